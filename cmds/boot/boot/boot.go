@@ -8,14 +8,60 @@
 
 //
 // Synopsis:
-//	boot [-v][-no-load][-no-exec]
+//	boot [-v][-no-load][-no-exec][-report][-json][-newest][-all-consoles][-keep-root][-grub-passwords][-splash dev][-splash-logo png][-keymap layout][-remote addr [-remote-keys file][-remote-hostkey file]]
 //
 // Description:
 //	If returns to u-root shell, the code didn't found a local bootable option
+//	and prints a report of every device scanned and why nothing on it was
+//	bootable.
 //
 //      -v prints messages
 //      -no-load prints the boot image paths it was going to load, but doesn't load + exec them
 //      -no-exec loads the boot image, but doesn't exec it
+//      -report prints the scan report even if something bootable was found
+//      -json prints the scan report as JSON
+//      -newest offers the entry with the newest kernel first
+//      -all-consoles shows the menu on, and takes input from, every console= console
+//      -keep-root leaves root= alone even if it names a device that does not exist
+//      -grub-passwords asks for a user name and password for entries GRUB restricts
+//      -splash shows progress and errors on a frame buffer, e.g. /dev/fb0
+//      -splash-logo shows a PNG image on the -splash screen
+//      -keymap sets the console keyboard layout for the menu and password prompts
+//      -remote lets operators see the menu and choose from it over SSH on addr, e.g. :2222
+//      -remote-keys are the authorized keys of -remote operators
+//      -remote-hostkey is the -remote host key, by default one made up for this boot
+//
+//	Kernel command lines, with -append, are Go templates over machine
+//	facts: {{.Serial}}, {{.SystemUUID}}, {{.MAC}} or {{.MAC "eth0"}},
+//	{{.Console}} and {{.RootUUID}}, of the device the config is on.
+//
+//	A root=/dev/... naming a device this kernel does not have, as written
+//	for another machine or distro, is pointed at the partition the kernel
+//	is on by PARTUUID (or UUID), if that holds a root file system.
+//
+//	GRUB entries restricted to some users, with superusers and menuentry
+//	--users, are booted without asking unless -grub-passwords is given, and
+//	each such entry is reported.
+//
+//	The menu and prompts are in the language of LANG= on the kernel
+//	command line, given catalogs of translations in /etc/l10n; see package
+//	l10n.
+//
+//	Before booting an entry, file systems are synced and unmounted, or
+//	remounted read-only if they are busy.
+//
+//	The -keymap layout, such as de or fr, defaults to vconsole.keymap= on
+//	the kernel command line, and is otherwise left as the kernel has it.
+//
+//	The -splash screen is drawn over whatever is on the frame buffer; boot
+//	the kernel without the frame buffer console (fbcon), or the console
+//	draws over it. The menu is still shown on the console.
+//
+//	-remote operators, logged in with one of the -remote-keys, are shown
+//	the menu and what it does, and may list, boot and change the kernel
+//	command line of entries, or hold the countdown to the default, for
+//	machines whose console cannot be reached. Without -remote-hostkey, the
+//	fingerprint of the host key made up is logged; see package menu.
 //
 // Notes:
 //	The code is looking for boot/grub/grub.cfg file as to identify the
@@ -29,16 +75,37 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
 	"flag"
+	"fmt"
+	"image/png"
+	"io/ioutil"
 	"log"
+	"net"
 	"os"
+	"sort"
 	"strings"
 
 	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/boot/facts"
+	"github.com/u-root/u-root/pkg/boot/grub"
+	"github.com/u-root/u-root/pkg/boot/kimage"
 	"github.com/u-root/u-root/pkg/boot/localboot"
 	"github.com/u-root/u-root/pkg/boot/menu"
+	"github.com/u-root/u-root/pkg/boot/splash"
 	"github.com/u-root/u-root/pkg/cmdline"
+	"github.com/u-root/u-root/pkg/console"
+	"github.com/u-root/u-root/pkg/fb"
+	"github.com/u-root/u-root/pkg/keymap"
+	"github.com/u-root/u-root/pkg/l10n"
 	"github.com/u-root/u-root/pkg/mount"
+	"github.com/u-root/u-root/pkg/mount/quiesce"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 var (
@@ -46,12 +113,149 @@ var (
 	verbose = flag.Bool("v", false, "Print debug messages")
 	noLoad  = flag.Bool("no-load", false, "print chosen boot configuration, but do not load + exec it")
 	noExec  = flag.Bool("no-exec", false, "load boot configuration, but do not exec it")
+	report  = flag.Bool("report", false, "print the scan report even if something bootable was found")
+	asJSON  = flag.Bool("json", false, "print the scan report as JSON")
+	newest  = flag.Bool("newest", false, "offer the entry with the newest kernel first")
+	allCons = flag.Bool("all-consoles", false, "mirror the menu to all consoles on the kernel command line and take input from any")
 
 	removeCmdlineItem = flag.String("remove", "console", "comma separated list of kernel params value to remove from parsed kernel configuration (default to console)")
 	reuseCmdlineItem  = flag.String("reuse", "console", "comma separated list of kernel params value to reuse from current kernel (default to console)")
-	appendCmdline     = flag.String("append", "", "Additional kernel params")
+	appendCmdline     = flag.String("append", "", "Additional kernel params, which may use machine facts such as {{.Serial}}")
+	grubPasswords     = flag.Bool("grub-passwords", false, "ask for the GRUB user name and password of entries GRUB restricts, rather than boot them regardless")
+	keepRoot          = flag.Bool("keep-root", false, "do not point a root= naming a device that does not exist at the kernel's partition")
+	splashDev         = flag.String("splash", "", "frame buffer device to show progress and errors on, e.g. /dev/fb0")
+	splashLogo        = flag.String("splash-logo", "", "PNG image to show on the -splash screen")
+	keymapName        = flag.String("keymap", "", "console keyboard layout, e.g. de (default vconsole.keymap= from the kernel command line)")
+	remoteAddr        = flag.String("remote", "", "address to let operators choose from the menu over SSH on, e.g. :2222")
+	remoteKeys        = flag.String("remote-keys", "/etc/ssh/authorized_keys", "authorized keys of -remote operators")
+	remoteHostKey     = flag.String("remote-hostkey", "", "host key of -remote, by default one made up for this boot")
+
+	// screen is the -splash screen, or nil.
+	screen *splash.Screen
 )
 
+// openSplash sets up the -splash screen.
+func openSplash() {
+	d, err := fb.Open(*splashDev)
+	if err != nil {
+		log.Printf("Cannot show splash screen: %v", err)
+		return
+	}
+	screen = splash.New(d, l10n.T("Booting"))
+	if *splashLogo == "" {
+		return
+	}
+	f, err := os.Open(*splashLogo)
+	if err != nil {
+		log.Printf("Cannot show splash logo: %v", err)
+		return
+	}
+	defer f.Close()
+	logo, err := png.Decode(f)
+	if err != nil {
+		log.Printf("Cannot show splash logo %s: %v", *splashLogo, err)
+		return
+	}
+	if err := screen.SetLogo(logo); err != nil {
+		log.Printf("Cannot show splash logo: %v", err)
+	}
+}
+
+// loadKeymap sets the console keyboard layout of -keymap or
+// vconsole.keymap=, if either is set.
+func loadKeymap() {
+	name := *keymapName
+	if name == "" {
+		name, _ = cmdline.Flag("vconsole.keymap")
+	}
+	if name == "" {
+		return
+	}
+	m, err := keymap.Layout(name)
+	if err != nil {
+		log.Printf("Cannot set keyboard layout: %v", err)
+		return
+	}
+	if err := m.LoadConsole(); err != nil {
+		log.Printf("Cannot set keyboard layout %s: %v", name, err)
+		return
+	}
+	debug("Keyboard layout is %s", name)
+}
+
+// startRemote serves the menu to -remote operators, returning nil if it
+// cannot.
+func startRemote() *menu.Remote {
+	b, err := ioutil.ReadFile(*remoteKeys)
+	if err != nil {
+		log.Printf("Cannot serve the menu remotely: %v", err)
+		return nil
+	}
+	var keys []ssh.PublicKey
+	for len(bytes.TrimSpace(b)) > 0 {
+		k, _, _, rest, err := ssh.ParseAuthorizedKey(b)
+		if err != nil {
+			log.Printf("Cannot serve the menu remotely: %s: %v", *remoteKeys, err)
+			return nil
+		}
+		keys = append(keys, k)
+		b = rest
+	}
+
+	var host ssh.Signer
+	if *remoteHostKey != "" {
+		b, err := ioutil.ReadFile(*remoteHostKey)
+		if err == nil {
+			host, err = ssh.ParsePrivateKey(b)
+		}
+		if err != nil {
+			log.Printf("Cannot serve the menu remotely: %v", err)
+			return nil
+		}
+	} else {
+		_, k, err := ed25519.GenerateKey(rand.Reader)
+		if err == nil {
+			host, err = ssh.NewSignerFromKey(k)
+		}
+		if err != nil {
+			log.Printf("Cannot serve the menu remotely: %v", err)
+			return nil
+		}
+		log.Printf("Remote menu host key: %s", ssh.FingerprintSHA256(host.PublicKey()))
+	}
+
+	l, err := net.Listen("tcp", *remoteAddr)
+	if err != nil {
+		log.Printf("Cannot serve the menu remotely: %v", err)
+		return nil
+	}
+	r := menu.NewRemote(host, keys)
+	go func() {
+		log.Printf("Remote menu: %v", r.Serve(l))
+	}()
+	log.Printf("Serving the menu on %v to %d keys", l.Addr(), len(keys))
+	return r
+}
+
+// status shows a line on the -splash screen, if there is one, translated.
+func status(format string, v ...interface{}) {
+	debug(format, v...)
+	if screen == nil {
+		return
+	}
+	if err := screen.Status("%s", l10n.Sprintf(format, v...)); err != nil {
+		debug("Cannot draw splash screen: %v", err)
+	}
+}
+
+// fatalf is log.Fatalf, which also shows the error on the -splash screen.
+func fatalf(format string, v ...interface{}) {
+	if screen != nil {
+		screen.Error(fmt.Errorf(format, v...))
+	}
+	log.Fatalf(format, v...)
+}
+
 // updateBootCmdline get the kernel command line parameters and filter it:
 // it removes parameters listed in 'remove' and append extra parameters from
 // the 'append' and 'reuse' flags
@@ -60,37 +264,209 @@ func updateBootCmdline(cl string) string {
 	return f.Update(cl)
 }
 
+// clearNextEntry removes a one-time grub-reboot entry from the partition
+// at mp, as GRUB itself does when it boots. Partitions are scanned
+// read-only, so this remounts mp read-write, and then back as it was.
+func clearNextEntry(mp *mount.MountPoint) {
+	var pending bool
+	for _, f := range grub.EnvFiles(mp.Path) {
+		if env, err := grub.ReadEnvFile(f); err == nil && len(env.Vars["next_entry"]) > 0 {
+			pending = true
+		}
+	}
+	if !pending {
+		return
+	}
+	if _, err := mount.Mount(mp.Device, mp.Path, mp.FSType, mp.Data, (mp.Flags|mount.MS_REMOUNT)&^mount.MS_RDONLY); err != nil {
+		log.Printf("Cannot clear GRUB next_entry on %s: %v", mp.Device, err)
+		return
+	}
+	defer func() {
+		if _, err := mount.Mount(mp.Device, mp.Path, mp.FSType, mp.Data, mp.Flags|mount.MS_REMOUNT); err != nil {
+			log.Printf("Cannot remount %s: %v", mp.Device, err)
+		}
+	}()
+	if _, err := grub.ClearNextEntry(mp.Path); err != nil {
+		log.Printf("Cannot clear GRUB next_entry on %s: %v", mp.Device, err)
+		return
+	}
+	debug("Cleared GRUB next_entry on %s", mp.Device)
+}
+
+// translateRoot points a root= of li that names a device that does not
+// exist at the partition li was found on.
+func translateRoot(li *boot.LinuxImage, rep *localboot.Report) {
+	var dir string
+	if mp := rep.MountOf(li); mp != nil {
+		dir = mp.Path
+	}
+	root, err := localboot.TranslateRoot(li, rep.DeviceOf(li), dir)
+	if err != nil {
+		log.Printf("%s may not find its root file system: %v", li.Label(), err)
+	} else if root != "" {
+		log.Printf("%s: root=%s", li.Label(), root)
+	}
+}
+
+// restrict makes a ask for a password if auth restricts who may boot it and
+// -grub-passwords is set, or else says that the restriction is bypassed.
+func restrict(a *menu.OSImageAction, auth *grub.Auth) {
+	if !auth.Restricted(a.OSImage) {
+		return
+	}
+	users := strings.Join(auth.Users(a.OSImage), ", ")
+	if !*grubPasswords {
+		log.Printf("GRUB restricts %s to %s; booting it without a password", a.OSImage.Label(), users)
+		return
+	}
+	a.Authenticate = func() error {
+		fmt.Printf("%s\n%s", l10n.Sprintf("%s may only be booted by %s.", a.OSImage.Label(), users), l10n.T("User name: "))
+		user, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil {
+			return err
+		}
+		fmt.Print(l10n.T("Password: "))
+		password, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Println()
+		if err != nil {
+			return err
+		}
+		return auth.Check(a.OSImage, strings.TrimSpace(user), string(password))
+	}
+}
+
+// kernelReleases returns the kernel release of each Linux image whose
+// kernel image has a version string.
+func kernelReleases(images []boot.OSImage) map[boot.OSImage]string {
+	releases := make(map[boot.OSImage]string)
+	for _, img := range images {
+		li, ok := img.(*boot.LinuxImage)
+		if !ok {
+			continue
+		}
+		info, err := li.KernelInfo()
+		if err != nil {
+			debug("Cannot inspect kernel of %s: %v", li.Label(), err)
+			continue
+		}
+		debug("%s: %s", li.Label(), info)
+		if info.Release != "" {
+			releases[img] = info.Release
+		}
+	}
+	return releases
+}
+
+// printReport prints what was found on each device, as text on stderr or
+// as JSON on stdout.
+func printReport(r *localboot.Report) {
+	if *asJSON {
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			log.Printf("Cannot encode report: %v", err)
+			return
+		}
+		fmt.Println(string(b))
+		return
+	}
+	if !r.Bootable() {
+		fmt.Fprintln(os.Stderr, l10n.T("Nothing bootable found. Devices scanned:"))
+	}
+	if err := r.WriteText(os.Stderr); err != nil {
+		log.Printf("Cannot print report: %v", err)
+	}
+}
+
 func main() {
 	flag.Parse()
 
 	if *verbose {
 		debug = log.Printf
 	}
+	if *allCons {
+		if devs, err := console.Devices(); err != nil {
+			log.Printf("Cannot find consoles: %v", err)
+		} else if m, err := console.Attach(devs); err != nil {
+			log.Printf("Cannot multiplex consoles: %v", err)
+		} else {
+			defer m.Close()
+		}
+	}
 
-	images, mps, err := localboot.Localboot()
+	if *splashDev != "" {
+		openSplash()
+	}
+	loadKeymap()
+
+	status("Looking for something to boot")
+	images, mps, rep, err := localboot.Localboot()
 	if err != nil {
-		log.Fatal(err)
+		fatalf("%v", err)
 	}
+	status("Found %d boot entries", len(images))
+	if *report || len(images) == 0 {
+		printReport(rep)
+	}
+	mf := &facts.Facts{}
 	for _, img := range images {
-		// Make changes to the kernel command line based on our cmdline.
+		// Make changes to the kernel command line based on our cmdline,
+		// and fill in machine facts.
 		if li, ok := img.(*boot.LinuxImage); ok {
 			li.Cmdline = updateBootCmdline(li.Cmdline)
+			mf.Root = rep.DeviceOf(img)
+			if cl, err := mf.Expand(li.Cmdline); err != nil {
+				log.Printf("Cannot fill in the command line of %s: %v", li.Label(), err)
+			} else {
+				li.Cmdline = cl
+			}
+			if !*keepRoot {
+				translateRoot(li, rep)
+			}
 		}
 	}
 
+	releases := kernelReleases(images)
+	if *newest {
+		// Images without a known release sort last.
+		sort.SliceStable(images, func(i, j int) bool {
+			return kimage.CompareRelease(releases[images[i]], releases[images[j]]) > 0
+		})
+	}
+
 	if *noLoad {
 		if len(images) > 0 {
 			log.Printf("Got configuration: %s", images[0])
 		} else {
-			log.Fatalf("Nothing bootable found.")
+			fatalf("Nothing bootable found.")
 		}
 		return
 	}
 	menuEntries := menu.OSImages(*verbose, images...)
+	for _, e := range menuEntries {
+		if a, ok := e.(*menu.OSImageAction); ok {
+			a.Release = releases[a.OSImage]
+			restrict(a, rep.AuthOf(a.OSImage))
+		}
+	}
 	menuEntries = append(menuEntries, menu.Reboot{})
+	if menu.FirmwareSetupSupported() {
+		menuEntries = append(menuEntries, menu.RebootToFirmware{})
+	}
 	menuEntries = append(menuEntries, menu.StartShell{})
 
-	chosenEntry := menu.ShowMenuAndLoad(os.Stdin, menuEntries...)
+	var remote *menu.Remote
+	if *remoteAddr != "" {
+		remote = startRemote()
+	}
+	chosenEntry := remote.ShowMenuAndLoad(os.Stdin, menuEntries...)
+
+	// The one-time entry has been honored once the image of its partition
+	// is booted, and not before: the choice may still be something else.
+	if a, ok := chosenEntry.(*menu.OSImageAction); ok && !*noExec {
+		if mp := rep.MountOf(a.OSImage); mp != nil {
+			clearNextEntry(mp)
+		}
+	}
 
 	// Clean up.
 	for _, mp := range mps {
@@ -99,15 +475,22 @@ func main() {
 		}
 	}
 	if chosenEntry == nil {
-		log.Fatalf("Nothing to boot.")
+		fatalf("Nothing to boot.")
 	}
 	if *noExec {
 		log.Printf("Chosen menu entry: %s", chosenEntry)
 		os.Exit(0)
 	}
+	status("Booting %s", chosenEntry.Label())
+	if _, ok := chosenEntry.(*menu.OSImageAction); ok {
+		// There is nothing to go back to if kexec fails.
+		if err := quiesce.Quiesce(quiesce.Options{Logf: debug}); err != nil {
+			log.Printf("Not all storage could be quiesced: %v", err)
+		}
+	}
 	// Exec should either return an error or not return at all.
 	if err := chosenEntry.Exec(); err != nil {
-		log.Fatalf("Failed to exec %s: %v", chosenEntry, err)
+		fatalf("Failed to exec %s: %v", chosenEntry, err)
 	}
 
 	// Kexec should either return an error or not return.
@@ -28,6 +28,7 @@ import (
 	"github.com/insomniacslk/dhcp/netboot"
 	"github.com/u-root/u-root/pkg/boot/kexec"
 	"github.com/u-root/u-root/pkg/crypto"
+	"github.com/u-root/u-root/pkg/ipmi"
 )
 
 var (
@@ -174,6 +175,7 @@ func boot(ifname string, dhcp dhcpFunc) error {
 			if err = netboot.ConfigureInterface(ifname, &bootconf.NetConf); err != nil {
 				return fmt.Errorf("DHCP: cannot configure interface %s: %v", ifname, err)
 			}
+			milestone(ipmi.MilestoneNetworkUp)
 		}
 		if *overrideNetbootURL != "" {
 			bootconf.BootfileURL = *overrideNetbootURL
@@ -253,6 +255,7 @@ func boot(ifname string, dhcp dhcpFunc) error {
 		if err = kexec.FileLoad(kernel, nil /* ramfs */, cmdline); err != nil {
 			return fmt.Errorf("DHCP: kexec.FileLoad failed: %v", err)
 		}
+		milestone(ipmi.MilestoneKexec)
 		if err = kexec.Reboot(); err != nil {
 			return fmt.Errorf("DHCP: kexec.Reboot failed: %v", err)
 		}
@@ -369,3 +372,10 @@ func dhcp4(ifname string) (*netboot.BootConf, error) {
 	}
 	return netboot.ConversationToNetconfv4(conversation)
 }
+
+// milestone tells the BMC, if there is one, how far the boot got.
+func milestone(m ipmi.Milestone) {
+	if err := ipmi.ReportMilestone(m); err != nil {
+		debug("IPMI: cannot report boot milestone %#02x: %v", byte(m), err)
+	}
+}
@@ -23,15 +23,21 @@ import (
 	"context"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/u-root/u-root/pkg/boot"
+	// Lets LOCALBOOT and chain.c32 menu entries boot local disks.
+	_ "github.com/u-root/u-root/pkg/boot/localboot"
 	"github.com/u-root/u-root/pkg/boot/menu"
 	"github.com/u-root/u-root/pkg/boot/netboot"
 	"github.com/u-root/u-root/pkg/curl"
 	"github.com/u-root/u-root/pkg/dhclient"
+	"github.com/u-root/u-root/pkg/netconsole"
 	"github.com/u-root/u-root/pkg/ulog"
 )
 
@@ -41,6 +47,7 @@ var (
 	noExec      = flag.Bool("no-exec", false, "download boot configuration, but do not exec it")
 	noNetConfig = flag.Bool("no-net-config", false, "get DHCP response, but do not apply the network config it to the kernel interface")
 	verbose     = flag.Bool("v", false, "Verbose output")
+	netconsTo   = flag.String("netconsole", "", "send kernel and pxeboot messages to HOST[:PORT], or to the DHCP log server if \"dhcp\"")
 )
 
 const (
@@ -93,6 +100,13 @@ func NetbootImages(ifaceNames string) ([]boot.OSImage, error) {
 				// ip/ipv6 address.
 			}
 
+			if *netconsTo != "" && !*noNetConfig {
+				if err := startNetconsole(result.Lease, *netconsTo); err != nil {
+					log.Printf("Netconsole: %v", err)
+				}
+				*netconsTo = ""
+			}
+
 			// Don't use the other context, as it's for the DHCP timeout.
 			imgs, err := netboot.BootImages(context.Background(), ulog.Log, curl.DefaultSchemes, result.Lease)
 			if err != nil {
@@ -104,6 +118,35 @@ func NetbootImages(ifaceNames string) ([]boot.OSImage, error) {
 	}
 }
 
+// startNetconsole sends kernel messages and our log to to, a HOST[:PORT] or
+// "dhcp", over the interface of the configured lease l.
+func startNetconsole(l dhclient.Lease, to string) error {
+	var remote *net.UDPAddr
+	if to != "dhcp" {
+		if _, _, err := net.SplitHostPort(to); err != nil {
+			to = net.JoinHostPort(to, strconv.Itoa(netconsole.DefaultRemotePort))
+		}
+		var err error
+		if remote, err = net.ResolveUDPAddr("udp4", to); err != nil {
+			return err
+		}
+	}
+	t, err := netconsole.FromLease(l, remote)
+	if err != nil {
+		return err
+	}
+	if err := netconsole.Configure("pxeboot", t); err != nil {
+		return err
+	}
+	c, err := netconsole.Dial(t.Remote())
+	if err != nil {
+		return err
+	}
+	log.SetOutput(io.MultiWriter(os.Stderr, c))
+	log.Printf("Netconsole to %v", t.Remote())
+	return nil
+}
+
 func main() {
 	flag.Parse()
 	if len(flag.Args()) > 1 {
@@ -19,6 +19,7 @@ import (
 	"time"
 
 	"github.com/u-root/u-root/pkg/boot/stboot"
+	"github.com/u-root/u-root/pkg/ipmi"
 	"github.com/u-root/u-root/pkg/recovery"
 )
 
@@ -67,6 +68,7 @@ func main() {
 		debug = log.Printf
 	}
 	log.Print(banner)
+	milestone(ipmi.MilestoneInitStart)
 
 	vars, err := stboot.FindHostVarsInInitramfs()
 	if err != nil {
@@ -87,6 +89,7 @@ func main() {
 	if err != nil {
 		reboot("Can not set up IO: %v", err)
 	}
+	milestone(ipmi.MilestoneNetworkUp)
 
 	err = validateSystemTime()
 	if err != nil {
@@ -149,6 +152,7 @@ func main() {
 
 	log.Printf("Bootconfig '%s' passed verification", bc.Name)
 	log.Print(check)
+	milestone(ipmi.MilestoneImageVerified)
 
 	if *dryRun {
 		debug("Dryrun mode: will not boot")
@@ -156,6 +160,7 @@ func main() {
 	}
 
 	log.Println("Starting up new kernel.")
+	milestone(ipmi.MilestoneKexec)
 
 	if err := bc.Boot(); err != nil {
 		log.Printf("Failed to boot kernel %s: %v", bc.Kernel, err)
@@ -164,6 +169,13 @@ func main() {
 	reboot("No boot configuration succeeded")
 }
 
+// milestone tells the BMC, if there is one, how far the boot got.
+func milestone(m ipmi.Milestone) {
+	if err := ipmi.ReportMilestone(m); err != nil {
+		debug("IPMI: cannot report boot milestone %#02x: %v", byte(m), err)
+	}
+}
+
 // matchFingerprint returns true if fingerprintHex matches the SHA256
 // hash calculated from pem decoded certPEM.
 func matchFingerprint(certPEM []byte, fingerprintHex string) bool {
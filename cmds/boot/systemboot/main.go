@@ -194,6 +194,9 @@ func main() {
                            |___/
 `)
 	runIPMICommands()
+	if err := ipmi.ReportMilestone(ipmi.MilestoneInitStart); err != nil {
+		log.Printf("Failed to report boot progress to the BMC: %v", err)
+	}
 	sleepInterval := time.Duration(*interval) * time.Second
 	if *allowInteractive {
 		log.Printf("**************************************************************************")
@@ -5,19 +5,33 @@
 // gpt reads and writes GPT headers.
 //
 // Synopsis:
-//     gpt [-w] file
+//     gpt [-b backup] [-w [-l backup]] [-R target] [-G] file
 //
 // Description:
-//     For -w, it reads a JSON formatted GPT from stdin, and writes 'file'
-//     which is usually a device. It writes both primary and secondary headers.
+//     For -w, it reads a JSON formatted GPT from stdin, or the backup file
+//     given with -l, and writes 'file' which is usually a device. It writes
+//     the MBR and both primary and secondary headers, with the secondary
+//     header moved to the end of 'file' if it is a different size from the
+//     disk the GPT came from.
+//
+//     For -b, it writes the headers of 'file' to the backup file in JSON
+//     format. For -R, it copies the GPT of 'file' to the target device.
 //
 //     Otherwise it just writes the headers to stdout in JSON format.
+//
+// Options:
+//     -b: back up the GPT of file to this file
+//     -l: with -w, read the GPT from this file rather than stdin
+//     -R: replicate the GPT of file onto this device
+//     -G: give the disk and its partitions new unique GUIDs when writing
+//     -w: write GPT to file
 package main
 
 import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"os"
 
@@ -27,7 +41,11 @@ import (
 const cmd = "gpt [options] file"
 
 var (
-	write = flag.Bool("w", false, "Write GPT to file")
+	write     = flag.Bool("w", false, "Write GPT to file")
+	backup    = flag.String("b", "", "Back up the GPT of file to this file")
+	load      = flag.String("l", "", "With -w, read the GPT from this file rather than stdin")
+	replicate = flag.String("R", "", "Replicate the GPT of file onto this device")
+	newGUIDs  = flag.Bool("G", false, "Give the disk and partitions new unique GUIDs when writing")
 )
 
 func init() {
@@ -39,44 +57,86 @@ func init() {
 	}
 }
 
+// writeTable writes p to the device or image n, fitted to its size.
+func writeTable(n string, p *gpt.PartitionTable) error {
+	f, err := os.OpenFile(n, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	size, err := gpt.Size(f)
+	if err != nil {
+		return err
+	}
+	c, err := gpt.Clone(p, size, *newGUIDs)
+	if err != nil {
+		return err
+	}
+	if err := gpt.Write(f, c); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
 func main() {
 	flag.Parse()
-	if flag.NArg() != 1 {
+	if flag.NArg() != 1 || (*write && (*backup != "" || *replicate != "")) || (*load != "" && !*write) {
 		flag.Usage()
 	}
 
-	m := os.O_RDONLY
-	if *write {
-		m = os.O_RDWR
-	}
-
 	n := flag.Args()[0]
-	f, err := os.OpenFile(n, m, 0)
-	if err != nil {
-		log.Fatal(err)
-	}
 
-	switch *write {
-	case true:
+	if *write {
+		in := os.Stdin
+		if *load != "" {
+			f, err := os.Open(*load)
+			if err != nil {
+				log.Fatal(err)
+			}
+			defer f.Close()
+			in = f
+		}
 		var p = &gpt.PartitionTable{}
-		if err := json.NewDecoder(os.Stdin).Decode(&p); err != nil {
+		if err := json.NewDecoder(in).Decode(&p); err != nil {
 			log.Fatalf("Reading in JSON: %v", err)
 		}
-		if err := gpt.Write(f, p); err != nil {
+		if err := writeTable(n, p); err != nil {
 			log.Fatalf("Writing %v: %v", n, err)
 		}
-	default:
-		// We might get one back, we might get both.
-		// In the event of an error, we show what we can
-		// so you can at least see what went wrong.
-		p, err := gpt.New(f)
-		if err != nil {
-			log.Printf("Error reading %v: %v", n, err)
+		return
+	}
+
+	f, err := os.Open(n)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// We might get one back, we might get both.
+	// In the event of an error, we show what we can
+	// so you can at least see what went wrong.
+	p, err := gpt.New(f)
+	if err != nil {
+		if *backup != "" || *replicate != "" {
+			log.Fatalf("Reading %v: %v", n, err)
 		}
-		// Emit this as a JSON array. Suggestions welcome on better ways to do this.
-		if _, err := fmt.Printf("%s\n", p); err != nil {
+		log.Printf("Error reading %v: %v", n, err)
+	}
+
+	if *backup != "" {
+		if err := ioutil.WriteFile(*backup, []byte(p.String()+"\n"), 0644); err != nil {
 			log.Fatal(err)
 		}
+	}
+	if *replicate != "" {
+		if err := writeTable(*replicate, p); err != nil {
+			log.Fatalf("Writing %v: %v", *replicate, err)
+		}
+	}
+	if *backup != "" || *replicate != "" {
+		return
+	}
 
+	// Emit this as a JSON array. Suggestions welcome on better ways to do this.
+	if _, err := fmt.Printf("%s\n", p); err != nil {
+		log.Fatal(err)
 	}
 }
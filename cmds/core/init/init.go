@@ -18,6 +18,7 @@ import (
 	"os/exec"
 	"syscall"
 
+	"github.com/u-root/u-root/pkg/boot/deadline"
 	"github.com/u-root/u-root/pkg/cmdline"
 	"github.com/u-root/u-root/pkg/libinit"
 	"github.com/u-root/u-root/pkg/uflag"
@@ -60,8 +61,17 @@ func main() {
 
 	libinit.SetEnv()
 	libinit.CreateRootfs()
+	libinit.ConfigurePanic()
 	libinit.NetInit()
 
+	// Reboot, or take another uroot.bootdeadline_action, if no OS is
+	// booted within uroot.bootdeadline.
+	if d, a, err := deadline.FromCmdline(); err != nil {
+		log.Printf("Boot deadline: %v", err)
+	} else if d > 0 {
+		deadline.Start(d, a)
+	}
+
 	// Potentially exec systemd if we have been asked to.
 	osInitGo()
 
@@ -14,6 +14,7 @@ import (
 
 	"github.com/u-root/u-root/pkg/cmdline"
 	"github.com/u-root/u-root/pkg/kmodule"
+	"github.com/u-root/u-root/pkg/rng"
 )
 
 // installModules installs kernel modules (.ko files) from /lib/modules.
@@ -50,6 +51,39 @@ func installModules() {
 	}
 }
 
+// seedRNG seeds the kernel's RNG from whatever is available, so that
+// netbooting over TLS does not block on a headless machine. A seed file
+// from a previous boot can be named with uroot.initflags="seedfile=PATH".
+func seedRNG(initFlags map[string]string) {
+	trustCPU, _ := cmdline.Flag("random.trust_cpu")
+	sources := []*rng.Source{rng.HwRandomSource(), rng.TPMSource()}
+	if s := rng.CPUSource(trustCPU == "on" || trustCPU == "1"); s != nil {
+		sources = append(sources, s)
+	}
+	if path, ok := initFlags["seedfile"]; ok {
+		sources = append(sources, rng.SeedFileSource(path, false))
+	}
+
+	var bits int
+	var used []string
+	res := rng.Seed(sources)
+	for _, r := range res {
+		if r.Bytes > 0 {
+			bits += r.Bits
+			used = append(used, r.Name)
+		}
+	}
+	if bits > 0 {
+		log.Printf("seedRNG: credited %d bits of entropy from %s", bits, strings.Join(used, ", "))
+		return
+	}
+	for _, r := range res {
+		if r.Err != nil {
+			log.Printf("seedRNG: %s: %v", r.Name, r.Err)
+		}
+	}
+}
+
 func init() {
 	osInitGo = runOSInitGo
 }
@@ -58,10 +92,14 @@ func runOSInitGo() {
 	// Install modules before exec-ing into user mode below
 	installModules()
 
+	initFlags := cmdline.GetInitFlagMap()
+
+	// After modules, which may include virtio-rng or a TPM driver.
+	seedRNG(initFlags)
+
 	// systemd is "special". If we are supposed to run systemd, we're
 	// going to exec, and if we're going to exec, we're done here.
 	// systemd uber alles.
-	initFlags := cmdline.GetInitFlagMap()
 
 	// systemd gets upset when it discovers it isn't really process 1, so
 	// we can't start it in its own namespace. I just love systemd.
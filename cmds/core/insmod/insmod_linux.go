@@ -5,13 +5,19 @@
 // insmod inserts a module into the running Linux kernel.
 //
 // Synopsis:
-//	insmod [filename] [module options...]
+//	insmod [-keys FILE] [-require-signed] [filename] [module options...]
 //
 // Description:
 //	insmod is a clone of insmod(8)
+//
+//	Modules are checked against the signing certificates in FILE, by default
+//	/etc/kmodule/signing_keys.pem if it exists, before they are loaded; badly
+//	signed modules are refused. Unsigned modules are refused with
+//	-require-signed, or module.sig_enforce=1 on the kernel command line.
 package main
 
 import (
+	"flag"
 	"log"
 	"os"
 	"strings"
@@ -19,16 +25,27 @@ import (
 	"github.com/u-root/u-root/pkg/kmodule"
 )
 
+var (
+	keys          = flag.String("keys", "", "file of module signing certificates")
+	requireSigned = flag.Bool("require-signed", false, "refuse unsigned modules")
+)
+
 func main() {
-	if len(os.Args) < 2 {
+	flag.Parse()
+	if flag.NArg() < 1 {
 		log.Fatalf("insmod: ERROR: missing filename.\n")
 	}
 
-	// get filename from argv[1]
-	filename := os.Args[1]
+	// get filename from the first argument
+	filename := flag.Arg(0)
 
 	// Everything else is module options
-	options := strings.Join(os.Args[2:], " ")
+	options := strings.Join(flag.Args()[1:], " ")
+
+	p, err := kmodule.NewPolicy(*keys, *requireSigned)
+	if err != nil {
+		log.Fatalf("insmod: %v", err)
+	}
 
 	f, err := os.Open(filename)
 	if err != nil {
@@ -36,7 +53,7 @@ func main() {
 	}
 	defer f.Close()
 
-	if err := kmodule.FileInit(f, options, 0); err != nil {
+	if err := kmodule.FileInitPolicy(f, options, 0, p); err != nil {
 		log.Fatalf("insmod: could not load %q: %v", filename, err)
 	}
 }
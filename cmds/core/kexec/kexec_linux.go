@@ -5,7 +5,7 @@
 // kexec executes a new kernel over the running kernel (u-root).
 //
 // Synopsis:
-//     kexec [--initrd=FILE] [--command-line=STRING] [-l] [-e] [KERNELIMAGE]
+//     kexec [--initrd=FILE] [--command-line=STRING] [-l] [-e] [--stop-arrays] [--standby] [KERNELIMAGE]
 //
 // Description:
 //		 Loads a kernel for later execution.
@@ -16,6 +16,11 @@
 //     --i=FILE or --initrd=FILE:     Use file as the kernel's initial ramdisk
 //     -l or --load:                  Load the new kernel into the current kernel
 //     -e or --exec:                  Execute a currently loaded kernel
+//     --stop-arrays:                 Stop md and dm devices before executing
+//     --standby:                     Spin disks down before executing
+//
+// Before executing, file systems are synced and unmounted, or remounted
+// read-only if they are busy.
 package main
 
 import (
@@ -29,6 +34,7 @@ import (
 	"github.com/u-root/u-root/pkg/boot/kexec"
 	"github.com/u-root/u-root/pkg/boot/multiboot"
 	"github.com/u-root/u-root/pkg/cmdline"
+	"github.com/u-root/u-root/pkg/mount/quiesce"
 	"github.com/u-root/u-root/pkg/uio"
 )
 
@@ -40,6 +46,8 @@ type options struct {
 	exec         bool
 	debug        bool
 	modules      []string
+	stopArrays   bool
+	standby      bool
 }
 
 func registerFlags() *options {
@@ -50,6 +58,8 @@ func registerFlags() *options {
 	flag.BoolVarP(&o.load, "load", "l", false, "Load the new kernel into the current kernel")
 	flag.BoolVarP(&o.exec, "exec", "e", false, "Execute a currently loaded kernel")
 	flag.BoolVarP(&o.debug, "debug", "d", false, "Print debug info")
+	flag.BoolVar(&o.stopArrays, "stop-arrays", false, "Stop md and dm devices before executing")
+	flag.BoolVar(&o.standby, "standby", false, "Spin disks down before executing")
 	flag.StringArrayVar(&o.modules, "module", nil, `Load module with command line args (e.g --module="mod arg1")`)
 	return o
 }
@@ -114,6 +124,13 @@ func main() {
 	}
 
 	if opts.exec {
+		q := quiesce.Options{StopArrays: opts.stopArrays, Standby: opts.standby}
+		if opts.debug {
+			q.Logf = log.Printf
+		}
+		if err := quiesce.Quiesce(q); err != nil {
+			log.Printf("Not all storage could be quiesced: %v", err)
+		}
 		if err := kexec.Reboot(); err != nil {
 			log.Fatalf("%v", err)
 		}
@@ -11,6 +11,9 @@
 //     -n: just show numbers
 //     -c: dump config space
 //     -s: specify glob for choosing devices.
+//     -sriov: show the SR-IOV state and virtual functions of devices
+//     -numvfs: enable this many SR-IOV virtual functions of the devices,
+//         0 to disable them
 package main
 
 import (
@@ -27,6 +30,8 @@ var (
 	numbers    = flag.Bool("n", false, "Show numeric IDs")
 	dumpConfig = flag.Bool("c", false, "Dump config space")
 	devs       = flag.String("s", "*", "Devices to match")
+	sriov      = flag.Bool("sriov", false, "Show SR-IOV state and virtual functions")
+	numVFs     = flag.Int("numvfs", -1, "Enable this many SR-IOV virtual functions, 0 to disable them")
 	format     = map[int]string{
 		32: "%08x:%08x",
 		16: "%08x:%04x",
@@ -105,6 +110,37 @@ func registers(d pci.Devices, cmds ...string) {
 
 	}
 }
+
+// showSRIOV adds the SR-IOV state and VFs of the physical functions of d to
+// their ExtraInfo.
+func showSRIOV(d pci.Devices) {
+	for _, p := range d {
+		s, err := p.SRIOV()
+		if err == pci.ErrNoSRIOV {
+			continue
+		}
+		if err != nil {
+			p.ExtraInfo = append(p.ExtraInfo, fmt.Sprintf("SR-IOV: %v", err))
+			continue
+		}
+		p.ExtraInfo = append(p.ExtraInfo, s.String())
+		vfs, err := p.VFs()
+		if err != nil {
+			p.ExtraInfo = append(p.ExtraInfo, fmt.Sprintf("VFs: %v", err))
+			continue
+		}
+		for _, vf := range vfs {
+			drv, err := vf.Driver()
+			if err != nil {
+				drv = err.Error()
+			} else if drv == "" {
+				drv = "no driver"
+			}
+			p.ExtraInfo = append(p.ExtraInfo, fmt.Sprintf("  VF %s: %s", vf.Addr, drv))
+		}
+	}
+}
+
 func main() {
 	flag.Parse()
 	r, err := pci.NewBusReader(strings.Split(*devs, ",")...)
@@ -123,6 +159,16 @@ func main() {
 	if len(flag.Args()) > 0 {
 		registers(d, flag.Args()...)
 	}
+	if *numVFs >= 0 {
+		for _, p := range d {
+			if err := p.SetNumVFs(*numVFs); err != nil && err != pci.ErrNoSRIOV {
+				log.Printf("%s: %v", p.Addr, err)
+			}
+		}
+	}
+	if *sriov {
+		showSRIOV(d)
+	}
 	if *dumpConfig {
 		d.ReadConfig()
 	}
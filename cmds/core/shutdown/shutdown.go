@@ -5,49 +5,116 @@
 // shutdown halts, suspends, or reboots.
 //
 // Synopsis:
-//     shutdown [-h|-r|halt|reboot|suspend]
+//     shutdown [-h|-r|-s|halt|reboot [MODE] [METHOD]|suspend|hibernate|sleep|firmware|capsule]
 //
 // Description:
-//     current operations are reboot (-r), suspend, and halt [-h].
+//     current operations are reboot (-r), suspend, and halt [-h]. What is
+//     done is logged in the BMC's SEL, if there is a BMC.
 //
 // Options:
 //     -r|reboot:	reboot the machine.
 //     -h|halt:		halt the machine.
-//     -s|suspend:	suspend the machine.
+//     -s|suspend|hibernate:
+//			suspend the machine to disk, if it can be resumed.
+//     sleep:		suspend the machine to RAM (ACPI S3).
+//     firmware:	reboot into the UEFI firmware's setup.
+//     capsule:		reboot and have the UEFI firmware apply the
+//			capsules in \EFI\UpdateCapsule on the ESP.
+//
+//     Reboots take a MODE of cold, warm, hard, soft or gpio, and on x86 a
+//     METHOD of acpi, efi, bios, kbd, triple or pci, as reboot= on the
+//     kernel command line does (Linux 5.11 and later).
 package main
 
 import (
 	"log"
 	"os"
 
-	"golang.org/x/sys/unix"
+	"github.com/u-root/u-root/pkg/efivar"
+	"github.com/u-root/u-root/pkg/shutdown"
 )
 
 var (
-	opcodes = map[string]uint{
-		"halt":    unix.LINUX_REBOOT_CMD_POWER_OFF,
-		"-h":      unix.LINUX_REBOOT_CMD_POWER_OFF,
-		"reboot":  unix.LINUX_REBOOT_CMD_RESTART,
-		"-r":      unix.LINUX_REBOOT_CMD_RESTART,
-		"suspend": unix.LINUX_REBOOT_CMD_SW_SUSPEND,
-		"-s":      unix.LINUX_REBOOT_CMD_SW_SUSPEND,
+	// indications are reboots that ask something of the firmware.
+	indications = map[string]efivar.OSIndications{
+		"firmware": efivar.BootToFWUI,
+		"capsule":  efivar.FileCapsuleDelivery,
+	}
+	modes = map[string]shutdown.Mode{
+		"cold": shutdown.Cold,
+		"warm": shutdown.Warm,
+		"hard": shutdown.Hard,
+		"soft": shutdown.Soft,
+		"gpio": shutdown.GPIO,
 	}
-	reboot = unix.Reboot
+	methods = map[string]shutdown.Method{
+		"acpi":   shutdown.ACPI,
+		"efi":    shutdown.EFI,
+		"bios":   shutdown.BIOS,
+		"kbd":    shutdown.Keyboard,
+		"triple": shutdown.Triple,
+		"pci":    shutdown.PCI,
+	}
+
+	powerOff         = shutdown.PowerOff
+	reboot           = shutdown.Reboot
+	hibernate        = shutdown.Hibernate
+	sleep            = shutdown.Sleep
+	setRebootMode    = shutdown.SetRebootMode
+	setOSIndications = efivar.SetOSIndications
 )
 
 func usage() {
-	log.Fatalf("shutdown [-h|-r|-s|halt|reboot|suspend] (defaults to halt)")
+	log.Fatalf("shutdown [-h|-r|-s|halt|reboot [MODE] [METHOD]|suspend|hibernate|sleep|firmware|capsule] (defaults to halt)")
 }
 
 func main() {
 	if len(os.Args) == 1 {
 		os.Args = append(os.Args, "halt")
 	}
-	op, ok := opcodes[os.Args[1]]
-	if !ok || len(os.Args) > 2 {
+	op := os.Args[1]
+	ind, isInd := indications[op]
+	isReboot := isInd || op == "reboot" || op == "-r"
+
+	var mode shutdown.Mode
+	var method shutdown.Method
+	for _, a := range os.Args[2:] {
+		m, isMode := modes[a]
+		t, isMethod := methods[a]
+		switch {
+		case isReboot && isMode && mode == "":
+			mode = m
+		case isReboot && isMethod && method == "":
+			method = t
+		default:
+			usage()
+		}
+	}
+
+	var err error
+	switch {
+	case isReboot:
+		if mode != "" || method != "" {
+			if err := setRebootMode(mode, method); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if isInd {
+			if err := setOSIndications(ind); err != nil {
+				log.Fatalf("%s: %v", op, err)
+			}
+		}
+		err = reboot()
+	case op == "halt" || op == "-h":
+		err = powerOff()
+	case op == "suspend" || op == "-s" || op == "hibernate":
+		err = hibernate()
+	case op == "sleep":
+		err = sleep()
+	default:
 		usage()
 	}
-	if err := reboot(int(op)); err != nil {
-		log.Fatalf(err.Error())
+	if err != nil {
+		log.Fatal(err)
 	}
 }
@@ -10,7 +10,8 @@ import (
 	"syscall"
 	"testing"
 
-	"golang.org/x/sys/unix"
+	"github.com/u-root/u-root/pkg/efivar"
+	"github.com/u-root/u-root/pkg/shutdown"
 )
 
 var tests = []struct {
@@ -27,6 +28,14 @@ var tests = []struct {
 	{[]string{"-r"}, 3},
 	{[]string{"suspend"}, 4},
 	{[]string{"-s"}, 4},
+	{[]string{"firmware"}, 5},
+	{[]string{"capsule"}, 6},
+	{[]string{"hibernate"}, 4},
+	{[]string{"sleep"}, 7},
+	{[]string{"reboot", "warm", "efi"}, 8},
+	{[]string{"-r", "cold"}, 9},
+	{[]string{"reboot", "cold", "warm"}, 1},
+	{[]string{"sleep", "warm"}, 1},
 }
 
 func TestShutdown(t *testing.T) {
@@ -55,21 +64,44 @@ func TestHelperProcess(t *testing.T) {
 		return
 	}
 
-	reboot = func(i int) error {
-		xval := 1
-		switch uint32(i) {
-		case unix.LINUX_REBOOT_CMD_POWER_OFF:
-			xval = 2
-		case unix.LINUX_REBOOT_CMD_RESTART:
-			xval = 3
-		case unix.LINUX_REBOOT_CMD_SW_SUSPEND:
-			xval = 4
+	var ind efivar.OSIndications
+	var mode shutdown.Mode
+	var method shutdown.Method
+	setOSIndications = func(o efivar.OSIndications) error {
+		ind = o
+		return nil
+	}
+	setRebootMode = func(m shutdown.Mode, t shutdown.Method) error {
+		mode, method = m, t
+		return nil
+	}
+	powerOff = func() error {
+		os.Exit(2)
+		return nil
+	}
+	reboot = func() error {
+		xval := 3
+		switch {
+		case ind == efivar.BootToFWUI:
+			xval = 5
+		case ind == efivar.FileCapsuleDelivery:
+			xval = 6
+		case mode == shutdown.Warm && method == shutdown.EFI:
+			xval = 8
+		case mode == shutdown.Cold && method == "":
+			xval = 9
 		}
-
-		t.Logf("Exit with %#x", i)
 		os.Exit(xval)
 		return nil
 	}
+	hibernate = func() error {
+		os.Exit(4)
+		return nil
+	}
+	sleep = func() error {
+		os.Exit(7)
+		return nil
+	}
 
 	os.Args = append([]string{"shutdown"}, os.Args[3:]...)
 	main()
@@ -21,7 +21,7 @@ var (
 )
 
 func usage() string {
-	return "switch_root [-h] [-V]\nswitch_root newroot init"
+	return "switch_root [-h] [-V]\nswitch_root newroot [init [arg...]]"
 }
 
 func main() {
@@ -42,10 +42,11 @@ func main() {
 		os.Exit(0)
 	}
 
-	newRoot := flag.Args()[0]
-	init := flag.Args()[1]
-
-	if err := mount.SwitchRoot(newRoot, init); err != nil {
+	o := mount.SwitchRootOptions{NewRoot: flag.Arg(0), Init: flag.Arg(1)}
+	if flag.NArg() > 2 {
+		o.Args = flag.Args()[2:]
+	}
+	if err := mount.SwitchRootWithOptions(o); err != nil {
 		log.Fatalf("switch_root failed %v\n", err)
 	}
 }
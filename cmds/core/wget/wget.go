@@ -5,18 +5,31 @@
 // Wget reads one file from a url and writes to stdout.
 //
 // Synopsis:
-//     wget URL
+//     wget [ARGS] URL
 //
 // Description:
 //     Returns a non-zero code on failure.
 //
+//     With -peers, HTTP files are fetched in chunks from the listed peers
+//     where they have them, and from URL otherwise. With -serve, chunks
+//     are served to peers while downloading and for -seed afterwards.
+//     Peers are trusted; verify the file afterwards.
+//
 // Notes:
 //     There are a few differences with GNU wget:
 //     - Upon error, the return value is always 1.
 //     - The protocol (http/https) is mandatory.
 //
+// Options:
+//     -O:     output file
+//     -peers: comma-separated base URLs of peers
+//     -serve: address to serve chunks to peers on, e.g. :8081
+//     -seed:  how long to keep serving after the download
+//     -progress: progress output: auto, tty, lines, json or none (default)
+//
 // Example:
 //     wget -O google.txt http://google.com/
+//     wget -serve :8081 -peers http://10.0.0.2:8081/,http://10.0.0.3:8081/ http://10.0.0.1/disk.img
 package main
 
 import (
@@ -24,18 +37,50 @@ import (
 	"flag"
 	"io"
 	"log"
+	"net"
+	"net/http"
 	"net/url"
 	"os"
 	"path"
+	"strings"
+	"time"
 
 	"github.com/u-root/u-root/pkg/curl"
+	"github.com/u-root/u-root/pkg/progress"
 	"github.com/u-root/u-root/pkg/uio"
 )
 
 var (
 	outPath = flag.String("O", "", "output file")
+	peers   = flag.String("peers", "", "comma-separated base URLs of peers to fetch chunks from")
+	serve   = flag.String("serve", "", "address to serve chunks to peers on")
+	seed    = flag.Duration("seed", 0, "how long to keep serving peers after the download")
+	mode    = flag.String("progress", progress.None, "progress output: auto, tty, lines, json or none")
 )
 
+// peerClient returns the client for HTTP downloads shared with peers.
+func peerClient() (*curl.PeerClient, error) {
+	pc := &curl.PeerClient{}
+	for _, p := range strings.Split(*peers, ",") {
+		if len(p) == 0 {
+			continue
+		}
+		u, err := url.Parse(p)
+		if err != nil {
+			return nil, err
+		}
+		pc.Peers = append(pc.Peers, u)
+	}
+	if len(*serve) > 0 {
+		l, err := net.Listen("tcp", *serve)
+		if err != nil {
+			return nil, err
+		}
+		go http.Serve(l, pc.Handler())
+	}
+	return pc, nil
+}
+
 func usage() {
 	log.Printf("Usage: %s [ARGS] URL\n", os.Args[0])
 	flag.PrintDefaults()
@@ -75,6 +120,14 @@ func main() {
 		"https": curl.DefaultHTTPClient,
 		"file":  &curl.LocalFileClient{},
 	}
+	if len(*peers) > 0 || len(*serve) > 0 {
+		pc, err := peerClient()
+		if err != nil {
+			log.Fatal(err)
+		}
+		schemes.Register("http", pc)
+		schemes.Register("https", pc)
+	}
 
 	readerAt, err := schemes.Fetch(context.Background(), url)
 	if err != nil {
@@ -87,7 +140,21 @@ func main() {
 	}
 	defer w.Close()
 
-	if _, err := io.Copy(w, uio.Reader(readerAt)); err != nil {
+	r, err := progress.NewReporter(*mode, os.Stderr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var size int64
+	if s, ok := readerAt.(interface{ Size() int64 }); ok {
+		size = s.Size()
+	}
+	m := progress.New(path.Base(*outPath), size, r)
+	_, err = io.Copy(w, m.Reader(uio.Reader(readerAt)))
+	m.Finish(err)
+	if err != nil {
 		log.Fatalf("Failed to read response data: %v", err)
 	}
+	if len(*serve) > 0 {
+		time.Sleep(*seed)
+	}
 }
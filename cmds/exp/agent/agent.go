@@ -0,0 +1,137 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// agent lets a central controller manage this machine over an
+// authenticated HTTP API: take its inventory, run health checks, write a
+// disk image, set the BMC boot target and kexec a kernel.
+//
+// Synopsis:
+//     agent [OPTIONS]
+//
+// Description:
+//     The controller authenticates with "Authorization: Bearer TOKEN", the
+//     token read from -token-file, or with a TLS client certificate signed
+//     by -client-ca. One of them is needed. Without -cert and -key, the
+//     API is served over plain HTTP, which sends the token in the clear;
+//     only do so on a network the controller trusts.
+//
+//     Each -check runs a command as a health check, which passes if the
+//     command exits 0. See package agent for the API.
+//
+// Options:
+//     -addr:       address to serve on (default :8443)
+//     -token-file: file holding the token the controller authenticates with
+//     -cert, -key: TLS certificate and key to serve with
+//     -client-ca:  CA certificates of the controller's TLS client certificates
+//     -check:      NAME=COMMAND [ARGS...], a health check; may be repeated
+//
+// Example:
+//     agent -token-file /etc/agent/token -cert /etc/agent/cert.pem -key /etc/agent/key.pem \
+//         -check "link=ip link show eth0" -check "disk=test -b /dev/sda"
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/agent"
+	"github.com/u-root/u-root/pkg/checker"
+	"github.com/u-root/u-root/pkg/shlex"
+)
+
+// checks are the -check flags.
+type checks []checker.Check
+
+func (c *checks) String() string {
+	var names []string
+	for _, ch := range *c {
+		names = append(names, ch.Name)
+	}
+	return strings.Join(names, ",")
+}
+
+func (c *checks) Set(s string) error {
+	i := strings.IndexByte(s, '=')
+	if i <= 0 {
+		return fmt.Errorf("check %q is not NAME=COMMAND", s)
+	}
+	argv := shlex.Argv(s[i+1:])
+	if len(argv) == 0 {
+		return fmt.Errorf("check %q has no command", s)
+	}
+	*c = append(*c, checker.Check{Name: s[:i], Run: checker.CommandExecutor(argv[0], argv[1:]...)})
+	return nil
+}
+
+var (
+	addr      = flag.String("addr", ":8443", "address to serve on")
+	tokenFile = flag.String("token-file", "", "file holding the token the controller authenticates with")
+	cert      = flag.String("cert", "", "TLS certificate to serve with")
+	key       = flag.String("key", "", "TLS key to serve with")
+	clientCA  = flag.String("client-ca", "", "CA certificates of the controller's TLS client certificates")
+
+	healthChecks checks
+)
+
+func init() {
+	flag.Var(&healthChecks, "check", "NAME=COMMAND [ARGS...] health check; may be repeated")
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		log.Fatalf("agent takes no arguments")
+	}
+	if *tokenFile == "" && *clientCA == "" {
+		log.Fatal("agent needs -token-file or -client-ca to authenticate the controller")
+	}
+	if (*cert == "") != (*key == "") {
+		log.Fatal("-cert and -key go together")
+	}
+	if *clientCA != "" && *cert == "" {
+		log.Fatal("-client-ca needs -cert and -key")
+	}
+
+	var token string
+	if *tokenFile != "" {
+		b, err := ioutil.ReadFile(*tokenFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if token = strings.TrimSpace(string(b)); token == "" {
+			log.Fatalf("%s holds no token", *tokenFile)
+		}
+	}
+
+	srv := &http.Server{Addr: *addr, Handler: agent.New(token, healthChecks)}
+	if *cert == "" {
+		log.Printf("Serving the agent API on %s over plain HTTP", *addr)
+		log.Fatal(srv.ListenAndServe())
+	}
+	srv.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	if *clientCA != "" {
+		b, err := ioutil.ReadFile(*clientCA)
+		if err != nil {
+			log.Fatal(err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(b) {
+			log.Fatalf("%s holds no PEM certificates", *clientCA)
+		}
+		srv.TLSConfig.ClientCAs = pool
+		srv.TLSConfig.ClientAuth = tls.VerifyClientCertIfGiven
+		if token == "" {
+			srv.TLSConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	log.Printf("Serving the agent API on %s", *addr)
+	log.Fatal(srv.ListenAndServeTLS(*cert, *key))
+}
@@ -0,0 +1,227 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// attestbundle gathers attestation evidence into a signed tarball, to be
+// verified offline.
+//
+// Synopsis:
+//     attestbundle [-o FILE] [-key FILE] [-nonce HEX] [-alg sha1|sha256] [AUDIT FILE...]
+//     attestbundle -verify [-pubkey FILE] [-nonce HEX] [-alg sha1|sha256] FILE
+//
+// Description:
+//     Where no attestation service is reachable at boot, as in air-gapped
+//     environments, attestbundle writes what one would have been sent to
+//     a gzipped tar instead: the TPM's PCRs and event log, a quote of the
+//     PCRs, the SMBIOS tables and the system identity they give, and the
+//     boot audit trail, the kernel command line and the AUDIT FILEs, e.g.
+//     a boot -json report. A manifest lists the SHA256 digest of each
+//     file and is signed with the ed25519 -key, if there is one.
+//
+//     The quote is over the digest of the manifest of the other files, the
+//     verifier's -nonce among them, so the TPM vouches for them all even
+//     without a -key. TPM 1.2 is not quoted.
+//
+//     With -verify, attestbundle checks the bundle FILE instead: the
+//     manifest, its signature by -pubkey, the -nonce and the quote. It
+//     exits with status 1 if any check fails. Whether the AK of the quote
+//     is one to trust, and the PCRs good ones, is up to the verifier.
+//
+// Options:
+//     -o:      bundle to write
+//     -key:    PEM ed25519 private key to sign the manifest with
+//     -pubkey: PEM ed25519 public key to verify the manifest with
+//     -nonce:  verifier's nonce, in hex
+//     -alg:    PCR bank to include and quote
+//     -verify: verify a bundle
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/u-root/u-root/pkg/attest"
+	"github.com/u-root/u-root/pkg/crypto"
+	"github.com/u-root/u-root/pkg/tss"
+	"golang.org/x/crypto/ed25519"
+)
+
+var (
+	out      = flag.String("o", "attest.tgz", "bundle to write")
+	keyFile  = flag.String("key", "", "PEM ed25519 private key to sign the manifest with")
+	pubFile  = flag.String("pubkey", "", "PEM ed25519 public key to verify the manifest with")
+	nonceHex = flag.String("nonce", "", "verifier's nonce, in hex")
+	algName  = flag.String("alg", "sha256", "PCR bank to include and quote: sha1 or sha256")
+	verify   = flag.Bool("verify", false, "verify a bundle")
+)
+
+var algs = map[string]tss.HashAlg{
+	"sha1":   tss.HashSHA1,
+	"sha256": tss.HashSHA256,
+}
+
+const smbiosDir = "/sys/firmware/dmi/tables"
+
+func gather(alg tss.HashAlg, nonce []byte, audit []string) (*attest.Bundle, error) {
+	b := &attest.Bundle{Time: time.Now()}
+	if nonce != nil {
+		if err := b.Add(attest.NonceFile, nonce); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range append([]string{"/proc/cmdline"}, audit...) {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.Add(attest.AuditDir+filepath.Base(f), data); err != nil {
+			return nil, err
+		}
+	}
+	if err := b.AddSMBIOS(smbiosDir); err != nil {
+		log.Printf("No SMBIOS identity: %v", err)
+	}
+
+	t, err := tss.NewTPM()
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+	if l, err := t.MeasurementLog(); err != nil {
+		log.Printf("No event log: %v", err)
+	} else if err := b.Add(attest.EventLogFile, l); err != nil {
+		return nil, err
+	}
+	pcrs, err := t.ReadPCRs(alg)
+	if err != nil {
+		return nil, err
+	}
+	if err := b.AddPCRs(alg, pcrs); err != nil {
+		return nil, err
+	}
+	if t.Version != tss.TPMVersion20 {
+		log.Printf("TPM %v: not quoting the PCRs", t.Version)
+		return b, nil
+	}
+	if err := b.AddQuote(t, alg); err != nil {
+		return nil, fmt.Errorf("quoting PCRs: %v", err)
+	}
+	return b, nil
+}
+
+func check(file string, alg tss.HashAlg, nonce []byte) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	b, err := attest.Read(f)
+	if err != nil {
+		log.Fatalf("reading %s: %v", file, err)
+	}
+
+	ok := true
+	switch {
+	case *pubFile == "":
+		if err := b.Check(); err != nil {
+			fmt.Printf("manifest: %v\n", err)
+			ok = false
+		} else {
+			fmt.Printf("manifest: ok, signed %t, not verified without -pubkey\n", b.Signed())
+		}
+	default:
+		pub, err := crypto.LoadPublicKeyFromFile(*pubFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := b.Verify(ed25519.PublicKey(pub)); err != nil {
+			fmt.Printf("manifest: %v\n", err)
+			ok = false
+		} else {
+			fmt.Println("manifest: ok, signature verified")
+		}
+	}
+
+	if nonce != nil {
+		if got, _ := b.File(attest.NonceFile); !bytes.Equal(got, nonce) {
+			fmt.Printf("nonce: %x, want %x\n", got, nonce)
+			ok = false
+		} else {
+			fmt.Println("nonce: ok")
+		}
+	}
+
+	switch ad, err := b.VerifyQuote(alg); {
+	case err == attest.ErrNoQuote:
+		fmt.Println("quote: none")
+	case err != nil:
+		fmt.Printf("quote: %v\n", err)
+		ok = false
+	default:
+		fmt.Printf("quote: ok, of PCRs %v, TPM firmware %#x, reset count %d\n", ad.AttestedQuoteInfo.PCRSelection.PCRs, ad.FirmwareVersion, ad.ClockInfo.ResetCount)
+	}
+
+	if id, found := b.File(attest.IdentityFile); found {
+		fmt.Printf("\n%s", id)
+	}
+	return ok
+}
+
+func main() {
+	flag.Parse()
+	alg, ok := algs[*algName]
+	if !ok {
+		log.Fatalf("unknown -alg %q", *algName)
+	}
+	var nonce []byte
+	if *nonceHex != "" {
+		var err error
+		if nonce, err = hex.DecodeString(*nonceHex); err != nil {
+			log.Fatalf("-nonce: %v", err)
+		}
+	}
+
+	if *verify {
+		if flag.NArg() != 1 {
+			log.Fatal("usage: attestbundle -verify [-pubkey FILE] [-nonce HEX] [-alg sha1|sha256] FILE")
+		}
+		if !check(flag.Arg(0), alg, nonce) {
+			os.Exit(1)
+		}
+		return
+	}
+
+	var key ed25519.PrivateKey
+	if *keyFile != "" {
+		k, err := crypto.LoadPrivateKeyFromFile(*keyFile, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(k) != ed25519.PrivateKeySize {
+			log.Fatalf("%s is not an ed25519 private key", *keyFile)
+		}
+		key = ed25519.PrivateKey(k)
+	}
+
+	b, err := gather(alg, nonce, flag.Args())
+	if err != nil {
+		log.Fatal(err)
+	}
+	f, err := os.OpenFile(*out, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := b.Write(f, key); err != nil {
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// bpfsnoop streams events from small built-in eBPF tracers.
+//
+// Synopsis:
+//     bpfsnoop [-d duration] [-n count] exec|open|tcpconnect
+//
+// Description:
+//     exec       prints every execve(2) with pid, uid, command and path.
+//     open       prints every openat(2) with pid, uid, command and path.
+//     tcpconnect prints every completed outgoing TCP connect with the time
+//                between SYN and ESTABLISHED.
+//
+//     The kernel needs CONFIG_BPF_SYSCALL and tracefs mounted at
+//     /sys/kernel/tracing or /sys/kernel/debug/tracing.
+//
+// Options:
+//     -d: stop after this long (default: run until interrupted)
+//     -n: stop after this many events
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/u-root/u-root/pkg/ebpf"
+)
+
+var (
+	duration = flag.Duration("d", 0, "stop after this long")
+	count    = flag.Int("n", 0, "stop after this many events")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: bpfsnoop [-d duration] [-n count] %s\n", strings.Join(ebpf.Snoopers(), "|"))
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 1 {
+		usage()
+	}
+
+	s, err := ebpf.NewSnoop(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.Close()
+
+	// Close on a signal or deadline so the kernel side is torn down; the
+	// pending Read then fails and main returns.
+	done := make(chan os.Signal, 1)
+	signal.Notify(done, os.Interrupt)
+	if *duration > 0 {
+		go func() {
+			time.Sleep(*duration)
+			done <- os.Interrupt
+		}()
+	}
+	go func() {
+		<-done
+		s.Close()
+		os.Exit(0)
+	}()
+
+	fmt.Println(s.Header)
+	for n := 0; *count == 0 || n < *count; n++ {
+		e, err := s.Next()
+		if _, ok := err.(*ebpf.LostError); ok {
+			log.Print(err)
+			continue
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println(e)
+	}
+}
@@ -0,0 +1,278 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// diskbench measures block device or file throughput, like a tiny fio.
+//
+// Synopsis:
+//     diskbench [-rw read|write|randread|randwrite] [-bs size] [-size size] [-iodepth n] [-runtime d] [-direct] FILE
+//
+// Description:
+//     diskbench issues -iodepth concurrent I/Os of -bs bytes over the first
+//     -size bytes of FILE until -size bytes were transferred or -runtime
+//     passed, then prints bandwidth, IOPS and latency percentiles.
+//
+//     Write tests destroy the data on FILE.
+//
+// Options:
+//     -rw:      access pattern (default read)
+//     -bs:      I/O size (default 4K)
+//     -size:    span of FILE to use (default: whole device or file)
+//     -iodepth: number of I/Os in flight (default 1)
+//     -runtime: stop after this long (default: when -size is transferred)
+//     -direct:  bypass the page cache with O_DIRECT
+//     -seed:    seed for random offsets
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rck/unit"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	rw       = flag.String("rw", "read", "access pattern: read, write, randread or randwrite")
+	iodepth  = flag.Int("iodepth", 1, "number of I/Os in flight")
+	duration = flag.Duration("runtime", 0, "stop after this long")
+	direct   = flag.Bool("direct", false, "bypass the page cache with O_DIRECT")
+	seed     = flag.Int64("seed", 1, "seed for random offsets")
+
+	bs   = unit.MustNewUnit(unit.DefaultUnits).MustNewValue(4*unit.K, unit.None)
+	size = unit.MustNewUnit(unit.DefaultUnits).MustNewValue(0, unit.None)
+)
+
+func init() {
+	flag.Var(bs, "bs", "I/O size")
+	flag.Var(size, "size", "span of the file to use (default: all of it)")
+}
+
+// job describes one benchmark run.
+type job struct {
+	write   bool
+	random  bool
+	bs      int64
+	span    int64
+	depth   int
+	runtime time.Duration
+	seed    int64
+}
+
+// result is what a run measured.
+type result struct {
+	bytes     int64
+	ios       int64
+	elapsed   time.Duration
+	latencies []time.Duration
+}
+
+func parseRW(s string) (write, random bool, err error) {
+	switch s {
+	case "read":
+	case "write":
+		write = true
+	case "randread":
+		random = true
+	case "randwrite":
+		write, random = true, true
+	default:
+		err = fmt.Errorf("unknown -rw %q", s)
+	}
+	return
+}
+
+// offsets hands out I/O offsets to the workers. Sequential jobs walk the
+// span once; random jobs pick bs aligned offsets until the byte budget is
+// spent.
+type offsets struct {
+	mu     sync.Mutex
+	j      job
+	next   int64
+	issued int64
+	rnd    *rand.Rand
+	stop   time.Time
+}
+
+func (o *offsets) get() (int64, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.j.runtime > 0 && time.Now().After(o.stop) {
+		return 0, false
+	}
+	if o.j.runtime == 0 && o.issued+o.j.bs > o.j.span {
+		return 0, false
+	}
+	o.issued += o.j.bs
+	if o.j.random {
+		return o.rnd.Int63n(o.j.span/o.j.bs) * o.j.bs, true
+	}
+	if o.next+o.j.bs > o.j.span {
+		// Time based sequential jobs wrap around.
+		o.next = 0
+	}
+	off := o.next
+	o.next += o.j.bs
+	return off, true
+}
+
+// alignedBuffer returns a page aligned buffer, as O_DIRECT requires.
+func alignedBuffer(n int64) ([]byte, error) {
+	return unix.Mmap(-1, 0, int(n), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
+}
+
+func run(f *os.File, j job) (*result, error) {
+	o := &offsets{j: j, rnd: rand.New(rand.NewSource(j.seed)), stop: time.Now().Add(j.runtime)}
+	var (
+		mu   sync.Mutex
+		res  result
+		errs []error
+		wg   sync.WaitGroup
+	)
+	start := time.Now()
+	for w := 0; w < j.depth; w++ {
+		buf, err := alignedBuffer(j.bs)
+		if err != nil {
+			return nil, err
+		}
+		defer unix.Munmap(buf)
+		rand.New(rand.NewSource(j.seed + int64(w))).Read(buf)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var lat []time.Duration
+			var done int64
+			for {
+				off, ok := o.get()
+				if !ok {
+					break
+				}
+				t := time.Now()
+				var err error
+				if j.write {
+					_, err = f.WriteAt(buf, off)
+				} else {
+					_, err = f.ReadAt(buf, off)
+				}
+				if err != nil && err != io.EOF {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+					break
+				}
+				lat = append(lat, time.Since(t))
+				done += j.bs
+			}
+			mu.Lock()
+			res.latencies = append(res.latencies, lat...)
+			res.bytes += done
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if j.write {
+		if err := f.Sync(); err != nil {
+			return nil, err
+		}
+	}
+	res.elapsed = time.Since(start)
+	res.ios = int64(len(res.latencies))
+	if len(errs) > 0 {
+		return &res, errs[0]
+	}
+	return &res, nil
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	return sorted[int(float64(len(sorted)-1)*p)]
+}
+
+func (r *result) String() string {
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+	var sum time.Duration
+	for _, l := range r.latencies {
+		sum += l
+	}
+	var avg time.Duration
+	if r.ios > 0 {
+		avg = sum / time.Duration(r.ios)
+	}
+	secs := r.elapsed.Seconds()
+	return fmt.Sprintf("%d bytes in %v: %.1f MiB/s, %.0f IOPS\nlatency: avg %v, p50 %v, p99 %v, max %v",
+		r.bytes, r.elapsed.Round(time.Millisecond), float64(r.bytes)/secs/(1<<20), float64(r.ios)/secs,
+		avg, percentile(r.latencies, 0.5), percentile(r.latencies, 0.99), percentile(r.latencies, 1))
+}
+
+// fileSize returns the size of a regular file or block device.
+func fileSize(f *os.File) (int64, error) {
+	n, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	return n, err
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("usage: diskbench [options] FILE")
+	}
+	write, random, err := parseRW(*rw)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *iodepth < 1 || bs.Value <= 0 {
+		log.Fatal("-iodepth and -bs must be positive")
+	}
+
+	mode := os.O_RDONLY
+	if write {
+		mode = os.O_RDWR
+	}
+	if *direct {
+		mode |= unix.O_DIRECT
+	}
+	f, err := os.OpenFile(flag.Arg(0), mode, 0)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	span := size.Value
+	if span == 0 {
+		if span, err = fileSize(f); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if span < bs.Value {
+		log.Fatalf("%s: span %d is smaller than block size %d", flag.Arg(0), span, bs.Value)
+	}
+
+	r, err := run(f, job{
+		write:   write,
+		random:  random,
+		bs:      bs.Value,
+		span:    span,
+		depth:   *iodepth,
+		runtime: *duration,
+		seed:    *seed,
+	})
+	if r != nil {
+		fmt.Printf("%s bs=%d iodepth=%d\n%v\n", *rw, bs.Value, *iodepth, r)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
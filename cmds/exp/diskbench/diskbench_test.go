@@ -0,0 +1,40 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	f, err := ioutil.TempFile("", "diskbench")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	for _, rw := range []string{"write", "read", "randwrite", "randread"} {
+		write, random, err := parseRW(rw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := run(f, job{write: write, random: random, bs: 4096, span: 1 << 20, depth: 4, seed: 1})
+		if err != nil {
+			t.Fatalf("%s: %v", rw, err)
+		}
+		if r.bytes != 1<<20 || r.ios != 256 {
+			t.Errorf("%s: got %d bytes in %d I/Os, want %d in 256", rw, r.bytes, r.ios, 1<<20)
+		}
+		if len(r.String()) == 0 {
+			t.Errorf("%s: empty report", rw)
+		}
+	}
+	if _, _, err := parseRW("sideways"); err == nil {
+		t.Errorf("parseRW(sideways) = nil, want error")
+	}
+}
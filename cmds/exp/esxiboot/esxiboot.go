@@ -26,6 +26,9 @@
 // modules=MOD1 [ARGS] --- MOD2 [ARGS] --- ...
 //
 // Lines starting with '#' are ignored.
+//
+// Before executing, file systems are synced and unmounted, or remounted
+// read-only if they are busy.
 
 package main
 
@@ -37,6 +40,7 @@ import (
 	flag "github.com/spf13/pflag"
 	"github.com/u-root/u-root/pkg/boot"
 	"github.com/u-root/u-root/pkg/boot/esxi"
+	"github.com/u-root/u-root/pkg/mount/quiesce"
 )
 
 var (
@@ -102,6 +106,9 @@ func main() {
 		log.Printf("Dry run: not booting kernel.")
 		os.Exit(0)
 	}
+	if err := quiesce.Quiesce(quiesce.Options{}); err != nil {
+		log.Printf("Not all storage could be quiesced: %v", err)
+	}
 	if err := boot.Execute(); err != nil {
 		log.Fatalf("Failed to boot image: %v", err)
 	}
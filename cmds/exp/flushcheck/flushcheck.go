@@ -0,0 +1,375 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// flushcheck verifies that a block device keeps what it said it flushed.
+//
+// Synopsis:
+//     flushcheck [-bs size] [-n count] [-poweroff-after count] [-v] write FILE
+//     flushcheck [-acked count] verify FILE
+//
+// Description:
+//     A device with a volatile write cache must write its cache out before
+//     it completes a flush. Devices that complete flushes early lose data
+//     that was acknowledged as durable when they lose power, which no
+//     amount of care in image writers can make up for.
+//
+//     write writes -n records of -bs bytes to FILE, bypassing the page
+//     cache, and flushes after each one; a record is acknowledged once its
+//     flush completes. It prints the flush latencies and the device's write
+//     cache mode. With -poweroff-after, it stops flushing after that many
+//     records, writes the rest, and powers the machine off without syncing,
+//     as a power failure would.
+//
+//     verify reads the records back after power was cut, e.g. on the next
+//     boot, and fails if any of the first -acked records is missing or
+//     corrupt. Records past -acked may or may not have made it.
+//
+//     write destroys the data on FILE.
+//
+// Options:
+//     -bs:             record size, a multiple of 4096 (default 4096)
+//     -n:              number of records to write (default 1024)
+//     -poweroff-after: power off after this many records are acknowledged
+//     -v:              print each acknowledged record
+//     -acked:          number of records that were acknowledged (default: all)
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	bs            = flag.Int("bs", 4096, "record size, a multiple of 4096")
+	count         = flag.Uint64("n", 1024, "number of records to write")
+	poweroffAfter = flag.Uint64("poweroff-after", 0, "power off after this many records are acknowledged")
+	verbose       = flag.Bool("v", false, "print each acknowledged record")
+	acked         = flag.Int64("acked", -1, "number of records that were acknowledged (default: all)")
+)
+
+// Every record, and the header that is record 0 at offset 0, is laid out
+// as:
+//
+//     0     magic
+//     8     run ID
+//     16    sequence number
+//     24    number of records in the run
+//     32    record size
+//     36    pseudo-random payload
+//     bs-4  CRC32 of everything before it
+const (
+	magic = "FLUSHCHK"
+	// minBS is the largest logical block size of common devices, which
+	// O_DIRECT I/O must be aligned to.
+	minBS = 4096
+)
+
+// run is one write pass over a device.
+type run struct {
+	id uint64
+	n  uint64
+	bs int
+}
+
+// record fills b with record seq of r.
+func (r *run) record(seq uint64, b []byte) {
+	copy(b, magic)
+	binary.LittleEndian.PutUint64(b[8:], r.id)
+	binary.LittleEndian.PutUint64(b[16:], seq)
+	binary.LittleEndian.PutUint64(b[24:], r.n)
+	binary.LittleEndian.PutUint32(b[32:], uint32(r.bs))
+	rand.New(rand.NewSource(int64(r.id^seq))).Read(b[36 : r.bs-4])
+	binary.LittleEndian.PutUint32(b[r.bs-4:], crc32.ChecksumIEEE(b[:r.bs-4]))
+}
+
+// check returns why b is not record seq of r, or nil if it is.
+func (r *run) check(seq uint64, b []byte) error {
+	if string(b[:len(magic)]) != magic {
+		return errors.New("never written")
+	}
+	if crc32.ChecksumIEEE(b[:r.bs-4]) != binary.LittleEndian.Uint32(b[r.bs-4:]) {
+		return errors.New("torn or corrupted")
+	}
+	if id := binary.LittleEndian.Uint64(b[8:]); id != r.id {
+		return fmt.Errorf("left over from run %#x", id)
+	}
+	if s := binary.LittleEndian.Uint64(b[16:]); s != seq {
+		return fmt.Errorf("holds record %d", s)
+	}
+	return nil
+}
+
+// alignedBuffer returns a page aligned buffer, as O_DIRECT requires.
+func alignedBuffer(n int) ([]byte, error) {
+	return unix.Mmap(-1, 0, n, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
+}
+
+// openDirect opens name bypassing the page cache, or through it if the
+// file system does not support that, e.g. for tests on tmpfs.
+func openDirect(name string, flag int) (*os.File, error) {
+	f, err := os.OpenFile(name, flag|unix.O_DIRECT, 0)
+	if errors.Is(err, unix.EINVAL) {
+		return os.OpenFile(name, flag, 0)
+	}
+	return f, err
+}
+
+// fileSize returns the size of a regular file or block device.
+func fileSize(f *os.File) (int64, error) {
+	n, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	_, err = f.Seek(0, io.SeekStart)
+	return n, err
+}
+
+// write writes the header and the records of r to f. It flushes after each
+// of the first flushed records, and calls ack once the flush completed. It
+// returns how long the flushes took.
+func write(f *os.File, r *run, flushed uint64, ack func(seq uint64)) ([]time.Duration, error) {
+	b, err := alignedBuffer(r.bs)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Munmap(b)
+
+	// The header is durable before any record is written, so verify
+	// knows the run even if nothing else made it.
+	r.record(0, b)
+	if _, err := f.WriteAt(b, 0); err != nil {
+		return nil, err
+	}
+	if err := unix.Fdatasync(int(f.Fd())); err != nil {
+		return nil, err
+	}
+	var lat []time.Duration
+	for seq := uint64(1); seq <= r.n; seq++ {
+		r.record(seq, b)
+		if _, err := f.WriteAt(b, int64(seq)*int64(r.bs)); err != nil {
+			return lat, fmt.Errorf("record %d: %v", seq, err)
+		}
+		if seq > flushed {
+			continue
+		}
+		t := time.Now()
+		if err := unix.Fdatasync(int(f.Fd())); err != nil {
+			return lat, fmt.Errorf("flushing record %d: %v", seq, err)
+		}
+		lat = append(lat, time.Since(t))
+		ack(seq)
+	}
+	return lat, nil
+}
+
+// readRun reads the header of the run on f.
+func readRun(f *os.File) (*run, error) {
+	b, err := alignedBuffer(minBS)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Munmap(b)
+	if _, err := f.ReadAt(b, 0); err != nil {
+		return nil, err
+	}
+	if string(b[:len(magic)]) != magic {
+		return nil, errors.New("no flushcheck run found")
+	}
+	r := &run{
+		id: binary.LittleEndian.Uint64(b[8:]),
+		n:  binary.LittleEndian.Uint64(b[24:]),
+		bs: int(binary.LittleEndian.Uint32(b[32:])),
+	}
+	if r.bs < minBS || r.bs%minBS != 0 {
+		return nil, fmt.Errorf("header is corrupted: record size %d", r.bs)
+	}
+	h, err := alignedBuffer(r.bs)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Munmap(h)
+	if _, err := f.ReadAt(h, 0); err != nil {
+		return nil, err
+	}
+	if err := r.check(0, h); err != nil {
+		return nil, fmt.Errorf("header: %v", err)
+	}
+	return r, nil
+}
+
+// result is what verify found.
+type result struct {
+	acked uint64
+	// lost are the acknowledged records that did not survive, and why.
+	lost map[uint64]error
+	// late is how many records that were not acknowledged survived.
+	late uint64
+}
+
+// verify checks the records of r on f, the first acked of which must have
+// survived.
+func verify(f *os.File, r *run, acked uint64) (*result, error) {
+	if acked > r.n {
+		return nil, fmt.Errorf("%d records acknowledged, but the run has %d", acked, r.n)
+	}
+	b, err := alignedBuffer(r.bs)
+	if err != nil {
+		return nil, err
+	}
+	defer unix.Munmap(b)
+
+	res := &result{acked: acked, lost: make(map[uint64]error)}
+	for seq := uint64(1); seq <= r.n; seq++ {
+		if _, err := f.ReadAt(b, int64(seq)*int64(r.bs)); err != nil {
+			return nil, fmt.Errorf("record %d: %v", seq, err)
+		}
+		err := r.check(seq, b)
+		switch {
+		case seq <= acked && err != nil:
+			res.lost[seq] = err
+		case seq > acked && err == nil:
+			res.late++
+		}
+	}
+	return res, nil
+}
+
+func (r *result) String() string {
+	return fmt.Sprintf("%d of %d acknowledged records intact, %d unacknowledged records made it",
+		r.acked-uint64(len(r.lost)), r.acked, r.late)
+}
+
+// writeCache returns the write cache mode the kernel has for the device
+// name, "write back" or "write through".
+func writeCache(name string) string {
+	dev := filepath.Join("/sys/class/block", filepath.Base(name))
+	// Partitions use the queue of their disk.
+	if _, err := os.Stat(filepath.Join(dev, "partition")); err == nil {
+		dev = filepath.Join(dev, "..")
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dev, "queue", "write_cache"))
+	if err != nil {
+		return "unknown"
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func latencies(lat []time.Duration) string {
+	if len(lat) == 0 {
+		return "no flushes"
+	}
+	min, max, sum := lat[0], lat[0], time.Duration(0)
+	for _, l := range lat {
+		if l < min {
+			min = l
+		}
+		if l > max {
+			max = l
+		}
+		sum += l
+	}
+	return fmt.Sprintf("%d flushes: min %v, avg %v, max %v", len(lat), min, sum/time.Duration(len(lat)), max)
+}
+
+func doWrite(name string) error {
+	if *bs < minBS || *bs%minBS != 0 {
+		return fmt.Errorf("-bs %d is not a multiple of %d", *bs, minBS)
+	}
+	f, err := openDirect(name, os.O_RDWR)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	size, err := fileSize(f)
+	if err != nil {
+		return err
+	}
+	if need := int64(*count+1) * int64(*bs); size < need {
+		return fmt.Errorf("%s has %d bytes, %d records of %d bytes need %d", name, size, *count, *bs, need)
+	}
+
+	log.Printf("Write cache of %s: %s", name, writeCache(name))
+	r := &run{id: uint64(time.Now().UnixNano()), n: *count, bs: *bs}
+	flushed := r.n
+	if *poweroffAfter > 0 && *poweroffAfter < r.n {
+		flushed = *poweroffAfter
+	}
+	lat, err := write(f, r, flushed, func(seq uint64) {
+		if *verbose {
+			fmt.Printf("acked %d\n", seq)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	log.Print(latencies(lat))
+	fmt.Printf("acked %d of %d\n", flushed, r.n)
+	if *poweroffAfter == 0 {
+		return nil
+	}
+	log.Printf("Powering off with %d records not flushed", r.n-flushed)
+	return unix.Reboot(unix.LINUX_REBOOT_CMD_POWER_OFF)
+}
+
+func doVerify(name string) error {
+	f, err := openDirect(name, os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	r, err := readRun(f)
+	if err != nil {
+		return err
+	}
+	n := r.n
+	if *acked >= 0 {
+		n = uint64(*acked)
+	}
+	res, err := verify(f, r, n)
+	if err != nil {
+		return err
+	}
+	for seq := uint64(1); seq <= n; seq++ {
+		if err, ok := res.lost[seq]; ok {
+			fmt.Printf("record %d: %v\n", seq, err)
+		}
+	}
+	fmt.Println(res)
+	if len(res.lost) > 0 {
+		return fmt.Errorf("%s lost %d acknowledged records; it does not honor flushes", name, len(res.lost))
+	}
+	return nil
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 2 {
+		log.Fatal("usage: flushcheck [options] write|verify FILE")
+	}
+	var err error
+	switch flag.Arg(0) {
+	case "write":
+		err = doWrite(flag.Arg(1))
+	case "verify":
+		err = doVerify(flag.Arg(1))
+	default:
+		log.Fatalf("unknown mode %q, want write or verify", flag.Arg(0))
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestWriteVerify(t *testing.T) {
+	f, err := ioutil.TempFile("", "flushcheck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	r := &run{id: 42, n: 16, bs: 8192}
+	var acks []uint64
+	lat, err := write(f, r, 10, func(seq uint64) { acks = append(acks, seq) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(acks) != 10 || acks[9] != 10 || len(lat) != 10 {
+		t.Fatalf("write acknowledged %v with %d flushes, want 1 to 10", acks, len(lat))
+	}
+
+	got, err := readRun(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *r {
+		t.Fatalf("readRun = %+v, want %+v", got, r)
+	}
+	res, err := verify(f, got, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.lost) != 0 || res.late != 6 {
+		t.Errorf("verify = %v, want no lost and 6 late records", res)
+	}
+
+	// Lose acknowledged record 3, tear record 5, and leave one of
+	// another run at 7.
+	if _, err := f.WriteAt(make([]byte, r.bs), 3*int64(r.bs)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte{0xff}, 5*int64(r.bs)+100); err != nil {
+		t.Fatal(err)
+	}
+	old := &run{id: 41, n: 16, bs: 8192}
+	b := make([]byte, r.bs)
+	old.record(7, b)
+	if _, err := f.WriteAt(b, 7*int64(r.bs)); err != nil {
+		t.Fatal(err)
+	}
+	res, err = verify(f, got, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint64]string{3: "never written", 5: "torn or corrupted", 7: "left over from run 0x29"}
+	if len(res.lost) != len(want) {
+		t.Errorf("verify lost %v, want %v", res.lost, want)
+	}
+	for seq, s := range want {
+		if err := res.lost[seq]; err == nil || err.Error() != s {
+			t.Errorf("record %d: %v, want %s", seq, err, s)
+		}
+	}
+
+	if _, err := verify(f, got, 17); err == nil {
+		t.Error("verify of more acknowledged records than written did not fail")
+	}
+	if _, err := f.WriteAt(make([]byte, r.bs), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readRun(f); err == nil {
+		t.Error("readRun without a header did not fail")
+	}
+}
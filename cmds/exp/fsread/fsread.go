@@ -0,0 +1,109 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// fsread reads files from a file system without mounting it.
+//
+// Synopsis:
+//     fsread DEVICE ls [PATH]
+//     fsread DEVICE cat PATH...
+//     fsread DEVICE cp PATH DEST
+//
+// Description:
+//     fsread reads file systems the kernel cannot mount, for want of a
+//     driver or of permission, with u-root's Go readers. It currently
+//     reads XFS, F2FS and exFAT.
+//
+//     ls lists a directory, or the root; cat writes files to stdout; and
+//     cp copies a file or tree to DEST on the host, e.g. /boot to a tmpfs
+//     to kexec a kernel from it.
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+
+	"github.com/u-root/u-root/pkg/fs"
+	_ "github.com/u-root/u-root/pkg/fs/exfat"
+	_ "github.com/u-root/u-root/pkg/fs/f2fs"
+	_ "github.com/u-root/u-root/pkg/fs/xfs"
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: fsread DEVICE ls [PATH] | cat PATH... | cp PATH DEST\n")
+	os.Exit(2)
+}
+
+func ls(fsys fs.FS, name string) error {
+	fis, err := fsys.ReadDir(name)
+	if err != nil {
+		return err
+	}
+	for _, fi := range fis {
+		s := fi.Name()
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if t, err := fsys.Readlink(path.Join(name, fi.Name())); err == nil {
+				s += " -> " + t
+			}
+		}
+		fmt.Printf("%v %10d %s %s\n", fi.Mode(), fi.Size(), fi.ModTime().Format("Jan _2 15:04 2006"), s)
+	}
+	return nil
+}
+
+func cat(fsys fs.FS, name string) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(os.Stdout, f)
+	return err
+}
+
+func main() {
+	if len(os.Args) < 3 {
+		usage()
+	}
+	dev, op, args := os.Args[1], os.Args[2], os.Args[3:]
+
+	f, err := os.Open(dev)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	fsys, _, err := fs.New(f)
+	if err != nil {
+		log.Fatalf("%s: %v", dev, err)
+	}
+
+	switch op {
+	case "ls":
+		name := "/"
+		if len(args) > 1 {
+			usage()
+		} else if len(args) == 1 {
+			name = args[0]
+		}
+		err = ls(fsys, name)
+	case "cat":
+		for _, a := range args {
+			if err = cat(fsys, a); err != nil {
+				break
+			}
+		}
+	case "cp":
+		if len(args) != 2 {
+			usage()
+		}
+		err = fs.Extract(fsys, args[0], args[1])
+	default:
+		usage()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
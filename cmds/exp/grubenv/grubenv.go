@@ -0,0 +1,82 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// grubenv edits a GRUB environment block, like grub-editenv.
+//
+// Synopsis:
+//     grubenv FILE create|list|set NAME=VALUE...|unset NAME...
+//
+// Description:
+//     create makes a new empty environment block.
+//     list prints all variables.
+//     set sets variables, e.g. "grubenv /boot/grub/grubenv set boot_success=1"
+//     to record a successful boot for A/B update schemes.
+//     unset removes variables.
+//
+//     The file is updated in place, so GRUB's own save_env keeps working.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/boot/grub"
+)
+
+func usage() {
+	log.Fatalf("Usage: grubenv FILE create|list|set NAME=VALUE...|unset NAME...")
+}
+
+func run(file, cmd string, args []string) error {
+	if cmd == "create" {
+		return grub.NewEnvFile().WriteFile(file)
+	}
+
+	env, err := grub.ReadEnvFile(file)
+	if err != nil {
+		return err
+	}
+	switch cmd {
+	case "list":
+		keys := make([]string, 0, len(env.Vars))
+		for k := range env.Vars {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Printf("%s=%s\n", k, env.Vars[k])
+		}
+		return nil
+
+	case "set":
+		for _, a := range args {
+			kv := strings.SplitN(a, "=", 2)
+			if len(kv) != 2 {
+				return fmt.Errorf("%q is not NAME=VALUE", a)
+			}
+			env.Vars[kv[0]] = kv[1]
+		}
+
+	case "unset":
+		for _, a := range args {
+			delete(env.Vars, a)
+		}
+
+	default:
+		usage()
+	}
+	return env.WriteFile(file)
+}
+
+func main() {
+	if len(os.Args) < 3 {
+		usage()
+	}
+	if err := run(os.Args[1], os.Args[2], os.Args[3:]); err != nil {
+		log.Fatal(err)
+	}
+}
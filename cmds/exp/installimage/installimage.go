@@ -0,0 +1,160 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// installimage writes a raw disk image to a block device.
+//
+// Synopsis:
+//     installimage [OPTIONS] SOURCE DEVICE
+//
+// Description:
+//     SOURCE is an http(s) or file URL, or a path. gzip and bzip2
+//     compressed images are decompressed, and qcow2, VHD, VHDX and
+//     streamOptimized VMDK images converted to raw, on the fly. Fixed VHDs
+//     need -decompress vhd. The image is checked against -checksum as it
+//     streams; on a mismatch the start of DEVICE is wiped so the bad image
+//     is not booted. Afterwards DEVICE is read back and compared to what
+//     was written.
+//
+//     DEVICE is opened exclusively, so installing to a disk with mounted
+//     partitions fails.
+//
+// Options:
+//     -checksum:   expected digest of SOURCE: hex, sha256:hex or sha512:hex
+//     -decompress: auto, none, gzip, bzip2, qcow2, vhd, vhdx or vmdk
+//     -sparse:     zero runs of zeroes instead of writing them
+//     -verify:     read DEVICE back after writing (default true)
+//     -bs:         block size
+//     -k:          do not verify the server's TLS certificate
+//     -progress:   progress output: auto, tty, lines, json or none
+//     -q:          no progress output, as -progress=none
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/rck/unit"
+	"github.com/u-root/u-root/pkg/installer"
+	"github.com/u-root/u-root/pkg/progress"
+)
+
+var (
+	checksum   = flag.String("checksum", "", "expected digest of SOURCE: hex, sha256:hex or sha512:hex")
+	decompress = flag.String("decompress", installer.Auto, "format of SOURCE: auto, none, gzip, bzip2, qcow2, vhd, vhdx or vmdk")
+	sparse     = flag.Bool("sparse", false, "zero runs of zeroes instead of writing them")
+	verify     = flag.Bool("verify", true, "read DEVICE back after writing")
+	insecure   = flag.Bool("k", false, "do not verify the server's TLS certificate")
+	quiet      = flag.Bool("q", false, "no progress output")
+	mode       = flag.String("progress", progress.Auto, "progress output: auto, tty, lines, json or none")
+
+	bs = unit.MustNewUnit(unit.DefaultUnits).MustNewValue(installer.DefaultBlockSize, unit.None)
+)
+
+func init() {
+	flag.Var(bs, "bs", "block size")
+}
+
+// meter reports installer progress to r with a meter for each phase. The
+// returned func finishes the last phase.
+func meter(r progress.Reporter) (func(installer.Progress), func(error)) {
+	var m *progress.Meter
+	var phase string
+	update := func(p installer.Progress) {
+		if p.Phase != phase {
+			if m != nil {
+				m.Finish(nil)
+			}
+			phase = p.Phase
+			m = progress.New(p.Phase, 0, r)
+		}
+		done := p.Written
+		if p.Phase == "write" && p.Total > 0 {
+			// Total is the size of the source, which may be
+			// compressed.
+			done = p.Fetched
+		}
+		if p.Total > 0 {
+			m.SetTotal(p.Total)
+		}
+		m.Set(done)
+	}
+	finish := func(err error) {
+		if m != nil {
+			m.Finish(err)
+		}
+	}
+	return update, finish
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: installimage [OPTIONS] SOURCE DEVICE")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		cancel()
+	}()
+
+	o := installer.Options{
+		Source:     flag.Arg(0),
+		Target:     flag.Arg(1),
+		Decompress: *decompress,
+		Checksum:   *checksum,
+		Sparse:     *sparse,
+		Verify:     *verify,
+		BlockSize:  int(bs.Value),
+	}
+	if *insecure {
+		o.Client = &http.Client{Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		}}
+	}
+	if *quiet {
+		*mode = progress.None
+	}
+	r, err := progress.NewReporter(*mode, os.Stderr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	finish := func(error) {}
+	if r != nil {
+		o.Progress, finish = meter(r)
+	}
+
+	start := time.Now()
+	res, err := installer.Install(ctx, o)
+	finish(err)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Wrote %d bytes to %s in %v", res.Size, o.Target, time.Since(start).Round(time.Millisecond))
+	if res.Skipped > 0 {
+		fmt.Printf(", %d bytes zeroed", res.Skipped)
+	}
+	if res.ZeroCopy {
+		fmt.Print(", zero-copy")
+	}
+	fmt.Println()
+	if res.SourceDigest != "" {
+		fmt.Printf("source digest: %s\n", res.SourceDigest)
+	}
+	if res.Verified {
+		fmt.Printf("verified, image sha256: %s\n", res.ImageDigest)
+	}
+}
@@ -8,23 +8,113 @@
 // Description:
 //
 // Options:
-//     -chassis : Print chassis power status.
+//     -chassis : Print chassis power status and boot flags.
 //     -sel     : Print SEL information.
-//     -lan     : Print IP information.
+//     -sel-list: List the SEL entries, decoded as far as possible.
+//     -sel-clear: Erase the SEL, after listing it with -sel-list.
+//     -lan     : Print LAN configuration.
+//     -channel : LAN channel to print, default 1.
+//     -users   : List the users of -channel and their privileges.
+//     -channel-info: Print the medium, protocol and sessions of -channel,
+//                and how it lets sessions log in: the authentication
+//                types, IPMI versions, and whether null users and
+//                anonymous logins are enabled.
+//     -ipsrc   : Make the BMC get its -channel address by dhcp or static.
+//     -ipaddr  : Give the BMC a static -channel address, e.g. 10.0.0.5/24.
+//     -gateway : Default gateway for -ipaddr.
+//     -vlan    : Put the BMC's -channel on this VLAN, or on none if 0.
 //     -device  : Print device information.
+//     -selftest: Print the results of the BMC's self-test.
+//     -reset   : Reset the BMC, cold or warm, and wait for it to be back.
+//     -watchdog: Print the watchdog timer configuration and state.
+//     -pef     : Print the Platform Event Filtering capabilities and
+//                configuration, with the event filters and alert policies.
+//     -event-receiver: Print where the -t controller sends its event
+//                messages with "show", stop it from generating them with
+//                "off", or point them at the controller at ADDR[:LUN].
+//     -dcmi    : Print the DCMI capabilities, power reading and limit, and
+//                asset tag.
+//     -power-limit: Limit the power the system draws to this many watts,
+//                logging an event if it cannot be kept to, or lift the
+//                limit if 0.
+//     -asset-tag: Set the DCMI asset tag.
+//     -hpm     : Print the HPM.1 firmware upgrade capabilities and
+//                components of the BMC.
+//     -hpm-flash: Upload a firmware image file to the -hpm-component of
+//                the BMC by HPM.1, preparing it first if it needs it, and
+//                activate it. An HPM.1 upgrade image (.hpm) is checked to
+//                be for the BMC, and its actions are run for every
+//                component whose firmware is not that of the image.
+//     -hpm-component: HPM.1 component for -hpm-flash, 0 to 7, of images
+//                that are not HPM.1 upgrade images.
+//     -hpm-force: Flash components of an HPM.1 upgrade image even if they
+//                have its version, or are too old for it.
+//     -oem     : Run "NAME [ARGS...]", an OEM command of the BMC's
+//                manufacturer, as Get Device ID says it is, and print what
+//                it answers; "list" lists the OEM commands. Supermicro's
+//                are built in.
 //     -raw     : Send raw command and print response.
+//     -exec    : Run a file of raw commands, as ipmitool exec does, and
+//                print the responses. A command must complete normally
+//                unless an "expect cc" line after it lists the completion
+//                codes it may answer with, and an "expect data" line can
+//                give what its response starts with, * for any byte;
+//                "sleep" pauses for a duration. The first command that
+//                does not answer as expected stops the script.
+//     -b       : Channel of the -t controller for -raw, default 0.
+//     -t       : Slave address of the controller to send -raw or -exec
+//                to, by way of the BMC, e.g. 0x72; the default is the BMC.
+//     -l       : LUN to send -raw or -exec to, 0 to 3.
+//     -B       : Channel of the -T controller, default 0.
+//     -T       : Slave address of a transit controller the -t controller
+//                is behind, for double bridging.
+//     -power   : Power the chassis off, on, cycle, reset, diag (pulse a
+//                diagnostic interrupt) or soft (ACPI shutdown).
+//     -identify: Blink the chassis identify LED: a duration of up to
+//                255s, "force" to keep it on or "off".
+//     -panel   : Comma separated front panel buttons to disable, of
+//                power, reset, diag and standby, or "none".
+//     -bootdev : Boot pxe, disk, safe (disk in safe mode), diag, cdrom,
+//                bios (setup) or none (no override) next.
+//     -persistent: Make -bootdev apply to all future boots.
+//     -efi     : Make -bootdev ask for an EFI boot.
+//     -sensor  : Print the reading and status of a sensor number.
+//     -sdr     : List the Sensor Data Records.
+//     -fru     : Print the inventory of a FRU device, 0 for the BMC's.
+//     -fru-write: Write a FRU image file to the -fru device first.
+//     -H       : Talk to the BMC at this host over the LAN (RMCP+) instead
+//                of to the local BMC.
+//     -U       : BMC user name for -H.
+//     -P       : BMC password for -H, or $IPMI_PASSWORD.
+//     -C       : RMCP+ cipher suite for -H, 3 or 17; the default tries
+//                17, then 3.
+//     -sol     : Attach to the serial console of the host of the -H BMC.
+//                At the start of a line, ~. detaches and ~B sends a
+//                break.
+//     -sol-config: Print the Serial over LAN configuration of -channel.
+//     -sol-set : Set SOL parameters of -channel, comma separated, of
+//                enable=true|false, privilege=user|operator|admin|oem,
+//                baud=0|9600|19200|38400|57600|115200 (0 for the serial
+//                port's rate), retries=0-7 and retry-interval=DURATION.
 //     -help    : Print help message.
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
+	"net"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/u-root/u-root/pkg/ipmi"
+	_ "github.com/u-root/u-root/pkg/ipmi/supermicro"
+	"github.com/u-root/u-root/pkg/termios"
 )
 
 const cmd = "ipmidump [options] "
@@ -32,10 +122,55 @@ const cmd = "ipmidump [options] "
 var (
 	flagChassis = flag.Bool("chassis", false, "print chassis power status")
 	flagSEL     = flag.Bool("sel", false, "print SEL information")
-	flagLan     = flag.Bool("lan", false, "Print IP address")
+	flagSELList = flag.Bool("sel-list", false, "list the SEL entries")
+	flagSELClr  = flag.Bool("sel-clear", false, "erase the SEL")
+	flagLan     = flag.Bool("lan", false, "print LAN configuration")
 	flagRaw     = flag.Bool("raw", false, "Send IPMI raw command")
+	flagExec    = flag.String("exec", "", "run a file of raw commands")
+	flagBridge  = flag.Uint("b", 0, "channel of the -t controller for -raw")
+	flagTarget  = flag.Uint("t", 0, "slave address of the controller to send -raw or -exec to, default the BMC")
+	flagLUN     = flag.Uint("l", 0, "LUN to send -raw or -exec to")
+	flagTBridge = flag.Uint("B", 0, "channel of the -T controller")
+	flagTTarget = flag.Uint("T", 0, "slave address of the transit controller the -t controller is behind")
 	flagHelp    = flag.Bool("help", false, "print help message")
 	flagDev     = flag.Bool("device", false, "print device information")
+	flagSelf    = flag.Bool("selftest", false, "print the BMC self-test results")
+	flagReset   = flag.String("reset", "", "reset the BMC, cold or warm")
+	flagWdt     = flag.Bool("watchdog", false, "print the watchdog timer")
+	flagPEF     = flag.Bool("pef", false, "print the PEF capabilities, event filters and alert policies")
+	flagEvRcv   = flag.String("event-receiver", "", "show, off or ADDR[:LUN] of the -t controller's event receiver")
+	flagDCMI    = flag.Bool("dcmi", false, "print the DCMI capabilities, power reading and limit, and asset tag")
+	flagPLimit  = flag.Int("power-limit", -1, "limit the system power to this many watts, 0 to lift the limit")
+	flagATag    = flag.String("asset-tag", "", "set the DCMI asset tag")
+	flagHPM     = flag.Bool("hpm", false, "print the HPM.1 upgrade capabilities and components")
+	flagHPMImg  = flag.String("hpm-flash", "", "upload this firmware image by HPM.1 and activate it")
+	flagHPMComp = flag.Int("hpm-component", -1, "HPM.1 component for -hpm-flash")
+	flagOEM     = flag.String("oem", "", "run NAME [ARGS...], an OEM command of the BMC's manufacturer, or list them")
+	flagHPMFrc  = flag.Bool("hpm-force", false, "flash the components of a -hpm-flash .hpm image even if they have its version")
+	flagChannel = flag.Int("channel", 1, "LAN channel for -lan, -users, -channel-info, -sol-config and -sol-set")
+	flagUsers   = flag.Bool("users", false, "list the users of -channel")
+	flagChInfo  = flag.Bool("channel-info", false, "print the medium, sessions and authentication capabilities of -channel")
+	flagIPSrc   = flag.String("ipsrc", "", "make the BMC get its -channel address by dhcp or static")
+	flagIPAddr  = flag.String("ipaddr", "", "static -channel address of the BMC, e.g. 10.0.0.5/24")
+	flagGateway = flag.String("gateway", "", "default gateway for -ipaddr")
+	flagVLAN    = flag.Int("vlan", -1, "VLAN of the BMC's -channel, 0 for none")
+	flagPower   = flag.String("power", "", "chassis power action: off, on, cycle, reset, diag or soft")
+	flagIdent   = flag.String("identify", "", "blink the chassis identify LED for a duration, \"force\" to keep it on or \"off\"")
+	flagPanel   = flag.String("panel", "", "comma separated front panel buttons to disable (power, reset, diag, standby) or \"none\"")
+	flagBoot    = flag.String("bootdev", "", "boot device override for the next boot: pxe, disk, safe, diag, cdrom, bios or none")
+	flagPersist = flag.Bool("persistent", false, "make -bootdev apply to all future boots")
+	flagEFI     = flag.Bool("efi", false, "make -bootdev ask for an EFI boot")
+	flagSensor  = flag.Int("sensor", -1, "print the reading of this sensor number")
+	flagSDR     = flag.Bool("sdr", false, "list the Sensor Data Records")
+	flagFRU     = flag.Int("fru", -1, "print the inventory of this FRU device")
+	flagFRUW    = flag.String("fru-write", "", "write this FRU image to the -fru device first")
+	flagHost    = flag.String("H", "", "BMC host to talk to over the LAN instead of the local BMC")
+	flagUser    = flag.String("U", "", "BMC user name for -H")
+	flagPass    = flag.String("P", "", "BMC password for -H, or $IPMI_PASSWORD")
+	flagSuite   = flag.Int("C", 0, "RMCP+ cipher suite for -H, 3 or 17")
+	flagSOL     = flag.Bool("sol", false, "attach to the serial console of the -H BMC's host")
+	flagSOLConf = flag.Bool("sol-config", false, "print the SOL configuration of -channel")
+	flagSOLSet  = flag.String("sol-set", "", "comma separated SOL parameters of -channel to set: enable, privilege, baud, retries, retry-interval")
 )
 
 func itob(i int) bool { return i != 0 }
@@ -64,16 +199,688 @@ func main() {
 		selInfo()
 	}
 
+	if *flagSELList {
+		listSEL()
+	}
+
+	if *flagSELClr {
+		clearSEL()
+	}
+
 	if *flagLan {
 		lanConfig()
 	}
 
-	if *flagDev {
-		deviceID()
+	if *flagIPSrc != "" || *flagIPAddr != "" || *flagVLAN >= 0 {
+		setLan()
+	}
+
+	if *flagUsers {
+		listUsers()
+	}
+
+	if *flagChInfo {
+		channelInfo()
+	}
+
+	if *flagDev {
+		deviceID()
+	}
+
+	if *flagReset != "" {
+		resetBMC(*flagReset)
+	}
+
+	if *flagSelf {
+		selfTest()
+	}
+
+	if *flagWdt {
+		watchdog()
+	}
+
+	if *flagPEF {
+		pefInfo()
+	}
+
+	if *flagEvRcv != "" {
+		eventReceiver(*flagEvRcv)
+	}
+
+	if *flagPLimit >= 0 || *flagATag != "" {
+		setDCMI(*flagPLimit, *flagATag)
+	}
+
+	if *flagDCMI {
+		dcmiInfo()
+	}
+
+	if *flagHPM {
+		hpmInfo()
+	}
+
+	if *flagHPMImg != "" {
+		hpmFlash(*flagHPMImg, *flagHPMComp)
+	}
+
+	if *flagOEM != "" {
+		oemCommand(strings.Fields(*flagOEM))
+	}
+
+	if *flagPower != "" {
+		chassisControl(*flagPower)
+	}
+
+	if *flagIdent != "" {
+		chassisIdentify(*flagIdent)
+	}
+
+	if *flagPanel != "" {
+		frontPanel(*flagPanel)
+	}
+
+	if *flagBoot != "" {
+		setBootDevice(*flagBoot, *flagPersist, *flagEFI)
+	}
+
+	if *flagSensor >= 0 {
+		sensorReading(*flagSensor)
+	}
+
+	if *flagSDR {
+		listSDR()
+	}
+
+	if *flagFRUW != "" && *flagFRU < 0 {
+		log.Fatal("-fru-write needs a -fru device")
+	}
+
+	if *flagFRU >= 0 {
+		fruInfo(*flagFRU, *flagFRUW)
+	}
+
+	if *flagRaw {
+		sendRawCmd(flag.Args())
+	}
+
+	if *flagExec != "" {
+		execScript(*flagExec)
+	}
+
+	if *flagSOLSet != "" {
+		setSOL(*flagSOLSet)
+	}
+
+	if *flagSOLConf {
+		solConfig()
+	}
+
+	if *flagSOL {
+		solConsole()
+	}
+}
+
+func setLan() {
+	srcs := map[string]ipmi.IPAddressSource{
+		"dhcp":   ipmi.IPAddressSourceDHCP,
+		"static": ipmi.IPAddressSourceStatic,
+	}
+	src, ok := srcs[*flagIPSrc]
+	if *flagIPSrc != "" && !ok {
+		log.Fatalf("unknown -ipsrc %q, want dhcp or static", *flagIPSrc)
+	}
+
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	channel := byte(*flagChannel)
+	if ok {
+		if err := ipmi.SetLanIPAddressSource(channel, src); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *flagIPAddr != "" {
+		ip, n, err := net.ParseCIDR(*flagIPAddr)
+		if err != nil {
+			log.Fatal(err)
+		}
+		var gw net.IP
+		if *flagGateway != "" {
+			if gw = net.ParseIP(*flagGateway); gw == nil {
+				log.Fatalf("invalid -gateway %q", *flagGateway)
+			}
+		}
+		if err := ipmi.SetLanStaticIP(channel, ip, n.Mask, gw); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *flagVLAN >= 0 {
+		if err := ipmi.SetLanVLAN(channel, uint16(*flagVLAN)); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func listUsers() {
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	channel := byte(*flagChannel)
+	// Every user's access tells how many users there are.
+	first, err := ipmi.GetUserAccess(channel, 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%-4s %-16s %-9s %-8s %-6s %s\n", "ID", "Name", "Status", "Callback", "IPMI", "Privilege")
+	for id := byte(1); id <= first.MaxUsers; id++ {
+		a, err := ipmi.GetUserAccess(channel, id)
+		if err != nil {
+			log.Fatal(err)
+		}
+		name, err := ipmi.GetUserName(id)
+		if err != nil {
+			// The null user and unused IDs may have no name.
+			name = ""
+		}
+		fmt.Printf("%-4d %-16s %-9v %-8t %-6t %v\n", id, name, a.Status, a.CallbackOnly, a.IPMIMessaging, a.Privilege)
+	}
+}
+
+// open opens the local BMC, or a session to the one of -H.
+func open() (*ipmi.IPMI, error) {
+	if *flagHost == "" {
+		return ipmi.Open(0)
+	}
+	pass := *flagPass
+	if pass == "" {
+		pass = os.Getenv("IPMI_PASSWORD")
+	}
+	return ipmi.DialLAN(*flagHost, &ipmi.LANConfig{
+		Username:    *flagUser,
+		Password:    pass,
+		CipherSuite: *flagSuite,
+		Retries:     3,
+	})
+}
+
+func solConsole() {
+	if *flagHost == "" {
+		log.Fatal("-sol needs a BMC to talk to with -H")
+	}
+
+	i, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer i.Close()
+
+	sol, err := i.ActivateSOL()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer sol.Deactivate()
+
+	t, err := termios.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+	old, err := t.Raw()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer t.Set(old)
+
+	fmt.Fprintf(os.Stderr, "[SOL to %s, ~. to detach]\r\n", *flagHost)
+	done := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(os.Stdout, sol)
+		done <- err
+	}()
+	go func() {
+		done <- typeSOL(sol, t)
+	}()
+	if err := <-done; err != nil {
+		t.Set(old)
+		log.Print(err)
+	}
+}
+
+// typeSOL copies what is typed to sol until ~. at the start of a line.
+func typeSOL(sol *ipmi.SOL, r io.Reader) error {
+	buf := make([]byte, 256)
+	lineStart, tilde := true, false
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return err
+		}
+		var out []byte
+		for _, c := range buf[:n] {
+			switch {
+			case tilde && c == '.':
+				_, err := sol.Write(out)
+				return err
+			case tilde && c == 'B':
+				if _, err := sol.Write(out); err != nil {
+					return err
+				}
+				out = out[:0]
+				if err := sol.Break(); err != nil {
+					return err
+				}
+			case tilde:
+				out = append(out, '~', c)
+			case lineStart && c == '~':
+				tilde = true
+				lineStart = false
+				continue
+			default:
+				out = append(out, c)
+			}
+			tilde = false
+			lineStart = c == '\r' || c == '\n'
+		}
+		if _, err := sol.Write(out); err != nil {
+			return err
+		}
+	}
+}
+
+func solConfig() {
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	c, err := ipmi.GetSOLConfig(byte(*flagChannel))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Enabled             :", c.Enabled)
+	fmt.Println("Privilege Level     :", c.Privilege)
+	fmt.Println("Force Encryption    :", c.ForceEncryption)
+	fmt.Println("Force Authentication:", c.ForceAuthentication)
+	fmt.Println("Accumulate Interval :", c.AccumulateInterval)
+	fmt.Println("Send Threshold      :", c.SendThreshold)
+	fmt.Println("Retry Count         :", c.Retries)
+	fmt.Println("Retry Interval      :", c.RetryInterval)
+	fmt.Println("Non-Volatile Baud   :", c.BitRate)
+	fmt.Println("Volatile Baud       :", c.VolatileBitRate)
+	fmt.Println("Payload Channel     :", c.PayloadChannel)
+	fmt.Println("Payload Port        :", c.PayloadPort)
+}
+
+// parseSOLSettings parses the -sol-set argument into changes to a SOL
+// configuration.
+func parseSOLSettings(s string) (func(*ipmi.SOLConfig), error) {
+	privileges := map[string]ipmi.Privilege{
+		"user":     ipmi.PrivilegeUser,
+		"operator": ipmi.PrivilegeOperator,
+		"admin":    ipmi.PrivilegeAdmin,
+		"oem":      ipmi.PrivilegeOEM,
+	}
+	var set []func(*ipmi.SOLConfig)
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("SOL setting %q is not KEY=VALUE", kv)
+		}
+		k, v := kv[:i], kv[i+1:]
+		var err error
+		switch k {
+		case "enable":
+			var b bool
+			b, err = strconv.ParseBool(v)
+			set = append(set, func(c *ipmi.SOLConfig) { c.Enabled = b })
+		case "privilege":
+			p, ok := privileges[v]
+			if !ok {
+				err = fmt.Errorf("want user, operator, admin or oem")
+			}
+			set = append(set, func(c *ipmi.SOLConfig) { c.Privilege = p })
+		case "baud":
+			var n int
+			var r ipmi.SOLBitRate
+			if n, err = strconv.Atoi(v); err == nil {
+				r, err = ipmi.SOLBitRateOf(n)
+			}
+			set = append(set, func(c *ipmi.SOLConfig) { c.BitRate, c.VolatileBitRate = r, r })
+		case "retries":
+			var n uint64
+			n, err = strconv.ParseUint(v, 10, 3)
+			set = append(set, func(c *ipmi.SOLConfig) { c.Retries = byte(n) })
+		case "retry-interval":
+			var d time.Duration
+			d, err = time.ParseDuration(v)
+			set = append(set, func(c *ipmi.SOLConfig) { c.RetryInterval = d })
+		default:
+			err = fmt.Errorf("unknown setting")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("SOL setting %q: %v", kv, err)
+		}
+	}
+	return func(c *ipmi.SOLConfig) {
+		for _, f := range set {
+			f(c)
+		}
+	}, nil
+}
+
+func setSOL(s string) {
+	set, err := parseSOLSettings(s)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	channel := byte(*flagChannel)
+	c, err := ipmi.GetSOLConfig(channel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	set(c)
+	if err := ipmi.SetSOLControl(channel, c); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func sensorReading(n int) {
+	if n > 0xFF {
+		log.Fatalf("sensor number %d is not a byte", n)
+	}
+
+	i, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer i.Close()
+
+	r, err := i.GetSensorReading(byte(n))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if r.Unavailable {
+		fmt.Printf("Sensor %#02x: reading unavailable\n", n)
+		return
+	}
+	fmt.Printf("Sensor %#02x: raw reading %#02x\n", n, r.Raw)
+	// The SDR is only needed for the name and units, so carry on without.
+	if sdr, err := ipmi.NewSDRCache(i).Sensor(byte(n)); err == nil {
+		fmt.Printf("Name                  : %s\n", sdr.Name())
+		if c, ok := sdr.Conversion(); ok {
+			fmt.Printf("Value                 : %.3f\n", r.Value(c))
+		}
+	}
+	fmt.Printf("Threshold status      : %v\n", r.Thresholds)
+	fmt.Printf("Discrete states       : %#04x\n", r.States)
+	fmt.Printf("Event messages enabled: %v\n", r.EventMessagesEnabled)
+	fmt.Printf("Scanning enabled      : %v\n", r.ScanningEnabled)
+}
+
+func listSDR() {
+	i, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer i.Close()
+
+	records, err := ipmi.NewSDRCache(i).Records()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, sdr := range records {
+		if n, ok := sdr.SensorNumber(); ok {
+			fmt.Printf("%#04x  type %#02x  sensor %#02x  %s\n", sdr.RecordID, sdr.Type, n, sdr.Name())
+			continue
+		}
+		fmt.Printf("%#04x  type %#02x               %s\n", sdr.RecordID, sdr.Type, sdr.Name())
+	}
+}
+
+func listSEL() {
+	i, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer i.Close()
+
+	var d ipmi.SELDecoder
+	if id, err := i.GetDeviceID(); err == nil {
+		d.Manufacturer = id.Manufacturer()
+	}
+	it := i.SELEntries()
+	for it.Next() {
+		fmt.Println(d.String(it.Event()))
+	}
+	if err := it.Err(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func clearSEL() {
+	i, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer i.Close()
+
+	if err := i.ClearSEL(10 * time.Second); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("SEL cleared")
+}
+
+func fruInfo(n int, image string) {
+	if n > 0xFF {
+		log.Fatalf("FRU device %d is not a byte", n)
+	}
+
+	i, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer i.Close()
+
+	if image != "" {
+		b, err := ioutil.ReadFile(image)
+		if err != nil {
+			log.Fatal(err)
+		}
+		// Refuse to program garbage.
+		if _, err := ipmi.ParseFRU(b); err != nil {
+			log.Fatalf("%s: %v", image, err)
+		}
+		if err := i.WriteFRU(byte(n), b); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	fru, err := i.GetFRU(byte(n))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if c := fru.Chassis; c != nil {
+		fmt.Printf("Chassis type          : %#02x\n", c.Type)
+		fmt.Printf("Chassis part number   : %s\n", c.PartNumber)
+		fmt.Printf("Chassis serial        : %s\n", c.SerialNumber)
+		for _, s := range c.Custom {
+			fmt.Printf("Chassis extra         : %s\n", s)
+		}
+	}
+	if b := fru.Board; b != nil {
+		if !b.MfgDate.IsZero() {
+			fmt.Printf("Board mfg date        : %v\n", b.MfgDate)
+		}
+		fmt.Printf("Board mfg             : %s\n", b.Manufacturer)
+		fmt.Printf("Board product         : %s\n", b.ProductName)
+		fmt.Printf("Board serial          : %s\n", b.SerialNumber)
+		fmt.Printf("Board part number     : %s\n", b.PartNumber)
+		for _, s := range b.Custom {
+			fmt.Printf("Board extra           : %s\n", s)
+		}
+	}
+	if p := fru.Product; p != nil {
+		fmt.Printf("Product manufacturer  : %s\n", p.Manufacturer)
+		fmt.Printf("Product name          : %s\n", p.Name)
+		fmt.Printf("Product part number   : %s\n", p.PartNumber)
+		fmt.Printf("Product version       : %s\n", p.Version)
+		fmt.Printf("Product serial        : %s\n", p.SerialNumber)
+		fmt.Printf("Product asset tag     : %s\n", p.AssetTag)
+		for _, s := range p.Custom {
+			fmt.Printf("Product extra         : %s\n", s)
+		}
+	}
+}
+
+var powerActions = map[string]ipmi.ChassisControl{
+	"off":   ipmi.ChassisPowerDown,
+	"on":    ipmi.ChassisPowerUp,
+	"cycle": ipmi.ChassisPowerCycle,
+	"reset": ipmi.ChassisHardReset,
+	"diag":  ipmi.ChassisDiagInterrupt,
+	"soft":  ipmi.ChassisSoftOff,
+}
+
+func chassisControl(s string) {
+	c, ok := powerActions[s]
+	if !ok {
+		log.Fatalf("power %q: want off, on, cycle, reset, diag or soft", s)
+	}
+
+	i, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer i.Close()
+
+	if err := i.ChassisControl(c); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Chassis %v requested\n", c)
+}
+
+var bootDevices = map[string]ipmi.BootDevice{
+	"none":  ipmi.BootDeviceNone,
+	"pxe":   ipmi.BootDevicePXE,
+	"disk":  ipmi.BootDeviceDisk,
+	"safe":  ipmi.BootDeviceDiskSafeMode,
+	"diag":  ipmi.BootDeviceDiagnostic,
+	"cdrom": ipmi.BootDeviceCDROM,
+	"bios":  ipmi.BootDeviceBIOSSetup,
+}
+
+func setBootDevice(s string, persistent, efi bool) {
+	d, ok := bootDevices[s]
+	if !ok {
+		log.Fatalf("bootdev %q: want pxe, disk, safe, diag, cdrom, bios or none", s)
+	}
+
+	i, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer i.Close()
+
+	// Change only the device and its flags, keeping the others as the
+	// BMC has them. Flags that cannot be read are all cleared.
+	f, err := i.GetSystemBootOptions()
+	if err != nil {
+		log.Printf("Reading the boot flags: %v", err)
+		f = &ipmi.BootFlags{}
+	}
+	f.Device, f.Persistent, f.EFI = d, persistent, efi
+	if err := i.SetSystemBootOptions(f); err != nil {
+		log.Fatal(err)
+	}
+	when := "next boot"
+	if persistent {
+		when = "all boots"
+	}
+	fmt.Printf("Boot device set to %v for %s\n", d, when)
+}
+
+// parseIdentify parses the -identify argument.
+func parseIdentify(s string) (time.Duration, bool, error) {
+	switch s {
+	case "off":
+		return 0, false, nil
+	case "force":
+		return 0, true, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, false, fmt.Errorf("identify %q: want a duration, \"force\" or \"off\"", s)
+	}
+	return d, false, nil
+}
+
+func chassisIdentify(s string) {
+	d, force, err := parseIdentify(s)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	if err := ipmi.ChassisIdentify(d, force); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// parseButtons parses the -panel argument.
+func parseButtons(s string) (ipmi.FrontPanelButtons, error) {
+	names := map[string]ipmi.FrontPanelButtons{
+		"power":   ipmi.FrontPanelPowerOff,
+		"reset":   ipmi.FrontPanelReset,
+		"diag":    ipmi.FrontPanelDiagInterrupt,
+		"standby": ipmi.FrontPanelStandby,
+	}
+	var b ipmi.FrontPanelButtons
+	if s == "none" {
+		return b, nil
+	}
+	for _, n := range strings.Split(s, ",") {
+		v, ok := names[strings.TrimSpace(n)]
+		if !ok {
+			return 0, fmt.Errorf("unknown front panel button %q", n)
+		}
+		b |= v
 	}
+	return b, nil
+}
 
-	if *flagRaw {
-		sendRawCmd(flag.Args())
+func frontPanel(s string) {
+	b, err := parseButtons(s)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	if err := ipmi.SetFrontPanelEnables(b); err != nil {
+		log.Fatal(err)
 	}
 }
 
@@ -98,7 +905,14 @@ func chassisInfo() {
 		0x00: "none",
 	}
 
-	ipmi, err := ipmi.Open(0)
+	identify := map[int]string{
+		0x0: "off",
+		0x1: "timed on",
+		0x2: "on",
+		0x3: "reserved",
+	}
+
+	ipmi, err := open()
 	if err != nil {
 		fmt.Printf("Failed to open ipmi device: %v\n", err)
 	}
@@ -133,6 +947,10 @@ func chassisInfo() {
 		fmt.Println("Drive Fault         :", state[itob(data&0x04)])
 		fmt.Println("Front Panel Lockout :", act[itob(data&0x02)])
 		fmt.Println("Chass Intrusion     :", act[itob(data&0x01)])
+		// The identify state is optional, and bit 6 says if it is there.
+		if data&0x40 != 0 {
+			fmt.Println("Chassis Identify    :", identify[(data>>4)&0x03])
+		}
 
 		// Front panel button (optional)
 		data = int(status.FrontPanelButton)
@@ -151,12 +969,24 @@ func chassisInfo() {
 			fmt.Println("Front Panel Button  : none")
 		}
 	}
+
+	if f, err := ipmi.GetSystemBootOptions(); err != nil {
+		fmt.Printf("Failed to get boot flags: %v\n", err)
+	} else {
+		mode := map[bool]string{true: "EFI", false: "legacy"}
+		fmt.Println("Boot flags")
+		fmt.Println("Boot Flags Valid    :", state[f.Valid])
+		fmt.Println("Boot Device         :", f.Device)
+		fmt.Println("Persistent          :", state[f.Persistent])
+		fmt.Println("Boot Mode           :", mode[f.EFI])
+		fmt.Println("BIOS Verbosity      :", f.Verbosity)
+	}
 }
 
 func selInfo() {
 	support := map[bool]string{true: "supported", false: "unsupported"}
 
-	ipmi, err := ipmi.Open(0)
+	ipmi, err := open()
 	if err != nil {
 		fmt.Printf("Failed to open ipmi device: %v\n", err)
 	}
@@ -216,81 +1046,463 @@ func selInfo() {
 }
 
 func lanConfig() {
-	const (
-		setInProgress byte = iota
-		_
-		_
-		IPAddress
-		IPAddressSrc
-		MACAddress
-	)
-
 	setInProgressStr := []string{
 		"Set Complete", "Set In Progress", "Commit Write", "Reserved",
 	}
 
-	IPAddressSrcStr := []string{
-		"Unspecified", "Static Address", "DHCP Address", "BIOS Assigned Address",
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	c, err := ipmi.GetLanConfig(byte(*flagChannel))
+	if err != nil {
+		fmt.Printf("Failed to get LAN config: %v\n", err)
+		return
+	}
+
+	fmt.Println("Set In Progress     :", setInProgressStr[c.SetInProgress])
+	fmt.Printf("Auth Type Support   : %#02x\n", c.AuthTypeSupport)
+	fmt.Printf("Auth Type Enables   : % x\n", c.AuthTypeEnables)
+	fmt.Println("IP Address Source   :", c.IPAddressSource)
+	fmt.Println("IP Address          :", c.IPAddress)
+	fmt.Println("Subnet Mask         :", net.IP(c.SubnetMask))
+	fmt.Println("MAC Address         :", c.MACAddress)
+	fmt.Printf("IP Header           : TTL=%#02x Flags=%#02x TOS=%#02x\n", c.TTL, c.IPFlags, c.TOS)
+	fmt.Printf("BMC ARP Control     : %#02x\n", c.ARPControl)
+	fmt.Printf("Gratuitous ARP      : every %.1f sec\n", float64(c.GratuitousARP)/2)
+	fmt.Println("Default Gateway IP  :", c.DefaultGateway)
+	fmt.Println("Default Gateway MAC :", c.DefaultGatewayMAC)
+	fmt.Println("Backup Gateway IP   :", c.BackupGateway)
+	fmt.Println("Backup Gateway MAC  :", c.BackupGatewayMAC)
+	fmt.Println("SNMP Community      :", c.CommunityString)
+	if c.VLANEnabled {
+		fmt.Println("802.1q VLAN ID      :", c.VLANID)
+	} else {
+		fmt.Println("802.1q VLAN ID      : Disabled")
+	}
+	fmt.Println("802.1q VLAN Priority:", c.VLANPriority)
+	fmt.Println("RMCP+ Cipher Suites :", c.CipherSuites)
+	for k, p := range c.CipherSuitePrivileges {
+		if k < len(c.CipherSuites) {
+			fmt.Printf("  Cipher Suite %-2d   : %v\n", c.CipherSuites[k], p)
+		}
+	}
+	for _, d := range c.Destinations {
+		fmt.Printf("Destination %-2d      : type %d, %v %v", d.Index, d.Type, d.IPAddress, d.MACAddress)
+		if d.VLANEnabled {
+			fmt.Printf(", VLAN %d priority %d", d.VLANID, d.VLANPriority)
+		}
+		fmt.Println()
 	}
+}
 
-	ipmi, err := ipmi.Open(0)
+func channelInfo() {
+	// What sessions of the highest standard privilege may log in with.
+	priv := ipmi.PrivilegeAdmin
+
+	ipmi, err := open()
 	if err != nil {
 		log.Fatal(err)
 	}
 	defer ipmi.Close()
 
-	// data 1	completion code
-	// data 2	parameter revision, 0x11
-	// data 3:N	data
+	channel := byte(*flagChannel)
+	c, err := ipmi.GetChannelInfo(channel)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Channel             :", c.Channel)
+	fmt.Println("Medium              :", c.Medium)
+	fmt.Println("Protocol            :", c.Protocol)
+	fmt.Println("Session Support     :", c.SessionSupport)
+	fmt.Println("Active Sessions     :", c.ActiveSessions)
+	fmt.Println("Protocol Vendor ID  :", c.VendorID)
+
+	a, err := ipmi.GetChannelAuthCapabilities(channel, priv)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Auth Types (Admin)  :", a.AuthTypes)
+	fmt.Printf("IPMI Sessions       : v1.5 %t, v2.0 %t\n", a.IPMIv15, a.IPMIv20)
+	fmt.Println("K_G Set             :", a.KGSet)
+	fmt.Println("Per-message Auth    :", a.PerMessageAuth)
+	fmt.Println("User Level Auth     :", a.UserLevelAuth)
+	fmt.Println("Non-null Users      :", a.NonNullUsers)
+	fmt.Println("Null Users          :", a.NullUsers)
+	fmt.Println("Anonymous Login     :", a.AnonymousLogin)
+}
 
-	// set in progress
-	if buf, err := ipmi.GetLanConfig(1, setInProgress); err != nil {
-		fmt.Printf("Failed to get LAN config: %v\n", err)
-	} else {
-		fmt.Printf("Set In Progress   : ")
-		if int(buf[2]) < len(setInProgressStr) {
-			fmt.Println(setInProgressStr[buf[2]])
-		} else {
-			fmt.Println("Unknown")
-			fmt.Printf("%v\n", buf)
+func pefInfo() {
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	caps, err := ipmi.GetPEFCapabilities()
+	if err != nil {
+		log.Fatal(err)
+	}
+	c, err := ipmi.GetPEFConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%-22s: %d.%d\n", "PEF Version", caps.Version&0xF, caps.Version>>4)
+	fmt.Printf("%-22s: %v\n", "Supported Actions", caps.Actions)
+	fmt.Printf("%-22s: %d\n", "Event Filters", caps.Filters)
+	fmt.Printf("%-22s: %t\n", "PEF Enabled", c.Enabled)
+	fmt.Printf("%-22s: %t\n", "PEF Event Messages", c.EventMessages)
+	fmt.Printf("%-22s: %v\n", "Enabled Actions", c.Actions)
+	if c.StartupDelayEnabled {
+		fmt.Printf("%-22s: %ds\n", "Startup Delay", c.StartupDelay)
+	}
+	if c.AlertStartupDelayEnabled {
+		fmt.Printf("%-22s: %ds\n", "Alert Startup Delay", c.AlertStartupDelay)
+	}
+	for _, f := range c.Filters {
+		// Unused entries are all zero but for their number.
+		if !f.Enabled && f.Actions == 0 && f.SensorType == 0 {
+			continue
+		}
+		state := "disabled"
+		if f.Enabled {
+			state = "enabled"
+		}
+		if f.Preconfigured {
+			state += ", preconfigured"
+		}
+		fmt.Printf("Filter %-3d: %s, sensor type %#02x number %#02x trigger %#02x offsets %#04x, %v: %v, policy %d\n",
+			f.Number, state, f.SensorType, f.SensorNumber, f.EventTrigger, f.OffsetMask, f.Severity, f.Actions, f.Policy)
+	}
+	for _, p := range c.Policies {
+		if p.Policy == 0 {
+			continue
+		}
+		state := "disabled"
+		if p.Enabled {
+			state = "enabled"
 		}
+		fmt.Printf("Policy entry %-3d: policy %d %s, %v, channel %d destination %d, string %d\n",
+			p.Entry, p.Policy, state, p.Rule, p.Channel, p.Destination, p.StringSet)
 	}
+}
 
-	// ip address source
-	if buf, err := ipmi.GetLanConfig(1, IPAddressSrc); err != nil {
-		fmt.Printf("Failed to get LAN config: %v\n", err)
-	} else {
-		fmt.Printf("IP Address Source : ")
-		if int(buf[2]) < len(IPAddressSrcStr) {
-			fmt.Println(IPAddressSrcStr[buf[2]])
-		} else {
-			fmt.Println("Other")
-			fmt.Printf("%v\n", buf)
+func watchdog() {
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	c, err := ipmi.GetWatchdog()
+	if err != nil {
+		log.Fatal(err)
+	}
+	running, logging := "Stopped", "On"
+	if c.Running {
+		running = "Running"
+	}
+	if c.DontLog {
+		logging = "Off"
+	}
+	fmt.Printf("%-22s: %v\n", "Timer Use", c.Use)
+	fmt.Printf("%-22s: %s\n", "Timer", running)
+	fmt.Printf("%-22s: %s\n", "Logging", logging)
+	fmt.Printf("%-22s: %v\n", "Timeout Action", c.Action)
+	fmt.Printf("%-22s: %v, %v before timeout\n", "Pre-timeout Interrupt", c.PreTimeoutAction, c.PreTimeout)
+	fmt.Printf("%-22s: %#02x\n", "Expiration Flags", c.Expired)
+	fmt.Printf("%-22s: %v\n", "Initial Countdown", c.Countdown)
+	fmt.Printf("%-22s: %v\n", "Present Countdown", c.Remaining)
+}
+
+func dcmiInfo() {
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	c, err := ipmi.GetDCMICapabilities()
+	if err != nil {
+		log.Fatal(err)
+	}
+	yes := func(b bool) string {
+		if b {
+			return "available"
 		}
+		return "unavailable"
 	}
+	fmt.Printf("%-26s: %d.%d\n", "DCMI Version", c.Major, c.Minor)
+	fmt.Printf("%-26s: %s\n", "Power Management", yes(c.PowerManagement))
+	fmt.Printf("%-26s: %s\n", "In-band System Interface", yes(c.InBand))
+	fmt.Printf("%-26s: %s\n", "Serial TMODE", yes(c.SerialTMode))
+	fmt.Printf("%-26s: %s\n", "Secondary LAN Channel", yes(c.SecondaryLAN))
+	fmt.Printf("%-26s: %s\n", "Primary LAN Channel", yes(c.PrimaryLAN))
+	fmt.Printf("%-26s: %s\n", "SOL", yes(c.SOL))
+	fmt.Printf("%-26s: %s\n", "VLAN", yes(c.VLAN))
+	fmt.Printf("%-26s: %d, flushed when full: %t\n", "SEL Entries", c.SELEntries, c.SELOverflowFlush)
+	fmt.Printf("%-26s: asset tag %s, host name %s, GUID %s\n", "Identification", yes(c.AssetTag), yes(c.HostName), yes(c.GUID))
+	fmt.Printf("%-26s: inlet %s, processor %s, baseboard %s, every %v\n", "Temperature Monitoring",
+		yes(c.InletTemperature), yes(c.ProcessorTemperature), yes(c.BaseboardTemperature), c.TemperatureSampling)
 
-	// ip address
-	if buf, err := ipmi.GetLanConfig(1, IPAddress); err != nil {
-		fmt.Printf("Failed to get LAN config: %v\n", err)
-	} else {
-		fmt.Printf("IP Address        : ")
-		if len(buf) == 6 {
-			fmt.Printf("%d.%d.%d.%d\n", buf[2], buf[3], buf[4], buf[5])
+	if c.PowerManagement {
+		if r, err := ipmi.GetPowerReading(); err != nil {
+			fmt.Printf("%-26s: %v\n", "Power Reading", err)
 		} else {
-			fmt.Printf("Unknown\n")
+			fmt.Printf("%-26s: %dW\n", "Instantaneous Power", r.Current)
+			fmt.Printf("%-26s: %dW / %dW / %dW over %v\n", "Minimum / Maximum / Average", r.Min, r.Max, r.Average, r.Period)
+			fmt.Printf("%-26s: %v\n", "Reading Time", r.Time)
+			fmt.Printf("%-26s: %t\n", "Power Measurement Active", r.Active)
+		}
+		if l, err := ipmi.GetPowerLimit(); err != nil {
+			fmt.Printf("%-26s: %v\n", "Power Limit", err)
+		} else {
+			fmt.Printf("%-26s: %dW, %v after %v, sampled every %v\n", "Power Limit", l.Limit, l.Action, l.Correction, l.Sampling)
 		}
 	}
 
-	// MAC address
-	if buf, err := ipmi.GetLanConfig(1, MACAddress); err != nil {
-		fmt.Printf("Failed to get LAN config: %v\n", err)
-	} else {
-		fmt.Printf("MAC Address       : ")
-		if len(buf) == 8 {
-			fmt.Printf("%02x:%02x:%02x:%02x:%02x:%02x\n", buf[2], buf[3], buf[4], buf[5], buf[6], buf[7])
+	if c.AssetTag {
+		if tag, err := ipmi.GetAssetTag(); err != nil {
+			fmt.Printf("%-26s: %v\n", "Asset Tag", err)
 		} else {
-			fmt.Printf("Unknown\n")
+			fmt.Printf("%-26s: %s\n", "Asset Tag", tag)
+		}
+	}
+}
+
+func resetBMC(how string) {
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	switch how {
+	case "cold":
+		err = ipmi.ColdReset()
+	case "warm":
+		err = ipmi.WarmReset()
+	default:
+		log.Fatalf("-reset must be cold or warm, not %q", how)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("BMC %s reset, waiting for it to be back\n", how)
+	if err := ipmi.WaitBMC(2 * time.Minute); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("BMC is back")
+}
+
+func selfTest() {
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	r, err := ipmi.GetSelfTestResults()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%-26s: %s\n", "Self Test Results", r)
+}
+
+func setDCMI(watts int, tag string) {
+	if watts > 0xFFFF {
+		log.Fatal("-power-limit must be at most 65535 watts")
+	}
+	limit := &ipmi.PowerLimit{
+		Action:     ipmi.PowerLimitLogSEL,
+		Limit:      uint16(watts),
+		Correction: time.Second,
+		Sampling:   time.Second,
+	}
+
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	switch {
+	case watts == 0:
+		if err := ipmi.ActivatePowerLimit(false); err != nil {
+			log.Fatal(err)
+		}
+	case watts > 0:
+		// Keep the timings of a limit already set.
+		if l, err := ipmi.GetPowerLimit(); err == nil {
+			limit.Correction, limit.Sampling = l.Correction, l.Sampling
+		}
+		if err := ipmi.SetPowerLimit(limit); err != nil {
+			log.Fatal(err)
+		}
+		if err := ipmi.ActivatePowerLimit(true); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if tag != "" {
+		if err := ipmi.SetAssetTag(tag); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func hpmInfo() {
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	c, err := ipmi.GetHPMCapabilities()
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%-24s: %d\n", "HPM.1 Version", c.Version)
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"Degraded During Upgrade", c.Degraded},
+		{"Deferred Activation", c.DeferredActivation},
+		{"Services Affected", c.ServicesAffected},
+		{"Manual Rollback", c.ManualRollback},
+		{"Automatic Rollback", c.AutomaticRollback},
+		{"Self Test", c.SelfTest},
+		{"Upgrade Undesirable", c.Undesirable},
+		{"Rollback Overridden", c.RollbackOverridden},
+	} {
+		fmt.Printf("%-24s: %t\n", f.name, f.set)
+	}
+	fmt.Printf("%-24s: %v\n", "Upgrade Timeout", c.UpgradeTimeout)
+	fmt.Printf("%-24s: %v\n", "Self Test Timeout", c.SelfTestTimeout)
+	fmt.Printf("%-24s: %v\n", "Rollback Timeout", c.RollbackTimeout)
+	fmt.Printf("%-24s: %v\n", "Inaccessibility Timeout", c.InaccessibilityTimeout)
+
+	for id := byte(0); id < 8; id++ {
+		if !c.Has(id) {
+			continue
+		}
+		comp, err := ipmi.GetHPMComponent(id)
+		if err != nil {
+			fmt.Printf("Component %d: %v\n", id, err)
+			continue
+		}
+		fmt.Printf("Component %d: %-12s | version %v | aux % x\n", id, comp.Description, comp.Version, comp.Version.Aux)
+	}
+}
+
+func hpmFlash(file string, id int) {
+	image, err := ioutil.ReadFile(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if bytes.HasPrefix(image, []byte("PICMGFWU")) {
+		hpmUpgrade(image)
+		return
+	}
+	if id < 0 || id > 7 {
+		log.Fatal("-hpm-flash needs an -hpm-component from 0 to 7")
+	}
+	prepare := ipmi.HPMPrepare
+
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	c, err := ipmi.GetHPMCapabilities()
+	if err != nil {
+		log.Fatal(err)
+	}
+	comp, err := ipmi.GetHPMComponent(byte(id))
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Upgrading component %d, %s, from version %v\n", id, comp.Description, comp.Version)
+	if comp.Preparation {
+		if err := ipmi.InitiateHPMUpgrade(c, 1<<uint(id), prepare); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err := ipmi.UploadHPMFirmware(c, byte(id), image); err != nil {
+		log.Fatal(err)
+	}
+	if err := ipmi.ActivateHPMFirmware(c); err != nil {
+		log.Fatal(err)
+	}
+	if comp, err = ipmi.GetHPMComponent(byte(id)); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Component %d is at version %v\n", id, comp.Version)
+}
+
+func hpmUpgrade(b []byte) {
+	img, err := ipmi.ParseHPMImage(b)
+	if err != nil {
+		log.Fatal(err)
+	}
+	upToDate := ipmi.ErrHPMUpToDate
+	o := &ipmi.HPMUpgradeOptions{
+		Force: *flagHPMFrc,
+		Progress: func(format string, v ...interface{}) {
+			fmt.Printf(format+"\n", v...)
+		},
+	}
+	fmt.Printf("Image version %v of %v, for device %#02x of manufacturer %d, product %#04x\n",
+		img.Version, img.Time.Format("2006-01-02"), img.DeviceID, img.ManufacturerID, img.ProductID)
+
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	switch err := ipmi.UpgradeHPM(img, o); err {
+	case nil:
+		fmt.Println("Upgrade done")
+	case upToDate:
+		fmt.Println("Nothing to upgrade: " + err.Error())
+	default:
+		log.Fatal(err)
+	}
+}
+
+func oemCommand(args []string) {
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	e, m, err := ipmi.OEMExtension()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if args[0] == "list" {
+		fmt.Printf("%s (manufacturer %d) OEM commands:\n", e.Name, m)
+		for _, n := range e.Names() {
+			fmt.Printf("  %-20s %s\n", n, e.Commands[n].Usage)
+		}
+		return
+	}
+	v, err := e.Run(ipmi, m, args[0], args[1:]...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch v := v.(type) {
+	case []byte:
+		if len(v) > 0 {
+			fmt.Printf("% x\n", v)
 		}
+	default:
+		fmt.Println(v)
 	}
 }
 
@@ -311,7 +1523,7 @@ func deviceID() {
 		"Chassis Device",        /* bit 7 */
 	}
 
-	ipmi, err := ipmi.Open(0)
+	ipmi, err := open()
 	if err != nil {
 		fmt.Printf("Failed to open ipmi device: %v\n", err)
 	}
@@ -360,10 +1572,68 @@ func deviceID() {
 			fmt.Printf("    0x%02x\n", val)
 		}
 	}
+
+	// GUIDs are optional.
+	if g, err := ipmi.GetDeviceGUID(); err == nil {
+		fmt.Printf("%-26s: %s\n", "Device GUID", g)
+	}
+	if g, err := ipmi.GetSystemGUID(); err == nil {
+		fmt.Printf("%-26s: %s\n", "System GUID", g)
+	}
+}
+
+func eventReceiver(arg string) {
+	a := rawAddr()
+	r := ipmi.EventReceiver{Target: ipmi.EventReceiverDisabled}
+	if arg != "show" && arg != "off" {
+		s := strings.SplitN(arg, ":", 2)
+		t, err := strconv.ParseUint(s[0], 0, 8)
+		if err != nil {
+			log.Fatalf("event receiver address %q: %v", s[0], err)
+		}
+		r.Target = byte(t)
+		if len(s) == 2 {
+			l, err := strconv.ParseUint(s[1], 0, 2)
+			if err != nil {
+				log.Fatalf("event receiver LUN %q: %v", s[1], err)
+			}
+			r.LUN = byte(l)
+		}
+	}
+
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+
+	if arg == "show" {
+		r, err = ipmi.GetEventReceiver(a)
+	} else {
+		err = ipmi.SetEventReceiver(a, r)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println("Event receiver:", r)
+}
+
+func rawAddr() ipmi.Addr {
+	if *flagBridge > 0xff || *flagTarget > 0xff || *flagLUN > 3 || *flagTBridge > 0xff || *flagTTarget > 0xff {
+		log.Fatal("-b and -t must be bytes and -l from 0 to 3")
+	}
+	return ipmi.Addr{
+		Channel:        byte(*flagBridge),
+		Target:         byte(*flagTarget),
+		LUN:            byte(*flagLUN),
+		TransitChannel: byte(*flagTBridge),
+		TransitTarget:  byte(*flagTTarget),
+	}
 }
 
 func sendRawCmd(cmds []string) {
-	ipmi, err := ipmi.Open(0)
+	a := rawAddr()
+	ipmi, err := open()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -380,7 +1650,7 @@ func sendRawCmd(cmds []string) {
 		data = append(data, byte(val))
 	}
 
-	if buf, err := ipmi.RawCmd(data); err != nil {
+	if buf, err := ipmi.RawCmdTo(a, data); err != nil {
 		fmt.Printf("Unable to send RAW command: %v\n", err)
 	} else {
 		for i, x := range buf {
@@ -391,3 +1661,25 @@ func sendRawCmd(cmds []string) {
 		}
 	}
 }
+
+func execScript(file string) {
+	a := rawAddr()
+	f, err := os.Open(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	steps, err := ipmi.ParseScript(f)
+	f.Close()
+	if err != nil {
+		log.Fatalf("%s: %v", file, err)
+	}
+
+	ipmi, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer ipmi.Close()
+	if err := ipmi.RunScript(a, steps, os.Stdout); err != nil {
+		log.Fatalf("%s: %v", file, err)
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/u-root/u-root/pkg/ipmi"
+)
+
+func TestParseIdentify(t *testing.T) {
+	for _, tt := range []struct {
+		in    string
+		d     time.Duration
+		force bool
+		err   bool
+	}{
+		{in: "off"},
+		{in: "force", force: true},
+		{in: "30s", d: 30 * time.Second},
+		{in: "forever", err: true},
+	} {
+		d, force, err := parseIdentify(tt.in)
+		if (err != nil) != tt.err || d != tt.d || force != tt.force {
+			t.Errorf("parseIdentify(%q) = %v, %v, %v", tt.in, d, force, err)
+		}
+	}
+}
+
+func TestParseButtons(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want ipmi.FrontPanelButtons
+		err  bool
+	}{
+		{in: "none"},
+		{in: "power", want: ipmi.FrontPanelPowerOff},
+		{in: "power, reset", want: ipmi.FrontPanelPowerOff | ipmi.FrontPanelReset},
+		{in: "diag,standby", want: ipmi.FrontPanelDiagInterrupt | ipmi.FrontPanelStandby},
+		{in: "eject", err: true},
+	} {
+		got, err := parseButtons(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("parseButtons(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseSOLSettings(t *testing.T) {
+	set, err := parseSOLSettings("enable=true, privilege=operator,baud=115200,retries=7,retry-interval=500ms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &ipmi.SOLConfig{Privilege: ipmi.PrivilegeAdmin, SendThreshold: 96}
+	set(c)
+	want := ipmi.SOLConfig{
+		Enabled:         true,
+		Privilege:       ipmi.PrivilegeOperator,
+		SendThreshold:   96,
+		Retries:         7,
+		RetryInterval:   500 * time.Millisecond,
+		BitRate:         ipmi.SOLBitRate115200,
+		VolatileBitRate: ipmi.SOLBitRate115200,
+	}
+	if *c != want {
+		t.Errorf("parseSOLSettings set %+v, want %+v", *c, want)
+	}
+
+	for _, bad := range []string{"enable", "enable=maybe", "privilege=root", "baud=4800", "retries=8", "retry-interval=1", "speed=fast"} {
+		if _, err := parseSOLSettings(bad); err == nil {
+			t.Errorf("parseSOLSettings(%q) did not fail", bad)
+		}
+	}
+}
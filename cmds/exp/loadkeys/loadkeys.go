@@ -0,0 +1,80 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// loadkeys sets the console's keyboard layout.
+//
+// Synopsis:
+//     loadkeys [-C CONSOLE] [-l] LAYOUT|FILE
+//
+// Description:
+//     loadkeys loads a built-in layout, such as de or fr, or a keymap file
+//     in the loadkeys format, so that prompts read what was typed on a
+//     non-US keyboard. Keymap files may include the built-in layouts,
+//     e.g. include "de", but only understand keycode, keymaps and
+//     include lines.
+//
+// Options:
+//     -C: console device (default /dev/tty0, or /dev/console)
+//     -l: list the built-in layouts
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/keymap"
+)
+
+var (
+	console = flag.String("C", "", "console device (default /dev/tty0, or /dev/console)")
+	list    = flag.Bool("l", false, "list the built-in layouts")
+)
+
+func load(name string) (*keymap.Keymap, error) {
+	if !strings.ContainsRune(name, '/') {
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			return keymap.Layout(name)
+		}
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	m, err := keymap.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return m, nil
+}
+
+func main() {
+	flag.Parse()
+	if *list {
+		fmt.Println(strings.Join(keymap.Layouts(), "\n"))
+		return
+	}
+	if flag.NArg() != 1 {
+		log.Fatal("usage: loadkeys [-C CONSOLE] [-l] LAYOUT|FILE")
+	}
+	m, err := load(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *console == "" {
+		err = m.LoadConsole()
+	} else {
+		var f *os.File
+		if f, err = os.OpenFile(*console, os.O_WRONLY, 0); err == nil {
+			err = m.Load(f)
+			f.Close()
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// lsinitrd lists and extracts the contents of an initrd.
+//
+// Synopsis:
+//     lsinitrd [-s] [-m] [-x DIR [-j N]] INITRD [FILE...]
+//
+// Description:
+//     lsinitrd reads an initrd the way the kernel does: as a series of cpio
+//     archives, each of which may be compressed. It lists the files in each
+//     segment, or only those named. It helps to find out why an initrd that
+//     boots from a boot loader does not boot after kexec.
+//
+// Options:
+//     -s: only print the segments
+//     -m: only print early microcode
+//     -x: extract the files, or only those named, into DIR
+//     -j: extract N files at once, default one per CPU
+//     -progress: progress output while extracting: auto, tty, lines, json
+//        or none (default)
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/u-root/u-root/pkg/boot/initrd"
+	"github.com/u-root/u-root/pkg/cpio"
+	"github.com/u-root/u-root/pkg/progress"
+)
+
+var (
+	segmentsOnly  = flag.Bool("s", false, "only print the segments")
+	microcodeOnly = flag.Bool("m", false, "only print early microcode")
+	extractDir    = flag.String("x", "", "extract files into this directory")
+	jobs          = flag.Int("j", 0, "number of files to extract at once, 0 for one per CPU")
+	mode          = flag.String("progress", progress.None, "progress output while extracting: auto, tty, lines, json or none")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: lsinitrd [-s] [-m] [-x DIR [-j N]] INITRD [FILE...]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func compression(s initrd.Segment) string {
+	if s.Compression == initrd.None {
+		return "uncompressed"
+	}
+	return s.Compression
+}
+
+func printMicrocode(segs []initrd.Segment) {
+	mc := initrd.FindMicrocode(segs)
+	if len(mc) == 0 {
+		fmt.Println("No early microcode")
+		return
+	}
+	for _, m := range mc {
+		fmt.Printf("%s: %s, %d bytes in segment %d\n", m.Vendor, m.Name, m.Size, m.Segment)
+		if segs[m.Segment].Compression != initrd.None {
+			fmt.Printf("  not loaded: the segment is %s\n", segs[m.Segment].Compression)
+		}
+		for _, u := range m.Updates {
+			fmt.Printf("  %s\n", u)
+		}
+	}
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() < 1 {
+		usage()
+	}
+
+	f, err := os.Open(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	// Print what could be read even if a later segment is broken.
+	segs, err := initrd.Segments(f)
+
+	want := make(map[string]bool)
+	for _, n := range flag.Args()[1:] {
+		want[cpio.Normalize(n)] = true
+	}
+
+	switch {
+	case *microcodeOnly:
+		printMicrocode(segs)
+	case *extractDir != "":
+		rep, perr := progress.NewReporter(*mode, os.Stderr)
+		if perr != nil {
+			log.Fatal(perr)
+		}
+		m := progress.New("extract", 0, rep)
+		var recs []cpio.Record
+		var size int64
+		for _, s := range segs {
+			for _, r := range s.Records {
+				if len(want) == 0 || want[cpio.Normalize(r.Name)] {
+					if r.ReaderAt != nil {
+						size += int64(r.FileSize)
+						r.ReaderAt = m.ReaderAt(r.ReaderAt)
+					}
+					recs = append(recs, r)
+				}
+			}
+		}
+		m.SetTotal(size)
+		xerr := initrd.ExtractAll(recs, *extractDir, *jobs)
+		m.Finish(xerr)
+		if xerr != nil {
+			log.Printf("Cannot extract: %v", xerr)
+		}
+	default:
+		for i, s := range segs {
+			fmt.Printf("Segment %d at %#x: %s, %d files\n", i, s.Offset, compression(s), len(s.Records))
+			if *segmentsOnly {
+				continue
+			}
+			for _, r := range s.Records {
+				if len(want) == 0 || want[cpio.Normalize(r.Name)] {
+					fmt.Printf("  %s\n", r)
+				}
+			}
+		}
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,198 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// mdadm creates, monitors and manages Linux software RAID arrays.
+//
+// Synopsis:
+//     mdadm -create [-level LEVEL] [-chunk KIB] ARRAY DEVICE...
+//     mdadm [-detail] [ARRAY...]
+//     mdadm -monitor [-interval DURATION] [ARRAY...]
+//     mdadm -fail|-remove|-add ARRAY DEVICE...
+//     mdadm -stop ARRAY...
+//
+// Description:
+//     -create builds a RAID0, RAID1 or RAID10 array, e.g. md0, from the
+//     devices with 0.90 metadata, which the kernel can autodetect at
+//     boot. Redundant arrays resync in the background.
+//
+//     Without a mode, mdadm prints the status of the arrays, or of all of
+//     them. -monitor prints events such as Fail, DegradedArray and
+//     RebuildFinished as they happen, until killed.
+//
+//     -fail marks devices faulty and -remove takes faulty or spare devices
+//     out of the array. -add adds spares, which rebuild a degraded array;
+//     the kernel only allows it for 0.90 arrays.
+//
+// Options:
+//     -create:   create an array
+//     -level:    RAID level: 0, 1 or 10
+//     -chunk:    chunk size in KiB for RAID0 and RAID10
+//     -detail:   print array status (the default)
+//     -monitor:  print array events
+//     -interval: how often -monitor checks the arrays
+//     -fail:     mark devices faulty
+//     -remove:   remove devices
+//     -add:      add devices as spares
+//     -stop:     stop arrays
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/u-root/u-root/pkg/mount/md"
+)
+
+var (
+	create   = flag.Bool("create", false, "create an array")
+	level    = flag.String("level", "1", "RAID level: 0, 1 or 10")
+	chunk    = flag.Int("chunk", 0, "chunk size in KiB for RAID0 and RAID10, 0 for the default")
+	detail   = flag.Bool("detail", false, "print array status")
+	monitor  = flag.Bool("monitor", false, "print array events until killed")
+	interval = flag.Duration("interval", 5*time.Second, "how often -monitor checks the arrays")
+	fail     = flag.Bool("fail", false, "mark devices faulty")
+	remove   = flag.Bool("remove", false, "remove faulty or spare devices")
+	add      = flag.Bool("add", false, "add devices as spares")
+	stop     = flag.Bool("stop", false, "stop arrays")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: mdadm [-create|-detail|-monitor|-fail|-remove|-add|-stop] [options] [ARRAY [DEVICE...]]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+// arrays returns names, or all arrays if there are none.
+func arrays(names []string) ([]string, error) {
+	if len(names) > 0 {
+		return names, nil
+	}
+	return md.Arrays()
+}
+
+func printStatus(names []string) error {
+	names, err := arrays(names)
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		a, err := md.Status(n)
+		if err != nil {
+			return err
+		}
+		fmt.Println(a)
+	}
+	return nil
+}
+
+// watch prints the events of the arrays names, or all arrays, every
+// interval.
+func watch(names []string, interval time.Duration) error {
+	all := len(names) == 0
+	last := make(map[string]*md.Array)
+	for first := true; ; first = false {
+		current, err := arrays(names)
+		if err != nil {
+			return err
+		}
+		now := make(map[string]*md.Array)
+		for _, n := range current {
+			a, err := md.Status(n)
+			if err != nil {
+				// Arrays named but not there yet may turn up.
+				if first && !all {
+					log.Print(err)
+				}
+				continue
+			}
+			now[a.Name] = a
+			if first {
+				fmt.Println(a)
+			}
+		}
+		if !first {
+			for n, a := range now {
+				for _, e := range md.Events(last[n], a) {
+					fmt.Printf("%s %s\n", time.Now().Format(time.RFC3339), e)
+				}
+			}
+			for n, a := range last {
+				if _, ok := now[n]; !ok {
+					for _, e := range md.Events(a, nil) {
+						fmt.Printf("%s %s\n", time.Now().Format(time.RFC3339), e)
+					}
+				}
+			}
+		}
+		last = now
+		time.Sleep(interval)
+	}
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	args := flag.Args()
+
+	modes := 0
+	for _, b := range []bool{*create, *detail, *monitor, *fail, *remove, *add, *stop} {
+		if b {
+			modes++
+		}
+	}
+	if modes > 1 {
+		usage()
+	}
+
+	var err error
+	switch {
+	case *create:
+		if len(args) < 2 {
+			usage()
+		}
+		l, perr := md.ParseLevel(*level)
+		if perr != nil {
+			log.Fatal(perr)
+		}
+		err = md.Create(args[0], l, *chunk<<10, args[1:])
+		if err == nil {
+			err = printStatus(args[:1])
+		}
+	case *monitor:
+		err = watch(args, *interval)
+	case *fail, *remove, *add:
+		if len(args) < 2 {
+			usage()
+		}
+		op := md.Fail
+		switch {
+		case *remove:
+			op = md.Remove
+		case *add:
+			op = md.Add
+		}
+		for _, d := range args[1:] {
+			if err = op(args[0], d); err != nil {
+				break
+			}
+		}
+	case *stop:
+		if len(args) == 0 {
+			usage()
+		}
+		for _, a := range args {
+			if err = md.Stop(a); err != nil {
+				break
+			}
+		}
+	default:
+		err = printStatus(args)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// memtest tests RAM with memtester-style patterns.
+//
+// Synopsis:
+//     memtest [-f fraction] [-j workers] [-l loops] [-p pattern,...] [-numa] [-d duration]
+//
+// Description:
+//     memtest locks a fraction of available memory and runs walking-ones,
+//     walking-zeros, random and address-in-address patterns over it. Each
+//     bad word is printed with its physical address when the kernel lets us
+//     find it; past the first 1000, failures are only counted. memtest
+//     exits 1 if any word failed, so it can gate a boot.
+//
+// Options:
+//     -f:    fraction of available memory to test (default 0.5)
+//     -j:    workers per NUMA node (default: one per CPU)
+//     -l:    number of times to run all patterns (default 1)
+//     -p:    comma separated patterns to run (default: all)
+//     -numa: test each node's memory from its own CPUs
+//     -d:    stop after this long
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/u-root/u-root/pkg/memtest"
+)
+
+var (
+	fraction = flag.Float64("f", 0.5, "fraction of available memory to test")
+	workers  = flag.Int("j", 0, "workers per NUMA node (default: one per CPU)")
+	loops    = flag.Int("l", 1, "number of times to run all patterns")
+	patterns = flag.String("p", "", "comma separated patterns to run (default: all)")
+	numa     = flag.Bool("numa", false, "test each node's memory from its own CPUs")
+	duration = flag.Duration("d", 0, "stop after this long")
+	verbose  = flag.Bool("v", false, "print progress")
+)
+
+func main() {
+	flag.Parse()
+
+	c := memtest.Config{
+		Fraction: *fraction,
+		Workers:  *workers,
+		Loops:    *loops,
+		NUMA:     *numa,
+	}
+	if *patterns != "" {
+		for _, name := range strings.Split(*patterns, ",") {
+			p, err := memtest.PatternByName(name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			c.Patterns = append(c.Patterns, p)
+		}
+	}
+	if *verbose {
+		c.Progress = func(node int, pattern string, loop int) {
+			log.Printf("node %d: loop %d: %s done", node, loop, pattern)
+		}
+	}
+
+	ctx := context.Background()
+	if *duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *duration)
+		defer cancel()
+	}
+
+	start := time.Now()
+	fails, n, err := memtest.Run(ctx, c)
+	for _, f := range fails {
+		fmt.Println(f)
+	}
+	if n > len(fails) {
+		fmt.Printf("... and %d more failures\n", n-len(fails))
+	}
+	if err != nil && err != context.DeadlineExceeded {
+		log.Fatal(err)
+	}
+	log.Printf("memtest finished in %v with %d failures", time.Since(start), n)
+	if n > 0 {
+		os.Exit(1)
+	}
+}
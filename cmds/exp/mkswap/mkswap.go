@@ -0,0 +1,95 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// mkswap sets up a swap area on a device or file.
+//
+// Synopsis:
+//     mkswap [-L LABEL] [-U UUID] [-s SIZE] PATH
+//
+// Description:
+//     mkswap writes a swap header to PATH, a block device or file, to use
+//     all of it as swap. With -s, it makes a new swap file of SIZE, e.g.
+//     2G, which is written out in full since swap files cannot have
+//     holes. Enable the area with swapon.
+//
+// Options:
+//     -L: label of the area
+//     -U: UUID of the area, random by default
+//     -s: make a new swap file of this size
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/rck/unit"
+	"github.com/u-root/u-root/pkg/swap"
+)
+
+var (
+	label = flag.String("L", "", "label of the swap area")
+	uuid  = flag.String("U", "", "UUID of the swap area, random by default")
+	size  = unit.MustNewUnit(unit.DefaultUnits).MustNewValue(0, unit.None)
+)
+
+func init() {
+	flag.Var(size, "s", "make a new swap file of this size")
+}
+
+func parseUUID(s string) ([16]byte, error) {
+	var u [16]byte
+	b, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil || len(b) != len(u) {
+		return u, fmt.Errorf("bad UUID %q", s)
+	}
+	copy(u[:], b)
+	return u, nil
+}
+
+func randomUUID() ([16]byte, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return u, err
+	}
+	// Version 4, variant 1.
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return u, nil
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatal("usage: mkswap [-L LABEL] [-U UUID] [-s SIZE] PATH")
+	}
+	path := flag.Arg(0)
+
+	h := &swap.Header{Label: *label}
+	var err error
+	if *uuid != "" {
+		h.UUID, err = parseUUID(*uuid)
+	} else {
+		h.UUID, err = randomUUID()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if size.IsSet {
+		err = swap.MakeFile(path, size.Value, h)
+	} else {
+		err = swap.MakeDevice(path, h)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	u := hex.EncodeToString(h.UUID[:])
+	fmt.Printf("Set up swap space of %d KiB on %s, UUID=%s-%s-%s-%s-%s\n",
+		int64(h.Pages-1)*int64(os.Getpagesize())>>10, path, u[:8], u[8:12], u[12:16], u[16:20], u[20:])
+}
@@ -5,8 +5,15 @@
 // modprobe - Add and remove modules from the Linux Kernel
 //
 // Synopsis:
-//     modprobe [-n] modulename [parameters...]
-//     modprobe [-n] -a modulename...
+//     modprobe [-n] [-keys FILE] [-require-signed] modulename [parameters...]
+//     modprobe [-n] [-keys FILE] [-require-signed] -a modulename...
+//
+// Description:
+//     Modules are checked against the signing certificates in FILE, by
+//     default /etc/kmodule/signing_keys.pem if it exists, before they are
+//     loaded; badly signed modules are refused. Unsigned modules are refused
+//     with -require-signed, or module.sig_enforce=1 on the kernel command
+//     line.
 //
 // Author:
 //     Roland Kammerer <dev.rck@gmail.com>
@@ -21,7 +28,7 @@ import (
 	"github.com/u-root/u-root/pkg/kmodule"
 )
 
-const cmd = "modprobe [-an] modulename[s] [parameters...]"
+const cmd = "modprobe [-an] [-keys FILE] [-require-signed] modulename[s] [parameters...]"
 
 var (
 	dryRun     = flag.Bool("n", false, "Dry run")
@@ -29,6 +36,8 @@ var (
 	verboseAll = flag.Bool("va", false, "Insert all module names on the command line.")
 	rootDir    = flag.String("d", "/", "Root directory for modules")
 	kernelVer  = flag.String("S", "", "Set kernel version instead of using uname")
+	keys       = flag.String("keys", "", "file of module signing certificates")
+	reqSigned  = flag.Bool("require-signed", false, "refuse unsigned modules")
 )
 
 func init() {
@@ -48,9 +57,15 @@ func main() {
 		os.Exit(1)
 	}
 
+	p, err := kmodule.NewPolicy(*keys, *reqSigned)
+	if err != nil {
+		log.Fatalf("modprobe: %v", err)
+	}
+
 	opts := kmodule.ProbeOpts{
 		RootDir: *rootDir,
 		KVer:    *kernelVer,
+		Policy:  p,
 	}
 	if *dryRun {
 		log.Println("Unique dependencies in load order, already loaded ones get skipped:")
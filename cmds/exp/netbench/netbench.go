@@ -0,0 +1,319 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// netbench measures TCP and UDP throughput between two machines, like a
+// tiny iperf.
+//
+// Synopsis:
+//     netbench -s [-u] [-p port]
+//     netbench -c host [-u] [-p port] [-t duration] [-l length] [-P streams] [-b bits/s]
+//
+// Description:
+//     One side runs as a server, the other as a client that sends for -t.
+//     For TCP both sides report the throughput they saw. For UDP the server
+//     also counts lost and reordered datagrams and sends its report back to
+//     the client.
+//
+// Options:
+//     -s: run as server
+//     -c: run as client connecting to host
+//     -u: use UDP instead of TCP
+//     -p: port (default 5201)
+//     -t: how long the client sends (default 10s)
+//     -l: write or datagram size in bytes (default 128K for TCP, 1400 for UDP)
+//     -P: number of parallel client streams (default 1)
+//     -b: UDP send rate in bits/s, 0 for unlimited (default 1G)
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"sync"
+	"time"
+)
+
+var (
+	server   = flag.Bool("s", false, "run as server")
+	client   = flag.String("c", "", "run as client connecting to host")
+	udp      = flag.Bool("u", false, "use UDP instead of TCP")
+	port     = flag.Int("p", 5201, "port")
+	duration = flag.Duration("t", 10*time.Second, "how long the client sends")
+	length   = flag.Int("l", 0, "write or datagram size in bytes")
+	streams  = flag.Int("P", 1, "number of parallel client streams")
+	rate     = flag.Float64("b", 1e9, "UDP send rate in bits/s, 0 for unlimited")
+)
+
+const (
+	defaultTCPLen = 128 << 10
+	defaultUDPLen = 1400
+
+	// UDP datagrams start with a magic number and a sequence number.
+	udpMagic  = 0x6e626e63
+	udpHeader = 12
+	// finSeq marks the end of a UDP stream.
+	finSeq = ^uint64(0)
+)
+
+// stats is what one side saw of one stream.
+type stats struct {
+	bytes    int64
+	elapsed  time.Duration
+	received uint64
+	lost     uint64
+	reorder  uint64
+}
+
+func (s stats) String() string {
+	secs := s.elapsed.Seconds()
+	if secs == 0 {
+		secs = 1e-9
+	}
+	r := fmt.Sprintf("%d bytes in %v: %.2f Mbit/s", s.bytes, s.elapsed.Round(time.Millisecond), float64(s.bytes)*8/secs/1e6)
+	if s.received > 0 || s.lost > 0 {
+		total := s.received + s.lost
+		r += fmt.Sprintf(", %d/%d datagrams lost (%.2f%%), %d out of order",
+			s.lost, total, float64(s.lost)*100/float64(total), s.reorder)
+	}
+	return r
+}
+
+func tcpServe(l net.Listener, report func(net.Addr, stats)) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer c.Close()
+			start := time.Now()
+			n, _ := io.Copy(ioutil.Discard, c)
+			report(c.RemoteAddr(), stats{bytes: n, elapsed: time.Since(start)})
+		}()
+	}
+}
+
+func tcpSend(addr string, d time.Duration, size int) (stats, error) {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		return stats{}, err
+	}
+	defer c.Close()
+	buf := make([]byte, size)
+	var s stats
+	start := time.Now()
+	for time.Since(start) < d {
+		n, err := c.Write(buf)
+		s.bytes += int64(n)
+		if err != nil {
+			return s, err
+		}
+	}
+	s.elapsed = time.Since(start)
+	return s, nil
+}
+
+type udpStream struct {
+	start, last time.Time
+	bytes       int64
+	received    uint64
+	maxSeq      uint64
+	reorder     uint64
+}
+
+func (u *udpStream) stats() stats {
+	s := stats{bytes: u.bytes, elapsed: u.last.Sub(u.start), received: u.received, reorder: u.reorder}
+	if expect := u.maxSeq + 1; expect > u.received {
+		s.lost = expect - u.received
+	}
+	return s
+}
+
+func udpServe(c net.PacketConn, report func(net.Addr, stats)) error {
+	streams := make(map[string]*udpStream)
+	buf := make([]byte, 64<<10)
+	for {
+		n, addr, err := c.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		if n < udpHeader || binary.BigEndian.Uint32(buf) != udpMagic {
+			continue
+		}
+		seq := binary.BigEndian.Uint64(buf[4:])
+		now := time.Now()
+		s, ok := streams[addr.String()]
+		if seq == finSeq {
+			if ok {
+				delete(streams, addr.String())
+				st := s.stats()
+				report(addr, st)
+				c.WriteTo([]byte(st.String()), addr)
+			}
+			continue
+		}
+		if !ok {
+			s = &udpStream{start: now}
+			streams[addr.String()] = s
+		}
+		s.last = now
+		s.bytes += int64(n)
+		s.received++
+		if seq < s.maxSeq {
+			s.reorder++
+		} else {
+			s.maxSeq = seq
+		}
+	}
+}
+
+// udpSend sends datagrams at bps bits per second and returns the local view
+// and the server's report.
+func udpSend(addr string, d time.Duration, size int, bps float64) (stats, string, error) {
+	if size < udpHeader {
+		return stats{}, "", fmt.Errorf("datagram size %d below minimum %d", size, udpHeader)
+	}
+	c, err := net.Dial("udp", addr)
+	if err != nil {
+		return stats{}, "", err
+	}
+	defer c.Close()
+
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint32(buf, udpMagic)
+	var gap time.Duration
+	if bps > 0 {
+		gap = time.Duration(float64(size*8) / bps * float64(time.Second))
+	}
+
+	var s stats
+	start := time.Now()
+	next := start
+	for seq := uint64(0); time.Since(start) < d; seq++ {
+		binary.BigEndian.PutUint64(buf[4:], seq)
+		n, err := c.Write(buf)
+		if err != nil {
+			return s, "", err
+		}
+		s.bytes += int64(n)
+		if gap > 0 {
+			next = next.Add(gap)
+			if w := time.Until(next); w > 0 {
+				time.Sleep(w)
+			}
+		}
+	}
+	s.elapsed = time.Since(start)
+
+	// The FIN may be lost too, so send a few until the report arrives.
+	binary.BigEndian.PutUint64(buf[4:], finSeq)
+	reply := make([]byte, 512)
+	for try := 0; try < 5; try++ {
+		if _, err := c.Write(buf[:udpHeader]); err != nil {
+			return s, "", err
+		}
+		c.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := c.Read(reply)
+		if err == nil {
+			return s, string(reply[:n]), nil
+		}
+	}
+	return s, "", errors.New("no report from server")
+}
+
+func runClient(host string) error {
+	addr := net.JoinHostPort(host, fmt.Sprint(*port))
+	size := *length
+	if size == 0 {
+		size = defaultTCPLen
+		if *udp {
+			size = defaultUDPLen
+		}
+	}
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		total stats
+		first error
+	)
+	for i := 0; i < *streams; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var (
+				s      stats
+				remote string
+				err    error
+			)
+			if *udp {
+				s, remote, err = udpSend(addr, *duration, size, *rate/float64(*streams))
+			} else {
+				s, err = tcpSend(addr, *duration, size)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil && first == nil {
+				first = err
+			}
+			fmt.Printf("[%d] sender:   %v\n", i, s)
+			if remote != "" {
+				fmt.Printf("[%d] receiver: %s\n", i, remote)
+			}
+			total.bytes += s.bytes
+			if s.elapsed > total.elapsed {
+				total.elapsed = s.elapsed
+			}
+		}(i)
+	}
+	wg.Wait()
+	if *streams > 1 {
+		fmt.Printf("[SUM] sender: %v\n", total)
+	}
+	return first
+}
+
+func runServer() error {
+	report := func(from net.Addr, s stats) {
+		fmt.Printf("%v: %v\n", from, s)
+	}
+	addr := fmt.Sprintf(":%d", *port)
+	if *udp {
+		c, err := net.ListenPacket("udp", addr)
+		if err != nil {
+			return err
+		}
+		log.Printf("Listening on UDP %v", c.LocalAddr())
+		return udpServe(c, report)
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Listening on TCP %v", l.Addr())
+	return tcpServe(l, report)
+}
+
+func main() {
+	flag.Parse()
+	var err error
+	switch {
+	case *server && *client != "":
+		log.Fatal("-s and -c are mutually exclusive")
+	case *server:
+		err = runServer()
+	case *client != "":
+		err = runClient(*client)
+	default:
+		log.Fatal("one of -s or -c is required")
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	got := make(chan stats, 1)
+	go tcpServe(l, func(_ net.Addr, s stats) { got <- s })
+
+	sent, err := tcpSend(l.Addr().String(), 50*time.Millisecond, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recv := <-got; recv.bytes != sent.bytes || sent.bytes == 0 {
+		t.Errorf("server got %d bytes, client sent %d", recv.bytes, sent.bytes)
+	}
+}
+
+func TestUDP(t *testing.T) {
+	c, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	got := make(chan stats, 1)
+	go udpServe(c, func(_ net.Addr, s stats) { got <- s })
+
+	// 1 Mbit/s of 1000 byte datagrams is one every 8ms.
+	sent, report, err := udpSend(c.LocalAddr().String(), 100*time.Millisecond, 1000, 1e6)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recv := <-got
+	if recv.received == 0 || recv.bytes > sent.bytes {
+		t.Errorf("server saw %+v, client sent %d bytes", recv, sent.bytes)
+	}
+	if !strings.Contains(report, "datagrams lost") {
+		t.Errorf("report %q does not mention loss", report)
+	}
+}
+
+func TestUDPStreamLoss(t *testing.T) {
+	u := &udpStream{received: 8, maxSeq: 9, reorder: 1}
+	if s := u.stats(); s.lost != 2 || s.reorder != 1 {
+		t.Errorf("stats() = %+v, want 2 lost, 1 reordered", s)
+	}
+}
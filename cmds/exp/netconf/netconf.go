@@ -0,0 +1,140 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// netconf configures network interfaces from netplan or systemd-networkd
+// config files.
+//
+// Synopsis:
+//     netconf [OPTIONS] PATH...
+//     netconf [OPTIONS] -cloudinit
+//
+// Description:
+//     Each PATH is a netplan YAML file (.yaml, .yml), a systemd-networkd
+//     .network file, or a directory of .network files. A link is configured
+//     by the first config that matches it, in the order given.
+//
+//     With -cloudinit, the network config comes from the instance
+//     metadata instead.
+//
+// Options:
+//     -cloudinit: use the network config from cloud-init metadata
+//     -n:         print which config each link matches, change nothing
+//     -timeout:   DHCP timeout
+//     -retry:     DHCP retries
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/u-root/u-root/pkg/cloudinit"
+	"github.com/u-root/u-root/pkg/dhclient"
+	"github.com/u-root/u-root/pkg/netconf"
+	"github.com/u-root/u-root/pkg/ulog"
+	"github.com/vishvananda/netlink"
+)
+
+var (
+	fromCloudInit = flag.Bool("cloudinit", false, "use the network config from cloud-init metadata")
+	dryRun        = flag.Bool("n", false, "print which config each link matches, change nothing")
+	timeout       = flag.Duration("timeout", 15*time.Second, "DHCP timeout")
+	retry         = flag.Int("retry", 5, "DHCP retries")
+)
+
+func load(path string) (*netconf.Config, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if fi.IsDir() {
+		return netconf.ParseNetworkdDir(path)
+	}
+	switch filepath.Ext(path) {
+	case ".yaml", ".yml":
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return netconf.ParseNetplan(b)
+	case ".network":
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		i, err := netconf.ParseNetworkd(filepath.Base(path), f)
+		if err != nil {
+			return nil, err
+		}
+		return &netconf.Config{Interfaces: []*netconf.Interface{i}}, nil
+	}
+	return nil, fmt.Errorf("%s: unknown config format", path)
+}
+
+func loadCloudInit() (*netconf.Config, error) {
+	md, err := cloudinit.Fetch(context.Background(), ulog.Log, cloudinit.DefaultSources()...)
+	if err != nil {
+		return nil, err
+	}
+	switch md.NetworkConfigFormat {
+	case cloudinit.NetplanV2:
+		return netconf.ParseNetplan(md.NetworkConfig)
+	case "":
+		return nil, fmt.Errorf("%s has no network config", md.Source)
+	}
+	return nil, fmt.Errorf("%s: network config format %s is not supported", md.Source, md.NetworkConfigFormat)
+}
+
+func main() {
+	flag.Parse()
+	if (flag.NArg() == 0) != *fromCloudInit {
+		fmt.Fprintln(os.Stderr, "Usage: netconf [OPTIONS] PATH... | netconf [OPTIONS] -cloudinit")
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	c := &netconf.Config{}
+	if *fromCloudInit {
+		var err error
+		if c, err = loadCloudInit(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	for _, p := range flag.Args() {
+		pc, err := load(p)
+		if err != nil {
+			log.Fatal(err)
+		}
+		c.Interfaces = append(c.Interfaces, pc.Interfaces...)
+	}
+
+	if *dryRun {
+		links, err := netlink.LinkList()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, l := range links {
+			i := c.Lookup(l.Attrs().Name, l.Attrs().HardwareAddr)
+			if i == nil {
+				fmt.Printf("%s: unmanaged\n", l.Attrs().Name)
+				continue
+			}
+			fmt.Printf("%s: %s: %+v\n", l.Attrs().Name, i.ID, *i)
+		}
+		return
+	}
+
+	if err := netconf.Apply(context.Background(), c, dhclient.Config{
+		Timeout: *timeout,
+		Retries: *retry,
+	}); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// netconsole sends kernel messages to a UDP receiver.
+//
+// Synopsis:
+//     netconsole [-name NAME] [-m MESSAGE] [TARGET]
+//
+// Description:
+//     netconsole configures the kernel's netconsole with TARGET, in the
+//     syntax of the netconsole= kernel parameter:
+//
+//         [+][src-port]@[src-ip]/[<dev>],[tgt-port]@<tgt-ip>/[tgt-macaddr]
+//
+//     Without TARGET, the netconsole= parameter of the running kernel is
+//     used. That is for kernels with netconsole as a module, which does not
+//     see the parameter when it is loaded later.
+//
+// Options:
+//     -name: name of the dynamic targets, if netconsole is already loaded
+//     -m:    also send MESSAGE to each target, to check the receiver
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/u-root/u-root/pkg/netconsole"
+)
+
+var (
+	name = flag.String("name", "uroot", "name of the dynamic targets")
+	msg  = flag.String("m", "", "send this message to each target")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: netconsole [-name NAME] [-m MESSAGE] [TARGET]\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+
+	var targets []*netconsole.Target
+	var err error
+	switch flag.NArg() {
+	case 0:
+		targets, err = netconsole.FromCmdline()
+		if err == nil && len(targets) == 0 {
+			log.Fatal("No TARGET and no netconsole= on the kernel command line")
+		}
+	case 1:
+		targets, err = netconsole.Parse(flag.Arg(0))
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := netconsole.Configure(*name, targets...); err != nil {
+		log.Fatal(err)
+	}
+	if *msg == "" {
+		return
+	}
+	for _, t := range targets {
+		c, err := netconsole.Dial(t.Remote())
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintln(c, *msg)
+		c.Close()
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// pcidriver binds PCI devices to drivers and unbinds them.
+//
+// Synopsis:
+//     pcidriver -s GLOB [show]
+//     pcidriver -s GLOB unbind|reset
+//     pcidriver -s GLOB bind DRIVER
+//     pcidriver new_id|remove_id DRIVER VENDOR DEVICE
+//
+// Description:
+//     show lists the devices matching GLOB, e.g. 0000:01:00.*, with the
+//     driver each is bound to.
+//
+//     unbind unbinds them from their drivers.
+//
+//     bind rebinds them to DRIVER, even one that does not know their IDs,
+//     such as vfio-pci for device passthrough, by overriding their driver.
+//
+//     reset lifts the override and rebinds them to the driver the kernel
+//     picks.
+//
+//     new_id makes DRIVER bind to devices with the VENDOR and DEVICE IDs,
+//     in hex, as well as those it knows, e.g. to try a driver on a newer
+//     revision of a device; remove_id undoes it.
+//
+// Options:
+//     -s: glob of the PCI addresses of the devices
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/pci"
+)
+
+var devs = flag.String("s", "", "glob of the PCI addresses of the devices")
+
+func usage() {
+	log.Fatal("usage: pcidriver -s GLOB [show|unbind|reset|bind DRIVER] or pcidriver new_id|remove_id DRIVER VENDOR DEVICE")
+}
+
+func devices() pci.Devices {
+	if *devs == "" {
+		log.Fatal("no devices: use -s")
+	}
+	r, err := pci.NewBusReader(strings.Split(*devs, ",")...)
+	if err != nil {
+		log.Fatal(err)
+	}
+	d, err := r.Read()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(d) == 0 {
+		log.Fatalf("no devices match %q", *devs)
+	}
+	return d
+}
+
+func main() {
+	flag.Parse()
+	args := flag.Args()
+	cmd := "show"
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
+	}
+
+	switch cmd {
+	case "new_id", "remove_id":
+		if len(args) != 3 {
+			usage()
+		}
+		f := pci.AddDynamicID
+		if cmd == "remove_id" {
+			f = pci.RemoveDynamicID
+		}
+		if err := f(args[0], args[1], args[2]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	case "bind":
+		if len(args) != 1 {
+			usage()
+		}
+	case "show", "unbind", "reset":
+		if len(args) != 0 {
+			usage()
+		}
+	default:
+		usage()
+	}
+
+	var failed bool
+	for _, p := range devices() {
+		var err error
+		switch cmd {
+		case "unbind":
+			err = p.Unbind()
+		case "reset":
+			err = p.ResetDriver()
+		case "bind":
+			err = p.BindTo(args[0])
+		}
+		if err != nil {
+			log.Printf("%s: %v", p.Addr, err)
+			failed = true
+		}
+		drv, err := p.Driver()
+		if err != nil {
+			drv = err.Error()
+		} else if drv == "" {
+			drv = "no driver"
+		}
+		fmt.Printf("%s %s:%s: %s\n", p.Addr, p.Vendor, p.Device, drv)
+	}
+	if failed {
+		log.Fatal("not all devices could be rebound")
+	}
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// pcrreplay replays the TPM event log, and compares the PCRs it predicts
+// with the TPM's.
+//
+// Synopsis:
+//     pcrreplay [-log FILE] [-alg sha1|sha256] [-firmware uefi|bios|txt] [-tpm 1.2|2.0] [-n] [-v]
+//
+// Description:
+//     pcrreplay extends the digests of the events in the log into PCRs as
+//     the TPM would have, and prints the value of each PCR the log
+//     extends. Unless -n, it reads the TPM's PCRs and tells whether they
+//     match. For a PCR that does not, it tells after how many of the
+//     PCR's events the TPM's value is what the log says, so events logged
+//     but never extended stand out, and which events have a digest that
+//     is not that of their data. With a sealed key that no longer
+//     unseals after a firmware update, this is where to look.
+//
+//     pcrreplay exits with status 1 if a PCR does not match.
+//
+// Options:
+//     -log:      event log, default the kernel's
+//     -alg:      PCR bank to replay and compare
+//     -firmware: firmware that wrote the log
+//     -tpm:      TPM version of the log, default the TPM's or, with -n, 2.0
+//     -n:        only predict the PCRs, without a TPM
+//     -v:        list the events of PCRs that do not match
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/u-root/u-root/pkg/tss"
+	"github.com/u-root/u-root/pkg/txtlog"
+)
+
+var (
+	logFile  = flag.String("log", txtlog.DefaultTCPABinaryLog, "event log")
+	algName  = flag.String("alg", "sha256", "PCR bank to replay: sha1 or sha256")
+	firmware = flag.String("firmware", "uefi", "firmware that wrote the log: uefi, bios or txt")
+	version  = flag.String("tpm", "", "TPM version of the log, 1.2 or 2.0")
+	noTPM    = flag.Bool("n", false, "only predict the PCRs, without a TPM")
+	verbose  = flag.Bool("v", false, "list the events of PCRs that do not match")
+)
+
+var algs = map[string]struct {
+	log txtlog.IAlgHash
+	tpm tss.HashAlg
+}{
+	"sha1":   {txtlog.TPMAlgSha, tss.HashSHA1},
+	"sha256": {txtlog.TPMAlgSha256, tss.HashSHA256},
+}
+
+var firmwares = map[string]txtlog.FirmwareType{
+	"uefi": txtlog.Uefi,
+	"bios": txtlog.Bios,
+	"txt":  txtlog.Txt,
+}
+
+var versions = map[string]tss.TPMVersion{
+	"1.2": tss.TPMVersion12,
+	"2.0": tss.TPMVersion20,
+}
+
+// report prints the replay of l and, unless live is nil, how live compares
+// with it. It returns whether all PCRs match.
+func report(w io.Writer, l *txtlog.PCRLog, r *txtlog.Replay, live map[int][]byte) bool {
+	var pcrs []int
+	for pcr := range r.PCRs {
+		pcrs = append(pcrs, pcr)
+	}
+	sort.Ints(pcrs)
+	ok := true
+	for _, pcr := range pcrs {
+		if live == nil {
+			fmt.Fprintf(w, "PCR %2d: %x\n", pcr, r.PCRs[pcr])
+			continue
+		}
+		d := r.Check(pcr, live[pcr])
+		if d.Match {
+			fmt.Fprintf(w, "PCR %2d: %x match\n", pcr, r.PCRs[pcr])
+			continue
+		}
+		ok = false
+		steps := r.Steps[pcr]
+		fmt.Fprintf(w, "PCR %2d: %x MISMATCH, the TPM has %x\n", pcr, r.PCRs[pcr], live[pcr])
+		if d.Matched >= 0 {
+			fmt.Fprintf(w, "        the TPM has the value after %d of %d events; these were logged but not extended:", d.Matched, len(steps))
+			for _, s := range steps[d.Matched:] {
+				fmt.Fprintf(w, " %d", s.Event)
+			}
+			fmt.Fprintln(w)
+		} else {
+			fmt.Fprintf(w, "        the TPM has none of the values of the %d events: an event was extended with another digest than logged, or not logged\n", len(steps))
+		}
+		for _, s := range d.BadDigests {
+			fmt.Fprintf(w, "        event %d (%s) has a digest that is not of its data\n", s.Event, l.PcrList[s.Event].PcrEventName())
+		}
+		if *verbose {
+			for _, s := range steps {
+				e := l.PcrList[s.Event]
+				fmt.Fprintf(w, "        %4d %-32s -> %x\n", s.Event, e.PcrEventName(), s.Value)
+			}
+		}
+	}
+	return ok
+}
+
+func main() {
+	flag.Parse()
+	alg, ok := algs[*algName]
+	if !ok {
+		log.Fatalf("unknown -alg %q", *algName)
+	}
+	fw, ok := firmwares[*firmware]
+	if !ok {
+		log.Fatalf("unknown -firmware %q", *firmware)
+	}
+	v := tss.TPMVersion20
+	if *version != "" {
+		if v, ok = versions[*version]; !ok {
+			log.Fatalf("unknown -tpm %q", *version)
+		}
+	}
+
+	var live map[int][]byte
+	if !*noTPM {
+		t, err := tss.NewTPM()
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer t.Close()
+		if *version == "" {
+			v = t.Version
+		}
+		pcrs, err := t.ReadPCRs(alg.tpm)
+		if err != nil {
+			log.Fatal(err)
+		}
+		live = make(map[int][]byte)
+		for _, p := range pcrs {
+			live[p.Index] = p.Digest
+		}
+	}
+
+	txtlog.DefaultTCPABinaryLog = *logFile
+	l, err := txtlog.ParseLog(fw, v)
+	if err != nil {
+		log.Fatalf("parsing %s: %v", *logFile, err)
+	}
+	r, err := txtlog.ReplayLog(l, alg.log)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if !report(os.Stdout, l, r, live) {
+		os.Exit(1)
+	}
+}
@@ -5,7 +5,15 @@
 // pxeserver is a test & lab PXE server that supports TFTP, HTTP, and DHCPv4.
 //
 // pxeserver can either respond to *all* DHCP requests, or a DHCP request from
-// a specific MAC. In either case, it will supply the same IP in all answers.
+// a specific MAC. It supplies the same IP in all answers, or one per client
+// from -pool.
+//
+// Boot files can be chosen by client: UEFI PXE clients get -efi-bootfilename,
+// UEFI HTTP boot clients -http-boot-url, and clients already running iPXE
+// -ipxe-bootfilename, which breaks the iPXE chainloading loop.
+//
+// With -proxy, pxeserver is a proxyDHCP server: it leaves addresses to the
+// network's DHCP server and only tells PXE clients what to boot.
 package main
 
 import (
@@ -17,6 +25,7 @@ import (
 	"net"
 	"net/http"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 
@@ -24,6 +33,7 @@ import (
 	"github.com/insomniacslk/dhcp/dhcpv4/server4"
 	"github.com/insomniacslk/dhcp/dhcpv6"
 	"github.com/insomniacslk/dhcp/dhcpv6/server6"
+	"github.com/insomniacslk/dhcp/iana"
 	"pack.ag/tftp"
 )
 
@@ -34,8 +44,15 @@ var (
 	ipv4         = flag.Bool("4", true, "IPv4 DHCP server")
 	selfIP       = flag.String("ip", "192.168.0.1", "DHCPv4 IP of self")
 	yourIP       = flag.String("your-ip", "192.168.0.2/24", "The one and only CIDR to give to all DHCPv4 clients")
+	pool4        = flag.String("pool", "", "Range of IPs in -your-ip's subnet to give one per client, e.g. 192.168.0.10-192.168.0.100")
+	routers      = flag.String("router", "", "Comma-separated routers to serve via DHCPv4 (default -ip)")
+	dns          = flag.String("dns", "", "Comma-separated DNS servers to serve via DHCPv4")
 	rootpath     = flag.String("rootpath", "", "RootPath option to serve via DHCPv4")
 	bootfilename = flag.String("bootfilename", "pxelinux.0", "Boot file to serve via DHCPv4")
+	efiBootfile  = flag.String("efi-bootfilename", "", "Boot file to serve to UEFI PXE clients")
+	ipxeBootfile = flag.String("ipxe-bootfilename", "", "Boot file or URL to serve to clients running iPXE")
+	httpBootURL  = flag.String("http-boot-url", "", "Boot URL to serve to UEFI HTTP boot clients")
+	proxy        = flag.Bool("proxy", false, "Be a proxyDHCP server: only serve boot options to PXE clients")
 	inf          = flag.String("interface", "eth0", "Interface to serve DHCPv4 on")
 
 	// DHCPv6-specific
@@ -53,55 +70,152 @@ var (
 type dserver4 struct {
 	mac          net.HardwareAddr
 	yourIP       net.IP
+	pool         *pool
 	submask      net.IPMask
 	self         net.IP
+	routers      []net.IP
+	dns          []net.IP
 	bootfilename string
 	rootpath     string
+
+	// efiBootfilename is for UEFI PXE clients, ipxeBootfilename for
+	// clients already running iPXE, and httpBootURL for UEFI HTTP boot
+	// clients.
+	efiBootfilename  string
+	ipxeBootfilename string
+	httpBootURL      string
+
+	// proxy only answers PXE clients, with boot options and no address,
+	// next to another DHCP server.
+	proxy bool
 }
 
-func (s *dserver4) dhcpHandler(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) {
-	log.Printf("Handling request %v for peer %v", m, peer)
+// Client architectures from RFC 4578 and the UEFI spec.
+const (
+	archEFIx64HTTP iana.Arch = 16
+)
+
+// isPXE returns whether m comes from a PXE or UEFI HTTP boot client.
+func isPXE(m *dhcpv4.DHCPv4) bool {
+	c := m.ClassIdentifier()
+	return strings.HasPrefix(c, "PXEClient") || strings.HasPrefix(c, "HTTPClient")
+}
+
+// bootfile returns the boot file for the client that sent m, and whether
+// it is an HTTP boot client.
+func (s *dserver4) bootfile(m *dhcpv4.DHCPv4) (string, bool) {
+	for _, uc := range m.UserClass() {
+		if uc == "iPXE" && len(s.ipxeBootfilename) > 0 {
+			return s.ipxeBootfilename, false
+		}
+	}
+	for _, a := range m.ClientArch() {
+		switch a {
+		case archEFIx64HTTP:
+			if len(s.httpBootURL) > 0 {
+				return s.httpBootURL, true
+			}
+		case iana.EFI_BC, iana.EFI_X86_64, iana.EFI_IA32:
+			if len(s.efiBootfilename) > 0 {
+				return s.efiBootfilename, false
+			}
+		}
+	}
+	return s.bootfilename, false
+}
 
+// reply returns the reply to m, or nil if m is not for us.
+func (s *dserver4) reply(m *dhcpv4.DHCPv4) (*dhcpv4.DHCPv4, error) {
 	var replyType dhcpv4.MessageType
 	switch mt := m.MessageType(); mt {
 	case dhcpv4.MessageTypeDiscover:
 		replyType = dhcpv4.MessageTypeOffer
 	case dhcpv4.MessageTypeRequest:
 		replyType = dhcpv4.MessageTypeAck
+		// The client picked another server's offer.
+		if sid := m.ServerIdentifier(); sid != nil && !sid.Equal(s.self) {
+			return nil, nil
+		}
 	default:
-		log.Printf("Can't handle type %v", mt)
-		return
+		return nil, fmt.Errorf("can't handle type %v", mt)
 	}
 	if s.mac != nil && !bytes.Equal(m.ClientHWAddr, s.mac) {
-		log.Printf("Not responding to DHCP request for mac %s, which does not match %s", m.ClientHWAddr, s.mac)
-		return
+		return nil, fmt.Errorf("not responding to DHCP request for mac %s, which does not match %s", m.ClientHWAddr, s.mac)
+	}
+	if s.proxy && !isPXE(m) {
+		return nil, nil
 	}
 
-	reply, err := dhcpv4.NewReplyFromRequest(m,
+	mods := []dhcpv4.Modifier{
 		dhcpv4.WithMessageType(replyType),
 		dhcpv4.WithServerIP(s.self),
-		dhcpv4.WithRouter(s.self),
-		dhcpv4.WithNetmask(s.submask),
-		dhcpv4.WithYourIP(s.yourIP),
 		// RFC 2131, Section 4.3.1. Server Identifier: MUST
 		dhcpv4.WithOption(dhcpv4.OptServerIdentifier(s.self)),
-		// RFC 2131, Section 4.3.1. IP lease time: MUST
-		dhcpv4.WithOption(dhcpv4.OptIPAddressLeaseTime(dhcpv4.MaxLeaseTime)),
-	)
+	}
+	if !s.proxy {
+		yourIP := s.yourIP
+		if s.pool != nil {
+			var err error
+			if yourIP, err = s.pool.lease(m.ClientHWAddr); err != nil {
+				return nil, err
+			}
+		}
+		mods = append(mods,
+			dhcpv4.WithRouter(s.routers...),
+			dhcpv4.WithNetmask(s.submask),
+			dhcpv4.WithYourIP(yourIP),
+			// RFC 2131, Section 4.3.1. IP lease time: MUST
+			dhcpv4.WithOption(dhcpv4.OptIPAddressLeaseTime(dhcpv4.MaxLeaseTime)),
+		)
+		if len(s.dns) > 0 {
+			mods = append(mods, dhcpv4.WithDNS(s.dns...))
+		}
+	}
+	reply, err := dhcpv4.NewReplyFromRequest(m, mods...)
+	if err != nil {
+		return nil, err
+	}
 	// RFC 6842, MUST include Client Identifier if client specified one.
 	if val := m.Options.Get(dhcpv4.OptionClientIdentifier); len(val) > 0 {
 		reply.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionClientIdentifier, val))
 	}
-	if len(s.bootfilename) > 0 {
-		reply.BootFileName = s.bootfilename
+
+	file, http := s.bootfile(m)
+	if len(file) > 0 {
+		reply.BootFileName = file
+		reply.UpdateOption(dhcpv4.OptBootFileName(file))
+	}
+	if isPXE(m) {
+		// PXE and HTTP boot clients want their class echoed back.
+		class := "PXEClient"
+		if http {
+			class = "HTTPClient"
+		}
+		reply.UpdateOption(dhcpv4.OptClassIdentifier(class))
+		reply.UpdateOption(dhcpv4.OptTFTPServerName(s.self.String()))
+		if s.proxy {
+			// PXE discovery control: boot the boot file, skip
+			// boot server discovery.
+			reply.UpdateOption(dhcpv4.OptGeneric(dhcpv4.OptionVendorSpecificInformation, []byte{6, 1, 8, 255}))
+		}
 	}
 	if len(s.rootpath) > 0 {
 		reply.UpdateOption(dhcpv4.OptRootPath(s.rootpath))
 	}
+	return reply, nil
+}
+
+func (s *dserver4) dhcpHandler(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHCPv4) {
+	log.Printf("Handling request %v for peer %v", m, peer)
+
+	reply, err := s.reply(m)
 	if err != nil {
 		log.Printf("Could not create reply for %v: %v", m, err)
 		return
 	}
+	if reply == nil {
+		return
+	}
 
 	// Experimentally determined. You can't just blindly send a broadcast packet
 	// with the broadcast address. You can, however, send a broadcast packet
@@ -112,7 +226,7 @@ func (s *dserver4) dhcpHandler(conn net.PacketConn, peer net.Addr, m *dhcpv4.DHC
 	// because this is not that expensive and it's just a tiny bit easier to
 	// follow IMHO.
 	if runtime.GOOS == "darwin" {
-		p := &net.UDPAddr{IP: s.yourIP.Mask(s.submask), Port: 68}
+		p := &net.UDPAddr{IP: reply.YourIPAddr.Mask(s.submask), Port: 68}
 		log.Printf("Changing %v to %v", peer, p)
 		peer = p
 	}
@@ -184,6 +298,21 @@ func (s *dserver6) dhcpHandler(conn net.PacketConn, peer net.Addr, m dhcpv6.DHCP
 	log.Printf("DHCPv6 request successfully handled, reply: %v", reply.Summary())
 }
 
+func parseIPs(s string) ([]net.IP, error) {
+	var ips []net.IP
+	for _, a := range strings.Split(s, ",") {
+		if len(a) == 0 {
+			continue
+		}
+		ip := net.ParseIP(a)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid IP %q", a)
+		}
+		ips = append(ips, ip)
+	}
+	return ips, nil
+}
+
 func main() {
 	flag.Parse()
 
@@ -229,22 +358,55 @@ func main() {
 		go func() {
 			defer wg.Done()
 			s := &dserver4{
-				mac:          maca,
-				self:         net.ParseIP(*selfIP),
-				yourIP:       yourIP,
-				submask:      yourNet.Mask,
-				bootfilename: *bootfilename,
-				rootpath:     *rootpath,
+				mac:              maca,
+				self:             net.ParseIP(*selfIP),
+				yourIP:           yourIP,
+				submask:          yourNet.Mask,
+				bootfilename:     *bootfilename,
+				rootpath:         *rootpath,
+				efiBootfilename:  *efiBootfile,
+				ipxeBootfilename: *ipxeBootfile,
+				httpBootURL:      *httpBootURL,
+				proxy:            *proxy,
 			}
-
-			laddr := &net.UDPAddr{Port: dhcpv4.ServerPort}
-			server, err := server4.NewServer(*inf, laddr, s.dhcpHandler)
-			if err != nil {
+			var err error
+			if len(*pool4) > 0 {
+				if s.pool, err = parsePool(*pool4); err != nil {
+					log.Fatal(err)
+				}
+			}
+			if s.routers, err = parseIPs(*routers); err != nil {
 				log.Fatal(err)
 			}
-			if err := server.Serve(); err != nil {
+			if len(s.routers) == 0 {
+				s.routers = []net.IP{s.self}
+			}
+			if s.dns, err = parseIPs(*dns); err != nil {
 				log.Fatal(err)
 			}
+
+			// A proxyDHCP server also answers PXE clients' boot
+			// server requests on port 4011.
+			ports := []int{dhcpv4.ServerPort}
+			if s.proxy {
+				ports = append(ports, 4011)
+			}
+			var swg sync.WaitGroup
+			for _, port := range ports {
+				laddr := &net.UDPAddr{Port: port}
+				server, err := server4.NewServer(*inf, laddr, s.dhcpHandler)
+				if err != nil {
+					log.Fatal(err)
+				}
+				swg.Add(1)
+				go func() {
+					defer swg.Done()
+					if err := server.Serve(); err != nil {
+						log.Fatal(err)
+					}
+				}()
+			}
+			swg.Wait()
 		}()
 	}
 
@@ -0,0 +1,121 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"net"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/insomniacslk/dhcp/iana"
+)
+
+func discover(t *testing.T, mac string, mods ...dhcpv4.Modifier) *dhcpv4.DHCPv4 {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := dhcpv4.NewDiscovery(hw, mods...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func pxe(arch iana.Arch) dhcpv4.Modifier {
+	return func(d *dhcpv4.DHCPv4) {
+		d.UpdateOption(dhcpv4.OptClassIdentifier("PXEClient:Arch:00000:UNDI:002001"))
+		d.UpdateOption(dhcpv4.OptClientArch(arch))
+	}
+}
+
+func TestReply(t *testing.T) {
+	p, err := parsePool("192.168.0.10-192.168.0.11")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &dserver4{
+		self:             net.ParseIP("192.168.0.1"),
+		routers:          []net.IP{net.ParseIP("192.168.0.1")},
+		submask:          net.CIDRMask(24, 32),
+		pool:             p,
+		bootfilename:     "pxelinux.0",
+		efiBootfilename:  "bootx64.efi",
+		ipxeBootfilename: "http://192.168.0.1/boot.ipxe",
+		httpBootURL:      "http://192.168.0.1/bootx64.efi",
+	}
+
+	for _, tt := range []struct {
+		name   string
+		m      *dhcpv4.DHCPv4
+		ip     string
+		file   string
+		class  string
+		noResp bool
+	}{
+		{name: "plain", m: discover(t, "52:54:00:00:00:01"), ip: "192.168.0.10", file: "pxelinux.0"},
+		{name: "same client, same IP", m: discover(t, "52:54:00:00:00:01"), ip: "192.168.0.10", file: "pxelinux.0"},
+		{name: "BIOS PXE", m: discover(t, "52:54:00:00:00:02", pxe(iana.INTEL_X86PC)), ip: "192.168.0.11", file: "pxelinux.0", class: "PXEClient"},
+		{name: "UEFI PXE", m: discover(t, "52:54:00:00:00:02", pxe(iana.EFI_X86_64)), ip: "192.168.0.11", file: "bootx64.efi", class: "PXEClient"},
+		{name: "UEFI HTTP", m: discover(t, "52:54:00:00:00:02", pxe(archEFIx64HTTP)), ip: "192.168.0.11", file: "http://192.168.0.1/bootx64.efi", class: "HTTPClient"},
+		{name: "iPXE", m: discover(t, "52:54:00:00:00:02", pxe(iana.INTEL_X86PC), dhcpv4.WithUserClass("iPXE", false)), ip: "192.168.0.11", file: "http://192.168.0.1/boot.ipxe", class: "PXEClient"},
+		{name: "pool exhausted", m: discover(t, "52:54:00:00:00:03"), noResp: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := s.reply(tt.m)
+			if tt.noResp {
+				if err == nil && r != nil {
+					t.Fatalf("reply() = %v, want none", r.Summary())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := r.YourIPAddr.String(); got != tt.ip {
+				t.Errorf("your IP = %s, want %s", got, tt.ip)
+			}
+			if r.BootFileName != tt.file {
+				t.Errorf("boot file = %q, want %q", r.BootFileName, tt.file)
+			}
+			if got := r.ClassIdentifier(); got != tt.class {
+				t.Errorf("class = %q, want %q", got, tt.class)
+			}
+		})
+	}
+}
+
+func TestProxyReply(t *testing.T) {
+	s := &dserver4{
+		self:         net.ParseIP("192.168.0.1"),
+		bootfilename: "pxelinux.0",
+		proxy:        true,
+	}
+	r, err := s.reply(discover(t, "52:54:00:00:00:01"))
+	if err != nil || r != nil {
+		t.Errorf("reply(non-PXE) = %v, %v, want no reply", r, err)
+	}
+
+	r, err = s.reply(discover(t, "52:54:00:00:00:01", pxe(iana.INTEL_X86PC)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !r.YourIPAddr.IsUnspecified() || r.Options.Has(dhcpv4.OptionIPAddressLeaseTime) {
+		t.Errorf("proxy reply assigns an address: %v", r.Summary())
+	}
+	if r.BootFileName != "pxelinux.0" || !r.ServerIPAddr.Equal(s.self) || len(r.GetOneOption(dhcpv4.OptionVendorSpecificInformation)) == 0 {
+		t.Errorf("proxy reply lacks boot options: %v", r.Summary())
+	}
+
+	// Requests to other servers are not ours.
+	req, err := dhcpv4.NewRequestFromOffer(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.UpdateOption(dhcpv4.OptServerIdentifier(net.ParseIP("192.168.0.254")))
+	if r, err := s.reply(req); err != nil || r != nil {
+		t.Errorf("reply(request to other server) = %v, %v, want no reply", r, err)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+)
+
+// pool hands out IPv4 addresses from a range, one per MAC address. Leases
+// do not expire; a lab has few enough machines.
+type pool struct {
+	start, end uint32
+
+	mu     sync.Mutex
+	leases map[string]uint32
+	used   map[uint32]bool
+}
+
+func ip4ToInt(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+func intToIP4(i uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, i)
+	return ip
+}
+
+// parsePool parses a range like "192.168.0.10-192.168.0.100".
+func parsePool(s string) (*pool, error) {
+	r := strings.SplitN(s, "-", 2)
+	if len(r) != 2 {
+		return nil, fmt.Errorf("pool %q: want FIRST-LAST", s)
+	}
+	start, end := net.ParseIP(r[0]).To4(), net.ParseIP(r[1]).To4()
+	if start == nil || end == nil || ip4ToInt(start) > ip4ToInt(end) {
+		return nil, fmt.Errorf("pool %q: want FIRST-LAST IPv4 addresses", s)
+	}
+	return &pool{
+		start:  ip4ToInt(start),
+		end:    ip4ToInt(end),
+		leases: make(map[string]uint32),
+		used:   make(map[uint32]bool),
+	}, nil
+}
+
+// lease returns the address of mac, allocating one if it has none.
+func (p *pool) lease(mac net.HardwareAddr) (net.IP, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ip, ok := p.leases[mac.String()]; ok {
+		return intToIP4(ip), nil
+	}
+	for ip := p.start; ip <= p.end && ip >= p.start; ip++ {
+		if !p.used[ip] {
+			p.used[ip] = true
+			p.leases[mac.String()] = ip
+			return intToIP4(ip), nil
+		}
+	}
+	return nil, fmt.Errorf("pool exhausted")
+}
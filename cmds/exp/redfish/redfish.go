@@ -0,0 +1,200 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// redfish manages a BMC through its Redfish service.
+//
+// Synopsis:
+//     redfish -H https://bmc [-U user] [-P password] [-k] COMMAND [ARGS...]
+//     redfish -hostif [-U user] [-P password] [-k] COMMAND [ARGS...]
+//
+// Description:
+//     Commands:
+//       systems                       list computer systems
+//       managers                      list managers
+//       reset SYSTEM TYPE             reset a system (On, ForceOff, ForceRestart, ...)
+//       boot SYSTEM TARGET [ENABLED]  override the boot source (Pxe, Hdd, BiosSetup, ...)
+//                                     ENABLED is Once (default), Continuous or Disabled
+//       update IMAGE-URI [PROTOCOL]   start a SimpleUpdate firmware update
+//       get PATH                      print any resource as JSON
+//
+//     The password may also be given in the REDFISH_PASSWORD environment
+//     variable to keep it off the command line.
+//
+//     With -hostif, the Redfish Host Interface of SMBIOS is brought up: the
+//     network device the BMC exposes to the host, usually over USB. Its
+//     service is used unless -H is given.
+//
+// Options:
+//     -H: Redfish endpoint, e.g. https://10.0.0.2
+//     -U: user name
+//     -P: password
+//     -k: do not verify the service's TLS certificate
+//     -hostif: configure the Redfish Host Interface and use its service
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/u-root/u-root/pkg/dhclient"
+	"github.com/u-root/u-root/pkg/redfish"
+	"github.com/u-root/u-root/pkg/smbios"
+)
+
+var (
+	host     = flag.String("H", "", "Redfish endpoint, e.g. https://10.0.0.2")
+	user     = flag.String("U", "", "user name")
+	password = flag.String("P", os.Getenv("REDFISH_PASSWORD"), "password")
+	insecure = flag.Bool("k", false, "do not verify the service's TLS certificate")
+	hostif   = flag.Bool("hostif", false, "configure the Redfish Host Interface and use its service")
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: redfish -H endpoint|-hostif [-U user] [-P password] [-k] systems|managers|reset|boot|update|get [ARGS...]")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func run(c *redfish.Client, args []string) error {
+	need := func(n int) {
+		if len(args) < n {
+			usage()
+		}
+	}
+	need(1)
+	switch args[0] {
+	case "systems":
+		systems, err := c.Systems()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tMANUFACTURER\tMODEL\tSERIAL\tPOWER\tBIOS\tHEALTH")
+		for _, s := range systems {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", s.ID, s.Manufacturer, s.Model, s.SerialNumber, s.PowerState, s.BiosVersion, s.Status.Health)
+		}
+		return w.Flush()
+
+	case "managers":
+		managers, err := c.Managers()
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tTYPE\tMODEL\tFIRMWARE\tHEALTH")
+		for _, m := range managers {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.ID, m.ManagerType, m.Model, m.FirmwareVersion, m.Status.Health)
+		}
+		return w.Flush()
+
+	case "reset":
+		need(3)
+		s, err := c.System(args[1])
+		if err != nil {
+			return err
+		}
+		return c.Reset(s, args[2])
+
+	case "boot":
+		need(3)
+		enabled := "Once"
+		if len(args) > 3 {
+			enabled = args[3]
+		}
+		s, err := c.System(args[1])
+		if err != nil {
+			return err
+		}
+		return c.SetBootOverride(s, args[2], enabled)
+
+	case "update":
+		need(2)
+		var protocol string
+		if len(args) > 2 {
+			protocol = args[2]
+		}
+		t, err := c.SimpleUpdate(args[1], protocol)
+		if err != nil {
+			return err
+		}
+		if t.ID != "" {
+			fmt.Printf("Started task %s: %s\n", t.ID, t.TaskState)
+		}
+		return nil
+
+	case "get":
+		need(2)
+		var v interface{}
+		if _, err := c.Get(args[1], &v); err != nil {
+			return err
+		}
+		b, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+	usage()
+	return nil
+}
+
+// hostInterface configures the first Redfish Host Interface and returns the
+// endpoint of its service.
+func hostInterface() (string, error) {
+	info, err := smbios.FromSysfs()
+	if err != nil {
+		return "", err
+	}
+	his, err := redfish.HostInterfaces(info)
+	if err != nil {
+		return "", err
+	}
+	if len(his) == 0 {
+		return "", fmt.Errorf("SMBIOS has no Redfish Host Interface")
+	}
+	h := his[0]
+	name, err := h.Configure(context.Background(), dhclient.Config{Timeout: 15 * time.Second, Retries: 3})
+	if err != nil {
+		return "", fmt.Errorf("configuring the Redfish Host Interface: %v", err)
+	}
+	log.Printf("Redfish Host Interface %s is up, service at %s", name, h.Endpoint())
+	return h.Endpoint(), nil
+}
+
+func main() {
+	flag.Usage = usage
+	flag.Parse()
+	if *hostif {
+		endpoint, err := hostInterface()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *host == "" {
+			*host = endpoint
+		}
+	}
+	if *host == "" {
+		usage()
+	}
+
+	c := redfish.NewClient(*host, *user, *password, *insecure)
+	if *user != "" {
+		if err := c.Login(); err != nil {
+			log.Printf("Could not open a session, falling back to basic auth: %v", err)
+		} else {
+			defer c.Logout()
+		}
+	}
+	if err := run(c, flag.Args()); err != nil {
+		c.Logout()
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,403 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// selexport forwards new IPMI System Event Log entries as JSON.
+//
+// Synopsis:
+//     selexport [-d DEV] [-i INTERVAL] [-sink SINK] [-state FILE] [-once]
+//
+// Description:
+//     selexport polls the BMC's SEL and exports every entry it has not
+//     exported before as one JSON object. Entries are only marked as
+//     exported once the sink accepted them, so a sink outage delays
+//     events rather than dropping them. If the SEL is cleared, export
+//     starts again from the first entry.
+//
+//     Entries carry a description of the event and the sensor type name,
+//     with the OEM codes of the BMC's manufacturer decoded if pkg/ipmi has
+//     a table for it.
+//
+//     SINK is one of:
+//       -                  JSON lines on stdout (default)
+//       log                the u-root log
+//       kmsg               the kernel log
+//       udp://HOST:PORT    one datagram per entry
+//       http(s)://URL      POST a JSON array per batch
+//
+// Options:
+//     -d:     IPMI device number
+//     -i:     poll interval
+//     -sink:  where to send entries
+//     -state: file that remembers the last exported entry across restarts
+//     -once:  export new entries once and exit
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/u-root/u-root/pkg/ipmi"
+	"github.com/u-root/u-root/pkg/ulog"
+)
+
+var (
+	dev      = flag.Int("d", 0, "IPMI device number")
+	interval = flag.Duration("i", 30*time.Second, "poll interval")
+	sinkFlag = flag.String("sink", "-", "where to send entries: -, log, kmsg, udp://host:port or http(s)://url")
+	state    = flag.String("state", "", "file that remembers the last exported entry across restarts")
+	once     = flag.Bool("once", false, "export new entries once and exit")
+)
+
+// record is the exported form of a SEL entry.
+type record struct {
+	Host       string `json:"host,omitempty"`
+	RecordID   uint16 `json:"record_id"`
+	RecordType uint8  `json:"record_type"`
+	Kind       string `json:"kind"`
+	Timestamp  uint32 `json:"timestamp,omitempty"`
+	Time       string `json:"time,omitempty"`
+
+	// Set for system event records.
+	GeneratorID  uint16 `json:"generator_id,omitempty"`
+	EvMRev       uint8  `json:"evm_rev,omitempty"`
+	SensorType   uint8  `json:"sensor_type,omitempty"`
+	SensorNumber uint8  `json:"sensor_number,omitempty"`
+	EventType    uint8  `json:"event_type,omitempty"`
+	Deassertion  bool   `json:"deassertion,omitempty"`
+	EventData    string `json:"event_data,omitempty"`
+
+	// SensorTypeName and Description say what the entry means; they are
+	// not part of the entry's identity.
+	SensorTypeName string `json:"sensor_type_name,omitempty"`
+	Description    string `json:"description,omitempty"`
+
+	// Set for OEM records.
+	ManufacturerID uint32 `json:"manufacturer_id,omitempty"`
+	OEMData        string `json:"oem_data,omitempty"`
+}
+
+func newRecord(host string, d ipmi.SELDecoder, e *ipmi.Event) *record {
+	r := &record{
+		Host:       host,
+		RecordID:   e.RecordID,
+		RecordType: e.RecordType,
+	}
+	switch {
+	case e.RecordType >= 0xE0:
+		r.Kind = "oem"
+		r.OEMData = hex.EncodeToString(e.OEMNontsDefinedData[:])
+		r.Description = d.RecordDescription(e)
+		return r
+	case e.RecordType >= 0xC0:
+		r.Kind = "oem_timestamped"
+		r.Timestamp = e.OEMTsEvent.Timestamp
+		m := e.ManfID
+		r.ManufacturerID = uint32(m[0]) | uint32(m[1])<<8 | uint32(m[2])<<16
+		r.OEMData = hex.EncodeToString(e.OEMTsDefinedData[:])
+		r.Description = d.RecordDescription(e)
+	default:
+		r.Kind = "system"
+		r.Timestamp = e.StandardEvent.Timestamp
+		r.GeneratorID = e.GenID
+		r.EvMRev = e.EvMRev
+		r.SensorType = e.SensorType
+		r.SensorNumber = e.SensorNum
+		r.EventType = e.EventTypeDir & 0x7f
+		r.Deassertion = e.EventTypeDir&0x80 != 0
+		r.EventData = hex.EncodeToString(e.EventData[:])
+		r.SensorTypeName = d.SensorTypeName(ipmi.SensorType(e.SensorType))
+		r.Description = d.Description(&e.StandardEvent)
+	}
+	if r.Timestamp > ipmi.SELPreInitTime {
+		r.Time = time.Unix(int64(r.Timestamp), 0).UTC().Format(time.RFC3339)
+	}
+	return r
+}
+
+// sameEntry reports whether r and o are of the same SEL entry, however they
+// were described.
+func (r record) sameEntry(o record) bool {
+	r.SensorTypeName, r.Description = "", ""
+	o.SensorTypeName, o.Description = "", ""
+	return r == o
+}
+
+// sel is the part of *ipmi.IPMI the exporter needs.
+type sel interface {
+	GetSELInfo() (*ipmi.SELInfo, error)
+	GetSELEntry(id uint16) (*ipmi.Event, uint16, error)
+}
+
+// exporter remembers how far the SEL has been exported.
+type exporter struct {
+	sel  sel
+	host string
+	dec  ipmi.SELDecoder
+
+	// last is the last exported entry, nil if none has been.
+	last    *record
+	lastAdd uint32
+	lastDel uint32
+}
+
+// poll returns the entries added since the last commit. It does not change
+// the exporter's state; commit does that once the entries are out.
+func (x *exporter) poll() ([]*record, error) {
+	info, err := x.sel.GetSELInfo()
+	if err != nil {
+		return nil, err
+	}
+	if info.Entries == 0 || x.last != nil && info.LastAddTime == x.lastAdd && info.LastDelTime == x.lastDel {
+		return nil, nil
+	}
+
+	id := uint16(ipmi.SELFirstEntry)
+	if x.last != nil {
+		// Resume after the last exported entry, provided it is still the
+		// same entry. If it was deleted or the SEL cleared and refilled,
+		// export everything again.
+		e, next, err := x.sel.GetSELEntry(x.last.RecordID)
+		if err == nil && newRecord(x.host, x.dec, e).sameEntry(*x.last) {
+			id = next
+		} else {
+			log.Printf("Last exported SEL entry %#04x is gone, exporting from the start", x.last.RecordID)
+		}
+	}
+
+	var recs []*record
+	for n := 0; id != ipmi.SELLastEntry; n++ {
+		if n > int(info.Entries) {
+			return recs, fmt.Errorf("SEL has more entries than the %d announced", info.Entries)
+		}
+		e, next, err := x.sel.GetSELEntry(id)
+		if err != nil {
+			return recs, err
+		}
+		recs = append(recs, newRecord(x.host, x.dec, e))
+		id = next
+	}
+	return recs, nil
+}
+
+// commit marks recs, as returned by poll, as exported.
+func (x *exporter) commit(recs []*record) error {
+	info, err := x.sel.GetSELInfo()
+	if err != nil {
+		return err
+	}
+	if len(recs) > 0 {
+		x.last = recs[len(recs)-1]
+	}
+	x.lastAdd, x.lastDel = info.LastAddTime, info.LastDelTime
+	return nil
+}
+
+func (x *exporter) load(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var r record
+	if err := json.Unmarshal(b, &r); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	x.last = &r
+	return nil
+}
+
+func (x *exporter) save(path string) error {
+	if x.last == nil {
+		return nil
+	}
+	b, err := json.Marshal(x.last)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// sink receives exported entries.
+type sink interface {
+	export(recs []*record) error
+}
+
+type writerSink struct {
+	w io.Writer
+}
+
+func (s writerSink) export(recs []*record) error {
+	enc := json.NewEncoder(s.w)
+	for _, r := range recs {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type logSink struct {
+	l ulog.Logger
+}
+
+func (s logSink) export(recs []*record) error {
+	for _, r := range recs {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		s.l.Printf("SEL: %s", b)
+	}
+	return nil
+}
+
+type udpSink struct {
+	addr string
+}
+
+func (s udpSink) export(recs []*record) error {
+	c, err := net.Dial("udp", s.addr)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	for _, r := range recs {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if _, err := c.Write(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type httpSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s httpSink) export(recs []*record) error {
+	b, err := json.Marshal(recs)
+	if err != nil {
+		return err
+	}
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("POST %s: %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+func newSink(s string) (sink, error) {
+	switch s {
+	case "-":
+		return writerSink{os.Stdout}, nil
+	case "log":
+		return logSink{ulog.Log}, nil
+	case "kmsg":
+		return logSink{ulog.KernelLog}, nil
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "udp":
+		return udpSink{u.Host}, nil
+	case "http", "https":
+		return httpSink{s, &http.Client{Timeout: 30 * time.Second}}, nil
+	}
+	return nil, fmt.Errorf("unknown sink %q", s)
+}
+
+// run exports one batch of new entries.
+func run(x *exporter, s sink) error {
+	recs, err := x.poll()
+	if err != nil && len(recs) == 0 {
+		return err
+	}
+	if len(recs) > 0 {
+		if err := s.export(recs); err != nil {
+			return err
+		}
+		if cerr := x.commit(recs); cerr != nil {
+			return cerr
+		}
+		if *state != "" {
+			if err := x.save(*state); err != nil {
+				return err
+			}
+		}
+	}
+	// A read that failed half-way still exported what it got; report the
+	// failure so the next poll picks up from there.
+	return err
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	s, err := newSink(*sinkFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	i, err := ipmi.Open(*dev)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer i.Close()
+
+	x := &exporter{sel: i}
+	x.host, _ = os.Hostname()
+	if id, err := i.GetDeviceID(); err != nil {
+		log.Printf("Not decoding OEM events: %v", err)
+	} else {
+		x.dec.Manufacturer = id.Manufacturer()
+	}
+	if *state != "" {
+		if err := x.load(*state); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	for {
+		if err := run(x, s); err != nil {
+			if *once {
+				log.Fatal(err)
+			}
+			log.Print(err)
+		}
+		if *once {
+			return
+		}
+		time.Sleep(*interval)
+	}
+}
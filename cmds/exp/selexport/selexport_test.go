@@ -0,0 +1,159 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/ipmi"
+)
+
+// fakeSEL is an in-memory SEL.
+type fakeSEL struct {
+	entries []ipmi.Event
+	add     uint32
+	del     uint32
+}
+
+func (f *fakeSEL) append(sensor uint8) {
+	id := uint16(1)
+	if len(f.entries) > 0 {
+		id = f.entries[len(f.entries)-1].RecordID + 1
+	}
+	f.add++
+	e := ipmi.Event{RecordID: id, RecordType: 0x02}
+	e.StandardEvent.Timestamp = 0x60000000 + f.add
+	e.SensorNum = sensor
+	f.entries = append(f.entries, e)
+}
+
+func (f *fakeSEL) clear() {
+	f.entries = nil
+	f.del++
+}
+
+func (f *fakeSEL) GetSELInfo() (*ipmi.SELInfo, error) {
+	return &ipmi.SELInfo{Entries: uint16(len(f.entries)), LastAddTime: f.add, LastDelTime: f.del}, nil
+}
+
+func (f *fakeSEL) GetSELEntry(id uint16) (*ipmi.Event, uint16, error) {
+	for i, e := range f.entries {
+		if id == ipmi.SELFirstEntry || e.RecordID == id {
+			next := uint16(ipmi.SELLastEntry)
+			if i+1 < len(f.entries) {
+				next = f.entries[i+1].RecordID
+			}
+			return &e, next, nil
+		}
+	}
+	return nil, 0, fmt.Errorf("no entry %#04x", id)
+}
+
+func sensors(t *testing.T, x *exporter) []uint8 {
+	t.Helper()
+	recs, err := x.poll()
+	if err != nil {
+		t.Fatalf("poll() = %v", err)
+	}
+	if err := x.commit(recs); err != nil {
+		t.Fatalf("commit() = %v", err)
+	}
+	var s []uint8
+	for _, r := range recs {
+		s = append(s, r.SensorNumber)
+	}
+	return s
+}
+
+func TestExporter(t *testing.T) {
+	f := &fakeSEL{}
+	x := &exporter{sel: f}
+
+	if got := sensors(t, x); len(got) != 0 {
+		t.Errorf("empty SEL exported %v", got)
+	}
+	f.append(1)
+	f.append(2)
+	if got := fmt.Sprint(sensors(t, x)); got != "[1 2]" {
+		t.Errorf("first poll exported %s, want [1 2]", got)
+	}
+	if got := sensors(t, x); len(got) != 0 {
+		t.Errorf("unchanged SEL exported %v", got)
+	}
+	f.append(3)
+	if got := fmt.Sprint(sensors(t, x)); got != "[3]" {
+		t.Errorf("poll after append exported %s, want [3]", got)
+	}
+
+	// A cleared and refilled SEL reuses record IDs.
+	f.clear()
+	f.append(4)
+	f.append(5)
+	f.append(6)
+	f.append(7)
+	if got := fmt.Sprint(sensors(t, x)); got != "[4 5 6 7]" {
+		t.Errorf("poll after clear exported %s, want [4 5 6 7]", got)
+	}
+
+	// Nothing is committed when the sink fails, so a retry exports again.
+	f.append(8)
+	if _, err := x.poll(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(sensors(t, x)); got != "[8]" {
+		t.Errorf("retry exported %s, want [8]", got)
+	}
+}
+
+func TestRecordJSON(t *testing.T) {
+	e := &ipmi.Event{RecordID: 0x10, RecordType: 0x02}
+	e.StandardEvent.Timestamp = 0x5f5e1000
+	e.GenID = 0x20
+	e.SensorType = 0x0c
+	e.SensorNum = 0x41
+	e.EventTypeDir = 0xef
+	e.EventData = [3]uint8{0xa1, 0x00, 0x03}
+
+	var buf bytes.Buffer
+	if err := (writerSink{&buf}).export([]*record{newRecord("h", ipmi.SELDecoder{}, e)}); err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[string]interface{}{
+		"host":             "h",
+		"kind":             "system",
+		"time":             "2020-09-13T12:26:40Z",
+		"event_type":       float64(0x6f),
+		"deassertion":      true,
+		"event_data":       "a10003",
+		"sensor_type_name": "Memory",
+		"description":      "Uncorrectable ECC",
+	} {
+		if got[k] != want {
+			t.Errorf("%s = %v, want %v", k, got[k], want)
+		}
+	}
+
+	// OEM codes are decoded with the table of the manufacturer.
+	e.SensorType, e.EventTypeDir, e.EventData[0] = 0xc0, 0x6f, 0x01
+	if r := newRecord("", ipmi.SELDecoder{Manufacturer: ipmi.ManufacturerDell}, e); r.SensorTypeName != "Performance Status" || r.Description != "Performance Degraded, other" {
+		t.Errorf("Dell OEM record is %q, %q", r.SensorTypeName, r.Description)
+	}
+	if !newRecord("", ipmi.SELDecoder{}, e).sameEntry(*newRecord("", ipmi.SELDecoder{Manufacturer: ipmi.ManufacturerDell}, e)) {
+		t.Error("records of the same entry with other descriptions are not the same entry")
+	}
+
+	// Pre-init timestamps are relative, so carry no wall clock time.
+	e.StandardEvent.Timestamp = 100
+	if r := newRecord("", ipmi.SELDecoder{}, e); r.Time != "" {
+		t.Errorf("pre-init record has time %q", r.Time)
+	}
+}
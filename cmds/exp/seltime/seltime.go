@@ -0,0 +1,141 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// seltime shows or synchronizes the BMC's SEL clock.
+//
+// Synopsis:
+//     seltime [-d DEV] [-sync [-rtc]] [-max-skew DURATION] [-wait DURATION] [-utc-offset OFFSET]
+//
+// Description:
+//     Without -sync, seltime prints the SEL time and how far it is from
+//     the system time. With -sync, it sets the SEL clock to the system
+//     time if the two are more than -max-skew apart, so events the BMC
+//     logs have trustworthy timestamps. Run it at boot after ntpdate, or
+//     use -wait to wait for the kernel to report a synchronized clock,
+//     as it does when an NTP daemon disciplines it. On machines without
+//     network time, -rtc takes the time from the RTC instead.
+//
+//     The SEL clock normally runs on UTC; -utc-offset tells the BMC
+//     otherwise, e.g. -utc-offset=-5h for a BMC running on EST.
+//
+// Options:
+//     -d:        IPMI device number
+//     -sync:     set the SEL clock from the system clock
+//     -max-skew: largest difference that is left alone
+//     -wait:     wait this long for the system clock to be synchronized
+//     -rtc:      set the SEL clock from the RTC rather than the system clock
+//     -utc-offset: set the SEL clock's offset from UTC
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/u-root/u-root/pkg/ipmi"
+	"github.com/u-root/u-root/pkg/rtc"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	dev     = flag.Int("d", 0, "IPMI device number")
+	doSync  = flag.Bool("sync", false, "set the SEL clock from the system clock")
+	maxSkew = flag.Duration("max-skew", 2*time.Second, "largest difference that is left alone")
+	wait    = flag.Duration("wait", 0, "wait this long for the system clock to be synchronized")
+	fromRTC = flag.Bool("rtc", false, "set the SEL clock from the RTC rather than the system clock")
+	offset  = flag.String("utc-offset", "", "set the SEL clock's offset from UTC, e.g. -5h or 0")
+)
+
+// clockSynced reports whether the kernel considers the system clock
+// synchronized to a time source.
+func clockSynced() (bool, error) {
+	var tx unix.Timex
+	state, err := unix.Adjtimex(&tx)
+	if err != nil {
+		return false, err
+	}
+	return state != unix.TIME_ERROR, nil
+}
+
+func waitSynced(d time.Duration) error {
+	deadline := time.Now().Add(d)
+	for {
+		ok, err := clockSynced()
+		if err != nil || ok {
+			return err
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("system clock not synchronized after %v", d)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func main() {
+	flag.Parse()
+	i, err := ipmi.Open(*dev)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer i.Close()
+
+	if *offset != "" {
+		d, err := time.ParseDuration(*offset)
+		if err != nil {
+			log.Fatalf("Bad -utc-offset: %v", err)
+		}
+		if err := i.SetSELTimeUTCOffset(d); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if !*doSync {
+		t, err := i.GetSELTime()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%s (%v from system time)", t.UTC().Format(time.RFC3339), t.Sub(time.Now().Truncate(time.Second)))
+		// Not all BMCs know about time zones.
+		if off, ok, err := i.GetSELTimeUTCOffset(); err == nil && ok {
+			fmt.Printf(", UTC offset %v", off)
+		}
+		fmt.Println()
+		return
+	}
+
+	if *fromRTC {
+		r, err := rtc.OpenRTC()
+		if err != nil {
+			log.Fatal(err)
+		}
+		now, err := r.Read()
+		if err != nil {
+			log.Fatalf("Reading RTC: %v", err)
+		}
+		syncSEL(i, now)
+		return
+	}
+
+	if *wait > 0 {
+		if err := waitSynced(*wait); err != nil {
+			// A roughly right SEL clock is better than one that
+			// is way off, so carry on.
+			log.Printf("%v, setting SEL time anyway", err)
+		}
+	}
+	syncSEL(i, time.Now())
+}
+
+func syncSEL(i *ipmi.IPMI, now time.Time) {
+	delta, err := ipmi.SyncSELTime(i, now, *maxSkew)
+	if err != nil {
+		log.Fatalf("Syncing SEL time: %v", err)
+	}
+	if delta > *maxSkew || delta < -*maxSkew {
+		log.Printf("SEL clock was %v off, set to %s", delta, now.UTC().Format(time.RFC3339))
+	} else {
+		log.Printf("SEL clock is %v off, left alone", delta)
+	}
+}
@@ -5,25 +5,52 @@
 // Serve files on the network.
 //
 // Synopsis:
-//     srvfiles [--h=HOST] [--p=PORT] [--d=DIR]
+//     srvfiles [OPTIONS]
+//
+// Description:
+//     Serves DIR over HTTP or HTTPS, with directory listings and range
+//     requests, so images and logs can be fetched from a booted machine.
 //
 // Options:
-//     --h: hostname (default: 127.0.0.1)
-//     --p: port number (default: 8080)
-//     --d: directory to serve (default: .)
+//     --h:      hostname (default: 127.0.0.1)
+//     --p:      port number (default: 8080)
+//     --d:      directory to serve (default: .)
+//     --cert:   TLS certificate file
+//     --key:    TLS key file
+//     --tls:    serve HTTPS with a generated self-signed certificate
+//     --auth:   require basic auth as USER:PASSWORD
+//     --nolist: do not list directories
+//     --v:      log requests
 package main
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"flag"
 	"log"
+	"math/big"
 	"net"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 )
 
 var (
-	host = flag.String("h", "127.0.0.1", "hostname")
-	port = flag.String("p", "8080", "port number")
-	dir  = flag.String("d", ".", "directory to serve")
+	host       = flag.String("h", "127.0.0.1", "hostname")
+	port       = flag.String("p", "8080", "port number")
+	dir        = flag.String("d", ".", "directory to serve")
+	certFile   = flag.String("cert", "", "TLS certificate file")
+	keyFile    = flag.String("key", "", "TLS key file")
+	selfSigned = flag.Bool("tls", false, "serve HTTPS with a generated self-signed certificate")
+	auth       = flag.String("auth", "", "require basic auth as USER:PASSWORD")
+	noList     = flag.Bool("nolist", false, "do not list directories")
+	verbose    = flag.Bool("v", false, "log requests")
 )
 
 var cacheHeaders = []string{
@@ -47,8 +74,113 @@ func maxAgeHandler(h http.Handler) http.Handler {
 	})
 }
 
+// authHandler requires basic auth with the given credentials.
+func authHandler(h http.Handler, user, password string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u, p, ok := r.BasicAuth()
+		if !ok || subtle.ConstantTimeCompare([]byte(u), []byte(user)) != 1 || subtle.ConstantTimeCompare([]byte(p), []byte(password)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="srvfiles"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// noListFS hides directories that have no index.html.
+type noListFS struct {
+	http.FileSystem
+}
+
+func (fs noListFS) Open(name string) (http.File, error) {
+	f, err := fs.FileSystem.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if fi, err := f.Stat(); err == nil && fi.IsDir() {
+		index, err := fs.FileSystem.Open(strings.TrimSuffix(name, "/") + "/index.html")
+		if err != nil {
+			f.Close()
+			return nil, os.ErrNotExist
+		}
+		index.Close()
+	}
+	return f, nil
+}
+
+func logHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s %s %s range=%q", r.RemoteAddr, r.Method, r.URL.Path, r.Header.Get("Range"))
+		h.ServeHTTP(w, r)
+	})
+}
+
+func handler() http.Handler {
+	var fs http.FileSystem = http.Dir(*dir)
+	if *noList {
+		fs = noListFS{fs}
+	}
+	h := maxAgeHandler(http.FileServer(fs))
+	if len(*auth) > 0 {
+		up := strings.SplitN(*auth, ":", 2)
+		if len(up) != 2 {
+			log.Fatalf("-auth must be USER:PASSWORD")
+		}
+		h = authHandler(h, up[0], up[1])
+	}
+	if *verbose {
+		h = logHandler(h)
+	}
+	return h
+}
+
+// selfSignedCert generates a certificate for this run.
+func selfSignedCert() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	hostname, _ := os.Hostname()
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: hostname},
+		DNSNames:     []string{hostname},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(365 * 24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(*host); ip != nil {
+		tmpl.IPAddresses = []net.IP{ip}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
+
 func main() {
 	flag.Parse()
-	http.Handle("/", maxAgeHandler(http.FileServer(http.Dir(*dir))))
-	log.Fatal(http.ListenAndServe(net.JoinHostPort(*host, *port), nil))
+	srv := &http.Server{
+		Addr:    net.JoinHostPort(*host, *port),
+		Handler: handler(),
+	}
+	switch {
+	case len(*certFile) > 0 || len(*keyFile) > 0:
+		log.Fatal(srv.ListenAndServeTLS(*certFile, *keyFile))
+	case *selfSigned:
+		cert, err := selfSignedCert()
+		if err != nil {
+			log.Fatal(err)
+		}
+		srv.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+		log.Fatal(srv.ListenAndServeTLS("", ""))
+	default:
+		log.Fatal(srv.ListenAndServe())
+	}
 }
@@ -0,0 +1,71 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	d, err := ioutil.TempDir("", "srvfiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	os.Mkdir(filepath.Join(d, "logs"), 0755)
+	ioutil.WriteFile(filepath.Join(d, "logs", "boot.log"), []byte("0123456789"), 0644)
+
+	*dir, *auth, *noList = d, "root:secret", true
+	srv := httptest.NewServer(handler())
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		name   string
+		path   string
+		user   string
+		rng    string
+		status int
+		body   string
+	}{
+		{name: "no auth", path: "/logs/boot.log", status: http.StatusUnauthorized},
+		{name: "wrong password", path: "/logs/boot.log", user: "root:nope", status: http.StatusUnauthorized},
+		{name: "file", path: "/logs/boot.log", user: "root:secret", status: http.StatusOK, body: "0123456789"},
+		{name: "range", path: "/logs/boot.log", user: "root:secret", rng: "bytes=2-4", status: http.StatusPartialContent, body: "234"},
+		{name: "no listing", path: "/logs/", user: "root:secret", status: http.StatusNotFound},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", srv.URL+tt.path, nil)
+			if len(tt.user) > 0 {
+				req.SetBasicAuth("root", tt.user[len("root:"):])
+			}
+			if len(tt.rng) > 0 {
+				req.Header.Set("Range", tt.rng)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			b, _ := ioutil.ReadAll(resp.Body)
+			if resp.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.status)
+			}
+			if len(tt.body) > 0 && string(b) != tt.body {
+				t.Errorf("body = %q, want %q", b, tt.body)
+			}
+		})
+	}
+}
+
+func TestSelfSignedCert(t *testing.T) {
+	if _, err := selfSignedCert(); err != nil {
+		t.Fatal(err)
+	}
+}
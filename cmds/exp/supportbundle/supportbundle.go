@@ -0,0 +1,308 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// supportbundle captures the state of a boot into a tarball to attach to bug
+// reports.
+//
+// Synopsis:
+//     supportbundle [-o FILE] [-d DEV] [-sel N] [-scan=false] [AUDIT FILE...]
+//
+// Description:
+//     When a machine fails to boot, supportbundle gathers what is needed to
+//     tell why into one gzipped tar, so every report comes with the same
+//     files:
+//       dmesg               the kernel log
+//       audit/              the kernel command line and the AUDIT FILEs,
+//                           e.g. a boot -json report
+//       network/            links and their addresses, routes and resolv.conf
+//       boot/               the boot entries found on local disks, and a
+//                           report of every device scanned
+//       smbios/, identity   the SMBIOS tables, decoded, and what system they
+//                           say this is
+//       pci                 the PCI devices
+//       sel                 the BMC's most recent SEL entries
+//       errors              what could not be captured, and why
+//
+//     Anything that cannot be captured is noted in errors rather than
+//     failing the bundle. A MANIFEST lists the SHA256 digest of each file.
+//
+// Options:
+//     -o:    bundle to write
+//     -d:    IPMI device number
+//     -sel:  number of the most recent SEL entries to include, 0 for none
+//     -scan: mount local disks to find boot entries
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/u-root/u-root/pkg/attest"
+	"github.com/u-root/u-root/pkg/boot/localboot"
+	"github.com/u-root/u-root/pkg/ipmi"
+	"github.com/u-root/u-root/pkg/mount"
+	"github.com/u-root/u-root/pkg/pci"
+	"github.com/u-root/u-root/pkg/smbios"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	out    = flag.String("o", "support.tgz", "bundle to write")
+	dev    = flag.Int("d", 0, "IPMI device number")
+	selMax = flag.Int("sel", 100, "number of the most recent SEL entries to include, 0 for none")
+	scan   = flag.Bool("scan", true, "mount local disks to find boot entries")
+)
+
+const smbiosDir = "/sys/firmware/dmi/tables"
+
+var (
+	// root is where the system's files are read from. Tests point it at
+	// a fake root.
+	root = "/"
+
+	// openIPMI opens the BMC the SEL is read from. Tests replace it with
+	// a fake BMC.
+	openIPMI = func() (*ipmi.IPMI, error) {
+		return ipmi.Open(*dev)
+	}
+)
+
+// collector adds what it captures to a bundle.
+type collector struct {
+	name string
+	add  func(*attest.Bundle) error
+	skip bool
+}
+
+func addDmesg(b *attest.Bundle) error {
+	n, err := unix.Klogctl(unix.SYSLOG_ACTION_SIZE_BUFFER, nil)
+	if err != nil {
+		return err
+	}
+	buf := make([]byte, n)
+	if n, err = unix.Klogctl(unix.SYSLOG_ACTION_READ_ALL, buf); err != nil {
+		return err
+	}
+	return b.Add("dmesg", buf[:n])
+}
+
+func addAudit(files []string) func(*attest.Bundle) error {
+	return func(b *attest.Bundle) error {
+		for _, f := range append([]string{filepath.Join(root, "proc/cmdline")}, files...) {
+			data, err := ioutil.ReadFile(f)
+			if err != nil {
+				return err
+			}
+			if err := b.Add(attest.AuditDir+filepath.Base(f), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func addNetwork(b *attest.Bundle) error {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return err
+	}
+	names := make(map[int]string)
+	var l bytes.Buffer
+	for _, link := range links {
+		a := link.Attrs()
+		names[a.Index] = a.Name
+		fmt.Fprintf(&l, "%d: %s: <%s> mtu %d state %s\n", a.Index, a.Name, strings.ToUpper(strings.Replace(a.Flags.String(), "|", ",", -1)), a.MTU, a.OperState)
+		if a.HardwareAddr != nil {
+			fmt.Fprintf(&l, "    link/%s %s\n", link.Type(), a.HardwareAddr)
+		}
+		addrs, err := netlink.AddrList(link, netlink.FAMILY_ALL)
+		if err != nil {
+			fmt.Fprintf(&l, "    addresses: %v\n", err)
+			continue
+		}
+		for _, addr := range addrs {
+			family := "inet"
+			if addr.IP.To4() == nil {
+				family = "inet6"
+			}
+			fmt.Fprintf(&l, "    %s %s\n", family, addr.IPNet)
+		}
+	}
+	if err := b.Add("network/links", l.Bytes()); err != nil {
+		return err
+	}
+
+	routes, err := netlink.RouteList(nil, netlink.FAMILY_ALL)
+	if err != nil {
+		return err
+	}
+	var r bytes.Buffer
+	for _, route := range routes {
+		dst := "default"
+		if route.Dst != nil {
+			dst = route.Dst.String()
+		}
+		fmt.Fprint(&r, dst)
+		if route.Gw != nil {
+			fmt.Fprintf(&r, " via %s", route.Gw)
+		}
+		fmt.Fprintf(&r, " dev %s", names[route.LinkIndex])
+		if route.Src != nil {
+			fmt.Fprintf(&r, " src %s", route.Src)
+		}
+		if route.Priority != 0 {
+			fmt.Fprintf(&r, " metric %d", route.Priority)
+		}
+		fmt.Fprintln(&r)
+	}
+	if err := b.Add("network/routes", r.Bytes()); err != nil {
+		return err
+	}
+
+	resolv, err := ioutil.ReadFile(filepath.Join(root, "etc/resolv.conf"))
+	if err != nil {
+		return err
+	}
+	return b.Add("network/resolv.conf", resolv)
+}
+
+func addBootEntries(b *attest.Bundle) error {
+	images, mps, report, err := localboot.Localboot()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, mp := range mps {
+			mp.Unmount(mount.MNT_DETACH)
+		}
+	}()
+
+	j, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := b.Add("boot/report.json", append(j, '\n')); err != nil {
+		return err
+	}
+	var e bytes.Buffer
+	for _, img := range images {
+		fmt.Fprintf(&e, "%s\n%s\n\n", img.Label(), img)
+	}
+	return b.Add("boot/entries", e.Bytes())
+}
+
+func addSMBIOS(b *attest.Bundle) error {
+	if err := b.AddSMBIOS(filepath.Join(root, smbiosDir)); err != nil {
+		return err
+	}
+	entry, _ := b.File(attest.SMBIOSEntryFile)
+	data, _ := b.File(attest.SMBIOSFile)
+	info, err := smbios.ParseInfo(entry, data)
+	if err != nil {
+		return err
+	}
+	return b.Add("smbios/tables", []byte(info.String()+"\n"))
+}
+
+func addPCI(b *attest.Bundle) error {
+	r, err := pci.NewBusReader()
+	if err != nil {
+		return err
+	}
+	d, err := r.Read()
+	if err != nil {
+		return err
+	}
+	d.SetVendorDeviceName()
+	return b.Add("pci", []byte(d.String()))
+}
+
+func addSEL(b *attest.Bundle) error {
+	i, err := openIPMI()
+	if err != nil {
+		return err
+	}
+	defer i.Close()
+
+	var d ipmi.SELDecoder
+	if id, err := i.GetDeviceID(); err == nil {
+		d.Manufacturer = id.Manufacturer()
+	}
+	// The SEL is only read oldest first; keep the last entries.
+	var lines []string
+	it := i.SELEntries()
+	for it.Next() {
+		lines = append(lines, d.String(it.Event()))
+		if len(lines) > *selMax {
+			lines = lines[1:]
+		}
+	}
+	if len(lines) > 0 {
+		if err := b.Add("sel", []byte(strings.Join(lines, "\n")+"\n")); err != nil {
+			return err
+		}
+	}
+	return it.Err()
+}
+
+// collect runs collectors into a new bundle. Those that fail are logged and
+// noted in the bundle's errors file.
+func collect(collectors []collector) (*attest.Bundle, error) {
+	b := &attest.Bundle{Time: time.Now()}
+	var errs bytes.Buffer
+	for _, c := range collectors {
+		if c.skip {
+			continue
+		}
+		if err := c.add(b); err != nil {
+			log.Printf("%s: %v", c.name, err)
+			fmt.Fprintf(&errs, "%s: %v\n", c.name, err)
+		}
+	}
+	if errs.Len() > 0 {
+		if err := b.Add("errors", errs.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func main() {
+	flag.Parse()
+
+	b, err := collect([]collector{
+		{"dmesg", addDmesg, false},
+		{"audit trail", addAudit(flag.Args()), false},
+		{"network state", addNetwork, false},
+		{"boot entries", addBootEntries, !*scan},
+		{"SMBIOS", addSMBIOS, false},
+		{"PCI devices", addPCI, false},
+		{"SEL", addSEL, *selMax <= 0},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := b.Write(f, nil); err != nil {
+		f.Close()
+		log.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Wrote %s: %s", *out, strings.Join(b.Files(), " "))
+}
@@ -0,0 +1,146 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/ipmi"
+	"github.com/u-root/u-root/pkg/ipmi/ipmitest"
+)
+
+// selBMC returns a BMC whose SEL has OEM records 1 to n.
+func selBMC(n uint16) *ipmitest.BMC {
+	b := ipmitest.New()
+	info := make([]byte, 14)
+	info[0] = 0x51
+	binary.LittleEndian.PutUint16(info[1:3], n)
+	b.Respond(0x0A, 0x40, info...)
+	b.Handle(0x0A, 0x43, func(data []byte) ([]byte, error) {
+		id := binary.LittleEndian.Uint16(data[2:4])
+		if id == 0 {
+			id = 1
+		}
+		next := id + 1
+		if id == n {
+			next = ipmi.SELLastEntry
+		}
+		resp := make([]byte, 3+16)
+		binary.LittleEndian.PutUint16(resp[1:3], next)
+		binary.LittleEndian.PutUint16(resp[3:5], id)
+		resp[5] = 0xF0
+		return resp, nil
+	})
+	return b
+}
+
+func readTar(t *testing.T, r io.Reader) map[string]string {
+	z, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]string)
+	tr := tar.NewReader(z)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[hdr.Name] = string(data)
+	}
+}
+
+func TestBundle(t *testing.T) {
+	dir, err := ioutil.TempDir("", "supportbundle")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The fake root has a command line but no SMBIOS tables.
+	fakeRoot := filepath.Join(dir, "root")
+	if err := os.MkdirAll(filepath.Join(fakeRoot, "proc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(fakeRoot, "proc/cmdline"), []byte("console=ttyS0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	report := filepath.Join(dir, "boot.json")
+	if err := ioutil.WriteFile(report, []byte("{}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	bmc := selBMC(3)
+
+	oldRoot, oldOpen, oldMax := root, openIPMI, *selMax
+	defer func() {
+		root, openIPMI, *selMax = oldRoot, oldOpen, oldMax
+	}()
+	root = fakeRoot
+	openIPMI = func() (*ipmi.IPMI, error) {
+		return bmc.IPMI(), nil
+	}
+	*selMax = 2
+
+	// SMBIOS fails, but what comes after it is still captured.
+	b, err := collect([]collector{
+		{"audit trail", addAudit([]string{report}), false},
+		{"boot entries", addBootEntries, true},
+		{"SMBIOS", addSMBIOS, false},
+		{"SEL", addSEL, false},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := b.Write(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	files := readTar(t, &buf)
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := []string{"MANIFEST", "audit/boot.json", "audit/cmdline", "errors", "sel"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("bundle has %v, want %v", names, want)
+	}
+	if got := files["audit/cmdline"]; got != "console=ttyS0\n" {
+		t.Errorf("audit/cmdline = %q, want the fake root's", got)
+	}
+	if got := files["audit/boot.json"]; got != "{}\n" {
+		t.Errorf("audit/boot.json = %q, want %q", got, "{}\n")
+	}
+	if errs := files["errors"]; !strings.HasPrefix(errs, "SMBIOS: ") || strings.Count(errs, "\n") != 1 {
+		t.Errorf("errors = %q, want only the SMBIOS failure", errs)
+	}
+	// Only the last -sel entries are kept.
+	sel := strings.Split(strings.TrimSuffix(files["sel"], "\n"), "\n")
+	if len(sel) != 2 || !strings.HasPrefix(sel[0], "   2 |") || !strings.HasPrefix(sel[1], "   3 |") {
+		t.Errorf("sel = %q, want records 2 and 3", files["sel"])
+	}
+	if !bmc.Closed() {
+		t.Errorf("BMC was not closed")
+	}
+}
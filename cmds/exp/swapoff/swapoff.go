@@ -0,0 +1,54 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// swapoff disables swap areas.
+//
+// Synopsis:
+//     swapoff PATH...
+//     swapoff -a
+//
+// Description:
+//     swapoff disables swap on the devices or files, reading what was
+//     swapped out back into memory, or with -a on all enabled areas.
+//
+// Options:
+//     -a: disable all swap areas
+package main
+
+import (
+	"flag"
+	"log"
+
+	"github.com/u-root/u-root/pkg/swap"
+)
+
+var all = flag.Bool("a", false, "disable all swap areas")
+
+func main() {
+	flag.Parse()
+	paths := flag.Args()
+	if *all {
+		areas, err := swap.Areas()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, a := range areas {
+			paths = append(paths, a.Path)
+		}
+	}
+	if len(paths) == 0 && !*all {
+		log.Fatal("usage: swapoff -a | PATH...")
+	}
+
+	var failed bool
+	for _, p := range paths {
+		if err := swap.Off(p); err != nil {
+			log.Print(err)
+			failed = true
+		}
+	}
+	if failed {
+		log.Fatal("not all swap areas were disabled")
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// swapon enables swap areas.
+//
+// Synopsis:
+//     swapon [-p PRIORITY] [-d] PATH...
+//     swapon -z SIZE [-algorithm ALG] [-p PRIORITY]
+//     swapon
+//
+// Description:
+//     swapon enables swap on the devices or files, which mkswap has set
+//     up. -z instead sets up and enables swap on a zram device of SIZE,
+//     e.g. 1G, which holds swapped out pages compressed in memory: on a
+//     machine short of memory and without a disk to spare, it fits more
+//     in memory. Without arguments, swapon lists the enabled areas.
+//
+// Options:
+//     -p:         priority, 0 to 32767; higher priority areas are used
+//                 first. zram swap defaults to 100, above disk swap.
+//     -d:         discard freed pages, for SSDs
+//     -z:         enable zram swap of this size
+//     -algorithm: zram compression algorithm, e.g. lz4 or zstd
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/rck/unit"
+	"github.com/u-root/u-root/pkg/swap"
+)
+
+var (
+	priority  = flag.Int("p", swap.DefaultPriority, "priority, 0 to 32767, higher is used first")
+	discard   = flag.Bool("d", false, "discard freed pages")
+	algorithm = flag.String("algorithm", "", "zram compression algorithm")
+	zramSize  = unit.MustNewUnit(unit.DefaultUnits).MustNewValue(0, unit.None)
+)
+
+func init() {
+	flag.Var(zramSize, "z", "enable zram swap of this size")
+}
+
+func list() error {
+	areas, err := swap.Areas()
+	if err != nil {
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, ' ', 0)
+	fmt.Fprintln(w, "NAME\tTYPE\tSIZE\tUSED\tPRIO")
+	for _, a := range areas {
+		fmt.Fprintf(w, "%s\t%s\t%dK\t%dK\t%d\n", a.Path, a.Type, a.Size>>10, a.Used>>10, a.Priority)
+	}
+	return w.Flush()
+}
+
+func main() {
+	flag.Parse()
+	o := swap.Options{Priority: *priority, Discard: *discard}
+
+	switch {
+	case zramSize.IsSet:
+		if flag.NArg() != 0 {
+			log.Fatal("usage: swapon -z SIZE [-algorithm ALG] [-p PRIORITY]")
+		}
+		if o.Priority < 0 {
+			o.Priority = swap.ZramPriority
+		}
+		// Freed pages should not hold on to memory.
+		o.Discard = true
+		z, err := swap.OnZram(zramSize.Value, *algorithm, o)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Enabled zram swap on %s\n", z.Path())
+	case flag.NArg() == 0:
+		if err := list(); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		for _, path := range flag.Args() {
+			if err := swap.On(path, o); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+}
@@ -0,0 +1,211 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+// decode returns a one line summary of an Ethernet frame.
+func decode(b []byte) string {
+	if len(b) < 14 {
+		return fmt.Sprintf("truncated frame, %d bytes", len(b))
+	}
+	src, dst := net.HardwareAddr(b[6:12]), net.HardwareAddr(b[0:6])
+	typ := binary.BigEndian.Uint16(b[12:])
+	p := b[14:]
+	// Skip one 802.1Q tag.
+	var vlan string
+	if typ == 0x8100 && len(p) >= 4 {
+		vlan = fmt.Sprintf("vlan %d, ", binary.BigEndian.Uint16(p)&0xfff)
+		typ = binary.BigEndian.Uint16(p[2:])
+		p = p[4:]
+	}
+
+	switch typ {
+	case 0x0806:
+		return vlan + decodeARP(p)
+	case 0x0800:
+		return vlan + decodeIPv4(p)
+	case 0x86dd:
+		return vlan + decodeIPv6(p)
+	}
+	return fmt.Sprintf("%s%s > %s, ethertype %#04x, length %d", vlan, src, dst, typ, len(b))
+}
+
+func decodeARP(p []byte) string {
+	// Only Ethernet/IPv4 ARP.
+	if len(p) < 28 || binary.BigEndian.Uint16(p[0:]) != 1 || binary.BigEndian.Uint16(p[2:]) != 0x0800 {
+		return "ARP, unknown format"
+	}
+	sha, spa := net.HardwareAddr(p[8:14]), net.IP(p[14:18])
+	tpa := net.IP(p[24:28])
+	switch binary.BigEndian.Uint16(p[6:]) {
+	case 1:
+		return fmt.Sprintf("ARP, Request who-has %s tell %s", tpa, spa)
+	case 2:
+		return fmt.Sprintf("ARP, Reply %s is-at %s", spa, sha)
+	}
+	return "ARP, unknown operation"
+}
+
+func decodeIPv4(p []byte) string {
+	if len(p) < 20 {
+		return "IP, truncated"
+	}
+	ihl := int(p[0]&0xf) * 4
+	if ihl < 20 || len(p) < ihl {
+		return "IP, bad header length"
+	}
+	src, dst := net.IP(p[12:16]), net.IP(p[16:20])
+	if binary.BigEndian.Uint16(p[6:])&0x1fff != 0 {
+		return fmt.Sprintf("IP %s > %s: fragment", src, dst)
+	}
+	return "IP " + decodeL4(p[9], src, dst, p[ihl:])
+}
+
+func decodeIPv6(p []byte) string {
+	if len(p) < 40 {
+		return "IP6, truncated"
+	}
+	return "IP6 " + decodeL4(p[6], net.IP(p[8:24]), net.IP(p[24:40]), p[40:])
+}
+
+func hostPort(ip net.IP, port uint16) string {
+	return net.JoinHostPort(ip.String(), fmt.Sprint(port))
+}
+
+func decodeL4(proto byte, src, dst net.IP, p []byte) string {
+	switch proto {
+	case 6:
+		if len(p) < 20 {
+			return fmt.Sprintf("%s > %s: TCP, truncated", src, dst)
+		}
+		sp, dp := binary.BigEndian.Uint16(p[0:]), binary.BigEndian.Uint16(p[2:])
+		off := int(p[12]>>4) * 4
+		payload := 0
+		if off <= len(p) {
+			payload = len(p) - off
+		}
+		return fmt.Sprintf("%s > %s: Flags [%s], seq %d, ack %d, win %d, length %d",
+			hostPort(src, sp), hostPort(dst, dp), tcpFlags(p[13]),
+			binary.BigEndian.Uint32(p[4:]), binary.BigEndian.Uint32(p[8:]), binary.BigEndian.Uint16(p[14:]), payload)
+	case 17:
+		if len(p) < 8 {
+			return fmt.Sprintf("%s > %s: UDP, truncated", src, dst)
+		}
+		sp, dp := binary.BigEndian.Uint16(p[0:]), binary.BigEndian.Uint16(p[2:])
+		s := fmt.Sprintf("%s > %s: ", hostPort(src, sp), hostPort(dst, dp))
+		data := p[8:]
+		switch {
+		case sp == 67 || sp == 68 || dp == 67 || dp == 68:
+			return s + decodeDHCP(data)
+		case sp == 53 || dp == 53 || sp == 5353 || dp == 5353:
+			return s + decodeDNS(data)
+		case sp == 69 || dp == 69:
+			return s + "TFTP"
+		}
+		return s + fmt.Sprintf("UDP, length %d", len(data))
+	case 1, 58:
+		if len(p) < 2 {
+			return fmt.Sprintf("%s > %s: ICMP, truncated", src, dst)
+		}
+		name := "ICMP"
+		if proto == 58 {
+			name = "ICMP6"
+		}
+		return fmt.Sprintf("%s > %s: %s type %d, code %d", src, dst, name, p[0], p[1])
+	}
+	return fmt.Sprintf("%s > %s: ip-proto-%d, length %d", src, dst, proto, len(p))
+}
+
+// tcpFlags formats flags like tcpdump does.
+func tcpFlags(f byte) string {
+	var s string
+	for _, fl := range []struct {
+		bit byte
+		c   string
+	}{{0x02, "S"}, {0x01, "F"}, {0x08, "P"}, {0x04, "R"}, {0x20, "U"}, {0x40, "E"}, {0x80, "W"}} {
+		if f&fl.bit != 0 {
+			s += fl.c
+		}
+	}
+	if f&0x10 != 0 {
+		s += "."
+	}
+	if len(s) == 0 {
+		return "none"
+	}
+	return s
+}
+
+func decodeDHCP(b []byte) string {
+	m, err := dhcpv4.FromBytes(b)
+	if err != nil {
+		return fmt.Sprintf("BOOTP/DHCP, malformed: %v", err)
+	}
+	s := fmt.Sprintf("DHCP %s, xid %s, client %s", m.MessageType(), m.TransactionID, m.ClientHWAddr)
+	if ip := m.YourIPAddr; ip != nil && !ip.IsUnspecified() {
+		s += fmt.Sprintf(", your-ip %s", ip)
+	}
+	if f := m.BootFileNameOption(); len(f) > 0 {
+		s += fmt.Sprintf(", file %q", f)
+	} else if len(m.BootFileName) > 0 {
+		s += fmt.Sprintf(", file %q", m.BootFileName)
+	}
+	return s
+}
+
+// dnsTypes names common query types.
+var dnsTypes = map[uint16]string{
+	1: "A", 2: "NS", 5: "CNAME", 6: "SOA", 12: "PTR", 15: "MX", 16: "TXT", 28: "AAAA", 33: "SRV", 255: "ANY",
+}
+
+// decodeDNS prints the header and first question of a DNS message.
+func decodeDNS(b []byte) string {
+	if len(b) < 12 {
+		return "DNS, truncated"
+	}
+	id := binary.BigEndian.Uint16(b[0:])
+	flags := binary.BigEndian.Uint16(b[2:])
+	qd, an := binary.BigEndian.Uint16(b[4:]), binary.BigEndian.Uint16(b[6:])
+
+	var q string
+	if qd > 0 {
+		var labels []string
+		i := 12
+		for i < len(b) && b[i] != 0 && b[i]&0xc0 == 0 {
+			n := int(b[i])
+			if i+1+n > len(b) {
+				return "DNS, truncated"
+			}
+			labels = append(labels, string(b[i+1:i+1+n]))
+			i += 1 + n
+		}
+		if i+5 > len(b) {
+			return "DNS, truncated"
+		}
+		typ := binary.BigEndian.Uint16(b[i+1:])
+		name, ok := dnsTypes[typ]
+		if !ok {
+			name = fmt.Sprintf("TYPE%d", typ)
+		}
+		q = fmt.Sprintf(" %s? %s.", name, strings.Join(labels, "."))
+	}
+
+	if flags&0x8000 == 0 {
+		return fmt.Sprintf("DNS %d%s", id, q)
+	}
+	rcode := flags & 0xf
+	if rcode != 0 {
+		return fmt.Sprintf("DNS %d%s rcode %d", id, q, rcode)
+	}
+	return fmt.Sprintf("DNS %d%s %d answers", id, q, an)
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+func ether(typ uint16, payload []byte) []byte {
+	b := make([]byte, 14)
+	copy(b[0:], []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff})
+	copy(b[6:], []byte{0x52, 0x54, 0, 0x12, 0x34, 0x56})
+	binary.BigEndian.PutUint16(b[12:], typ)
+	return append(b, payload...)
+}
+
+func ipv4(proto byte, src, dst string, payload []byte) []byte {
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	ip[9] = proto
+	copy(ip[12:], net.ParseIP(src).To4())
+	copy(ip[16:], net.ParseIP(dst).To4())
+	return ether(0x0800, append(ip, payload...))
+}
+
+func udp(sport, dport uint16, payload []byte) []byte {
+	u := make([]byte, 8)
+	binary.BigEndian.PutUint16(u[0:], sport)
+	binary.BigEndian.PutUint16(u[2:], dport)
+	return append(u, payload...)
+}
+
+func TestDecode(t *testing.T) {
+	arp := make([]byte, 28)
+	binary.BigEndian.PutUint16(arp[0:], 1)
+	binary.BigEndian.PutUint16(arp[2:], 0x0800)
+	binary.BigEndian.PutUint16(arp[6:], 1)
+	copy(arp[14:], net.ParseIP("10.0.0.2").To4())
+	copy(arp[24:], net.ParseIP("10.0.0.1").To4())
+
+	tcp := make([]byte, 20)
+	binary.BigEndian.PutUint16(tcp[0:], 40000)
+	binary.BigEndian.PutUint16(tcp[2:], 80)
+	binary.BigEndian.PutUint32(tcp[4:], 1000)
+	tcp[12] = 5 << 4
+	tcp[13] = 0x12 // SYN, ACK
+
+	mac, _ := net.ParseMAC("52:54:00:12:34:56")
+	disc, err := dhcpv4.NewDiscovery(mac)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Query for example.com A.
+	dns := []byte{0x12, 0x34, 0x01, 0x00, 0, 1, 0, 0, 0, 0, 0, 0,
+		7, 'e', 'x', 'a', 'm', 'p', 'l', 'e', 3, 'c', 'o', 'm', 0, 0, 1, 0, 1}
+
+	for _, tt := range []struct {
+		name string
+		pkt  []byte
+		want string
+	}{
+		{"arp", ether(0x0806, arp), "ARP, Request who-has 10.0.0.1 tell 10.0.0.2"},
+		{"tcp", ipv4(6, "10.0.0.2", "10.0.0.1", tcp), "IP 10.0.0.2:40000 > 10.0.0.1:80: Flags [S.], seq 1000, ack 0, win 0, length 0"},
+		{"dhcp", ipv4(17, "0.0.0.0", "255.255.255.255", udp(68, 67, disc.ToBytes())), "IP 0.0.0.0:68 > 255.255.255.255:67: DHCP DISCOVER, xid " + disc.TransactionID.String() + ", client 52:54:00:12:34:56"},
+		{"dns", ipv4(17, "10.0.0.2", "10.0.0.53", udp(5000, 53, dns)), "IP 10.0.0.2:5000 > 10.0.0.53:53: DNS 4660 A? example.com."},
+		{"truncated", ether(0x0800, []byte{0x45}), "IP, truncated"},
+		{"other", ether(0x88cc, nil), "52:54:00:12:34:56 > ff:ff:ff:ff:ff:ff, ethertype 0x88cc, length 14"},
+	} {
+		if got := decode(tt.pkt); got != tt.want {
+			t.Errorf("%s: decode() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	// Nothing may panic on truncated packets.
+	full := ipv4(17, "10.0.0.2", "10.0.0.53", udp(5000, 53, dns))
+	for i := range full {
+		if s := decode(full[:i]); strings.Contains(s, "panic") {
+			t.Errorf("decode(%d bytes) = %q", i, s)
+		}
+	}
+}
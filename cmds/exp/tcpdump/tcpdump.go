@@ -0,0 +1,145 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// tcpdump captures packets on a network interface.
+//
+// Synopsis:
+//     tcpdump [OPTIONS] -i INTERFACE [EXPRESSION]
+//
+// Description:
+//     Packets matching EXPRESSION are printed one per line, with a short
+//     decode of ARP, DHCP, DNS, TCP and ICMP, and/or written to a pcap or
+//     pcapng file. EXPRESSION is a subset of tcpdump's filter language,
+//     e.g. "udp port 67 or udp port 68 or arp"; it is run in the kernel.
+//
+// Options:
+//     -i:  interface to capture on
+//     -w:  write packets to this file, - for stdout
+//     -ng: write pcapng instead of pcap
+//     -s:  bytes to capture of each packet
+//     -c:  exit after this many packets
+//     -p:  do not put the interface into promiscuous mode
+//     -q:  do not print packets while writing them
+//     -d:  print the compiled BPF program and exit
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/mdlayher/raw"
+	"github.com/u-root/u-root/pkg/pcap"
+	"golang.org/x/net/bpf"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	iface     = flag.String("i", "", "interface to capture on")
+	outFile   = flag.String("w", "", "write packets to this file, - for stdout")
+	ng        = flag.Bool("ng", false, "write pcapng instead of pcap")
+	snaplen   = flag.Int("s", 262144, "bytes to capture of each packet")
+	count     = flag.Int("c", 0, "exit after this many packets")
+	noPromisc = flag.Bool("p", false, "do not put the interface into promiscuous mode")
+	quiet     = flag.Bool("q", false, "do not print packets while writing them")
+	dump      = flag.Bool("d", false, "print the compiled BPF program and exit")
+)
+
+func main() {
+	flag.Parse()
+	prog, err := pcap.Compile(strings.Join(flag.Args(), " "), *snaplen)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *dump {
+		for i, ins := range prog {
+			fmt.Printf("(%03d) %v\n", i, ins)
+		}
+		return
+	}
+	filter, err := bpf.Assemble(prog)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *iface == "" {
+		log.Fatal("no interface given, use -i")
+	}
+	ifi, err := net.InterfaceByName(*iface)
+	if err != nil {
+		log.Fatal(err)
+	}
+	c, err := raw.ListenPacket(ifi, unix.ETH_P_ALL, &raw.Config{Filter: filter})
+	if err != nil {
+		log.Fatalf("listen on %s: %v", *iface, err)
+	}
+	if !*noPromisc {
+		if err := c.SetPromiscuous(true); err != nil {
+			log.Printf("promiscuous mode: %v", err)
+		}
+	}
+
+	var w pcap.Writer
+	if *outFile != "" {
+		var f io.WriteCloser = os.Stdout
+		if *outFile != "-" {
+			if f, err = os.Create(*outFile); err != nil {
+				log.Fatal(err)
+			}
+		}
+		defer f.Close()
+		if *ng {
+			w, err = pcap.NewNGWriter(f, *iface, *snaplen, pcap.LinkTypeEthernet)
+		} else {
+			w, err = pcap.NewWriter(f, *snaplen, pcap.LinkTypeEthernet)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *outFile == "-" {
+			*quiet = true
+		}
+	}
+
+	// Stop reading on ^C so the output file is closed properly.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		<-sig
+		c.SetReadDeadline(time.Now())
+	}()
+
+	// Packets are truncated by the filter, so this is as big as they get.
+	buf := make([]byte, *snaplen)
+	var n int
+	for *count == 0 || n < *count {
+		l, _, err := c.ReadFrom(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			}
+			log.Fatal(err)
+		}
+		now := time.Now()
+		n++
+		if w != nil {
+			if err := w.WritePacket(now, buf[:l], l); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if !*quiet {
+			fmt.Printf("%s %s\n", now.Format("15:04:05.000000"), decode(buf[:l]))
+		}
+	}
+
+	if st, err := c.Stats(); err == nil {
+		fmt.Fprintf(os.Stderr, "%d packets captured, %d dropped by kernel\n", n, st.Drops)
+	}
+}
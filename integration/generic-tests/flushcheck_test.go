@@ -0,0 +1,90 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !race
+
+package integration
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/u-root/u-root/pkg/qemu"
+	"github.com/u-root/u-root/pkg/uroot"
+	"github.com/u-root/u-root/pkg/vmtest"
+)
+
+// TestFlushcheck cuts the power of a VM halfway through writing records to
+// a disk, then checks in a second VM on the same disk that every record
+// flushed before that survived.
+func TestFlushcheck(t *testing.T) {
+	// TODO: support arm
+	if vmtest.TestArch() != "amd64" {
+		t.Skipf("test not supported on %s", vmtest.TestArch())
+	}
+
+	disk, err := ioutil.TempFile("", "flushcheck")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(disk.Name())
+	err = disk.Truncate(8 << 20)
+	disk.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buildOpts := uroot.Opts{
+		Commands: uroot.BusyBoxCmds(
+			"github.com/u-root/u-root/cmds/core/init",
+			"github.com/u-root/u-root/cmds/core/elvish",
+			"github.com/u-root/u-root/cmds/core/shutdown",
+			"github.com/u-root/u-root/cmds/exp/flushcheck",
+		),
+	}
+	w, wcleanup := vmtest.QEMUTest(t, &vmtest.Options{
+		Name:      "TestFlushcheck_Write",
+		BuildOpts: buildOpts,
+		TestCmds: []string{
+			"flushcheck -n 512 -poweroff-after 256 write /dev/sda",
+		},
+		QEMUOpts: qemu.Options{
+			SerialOutput: vmtest.TestLineWriter(t, "write"),
+			Timeout:      time.Minute,
+			Devices: []qemu.Device{
+				qemu.IDEBlockDevice{File: disk.Name()},
+			},
+		},
+	})
+	if err := w.Expect("acked 256 of 512"); err != nil {
+		wcleanup()
+		t.Fatal(`expected "acked 256 of 512", got error: `, err)
+	}
+	// The VM exits when flushcheck powers it off.
+	w.Wait()
+	wcleanup()
+
+	v, vcleanup := vmtest.QEMUTest(t, &vmtest.Options{
+		Name:      "TestFlushcheck_Verify",
+		BuildOpts: buildOpts,
+		TestCmds: []string{
+			"flushcheck -acked 256 verify /dev/sda",
+			"shutdown -h",
+		},
+		QEMUOpts: qemu.Options{
+			SerialOutput: vmtest.TestLineWriter(t, "verify"),
+			Timeout:      time.Minute,
+			Devices: []qemu.Device{
+				qemu.IDEBlockDevice{File: disk.Name()},
+			},
+		},
+	})
+	defer vcleanup()
+
+	if err := v.Expect("256 of 256 acknowledged records intact"); err != nil {
+		t.Fatal(`expected "256 of 256 acknowledged records intact", got error: `, err)
+	}
+}
@@ -0,0 +1,362 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package agent turns a machine booted into u-root into a provisioning
+// endpoint that a central controller manages over a small authenticated
+// HTTP API, rather than one that runs a script and is done.
+//
+// Requests and responses are JSON:
+//
+//     GET  /v1/inventory    what the machine is: Inventory
+//     POST /v1/health       run the health checks: HealthReport
+//     POST /v1/image        write an ImageRequest to a disk: installer.Result
+//     PUT  /v1/boot-target  have the BMC boot the next time from a BootTarget
+//     POST /v1/kexec        boot a KexecRequest: 202 Accepted, then kexec
+//
+// Errors are answered with an HTTP error status and an Error. Requests
+// that change the machine are taken one at a time; others get 409
+// Conflict while one is going on.
+package agent
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/checker"
+	"github.com/u-root/u-root/pkg/curl"
+	"github.com/u-root/u-root/pkg/installer"
+	"github.com/u-root/u-root/pkg/ipmi"
+)
+
+// Agent is an http.Handler serving the API.
+type Agent struct {
+	// Token, if set, is what the controller may authenticate with, as
+	// "Authorization: Bearer TOKEN". A TLS client certificate the server
+	// verified is taken either way.
+	Token string
+
+	// Checks are the health checks POST /v1/health runs.
+	Checks []checker.Check
+
+	// busy holds a token while a request changes the machine.
+	busy chan struct{}
+}
+
+// New returns an Agent authenticating the controller with token, if not
+// empty, or with TLS client certificates, and running checks.
+func New(token string, checks []checker.Check) *Agent {
+	return &Agent{Token: token, Checks: checks, busy: make(chan struct{}, 1)}
+}
+
+// Error is the body of error responses.
+type Error struct {
+	Error string `json:"error"`
+}
+
+var (
+	gatherInventory = GatherInventory
+	install         = installer.Install
+
+	// setBootFlags edits the boot flags the BMC has for the next boot.
+	setBootFlags = func(f func(*ipmi.BootFlags)) error {
+		i, err := ipmi.Open(0)
+		if err != nil {
+			return err
+		}
+		defer i.Close()
+		flags, err := i.GetSystemBootOptions()
+		if err != nil {
+			return err
+		}
+		f(flags)
+		return i.SetSystemBootOptions(flags)
+	}
+	kexecLoad = func(li *boot.LinuxImage) error {
+		return li.Load(false)
+	}
+	kexecReboot = boot.Execute
+
+	// kexecDelay is how long the controller has to get the answer to
+	// POST /v1/kexec before the machine goes away.
+	kexecDelay = time.Second
+)
+
+func (a *Agent) authorized(r *http.Request) bool {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		return true
+	}
+	if a.Token == "" {
+		return false
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(auth, "Bearer ")), []byte(a.Token)) == 1
+}
+
+// ServeHTTP implements http.Handler.
+func (a *Agent) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(r) {
+		log.Printf("Agent: %s %s from %s: not authorized", r.Method, r.URL.Path, r.RemoteAddr)
+		reply(w, http.StatusUnauthorized, Error{"not authorized"})
+		return
+	}
+
+	type route struct {
+		method string
+		handle func(http.ResponseWriter, *http.Request)
+		// changes is set for requests that change the machine.
+		changes bool
+	}
+	routes := map[string]route{
+		"/v1/inventory":   {http.MethodGet, a.inventory, false},
+		"/v1/health":      {http.MethodPost, a.health, false},
+		"/v1/image":       {http.MethodPost, a.image, true},
+		"/v1/boot-target": {http.MethodPut, a.bootTarget, true},
+		"/v1/kexec":       {http.MethodPost, a.kexec, true},
+	}
+	rt, ok := routes[r.URL.Path]
+	switch {
+	case !ok:
+		reply(w, http.StatusNotFound, Error{fmt.Sprintf("no such API %s", r.URL.Path)})
+		return
+	case r.Method != rt.method:
+		w.Header().Set("Allow", rt.method)
+		reply(w, http.StatusMethodNotAllowed, Error{fmt.Sprintf("%s takes %s", r.URL.Path, rt.method)})
+		return
+	}
+	if rt.changes {
+		select {
+		case a.busy <- struct{}{}:
+			defer func() { <-a.busy }()
+		default:
+			reply(w, http.StatusConflict, Error{"another request is changing the machine"})
+			return
+		}
+	}
+	log.Printf("Agent: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+	rt.handle(w, r)
+}
+
+// reply writes v as the JSON response, with status.
+func reply(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Agent: cannot reply: %v", err)
+	}
+}
+
+// decode reads the JSON request body into v, answering a bad request if it
+// cannot.
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	if err := d.Decode(v); err != nil {
+		reply(w, http.StatusBadRequest, Error{fmt.Sprintf("bad request: %v", err)})
+		return false
+	}
+	return true
+}
+
+func (a *Agent) inventory(w http.ResponseWriter, r *http.Request) {
+	reply(w, http.StatusOK, gatherInventory())
+}
+
+// CheckResult is the outcome of a health check.
+type CheckResult struct {
+	Name string `json:"name"`
+	OK   bool   `json:"ok"`
+	// Error is why the check failed, the last time it was run.
+	Error string `json:"error,omitempty"`
+	// Remediated is set if the check failed, was remediated and run
+	// again.
+	Remediated bool `json:"remediated,omitempty"`
+}
+
+// HealthReport is the outcome of the health checks.
+type HealthReport struct {
+	Healthy bool          `json:"healthy"`
+	Checks  []CheckResult `json:"checks"`
+}
+
+// RunChecks runs checks in order, remediating failed checks that can be
+// and running them again. It stops after a failed check that has
+// StopOnError set.
+func RunChecks(checks []checker.Check) HealthReport {
+	rep := HealthReport{Healthy: true, Checks: []CheckResult{}}
+	for _, c := range checks {
+		res := CheckResult{Name: c.Name}
+		err := c.Run()
+		if err != nil && c.Remediate != nil {
+			if rerr := c.Remediate(); rerr != nil {
+				err = fmt.Errorf("%v; remediation failed: %v", err, rerr)
+			} else {
+				res.Remediated = true
+				err = c.Run()
+			}
+		}
+		res.OK = err == nil
+		if err != nil {
+			res.Error = err.Error()
+			rep.Healthy = false
+		}
+		rep.Checks = append(rep.Checks, res)
+		if err != nil && c.StopOnError {
+			break
+		}
+	}
+	return rep
+}
+
+func (a *Agent) health(w http.ResponseWriter, r *http.Request) {
+	reply(w, http.StatusOK, RunChecks(a.Checks))
+}
+
+// ImageRequest asks for an image to be written to a disk, as the
+// installer.Options of the same names.
+type ImageRequest struct {
+	Source     string `json:"source"`
+	Target     string `json:"target"`
+	Checksum   string `json:"checksum,omitempty"`
+	Decompress string `json:"decompress,omitempty"`
+	Sparse     bool   `json:"sparse,omitempty"`
+	Verify     bool   `json:"verify,omitempty"`
+}
+
+func (a *Agent) image(w http.ResponseWriter, r *http.Request) {
+	var req ImageRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.Source == "" || req.Target == "" {
+		reply(w, http.StatusBadRequest, Error{"bad request: an image needs a source and a target"})
+		return
+	}
+	res, err := install(r.Context(), installer.Options{
+		Source:     req.Source,
+		Target:     req.Target,
+		Checksum:   req.Checksum,
+		Decompress: req.Decompress,
+		Sparse:     req.Sparse,
+		Verify:     req.Verify,
+	})
+	if err != nil {
+		reply(w, http.StatusInternalServerError, Error{err.Error()})
+		return
+	}
+	log.Printf("Agent: wrote %s to %s", req.Source, req.Target)
+	reply(w, http.StatusOK, res)
+}
+
+// bootDevices are the names of BMC boot devices a BootTarget takes.
+var bootDevices = map[string]ipmi.BootDevice{
+	"none":         ipmi.BootDeviceNone,
+	"pxe":          ipmi.BootDevicePXE,
+	"disk":         ipmi.BootDeviceDisk,
+	"safe":         ipmi.BootDeviceDiskSafeMode,
+	"diag":         ipmi.BootDeviceDiagnostic,
+	"cdrom":        ipmi.BootDeviceCDROM,
+	"bios":         ipmi.BootDeviceBIOSSetup,
+	"remote-cdrom": ipmi.BootDeviceRemoteCDROM,
+	"remote-media": ipmi.BootDeviceRemoteMedia,
+	"remote-disk":  ipmi.BootDeviceRemoteDisk,
+	"floppy":       ipmi.BootDeviceFloppy,
+}
+
+// BootTarget is where the firmware boots from, as the BMC's boot flags
+// tell it.
+type BootTarget struct {
+	// Device is one of none, pxe, disk, safe, diag, cdrom, bios,
+	// remote-cdrom, remote-media, remote-disk or floppy.
+	Device string `json:"device"`
+	// Persistent is set for all boots to come, not only the next.
+	Persistent bool `json:"persistent,omitempty"`
+	EFI        bool `json:"efi,omitempty"`
+}
+
+func (a *Agent) bootTarget(w http.ResponseWriter, r *http.Request) {
+	var t BootTarget
+	if !decode(w, r, &t) {
+		return
+	}
+	d, ok := bootDevices[t.Device]
+	if !ok {
+		reply(w, http.StatusBadRequest, Error{fmt.Sprintf("bad request: unknown boot device %q", t.Device)})
+		return
+	}
+	err := setBootFlags(func(f *ipmi.BootFlags) {
+		f.Device, f.Persistent, f.EFI = d, t.Persistent, t.EFI
+	})
+	if err != nil {
+		reply(w, http.StatusInternalServerError, Error{err.Error()})
+		return
+	}
+	log.Printf("Agent: boot target %+v", t)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// KexecRequest asks for a kernel to be booted. Kernel and Initrd are
+// URLs, such as http or tftp, or paths.
+type KexecRequest struct {
+	Kernel  string `json:"kernel"`
+	Initrd  string `json:"initrd,omitempty"`
+	Cmdline string `json:"cmdline,omitempty"`
+}
+
+func fetch(ctx context.Context, s string) (io.ReaderAt, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" {
+		u.Scheme = "file"
+	}
+	return curl.Fetch(ctx, u)
+}
+
+func (a *Agent) kexec(w http.ResponseWriter, r *http.Request) {
+	var req KexecRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.Kernel == "" {
+		reply(w, http.StatusBadRequest, Error{"bad request: kexec needs a kernel"})
+		return
+	}
+	li := &boot.LinuxImage{Name: req.Kernel, Cmdline: req.Cmdline}
+	var err error
+	if li.Kernel, err = fetch(r.Context(), req.Kernel); err != nil {
+		reply(w, http.StatusBadRequest, Error{err.Error()})
+		return
+	}
+	if req.Initrd != "" {
+		if li.Initrd, err = fetch(r.Context(), req.Initrd); err != nil {
+			reply(w, http.StatusBadRequest, Error{err.Error()})
+			return
+		}
+	}
+	if err := kexecLoad(li); err != nil {
+		reply(w, http.StatusInternalServerError, Error{err.Error()})
+		return
+	}
+	log.Printf("Agent: booting %s %s", req.Kernel, req.Cmdline)
+	w.WriteHeader(http.StatusAccepted)
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+	time.AfterFunc(kexecDelay, func() {
+		log.Printf("Agent: kexec: %v", kexecReboot())
+	})
+}
@@ -0,0 +1,326 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/checker"
+	"github.com/u-root/u-root/pkg/installer"
+	"github.com/u-root/u-root/pkg/ipmi"
+)
+
+// call sends a request with a JSON body of in, if not nil, and decodes the
+// response into out, if not nil. It returns the status.
+func call(t *testing.T, srv *httptest.Server, token, method, path string, in, out interface{}) int {
+	t.Helper()
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, srv.URL+path, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAuthAndRoutes(t *testing.T) {
+	defer func(g func() *Inventory) { gatherInventory = g }(gatherInventory)
+	gatherInventory = func() *Inventory { return &Inventory{Hostname: "node1"} }
+
+	srv := httptest.NewServer(New("s3cret", nil))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		token, method, path string
+		want                int
+	}{
+		{"", http.MethodGet, "/v1/inventory", http.StatusUnauthorized},
+		{"wrong", http.MethodGet, "/v1/inventory", http.StatusUnauthorized},
+		{"s3cret", http.MethodGet, "/v1/nothing", http.StatusNotFound},
+		{"s3cret", http.MethodPost, "/v1/inventory", http.StatusMethodNotAllowed},
+		{"s3cret", http.MethodPost, "/v1/image", http.StatusBadRequest},
+	} {
+		var e Error
+		if got := call(t, srv, tt.token, tt.method, tt.path, nil, &e); got != tt.want || e.Error == "" {
+			t.Errorf("%s %s with token %q = %d, %q, want %d with an error", tt.method, tt.path, tt.token, got, e.Error, tt.want)
+		}
+	}
+
+	var inv Inventory
+	if got := call(t, srv, "s3cret", http.MethodGet, "/v1/inventory", nil, &inv); got != http.StatusOK || inv.Hostname != "node1" {
+		t.Errorf("GET /v1/inventory = %d, %+v", got, inv)
+	}
+
+	// Without a token, only TLS client certificates let the controller in.
+	plain := httptest.NewServer(New("", nil))
+	defer plain.Close()
+	if got := call(t, plain, "", http.MethodGet, "/v1/inventory", nil, nil); got != http.StatusUnauthorized {
+		t.Errorf("GET /v1/inventory without a client certificate = %d, want %d", got, http.StatusUnauthorized)
+	}
+}
+
+// clientCert returns a CA and a client certificate it signed.
+func clientCert(t *testing.T) (*x509.CertPool, tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "controller"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(c)
+	return pool, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestClientCertWithToken(t *testing.T) {
+	defer func(g func() *Inventory) { gatherInventory = g }(gatherInventory)
+	gatherInventory = func() *Inventory { return &Inventory{Hostname: "node1"} }
+
+	// As the agent command serves with both -token-file and -client-ca.
+	pool, cert := clientCert(t)
+	srv := httptest.NewUnstartedServer(New("s3cret", nil))
+	srv.TLS = &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}
+	srv.StartTLS()
+	defer srv.Close()
+
+	if got := call(t, srv, "", http.MethodGet, "/v1/inventory", nil, nil); got != http.StatusUnauthorized {
+		t.Errorf("GET /v1/inventory without a token or certificate = %d, want %d", got, http.StatusUnauthorized)
+	}
+	if got := call(t, srv, "s3cret", http.MethodGet, "/v1/inventory", nil, nil); got != http.StatusOK {
+		t.Errorf("GET /v1/inventory with the token = %d, want %d", got, http.StatusOK)
+	}
+	tr := srv.Client().Transport.(*http.Transport)
+	tr.CloseIdleConnections()
+	tr.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	if got := call(t, srv, "", http.MethodGet, "/v1/inventory", nil, nil); got != http.StatusOK {
+		t.Errorf("GET /v1/inventory with a client certificate = %d, want %d", got, http.StatusOK)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	var fixed bool
+	checks := []checker.Check{
+		{Name: "ok", Run: func() error { return nil }},
+		{
+			Name: "fixable",
+			Run: func() error {
+				if !fixed {
+					return errors.New("broken")
+				}
+				return nil
+			},
+			Remediate: func() error {
+				fixed = true
+				return nil
+			},
+		},
+		{Name: "broken", Run: func() error { return errors.New("no link") }, StopOnError: true},
+		{Name: "skipped", Run: func() error { return nil }},
+	}
+	srv := httptest.NewServer(New("t", checks))
+	defer srv.Close()
+
+	var rep HealthReport
+	if got := call(t, srv, "t", http.MethodPost, "/v1/health", nil, &rep); got != http.StatusOK {
+		t.Fatalf("POST /v1/health = %d", got)
+	}
+	want := HealthReport{Checks: []CheckResult{
+		{Name: "ok", OK: true},
+		{Name: "fixable", OK: true, Remediated: true},
+		{Name: "broken", Error: "no link"},
+	}}
+	if !reflect.DeepEqual(rep, want) {
+		t.Errorf("POST /v1/health = %+v, want %+v", rep, want)
+	}
+}
+
+func TestImage(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	src, dst := filepath.Join(tmp, "image"), filepath.Join(tmp, "disk")
+	image := bytes.Repeat([]byte("disk image"), 1000)
+	if err := ioutil.WriteFile(src, image, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(dst, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	srv := httptest.NewServer(New("t", nil))
+	defer srv.Close()
+
+	var res installer.Result
+	if got := call(t, srv, "t", http.MethodPost, "/v1/image", ImageRequest{Source: src, Target: dst, Verify: true}, &res); got != http.StatusOK {
+		t.Fatalf("POST /v1/image = %d", got)
+	}
+	if res.Size != int64(len(image)) || !res.Verified {
+		t.Errorf("POST /v1/image = %+v, want %d bytes verified", res, len(image))
+	}
+	if b, err := ioutil.ReadFile(dst); err != nil || !bytes.Equal(b, image) {
+		t.Errorf("disk holds %d bytes, %v, want the image", len(b), err)
+	}
+
+	var e Error
+	if got := call(t, srv, "t", http.MethodPost, "/v1/image", ImageRequest{Source: src, Target: dst, Checksum: strings.Repeat("0", 64)}, &e); got != http.StatusInternalServerError {
+		t.Errorf("POST /v1/image with a bad checksum = %d, %q", got, e.Error)
+	}
+}
+
+func TestBusy(t *testing.T) {
+	defer func(i func(context.Context, installer.Options) (*installer.Result, error)) { install = i }(install)
+	started, done := make(chan struct{}), make(chan struct{})
+	install = func(context.Context, installer.Options) (*installer.Result, error) {
+		close(started)
+		<-done
+		return &installer.Result{}, nil
+	}
+
+	srv := httptest.NewServer(New("t", nil))
+	defer srv.Close()
+
+	finished := make(chan int)
+	go func() {
+		finished <- call(t, srv, "t", http.MethodPost, "/v1/image", ImageRequest{Source: "a", Target: "b"}, nil)
+	}()
+	<-started
+	if got := call(t, srv, "t", http.MethodPut, "/v1/boot-target", BootTarget{Device: "pxe"}, nil); got != http.StatusConflict {
+		t.Errorf("PUT /v1/boot-target while writing an image = %d, want %d", got, http.StatusConflict)
+	}
+	close(done)
+	if got := <-finished; got != http.StatusOK {
+		t.Errorf("POST /v1/image = %d", got)
+	}
+}
+
+func TestBootTarget(t *testing.T) {
+	defer func(s func(func(*ipmi.BootFlags)) error) { setBootFlags = s }(setBootFlags)
+	flags := &ipmi.BootFlags{Device: ipmi.BootDeviceDisk, Persistent: true, Verbosity: 2}
+	setBootFlags = func(f func(*ipmi.BootFlags)) error {
+		f(flags)
+		return nil
+	}
+
+	srv := httptest.NewServer(New("t", nil))
+	defer srv.Close()
+
+	if got := call(t, srv, "t", http.MethodPut, "/v1/boot-target", BootTarget{Device: "pxe", EFI: true}, nil); got != http.StatusNoContent {
+		t.Fatalf("PUT /v1/boot-target = %d", got)
+	}
+	want := &ipmi.BootFlags{Device: ipmi.BootDevicePXE, EFI: true, Verbosity: 2}
+	if !reflect.DeepEqual(flags, want) {
+		t.Errorf("boot flags = %+v, want %+v", flags, want)
+	}
+	if got := call(t, srv, "t", http.MethodPut, "/v1/boot-target", BootTarget{Device: "tape"}, nil); got != http.StatusBadRequest {
+		t.Errorf("PUT /v1/boot-target to tape = %d, want %d", got, http.StatusBadRequest)
+	}
+	if got := call(t, srv, "t", http.MethodPut, "/v1/boot-target", map[string]string{"device": "pxe", "next": "yes"}, nil); got != http.StatusBadRequest {
+		t.Errorf("PUT /v1/boot-target with an unknown field = %d, want %d", got, http.StatusBadRequest)
+	}
+}
+
+func TestKexec(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	kernel := filepath.Join(tmp, "vmlinuz")
+	if err := ioutil.WriteFile(kernel, []byte("bzImage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(l func(*boot.LinuxImage) error, r func() error, d time.Duration) {
+		kexecLoad, kexecReboot, kexecDelay = l, r, d
+	}(kexecLoad, kexecReboot, kexecDelay)
+	var loaded *boot.LinuxImage
+	kexecLoad = func(li *boot.LinuxImage) error {
+		loaded = li
+		return nil
+	}
+	rebooted := make(chan struct{})
+	kexecReboot = func() error {
+		close(rebooted)
+		return nil
+	}
+	kexecDelay = 0
+
+	srv := httptest.NewServer(New("t", nil))
+	defer srv.Close()
+
+	if got := call(t, srv, "t", http.MethodPost, "/v1/kexec", KexecRequest{Kernel: filepath.Join(tmp, "missing")}, nil); got != http.StatusBadRequest {
+		t.Errorf("POST /v1/kexec of a missing kernel = %d, want %d", got, http.StatusBadRequest)
+	}
+	if got := call(t, srv, "t", http.MethodPost, "/v1/kexec", KexecRequest{Kernel: kernel, Cmdline: "console=ttyS0"}, nil); got != http.StatusAccepted {
+		t.Fatalf("POST /v1/kexec = %d", got)
+	}
+	select {
+	case <-rebooted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("POST /v1/kexec did not kexec")
+	}
+	if loaded == nil || loaded.Cmdline != "console=ttyS0" || loaded.Initrd != nil {
+		t.Fatalf("kexec loaded %v", loaded)
+	}
+	b := make([]byte, 7)
+	if _, err := loaded.Kernel.ReadAt(b, 0); err != nil || string(b) != "bzImage" {
+		t.Errorf("kexec loaded kernel %q, %v", b, err)
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/smbios"
+)
+
+// Interface is a network interface of the Inventory.
+type Interface struct {
+	Name  string   `json:"name"`
+	MAC   string   `json:"mac,omitempty"`
+	Up    bool     `json:"up"`
+	Addrs []string `json:"addrs,omitempty"`
+}
+
+// Disk is a whole disk of the Inventory, without its partitions.
+type Disk struct {
+	Name  string `json:"name"`
+	Size  uint64 `json:"size"`
+	Model string `json:"model,omitempty"`
+}
+
+// Inventory is what a machine is, as the controller needs to know it to
+// provision it.
+type Inventory struct {
+	Hostname string `json:"hostname"`
+	Kernel   string `json:"kernel"`
+
+	// Manufacturer, Product, Serial and UUID are those of SMBIOS.
+	Manufacturer string `json:"manufacturer,omitempty"`
+	Product      string `json:"product,omitempty"`
+	Serial       string `json:"serial,omitempty"`
+	UUID         string `json:"uuid,omitempty"`
+
+	CPUs   int    `json:"cpus"`
+	Memory uint64 `json:"memory"`
+
+	Interfaces []Interface `json:"interfaces"`
+	Disks      []Disk      `json:"disks"`
+
+	// Errors are what could not be found out, and why.
+	Errors []string `json:"errors,omitempty"`
+}
+
+// Where the inventory is read from.
+var (
+	procPath     = "/proc"
+	sysBlockPath = "/sys/block"
+	smbiosInfo   = smbios.FromSysfs
+	interfaces   = net.Interfaces
+)
+
+// GatherInventory returns the Inventory of this machine. What cannot be
+// found out is left out, with why in Errors.
+func GatherInventory() *Inventory {
+	inv := &Inventory{CPUs: runtime.NumCPU()}
+	fail := func(what string, err error) {
+		inv.Errors = append(inv.Errors, fmt.Sprintf("%s: %v", what, err))
+	}
+
+	var err error
+	if inv.Hostname, err = os.Hostname(); err != nil {
+		fail("hostname", err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(procPath, "sys/kernel/osrelease")); err != nil {
+		fail("kernel", err)
+	} else {
+		inv.Kernel = strings.TrimSpace(string(b))
+	}
+	if inv.Memory, err = memTotal(); err != nil {
+		fail("memory", err)
+	}
+
+	if info, err := smbiosInfo(); err != nil {
+		fail("SMBIOS", err)
+	} else if sys, err := info.GetSystemInfo(); err != nil {
+		fail("SMBIOS system information", err)
+	} else {
+		inv.Manufacturer = sys.Manufacturer
+		inv.Product = sys.ProductName
+		inv.Serial = sys.SerialNumber
+		inv.UUID = sys.UUID.String()
+	}
+
+	if inv.Interfaces, err = gatherInterfaces(); err != nil {
+		fail("interfaces", err)
+	}
+	if inv.Disks, err = gatherDisks(); err != nil {
+		fail("disks", err)
+	}
+	return inv
+}
+
+// memTotal returns MemTotal of /proc/meminfo, in bytes.
+func memTotal() (uint64, error) {
+	f, err := os.Open(filepath.Join(procPath, "meminfo"))
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 3 || fields[0] != "MemTotal:" || fields[2] != "kB" {
+			continue
+		}
+		kb, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("MemTotal: %v", err)
+		}
+		return kb << 10, nil
+	}
+	if err := s.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no MemTotal in meminfo")
+}
+
+func gatherInterfaces() ([]Interface, error) {
+	ifaces, err := interfaces()
+	if err != nil {
+		return nil, err
+	}
+	var is []Interface
+	for _, iface := range ifaces {
+		i := Interface{
+			Name: iface.Name,
+			MAC:  iface.HardwareAddr.String(),
+			Up:   iface.Flags&net.FlagUp != 0,
+		}
+		if addrs, err := iface.Addrs(); err == nil {
+			for _, a := range addrs {
+				i.Addrs = append(i.Addrs, a.String())
+			}
+		}
+		is = append(is, i)
+	}
+	return is, nil
+}
+
+// gatherDisks returns the disks of /sys/block, leaving out those of no
+// size such as empty CD drives, and loop and ram disks.
+func gatherDisks() ([]Disk, error) {
+	names, err := ioutil.ReadDir(sysBlockPath)
+	if err != nil {
+		return nil, err
+	}
+	var disks []Disk
+	for _, n := range names {
+		name := n.Name()
+		if strings.HasPrefix(name, "loop") || strings.HasPrefix(name, "ram") {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(sysBlockPath, name, "size"))
+		if err != nil {
+			continue
+		}
+		// size is in 512-byte sectors, whatever the disk's.
+		sectors, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+		if err != nil || sectors == 0 {
+			continue
+		}
+		d := Disk{Name: name, Size: sectors * 512}
+		if b, err := ioutil.ReadFile(filepath.Join(sysBlockPath, name, "device/model")); err == nil {
+			d.Model = strings.TrimSpace(string(b))
+		}
+		disks = append(disks, d)
+	}
+	sort.Slice(disks, func(i, j int) bool { return disks[i].Name < disks[j].Name })
+	return disks, nil
+}
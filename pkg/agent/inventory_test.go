@@ -0,0 +1,70 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package agent
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/smbios"
+)
+
+func TestGatherInventory(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "inventory")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	for name, content := range map[string]string{
+		"proc/sys/kernel/osrelease":  "5.8.0-u-root\n",
+		"proc/meminfo":               "MemFree:  1024 kB\nMemTotal:  16384 kB\n",
+		"block/sda/size":             "2048\n",
+		"block/sda/device/model":     "QEMU HARDDISK   \n",
+		"block/sr0/size":             "0\n",
+		"block/loop0/size":           "8\n",
+		"block/nvme0n1/size":         "4096\n",
+		"block/nvme0n1/device/dummy": "",
+	} {
+		p := filepath.Join(tmp, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(p, b string, s func() (*smbios.Info, error), i func() ([]net.Interface, error)) {
+		procPath, sysBlockPath, smbiosInfo, interfaces = p, b, s, i
+	}(procPath, sysBlockPath, smbiosInfo, interfaces)
+	procPath, sysBlockPath = filepath.Join(tmp, "proc"), filepath.Join(tmp, "block")
+	smbiosInfo = func() (*smbios.Info, error) { return nil, errors.New("no SMBIOS") }
+	interfaces = func() ([]net.Interface, error) {
+		return []net.Interface{{Name: "eth0", HardwareAddr: net.HardwareAddr{0, 1, 2, 3, 4, 5}, Flags: net.FlagUp}}, nil
+	}
+
+	inv := GatherInventory()
+	if inv.Kernel != "5.8.0-u-root" || inv.Memory != 16<<20 {
+		t.Errorf("kernel %q, memory %d, want 5.8.0-u-root, %d", inv.Kernel, inv.Memory, 16<<20)
+	}
+	wantDisks := []Disk{
+		{Name: "nvme0n1", Size: 4096 * 512},
+		{Name: "sda", Size: 2048 * 512, Model: "QEMU HARDDISK"},
+	}
+	if !reflect.DeepEqual(inv.Disks, wantDisks) {
+		t.Errorf("disks = %+v, want %+v", inv.Disks, wantDisks)
+	}
+	if len(inv.Interfaces) != 1 || inv.Interfaces[0].MAC != "00:01:02:03:04:05" || !inv.Interfaces[0].Up {
+		t.Errorf("interfaces = %+v", inv.Interfaces)
+	}
+	if want := []string{"SMBIOS: no SMBIOS"}; !reflect.DeepEqual(inv.Errors, want) {
+		t.Errorf("errors = %q, want %q", inv.Errors, want)
+	}
+}
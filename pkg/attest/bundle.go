@@ -0,0 +1,224 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package attest gathers attestation evidence into a bundle that can be
+// verified offline, where no attestation service is reachable at boot.
+//
+// A bundle is a gzipped tar of evidence files, followed by a manifest of
+// their SHA256 digests in sha256sum format and, if signed, the ed25519
+// signature of the manifest.
+package attest
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ed25519"
+)
+
+// Names of the files a bundle adds itself.
+const (
+	ManifestFile  = "MANIFEST"
+	SignatureFile = "MANIFEST.sig"
+)
+
+// ErrUnsigned is returned when verifying a bundle without a signature.
+var ErrUnsigned = errors.New("bundle is not signed")
+
+type file struct {
+	name string
+	data []byte
+}
+
+// Bundle is a set of evidence files, in the order they were added.
+type Bundle struct {
+	// Time is the modification time of the files in the tar.
+	Time time.Time
+
+	files     []file
+	manifest  []byte
+	signature []byte
+}
+
+// Add adds a file of evidence to b, replacing any of the same name.
+func (b *Bundle) Add(name string, data []byte) error {
+	if name == "" || name == ManifestFile || name == SignatureFile || strings.ContainsAny(name, " \n") {
+		return fmt.Errorf("invalid evidence file name %q", name)
+	}
+	for i := range b.files {
+		if b.files[i].name == name {
+			b.files[i].data = data
+			return nil
+		}
+	}
+	b.files = append(b.files, file{name, data})
+	return nil
+}
+
+// File returns the file name of b.
+func (b *Bundle) File(name string) ([]byte, bool) {
+	for _, f := range b.files {
+		if f.name == name {
+			return f.data, true
+		}
+	}
+	return nil, false
+}
+
+// Files returns the names of the files of b.
+func (b *Bundle) Files() []string {
+	var names []string
+	for _, f := range b.files {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+// Manifest returns the manifest of b, a line with the SHA256 digest and name
+// of each file, as sha256sum prints them.
+func (b *Bundle) Manifest() []byte {
+	var m bytes.Buffer
+	for _, f := range b.files {
+		fmt.Fprintf(&m, "%x  %s\n", sha256.Sum256(f.data), f.name)
+	}
+	return m.Bytes()
+}
+
+// Write writes b to w, with the manifest signed by key unless key is nil.
+func (b *Bundle) Write(w io.Writer, key ed25519.PrivateKey) error {
+	manifest := b.Manifest()
+	files := append(append([]file(nil), b.files...), file{ManifestFile, manifest})
+	if key != nil {
+		files = append(files, file{SignatureFile, ed25519.Sign(key, manifest)})
+	}
+
+	z := gzip.NewWriter(w)
+	t := tar.NewWriter(z)
+	for _, f := range files {
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     f.name,
+			Mode:     0444,
+			Size:     int64(len(f.data)),
+			ModTime:  b.Time,
+			Format:   tar.FormatPAX,
+		}
+		if err := t.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := t.Write(f.data); err != nil {
+			return err
+		}
+	}
+	if err := t.Close(); err != nil {
+		return err
+	}
+	return z.Close()
+}
+
+// Read reads a bundle written by Write. The bundle is not verified.
+func Read(r io.Reader) (*Bundle, error) {
+	z, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	b := &Bundle{}
+	t := tar.NewReader(z)
+	for {
+		hdr, err := t.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("%s: not a regular file", hdr.Name)
+		}
+		data, err := ioutil.ReadAll(t)
+		if err != nil {
+			return nil, err
+		}
+		switch hdr.Name {
+		case ManifestFile:
+			b.manifest = data
+		case SignatureFile:
+			b.signature = data
+		default:
+			if _, ok := b.File(hdr.Name); ok {
+				return nil, fmt.Errorf("%s: duplicate file", hdr.Name)
+			}
+			if err := b.Add(hdr.Name, data); err != nil {
+				return nil, err
+			}
+		}
+		b.Time = hdr.ModTime
+	}
+	if b.manifest == nil {
+		return nil, fmt.Errorf("bundle has no %s", ManifestFile)
+	}
+	return b, nil
+}
+
+// Check checks that the files of b, as read, are those of its manifest.
+func (b *Bundle) Check() error {
+	want := make(map[string]string)
+	s := bufio.NewScanner(bytes.NewReader(b.manifest))
+	for s.Scan() {
+		f := strings.SplitN(s.Text(), "  ", 2)
+		if len(f) != 2 {
+			return fmt.Errorf("invalid manifest line %q", s.Text())
+		}
+		if _, ok := want[f[1]]; ok {
+			return fmt.Errorf("manifest lists %s twice", f[1])
+		}
+		want[f[1]] = f[0]
+	}
+	for _, f := range b.files {
+		digest, ok := want[f.name]
+		if !ok {
+			return fmt.Errorf("%s is not in the manifest", f.name)
+		}
+		if got := fmt.Sprintf("%x", sha256.Sum256(f.data)); got != digest {
+			return fmt.Errorf("%s has digest %s, the manifest says %s", f.name, got, digest)
+		}
+		delete(want, f.name)
+	}
+	for name := range want {
+		return fmt.Errorf("%s of the manifest is missing", name)
+	}
+	return nil
+}
+
+// Signed returns whether b, as read, is signed.
+func (b *Bundle) Signed() bool {
+	return b.signature != nil
+}
+
+// Verify checks b and that pub signed its manifest. If b is not signed, it
+// returns ErrUnsigned once b checks.
+func (b *Bundle) Verify(pub ed25519.PublicKey) error {
+	if err := b.Check(); err != nil {
+		return err
+	}
+	if b.signature == nil {
+		return ErrUnsigned
+	}
+	if len(pub) != ed25519.PublicKeySize {
+		return fmt.Errorf("public key is %d bytes, not %d", len(pub), ed25519.PublicKeySize)
+	}
+	if !ed25519.Verify(pub, b.manifest, b.signature) {
+		return errors.New("manifest signature does not verify")
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package attest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/google/go-tpm/tpmutil"
+	"github.com/u-root/u-root/pkg/tss"
+	"golang.org/x/crypto/ed25519"
+)
+
+func roundTrip(t *testing.T, b *Bundle, key ed25519.PrivateKey) *Bundle {
+	var buf bytes.Buffer
+	if err := b.Write(&buf, key); err != nil {
+		t.Fatal(err)
+	}
+	r, err := Read(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestBundle(t *testing.T) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := &Bundle{}
+	for _, f := range []file{{EventLogFile, []byte("log")}, {AuditDir + "cmdline", []byte("console=ttyS0\n")}, {EventLogFile, []byte("event log")}} {
+		if err := b.Add(f.name, f.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.Add(ManifestFile, nil); err == nil {
+		t.Errorf("Add(%s) did not fail", ManifestFile)
+	}
+	want := fmt.Sprintf("%x  eventlog\n%x  audit/cmdline\n", sha256.Sum256([]byte("event log")), sha256.Sum256([]byte("console=ttyS0\n")))
+	if got := string(b.Manifest()); got != want {
+		t.Errorf("Manifest = %q, want %q", got, want)
+	}
+
+	r := roundTrip(t, b, key)
+	if !reflect.DeepEqual(r.Files(), b.Files()) {
+		t.Errorf("read files %q, want %q", r.Files(), b.Files())
+	}
+	if data, _ := r.File(EventLogFile); string(data) != "event log" {
+		t.Errorf("read %s = %q, want the last one added", EventLogFile, data)
+	}
+	if err := r.Verify(pub); err != nil {
+		t.Errorf("Verify = %v", err)
+	}
+	if err := r.Verify(other); err == nil {
+		t.Error("Verify with another key did not fail")
+	}
+	r.Add(EventLogFile, []byte("another log"))
+	if err := r.Verify(pub); err == nil || !strings.Contains(err.Error(), "eventlog has digest") {
+		t.Errorf("Verify of a changed file = %v", err)
+	}
+	r.Add("extra", nil)
+	r.files[0].data = []byte("event log")
+	if err := r.Verify(pub); err == nil || err.Error() != "extra is not in the manifest" {
+		t.Errorf("Verify of an added file = %v", err)
+	}
+
+	if err := roundTrip(t, b, nil).Verify(pub); err != ErrUnsigned {
+		t.Errorf("Verify of an unsigned bundle = %v, want %v", err, ErrUnsigned)
+	}
+}
+
+// fakeQuote quotes pcrs over nonce as a TPM would, with the ECDSA key ak.
+func fakeQuote(t *testing.T, ak *ecdsa.PrivateKey, nonce []byte, pcrs []tss.PCR) *tss.Quote {
+	pub := tpm2.Public{
+		Type:       tpm2.AlgECC,
+		NameAlg:    tpm2.AlgSHA256,
+		Attributes: tpm2.FlagSignerDefault,
+		ECCParameters: &tpm2.ECCParams{
+			Sign:    &tpm2.SigScheme{Alg: tpm2.AlgECDSA, Hash: tpm2.AlgSHA256},
+			CurveID: tpm2.CurveNISTP256,
+			Point:   tpm2.ECPoint{XRaw: ak.X.Bytes(), YRaw: ak.Y.Bytes()},
+		},
+	}
+	akPub, err := pub.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := sha256.New()
+	var sel [3]byte
+	for _, p := range pcrs {
+		h.Write(p.Digest)
+		sel[p.Index/8] |= 1 << uint(p.Index%8)
+	}
+	attest, err := tpmutil.Pack(uint32(0xff544347), tpm2.TagAttestQuote,
+		tpmutil.U16Bytes(append([]byte{0, byte(tpm2.AlgSHA256)}, make([]byte, 32)...)), tpmutil.U16Bytes(nonce), tpm2.ClockInfo{}, uint64(0),
+		uint32(1), tpm2.AlgSHA256, byte(3), sel, tpmutil.U16Bytes(h.Sum(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	digest := sha256.Sum256(attest)
+	r, s, err := ecdsa.Sign(rand.Reader, ak, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := tpmutil.Pack(tpm2.AlgECDSA, tpm2.AlgSHA256, tpmutil.U16Bytes(r.Bytes()), tpmutil.U16Bytes(s.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tss.Quote{Attest: attest, Signature: sig, AK: akPub}
+}
+
+func TestQuote(t *testing.T) {
+	ak, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pcrs := []tss.PCR{{Index: 0, Digest: bytes.Repeat([]byte{1}, 32)}, {Index: 7, Digest: bytes.Repeat([]byte{7}, 32)}}
+
+	b := &Bundle{}
+	b.Add(NonceFile, []byte("fresh"))
+	if err := b.AddPCRs(tss.HashSHA256, pcrs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.VerifyQuote(tss.HashSHA256); err != ErrNoQuote {
+		t.Errorf("VerifyQuote without a quote = %v, want %v", err, ErrNoQuote)
+	}
+	nonce := b.QuoteNonce()
+	q := fakeQuote(t, ak, nonce, pcrs)
+	b.Add(quoteAttestFile, q.Attest)
+	b.Add(quoteSignatureFile, q.Signature)
+	b.Add(quoteAKFile, q.AK)
+	if !bytes.Equal(b.QuoteNonce(), nonce) {
+		t.Error("QuoteNonce changed with the quote added")
+	}
+
+	r := roundTrip(t, b, nil)
+	got, err := r.PCRs(tss.HashSHA256)
+	if err != nil || !reflect.DeepEqual(got, pcrs) {
+		t.Errorf("PCRs = %v, %v, want %v", got, err, pcrs)
+	}
+	if _, err := r.VerifyQuote(tss.HashSHA256); err != nil {
+		t.Errorf("VerifyQuote = %v", err)
+	}
+
+	r.Add(NonceFile, []byte("stale"))
+	if _, err := r.VerifyQuote(tss.HashSHA256); err == nil || !strings.HasPrefix(err.Error(), "quote nonce is") {
+		t.Errorf("VerifyQuote with another nonce = %v", err)
+	}
+	r.Add(NonceFile, []byte("fresh"))
+	r.AddPCRs(tss.HashSHA256, []tss.PCR{pcrs[0], {Index: 7, Digest: make([]byte, 32)}})
+	if _, err := r.VerifyQuote(tss.HashSHA256); err == nil {
+		t.Error("VerifyQuote with other PCRs did not fail")
+	}
+	if _, err := q.Verify(nonce, pcrs[:1]); err == nil || err.Error() != "1 of the 2 quoted PCRs are missing" {
+		t.Errorf("Verify without PCR 7 = %v", err)
+	}
+	q.Attest[len(q.Attest)-1] ^= 1
+	if _, err := q.Verify(nonce, pcrs); err == nil || err.Error() != "quote signature does not verify" {
+		t.Errorf("Verify of a changed quote = %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package attest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/google/go-tpm/tpm2"
+	"github.com/u-root/u-root/pkg/smbios"
+	"github.com/u-root/u-root/pkg/tss"
+)
+
+// Names of the evidence files.
+const (
+	// NonceFile is the verifier's nonce, if it gave one.
+	NonceFile = "nonce"
+	// EventLogFile is the TPM event log.
+	EventLogFile = "eventlog"
+	// SMBIOSEntryFile and SMBIOSFile are the SMBIOS tables, and
+	// IdentityFile what they say the system is.
+	SMBIOSEntryFile = "smbios/smbios_entry_point"
+	SMBIOSFile      = "smbios/DMI"
+	IdentityFile    = "identity"
+	// AuditDir holds the boot audit trail: the kernel command line, boot
+	// reports and the like.
+	AuditDir = "audit/"
+	// QuoteDir holds the quote, see AddQuote.
+	QuoteDir = "quote/"
+
+	quoteAttestFile    = QuoteDir + "attest"
+	quoteSignatureFile = QuoteDir + "signature"
+	quoteAKFile        = QuoteDir + "ak"
+)
+
+// ErrNoQuote is returned when verifying the quote of a bundle without one.
+var ErrNoQuote = errors.New("bundle has no quote")
+
+// PCRFile returns the name of the file of the PCRs of bank alg.
+func PCRFile(alg tss.HashAlg) string {
+	return "pcrs/" + strings.ToLower(alg.String())
+}
+
+// AddPCRs adds pcrs, of bank alg, a line with the index and digest of each.
+func (b *Bundle) AddPCRs(alg tss.HashAlg, pcrs []tss.PCR) error {
+	var buf bytes.Buffer
+	for _, p := range pcrs {
+		fmt.Fprintf(&buf, "%d %x\n", p.Index, p.Digest)
+	}
+	return b.Add(PCRFile(alg), buf.Bytes())
+}
+
+// PCRs returns the PCRs of bank alg.
+func (b *Bundle) PCRs(alg tss.HashAlg) ([]tss.PCR, error) {
+	name := PCRFile(alg)
+	data, ok := b.File(name)
+	if !ok {
+		return nil, fmt.Errorf("bundle has no %s", name)
+	}
+	var pcrs []tss.PCR
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		f := strings.Fields(s.Text())
+		if len(f) != 2 {
+			return nil, fmt.Errorf("%s: invalid line %q", name, s.Text())
+		}
+		i, err := strconv.Atoi(f[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		d, err := hex.DecodeString(f[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		pcrs = append(pcrs, tss.PCR{Index: i, Digest: d})
+	}
+	return pcrs, nil
+}
+
+// AddSMBIOS adds the SMBIOS tables of dir, as /sys/firmware/dmi/tables has
+// them, and the identity of the system they give.
+func (b *Bundle) AddSMBIOS(dir string) error {
+	entry, err := ioutil.ReadFile(filepath.Join(dir, "smbios_entry_point"))
+	if err != nil {
+		return err
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "DMI"))
+	if err != nil {
+		return err
+	}
+	info, err := smbios.ParseInfo(entry, data)
+	if err != nil {
+		return err
+	}
+	var id bytes.Buffer
+	if si, err := info.GetSystemInfo(); err == nil {
+		fmt.Fprintf(&id, "%s\n\n", si)
+	}
+	if bbs, err := info.GetBaseboardInfo(); err == nil {
+		for _, bb := range bbs {
+			fmt.Fprintf(&id, "%s\n\n", bb)
+		}
+	}
+	if id.Len() == 0 {
+		return errors.New("SMBIOS tables have no system or baseboard information")
+	}
+	if err := b.Add(SMBIOSEntryFile, entry); err != nil {
+		return err
+	}
+	if err := b.Add(SMBIOSFile, data); err != nil {
+		return err
+	}
+	return b.Add(IdentityFile, id.Bytes())
+}
+
+// QuoteNonce returns the qualifying data of the quote of b: the SHA256
+// digest of the manifest of the other files, so the quote vouches for
+// them all, the verifier's nonce among them.
+func (b *Bundle) QuoteNonce() []byte {
+	other := &Bundle{}
+	for _, f := range b.files {
+		if !strings.HasPrefix(f.name, QuoteDir) {
+			other.files = append(other.files, f)
+		}
+	}
+	sum := sha256.Sum256(other.Manifest())
+	return sum[:]
+}
+
+// AddQuote adds a quote by t of the PCRs of bank alg that b has, over the
+// QuoteNonce of b. Add all other evidence first.
+func (b *Bundle) AddQuote(t *tss.TPM, alg tss.HashAlg) error {
+	pcrs, err := b.PCRs(alg)
+	if err != nil {
+		return err
+	}
+	var sel []int
+	for _, p := range pcrs {
+		sel = append(sel, p.Index)
+	}
+	q, err := t.Quote(b.QuoteNonce(), alg, sel)
+	if err != nil {
+		return err
+	}
+	if err := b.Add(quoteAttestFile, q.Attest); err != nil {
+		return err
+	}
+	if err := b.Add(quoteSignatureFile, q.Signature); err != nil {
+		return err
+	}
+	return b.Add(quoteAKFile, q.AK)
+}
+
+// Quote returns the quote of b.
+func (b *Bundle) Quote() (*tss.Quote, error) {
+	var q tss.Quote
+	var ok [3]bool
+	q.Attest, ok[0] = b.File(quoteAttestFile)
+	q.Signature, ok[1] = b.File(quoteSignatureFile)
+	q.AK, ok[2] = b.File(quoteAKFile)
+	if ok != [3]bool{true, true, true} {
+		return nil, ErrNoQuote
+	}
+	return &q, nil
+}
+
+// VerifyQuote checks that the quote of b is of its PCRs of bank alg, over
+// its QuoteNonce. That the AK is a TPM's, and one the verifier trusts, is
+// up to the verifier.
+func (b *Bundle) VerifyQuote(alg tss.HashAlg) (*tpm2.AttestationData, error) {
+	q, err := b.Quote()
+	if err != nil {
+		return nil, err
+	}
+	pcrs, err := b.PCRs(alg)
+	if err != nil {
+		return nil, err
+	}
+	return q.Verify(b.QuoteNonce(), pcrs)
+}
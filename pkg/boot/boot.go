@@ -8,8 +8,10 @@ package boot
 
 import (
 	"fmt"
+	"log"
 
 	"github.com/u-root/u-root/pkg/boot/kexec"
+	"github.com/u-root/u-root/pkg/mount/scratch"
 )
 
 // OSImage represents a bootable OS package.
@@ -24,13 +26,21 @@ type OSImage interface {
 	// Load loads the OS image into kernel memory, ready for execution.
 	//
 	// After Load is called, call boot.Execute() to stop Linux and boot the
-	// loaded OSImage.
+	// loaded OSImage. Callers that do not go on to anything else if that
+	// fails should bring storage to a consistent state first, with package
+	// quiesce; Execute does not.
 	Load(verbose bool) error
 }
 
 // Execute executes a previously loaded OSImage.
 //
 // This will only work if OSImage.Load was called on some OSImage.
+//
+// Scratch spaces are released first. File systems are left mounted, so a
+// caller can still try something else if kexec fails.
 func Execute() error {
+	if err := scratch.ReleaseAll(); err != nil {
+		log.Print(err)
+	}
 	return kexec.Reboot()
 }
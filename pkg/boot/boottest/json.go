@@ -84,6 +84,9 @@ func ImagesToJSONLike(imgs []boot.OSImage) []interface{} {
 		if m, ok := img.(*boot.MultibootImage); ok {
 			infs = append(infs, MultibootImageToJSON(m))
 		}
+		if c, ok := img.(*boot.ChainImage); ok {
+			infs = append(infs, ChainImageToJSON(c))
+		}
 	}
 	return infs
 }
@@ -129,3 +132,23 @@ func MultibootImageToJSON(mi *boot.MultibootImage) map[string]interface{} {
 	m["modules"] = modules
 	return m
 }
+
+// ChainImageToJSON is implemented only in order to compare ChainImages in
+// tests.
+//
+// It should be json-encodable and decodable.
+func ChainImageToJSON(ci *boot.ChainImage) map[string]interface{} {
+	m := make(map[string]interface{})
+	m["image_type"] = "chain"
+	m["name"] = ci.Name
+	// JSON numbers decode as float64.
+	m["disk"] = float64(ci.Disk)
+	m["partition"] = float64(ci.Partition)
+	if len(ci.PartLabel) > 0 {
+		m["label"] = ci.PartLabel
+	}
+	if len(ci.PartGUID) > 0 {
+		m["guid"] = ci.PartGUID
+	}
+	return m
+}
@@ -26,7 +26,7 @@ func mustReadAll(r io.ReaderAt) string {
 // SameBootImage compares the contents of given boot images, but not the
 // underlying URLs.
 //
-// Works for Linux and Multiboot images.
+// Works for Linux, Multiboot and chain images.
 func SameBootImage(got, want boot.OSImage) error {
 	if got.Label() != want.Label() {
 		return fmt.Errorf("got image label %s, want %s", got.Label(), want.Label())
@@ -91,5 +91,17 @@ func SameBootImage(got, want boot.OSImage) error {
 		return nil
 	}
 
+	if gotChain, ok := got.(*boot.ChainImage); ok {
+		wantChain, ok := want.(*boot.ChainImage)
+		if !ok {
+			return fmt.Errorf("got image %s is chain image, but %s is not", got, want)
+		}
+		if gotChain.Disk != wantChain.Disk || gotChain.Partition != wantChain.Partition ||
+			gotChain.PartLabel != wantChain.PartLabel || gotChain.PartGUID != wantChain.PartGUID {
+			return fmt.Errorf("got chain image %s, want %s", got, want)
+		}
+		return nil
+	}
+
 	return fmt.Errorf("image not supported")
 }
@@ -0,0 +1,95 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ChainImage boots whatever is installed on a local disk instead of a
+// kernel of its own. It is what syslinux's LOCALBOOT directive and
+// chain.c32 entries ask for, e.g. PXE menus that fall back to the local
+// disk.
+//
+// We cannot run a disk's boot sector, so loading a ChainImage means
+// looking for boot configs on the selected disk or partition and loading
+// the first OS found there. That is done by ChainLoader.
+type ChainImage struct {
+	Name string
+
+	// Disk is the index of the disk to boot, as in chain.c32's "hd0", or
+	// -1 for any local disk.
+	Disk int
+
+	// Partition is the partition number on Disk, starting at 1, or 0 for
+	// any partition.
+	Partition int
+
+	// PartLabel and PartGUID select a GPT partition by name or unique
+	// GUID on any disk, as chain.c32's "label=" and "guid=" do.
+	PartLabel string
+	PartGUID  string
+
+	loaded OSImage
+}
+
+var _ OSImage = &ChainImage{}
+
+// ChainLoader finds the OS a ChainImage refers to.
+//
+// It is set by pkg/boot/localboot, which callers that want ChainImages to
+// work must import.
+var ChainLoader func(c *ChainImage) (OSImage, error)
+
+// Label returns either Name or a short description.
+func (c *ChainImage) Label() string {
+	if len(c.Name) > 0 {
+		return c.Name
+	}
+	return fmt.Sprintf("Chain(%s)", c.target())
+}
+
+func (c *ChainImage) target() string {
+	var t []string
+	if c.Disk >= 0 {
+		t = append(t, fmt.Sprintf("hd%d", c.Disk))
+	}
+	if c.Partition > 0 {
+		t = append(t, fmt.Sprintf("partition %d", c.Partition))
+	}
+	if len(c.PartLabel) > 0 {
+		t = append(t, "label="+c.PartLabel)
+	}
+	if len(c.PartGUID) > 0 {
+		t = append(t, "guid="+c.PartGUID)
+	}
+	if len(t) == 0 {
+		return "local disk"
+	}
+	return strings.Join(t, " ")
+}
+
+// Load implements OSImage.Load by loading the OS found by ChainLoader.
+func (c *ChainImage) Load(verbose bool) error {
+	if ChainLoader == nil {
+		return errors.New("chain loading local disks is not supported by this binary")
+	}
+	img, err := ChainLoader(c)
+	if err != nil {
+		return fmt.Errorf("no OS on %s: %v", c.target(), err)
+	}
+	c.loaded = img
+	return img.Load(verbose)
+}
+
+// String implements fmt.Stringer.
+func (c *ChainImage) String() string {
+	if c.loaded != nil {
+		return fmt.Sprintf("ChainImage(\n  Name: %s\n  Target: %s\n  Loaded: %s\n)", c.Name, c.target(), c.loaded)
+	}
+	return fmt.Sprintf("ChainImage(\n  Name: %s\n  Target: %s\n)", c.Name, c.target())
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package boot
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoConfig is returned by config parsers that found no config to parse.
+var ErrNoConfig = errors.New("no config found")
+
+// ConfigError is an error at a line of a boot loader config file. Line is
+// 0 if the error is not about one line.
+type ConfigError struct {
+	File string
+	Line int
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	if e.Line == 0 {
+		return fmt.Sprintf("%s: %v", e.File, e.Err)
+	}
+	return fmt.Sprintf("%s:%d: %v", e.File, e.Line, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigErrors are errors config parsers recovered from by skipping a
+// directive or entry. Parsers return them along with the images they
+// could still find.
+type ConfigErrors []*ConfigError
+
+func (e ConfigErrors) Error() string {
+	s := make([]string, 0, len(e))
+	for _, err := range e {
+		s = append(s, err.Error())
+	}
+	return strings.Join(s, "; ")
+}
+
+// Err returns e as an error, or nil if there are no errors.
+func (e ConfigErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,219 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package deadline takes a fallback action when no OS has been booted in
+// time, so that a machine in a lights-out datacenter does not sit at a
+// boot menu or shell forever.
+//
+// Booting an OS kexecs away the process that started the deadline, and
+// with it the deadline, so there is nothing to do on success.
+package deadline
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/u-root/u-root/pkg/boot/kexec"
+	"github.com/u-root/u-root/pkg/cmdline"
+	"github.com/u-root/u-root/pkg/ipmi"
+	"github.com/u-root/u-root/pkg/shlex"
+	"github.com/u-root/u-root/pkg/shutdown"
+)
+
+// Kind is what an Action does.
+type Kind string
+
+// Kinds of actions.
+const (
+	// Reboot reboots the machine.
+	Reboot Kind = "reboot"
+	// PowerCycle has the BMC power cycle the machine, to reset what a
+	// reboot does not, such as hung devices.
+	PowerCycle Kind = "powercycle"
+	// Recovery kexecs into a recovery image.
+	Recovery Kind = "recovery"
+	// Shell starts a command, by default sshd, for an operator to log
+	// in remotely.
+	Shell Kind = "shell"
+)
+
+// Action is what to do when the deadline passes.
+type Action struct {
+	Kind Kind
+	// Args are the kernel, optional initramfs and command line of
+	// Recovery, and the command of Shell.
+	Args []string
+}
+
+func (a Action) String() string {
+	return strings.TrimSpace(string(a.Kind) + " " + strings.Join(a.Args, " "))
+}
+
+// ParseAction parses an action of one of the forms
+//
+//     reboot
+//     powercycle
+//     recovery KERNEL [INITRD [CMDLINE...]]
+//     shell [COMMAND [ARGS...]]
+//
+// with words split as a shell would.
+func ParseAction(s string) (Action, error) {
+	argv := shlex.Argv(s)
+	if len(argv) == 0 {
+		return Action{}, fmt.Errorf("no action")
+	}
+	a := Action{Kind: Kind(argv[0]), Args: argv[1:]}
+	switch a.Kind {
+	case Reboot, PowerCycle:
+		if len(a.Args) != 0 {
+			return Action{}, fmt.Errorf("%s takes no arguments", a.Kind)
+		}
+	case Recovery:
+		if len(a.Args) == 0 {
+			return Action{}, fmt.Errorf("recovery needs a kernel")
+		}
+	case Shell:
+		if len(a.Args) == 0 {
+			a.Args = []string{"sshd"}
+		}
+	default:
+		return Action{}, fmt.Errorf("unknown action %q, want reboot, powercycle, recovery or shell", a.Kind)
+	}
+	return a, nil
+}
+
+var (
+	reboot = shutdown.Reboot
+
+	// powerCycle has the BMC power cycle the machine, for hangs that a
+	// reboot does not get out of.
+	powerCycle = func() error {
+		i, err := ipmi.Open(0)
+		if err != nil {
+			return err
+		}
+		defer i.Close()
+		return i.ChassisControl(ipmi.ChassisPowerCycle)
+	}
+	kexecLoad   = kexec.FileLoad
+	kexecReboot = kexec.Reboot
+	command     = exec.Command
+)
+
+// Do takes the action. Shell returns once the command has started.
+func (a Action) Do() error {
+	switch a.Kind {
+	case Reboot:
+		return reboot()
+	case PowerCycle:
+		return powerCycle()
+	case Recovery:
+		return a.recover()
+	case Shell:
+		c := command(a.Args[0], a.Args[1:]...)
+		c.Stdout, c.Stderr = os.Stdout, os.Stderr
+		return c.Start()
+	}
+	return fmt.Errorf("unknown action %q", a.Kind)
+}
+
+func (a Action) recover() error {
+	kernel, err := os.Open(a.Args[0])
+	if err != nil {
+		return err
+	}
+	defer kernel.Close()
+	var initrd *os.File
+	if len(a.Args) > 1 {
+		if initrd, err = os.Open(a.Args[1]); err != nil {
+			return err
+		}
+		defer initrd.Close()
+	}
+	var args string
+	if len(a.Args) > 2 {
+		args = strings.Join(a.Args[2:], " ")
+	}
+	if err := kexecLoad(kernel, initrd, args); err != nil {
+		return err
+	}
+	return kexecReboot()
+}
+
+// Start takes action once d has passed, unless stop is called first. If
+// the action fails, and it is not Shell, it reboots as a last resort.
+func Start(d time.Duration, a Action) (stop func()) {
+	log.Printf("Boot deadline: %s in %v unless an OS is booted", a, d)
+	t := time.AfterFunc(d, func() {
+		log.Printf("Boot deadline of %v passed: %s", d, a)
+		err := a.Do()
+		switch {
+		case err == nil:
+		case a.Kind == Shell || a.Kind == Reboot:
+			log.Printf("Boot deadline: %s: %v", a, err)
+		default:
+			log.Printf("Boot deadline: %s: %v; rebooting", a, err)
+			log.Printf("Boot deadline: reboot: %v", reboot())
+		}
+	})
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			if t.Stop() {
+				log.Printf("Boot deadline stopped")
+			}
+		})
+	}
+}
+
+// ParseDuration parses a deadline: a number of minutes, or a duration
+// such as 90s or 1h30m.
+func ParseDuration(s string) (time.Duration, error) {
+	if m, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return time.Duration(m) * time.Minute, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("deadline %q is neither minutes nor a duration", s)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("deadline %q is negative", s)
+	}
+	return d, nil
+}
+
+// FromCmdline returns the deadline and action of the kernel command line:
+//
+//     uroot.bootdeadline=MINUTES|DURATION
+//     uroot.bootdeadline_action=ACTION
+//
+// with ACTION as ParseAction takes it, reboot by default. A deadline of
+// 0, or none, is no deadline.
+func FromCmdline() (time.Duration, Action, error) {
+	return fromFlags(cmdline.Flag)
+}
+
+func fromFlags(flag func(string) (string, bool)) (time.Duration, Action, error) {
+	s, ok := flag("uroot.bootdeadline")
+	if !ok {
+		return 0, Action{}, nil
+	}
+	d, err := ParseDuration(s)
+	if err != nil {
+		return 0, Action{}, err
+	}
+	a := Action{Kind: Reboot}
+	if s, ok := flag("uroot.bootdeadline_action"); ok {
+		if a, err = ParseAction(s); err != nil {
+			return 0, Action{}, err
+		}
+	}
+	return d, a, nil
+}
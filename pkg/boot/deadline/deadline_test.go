@@ -0,0 +1,134 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package deadline
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseAction(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want Action
+		err  bool
+	}{
+		{in: "reboot", want: Action{Kind: Reboot, Args: []string{}}},
+		{in: "powercycle", want: Action{Kind: PowerCycle, Args: []string{}}},
+		{in: `recovery /boot/rescue /boot/rescue.cpio "console=ttyS0 quiet"`, want: Action{Kind: Recovery, Args: []string{"/boot/rescue", "/boot/rescue.cpio", "console=ttyS0 quiet"}}},
+		{in: "shell", want: Action{Kind: Shell, Args: []string{"sshd"}}},
+		{in: "shell cpud -remote", want: Action{Kind: Shell, Args: []string{"cpud", "-remote"}}},
+		{in: "", err: true},
+		{in: "reboot now", err: true},
+		{in: "recovery", err: true},
+		{in: "halt", err: true},
+	} {
+		got, err := ParseAction(tt.in)
+		if (err != nil) != tt.err {
+			t.Errorf("ParseAction(%q) = %v, want error %t", tt.in, err, tt.err)
+			continue
+		}
+		if err == nil && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseAction(%q) = %#v, want %#v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestFromFlags(t *testing.T) {
+	for _, tt := range []struct {
+		flags  map[string]string
+		d      time.Duration
+		action Kind
+		err    bool
+	}{
+		{},
+		{flags: map[string]string{"uroot.bootdeadline": "10"}, d: 10 * time.Minute, action: Reboot},
+		{flags: map[string]string{"uroot.bootdeadline": "90s", "uroot.bootdeadline_action": "powercycle"}, d: 90 * time.Second, action: PowerCycle},
+		{flags: map[string]string{"uroot.bootdeadline": "-1m"}, err: true},
+		{flags: map[string]string{"uroot.bootdeadline": "soon"}, err: true},
+		{flags: map[string]string{"uroot.bootdeadline": "5", "uroot.bootdeadline_action": "halt"}, err: true},
+	} {
+		d, a, err := fromFlags(func(f string) (string, bool) {
+			v, ok := tt.flags[f]
+			return v, ok
+		})
+		if (err != nil) != tt.err || d != tt.d || a.Kind != tt.action {
+			t.Errorf("fromFlags(%v) = %v, %v, %v, want %v, %v, error %t", tt.flags, d, a, err, tt.d, tt.action, tt.err)
+		}
+	}
+}
+
+func TestStart(t *testing.T) {
+	defer func(r, p func() error) { reboot, powerCycle = r, p }(reboot, powerCycle)
+	done := make(chan string, 2)
+	reboot = func() error {
+		done <- "reboot"
+		return nil
+	}
+	powerCycle = func() error {
+		done <- "powercycle"
+		return errors.New("no BMC")
+	}
+
+	// A failed power cycle falls back to a reboot.
+	Start(time.Millisecond, Action{Kind: PowerCycle})
+	for _, want := range []string{"powercycle", "reboot"} {
+		select {
+		case got := <-done:
+			if got != want {
+				t.Errorf("deadline did %s, want %s", got, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("deadline did not %s", want)
+		}
+	}
+
+	stop := Start(time.Hour, Action{Kind: Reboot})
+	stop()
+	stop()
+	select {
+	case got := <-done:
+		t.Errorf("stopped deadline did %s", got)
+	default:
+	}
+}
+
+func TestRecovery(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "deadline")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	kernel := filepath.Join(tmp, "kernel")
+	if err := ioutil.WriteFile(kernel, []byte("bzImage"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(l func(k, i *os.File, c string) error, r func() error) { kexecLoad, kexecReboot = l, r }(kexecLoad, kexecReboot)
+	var got string
+	kexecLoad = func(k, i *os.File, c string) error {
+		if i != nil {
+			t.Errorf("kexec with an initramfs")
+		}
+		got = filepath.Base(k.Name()) + " " + c
+		return nil
+	}
+	kexecReboot = func() error { return nil }
+
+	if err := (Action{Kind: Recovery, Args: []string{kernel}}).Do(); err != nil {
+		t.Fatal(err)
+	}
+	if got != "kernel " {
+		t.Errorf("kexec'd %q, want the kernel without a command line", got)
+	}
+	if err := (Action{Kind: Recovery, Args: []string{kernel, filepath.Join(tmp, "initrd")}}).Do(); err == nil {
+		t.Error("recovery with a missing initramfs did not fail")
+	}
+}
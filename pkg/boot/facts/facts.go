@@ -0,0 +1,157 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package facts substitutes facts about the machine into the kernel command
+// line of the next kernel, so one config serves many machines.
+//
+// Command lines are Go templates over a *Facts:
+//
+//	console={{.Console}} hostname=node-{{.Serial}} ip=::::{{.MAC "eth0"}}
+//
+// Facts are only gathered if a command line asks for them.
+package facts
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"strings"
+	"text/template"
+
+	"github.com/u-root/u-root/pkg/cmdline"
+	"github.com/u-root/u-root/pkg/mount/block"
+	"github.com/u-root/u-root/pkg/smbios"
+)
+
+var (
+	readSMBIOS    = smbios.FromSysfs
+	interfaces    = net.Interfaces
+	kernelCmdline = cmdline.FullCmdLine
+	activeConsole = "/sys/class/tty/console/active"
+)
+
+// Facts are the facts a command line can use.
+type Facts struct {
+	// Root is the device the boot config was found on, for RootUUID.
+	Root *block.BlockDev
+
+	sys *smbios.SystemInfo
+}
+
+// Expand substitutes facts into cl. Command lines without template actions
+// are returned as they are.
+func (f *Facts) Expand(cl string) (string, error) {
+	if !strings.Contains(cl, "{{") {
+		return cl, nil
+	}
+	t, err := template.New("cmdline").Parse(cl)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, f); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// word makes s fit in a command line argument, which cannot hold spaces.
+func word(s string) string {
+	return strings.Join(strings.Fields(s), "_")
+}
+
+func (f *Facts) system() (*smbios.SystemInfo, error) {
+	if f.sys != nil {
+		return f.sys, nil
+	}
+	info, err := readSMBIOS()
+	if err != nil {
+		return nil, err
+	}
+	if f.sys, err = info.GetSystemInfo(); err != nil {
+		return nil, fmt.Errorf("SMBIOS system information: %v", err)
+	}
+	return f.sys, nil
+}
+
+// Serial is the system serial number from SMBIOS.
+func (f *Facts) Serial() (string, error) {
+	sys, err := f.system()
+	if err != nil {
+		return "", err
+	}
+	s := word(sys.SerialNumber)
+	if s == "" {
+		return "", errors.New("no SMBIOS system serial number")
+	}
+	return s, nil
+}
+
+// SystemUUID is the system UUID from SMBIOS.
+func (f *Facts) SystemUUID() (string, error) {
+	sys, err := f.system()
+	if err != nil {
+		return "", err
+	}
+	return sys.UUID.String(), nil
+}
+
+// MAC is the MAC address of the named interface or, with no name, of the
+// first interface that is up and has one.
+func (f *Facts) MAC(name ...string) (string, error) {
+	if len(name) > 1 {
+		return "", fmt.Errorf("MAC takes one interface name, got %q", name)
+	}
+	ifaces, err := interfaces()
+	if err != nil {
+		return "", err
+	}
+	for _, i := range ifaces {
+		if len(i.HardwareAddr) == 0 {
+			continue
+		}
+		if len(name) == 1 && i.Name == name[0] || len(name) == 0 && i.Flags&net.FlagUp != 0 && i.Flags&net.FlagLoopback == 0 {
+			return i.HardwareAddr.String(), nil
+		}
+	}
+	if len(name) == 1 {
+		return "", fmt.Errorf("no interface %s with a MAC address", name[0])
+	}
+	return "", errors.New("no interface that is up has a MAC address")
+}
+
+// Console is the console of the running kernel: the last console= of its
+// command line, which is /dev/console, or else the console it picked.
+func (f *Facts) Console() (string, error) {
+	var console string
+	for _, arg := range strings.Fields(kernelCmdline()) {
+		if strings.HasPrefix(arg, "console=") {
+			console = strings.TrimPrefix(arg, "console=")
+		}
+	}
+	if console != "" {
+		return console, nil
+	}
+	b, err := ioutil.ReadFile(activeConsole)
+	if err != nil {
+		return "", err
+	}
+	active := strings.Fields(string(b))
+	if len(active) == 0 {
+		return "", errors.New("no console")
+	}
+	return active[len(active)-1], nil
+}
+
+// RootUUID is the file system UUID of Root.
+func (f *Facts) RootUUID() (string, error) {
+	if f.Root == nil {
+		return "", errors.New("no root device")
+	}
+	if f.Root.FsUUID == "" {
+		return "", fmt.Errorf("%s has no file system UUID", f.Root.Name)
+	}
+	return f.Root.FsUUID, nil
+}
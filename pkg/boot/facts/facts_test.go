@@ -0,0 +1,102 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package facts
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/mount/block"
+	"github.com/u-root/u-root/pkg/smbios"
+)
+
+// systemInfo is an SMBIOS type 1 table with a serial number with spaces.
+var systemInfo = append([]byte{
+	1, 27, 0, 1, // header
+	1, 2, 3, 4, // manufacturer, product, version, serial
+	0x78, 0x56, 0x34, 0x12, 0x34, 0x12, 0x78, 0x56, 0, 1, 2, 3, 4, 5, 6, 7, // UUID
+	6, 0, 0, // wake-up type, SKU, family
+}, "Acme\x00Box\x001.0\x00 SN 42 X \x00\x00"...)
+
+// fake replaces the machine with a fake one. It returns a cleanup func.
+func fake(t *testing.T, cmdline, active string) func() {
+	dir, err := ioutil.TempDir("", "facts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldSMBIOS, oldIfaces, oldCmdline, oldActive := readSMBIOS, interfaces, kernelCmdline, activeConsole
+	readSMBIOS = func() (*smbios.Info, error) {
+		tbl, _, err := smbios.ParseTable(systemInfo)
+		if err != nil {
+			return nil, err
+		}
+		return &smbios.Info{Tables: []*smbios.Table{tbl}}, nil
+	}
+	interfaces = func() ([]net.Interface, error) {
+		return []net.Interface{
+			{Name: "lo", Flags: net.FlagUp | net.FlagLoopback},
+			{Name: "eth0", HardwareAddr: net.HardwareAddr{0, 0x11, 0x22, 0x33, 0x44, 0x55}},
+			{Name: "eth1", Flags: net.FlagUp, HardwareAddr: net.HardwareAddr{0, 0x11, 0x22, 0x33, 0x44, 0x66}},
+		}, nil
+	}
+	kernelCmdline = func() string { return cmdline }
+	activeConsole = filepath.Join(dir, "active")
+	ioutil.WriteFile(activeConsole, []byte(active), 0644)
+	return func() {
+		readSMBIOS, interfaces, kernelCmdline, activeConsole = oldSMBIOS, oldIfaces, oldCmdline, oldActive
+		os.RemoveAll(dir)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	defer fake(t, "quiet console=tty0 console=ttyS1,115200n8", "tty0 ttyS1\n")()
+
+	f := &Facts{Root: &block.BlockDev{Name: "sda2", FsUUID: "2f6c1e7a-0b1d-4c5e-9a3f-8d7e6c5b4a39"}}
+	for _, tt := range []struct {
+		in, want string
+	}{
+		{"ro quiet", "ro quiet"},
+		{"console={{.Console}} hostname=node-{{.Serial}}", "console=ttyS1,115200n8 hostname=node-SN_42_X"},
+		{"uuid={{.SystemUUID}}", "uuid=12345678-1234-5678-0001-020304050607"},
+		{"mac={{.MAC}} eth0={{.MAC \"eth0\"}}", "mac=00:11:22:33:44:66 eth0=00:11:22:33:44:55"},
+		{"root=UUID={{.RootUUID}}", "root=UUID=2f6c1e7a-0b1d-4c5e-9a3f-8d7e6c5b4a39"},
+	} {
+		got, err := f.Expand(tt.in)
+		if err != nil {
+			t.Errorf("Expand(%q) = %v", tt.in, err)
+		} else if got != tt.want {
+			t.Errorf("Expand(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+
+	for _, in := range []string{
+		"{{.Serial",
+		"{{.NoSuchFact}}",
+		"{{.MAC \"eth9\"}}",
+		"{{.MAC \"eth0\" \"eth1\"}}",
+	} {
+		if got, err := f.Expand(in); err == nil {
+			t.Errorf("Expand(%q) = %q, want error", in, got)
+		}
+	}
+	if got, err := (&Facts{}).Expand("{{.RootUUID}}"); err == nil {
+		t.Errorf("Expand without a root = %q, want error", got)
+	}
+}
+
+func TestConsoleActive(t *testing.T) {
+	defer fake(t, "quiet", "tty0 ttyS0\n")()
+
+	got, err := (&Facts{}).Console()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "ttyS0" {
+		t.Errorf("Console() = %q, want ttyS0", got)
+	}
+}
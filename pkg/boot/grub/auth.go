@@ -0,0 +1,152 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package grub
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/boot"
+)
+
+// ErrAuth is returned for a wrong user name or password.
+var ErrAuth = errors.New("wrong user name or password")
+
+// Auth is what a GRUB config says about who may boot its entries.
+//
+// Once superusers are set, GRUB only boots an entry for a superuser, for a
+// user its menuentry --users names, or for anyone if it is --unrestricted.
+// See https://www.gnu.org/software/grub/manual/grub/html_node/Authentication-and-authorisation.html.
+type Auth struct {
+	// Superusers may boot every entry. Without them, entries are not
+	// restricted.
+	Superusers []string
+
+	// Passwords are the users' passwords: as they are for the password
+	// command, and as grub.pbkdf2.sha512.<iterations>.<salt>.<hash> for
+	// password_pbkdf2.
+	Passwords map[string]string
+
+	// users are who may boot each restricted image, besides superusers.
+	// Unrestricted images are not in it.
+	users map[boot.OSImage][]string
+}
+
+func newAuth() *Auth {
+	return &Auth{
+		Passwords: make(map[string]string),
+		users:     make(map[boot.OSImage][]string),
+	}
+}
+
+// userList splits a list of users as GRUB does.
+func userList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return strings.ContainsRune(" ,;|&", r)
+	})
+}
+
+// Restricted returns whether only some users may boot img.
+func (a *Auth) Restricted(img boot.OSImage) bool {
+	if a == nil || len(a.Superusers) == 0 {
+		return false
+	}
+	_, ok := a.users[img]
+	return ok
+}
+
+// Users returns who may boot img if it is Restricted: the superusers and
+// the users its entry names.
+func (a *Auth) Users(img boot.OSImage) []string {
+	if !a.Restricted(img) {
+		return nil
+	}
+	return append(append([]string{}, a.Superusers...), a.users[img]...)
+}
+
+// Check returns nil if user may boot img with password. Unrestricted
+// images need no user or password.
+func (a *Auth) Check(img boot.OSImage, user, password string) error {
+	if !a.Restricted(img) {
+		return nil
+	}
+	if !contains(a.Users(img), user) {
+		return ErrAuth
+	}
+	want, ok := a.Passwords[user]
+	if !ok {
+		return ErrAuth
+	}
+	if !strings.HasPrefix(want, pbkdf2Prefix) {
+		if subtle.ConstantTimeCompare([]byte(password), []byte(want)) != 1 {
+			return ErrAuth
+		}
+		return nil
+	}
+	ok, err := checkPBKDF2(want, password)
+	if err != nil {
+		return fmt.Errorf("password of %s: %v", user, err)
+	}
+	if !ok {
+		return ErrAuth
+	}
+	return nil
+}
+
+// pbkdf2Prefix starts the hashes grub-mkpasswd-pbkdf2 makes.
+const pbkdf2Prefix = "grub.pbkdf2.sha512."
+
+// checkPBKDF2 returns whether password hashes to hash, as made by
+// grub-mkpasswd-pbkdf2.
+func checkPBKDF2(hash, password string) (bool, error) {
+	f := strings.Split(strings.TrimPrefix(hash, pbkdf2Prefix), ".")
+	if len(f) != 3 {
+		return false, errors.New("malformed PBKDF2 hash")
+	}
+	iter, err := strconv.Atoi(f[0])
+	if err != nil || iter < 1 {
+		return false, fmt.Errorf("bad PBKDF2 iteration count %q", f[0])
+	}
+	salt, err := hex.DecodeString(f[1])
+	if err != nil {
+		return false, fmt.Errorf("bad PBKDF2 salt: %v", err)
+	}
+	want, err := hex.DecodeString(f[2])
+	if err != nil || len(want) == 0 {
+		return false, fmt.Errorf("bad PBKDF2 hash: %v", err)
+	}
+	got := pbkdf2SHA512([]byte(password), salt, iter, len(want))
+	return subtle.ConstantTimeCompare(got, want) == 1, nil
+}
+
+// pbkdf2SHA512 is PBKDF2 (RFC 8018) with HMAC-SHA512.
+func pbkdf2SHA512(password, salt []byte, iter, keyLen int) []byte {
+	prf := hmac.New(sha512.New, password)
+	var key []byte
+	for block := uint32(1); len(key) < keyLen; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, block)
+		u := prf.Sum(nil)
+		t := append([]byte{}, u...)
+		for n := 1; n < iter; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range t {
+				t[i] ^= u[i]
+			}
+		}
+		key = append(key, t...)
+	}
+	return key[:keyLen]
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package grub
+
+import (
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/boot"
+)
+
+func TestPBKDF2SHA512(t *testing.T) {
+	want := "e1d9c16aa681708a45f5c7c4e215ceb66e011a2e9f0040713f18aefdb866d53cf76cab2868a39b9f7840edce4fef5a82be67335c77a6068e04112754f27ccf4e"
+	if got := hex.EncodeToString(pbkdf2SHA512([]byte("password"), []byte("salt"), 2, 64)); got != want {
+		t.Errorf("pbkdf2SHA512 = %s, want %s", got, want)
+	}
+}
+
+// hunter2 is what grub-mkpasswd-pbkdf2 makes of "hunter2".
+const hunter2 = "grub.pbkdf2.sha512.1000.000102030405060708090A0B0C0D0E0F101112131415161718191A1B1C1D1E1F202122232425262728292A2B2C2D2E2F303132333435363738393A3B3C3D3E3F.CEBC77C9BDFB8CD5AB80CACB864BD1FF14002FDB4A29701A8D91357653362AC485736B3DF080F17CF9A1859A5B515294CC93823842F006FD41AC80C4329DA336"
+
+func TestAuth(t *testing.T) {
+	config := `set superusers="root"
+password_pbkdf2 root ` + hunter2 + `
+password alice wonderland
+menuentry 'Default' --class os --unrestricted {
+	linux /vmlinuz-1
+}
+menuentry 'Maintenance' --users alice {
+	linux /vmlinuz-2
+}
+menuentry 'Recovery' {
+	linux /vmlinuz-3
+}
+`
+	dir, err := ioutil.TempDir("", "grub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "boot/grub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "boot/grub/grub.cfg"), []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	imgs, auth, err := ParseLocalConfigAuth(context.Background(), dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imgs) != 3 {
+		t.Fatalf("ParseLocalConfigAuth returned %d images, want 3", len(imgs))
+	}
+	def, maint, recov := imgs[0], imgs[1], imgs[2]
+
+	if !reflect.DeepEqual(auth.Superusers, []string{"root"}) {
+		t.Errorf("Superusers = %q, want root", auth.Superusers)
+	}
+	for img, want := range map[boot.OSImage][]string{
+		def:   nil,
+		maint: {"root", "alice"},
+		recov: {"root"},
+	} {
+		if got := auth.Users(img); !reflect.DeepEqual(got, want) {
+			t.Errorf("Users(%s) = %q, want %q", img.Label(), got, want)
+		}
+	}
+
+	for _, tt := range []struct {
+		img            boot.OSImage
+		user, password string
+		ok             bool
+	}{
+		{def, "", "", true},
+		{maint, "alice", "wonderland", true},
+		{maint, "alice", "looking glass", false},
+		{maint, "root", "hunter2", true},
+		{maint, "root", "hunter3", false},
+		{recov, "root", "hunter2", true},
+		{recov, "alice", "wonderland", false},
+		{recov, "", "", false},
+	} {
+		if err := auth.Check(tt.img, tt.user, tt.password); (err == nil) != tt.ok {
+			t.Errorf("Check(%s, %q, %q) = %v, want ok %t", tt.img.Label(), tt.user, tt.password, err, tt.ok)
+		}
+	}
+}
+
+func TestAuthNoSuperusers(t *testing.T) {
+	a := newAuth()
+	img := &boot.LinuxImage{}
+	a.users[img] = nil
+	if a.Restricted(img) {
+		t.Errorf("entry restricted without superusers")
+	}
+	if err := a.Check(img, "", ""); err != nil {
+		t.Errorf("Check = %v, want nil", err)
+	}
+	var none *Auth
+	if none.Restricted(img) {
+		t.Errorf("nil Auth restricts")
+	}
+}
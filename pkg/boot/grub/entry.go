@@ -5,10 +5,12 @@
 package grub
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sort"
 	"strings"
 )
@@ -16,6 +18,9 @@ import (
 // GRUB block size.
 const blockSize = 1024
 
+// envHeader starts every environment block GRUB writes.
+const envHeader = "# GRUB Environment Block\n"
+
 // EnvFile is a GRUB environment file consisting of key-value pairs akin to the
 // GRUB commands load_env and save_env.
 type EnvFile struct {
@@ -29,10 +34,16 @@ func NewEnvFile() *EnvFile {
 	}
 }
 
+// escapeEnv escapes backslashes and newlines as GRUB's envblk does.
+func escapeEnv(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return strings.Replace(s, "\n", "\\\n", -1)
+}
+
 // WriteTo writes key-value pairs to a file, padded to 1024 bytes, as save_env does.
 func (env *EnvFile) WriteTo(w io.Writer) (int64, error) {
 	var b bytes.Buffer
-	b.WriteString("# GRUB Environment Block\n")
+	b.WriteString(envHeader)
 
 	// Sort keys so order is deterministic.
 	keys := make([]string, 0, len(env.Vars))
@@ -43,9 +54,9 @@ func (env *EnvFile) WriteTo(w io.Writer) (int64, error) {
 
 	for _, k := range keys {
 		if len(env.Vars[k]) > 0 {
-			b.WriteString(k)
+			b.WriteString(escapeEnv(k))
 			b.WriteString("=")
-			b.WriteString(env.Vars[k])
+			b.WriteString(escapeEnv(env.Vars[k]))
 			b.WriteString("\n")
 		}
 	}
@@ -53,7 +64,7 @@ func (env *EnvFile) WriteTo(w io.Writer) (int64, error) {
 
 	// Fill up the file with # until 1024 bytes to make the file size a
 	// multiple of the block size.
-	remainder := blockSize - length%blockSize
+	remainder := (blockSize - length%blockSize) % blockSize
 	for i := 0; i < remainder; i++ {
 		b.WriteByte('#')
 	}
@@ -65,27 +76,123 @@ func (env *EnvFile) WriteTo(w io.Writer) (int64, error) {
 //
 // ParseEnvFile accepts incorrectly padded GRUB env files, as opposed to GRUB.
 func ParseEnvFile(r io.Reader) (*EnvFile, error) {
-	s := bufio.NewScanner(r)
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
 	conf := NewEnvFile()
 	// Best lexer & parser in the world.
-	for s.Scan() {
-		if len(s.Text()) == 0 {
+	for len(b) > 0 {
+		// Lines end at the first newline not escaped by a backslash.
+		var line []byte
+		i := 0
+		for ; i < len(b) && b[i] != '\n'; i++ {
+			if b[i] == '\\' && i+1 < len(b) {
+				i++
+			}
+			line = append(line, b[i])
+		}
+		if i < len(b) {
+			i++
+		}
+		b = b[i:]
+
+		if len(line) == 0 {
 			continue
 		}
-		// Comments.
-		if s.Text()[0] == '#' {
+		// Comments and padding.
+		if line[0] == '#' {
 			continue
 		}
 
-		tokens := strings.SplitN(s.Text(), "=", 2)
+		tokens := strings.SplitN(string(line), "=", 2)
 		if len(tokens) != 2 {
-			return nil, fmt.Errorf("error parsing %q: must find = or # in each line", s.Text())
+			return nil, fmt.Errorf("error parsing %q: must find = or # in each line", line)
 		}
 		key, value := tokens[0], tokens[1]
 		conf.Vars[key] = value
 	}
-	if err := s.Err(); err != nil {
+	return conf, nil
+}
+
+// ReadEnvFile reads the GRUB environment file at path.
+func ReadEnvFile(path string) (*EnvFile, error) {
+	f, err := os.Open(path)
+	if err != nil {
 		return nil, err
 	}
-	return conf, nil
+	defer f.Close()
+	return ParseEnvFile(f)
+}
+
+// WriteFile saves env to path.
+//
+// GRUB's save_env writes to the blocks the file already occupies and never
+// resizes it, so an existing file of the right size is overwritten in place
+// rather than replaced.
+func (env *EnvFile) WriteFile(path string) error {
+	var b bytes.Buffer
+	if _, err := env.WriteTo(&b); err != nil {
+		return err
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil || fi.Size() != int64(b.Len()) {
+		return ioutil.WriteFile(path, b.Bytes(), 0644)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteAt(b.Bytes(), 0); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// EnvFiles returns the grubenv files on the disk partition mounted at
+// diskDir, in the places ParseLocalConfig looks for configs.
+func EnvFiles(diskDir string) []string {
+	var dirs []string
+	for _, f := range probeGrubFiles {
+		dirs = append(dirs, filepath.Join(diskDir, filepath.Dir(f)))
+	}
+	efi, _ := filepath.Glob(filepath.Join(diskDir, "EFI", "*"))
+	dirs = append(efi, dirs...)
+
+	var files []string
+	for _, d := range dirs {
+		f := filepath.Join(d, "grubenv")
+		if fi, err := os.Stat(f); err == nil && fi.Mode().IsRegular() {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// ClearNextEntry removes the one-time next_entry set by grub-reboot from
+// every grubenv on the partition mounted at diskDir, as GRUB does when it
+// shows its menu. It reports whether any entry was cleared.
+func ClearNextEntry(diskDir string) (bool, error) {
+	var cleared bool
+	for _, f := range EnvFiles(diskDir) {
+		env, err := ReadEnvFile(f)
+		if err != nil {
+			return cleared, err
+		}
+		if len(env.Vars["next_entry"]) == 0 {
+			continue
+		}
+		delete(env.Vars, "next_entry")
+		if err := env.WriteFile(f); err != nil {
+			return cleared, err
+		}
+		cleared = true
+	}
+	return cleared, nil
 }
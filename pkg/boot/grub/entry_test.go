@@ -6,6 +6,10 @@ package grub
 
 import (
 	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -47,3 +51,80 @@ initrd=initramfs.cpio
 		t.Errorf("ParseEnvFile(%q) diff(-want, +got) = \n%s", file, diff)
 	}
 }
+
+func TestEnvFileEscaping(t *testing.T) {
+	env := &EnvFile{map[string]string{
+		"saved_entry": `Advanced options>Linux \ "5.4"`,
+		"multi":       "line1\nline2",
+	}}
+	var buf bytes.Buffer
+	if _, err := env.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != blockSize {
+		t.Errorf("env.WriteTo() wrote %d bytes, want %d", buf.Len(), blockSize)
+	}
+	got, err := ParseEnvFile(&buf)
+	if err != nil {
+		t.Fatalf("ParseEnvFile() = %v", err)
+	}
+	if diff := cmp.Diff(env, got); diff != "" {
+		t.Errorf("round trip diff(-want, +got) = \n%s", diff)
+	}
+}
+
+func TestWriteToExactBlock(t *testing.T) {
+	// Header, "k=", value and newline fill exactly one block.
+	env := &EnvFile{map[string]string{
+		"k": strings.Repeat("v", blockSize-len(envHeader)-3),
+	}}
+	var buf bytes.Buffer
+	if _, err := env.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != blockSize {
+		t.Errorf("env.WriteTo() wrote %d bytes, want %d", buf.Len(), blockSize)
+	}
+}
+
+func TestClearNextEntry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "grubenv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := os.MkdirAll(filepath.Join(dir, "boot/grub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "boot/grub/grubenv")
+	env := &EnvFile{map[string]string{
+		"saved_entry": "1",
+		"next_entry":  "2",
+	}}
+	if err := env.WriteFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if files := EnvFiles(dir); len(files) != 1 || files[0] != path {
+		t.Errorf("EnvFiles() = %v, want [%s]", files, path)
+	}
+	if cleared, err := ClearNextEntry(dir); err != nil || !cleared {
+		t.Fatalf("ClearNextEntry() = %v, %v, want true, nil", cleared, err)
+	}
+	if cleared, err := ClearNextEntry(dir); err != nil || cleared {
+		t.Errorf("second ClearNextEntry() = %v, %v, want false, nil", cleared, err)
+	}
+
+	got, err := ReadEnvFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &EnvFile{map[string]string{"saved_entry": "1"}}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("grubenv diff(-want, +got) = \n%s", diff)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() != blockSize {
+		t.Errorf("grubenv is not one block: %v, %v", fi, err)
+	}
+}
@@ -10,16 +10,26 @@
 // - https://www.gnu.org/software/grub/manual/grub/html_node/Shell_002dlike-scripting.html
 // - https://www.gnu.org/software/grub/manual/grub/html_node/Commands.html
 //
-// Currently, only the linux[16|efi], initrd[16|efi], menuentry and set
-// directives are partially supported.
+// Currently, only the linux[16|efi], initrd[16|efi], menuentry, set and
+// load_env directives are partially supported.
+//
+// The default entry honors the saved_entry and next_entry variables of the
+// GRUB environment block (grubenv) the way grub-set-default and grub-reboot
+// expect.
+//
+// The superusers variable, the password and password_pbkdf2 directives and
+// the --users and --unrestricted menuentry options are gathered into an
+// Auth, for boot menus to enforce or to report that they do not.
 package grub
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
 	"log"
 	"net/url"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -31,6 +41,10 @@ import (
 	"github.com/u-root/u-root/pkg/uio"
 )
 
+// maxConfigDepth bounds how deep configfile directives nest, so a config
+// that includes itself does not recurse forever.
+const maxConfigDepth = 16
+
 var probeGrubFiles = []string{
 	"boot/grub/grub.cfg",
 	"grub/grub.cfg",
@@ -45,6 +59,13 @@ var probeGrubFiles = []string{
 // assume that the kernels we boot are only on this one partition. But so is
 // this whole parser.
 func ParseLocalConfig(ctx context.Context, diskDir string) ([]boot.OSImage, error) {
+	imgs, _, err := ParseLocalConfigAuth(ctx, diskDir)
+	return imgs, err
+}
+
+// ParseLocalConfigAuth is ParseLocalConfig, and also returns what the config
+// says about who may boot the images.
+func ParseLocalConfigAuth(ctx context.Context, diskDir string) ([]boot.OSImage, *Auth, error) {
 	wd := &url.URL{
 		Scheme: "file",
 		Path:   diskDir,
@@ -70,13 +91,13 @@ func ParseLocalConfig(ctx context.Context, diskDir string) ([]boot.OSImage, erro
 	}
 
 	for _, relname := range append(relNames, probeGrubFiles...) {
-		c, err := ParseConfigFile(ctx, curl.DefaultSchemes, relname, wd)
+		c, auth, err := parseConfigFile(ctx, curl.DefaultSchemes, relname, wd)
 		if curl.IsURLError(err) {
 			continue
 		}
-		return c, err
+		return c, auth, err
 	}
-	return nil, fmt.Errorf("no valid grub config found")
+	return nil, nil, fmt.Errorf("GRUB: %w", boot.ErrNoConfig)
 }
 
 // ParseConfigFile parses a grub configuration as specified in
@@ -88,10 +109,19 @@ func ParseLocalConfig(ctx context.Context, diskDir string) ([]boot.OSImage, erro
 // `wd` is the default scheme, host, and path for any files named as a
 // relative path - e.g. kernel, include, and initramfs paths are requested
 // relative to the wd.
+//
+// Directives that fail, e.g. because a file cannot be found, are skipped,
+// and so is the entry they are in. The images that could still be parsed
+// are returned along with a boot.ConfigErrors listing what was skipped.
 func ParseConfigFile(ctx context.Context, s curl.Schemes, configFile string, wd *url.URL) ([]boot.OSImage, error) {
+	imgs, _, err := parseConfigFile(ctx, s, configFile, wd)
+	return imgs, err
+}
+
+func parseConfigFile(ctx context.Context, s curl.Schemes, configFile string, wd *url.URL) ([]boot.OSImage, *Auth, error) {
 	p := newParser(wd, s)
 	if err := p.appendFile(ctx, configFile); err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Don't add entries twice.
@@ -100,27 +130,33 @@ func ParseConfigFile(ctx context.Context, s curl.Schemes, configFile string, wd
 	seenLinux := make(map[*boot.LinuxImage]struct{})
 	seenMB := make(map[*boot.MultibootImage]struct{})
 
+	// A one-time entry chosen by grub-reboot takes precedence over
+	// whatever the config picked. Clearing it is up to the caller; see
+	// ClearNextEntry.
+	if next := p.env["next_entry"]; len(next) > 0 {
+		p.defaultEntry = next
+	}
 	if len(p.defaultEntry) > 0 {
-		p.labelOrder = append([]string{p.defaultEntry}, p.labelOrder...)
+		p.labelOrder = append([]string{p.resolveEntry(p.defaultEntry)}, p.labelOrder...)
 	}
 
 	var images []boot.OSImage
 	for _, label := range p.labelOrder {
-		if img, ok := p.linuxEntries[label]; ok {
+		if img, ok := p.linuxEntries[label]; ok && !p.broken[img] {
 			if _, ok := seenLinux[img]; !ok {
 				images = append(images, img)
 				seenLinux[img] = struct{}{}
 			}
 		}
 
-		if img, ok := p.mbEntries[label]; ok {
+		if img, ok := p.mbEntries[label]; ok && !p.broken[img] {
 			if _, ok := seenMB[img]; !ok {
 				images = append(images, img)
 				seenMB[img] = struct{}{}
 			}
 		}
 	}
-	return images, nil
+	return images, p.auth, p.errs.Err()
 }
 
 type parser struct {
@@ -130,17 +166,47 @@ type parser struct {
 	labelOrder   []string
 	defaultEntry string
 
+	// env holds the variables read by load_env.
+	env map[string]string
+
+	// prefix is the directory of the top-level config file, where
+	// load_env looks for grubenv by default.
+	prefix string
+
 	W io.Writer
 
 	// parser internals.
 	numEntry int
 
+	// curFile is the config file being parsed, depth how many config
+	// files deep it is.
+	curFile string
+	depth   int
+
 	// curEntry is the current entry number as a string.
 	curEntry string
 
 	// curLabel is the last parsed label from a "menuentry".
 	curLabel string
 
+	// curID is the --id of the last parsed "menuentry", if it had one.
+	curID string
+
+	// curRestricted is whether the last parsed "menuentry" lacked
+	// --unrestricted, and curUsers are its --users.
+	curRestricted bool
+	curUsers      []string
+
+	// auth collects superusers, passwords and restricted entries.
+	auth *Auth
+
+	// errs are the errors the parser skipped over.
+	errs boot.ConfigErrors
+
+	// broken are entries that are left out because a directive in them
+	// failed.
+	broken map[boot.OSImage]bool
+
 	wd      *url.URL
 	schemes curl.Schemes
 }
@@ -157,6 +223,9 @@ func newParser(wd *url.URL, s curl.Schemes) *parser {
 	return &parser{
 		linuxEntries: make(map[string]*boot.LinuxImage),
 		mbEntries:    make(map[string]*boot.MultibootImage),
+		env:          make(map[string]string),
+		broken:       make(map[boot.OSImage]bool),
+		auth:         newAuth(),
 		wd:           wd,
 		schemes:      s,
 	}
@@ -197,10 +266,16 @@ func (c *parser) getFile(url string) (io.ReaderAt, error) {
 
 // appendFile parses the config file downloaded from `url` and adds it to `c`.
 func (c *parser) appendFile(ctx context.Context, url string) error {
+	if c.depth >= maxConfigDepth {
+		return fmt.Errorf("%s: config files nested more than %d deep", url, maxConfigDepth)
+	}
 	u, err := parseURL(url, c.wd)
 	if err != nil {
 		return err
 	}
+	if len(c.prefix) == 0 {
+		c.prefix = filepath.Dir(url)
+	}
 
 	r, err := c.schemes.Fetch(ctx, u)
 	if err != nil {
@@ -218,6 +293,12 @@ func (c *parser) appendFile(ctx context.Context, url string) error {
 	} else {
 		log.Printf("[grub] Got config file %s:\n%s\n", r, string(config))
 	}
+	defer func(f string) {
+		c.curFile = f
+		c.depth--
+	}(c.curFile)
+	c.curFile = url
+	c.depth++
 	return c.append(ctx, string(config))
 }
 
@@ -243,7 +324,7 @@ func cmdlineQuote(args []string) string {
 // then we can do a rewrite.
 func (c *parser) append(ctx context.Context, config string) error {
 	// Here's a shitty parser.
-	for _, line := range strings.Split(config, "\n") {
+	for n, line := range strings.Split(config, "\n") {
 		kv := shlex.Argv(line)
 		if len(kv) < 1 {
 			continue
@@ -254,6 +335,11 @@ func (c *parser) append(ctx context.Context, config string) error {
 			fmt.Fprintf(c.W, "echo:%#v\n", kv[1:])
 		}
 
+		if directive == "load_env" {
+			c.loadEnv(ctx, kv[1:])
+			continue
+		}
+
 		if len(kv) <= 1 {
 			continue
 		}
@@ -265,15 +351,21 @@ func (c *parser) append(ctx context.Context, config string) error {
 			if len(vals) == 2 {
 				//TODO handle vars? bootVars[vals[0]] = vals[1]
 				//log.Printf("grubvar: %s=%s", vals[0], vals[1])
+				if vals[0] == "superusers" {
+					c.auth.Superusers = userList(vals[1])
+				}
 				if vals[0] == "default" {
-					c.defaultEntry = vals[1]
+					// Typically "${saved_entry}" or "${next_entry}".
+					c.defaultEntry = os.Expand(vals[1], func(v string) string {
+						return c.env[v]
+					})
 				}
 			}
 
 		case "configfile":
 			// TODO test that
 			if err := c.appendFile(ctx, arg); err != nil {
-				return err
+				c.warn(n+1, err)
 			}
 
 		case "menuentry":
@@ -281,11 +373,24 @@ func (c *parser) append(ctx context.Context, config string) error {
 			c.curLabel = arg
 			c.numEntry++
 			c.labelOrder = append(c.labelOrder, c.curEntry, c.curLabel)
+			c.curID = menuEntryID(kv[2:])
+			if len(c.curID) > 0 {
+				c.labelOrder = append(c.labelOrder, c.curID)
+			}
+			c.curRestricted, c.curUsers = menuEntryUsers(kv[2:])
+
+		case "password", "password_pbkdf2":
+			if len(kv) < 3 {
+				c.warn(n+1, fmt.Errorf("%s: missing password", directive))
+				continue
+			}
+			c.auth.Passwords[arg] = kv[2]
 
 		case "linux", "linux16", "linuxefi":
 			k, err := c.getFile(arg)
 			if err != nil {
-				return err
+				c.warn(n+1, err)
+				continue
 			}
 			// from grub manual: "Any initrd must be reloaded after using this command" so we can replace the entry
 			entry := &boot.LinuxImage{
@@ -295,12 +400,19 @@ func (c *parser) append(ctx context.Context, config string) error {
 			}
 			c.linuxEntries[c.curEntry] = entry
 			c.linuxEntries[c.curLabel] = entry
+			c.restrict(entry)
+			// IDs are not unique across submenus; GRUB picks the first.
+			if _, ok := c.linuxEntries[c.curID]; len(c.curID) > 0 && !ok {
+				c.linuxEntries[c.curID] = entry
+			}
 
 		case "initrd", "initrd16", "initrdefi":
 			if e, ok := c.linuxEntries[c.curEntry]; ok {
 				i, err := c.getFile(arg)
 				if err != nil {
-					return err
+					c.warn(n+1, err)
+					c.broken[e] = true
+					continue
 				}
 				e.Initrd = i
 			}
@@ -309,7 +421,8 @@ func (c *parser) append(ctx context.Context, config string) error {
 			// TODO handle --quirk-* arguments ? (change parsing)
 			k, err := c.getFile(arg)
 			if err != nil {
-				return err
+				c.warn(n+1, err)
+				continue
 			}
 			// from grub manual: "Any initrd must be reloaded after using this command" so we can replace the entry
 			entry := &boot.MultibootImage{
@@ -319,6 +432,10 @@ func (c *parser) append(ctx context.Context, config string) error {
 			}
 			c.mbEntries[c.curEntry] = entry
 			c.mbEntries[c.curLabel] = entry
+			c.restrict(entry)
+			if _, ok := c.mbEntries[c.curID]; len(c.curID) > 0 && !ok {
+				c.mbEntries[c.curID] = entry
+			}
 
 		case "module":
 			// TODO handle --nounzip arguments ? (change parsing)
@@ -326,13 +443,20 @@ func (c *parser) append(ctx context.Context, config string) error {
 				// The only allowed arg
 				cmdline := kv[1:]
 				if arg == "--nounzip" {
+					if len(kv) < 3 {
+						c.warn(n+1, fmt.Errorf("module: missing file name"))
+						c.broken[e] = true
+						continue
+					}
 					arg = kv[2]
 					cmdline = kv[2:]
 				}
 
 				m, err := c.getFile(arg)
 				if err != nil {
-					return err
+					c.warn(n+1, err)
+					c.broken[e] = true
+					continue
 				}
 				// TODO: Lasy tryGzipFilter(m)
 				mod := multiboot.Module{
@@ -347,3 +471,129 @@ func (c *parser) append(ctx context.Context, config string) error {
 	return nil
 
 }
+
+// warn notes an error at line of the current file that the parser skipped
+// over.
+func (c *parser) warn(line int, err error) {
+	log.Printf("[grub] %s:%d: %v", c.curFile, line, err)
+	c.errs = append(c.errs, &boot.ConfigError{File: c.curFile, Line: line, Err: err})
+}
+
+// loadEnv reads variables from a grubenv file as the load_env command does.
+// Without -f the file is grubenv next to the top-level config. Any
+// remaining arguments restrict which variables are read.
+func (c *parser) loadEnv(ctx context.Context, args []string) {
+	file := filepath.Join(c.prefix, "grubenv")
+	var names []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-f" || args[i] == "--file":
+			if i+1 < len(args) {
+				file = args[i+1]
+				i++
+			}
+		case strings.HasPrefix(args[i], "--file="):
+			file = strings.TrimPrefix(args[i], "--file=")
+		case strings.HasPrefix(args[i], "-"):
+			// --skip-sig and the like.
+		default:
+			names = append(names, args[i])
+		}
+	}
+	file = os.Expand(file, func(v string) string {
+		if v == "prefix" || v == "config_directory" {
+			return c.prefix
+		}
+		return c.env[v]
+	})
+
+	// Configs guard load_env with a check that grubenv exists, which we
+	// don't evaluate, so a missing file is not an error.
+	u, err := parseURL(file, c.wd)
+	if err != nil {
+		log.Printf("[grub] load_env: %v", err)
+		return
+	}
+	r, err := c.schemes.Fetch(ctx, u)
+	if err != nil {
+		return
+	}
+	b, err := uio.ReadAll(r)
+	if err != nil {
+		log.Printf("[grub] load_env: could not read %s: %v", u, err)
+		return
+	}
+	env, err := ParseEnvFile(bytes.NewReader(b))
+	if err != nil {
+		log.Printf("[grub] load_env: %s: %v", u, err)
+		return
+	}
+	for k, v := range env.Vars {
+		if len(names) == 0 || contains(names, k) {
+			c.env[k] = v
+		}
+	}
+}
+
+// menuEntryID returns the value of a menuentry's --id option, which
+// distributions pass through the menuentry_id_option variable.
+func menuEntryID(args []string) string {
+	for i := 0; i < len(args)-1; i++ {
+		switch args[i] {
+		case "--id", "$menuentry_id_option", "${menuentry_id_option}":
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// menuEntryUsers returns whether a menuentry is restricted, as it is unless
+// it is --unrestricted, and who its --users are.
+func menuEntryUsers(args []string) (bool, []string) {
+	restricted := true
+	var users []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--unrestricted":
+			restricted = false
+		case args[i] == "--users" && i+1 < len(args):
+			users = userList(args[i+1])
+			i++
+		case strings.HasPrefix(args[i], "--users="):
+			users = userList(strings.TrimPrefix(args[i], "--users="))
+		}
+	}
+	return restricted, users
+}
+
+// restrict notes who may boot img, the image of the current entry.
+func (c *parser) restrict(img boot.OSImage) {
+	if c.curRestricted {
+		c.auth.users[img] = c.curUsers
+	}
+}
+
+// resolveEntry maps a default entry to an entry the parser knows. Entries
+// in submenus are saved as "submenu>entry"; since submenus are flattened,
+// only the last part of such a path can match.
+func (c *parser) resolveEntry(e string) string {
+	if _, ok := c.linuxEntries[e]; ok {
+		return e
+	}
+	if _, ok := c.mbEntries[e]; ok {
+		return e
+	}
+	if i := strings.LastIndex(e, ">"); i >= 0 {
+		return e[i+1:]
+	}
+	return e
+}
+
+func contains(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -5,8 +5,14 @@
 package grub
 
 import (
+	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+
+	"github.com/u-root/u-root/pkg/boot"
 )
 
 func TestCmdlineQuote(t *testing.T) {
@@ -45,3 +51,69 @@ func TestCmdlineQuote(t *testing.T) {
 		})
 	}
 }
+
+func TestDefaultFromEnv(t *testing.T) {
+	const config = `load_env
+if [ "${next_entry}" ] ; then
+   set default="${next_entry}"
+   set next_entry=
+   save_env next_entry
+else
+   set default="${saved_entry}"
+fi
+menuentry 'First' --class os $menuentry_id_option 'first-id' {
+	linux /vmlinuz-1
+}
+submenu 'Advanced' {
+	menuentry 'Second' --id second-id {
+		linux /vmlinuz-2
+	}
+	menuentry 'Third' $menuentry_id_option 'third-id' {
+		linux /vmlinuz-3
+	}
+}
+`
+	for _, tt := range []struct {
+		desc string
+		env  map[string]string
+		want string
+	}{
+		{desc: "no grubenv", want: "First"},
+		{desc: "saved title", env: map[string]string{"saved_entry": "Third"}, want: "Third"},
+		{desc: "saved id", env: map[string]string{"saved_entry": "second-id"}, want: "Second"},
+		{desc: "saved submenu path", env: map[string]string{"saved_entry": "Advanced>Third"}, want: "Third"},
+		{desc: "saved index", env: map[string]string{"saved_entry": "1"}, want: "Second"},
+		{desc: "next entry wins", env: map[string]string{"saved_entry": "Second", "next_entry": "third-id"}, want: "Third"},
+	} {
+		t.Run(tt.desc, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "grub")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			if err := os.MkdirAll(filepath.Join(dir, "boot/grub"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, "boot/grub/grub.cfg"), []byte(config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if tt.env != nil {
+				if err := (&EnvFile{tt.env}).WriteFile(filepath.Join(dir, "boot/grub/grubenv")); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			imgs, err := ParseLocalConfig(context.Background(), dir)
+			if err != nil {
+				t.Fatalf("ParseLocalConfig() = %v", err)
+			}
+			if len(imgs) != 3 {
+				t.Fatalf("ParseLocalConfig() returned %d images, want 3", len(imgs))
+			}
+			if got := imgs[0].(*boot.LinuxImage).Name; got != tt.want {
+				t.Errorf("default image = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package grub
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/curl"
+)
+
+func TestParseRecovers(t *testing.T) {
+	const config = `menuentry 'Bad kernel' {
+	linux ftp://nowhere/vmlinuz
+}
+menuentry 'Bad initrd' {
+	linux /vmlinuz-2
+	initrd ftp://nowhere/initrd
+}
+menuentry 'Bad module' {
+	multiboot /xen.gz
+	module --nounzip
+}
+menuentry 'Good' {
+	linux /vmlinuz-3 root=/dev/sda1
+	initrd /initrd-3
+}
+`
+	fs := curl.NewMockScheme("tftp")
+	fs.Add("1.2.3.4", "/grub.cfg", config)
+	wd := &url.URL{Scheme: "tftp", Host: "1.2.3.4", Path: "/"}
+
+	imgs, err := ParseConfigFile(context.Background(), curl.Schemes{"tftp": fs}, "grub.cfg", wd)
+	if len(imgs) != 1 || imgs[0].Label() != "Good" {
+		t.Errorf("ParseConfigFile() = %v, want only the good entry", imgs)
+	}
+
+	var errs boot.ConfigErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("ParseConfigFile() = %v, want boot.ConfigErrors", err)
+	}
+	var lines []int
+	for _, e := range errs {
+		if e.File != "grub.cfg" {
+			t.Errorf("error %v in file %q, want grub.cfg", e, e.File)
+		}
+		lines = append(lines, e.Line)
+	}
+	if want := []int{2, 6, 10}; len(lines) != len(want) || lines[0] != want[0] || lines[1] != want[1] || lines[2] != want[2] {
+		t.Errorf("errors at lines %v, want %v", lines, want)
+	}
+}
+
+func TestParseNestingBounded(t *testing.T) {
+	fs := curl.NewMockScheme("tftp")
+	fs.Add("1.2.3.4", "/grub.cfg", "configfile grub.cfg\n")
+	wd := &url.URL{Scheme: "tftp", Host: "1.2.3.4", Path: "/"}
+
+	_, err := ParseConfigFile(context.Background(), curl.Schemes{"tftp": fs}, "grub.cfg", wd)
+	var errs boot.ConfigErrors
+	if !errors.As(err, &errs) || len(errs) != 1 {
+		t.Errorf("ParseConfigFile(self-including config) = %v, want one error", err)
+	}
+}
+
+// malformed are inputs that once crashed the parser or that it must
+// survive.
+var malformed = []string{
+	"",
+	"\x00",
+	"menuentry",
+	"menuentry 'a' --id",
+	"module --nounzip",
+	"menuentry a {\nmultiboot /xen\nmodule --nounzip\n}",
+	"linux",
+	"initrd /initrd",
+	"set",
+	"set default",
+	"set default=${",
+	"load_env -f",
+	"configfile ::::",
+	"linux %zz",
+	"menuentry \"unterminated",
+	"menuentry a {\nlinux /k\ninitrd\n}",
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, in := range malformed {
+		fuzzParse([]byte(in))
+	}
+}
+
+// fuzzParse parses data as a config that can only refer to files that
+// do not exist.
+func fuzzParse(data []byte) (*parser, error) {
+	fs := curl.NewMockScheme("tftp")
+	p := newParser(&url.URL{Scheme: "tftp", Host: "fuzz", Path: "/"}, curl.Schemes{"tftp": fs})
+	err := p.append(context.Background(), string(data))
+	return p, err
+}
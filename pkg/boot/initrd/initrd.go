@@ -0,0 +1,250 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package initrd reads initrds the way the kernel unpacks them: as a series
+// of cpio archives, each of which may be compressed, separated by zero
+// padding.
+//
+// Distributions commonly build an uncompressed segment holding CPU
+// microcode for the kernel's early loader, followed by a compressed segment
+// holding the root file system.
+package initrd
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/klauspost/pgzip"
+	"github.com/u-root/u-root/pkg/cpio"
+)
+
+// ErrUnsupportedCompression is returned for segments compressed with a
+// codec this package cannot decompress.
+var ErrUnsupportedCompression = errors.New("unsupported compression")
+
+// Compression formats.
+const (
+	None  = ""
+	Gzip  = "gzip"
+	Bzip2 = "bzip2"
+)
+
+var magics = []struct {
+	format string
+	magic  []byte
+}{
+	{Gzip, []byte{0x1f, 0x8b}},
+	{Bzip2, []byte("BZh")},
+	// Recognized only to give a useful error.
+	{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0}},
+	{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd}},
+	{"lz4", []byte{0x02, 0x21, 0x4c, 0x18}},
+	{"lzo", []byte{0x89, 'L', 'Z', 'O'}},
+	{"lzma", []byte{0x5d, 0x00, 0x00}},
+}
+
+var cpioMagics = [][]byte{[]byte("070701"), []byte("070702")}
+
+// maxDecompressed bounds how much of a compressed segment is inflated.
+const maxDecompressed = 1 << 30
+
+// Segment is one cpio archive in an initrd.
+type Segment struct {
+	// Offset is where the segment starts in the initrd.
+	Offset int64
+
+	// Compression is the compression format, None if the archive is
+	// stored as is.
+	Compression string
+
+	// Records are the files in the archive, without the trailer.
+	Records []cpio.Record
+}
+
+// Segments reads all segments of the initrd in r.
+//
+// A compressed segment is taken to hold the rest of the initrd. The kernel
+// does allow more segments after it, but no tool builds initrds like that.
+func Segments(r io.ReaderAt) ([]Segment, error) {
+	var segs []Segment
+	var pos int64
+	for {
+		var err error
+		if pos, err = skipPadding(r, pos); err == io.EOF {
+			return segs, nil
+		} else if err != nil {
+			return segs, err
+		}
+
+		head := make([]byte, 6)
+		n, err := r.ReadAt(head, pos)
+		if err != nil && err != io.EOF {
+			return segs, err
+		}
+		head = head[:n]
+
+		if isCPIO(head) {
+			s := Segment{Offset: pos}
+			if pos, err = readArchive(io.NewSectionReader(r, pos, 1<<62), &s); err != nil {
+				return segs, fmt.Errorf("segment at %#x: %v", s.Offset, err)
+			}
+			pos += s.Offset
+			segs = append(segs, s)
+			continue
+		}
+
+		format := detect(head)
+		if format == None {
+			return segs, fmt.Errorf("segment at %#x: neither cpio nor a known compression: % x", pos, head)
+		}
+		s := Segment{Offset: pos, Compression: format}
+		d, err := decompress(format, io.NewSectionReader(r, pos, 1<<62))
+		if err != nil {
+			return segs, fmt.Errorf("segment at %#x: %w", pos, err)
+		}
+		// A compressed segment may itself hold several archives.
+		dr := bytes.NewReader(d)
+		for off := int64(0); ; {
+			if off, err = skipPadding(dr, off); err == io.EOF {
+				break
+			} else if err != nil {
+				return segs, err
+			}
+			next, err := readArchive(io.NewSectionReader(dr, off, dr.Size()-off), &s)
+			if err != nil {
+				return segs, fmt.Errorf("%s segment at %#x: %v", format, s.Offset, err)
+			}
+			off += next
+		}
+		return append(segs, s), nil
+	}
+}
+
+// skipPadding returns the offset of the first non-zero byte at or after pos.
+func skipPadding(r io.ReaderAt, pos int64) (int64, error) {
+	b := make([]byte, 4096)
+	for {
+		n, err := r.ReadAt(b, pos)
+		for i := 0; i < n; i++ {
+			if b[i] != 0 {
+				return pos + int64(i), nil
+			}
+		}
+		if err != nil {
+			return pos + int64(n), err
+		}
+		pos += int64(n)
+	}
+}
+
+func isCPIO(head []byte) bool {
+	for _, m := range cpioMagics {
+		if bytes.HasPrefix(head, m) {
+			return true
+		}
+	}
+	return false
+}
+
+func detect(head []byte) string {
+	for _, m := range magics {
+		if bytes.HasPrefix(head, m.magic) {
+			return m.format
+		}
+	}
+	return None
+}
+
+func decompress(format string, r io.Reader) ([]byte, error) {
+	switch format {
+	case Gzip:
+		// pgzip inflates ahead of the reader on another core.
+		z, err := pgzip.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+		r = z
+	case Bzip2:
+		r = bzip2.NewReader(r)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedCompression, format)
+	}
+	d, err := ioutil.ReadAll(io.LimitReader(r, maxDecompressed))
+	if err != nil {
+		return nil, fmt.Errorf("decompressing %s: %v", format, err)
+	}
+	return d, nil
+}
+
+// readArchive appends the records of the archive at the start of r to s and
+// returns the offset just past its trailer.
+func readArchive(r io.ReaderAt, s *Segment) (int64, error) {
+	// Read below the EOFReader, which hides where the trailer ends.
+	rr := cpio.Newc.Reader(r)
+	if e, ok := rr.(cpio.EOFReader); ok {
+		rr = e.RecordReader
+	}
+	for {
+		rec, err := rr.ReadRecord()
+		if err == io.EOF {
+			return 0, fmt.Errorf("archive has no trailer")
+		}
+		if err != nil {
+			return 0, err
+		}
+		if rec.Name == cpio.Trailer {
+			return (rec.FilePos + int64(rec.FileSize) + 3) &^ 3, nil
+		}
+		s.Records = append(s.Records, rec)
+	}
+}
+
+// checkName returns rec's name normalized, or an error if it would land
+// outside the archive root.
+func checkName(rec cpio.Record) (string, error) {
+	name := cpio.Normalize(rec.Name)
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return "", fmt.Errorf("%q is outside the archive root", rec.Name)
+	}
+	return name, nil
+}
+
+// Extract creates rec in dir. Unlike cpio.CreateFileInRoot, it refuses
+// names that would land outside dir, also through a symlink an earlier
+// record made.
+func Extract(rec cpio.Record, dir string) error {
+	name, err := checkName(rec)
+	if err != nil {
+		return err
+	}
+	if err := cpio.CheckPath(dir, name); err != nil {
+		return err
+	}
+	rec.Name = name
+	return cpio.CreateFileInRoot(rec, dir, false)
+}
+
+// ExtractAll creates recs in dir with cpio.ExtractAll, writing files with
+// workers goroutines at once. Records of later segments replace those of
+// earlier ones with the same name, as when the kernel unpacks the initrd.
+// Like Extract, it refuses names that would land outside dir, and none of
+// the records are created if any would. Records that would be created
+// through a symlink are not created either; see cpio.CheckPath.
+func ExtractAll(recs []cpio.Record, dir string, workers int) error {
+	checked := make([]cpio.Record, 0, len(recs))
+	for _, rec := range recs {
+		name, err := checkName(rec)
+		if err != nil {
+			return err
+		}
+		rec.Name = name
+		checked = append(checked, rec)
+	}
+	return cpio.ExtractAll(checked, dir, workers, false)
+}
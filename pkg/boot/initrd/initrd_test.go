@@ -0,0 +1,223 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package initrd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/cpio"
+)
+
+func archive(t *testing.T, recs ...cpio.Record) []byte {
+	var b bytes.Buffer
+	w := cpio.Newc.Writer(&b)
+	if err := cpio.WriteRecords(w, recs); err != nil {
+		t.Fatal(err)
+	}
+	if err := cpio.WriteTrailer(w); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func gzipped(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	z := gzip.NewWriter(&buf)
+	if _, err := z.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// intelMicrocode returns an Intel microcode file of updates with no data.
+func intelMicrocode(revs ...uint32) []byte {
+	var b bytes.Buffer
+	for _, rev := range revs {
+		binary.Write(&b, binary.LittleEndian, intelHeader{
+			HeaderVersion: 1,
+			Revision:      rev,
+			Date:          0x06172020,
+			Signature:     0x000906ea,
+			DataSize:      16,
+			TotalSize:     intelHeaderSize + 16,
+		})
+		b.Write(make([]byte, 16))
+	}
+	return b.Bytes()
+}
+
+func names(s Segment) []string {
+	var n []string
+	for _, r := range s.Records {
+		n = append(n, r.Name)
+	}
+	return n
+}
+
+func TestSegments(t *testing.T) {
+	early := archive(t,
+		cpio.Directory("kernel", 0755),
+		cpio.Directory("kernel/x86", 0755),
+		cpio.Directory("kernel/x86/microcode", 0755),
+		cpio.StaticFile("kernel/x86/microcode/GenuineIntel.bin", string(intelMicrocode(0xd6, 0xd8)), 0644),
+	)
+	main := archive(t,
+		cpio.StaticFile("init", "#!/bin/sh\n", 0755),
+		cpio.Directory("etc", 0755),
+	)
+	extra := archive(t, cpio.StaticFile("etc/hostname", "box\n", 0644))
+
+	img := append([]byte{}, early...)
+	img = append(img, make([]byte, 512)...)
+	img = append(img, gzipped(t, append(append(main, make([]byte, 4)...), extra...))...)
+
+	segs, err := Segments(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(segs) != 2 {
+		t.Fatalf("Segments() = %d segments, want 2", len(segs))
+	}
+	if segs[0].Offset != 0 || segs[0].Compression != None {
+		t.Errorf("segment 0 at %#x, compression %q; want 0, none", segs[0].Offset, segs[0].Compression)
+	}
+	if segs[1].Offset != int64(len(early)+512) || segs[1].Compression != Gzip {
+		t.Errorf("segment 1 at %#x, compression %q; want %#x, gzip", segs[1].Offset, segs[1].Compression, len(early)+512)
+	}
+	if want := []string{"init", "etc", "etc/hostname"}; !reflect.DeepEqual(names(segs[1]), want) {
+		t.Errorf("segment 1 has %v, want %v", names(segs[1]), want)
+	}
+
+	mc := FindMicrocode(segs)
+	want := []Microcode{{
+		Segment: 0,
+		Name:    "kernel/x86/microcode/GenuineIntel.bin",
+		Vendor:  "GenuineIntel",
+		Size:    2 * (intelHeaderSize + 16),
+		Updates: []IntelUpdate{
+			{Signature: 0x000906ea, Revision: 0xd6, Date: "2020-06-17"},
+			{Signature: 0x000906ea, Revision: 0xd8, Date: "2020-06-17"},
+		},
+	}}
+	if !reflect.DeepEqual(mc, want) {
+		t.Errorf("FindMicrocode() = %+v, want %+v", mc, want)
+	}
+}
+
+func TestSegmentsErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		img  []byte
+		is   error
+	}{
+		{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0, 1, 2}, ErrUnsupportedCompression},
+		{"garbage", []byte("hi there"), nil},
+		{"truncated", archive(t, cpio.StaticFile("init", "x", 0755))[:200], nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Segments(bytes.NewReader(tt.img))
+			if err == nil {
+				t.Fatalf("Segments() = nil, want error")
+			}
+			if tt.is != nil && !errors.Is(err, tt.is) {
+				t.Errorf("Segments() = %v, want %v", err, tt.is)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	dir, err := ioutil.TempDir("", "initrd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := Extract(cpio.StaticFile("etc/hostname", "box\n", 0644), dir); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(filepath.Join(dir, "etc/hostname")); err != nil || string(b) != "box\n" {
+		t.Errorf("extracted etc/hostname = %q, %v; want %q", b, err, "box\n")
+	}
+	if err := Extract(cpio.StaticFile("../escape", "x", 0644), dir); err == nil {
+		t.Errorf("Extract(../escape) = nil, want error")
+	}
+
+	outside, err := ioutil.TempDir("", "initrd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	if err := Extract(cpio.Symlink("a", outside), dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := Extract(cpio.StaticFile("a/pwned", "x", 0644), dir); err == nil {
+		t.Errorf("Extract(a/pwned) through a symlink = nil, want error")
+	}
+	if _, err := os.Lstat(filepath.Join(outside, "pwned")); !os.IsNotExist(err) {
+		t.Errorf("Extract wrote %s through a symlink", filepath.Join(outside, "pwned"))
+	}
+}
+
+func TestExtractAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "initrd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	img := append(archive(t, cpio.StaticFile("etc/hostname", "early\n", 0644)),
+		gzipped(t, archive(t,
+			cpio.Directory("etc", 0755),
+			cpio.StaticFile("etc/hostname", "box\n", 0644),
+			cpio.StaticFile("init", "#!/bin/sh\n", 0755),
+		))...)
+	segs, err := Segments(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var recs []cpio.Record
+	for _, s := range segs {
+		recs = append(recs, s.Records...)
+	}
+	if err := ExtractAll(recs, dir, 2); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{"etc/hostname": "box\n", "init": "#!/bin/sh\n"} {
+		if b, err := ioutil.ReadFile(filepath.Join(dir, name)); err != nil || string(b) != want {
+			t.Errorf("extracted %s = %q, %v; want %q", name, b, err, want)
+		}
+	}
+
+	if err := ExtractAll([]cpio.Record{cpio.StaticFile("ok", "x", 0644), cpio.StaticFile("../escape", "x", 0644)}, dir, 2); err == nil {
+		t.Errorf("ExtractAll(../escape) = nil, want error")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "ok")); !os.IsNotExist(err) {
+		t.Errorf("ExtractAll(../escape) created other files")
+	}
+
+	outside, err := ioutil.TempDir("", "initrd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(outside)
+	if err := ExtractAll([]cpio.Record{cpio.Symlink("a", outside), cpio.StaticFile("a/pwned", "x", 0644)}, dir, 2); err == nil {
+		t.Errorf("ExtractAll(a/pwned) through a symlink = nil, want error")
+	}
+	if _, err := os.Lstat(filepath.Join(outside, "pwned")); !os.IsNotExist(err) {
+		t.Errorf("ExtractAll wrote %s through a symlink", filepath.Join(outside, "pwned"))
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package initrd
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/cpio"
+	"golang.org/x/sys/unix"
+)
+
+// microcodeDir is where the kernel's early loader looks for microcode,
+// Documentation/x86/microcode.rst.
+const microcodeDir = "kernel/x86/microcode"
+
+// Microcode is a microcode file for the kernel's early loader.
+type Microcode struct {
+	// Segment is the index of the segment holding the file.
+	Segment int
+	Name    string
+	Vendor  string
+	Size    uint64
+
+	// Updates are the updates in an Intel microcode file. They are not
+	// decoded for other vendors.
+	Updates []IntelUpdate
+}
+
+// IntelUpdate is the header of one update in an Intel microcode file.
+type IntelUpdate struct {
+	// Signature is the CPUID signature of the processor it applies to.
+	Signature uint32
+	Revision  uint32
+	// Date is as found in the file, year-month-day.
+	Date string
+}
+
+// String formats u like iucode_tool.
+func (u IntelUpdate) String() string {
+	return fmt.Sprintf("sig %#08x, rev %#x, date %s", u.Signature, u.Revision, u.Date)
+}
+
+// FindMicrocode returns the early microcode files in segs.
+//
+// The kernel only finds microcode in the uncompressed segments before the
+// first compressed one, but all segments are searched so a misplaced file
+// shows up too.
+func FindMicrocode(segs []Segment) []Microcode {
+	var mc []Microcode
+	for i, s := range segs {
+		for _, r := range s.Records {
+			name := cpio.Normalize(r.Name)
+			if path.Dir(name) != microcodeDir || r.Mode&unix.S_IFMT != unix.S_IFREG {
+				continue
+			}
+			m := Microcode{
+				Segment: i,
+				Name:    name,
+				Vendor:  strings.TrimSuffix(path.Base(name), ".bin"),
+				Size:    r.FileSize,
+			}
+			if m.Vendor == "GenuineIntel" {
+				m.Updates, _ = intelUpdates(r, int64(r.FileSize))
+			}
+			mc = append(mc, m)
+		}
+	}
+	return mc
+}
+
+// Intel microcode update header, Intel SDM volume 3, 9.11.1.
+type intelHeader struct {
+	HeaderVersion  uint32
+	Revision       uint32
+	Date           uint32
+	Signature      uint32
+	Checksum       uint32
+	LoaderRevision uint32
+	ProcessorFlags uint32
+	DataSize       uint32
+	TotalSize      uint32
+	_              [3]uint32
+}
+
+const intelHeaderSize = 48
+
+// intelUpdates returns the updates in an Intel microcode file, as many as
+// could be read.
+func intelUpdates(r io.ReaderAt, size int64) ([]IntelUpdate, error) {
+	var updates []IntelUpdate
+	for off := int64(0); off+intelHeaderSize <= size; {
+		var h intelHeader
+		if err := binary.Read(io.NewSectionReader(r, off, intelHeaderSize), binary.LittleEndian, &h); err != nil {
+			return updates, err
+		}
+		if h.HeaderVersion != 1 {
+			return updates, fmt.Errorf("update at %#x: header version %d", off, h.HeaderVersion)
+		}
+		updates = append(updates, IntelUpdate{
+			Signature: h.Signature,
+			Revision:  h.Revision,
+			// The date is BCD, mmddyyyy.
+			Date: fmt.Sprintf("%04x-%02x-%02x", h.Date&0xffff, h.Date>>24, (h.Date>>16)&0xff),
+		})
+		// Sizes of 0 mean the original 2000 byte data, 2048 in total.
+		total := int64(h.TotalSize)
+		if h.DataSize == 0 {
+			total = 2048
+		}
+		if total < intelHeaderSize {
+			return updates, fmt.Errorf("update at %#x: total size %d", off, total)
+		}
+		off += total
+	}
+	return updates, nil
+}
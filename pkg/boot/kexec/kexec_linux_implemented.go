@@ -18,7 +18,17 @@ import (
 //
 // The kexec_file_load(2) syscall is x86-64 and arm64 only.
 func FileLoad(kernel, ramfs *os.File, cmdline string) error {
-	var flags int
+	return fileLoad(kernel, ramfs, cmdline, 0)
+}
+
+// FileLoadCrash loads the given kernel as the crash kernel, which the
+// kernel boots into when it panics, with the given ramfs and cmdline. The
+// kernel must have been booted with crashkernel= to reserve memory for it.
+func FileLoadCrash(kernel, ramfs *os.File, cmdline string) error {
+	return fileLoad(kernel, ramfs, cmdline, unix.KEXEC_FILE_ON_CRASH)
+}
+
+func fileLoad(kernel, ramfs *os.File, cmdline string, flags int) error {
 	var ramfsfd int
 	if ramfs != nil {
 		ramfsfd = int(ramfs.Fd())
@@ -14,3 +14,7 @@ import (
 func FileLoad(kernel, ramfs *os.File, cmdline string) error {
 	return syscall.ENOSYS
 }
+
+func FileLoadCrash(kernel, ramfs *os.File, cmdline string) error {
+	return syscall.ENOSYS
+}
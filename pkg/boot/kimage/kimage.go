@@ -0,0 +1,259 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package kimage identifies Linux kernel images: what architecture they are
+// built for, which Linux release they are, and how they are booted.
+//
+// It understands x86 bzImages, arm64 and RISC-V Images, 32-bit ARM zImages
+// and ELF vmlinux files, bare or gzip compressed.
+package kimage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Format is a kernel image format.
+type Format string
+
+// Kernel image formats.
+const (
+	FormatBzImage    Format = "bzImage"
+	FormatZImage     Format = "zImage"
+	FormatARM64Image Format = "arm64 Image"
+	FormatRISCVImage Format = "RISC-V Image"
+	FormatARMZImage  Format = "ARM zImage"
+	FormatELF        Format = "ELF"
+)
+
+var (
+	// ErrUnknownFormat is returned for files that are not kernel images.
+	ErrUnknownFormat = errors.New("not a known kernel image format")
+
+	// ErrUnsupportedCompression is returned for kernels compressed with
+	// something other than gzip.
+	ErrUnsupportedCompression = errors.New("unsupported compression")
+)
+
+// Info is what could be found out about a kernel image.
+type Info struct {
+	Format Format
+
+	// Arch is the architecture the kernel runs on, as a GOARCH value.
+	Arch string
+
+	// Protocol is the boot protocol version for formats that carry one,
+	// e.g. "2.13" for an x86 bzImage.
+	Protocol string
+
+	// Compression is set if the image file was compressed as a whole,
+	// e.g. "gzip" for an arm64 Image.gz.
+	Compression string
+
+	// Release is the kernel release as printed by uname -r, e.g.
+	// "5.4.0-42-generic". Version is the whole version string the release
+	// is taken from. Both are empty if the image has no version string
+	// that can be found without decompressing the kernel.
+	Release string
+	Version string
+}
+
+// String returns a one-line description of the image.
+func (i *Info) String() string {
+	s := fmt.Sprintf("%s %s", i.Arch, i.Format)
+	if i.Protocol != "" {
+		s += " protocol " + i.Protocol
+	}
+	if i.Compression != "" {
+		s += " (" + i.Compression + ")"
+	}
+	if i.Release != "" {
+		s += ", Linux " + i.Release
+	}
+	return s
+}
+
+// CheckArch returns an error if the kernel cannot run on goarch.
+func (i *Info) CheckArch(goarch string) error {
+	if i.Arch != goarch {
+		return fmt.Errorf("%s kernel cannot be booted on %s", i.Arch, goarch)
+	}
+	return nil
+}
+
+// maxDecompressed bounds how much of a compressed image is inflated.
+const maxDecompressed = 256 << 20
+
+// Inspect identifies the kernel image in r.
+func Inspect(r io.ReaderAt) (*Info, error) {
+	var magic [6]byte
+	if _, err := r.ReadAt(magic[:], 0); err != nil {
+		return nil, fmt.Errorf("reading kernel image: %v", err)
+	}
+	switch {
+	case magic[0] == 0x1f && magic[1] == 0x8b:
+		z, err := gzip.NewReader(io.NewSectionReader(r, 0, 1<<62))
+		if err != nil {
+			return nil, err
+		}
+		d, err := ioutil.ReadAll(io.LimitReader(z, maxDecompressed))
+		if err != nil {
+			return nil, fmt.Errorf("decompressing kernel image: %v", err)
+		}
+		i, err := inspect(bytes.NewReader(d))
+		if err != nil {
+			return nil, err
+		}
+		i.Compression = "gzip"
+		return i, nil
+	case bytes.Equal(magic[:], []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		return nil, fmt.Errorf("%w: xz", ErrUnsupportedCompression)
+	case bytes.Equal(magic[:4], []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		return nil, fmt.Errorf("%w: zstd", ErrUnsupportedCompression)
+	case bytes.Equal(magic[:3], []byte("BZh")):
+		return nil, fmt.Errorf("%w: bzip2", ErrUnsupportedCompression)
+	case bytes.Equal(magic[:4], []byte{0x02, 0x21, 0x4c, 0x18}):
+		return nil, fmt.Errorf("%w: lz4", ErrUnsupportedCompression)
+	}
+	return inspect(r)
+}
+
+func inspect(r io.ReaderAt) (*Info, error) {
+	// Room for the largest header looked at, the x86 setup header.
+	hdr := make([]byte, 0x268)
+	n, err := r.ReadAt(hdr, 0)
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("reading kernel image: %v", err)
+	}
+	hdr = hdr[:n]
+
+	switch {
+	case len(hdr) >= 0x208 && string(hdr[0x202:0x206]) == "HdrS":
+		return inspectX86(r, hdr)
+	case len(hdr) >= 0x40 && string(hdr[0x38:0x3c]) == "ARM\x64":
+		return scanVersion(r, &Info{Format: FormatARM64Image, Arch: "arm64"})
+	case len(hdr) >= 0x40 && string(hdr[0x30:0x38]) == "RISCV\x00\x00\x00":
+		v := binary.LittleEndian.Uint32(hdr[0x28:])
+		return scanVersion(r, &Info{
+			Format:   FormatRISCVImage,
+			Arch:     "riscv64",
+			Protocol: fmt.Sprintf("%d.%d", v>>16, v&0xffff),
+		})
+	case len(hdr) >= 0x30 && binary.LittleEndian.Uint32(hdr[0x24:]) == 0x016f2818:
+		return scanVersion(r, &Info{Format: FormatARMZImage, Arch: "arm"})
+	case len(hdr) >= 4 && string(hdr[:4]) == elf.ELFMAG:
+		return inspectELF(r)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// x86 setup header fields, Documentation/x86/boot.rst.
+const (
+	x86LoadFlags     = 0x211
+	x86KernelVersion = 0x20e
+	x86XLoadFlags    = 0x236
+
+	loadedHigh  = 0x01
+	xlfKernel64 = 0x01
+)
+
+func inspectX86(r io.ReaderAt, hdr []byte) (*Info, error) {
+	proto := binary.LittleEndian.Uint16(hdr[0x206:])
+	i := &Info{
+		Format:   FormatZImage,
+		Arch:     "386",
+		Protocol: fmt.Sprintf("%d.%02d", proto>>8, proto&0xff),
+	}
+	if proto >= 0x200 && len(hdr) > x86LoadFlags && hdr[x86LoadFlags]&loadedHigh != 0 {
+		i.Format = FormatBzImage
+	}
+	// Kernels that cannot be entered in 64-bit mode cannot be kexec'd
+	// from a 64-bit kernel, so call them 386 whatever they run in later.
+	if proto >= 0x20c && len(hdr) > x86XLoadFlags && hdr[x86XLoadFlags]&xlfKernel64 != 0 {
+		i.Arch = "amd64"
+	}
+	// The version string lives in the setup code, which is not
+	// compressed, at an offset from the start of the header sector.
+	if off := binary.LittleEndian.Uint16(hdr[x86KernelVersion:]); proto >= 0x200 && off != 0 {
+		b := make([]byte, 256)
+		n, err := r.ReadAt(b, int64(off)+0x200)
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("reading kernel version: %v", err)
+		}
+		i.setVersion(cstring(b[:n]))
+	}
+	return i, nil
+}
+
+var elfArch = map[elf.Machine]map[elf.Class]string{
+	elf.EM_386:     {elf.ELFCLASS32: "386"},
+	elf.EM_X86_64:  {elf.ELFCLASS64: "amd64"},
+	elf.EM_ARM:     {elf.ELFCLASS32: "arm"},
+	elf.EM_AARCH64: {elf.ELFCLASS64: "arm64"},
+	elf.EM_RISCV:   {elf.ELFCLASS64: "riscv64"},
+	elf.EM_PPC64:   {elf.ELFCLASS64: "ppc64le"},
+}
+
+func inspectELF(r io.ReaderAt) (*Info, error) {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return nil, err
+	}
+	arch, ok := elfArch[f.Machine][f.Class]
+	if !ok {
+		return nil, fmt.Errorf("ELF kernel for unknown machine %v", f.Machine)
+	}
+	if arch == "ppc64le" && f.ByteOrder == binary.BigEndian {
+		arch = "ppc64"
+	}
+	return scanVersion(r, &Info{Format: FormatELF, Arch: arch})
+}
+
+var banner = []byte("Linux version ")
+
+// scanVersion looks for the banner printed by the kernel at boot. Only
+// uncompressed kernels carry it in the clear; for the rest Release stays
+// empty.
+func scanVersion(r io.ReaderAt, i *Info) (*Info, error) {
+	const chunk = 1 << 20
+	// Overlap chunks so a banner across a boundary is seen whole.
+	const overlap = 512
+
+	b := make([]byte, chunk+overlap)
+	for off := int64(0); ; off += chunk {
+		n, err := r.ReadAt(b, off)
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("reading kernel image: %v", err)
+		}
+		if x := bytes.Index(b[:n], banner); x >= 0 {
+			i.setVersion(cstring(b[x+len(banner) : n]))
+			return i, nil
+		}
+		if n < len(b) {
+			return i, nil
+		}
+	}
+}
+
+// cstring returns b up to the first NUL or newline.
+func cstring(b []byte) string {
+	if x := bytes.IndexAny(b, "\x00\n"); x >= 0 {
+		b = b[:x]
+	}
+	return string(b)
+}
+
+func (i *Info) setVersion(v string) {
+	i.Version = v
+	if f := strings.Fields(v); len(f) > 0 {
+		i.Release = f[0]
+	}
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kimage
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func arm64Image(version string) []byte {
+	b := make([]byte, 4096)
+	copy(b[0x38:], "ARM\x64")
+	copy(b[2000:], "Linux version "+version+"\n\x00")
+	return b
+}
+
+func riscvImage() []byte {
+	b := make([]byte, 64)
+	binary.LittleEndian.PutUint32(b[0x28:], 0x00000002)
+	copy(b[0x30:], "RISCV\x00\x00\x00")
+	copy(b[0x38:], "RSC\x05")
+	return b
+}
+
+func gzipped(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	z := gzip.NewWriter(&buf)
+	if _, err := z.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestInspect(t *testing.T) {
+	const v = "5.4.0-42-generic (buildd@lgw01-amd64-038) #46-Ubuntu SMP Fri Jul 10 00:24:02 UTC 2020"
+	for _, tt := range []struct {
+		name string
+		img  []byte
+		want *Info
+	}{
+		{
+			name: "arm64",
+			img:  arm64Image(v),
+			want: &Info{Format: FormatARM64Image, Arch: "arm64", Release: "5.4.0-42-generic", Version: v},
+		},
+		{
+			name: "arm64 gzip",
+			img:  gzipped(t, arm64Image(v)),
+			want: &Info{Format: FormatARM64Image, Arch: "arm64", Compression: "gzip", Release: "5.4.0-42-generic", Version: v},
+		},
+		{
+			name: "riscv",
+			img:  riscvImage(),
+			want: &Info{Format: FormatRISCVImage, Arch: "riscv64", Protocol: "0.2"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Inspect(bytes.NewReader(tt.img))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Inspect() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInspectBzImage(t *testing.T) {
+	f, err := os.Open("../bzimage/testdata/bzImage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	got, err := Inspect(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Info{
+		Format:   FormatBzImage,
+		Arch:     "amd64",
+		Protocol: "2.13",
+		Release:  "4.12.7",
+		Version:  "4.12.7 (rminnich@uroot) #6 Fri Aug 10 14:47:18 PDT 2018",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Inspect() = %+v, want %+v", got, want)
+	}
+	if err := got.CheckArch("amd64"); err != nil {
+		t.Errorf("CheckArch(amd64) = %v, want nil", err)
+	}
+	if err := got.CheckArch("arm64"); err == nil {
+		t.Errorf("CheckArch(arm64) = nil, want error")
+	}
+}
+
+func TestInspectErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		img  []byte
+		want error
+	}{
+		{"garbage", bytes.Repeat([]byte("hi there"), 100), ErrUnknownFormat},
+		{"short", []byte("hi there"), ErrUnknownFormat},
+		{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0, 0}, ErrUnsupportedCompression},
+		{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd, 0, 0}, ErrUnsupportedCompression},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Inspect(bytes.NewReader(tt.img)); !errors.Is(err, tt.want) {
+				t.Errorf("Inspect() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
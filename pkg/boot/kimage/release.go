@@ -0,0 +1,79 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kimage
+
+import (
+	"strconv"
+	"strings"
+)
+
+// splitRelease splits a release into runs of digits and runs of anything
+// else, e.g. "5.10.0-rc1" into "5", ".", "10", ".", "0", "-rc", "1".
+func splitRelease(r string) []string {
+	var parts []string
+	for len(r) > 0 {
+		digit := isDigit(r[0])
+		n := 1
+		for n < len(r) && isDigit(r[n]) == digit {
+			n++
+		}
+		parts = append(parts, r[:n])
+		r = r[n:]
+	}
+	return parts
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// CompareRelease compares two kernel releases, returning -1, 0 or 1 if a
+// is older than, the same as or newer than b.
+//
+// Numbers compare as numbers, so 5.10 is newer than 5.4. A release that
+// is a prefix of another is older, except that release candidates are
+// older than the release they lead up to.
+func CompareRelease(a, b string) int {
+	pa, pb := splitRelease(a), splitRelease(b)
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		if c := compareParts(pa[i], pb[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(pa) == len(pb):
+		return 0
+	case len(pa) > len(pb):
+		if isRC(pa[len(pb)]) {
+			return -1
+		}
+		return 1
+	default:
+		if isRC(pb[len(pa)]) {
+			return 1
+		}
+		return -1
+	}
+}
+
+func compareParts(a, b string) int {
+	if isDigit(a[0]) && isDigit(b[0]) {
+		// Releases don't have numbers that overflow.
+		na, _ := strconv.ParseUint(a, 10, 64)
+		nb, _ := strconv.ParseUint(b, 10, 64)
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(a, b)
+}
+
+func isRC(part string) bool {
+	return strings.HasPrefix(part, "-rc")
+}
@@ -0,0 +1,28 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kimage
+
+import "testing"
+
+func TestCompareRelease(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{"5.4.0", "5.4.0", 0},
+		{"5.10.0", "5.4.0", 1},
+		{"5.4.0-42-generic", "5.4.0-100-generic", -1},
+		{"4.19.0-9-amd64", "5.4.0", -1},
+		{"5.10.0-rc1", "5.10.0", -1},
+		{"5.10.0", "5.10.0-rc1", 1},
+		{"5.10.0-rc2", "5.10.0-rc10", -1},
+		{"5.4.0", "5.4.0.1", -1},
+		{"5.4.0-1-amd64", "5.4.0", 1},
+	} {
+		if got := CompareRelease(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareRelease(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
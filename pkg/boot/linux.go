@@ -11,8 +11,10 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"runtime"
 
 	"github.com/u-root/u-root/pkg/boot/kexec"
+	"github.com/u-root/u-root/pkg/boot/kimage"
 	"github.com/u-root/u-root/pkg/uio"
 )
 
@@ -104,6 +106,18 @@ func (li *LinuxImage) Load(verbose bool) error {
 	}
 	defer k.Close()
 
+	// Images the kernel would not recognize are left for kexec to reject,
+	// but one built for another architecture is refused here with a
+	// better error than kexec would give.
+	if info, err := kimage.Inspect(k); err == nil {
+		if err := info.CheckArch(runtime.GOARCH); err != nil {
+			return err
+		}
+		if verbose {
+			log.Printf("Kernel image: %s", info)
+		}
+	}
+
 	var i *os.File
 	if li.Initrd != nil {
 		i, err = copyToFile(initrd)
@@ -120,3 +134,12 @@ func (li *LinuxImage) Load(verbose bool) error {
 	log.Printf("Command line: %s", li.Cmdline)
 	return kexec.FileLoad(k, i, li.Cmdline)
 }
+
+// KernelInfo inspects the kernel image. It reads the kernel, so a kernel
+// fetched over the network is downloaded.
+func (li *LinuxImage) KernelInfo() (*kimage.Info, error) {
+	if li.Kernel == nil {
+		return nil, errors.New("LinuxImage.Kernel must be non-nil")
+	}
+	return kimage.Inspect(li.Kernel)
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localboot
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/mount"
+	"github.com/u-root/u-root/pkg/mount/block"
+)
+
+func init() {
+	boot.ChainLoader = chainLoad
+}
+
+// sysfsBlock is where partition information is read from. It is a
+// variable so tests can substitute it.
+var sysfsBlock = "/sys/class/block"
+
+// partition describes a block device that is a partition.
+type partition struct {
+	disk  string
+	num   int
+	label string
+}
+
+// partitionInfo returns whether name is a partition, and if so which.
+func partitionInfo(name string) (partition, bool) {
+	dir := filepath.Join(sysfsBlock, name)
+	b, err := ioutil.ReadFile(filepath.Join(dir, "partition"))
+	if err != nil {
+		return partition{}, false
+	}
+	p := partition{}
+	p.num, _ = strconv.Atoi(strings.TrimSpace(string(b)))
+
+	// /sys/class/block/sda1 links to .../block/sda/sda1.
+	if target, err := os.Readlink(dir); err == nil {
+		p.disk = filepath.Base(filepath.Dir(target))
+	}
+	if uevent, err := ioutil.ReadFile(filepath.Join(dir, "uevent")); err == nil {
+		for _, line := range strings.Split(string(uevent), "\n") {
+			if strings.HasPrefix(line, "PARTNAME=") {
+				p.label = strings.TrimPrefix(line, "PARTNAME=")
+			}
+		}
+	}
+	return p, true
+}
+
+// chainTargets returns the devices among devs that c selects.
+//
+// Disks are numbered in the order devs lists them, which need not match
+// the firmware's order; "hd0" is just the first disk we see.
+func chainTargets(c *boot.ChainImage, devs block.BlockDevices) (block.BlockDevices, error) {
+	var disks []string
+	parts := make(map[string]partition)
+	for _, d := range devs {
+		if p, ok := partitionInfo(d.Name); ok {
+			parts[d.Name] = p
+		} else {
+			disks = append(disks, d.Name)
+		}
+	}
+
+	var disk string
+	if c.Disk >= 0 {
+		if c.Disk >= len(disks) {
+			return nil, fmt.Errorf("no disk hd%d, only %d disks", c.Disk, len(disks))
+		}
+		disk = disks[c.Disk]
+	}
+
+	var targets block.BlockDevices
+	for _, d := range devs {
+		p, isPart := parts[d.Name]
+		if len(disk) > 0 && d.Name != disk && p.disk != disk {
+			continue
+		}
+		if c.Partition > 0 && (!isPart || p.num != c.Partition) {
+			continue
+		}
+		if len(c.PartLabel) > 0 && (!isPart || p.label != c.PartLabel) {
+			continue
+		}
+		if len(c.PartGUID) > 0 && (!isPart || !hasPartGUID(p, c.PartGUID)) {
+			continue
+		}
+		targets = append(targets, d)
+	}
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no matching block device")
+	}
+	return targets, nil
+}
+
+// hasPartGUID reports whether p's unique GUID in its disk's GPT is guid.
+func hasPartGUID(p partition, guid string) bool {
+	table, err := (&block.BlockDev{Name: p.disk}).GPTTable()
+	if err != nil || p.num < 1 || p.num > len(table.Partitions) {
+		return false
+	}
+	return strings.EqualFold(table.Partitions[p.num-1].Id.String(), guid)
+}
+
+// chainLoad finds the first bootable OS on the devices c selects. Devices
+// that have nothing to boot are unmounted again; the chosen one stays
+// mounted so the OS can be loaded from it.
+func chainLoad(c *boot.ChainImage) (boot.OSImage, error) {
+	devs, err := block.GetBlockDevices()
+	if err != nil {
+		return nil, err
+	}
+	targets, err := chainTargets(c, devs.FilterZeroSize())
+	if err != nil {
+		return nil, err
+	}
+
+	mountDir, err := ioutil.TempDir("", "u-root-chain")
+	if err != nil {
+		return nil, fmt.Errorf("cannot create tmpdir: %v", err)
+	}
+
+	var chosen boot.OSImage
+	for _, s := range Scan(context.Background(), targets, mountDir, DefaultWorkers, DefaultDeviceTimeout) {
+		var keep bool
+		for _, img := range s.Images {
+			// A disk that itself says "boot the local disk" would
+			// send us round in circles.
+			if _, ok := img.(*boot.ChainImage); ok {
+				continue
+			}
+			if chosen == nil {
+				chosen, keep = img, true
+			}
+		}
+		if s.Mount != nil && !keep {
+			s.Mount.Unmount(mount.MNT_DETACH)
+		}
+	}
+	if chosen == nil {
+		return nil, fmt.Errorf("nothing bootable on %v", targets)
+	}
+	return chosen, nil
+}
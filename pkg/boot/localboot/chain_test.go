@@ -0,0 +1,94 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localboot
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/mount/block"
+)
+
+// fakeSysfs lays out /sys/class/block for two disks with partitions.
+func fakeSysfs(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	class := filepath.Join(dir, "class")
+	if err := os.MkdirAll(class, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range []struct {
+		disk, name string
+		num        int
+		label      string
+	}{
+		{"sda", "sda", 0, ""},
+		{"sda", "sda1", 1, "EFI"},
+		{"sda", "sda2", 2, "ROOT-A"},
+		{"nvme0n1", "nvme0n1", 0, ""},
+		{"nvme0n1", "nvme0n1p1", 1, "ROOT-B"},
+	} {
+		dev := filepath.Join(dir, "devices", d.disk)
+		if d.num > 0 {
+			dev = filepath.Join(dev, d.name)
+		}
+		if err := os.MkdirAll(dev, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if d.num > 0 {
+			ioutil.WriteFile(filepath.Join(dev, "partition"), []byte(fmt.Sprintf("%d\n", d.num)), 0644)
+			ioutil.WriteFile(filepath.Join(dev, "uevent"), []byte(fmt.Sprintf("DEVNAME=%s\nPARTN=%d\nPARTNAME=%s\n", d.name, d.num, d.label)), 0644)
+		}
+		if err := os.Symlink(dev, filepath.Join(class, d.name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestChainTargets(t *testing.T) {
+	dir := fakeSysfs(t)
+	defer os.RemoveAll(dir)
+	defer func(old string) { sysfsBlock = old }(sysfsBlock)
+	sysfsBlock = filepath.Join(dir, "class")
+
+	devs := block.BlockDevices{
+		{Name: "sda"}, {Name: "sda1"}, {Name: "sda2"}, {Name: "nvme0n1"}, {Name: "nvme0n1p1"},
+	}
+	for _, tt := range []struct {
+		c    boot.ChainImage
+		want string
+	}{
+		{boot.ChainImage{Disk: -1}, "[sda sda1 sda2 nvme0n1 nvme0n1p1]"},
+		{boot.ChainImage{Disk: 0}, "[sda sda1 sda2]"},
+		{boot.ChainImage{Disk: 1}, "[nvme0n1 nvme0n1p1]"},
+		{boot.ChainImage{Disk: 0, Partition: 2}, "[sda2]"},
+		{boot.ChainImage{Disk: -1, Partition: 1}, "[sda1 nvme0n1p1]"},
+		{boot.ChainImage{Disk: -1, PartLabel: "ROOT-B"}, "[nvme0n1p1]"},
+		{boot.ChainImage{Disk: 2}, "error"},
+		{boot.ChainImage{Disk: 0, PartLabel: "ROOT-B"}, "error"},
+	} {
+		var got string
+		targets, err := chainTargets(&tt.c, devs)
+		if err != nil {
+			got = "error"
+		} else {
+			var names []string
+			for _, d := range targets {
+				names = append(names, d.Name)
+			}
+			got = fmt.Sprint(names)
+		}
+		if got != tt.want {
+			t.Errorf("chainTargets(%s) = %s, want %s", tt.c.Label(), got, tt.want)
+		}
+	}
+}
@@ -13,42 +13,265 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/u-root/u-root/pkg/boot"
 	"github.com/u-root/u-root/pkg/boot/bls"
 	"github.com/u-root/u-root/pkg/boot/grub"
 	"github.com/u-root/u-root/pkg/boot/syslinux"
+	"github.com/u-root/u-root/pkg/fs"
+	_ "github.com/u-root/u-root/pkg/fs/exfat"
+	_ "github.com/u-root/u-root/pkg/fs/f2fs"
+	_ "github.com/u-root/u-root/pkg/fs/xfs"
 	"github.com/u-root/u-root/pkg/mount"
 	"github.com/u-root/u-root/pkg/mount/block"
 	"github.com/u-root/u-root/pkg/ulog"
 )
 
-func parse(device *block.BlockDev, mountDir string) []boot.OSImage {
-	imgs, err := bls.ScanBLSEntries(ulog.Log, mountDir)
+const (
+	// DefaultWorkers is how many devices Localboot scans at once.
+	DefaultWorkers = 8
+
+	// DefaultDeviceTimeout bounds how long Localboot spends on one device.
+	DefaultDeviceTimeout = 30 * time.Second
+)
+
+// ConfigScan is the outcome of looking for one boot loader's configs on a
+// device.
+type ConfigScan struct {
+	// Format is the boot loader, e.g. "grub".
+	Format string
+
+	// Images are the boot images found.
+	Images []boot.OSImage
+
+	// Err is why no images were found. It wraps boot.ErrNoConfig if there
+	// was no config, and is a *boot.ConfigError for parse errors.
+	Err error
+
+	// Skipped says why entries were left out, for formats that skip bad
+	// entries rather than fail.
+	Skipped []string
+
+	// Auth says who may boot the images, for GRUB configs.
+	Auth *grub.Auth
+}
+
+// skipLogger collects messages about skipped entries.
+type skipLogger struct {
+	msgs []string
+}
+
+func (l *skipLogger) Printf(format string, v ...interface{}) {
+	l.msgs = append(l.msgs, fmt.Sprintf(format, v...))
+	ulog.Log.Printf(format, v...)
+}
+
+func (l *skipLogger) Print(v ...interface{}) {
+	l.msgs = append(l.msgs, fmt.Sprint(v...))
+	ulog.Log.Print(v...)
+}
+
+func parse(ctx context.Context, device *block.BlockDev, mountDir string) []ConfigScan {
+	var configs []ConfigScan
+
+	l := &skipLogger{}
+	imgs, err := bls.ScanBLSEntries(l, mountDir)
+	if err == nil && len(imgs) == 0 && len(l.msgs) == 0 {
+		err = fmt.Errorf("BootLoaderSpec: %w", boot.ErrNoConfig)
+	}
 	if err != nil {
 		log.Printf("Failed to parse systemd-boot BootLoaderSpec configs, trying another format...: %v", err)
 	}
+	configs = append(configs, ConfigScan{Format: "bls", Images: imgs, Err: err, Skipped: l.msgs})
 
-	grubImgs, err := grub.ParseLocalConfig(context.Background(), mountDir)
+	imgs, auth, err := grub.ParseLocalConfigAuth(ctx, mountDir)
 	if err != nil {
 		log.Printf("Failed to parse GRUB configs from %s, trying another format...: %v", device, err)
 	}
-	imgs = append(imgs, grubImgs...)
+	configs = append(configs, ConfigScan{Format: "grub", Images: imgs, Err: err, Auth: auth})
 
-	syslinuxImgs, err := syslinux.ParseLocalConfig(context.Background(), mountDir)
+	imgs, err = syslinux.ParseLocalConfig(ctx, mountDir)
 	if err != nil {
 		log.Printf("Failed to parse syslinux configs from %s: %v", device, err)
 	}
-	imgs = append(imgs, syslinuxImgs...)
+	configs = append(configs, ConfigScan{Format: "syslinux", Images: imgs, Err: err})
+
+	return configs
+}
+
+// DeviceScan is the outcome of scanning one block device.
+type DeviceScan struct {
+	Device *block.BlockDev
+
+	// Images are the boot images found on the device.
+	Images []boot.OSImage
+
+	// Configs are the results for each boot loader format.
+	Configs []ConfigScan
+
+	// Mount is where the device is mounted, if it could be.
+	Mount *mount.MountPoint
+
+	// Duration is how long the scan took.
+	Duration time.Duration
+
+	// Err is why the device could not be scanned.
+	Err error
+}
+
+// scanDevice mounts device under mountDir and parses its boot configs.
+// If the kernel cannot mount it, its boot files are read with u-root's
+// file system readers instead, and there is no mount point.
+//
+// It is a variable so tests can substitute it.
+var scanDevice = func(ctx context.Context, device *block.BlockDev, mountDir string) ([]ConfigScan, *mount.MountPoint, error) {
+	dir := filepath.Join(mountDir, device.Name)
+	os.MkdirAll(dir, 0777)
+	mp, err := device.Mount(dir, mount.ReadOnly)
+	if err != nil {
+		if rerr := extractBoot(device.DevicePath(), dir); rerr != nil {
+			return nil, nil, fmt.Errorf("%v; reading without mounting: %v", err, rerr)
+		}
+		return parse(ctx, device, dir), nil, nil
+	}
+	return parse(ctx, device, dir), mp, nil
+}
+
+// bootDirs are the top-level directories extractBoot copies: where boot
+// loaders keep their configs, and often kernels.
+var bootDirs = []string{"boot", "efi", "loader", "grub", "grub2", "syslinux", "isolinux", "extlinux"}
+
+// maxTopLevelFile bounds the top-level files extractBoot copies. Kernels
+// and initramfses sit there on a separate /boot; ISOs and disk images on
+// a USB stick should not be copied into memory.
+const maxTopLevelFile = 256 << 20
+
+// extractBoot reads the file system on devPath in Go and copies its boot
+// directories and top-level files to dir, for the config parsers.
+func extractBoot(devPath, dir string) error {
+	f, err := os.Open(devPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fsys, name, err := fs.New(f)
+	if err != nil {
+		return err
+	}
+	fis, err := fsys.ReadDir("/")
+	if err != nil {
+		return err
+	}
+	log.Printf("Reading %s file system on %s without mounting it", name, devPath)
+	for _, fi := range fis {
+		if fi.IsDir() && !isBootDir(fi.Name()) || fi.Mode().IsRegular() && fi.Size() > maxTopLevelFile {
+			continue
+		}
+		if err := fs.Extract(fsys, "/"+fi.Name(), filepath.Join(dir, fi.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	return imgs
+// isBootDir reports whether name is one of bootDirs, in any case, as FAT
+// and exFAT do not care.
+func isBootDir(name string) bool {
+	for _, d := range bootDirs {
+		if strings.EqualFold(name, d) {
+			return true
+		}
+	}
+	return false
 }
 
-// Localboot tries to boot from any local filesystem by parsing grub configuration
-func Localboot() ([]boot.OSImage, []*mount.MountPoint, error) {
+// scanOne runs scanDevice with a timeout.
+//
+// Mounting cannot be interrupted, so a scan that overruns is left to finish
+// in the background and its mount, if any, is undone then.
+func scanOne(ctx context.Context, device *block.BlockDev, mountDir string, timeout time.Duration) DeviceScan {
+	start := time.Now()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	type result struct {
+		configs []ConfigScan
+		mp      *mount.MountPoint
+		err     error
+	}
+	done := make(chan result, 1)
+	go func() {
+		configs, mp, err := scanDevice(ctx, device, mountDir)
+		done <- result{configs, mp, err}
+	}()
+
+	select {
+	case r := <-done:
+		s := DeviceScan{
+			Device:   device,
+			Configs:  r.configs,
+			Mount:    r.mp,
+			Err:      r.err,
+			Duration: time.Since(start),
+		}
+		for _, c := range r.configs {
+			s.Images = append(s.Images, c.Images...)
+		}
+		return s
+
+	case <-ctx.Done():
+		go func() {
+			if r := <-done; r.mp != nil {
+				r.mp.Unmount(mount.MNT_DETACH)
+			}
+		}()
+		return DeviceScan{
+			Device:   device,
+			Err:      fmt.Errorf("scanning %s: %v", device.Name, ctx.Err()),
+			Duration: time.Since(start),
+		}
+	}
+}
+
+// Scan mounts every device under mountDir and parses its boot configs,
+// with at most workers devices in flight and each device given at most
+// timeout. Results are in the same order as devices.
+func Scan(ctx context.Context, devices block.BlockDevices, mountDir string, workers int, timeout time.Duration) []DeviceScan {
+	if workers < 1 {
+		workers = 1
+	}
+	scans := make([]DeviceScan, len(devices))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, workers)
+	for i, device := range devices {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, device *block.BlockDev) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			scans[i] = scanOne(ctx, device, mountDir, timeout)
+		}(i, device)
+	}
+	wg.Wait()
+	return scans
+}
+
+// Localboot tries to boot from any local filesystem by parsing grub
+// configuration. The report says what was found on each device, and why
+// nothing was if nothing was.
+func Localboot() ([]boot.OSImage, []*mount.MountPoint, *Report, error) {
 	blockDevs, err := block.GetBlockDevices()
 	if err != nil {
-		return nil, nil, errors.New("no available block devices to boot from")
+		return nil, nil, nil, errors.New("no available block devices to boot from")
 	}
 
 	// Try to only boot from "good" block devices.
@@ -57,23 +280,22 @@ func Localboot() ([]boot.OSImage, []*mount.MountPoint, error) {
 
 	mountPoints, err := ioutil.TempDir("", "u-root-boot")
 	if err != nil {
-		return nil, nil, fmt.Errorf("cannot create tmpdir: %v", err)
+		return nil, nil, nil, fmt.Errorf("cannot create tmpdir: %v", err)
 	}
 
 	var images []boot.OSImage
 	var mps []*mount.MountPoint
-	for _, device := range blockDevs {
-		dir := filepath.Join(mountPoints, device.Name)
-
-		os.MkdirAll(dir, 0777)
-		mp, err := device.Mount(dir, mount.ReadOnly)
-		if err != nil {
+	scans := Scan(context.Background(), blockDevs, mountPoints, DefaultWorkers, DefaultDeviceTimeout)
+	for _, s := range scans {
+		if s.Err != nil {
+			log.Printf("Skipping %s after %v: %v", s.Device.Name, s.Duration, s.Err)
 			continue
 		}
-
-		imgs := parse(device, dir)
-		images = append(images, imgs...)
-		mps = append(mps, mp)
+		log.Printf("Scanned %s in %v: %d boot images", s.Device.Name, s.Duration, len(s.Images))
+		images = append(images, s.Images...)
+		if s.Mount != nil {
+			mps = append(mps, s.Mount)
+		}
 	}
-	return images, mps, nil
+	return images, mps, NewReport(scans), nil
 }
@@ -0,0 +1,70 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localboot
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/mount"
+	"github.com/u-root/u-root/pkg/mount/block"
+)
+
+func TestScanBoundedAndOrdered(t *testing.T) {
+	var inFlight, peak int32
+	scanDevice = func(ctx context.Context, device *block.BlockDev, mountDir string) ([]ConfigScan, *mount.MountPoint, error) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+		return []ConfigScan{{Format: "grub", Images: []boot.OSImage{&boot.LinuxImage{Name: device.Name}}}}, nil, nil
+	}
+
+	var devs block.BlockDevices
+	for _, name := range []string{"sda1", "sdb1", "sdc1", "sdd1", "sde1", "sdf1"} {
+		devs = append(devs, &block.BlockDev{Name: name})
+	}
+	scans := Scan(context.Background(), devs, "/mnt", 2, time.Second)
+
+	if peak > 2 {
+		t.Errorf("Scan ran %d devices at once, want at most 2", peak)
+	}
+	for i, s := range scans {
+		if s.Err != nil {
+			t.Errorf("Scan(%s) = %v", devs[i].Name, s.Err)
+		}
+		if s.Device != devs[i] || len(s.Images) != 1 || s.Images[0].(*boot.LinuxImage).Name != devs[i].Name {
+			t.Errorf("Scan result %d = %+v, want device %s", i, s, devs[i].Name)
+		}
+	}
+}
+
+func TestScanTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	scanDevice = func(ctx context.Context, device *block.BlockDev, mountDir string) ([]ConfigScan, *mount.MountPoint, error) {
+		if device.Name == "slow" {
+			<-release
+		}
+		return nil, nil, nil
+	}
+
+	devs := block.BlockDevices{{Name: "slow"}, {Name: "fast"}}
+	scans := Scan(context.Background(), devs, "/mnt", 2, 20*time.Millisecond)
+	if scans[0].Err == nil {
+		t.Errorf("Scan(slow) = nil, want timeout")
+	}
+	if scans[1].Err != nil {
+		t.Errorf("Scan(fast) = %v, want nil", scans[1].Err)
+	}
+}
@@ -0,0 +1,212 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localboot
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/boot/grub"
+	"github.com/u-root/u-root/pkg/mount"
+	"github.com/u-root/u-root/pkg/mount/block"
+)
+
+// Reasons a device or config yielded nothing bootable.
+const (
+	ReasonUnreadable = "unreadable"
+	ReasonNoConfig   = "no config"
+	ReasonParseError = "parse error"
+	ReasonNoEntries  = "no bootable entries"
+)
+
+// Report says what was found on each scanned device, and why nothing was
+// where nothing was. It is meant to answer "why didn't it find my OS".
+type Report struct {
+	Devices []DeviceReport `json:"devices"`
+
+	// devices are the devices the images were found on, and mounts
+	// where those are mounted.
+	devices map[boot.OSImage]*block.BlockDev
+	mounts  map[boot.OSImage]*mount.MountPoint
+
+	// auth says who may boot images whose config restricts that.
+	auth map[boot.OSImage]*grub.Auth
+}
+
+// DeviceReport is the part of a Report about one device.
+type DeviceReport struct {
+	Device   string `json:"device"`
+	FSType   string `json:"fs_type,omitempty"`
+	Duration string `json:"duration"`
+	Images   int    `json:"images"`
+
+	// Reason and Error are set if the device could not be scanned.
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+
+	Configs []ConfigReport `json:"configs,omitempty"`
+}
+
+// ConfigReport is the part of a Report about one boot loader's configs on
+// one device.
+type ConfigReport struct {
+	Format string `json:"format"`
+	Images int    `json:"images"`
+
+	// Reason and Error are set if no images were found. File and Line
+	// are set for parse errors.
+	Reason string `json:"reason,omitempty"`
+	Error  string `json:"error,omitempty"`
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"line,omitempty"`
+
+	// Skipped says why entries were left out.
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// NewReport summarizes scans.
+func NewReport(scans []DeviceScan) *Report {
+	r := &Report{
+		devices: make(map[boot.OSImage]*block.BlockDev),
+		mounts:  make(map[boot.OSImage]*mount.MountPoint),
+		auth:    make(map[boot.OSImage]*grub.Auth),
+	}
+	for _, s := range scans {
+		for _, img := range s.Images {
+			r.devices[img] = s.Device
+			r.mounts[img] = s.Mount
+		}
+		d := DeviceReport{
+			Device:   s.Device.Name,
+			Duration: s.Duration.String(),
+			Images:   len(s.Images),
+		}
+		if s.Mount != nil {
+			d.FSType = s.Mount.FSType
+		}
+		if s.Err != nil {
+			d.Reason, d.Error = ReasonUnreadable, s.Err.Error()
+		}
+		for _, c := range s.Configs {
+			d.Configs = append(d.Configs, newConfigReport(c))
+			for _, img := range c.Images {
+				if c.Auth.Restricted(img) {
+					r.auth[img] = c.Auth
+				}
+			}
+		}
+		r.Devices = append(r.Devices, d)
+	}
+	return r
+}
+
+func newConfigReport(c ConfigScan) ConfigReport {
+	cr := ConfigReport{
+		Format:  c.Format,
+		Images:  len(c.Images),
+		Skipped: c.Skipped,
+	}
+	// Parsers skip over broken entries and return the errors along with
+	// the images they still found.
+	var errs boot.ConfigErrors
+	if errors.As(c.Err, &errs) {
+		if len(c.Images) > 0 {
+			for _, e := range errs {
+				cr.Skipped = append(cr.Skipped, e.Error())
+			}
+			return cr
+		}
+		cr.File, cr.Line = errs[0].File, errs[0].Line
+	}
+
+	var ce *boot.ConfigError
+	switch {
+	case errors.Is(c.Err, boot.ErrNoConfig):
+		cr.Reason = ReasonNoConfig
+	case len(errs) > 0:
+		cr.Reason = ReasonParseError
+	case errors.As(c.Err, &ce):
+		cr.Reason, cr.File, cr.Line = ReasonParseError, ce.File, ce.Line
+	case c.Err != nil:
+		cr.Reason = ReasonParseError
+	case len(c.Images) == 0:
+		cr.Reason = ReasonNoEntries
+	}
+	if c.Err != nil {
+		cr.Error = c.Err.Error()
+	}
+	return cr
+}
+
+// DeviceOf returns the device img was found on, or nil if it is not of
+// the scans.
+func (r *Report) DeviceOf(img boot.OSImage) *block.BlockDev {
+	return r.devices[img]
+}
+
+// MountOf returns where the device img was found on is mounted, or nil if
+// img is not of the scans.
+func (r *Report) MountOf(img boot.OSImage) *mount.MountPoint {
+	return r.mounts[img]
+}
+
+// AuthOf returns who may boot img, or nil if anyone may.
+func (r *Report) AuthOf(img boot.OSImage) *grub.Auth {
+	return r.auth[img]
+}
+
+// Bootable returns whether any device had a boot image.
+func (r *Report) Bootable() bool {
+	for _, d := range r.Devices {
+		if d.Images > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteText writes the report for humans.
+func (r *Report) WriteText(w io.Writer) error {
+	if len(r.Devices) == 0 {
+		_, err := fmt.Fprintln(w, "No block devices were scanned.")
+		return err
+	}
+	for _, d := range r.Devices {
+		fs := d.FSType
+		if fs == "" {
+			fs = "?"
+		}
+		if _, err := fmt.Fprintf(w, "%s (%s, %s): %d boot images\n", d.Device, fs, d.Duration, d.Images); err != nil {
+			return err
+		}
+		if d.Reason != "" {
+			if _, err := fmt.Fprintf(w, "  %s: %s\n", d.Reason, d.Error); err != nil {
+				return err
+			}
+		}
+		for _, c := range d.Configs {
+			var err error
+			switch {
+			case c.Reason == "":
+				_, err = fmt.Fprintf(w, "  %s: %d boot images\n", c.Format, c.Images)
+			case c.Error == "":
+				_, err = fmt.Fprintf(w, "  %s: %s\n", c.Format, c.Reason)
+			default:
+				_, err = fmt.Fprintf(w, "  %s: %s: %s\n", c.Format, c.Reason, c.Error)
+			}
+			if err != nil {
+				return err
+			}
+			for _, s := range c.Skipped {
+				if _, err := fmt.Fprintf(w, "    skipped: %s\n", s); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
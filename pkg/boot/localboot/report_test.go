@@ -0,0 +1,146 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localboot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/mount"
+	"github.com/u-root/u-root/pkg/mount/block"
+)
+
+func TestReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "localboot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "boot/grub"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	cfg := "set timeout=5\nmenuentry 'Linux' {\n  configfile /boot/grub/missing.cfg\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "boot/grub/grub.cfg"), []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	scans := []DeviceScan{
+		{
+			Device:  &block.BlockDev{Name: "sda1"},
+			Mount:   &mount.MountPoint{FSType: "ext4"},
+			Configs: parse(context.Background(), &block.BlockDev{Name: "sda1"}, dir),
+		},
+		{
+			Device: &block.BlockDev{Name: "sdb1"},
+			Err:    errors.New("no suitable filesystem"),
+		},
+	}
+	r := NewReport(scans)
+	if r.Bootable() {
+		t.Errorf("Bootable() = true, want false")
+	}
+
+	want := map[string]ConfigReport{
+		"bls":      {Format: "bls", Reason: ReasonNoConfig},
+		"grub":     {Format: "grub", Reason: ReasonParseError, File: "boot/grub/grub.cfg", Line: 3},
+		"syslinux": {Format: "syslinux", Reason: ReasonNoConfig},
+	}
+	if len(r.Devices[0].Configs) != len(want) {
+		t.Fatalf("configs = %+v, want %d", r.Devices[0].Configs, len(want))
+	}
+	for _, c := range r.Devices[0].Configs {
+		w := want[c.Format]
+		if c.Reason != w.Reason || c.File != w.File || c.Line != w.Line {
+			t.Errorf("%s: got %+v, want %+v", c.Format, c, w)
+		}
+	}
+	if d := r.Devices[1]; d.Reason != ReasonUnreadable || d.Error != "no suitable filesystem" {
+		t.Errorf("sdb1: got %+v", d)
+	}
+
+	var text strings.Builder
+	if err := r.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"sda1 (ext4, 0s): 0 boot images",
+		"grub: parse error: boot/grub/grub.cfg:3: ",
+		"sdb1 (?, 0s): 0 boot images\n  unreadable: no suitable filesystem",
+	} {
+		if !strings.Contains(text.String(), s) {
+			t.Errorf("WriteText() = %q, want it to contain %q", text.String(), s)
+		}
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Report
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Devices[0].Configs[1].Line != 3 {
+		t.Errorf("JSON round trip lost the line number: %s", b)
+	}
+}
+
+func TestReportDeviceOf(t *testing.T) {
+	sda1, sdb1 := &block.BlockDev{Name: "sda1"}, &block.BlockDev{Name: "sdb1"}
+	mp := &mount.MountPoint{Path: "/mnt/sda1"}
+	a, b, c := &boot.LinuxImage{Name: "a"}, &boot.LinuxImage{Name: "b"}, &boot.LinuxImage{Name: "c"}
+	r := NewReport([]DeviceScan{
+		{Device: sda1, Images: []boot.OSImage{a, b}, Mount: mp},
+		{Device: sdb1, Images: []boot.OSImage{c}},
+	})
+	for img, want := range map[boot.OSImage]*block.BlockDev{a: sda1, b: sda1, c: sdb1, &boot.LinuxImage{}: nil} {
+		if got := r.DeviceOf(img); got != want {
+			t.Errorf("DeviceOf(%s) = %v, want %v", img.Label(), got, want)
+		}
+	}
+	for img, want := range map[boot.OSImage]*mount.MountPoint{a: mp, c: nil} {
+		if got := r.MountOf(img); got != want {
+			t.Errorf("MountOf(%s) = %v, want %v", img.Label(), got, want)
+		}
+	}
+}
+
+func TestReportAuthOf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "localboot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "boot/grub"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	cfg := "set superusers=root\npassword root toor\nmenuentry 'Linux' --unrestricted {\n  linux /vmlinuz\n}\nmenuentry 'Rescue' {\n  linux /vmlinuz\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "boot/grub/grub.cfg"), []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	configs := parse(context.Background(), &block.BlockDev{Name: "sda1"}, dir)
+	var imgs []boot.OSImage
+	for _, c := range configs {
+		imgs = append(imgs, c.Images...)
+	}
+	if len(imgs) != 2 {
+		t.Fatalf("parse found %d images, want 2", len(imgs))
+	}
+	r := NewReport([]DeviceScan{{Device: &block.BlockDev{Name: "sda1"}, Images: imgs, Configs: configs}})
+	if a := r.AuthOf(imgs[0]); a != nil {
+		t.Errorf("AuthOf(%s) = %v, want nil", imgs[0].Label(), a)
+	}
+	if a := r.AuthOf(imgs[1]); a == nil || a.Check(imgs[1], "root", "toor") != nil {
+		t.Errorf("AuthOf(%s) = %v, want root's", imgs[1].Label(), a)
+	}
+}
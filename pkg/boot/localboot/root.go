@@ -0,0 +1,95 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localboot
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/mount/block"
+)
+
+var (
+	// deviceExists reports whether this kernel has block device name.
+	deviceExists = func(name string) bool {
+		_, err := os.Stat(filepath.Join("/sys/class/block", name))
+		return err == nil
+	}
+	partUUID = (*block.BlockDev).PartUUID
+
+	rootArg = regexp.MustCompile(`(^|\s)root=(\S*)`)
+)
+
+// Devices that do not exist until userspace, e.g. an initramfs, sets them
+// up. Their names are not a sign of a config written for another machine.
+var assembledDevices = []string{"md", "dm-", "mapper/", "nfs", "ram", "disk/"}
+
+// TranslateRoot fixes a root= on li's command line that names a /dev device
+// this kernel does not have, such as one named the way another distro or
+// machine names it. The next kernel is likely not to have it either, and
+// would panic for want of a root file system.
+//
+// dev holds li's kernel and is mounted at dir. If dir holds a root file
+// system rather than a separate /boot, root= is pointed at dev: by
+// PARTUUID, which the kernel resolves, or, failing that, by file system
+// UUID if li has an initramfs to resolve it.
+//
+// TranslateRoot returns the new root=, or "" if root= is fine as it is.
+func TranslateRoot(li *boot.LinuxImage, dev *block.BlockDev, dir string) (string, error) {
+	m := rootArg.FindAllStringSubmatchIndex(li.Cmdline, -1)
+	if len(m) == 0 {
+		return "", nil
+	}
+	// The kernel goes by the last root=.
+	start, end := m[len(m)-1][4], m[len(m)-1][5]
+	root := li.Cmdline[start:end]
+	if !strings.HasPrefix(root, "/dev/") {
+		return "", nil
+	}
+	name := strings.TrimPrefix(root, "/dev/")
+	for _, a := range assembledDevices {
+		if strings.HasPrefix(name, a) {
+			return "", nil
+		}
+	}
+	if deviceExists(name) {
+		return "", nil
+	}
+
+	if dev == nil {
+		return "", fmt.Errorf("%s does not exist, and the device of the kernel is unknown", root)
+	}
+	if !isRootFS(dir) {
+		return "", fmt.Errorf("%s does not exist, and %s holds no root file system", root, dev.Name)
+	}
+	var fixed string
+	if uuid, err := partUUID(dev); err == nil {
+		fixed = "PARTUUID=" + uuid
+	} else if dev.FsUUID != "" && li.Initrd != nil {
+		fixed = "UUID=" + dev.FsUUID
+	} else {
+		return "", fmt.Errorf("%s does not exist, and %s has no PARTUUID: %v", root, dev.Name, err)
+	}
+	li.Cmdline = li.Cmdline[:start] + fixed + li.Cmdline[end:]
+	return fixed, nil
+}
+
+// isRootFS returns whether dir holds a root file system, going by what a
+// root file system has and a /boot does not.
+func isRootFS(dir string) bool {
+	if dir == "" {
+		return false
+	}
+	for _, f := range []string{"sbin/init", "etc/fstab"} {
+		if _, err := os.Stat(filepath.Join(dir, f)); err == nil {
+			return true
+		}
+	}
+	return false
+}
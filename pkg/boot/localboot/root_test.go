@@ -0,0 +1,81 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package localboot
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/mount/block"
+)
+
+func TestTranslateRoot(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootfs)
+	os.MkdirAll(filepath.Join(rootfs, "etc"), 0755)
+	ioutil.WriteFile(filepath.Join(rootfs, "etc", "fstab"), nil, 0644)
+	bootfs, err := ioutil.TempDir("", "bootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(bootfs)
+
+	oldExists, oldPartUUID := deviceExists, partUUID
+	defer func() { deviceExists, partUUID = oldExists, oldPartUUID }()
+	deviceExists = func(name string) bool { return name == "nvme0n1p2" }
+	partUUID = func(b *block.BlockDev) (string, error) {
+		if b.Name == "nvme0n1p2" {
+			return "6a5d2c1b-02", nil
+		}
+		return "", errors.New("not a partition")
+	}
+
+	gpt := &block.BlockDev{Name: "nvme0n1p2", FsUUID: "2f6c1e7a"}
+	nopart := &block.BlockDev{Name: "md0", FsUUID: "2f6c1e7a"}
+	initrd := strings.NewReader("")
+	for _, tt := range []struct {
+		name    string
+		cmdline string
+		initrd  bool
+		dev     *block.BlockDev
+		dir     string
+		want    string
+		err     bool
+	}{
+		{name: "missing", cmdline: "ro root=/dev/hda2 quiet", dev: gpt, dir: rootfs, want: "ro root=PARTUUID=6a5d2c1b-02 quiet"},
+		{name: "last", cmdline: "root=/dev/sda1 root=/dev/hda2", dev: gpt, dir: rootfs, want: "root=/dev/sda1 root=PARTUUID=6a5d2c1b-02"},
+		{name: "exists", cmdline: "root=/dev/nvme0n1p2 ro", dev: gpt, dir: rootfs, want: "root=/dev/nvme0n1p2 ro"},
+		{name: "uuid", cmdline: "root=UUID=1234 ro", dev: gpt, dir: rootfs, want: "root=UUID=1234 ro"},
+		{name: "none", cmdline: "ro quiet", dev: gpt, dir: rootfs, want: "ro quiet"},
+		{name: "lvm", cmdline: "root=/dev/mapper/vg-root", dev: gpt, dir: rootfs, want: "root=/dev/mapper/vg-root"},
+		{name: "not an arg", cmdline: "myroot=/dev/hda2", dev: gpt, dir: rootfs, want: "myroot=/dev/hda2"},
+		{name: "fs uuid", cmdline: "root=/dev/hda2", initrd: true, dev: nopart, dir: rootfs, want: "root=UUID=2f6c1e7a"},
+		{name: "fs uuid without initramfs", cmdline: "root=/dev/hda2", dev: nopart, dir: rootfs, want: "root=/dev/hda2", err: true},
+		{name: "separate boot", cmdline: "root=/dev/hda2", dev: gpt, dir: bootfs, want: "root=/dev/hda2", err: true},
+		{name: "unknown device", cmdline: "root=/dev/hda2", want: "root=/dev/hda2", err: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			li := &boot.LinuxImage{Cmdline: tt.cmdline}
+			if tt.initrd {
+				li.Initrd = initrd
+			}
+			_, err := TranslateRoot(li, tt.dev, tt.dir)
+			if (err != nil) != tt.err {
+				t.Errorf("TranslateRoot = %v, want error %t", err, tt.err)
+			}
+			if li.Cmdline != tt.want {
+				t.Errorf("TranslateRoot made %q, want %q", li.Cmdline, tt.want)
+			}
+		})
+	}
+}
@@ -4,6 +4,8 @@
 
 // Package menu displays a Terminal UI based text menu to choose boot options
 // from.
+//
+// What the menu says is translated with package l10n.
 package menu
 
 import (
@@ -13,10 +15,13 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/efivar"
+	"github.com/u-root/u-root/pkg/l10n"
 	"github.com/u-root/u-root/pkg/sh"
 	"golang.org/x/crypto/ssh/terminal"
 	"golang.org/x/sys/unix"
@@ -46,75 +51,136 @@ type Entry interface {
 	IsDefault() bool
 }
 
+// CmdlineEditor is an Entry whose kernel command line can be changed
+// before it is loaded, as operators of a Remote may.
+type CmdlineEditor interface {
+	Entry
+
+	// Cmdline returns the kernel command line.
+	Cmdline() (string, error)
+
+	// SetCmdline replaces the kernel command line.
+	SetCmdline(string) error
+}
+
 // Choose presents the user a menu on input to choose an entry from and returns that entry.
 func Choose(input *os.File, entries ...Entry) Entry {
+	return choose(input, nil, entries)
+}
+
+// choose is Choose, also taking a choice from r if it is not nil.
+func choose(input *os.File, r *Remote, entries []Entry) Entry {
 	fmt.Println("")
 	for i, e := range entries {
 		fmt.Printf("%02d. %s\n\n", i+1, e.Label())
 	}
 	fmt.Println("\r")
 
-	oldState, err := terminal.MakeRaw(int(input.Fd()))
-	if err != nil {
-		log.Printf("BUG: Please report: We cannot actually let you choose from menu (MakeRaw failed): %v", err)
-		return nil
-	}
-	defer terminal.Restore(int(input.Fd()), oldState)
-
 	// TODO(chrisko): reduce this timeout a la GRUB. 3 seconds, and hitting
 	// any button resets the timeout. We could save 7 seconds here.
 	t := time.NewTimer(initialTimeout)
 
 	boot := make(chan Entry, 1)
 
-	go func() {
-		// Read exactly one line.
-		term := terminal.NewTerminal(input, "Choose a menu option (hit enter to boot the default - 01 is the default option) > ")
+	oldState, err := terminal.MakeRaw(int(input.Fd()))
+	switch {
+	case err != nil && r == nil:
+		log.Printf("BUG: Please report: We cannot actually let you choose from menu (MakeRaw failed): %v", err)
+		return nil
+	case err != nil:
+		// Operators of r can still choose.
+		log.Printf("Cannot take a choice from the console (MakeRaw failed): %v", err)
+	default:
+		defer terminal.Restore(int(input.Fd()), oldState)
+		go readChoice(input, t, r, boot, entries)
+	}
 
-		term.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
-			// We ain't gonna autocomplete, but we'll reset the countdown timer when you press a key.
-			t.Reset(subsequentTimeout)
-			return "", 0, false
-		}
+	var remoteChoices <-chan Entry
+	var remoteHolds <-chan bool
+	if r != nil {
+		r.open(entries, initialTimeout)
+		// Closed before the entry chosen is loaded, so operators can
+		// no longer change it.
+		defer r.close()
+		remoteChoices, remoteHolds = r.choices, r.holds
+	}
 
-		for {
-			choice, err := term.ReadLine()
-			if err != nil {
-				if err != io.EOF {
-					fmt.Printf("BUG: Please report: Terminal read error: %v.\r\n", err)
-				}
-				boot <- nil
-				return
+	for {
+		select {
+		case entry := <-boot:
+			if entry != nil {
+				fmt.Printf("%s\r\n\r\n", l10n.Sprintf("Chosen option %s.", entry.Label()))
+				r.notify("%s", l10n.Sprintf("Chosen option %s on the console.", entry.Label()))
 			}
+			return entry
 
-			if choice == "" {
-				// nil will result in the default order.
-				boot <- nil
-				return
+		case entry := <-remoteChoices:
+			if entry != nil {
+				fmt.Printf("%s\r\n\r\n", l10n.Sprintf("Chosen option %s remotely.", entry.Label()))
+				r.notify("%s", l10n.Sprintf("Chosen option %s.", entry.Label()))
 			}
-			num, err := strconv.Atoi(choice)
-			if err != nil {
-				fmt.Printf("%s is not a valid entry number: %v.\r\n", choice, err)
-				continue
+			return entry
+
+		case hold := <-remoteHolds:
+			if !t.Stop() {
+				select {
+				case <-t.C:
+				default:
+				}
 			}
-			if num-1 < 0 || num > len(entries) {
-				fmt.Printf("%s is not a valid entry number.\r\n", choice)
-				continue
+			if hold {
+				r.countdown(0)
+			} else {
+				t.Reset(subsequentTimeout)
+				r.countdown(subsequentTimeout)
 			}
-			boot <- entries[num-1]
-			return
+
+		case <-t.C:
+			r.notify("%s", l10n.T("No choice was made."))
+			return nil
 		}
-	}()
+	}
+}
+
+// readChoice reads one choice of entries from input and sends it to boot,
+// resetting t on every key.
+func readChoice(input *os.File, t *time.Timer, r *Remote, boot chan<- Entry, entries []Entry) {
+	// Read exactly one line.
+	term := terminal.NewTerminal(input, l10n.T("Choose a menu option (hit enter to boot the default - 01 is the default option) > "))
+
+	term.AutoCompleteCallback = func(line string, pos int, key rune) (string, int, bool) {
+		// We ain't gonna autocomplete, but we'll reset the countdown timer when you press a key.
+		t.Reset(subsequentTimeout)
+		r.countdown(subsequentTimeout)
+		return "", 0, false
+	}
 
-	select {
-	case entry := <-boot:
-		if entry != nil {
-			fmt.Printf("Chosen option %s.\r\n\r\n", entry.Label())
+	for {
+		choice, err := term.ReadLine()
+		if err != nil {
+			if err != io.EOF {
+				fmt.Printf("BUG: Please report: Terminal read error: %v.\r\n", err)
+			}
+			boot <- nil
+			return
 		}
-		return entry
 
-	case <-t.C:
-		return nil
+		if choice == "" {
+			// nil will result in the default order.
+			boot <- nil
+			return
+		}
+		num, err := strconv.Atoi(choice)
+		if err != nil {
+			fmt.Printf("%s\r\n", l10n.Sprintf("%s is not a valid entry number: %v.", choice, err))
+			continue
+		}
+		if num-1 < 0 || num > len(entries) {
+			fmt.Printf("%s\r\n", l10n.Sprintf("%s is not a valid entry number.", choice))
+			continue
+		}
+		boot <- entries[num-1]
+		return
 	}
 }
 
@@ -124,14 +190,20 @@ func Choose(input *os.File, entries ...Entry) Entry {
 //
 // The user is left to call Entry.Exec when this function returns.
 func ShowMenuAndLoad(input *os.File, entries ...Entry) Entry {
+	return (*Remote)(nil).ShowMenuAndLoad(input, entries...)
+}
+
+// ShowMenuAndLoad is ShowMenuAndLoad, also mirroring the menu to the
+// operators of r, who may choose as the user may. r may be nil.
+func (r *Remote) ShowMenuAndLoad(input *os.File, entries ...Entry) Entry {
 	// Clear the screen (ANSI terminal escape code for screen clear).
 	fmt.Printf("\033[1;1H\033[2J\n\n")
-	fmt.Printf("Welcome to NERF's Boot Menu\n\n")
-	fmt.Printf("Enter a number to boot a kernel:\n")
+	fmt.Printf("%s\n\n", l10n.T("Welcome to NERF's Boot Menu"))
+	fmt.Printf("%s\n", l10n.T("Enter a number to boot a kernel:"))
 
 	for {
 		// Allow the user to choose.
-		entry := Choose(input, entries...)
+		entry := choose(input, r, entries)
 		if entry == nil {
 			// This only returns something if the user explicitly
 			// entered something.
@@ -141,8 +213,10 @@ func ShowMenuAndLoad(input *os.File, entries ...Entry) Entry {
 		}
 		if err := entry.Load(); err != nil {
 			log.Printf("Failed to load %s: %v", entry.Label(), err)
+			r.notify("Failed to load %s: %v", entry.Label(), err)
 			continue
 		}
+		r.notify("%s", l10n.Sprintf("Booting %s.", entry.Label()))
 
 		// Entry was successfully loaded. Leave it to the caller to
 		// exec, so the caller can clean up the OS before rebooting or
@@ -158,12 +232,15 @@ func ShowMenuAndLoad(input *os.File, entries ...Entry) Entry {
 		// Only perform actions that are default actions. I.e. don't
 		// drop to shell.
 		if e.IsDefault() {
-			fmt.Printf("Attempting to boot %s.\n\n", e)
+			fmt.Printf("%s\n\n", l10n.Sprintf("Attempting to boot %s.", e))
+			r.notify("%s", l10n.Sprintf("Attempting to boot %s.", e.Label()))
 
 			if err := e.Load(); err != nil {
 				log.Printf("Failed to load %s: %v", e.Label(), err)
+				r.notify("Failed to load %s: %v", e.Label(), err)
 				continue
 			}
+			r.notify("%s", l10n.Sprintf("Booting %s.", e.Label()))
 
 			// Entry was successfully loaded. Leave it to the
 			// caller to exec, so the caller can clean up the OS
@@ -191,16 +268,64 @@ func OSImages(verbose bool, imgs ...boot.OSImage) []Entry {
 type OSImageAction struct {
 	boot.OSImage
 	Verbose bool
+
+	// Release is the kernel release shown with the label, if known.
+	Release string
+
+	// Authenticate, if set, is called before the image is loaded, which
+	// it is not if Authenticate fails: for entries that only some users
+	// may boot.
+	Authenticate func() error
+}
+
+// Label implements Entry.Label, adding the kernel release unless the
+// label already mentions it.
+func (oia OSImageAction) Label() string {
+	l := oia.OSImage.Label()
+	if oia.Release != "" && !strings.Contains(l, oia.Release) {
+		l = fmt.Sprintf("%s (Linux %s)", l, oia.Release)
+	}
+	return l
 }
 
 // Load implements Entry.Load by loading the OS image into memory.
 func (oia OSImageAction) Load() error {
+	if oia.Authenticate != nil {
+		if err := oia.Authenticate(); err != nil {
+			return fmt.Errorf("not allowed to boot %s: %v", oia.Label(), err)
+		}
+	}
 	if err := oia.OSImage.Load(oia.Verbose); err != nil {
 		return fmt.Errorf("could not load image %s: %v", oia.OSImage, err)
 	}
 	return nil
 }
 
+// Cmdline implements CmdlineEditor.Cmdline for Linux and multiboot images.
+func (oia OSImageAction) Cmdline() (string, error) {
+	switch img := oia.OSImage.(type) {
+	case *boot.LinuxImage:
+		return img.Cmdline, nil
+	case *boot.MultibootImage:
+		return img.Cmdline, nil
+	}
+	return "", fmt.Errorf("%s has no kernel command line", oia.Label())
+}
+
+// SetCmdline implements CmdlineEditor.SetCmdline for Linux and multiboot
+// images.
+func (oia OSImageAction) SetCmdline(cmdline string) error {
+	switch img := oia.OSImage.(type) {
+	case *boot.LinuxImage:
+		img.Cmdline = cmdline
+	case *boot.MultibootImage:
+		img.Cmdline = cmdline
+	default:
+		return fmt.Errorf("%s has no kernel command line", oia.Label())
+	}
+	return nil
+}
+
 // Exec executes the loaded image.
 func (oia OSImageAction) Exec() error {
 	return boot.Execute()
@@ -215,7 +340,7 @@ type StartShell struct{}
 
 // Label is the label to show to the user.
 func (StartShell) Label() string {
-	return "Enter a LinuxBoot shell"
+	return l10n.T("Enter a LinuxBoot shell")
 }
 
 // Load does nothing.
@@ -238,7 +363,7 @@ type Reboot struct{}
 
 // Label is the label to show to the user.
 func (Reboot) Label() string {
-	return "Reboot"
+	return l10n.T("Reboot")
 }
 
 // Load does nothing.
@@ -254,3 +379,32 @@ func (Reboot) Exec() error {
 
 // IsDefault indicates that this should not be run as a default action.
 func (Reboot) IsDefault() bool { return false }
+
+// RebootToFirmware is a menu.Entry that reboots the machine into the UEFI
+// firmware's setup.
+type RebootToFirmware struct{}
+
+// FirmwareSetupSupported returns whether the firmware can be rebooted into
+// its setup, for RebootToFirmware.
+func FirmwareSetupSupported() bool {
+	o, err := efivar.SupportedOSIndications()
+	return err == nil && o&efivar.BootToFWUI != 0
+}
+
+// Label is the label to show to the user.
+func (RebootToFirmware) Label() string {
+	return l10n.T("Reboot into firmware setup")
+}
+
+// Load asks the firmware to stop in its setup on the next boot.
+func (RebootToFirmware) Load() error {
+	return efivar.SetOSIndications(efivar.BootToFWUI)
+}
+
+// Exec reboots the machine using sys_reboot.
+func (RebootToFirmware) Exec() error {
+	return Reboot{}.Exec()
+}
+
+// IsDefault indicates that this should not be run as a default action.
+func (RebootToFirmware) IsDefault() bool { return false }
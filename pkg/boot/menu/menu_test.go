@@ -5,13 +5,19 @@
 package menu
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/google/goterm/term"
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/efivar"
+	"github.com/u-root/u-root/pkg/l10n"
 	"github.com/u-root/u-root/pkg/testutil"
 )
 
@@ -269,3 +275,81 @@ func TestShowMenuAndLoad(t *testing.T) {
 		})
 	}
 }
+
+func TestOSImageActionLabel(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		release string
+		want    string
+	}{
+		{"Debian", "", "Debian"},
+		{"Debian", "5.4.0-4-amd64", "Debian (Linux 5.4.0-4-amd64)"},
+		{"Ubuntu, with Linux 5.4.0-42-generic", "5.4.0-42-generic", "Ubuntu, with Linux 5.4.0-42-generic"},
+	} {
+		a := OSImageAction{
+			OSImage: &boot.LinuxImage{Name: tt.name},
+			Release: tt.release,
+		}
+		if got := a.Label(); got != tt.want {
+			t.Errorf("Label() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestOSImageActionAuthenticate(t *testing.T) {
+	var asked bool
+	a := OSImageAction{
+		OSImage: &boot.LinuxImage{Name: "Rescue"},
+		Authenticate: func() error {
+			asked = true
+			return errors.New("wrong password")
+		},
+	}
+	err := a.Load()
+	if !asked {
+		t.Errorf("Load did not authenticate")
+	}
+	if err == nil || !strings.Contains(err.Error(), "wrong password") {
+		t.Errorf("Load = %v, want the authentication error", err)
+	}
+}
+
+func TestLabelTranslated(t *testing.T) {
+	l10n.Register("de", l10n.Catalog{"Reboot": "Neu starten"})
+	l10n.SetLanguage("de_DE.UTF-8")
+	defer l10n.SetLanguage("")
+
+	if got := (Reboot{}).Label(); got != "Neu starten" {
+		t.Errorf("Reboot label = %q, want %q", got, "Neu starten")
+	}
+	if got := (StartShell{}).Label(); got != "Enter a LinuxBoot shell" {
+		t.Errorf("StartShell label = %q, want it untranslated", got)
+	}
+}
+
+func TestRebootToFirmware(t *testing.T) {
+	d, err := ioutil.TempDir("", "efivars")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	old := efivar.Dir
+	efivar.Dir = d
+	defer func() { efivar.Dir = old }()
+
+	if FirmwareSetupSupported() {
+		t.Errorf("FirmwareSetupSupported without OsIndicationsSupported = true")
+	}
+	if err := efivar.Write("OsIndicationsSupported", efivar.GlobalGUID, efivar.BootServiceAccess|efivar.RuntimeAccess, []byte{1, 0, 0, 0, 0, 0, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if !FirmwareSetupSupported() {
+		t.Errorf("FirmwareSetupSupported = false, want true")
+	}
+	if err := (RebootToFirmware{}).Load(); err != nil {
+		t.Fatal(err)
+	}
+	if o, err := efivar.GetOSIndications(); err != nil || o != efivar.BootToFWUI {
+		t.Errorf("OsIndications = %v, %v, want %v", o, err, efivar.BootToFWUI)
+	}
+}
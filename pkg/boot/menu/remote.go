@@ -0,0 +1,450 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package menu
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/u-root/u-root/pkg/l10n"
+	"github.com/u-root/u-root/pkg/shlex"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Remote lets operators who cannot reach the console, physical or serial,
+// see the boot menu and choose from it over SSH.
+//
+// Operators log in with one of the authorized keys, are told what the
+// menu shows and does, and may type
+//
+//     list                 the entries, and the time left to boot the default
+//     boot [N]             boot entry N, or the default entries
+//     cmdline N [ARGS...]  show, or replace, the kernel command line of entry N
+//     hold                 stop the countdown to booting the default
+//     help
+//     quit
+//
+// or give one of them as the ssh command, e.g. ssh -p 2222 host boot 2.
+// Entries that ask for a password, such as those GRUB restricts, still ask
+// on the console.
+type Remote struct {
+	config *ssh.ServerConfig
+
+	// choices and holds are read by the menu while it waits for a
+	// choice. A nil choice boots the default entries; a hold is true to
+	// stop the countdown and false to restart it.
+	choices chan Entry
+	holds   chan bool
+
+	mu       sync.Mutex
+	entries  []Entry
+	deadline time.Time
+	sessions map[io.Writer]struct{}
+}
+
+// NewRemote returns a Remote that identifies itself with hostKey and lets
+// in operators with one of authorizedKeys.
+func NewRemote(hostKey ssh.Signer, authorizedKeys []ssh.PublicKey) *Remote {
+	keys := make(map[string]bool)
+	for _, k := range authorizedKeys {
+		keys[string(k.Marshal())] = true
+	}
+	r := &Remote{
+		config: &ssh.ServerConfig{
+			PublicKeyCallback: func(c ssh.ConnMetadata, k ssh.PublicKey) (*ssh.Permissions, error) {
+				if !keys[string(k.Marshal())] {
+					return nil, fmt.Errorf("unknown public key for %q", c.User())
+				}
+				return &ssh.Permissions{
+					Extensions: map[string]string{"pubkey-fp": ssh.FingerprintSHA256(k)},
+				}, nil
+			},
+		},
+		choices:  make(chan Entry, 1),
+		holds:    make(chan bool, 1),
+		sessions: make(map[io.Writer]struct{}),
+	}
+	if hostKey != nil {
+		r.config.AddHostKey(hostKey)
+	}
+	return r
+}
+
+// Serve accepts connections on l until it fails.
+func (r *Remote) Serve(l net.Listener) error {
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go r.handleConn(c)
+	}
+}
+
+func (r *Remote) handleConn(c net.Conn) {
+	conn, chans, reqs, err := ssh.NewServerConn(c, r.config)
+	if err != nil {
+		log.Printf("Remote menu: %v: %v", c.RemoteAddr(), err)
+		c.Close()
+		return
+	}
+	defer conn.Close()
+	who := fmt.Sprintf("%s@%v (%s)", conn.User(), conn.RemoteAddr(), conn.Permissions.Extensions["pubkey-fp"])
+	log.Printf("Remote menu: %s logged in", who)
+
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		ch, reqs, err := nc.Accept()
+		if err != nil {
+			log.Printf("Remote menu: %s: %v", who, err)
+			continue
+		}
+		go r.session(ch, reqs, who)
+	}
+}
+
+func (r *Remote) session(ch ssh.Channel, reqs <-chan *ssh.Request, who string) {
+	defer ch.Close()
+	var pty bool
+	for req := range reqs {
+		switch req.Type {
+		case "pty-req":
+			pty = true
+			req.Reply(true, nil)
+
+		case "shell":
+			req.Reply(true, nil)
+			go ssh.DiscardRequests(reqs)
+			r.interact(ch, pty, who)
+			return
+
+		case "exec":
+			var cmd struct{ Command string }
+			if err := ssh.Unmarshal(req.Payload, &cmd); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			req.Reply(true, nil)
+			go ssh.DiscardRequests(reqs)
+			var status struct{ Status uint32 }
+			if err := r.command(ch, cmd.Command, who); err != nil {
+				fmt.Fprintf(ch, "%v\r\n", err)
+				status.Status = 1
+			}
+			ch.SendRequest("exit-status", false, ssh.Marshal(&status))
+			return
+
+		default:
+			req.Reply(false, nil)
+		}
+	}
+}
+
+// interact runs commands read from rw, a terminal if pty is set, until the
+// operator quits.
+func (r *Remote) interact(rw io.ReadWriter, pty bool, who string) {
+	var w io.Writer = rw
+	var readLine func() (string, error)
+	if pty {
+		t := terminal.NewTerminal(rw, "boot> ")
+		w, readLine = t, t.ReadLine
+	} else {
+		s := bufio.NewScanner(rw)
+		readLine = func() (string, error) {
+			if !s.Scan() {
+				if s.Err() != nil {
+					return "", s.Err()
+				}
+				return "", io.EOF
+			}
+			return s.Text(), nil
+		}
+	}
+
+	r.mu.Lock()
+	r.sessions[w] = struct{}{}
+	r.mu.Unlock()
+	defer func() {
+		r.mu.Lock()
+		delete(r.sessions, w)
+		r.mu.Unlock()
+	}()
+
+	r.list(w)
+	for {
+		line, err := readLine()
+		if err != nil {
+			return
+		}
+		switch strings.TrimSpace(line) {
+		case "":
+			continue
+		case "quit", "exit":
+			return
+		}
+		if err := r.command(w, line, who); err != nil {
+			fmt.Fprintf(w, "%v\r\n", err)
+		}
+	}
+}
+
+var errMenuClosed = errors.New("the menu is not waiting for a choice")
+
+// command runs one command line, writing what it shows to w.
+func (r *Remote) command(w io.Writer, line, who string) error {
+	argv := shlex.Argv(line)
+	if len(argv) == 0 {
+		return nil
+	}
+	switch argv[0] {
+	case "list", "ls":
+		r.list(w)
+		return nil
+
+	case "boot":
+		var e Entry
+		if len(argv) > 1 {
+			var err error
+			if e, err = r.entry(argv[1]); err != nil {
+				return err
+			}
+		}
+		if err := r.choose(e); err != nil {
+			return err
+		}
+		if e == nil {
+			log.Printf("Remote menu: %s chose the default entries", who)
+		} else {
+			log.Printf("Remote menu: %s chose %s", who, e.Label())
+		}
+		return nil
+
+	case "cmdline":
+		if len(argv) < 2 {
+			return fmt.Errorf("usage: cmdline N [ARGS...]")
+		}
+		if len(argv) == 2 {
+			cl, err := r.cmdline(argv[1], nil)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "%s\r\n", cl)
+			return nil
+		}
+		// The kernel parses the quoting of its command line itself.
+		cl := afterWords(line, 2)
+		label, err := r.cmdline(argv[1], &cl)
+		if err != nil {
+			return err
+		}
+		log.Printf("Remote menu: %s set the command line of %s to %q", who, label, cl)
+		r.hold(false)
+		return nil
+
+	case "hold":
+		if !r.hold(true) {
+			return errMenuClosed
+		}
+		r.notify("%s", l10n.T("The countdown to booting the default is stopped."))
+		return nil
+
+	case "help":
+		fmt.Fprint(w, "list                 the entries, and the time left to boot the default\r\n"+
+			"boot [N]             boot entry N, or the default entries\r\n"+
+			"cmdline N [ARGS...]  show, or replace, the kernel command line of entry N\r\n"+
+			"hold                 stop the countdown to booting the default\r\n"+
+			"quit\r\n")
+		return nil
+	}
+	return fmt.Errorf("unknown command %q; try help", argv[0])
+}
+
+// afterWords returns line after its first n words, as it was typed.
+func afterWords(line string, n int) string {
+	s := strings.TrimLeft(line, " \t")
+	for ; n > 0; n-- {
+		i := strings.IndexAny(s, " \t")
+		if i < 0 {
+			return ""
+		}
+		s = strings.TrimLeft(s[i:], " \t")
+	}
+	return strings.TrimRight(s, " \t")
+}
+
+// cmdline returns the kernel command line of the entry numbered s, and
+// replaces it first with set if set is not nil. It returns the label of
+// the entry when it sets its command line.
+//
+// It holds r.mu throughout, and the menu closes r under r.mu before it
+// loads the entry chosen, so entries are never changed once chosen.
+func (r *Remote) cmdline(s string, set *string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e, err := r.entryLocked(s)
+	if err != nil {
+		return "", err
+	}
+	c, ok := e.(CmdlineEditor)
+	if !ok {
+		return "", fmt.Errorf("%s has no kernel command line", e.Label())
+	}
+	if set == nil {
+		return c.Cmdline()
+	}
+	if err := c.SetCmdline(*set); err != nil {
+		return "", err
+	}
+	return e.Label(), nil
+}
+
+// entry returns the entry numbered s, counting from 1 as the menu does.
+func (r *Remote) entry(s string) (Entry, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.entryLocked(s)
+}
+
+func (r *Remote) entryLocked(s string) (Entry, error) {
+	if r.entries == nil {
+		return nil, errMenuClosed
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > len(r.entries) {
+		return nil, fmt.Errorf("%s is not a valid entry number", s)
+	}
+	return r.entries[n-1], nil
+}
+
+func (r *Remote) list(w io.Writer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.entries == nil {
+		fmt.Fprintf(w, "%s\r\n", errMenuClosed)
+		return
+	}
+	for i, e := range r.entries {
+		fmt.Fprintf(w, "%02d. %s\r\n", i+1, e.Label())
+	}
+	if r.deadline.IsZero() {
+		fmt.Fprintf(w, "%s\r\n", l10n.T("The countdown to booting the default is stopped."))
+	} else {
+		left := time.Until(r.deadline).Round(time.Second)
+		fmt.Fprintf(w, "%s\r\n", l10n.Sprintf("Booting the default in %v.", left))
+	}
+}
+
+func (r *Remote) choose(e Entry) error {
+	r.mu.Lock()
+	open := r.entries != nil
+	r.mu.Unlock()
+	if !open {
+		return errMenuClosed
+	}
+	select {
+	case r.choices <- e:
+		return nil
+	default:
+		return errors.New("a choice has already been made")
+	}
+}
+
+// hold stops or restarts the countdown, and returns whether the menu is
+// waiting for a choice.
+func (r *Remote) hold(stop bool) bool {
+	r.mu.Lock()
+	open := r.entries != nil
+	r.mu.Unlock()
+	if !open {
+		return false
+	}
+	select {
+	case r.holds <- stop:
+	default:
+	}
+	return true
+}
+
+// open tells operators the menu is waiting for a choice from entries,
+// booting the default after d, and forgets choices made before.
+func (r *Remote) open(entries []Entry, d time.Duration) {
+	if r == nil {
+		return
+	}
+	for drained := false; !drained; {
+		select {
+		case <-r.choices:
+		case <-r.holds:
+		default:
+			drained = true
+		}
+	}
+	r.mu.Lock()
+	r.entries = entries
+	r.mu.Unlock()
+	r.countdown(d)
+	for _, w := range r.writers() {
+		r.list(w)
+	}
+}
+
+func (r *Remote) close() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.entries = nil
+	r.deadline = time.Time{}
+	r.mu.Unlock()
+}
+
+// countdown records that the default is booted in d, or never if d is 0.
+func (r *Remote) countdown(d time.Duration) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if d == 0 {
+		r.deadline = time.Time{}
+	} else {
+		r.deadline = time.Now().Add(d)
+	}
+}
+
+// notify tells every operator logged in what the menu does.
+func (r *Remote) notify(format string, v ...interface{}) {
+	if r == nil {
+		return
+	}
+	msg := fmt.Sprintf(format, v...)
+	for _, w := range r.writers() {
+		fmt.Fprintf(w, "%s\r\n", msg)
+	}
+}
+
+// writers returns where to write to the operators logged in.
+func (r *Remote) writers() []io.Writer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var ws []io.Writer
+	for w := range r.sessions {
+		ws = append(ws, w)
+	}
+	return ws
+}
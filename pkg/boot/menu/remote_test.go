@@ -0,0 +1,195 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package menu
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/u-root/u-root/pkg/boot"
+	"golang.org/x/crypto/ed25519"
+	"golang.org/x/crypto/ssh"
+)
+
+// operator is an operator logged in to a Remote, without SSH.
+type operator struct {
+	t     *testing.T
+	in    *io.PipeWriter
+	lines chan string
+}
+
+func login(t *testing.T, r *Remote) *operator {
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	go func() {
+		r.interact(struct {
+			io.Reader
+			io.Writer
+		}{inR, outW}, false, "test")
+		outW.Close()
+	}()
+	o := &operator{t: t, in: inW, lines: make(chan string, 100)}
+	go func() {
+		s := bufio.NewScanner(outR)
+		for s.Scan() {
+			o.lines <- strings.TrimSuffix(s.Text(), "\r")
+		}
+		close(o.lines)
+	}()
+	return o
+}
+
+// waitFor returns the first line the operator is shown that contains s.
+func (o *operator) waitFor(s string) string {
+	o.t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case l, ok := <-o.lines:
+			if !ok {
+				o.t.Fatalf("session ended waiting for %q", s)
+			}
+			if strings.Contains(l, s) {
+				return l
+			}
+		case <-timeout:
+			o.t.Fatalf("timed out waiting for %q", s)
+		}
+	}
+}
+
+func (o *operator) do(cmd string) {
+	if _, err := fmt.Fprintf(o.in, "%s\n", cmd); err != nil {
+		o.t.Fatal(err)
+	}
+}
+
+func TestRemoteChoose(t *testing.T) {
+	// A pipe is not a terminal, so only the operator can choose.
+	input, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer input.Close()
+	defer w.Close()
+
+	linux := &boot.LinuxImage{Name: "Linux", Cmdline: "quiet"}
+	entry1 := &OSImageAction{OSImage: linux}
+	entry2 := &dummyEntry{label: "Other"}
+
+	r := NewRemote(nil, nil)
+	o := login(t, r)
+	defer o.in.Close()
+	o.waitFor(errMenuClosed.Error())
+
+	chosen := make(chan Entry)
+	go func() {
+		chosen <- choose(input, r, []Entry{entry1, entry2})
+	}()
+	o.waitFor("02. Other")
+	o.waitFor("Booting the default in")
+
+	o.do("hold")
+	o.waitFor("countdown to booting the default is stopped")
+	// The countdown of 2s would have passed.
+	time.Sleep(initialTimeout + 500*time.Millisecond)
+
+	o.do("cmdline 1")
+	o.waitFor("quiet")
+	o.do(`cmdline  1  console=ttyS0 dyndbg="file init.c +p"  `)
+	o.do("cmdline 2")
+	o.waitFor("Other has no kernel command line")
+	o.do("boot 3")
+	o.waitFor("3 is not a valid entry number")
+	o.do("reboot")
+	o.waitFor(`unknown command "reboot"`)
+	o.do("boot 1")
+
+	select {
+	case got := <-chosen:
+		if got != entry1 {
+			t.Errorf("choose = %v, want %v", got, entry1)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the operator's choice was not taken")
+	}
+	want := `console=ttyS0 dyndbg="file init.c +p"`
+	if linux.Cmdline != want {
+		t.Errorf("Cmdline = %q, want %q", linux.Cmdline, want)
+	}
+	o.waitFor("Chosen option Linux.")
+
+	o.do("boot 2")
+	o.waitFor(errMenuClosed.Error())
+	// The entry chosen may be booting; it is not to be changed.
+	o.do("cmdline 1 quiet")
+	o.waitFor(errMenuClosed.Error())
+	if linux.Cmdline != want {
+		t.Errorf("Cmdline after the choice = %q, want %q", linux.Cmdline, want)
+	}
+}
+
+func TestRemoteSSH(t *testing.T) {
+	signer := func() ssh.Signer {
+		_, k, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := ssh.NewSignerFromKey(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	host, operatorKey, strangerKey := signer(), signer(), signer()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	r := NewRemote(host, []ssh.PublicKey{operatorKey.PublicKey()})
+	go r.Serve(l)
+
+	dial := func(k ssh.Signer) (*ssh.Client, error) {
+		return ssh.Dial("tcp", l.Addr().String(), &ssh.ClientConfig{
+			User:            "root",
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(k)},
+			HostKeyCallback: ssh.FixedHostKey(host.PublicKey()),
+		})
+	}
+	if c, err := dial(strangerKey); err == nil {
+		c.Close()
+		t.Fatal("logged in with a key that is not authorized")
+	}
+	c, err := dial(operatorKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	run := func(cmd string) (string, error) {
+		s, err := c.NewSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer s.Close()
+		out, err := s.CombinedOutput(cmd)
+		return string(out), err
+	}
+	if out, err := run("list"); err != nil || !strings.Contains(out, errMenuClosed.Error()) {
+		t.Errorf("list = %q, %v, want %q", out, err, errMenuClosed)
+	}
+	if _, err := run("boot 1"); err == nil {
+		t.Error("boot 1 with no menu did not fail")
+	}
+}
@@ -0,0 +1,210 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package splash shows boot progress and errors as a status screen, for
+// machines whose users should not see a scrolling console.
+//
+// The screen has an optional logo, a title, a progress bar, the last few
+// status lines and the last error:
+//
+//	d, err := fb.Open("/dev/fb0")
+//	...
+//	s := splash.New(d, "Booting")
+//	s.Status("Scanning disks")
+//	s.Progress(1, 3)
+package splash
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/u-root/u-root/pkg/fb"
+)
+
+// Display is what a Screen is drawn on, such as an *fb.FB.
+type Display interface {
+	Bounds() image.Rectangle
+	Draw(image.Image) error
+}
+
+// Colors of the screen.
+var (
+	Background = color.RGBA{0x10, 0x10, 0x10, 0xff}
+	Foreground = color.RGBA{0xe0, 0xe0, 0xe0, 0xff}
+	Dim        = color.RGBA{0x80, 0x80, 0x80, 0xff}
+	ErrorColor = color.RGBA{0xff, 0x50, 0x50, 0xff}
+)
+
+// Screen is a status screen on a Display. It is redrawn on every change
+// and is safe for concurrent use.
+type Screen struct {
+	mu      sync.Mutex
+	d       Display
+	title   string
+	logo    image.Image
+	lines   []string
+	partial string
+	done    int
+	total   int
+	errLine string
+}
+
+var _ io.Writer = &Screen{}
+
+// New returns a Screen with title on d. Nothing is drawn until something
+// is set.
+func New(d Display, title string) *Screen {
+	return &Screen{d: d, title: title}
+}
+
+// SetLogo shows img above the title, scaled down to fit if needed.
+func (s *Screen) SetLogo(img image.Image) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.logo = img
+	return s.draw()
+}
+
+// Status adds a status line.
+func (s *Screen) Status(format string, v ...interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.lines = append(s.lines, fmt.Sprintf(format, v...))
+	return s.draw()
+}
+
+// Progress sets the progress bar to done out of total. A total of 0 hides
+// it.
+func (s *Screen) Progress(done, total int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done, s.total = done, total
+	return s.draw()
+}
+
+// Error shows err below the status lines until the next Error. A nil err
+// clears it.
+func (s *Screen) Error(err error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errLine = ""
+	if err != nil {
+		s.errLine = err.Error()
+	}
+	return s.draw()
+}
+
+// Write adds each line of p as a status line, so that a Screen can be the
+// output of a log.Logger.
+func (s *Screen) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	text := s.partial + string(p)
+	lines := strings.Split(text, "\n")
+	s.partial = lines[len(lines)-1]
+	lines = lines[:len(lines)-1]
+	if len(lines) == 0 {
+		return len(p), nil
+	}
+	s.lines = append(s.lines, lines...)
+	if err := s.draw(); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// scale is the font scale for a screen dx pixels wide: about 100 columns
+// of status text.
+func scale(dx int) int {
+	if sc := dx / (100 * fb.CharWidth); sc > 1 {
+		return sc
+	}
+	return 1
+}
+
+// draw renders the screen. s.mu must be held.
+func (s *Screen) draw() error {
+	r := s.d.Bounds()
+	img := image.NewRGBA(r)
+	draw.Draw(img, r, image.NewUniform(Background), image.ZP, draw.Src)
+
+	sc := scale(r.Dx())
+	lineHeight := fb.CharHeight * sc
+	// The logo and title take the top half, centered.
+	y := r.Min.Y + r.Dy()/8
+	if s.logo != nil {
+		logo := shrink(s.logo, r.Dx()*3/4, r.Dy()/4)
+		lb := logo.Bounds()
+		at := image.Pt(r.Min.X+(r.Dx()-lb.Dx())/2, y)
+		draw.Draw(img, lb.Sub(lb.Min).Add(at), logo, lb.Min, draw.Over)
+		y += lb.Dy() + lineHeight
+	}
+	if s.title != "" {
+		tsc := 2 * sc
+		w := fb.StringWidth(s.title, tsc)
+		fb.DrawString(img, image.Pt(r.Min.X+(r.Dx()-w)/2, y), tsc, s.title, Foreground)
+	}
+
+	// The progress bar is in the middle.
+	margin := r.Dx() / 8
+	y = r.Min.Y + r.Dy()/2
+	if s.total > 0 {
+		done := s.done
+		if done > s.total {
+			done = s.total
+		}
+		bar := image.Rect(r.Min.X+margin, y, r.Max.X-margin, y+lineHeight)
+		draw.Draw(img, bar, image.NewUniform(Dim), image.ZP, draw.Src)
+		inner := bar.Inset(sc)
+		inner.Max.X = inner.Min.X + inner.Dx()*done/s.total
+		draw.Draw(img, inner, image.NewUniform(Foreground), image.ZP, draw.Src)
+	}
+	y += 2 * lineHeight
+
+	// Status lines fill the rest, newest last, with room for the error.
+	bottom := r.Max.Y - lineHeight
+	if s.errLine != "" {
+		bottom -= 2 * lineHeight
+	}
+	n := (bottom - y) / lineHeight
+	if n < 0 {
+		n = 0
+	}
+	if len(s.lines) > n {
+		s.lines = s.lines[len(s.lines)-n:]
+	}
+	for _, l := range s.lines {
+		fb.DrawString(img, image.Pt(r.Min.X+margin, y), sc, l, Dim)
+		y += lineHeight
+	}
+	if s.errLine != "" {
+		fb.DrawString(img, image.Pt(r.Min.X+margin, bottom+lineHeight), sc, s.errLine, ErrorColor)
+	}
+	return s.d.Draw(img)
+}
+
+// shrink scales img down, keeping its aspect, to fit in maxW by maxH. It
+// picks the nearest pixel; logos should be made the size they are shown.
+func shrink(img image.Image, maxW, maxH int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= maxW && b.Dy() <= maxH || b.Dx() == 0 || b.Dy() == 0 {
+		return img
+	}
+	w, h := maxW, b.Dy()*maxW/b.Dx()
+	if h > maxH {
+		w, h = b.Dx()*maxH/b.Dy(), maxH
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dst.Set(x, y, img.At(b.Min.X+x*b.Dx()/w, b.Min.Y+y*b.Dy()/h))
+		}
+	}
+	return dst
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package splash
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"log"
+	"reflect"
+	"testing"
+)
+
+type display struct {
+	r     image.Rectangle
+	last  image.Image
+	draws int
+	err   error
+}
+
+func (d *display) Bounds() image.Rectangle { return d.r }
+
+func (d *display) Draw(img image.Image) error {
+	d.last = img
+	d.draws++
+	return d.err
+}
+
+// count returns how many pixels of img in r are c.
+func count(img image.Image, r image.Rectangle, c color.Color) int {
+	var n int
+	want := color.RGBAModel.Convert(c)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			if color.RGBAModel.Convert(img.At(x, y)) == want {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func TestScreen(t *testing.T) {
+	d := &display{r: image.Rect(0, 0, 640, 480)}
+	s := New(d, "Booting")
+	if d.draws != 0 {
+		t.Errorf("New drew the screen")
+	}
+
+	if err := s.Status("Scanning %d disks", 2); err != nil {
+		t.Fatal(err)
+	}
+	if d.last.Bounds() != d.r {
+		t.Errorf("drawn image is %v, want %v", d.last.Bounds(), d.r)
+	}
+	top := image.Rect(0, 0, 640, 240)
+	if count(d.last, top, Foreground) == 0 {
+		t.Errorf("no title drawn")
+	}
+	if count(d.last, image.Rect(0, 240, 640, 480), Dim) == 0 {
+		t.Errorf("no status drawn")
+	}
+
+	// A progress bar across the middle, half full.
+	if err := s.Progress(1, 2); err != nil {
+		t.Fatal(err)
+	}
+	bar := image.Rect(80, 241, 560, 248)
+	if n := count(d.last, bar, Foreground); n != 239*7 {
+		t.Errorf("progress bar has %d pixels, want %d", n, 239*7)
+	}
+	s.Progress(0, 0)
+	if count(d.last, bar, Foreground) != 0 {
+		t.Errorf("progress bar still drawn with no total")
+	}
+
+	bottom := image.Rect(0, 440, 640, 480)
+	if err := s.Error(errors.New("no kernel")); err != nil {
+		t.Fatal(err)
+	}
+	if count(d.last, bottom, ErrorColor) == 0 {
+		t.Errorf("no error drawn")
+	}
+	s.Error(nil)
+	if count(d.last, bottom, ErrorColor) != 0 {
+		t.Errorf("error still drawn")
+	}
+
+	d.err = errors.New("gone")
+	if err := s.Status("x"); err != d.err {
+		t.Errorf("Status = %v, want %v", err, d.err)
+	}
+}
+
+func TestScreenLines(t *testing.T) {
+	d := &display{r: image.Rect(0, 0, 100, 100)}
+	s := New(d, "")
+
+	l := log.New(s, "", 0)
+	l.Printf("one")
+	fmt.Fprint(s, "two\nthr")
+	if want := []string{"one", "two"}; !reflect.DeepEqual(s.lines, want) {
+		t.Errorf("lines = %q, want %q", s.lines, want)
+	}
+	fmt.Fprint(s, "ee\n")
+	// 100x100 has room for 2 lines of status.
+	for i := 0; i < 10; i++ {
+		s.Status("%d", i)
+	}
+	if want := []string{"8", "9"}; !reflect.DeepEqual(s.lines, want) {
+		t.Errorf("lines = %q, want %q", s.lines, want)
+	}
+}
+
+func TestLogo(t *testing.T) {
+	d := &display{r: image.Rect(0, 0, 400, 400)}
+	s := New(d, "")
+	red := color.RGBA{0xff, 0, 0, 0xff}
+	logo := image.NewRGBA(image.Rect(10, 10, 410, 210))
+	for y := 10; y < 210; y++ {
+		for x := 10; x < 410; x++ {
+			logo.Set(x, y, red)
+		}
+	}
+	if err := s.SetLogo(logo); err != nil {
+		t.Fatal(err)
+	}
+	// Shrunk to 200x100 to fit a quarter of the height, centered, from
+	// y 50.
+	if n := count(d.last, d.r, red); n != 200*100 {
+		t.Errorf("logo has %d pixels, want %d", n, 200*100)
+	}
+	if count(d.last, image.Rect(100, 50, 300, 150), red) != 200*100 {
+		t.Errorf("logo is not where it belongs")
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build gofuzz
+
+package syslinux
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/u-root/u-root/pkg/curl"
+)
+
+// Fuzz is the go-fuzz entry point for the config parser. Files the config
+// refers to do not exist.
+func Fuzz(data []byte) int {
+	p := newParser(&url.URL{Scheme: "tftp", Host: "fuzz"}, "", curl.Schemes{"tftp": curl.NewMockScheme("tftp")})
+	if err := p.append(context.Background(), string(data)); err != nil || len(p.errs) > 0 {
+		return 0
+	}
+	return 1
+}
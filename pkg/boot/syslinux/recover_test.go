@@ -0,0 +1,101 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package syslinux
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/boot"
+	"github.com/u-root/u-root/pkg/curl"
+)
+
+func TestParseRecovers(t *testing.T) {
+	const config = `default good
+include ftp://nowhere/menu.cfg
+
+label badkernel
+	kernel ftp://nowhere/vmlinuz
+
+label badinitrd
+	kernel vmlinuz-2
+	append initrd=ftp://nowhere/initrd
+
+label badmboot
+	kernel mboot.c32
+	append --- /xen.gz
+
+label good
+	kernel vmlinuz-3
+	initrd initrd-3
+`
+	fs := curl.NewMockScheme("tftp")
+	fs.Add("1.2.3.4", "/pxelinux.cfg/default", config)
+	rootdir := &url.URL{Scheme: "tftp", Host: "1.2.3.4", Path: "/"}
+
+	imgs, err := ParseConfigFile(context.Background(), curl.Schemes{"tftp": fs}, "pxelinux.cfg/default", rootdir, "")
+	if len(imgs) != 1 || imgs[0].Label() != "good" {
+		t.Errorf("ParseConfigFile() = %v, want only the good label", imgs)
+	}
+
+	var errs boot.ConfigErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("ParseConfigFile() = %v, want boot.ConfigErrors", err)
+	}
+	// Missing includes are ignored, as syslinux does. The initrd from the
+	// cmdline is only fetched once all labels are known, so its error has
+	// no line.
+	want := map[int]bool{5: true, 13: true, 0: true}
+	if len(errs) != len(want) {
+		t.Errorf("ParseConfigFile() = %v, want %d errors", err, len(want))
+	}
+	for _, e := range errs {
+		if !want[e.Line] || e.File != "pxelinux.cfg/default" {
+			t.Errorf("unexpected error %v", e)
+		}
+	}
+}
+
+func TestParseNestingBounded(t *testing.T) {
+	fs := curl.NewMockScheme("tftp")
+	fs.Add("1.2.3.4", "/default", "include default\n")
+	rootdir := &url.URL{Scheme: "tftp", Host: "1.2.3.4", Path: "/"}
+
+	_, err := ParseConfigFile(context.Background(), curl.Schemes{"tftp": fs}, "default", rootdir, "")
+	var errs boot.ConfigErrors
+	if !errors.As(err, &errs) || len(errs) != 1 {
+		t.Errorf("ParseConfigFile(self-including config) = %v, want one error", err)
+	}
+}
+
+// malformed are inputs that once crashed the parser or that it must
+// survive.
+var malformed = []string{
+	"",
+	"\x00",
+	"label",
+	"label a\nkernel mboot.c32\nappend ---",
+	"label a\nkernel mboot.c32\nappend --- ---",
+	"label a\nkernel k\nappend initrd",
+	"label a\nkernel k\nappend initrd=",
+	"label a\nkernel chain.c32\nappend hd",
+	"label a\nkernel chain.c32\nappend hd0, guid=",
+	"label a\ncom32 chain.c32",
+	"menu",
+	"menu label",
+	"menu default",
+	"include ::::",
+	"kernel %zz",
+	"localboot 0",
+}
+
+func TestParseMalformed(t *testing.T) {
+	for _, in := range malformed {
+		p := newParser(&url.URL{Scheme: "tftp", Host: "fuzz"}, "", curl.Schemes{"tftp": curl.NewMockScheme("tftp")})
+		p.append(context.Background(), in)
+	}
+}
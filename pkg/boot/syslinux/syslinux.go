@@ -7,8 +7,9 @@
 // See http://www.syslinux.org/wiki/index.php?title=Config for general syslinux
 // config features.
 //
-// Currently, only the APPEND, INCLUDE, KERNEL, LABEL, DEFAULT, and INITRD
-// directives are partially supported.
+// Currently, only the APPEND, INCLUDE, KERNEL, LABEL, DEFAULT, INITRD and
+// LOCALBOOT directives are partially supported. Of the COM32 modules,
+// mboot.c32 and chain.c32 are understood.
 package syslinux
 
 import (
@@ -19,6 +20,7 @@ import (
 	"net/url"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/u-root/u-root/pkg/boot"
@@ -77,14 +79,15 @@ func ParseLocalConfig(ctx context.Context, diskDir string) ([]boot.OSImage, erro
 		}
 		return imgs, err
 	}
-	return nil, fmt.Errorf("no valid syslinux config found on %s", diskDir)
+	return nil, fmt.Errorf("syslinux: %w on %s", boot.ErrNoConfig, diskDir)
 }
 
 // ParseConfigFile parses a Syslinux configuration as specified in
 // http://www.syslinux.org/wiki/index.php?title=Config
 //
-// Currently, only the APPEND, INCLUDE, KERNEL, LABEL, DEFAULT, and INITRD
-// directives are partially supported.
+// Currently, only the APPEND, INCLUDE, KERNEL, LABEL, DEFAULT, INITRD and
+// LOCALBOOT directives are partially supported. LOCALBOOT and chain.c32
+// entries become boot.ChainImages.
 //
 // `s` is used to fetch any files that must be parsed or provided.
 //
@@ -97,6 +100,10 @@ func ParseLocalConfig(ctx context.Context, diskDir string) ([]boot.OSImage, erro
 // For PXE clients, rootdir will be the the URL without the path, and wd the
 // path component of the URL (e.g. rootdir = http://foobar.com, wd =
 // barfoo/pxelinux.cfg/).
+//
+// Directives that fail, e.g. because a file cannot be found, are skipped,
+// and so is the label they are in. The images that could still be parsed
+// are returned along with a boot.ConfigErrors listing what was skipped.
 func ParseConfigFile(ctx context.Context, s curl.Schemes, configFile string, rootdir *url.URL, wd string) ([]boot.OSImage, error) {
 	p := newParser(rootdir, wd, s)
 	if err := p.appendFile(ctx, configFile); err != nil {
@@ -111,6 +118,9 @@ func ParseConfigFile(ctx context.Context, s curl.Schemes, configFile string, roo
 		if e, ok := p.mbEntries[label]; ok {
 			e.Name = displayLabel
 		}
+		if e, ok := p.chainEntries[label]; ok {
+			e.Name = displayLabel
+		}
 	}
 
 	// Intended order:
@@ -119,7 +129,7 @@ func ParseConfigFile(ctx context.Context, s curl.Schemes, configFile string, roo
 	// 2. defaultEntry
 	// 3. labels in order they appeared in config
 	if len(p.labelOrder) == 0 {
-		return nil, nil
+		return nil, p.errs.Err()
 	}
 	if len(p.defaultEntry) > 0 {
 		p.labelOrder = append([]string{p.defaultEntry}, p.labelOrder...)
@@ -131,14 +141,17 @@ func ParseConfigFile(ctx context.Context, s curl.Schemes, configFile string, roo
 
 	var images []boot.OSImage
 	for _, label := range p.labelOrder {
-		if img, ok := p.linuxEntries[label]; ok && img.Kernel != nil {
+		if img, ok := p.linuxEntries[label]; ok && img.Kernel != nil && !p.broken[img] {
+			images = append(images, img)
+		}
+		if img, ok := p.mbEntries[label]; ok && img.Kernel != nil && !p.broken[img] {
 			images = append(images, img)
 		}
-		if img, ok := p.mbEntries[label]; ok && img.Kernel != nil {
+		if img, ok := p.chainEntries[label]; ok {
 			images = append(images, img)
 		}
 	}
-	return images, nil
+	return images, p.errs.Err()
 }
 
 func dedupStrings(list []string) []string {
@@ -157,6 +170,7 @@ type parser struct {
 	// linuxEntries is a map of label name -> label configuration.
 	linuxEntries map[string]*boot.LinuxImage
 	mbEntries    map[string]*boot.MultibootImage
+	chainEntries map[string]*boot.ChainImage
 
 	// labelOrder is the order of label entries in linuxEntries.
 	labelOrder []string
@@ -168,14 +182,25 @@ type parser struct {
 	nerfDefaultEntry string
 
 	// parser internals.
+	curFile      string
+	depth        int
 	globalAppend string
 	scope        scope
 	curEntry     string
 	wd           string
 	rootdir      *url.URL
 	schemes      curl.Schemes
+
+	// errs are the errors the parser skipped over, and broken the
+	// entries left out because of them.
+	errs   boot.ConfigErrors
+	broken map[boot.OSImage]bool
 }
 
+// maxConfigDepth bounds how deep INCLUDE directives nest, so a config that
+// includes itself does not recurse forever.
+const maxConfigDepth = 16
+
 type scope uint8
 
 const (
@@ -195,11 +220,13 @@ func newParser(rootdir *url.URL, wd string, s curl.Schemes) *parser {
 	return &parser{
 		linuxEntries: make(map[string]*boot.LinuxImage),
 		mbEntries:    make(map[string]*boot.MultibootImage),
+		chainEntries: make(map[string]*boot.ChainImage),
 		scope:        scopeGlobal,
 		wd:           wd,
 		rootdir:      rootdir,
 		schemes:      s,
 		menuLabel:    make(map[string]string),
+		broken:       make(map[boot.OSImage]bool),
 	}
 }
 
@@ -253,6 +280,9 @@ func (c *parser) getFile(url string) (io.ReaderAt, error) {
 
 // appendFile parses the config file downloaded from `url` and adds it to `c`.
 func (c *parser) appendFile(ctx context.Context, url string) error {
+	if c.depth >= maxConfigDepth {
+		return fmt.Errorf("%s: config files nested more than %d deep", url, maxConfigDepth)
+	}
 	u, err := parseURL(url, c.rootdir, c.wd)
 	if err != nil {
 		return err
@@ -267,13 +297,19 @@ func (c *parser) appendFile(ctx context.Context, url string) error {
 		return err
 	}
 	log.Printf("Got config file %s:\n%s\n", r, string(config))
+	defer func(f string) {
+		c.curFile = f
+		c.depth--
+	}(c.curFile)
+	c.curFile = url
+	c.depth++
 	return c.append(ctx, string(config))
 }
 
 // Append parses `config` and adds the respective configuration to `c`.
 func (c *parser) append(ctx context.Context, config string) error {
 	// Here's a shitty parser.
-	for _, line := range strings.Split(config, "\n") {
+	for n, line := range strings.Split(config, "\n") {
 		// This is stupid. There should be a FieldsN(...).
 		kv := strings.Fields(line)
 		if len(kv) <= 1 {
@@ -302,7 +338,7 @@ func (c *parser) append(ctx context.Context, config string) error {
 				// TODO(hugelgupf): plumb a logger through here.
 				continue
 			} else if err != nil {
-				return err
+				c.warn(n+1, err)
 			}
 
 		case "menu":
@@ -340,7 +376,14 @@ func (c *parser) append(ctx context.Context, config string) error {
 			}
 			c.labelOrder = append(c.labelOrder, c.curEntry)
 
-		case "kernel":
+		case "localboot":
+			// Whatever the type argument, the intent is to boot
+			// from a local disk.
+			if c.scope == scopeEntry {
+				c.chainTo(nil)
+			}
+
+		case "kernel", "com32":
 			// I hate special cases like these, but we aren't gonna
 			// implement syslinux modules.
 			if arg == "mboot.c32" {
@@ -350,13 +393,21 @@ func (c *parser) append(ctx context.Context, config string) error {
 					Name: c.curEntry,
 				}
 			}
+			if path.Base(kv[1]) == "chain.c32" {
+				if c.scope == scopeEntry {
+					c.chainTo(kv[2:])
+				}
+				continue
+			}
 			fallthrough
 
 		case "linux":
 			if e, ok := c.linuxEntries[c.curEntry]; ok {
 				k, err := c.getFile(arg)
 				if err != nil {
-					return err
+					c.warn(n+1, err)
+					c.broken[e] = true
+					continue
 				}
 				e.Kernel = k
 			}
@@ -371,7 +422,9 @@ func (c *parser) append(ctx context.Context, config string) error {
 				// https://wiki.syslinux.org/wiki/index.php?title=Directives/append
 				i, err := c.getFile(arg)
 				if err != nil {
-					return err
+					c.warn(n+1, err)
+					c.broken[e] = true
+					continue
 				}
 				e.Initrd = i
 			}
@@ -382,14 +435,24 @@ func (c *parser) append(ctx context.Context, config string) error {
 				c.globalAppend = arg
 
 			case scopeEntry:
+				if e, ok := c.chainEntries[c.curEntry]; ok {
+					parseChainArgs(e, kv[1:])
+				}
 				if e, ok := c.mbEntries[c.curEntry]; ok {
 					modules := strings.Split(arg, "---")
 					// The first module is special -- the kernel.
 					if len(modules) > 0 {
 						kernel := strings.Fields(modules[0])
+						if len(kernel) == 0 {
+							c.warn(n+1, fmt.Errorf("append: no multiboot kernel"))
+							c.broken[e] = true
+							continue
+						}
 						k, err := c.getFile(kernel[0])
 						if err != nil {
-							return err
+							c.warn(n+1, err)
+							c.broken[e] = true
+							continue
 						}
 						e.Kernel = k
 						if len(kernel) > 1 {
@@ -405,7 +468,9 @@ func (c *parser) append(ctx context.Context, config string) error {
 						name := m[0]
 						file, err := c.getFile(name)
 						if err != nil {
-							return err
+							c.warn(n+1, err)
+							c.broken[e] = true
+							break
 						}
 						e.Modules = append(e.Modules, multiboot.Module{
 							CmdLine: strings.TrimSpace(cmdline),
@@ -453,14 +518,16 @@ func (c *parser) append(ctx context.Context, config string) error {
 		}
 
 		for _, opt := range strings.Fields(label.Cmdline) {
-			optkv := strings.Split(opt, "=")
-			if optkv[0] != "initrd" {
+			optkv := strings.SplitN(opt, "=", 2)
+			if len(optkv) != 2 || optkv[0] != "initrd" {
 				continue
 			}
 
 			i, err := c.getFile(optkv[1])
 			if err != nil {
-				return err
+				c.warn(0, fmt.Errorf("label %s: %v", label.Name, err))
+				c.broken[label] = true
+				continue
 			}
 			label.Initrd = i
 		}
@@ -468,3 +535,59 @@ func (c *parser) append(ctx context.Context, config string) error {
 	return nil
 
 }
+
+// warn notes an error at line of the current file that the parser skipped
+// over.
+func (c *parser) warn(line int, err error) {
+	log.Printf("%s:%d: %v", c.curFile, line, err)
+	c.errs = append(c.errs, &boot.ConfigError{File: c.curFile, Line: line, Err: err})
+}
+
+// chainTo turns the current entry into one that boots a local disk, as
+// LOCALBOOT and chain.c32 do. args are chain.c32 arguments.
+func (c *parser) chainTo(args []string) {
+	delete(c.linuxEntries, c.curEntry)
+	delete(c.mbEntries, c.curEntry)
+	e := &boot.ChainImage{
+		Name: c.curEntry,
+		Disk: -1,
+	}
+	parseChainArgs(e, args)
+	c.chainEntries[c.curEntry] = e
+}
+
+// parseChainArgs applies the chain.c32 arguments that select what to boot:
+// "hdN [PART]", "label=NAME" and "guid=GUID". The rest, such as "fs",
+// "mbr=" or "ntldr=", either mean "some local disk" or concern loading a
+// boot sector, which we do not do.
+//
+// https://wiki.syslinux.org/wiki/index.php?title=Comboot/chain.c32
+func parseChainArgs(e *boot.ChainImage, args []string) {
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		switch {
+		case strings.HasPrefix(a, "hd"):
+			// Both "hd0 1" and "hd0,1" are used in the wild.
+			disk := strings.SplitN(a[2:], ",", 2)
+			n, err := strconv.Atoi(disk[0])
+			if err != nil {
+				continue
+			}
+			e.Disk = n
+			if len(disk) == 2 {
+				e.Partition, _ = strconv.Atoi(disk[1])
+			} else if i+1 < len(args) {
+				if p, err := strconv.Atoi(args[i+1]); err == nil {
+					e.Partition = p
+					i++
+				}
+			}
+
+		case strings.HasPrefix(a, "label="):
+			e.PartLabel = strings.TrimPrefix(a, "label=")
+
+		case strings.HasPrefix(a, "guid="), strings.HasPrefix(a, "uuid="):
+			e.PartGUID = a[len("guid="):]
+		}
+	}
+}
@@ -493,6 +493,41 @@ func TestParseGeneral(t *testing.T) {
 				},
 			},
 		},
+		{
+			desc: "localboot and chain.c32 entries",
+			configFiles: map[string]string{
+				"/foobar/pxelinux.cfg/default": `
+					default local
+
+					label local
+					menu label Boot from local drive
+					localboot 0
+
+					label part
+					com32 chain.c32
+					append hd1 2
+
+					label bylabel
+					kernel /boot/chain.c32
+					append label=ROOT-A
+
+					label comma
+					kernel chain.c32 hd0,3
+
+					label foo
+					kernel ./pxefiles/kernel1`,
+			},
+			want: []boot.OSImage{
+				&boot.ChainImage{Name: "Boot from local drive", Disk: -1},
+				&boot.ChainImage{Name: "part", Disk: 1, Partition: 2},
+				&boot.ChainImage{Name: "bylabel", Disk: -1, PartLabel: "ROOT-A"},
+				&boot.ChainImage{Name: "comma", Disk: 0, Partition: 3},
+				&boot.LinuxImage{
+					Name:   "foo",
+					Kernel: strings.NewReader(kernel1),
+				},
+			},
+		},
 	} {
 		t.Run(fmt.Sprintf("Test [%02d] %s", i, tt.desc), func(t *testing.T) {
 			fs := newMockScheme()
@@ -0,0 +1,143 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cloudinit reads instance metadata the way cloud-init does.
+//
+// Supported data sources are NoCloud (a seed directory, a seed partition
+// or ISO labelled "cidata", or a seed URL), the EC2 instance metadata
+// service and the OpenStack metadata service. NoCloud settings may also
+// come from the SMBIOS system serial number, e.g.
+// "ds=nocloud;h=myhost;s=http://10.0.0.1/seed/".
+//
+// u-root does not run user data; it is handed to the caller as is.
+package cloudinit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/u-root/u-root/pkg/ulog"
+)
+
+// Network config formats.
+const (
+	// NetplanV2 is cloud-init's network config version 2, a netplan
+	// subset, as NoCloud and cloud-init's EC2 defaults use.
+	NetplanV2 = "netplan-v2"
+
+	// NetplanV1 is cloud-init's network config version 1.
+	NetplanV1 = "cloud-init-v1"
+
+	// OpenStackNetworkData is OpenStack's network_data.json.
+	OpenStackNetworkData = "openstack-network-data"
+)
+
+// Metadata is what a data source knows about this instance.
+type Metadata struct {
+	// Source names the data source that provided the metadata.
+	Source string
+
+	InstanceID string
+	Hostname   string
+
+	// SSHKeys are public keys in authorized_keys format.
+	SSHKeys []string
+
+	// UserData is handed over uninterpreted.
+	UserData []byte
+
+	// NetworkConfig is in NetworkConfigFormat, empty if the source
+	// had none.
+	NetworkConfig       []byte
+	NetworkConfigFormat string
+}
+
+// Source is a data source.
+type Source interface {
+	// Name identifies the source in logs.
+	Name() string
+
+	// Fetch returns the source's metadata, or ErrNotFound if the source
+	// does not exist in this environment.
+	Fetch(ctx context.Context) (*Metadata, error)
+}
+
+// ErrNotFound means a data source is not present.
+var ErrNotFound = errors.New("data source not found")
+
+// DefaultTimeout bounds how long an HTTP data source may take to answer.
+// Outside of its cloud, a metadata address does not exist, so this is how
+// long probing for it costs.
+const DefaultTimeout = 5 * time.Second
+
+// DefaultSources returns the sources cloud-init would try: NoCloud from the
+// SMBIOS serial number or a seed device, then EC2, then OpenStack.
+func DefaultSources() []Source {
+	client := &http.Client{Timeout: DefaultTimeout}
+	return []Source{
+		&NoCloudSMBIOS{Client: client},
+		&NoCloudDevice{},
+		&EC2{Client: client},
+		&OpenStack{Client: client},
+	}
+}
+
+// Fetch returns the metadata of the first source that has any. Sources that
+// are present but fail are logged to l and skipped.
+func Fetch(ctx context.Context, l ulog.Logger, sources ...Source) (*Metadata, error) {
+	for _, s := range sources {
+		md, err := s.Fetch(ctx)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			l.Printf("cloudinit: %s: %v", s.Name(), err)
+			continue
+		}
+		md.Source = s.Name()
+		return md, nil
+	}
+	return nil, ErrNotFound
+}
+
+// WriteAuthorizedKeys appends the instance's SSH keys to an authorized_keys
+// file, skipping keys that are already there.
+func (md *Metadata) WriteAuthorizedKeys(path string) error {
+	if len(md.SSHKeys) == 0 {
+		return nil
+	}
+	existing, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	have := make(map[string]bool)
+	for _, l := range strings.Split(string(existing), "\n") {
+		have[strings.TrimSpace(l)] = true
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 && !strings.HasSuffix(string(existing), "\n") {
+		fmt.Fprintln(f)
+	}
+	for _, k := range md.SSHKeys {
+		if k = strings.TrimSpace(k); len(k) > 0 && !have[k] {
+			fmt.Fprintln(f, k)
+			have[k] = true
+		}
+	}
+	return f.Close()
+}
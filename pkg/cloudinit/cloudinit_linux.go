@@ -0,0 +1,122 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cloudinit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/mount"
+	"github.com/u-root/u-root/pkg/mount/block"
+	"github.com/u-root/u-root/pkg/smbios"
+	"golang.org/x/sys/unix"
+)
+
+// systemSerial returns the SMBIOS system serial number.
+func systemSerial() (string, error) {
+	info, err := smbios.FromSysfs()
+	if err != nil {
+		return "", err
+	}
+	si, err := info.GetSystemInfo()
+	if err != nil {
+		return "", err
+	}
+	return si.SerialNumber, nil
+}
+
+// fsLabel returns the volume label of an ISO 9660 or FAT file system.
+func fsLabel(r io.ReaderAt) string {
+	// ISO 9660: the primary volume descriptor is at sector 16, and its
+	// volume identifier at offset 40.
+	pvd := make([]byte, 72)
+	if _, err := r.ReadAt(pvd, 0x8000); err == nil && string(pvd[1:6]) == "CD001" {
+		return strings.TrimSpace(string(pvd[40:72]))
+	}
+	// FAT: the label is in the extended boot record, whose position
+	// differs between FAT12/16 and FAT32.
+	bs := make([]byte, 90)
+	if _, err := r.ReadAt(bs, 0); err != nil {
+		return ""
+	}
+	switch {
+	case bytes.HasPrefix(bs[82:], []byte("FAT32")):
+		return strings.TrimSpace(string(bs[71:82]))
+	case bytes.HasPrefix(bs[54:], []byte("FAT1")):
+		return strings.TrimSpace(string(bs[43:54]))
+	}
+	return ""
+}
+
+// NoCloudDevice is a NoCloud seed on a partition or CD labelled "cidata".
+type NoCloudDevice struct {
+	// Device is the seed device; empty searches all block devices.
+	Device string
+}
+
+// Name implements Source.Name.
+func (n *NoCloudDevice) Name() string {
+	if len(n.Device) > 0 {
+		return "nocloud:" + n.Device
+	}
+	return "nocloud:cidata"
+}
+
+// findSeed returns the first block device labelled cidata.
+func findSeed() (string, error) {
+	devs, err := block.GetBlockDevices()
+	if err != nil {
+		return "", err
+	}
+	for _, d := range devs.FilterZeroSize() {
+		f, err := os.Open(d.DevicePath())
+		if err != nil {
+			continue
+		}
+		label := fsLabel(f)
+		f.Close()
+		if strings.EqualFold(label, "cidata") {
+			return d.DevicePath(), nil
+		}
+	}
+	return "", ErrNotFound
+}
+
+// Fetch implements Source.Fetch.
+func (n *NoCloudDevice) Fetch(ctx context.Context) (*Metadata, error) {
+	dev := n.Device
+	if len(dev) == 0 {
+		var err error
+		if dev, err = findSeed(); err != nil {
+			return nil, err
+		}
+	}
+	dir, err := ioutil.TempDir("", "cidata")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	mp, err := mount.TryMount(dev, dir, unix.MS_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	defer mp.Unmount(0)
+	return (&NoCloudDir{Dir: filepath.Clean(dir)}).Fetch(ctx)
+}
+
+// SetHostname sets the system's host name to the instance's.
+func (md *Metadata) SetHostname() error {
+	if len(md.Hostname) == 0 {
+		return nil
+	}
+	// Metadata may carry a fully qualified name.
+	return unix.Sethostname([]byte(strings.SplitN(md.Hostname, ".", 2)[0]))
+}
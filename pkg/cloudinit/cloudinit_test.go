@@ -0,0 +1,209 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cloudinit
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/ulog"
+)
+
+func TestParseMetaData(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		in   string
+		want *Metadata
+	}{
+		{
+			name: "list of keys",
+			in:   "instance-id: iid-1\nlocal-hostname: host1\npublic-keys:\n  - ssh-ed25519 AAAA a@b\n  - ssh-rsa BBBB c@d\n",
+			want: &Metadata{InstanceID: "iid-1", Hostname: "host1", SSHKeys: []string{"ssh-ed25519 AAAA a@b", "ssh-rsa BBBB c@d"}},
+		},
+		{
+			name: "map of keys, hostname",
+			in:   "instance-id: iid-2\nhostname: host2\npublic-keys:\n  b: ssh-rsa BBBB\n  a: ssh-rsa AAAA\n",
+			want: &Metadata{InstanceID: "iid-2", Hostname: "host2", SSHKeys: []string{"ssh-rsa AAAA", "ssh-rsa BBBB"}},
+		},
+		{
+			name: "single key",
+			in:   "instance-id: iid-3\npublic-keys: ssh-rsa AAAA\n",
+			want: &Metadata{InstanceID: "iid-3", SSHKeys: []string{"ssh-rsa AAAA"}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseMetaData([]byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseMetaData() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNoCloudDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudinit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	src := &NoCloudDir{Dir: dir}
+	if _, err := src.Fetch(context.Background()); err != ErrNotFound {
+		t.Fatalf("Fetch() of empty seed = %v, want ErrNotFound", err)
+	}
+
+	ioutil.WriteFile(filepath.Join(dir, "meta-data"), []byte("instance-id: iid-1\nlocal-hostname: host1\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "user-data"), []byte("#cloud-config\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "network-config"), []byte("network:\n  version: 2\n  ethernets: {}\n"), 0644)
+
+	md, err := Fetch(context.Background(), ulog.Null, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Source != src.Name() || md.Hostname != "host1" || string(md.UserData) != "#cloud-config\n" || md.NetworkConfigFormat != NetplanV2 {
+		t.Errorf("Fetch() = %+v", md)
+	}
+}
+
+func TestNoCloudSMBIOS(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/seed/meta-data":
+			w.Write([]byte("instance-id: seed-id\nlocal-hostname: seedhost\npublic-keys: [ssh-rsa AAAA]\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		serial string
+		want   *Metadata
+	}{
+		{"VMware-56 4d", nil},
+		{"ds=nocloud;h=host1;i=iid-1", &Metadata{InstanceID: "iid-1", Hostname: "host1"}},
+		{"ds=nocloud-net;s=" + srv.URL + "/seed/;h=override", &Metadata{InstanceID: "seed-id", Hostname: "override", SSHKeys: []string{"ssh-rsa AAAA"}}},
+	} {
+		md, err := (&NoCloudSMBIOS{Serial: tt.serial}).Fetch(context.Background())
+		if tt.want == nil {
+			if err != ErrNotFound {
+				t.Errorf("Fetch(%q) = %v, want ErrNotFound", tt.serial, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Fetch(%q) = %v", tt.serial, err)
+			continue
+		}
+		if !reflect.DeepEqual(md, tt.want) {
+			t.Errorf("Fetch(%q) = %+v, want %+v", tt.serial, md, tt.want)
+		}
+	}
+}
+
+func TestEC2(t *testing.T) {
+	files := map[string]string{
+		"/latest/meta-data/instance-id":               "i-0123",
+		"/latest/meta-data/local-hostname":            "ip-10-0-0-1.ec2.internal",
+		"/latest/meta-data/public-keys/":              "0=mykey\n1=other",
+		"/latest/meta-data/public-keys/0/openssh-key": "ssh-rsa AAAA mykey\n",
+		"/latest/meta-data/public-keys/1/openssh-key": "ssh-ed25519 BBBB other\n",
+		"/latest/user-data":                           "#!/bin/sh\n",
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" && r.URL.Path == "/latest/api/token" {
+			w.Write([]byte("tok"))
+			return
+		}
+		if r.Header.Get("X-Aws-Ec2-Metadata-Token") != "tok" {
+			http.Error(w, "no token", http.StatusUnauthorized)
+			return
+		}
+		f, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(f))
+	}))
+	defer srv.Close()
+
+	md, err := (&EC2{Endpoint: srv.URL}).Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Metadata{
+		InstanceID: "i-0123",
+		Hostname:   "ip-10-0-0-1.ec2.internal",
+		SSHKeys:    []string{"ssh-rsa AAAA mykey", "ssh-ed25519 BBBB other"},
+		UserData:   []byte("#!/bin/sh\n"),
+	}
+	if !reflect.DeepEqual(md, want) {
+		t.Errorf("Fetch() = %+v, want %+v", md, want)
+	}
+}
+
+func TestOpenStack(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/openstack/latest/meta_data.json":
+			w.Write([]byte(`{"uuid": "83679162", "hostname": "vm1", "public_keys": {"mykey": "ssh-rsa AAAA"}}`))
+		case "/openstack/latest/network_data.json":
+			w.Write([]byte(`{"links": []}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	md, err := (&OpenStack{Endpoint: srv.URL}).Fetch(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.InstanceID != "83679162" || md.Hostname != "vm1" || !reflect.DeepEqual(md.SSHKeys, []string{"ssh-rsa AAAA"}) || md.NetworkConfigFormat != OpenStackNetworkData || md.UserData != nil {
+		t.Errorf("Fetch() = %+v", md)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+	if _, err := Fetch(context.Background(), ulog.Null, &EC2{Endpoint: srv.URL}, &OpenStack{Endpoint: srv.URL}); err != ErrNotFound {
+		t.Errorf("Fetch() = %v, want ErrNotFound", err)
+	}
+}
+
+func TestWriteAuthorizedKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cloudinit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, ".ssh", "authorized_keys")
+	md := &Metadata{SSHKeys: []string{"ssh-rsa AAAA", "ssh-rsa BBBB"}}
+	for i := 0; i < 2; i++ {
+		if err := md.WriteAuthorizedKeys(path); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Split(strings.TrimSpace(string(b)), "\n"); !reflect.DeepEqual(got, md.SSHKeys) {
+		t.Errorf("authorized_keys = %q, want %q", got, md.SSHKeys)
+	}
+}
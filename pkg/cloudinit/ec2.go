@@ -0,0 +1,127 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cloudinit
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// DefaultEndpoint is the link-local address of the EC2 and OpenStack
+// metadata services.
+const DefaultEndpoint = "http://169.254.169.254"
+
+// httpGet fetches url with the given extra headers. It also returns the
+// status code, which is 0 if the request did not get an answer.
+func httpGet(ctx context.Context, c *http.Client, url string, header http.Header) ([]byte, int, error) {
+	return httpDo(ctx, c, "GET", url, header)
+}
+
+func httpDo(ctx context.Context, c *http.Client, method, url string, header http.Header) ([]byte, int, error) {
+	if c == nil {
+		c = &http.Client{Timeout: DefaultTimeout}
+	}
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := c.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, resp.StatusCode, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, resp.StatusCode, fmt.Errorf("%s %s: %s", method, url, resp.Status)
+	}
+	return b, resp.StatusCode, nil
+}
+
+// EC2 is the EC2 instance metadata service. IMDSv2 session tokens are used
+// when the service supports them.
+type EC2 struct {
+	// Endpoint defaults to DefaultEndpoint.
+	Endpoint string
+	Client   *http.Client
+}
+
+// Name implements Source.Name.
+func (e *EC2) Name() string {
+	return "ec2"
+}
+
+func (e *EC2) endpoint() string {
+	if len(e.Endpoint) > 0 {
+		return strings.TrimSuffix(e.Endpoint, "/")
+	}
+	return DefaultEndpoint
+}
+
+// Fetch implements Source.Fetch.
+func (e *EC2) Fetch(ctx context.Context) (*Metadata, error) {
+	base := e.endpoint() + "/latest"
+
+	h := http.Header{}
+	tok, status, err := httpDo(ctx, e.Client, "PUT", base+"/api/token", http.Header{
+		"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": {"300"},
+	})
+	switch {
+	case status == 0:
+		// Nothing answered.
+		return nil, ErrNotFound
+	case err == nil:
+		h.Set("X-Aws-Ec2-Metadata-Token", string(tok))
+	}
+	// Otherwise, this is IMDSv1 only.
+
+	get := func(path string) ([]byte, int, error) {
+		return httpGet(ctx, e.Client, base+path, h)
+	}
+	id, status, err := get("/meta-data/instance-id")
+	if status == 0 || status == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	md := &Metadata{InstanceID: string(id)}
+
+	if b, _, err := get("/meta-data/local-hostname"); err == nil {
+		md.Hostname = string(b)
+	} else if b, _, err := get("/meta-data/hostname"); err == nil {
+		md.Hostname = string(b)
+	}
+
+	// public-keys lists "N=name" lines; the keys are at N/openssh-key.
+	if b, _, err := get("/meta-data/public-keys/"); err == nil {
+		for _, l := range strings.Split(string(b), "\n") {
+			idx := strings.SplitN(strings.TrimSpace(l), "=", 2)[0]
+			if len(idx) == 0 {
+				continue
+			}
+			k, _, err := get("/meta-data/public-keys/" + idx + "/openssh-key")
+			if err != nil {
+				return nil, err
+			}
+			md.SSHKeys = append(md.SSHKeys, publicKeys(string(k))...)
+		}
+	}
+
+	ud, status, err := get("/user-data")
+	if err != nil && status != http.StatusNotFound {
+		return nil, err
+	}
+	md.UserData = ud
+	return md, nil
+}
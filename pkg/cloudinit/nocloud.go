@@ -0,0 +1,271 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cloudinit
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// NoCloud seed files.
+const (
+	metaDataFile      = "meta-data"
+	userDataFile      = "user-data"
+	networkConfigFile = "network-config"
+)
+
+type noCloudMetaData struct {
+	InstanceID    string      `yaml:"instance-id"`
+	LocalHostname string      `yaml:"local-hostname"`
+	Hostname      string      `yaml:"hostname"`
+	PublicKeys    interface{} `yaml:"public-keys"`
+}
+
+// parseMetaData parses a NoCloud meta-data file.
+func parseMetaData(b []byte) (*Metadata, error) {
+	var m noCloudMetaData
+	if err := yaml.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("meta-data: %v", err)
+	}
+	md := &Metadata{
+		InstanceID: m.InstanceID,
+		Hostname:   m.LocalHostname,
+		SSHKeys:    publicKeys(m.PublicKeys),
+	}
+	if len(md.Hostname) == 0 {
+		md.Hostname = m.Hostname
+	}
+	return md, nil
+}
+
+// publicKeys flattens the shapes public-keys comes in: a string, a list, or
+// a map from key name to key.
+func publicKeys(v interface{}) []string {
+	switch k := v.(type) {
+	case string:
+		var keys []string
+		for _, l := range strings.Split(k, "\n") {
+			if l = strings.TrimSpace(l); len(l) > 0 {
+				keys = append(keys, l)
+			}
+		}
+		return keys
+	case []interface{}:
+		var keys []string
+		for _, e := range k {
+			keys = append(keys, publicKeys(e)...)
+		}
+		return keys
+	case map[interface{}]interface{}:
+		// Sort by name so the order is stable.
+		byName := make(map[string]interface{})
+		var names []string
+		for n, v := range k {
+			byName[fmt.Sprint(n)] = v
+			names = append(names, fmt.Sprint(n))
+		}
+		sort.Strings(names)
+		var keys []string
+		for _, n := range names {
+			keys = append(keys, publicKeys(byName[n])...)
+		}
+		return keys
+	}
+	return nil
+}
+
+// networkConfigFormat returns the format of a network-config file, which
+// may have its config under a top-level "network" key.
+func networkConfigFormat(b []byte) (string, error) {
+	var c struct {
+		Version int
+		Network *struct {
+			Version int
+		}
+	}
+	if err := yaml.Unmarshal(b, &c); err != nil {
+		return "", fmt.Errorf("network-config: %v", err)
+	}
+	if c.Network != nil {
+		c.Version = c.Network.Version
+	}
+	switch c.Version {
+	case 1:
+		return NetplanV1, nil
+	case 2:
+		return NetplanV2, nil
+	}
+	return "", fmt.Errorf("network-config: unsupported version %d", c.Version)
+}
+
+// fromSeed assembles metadata from NoCloud seed files read by get, which
+// returns nil data for files that do not exist.
+func fromSeed(get func(name string) ([]byte, error)) (*Metadata, error) {
+	b, err := get(metaDataFile)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil {
+		return nil, ErrNotFound
+	}
+	md, err := parseMetaData(b)
+	if err != nil {
+		return nil, err
+	}
+	if md.UserData, err = get(userDataFile); err != nil {
+		return nil, err
+	}
+	nc, err := get(networkConfigFile)
+	if err != nil {
+		return nil, err
+	}
+	if len(nc) > 0 {
+		if md.NetworkConfigFormat, err = networkConfigFormat(nc); err != nil {
+			return nil, err
+		}
+		md.NetworkConfig = nc
+	}
+	return md, nil
+}
+
+// NoCloudDir is a NoCloud seed directory, such as a mounted seed device or
+// /var/lib/cloud/seed/nocloud.
+type NoCloudDir struct {
+	Dir string
+}
+
+// Name implements Source.Name.
+func (n *NoCloudDir) Name() string {
+	return "nocloud:" + n.Dir
+}
+
+// Fetch implements Source.Fetch.
+func (n *NoCloudDir) Fetch(ctx context.Context) (*Metadata, error) {
+	return fromSeed(func(name string) ([]byte, error) {
+		b, err := ioutil.ReadFile(filepath.Join(n.Dir, name))
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return b, err
+	})
+}
+
+// NoCloudURL is a NoCloud seed served over HTTP(S).
+type NoCloudURL struct {
+	// URL is the seed's base URL. The seed files are relative to it,
+	// so it normally ends in a slash.
+	URL    string
+	Client *http.Client
+}
+
+// Name implements Source.Name.
+func (n *NoCloudURL) Name() string {
+	return "nocloud-net:" + n.URL
+}
+
+// Fetch implements Source.Fetch.
+func (n *NoCloudURL) Fetch(ctx context.Context) (*Metadata, error) {
+	base, err := url.Parse(n.URL)
+	if err != nil {
+		return nil, err
+	}
+	return fromSeed(func(name string) ([]byte, error) {
+		u, err := base.Parse(name)
+		if err != nil {
+			return nil, err
+		}
+		b, status, err := httpGet(ctx, n.Client, u.String(), nil)
+		if status == http.StatusNotFound {
+			return nil, nil
+		}
+		return b, err
+	})
+}
+
+// NoCloudSMBIOS is NoCloud configured through the SMBIOS system serial
+// number, which hypervisors let users set, e.g.
+// "ds=nocloud;h=myhost;i=id-1" or "ds=nocloud-net;s=http://10.0.0.1/seed/".
+// Keys are s (seedfrom), h (local-hostname) and i (instance-id).
+type NoCloudSMBIOS struct {
+	// Serial is the serial number; empty reads it from SMBIOS.
+	Serial string
+	Client *http.Client
+}
+
+// Name implements Source.Name.
+func (n *NoCloudSMBIOS) Name() string {
+	return "nocloud-smbios"
+}
+
+// parseSerial returns the key-value pairs of a NoCloud serial number, or
+// nil if the serial is not one.
+func parseSerial(serial string) map[string]string {
+	fields := strings.Split(serial, ";")
+	if fields[0] != "ds=nocloud" && fields[0] != "ds=nocloud-net" {
+		return nil
+	}
+	kv := make(map[string]string)
+	for _, f := range fields[1:] {
+		p := strings.SplitN(f, "=", 2)
+		if len(p) != 2 {
+			continue
+		}
+		switch p[0] {
+		case "s", "seedfrom":
+			kv["s"] = p[1]
+		case "h", "local-hostname":
+			kv["h"] = p[1]
+		case "i", "instance-id":
+			kv["i"] = p[1]
+		}
+	}
+	return kv
+}
+
+// Fetch implements Source.Fetch.
+func (n *NoCloudSMBIOS) Fetch(ctx context.Context) (*Metadata, error) {
+	serial := n.Serial
+	if len(serial) == 0 {
+		var err error
+		if serial, err = systemSerial(); err != nil {
+			return nil, ErrNotFound
+		}
+	}
+	kv := parseSerial(serial)
+	if kv == nil {
+		return nil, ErrNotFound
+	}
+
+	md := &Metadata{}
+	if seed, ok := kv["s"]; ok {
+		var src Source
+		if strings.HasPrefix(seed, "http://") || strings.HasPrefix(seed, "https://") {
+			src = &NoCloudURL{URL: seed, Client: n.Client}
+		} else {
+			src = &NoCloudDir{Dir: strings.TrimPrefix(seed, "file://")}
+		}
+		var err error
+		if md, err = src.Fetch(ctx); err != nil {
+			return nil, fmt.Errorf("seed %s: %v", seed, err)
+		}
+	}
+	// The serial number's values win over the seed's.
+	if h, ok := kv["h"]; ok {
+		md.Hostname = h
+	}
+	if i, ok := kv["i"]; ok {
+		md.InstanceID = i
+	}
+	return md, nil
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cloudinit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// OpenStack is the OpenStack metadata service.
+type OpenStack struct {
+	// Endpoint defaults to DefaultEndpoint.
+	Endpoint string
+	Client   *http.Client
+}
+
+// Name implements Source.Name.
+func (o *OpenStack) Name() string {
+	return "openstack"
+}
+
+type openStackMetaData struct {
+	UUID       string            `json:"uuid"`
+	Hostname   string            `json:"hostname"`
+	PublicKeys map[string]string `json:"public_keys"`
+}
+
+// Fetch implements Source.Fetch.
+func (o *OpenStack) Fetch(ctx context.Context) (*Metadata, error) {
+	base := DefaultEndpoint
+	if len(o.Endpoint) > 0 {
+		base = strings.TrimSuffix(o.Endpoint, "/")
+	}
+	base += "/openstack/latest/"
+
+	b, status, err := httpGet(ctx, o.Client, base+"meta_data.json", nil)
+	if status == 0 || status == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var m openStackMetaData
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("meta_data.json: %v", err)
+	}
+	md := &Metadata{
+		InstanceID: m.UUID,
+		Hostname:   m.Hostname,
+	}
+	var names []string
+	for n := range m.PublicKeys {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		md.SSHKeys = append(md.SSHKeys, publicKeys(m.PublicKeys[n])...)
+	}
+
+	if md.UserData, status, err = httpGet(ctx, o.Client, base+"user_data", nil); err != nil && status != http.StatusNotFound {
+		return nil, err
+	}
+	nd, status, err := httpGet(ctx, o.Client, base+"network_data.json", nil)
+	if err != nil && status != http.StatusNotFound {
+		return nil, err
+	}
+	if len(nd) > 0 {
+		md.NetworkConfig = nd
+		md.NetworkConfigFormat = OpenStackNetworkData
+	}
+	return md, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package console mirrors output to several consoles and takes input from
+// any of them, as firmware does with its VGA and serial consoles.
+package console
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// ErrNoConsoles is returned by Write when there is no console left to write
+// to.
+var ErrNoConsoles = errors.New("no consoles")
+
+// Mux writes everything written to it to all of its consoles, and copies
+// whatever is typed on any console to a single input.
+//
+// A console that fails a read or write is dropped; the rest carry on.
+type Mux struct {
+	in io.Writer
+
+	mu       sync.Mutex
+	consoles []io.ReadWriteCloser
+}
+
+// NewMux returns a Mux that copies console input to in.
+func NewMux(in io.Writer) *Mux {
+	return &Mux{in: in}
+}
+
+// Add adds a console. Anything that can be read from and written to will do,
+// so network consoles can be added the same way as ttys.
+func (m *Mux) Add(c io.ReadWriteCloser) {
+	m.mu.Lock()
+	m.consoles = append(m.consoles, c)
+	m.mu.Unlock()
+	go m.readFrom(c)
+}
+
+func (m *Mux) readFrom(c io.ReadWriteCloser) {
+	// Input is typed by people, so it comes in small pieces.
+	var b [256]byte
+	for {
+		n, err := c.Read(b[:])
+		if n > 0 {
+			if _, err := m.in.Write(b[:n]); err != nil {
+				return
+			}
+		}
+		if err != nil {
+			m.remove(c)
+			return
+		}
+	}
+}
+
+func (m *Mux) remove(c io.ReadWriteCloser) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, cc := range m.consoles {
+		if cc == c {
+			m.consoles = append(m.consoles[:i], m.consoles[i+1:]...)
+			c.Close()
+			return
+		}
+	}
+}
+
+// Len returns the number of consoles.
+func (m *Mux) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.consoles)
+}
+
+// Write writes p to every console. It only fails if there are no consoles
+// left.
+func (m *Mux) Write(p []byte) (int, error) {
+	m.mu.Lock()
+	consoles := append([]io.ReadWriteCloser(nil), m.consoles...)
+	m.mu.Unlock()
+
+	var ok bool
+	for _, c := range consoles {
+		if _, err := c.Write(p); err != nil {
+			m.remove(c)
+			continue
+		}
+		ok = true
+	}
+	if !ok {
+		return 0, ErrNoConsoles
+	}
+	return len(p), nil
+}
+
+// Close closes all consoles.
+func (m *Mux) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var err error
+	for _, c := range m.consoles {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = cerr
+		}
+	}
+	m.consoles = nil
+	return err
+}
@@ -0,0 +1,173 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package console
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/termios"
+	"golang.org/x/sys/unix"
+)
+
+// Device is a console named on the kernel command line.
+type Device struct {
+	// Path is the device node, e.g. /dev/ttyS0.
+	Path string
+	// Baud is the serial speed, or 0 to leave it alone.
+	Baud int
+}
+
+// ParseCmdline returns the consoles named by console= in cmdline, in order.
+// Options are as in the kernel's admin-guide: "ttyS0,115200n8", "tty0",
+// "hvc0". Only the speed of the options is used.
+func ParseCmdline(cmdline string) []Device {
+	var devs []Device
+	for _, f := range strings.Fields(cmdline) {
+		if !strings.HasPrefix(f, "console=") {
+			continue
+		}
+		v := strings.Trim(strings.TrimPrefix(f, "console="), `"`)
+		name, opts := v, ""
+		if i := strings.IndexByte(v, ','); i >= 0 {
+			name, opts = v[:i], v[i+1:]
+		}
+		if name == "" || name == "null" {
+			continue
+		}
+		d := Device{Path: filepath.Join("/dev", name)}
+		// The speed is the leading digits, followed by parity and bits.
+		n := 0
+		for n < len(opts) && opts[n] >= '0' && opts[n] <= '9' {
+			n++
+		}
+		if baud, err := strconv.Atoi(opts[:n]); err == nil {
+			d.Baud = baud
+		}
+		devs = append(devs, d)
+	}
+	return devs
+}
+
+// Devices returns the consoles on the kernel command line, or /dev/console
+// if there are none.
+func Devices() ([]Device, error) {
+	b, err := ioutil.ReadFile("/proc/cmdline")
+	if err != nil {
+		return nil, err
+	}
+	if devs := ParseCmdline(string(b)); len(devs) > 0 {
+		return devs, nil
+	}
+	return []Device{{Path: "/dev/console"}}, nil
+}
+
+// tty is a console device in raw mode. All line editing is left to the
+// pty the consoles are multiplexed onto.
+type tty struct {
+	*os.File
+	restore *unix.Termios
+}
+
+// Open opens d and puts it in raw mode at its speed.
+func Open(d Device) (io.ReadWriteCloser, error) {
+	f, err := os.OpenFile(d.Path, os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, err
+	}
+	restore, err := termios.GetTermios(f.Fd())
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", d.Path, err)
+	}
+	raw := termios.MakeRaw(restore)
+	if d.Baud != 0 {
+		if raw, err = termios.MakeSerialBaud(raw, d.Baud); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("%s: %v", d.Path, err)
+		}
+		raw.Cflag |= unix.CLOCAL | unix.CREAD
+	}
+	if err := termios.SetTermios(f.Fd(), raw); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", d.Path, err)
+	}
+	return &tty{File: f, restore: restore}, nil
+}
+
+func (t *tty) Close() error {
+	termios.SetTermios(t.Fd(), t.restore)
+	return t.File.Close()
+}
+
+// openPty returns a new pty's master and slave.
+func openPty() (*os.File, *os.File, error) {
+	ptm, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := unix.IoctlSetPointerInt(int(ptm.Fd()), unix.TIOCSPTLCK, 0); err != nil {
+		ptm.Close()
+		return nil, nil, fmt.Errorf("unlock pty: %v", err)
+	}
+	n, err := unix.IoctlGetInt(int(ptm.Fd()), unix.TIOCGPTN)
+	if err != nil {
+		ptm.Close()
+		return nil, nil, fmt.Errorf("pty number: %v", err)
+	}
+	pts, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|unix.O_NOCTTY, 0)
+	if err != nil {
+		ptm.Close()
+		return nil, nil, err
+	}
+	return ptm, pts, nil
+}
+
+// Attach opens devs and makes stdin, stdout and stderr a pty multiplexed
+// onto all of them, so that menus, prompts and logs appear on every console
+// and input is taken from any. Consoles that cannot be opened are logged
+// and skipped. More consoles, e.g. a network console, can be added to the
+// returned Mux.
+func Attach(devs []Device) (*Mux, error) {
+	ptm, pts, err := openPty()
+	if err != nil {
+		return nil, err
+	}
+	m := NewMux(ptm)
+	var sized bool
+	for _, d := range devs {
+		c, err := Open(d)
+		if err != nil {
+			log.Printf("console: %v", err)
+			continue
+		}
+		// Serial consoles have no size; use the first console that does.
+		if ws, err := termios.GetWinSize(c.(*tty).Fd()); !sized && err == nil && ws.Row != 0 && ws.Col != 0 {
+			sized = termios.SetWinSize(pts.Fd(), ws) == nil
+		}
+		m.Add(c)
+	}
+	if m.Len() == 0 {
+		ptm.Close()
+		pts.Close()
+		return nil, ErrNoConsoles
+	}
+	go io.Copy(m, ptm)
+
+	for fd := 0; fd <= 2; fd++ {
+		if err := unix.Dup3(int(pts.Fd()), fd, 0); err != nil {
+			m.Close()
+			return nil, err
+		}
+	}
+	pts.Close()
+	return m, nil
+}
@@ -0,0 +1,29 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package console
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseCmdline(t *testing.T) {
+	for _, tt := range []struct {
+		cmdline string
+		want    []Device
+	}{
+		{"root=/dev/sda1 quiet", nil},
+		{"console=tty0", []Device{{Path: "/dev/tty0"}}},
+		{
+			"console=tty0 console=ttyS0,115200n8 earlycon console=ttyS1,9600 console=null",
+			[]Device{{Path: "/dev/tty0"}, {Path: "/dev/ttyS0", Baud: 115200}, {Path: "/dev/ttyS1", Baud: 9600}},
+		},
+		{"console=hvc0,", []Device{{Path: "/dev/hvc0"}}},
+	} {
+		if got := ParseCmdline(tt.cmdline); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseCmdline(%q) = %v, want %v", tt.cmdline, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package console
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fake is a console whose input is a pipe and whose output is a buffer.
+type fake struct {
+	*io.PipeReader
+	in *io.PipeWriter
+
+	mu  sync.Mutex
+	out bytes.Buffer
+	err error
+}
+
+func newFake() *fake {
+	r, w := io.Pipe()
+	return &fake{PipeReader: r, in: w}
+}
+
+func (f *fake) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return 0, f.err
+	}
+	return f.out.Write(p)
+}
+
+func (f *fake) output() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.out.String()
+}
+
+type syncBuffer struct {
+	mu sync.Mutex
+	b  bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+func TestMuxWrite(t *testing.T) {
+	a, b, broken := newFake(), newFake(), newFake()
+	broken.err = errors.New("unplugged")
+	m := NewMux(&syncBuffer{})
+	for _, c := range []io.ReadWriteCloser{a, broken, b} {
+		m.Add(c)
+	}
+
+	if n, err := m.Write([]byte("boot menu\r\n")); n != 11 || err != nil {
+		t.Fatalf("Write = %d, %v, want 11, nil", n, err)
+	}
+	for i, c := range []*fake{a, b} {
+		if got := c.output(); got != "boot menu\r\n" {
+			t.Errorf("console %d got %q, want %q", i, got, "boot menu\r\n")
+		}
+	}
+	if m.Len() != 2 {
+		t.Errorf("Len() = %d after a failed write, want 2", m.Len())
+	}
+
+	a.err, b.err = broken.err, broken.err
+	if _, err := m.Write([]byte("x")); err != ErrNoConsoles {
+		t.Errorf("Write with all consoles broken = %v, want %v", err, ErrNoConsoles)
+	}
+}
+
+func TestMuxInput(t *testing.T) {
+	a, b := newFake(), newFake()
+	in := &syncBuffer{}
+	m := NewMux(in)
+	m.Add(a)
+	m.Add(b)
+
+	deadline := time.Now().Add(5 * time.Second)
+	want := ""
+	for _, k := range []struct {
+		c   *fake
+		key string
+	}{{a, "1"}, {b, "2"}, {a, "\r"}} {
+		k.c.in.Write([]byte(k.key))
+		want += k.key
+		for in.String() != want && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	if got := in.String(); got != "12\r" {
+		t.Errorf("input = %q, want %q", got, "12\r")
+	}
+
+	// A console that goes away is dropped.
+	a.in.Close()
+	for m.Len() != 1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if m.Len() != 1 {
+		t.Errorf("Len() = %d after a console went away, want 1", m.Len())
+	}
+	m.Close()
+}
@@ -0,0 +1,179 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpio
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// extractBufSize is the size of each worker's copy buffer.
+const extractBufSize = 1 << 20
+
+// ExtractAll creates recs under rootDir the way the kernel unpacks an
+// initramfs: a later record replaces an earlier one of the same name, and
+// regular files that share an inode are hard links to one another.
+//
+// Directories and symlinks are created first, in archive order. Regular
+// files and devices are then created by workers goroutines at once, or
+// runtime.NumCPU() if workers is 0, and hard links last. Record contents
+// must be safe to read concurrently, as files and bytes.Readers are.
+//
+// Records are never created through a symlink, even one the archive made
+// itself: those that CheckPath refuses are not created.
+//
+// forcePriv is as for CreateFileInRoot. ExtractAll carries on past errors
+// and returns the first.
+func ExtractAll(recs []Record, rootDir string, workers int, forcePriv bool) error {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	last := make(map[string]int, len(recs))
+	for i, r := range recs {
+		last[Normalize(r.Name)] = i
+	}
+
+	var (
+		early, files []Record
+		links        []Record
+		linkTo       = make(map[devInode]Record)
+	)
+	for i, r := range recs {
+		if last[Normalize(r.Name)] != i {
+			continue
+		}
+		switch r.Mode & modeTypeMask {
+		case modeDir, modeSymlink:
+			early = append(early, r)
+		case modeFile:
+			if r.NLink <= 1 {
+				files = append(files, r)
+				break
+			}
+			// The kernel puts the contents with any one of the
+			// links, so the one with contents is created and the
+			// others linked to it.
+			key := devInode{dev: r.Major<<32 | r.Minor, ino: r.Ino}
+			first, ok := linkTo[key]
+			switch {
+			case !ok:
+				linkTo[key] = r
+			case first.FileSize == 0 && r.FileSize > 0:
+				linkTo[key] = r
+				links = append(links, first)
+			default:
+				links = append(links, r)
+			}
+		default:
+			files = append(files, r)
+		}
+	}
+	for _, r := range linkTo {
+		files = append(files, r)
+	}
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for _, r := range early {
+		if err := CheckPath(rootDir, r.Name); err != nil {
+			fail(err)
+			continue
+		}
+		if err := CreateFileInRoot(r, rootDir, forcePriv); err != nil {
+			fail(err)
+		}
+	}
+
+	c := make(chan Record)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, extractBufSize)
+			for r := range c {
+				if err := CheckPath(rootDir, r.Name); err != nil {
+					fail(err)
+					continue
+				}
+				if err := createFileInRoot(r, rootDir, forcePriv, buf); err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
+	for _, r := range files {
+		c <- r
+	}
+	close(c)
+	wg.Wait()
+
+	for _, r := range links {
+		target := linkTo[devInode{dev: r.Major<<32 | r.Minor, ino: r.Ino}]
+		if err := CheckPath(rootDir, r.Name); err != nil {
+			fail(err)
+			continue
+		}
+		if err := CheckPath(rootDir, target.Name); err != nil {
+			fail(err)
+			continue
+		}
+		oldname := filepath.Join(rootDir, Normalize(target.Name))
+		newname := filepath.Join(rootDir, Normalize(r.Name))
+		os.Remove(newname)
+		if err := os.MkdirAll(filepath.Dir(newname), 0755); err != nil {
+			fail(err)
+			continue
+		}
+		if err := os.Link(oldname, newname); err != nil {
+			fail(fmt.Errorf("linking %q to %q: %v", r.Name, target.Name, err))
+		}
+	}
+	return firstErr
+}
+
+// CheckPath returns an error if the record named name would be created
+// outside rootDir, or through anything but a directory on the way there,
+// such as a symlink an earlier record made. Directories that do not exist
+// yet are fine; they are created as directories.
+func CheckPath(rootDir, name string) error {
+	name = Normalize(name)
+	if name == ".." || strings.HasPrefix(name, "../") {
+		return fmt.Errorf("%q is outside %s", name, rootDir)
+	}
+	dir := rootDir
+	for _, c := range strings.Split(filepath.Dir(name), "/") {
+		if c == "." {
+			continue
+		}
+		dir = filepath.Join(dir, c)
+		fi, err := os.Lstat(dir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			return fmt.Errorf("%q: %s is not a directory", name, dir)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpio
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestExtractAll(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	link := func(name, content string) Record {
+		return StaticRecord([]byte(content), Info{Name: name, Mode: unix.S_IFREG | 0644, Ino: 42, NLink: 3})
+	}
+	recs := []Record{
+		Directory("etc", 0755),
+		StaticFile("etc/hostname", "old", 0644),
+		Symlink("lib", "usr/lib"),
+		Directory("usr/lib", 0755),
+		StaticFile("usr/lib/libc.so", "libc", 0755),
+		link("bin/a", ""),
+		link("bin/b", "busybox"),
+		link("sbin/c", ""),
+		StaticFile("etc/hostname", "new", 0644),
+	}
+	for i := 0; i < 100; i++ {
+		recs = append(recs, StaticFile(fmt.Sprintf("data/%d", i), fmt.Sprint(i), 0644))
+	}
+	if err := ExtractAll(recs, dir, 4, false); err != nil {
+		t.Fatalf("ExtractAll() = %v", err)
+	}
+
+	for name, want := range map[string]string{
+		"etc/hostname":    "new",
+		"usr/lib/libc.so": "libc",
+		"bin/a":           "busybox",
+		"sbin/c":          "busybox",
+		"data/99":         "99",
+	} {
+		got, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+
+	if target, err := os.Readlink(filepath.Join(dir, "lib")); err != nil || target != "usr/lib" {
+		t.Errorf("lib links to %q, %v, want usr/lib", target, err)
+	}
+	a, err := os.Stat(filepath.Join(dir, "bin/a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"bin/b", "sbin/c"} {
+		fi, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !os.SameFile(a, fi) {
+			t.Errorf("%s is not a hard link to bin/a", name)
+		}
+	}
+}
+
+func TestExtractAllThroughSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	root, outside := filepath.Join(dir, "root"), filepath.Join(dir, "outside")
+	if err := os.Mkdir(outside, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	recs := []Record{
+		Symlink("a", outside),
+		StaticFile("a/pwned", "pwned", 0644),
+		Directory("a/dir", 0755),
+		Symlink("lib", "usr/lib"),
+		Directory("usr/lib", 0755),
+		StaticFile("lib/libc.so", "libc", 0755),
+		StaticFile("ok", "ok", 0644),
+	}
+	if err := ExtractAll(recs, root, 2, false); err == nil {
+		t.Error("ExtractAll() through symlinks did not fail")
+	}
+	for _, name := range []string{"outside/pwned", "outside/dir", "root/usr/lib/libc.so"} {
+		if _, err := os.Lstat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("%s was created through a symlink: %v", name, err)
+		}
+	}
+	if got, err := ioutil.ReadFile(filepath.Join(root, "ok")); err != nil || string(got) != "ok" {
+		t.Errorf("ok = %q, %v, want the other records created", got, err)
+	}
+}
@@ -115,6 +115,12 @@ func CreateFile(f Record) error {
 //
 // Block and char device creation will only return error if forcePriv is true.
 func CreateFileInRoot(f Record, rootDir string, forcePriv bool) error {
+	return createFileInRoot(f, rootDir, forcePriv, nil)
+}
+
+// createFileInRoot is CreateFileInRoot, copying file contents through buf
+// if it is not nil.
+func createFileInRoot(f Record, rootDir string, forcePriv bool, buf []byte) error {
 	m, err := linuxModeToFileType(f.Mode)
 	if err != nil {
 		return err
@@ -149,7 +155,15 @@ func CreateFileInRoot(f Record, rootDir string, forcePriv bool) error {
 			return err
 		}
 		defer nf.Close()
-		if _, err := io.Copy(nf, uio.Reader(f)); err != nil {
+		// Telling the file system the size up front saves it growing
+		// the file piecemeal and keeps the file contiguous.
+		preallocate(nf, int64(f.FileSize))
+		var w io.Writer = nf
+		if buf != nil {
+			// Hide ReadFrom, which would not use buf.
+			w = struct{ io.Writer }{nf}
+		}
+		if _, err := io.CopyBuffer(w, uio.Reader(f), buf); err != nil {
 			return err
 		}
 
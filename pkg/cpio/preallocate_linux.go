@@ -0,0 +1,19 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cpio
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// preallocate reserves size bytes for f. Not all file systems can, and
+// nothing depends on it, so errors are ignored.
+func preallocate(f *os.File, size int64) {
+	if size > 0 {
+		unix.Fallocate(int(f.Fd()), 0, 0, size)
+	}
+}
@@ -0,0 +1,11 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !linux
+
+package cpio
+
+import "os"
+
+func preallocate(f *os.File, size int64) {}
@@ -0,0 +1,280 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// DefaultChunkSize is the unit PeerClient fetches and shares files in.
+const DefaultChunkSize = 4 << 20
+
+// PeerClient implements FileScheme for HTTP files that machines fetching
+// the same file share among each other, so that a rack provisioning at
+// once does not have to get every byte from the origin server.
+//
+// Files are fetched in chunks. Each chunk is asked for from a peer first,
+// and from the origin if no peer has it yet. Every chunk fetched is
+// served to peers by Handler, which the caller has to serve on a port the
+// peers know about.
+//
+// Peers are trusted to serve the right data. Verify what was fetched,
+// e.g. against a checksum from the origin.
+type PeerClient struct {
+	// Client is used for the origin and peers. nil means
+	// http.DefaultClient.
+	Client *http.Client
+
+	// Peers are the base URLs of other machines' Handlers.
+	Peers []*url.URL
+
+	// ChunkSize defaults to DefaultChunkSize.
+	ChunkSize int64
+
+	// Parallel is how many chunks are fetched at once; defaults to 4.
+	Parallel int
+
+	// Dir holds the fetched files; empty means os.TempDir().
+	Dir string
+
+	mu    sync.Mutex
+	files map[string]*peerFile
+}
+
+// peerFile is a file that is being or has been fetched.
+type peerFile struct {
+	*os.File
+	size  int64
+	chunk int64
+
+	mu   sync.Mutex
+	have []bool
+}
+
+func (f *peerFile) setHave(i int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.have[i] = true
+}
+
+// hasRange returns whether all of [off, off+n) has been fetched.
+func (f *peerFile) hasRange(off, n int64) bool {
+	if off < 0 || n <= 0 || off > f.size || n > f.size-off {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := off / f.chunk; i <= (off+n-1)/f.chunk; i++ {
+		if !f.have[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *PeerClient) client() *http.Client {
+	if p.Client == nil {
+		return http.DefaultClient
+	}
+	return p.Client
+}
+
+// Fetch implements FileScheme.Fetch. Files that the origin cannot serve
+// in ranges are fetched from it as a whole.
+func (p *PeerClient) Fetch(ctx context.Context, u *url.URL) (io.ReaderAt, error) {
+	req, err := http.NewRequestWithContext(ctx, "HEAD", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return nil, &HTTPClientCodeError{fmt.Errorf("HEAD %s: %s", u, resp.Status), resp.StatusCode}
+	}
+	if resp.ContentLength <= 0 || resp.Header.Get("Accept-Ranges") != "bytes" {
+		return NewHTTPClient(p.client()).Fetch(ctx, u)
+	}
+
+	f, err := p.create(u, resp.ContentLength)
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := make(chan int64)
+	errs := make(chan error, 1)
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	parallel := p.Parallel
+	if parallel <= 0 {
+		parallel = 4
+	}
+	for w := 0; w < parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range chunks {
+				if err := p.fetchChunk(ctx, u, f, i); err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+					cancel()
+				}
+			}
+		}()
+	}
+	n := int64(len(f.have))
+	for i := int64(0); i < n && ctx.Err() == nil; i++ {
+		select {
+		case chunks <- i:
+		case <-ctx.Done():
+		}
+	}
+	close(chunks)
+	wg.Wait()
+
+	select {
+	case err := <-errs:
+		return nil, err
+	default:
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// create adds a file to be fetched, replacing any previous fetch of u.
+func (p *PeerClient) create(u *url.URL, size int64) (*peerFile, error) {
+	tmp, err := ioutil.TempFile(p.Dir, "peer")
+	if err != nil {
+		return nil, err
+	}
+	// Nobody else needs a name for it.
+	os.Remove(tmp.Name())
+
+	chunk := p.ChunkSize
+	if chunk <= 0 {
+		chunk = DefaultChunkSize
+	}
+	f := &peerFile{
+		File:  tmp,
+		size:  size,
+		chunk: chunk,
+		have:  make([]bool, (size+chunk-1)/chunk),
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.files == nil {
+		p.files = make(map[string]*peerFile)
+	}
+	p.files[u.String()] = f
+	return f, nil
+}
+
+// fetchChunk fetches chunk i, trying peers in an order that depends on i,
+// so that peers share the load.
+func (p *PeerClient) fetchChunk(ctx context.Context, u *url.URL, f *peerFile, i int64) error {
+	off := i * f.chunk
+	n := f.chunk
+	if off+n > f.size {
+		n = f.size - off
+	}
+
+	for j := range p.Peers {
+		peer := p.Peers[(int(i)+j)%len(p.Peers)]
+		q := url.Values{
+			"url": {u.String()},
+			"off": {strconv.FormatInt(off, 10)},
+			"len": {strconv.FormatInt(n, 10)},
+		}
+		pu := *peer
+		pu.RawQuery = q.Encode()
+		if err := p.get(ctx, pu.String(), "", http.StatusOK, f, off, n); err == nil {
+			f.setHave(i)
+			return nil
+		}
+	}
+
+	rng := fmt.Sprintf("bytes=%d-%d", off, off+n-1)
+	if err := p.get(ctx, u.String(), rng, http.StatusPartialContent, f, off, n); err != nil {
+		return err
+	}
+	f.setHave(i)
+	return nil
+}
+
+// get writes exactly n bytes from url to f at off.
+func (p *PeerClient) get(ctx context.Context, url, rng string, status int, f *peerFile, off, n int64) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	if len(rng) > 0 {
+		req.Header.Set("Range", rng)
+	}
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != status {
+		return &HTTPClientCodeError{fmt.Errorf("GET %s: %s", url, resp.Status), resp.StatusCode}
+	}
+	if _, err := io.CopyN(&offsetWriter{f, off}, resp.Body, n); err != nil {
+		return fmt.Errorf("GET %s: %v", url, err)
+	}
+	return nil
+}
+
+// offsetWriter writes sequentially from an offset of an io.WriterAt.
+type offsetWriter struct {
+	io.WriterAt
+	off int64
+}
+
+func (o *offsetWriter) Write(b []byte) (int, error) {
+	n, err := o.WriteAt(b, o.off)
+	o.off += int64(n)
+	return n, err
+}
+
+// Handler serves fetched chunks to peers. It answers 404 for anything not
+// fetched yet.
+func (p *PeerClient) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		off, err1 := strconv.ParseInt(q.Get("off"), 10, 64)
+		n, err2 := strconv.ParseInt(q.Get("len"), 10, 64)
+		if err1 != nil || err2 != nil {
+			http.Error(w, "bad range", http.StatusBadRequest)
+			return
+		}
+
+		p.mu.Lock()
+		f := p.files[q.Get("url")]
+		p.mu.Unlock()
+		if f == nil || !f.hasRange(off, n) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(n, 10))
+		io.Copy(w, io.NewSectionReader(f, off, n))
+	})
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package curl
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/u-root/u-root/pkg/uio"
+)
+
+func TestPeerClient(t *testing.T) {
+	img := make([]byte, 10*1000+123)
+	rand.New(rand.NewSource(1)).Read(img)
+
+	var originGets int32
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			atomic.AddInt32(&originGets, 1)
+		}
+		http.ServeContent(w, r, "img", time.Time{}, bytes.NewReader(img))
+	}))
+	defer origin.Close()
+	u, _ := url.Parse(origin.URL + "/img")
+
+	// The first machine gets everything from the origin.
+	first := &PeerClient{ChunkSize: 1000}
+	peerSrv := httptest.NewServer(first.Handler())
+	defer peerSrv.Close()
+
+	r, err := first.Fetch(context.Background(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadAll(uio.Reader(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, img) {
+		t.Fatalf("first fetch differs from origin")
+	}
+	if n := atomic.LoadInt32(&originGets); n != 11 {
+		t.Errorf("first fetch: %d origin GETs, want 11", n)
+	}
+
+	// Ranges past the end are not served, however large.
+	for _, rng := range []string{"off=10000&len=124", "off=1&len=9223372036854775807"} {
+		resp, err := http.Get(peerSrv.URL + "/?url=" + url.QueryEscape(u.String()) + "&" + rng)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("peer GET %s: %s, want 404", rng, resp.Status)
+		}
+	}
+
+	// The second gets everything from the first.
+	atomic.StoreInt32(&originGets, 0)
+	peer, _ := url.Parse(peerSrv.URL)
+	second := &PeerClient{ChunkSize: 1000, Peers: []*url.URL{peer}}
+	r, err = second.Fetch(context.Background(), u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = ioutil.ReadAll(uio.Reader(r))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, img) {
+		t.Fatalf("second fetch differs from origin")
+	}
+	if n := atomic.LoadInt32(&originGets); n != 0 {
+		t.Errorf("second fetch: %d origin GETs, want 0", n)
+	}
+
+	// A peer without the file falls back to the origin.
+	third := &PeerClient{ChunkSize: 4000, Peers: []*url.URL{peer}}
+	u2, _ := url.Parse(origin.URL + "/other")
+	if _, err := third.Fetch(context.Background(), u2); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&originGets); n != 3 {
+		t.Errorf("third fetch: %d origin GETs, want 3", n)
+	}
+}
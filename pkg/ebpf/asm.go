@@ -0,0 +1,282 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ebpf loads small, hand-assembled eBPF programs into the kernel,
+// attaches them to tracepoints and streams the events they emit.
+//
+// It is deliberately tiny: there is no ELF loader and no compiler. Programs
+// are written with the instruction helpers in this file, which is enough
+// for the handful of canned tracers u-root ships.
+package ebpf
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// Register is an eBPF register.
+type Register uint8
+
+// eBPF registers. R0 holds return values, R1-R5 hold arguments, R6-R9 are
+// callee saved and R10 is the read-only frame pointer.
+const (
+	R0 Register = iota
+	R1
+	R2
+	R3
+	R4
+	R5
+	R6
+	R7
+	R8
+	R9
+	R10
+)
+
+// Instruction classes.
+const (
+	classLD    = 0x00
+	classLDX   = 0x01
+	classST    = 0x02
+	classSTX   = 0x03
+	classALU   = 0x04
+	classJMP   = 0x05
+	classALU64 = 0x07
+)
+
+// Size is the width of a memory access.
+type Size uint8
+
+// Memory access sizes.
+const (
+	Word  Size = 0x00
+	Half  Size = 0x08
+	Byte  Size = 0x10
+	DWord Size = 0x18
+)
+
+// Addressing modes and operand sources.
+const (
+	modeIM  = 0x00
+	modeMEM = 0x60
+	srcK    = 0x00
+	srcX    = 0x08
+)
+
+// ALUOp is an arithmetic operation.
+type ALUOp uint8
+
+// ALU operations.
+const (
+	Add ALUOp = 0x00
+	Sub ALUOp = 0x10
+	Mul ALUOp = 0x20
+	Div ALUOp = 0x30
+	Or  ALUOp = 0x40
+	And ALUOp = 0x50
+	LSh ALUOp = 0x60
+	RSh ALUOp = 0x70
+	Mod ALUOp = 0x90
+	Xor ALUOp = 0xa0
+	Mov ALUOp = 0xb0
+)
+
+// JumpOp is a conditional jump operation.
+type JumpOp uint8
+
+// Jump operations.
+const (
+	JA   JumpOp = 0x00
+	JEq  JumpOp = 0x10
+	JGT  JumpOp = 0x20
+	JGE  JumpOp = 0x30
+	JSet JumpOp = 0x40
+	JNE  JumpOp = 0x50
+)
+
+const (
+	opCall = 0x80
+	opExit = 0x90
+)
+
+// Helper is the number of an in-kernel BPF helper function.
+type Helper int32
+
+// BPF helpers used by the canned programs.
+const (
+	MapLookupElem     Helper = 1
+	MapUpdateElem     Helper = 2
+	MapDeleteElem     Helper = 3
+	ProbeRead         Helper = 4
+	KtimeGetNS        Helper = 5
+	GetCurrentPidTgid Helper = 14
+	GetCurrentUIDGid  Helper = 15
+	GetCurrentComm    Helper = 16
+	PerfEventOutput   Helper = 25
+	ProbeReadStr      Helper = 45
+)
+
+// pseudoMapFD marks a 64-bit immediate load as a map file descriptor.
+const pseudoMapFD = 1
+
+// InstructionSize is the size of one encoded instruction.
+const InstructionSize = 8
+
+// Instruction is a single eBPF instruction.
+//
+// Jumps may name a Target label instead of carrying a raw offset; labels
+// are defined with Label and resolved by Assemble.
+type Instruction struct {
+	OpCode uint8
+	Dst    Register
+	Src    Register
+	Off    int16
+	Imm    int64
+
+	// Target is the label a jump goes to.
+	Target string
+	// label is set on pseudo-instructions created by Label.
+	label string
+}
+
+// Label defines a jump target. It does not emit any code.
+func Label(name string) Instruction {
+	return Instruction{label: name}
+}
+
+func (i Instruction) isLabel() bool {
+	return i.label != ""
+}
+
+// isWide reports whether the instruction takes two slots.
+func (i Instruction) isWide() bool {
+	return i.OpCode == classLD|uint8(DWord)|modeIM
+}
+
+// ALU64Imm returns dst = dst <op> imm on 64 bits.
+func ALU64Imm(op ALUOp, dst Register, imm int32) Instruction {
+	return Instruction{OpCode: classALU64 | uint8(op) | srcK, Dst: dst, Imm: int64(imm)}
+}
+
+// ALU64Reg returns dst = dst <op> src on 64 bits.
+func ALU64Reg(op ALUOp, dst, src Register) Instruction {
+	return Instruction{OpCode: classALU64 | uint8(op) | srcX, Dst: dst, Src: src}
+}
+
+// ALU32Imm returns dst = dst <op> imm on 32 bits, zero extending the result.
+func ALU32Imm(op ALUOp, dst Register, imm int32) Instruction {
+	return Instruction{OpCode: classALU | uint8(op) | srcK, Dst: dst, Imm: int64(imm)}
+}
+
+// Mov64Imm returns dst = imm, sign extended.
+func Mov64Imm(dst Register, imm int32) Instruction {
+	return ALU64Imm(Mov, dst, imm)
+}
+
+// Mov64Reg returns dst = src.
+func Mov64Reg(dst, src Register) Instruction {
+	return ALU64Reg(Mov, dst, src)
+}
+
+// LoadMapFD loads a map file descriptor into dst. It takes two slots.
+func LoadMapFD(dst Register, fd int) Instruction {
+	return Instruction{OpCode: classLD | uint8(DWord) | modeIM, Dst: dst, Src: pseudoMapFD, Imm: int64(fd)}
+}
+
+// LoadImm64 loads a 64-bit constant into dst. It takes two slots.
+func LoadImm64(dst Register, imm int64) Instruction {
+	return Instruction{OpCode: classLD | uint8(DWord) | modeIM, Dst: dst, Imm: imm}
+}
+
+// LoadMem returns dst = *(size *)(src + off).
+func LoadMem(size Size, dst, src Register, off int16) Instruction {
+	return Instruction{OpCode: classLDX | uint8(size) | modeMEM, Dst: dst, Src: src, Off: off}
+}
+
+// StoreMem returns *(size *)(dst + off) = src.
+func StoreMem(size Size, dst Register, off int16, src Register) Instruction {
+	return Instruction{OpCode: classSTX | uint8(size) | modeMEM, Dst: dst, Src: src, Off: off}
+}
+
+// StoreImm returns *(size *)(dst + off) = imm.
+func StoreImm(size Size, dst Register, off int16, imm int32) Instruction {
+	return Instruction{OpCode: classST | uint8(size) | modeMEM, Dst: dst, Off: off, Imm: int64(imm)}
+}
+
+// JumpImm jumps to target if dst <op> imm.
+func JumpImm(op JumpOp, dst Register, imm int32, target string) Instruction {
+	return Instruction{OpCode: classJMP | uint8(op) | srcK, Dst: dst, Imm: int64(imm), Target: target}
+}
+
+// JumpReg jumps to target if dst <op> src.
+func JumpReg(op JumpOp, dst, src Register, target string) Instruction {
+	return Instruction{OpCode: classJMP | uint8(op) | srcX, Dst: dst, Src: src, Target: target}
+}
+
+// Jump unconditionally jumps to target.
+func Jump(target string) Instruction {
+	return Instruction{OpCode: classJMP | uint8(JA), Target: target}
+}
+
+// Call calls a BPF helper. Arguments go in R1-R5, the result in R0.
+func Call(h Helper) Instruction {
+	return Instruction{OpCode: classJMP | opCall, Imm: int64(h)}
+}
+
+// Exit returns R0 to the kernel.
+func Exit() Instruction {
+	return Instruction{OpCode: classJMP | opExit}
+}
+
+// Assemble resolves labels and encodes insns into the kernel's wire format.
+func Assemble(insns []Instruction) ([]byte, error) {
+	// First pass: slot offsets of every label.
+	labels := make(map[string]int)
+	slot := 0
+	for _, in := range insns {
+		if in.isLabel() {
+			if _, ok := labels[in.label]; ok {
+				return nil, fmt.Errorf("label %q defined twice", in.label)
+			}
+			labels[in.label] = slot
+			continue
+		}
+		slot++
+		if in.isWide() {
+			slot++
+		}
+	}
+
+	buf := make([]byte, 0, slot*InstructionSize)
+	slot = 0
+	for _, in := range insns {
+		if in.isLabel() {
+			continue
+		}
+		off := in.Off
+		if in.Target != "" {
+			t, ok := labels[in.Target]
+			if !ok {
+				return nil, fmt.Errorf("jump to undefined label %q", in.Target)
+			}
+			off = int16(t - slot - 1)
+		}
+		buf = appendInsn(buf, in.OpCode, in.Dst, in.Src, off, int32(in.Imm))
+		slot++
+		if in.isWide() {
+			buf = appendInsn(buf, 0, 0, 0, 0, int32(uint64(in.Imm)>>32))
+			slot++
+		}
+	}
+	return buf, nil
+}
+
+func appendInsn(b []byte, op uint8, dst, src Register, off int16, imm int32) []byte {
+	var raw [InstructionSize]byte
+	raw[0] = op
+	raw[1] = uint8(dst&0xf) | uint8(src&0xf)<<4
+	binary.LittleEndian.PutUint16(raw[2:], uint16(off))
+	binary.LittleEndian.PutUint32(raw[4:], uint32(imm))
+	return append(b, raw[:]...)
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ebpf
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestAssemble(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		insns []Instruction
+		want  []byte
+	}{
+		{
+			name:  "mov exit",
+			insns: []Instruction{Mov64Imm(R0, 0), Exit()},
+			want: []byte{
+				0xb7, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x95, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+			},
+		},
+		{
+			name:  "store and load",
+			insns: []Instruction{StoreMem(Word, R10, -8, R1), LoadMem(DWord, R3, R6, 16)},
+			want: []byte{
+				0x63, 0x1a, 0xf8, 0xff, 0x00, 0x00, 0x00, 0x00,
+				0x79, 0x63, 0x10, 0x00, 0x00, 0x00, 0x00, 0x00,
+			},
+		},
+		{
+			name:  "map fd is wide",
+			insns: []Instruction{LoadMapFD(R2, 5)},
+			want: []byte{
+				0x18, 0x12, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+			},
+		},
+		{
+			name:  "imm64 high half",
+			insns: []Instruction{LoadImm64(R1, 0x1122334455667788)},
+			want: []byte{
+				0x18, 0x01, 0x00, 0x00, 0x88, 0x77, 0x66, 0x55,
+				0x00, 0x00, 0x00, 0x00, 0x44, 0x33, 0x22, 0x11,
+			},
+		},
+		{
+			name: "labels skip wide slots",
+			insns: []Instruction{
+				JumpImm(JEq, R1, 0, "out"),
+				LoadMapFD(R2, 1),
+				Label("out"),
+				Exit(),
+			},
+			want: []byte{
+				0x15, 0x01, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x18, 0x12, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00,
+				0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x95, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+			},
+		},
+		{
+			name: "backwards jump",
+			insns: []Instruction{
+				Label("top"),
+				Mov64Imm(R0, 0),
+				Jump("top"),
+			},
+			want: []byte{
+				0xb7, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+				0x05, 0x00, 0xfe, 0xff, 0x00, 0x00, 0x00, 0x00,
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Assemble(tt.insns)
+			if err != nil {
+				t.Fatalf("Assemble() = %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("Assemble() = %#x, want %#x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssembleErrors(t *testing.T) {
+	if _, err := Assemble([]Instruction{Jump("nowhere")}); err == nil {
+		t.Errorf("Assemble(undefined label) = nil, want error")
+	}
+	if _, err := Assemble([]Instruction{Label("a"), Label("a"), Exit()}); err == nil {
+		t.Errorf("Assemble(duplicate label) = nil, want error")
+	}
+}
+
+func TestCannedProgramsAssemble(t *testing.T) {
+	for name, insns := range map[string][]Instruction{
+		"exec":       ExecSnoopProgram(3),
+		"open":       OpenSnoopProgram(3),
+		"tcpconnect": TCPConnectProgram(3, 4),
+	} {
+		if _, err := Assemble(insns); err != nil {
+			t.Errorf("Assemble(%s) = %v", name, err)
+		}
+	}
+}
+
+func TestDecodeEvents(t *testing.T) {
+	b := make([]byte, pathEventSize)
+	b[0], b[4] = 42, 7
+	copy(b[8:], "sh\x00garbage")
+	copy(b[8+commLen:], "/bin/ls\x00")
+	e, err := DecodeExecEvent(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := *e.(*ExecEvent), (ExecEvent{PID: 42, UID: 7, Comm: "sh", Path: "/bin/ls"}); got != want {
+		t.Errorf("DecodeExecEvent() = %+v, want %+v", got, want)
+	}
+	if _, err := DecodeOpenEvent(b[:10]); err == nil {
+		t.Errorf("DecodeOpenEvent(short) = nil, want error")
+	}
+
+	tcp := make([]byte, tcpEventSize)
+	tcp[0], tcp[1] = 0x10, 0x27 // 10000ns
+	tcp[8] = 9
+	tcp[12] = 2 // AF_INET
+	tcp[14] = 80
+	copy(tcp[16:], []byte{10, 0, 0, 1})
+	e, err = DecodeTCPConnectEvent(tcp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := e.String(), "9       10.0.0.1                                80    10µs"; got != want {
+		t.Errorf("DecodeTCPConnectEvent().String() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ebpf
+
+import (
+	"bytes"
+	"fmt"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// logSize is the size of the verifier log buffer.
+const logSize = 64 * 1024
+
+// mapCreateAttr is the BPF_MAP_CREATE layout of union bpf_attr.
+type mapCreateAttr struct {
+	mapType    uint32
+	keySize    uint32
+	valueSize  uint32
+	maxEntries uint32
+	flags      uint32
+}
+
+// mapElemAttr is the BPF_MAP_*_ELEM layout of union bpf_attr.
+type mapElemAttr struct {
+	fd    uint32
+	_     uint32
+	key   uint64
+	value uint64
+	flags uint64
+}
+
+// progLoadAttr is the BPF_PROG_LOAD layout of union bpf_attr.
+type progLoadAttr struct {
+	progType    uint32
+	insnCnt     uint32
+	insns       uint64
+	license     uint64
+	logLevel    uint32
+	logSize     uint32
+	logBuf      uint64
+	kernVersion uint32
+}
+
+func bpf(cmd int, attr unsafe.Pointer, size uintptr) (int, error) {
+	r, _, errno := unix.Syscall(unix.SYS_BPF, uintptr(cmd), uintptr(attr), size)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(r), nil
+}
+
+// Map is a kernel BPF map.
+type Map struct {
+	fd int
+}
+
+// MapType is the kind of a BPF map.
+type MapType uint32
+
+// Map types used by this package.
+const (
+	Hash           MapType = unix.BPF_MAP_TYPE_HASH
+	PerfEventArray MapType = unix.BPF_MAP_TYPE_PERF_EVENT_ARRAY
+)
+
+// NewMap creates a map with the given geometry.
+func NewMap(t MapType, keySize, valueSize, maxEntries uint32) (*Map, error) {
+	attr := mapCreateAttr{
+		mapType:    uint32(t),
+		keySize:    keySize,
+		valueSize:  valueSize,
+		maxEntries: maxEntries,
+	}
+	fd, err := bpf(unix.BPF_MAP_CREATE, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	if err != nil {
+		return nil, fmt.Errorf("creating map: %v", err)
+	}
+	return &Map{fd: fd}, nil
+}
+
+// FD returns the map's file descriptor.
+func (m *Map) FD() int {
+	return m.fd
+}
+
+// Update sets key to value.
+func (m *Map) Update(key, value []byte) error {
+	attr := mapElemAttr{
+		fd:    uint32(m.fd),
+		key:   uint64(uintptr(unsafe.Pointer(&key[0]))),
+		value: uint64(uintptr(unsafe.Pointer(&value[0]))),
+	}
+	_, err := bpf(unix.BPF_MAP_UPDATE_ELEM, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	runtime.KeepAlive(key)
+	runtime.KeepAlive(value)
+	return err
+}
+
+// Close releases the map.
+func (m *Map) Close() error {
+	return unix.Close(m.fd)
+}
+
+// Program is a loaded BPF program.
+type Program struct {
+	fd int
+}
+
+// ProgramType is the kind of a BPF program.
+type ProgramType uint32
+
+// Program types used by this package.
+const (
+	Tracepoint ProgramType = unix.BPF_PROG_TYPE_TRACEPOINT
+)
+
+// LoadProgram assembles insns and loads them into the kernel. When the
+// verifier rejects the program its log is part of the returned error.
+func LoadProgram(t ProgramType, insns []Instruction, license string) (*Program, error) {
+	code, err := Assemble(insns)
+	if err != nil {
+		return nil, err
+	}
+	lic := append([]byte(license), 0)
+	log := make([]byte, logSize)
+	attr := progLoadAttr{
+		progType: uint32(t),
+		insnCnt:  uint32(len(code) / InstructionSize),
+		insns:    uint64(uintptr(unsafe.Pointer(&code[0]))),
+		license:  uint64(uintptr(unsafe.Pointer(&lic[0]))),
+		logLevel: 1,
+		logSize:  uint32(len(log)),
+		logBuf:   uint64(uintptr(unsafe.Pointer(&log[0]))),
+	}
+	fd, err := bpf(unix.BPF_PROG_LOAD, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	runtime.KeepAlive(code)
+	runtime.KeepAlive(lic)
+	if err != nil {
+		if n := bytes.IndexByte(log, 0); n > 0 {
+			return nil, fmt.Errorf("loading program: %v\n%s", err, log[:n])
+		}
+		return nil, fmt.Errorf("loading program: %v", err)
+	}
+	return &Program{fd: fd}, nil
+}
+
+// Close unloads the program unless something else still holds it.
+func (p *Program) Close() error {
+	return unix.Close(p.fd)
+}
@@ -0,0 +1,273 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ebpf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// tracefsRoots are the places tracefs is usually found.
+var tracefsRoots = []string{
+	"/sys/kernel/tracing",
+	"/sys/kernel/debug/tracing",
+}
+
+// perf record types we care about.
+const (
+	perfRecordLost   = 2
+	perfRecordSample = 9
+)
+
+// TracepointID returns the kernel's ID for the category/name tracepoint.
+func TracepointID(category, name string) (uint64, error) {
+	for _, root := range tracefsRoots {
+		b, err := ioutil.ReadFile(filepath.Join(root, "events", category, name, "id"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+		return strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	}
+	return 0, fmt.Errorf("tracepoint %s/%s not found; is tracefs mounted?", category, name)
+}
+
+// Link is a program attached to an event source.
+type Link struct {
+	fd int
+}
+
+// Close detaches the program.
+func (l *Link) Close() error {
+	return unix.Close(l.fd)
+}
+
+// AttachTracepoint attaches p to the category/name tracepoint. The program
+// runs on every CPU even though the perf event is opened on CPU 0.
+func (p *Program) AttachTracepoint(category, name string) (*Link, error) {
+	id, err := TracepointID(category, name)
+	if err != nil {
+		return nil, err
+	}
+	attr := unix.PerfEventAttr{
+		Type:        unix.PERF_TYPE_TRACEPOINT,
+		Size:        uint32(unsafe.Sizeof(unix.PerfEventAttr{})),
+		Config:      id,
+		Sample:      1,
+		Sample_type: unix.PERF_SAMPLE_RAW,
+		Wakeup:      1,
+	}
+	fd, err := unix.PerfEventOpen(&attr, -1, 0, -1, unix.PERF_FLAG_FD_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("opening tracepoint %s/%s: %v", category, name, err)
+	}
+	if err := unix.IoctlSetInt(fd, unix.PERF_EVENT_IOC_SET_BPF, p.fd); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("attaching program: %v", err)
+	}
+	if err := unix.IoctlSetInt(fd, unix.PERF_EVENT_IOC_ENABLE, 0); err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("enabling tracepoint: %v", err)
+	}
+	return &Link{fd: fd}, nil
+}
+
+// PossibleCPUs returns the number of CPUs the kernel may bring online,
+// which is how large a perf event array needs to be.
+func PossibleCPUs() (int, error) {
+	b, err := ioutil.ReadFile("/sys/devices/system/cpu/possible")
+	if err != nil {
+		return 0, err
+	}
+	return parseCPUList(strings.TrimSpace(string(b)))
+}
+
+// parseCPUList returns one past the highest CPU in a list like "0-3,8".
+func parseCPUList(s string) (int, error) {
+	max := -1
+	for _, r := range strings.Split(s, ",") {
+		bounds := strings.SplitN(r, "-", 2)
+		n, err := strconv.Atoi(bounds[len(bounds)-1])
+		if err != nil {
+			return 0, fmt.Errorf("bad CPU list %q: %v", s, err)
+		}
+		if n > max {
+			max = n
+		}
+	}
+	return max + 1, nil
+}
+
+// Record is one event read from a perf ring.
+type Record struct {
+	CPU int
+	// Raw is the data the program passed to bpf_perf_event_output.
+	Raw []byte
+	// Lost is the number of records the kernel dropped, if non-zero.
+	Lost uint64
+}
+
+type ring struct {
+	cpu  int
+	fd   int
+	mem  []byte
+	meta *unix.PerfEventMmapPage
+	data []byte
+}
+
+// Reader reads records from a PerfEventArray map.
+type Reader struct {
+	rings   []*ring
+	byFD    map[int]*ring
+	epfd    int
+	pending []Record
+}
+
+// NewReader opens one perf ring of pages pages per CPU and plugs them into
+// m, which must be a PerfEventArray with an entry per possible CPU.
+func NewReader(m *Map, cpus, pages int) (*Reader, error) {
+	epfd, err := unix.EpollCreate1(unix.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	r := &Reader{epfd: epfd, byFD: make(map[int]*ring)}
+	for cpu := 0; cpu < cpus; cpu++ {
+		rg, err := openRing(cpu, pages)
+		if err == unix.ENODEV {
+			// Possible but offline.
+			continue
+		}
+		if err != nil {
+			r.Close()
+			return nil, err
+		}
+		r.rings = append(r.rings, rg)
+		r.byFD[rg.fd] = rg
+
+		var key, val [4]byte
+		binary.LittleEndian.PutUint32(key[:], uint32(cpu))
+		binary.LittleEndian.PutUint32(val[:], uint32(rg.fd))
+		if err := m.Update(key[:], val[:]); err != nil {
+			r.Close()
+			return nil, fmt.Errorf("adding CPU %d ring to map: %v", cpu, err)
+		}
+		ev := unix.EpollEvent{Events: unix.EPOLLIN, Fd: int32(rg.fd)}
+		if err := unix.EpollCtl(epfd, unix.EPOLL_CTL_ADD, rg.fd, &ev); err != nil {
+			r.Close()
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+func openRing(cpu, pages int) (*ring, error) {
+	attr := unix.PerfEventAttr{
+		Type:        unix.PERF_TYPE_SOFTWARE,
+		Size:        uint32(unsafe.Sizeof(unix.PerfEventAttr{})),
+		Config:      unix.PERF_COUNT_SW_BPF_OUTPUT,
+		Sample_type: unix.PERF_SAMPLE_RAW,
+		Sample:      1,
+		Wakeup:      1,
+	}
+	fd, err := unix.PerfEventOpen(&attr, -1, cpu, -1, unix.PERF_FLAG_FD_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+	psize := os.Getpagesize()
+	mem, err := unix.Mmap(fd, 0, psize*(pages+1), unix.PROT_READ|unix.PROT_WRITE, unix.MAP_SHARED)
+	if err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("mapping CPU %d ring: %v", cpu, err)
+	}
+	if err := unix.IoctlSetInt(fd, unix.PERF_EVENT_IOC_ENABLE, 0); err != nil {
+		unix.Munmap(mem)
+		unix.Close(fd)
+		return nil, err
+	}
+	return &ring{
+		cpu:  cpu,
+		fd:   fd,
+		mem:  mem,
+		meta: (*unix.PerfEventMmapPage)(unsafe.Pointer(&mem[0])),
+		data: mem[psize:],
+	}, nil
+}
+
+// read appends every complete record in the ring to recs.
+func (rg *ring) read(recs []Record) []Record {
+	head := atomic.LoadUint64(&rg.meta.Data_head)
+	tail := atomic.LoadUint64(&rg.meta.Data_tail)
+	for tail < head {
+		hdr := rg.copy(tail, 8)
+		typ := binary.LittleEndian.Uint32(hdr[0:])
+		n := uint64(binary.LittleEndian.Uint16(hdr[6:]))
+		body := rg.copy(tail+8, n-8)
+		switch typ {
+		case perfRecordSample:
+			raw := binary.LittleEndian.Uint32(body)
+			recs = append(recs, Record{CPU: rg.cpu, Raw: body[4 : 4+raw]})
+		case perfRecordLost:
+			// u64 id, u64 lost.
+			recs = append(recs, Record{CPU: rg.cpu, Lost: binary.LittleEndian.Uint64(body[8:])})
+		}
+		tail += n
+	}
+	atomic.StoreUint64(&rg.meta.Data_tail, tail)
+	return recs
+}
+
+// copy returns n bytes at ring offset off, unwrapping as needed.
+func (rg *ring) copy(off, n uint64) []byte {
+	size := uint64(len(rg.data))
+	b := make([]byte, n)
+	start := off % size
+	c := copy(b, rg.data[start:])
+	copy(b[c:], rg.data)
+	return b
+}
+
+func (rg *ring) close() {
+	unix.Munmap(rg.mem)
+	unix.Close(rg.fd)
+}
+
+// Read blocks until a record is available and returns it.
+func (r *Reader) Read() (Record, error) {
+	events := make([]unix.EpollEvent, len(r.rings))
+	for len(r.pending) == 0 {
+		n, err := unix.EpollWait(r.epfd, events, -1)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return Record{}, err
+		}
+		for _, ev := range events[:n] {
+			r.pending = r.byFD[int(ev.Fd)].read(r.pending)
+		}
+	}
+	rec := r.pending[0]
+	r.pending = r.pending[1:]
+	return rec, nil
+}
+
+// Close releases all rings.
+func (r *Reader) Close() error {
+	for _, rg := range r.rings {
+		rg.close()
+	}
+	return unix.Close(r.epfd)
+}
@@ -0,0 +1,272 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ebpf
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+// Event is a decoded record emitted by one of the canned programs.
+type Event interface {
+	fmt.Stringer
+}
+
+// ExecEvent is emitted by the exec snooper for every execve(2).
+type ExecEvent struct {
+	PID  uint32
+	UID  uint32
+	Comm string
+	Path string
+}
+
+// String implements fmt.Stringer.
+func (e *ExecEvent) String() string {
+	return fmt.Sprintf("%-7d %-7d %-16s %s", e.PID, e.UID, e.Comm, e.Path)
+}
+
+// OpenEvent is emitted by the open snooper for every openat(2).
+type OpenEvent ExecEvent
+
+// String implements fmt.Stringer.
+func (e *OpenEvent) String() string {
+	return (*ExecEvent)(e).String()
+}
+
+// TCPConnectEvent is emitted by the TCP connect snooper when an active
+// open completes.
+type TCPConnectEvent struct {
+	PID     uint32
+	Addr    net.IP
+	Port    uint16
+	Latency time.Duration
+}
+
+// String implements fmt.Stringer.
+func (e *TCPConnectEvent) String() string {
+	return fmt.Sprintf("%-7d %-39s %-5d %v", e.PID, e.Addr, e.Port, e.Latency)
+}
+
+// Layout of the record shared by the syscall path snoopers.
+const (
+	pathEventSize = 152
+	commLen       = 16
+	pathLen       = 128
+)
+
+// syscallPathProgram builds a program for a syscalls/sys_enter_* tracepoint
+// that reports the caller and the path found in the argument at ctx+argOff.
+func syscallPathProgram(events int, argOff int16) []Instruction {
+	const base = -pathEventSize
+	return []Instruction{
+		Mov64Reg(R6, R1),
+
+		Call(GetCurrentPidTgid),
+		ALU64Imm(RSh, R0, 32),
+		StoreMem(Word, R10, base, R0),
+
+		Call(GetCurrentUIDGid),
+		StoreMem(Word, R10, base+4, R0),
+
+		Mov64Reg(R1, R10),
+		ALU64Imm(Add, R1, base+8),
+		Mov64Imm(R2, commLen),
+		Call(GetCurrentComm),
+
+		Mov64Reg(R1, R10),
+		ALU64Imm(Add, R1, base+8+commLen),
+		Mov64Imm(R2, pathLen),
+		LoadMem(DWord, R3, R6, argOff),
+		Call(ProbeReadStr),
+
+		Mov64Reg(R1, R6),
+		LoadMapFD(R2, events),
+		// BPF_F_CURRENT_CPU; the 32-bit move keeps the upper half clear.
+		ALU32Imm(Mov, R3, -1),
+		Mov64Reg(R4, R10),
+		ALU64Imm(Add, R4, base),
+		Mov64Imm(R5, pathEventSize),
+		Call(PerfEventOutput),
+
+		Mov64Imm(R0, 0),
+		Exit(),
+	}
+}
+
+// ExecSnoopProgram returns a program for syscalls/sys_enter_execve.
+func ExecSnoopProgram(events int) []Instruction {
+	// struct { common; int nr; const char *filename; ... }
+	return syscallPathProgram(events, 16)
+}
+
+// OpenSnoopProgram returns a program for syscalls/sys_enter_openat.
+func OpenSnoopProgram(events int) []Instruction {
+	// struct { common; int nr; int dfd; const char *filename; ... }
+	return syscallPathProgram(events, 24)
+}
+
+func cstring(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	return string(b)
+}
+
+func decodePathEvent(b []byte) (*ExecEvent, error) {
+	if len(b) < pathEventSize {
+		return nil, fmt.Errorf("short record: %d bytes, want %d", len(b), pathEventSize)
+	}
+	return &ExecEvent{
+		PID:  binary.LittleEndian.Uint32(b[0:]),
+		UID:  binary.LittleEndian.Uint32(b[4:]),
+		Comm: cstring(b[8 : 8+commLen]),
+		Path: cstring(b[8+commLen : 8+commLen+pathLen]),
+	}, nil
+}
+
+// DecodeExecEvent decodes a record emitted by ExecSnoopProgram.
+func DecodeExecEvent(b []byte) (Event, error) {
+	return decodePathEvent(b)
+}
+
+// DecodeOpenEvent decodes a record emitted by OpenSnoopProgram.
+func DecodeOpenEvent(b []byte) (Event, error) {
+	e, err := decodePathEvent(b)
+	if err != nil {
+		return nil, err
+	}
+	return (*OpenEvent)(e), nil
+}
+
+// Offsets into the sock/inet_sock_set_state tracepoint record, stable
+// since Linux 4.16.
+const (
+	inetSkaddr   = 8
+	inetOldstate = 16
+	inetNewstate = 20
+	inetDport    = 26
+	inetFamily   = 28
+	inetProtocol = 30
+	inetDaddr    = 36
+	inetDaddrV6  = 56
+
+	tcpEstablished = 1
+	tcpSynSent     = 2
+	ipprotoTCP     = 6
+	afInet6        = 10
+)
+
+// Layout of the TCP connect record and of the start map.
+const (
+	tcpEventSize   = 40
+	tcpStartKey    = 8
+	tcpStartValue  = 16
+	tcpStartMaxEnt = 4096
+)
+
+// TCPConnectProgram returns a program for sock/inet_sock_set_state that
+// times SYN_SENT -> ESTABLISHED transitions. start must be a Hash map with
+// tcpStartKey byte keys and tcpStartValue byte values.
+func TCPConnectProgram(events, start int) []Instruction {
+	const (
+		ev  = -tcpEventSize
+		key = ev - tcpStartKey
+		val = key - tcpStartValue
+	)
+	return []Instruction{
+		Mov64Reg(R6, R1),
+		LoadMem(Half, R1, R6, inetProtocol),
+		JumpImm(JNE, R1, ipprotoTCP, "out"),
+
+		LoadMem(Word, R7, R6, inetNewstate),
+		LoadMem(DWord, R8, R6, inetSkaddr),
+		StoreMem(DWord, R10, key, R8),
+		JumpImm(JNE, R7, tcpSynSent, "notsyn"),
+
+		// connect(2) in progress: remember when and who.
+		Call(KtimeGetNS),
+		StoreMem(DWord, R10, val, R0),
+		Call(GetCurrentPidTgid),
+		ALU64Imm(RSh, R0, 32),
+		StoreMem(DWord, R10, val+8, R0),
+		LoadMapFD(R1, start),
+		Mov64Reg(R2, R10),
+		ALU64Imm(Add, R2, key),
+		Mov64Reg(R3, R10),
+		ALU64Imm(Add, R3, val),
+		Mov64Imm(R4, 0),
+		Call(MapUpdateElem),
+		Jump("out"),
+
+		Label("notsyn"),
+		LoadMem(Word, R1, R6, inetOldstate),
+		JumpImm(JNE, R1, tcpSynSent, "out"),
+		LoadMapFD(R1, start),
+		Mov64Reg(R2, R10),
+		ALU64Imm(Add, R2, key),
+		Call(MapLookupElem),
+		JumpImm(JEq, R0, 0, "out"),
+		Mov64Reg(R9, R0),
+		// Failed or reset connects only need their start entry dropped.
+		JumpImm(JNE, R7, tcpEstablished, "del"),
+
+		Call(KtimeGetNS),
+		LoadMem(DWord, R1, R9, 0),
+		ALU64Reg(Sub, R0, R1),
+		StoreMem(DWord, R10, ev, R0),
+		LoadMem(DWord, R1, R9, 8),
+		StoreMem(Word, R10, ev+8, R1),
+		LoadMem(Half, R1, R6, inetFamily),
+		StoreMem(Half, R10, ev+12, R1),
+		LoadMem(Half, R1, R6, inetDport),
+		StoreMem(Half, R10, ev+14, R1),
+		LoadMem(Word, R1, R6, inetDaddr),
+		StoreMem(Word, R10, ev+16, R1),
+		StoreImm(Word, R10, ev+20, 0),
+		LoadMem(DWord, R1, R6, inetDaddrV6),
+		StoreMem(DWord, R10, ev+24, R1),
+		LoadMem(DWord, R1, R6, inetDaddrV6+8),
+		StoreMem(DWord, R10, ev+32, R1),
+
+		Mov64Reg(R1, R6),
+		LoadMapFD(R2, events),
+		ALU32Imm(Mov, R3, -1),
+		Mov64Reg(R4, R10),
+		ALU64Imm(Add, R4, ev),
+		Mov64Imm(R5, tcpEventSize),
+		Call(PerfEventOutput),
+
+		Label("del"),
+		LoadMapFD(R1, start),
+		Mov64Reg(R2, R10),
+		ALU64Imm(Add, R2, key),
+		Call(MapDeleteElem),
+
+		Label("out"),
+		Mov64Imm(R0, 0),
+		Exit(),
+	}
+}
+
+// DecodeTCPConnectEvent decodes a record emitted by TCPConnectProgram.
+func DecodeTCPConnectEvent(b []byte) (Event, error) {
+	if len(b) < tcpEventSize {
+		return nil, fmt.Errorf("short record: %d bytes, want %d", len(b), tcpEventSize)
+	}
+	e := &TCPConnectEvent{
+		Latency: time.Duration(binary.LittleEndian.Uint64(b[0:])),
+		PID:     binary.LittleEndian.Uint32(b[8:]),
+		Port:    binary.LittleEndian.Uint16(b[14:]),
+	}
+	if binary.LittleEndian.Uint16(b[12:]) == afInet6 {
+		e.Addr = net.IP(append([]byte(nil), b[24:40]...))
+	} else {
+		e.Addr = net.IP(append([]byte(nil), b[16:20]...))
+	}
+	return e, nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ebpf
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ringPages is the size of each per-CPU ring in pages. Must be a power of 2.
+const ringPages = 64
+
+type snooper struct {
+	category, name string
+	header         string
+	// build returns the program; scratch holds any extra maps it created.
+	build  func(events int) (prog []Instruction, scratch []*Map, err error)
+	decode func([]byte) (Event, error)
+}
+
+var snoopers = map[string]snooper{
+	"exec": {
+		category: "syscalls",
+		name:     "sys_enter_execve",
+		header:   fmt.Sprintf("%-7s %-7s %-16s %s", "PID", "UID", "COMM", "PATH"),
+		build: func(events int) ([]Instruction, []*Map, error) {
+			return ExecSnoopProgram(events), nil, nil
+		},
+		decode: DecodeExecEvent,
+	},
+	"open": {
+		category: "syscalls",
+		name:     "sys_enter_openat",
+		header:   fmt.Sprintf("%-7s %-7s %-16s %s", "PID", "UID", "COMM", "PATH"),
+		build: func(events int) ([]Instruction, []*Map, error) {
+			return OpenSnoopProgram(events), nil, nil
+		},
+		decode: DecodeOpenEvent,
+	},
+	"tcpconnect": {
+		category: "sock",
+		name:     "inet_sock_set_state",
+		header:   fmt.Sprintf("%-7s %-39s %-5s %s", "PID", "DADDR", "DPORT", "LATENCY"),
+		build: func(events int) ([]Instruction, []*Map, error) {
+			start, err := NewMap(Hash, tcpStartKey, tcpStartValue, tcpStartMaxEnt)
+			if err != nil {
+				return nil, nil, err
+			}
+			return TCPConnectProgram(events, start.FD()), []*Map{start}, nil
+		},
+		decode: DecodeTCPConnectEvent,
+	},
+}
+
+// Snoopers returns the names of the canned tracers.
+func Snoopers() []string {
+	var n []string
+	for k := range snoopers {
+		n = append(n, k)
+	}
+	sort.Strings(n)
+	return n
+}
+
+// Snoop is a running canned tracer.
+type Snoop struct {
+	// Header describes the columns of the events' String form.
+	Header string
+
+	maps   []*Map
+	prog   *Program
+	link   *Link
+	reader *Reader
+	decode func([]byte) (Event, error)
+}
+
+// NewSnoop loads and attaches the named canned tracer.
+func NewSnoop(name string) (s *Snoop, err error) {
+	sn, ok := snoopers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown snooper %q, want one of %v", name, Snoopers())
+	}
+	s = &Snoop{Header: sn.header, decode: sn.decode}
+	defer func() {
+		if err != nil {
+			s.Close()
+		}
+	}()
+
+	cpus, err := PossibleCPUs()
+	if err != nil {
+		return nil, err
+	}
+	events, err := NewMap(PerfEventArray, 4, 4, uint32(cpus))
+	if err != nil {
+		return nil, err
+	}
+	s.maps = append(s.maps, events)
+
+	insns, scratch, err := sn.build(events.FD())
+	s.maps = append(s.maps, scratch...)
+	if err != nil {
+		return nil, err
+	}
+	if s.prog, err = LoadProgram(Tracepoint, insns, "GPL"); err != nil {
+		return nil, err
+	}
+	if s.reader, err = NewReader(events, cpus, ringPages); err != nil {
+		return nil, err
+	}
+	if s.link, err = s.prog.AttachTracepoint(sn.category, sn.name); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// LostError reports events the kernel dropped because a ring was full.
+type LostError struct {
+	CPU   int
+	Count uint64
+}
+
+// Error implements error.
+func (e *LostError) Error() string {
+	return fmt.Sprintf("CPU %d: lost %d events", e.CPU, e.Count)
+}
+
+// Next blocks until the next event arrives. Dropped events are reported as
+// a *LostError so callers can note the gap and keep reading.
+func (s *Snoop) Next() (Event, error) {
+	rec, err := s.reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	if rec.Lost != 0 {
+		return nil, &LostError{CPU: rec.CPU, Count: rec.Lost}
+	}
+	return s.decode(rec.Raw)
+}
+
+// Close detaches the tracer and frees its kernel resources.
+func (s *Snoop) Close() error {
+	if s.link != nil {
+		s.link.Close()
+	}
+	if s.reader != nil {
+		s.reader.Close()
+	}
+	if s.prog != nil {
+		s.prog.Close()
+	}
+	for _, m := range s.maps {
+		m.Close()
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package efivar reads and writes UEFI variables through efivarfs, or the
+// legacy sysfs interface of kernels without it, and gets and sets the EFI
+// time. Writes are rate limited and checked against the free space of the
+// variable store: some machines do not boot with a full store.
+package efivar
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"github.com/vtolstov/go-ioctl"
+	"golang.org/x/sys/unix"
+)
+
+// Dir is where efivarfs is mounted.
+var Dir = "/sys/firmware/efi/efivars"
+
+// LegacyDir is the sysfs interface to variables that efivarfs replaced. It
+// is used if efivarfs is not mounted at Dir.
+var LegacyDir = "/sys/firmware/efi/vars"
+
+// GlobalGUID is the vendor GUID of the variables the UEFI spec defines.
+const GlobalGUID = "8be4df61-93ca-11d2-aa0d-00e098032b8c"
+
+// Attributes of a variable, UEFI 2.8 section 8.2.
+type Attributes uint32
+
+// Attributes.
+const (
+	NonVolatile                       Attributes = 0x01
+	BootServiceAccess                 Attributes = 0x02
+	RuntimeAccess                     Attributes = 0x04
+	HardwareErrorRecord               Attributes = 0x08
+	AuthenticatedWriteAccess          Attributes = 0x10
+	TimeBasedAuthenticatedWriteAccess Attributes = 0x20
+	AppendWrite                       Attributes = 0x40
+)
+
+// fsImmutable is FS_IMMUTABLE_FL, which efivarfs sets on most variables
+// so they are not written by accident.
+const fsImmutable = 0x10
+
+// fsIocSetflags is FS_IOC_SETFLAGS, which x/sys/unix lacks.
+var fsIocSetflags = ioctl.IOW('f', 2, unsafe.Sizeof(int(0)))
+
+func path(name, guid string) string {
+	return filepath.Join(Dir, name+"-"+guid)
+}
+
+// useLegacy returns whether variables are to be accessed through
+// LegacyDir: efivarfs, which always has some variables, is not mounted and
+// the legacy interface is there.
+func useLegacy() bool {
+	if _, err := os.Stat(filepath.Join(LegacyDir, "new_var")); err != nil {
+		return false
+	}
+	d, err := os.Open(Dir)
+	if err != nil {
+		return true
+	}
+	defer d.Close()
+	names, err := d.Readdirnames(1)
+	return err != nil || len(names) == 0
+}
+
+// Read returns the attributes and value of variable name of vendor guid.
+// The error of a missing variable satisfies os.IsNotExist.
+func Read(name, guid string) (Attributes, []byte, error) {
+	if useLegacy() {
+		return readLegacy(name, guid)
+	}
+	b, err := ioutil.ReadFile(path(name, guid))
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(b) < 4 {
+		return 0, nil, fmt.Errorf("EFI variable %s: %d bytes are too short for attributes", name, len(b))
+	}
+	return Attributes(binary.LittleEndian.Uint32(b)), b[4:], nil
+}
+
+// Write sets variable name of vendor guid to data, creating it with attr
+// if it does not exist. It fails with ErrRateLimited past WriteLimit writes
+// in WriteWindow, and with ErrNoSpace if the store would be left with less
+// than Reserve bytes free.
+func Write(name, guid string, attr Attributes, data []byte) (err error) {
+	if useLegacy() {
+		if err := writes.take(); err != nil {
+			return err
+		}
+		return writeLegacy(name, guid, attr, data)
+	}
+	if err := checkSpace(name, data); err != nil {
+		return err
+	}
+	if err := writes.take(); err != nil {
+		return err
+	}
+	p := path(name, guid)
+	restore, err := makeMutable(p)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// Whether the write works or not, the variable is left as protected
+	// as it was.
+	defer func() {
+		if rerr := restore(); rerr != nil && err == nil {
+			err = rerr
+		}
+	}()
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	// efivarfs takes the attributes and value in one write.
+	b := make([]byte, 4+len(data))
+	binary.LittleEndian.PutUint32(b, uint32(attr))
+	copy(b[4:], data)
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return fmt.Errorf("writing EFI variable %s: %v", name, err)
+	}
+	return f.Close()
+}
+
+// makeMutable clears the immutable flag of the variable at p, if it has it.
+// It returns a function that sets the flag again, which does nothing if
+// there was none to clear.
+func makeMutable(p string) (func() error, error) {
+	none := func() error { return nil }
+	f, err := os.Open(p)
+	if err != nil {
+		return none, err
+	}
+	flags, err := unix.IoctlGetUint32(int(f.Fd()), unix.FS_IOC_GETFLAGS)
+	if err != nil || flags&fsImmutable == 0 {
+		// No flags on this file system, or mutable already.
+		f.Close()
+		return none, nil
+	}
+	if err := unix.IoctlSetPointerInt(int(f.Fd()), uint(fsIocSetflags), int(flags&^fsImmutable)); err != nil {
+		f.Close()
+		return none, fmt.Errorf("making %s mutable: %v", p, err)
+	}
+	return func() error {
+		defer f.Close()
+		if err := unix.IoctlSetPointerInt(int(f.Fd()), uint(fsIocSetflags), int(flags)); err != nil {
+			return fmt.Errorf("making %s immutable again: %v", p, err)
+		}
+		return nil
+	}, nil
+}
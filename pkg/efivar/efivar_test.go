@@ -0,0 +1,259 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package efivar
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+func testDir(t *testing.T) func() {
+	d, err := ioutil.TempDir("", "efivar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldDir, oldLegacy, oldStatfs := Dir, LegacyDir, statfs
+	Dir, LegacyDir = filepath.Join(d, "efivars"), filepath.Join(d, "vars")
+	if err := os.Mkdir(Dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Space unknown.
+	statfs = func(string, *unix.Statfs_t) error { return nil }
+	writes = limiter{}
+	return func() {
+		Dir, LegacyDir, statfs = oldDir, oldLegacy, oldStatfs
+		writes = limiter{}
+		os.RemoveAll(d)
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	defer testDir(t)()
+
+	if _, _, err := Read("Timeout", GlobalGUID); !os.IsNotExist(err) {
+		t.Errorf("Read of a missing variable = %v, want not exist", err)
+	}
+	attr := NonVolatile | BootServiceAccess | RuntimeAccess
+	if err := Write("Timeout", GlobalGUID, attr, []byte{5, 0}); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(Dir, "Timeout-"+GlobalGUID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{7, 0, 0, 0, 5, 0}; !bytes.Equal(b, want) {
+		t.Errorf("Timeout file = %#x, want %#x", b, want)
+	}
+	gotAttr, data, err := Read("Timeout", GlobalGUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotAttr != attr || !bytes.Equal(data, []byte{5, 0}) {
+		t.Errorf("Read = %#x, %#x, want %#x, 0x0500", gotAttr, data, attr)
+	}
+}
+
+func TestWriteImmutable(t *testing.T) {
+	defer testDir(t)()
+
+	attr := NonVolatile | BootServiceAccess | RuntimeAccess
+	if err := Write("BootOrder", GlobalGUID, attr, []byte{1, 0}); err != nil {
+		t.Fatal(err)
+	}
+	p := filepath.Join(Dir, "BootOrder-"+GlobalGUID)
+	f, err := os.Open(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	flags, err := unix.IoctlGetUint32(int(f.Fd()), unix.FS_IOC_GETFLAGS)
+	if err != nil {
+		t.Skipf("no file flags: %v", err)
+	}
+	if err := unix.IoctlSetPointerInt(int(f.Fd()), uint(fsIocSetflags), int(flags|fsImmutable)); err != nil {
+		t.Skipf("cannot make a file immutable: %v", err)
+	}
+	// Leave the file removable.
+	defer unix.IoctlSetPointerInt(int(f.Fd()), uint(fsIocSetflags), int(flags))
+
+	if err := Write("BootOrder", GlobalGUID, attr, []byte{2, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if _, data, err := Read("BootOrder", GlobalGUID); err != nil || !bytes.Equal(data, []byte{2, 0}) {
+		t.Errorf("Read after Write = %#x, %v, want 0x0200", data, err)
+	}
+	if got, err := unix.IoctlGetUint32(int(f.Fd()), unix.FS_IOC_GETFLAGS); err != nil || got&fsImmutable == 0 {
+		t.Errorf("flags after Write = %#x, %v, want immutable", got, err)
+	}
+}
+
+func TestOSIndications(t *testing.T) {
+	defer testDir(t)()
+
+	if err := SetOSIndications(BootToFWUI); err == nil {
+		t.Error("SetOSIndications without support did not fail")
+	}
+	if err := Write("OsIndicationsSupported", GlobalGUID, BootServiceAccess|RuntimeAccess, []byte{0x05, 0, 0, 0, 0, 0, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write("OsIndications", GlobalGUID, NonVolatile|BootServiceAccess|RuntimeAccess, []byte{0x04, 0, 0, 0, 0, 0, 0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetOSIndications(BootToFWUI); err != nil {
+		t.Fatal(err)
+	}
+	o, err := GetOSIndications()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if o != BootToFWUI|FileCapsuleDelivery {
+		t.Errorf("GetOSIndications = %v, want %v", o, BootToFWUI|FileCapsuleDelivery)
+	}
+	if err := SetOSIndications(StartOSRecovery); err == nil || err.Error() != "firmware does not support start OS recovery" {
+		t.Errorf("SetOSIndications(StartOSRecovery) = %v", err)
+	}
+}
+
+func TestOSIndicationsString(t *testing.T) {
+	for _, tt := range []struct {
+		o    OSIndications
+		want string
+	}{
+		{0, "none"},
+		{BootToFWUI, "boot to firmware UI"},
+		{FileCapsuleDelivery | 0x100, "file capsule delivery, 0x100"},
+	} {
+		if got := tt.o.String(); got != tt.want {
+			t.Errorf("%#x.String() = %q, want %q", uint64(tt.o), got, tt.want)
+		}
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	defer testDir(t)()
+	if err := os.Mkdir(LegacyDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	newVar := filepath.Join(LegacyDir, "new_var")
+	if err := ioutil.WriteFile(newVar, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	attr := NonVolatile | BootServiceAccess | RuntimeAccess
+	if err := Write("Timeout", GlobalGUID, attr, []byte{5, 0}); err != nil {
+		t.Fatal(err)
+	}
+	v, err := ioutil.ReadFile(newVar)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v) != legacyVarLen {
+		t.Fatalf("new_var got %d bytes, want %d", len(v), legacyVarLen)
+	}
+	if want := []byte{'T', 0, 'i', 0}; !bytes.Equal(v[:4], want) {
+		t.Errorf("name starts %#x, want %#x", v[:4], want)
+	}
+	guid := []byte{0x61, 0xdf, 0xe4, 0x8b, 0xca, 0x93, 0xd2, 0x11, 0xaa, 0x0d, 0x00, 0xe0, 0x98, 0x03, 0x2b, 0x8c}
+	if g := v[legacyGUIDOff : legacyGUIDOff+16]; !bytes.Equal(g, guid) {
+		t.Errorf("GUID = %#x, want %#x", g, guid)
+	}
+
+	// The kernel makes a directory of the new variable.
+	d := filepath.Join(LegacyDir, "Timeout-"+GlobalGUID)
+	if err := os.Mkdir(d, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(d, "raw_var"), v, 0644); err != nil {
+		t.Fatal(err)
+	}
+	gotAttr, data, err := Read("Timeout", GlobalGUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotAttr != attr || !bytes.Equal(data, []byte{5, 0}) {
+		t.Errorf("Read = %#x, %#x, want %#x, 0x0500", gotAttr, data, attr)
+	}
+	if err := Write("Timeout", GlobalGUID, attr, []byte{7, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if _, data, err := Read("Timeout", GlobalGUID); err != nil || !bytes.Equal(data, []byte{7, 0}) {
+		t.Errorf("Read after rewrite = %#x, %v, want 0x0700", data, err)
+	}
+
+	if err := Write("Big", GlobalGUID, attr, make([]byte, legacyDataLen+1)); err == nil {
+		t.Error("Write of more than the legacy interface takes did not fail")
+	}
+	if _, _, err := Read("Missing", GlobalGUID); !os.IsNotExist(err) {
+		t.Errorf("Read of a missing variable = %v, want not exist", err)
+	}
+
+	// Once efivarfs is mounted, it is used.
+	if err := ioutil.WriteFile(filepath.Join(Dir, "Timeout-"+GlobalGUID), []byte{7, 0, 0, 0, 9, 0}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, data, err := Read("Timeout", GlobalGUID); err != nil || !bytes.Equal(data, []byte{9, 0}) {
+		t.Errorf("Read with efivarfs = %#x, %v, want 0x0900", data, err)
+	}
+}
+
+func TestParseGUID(t *testing.T) {
+	for _, g := range []string{"", "8be4df61-93ca-11d2-aa0d-00e098032b8", "8be4df61-93ca-11d2-aa0d-00e098032b8x", "8be4df6193ca11d2aa0d00e098032b8c"} {
+		if _, err := parseGUID(g); err == nil {
+			t.Errorf("parseGUID(%q) did not fail", g)
+		}
+	}
+}
+
+func TestWriteLimit(t *testing.T) {
+	defer testDir(t)()
+	defer func(n int) { WriteLimit = n }(WriteLimit)
+	WriteLimit = 2
+
+	for i := 0; i < 2; i++ {
+		if err := Write("Timeout", GlobalGUID, NonVolatile, []byte{byte(i), 0}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Write("Timeout", GlobalGUID, NonVolatile, []byte{2, 0}); err != ErrRateLimited {
+		t.Errorf("third Write = %v, want %v", err, ErrRateLimited)
+	}
+
+	defer func(w time.Duration) { WriteWindow = w }(WriteWindow)
+	WriteWindow = 0
+	if err := Write("Timeout", GlobalGUID, NonVolatile, []byte{2, 0}); err != nil {
+		t.Errorf("Write after the window = %v", err)
+	}
+}
+
+func TestWriteSpace(t *testing.T) {
+	defer testDir(t)()
+	var free uint64
+	statfs = func(_ string, s *unix.Statfs_t) error {
+		s.Bsize, s.Blocks, s.Bfree = 1, 64*1024, free
+		return nil
+	}
+
+	// The header, "Timeout" and its NUL, the data and Reserve.
+	need := uint64(varHeader+16+2) + Reserve
+	free = need - 1
+	if err := Write("Timeout", GlobalGUID, NonVolatile, []byte{5, 0}); !errors.Is(err, ErrNoSpace) {
+		t.Errorf("Write to a full store = %v, want %v", err, ErrNoSpace)
+	}
+	free = need
+	if err := Write("Timeout", GlobalGUID, NonVolatile, []byte{5, 0}); err != nil {
+		t.Errorf("Write = %v", err)
+	}
+	total, gotFree, ok, err := Space()
+	if err != nil || !ok || total != 64*1024 || gotFree != need {
+		t.Errorf("Space = %d, %d, %t, %v, want %d, %d, true", total, gotFree, ok, err, 64*1024, need)
+	}
+}
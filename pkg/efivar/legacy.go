@@ -0,0 +1,137 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package efivar
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf16"
+	"unsafe"
+)
+
+// The legacy interface reads and writes variables as the kernel's struct
+// efi_variable:
+//
+//	u16           VariableName[512];
+//	efi_guid_t    VendorGuid;
+//	unsigned long DataSize;
+//	u8            Data[1024];
+//	efi_status_t  Status;
+//	u32           Attributes;
+//
+// packed, with longs of the size of the writer's.
+const (
+	legacyNameLen = 1024
+	legacyDataLen = 1024
+	longLen       = int(unsafe.Sizeof(uintptr(0)))
+
+	legacyGUIDOff = legacyNameLen
+	legacySizeOff = legacyGUIDOff + 16
+	legacyDataOff = legacySizeOff + longLen
+	legacyAttrOff = legacyDataOff + legacyDataLen + longLen
+	legacyVarLen  = legacyAttrOff + 4
+	legacyMaxName = legacyNameLen/2 - 1
+)
+
+// parseGUID returns the bytes of a GUID in the text form of GlobalGUID,
+// with its first three fields little endian.
+func parseGUID(guid string) ([16]byte, error) {
+	var g [16]byte
+	b, err := hex.DecodeString(strings.Replace(guid, "-", "", -1))
+	if err != nil || len(guid) != len(GlobalGUID) || len(b) != 16 {
+		return g, fmt.Errorf("invalid GUID %q", guid)
+	}
+	binary.LittleEndian.PutUint32(g[0:], binary.BigEndian.Uint32(b[0:]))
+	binary.LittleEndian.PutUint16(g[4:], binary.BigEndian.Uint16(b[4:]))
+	binary.LittleEndian.PutUint16(g[6:], binary.BigEndian.Uint16(b[6:]))
+	copy(g[8:], b[8:])
+	return g, nil
+}
+
+func putLong(b []byte, v uint64) {
+	if longLen == 8 {
+		binary.LittleEndian.PutUint64(b, v)
+	} else {
+		binary.LittleEndian.PutUint32(b, uint32(v))
+	}
+}
+
+func long(b []byte) uint64 {
+	if longLen == 8 {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return uint64(binary.LittleEndian.Uint32(b))
+}
+
+// legacyVar encodes a struct efi_variable.
+func legacyVar(name, guid string, attr Attributes, data []byte) ([]byte, error) {
+	u := utf16.Encode([]rune(name))
+	if len(u) > legacyMaxName {
+		return nil, fmt.Errorf("EFI variable name %s is too long", name)
+	}
+	if len(data) > legacyDataLen {
+		return nil, fmt.Errorf("EFI variable %s: %d bytes are more than the %d of the legacy interface", name, len(data), legacyDataLen)
+	}
+	g, err := parseGUID(guid)
+	if err != nil {
+		return nil, err
+	}
+	v := make([]byte, legacyVarLen)
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(v[2*i:], c)
+	}
+	copy(v[legacyGUIDOff:], g[:])
+	putLong(v[legacySizeOff:], uint64(len(data)))
+	copy(v[legacyDataOff:], data)
+	binary.LittleEndian.PutUint32(v[legacyAttrOff:], uint32(attr))
+	return v, nil
+}
+
+func legacyPath(name, guid string) string {
+	return filepath.Join(LegacyDir, name+"-"+guid)
+}
+
+func readLegacy(name, guid string) (Attributes, []byte, error) {
+	v, err := ioutil.ReadFile(filepath.Join(legacyPath(name, guid), "raw_var"))
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(v) != legacyVarLen {
+		return 0, nil, fmt.Errorf("EFI variable %s: %d bytes, not %d", name, len(v), legacyVarLen)
+	}
+	size := long(v[legacySizeOff:])
+	if size > legacyDataLen {
+		return 0, nil, fmt.Errorf("EFI variable %s: bad size %d", name, size)
+	}
+	data := append([]byte(nil), v[legacyDataOff:legacyDataOff+int(size)]...)
+	return Attributes(binary.LittleEndian.Uint32(v[legacyAttrOff:])), data, nil
+}
+
+// writeLegacy writes an existing variable's raw_var, and new ones to
+// new_var.
+func writeLegacy(name, guid string, attr Attributes, data []byte) error {
+	v, err := legacyVar(name, guid, attr, data)
+	if err != nil {
+		return err
+	}
+	p := filepath.Join(legacyPath(name, guid), "raw_var")
+	if _, err := os.Stat(p); os.IsNotExist(err) {
+		p = filepath.Join(LegacyDir, "new_var")
+	}
+	f, err := os.OpenFile(p, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(v); err != nil {
+		f.Close()
+		return fmt.Errorf("writing EFI variable %s: %v", name, err)
+	}
+	return f.Close()
+}
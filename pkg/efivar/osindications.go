@@ -0,0 +1,108 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package efivar
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// OSIndications are what the OS asks of the firmware on the next boot,
+// UEFI 2.8 section 8.5.4.
+type OSIndications uint64
+
+// OSIndications. Capsule support bits are only ever supported, not asked
+// for.
+const (
+	// BootToFWUI stops the next boot in the firmware's setup UI.
+	BootToFWUI OSIndications = 1 << iota
+	TimestampRevocation
+	// FileCapsuleDelivery has the firmware apply the capsules in
+	// \EFI\UpdateCapsule on the ESP.
+	FileCapsuleDelivery
+	FMPCapsuleSupported
+	CapsuleResultVarSupported
+	StartOSRecovery
+	StartPlatformRecovery
+	JSONConfigDataRefresh
+)
+
+var osIndicationNames = []string{
+	"boot to firmware UI",
+	"timestamp revocation",
+	"file capsule delivery",
+	"FMP capsule",
+	"capsule result variable",
+	"start OS recovery",
+	"start platform recovery",
+	"JSON config data refresh",
+}
+
+func (o OSIndications) String() string {
+	var s []string
+	for i, n := range osIndicationNames {
+		if o&(1<<uint(i)) != 0 {
+			s = append(s, n)
+			o &^= 1 << uint(i)
+		}
+	}
+	if o != 0 {
+		s = append(s, fmt.Sprintf("%#x", uint64(o)))
+	}
+	if len(s) == 0 {
+		return "none"
+	}
+	return strings.Join(s, ", ")
+}
+
+func readOSIndications(name string) (OSIndications, error) {
+	_, b, err := Read(name, GlobalGUID)
+	if err != nil {
+		return 0, err
+	}
+	if len(b) != 8 {
+		return 0, fmt.Errorf("EFI variable %s is %d bytes, not 8", name, len(b))
+	}
+	return OSIndications(binary.LittleEndian.Uint64(b)), nil
+}
+
+// SupportedOSIndications returns what the firmware can be asked for.
+func SupportedOSIndications() (OSIndications, error) {
+	o, err := readOSIndications("OsIndicationsSupported")
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	return o, err
+}
+
+// GetOSIndications returns what the firmware is asked for on the next boot.
+func GetOSIndications() (OSIndications, error) {
+	o, err := readOSIndications("OsIndications")
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	return o, err
+}
+
+// SetOSIndications asks the firmware for o on the next boot, on top of what
+// it is asked for already. The firmware clears them once done.
+func SetOSIndications(o OSIndications) error {
+	supported, err := SupportedOSIndications()
+	if err != nil {
+		return err
+	}
+	if u := o &^ supported; u != 0 {
+		return fmt.Errorf("firmware does not support %v", u)
+	}
+	cur, err := GetOSIndications()
+	if err != nil {
+		return err
+	}
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], uint64(cur|o))
+	return Write("OsIndications", GlobalGUID, NonVolatile|BootServiceAccess|RuntimeAccess, b[:])
+}
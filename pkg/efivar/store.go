@@ -0,0 +1,98 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package efivar
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"golang.org/x/sys/unix"
+)
+
+// Firmware reclaims the space of overwritten variables at best on the next
+// boot, so a program writing variables in a loop fills the store, and some
+// machines do not boot with a full store.
+var (
+	// WriteLimit is how many variables may be written in WriteWindow.
+	WriteLimit = 64
+	// WriteWindow is the window of WriteLimit.
+	WriteWindow = time.Minute
+	// Reserve is the space writes leave free in the store, as the kernel
+	// does on x86.
+	Reserve uint64 = 5 * 1024
+)
+
+var (
+	// ErrRateLimited is returned by writes past WriteLimit.
+	ErrRateLimited = errors.New("too many EFI variable writes")
+	// ErrNoSpace is returned by writes that would leave less than Reserve
+	// free in the store.
+	ErrNoSpace = errors.New("EFI variable store is full")
+)
+
+// varHeader is about the size of an authenticated variable's header in
+// the store, EDK II's AUTHENTICATED_VARIABLE_HEADER.
+const varHeader = 64
+
+// statfs is a variable so tests can fake the store's space.
+var statfs = unix.Statfs
+
+type limiter struct {
+	mu     sync.Mutex
+	writes []time.Time
+}
+
+var writes limiter
+
+// take counts a write, unless it is past WriteLimit.
+func (l *limiter) take() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now()
+	w := l.writes[:0]
+	for _, t := range l.writes {
+		if now.Sub(t) < WriteWindow {
+			w = append(w, t)
+		}
+	}
+	l.writes = w
+	if len(l.writes) >= WriteLimit {
+		return ErrRateLimited
+	}
+	l.writes = append(l.writes, now)
+	return nil
+}
+
+// Space returns the size of the variable store and the space free in it.
+// efivarfs reports them since Linux 6.6; ok is false if it does not.
+func Space() (total, free uint64, ok bool, err error) {
+	var s unix.Statfs_t
+	if err := statfs(Dir, &s); err != nil {
+		return 0, 0, false, err
+	}
+	if s.Blocks == 0 {
+		return 0, 0, false, nil
+	}
+	return s.Blocks * uint64(s.Bsize), s.Bfree * uint64(s.Bsize), true, nil
+}
+
+// checkSpace returns ErrNoSpace if writing data to variable name would
+// leave less than Reserve free. The firmware writes the new value before
+// reclaiming the old one, so all of it has to fit.
+func checkSpace(name string, data []byte) error {
+	_, free, ok, err := Space()
+	if err != nil || !ok {
+		// Nothing to go by; the firmware has the last word.
+		return nil
+	}
+	need := uint64(varHeader+2*(len(utf16.Encode([]rune(name)))+1)+len(data)) + Reserve
+	if free < need {
+		return fmt.Errorf("writing EFI variable %s: %w: %d bytes free, %d needed", name, ErrNoSpace, free, need)
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package efivar
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+	"unsafe"
+
+	"github.com/vtolstov/go-ioctl"
+	"golang.org/x/sys/unix"
+)
+
+// The EFI time is the firmware's GetTime and SetTime, through the rtc-efi
+// RTC or, without it, the efi_test module's /dev/efi_test.
+var (
+	rtcClass = "/sys/class/rtc"
+	devDir   = "/dev"
+	efiTest  = "/dev/efi_test"
+)
+
+// ErrNoTime is returned if neither rtc-efi nor efi_test are there.
+var ErrNoTime = errors.New("no access to the EFI time: load rtc-efi or efi_test")
+
+// efiTime is EFI_TIME, UEFI 2.8 section 8.3.
+type efiTime struct {
+	Year       uint16
+	Month      uint8
+	Day        uint8
+	Hour       uint8
+	Minute     uint8
+	Second     uint8
+	_          uint8
+	Nanosecond uint32
+	TimeZone   int16
+	Daylight   uint8
+	_          uint8
+}
+
+// efiTimeCap is EFI_TIME_CAPABILITIES.
+type efiTimeCap struct {
+	Resolution uint32
+	Accuracy   uint32
+	SetsToZero uint8
+}
+
+// unspecifiedTimeZone is EFI_UNSPECIFIED_TIMEZONE, local time.
+const unspecifiedTimeZone = 0x07FF
+
+// efi_test's struct efi_gettime and efi_settime: pointers to the status
+// and arguments of the call.
+type efiGetTime struct {
+	status, time, caps uintptr
+}
+
+type efiSetTime struct {
+	status, time uintptr
+}
+
+var (
+	efiRuntimeGetTime = ioctl.IOR('p', 0x03, unsafe.Sizeof(efiGetTime{}))
+	efiRuntimeSetTime = ioctl.IOW('p', 0x04, unsafe.Sizeof(efiSetTime{}))
+)
+
+func (t *efiTime) time() time.Time {
+	loc := time.Local
+	if t.TimeZone != unspecifiedTimeZone {
+		// The offset in minutes from UTC.
+		loc = time.FixedZone("", int(t.TimeZone)*60)
+	}
+	return time.Date(int(t.Year), time.Month(t.Month), int(t.Day), int(t.Hour), int(t.Minute), int(t.Second), int(t.Nanosecond), loc)
+}
+
+func toEFITime(t time.Time) *efiTime {
+	_, off := t.Zone()
+	return &efiTime{
+		Year:       uint16(t.Year()),
+		Month:      uint8(t.Month()),
+		Day:        uint8(t.Day()),
+		Hour:       uint8(t.Hour()),
+		Minute:     uint8(t.Minute()),
+		Second:     uint8(t.Second()),
+		Nanosecond: uint32(t.Nanosecond()),
+		TimeZone:   int16(off / 60),
+	}
+}
+
+// rtcEFI returns the device of the rtc-efi RTC, or "".
+func rtcEFI() string {
+	names, _ := filepath.Glob(filepath.Join(rtcClass, "rtc*", "name"))
+	for _, n := range names {
+		if b, err := ioutil.ReadFile(n); err == nil && strings.TrimSpace(string(b)) == "rtc-efi" {
+			return filepath.Join(devDir, filepath.Base(filepath.Dir(n)))
+		}
+	}
+	return ""
+}
+
+// efiStatus is an error of an EFI_STATUS.
+func efiStatus(op string, status uint64) error {
+	if status == 0 {
+		return nil
+	}
+	// Errors have the high bit set.
+	return fmt.Errorf("%s: EFI status %#x", op, status&^(1<<63))
+}
+
+// GetTime returns the EFI time. rtc-efi has no time zone, so its time is
+// in UTC.
+func GetTime() (time.Time, error) {
+	if d := rtcEFI(); d != "" {
+		f, err := os.Open(d)
+		if err != nil {
+			return time.Time{}, err
+		}
+		defer f.Close()
+		rt, err := unix.IoctlGetRTCTime(int(f.Fd()))
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%s: %v", d, err)
+		}
+		return time.Date(int(rt.Year)+1900, time.Month(rt.Mon+1), int(rt.Mday), int(rt.Hour), int(rt.Min), int(rt.Sec), 0, time.UTC), nil
+	}
+	f, err := os.Open(efiTest)
+	if os.IsNotExist(err) {
+		return time.Time{}, ErrNoTime
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer f.Close()
+	var (
+		status uint64
+		t      efiTime
+		caps   efiTimeCap
+	)
+	a := efiGetTime{
+		status: uintptr(unsafe.Pointer(&status)),
+		time:   uintptr(unsafe.Pointer(&t)),
+		caps:   uintptr(unsafe.Pointer(&caps)),
+	}
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), efiRuntimeGetTime, uintptr(unsafe.Pointer(&a)))
+	runtime.KeepAlive(&status)
+	runtime.KeepAlive(&t)
+	runtime.KeepAlive(&caps)
+	if errno != 0 {
+		return time.Time{}, fmt.Errorf("GetTime: %v", errno)
+	}
+	if err := efiStatus("GetTime", status); err != nil {
+		return time.Time{}, err
+	}
+	return t.time(), nil
+}
+
+// SetTime sets the EFI time to t, in UTC through rtc-efi, and in t's time
+// zone otherwise.
+func SetTime(t time.Time) error {
+	if d := rtcEFI(); d != "" {
+		f, err := os.Open(d)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		u := t.UTC()
+		rt := unix.RTCTime{
+			Sec:  int32(u.Second()),
+			Min:  int32(u.Minute()),
+			Hour: int32(u.Hour()),
+			Mday: int32(u.Day()),
+			Mon:  int32(u.Month() - 1),
+			Year: int32(u.Year() - 1900),
+		}
+		if err := unix.IoctlSetRTCTime(int(f.Fd()), &rt); err != nil {
+			return fmt.Errorf("%s: %v", d, err)
+		}
+		return nil
+	}
+	f, err := os.Open(efiTest)
+	if os.IsNotExist(err) {
+		return ErrNoTime
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var status uint64
+	et := toEFITime(t)
+	a := efiSetTime{
+		status: uintptr(unsafe.Pointer(&status)),
+		time:   uintptr(unsafe.Pointer(et)),
+	}
+	_, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), efiRuntimeSetTime, uintptr(unsafe.Pointer(&a)))
+	runtime.KeepAlive(&status)
+	runtime.KeepAlive(et)
+	if errno != 0 {
+		return fmt.Errorf("SetTime: %v", errno)
+	}
+	return efiStatus("SetTime", status)
+}
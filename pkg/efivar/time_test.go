@@ -0,0 +1,74 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package efivar
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEFITime(t *testing.T) {
+	for _, tt := range []struct {
+		et   efiTime
+		want time.Time
+	}{
+		{
+			et:   efiTime{Year: 2020, Month: 3, Day: 14, Hour: 15, Minute: 9, Second: 26, Nanosecond: 5, TimeZone: 60},
+			want: time.Date(2020, 3, 14, 15, 9, 26, 5, time.FixedZone("", 3600)),
+		},
+		{
+			et:   efiTime{Year: 2020, Month: 12, Day: 31, Hour: 23, Minute: 59, Second: 59, TimeZone: -300},
+			want: time.Date(2020, 12, 31, 23, 59, 59, 0, time.FixedZone("", -5*3600)),
+		},
+	} {
+		got := tt.et.time()
+		if !got.Equal(tt.want) {
+			t.Errorf("%+v.time() = %v, want %v", tt.et, got, tt.want)
+		}
+		if et := toEFITime(got); *et != tt.et {
+			t.Errorf("toEFITime(%v) = %+v, want %+v", got, *et, tt.et)
+		}
+	}
+
+	local := efiTime{Year: 2020, Month: 1, Day: 2, TimeZone: unspecifiedTimeZone}
+	if got := local.time(); got.Location() != time.Local {
+		t.Errorf("time with unspecified time zone is in %v, want local", got.Location())
+	}
+}
+
+func TestRTCEFI(t *testing.T) {
+	d, err := ioutil.TempDir("", "efivar")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(d)
+	defer func(c, dev, e string) { rtcClass, devDir, efiTest = c, dev, e }(rtcClass, devDir, efiTest)
+	rtcClass, devDir, efiTest = d, "/dev", filepath.Join(d, "efi_test")
+
+	for rtc, name := range map[string]string{"rtc0": "rtc_cmos\n", "rtc1": "rtc-efi\n"} {
+		if err := os.Mkdir(filepath.Join(d, rtc), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(d, rtc, "name"), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := rtcEFI(); got != "/dev/rtc1" {
+		t.Errorf("rtcEFI = %q, want /dev/rtc1", got)
+	}
+
+	if err := os.RemoveAll(filepath.Join(d, "rtc1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetTime(); err != ErrNoTime {
+		t.Errorf("GetTime without rtc-efi or efi_test = %v, want %v", err, ErrNoTime)
+	}
+	if err := SetTime(time.Now()); err != ErrNoTime {
+		t.Errorf("SetTime without rtc-efi or efi_test = %v, want %v", err, ErrNoTime)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package fb draws on a Linux frame buffer device, /dev/fb0 and the like.
+//
+// DRM drivers provide one too, unless the kernel is built without
+// CONFIG_DRM_FBDEV_EMULATION.
+package fb
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Frame buffer ioctls, from linux/fb.h.
+const (
+	fbioGetVScreenInfo = 0x4600
+	fbioGetFScreenInfo = 0x4602
+)
+
+// bitfield is struct fb_bitfield: where a color channel is in a pixel.
+type bitfield struct {
+	Offset   uint32
+	Length   uint32
+	MSBRight uint32
+}
+
+// varScreenInfo is struct fb_var_screeninfo.
+type varScreenInfo struct {
+	XRes, YRes               uint32
+	XResVirtual, YResVirtual uint32
+	XOffset, YOffset         uint32
+	BitsPerPixel             uint32
+	Grayscale                uint32
+	Red, Green, Blue, Transp bitfield
+	NonStd                   uint32
+	Activate                 uint32
+	Height, Width            uint32
+	AccelFlags               uint32
+	PixClock                 uint32
+	LeftMargin, RightMargin  uint32
+	UpperMargin, LowerMargin uint32
+	HSyncLen, VSyncLen       uint32
+	Sync                     uint32
+	VMode                    uint32
+	Rotate                   uint32
+	Colorspace               uint32
+	Reserved                 [4]uint32
+}
+
+// fixScreenInfo is struct fb_fix_screeninfo.
+type fixScreenInfo struct {
+	ID           [16]byte
+	SMemStart    uintptr
+	SMemLen      uint32
+	Type         uint32
+	TypeAux      uint32
+	Visual       uint32
+	XPanStep     uint16
+	YPanStep     uint16
+	YWrapStep    uint16
+	LineLength   uint32
+	MMIOStart    uintptr
+	MMIOLen      uint32
+	Accel        uint32
+	Capabilities uint16
+	Reserved     [2]uint16
+}
+
+// FB is a frame buffer device.
+type FB struct {
+	f      *os.File
+	v      varScreenInfo
+	stride int
+	frame  []byte
+}
+
+// Open opens the frame buffer device dev, e.g. /dev/fb0.
+func Open(dev string) (*FB, error) {
+	f, err := os.OpenFile(dev, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	var v varScreenInfo
+	var fix fixScreenInfo
+	if err := ioctl(f, fbioGetVScreenInfo, unsafe.Pointer(&v)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: FBIOGET_VSCREENINFO: %v", dev, err)
+	}
+	if err := ioctl(f, fbioGetFScreenInfo, unsafe.Pointer(&fix)); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: FBIOGET_FSCREENINFO: %v", dev, err)
+	}
+	fb, err := newFB(f, v, int(fix.LineLength))
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", dev, err)
+	}
+	return fb, nil
+}
+
+func ioctl(f *os.File, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+func newFB(f *os.File, v varScreenInfo, stride int) (*FB, error) {
+	switch v.BitsPerPixel {
+	case 16, 24, 32:
+	default:
+		return nil, fmt.Errorf("%d bits per pixel are not supported", v.BitsPerPixel)
+	}
+	if stride < int(v.XRes*v.BitsPerPixel/8) {
+		return nil, fmt.Errorf("line length %d is too short for %d pixels", stride, v.XRes)
+	}
+	return &FB{f: f, v: v, stride: stride, frame: make([]byte, stride*int(v.YRes))}, nil
+}
+
+// Bounds returns the visible area of the frame buffer.
+func (fb *FB) Bounds() image.Rectangle {
+	return image.Rect(0, 0, int(fb.v.XRes), int(fb.v.YRes))
+}
+
+// Draw shows img, which is clipped to Bounds.
+func (fb *FB) Draw(img image.Image) error {
+	rgba, ok := img.(*image.RGBA)
+	if !ok || rgba.Bounds() != fb.Bounds() {
+		rgba = image.NewRGBA(fb.Bounds())
+		draw.Draw(rgba, rgba.Bounds(), img, image.ZP, draw.Src)
+	}
+
+	bpp := int(fb.v.BitsPerPixel / 8)
+	for y := 0; y < int(fb.v.YRes); y++ {
+		line := fb.frame[y*fb.stride:]
+		src := rgba.Pix[y*rgba.Stride:]
+		for x := 0; x < int(fb.v.XRes); x++ {
+			p := fb.pixel(src[x*4], src[x*4+1], src[x*4+2])
+			for i := 0; i < bpp; i++ {
+				line[x*bpp+i] = byte(p >> (8 * uint(i)))
+			}
+		}
+	}
+	// Write to what is on screen if the buffer is panned.
+	off := int64(fb.v.YOffset)*int64(fb.stride) + int64(fb.v.XOffset)*int64(bpp)
+	_, err := fb.f.WriteAt(fb.frame, off)
+	return err
+}
+
+// pixel packs a color as the frame buffer wants it, in native byte order.
+func (fb *FB) pixel(r, g, b byte) uint32 {
+	return channel(r, fb.v.Red) | channel(g, fb.v.Green) | channel(b, fb.v.Blue)
+}
+
+func channel(c byte, f bitfield) uint32 {
+	if f.Length == 0 || f.Length > 8 {
+		return 0
+	}
+	return uint32(c>>(8-f.Length)) << f.Offset
+}
+
+// Close closes the device. What was drawn stays on screen.
+func (fb *FB) Close() error {
+	return fb.f.Close()
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fb
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"io/ioutil"
+	"os"
+	"testing"
+	"unsafe"
+)
+
+func TestScreenInfoSize(t *testing.T) {
+	// sizeof(struct fb_var_screeninfo) is 160 on every architecture.
+	if s := unsafe.Sizeof(varScreenInfo{}); s != 160 {
+		t.Errorf("sizeof(varScreenInfo) = %d, want 160", s)
+	}
+}
+
+func TestDraw(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		v      varScreenInfo
+		stride int
+		want   []byte
+	}{
+		{
+			name:   "xrgb8888",
+			v:      varScreenInfo{XRes: 2, YRes: 2, BitsPerPixel: 32, Red: bitfield{Offset: 16, Length: 8}, Green: bitfield{Offset: 8, Length: 8}, Blue: bitfield{Length: 8}},
+			stride: 12,
+			want: []byte{
+				0x30, 0x20, 0x10, 0, 0xff, 0xff, 0xff, 0, 0, 0, 0, 0,
+				0, 0, 0, 0, 0x30, 0x20, 0x10, 0, 0, 0, 0, 0,
+			},
+		},
+		{
+			name:   "bgr888",
+			v:      varScreenInfo{XRes: 2, YRes: 2, BitsPerPixel: 24, Red: bitfield{Length: 8}, Green: bitfield{Offset: 8, Length: 8}, Blue: bitfield{Offset: 16, Length: 8}},
+			stride: 6,
+			want: []byte{
+				0x10, 0x20, 0x30, 0xff, 0xff, 0xff,
+				0, 0, 0, 0x10, 0x20, 0x30,
+			},
+		},
+		{
+			name:   "rgb565",
+			v:      varScreenInfo{XRes: 2, YRes: 2, BitsPerPixel: 16, Red: bitfield{Offset: 11, Length: 5}, Green: bitfield{Offset: 5, Length: 6}, Blue: bitfield{Length: 5}},
+			stride: 4,
+			want: []byte{
+				0x06, 0x11, 0xff, 0xff,
+				0, 0, 0x06, 0x11,
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := ioutil.TempFile("", "fb")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.Remove(f.Name())
+			defer f.Close()
+
+			fb, err := newFB(f, tt.v, tt.stride)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b := fb.Bounds(); b != image.Rect(0, 0, 2, 2) {
+				t.Errorf("Bounds() = %v, want 2x2", b)
+			}
+			img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+			c := color.RGBA{0x10, 0x20, 0x30, 0xff}
+			img.Set(0, 0, c)
+			img.Set(1, 0, color.White)
+			img.Set(1, 1, c)
+			if err := fb.Draw(img); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ioutil.ReadFile(f.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("frame = % x, want % x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewFBUnsupported(t *testing.T) {
+	if _, err := newFB(nil, varScreenInfo{XRes: 8, YRes: 8, BitsPerPixel: 8}, 8); err == nil {
+		t.Errorf("newFB accepted 8 bpp")
+	}
+	if _, err := newFB(nil, varScreenInfo{XRes: 8, YRes: 8, BitsPerPixel: 32}, 16); err == nil {
+		t.Errorf("newFB accepted a short line length")
+	}
+}
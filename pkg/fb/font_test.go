@@ -0,0 +1,67 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fb
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+)
+
+// render draws s at scale 1 and returns it as rows of '#' and '.'.
+func render(s string) string {
+	img := image.NewGray(image.Rect(0, 0, StringWidth(s, 1), CharHeight))
+	DrawString(img, image.ZP, 1, s, color.White)
+	var b strings.Builder
+	for y := 0; y < 8; y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			if img.GrayAt(x, y).Y != 0 {
+				b.WriteByte('#')
+			} else {
+				b.WriteByte('.')
+			}
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func TestDrawString(t *testing.T) {
+	want := `#...#...#...
+#...#.......
+#...#..##...
+#####...#...
+#...#...#...
+#...#...#...
+#...#..###..
+............
+`
+	if got := render("Hi"); got != want {
+		t.Errorf("render(Hi) =\n%s\nwant\n%s", got, want)
+	}
+	if render("\x01") != render("?") || render("é") != render("?") {
+		t.Errorf("unprintable characters are not drawn as ?")
+	}
+}
+
+func TestDrawStringScale(t *testing.T) {
+	img := image.NewGray(image.Rect(0, 0, 20, 20))
+	DrawString(img, image.Pt(2, 2), 2, "|", color.White)
+	// The bar is column 2 of the glyph, rows 0-2 and 4-6.
+	for _, p := range []image.Point{{6, 2}, {7, 7}, {6, 10}, {7, 15}} {
+		if img.GrayAt(p.X, p.Y).Y == 0 {
+			t.Errorf("pixel %v is not set", p)
+		}
+	}
+	for _, p := range []image.Point{{5, 2}, {8, 2}, {6, 8}, {6, 16}} {
+		if img.GrayAt(p.X, p.Y).Y != 0 {
+			t.Errorf("pixel %v is set", p)
+		}
+	}
+	if w := StringWidth("abc", 2); w != 3*CharWidth*2 {
+		t.Errorf("StringWidth = %d, want %d", w, 3*CharWidth*2)
+	}
+}
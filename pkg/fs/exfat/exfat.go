@@ -0,0 +1,442 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package exfat reads exFAT file systems, as on most SD cards and USB
+// sticks bigger than 32 GB.
+//
+// exFAT has no inodes, so the inode numbers this package gives fs.Tree are
+// the disk offsets of files' directory entries. Names are looked up without
+// regard to case, as exFAT does.
+package exfat
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf16"
+
+	"github.com/u-root/u-root/pkg/fs"
+)
+
+func init() {
+	fs.Register("exfat", New)
+}
+
+const (
+	fsName = "EXFAT   "
+
+	// The FAT marks the end of a chain with this, and bad clusters with
+	// badCluster.
+	endOfChain = 0xffffffff
+	badCluster = 0xfffffff7
+
+	// firstCluster is the number of the first cluster of the heap.
+	firstCluster = 2
+)
+
+// Directory entry types and fields.
+const (
+	entrySize = 32
+
+	entryEnd    = 0x00
+	entryInUse  = 0x80
+	entryFile   = 0x85
+	entryStream = 0xc0
+	entryName   = 0xc1
+
+	attrReadOnly  = 0x01
+	attrDirectory = 0x10
+
+	streamNoFATChain = 0x02
+
+	nameChars = 15
+
+	// rootIno is the inode number of the root directory, which has no
+	// directory entry. Offset 0 is the boot sector, so no entry is there.
+	rootIno = 0
+)
+
+// FS is an exFAT file system.
+type FS struct {
+	r io.ReaderAt
+
+	fatOffset    int64
+	heapOffset   int64
+	clusterShift uint
+	clusterCount uint32
+	rootCluster  uint32
+
+	mu sync.Mutex
+	// files are the files ReadDir has found, by inode number.
+	files map[uint64]*file
+}
+
+// file is what this package uses of a file's directory entries.
+type file struct {
+	name      string
+	attr      uint16
+	mtime     time.Time
+	cluster   uint32
+	size      int64
+	validSize int64
+	noChain   bool
+}
+
+func (f *file) isDir() bool {
+	return f.attr&attrDirectory != 0
+}
+
+// New reads the exFAT file system on r.
+func New(r io.ReaderAt) (fs.FS, error) {
+	x, err := newFS(r)
+	if err != nil {
+		return nil, err
+	}
+	return fs.NewFS(x), nil
+}
+
+func newFS(r io.ReaderAt) (*FS, error) {
+	b := make([]byte, 512)
+	if _, err := r.ReadAt(b, 0); err != nil {
+		return nil, fmt.Errorf("reading boot sector: %v", err)
+	}
+	if string(b[3:11]) != fsName {
+		return nil, fmt.Errorf("no exFAT file system name")
+	}
+	if b[510] != 0x55 || b[511] != 0xaa {
+		return nil, fmt.Errorf("bad boot signature %#02x%02x", b[510], b[511])
+	}
+	le := binary.LittleEndian
+	sectorShift, clusterShift := uint(b[108]), uint(b[109])
+	if sectorShift < 9 || sectorShift > 12 || sectorShift+clusterShift > 25 {
+		return nil, fmt.Errorf("bad sector or cluster size shifts %d and %d", sectorShift, clusterShift)
+	}
+	x := &FS{
+		r:            r,
+		fatOffset:    int64(le.Uint32(b[80:])) << sectorShift,
+		heapOffset:   int64(le.Uint32(b[88:])) << sectorShift,
+		clusterShift: sectorShift + clusterShift,
+		clusterCount: le.Uint32(b[92:]),
+		rootCluster:  le.Uint32(b[96:]),
+		files:        map[uint64]*file{},
+	}
+	if !x.valid(x.rootCluster) {
+		return nil, fmt.Errorf("bad root directory cluster %d", x.rootCluster)
+	}
+	x.files[rootIno] = &file{attr: attrDirectory, cluster: x.rootCluster}
+	return x, nil
+}
+
+// valid reports whether c is a cluster in the heap.
+func (x *FS) valid(c uint32) bool {
+	return c >= firstCluster && c-firstCluster < x.clusterCount
+}
+
+func (x *FS) clusterOffset(c uint32) int64 {
+	return x.heapOffset + int64(c-firstCluster)<<x.clusterShift
+}
+
+// chain returns the clusters of a file, starting at c, up to n of them,
+// or to the end of the chain if n is negative.
+func (x *FS) chain(c uint32, n int64) ([]uint32, error) {
+	var cs []uint32
+	for (n < 0 || int64(len(cs)) < n) && c != endOfChain {
+		if !x.valid(c) {
+			return nil, fmt.Errorf("bad cluster %#x in chain", c)
+		}
+		// A chain longer than the heap has a loop.
+		if uint32(len(cs)) >= x.clusterCount {
+			return nil, fmt.Errorf("cluster chain loops")
+		}
+		cs = append(cs, c)
+		var b [4]byte
+		if _, err := x.r.ReadAt(b[:], x.fatOffset+int64(c)*4); err != nil {
+			return nil, fmt.Errorf("reading FAT: %v", err)
+		}
+		if c = binary.LittleEndian.Uint32(b[:]); c == badCluster {
+			return nil, fmt.Errorf("bad cluster in chain")
+		}
+	}
+	return cs, nil
+}
+
+// reader returns a reader of f's contents, which are size bytes.
+func (x *FS) reader(f *file, size int64) (*fileReader, error) {
+	n := size >> x.clusterShift
+	if size&(1<<x.clusterShift-1) != 0 {
+		n++
+	}
+	if n > int64(x.clusterCount) {
+		return nil, fmt.Errorf("file of %d bytes does not fit in %d clusters", size, x.clusterCount)
+	}
+	var cs []uint32
+	switch {
+	case n == 0:
+	case f.noChain:
+		if !x.valid(f.cluster) || !x.valid(f.cluster+uint32(n)-1) {
+			return nil, fmt.Errorf("bad clusters %#x to %#x", f.cluster, f.cluster+uint32(n)-1)
+		}
+		for i := uint32(0); i < uint32(n); i++ {
+			cs = append(cs, f.cluster+i)
+		}
+	default:
+		var err error
+		if cs, err = x.chain(f.cluster, n); err != nil {
+			return nil, err
+		}
+		if int64(len(cs)) < n {
+			return nil, fmt.Errorf("cluster chain of %d bytes is short of %d", int64(len(cs))<<x.clusterShift, size)
+		}
+	}
+	valid := f.validSize
+	if valid > size {
+		valid = size
+	}
+	return &fileReader{x: x, clusters: cs, size: size, valid: valid}, nil
+}
+
+// fileReader reads size bytes of a file from its clusters. Bytes from valid
+// on have not been written and read as zeros.
+type fileReader struct {
+	x        *FS
+	clusters []uint32
+	size     int64
+	valid    int64
+}
+
+func (r *fileReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= r.size {
+		return 0, io.EOF
+	}
+	var err error
+	if int64(len(p)) > r.size-off {
+		p = p[:r.size-off]
+		err = io.EOF
+	}
+	cs := int64(1) << r.x.clusterShift
+	for n := 0; n < len(p); {
+		pos := off + int64(n)
+		chunk := p[n:]
+		if rest := cs - pos%cs; int64(len(chunk)) > rest {
+			chunk = chunk[:rest]
+		}
+		n += len(chunk)
+		if pos+int64(len(chunk)) > r.valid {
+			from := r.valid - pos
+			if from < 0 {
+				from = 0
+			}
+			for i := range chunk[from:] {
+				chunk[from+int64(i)] = 0
+			}
+			chunk = chunk[:from]
+		}
+		if len(chunk) == 0 {
+			continue
+		}
+		if pos/cs >= int64(len(r.clusters)) {
+			return n - len(chunk), fmt.Errorf("offset %d is past the file's %d clusters", pos, len(r.clusters))
+		}
+		c := r.clusters[pos/cs]
+		if _, rerr := r.x.r.ReadAt(chunk, r.x.clusterOffset(c)+pos%cs); rerr != nil {
+			return n - len(chunk), rerr
+		}
+	}
+	return len(p), err
+}
+
+// Root implements fs.Tree.
+func (x *FS) Root() uint64 {
+	return rootIno
+}
+
+func (x *FS) file(ino uint64) (*file, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	f, ok := x.files[ino]
+	if !ok {
+		return nil, fmt.Errorf("no file at entry %#x", ino)
+	}
+	return f, nil
+}
+
+// Stat implements fs.Tree.
+func (x *FS) Stat(ino uint64, name string) (os.FileInfo, error) {
+	f, err := x.file(ino)
+	if err != nil {
+		return nil, err
+	}
+	mode := os.FileMode(0777)
+	if f.attr&attrReadOnly != 0 {
+		mode = 0555
+	}
+	if f.isDir() {
+		mode |= os.ModeDir
+	}
+	return &fs.Info{
+		FileName: name,
+		FileSize: f.size,
+		FileMode: mode,
+		MTime:    f.mtime,
+		Ino:      ino,
+		Nlink:    1,
+	}, nil
+}
+
+// Readlink implements fs.Tree. exFAT has no symlinks.
+func (x *FS) Readlink(ino uint64) (string, error) {
+	return "", fmt.Errorf("exFAT has no symlinks")
+}
+
+// Open implements fs.Tree.
+func (x *FS) Open(ino uint64) (io.ReaderAt, int64, error) {
+	f, err := x.file(ino)
+	if err != nil {
+		return nil, 0, err
+	}
+	r, err := x.reader(f, f.size)
+	if err != nil {
+		return nil, 0, fmt.Errorf("%s: %v", f.name, err)
+	}
+	return r, f.size, nil
+}
+
+// CaseInsensitive implements fs.CaseInsensitive.
+func (x *FS) CaseInsensitive() bool {
+	return true
+}
+
+// ReadDir implements fs.Tree.
+func (x *FS) ReadDir(ino uint64) ([]fs.Dirent, error) {
+	dir, err := x.file(ino)
+	if err != nil {
+		return nil, err
+	}
+	if !dir.isDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir.name)
+	}
+	var cs []uint32
+	if ino == rootIno {
+		// The root directory has no size; it is its whole chain.
+		if cs, err = x.chain(dir.cluster, -1); err != nil {
+			return nil, err
+		}
+	} else {
+		r, err := x.reader(dir, dir.size)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", dir.name, err)
+		}
+		cs = r.clusters
+	}
+
+	// Read the directory, and where each of its entries is on disk.
+	cs64 := int64(1) << x.clusterShift
+	b := make([]byte, int64(len(cs))*cs64)
+	for i, c := range cs {
+		if _, err := x.r.ReadAt(b[int64(i)*cs64:int64(i+1)*cs64], x.clusterOffset(c)); err != nil {
+			return nil, fmt.Errorf("reading directory: %v", err)
+		}
+	}
+	offset := func(i int) uint64 {
+		return uint64(x.clusterOffset(cs[int64(i)/cs64]) + int64(i)%cs64)
+	}
+
+	var ents []fs.Dirent
+	for i := 0; i+entrySize <= len(b); i += entrySize {
+		t := b[i]
+		if t == entryEnd {
+			break
+		}
+		if t != entryFile {
+			continue
+		}
+		f, n, err := parseFile(b[i:])
+		if err != nil {
+			return nil, fmt.Errorf("entry at %#x: %v", offset(i), err)
+		}
+		ino := offset(i)
+		x.mu.Lock()
+		x.files[ino] = f
+		x.mu.Unlock()
+		ents = append(ents, fs.Dirent{Name: f.name, Ino: ino})
+		i += (n - 1) * entrySize
+	}
+	return ents, nil
+}
+
+// parseFile parses the directory entry set of a file at the start of b,
+// and returns the file and how many entries the set is.
+func parseFile(b []byte) (*file, int, error) {
+	le := binary.LittleEndian
+	n := 1 + int(b[1])
+	if n < 3 || n*entrySize > len(b) {
+		return nil, 0, fmt.Errorf("entry set of %d entries", n)
+	}
+	set := b[:n*entrySize]
+	if sum := setChecksum(set); sum != le.Uint16(set[2:]) {
+		return nil, 0, fmt.Errorf("entry set checksum %#04x, want %#04x", sum, le.Uint16(set[2:]))
+	}
+	s := set[entrySize:]
+	if s[0] != entryStream {
+		return nil, 0, fmt.Errorf("entry type %#02x after file, want stream extension", s[0])
+	}
+	f := &file{
+		attr:      le.Uint16(set[4:]),
+		mtime:     timestamp(le.Uint32(set[12:]), set[21], set[23]),
+		noChain:   s[1]&streamNoFATChain != 0,
+		validSize: int64(le.Uint64(s[8:])),
+		cluster:   le.Uint32(s[20:]),
+		size:      int64(le.Uint64(s[24:])),
+	}
+	if f.size < 0 || f.validSize < 0 {
+		return nil, 0, fmt.Errorf("bad size %d", f.size)
+	}
+	nameLen := int(s[3])
+	var name []uint16
+	for e := set[2*entrySize:]; len(name) < nameLen && len(e) >= entrySize; e = e[entrySize:] {
+		if e[0] != entryName {
+			return nil, 0, fmt.Errorf("entry type %#02x in name, want file name", e[0])
+		}
+		for j := 0; j < nameChars && len(name) < nameLen; j++ {
+			name = append(name, le.Uint16(e[2+2*j:]))
+		}
+	}
+	if len(name) != nameLen || nameLen == 0 {
+		return nil, 0, fmt.Errorf("name of %d characters in %d entries", nameLen, n)
+	}
+	f.name = string(utf16.Decode(name))
+	return f, n, nil
+}
+
+// setChecksum returns the checksum of an entry set, which skips the
+// checksum field in the first entry.
+func setChecksum(set []byte) uint16 {
+	var sum uint16
+	for i, c := range set {
+		if i == 2 || i == 3 {
+			continue
+		}
+		sum = (sum<<15 | sum>>1) + uint16(c)
+	}
+	return sum
+}
+
+// timestamp decodes an exFAT timestamp: a DOS date and time, 10ms
+// increments and a UTC offset in 15 minute increments, if its top bit is
+// set. Times without an offset are taken as UTC.
+func timestamp(t uint32, cs byte, utc byte) time.Time {
+	if t == 0 {
+		return time.Time{}
+	}
+	loc := time.UTC
+	if utc&0x80 != 0 {
+		off := int(int8(utc<<1)>>1) * 15 * 60
+		loc = time.FixedZone("", off)
+	}
+	return time.Date(int(t>>25)+1980, time.Month(t>>21&0xf), int(t>>16&0x1f),
+		int(t>>11&0x1f), int(t>>5&0x3f), int(t&0x1f)*2+int(cs)/100, int(cs)%100*10*1e6, loc)
+}
@@ -0,0 +1,294 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package exfat
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"github.com/u-root/u-root/pkg/fs"
+)
+
+// The test image has 512 byte sectors and 4096 byte clusters.
+const (
+	testSectorShift  = 9
+	testClusterShift = 3
+	testClusterSize  = 1 << (testSectorShift + testClusterShift)
+	testFATSector    = 24
+	testHeapSector   = 32
+	testClusters     = 16
+)
+
+type image []byte
+
+func (im image) cluster(c uint32) []byte {
+	off := testHeapSector<<testSectorShift + int(c-firstCluster)*testClusterSize
+	return im[off : off+testClusterSize]
+}
+
+func (im image) setFAT(c, next uint32) {
+	binary.LittleEndian.PutUint32(im[testFATSector<<testSectorShift+int(c)*4:], next)
+}
+
+// entrySet returns the directory entries of a file.
+func entrySet(name string, attr uint16, cluster uint32, size, valid uint64, noChain bool) []byte {
+	u := utf16.Encode([]rune(name))
+	names := (len(u) + nameChars - 1) / nameChars
+	b := make([]byte, (2+names)*entrySize)
+	le := binary.LittleEndian
+	b[0] = entryFile
+	b[1] = byte(1 + names)
+	le.PutUint16(b[4:], attr)
+	// 2020-06-15 12:30:10.5, UTC+2.
+	le.PutUint32(b[12:], 40<<25|6<<21|15<<16|12<<11|30<<5|5)
+	b[21] = 50
+	b[23] = 0x80 | 8
+	s := b[entrySize:]
+	s[0] = entryStream
+	s[1] = 0x01
+	if noChain {
+		s[1] |= streamNoFATChain
+	}
+	s[3] = byte(len(u))
+	le.PutUint64(s[8:], valid)
+	le.PutUint32(s[20:], cluster)
+	le.PutUint64(s[24:], size)
+	for i, c := range u {
+		e := b[(2+i/nameChars)*entrySize:]
+		e[0] = entryName
+		le.PutUint16(e[2+2*(i%nameChars):], c)
+	}
+	le.PutUint16(b[2:], setChecksum(b))
+	return b
+}
+
+func pattern(n int, seed byte) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = seed + byte(i*7)
+	}
+	return b
+}
+
+// testImage returns an image of:
+//
+//	/
+//	/BOOT/
+//	/BOOT/vmlinuz: 6000 bytes in contiguous clusters
+//	/readme.txt: 9000 bytes, of which the first 8500 are written, in
+//	    fragmented clusters
+func testImage() (image, map[string][]byte) {
+	im := make(image, testHeapSector<<testSectorShift+testClusters*testClusterSize)
+	le := binary.LittleEndian
+	copy(im[3:], fsName)
+	le.PutUint32(im[80:], testFATSector)
+	le.PutUint32(im[84:], testHeapSector-testFATSector)
+	le.PutUint32(im[88:], testHeapSector)
+	le.PutUint32(im[92:], testClusters)
+	le.PutUint32(im[96:], 2)
+	im[108], im[109] = testSectorShift, testClusterShift
+	im[510], im[511] = 0x55, 0xaa
+
+	im.setFAT(0, 0xfffffff8)
+	im.setFAT(1, endOfChain)
+
+	// The root directory takes two clusters, 2 and 9, so that an entry
+	// set crosses into the second.
+	im.setFAT(2, 9)
+	im.setFAT(9, endOfChain)
+	root := append(append([]byte{}, im.cluster(2)...), im.cluster(9)...)
+	var p int
+	add := func(b []byte) {
+		copy(root[p:], b)
+		p += len(b)
+	}
+	// The allocation bitmap and a deleted file, which are skipped.
+	bitmap := make([]byte, entrySize)
+	bitmap[0] = 0x81
+	add(bitmap)
+	deleted := entrySet("gone", 0, 3, 10, 10, true)
+	deleted[0] &^= entryInUse
+	add(deleted)
+	add(entrySet("BOOT", attrDirectory, 3, testClusterSize, testClusterSize, true))
+	// Pad so that readme.txt's entries straddle the clusters.
+	for p < testClusterSize-entrySize {
+		e := make([]byte, entrySize)
+		e[0] = 0x81 &^ entryInUse
+		add(e)
+	}
+	add(entrySet("readme.txt", attrReadOnly, 5, 9000, 8500, false))
+	copy(im.cluster(2), root)
+	copy(im.cluster(9), root[testClusterSize:])
+
+	kernel := pattern(6000, 1)
+	boot := entrySet("vmlinuz", 0, 6, uint64(len(kernel)), uint64(len(kernel)), true)
+	copy(im.cluster(3), boot)
+	copy(im.cluster(6), kernel)
+	copy(im.cluster(7), kernel[testClusterSize:])
+
+	readme := pattern(9000, 2)
+	for i := 8500; i < len(readme); i++ {
+		readme[i] = 0
+	}
+	written := pattern(9000, 2)
+	im.setFAT(5, 11)
+	im.setFAT(11, 8)
+	im.setFAT(8, endOfChain)
+	copy(im.cluster(5), written)
+	copy(im.cluster(11), written[testClusterSize:])
+	// Beyond the valid size is junk, which must read as zeros.
+	copy(im.cluster(8), bytes.Repeat([]byte{0xff}, testClusterSize))
+	copy(im.cluster(8), written[2*testClusterSize:8500])
+
+	return im, map[string][]byte{
+		"/BOOT/vmlinuz": kernel,
+		"/readme.txt":   readme,
+	}
+}
+
+func TestRead(t *testing.T) {
+	im, files := testImage()
+	fsys, name, err := fs.New(bytes.NewReader(im))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "exfat" {
+		t.Errorf("fs.New found %q, want exfat", name)
+	}
+
+	var got []string
+	if err := fs.Walk(fsys, "/", func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		got = append(got, path)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/", "/BOOT", "/BOOT/vmlinuz", "/readme.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk = %q, want %q", got, want)
+	}
+
+	for name, want := range files {
+		got, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			t.Errorf("ReadFile(%q) = %v", name, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("ReadFile(%q) differs from what was written", name)
+		}
+	}
+
+	// Names are matched without regard to case.
+	if _, err := fs.ReadFile(fsys, "/boot/VMLINUZ"); err != nil {
+		t.Errorf("ReadFile(/boot/VMLINUZ) = %v, want nil", err)
+	}
+
+	fi, err := fsys.Stat("/readme.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Date(2020, 6, 15, 12, 30, 10, 500*1e6, time.FixedZone("", 2*60*60))
+	if fi.Size() != 9000 || fi.Mode() != 0555 || !fi.ModTime().Equal(mtime) {
+		t.Errorf("Stat(/readme.txt) = size %d, mode %v, mtime %v; want 9000, %v, %v", fi.Size(), fi.Mode(), fi.ModTime(), os.FileMode(0555), mtime)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	im, files := testImage()
+	fsys, err := New(bytes.NewReader(im))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "exfat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := fs.Extract(fsys, "/BOOT", dir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(dir + "/vmlinuz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, files["/BOOT/vmlinuz"]) {
+		t.Errorf("extracted vmlinuz differs from what was written")
+	}
+}
+
+func TestBad(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		corrupt func(im image)
+	}{
+		{"name", func(im image) { im[3] = 'X' }},
+		{"signature", func(im image) { im[510] = 0 }},
+		{"root cluster", func(im image) { binary.LittleEndian.PutUint32(im[96:], 100) }},
+	} {
+		im, _ := testImage()
+		tt.corrupt(im)
+		if _, err := New(bytes.NewReader(im)); err == nil {
+			t.Errorf("New with bad %s = nil, want error", tt.name)
+		}
+	}
+
+	// A broken checksum fails listing the directory.
+	im, _ := testImage()
+	im.cluster(3)[2]++
+	fsys, err := New(bytes.NewReader(im))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.ReadDir("/BOOT"); err == nil {
+		t.Errorf("ReadDir with bad checksum = nil, want error")
+	}
+
+	// A contiguous file of more clusters than there are, whose count
+	// does not fit in 32 bits, fails to open rather than reading past
+	// its clusters.
+	for _, size := range []uint64{(1<<32 + 2) * testClusterSize, 1<<63 - 1} {
+		im, _ = testImage()
+		copy(im.cluster(3), entrySet("vmlinuz", 0, 6, size, size, true))
+		if fsys, err = New(bytes.NewReader(im)); err != nil {
+			t.Fatal(err)
+		}
+		if f, err := fsys.Open("/BOOT/vmlinuz"); err == nil {
+			f.ReadAt(make([]byte, 10), 3*testClusterSize)
+			t.Errorf("Open of a %d byte file = nil, want error", size)
+		}
+	}
+
+	// As does a chain that loops.
+	im, _ = testImage()
+	im.setFAT(9, 2)
+	if fsys, err = New(bytes.NewReader(im)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.ReadDir("/"); err == nil {
+		t.Errorf("ReadDir of looping directory = nil, want error")
+	}
+}
+
+func TestReadPastClusters(t *testing.T) {
+	im, _ := testImage()
+	x, err := newFS(bytes.NewReader(im))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &fileReader{x: x, clusters: []uint32{6}, size: 3 * testClusterSize, valid: 3 * testClusterSize}
+	if _, err := r.ReadAt(make([]byte, 10), 2*testClusterSize); err == nil {
+		t.Errorf("ReadAt past the clusters = nil, want error")
+	}
+}
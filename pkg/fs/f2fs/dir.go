@@ -0,0 +1,95 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package f2fs
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/u-root/u-root/pkg/fs"
+)
+
+// Dentry block layout, from struct f2fs_dentry_block.
+const (
+	dentrySize = 11
+	slotLen    = 8
+
+	dentriesPerBlock  = 214
+	dentryBitmapSize  = (dentriesPerBlock + 7) / 8
+	dentryBlockOffset = dentryBitmapSize + 3
+	nameBlockOffset   = dentryBlockOffset + dentriesPerBlock*dentrySize
+)
+
+// ReadDir implements fs.Tree.
+func (x *FS) ReadDir(ino uint64) ([]fs.Dirent, error) {
+	in, err := x.inode(uint32(ino))
+	if err != nil {
+		return nil, err
+	}
+	if !in.isDir() {
+		return nil, fmt.Errorf("inode %d is not a directory", ino)
+	}
+	if in.inline&inlineDentry != 0 {
+		// An inline directory is laid out as a dentry block is, but with
+		// as many slots as fit.
+		b := in.inlineData
+		n := len(b) * 8 / ((dentrySize+slotLen)*8 + 1)
+		bitmap := (n + 7) / 8
+		dentries := len(b) - (dentrySize+slotLen)*n
+		return appendDentries(nil, b[:bitmap], b[dentries:], b[dentries+n*dentrySize:], n)
+	}
+
+	m, err := x.blockMap(in)
+	if err != nil {
+		return nil, err
+	}
+	var ents []fs.Dirent
+	for i, n := int64(0), (in.size+blockSize-1)/blockSize; i < n; {
+		a, skip, err := m.lookup(i)
+		if err != nil {
+			return nil, err
+		}
+		i += skip
+		if a == nullAddr {
+			continue
+		}
+		b, err := x.readBlock(a)
+		if err != nil {
+			return nil, fmt.Errorf("directory %d: %v", ino, err)
+		}
+		ents, err = appendDentries(ents, b[:dentryBitmapSize], b[dentryBlockOffset:], b[nameBlockOffset:], dentriesPerBlock)
+		if err != nil {
+			return nil, fmt.Errorf("directory %d block %#x: %v", ino, a, err)
+		}
+	}
+	return ents, nil
+}
+
+// appendDentries appends the entries of a dentry block, or of an inline
+// directory, of n slots, to ents. A name longer than a slot takes the slots
+// after it too.
+func appendDentries(ents []fs.Dirent, bitmap, dentries, names []byte, n int) ([]fs.Dirent, error) {
+	le := binary.LittleEndian
+	for i := 0; i < n; {
+		// The bitmap is little endian, unlike the NAT bitmap.
+		if bitmap[i/8]&(1<<(i%8)) == 0 {
+			i++
+			continue
+		}
+		d := dentries[i*dentrySize:]
+		ino := le.Uint32(d[4:])
+		nameLen := int(le.Uint16(d[8:]))
+		slots := (nameLen + slotLen - 1) / slotLen
+		if nameLen == 0 || i+slots > n {
+			return nil, fmt.Errorf("dentry %d: name of %d bytes", i, nameLen)
+		}
+		name := string(names[i*slotLen : i*slotLen+nameLen])
+		if name != "." && name != ".." {
+			ents = append(ents, fs.Dirent{Name: name, Ino: uint64(ino)})
+		}
+		i += slots
+	}
+	return ents, nil
+}
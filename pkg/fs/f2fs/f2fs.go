@@ -0,0 +1,601 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package f2fs reads F2FS file systems, as on the flash storage of many
+// embedded devices and phones.
+//
+// It reads the last valid checkpoint and does not roll forward fsync'ed
+// data written after it, which is what a read-only mount does too.
+// Compressed files are not supported.
+package f2fs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"time"
+
+	"github.com/u-root/u-root/pkg/fs"
+)
+
+func init() {
+	fs.Register("f2fs", New)
+}
+
+// Superblock and checkpoint magic, offsets and flags, from
+// include/linux/f2fs_fs.h.
+const (
+	sbMagic  = 0xf2f52010
+	sbOffset = 1024
+
+	blockSize = 4096
+	blockLog  = 12
+
+	featureExtraAttr           = 0x0008
+	featureFlexibleInlineXattr = 0x0040
+
+	cpUmount         = 0x0001
+	cpCompactSum     = 0x0004
+	cpFastboot       = 0x0020
+	cpLargeNATBitmap = 0x0400
+
+	// cpBitmapOffset is where the SIT and NAT version bitmaps are in a
+	// checkpoint, unless they do not fit.
+	cpBitmapOffset = 192
+
+	// The NAT journal of a compact summary, and of the hot data summary
+	// block, from struct f2fs_summary_block.
+	sumJournalOffset = 3584
+	natJournalSize   = 13
+)
+
+// Inode fields, from struct f2fs_inode.
+const (
+	inodeAddrs   = 923
+	nodeAddrs    = 1018
+	nidOffset    = 360 + inodeAddrs*4
+	nodeNids     = 5
+	inlineXattrs = 50
+
+	inlineXattr  = 0x01
+	inlineData   = 0x02
+	inlineDentry = 0x04
+	extraAttr    = 0x20
+
+	flagCompressed = 0x04
+
+	nullAddr       = 0
+	newAddr        = 0xffffffff
+	compressedAddr = 0xfffffffe
+
+	natEntrySize     = 9
+	natEntriesPerBlk = blockSize / natEntrySize
+)
+
+// FS is an F2FS file system.
+type FS struct {
+	r io.ReaderAt
+
+	rootIno      uint32
+	features     uint32
+	natBlkAddr   uint32
+	blocksPerSeg uint32
+	natBitmap    []byte
+
+	// natJournal holds NAT entries newer than those in the NAT blocks.
+	natJournal map[uint32]uint32
+}
+
+// New reads the F2FS file system on r.
+func New(r io.ReaderAt) (fs.FS, error) {
+	x, err := newFS(r)
+	if err != nil {
+		return nil, err
+	}
+	return fs.NewFS(x), nil
+}
+
+func newFS(r io.ReaderAt) (*FS, error) {
+	// There is a second superblock in the next block, should the first be
+	// bad.
+	var sb []byte
+	var err error
+	for _, off := range []int64{sbOffset, blockSize + sbOffset} {
+		sb = make([]byte, 3072)
+		if _, err = r.ReadAt(sb, off); err != nil {
+			err = fmt.Errorf("reading superblock: %v", err)
+			continue
+		}
+		if err = checkSuperblock(sb); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	x := &FS{
+		r:            r,
+		blocksPerSeg: 1 << le.Uint32(sb[20:]),
+		natBlkAddr:   le.Uint32(sb[84:]),
+		rootIno:      le.Uint32(sb[96:]),
+		features:     le.Uint32(sb[2180:]),
+		natJournal:   map[uint32]uint32{},
+	}
+	if err := x.readCheckpoint(le.Uint32(sb[76:]), le.Uint32(sb[1664:])); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+func checkSuperblock(sb []byte) error {
+	le := binary.LittleEndian
+	if m := le.Uint32(sb); m != sbMagic {
+		return fmt.Errorf("bad superblock magic %#08x", m)
+	}
+	if l := le.Uint32(sb[16:]); l != blockLog {
+		return fmt.Errorf("unsupported block size %d", 1<<l)
+	}
+	if l := le.Uint32(sb[20:]); l > 16 {
+		return fmt.Errorf("bad segment size of %d blocks", 1<<l)
+	}
+	return nil
+}
+
+// crc returns the checksum of b as F2FS computes it: Linux's crc32_le with
+// the superblock magic as seed, and no final inversion.
+func crc(b []byte) uint32 {
+	return ^crc32.Update(^uint32(sbMagic), crc32.IEEETable, b)
+}
+
+// checkpoint reads and checks the checkpoint pack at block addr.
+func (x *FS) checkpoint(addr uint32) ([]byte, uint64, error) {
+	cp, err := x.readBlock(addr)
+	if err != nil {
+		return nil, 0, err
+	}
+	le := binary.LittleEndian
+	off := le.Uint32(cp[164:])
+	if off < cpBitmapOffset || off > blockSize-4 {
+		return nil, 0, fmt.Errorf("checkpoint at %#x: bad checksum offset %d", addr, off)
+	}
+	// The checksum covers the block but for itself, which is usually at
+	// the end.
+	sum := crc(cp[:off])
+	if off < blockSize-4 {
+		sum = ^crc32.Update(^sum, crc32.IEEETable, cp[off+4:])
+	}
+	if want := le.Uint32(cp[off:]); sum != want {
+		return nil, 0, fmt.Errorf("checkpoint at %#x: checksum %#08x, want %#08x", addr, sum, want)
+	}
+	ver := le.Uint64(cp)
+	// The pack ends with a copy of the first block, which says whether
+	// all of it was written.
+	total := le.Uint32(cp[136:])
+	if total < 2 || total > x.blocksPerSeg {
+		return nil, 0, fmt.Errorf("checkpoint at %#x: pack of %d blocks", addr, total)
+	}
+	last, err := x.readBlock(addr + total - 1)
+	if err != nil {
+		return nil, 0, err
+	}
+	if v := le.Uint64(last); v != ver {
+		return nil, 0, fmt.Errorf("checkpoint at %#x: version %d at end, want %d", addr, v, ver)
+	}
+	return cp, ver, nil
+}
+
+// readCheckpoint reads the newer of the two checkpoints at cpAddr, and its
+// NAT bitmap and journal.
+func (x *FS) readCheckpoint(cpAddr, payload uint32) error {
+	var cp []byte
+	var start uint32
+	var ver uint64
+	var errs []error
+	for _, addr := range []uint32{cpAddr, cpAddr + x.blocksPerSeg} {
+		b, v, err := x.checkpoint(addr)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if cp == nil || v > ver {
+			cp, start, ver = b, addr, v
+		}
+	}
+	if cp == nil {
+		return fmt.Errorf("no valid checkpoint: %v", errs)
+	}
+
+	le := binary.LittleEndian
+	flags := le.Uint32(cp[132:])
+	sitSize, natSize := le.Uint32(cp[156:]), le.Uint32(cp[160:])
+	var bitmap int
+	switch {
+	case flags&cpLargeNATBitmap != 0:
+		bitmap = cpBitmapOffset + 4 + int(sitSize)
+	case payload > 0:
+		bitmap = cpBitmapOffset
+	default:
+		bitmap = cpBitmapOffset + int(sitSize)
+	}
+	if bitmap+int(natSize) > len(cp) {
+		return fmt.Errorf("NAT bitmap of %d bytes at %d", natSize, bitmap)
+	}
+	x.natBitmap = cp[bitmap : bitmap+int(natSize)]
+
+	// The NAT journal is in the compact summaries, or in the hot data
+	// summary block.
+	total := le.Uint32(cp[136:])
+	var sum []byte
+	var err error
+	switch {
+	case flags&cpCompactSum != 0:
+		if sum, err = x.readBlock(start + le.Uint32(cp[140:])); err != nil {
+			return err
+		}
+	case flags&(cpUmount|cpFastboot) != 0:
+		if sum, err = x.readBlock(start + total - 7); err != nil {
+			return err
+		}
+		sum = sum[sumJournalOffset:]
+	default:
+		if sum, err = x.readBlock(start + total - 4); err != nil {
+			return err
+		}
+		sum = sum[sumJournalOffset:]
+	}
+	n := int(le.Uint16(sum))
+	if 2+n*natJournalSize > len(sum) {
+		return fmt.Errorf("NAT journal of %d entries", n)
+	}
+	for i := 0; i < n; i++ {
+		e := sum[2+i*natJournalSize:]
+		x.natJournal[le.Uint32(e)] = le.Uint32(e[4+5:])
+	}
+	return nil
+}
+
+func (x *FS) readBlock(addr uint32) ([]byte, error) {
+	b := make([]byte, blockSize)
+	if _, err := x.r.ReadAt(b, int64(addr)<<blockLog); err != nil {
+		return nil, fmt.Errorf("reading block %#x: %v", addr, err)
+	}
+	return b, nil
+}
+
+// nodeAddr returns the block address of node nid, from the node address
+// table. Each NAT block has two copies, one in each of a pair of segments,
+// and the bitmap says which is current.
+func (x *FS) nodeAddr(nid uint32) (uint32, error) {
+	if a, ok := x.natJournal[nid]; ok {
+		return a, nil
+	}
+	blk := nid / natEntriesPerBlk
+	if int(blk/8) >= len(x.natBitmap) {
+		return 0, fmt.Errorf("node %d is beyond the NAT", nid)
+	}
+	addr := x.natBlkAddr + blk<<1 - blk&(x.blocksPerSeg-1)
+	if x.natBitmap[blk/8]&(0x80>>(blk%8)) != 0 {
+		addr += x.blocksPerSeg
+	}
+	b, err := x.readBlock(addr)
+	if err != nil {
+		return 0, err
+	}
+	e := b[(nid%natEntriesPerBlk)*natEntrySize:]
+	return binary.LittleEndian.Uint32(e[5:]), nil
+}
+
+// node reads node nid and checks that its footer says it is.
+func (x *FS) node(nid uint32) ([]byte, error) {
+	addr, err := x.nodeAddr(nid)
+	if err != nil {
+		return nil, err
+	}
+	if addr == nullAddr || addr == newAddr {
+		return nil, fmt.Errorf("node %d has no block", nid)
+	}
+	b, err := x.readBlock(addr)
+	if err != nil {
+		return nil, err
+	}
+	// struct node_footer: nid, ino, flag, checkpoint version and next
+	// block.
+	if n := binary.LittleEndian.Uint32(b[blockSize-24:]); n != nid {
+		return nil, fmt.Errorf("node %d: block %#x is node %d", nid, addr, n)
+	}
+	return b, nil
+}
+
+// inode is what this package uses of an inode.
+type inode struct {
+	ino      uint32
+	mode     uint16
+	inline   byte
+	uid, gid uint32
+	nlink    uint32
+	size     int64
+	mtime    time.Time
+	flags    uint32
+
+	// addrs are the direct block addresses in the inode, and nids its
+	// direct, indirect and double indirect nodes.
+	addrs []uint32
+	nids  [nodeNids]uint32
+
+	// inlineData is where inline data or dentries are.
+	inlineData []byte
+}
+
+func (in *inode) isDir() bool     { return uint32(in.mode)&0170000 == 0040000 }
+func (in *inode) isSymlink() bool { return uint32(in.mode)&0170000 == 0120000 }
+
+func (x *FS) inode(ino uint32) (*inode, error) {
+	b, err := x.node(ino)
+	if err != nil {
+		return nil, err
+	}
+	le := binary.LittleEndian
+	in := &inode{
+		ino:    ino,
+		mode:   le.Uint16(b[0:]),
+		inline: b[3],
+		uid:    le.Uint32(b[4:]),
+		gid:    le.Uint32(b[8:]),
+		nlink:  le.Uint32(b[12:]),
+		size:   int64(le.Uint64(b[16:])),
+		mtime:  time.Unix(int64(le.Uint64(b[48:])), int64(le.Uint32(b[64:]))),
+		flags:  le.Uint32(b[80:]),
+	}
+	if in.size < 0 {
+		return nil, fmt.Errorf("inode %d: bad size %d", ino, in.size)
+	}
+	// With extra attributes, the first words of i_addr are taken by
+	// them, i_extra_isize bytes.
+	extra := 0
+	if x.features&featureExtraAttr != 0 && in.inline&extraAttr != 0 {
+		extra = int(le.Uint16(b[360:])) / 4
+		if extra > inodeAddrs {
+			return nil, fmt.Errorf("inode %d: %d bytes of extra attributes", ino, extra*4)
+		}
+	}
+	// So are the last words by inline extended attributes.
+	xattr := 0
+	if in.inline&inlineXattr != 0 {
+		xattr = inlineXattrs
+		if x.features&featureFlexibleInlineXattr != 0 {
+			xattr = int(le.Uint16(b[362:]))
+		}
+	}
+	n := inodeAddrs - extra - xattr
+	if n < 1 {
+		return nil, fmt.Errorf("inode %d: %d extra and %d extended attribute words", ino, extra, xattr)
+	}
+	for i := 0; i < n; i++ {
+		in.addrs = append(in.addrs, le.Uint32(b[360+4*(extra+i):]))
+	}
+	for i := range in.nids {
+		in.nids[i] = le.Uint32(b[nidOffset+4*i:])
+	}
+	// Inline data starts a word in, and leaves the inline extended
+	// attributes room.
+	in.inlineData = b[360+4*(extra+1) : 360+4*(extra+n)]
+	return in, nil
+}
+
+// maxBlocks returns how many blocks the addresses in in and its two direct,
+// two indirect and double indirect nodes map.
+func maxBlocks(in *inode) int64 {
+	return int64(len(in.addrs)) + 2*nodeAddrs + 2*nodeAddrs*nodeAddrs + nodeAddrs*nodeAddrs*nodeAddrs
+}
+
+// blockMap looks up the addresses of the blocks of an inode, walking its
+// nodes for each block.
+type blockMap struct {
+	x  *FS
+	in *inode
+
+	// nodes are the nodes last read at each depth of a walk.
+	nodes [3]struct {
+		nid uint32
+		b   []byte
+	}
+}
+
+// blockMap returns a blockMap of in, which must not be compressed or
+// bigger than its nodes map.
+func (x *FS) blockMap(in *inode) (*blockMap, error) {
+	if in.flags&flagCompressed != 0 {
+		return nil, fmt.Errorf("inode %d is compressed, which is not supported", in.ino)
+	}
+	if in.size > maxBlocks(in)*blockSize {
+		return nil, fmt.Errorf("inode %d: size %d is more than its nodes map", in.ino, in.size)
+	}
+	return &blockMap{x: x, in: in}, nil
+}
+
+func (m *blockMap) node(depth int, nid uint32) ([]byte, error) {
+	c := &m.nodes[depth]
+	if c.b == nil || c.nid != nid {
+		b, err := m.x.node(nid)
+		if err != nil {
+			return nil, err
+		}
+		c.nid, c.b = nid, b
+	}
+	return c.b, nil
+}
+
+// lookup returns the address of block i, nullAddr for a hole, and how many
+// blocks from i on that is for: more than one only for the blocks of a
+// missing node.
+func (m *blockMap) lookup(i int64) (uint32, int64, error) {
+	if i < int64(len(m.in.addrs)) {
+		a, err := m.addr(m.in.addrs[i])
+		return a, 1, err
+	}
+	i -= int64(len(m.in.addrs))
+	// Two direct nodes, two indirect and a double indirect.
+	levels := [nodeNids]int{0, 0, 1, 1, 2}
+	for k, nid := range m.in.nids {
+		span := int64(nodeAddrs)
+		for j := 0; j < levels[k]; j++ {
+			span *= nodeAddrs
+		}
+		if i >= span {
+			i -= span
+			continue
+		}
+		for depth := 0; ; depth++ {
+			if nid == 0 {
+				return nullAddr, span - i, nil
+			}
+			b, err := m.node(depth, nid)
+			if err != nil {
+				return 0, 0, fmt.Errorf("inode %d: %v", m.in.ino, err)
+			}
+			span /= nodeAddrs
+			w := binary.LittleEndian.Uint32(b[4*(i/span):])
+			i %= span
+			if span == 1 {
+				a, err := m.addr(w)
+				return a, 1, err
+			}
+			nid = w
+		}
+	}
+	return 0, 0, fmt.Errorf("inode %d has no block %d", m.in.ino, i)
+}
+
+// addr returns block address a, as nullAddr for a hole.
+func (m *blockMap) addr(a uint32) (uint32, error) {
+	switch a {
+	case newAddr:
+		return nullAddr, nil
+	case compressedAddr:
+		return 0, fmt.Errorf("inode %d has compressed blocks, which are not supported", m.in.ino)
+	}
+	return a, nil
+}
+
+// fileReader reads size bytes of a file from its blocks. Holes read as
+// zeros.
+type fileReader struct {
+	m    *blockMap
+	size int64
+}
+
+func (f *fileReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	var err error
+	if int64(len(p)) > f.size-off {
+		p = p[:f.size-off]
+		err = io.EOF
+	}
+	for n := 0; n < len(p); {
+		pos := off + int64(n)
+		chunk := p[n:]
+		if rest := blockSize - pos%blockSize; int64(len(chunk)) > rest {
+			chunk = chunk[:rest]
+		}
+		a, _, lerr := f.m.lookup(pos / blockSize)
+		if lerr != nil {
+			return n, lerr
+		}
+		n += len(chunk)
+		if a == nullAddr {
+			for j := range chunk {
+				chunk[j] = 0
+			}
+			continue
+		}
+		if _, rerr := f.m.x.r.ReadAt(chunk, int64(a)<<blockLog+pos%blockSize); rerr != nil {
+			return n - len(chunk), rerr
+		}
+	}
+	return len(p), err
+}
+
+// reader returns a reader of in's contents.
+func (x *FS) reader(in *inode) (io.ReaderAt, error) {
+	if in.inline&inlineData != 0 {
+		if in.size > int64(len(in.inlineData)) {
+			return nil, fmt.Errorf("inode %d: %d bytes of inline data", in.ino, in.size)
+		}
+		return bytes.NewReader(in.inlineData[:in.size]), nil
+	}
+	m, err := x.blockMap(in)
+	if err != nil {
+		return nil, err
+	}
+	return &fileReader{m: m, size: in.size}, nil
+}
+
+// Root implements fs.Tree.
+func (x *FS) Root() uint64 {
+	return uint64(x.rootIno)
+}
+
+// Stat implements fs.Tree.
+func (x *FS) Stat(ino uint64, name string) (os.FileInfo, error) {
+	in, err := x.inode(uint32(ino))
+	if err != nil {
+		return nil, err
+	}
+	return &fs.Info{
+		FileName: name,
+		FileSize: in.size,
+		FileMode: fs.UnixMode(uint32(in.mode)),
+		MTime:    in.mtime,
+		Ino:      ino,
+		UID:      in.uid,
+		GID:      in.gid,
+		Nlink:    in.nlink,
+	}, nil
+}
+
+// Open implements fs.Tree.
+func (x *FS) Open(ino uint64) (io.ReaderAt, int64, error) {
+	in, err := x.inode(uint32(ino))
+	if err != nil {
+		return nil, 0, err
+	}
+	r, err := x.reader(in)
+	if err != nil {
+		return nil, 0, err
+	}
+	return r, in.size, nil
+}
+
+// maxPathLen bounds symlink targets, as PATH_MAX does.
+const maxPathLen = 4096
+
+// Readlink implements fs.Tree. Symlink targets are stored as file
+// contents.
+func (x *FS) Readlink(ino uint64) (string, error) {
+	in, err := x.inode(uint32(ino))
+	if err != nil {
+		return "", err
+	}
+	if !in.isSymlink() {
+		return "", fmt.Errorf("inode %d is not a symlink", ino)
+	}
+	if in.size > maxPathLen {
+		return "", fmt.Errorf("inode %d: symlink of %d bytes", ino, in.size)
+	}
+	r, err := x.reader(in)
+	if err != nil {
+		return "", err
+	}
+	b := make([]byte, in.size)
+	if _, err := r.ReadAt(b, 0); err != nil && err != io.EOF {
+		return "", err
+	}
+	return string(b), nil
+}
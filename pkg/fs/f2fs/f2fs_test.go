@@ -0,0 +1,315 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package f2fs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/u-root/u-root/pkg/fs"
+)
+
+// The test image has 4 block segments, so its checkpoint packs are at
+// blocks 4 and 8, and the two copies of its NAT at 12 and 16. Its main area
+// starts at block 20.
+const (
+	testBlocksPerSegLog = 2
+	testCPAddr          = 4
+	testNATAddr         = 12
+	testRootIno         = 3
+)
+
+type image []byte
+
+func (im image) block(addr uint32) []byte {
+	return im[addr*blockSize : (addr+1)*blockSize]
+}
+
+var le = binary.LittleEndian
+
+// checkpoint writes a checkpoint pack with a compact summary whose NAT
+// journal has nat.
+func (im image) checkpoint(addr uint32, ver uint64, nat map[uint32]uint32) {
+	cp := im.block(addr)
+	le.PutUint64(cp, ver)
+	le.PutUint32(cp[132:], cpUmount|cpCompactSum)
+	le.PutUint32(cp[136:], 3)
+	le.PutUint32(cp[140:], 1)
+	le.PutUint32(cp[156:], 4)
+	le.PutUint32(cp[160:], 1)
+	// NAT block 0 is in the second copy.
+	cp[cpBitmapOffset+4] = 0x80
+	le.PutUint32(cp[164:], blockSize-4)
+	le.PutUint32(cp[blockSize-4:], crc(cp[:blockSize-4]))
+
+	sum := im.block(addr + 1)
+	le.PutUint16(sum, uint16(len(nat)))
+	i := 0
+	for nid, a := range nat {
+		e := sum[2+i*natJournalSize:]
+		le.PutUint32(e, nid)
+		le.PutUint32(e[4+1:], nid)
+		le.PutUint32(e[4+5:], a)
+		i++
+	}
+	copy(im.block(addr+2), cp)
+}
+
+// node writes the footer of node nid at addr, and its NAT entry.
+func (im image) node(nid, addr uint32) []byte {
+	n := im.block(addr)
+	le.PutUint32(n[blockSize-24:], nid)
+	le.PutUint32(n[blockSize-20:], nid)
+	nat := im.block(testNATAddr + 1<<testBlocksPerSegLog)
+	le.PutUint32(nat[nid*natEntrySize+5:], addr)
+	return n
+}
+
+func (im image) inode(ino, addr uint32, mode uint16, size int) []byte {
+	n := im.node(ino, addr)
+	le.PutUint16(n, mode)
+	le.PutUint32(n[12:], 1)
+	le.PutUint64(n[16:], uint64(size))
+	le.PutUint64(n[48:], 1592224210)
+	le.PutUint32(n[64:], 5e8)
+	return n
+}
+
+type dentry struct {
+	name string
+	ino  uint32
+}
+
+// dentries writes ds in a dentry block layout of n slots in b.
+func dentries(b []byte, n int, ds []dentry) {
+	bitmap := b
+	d := b[len(b)-(dentrySize+slotLen)*n:]
+	names := d[n*dentrySize:]
+	slot := 0
+	for _, e := range ds {
+		bitmap[slot/8] |= 1 << (slot % 8)
+		le.PutUint32(d[slot*dentrySize+4:], e.ino)
+		le.PutUint16(d[slot*dentrySize+8:], uint16(len(e.name)))
+		copy(names[slot*slotLen:], e.name)
+		slot += (len(e.name) + slotLen - 1) / slotLen
+	}
+}
+
+func pattern(n int, seed byte) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = seed + byte(i*7)
+	}
+	return b
+}
+
+const longName = "a-rather-long-file-name.txt"
+
+// testImage returns an image of:
+//
+//	/
+//	/boot/: an inline directory
+//	/boot/vmlinuz: inline data
+//	/a-rather-long-file-name.txt: with holes, through a direct node
+//	/link: to boot/vmlinuz
+func testImage() (image, map[string][]byte) {
+	im := make(image, 32*blockSize)
+	sb := im[sbOffset:]
+	le.PutUint32(sb, sbMagic)
+	le.PutUint32(sb[16:], blockLog)
+	le.PutUint32(sb[20:], testBlocksPerSegLog)
+	le.PutUint32(sb[76:], testCPAddr)
+	le.PutUint32(sb[84:], testNATAddr)
+	le.PutUint32(sb[96:], testRootIno)
+	le.PutUint32(sb[2180:], featureExtraAttr)
+
+	// The older checkpoint has the root inode nowhere.
+	im.checkpoint(testCPAddr, 1, map[uint32]uint32{testRootIno: 0})
+	im.checkpoint(testCPAddr+1<<testBlocksPerSegLog, 2, map[uint32]uint32{testRootIno: 20})
+	// The first copy of the NAT is stale.
+	for nid := uint32(0); nid < 10; nid++ {
+		le.PutUint32(im.block(testNATAddr)[nid*natEntrySize+5:], 31)
+	}
+
+	// The root's NAT entry is only in the journal.
+	root := im.inode(testRootIno, 20, 0040755, blockSize)
+	le.PutUint32(im.block(testNATAddr + 1<<testBlocksPerSegLog)[testRootIno*natEntrySize+5:], 0)
+	le.PutUint32(root[360:], 21)
+	dentries(im.block(21)[:nameBlockOffset+dentriesPerBlock*slotLen], dentriesPerBlock, []dentry{
+		{".", testRootIno}, {"..", testRootIno}, {"boot", 4}, {longName, 5}, {"link", 6},
+	})
+
+	boot := im.inode(4, 22, 0040755, 3688)
+	boot[3] = inlineDentry
+	dentries(boot[364:364+3688], 3688*8/153, []dentry{{".", 4}, {"..", testRootIno}, {"vmlinuz", 7}})
+
+	kernel := []byte("not really a kernel")
+	vmlinuz := im.inode(7, 30, 0100644, len(kernel))
+	vmlinuz[3] = inlineData
+	copy(vmlinuz[364:], kernel)
+
+	target := "boot/vmlinuz"
+	link := im.inode(6, 29, 0120777, len(target))
+	link[3] = inlineData
+	copy(link[364:], target)
+
+	// Extra attributes leave the inode room for three block addresses,
+	// so the rest are in direct node 8.
+	size := 5*blockSize + 100
+	long := im.inode(5, 23, 0100600, size)
+	long[3] = extraAttr
+	le.PutUint16(long[360:], 920*4)
+	le.PutUint32(long[360+920*4:], 24)
+	le.PutUint32(long[360+922*4:], 25)
+	le.PutUint32(long[nidOffset:], 8)
+	direct := im.node(8, 26)
+	le.PutUint32(direct, 27)
+	le.PutUint32(direct[4:], newAddr)
+	le.PutUint32(direct[8:], 28)
+	data := pattern(size, 3)
+	for _, b := range []struct {
+		i    int
+		addr uint32
+	}{{0, 24}, {2, 25}, {3, 27}, {5, 28}} {
+		copy(im.block(b.addr), data[b.i*blockSize:])
+	}
+	for _, hole := range []int{1, 4} {
+		for i := hole * blockSize; i < (hole+1)*blockSize; i++ {
+			data[i] = 0
+		}
+	}
+
+	return im, map[string][]byte{
+		"/boot/vmlinuz": kernel,
+		"/link":         kernel,
+		"/" + longName:  data,
+	}
+}
+
+func TestRead(t *testing.T) {
+	im, files := testImage()
+	fsys, name, err := fs.New(bytes.NewReader(im))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "f2fs" {
+		t.Errorf("fs.New found %q, want f2fs", name)
+	}
+
+	var got []string
+	if err := fs.Walk(fsys, "/", func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		got = append(got, path)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/", "/" + longName, "/boot", "/boot/vmlinuz", "/link"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk = %q, want %q", got, want)
+	}
+
+	for name, want := range files {
+		got, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			t.Errorf("ReadFile(%q) = %v", name, err)
+			continue
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("ReadFile(%q) differs from what was written", name)
+		}
+	}
+
+	fi, err := fsys.Lstat("/link")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Unix(1592224210, 5e8)
+	if fi.Mode() != os.ModeSymlink|0777 || !fi.ModTime().Equal(mtime) {
+		t.Errorf("Lstat(/link) = mode %v, mtime %v; want %v, %v", fi.Mode(), fi.ModTime(), os.ModeSymlink|0777, mtime)
+	}
+}
+
+func TestBad(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		corrupt func(im image)
+	}{
+		{"magic", func(im image) { im[sbOffset]++ }},
+		{"block size", func(im image) { im[sbOffset+16]++ }},
+		{"checkpoints", func(im image) {
+			im.block(testCPAddr)[100]++
+			im.block(testCPAddr + 1<<testBlocksPerSegLog)[100]++
+		}},
+	} {
+		im, _ := testImage()
+		tt.corrupt(im)
+		if _, err := New(bytes.NewReader(im)); err == nil {
+			t.Errorf("New with bad %s = nil, want error", tt.name)
+		}
+	}
+
+	// With the newer checkpoint torn, the older one is read, which has
+	// no root.
+	im, _ := testImage()
+	le.PutUint64(im.block(testCPAddr+1<<testBlocksPerSegLog+2), 3)
+	fsys, err := New(bytes.NewReader(im))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.ReadDir("/"); err == nil {
+		t.Errorf("ReadDir(/) with the old checkpoint = nil, want error")
+	}
+}
+
+func TestCorruptSize(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		size    int64
+		wantErr bool
+	}{
+		// All that the inode and its nodes map, most of it in missing
+		// nodes, which must not take long.
+		{"sparse", (3 + 2*nodeAddrs + 2*nodeAddrs*nodeAddrs + nodeAddrs*nodeAddrs*nodeAddrs) * blockSize, false},
+		{"more than is mapped", (4 + 2*nodeAddrs + 2*nodeAddrs*nodeAddrs + nodeAddrs*nodeAddrs*nodeAddrs) * blockSize, true},
+		{"huge", 1<<63 - 1, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			im, files := testImage()
+			le.PutUint64(im.block(23)[16:], uint64(tt.size))
+			fsys, err := New(bytes.NewReader(im))
+			if err != nil {
+				t.Fatal(err)
+			}
+			f, err := fsys.Open("/" + longName)
+			if tt.wantErr {
+				if err == nil {
+					f.Close()
+					t.Errorf("Open with size %d = nil, want error", tt.size)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			want := files["/"+longName]
+			got := make([]byte, len(want))
+			if _, err := f.ReadAt(got, 0); err != nil || !bytes.Equal(got, want) {
+				t.Errorf("ReadAt(0) = %v, or differs from what was written", err)
+			}
+			got = make([]byte, blockSize)
+			if _, err := f.ReadAt(got, tt.size-blockSize); err != nil || !bytes.Equal(got, make([]byte, blockSize)) {
+				t.Errorf("ReadAt(last block) = %v, or not a hole", err)
+			}
+		})
+	}
+}
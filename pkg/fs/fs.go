@@ -0,0 +1,485 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package fs reads file systems in Go, without mounting them.
+//
+// Mounting is not always possible: the kernel may have no driver for a file
+// system, or the environment may not allow mounts. The readers in fs's
+// subpackages read a file system from an io.ReaderAt, usually a block
+// device, and register themselves so that New finds the right one:
+//
+//	import _ "github.com/u-root/u-root/pkg/fs/xfs"
+//
+//	fsys, name, err := fs.New(dev)
+//	kernel, err := fs.ReadFile(fsys, "/boot/vmlinuz")
+//
+// Readers implement Tree, a file system as inodes, and NewFS turns that into
+// an FS, which works with path names and follows symlinks.
+package fs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FS is a read-only file system. Names are slash separated and relative to
+// the file system's root, whether or not they start with a slash.
+type FS interface {
+	// Open opens the named file for reading.
+	Open(name string) (File, error)
+
+	// Stat returns information about the named file.
+	Stat(name string) (os.FileInfo, error)
+
+	// Lstat is Stat, but does not follow a symlink at the end of name.
+	Lstat(name string) (os.FileInfo, error)
+
+	// ReadDir returns the entries of a directory, sorted by name and
+	// without . and ...
+	ReadDir(name string) ([]os.FileInfo, error)
+
+	// Readlink returns the target of a symlink.
+	Readlink(name string) (string, error)
+}
+
+// File is an open file of an FS.
+type File interface {
+	io.Reader
+	io.ReaderAt
+	io.Seeker
+	io.Closer
+	Stat() (os.FileInfo, error)
+}
+
+// Dirent is a directory entry.
+type Dirent struct {
+	Name string
+	Ino  uint64
+}
+
+// Tree is a file system as inodes, which is how most of them are laid out.
+type Tree interface {
+	// Root returns the inode of the root directory.
+	Root() uint64
+
+	// Stat returns information about inode ino, named name.
+	Stat(ino uint64, name string) (os.FileInfo, error)
+
+	// ReadDir returns the entries of directory ino, without . and ...
+	ReadDir(ino uint64) ([]Dirent, error)
+
+	// Readlink returns the target of symlink ino.
+	Readlink(ino uint64) (string, error)
+
+	// Open returns the contents of regular file ino, and its size.
+	Open(ino uint64) (io.ReaderAt, int64, error)
+}
+
+// CaseInsensitive is implemented by Trees whose names match regardless of
+// case, like FAT's. An exact match still wins over one that differs in case.
+type CaseInsensitive interface {
+	CaseInsensitive() bool
+}
+
+// Info is an os.FileInfo for readers to return. Sys returns the Info.
+type Info struct {
+	FileName string
+	FileSize int64
+	FileMode os.FileMode
+	MTime    time.Time
+
+	Ino      uint64
+	UID, GID uint32
+	Nlink    uint32
+}
+
+// Name implements os.FileInfo.
+func (i *Info) Name() string { return i.FileName }
+
+// Size implements os.FileInfo.
+func (i *Info) Size() int64 { return i.FileSize }
+
+// Mode implements os.FileInfo.
+func (i *Info) Mode() os.FileMode { return i.FileMode }
+
+// ModTime implements os.FileInfo.
+func (i *Info) ModTime() time.Time { return i.MTime }
+
+// IsDir implements os.FileInfo.
+func (i *Info) IsDir() bool { return i.FileMode.IsDir() }
+
+// Sys implements os.FileInfo.
+func (i *Info) Sys() interface{} { return i }
+
+// UnixMode converts a Unix st_mode to an os.FileMode.
+func UnixMode(m uint32) os.FileMode {
+	mode := os.FileMode(m & 0777)
+	switch m & syscall.S_IFMT {
+	case syscall.S_IFDIR:
+		mode |= os.ModeDir
+	case syscall.S_IFLNK:
+		mode |= os.ModeSymlink
+	case syscall.S_IFCHR:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case syscall.S_IFBLK:
+		mode |= os.ModeDevice
+	case syscall.S_IFIFO:
+		mode |= os.ModeNamedPipe
+	case syscall.S_IFSOCK:
+		mode |= os.ModeSocket
+	}
+	if m&syscall.S_ISUID != 0 {
+		mode |= os.ModeSetuid
+	}
+	if m&syscall.S_ISGID != 0 {
+		mode |= os.ModeSetgid
+	}
+	if m&syscall.S_ISVTX != 0 {
+		mode |= os.ModeSticky
+	}
+	return mode
+}
+
+// maxSymlinks is how many symlinks a lookup follows, as in Linux.
+const maxSymlinks = 40
+
+type treeFS struct {
+	t Tree
+}
+
+// NewFS returns an FS that reads t.
+func NewFS(t Tree) FS {
+	return &treeFS{t: t}
+}
+
+// lookup returns the inode and information of name, following a symlink at
+// the end if follow is set.
+func (f *treeFS) lookup(op, name string, follow bool) (uint64, os.FileInfo, error) {
+	root := f.t.Root()
+	fi, err := f.t.Stat(root, "/")
+	if err != nil {
+		return 0, nil, &os.PathError{Op: op, Path: name, Err: err}
+	}
+	ino := root
+	// The directories walked through, for "..".
+	dirs := []uint64{root}
+	elems := strings.Split(name, "/")
+	for links := 0; len(elems) > 0; {
+		e := elems[0]
+		elems = elems[1:]
+		switch e {
+		case "", ".":
+			continue
+		case "..":
+			if !fi.IsDir() {
+				return 0, nil, &os.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+			}
+			if len(dirs) > 1 {
+				dirs = dirs[:len(dirs)-1]
+			}
+			ino = dirs[len(dirs)-1]
+			if fi, err = f.t.Stat(ino, e); err != nil {
+				return 0, nil, &os.PathError{Op: op, Path: name, Err: err}
+			}
+			continue
+		}
+		if !fi.IsDir() {
+			return 0, nil, &os.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+		}
+		ents, err := f.t.ReadDir(dirs[len(dirs)-1])
+		if err != nil {
+			return 0, nil, &os.PathError{Op: op, Path: name, Err: err}
+		}
+		found := false
+		for _, d := range ents {
+			if d.Name == e {
+				ino, found = d.Ino, true
+				break
+			}
+		}
+		if ci, ok := f.t.(CaseInsensitive); !found && ok && ci.CaseInsensitive() {
+			for _, d := range ents {
+				if strings.EqualFold(d.Name, e) {
+					ino, found = d.Ino, true
+					break
+				}
+			}
+		}
+		if !found {
+			return 0, nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+		}
+		if fi, err = f.t.Stat(ino, e); err != nil {
+			return 0, nil, &os.PathError{Op: op, Path: name, Err: err}
+		}
+		if fi.Mode()&os.ModeSymlink != 0 && (follow || len(elems) > 0) {
+			if links++; links > maxSymlinks {
+				return 0, nil, &os.PathError{Op: op, Path: name, Err: syscall.ELOOP}
+			}
+			target, err := f.t.Readlink(ino)
+			if err != nil {
+				return 0, nil, &os.PathError{Op: op, Path: name, Err: err}
+			}
+			if strings.HasPrefix(target, "/") {
+				dirs = dirs[:1]
+			}
+			// Carry on from the directory the link is in.
+			ino = dirs[len(dirs)-1]
+			if fi, err = f.t.Stat(ino, e); err != nil {
+				return 0, nil, &os.PathError{Op: op, Path: name, Err: err}
+			}
+			elems = append(strings.Split(target, "/"), elems...)
+			continue
+		}
+		if fi.IsDir() {
+			dirs = append(dirs, ino)
+		}
+	}
+	// The name of the file is the last element of name, not of where
+	// links took the lookup.
+	if info, ok := fi.(*Info); ok {
+		c := *info
+		c.FileName = path.Base(path.Clean("/" + name))
+		fi = &c
+	}
+	return ino, fi, nil
+}
+
+func (f *treeFS) Stat(name string) (os.FileInfo, error) {
+	_, fi, err := f.lookup("stat", name, true)
+	return fi, err
+}
+
+func (f *treeFS) Lstat(name string) (os.FileInfo, error) {
+	_, fi, err := f.lookup("lstat", name, false)
+	return fi, err
+}
+
+func (f *treeFS) Readlink(name string) (string, error) {
+	ino, fi, err := f.lookup("readlink", name, false)
+	if err != nil {
+		return "", err
+	}
+	if fi.Mode()&os.ModeSymlink == 0 {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+	}
+	s, err := f.t.Readlink(ino)
+	if err != nil {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: err}
+	}
+	return s, nil
+}
+
+func (f *treeFS) ReadDir(name string) ([]os.FileInfo, error) {
+	ino, fi, err := f.lookup("readdir", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: syscall.ENOTDIR}
+	}
+	ents, err := f.t.ReadDir(ino)
+	if err != nil {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: err}
+	}
+	fis := make([]os.FileInfo, 0, len(ents))
+	seen := make(map[string]bool, len(ents))
+	for _, d := range ents {
+		// A corrupt or crafted directory must not name anything but
+		// its own entries, once each, or extracting it could write
+		// through a symlink it made.
+		if d.Name == "" || d.Name == "." || d.Name == ".." || strings.ContainsAny(d.Name, "/\x00") || seen[d.Name] {
+			return nil, &os.PathError{Op: "readdir", Path: name, Err: fmt.Errorf("bad directory entry %q", d.Name)}
+		}
+		seen[d.Name] = true
+		fi, err := f.t.Stat(d.Ino, d.Name)
+		if err != nil {
+			return nil, &os.PathError{Op: "readdir", Path: path.Join(name, d.Name), Err: err}
+		}
+		fis = append(fis, fi)
+	}
+	sort.Slice(fis, func(i, j int) bool { return fis[i].Name() < fis[j].Name() })
+	return fis, nil
+}
+
+func (f *treeFS) Open(name string) (File, error) {
+	ino, fi, err := f.lookup("open", name, true)
+	if err != nil {
+		return nil, err
+	}
+	if !fi.Mode().IsRegular() {
+		// Directories and devices have nothing to read.
+		return &file{SectionReader: io.NewSectionReader(eofReader{}, 0, 0), fi: fi}, nil
+	}
+	r, size, err := f.t.Open(ino)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: name, Err: err}
+	}
+	return &file{SectionReader: io.NewSectionReader(r, 0, size), fi: fi}, nil
+}
+
+type eofReader struct{}
+
+func (eofReader) ReadAt([]byte, int64) (int, error) { return 0, io.EOF }
+
+type file struct {
+	*io.SectionReader
+	fi os.FileInfo
+}
+
+func (f *file) Stat() (os.FileInfo, error) { return f.fi, nil }
+func (f *file) Close() error               { return nil }
+
+// ReadFile returns the contents of the named file.
+func ReadFile(fsys FS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	b := make([]byte, fi.Size())
+	if _, err := io.ReadFull(f, b); err != nil {
+		return nil, &os.PathError{Op: "read", Path: name, Err: err}
+	}
+	return b, nil
+}
+
+// Walk walks the tree at root in lexical order, as filepath.Walk does, and
+// does not follow symlinks. Returning filepath.SkipDir from fn for a
+// directory skips it.
+func Walk(fsys FS, root string, fn filepath.WalkFunc) error {
+	fi, err := fsys.Lstat(root)
+	if err != nil {
+		err = fn(root, nil, err)
+	} else {
+		err = walk(fsys, root, fi, fn)
+	}
+	if err == filepath.SkipDir {
+		return nil
+	}
+	return err
+}
+
+func walk(fsys FS, name string, fi os.FileInfo, fn filepath.WalkFunc) error {
+	if !fi.IsDir() {
+		return fn(name, fi, nil)
+	}
+	fis, err := fsys.ReadDir(name)
+	err1 := fn(name, fi, err)
+	if err != nil || err1 != nil {
+		return err1
+	}
+	for _, c := range fis {
+		if err := walk(fsys, path.Join(name, c.Name()), c, fn); err != nil {
+			if !c.IsDir() || err != filepath.SkipDir {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Opener reads a file system from r, or fails if r does not hold one it
+// understands.
+type Opener func(r io.ReaderAt) (FS, error)
+
+var (
+	mu      sync.Mutex
+	openers = map[string]Opener{}
+)
+
+// Register makes the reader for file system name available to New.
+func Register(name string, open Opener) {
+	mu.Lock()
+	defer mu.Unlock()
+	openers[name] = open
+}
+
+// New reads the file system on r with the first registered reader that
+// understands it, and returns the file system and its name.
+func New(r io.ReaderAt) (FS, string, error) {
+	mu.Lock()
+	names := make([]string, 0, len(openers))
+	for n := range openers {
+		names = append(names, n)
+	}
+	mu.Unlock()
+	sort.Strings(names)
+
+	var errs []string
+	for _, n := range names {
+		mu.Lock()
+		open := openers[n]
+		mu.Unlock()
+		fsys, err := open(r)
+		if err == nil {
+			return fsys, n, nil
+		}
+		errs = append(errs, fmt.Sprintf("%s: %v", n, err))
+	}
+	if len(errs) == 0 {
+		return nil, "", fmt.Errorf("no file system readers are registered")
+	}
+	return nil, "", fmt.Errorf("no readable file system: %s", strings.Join(errs, "; "))
+}
+
+// Extract copies the tree at src in fsys to dst on the host, with
+// symlinks as they are, but never writing through one. Devices and other
+// special files are skipped. It is how readers' files are handed to code
+// that wants a directory, such as boot config parsers and kexec.
+func Extract(fsys FS, src, dst string) error {
+	return Walk(fsys, src, func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(path.Clean("/"+name), path.Clean("/"+src))
+		target := filepath.Join(dst, filepath.FromSlash(rel))
+		switch m := fi.Mode(); {
+		case m.IsDir():
+			return os.MkdirAll(target, m.Perm()|0700)
+		case m&os.ModeSymlink != 0:
+			link, err := fsys.Readlink(name)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case m.IsRegular():
+			return extractFile(fsys, name, target, m.Perm())
+		}
+		return nil
+	})
+}
+
+func extractFile(fsys FS, name, target string, perm os.FileMode) error {
+	in, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	// Never write through whatever is at target, such as a symlink
+	// extracted before.
+	if err := os.Remove(target); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL|syscall.O_NOFOLLOW, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return fmt.Errorf("extracting %s: %v", name, err)
+	}
+	return out.Close()
+}
@@ -0,0 +1,190 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package fs
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+// memTree is a Tree of inodes in memory: directories have entries, symlinks
+// a target and files contents.
+type memTree map[uint64]memInode
+
+type memInode struct {
+	mode    uint32
+	ents    []Dirent
+	target  string
+	content string
+}
+
+func (m memTree) Root() uint64 { return 1 }
+
+func (m memTree) Stat(ino uint64, name string) (os.FileInfo, error) {
+	in, ok := m[ino]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return &Info{FileName: name, FileMode: UnixMode(in.mode), FileSize: int64(len(in.content)), Ino: ino}, nil
+}
+
+func (m memTree) ReadDir(ino uint64) ([]Dirent, error) { return m[ino].ents, nil }
+func (m memTree) Readlink(ino uint64) (string, error)  { return m[ino].target, nil }
+
+func (m memTree) Open(ino uint64) (io.ReaderAt, int64, error) {
+	c := m[ino].content
+	return bytes.NewReader([]byte(c)), int64(len(c)), nil
+}
+
+var tree = memTree{
+	1: {mode: syscall.S_IFDIR | 0755, ents: []Dirent{{"etc", 2}, {"loop", 5}, {"up", 6}, {"abs", 7}}},
+	2: {mode: syscall.S_IFDIR | 0755, ents: []Dirent{{"passwd", 3}, {"rel", 4}}},
+	3: {mode: syscall.S_IFREG | 0644, content: "root:x:0:0\n"},
+	4: {mode: syscall.S_IFLNK | 0777, target: "passwd"},
+	5: {mode: syscall.S_IFLNK | 0777, target: "loop"},
+	6: {mode: syscall.S_IFLNK | 0777, target: "../../etc"},
+	7: {mode: syscall.S_IFLNK | 0777, target: "/etc/rel"},
+}
+
+func TestLookup(t *testing.T) {
+	fsys := NewFS(tree)
+	for _, tt := range []struct {
+		name string
+		want string
+		err  error
+	}{
+		{name: "etc/passwd", want: "root:x:0:0\n"},
+		{name: "/etc/./rel", want: "root:x:0:0\n"},
+		{name: "up/passwd", want: "root:x:0:0\n"},
+		{name: "abs", want: "root:x:0:0\n"},
+		{name: "/../etc/passwd", want: "root:x:0:0\n"},
+		{name: "loop", err: syscall.ELOOP},
+		{name: "etc/passwd/x", err: syscall.ENOTDIR},
+		{name: "etc/shadow", err: os.ErrNotExist},
+	} {
+		got, err := ReadFile(fsys, tt.name)
+		if tt.err != nil {
+			if pe, ok := err.(*os.PathError); !ok || pe.Err != tt.err {
+				t.Errorf("ReadFile(%q) = %v, want %v", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || string(got) != tt.want {
+			t.Errorf("ReadFile(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+type foldTree struct {
+	memTree
+}
+
+func (foldTree) CaseInsensitive() bool { return true }
+
+func TestLookupCaseInsensitive(t *testing.T) {
+	if _, err := ReadFile(NewFS(tree), "ETC/passwd"); err == nil {
+		t.Errorf("ReadFile(ETC/passwd) = nil, want error")
+	}
+	fsys := NewFS(foldTree{tree})
+	got, err := ReadFile(fsys, "ETC/Passwd")
+	if err != nil || string(got) != "root:x:0:0\n" {
+		t.Errorf("ReadFile(ETC/Passwd) = %q, %v, want %q", got, err, "root:x:0:0\n")
+	}
+	fi, err := fsys.Stat("Etc")
+	if err != nil || fi.Name() != "Etc" {
+		t.Errorf("Stat(Etc) = %v, %v, want Etc", fi, err)
+	}
+}
+
+func TestWalk(t *testing.T) {
+	var got []string
+	err := Walk(NewFS(tree), "/", func(name string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		got = append(got, name)
+		if name == "/etc" {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	want := []string{"/", "/abs", "/etc", "/loop", "/up"}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk() = %v, %v, want %v", got, err, want)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := Extract(NewFS(tree), "/etc", dir); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(dir, "rel"))
+	if err != nil || string(got) != "root:x:0:0\n" {
+		t.Errorf("extracted rel = %q, %v, want the password file", got, err)
+	}
+	if l, err := os.Readlink(filepath.Join(dir, "rel")); err != nil || l != "passwd" {
+		t.Errorf("extracted rel links to %q, %v, want passwd", l, err)
+	}
+}
+
+func TestReadDirBadEntries(t *testing.T) {
+	for _, ents := range [][]Dirent{
+		{{"a/b", 3}},
+		{{"..", 2}},
+		{{"", 3}},
+		{{"passwd", 3}, {"passwd", 4}},
+	} {
+		bad := memTree{}
+		for ino, in := range tree {
+			bad[ino] = in
+		}
+		bad[2] = memInode{mode: syscall.S_IFDIR | 0755, ents: ents}
+		if _, err := NewFS(bad).ReadDir("/etc"); err == nil {
+			t.Errorf("ReadDir of a directory with entries %v did not fail", ents)
+		}
+	}
+}
+
+func TestExtractOverSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	victim := filepath.Join(dir, "victim")
+	if err := ioutil.WriteFile(victim, []byte("safe\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out")
+	if err := os.Mkdir(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	// Left by an earlier extraction, or made by one.
+	if err := os.Symlink("../victim", filepath.Join(out, "passwd")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Extract(NewFS(tree), "/etc", out); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(victim); err != nil || string(b) != "safe\n" {
+		t.Errorf("victim = %q, %v, want it untouched", b, err)
+	}
+	if fi, err := os.Lstat(filepath.Join(out, "passwd")); err != nil || !fi.Mode().IsRegular() {
+		t.Errorf("extracted passwd = %v, %v, want a regular file", fi, err)
+	}
+}
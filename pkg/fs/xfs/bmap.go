@@ -0,0 +1,201 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// extent maps count blocks at file block off to file system block fsb.
+// Unwritten extents are allocated but read as zeros.
+type extent struct {
+	off       uint64
+	fsb       uint64
+	count     uint64
+	unwritten bool
+}
+
+// extentSize is the size of struct xfs_bmbt_rec.
+const extentSize = 16
+
+// unpackExtent unpacks a struct xfs_bmbt_rec: 1 bit of unwritten flag, 54
+// of file offset, 52 of start block and 21 of block count.
+func unpackExtent(b []byte) extent {
+	l0, l1 := binary.BigEndian.Uint64(b), binary.BigEndian.Uint64(b[8:])
+	return extent{
+		unwritten: l0>>63 != 0,
+		off:       l0 & (1<<63 - 1) >> 9,
+		fsb:       l0&(1<<9-1)<<43 | l1>>21,
+		count:     l1 & (1<<21 - 1),
+	}
+}
+
+// decodeExtent unpacks the extent in b, and checks that its blocks are in
+// the file system and its file offsets fit an int64.
+func (x *FS) decodeExtent(b []byte) (extent, error) {
+	e := unpackExtent(b)
+	ag, agb := e.fsb>>x.agBlkLog, e.fsb&(1<<x.agBlkLog-1)
+	if ag >= x.agCount || agb+e.count > x.agBlocks || ag*x.agBlocks+agb+e.count > x.dBlocks {
+		return e, fmt.Errorf("extent of %d blocks at %#x is past the end of the file system", e.count, e.fsb)
+	}
+	if e.off+e.count > uint64(math.MaxInt64/x.blockSize) {
+		return e, fmt.Errorf("extent of %d blocks at file block %d is past the largest file", e.count, e.off)
+	}
+	return e, nil
+}
+
+// Bmap btree block magic and header sizes, struct xfs_btree_block with
+// long pointers.
+const (
+	bmapMagic   = 0x424d4150 // "BMAP"
+	bmapMagicV5 = 0x424d4133 // "BMA3"
+
+	bmapHdrSize   = 24
+	bmapHdrSizeV5 = 72
+
+	// maxBtreeLevels bounds how deep a bmap btree is followed.
+	maxBtreeLevels = 10
+)
+
+// extents returns the extents of an inode's data fork, sorted by offset.
+func (x *FS) extents(in *inode) ([]extent, error) {
+	var ext []extent
+	switch in.format {
+	case formatExtents:
+		if in.nextents > uint64(len(in.fork)/extentSize) {
+			return nil, fmt.Errorf("inode %d: %d extents in %d byte fork", in.ino, in.nextents, len(in.fork))
+		}
+		for i := uint64(0); i < in.nextents; i++ {
+			e, err := x.decodeExtent(in.fork[i*extentSize:])
+			if err != nil {
+				return nil, fmt.Errorf("inode %d: %v", in.ino, err)
+			}
+			ext = append(ext, e)
+		}
+	case formatBtree:
+		// The root in the inode is struct xfs_bmdr_block: level and
+		// number of records, then as many keys and pointers as fit.
+		if len(in.fork) < 4 {
+			return nil, fmt.Errorf("inode %d: btree root in %d byte fork", in.ino, len(in.fork))
+		}
+		level := binary.BigEndian.Uint16(in.fork)
+		n := int(binary.BigEndian.Uint16(in.fork[2:]))
+		max := (len(in.fork) - 4) / 16
+		if level == 0 || n > max {
+			return nil, fmt.Errorf("inode %d: bad btree root of level %d with %d records", in.ino, level, n)
+		}
+		for i := 0; i < n; i++ {
+			ptr := binary.BigEndian.Uint64(in.fork[4+max*8+i*8:])
+			if err := x.btreeExtents(ptr, int(level)-1, &ext); err != nil {
+				return nil, fmt.Errorf("inode %d: %v", in.ino, err)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("inode %d: data fork format %d has no extents", in.ino, in.format)
+	}
+	sort.Slice(ext, func(i, j int) bool { return ext[i].off < ext[j].off })
+	return ext, nil
+}
+
+// btreeExtents appends the extents in the bmap btree block fsb, of level, to
+// ext.
+func (x *FS) btreeExtents(fsb uint64, level int, ext *[]extent) error {
+	if level >= maxBtreeLevels {
+		return fmt.Errorf("bmap btree too deep")
+	}
+	b, err := x.readBlock(fsb, x.blockSize)
+	if err != nil {
+		return err
+	}
+	hdr := bmapHdrSize
+	switch m := binary.BigEndian.Uint32(b); {
+	case x.v5 && m == bmapMagicV5:
+		hdr = bmapHdrSizeV5
+	case !x.v5 && m == bmapMagic:
+	default:
+		return fmt.Errorf("bmap btree block %#x: bad magic %#08x", fsb, m)
+	}
+	if l := int(binary.BigEndian.Uint16(b[4:])); l != level {
+		return fmt.Errorf("bmap btree block %#x: level %d, want %d", fsb, l, level)
+	}
+	n := int(binary.BigEndian.Uint16(b[6:]))
+	if level == 0 {
+		if hdr+n*extentSize > len(b) {
+			return fmt.Errorf("bmap btree block %#x: %d records", fsb, n)
+		}
+		for i := 0; i < n; i++ {
+			e, err := x.decodeExtent(b[hdr+i*extentSize:])
+			if err != nil {
+				return fmt.Errorf("bmap btree block %#x: %v", fsb, err)
+			}
+			*ext = append(*ext, e)
+		}
+		return nil
+	}
+	max := (len(b) - hdr) / 16
+	if n > max {
+		return fmt.Errorf("bmap btree block %#x: %d records", fsb, n)
+	}
+	for i := 0; i < n; i++ {
+		ptr := binary.BigEndian.Uint64(b[hdr+max*8+i*8:])
+		if err := x.btreeExtents(ptr, level-1, ext); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fileReader reads size bytes of a file through its extents. Holes and
+// unwritten extents read as zeros.
+type fileReader struct {
+	x    *FS
+	ext  []extent
+	size int64
+}
+
+func (f *fileReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	var err error
+	if int64(len(p)) > f.size-off {
+		p = p[:f.size-off]
+		err = io.EOF
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	bs := f.x.blockSize
+	end := off + int64(len(p))
+	for _, e := range f.ext {
+		start, stop := int64(e.off)*bs, int64(e.off+e.count)*bs
+		if stop <= off || start >= end || e.unwritten {
+			continue
+		}
+		from, to := max64(start, off), min64(stop, end)
+		if _, rerr := f.x.r.ReadAt(p[from-off:to-off], f.x.fsbOffset(e.fsb)+from-start); rerr != nil {
+			return 0, rerr
+		}
+	}
+	return len(p), err
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
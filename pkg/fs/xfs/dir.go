@@ -0,0 +1,173 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xfs
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/u-root/u-root/pkg/fs"
+)
+
+// Directory data block magic and header sizes, from xfs_da_format.h.
+const (
+	dirBlockMagic   = 0x58443242 // "XD2B", a single block directory
+	dirDataMagic    = 0x58443244 // "XD2D", a data block of a bigger one
+	dirBlockMagicV5 = 0x58444233 // "XDB3"
+	dirDataMagicV5  = 0x58444433 // "XDD3"
+
+	dirDataHdrSize   = 16
+	dirDataHdrSizeV5 = 64
+
+	// dirBlockTailSize is struct xfs_dir2_block_tail, at the end of a
+	// single block directory, after its leaf entries.
+	dirBlockTailSize = 8
+	dirLeafEntSize   = 8
+
+	dirFreeTag = 0xffff
+
+	// dirLeafOffset is where a directory's leaf blocks start. Entries
+	// are all in the data blocks below it.
+	dirLeafOffset = 32 << 30
+)
+
+// ReadDir implements fs.Tree.
+func (x *FS) ReadDir(ino uint64) ([]fs.Dirent, error) {
+	in, err := x.inode(ino)
+	if err != nil {
+		return nil, err
+	}
+	if !in.isDir() {
+		return nil, fmt.Errorf("inode %d is not a directory", ino)
+	}
+	if in.format == formatLocal {
+		return x.shortformDir(in)
+	}
+
+	ext, err := x.extents(in)
+	if err != nil {
+		return nil, err
+	}
+	r := &fileReader{x: x, ext: ext, size: dirLeafOffset}
+	var ents []fs.Dirent
+	// Directory blocks are dirBlkSize aligned in the directory, and may
+	// be made of several file system blocks from different extents.
+	var last int64 = -1
+	for _, e := range ext {
+		for off := int64(e.off) * x.blockSize; off < int64(e.off+e.count)*x.blockSize && off < dirLeafOffset; off += x.blockSize {
+			db := off / x.dirBlkSize * x.dirBlkSize
+			if db == last {
+				continue
+			}
+			last = db
+			b := make([]byte, x.dirBlkSize)
+			if _, err := r.ReadAt(b, db); err != nil {
+				return nil, fmt.Errorf("directory %d: %v", ino, err)
+			}
+			if ents, err = x.dataBlock(ents, b); err != nil {
+				return nil, fmt.Errorf("directory %d block at %#x: %v", ino, db, err)
+			}
+		}
+	}
+	return ents, nil
+}
+
+// dataBlock appends the entries in directory data block b to ents.
+func (x *FS) dataBlock(ents []fs.Dirent, b []byte) ([]fs.Dirent, error) {
+	be := binary.BigEndian
+	var hdr int
+	block := false
+	switch m := be.Uint32(b); {
+	case !x.v5 && (m == dirBlockMagic || m == dirDataMagic):
+		hdr, block = dirDataHdrSize, m == dirBlockMagic
+	case x.v5 && (m == dirBlockMagicV5 || m == dirDataMagicV5):
+		hdr, block = dirDataHdrSizeV5, m == dirBlockMagicV5
+	default:
+		return nil, fmt.Errorf("bad magic %#08x", m)
+	}
+	end := len(b)
+	if block {
+		n := int(be.Uint32(b[end-dirBlockTailSize:]))
+		end -= dirBlockTailSize + n*dirLeafEntSize
+		if end < hdr {
+			return nil, fmt.Errorf("%d leaf entries", n)
+		}
+	}
+
+	for p := hdr; p < end; {
+		if be.Uint16(b[p:]) == dirFreeTag {
+			n := int(be.Uint16(b[p+2:]))
+			if n == 0 || n%8 != 0 {
+				return nil, fmt.Errorf("free space of %d bytes at %#x", n, p)
+			}
+			p += n
+			continue
+		}
+		// struct xfs_dir2_data_entry: inode, name length and name,
+		// file type if the file system has them, then a tag, padded
+		// to 8 bytes.
+		if p+9 > end {
+			return nil, fmt.Errorf("entry at %#x runs off the block", p)
+		}
+		ino := be.Uint64(b[p:])
+		n := int(b[p+8])
+		size := 8 + 1 + n + 2
+		if x.ftype {
+			size++
+		}
+		size = (size + 7) &^ 7
+		if n == 0 || p+size > end {
+			return nil, fmt.Errorf("entry at %#x runs off the block", p)
+		}
+		name := string(b[p+9 : p+9+n])
+		if name != "." && name != ".." {
+			ents = append(ents, fs.Dirent{Name: name, Ino: ino})
+		}
+		p += size
+	}
+	return ents, nil
+}
+
+// shortformDir returns the entries of a directory small enough to fit in
+// its inode, struct xfs_dir2_sf_hdr and its entries.
+func (x *FS) shortformDir(in *inode) ([]fs.Dirent, error) {
+	b := in.fork
+	if len(b) < 6 {
+		return nil, fmt.Errorf("directory %d: short form header in %d bytes", in.ino, len(b))
+	}
+	count := int(b[0])
+	inoSize := 4
+	if b[1] != 0 {
+		inoSize = 8
+	}
+	// Skip the counts and the parent inode.
+	p := 2 + inoSize
+	ents := make([]fs.Dirent, 0, count)
+	for i := 0; i < count; i++ {
+		// Name length, offset in the directory as if it were a block
+		// directory, name, file type and inode.
+		if p+3 > len(b) {
+			return nil, fmt.Errorf("directory %d: entry %d runs off the fork", in.ino, i)
+		}
+		n := int(b[p])
+		name := p + 3
+		ip := name + n
+		if x.ftype {
+			ip++
+		}
+		if n == 0 || ip+inoSize > len(b) {
+			return nil, fmt.Errorf("directory %d: entry %d runs off the fork", in.ino, i)
+		}
+		var ino uint64
+		if inoSize == 8 {
+			ino = binary.BigEndian.Uint64(b[ip:])
+		} else {
+			ino = uint64(binary.BigEndian.Uint32(b[ip:]))
+		}
+		ents = append(ents, fs.Dirent{Name: string(b[name : name+n]), Ino: ino})
+		p = ip + inoSize
+	}
+	return ents, nil
+}
@@ -0,0 +1,347 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package xfs reads XFS file systems.
+//
+// It reads enough to walk directories and read files and symlinks, in all
+// of their on-disk formats, of version 4 and 5 (CRC) file systems. It does
+// not replay the log, so a file system that was not unmounted cleanly may
+// read as it was at the last checkpoint; for finding kernels on /boot that
+// is as good as it gets. Realtime files are not supported.
+package xfs
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/u-root/u-root/pkg/fs"
+)
+
+func init() {
+	fs.Register("xfs", New)
+}
+
+// Superblock magic and fields, from fs/xfs/libxfs/xfs_format.h.
+const (
+	sbMagic = 0x58465342 // "XFSB"
+
+	sbVersionMask = 0x000f
+	sbVersion5    = 5
+	sbVersion4    = 4
+
+	sbFeatures2FType = 0x00000200
+
+	incompatFType     = 1 << 0
+	incompatSpinodes  = 1 << 1
+	incompatMetaUUID  = 1 << 2
+	incompatBigtime   = 1 << 3
+	incompatRepair    = 1 << 4
+	incompatNrext64   = 1 << 5
+	incompatExchRange = 1 << 6
+	incompatParent    = 1 << 7
+
+	// incompatKnown are the incompatible features that do not change
+	// what this package reads.
+	incompatKnown = incompatFType | incompatSpinodes | incompatMetaUUID | incompatBigtime |
+		incompatRepair | incompatNrext64 | incompatExchRange | incompatParent
+)
+
+// Inode magic, formats and flags, from xfs_format.h.
+const (
+	inodeMagic = 0x494e // "IN"
+
+	formatDev     = 0
+	formatLocal   = 1
+	formatExtents = 2
+	formatBtree   = 3
+
+	diflagRealtime = 1 << 0
+
+	diflag2Bigtime = 1 << 3
+	diflag2Nrext64 = 1 << 4
+
+	// Sizes of the inode core of version 1 and 2, and 3, inodes.
+	inodeCoreV2 = 100
+	inodeCoreV3 = 176
+)
+
+// FS is an XFS file system.
+type FS struct {
+	r io.ReaderAt
+
+	blockSize  int64
+	dBlocks    uint64
+	agBlocks   uint64
+	agCount    uint64
+	agBlkLog   uint
+	inoPBLog   uint
+	inodeSize  int64
+	dirBlkSize int64
+	rootIno    uint64
+	v5         bool
+	ftype      bool
+}
+
+// New reads the XFS file system on r.
+func New(r io.ReaderAt) (fs.FS, error) {
+	x, err := newFS(r)
+	if err != nil {
+		return nil, err
+	}
+	return fs.NewFS(x), nil
+}
+
+func newFS(r io.ReaderAt) (*FS, error) {
+	sb := make([]byte, 512)
+	if _, err := r.ReadAt(sb, 0); err != nil {
+		return nil, fmt.Errorf("reading superblock: %v", err)
+	}
+	be := binary.BigEndian
+	if m := be.Uint32(sb[0:]); m != sbMagic {
+		return nil, fmt.Errorf("bad superblock magic %#08x", m)
+	}
+	x := &FS{
+		r:         r,
+		blockSize: int64(be.Uint32(sb[4:])),
+		dBlocks:   be.Uint64(sb[8:]),
+		rootIno:   be.Uint64(sb[56:]),
+		agBlocks:  uint64(be.Uint32(sb[84:])),
+		agCount:   uint64(be.Uint32(sb[88:])),
+		inodeSize: int64(be.Uint16(sb[104:])),
+		inoPBLog:  uint(sb[123]),
+		agBlkLog:  uint(sb[124]),
+	}
+	blockLog, inodeLog, dirBlkLog := uint(sb[120]), uint(sb[122]), uint(sb[192])
+	switch v := be.Uint16(sb[100:]) & sbVersionMask; v {
+	case sbVersion5:
+		x.v5 = true
+		incompat := be.Uint32(sb[216:])
+		if incompat&^incompatKnown != 0 {
+			return nil, fmt.Errorf("unsupported incompatible features %#x", incompat&^incompatKnown)
+		}
+		x.ftype = incompat&incompatFType != 0
+	case sbVersion4:
+		x.ftype = be.Uint32(sb[200:])&sbFeatures2FType != 0
+	default:
+		return nil, fmt.Errorf("unsupported version %d", v)
+	}
+	if blockLog < 9 || blockLog > 16 || x.blockSize != 1<<blockLog {
+		return nil, fmt.Errorf("bad block size %d", x.blockSize)
+	}
+	if inodeLog < 8 || inodeLog > 11 || x.inodeSize != 1<<inodeLog || inodeLog+x.inoPBLog != blockLog {
+		return nil, fmt.Errorf("bad inode size %d", x.inodeSize)
+	}
+	if x.agBlkLog > 31 || x.agBlocks == 0 || x.agBlocks > 1<<x.agBlkLog {
+		return nil, fmt.Errorf("bad allocation group size %d", x.agBlocks)
+	}
+	if blockLog+dirBlkLog > 16 {
+		return nil, fmt.Errorf("bad directory block size %d", x.blockSize<<dirBlkLog)
+	}
+	x.dirBlkSize = x.blockSize << dirBlkLog
+	return x, nil
+}
+
+// fsbOffset returns the byte offset of file system block fsb, which is an
+// allocation group number and a block in the group.
+func (x *FS) fsbOffset(fsb uint64) int64 {
+	ag, agb := fsb>>x.agBlkLog, fsb&(1<<x.agBlkLog-1)
+	return int64(ag*x.agBlocks+agb) * x.blockSize
+}
+
+// readBlock reads n bytes at file system block fsb.
+func (x *FS) readBlock(fsb uint64, n int64) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := x.r.ReadAt(b, x.fsbOffset(fsb)); err != nil {
+		return nil, fmt.Errorf("reading block %#x: %v", fsb, err)
+	}
+	return b, nil
+}
+
+// inode is what this package uses of an inode.
+type inode struct {
+	ino      uint64
+	mode     uint16
+	format   uint8
+	uid, gid uint32
+	nlink    uint32
+	size     int64
+	mtime    time.Time
+	nextents uint64
+	flags    uint16
+
+	// fork is the data fork.
+	fork []byte
+}
+
+// xfsTime decodes an inode timestamp.
+func xfsTime(b []byte, bigtime bool) time.Time {
+	if bigtime {
+		// Nanoseconds since the lowest 32-bit time.
+		ns := binary.BigEndian.Uint64(b)
+		return time.Unix(int64(ns/1e9)-1<<31, int64(ns%1e9))
+	}
+	return time.Unix(int64(int32(binary.BigEndian.Uint32(b))), int64(int32(binary.BigEndian.Uint32(b[4:]))))
+}
+
+func (x *FS) inode(ino uint64) (*inode, error) {
+	ag := ino >> (x.agBlkLog + x.inoPBLog)
+	agb := ino >> x.inoPBLog & (1<<x.agBlkLog - 1)
+	off := int64(ino & (1<<x.inoPBLog - 1))
+	b := make([]byte, x.inodeSize)
+	if _, err := x.r.ReadAt(b, int64(ag*x.agBlocks+agb)*x.blockSize+off*x.inodeSize); err != nil {
+		return nil, fmt.Errorf("reading inode %d: %v", ino, err)
+	}
+	be := binary.BigEndian
+	if m := be.Uint16(b[0:]); m != inodeMagic {
+		return nil, fmt.Errorf("inode %d: bad magic %#04x", ino, m)
+	}
+	in := &inode{
+		ino:    ino,
+		mode:   be.Uint16(b[2:]),
+		format: b[5],
+		uid:    be.Uint32(b[8:]),
+		gid:    be.Uint32(b[12:]),
+		nlink:  be.Uint32(b[16:]),
+		size:   int64(be.Uint64(b[56:])),
+		flags:  be.Uint16(b[90:]),
+	}
+	core := int64(inodeCoreV2)
+	var flags2 uint64
+	switch b[4] {
+	case 1:
+		in.nlink = uint32(be.Uint16(b[6:]))
+	case 2:
+	case 3:
+		core = inodeCoreV3
+		flags2 = be.Uint64(b[120:])
+	default:
+		return nil, fmt.Errorf("inode %d: unsupported version %d", ino, b[4])
+	}
+	if flags2&diflag2Nrext64 != 0 {
+		in.nextents = be.Uint64(b[24:])
+	} else {
+		in.nextents = uint64(be.Uint32(b[76:]))
+	}
+	in.mtime = xfsTime(b[40:], flags2&diflag2Bigtime != 0)
+
+	end := x.inodeSize
+	if forkoff := int64(b[82]); forkoff != 0 {
+		end = core + forkoff*8
+	}
+	if end > x.inodeSize || end < core {
+		return nil, fmt.Errorf("inode %d: bad fork offset %d", ino, b[82])
+	}
+	in.fork = b[core:end]
+	if in.size < 0 {
+		return nil, fmt.Errorf("inode %d: bad size %d", ino, in.size)
+	}
+	return in, nil
+}
+
+func (in *inode) isDir() bool     { return uint32(in.mode)&0170000 == 0040000 }
+func (in *inode) isSymlink() bool { return uint32(in.mode)&0170000 == 0120000 }
+
+// Root implements fs.Tree.
+func (x *FS) Root() uint64 {
+	return x.rootIno
+}
+
+// Stat implements fs.Tree.
+func (x *FS) Stat(ino uint64, name string) (os.FileInfo, error) {
+	in, err := x.inode(ino)
+	if err != nil {
+		return nil, err
+	}
+	return &fs.Info{
+		FileName: name,
+		FileSize: in.size,
+		FileMode: fs.UnixMode(uint32(in.mode)),
+		MTime:    in.mtime,
+		Ino:      ino,
+		UID:      in.uid,
+		GID:      in.gid,
+		Nlink:    in.nlink,
+	}, nil
+}
+
+// Open implements fs.Tree.
+func (x *FS) Open(ino uint64) (io.ReaderAt, int64, error) {
+	in, err := x.inode(ino)
+	if err != nil {
+		return nil, 0, err
+	}
+	if in.flags&diflagRealtime != 0 {
+		return nil, 0, fmt.Errorf("inode %d is a realtime file, which is not supported", ino)
+	}
+	ext, err := x.extents(in)
+	if err != nil {
+		return nil, 0, err
+	}
+	return &fileReader{x: x, ext: ext, size: in.size}, in.size, nil
+}
+
+// Symlink block header, XFS_SYMLINK_MAGIC and struct xfs_dsymlink_hdr.
+const (
+	symlinkMagic   = 0x58534c4d // "XSLM"
+	symlinkHdrSize = 56
+
+	maxPathLen = 1024
+)
+
+// Readlink implements fs.Tree.
+func (x *FS) Readlink(ino uint64) (string, error) {
+	in, err := x.inode(ino)
+	if err != nil {
+		return "", err
+	}
+	if !in.isSymlink() {
+		return "", fmt.Errorf("inode %d is not a symlink", ino)
+	}
+	if in.size > maxPathLen {
+		return "", fmt.Errorf("inode %d: symlink of %d bytes", ino, in.size)
+	}
+	if in.format == formatLocal {
+		if in.size > int64(len(in.fork)) {
+			return "", fmt.Errorf("inode %d: symlink of %d bytes in %d byte fork", ino, in.size, len(in.fork))
+		}
+		return string(in.fork[:in.size]), nil
+	}
+
+	ext, err := x.extents(in)
+	if err != nil {
+		return "", err
+	}
+	r := &fileReader{x: x, ext: ext, size: 1 << 20}
+	if !x.v5 {
+		b := make([]byte, in.size)
+		if _, err := r.ReadAt(b, 0); err != nil {
+			return "", err
+		}
+		return string(b), nil
+	}
+	// Each block of a version 5 symlink has a header, then part of the
+	// target.
+	var target []byte
+	for off := int64(0); int64(len(target)) < in.size; off += x.blockSize {
+		b := make([]byte, x.blockSize)
+		if _, err := r.ReadAt(b, off); err != nil {
+			return "", err
+		}
+		if m := binary.BigEndian.Uint32(b); m != symlinkMagic {
+			return "", fmt.Errorf("inode %d: bad symlink block magic %#08x", ino, m)
+		}
+		n := int64(binary.BigEndian.Uint32(b[8:]))
+		if n > x.blockSize-symlinkHdrSize {
+			return "", fmt.Errorf("inode %d: symlink block of %d bytes", ino, n)
+		}
+		target = append(target, b[symlinkHdrSize:symlinkHdrSize+n]...)
+	}
+	if int64(len(target)) > in.size {
+		target = target[:in.size]
+	}
+	return string(target), nil
+}
@@ -0,0 +1,378 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xfs
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/fs"
+)
+
+// There is no mkfs.xfs to make test images with, so image builds a small
+// version 5 file system by hand: 4 KiB blocks, 512 byte inodes and one
+// allocation group of 64 blocks, with inodes in blocks 8 and 9.
+type image []byte
+
+const (
+	testBS     = 4096
+	testInoBlk = 8
+)
+
+var be = binary.BigEndian
+
+func newImage() image {
+	img := make(image, 64*testBS)
+	sb := img[:512]
+	be.PutUint32(sb[0:], sbMagic)
+	be.PutUint32(sb[4:], testBS)
+	be.PutUint64(sb[8:], 64)
+	be.PutUint64(sb[56:], testInoBlk<<3)
+	be.PutUint32(sb[84:], 64)
+	be.PutUint32(sb[88:], 1)
+	be.PutUint16(sb[100:], 0xb4a5)
+	be.PutUint16(sb[102:], 512)
+	be.PutUint16(sb[104:], 512)
+	be.PutUint16(sb[106:], 8)
+	sb[120], sb[121], sb[122], sb[123], sb[124] = 12, 9, 9, 3, 6
+	be.PutUint32(sb[216:], incompatFType)
+	return img
+}
+
+func (img image) block(fsb int) []byte {
+	return img[fsb*testBS : (fsb+1)*testBS]
+}
+
+// inode writes inode ino with a data fork.
+func (img image) inode(ino uint64, mode uint16, format uint8, size int64, nextents int, fork []byte) {
+	b := img[ino*512 : (ino+1)*512]
+	be.PutUint16(b[0:], inodeMagic)
+	be.PutUint16(b[2:], mode)
+	b[4], b[5] = 3, format
+	be.PutUint32(b[16:], 1)
+	be.PutUint32(b[40:], 1600000000)
+	be.PutUint64(b[56:], uint64(size))
+	be.PutUint32(b[76:], uint32(nextents))
+	copy(b[inodeCoreV3:], fork)
+}
+
+func extentBytes(exts ...extent) []byte {
+	var b []byte
+	for _, e := range exts {
+		var r [16]byte
+		l0 := e.off<<9 | e.fsb>>43
+		if e.unwritten {
+			l0 |= 1 << 63
+		}
+		be.PutUint64(r[:], l0)
+		be.PutUint64(r[8:], e.fsb<<21|e.count)
+		b = append(b, r[:]...)
+	}
+	return b
+}
+
+func shortform(parent uint32, ents ...fs.Dirent) []byte {
+	b := []byte{byte(len(ents)), 0, 0, 0, 0, 0}
+	be.PutUint32(b[2:], parent)
+	for _, e := range ents {
+		b = append(b, byte(len(e.Name)), 0, 0)
+		b = append(b, e.Name...)
+		b = append(b, 1, 0, 0, 0, 0)
+		be.PutUint32(b[len(b)-4:], uint32(e.Ino))
+	}
+	return b
+}
+
+// dirBlock fills b as a directory data block, a whole single block
+// directory if block is set.
+func dirBlock(b []byte, block bool, ents ...fs.Dirent) {
+	if block {
+		be.PutUint32(b, dirBlockMagicV5)
+	} else {
+		be.PutUint32(b, dirDataMagicV5)
+	}
+	p := dirDataHdrSizeV5
+	for _, e := range ents {
+		be.PutUint64(b[p:], e.Ino)
+		b[p+8] = byte(len(e.Name))
+		copy(b[p+9:], e.Name)
+		p += (8 + 1 + len(e.Name) + 1 + 2 + 7) &^ 7
+	}
+	end := len(b)
+	if block {
+		be.PutUint32(b[end-8:], uint32(len(ents)))
+		end -= 8 + 8*len(ents)
+	}
+	be.PutUint16(b[p:], dirFreeTag)
+	be.PutUint16(b[p+2:], uint16(end-p))
+}
+
+const (
+	sIFDIR = 0040755
+	sIFREG = 0100644
+	sIFLNK = 0120777
+)
+
+func testImage() image {
+	img := newImage()
+	const (
+		root = iota + testInoBlk<<3
+		boot
+		hello
+		vmlinuz
+		long
+		kernel
+		grub
+		initrd
+		grubcfg
+	)
+	img.inode(root, sIFDIR, formatLocal, 0, 0, shortform(root,
+		fs.Dirent{Name: "boot", Ino: boot},
+		fs.Dirent{Name: "hello", Ino: hello},
+		fs.Dirent{Name: "vmlinuz", Ino: vmlinuz},
+		fs.Dirent{Name: "long", Ino: long},
+	))
+
+	// /boot is a single block directory in block 16.
+	img.inode(boot, sIFDIR, formatExtents, testBS, 1, extentBytes(extent{fsb: 16, count: 1}))
+	dirBlock(img.block(16), true,
+		fs.Dirent{Name: ".", Ino: boot},
+		fs.Dirent{Name: "..", Ino: root},
+		fs.Dirent{Name: "vmlinuz-5.4", Ino: kernel},
+		fs.Dirent{Name: "grub", Ino: grub},
+		fs.Dirent{Name: "initrd.img", Ino: initrd},
+	)
+
+	img.inode(hello, sIFREG, formatExtents, 13, 1, extentBytes(extent{fsb: 20, count: 1}))
+	copy(img.block(20), "hello, world\n")
+
+	img.inode(vmlinuz, sIFLNK, formatLocal, 16, 0, []byte("boot/vmlinuz-5.4"))
+
+	// A symlink in a block, with its header.
+	const target = "/boot/grub/../vmlinuz-5.4"
+	img.inode(long, sIFLNK, formatExtents, int64(len(target)), 1, extentBytes(extent{fsb: 27, count: 1}))
+	be.PutUint32(img.block(27), symlinkMagic)
+	be.PutUint32(img.block(27)[8:], uint32(len(target)))
+	copy(img.block(27)[symlinkHdrSize:], target)
+
+	// Block 0 in block 21, a hole, an unwritten extent and 100 bytes in
+	// block 23.
+	img.inode(kernel, sIFREG, formatExtents, 3*testBS+100, 3, extentBytes(
+		extent{off: 0, fsb: 21, count: 1},
+		extent{off: 2, fsb: 22, count: 1, unwritten: true},
+		extent{off: 3, fsb: 23, count: 1},
+	))
+	copy(img.block(21), bytes.Repeat([]byte{'A'}, testBS))
+	copy(img.block(22), bytes.Repeat([]byte{'X'}, testBS))
+	copy(img.block(23), bytes.Repeat([]byte{'B'}, 100))
+
+	// /boot/grub is a data block and a leaf block, as bigger
+	// directories are.
+	img.inode(grub, sIFDIR, formatExtents, testBS, 2, extentBytes(
+		extent{off: 0, fsb: 28, count: 1},
+		extent{off: dirLeafOffset / testBS, fsb: 29, count: 1},
+	))
+	dirBlock(img.block(28), false,
+		fs.Dirent{Name: ".", Ino: grub},
+		fs.Dirent{Name: "..", Ino: boot},
+		fs.Dirent{Name: "grub.cfg", Ino: grubcfg},
+	)
+	img.inode(grubcfg, sIFREG, formatExtents, 0, 0, nil)
+
+	// initrd.img has its extents in a btree, the root in the inode and
+	// a leaf in block 24.
+	fork := make([]byte, 512-inodeCoreV3)
+	be.PutUint16(fork[0:], 1)
+	be.PutUint16(fork[2:], 1)
+	max := (len(fork) - 4) / 16
+	be.PutUint64(fork[4+max*8:], 24)
+	img.inode(initrd, sIFREG, formatBtree, 2*testBS, 2, fork)
+	leaf := img.block(24)
+	be.PutUint32(leaf, bmapMagicV5)
+	be.PutUint16(leaf[6:], 2)
+	copy(leaf[bmapHdrSizeV5:], extentBytes(extent{off: 0, fsb: 25, count: 1}, extent{off: 1, fsb: 26, count: 1}))
+	copy(img.block(25), bytes.Repeat([]byte{'1'}, testBS))
+	copy(img.block(26), bytes.Repeat([]byte{'2'}, testBS))
+	return img
+}
+
+func TestExtentUnpack(t *testing.T) {
+	want := extent{off: 1<<54 - 1, fsb: 1<<52 - 1, count: 1<<21 - 1, unwritten: true}
+	if got := unpackExtent(extentBytes(want)); got != want {
+		t.Errorf("unpackExtent() = %+v, want %+v", got, want)
+	}
+}
+
+func TestCorruptExtent(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		e    extent
+	}{
+		{"past the end", extent{fsb: 60, count: 5}},
+		{"in a missing allocation group", extent{fsb: 1 << 6, count: 1}},
+		{"overflowing", extent{off: 1<<54 - 1, fsb: 16, count: 1<<21 - 1}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			img := testImage()
+			// /boot, as a data block reached by ReadDir.
+			img.inode(testInoBlk<<3+1, sIFDIR, formatExtents, testBS, 1, extentBytes(tt.e))
+			fsys, err := New(bytes.NewReader(img))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := fsys.ReadDir("/boot"); err == nil || !strings.Contains(err.Error(), "past the") {
+				t.Errorf("ReadDir(/boot) = %v, want an error about the extent", err)
+			}
+		})
+	}
+}
+
+func TestNewBadMagic(t *testing.T) {
+	if _, err := New(bytes.NewReader(make([]byte, 4096))); err == nil {
+		t.Errorf("New(zeros) = nil error, want error")
+	}
+}
+
+func TestReadDir(t *testing.T) {
+	fsys, err := New(bytes.NewReader(testImage()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		dir  string
+		want []string
+	}{
+		{"/", []string{"boot", "hello", "long", "vmlinuz"}},
+		{"boot", []string{"grub", "initrd.img", "vmlinuz-5.4"}},
+		{"/boot/grub", []string{"grub.cfg"}},
+	} {
+		fis, err := fsys.ReadDir(tt.dir)
+		if err != nil {
+			t.Errorf("ReadDir(%q) = %v", tt.dir, err)
+			continue
+		}
+		var got []string
+		for _, fi := range fis {
+			got = append(got, fi.Name())
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ReadDir(%q) = %v, want %v", tt.dir, got, tt.want)
+		}
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	fsys, err := New(bytes.NewReader(testImage()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kernel := append(bytes.Repeat([]byte{'A'}, testBS), make([]byte, 2*testBS)...)
+	kernel = append(kernel, bytes.Repeat([]byte{'B'}, 100)...)
+	initrd := append(bytes.Repeat([]byte{'1'}, testBS), bytes.Repeat([]byte{'2'}, testBS)...)
+	for _, tt := range []struct {
+		name string
+		want []byte
+	}{
+		{"hello", []byte("hello, world\n")},
+		{"/boot/vmlinuz-5.4", kernel},
+		{"vmlinuz", kernel},
+		{"long", kernel},
+		{"boot/initrd.img", initrd},
+		{"boot/grub/grub.cfg", []byte{}},
+	} {
+		got, err := fs.ReadFile(fsys, tt.name)
+		if err != nil {
+			t.Errorf("ReadFile(%q) = %v", tt.name, err)
+			continue
+		}
+		if !bytes.Equal(got, tt.want) {
+			t.Errorf("ReadFile(%q) = %d bytes %.20q..., want %d bytes %.20q...", tt.name, len(got), got, len(tt.want), tt.want)
+		}
+	}
+
+	if _, err := fs.ReadFile(fsys, "boot/nothing"); !os.IsNotExist(err) {
+		t.Errorf("ReadFile(boot/nothing) = %v, want not exist", err)
+	}
+	if _, err := fs.ReadFile(fsys, "hello/x"); err == nil || !strings.Contains(err.Error(), "not a directory") {
+		t.Errorf("ReadFile(hello/x) = %v, want not a directory", err)
+	}
+}
+
+func TestSymlinks(t *testing.T) {
+	fsys, err := New(bytes.NewReader(testImage()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"vmlinuz": "boot/vmlinuz-5.4",
+		"/long":   "/boot/grub/../vmlinuz-5.4",
+	} {
+		if got, err := fsys.Readlink(name); err != nil || got != want {
+			t.Errorf("Readlink(%q) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	fi, err := fsys.Lstat("vmlinuz")
+	if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Lstat(vmlinuz) = %v, %v, want a symlink", fi, err)
+	}
+	fi, err = fsys.Stat("vmlinuz")
+	if err != nil || !fi.Mode().IsRegular() || fi.Name() != "vmlinuz" || fi.Size() != 3*testBS+100 {
+		t.Errorf("Stat(vmlinuz) = %v, %v, want a regular file", fi, err)
+	}
+}
+
+func TestExtractThroughSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	victim := filepath.Join(dir, "victim")
+	if err := ioutil.WriteFile(victim, []byte("safe\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// /boot holds a symlink x out of where it is extracted to, and a
+	// file x to write through it. Opening /boot/x follows the symlink,
+	// which also has to resolve in the image.
+	img := testImage()
+	const (
+		root = testInoBlk << 3
+		boot = root + 1
+		link = root + 9
+		file = root + 10
+		evil = root + 11
+	)
+	img.inode(root, sIFDIR, formatLocal, 0, 0, shortform(root,
+		fs.Dirent{Name: "boot", Ino: boot},
+		fs.Dirent{Name: "victim", Ino: evil},
+	))
+	img.inode(evil, sIFREG, formatExtents, 13, 1, extentBytes(extent{fsb: 20, count: 1}))
+	dirBlock(img.block(16), true,
+		fs.Dirent{Name: ".", Ino: boot},
+		fs.Dirent{Name: "..", Ino: root},
+		fs.Dirent{Name: "x", Ino: link},
+		fs.Dirent{Name: "x", Ino: file},
+	)
+	img.inode(link, sIFLNK, formatLocal, 12, 0, []byte("../../victim"))
+	img.inode(file, sIFREG, formatExtents, 13, 1, extentBytes(extent{fsb: 20, count: 1}))
+	fsys, err := New(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.Extract(fsys, "/boot", filepath.Join(dir, "out", "boot")); err == nil {
+		t.Error("Extract of a directory with x twice did not fail")
+	}
+	if b, err := ioutil.ReadFile(victim); err != nil || string(b) != "safe\n" {
+		t.Errorf("victim = %q, %v, want it untouched", b, err)
+	}
+}
@@ -0,0 +1,443 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package installer writes raw disk images to block devices.
+//
+// An image is streamed from a URL or file, decompressed or converted from
+// qcow2, VHD(X) or VMDK on the fly if need be, checked against a checksum
+// as it goes by, written skipping runs of zeroes, and finally read back to
+// make sure the device holds what was written.
+package installer
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/klauspost/pgzip"
+	"github.com/u-root/u-root/pkg/qcow2"
+	"github.com/u-root/u-root/pkg/vhd"
+	"github.com/u-root/u-root/pkg/vmdk"
+)
+
+// DefaultBlockSize is the unit images are read and written in.
+const DefaultBlockSize = 1 << 20
+
+// Compression formats.
+const (
+	// Auto detects the format from the image's first bytes.
+	Auto  = "auto"
+	None  = "none"
+	Gzip  = "gzip"
+	Bzip2 = "bzip2"
+
+	// Virtual disk images are converted to raw as they are read. Fixed
+	// VHDs are raw images with a footer, and cannot be detected; Vhd
+	// must be given for them.
+	Qcow2 = "qcow2"
+	Vhd   = "vhd"
+	Vhdx  = "vhdx"
+	Vmdk  = "vmdk"
+)
+
+var magics = []struct {
+	format string
+	magic  []byte
+}{
+	{Gzip, []byte{0x1f, 0x8b}},
+	{Bzip2, []byte("BZh")},
+	{Qcow2, []byte(qcow2.Magic)},
+	{Vhd, []byte(vhd.VHDCookie)},
+	{Vhdx, []byte(vhd.VHDXSignature)},
+	{Vmdk, []byte(vmdk.Magic)},
+	// Recognized only to give a useful error.
+	{"xz", []byte{0xfd, '7', 'z', 'X', 'Z', 0}},
+	{"zstd", []byte{0x28, 0xb5, 0x2f, 0xfd}},
+}
+
+// detect returns the compression format of an image starting with b.
+func detect(b []byte) string {
+	for _, m := range magics {
+		if bytes.HasPrefix(b, m.magic) {
+			return m.format
+		}
+	}
+	return None
+}
+
+// Options say what to install where.
+type Options struct {
+	// Source is an http(s) or file URL, or a local path.
+	Source string
+
+	// Target is the block device, or file, to write to.
+	Target string
+
+	// Decompress is the source's compression or image format, Auto if
+	// empty.
+	Decompress string
+
+	// Checksum is the expected digest of Source as fetched, i.e. before
+	// decompression. It is either hex or "sha256:hex" or "sha512:hex";
+	// bare hex is told apart by length. Empty skips the check.
+	Checksum string
+
+	// Sparse skips writing blocks that are all zeroes. On block devices
+	// they are zeroed with a single request instead, which is cheap on
+	// devices that support it.
+	Sparse bool
+
+	// Verify reads the target back after writing and compares it to
+	// what was written.
+	Verify bool
+
+	// BlockSize is the size of reads and writes, DefaultBlockSize if 0.
+	BlockSize int
+
+	// Progress, if set, is called after every block.
+	Progress func(Progress)
+
+	// Client fetches http(s) sources, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Progress reports how far an installation is.
+type Progress struct {
+	// Phase is "write" or "verify".
+	Phase string
+
+	// Fetched is how many source bytes were read, Total the source's
+	// size or -1 if unknown. With compression Fetched lags Written.
+	Fetched int64
+	Total   int64
+
+	// Written is how many image bytes were written, or verified.
+	Written int64
+}
+
+// Result describes a finished installation.
+type Result struct {
+	// Size is the size of the uncompressed image.
+	Size int64
+
+	// Skipped is how many bytes were zeroed rather than written.
+	Skipped int64
+
+	// ZeroCopy is set if the kernel copied the image without it passing
+	// through this process.
+	ZeroCopy bool
+
+	// SourceDigest is the source's checksum, ImageDigest the
+	// uncompressed image's SHA-256.
+	SourceDigest string
+	ImageDigest  string
+
+	// Verified is set if the target was read back successfully.
+	Verified bool
+}
+
+// ChecksumError is returned when the source does not match
+// Options.Checksum. The target has been written to by then, so its start
+// and the backup GPT at its end are wiped to keep a corrupt image from
+// being booted.
+type ChecksumError struct {
+	Want, Got string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum mismatch: got %s, want %s", e.Got, e.Want)
+}
+
+// parseChecksum returns a hash for checksum and its expected digest.
+func parseChecksum(checksum string) (hash.Hash, string, error) {
+	if len(checksum) == 0 {
+		return sha256.New(), "", nil
+	}
+	algo, digest := "", checksum
+	if i := strings.Index(checksum, ":"); i >= 0 {
+		algo, digest = checksum[:i], checksum[i+1:]
+	}
+	digest = strings.ToLower(digest)
+	if _, err := hex.DecodeString(digest); err != nil {
+		return nil, "", fmt.Errorf("checksum %q is not hex", checksum)
+	}
+	switch {
+	case algo == "sha256" || algo == "" && len(digest) == 2*sha256.Size:
+		return sha256.New(), digest, nil
+	case algo == "sha512" || algo == "" && len(digest) == 2*sha512.Size:
+		return sha512.New(), digest, nil
+	}
+	return nil, "", fmt.Errorf("unsupported checksum %q", checksum)
+}
+
+// openSource opens o.Source and returns its size, -1 if unknown.
+func openSource(ctx context.Context, o *Options) (io.ReadCloser, int64, error) {
+	u, err := url.Parse(o.Source)
+	if err != nil || len(u.Scheme) <= 1 {
+		// Local path; a one letter "scheme" is a Windows drive, which
+		// we don't care about, but don't misparse either.
+		u = &url.URL{Scheme: "file", Path: o.Source}
+	}
+	switch u.Scheme {
+	case "file":
+		f, err := os.Open(u.Path)
+		if err != nil {
+			return nil, 0, err
+		}
+		fi, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, 0, err
+		}
+		return f, fi.Size(), nil
+
+	case "http", "https":
+		req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		c := o.Client
+		if c == nil {
+			c = http.DefaultClient
+		}
+		resp, err := c.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, 0, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, 0, fmt.Errorf("GET %s: %s", u, resp.Status)
+		}
+		return resp.Body, resp.ContentLength, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported source scheme %q", u.Scheme)
+}
+
+// decompressor wraps r according to format.
+func decompressor(format string, r io.Reader) (io.Reader, error) {
+	switch format {
+	case None:
+		return r, nil
+	case Gzip:
+		return pgzip.NewReader(r)
+	case Bzip2:
+		return bzip2.NewReader(r), nil
+	case Qcow2:
+		return qcow2.NewReader(r)
+	case Vhd, Vhdx:
+		return vhd.NewReader(r)
+	case Vmdk:
+		return vmdk.NewReader(r)
+	}
+	return nil, fmt.Errorf("%s compressed images are not supported", format)
+}
+
+// countingReader counts and hashes what is read through it.
+type countingReader struct {
+	r io.Reader
+	h hash.Hash
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	c.h.Write(p[:n])
+	return n, err
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// readBlock reads into buf until it is full or r fails. Unlike io.ReadFull,
+// it returns r's error as it is: a decompressor reports a stream that
+// breaks off as io.ErrUnexpectedEOF, which is not the end of the image.
+func readBlock(r io.Reader, buf []byte) (int, error) {
+	var n int
+	for n < len(buf) {
+		m, err := r.Read(buf[n:])
+		n += m
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Install writes the image at o.Source to o.Target.
+func Install(ctx context.Context, o Options) (*Result, error) {
+	if o.BlockSize <= 0 {
+		o.BlockSize = DefaultBlockSize
+	}
+	if len(o.Decompress) == 0 {
+		o.Decompress = Auto
+	}
+	sourceHash, wantDigest, err := parseChecksum(o.Checksum)
+	if err != nil {
+		return nil, err
+	}
+	progress := func(p Progress) {
+		if o.Progress != nil {
+			o.Progress(p)
+		}
+	}
+
+	src, total, err := openSource(ctx, &o)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	br := bufio.NewReaderSize(src, o.BlockSize)
+	if o.Decompress == Auto {
+		magic, _ := br.Peek(8)
+		o.Decompress = detect(magic)
+	}
+
+	t, err := openTarget(o.Target)
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+
+	res := &Result{}
+
+	// Nothing needs to look at the data of a plain local file, so the
+	// kernel can copy it.
+	if f, ok := src.(*os.File); ok && o.Decompress == None && len(wantDigest) == 0 && !o.Sparse {
+		n, err := t.copyFrom(f)
+		if err == nil {
+			res.Size, res.ZeroCopy = n, true
+			progress(Progress{Phase: "write", Fetched: n, Total: total, Written: n})
+		} else if n > 0 {
+			return nil, err
+		}
+		// Otherwise copying is not supported here; fall back.
+	}
+
+	imageHash := sha256.New()
+	if !res.ZeroCopy {
+		cr := &countingReader{r: br, h: sourceHash}
+		r, err := decompressor(o.Decompress, cr)
+		if err != nil {
+			return nil, err
+		}
+
+		buf := make([]byte, o.BlockSize)
+		var off int64
+		for {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			n, err := readBlock(r, buf)
+			if n > 0 {
+				b := buf[:n]
+				imageHash.Write(b)
+				if o.Sparse && isZero(b) {
+					if err := t.zero(off, int64(n)); err != nil {
+						return nil, err
+					}
+					res.Skipped += int64(n)
+				} else if _, err := t.WriteAt(b, off); err != nil {
+					return nil, err
+				}
+				off += int64(n)
+				progress(Progress{Phase: "write", Fetched: cr.n, Total: total, Written: off})
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		// Trailing data the decompressor did not need is still part
+		// of what the checksum covers.
+		if _, err := io.Copy(sourceHash, br); err != nil {
+			return nil, err
+		}
+		res.Size = off
+		res.ImageDigest = hex.EncodeToString(imageHash.Sum(nil))
+		res.SourceDigest = hex.EncodeToString(sourceHash.Sum(nil))
+	}
+
+	if err := t.finish(res.Size); err != nil {
+		return nil, err
+	}
+
+	if len(wantDigest) > 0 && res.SourceDigest != wantDigest {
+		t.wipe(res.Size, o.BlockSize)
+		return res, &ChecksumError{Want: wantDigest, Got: res.SourceDigest}
+	}
+
+	if o.Verify {
+		if res.ZeroCopy {
+			// We never saw the data; hash the source instead.
+			f := src.(*os.File)
+			if _, err := io.Copy(imageHash, io.NewSectionReader(f, 0, res.Size)); err != nil {
+				return nil, err
+			}
+			res.ImageDigest = hex.EncodeToString(imageHash.Sum(nil))
+		}
+		got, err := readBack(ctx, o.Target, res.Size, o.BlockSize, progress)
+		if err != nil {
+			return nil, err
+		}
+		if got != res.ImageDigest {
+			return res, errors.New("verification failed: the target does not hold the image that was written")
+		}
+		res.Verified = true
+	}
+	return res, nil
+}
+
+// readBack returns the SHA-256 of the first size bytes of path.
+func readBack(ctx context.Context, path string, size int64, bs int, progress func(Progress)) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	buf := make([]byte, bs)
+	var off int64
+	for off < size {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		b := buf
+		if size-off < int64(len(b)) {
+			b = b[:size-off]
+		}
+		n, err := f.ReadAt(b, off)
+		h.Write(b[:n])
+		off += int64(n)
+		if err == io.EOF && off < size {
+			return "", fmt.Errorf("%s is %d bytes, image is %d", path, off, size)
+		} else if err != nil && err != io.EOF {
+			return "", err
+		}
+		progress(Progress{Phase: "verify", Written: off, Total: size})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,263 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package installer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testImage is 3 blocks of data around 4 blocks of zeroes.
+func testImage() []byte {
+	const bs = 4096
+	img := make([]byte, 7*bs)
+	r := rand.New(rand.NewSource(1))
+	r.Read(img[:bs])
+	r.Read(img[5*bs:])
+	return img[:len(img)-100]
+}
+
+func gzipped(t *testing.T, b []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// qcow2ed returns b as a version 2 qcow2 image of 4096 byte clusters,
+// leaving clusters of zeroes unallocated.
+func qcow2ed(b []byte) []byte {
+	const cs = 4096
+	img := make([]byte, 3*cs)
+	be := binary.BigEndian
+	copy(img, "QFI\xfb")
+	be.PutUint32(img[4:], 2)
+	be.PutUint32(img[20:], 12)
+	be.PutUint64(img[24:], uint64(len(b)))
+	be.PutUint32(img[36:], 1)
+	be.PutUint64(img[40:], cs)
+	be.PutUint64(img[cs:], 2*cs)
+	for i := 0; i*cs < len(b); i++ {
+		c := b[i*cs:]
+		if len(c) > cs {
+			c = c[:cs]
+		}
+		if isZero(c) {
+			continue
+		}
+		be.PutUint64(img[2*cs+8*i:], uint64(len(img)))
+		img = append(img, make([]byte, cs)...)
+		copy(img[len(img)-cs:], c)
+	}
+	return img
+}
+
+// fixedVHD returns b as a fixed VHD: b and a footer.
+func fixedVHD(b []byte) []byte {
+	f := make([]byte, 512)
+	be := binary.BigEndian
+	copy(f, "conectix")
+	be.PutUint64(f[48:], uint64(len(b)))
+	be.PutUint32(f[60:], 2)
+	var sum uint32
+	for _, c := range f {
+		sum += uint32(c)
+	}
+	be.PutUint32(f[64:], ^sum)
+	return append(append([]byte{}, b...), f...)
+}
+
+func digest(b []byte) string {
+	s := sha256.Sum256(b)
+	return hex.EncodeToString(s[:])
+}
+
+func TestInstall(t *testing.T) {
+	dir, err := ioutil.TempDir("", "installer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	img := testImage()
+	gz := gzipped(t, img)
+	plainPath := filepath.Join(dir, "disk.img")
+	gzPath := filepath.Join(dir, "disk.img.gz")
+	qcowPath := filepath.Join(dir, "disk.qcow2")
+	vhdPath := filepath.Join(dir, "disk.vhd")
+	ioutil.WriteFile(plainPath, img, 0644)
+	ioutil.WriteFile(gzPath, gz, 0644)
+	ioutil.WriteFile(qcowPath, qcow2ed(img), 0644)
+	ioutil.WriteFile(vhdPath, fixedVHD(img), 0644)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(gz)
+	}))
+	defer srv.Close()
+
+	for _, tt := range []struct {
+		name string
+		o    Options
+	}{
+		{"plain file", Options{Source: plainPath, Verify: true}},
+		{"gzip file, sparse", Options{Source: gzPath, Sparse: true, Verify: true, BlockSize: 4096}},
+		{"gzip over http with checksum", Options{Source: srv.URL + "/disk.img.gz", Checksum: "sha256:" + digest(gz), Verify: true}},
+		{"qcow2 file, sparse", Options{Source: qcowPath, Sparse: true, Verify: true, BlockSize: 4096}},
+		{"fixed VHD", Options{Source: vhdPath, Decompress: Vhd, Verify: true}},
+		{"explicit format, odd block size", Options{Source: "file://" + gzPath, Decompress: Gzip, BlockSize: 1000, Verify: true}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.o.Target = filepath.Join(dir, "target")
+			var calls int
+			tt.o.Progress = func(Progress) { calls++ }
+
+			res, err := Install(context.Background(), tt.o)
+			if err != nil {
+				t.Fatalf("Install() = %v", err)
+			}
+			got, err := ioutil.ReadFile(tt.o.Target)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, img) {
+				t.Errorf("target differs from image (%d bytes vs %d)", len(got), len(img))
+			}
+			if res.Size != int64(len(img)) || !res.Verified {
+				t.Errorf("Install() = %+v, want size %d and verified", res, len(img))
+			}
+			if !res.ZeroCopy && res.ImageDigest != digest(img) {
+				t.Errorf("ImageDigest = %s, want %s", res.ImageDigest, digest(img))
+			}
+			if tt.o.Sparse && res.Skipped != 4*4096 {
+				t.Errorf("Skipped = %d, want %d", res.Skipped, 4*4096)
+			}
+			if calls == 0 {
+				t.Errorf("Progress was never called")
+			}
+		})
+	}
+}
+
+func TestInstallChecksumMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "installer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	img := testImage()
+	src := filepath.Join(dir, "disk.img")
+	ioutil.WriteFile(src, img, 0644)
+
+	target := filepath.Join(dir, "target")
+	_, err = Install(context.Background(), Options{
+		Source:    src,
+		Target:    target,
+		Checksum:  digest([]byte("something else")),
+		BlockSize: 4096,
+	})
+	if _, ok := err.(*ChecksumError); !ok {
+		t.Fatalf("Install() = %v, want *ChecksumError", err)
+	}
+	got, _ := ioutil.ReadFile(target)
+	if len(got) < 4096 || !isZero(got[:4096]) {
+		t.Errorf("start of target was not wiped after checksum mismatch")
+	}
+	if backup := 33 * 512; len(got) < backup || !isZero(got[len(got)-backup:]) {
+		t.Errorf("backup GPT at the end of target was not wiped after checksum mismatch")
+	}
+}
+
+// testBzip2 is "installer test image\n" 3000 times, compressed by bzip2.
+var testBzip2 = []byte("\x42\x5a\x68\x39\x31\x41\x59\x26\x53\x59\xda\x8e\x40\xb8\x00\x40\x73\xd1\x80\x00\x10\x40\x00\x22\xa7\x1c\x00\x30\x00\xb0\x10\x34\x0d\x01\x35\x54\x68\x31\x04\x0d\x03\x43\x15\x08\x5f\x54\x21\x6e\xa1\x0b\x55\x08\x5c\xd4\x21\x7b\x50\x85\xaa\x84\x2e\x6a\x10\xb3\x50\x85\x9a\x84\x2c\xd4\x21\x75\x50\x85\x8a\x84\x2d\x55\x08\x5a\xaa\x10\xb7\x50\x85\xf5\x50\x85\xed\x42\x17\xe2\xee\x48\xa7\x0a\x12\x1b\x51\xc8\x17\x00")
+
+func TestInstallTruncated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "installer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := Install(context.Background(), Options{Source: "file://" + writeSource(t, dir, testBzip2), Target: filepath.Join(dir, "target"), Verify: true}); err != nil {
+		t.Fatalf("Install() of the whole bzip2 image = %v", err)
+	}
+	if got, _ := ioutil.ReadFile(filepath.Join(dir, "target")); !bytes.Equal(got, bytes.Repeat([]byte("installer test image\n"), 3000)) {
+		t.Errorf("target differs from the bzip2 image")
+	}
+
+	gz := gzipped(t, testImage())
+	for _, tt := range []struct {
+		name string
+		src  []byte
+	}{
+		{"gzip", gz[:len(gz)/2]},
+		{"bzip2", testBzip2[:len(testBzip2)/2]},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := Install(context.Background(), Options{
+				Source:    writeSource(t, dir, tt.src),
+				Target:    filepath.Join(dir, "target"),
+				Verify:    true,
+				BlockSize: 4096,
+			})
+			if err == nil {
+				t.Errorf("Install() of a truncated image = %+v, want error", res)
+			}
+		})
+	}
+}
+
+// writeSource writes b to a source file in dir and returns its path.
+func writeSource(t *testing.T, dir string, b []byte) string {
+	p := filepath.Join(dir, "source")
+	if err := ioutil.WriteFile(p, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestParseChecksum(t *testing.T) {
+	sha256Hex := digest(nil)
+	sha512Hex := hex.EncodeToString(make([]byte, 64))
+	for _, tt := range []struct {
+		in   string
+		size int
+		ok   bool
+	}{
+		{"", 32, true},
+		{sha256Hex, 32, true},
+		{"sha256:" + sha256Hex, 32, true},
+		{sha512Hex, 64, true},
+		{"sha512:" + sha512Hex, 64, true},
+		{"md5:abcd", 0, false},
+		{"xyz", 0, false},
+		{"abcd", 0, false},
+	} {
+		h, _, err := parseChecksum(tt.in)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseChecksum(%q) = %v, want ok=%v", tt.in, err, tt.ok)
+			continue
+		}
+		if err == nil && h.Size() != tt.size {
+			t.Errorf("parseChecksum(%q) hash size = %d, want %d", tt.in, h.Size(), tt.size)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package installer
+
+import (
+	"io"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// _BLKZEROOUT is _IO(0x12, 127), which x/sys/unix does not define.
+const _BLKZEROOUT = 0x127f
+
+// target is where an image is written.
+type target struct {
+	*os.File
+
+	// block is set for block devices, which have to be zeroed
+	// explicitly; files get holes.
+	block bool
+}
+
+// openTarget opens path for writing. Block devices are opened
+// exclusively, which fails if they or one of their partitions is mounted.
+func openTarget(path string) (*target, error) {
+	fi, err := os.Stat(path)
+	if err == nil && fi.Mode()&os.ModeDevice != 0 {
+		f, err := os.OpenFile(path, os.O_WRONLY|unix.O_EXCL, 0)
+		if err != nil {
+			return nil, err
+		}
+		return &target{File: f, block: true}, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &target{File: f}, nil
+}
+
+// zero makes n bytes at off read as zeroes.
+func (t *target) zero(off, n int64) error {
+	if !t.block {
+		// The file was truncated, so anything not written is a hole.
+		return nil
+	}
+	// BLKZEROOUT wants 512 byte aligned ranges.
+	if off%512 == 0 && n%512 == 0 {
+		r := [2]uint64{uint64(off), uint64(n)}
+		if _, _, errno := unix.Syscall(unix.SYS_IOCTL, t.Fd(), _BLKZEROOUT, uintptr(unsafe.Pointer(&r[0]))); errno == 0 {
+			return nil
+		}
+	}
+	_, err := t.WriteAt(make([]byte, n), off)
+	return err
+}
+
+// copyFrom has the kernel copy all of f to the start of t.
+func (t *target) copyFrom(f *os.File) (int64, error) {
+	var roff, woff int64
+	for {
+		n, err := unix.CopyFileRange(int(f.Fd()), &roff, int(t.Fd()), &woff, 1<<30, 0)
+		if err != nil {
+			return woff, err
+		}
+		if n == 0 {
+			return woff, nil
+		}
+	}
+}
+
+// finish sets the size of file targets, flushes the data to stable
+// storage and drops it from the page cache so a read back really reads
+// the device.
+func (t *target) finish(size int64) error {
+	if !t.block {
+		if err := t.Truncate(size); err != nil {
+			return err
+		}
+	}
+	if err := t.Sync(); err != nil {
+		return err
+	}
+	return unix.Fadvise(int(t.Fd()), 0, 0, unix.FADV_DONTNEED)
+}
+
+// gptSectors is how many sectors a GPT takes at the end of a disk: the
+// backup header and 128 entries of 128 bytes in 512 byte sectors.
+const gptSectors = 33
+
+// sectorSize returns the logical sector size of t.
+func (t *target) sectorSize() int64 {
+	if t.block {
+		if n, err := unix.IoctlGetInt(int(t.Fd()), unix.BLKSSZGET); err == nil && n > 0 {
+			return int64(n)
+		}
+	}
+	return 512
+}
+
+// wipe zeroes the start of a target holding a corrupt image of size bytes,
+// so its partition table and boot loader are gone, and its end, where the
+// backup GPT that firmware and tools restore a partition table from is.
+func (t *target) wipe(size int64, bs int) {
+	if size > int64(bs) {
+		size = int64(bs)
+	}
+	t.WriteAt(make([]byte, size), 0)
+	if end, err := t.Seek(0, io.SeekEnd); err == nil {
+		n := gptSectors * t.sectorSize()
+		if n > end {
+			n = end
+		}
+		t.WriteAt(make([]byte, n), end-n)
+	}
+	t.Sync()
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"context"
+	"fmt"
+)
+
+// BMCAddr is the slave address of the BMC on the IPMB.
+const BMCAddr = 0x20
+
+// Addr addresses a management controller: the BMC, a satellite controller
+// the BMC reaches on one of its channels, or one a transit controller
+// reaches on one of its own, as ipmitool's -B and -T do. The zero Addr is
+// the BMC's LUN 0.
+type Addr struct {
+	// Channel is the channel the controller is on, 0 for the primary
+	// IPMB. It is ignored for the BMC.
+	Channel byte
+
+	// Target is the slave address of the controller; 0 and BMCAddr are
+	// the BMC.
+	Target byte
+
+	// LUN is the logical unit of the controller, from 0 to 3.
+	LUN byte
+
+	// TransitChannel and TransitTarget are the channel and slave
+	// address of the controller that Target is reached through, if any.
+	TransitChannel byte
+	TransitTarget  byte
+}
+
+func (a Addr) bmc() bool {
+	return a.Target == 0 || a.Target == BMCAddr
+}
+
+// double returns whether a is reached through a transit controller.
+func (a Addr) double() bool {
+	return !a.bmc() && a.TransitTarget != 0 && a.TransitTarget != BMCAddr
+}
+
+func (a Addr) check() error {
+	if a.LUN > 3 {
+		return fmt.Errorf("%v: LUN must be from 0 to 3", a)
+	}
+	return nil
+}
+
+func (a Addr) String() string {
+	if a.bmc() {
+		return fmt.Sprintf("BMC LUN %d", a.LUN)
+	}
+	s := fmt.Sprintf("channel %d target %#02x LUN %d", a.Channel, a.Target, a.LUN)
+	if a.double() {
+		s += fmt.Sprintf(" via channel %d target %#02x", a.TransitChannel, a.TransitTarget)
+	}
+	return s
+}
+
+// AddrTransport is a Transport that can send requests to other LUNs than
+// the BMC's 0 and to other controllers.
+type AddrTransport interface {
+	ContextTransport
+
+	// SendRecvTo is SendRecvContext for the controller at a.
+	SendRecvTo(ctx context.Context, a Addr, netfn, cmd byte, data []byte) ([]byte, error)
+}
+
+var _ AddrTransport = &IPMI{}
+
+// SendRecvTo implements AddrTransport.SendRecvTo, with the timeout of
+// WithTimeout. Requests to the BMC's LUN 0 go over any Transport, others
+// only over an AddrTransport.
+func (i *IPMI) SendRecvTo(ctx context.Context, a Addr, netfn, cmd byte, data []byte) ([]byte, error) {
+	if a.bmc() && a.LUN == 0 {
+		return i.SendRecvContext(ctx, netfn, cmd, data)
+	}
+	if err := a.check(); err != nil {
+		return nil, err
+	}
+	t, ok := i.Transport.(AddrTransport)
+	if !ok {
+		return nil, fmt.Errorf("%T cannot address %v", i.Transport, a)
+	}
+	if i.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, i.timeout)
+		defer cancel()
+	}
+	return t.SendRecvTo(ctx, a, netfn, cmd, data)
+}
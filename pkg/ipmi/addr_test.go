@@ -0,0 +1,56 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRawCmdTo(t *testing.T) {
+	f := &addrTransport{fakeTransport: fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_APP, _BMC_GET_DEVICE_ID}: {0, 0x20},
+	}}}
+	i := &IPMI{Transport: &IPMI{Transport: f}}
+
+	for _, a := range []Addr{
+		{},
+		{LUN: 2},
+		{Channel: 7, Target: 0x72},
+	} {
+		resp, err := i.RawCmdTo(a, []byte{_IPMI_NETFN_APP, _BMC_GET_DEVICE_ID})
+		if err != nil {
+			t.Fatalf("RawCmdTo(%v) = %v", a, err)
+		}
+		if want := []byte{0, 0x20}; !reflect.DeepEqual(resp, want) {
+			t.Errorf("RawCmdTo(%v) = %#x, want %#x", a, resp, want)
+		}
+	}
+	want := []Addr{{}, {LUN: 2}, {Channel: 7, Target: 0x72}}
+	if !reflect.DeepEqual(f.addrs, want) {
+		t.Errorf("RawCmdTo sent to %v, want %v", f.addrs, want)
+	}
+
+	if _, err := i.RawCmdTo(Addr{LUN: 4}, []byte{_IPMI_NETFN_APP, _BMC_GET_DEVICE_ID}); err == nil {
+		t.Error("RawCmdTo of LUN 4 did not fail")
+	}
+}
+
+func TestRawCmdToPlainTransport(t *testing.T) {
+	f := &fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_APP, _BMC_GET_DEVICE_ID}: {0, 0x20},
+	}}
+	i := &IPMI{Transport: f}
+
+	// The BMC is the BMC however it is addressed.
+	if _, err := i.RawCmdTo(Addr{Channel: 3, Target: BMCAddr}, []byte{_IPMI_NETFN_APP, _BMC_GET_DEVICE_ID}); err != nil {
+		t.Errorf("RawCmdTo(BMC) = %v", err)
+	}
+	_, err := i.RawCmdTo(Addr{Target: 0x72}, []byte{_IPMI_NETFN_APP, _BMC_GET_DEVICE_ID})
+	if err == nil || !strings.Contains(err.Error(), "cannot address channel 0 target 0x72 LUN 0") {
+		t.Errorf("RawCmdTo(0x72) = %v, want an error", err)
+	}
+}
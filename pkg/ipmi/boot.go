@@ -0,0 +1,259 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// BootDevice is a boot device selector of the boot flags System Boot
+// Options parameter, IPMI v2.0 table 28-14.
+type BootDevice byte
+
+// Boot device selectors.
+const (
+	BootDeviceNone         BootDevice = 0x0
+	BootDevicePXE          BootDevice = 0x1
+	BootDeviceDisk         BootDevice = 0x2
+	BootDeviceDiskSafeMode BootDevice = 0x3
+	BootDeviceDiagnostic   BootDevice = 0x4
+	BootDeviceCDROM        BootDevice = 0x5
+	BootDeviceBIOSSetup    BootDevice = 0x6
+	BootDeviceRemoteFloppy BootDevice = 0x7
+	BootDeviceRemoteCDROM  BootDevice = 0x8
+	BootDeviceRemoteMedia  BootDevice = 0x9
+	BootDeviceRemoteDisk   BootDevice = 0xB
+	BootDeviceFloppy       BootDevice = 0xF
+)
+
+var bootDeviceNames = map[BootDevice]string{
+	BootDeviceNone:         "no override",
+	BootDevicePXE:          "PXE",
+	BootDeviceDisk:         "disk",
+	BootDeviceDiskSafeMode: "disk, safe mode",
+	BootDeviceDiagnostic:   "diagnostic partition",
+	BootDeviceCDROM:        "CD/DVD",
+	BootDeviceBIOSSetup:    "BIOS setup",
+	BootDeviceRemoteFloppy: "remote floppy",
+	BootDeviceRemoteCDROM:  "remote CD/DVD",
+	BootDeviceRemoteMedia:  "primary remote media",
+	BootDeviceRemoteDisk:   "remote disk",
+	BootDeviceFloppy:       "floppy",
+}
+
+func (d BootDevice) String() string {
+	if s, ok := bootDeviceNames[d]; ok {
+		return s
+	}
+	return fmt.Sprintf("boot device %#x", byte(d))
+}
+
+// BIOSVerbosity is how much the BIOS prints while booting.
+type BIOSVerbosity byte
+
+// BIOS verbosities.
+const (
+	BIOSVerbosityDefault BIOSVerbosity = 0
+	BIOSVerbosityQuiet   BIOSVerbosity = 1
+	BIOSVerbosityVerbose BIOSVerbosity = 2
+)
+
+func (v BIOSVerbosity) String() string {
+	switch v {
+	case BIOSVerbosityDefault:
+		return "default"
+	case BIOSVerbosityQuiet:
+		return "quiet"
+	case BIOSVerbosityVerbose:
+		return "verbose"
+	}
+	return fmt.Sprintf("verbosity %d", byte(v))
+}
+
+// BootFlags is the boot flags System Boot Options parameter, which the BIOS
+// reads to pick what to boot.
+//
+// Flags BootFlags has no field for are kept as GetSystemBootOptions read
+// them, so that changing a field of what it returns and passing that to
+// SetSystemBootOptions leaves them be.
+type BootFlags struct {
+	// Valid says the BMC holds flags for the BIOS to act on. The BIOS
+	// or the BMC clears it once they are used, or after a timeout.
+	// SetSystemBootOptions always sets it.
+	Valid bool
+
+	// Device overrides the BIOS's boot order.
+	Device BootDevice
+
+	// Persistent applies the flags to all future boots rather than the
+	// next one only.
+	Persistent bool
+
+	// EFI asks for an EFI boot rather than a legacy one.
+	EFI bool
+
+	// Verbosity is how much the BIOS prints.
+	Verbosity BIOSVerbosity
+
+	// other are the bits of the flags not in the fields above.
+	other [bootFlagsLen]byte
+}
+
+// System Boot Options parameters and their bits, IPMI v2.0 table 28-14.
+const (
+	bootParamSetInProgress = 0
+	bootParamInfoAck       = 4
+	bootParamFlags         = 5
+
+	bootSetComplete   = 0x00
+	bootSetInProgress = 0x01
+
+	bootFlagsLen = 5
+
+	// Data byte 1.
+	bootFlagsValid      = 0x80
+	bootFlagsPersistent = 0x40
+	bootFlagsEFI        = 0x20
+
+	// Data byte 2.
+	bootDeviceShift = 2
+	bootDeviceMask  = 0xF << bootDeviceShift
+
+	// Data byte 3.
+	bootVerbosityShift = 5
+	bootVerbosityMask  = 0x3 << bootVerbosityShift
+
+	// bootParamInvalid is set in the parameter selector of a response
+	// when the parameter is locked or not yet valid.
+	bootParamInvalid = 0x80
+
+	// ccBootParamNotSupported is the completion code of a System Boot
+	// Options parameter the BMC does not implement.
+	ccBootParamNotSupported CompletionCode = 0x80
+)
+
+// marshal encodes f as the boot flags parameter.
+func (f *BootFlags) marshal() []byte {
+	b := make([]byte, bootFlagsLen)
+	copy(b, f.other[:])
+	b[0] |= bootFlagsValid
+	if f.Persistent {
+		b[0] |= bootFlagsPersistent
+	}
+	if f.EFI {
+		b[0] |= bootFlagsEFI
+	}
+	b[1] |= byte(f.Device) << bootDeviceShift & bootDeviceMask
+	b[2] |= byte(f.Verbosity) << bootVerbosityShift & bootVerbosityMask
+	return b
+}
+
+// unmarshalBootFlags decodes the boot flags parameter.
+func unmarshalBootFlags(b []byte) (*BootFlags, error) {
+	if len(b) < bootFlagsLen {
+		return nil, fmt.Errorf("boot flags of %d bytes, want %d", len(b), bootFlagsLen)
+	}
+	f := &BootFlags{
+		Valid:      b[0]&bootFlagsValid != 0,
+		Persistent: b[0]&bootFlagsPersistent != 0,
+		EFI:        b[0]&bootFlagsEFI != 0,
+		Device:     BootDevice(b[1] & bootDeviceMask >> bootDeviceShift),
+		Verbosity:  BIOSVerbosity(b[2] & bootVerbosityMask >> bootVerbosityShift),
+	}
+	copy(f.other[:], b)
+	f.other[0] &^= bootFlagsValid | bootFlagsPersistent | bootFlagsEFI
+	f.other[1] &^= bootDeviceMask
+	f.other[2] &^= bootVerbosityMask
+	return f, nil
+}
+
+// setBootParam sets a System Boot Options parameter, failing as op.
+func (i *IPMI) setBootParam(op string, param byte, data []byte) error {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_CHASSIS
+	req.msg.cmd = _BMC_SET_SYSTEM_BOOT_OPTIONS
+
+	buf := append([]byte{param}, data...)
+	req.msg.data = unsafe.Pointer(&buf[0])
+	req.msg.dataLen = uint16(len(buf))
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return err
+	}
+	return req.completion(op, recv)
+}
+
+// GetSystemBootOptions reads the boot flags.
+func (i *IPMI) GetSystemBootOptions() (*BootFlags, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_CHASSIS
+	req.msg.cmd = _BMC_GET_SYSTEM_BOOT_OPTIONS
+
+	// Parameter, set and block selectors.
+	data := [3]byte{bootParamFlags, 0, 0}
+	req.msg.data = unsafe.Pointer(&data[0])
+	req.msg.dataLen = 3
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.completion("GetSystemBootOptions", recv); err != nil {
+		return nil, err
+	}
+	// Parameter version, then the selector with the invalid bit.
+	if len(recv) < 3 {
+		return nil, fmt.Errorf("GetSystemBootOptions: short response of %d bytes", len(recv))
+	}
+	if recv[2]&bootParamInvalid != 0 {
+		return nil, fmt.Errorf("GetSystemBootOptions: boot flags are locked or invalid")
+	}
+	f, err := unmarshalBootFlags(recv[3:])
+	if err != nil {
+		return nil, fmt.Errorf("GetSystemBootOptions: %v", err)
+	}
+	return f, nil
+}
+
+// SetSystemBootOptions sets the boot flags the BIOS uses on the next boot,
+// or on every boot if f.Persistent is set. BootDeviceNone clears an
+// override. To change some flags only, change them in what
+// GetSystemBootOptions returns.
+//
+// As ipmitool does, the write is bracketed by set in progress, where the
+// BMC implements it, and the BIOS's acknowledgement is cleared so it acts
+// on the new flags.
+func (i *IPMI) SetSystemBootOptions(f *BootFlags) error {
+	if f.Device > BootDeviceFloppy {
+		return fmt.Errorf("SetSystemBootOptions: unknown boot device %v", f.Device)
+	}
+	if f.Verbosity > BIOSVerbosityVerbose {
+		return fmt.Errorf("SetSystemBootOptions: unknown BIOS %v", f.Verbosity)
+	}
+
+	err := i.setBootParam("SetSystemBootOptions: set in progress", bootParamSetInProgress, []byte{bootSetInProgress})
+	locked := err == nil
+	if !locked && !isCompletion(err, ccBootParamNotSupported) {
+		return err
+	}
+
+	// Clear the BIOS's acknowledgement, with the mask and data bytes.
+	if err = i.setBootParam("SetSystemBootOptions: boot info acknowledge", bootParamInfoAck, []byte{0x01, 0x01}); isCompletion(err, ccBootParamNotSupported) {
+		err = nil
+	}
+	if err == nil {
+		err = i.setBootParam(fmt.Sprintf("SetSystemBootOptions(%v)", f.Device), bootParamFlags, f.marshal())
+	}
+
+	if locked {
+		cerr := i.setBootParam("SetSystemBootOptions: set complete", bootParamSetInProgress, []byte{bootSetComplete})
+		if err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBootFlagsMarshal(t *testing.T) {
+	for _, tt := range []struct {
+		f    BootFlags
+		want []byte
+	}{
+		{BootFlags{}, []byte{0x80, 0x00, 0, 0, 0}},
+		{BootFlags{Device: BootDevicePXE}, []byte{0x80, 0x04, 0, 0, 0}},
+		{BootFlags{Device: BootDeviceDisk, Persistent: true}, []byte{0xc0, 0x08, 0, 0, 0}},
+		{BootFlags{Device: BootDeviceBIOSSetup, EFI: true}, []byte{0xa0, 0x18, 0, 0, 0}},
+		{BootFlags{Device: BootDeviceFloppy, Persistent: true, EFI: true}, []byte{0xe0, 0x3c, 0, 0, 0}},
+	} {
+		if got := tt.f.marshal(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v.marshal() = %#v, want %#v", tt.f, got, tt.want)
+		}
+	}
+}
+
+func TestBootFlagsUnmarshal(t *testing.T) {
+	// Valid, persistent EFI boot from disk with CMOS clear, verbose with
+	// console redirection.
+	b := []byte{0xe0, 0x88, 0x41, 0x01, 0x02}
+	f, err := unmarshalBootFlags(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.Valid || !f.Persistent || !f.EFI || f.Device != BootDeviceDisk || f.Verbosity != BIOSVerbosityVerbose {
+		t.Errorf("unmarshalBootFlags(%#v) = %+v", b, f)
+	}
+
+	// Changing the device keeps the flags BootFlags has no fields for.
+	f.Device = BootDevicePXE
+	f.Persistent = false
+	want := []byte{0xa0, 0x84, 0x41, 0x01, 0x02}
+	if got := f.marshal(); !reflect.DeepEqual(got, want) {
+		t.Errorf("marshal() = %#v, want %#v", got, want)
+	}
+
+	// A parameter that is not valid is set valid.
+	f, err = unmarshalBootFlags([]byte{0x00, 0x18, 0x20, 0, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Valid || f.Device != BootDeviceBIOSSetup || f.Verbosity != BIOSVerbosityQuiet {
+		t.Errorf("unmarshalBootFlags = %+v", f)
+	}
+	if got, want := f.marshal(), []byte{0x80, 0x18, 0x20, 0, 0}; !reflect.DeepEqual(got, want) {
+		t.Errorf("marshal() = %#v, want %#v", got, want)
+	}
+
+	if _, err := unmarshalBootFlags([]byte{0x80, 0x04}); err == nil {
+		t.Errorf("unmarshalBootFlags of 2 bytes = nil, want error")
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import "fmt"
+
+// Send Message bridging, IPMI v2.0 section 22.7: a request to a controller
+// behind the BMC goes to the BMC inside a Send Message request, which the
+// BMC passes on to the channel the controller is on. To reach a controller
+// behind that one, the request is wrapped twice.
+
+// sendMessageTrack has the BMC track a bridged request, and hand the
+// response back as if it were its own.
+const sendMessageTrack = 0x40
+
+// ipmbMessage encodes a request of netfn and cmd with data from rqSA to
+// rsSA: the connection header, its checksum, the rest and its checksum,
+// IPMI v2.0 section 5.5.
+func ipmbMessage(rsSA, netfn, rsLUN, rqSA, rqSeq, cmd byte, data []byte) []byte {
+	m := make([]byte, 0, 7+len(data))
+	m = append(m, rsSA, netfn<<2|rsLUN&3)
+	m = append(m, checksum(m))
+	m = append(m, rqSA, rqSeq<<2, cmd)
+	m = append(m, data...)
+	return append(m, checksum(m[3:]))
+}
+
+// sendMessage returns the data of a Send Message request carrying msg, an
+// ipmbMessage, to channel.
+func sendMessage(channel byte, track bool, msg []byte) []byte {
+	c := channel & 0x0F
+	if track {
+		c |= sendMessageTrack
+	}
+	return append([]byte{c}, msg...)
+}
+
+// bridged is a response embedded in the response to Send Message.
+type bridged struct {
+	netfn, cmd byte
+	// resp is the response from the completion code on.
+	resp []byte
+}
+
+// embedded returns the response embedded in resp, the response to Send
+// Message from the completion code on, if there is one. Some BMCs embed
+// the response, others send it on its own.
+func embedded(resp []byte) (*bridged, bool, error) {
+	// Completion code, then rqSA, netfn, checksum, rsSA, rqSeq, cmd,
+	// completion code and checksum.
+	if len(resp) <= 1 {
+		return nil, false, nil
+	}
+	m := resp[1:]
+	if len(m) < 8 {
+		return nil, false, fmt.Errorf("bridged response of %d bytes is too short", len(m))
+	}
+	if checksum(m[:3]) != 0 || checksum(m[3:]) != 0 {
+		return nil, false, fmt.Errorf("bridged response with bad checksum: %#x", m)
+	}
+	return &bridged{netfn: m[1] >> 2, cmd: m[5], resp: m[6 : len(m)-1]}, true, nil
+}
+
+// unbridge returns the response to netfn and cmd from resp, the response
+// to Send Message from the completion code on, unwrapping Send Message
+// responses to it as long as they embed one.
+func unbridge(a Addr, netfn, cmd byte, resp []byte) ([]byte, error) {
+	for {
+		if err := checkCompletion(fmt.Sprintf("Send Message to %v", a), _IPMI_NETFN_APP, _BMC_SEND_MESSAGE, resp); err != nil {
+			return nil, err
+		}
+		b, ok, err := embedded(resp)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("Send Message to %v: no response from the target", a)
+		}
+		if b.netfn == _IPMI_NETFN_APP|1 && b.cmd == _BMC_SEND_MESSAGE && !(netfn == _IPMI_NETFN_APP && cmd == _BMC_SEND_MESSAGE) {
+			resp = b.resp
+			continue
+		}
+		if b.netfn != netfn|1 || b.cmd != cmd {
+			return nil, fmt.Errorf("Send Message to %v: response to netfn %#02x cmd %#02x, not %#02x %#02x", a, b.netfn&^1, b.cmd, netfn, cmd)
+		}
+		return b.resp, nil
+	}
+}
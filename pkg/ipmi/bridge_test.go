@@ -0,0 +1,91 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestIPMBMessage(t *testing.T) {
+	m := ipmbMessage(0x72, _IPMI_NETFN_APP, 1, BMCAddr, 5, _BMC_GET_DEVICE_ID, []byte{0xAA})
+	want := []byte{0x72, 0x19, 0x75, 0x20, 0x14, 0x01, 0xAA, 0x21}
+	if !bytes.Equal(m, want) {
+		t.Errorf("ipmbMessage = %#x, want %#x", m, want)
+	}
+	if checksum(m[:3]) != 0 || checksum(m[3:]) != 0 {
+		t.Errorf("ipmbMessage %#x has bad checksums", m)
+	}
+	if got := sendMessage(0x17, true, m); got[0] != 0x47 || !bytes.Equal(got[1:], m) {
+		t.Errorf("sendMessage = %#x", got)
+	}
+}
+
+// response encodes a response of rsSA to netfn and cmd, from the
+// completion code on, as it is embedded in a Send Message response.
+func response(rsSA, netfn, cmd byte, resp []byte) []byte {
+	return ipmbMessage(BMCAddr, netfn|1, 0, rsSA, 0, cmd, resp)
+}
+
+func TestUnbridge(t *testing.T) {
+	a := Addr{Channel: 7, Target: 0x72}
+	devID := response(0x72, _IPMI_NETFN_APP, _BMC_GET_DEVICE_ID, []byte{0, 0x20})
+	for _, tt := range []struct {
+		name string
+		resp []byte
+		want []byte
+		err  string
+	}{
+		{
+			name: "embedded",
+			resp: append([]byte{0}, devID...),
+			want: []byte{0, 0x20},
+		},
+		{
+			name: "double",
+			resp: append([]byte{0}, response(0x82, _IPMI_NETFN_APP, _BMC_SEND_MESSAGE, append([]byte{0}, devID...))...),
+			want: []byte{0, 0x20},
+		},
+		{
+			name: "target error",
+			resp: append([]byte{0}, response(0x72, _IPMI_NETFN_APP, _BMC_GET_DEVICE_ID, []byte{0xC1})...),
+			want: []byte{0xC1},
+		},
+		{
+			name: "failed",
+			resp: []byte{0x83},
+			err:  "Send Message to channel 7 target 0x72 LUN 0: completion code 0x83",
+		},
+		{
+			name: "not embedded",
+			resp: []byte{0},
+			err:  "no response from the target",
+		},
+		{
+			name: "bad checksum",
+			resp: append([]byte{0}, append(devID[:len(devID)-1:len(devID)-1], 0)...),
+			err:  "bad checksum",
+		},
+		{
+			name: "other command",
+			resp: append([]byte{0}, response(0x72, _IPMI_NETFN_APP, _BMC_GET_WATCHDOG_TIMER, []byte{0})...),
+			err:  "not 0x06 0x01",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unbridge(a, _IPMI_NETFN_APP, _BMC_GET_DEVICE_ID, tt.resp)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("unbridge = %#x, %v, want error %q", got, err, tt.err)
+				}
+				return
+			}
+			if err != nil || !bytes.Equal(got, tt.want) {
+				t.Errorf("unbridge = %#x, %v, want %#x", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,292 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// CurrentChannel as a channel number is the channel a request comes in on.
+const CurrentChannel = 0x0E
+
+// ChannelMedium is the medium of a channel, IPMI v2.0 table 6-3.
+type ChannelMedium byte
+
+// Channel media.
+const (
+	ChannelMediumIPMB        ChannelMedium = 0x01
+	ChannelMediumICMB10      ChannelMedium = 0x02
+	ChannelMediumICMB09      ChannelMedium = 0x03
+	ChannelMediumLAN         ChannelMedium = 0x04
+	ChannelMediumSerial      ChannelMedium = 0x05
+	ChannelMediumOtherLAN    ChannelMedium = 0x06
+	ChannelMediumPCISMBus    ChannelMedium = 0x07
+	ChannelMediumSMBus11     ChannelMedium = 0x08
+	ChannelMediumSMBus20     ChannelMedium = 0x09
+	ChannelMediumUSB1        ChannelMedium = 0x0A
+	ChannelMediumUSB2        ChannelMedium = 0x0B
+	ChannelMediumSystemIface ChannelMedium = 0x0C
+)
+
+var channelMedia = map[ChannelMedium]string{
+	ChannelMediumIPMB:        "IPMB (I2C)",
+	ChannelMediumICMB10:      "ICMB v1.0",
+	ChannelMediumICMB09:      "ICMB v0.9",
+	ChannelMediumLAN:         "802.3 LAN",
+	ChannelMediumSerial:      "Serial/Modem",
+	ChannelMediumOtherLAN:    "Other LAN",
+	ChannelMediumPCISMBus:    "PCI SMBus",
+	ChannelMediumSMBus11:     "SMBus v1.0/1.1",
+	ChannelMediumSMBus20:     "SMBus v2.0",
+	ChannelMediumUSB1:        "USB 1.x",
+	ChannelMediumUSB2:        "USB 2.x",
+	ChannelMediumSystemIface: "System Interface",
+}
+
+func (m ChannelMedium) String() string {
+	if s, ok := channelMedia[m]; ok {
+		return s
+	}
+	if m >= 0x60 && m <= 0x7F {
+		return fmt.Sprintf("OEM (%#02x)", byte(m))
+	}
+	return fmt.Sprintf("Unknown (%#02x)", byte(m))
+}
+
+// ChannelProtocol is the protocol of a channel, IPMI v2.0 table 6-2.
+type ChannelProtocol byte
+
+// Channel protocols.
+const (
+	ChannelProtocolIPMB  ChannelProtocol = 0x01
+	ChannelProtocolICMB  ChannelProtocol = 0x02
+	ChannelProtocolSMBus ChannelProtocol = 0x04
+	ChannelProtocolKCS   ChannelProtocol = 0x05
+	ChannelProtocolSMIC  ChannelProtocol = 0x06
+	ChannelProtocolBT10  ChannelProtocol = 0x07
+	ChannelProtocolBT15  ChannelProtocol = 0x08
+	ChannelProtocolTMode ChannelProtocol = 0x09
+)
+
+var channelProtocols = map[ChannelProtocol]string{
+	ChannelProtocolIPMB:  "IPMB-1.0",
+	ChannelProtocolICMB:  "ICMB-1.0",
+	ChannelProtocolSMBus: "IPMI-SMBus",
+	ChannelProtocolKCS:   "KCS",
+	ChannelProtocolSMIC:  "SMIC",
+	ChannelProtocolBT10:  "BT-10",
+	ChannelProtocolBT15:  "BT-15",
+	ChannelProtocolTMode: "TMode",
+}
+
+func (p ChannelProtocol) String() string {
+	if s, ok := channelProtocols[p]; ok {
+		return s
+	}
+	if p >= 0x1C && p <= 0x1F {
+		return fmt.Sprintf("OEM %d", p-0x1B)
+	}
+	return fmt.Sprintf("Unknown (%#02x)", byte(p))
+}
+
+// SessionSupport is whether a channel carries sessions.
+type SessionSupport byte
+
+// Session support of channels.
+const (
+	SessionLess   SessionSupport = 0
+	SingleSession SessionSupport = 1
+	MultiSession  SessionSupport = 2
+	SessionBased  SessionSupport = 3
+)
+
+func (s SessionSupport) String() string {
+	switch s {
+	case SessionLess:
+		return "session-less"
+	case SingleSession:
+		return "single-session"
+	case MultiSession:
+		return "multi-session"
+	case SessionBased:
+		return "session-based"
+	}
+	return fmt.Sprintf("SessionSupport(%d)", byte(s))
+}
+
+// ChannelInfo describes a channel of the BMC.
+type ChannelInfo struct {
+	Channel        byte
+	Medium         ChannelMedium
+	Protocol       ChannelProtocol
+	SessionSupport SessionSupport
+	// ActiveSessions is how many sessions are active on the channel.
+	ActiveSessions byte
+	// VendorID is the IANA enterprise number of the body that defined
+	// Protocol, 7154 (IPMI) for the standard ones.
+	VendorID uint32
+	// Aux is the auxiliary channel information, e.g. the interrupts of
+	// the system interface.
+	Aux [2]byte
+}
+
+// GetChannelInfo returns the medium, protocol and sessions of channel, or of
+// the channel the request comes in on if it is CurrentChannel.
+func (i *IPMI) GetChannelInfo(channel byte) (*ChannelInfo, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_APP
+	req.msg.cmd = _BMC_GET_CHANNEL_INFO
+
+	data := [1]byte{channel & 0x0F}
+	req.msg.data = unsafe.Pointer(&data[0])
+	req.msg.dataLen = 1
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return nil, err
+	}
+	op := fmt.Sprintf("GetChannelInfo(%d)", channel)
+	if err := req.completion(op, recv); err != nil {
+		return nil, err
+	}
+	if len(recv) < 10 {
+		return nil, fmt.Errorf("%s: short response of %d bytes", op, len(recv))
+	}
+	c := &ChannelInfo{
+		Channel:        recv[1] & 0x0F,
+		Medium:         ChannelMedium(recv[2] & 0x7F),
+		Protocol:       ChannelProtocol(recv[3] & 0x1F),
+		SessionSupport: SessionSupport(recv[4] >> 6),
+		ActiveSessions: recv[4] & 0x3F,
+		VendorID:       uint32(recv[5]) | uint32(recv[6])<<8 | uint32(recv[7])<<16,
+	}
+	copy(c.Aux[:], recv[8:10])
+	return c, nil
+}
+
+// AuthTypes is a set of IPMI v1.5 session authentication types.
+type AuthTypes byte
+
+// Authentication types.
+const (
+	AuthTypeNone     AuthTypes = 1 << 0
+	AuthTypeMD2      AuthTypes = 1 << 1
+	AuthTypeMD5      AuthTypes = 1 << 2
+	AuthTypePassword AuthTypes = 1 << 4
+	AuthTypeOEM      AuthTypes = 1 << 5
+)
+
+var authTypeNames = []struct {
+	t    AuthTypes
+	name string
+}{
+	{AuthTypeNone, "NONE"},
+	{AuthTypeMD2, "MD2"},
+	{AuthTypeMD5, "MD5"},
+	{AuthTypePassword, "PASSWORD"},
+	{AuthTypeOEM, "OEM"},
+}
+
+func (a AuthTypes) String() string {
+	var s []string
+	for _, n := range authTypeNames {
+		if a&n.t != 0 {
+			s = append(s, n.name)
+		}
+	}
+	if len(s) == 0 {
+		return "none enabled"
+	}
+	return strings.Join(s, " ")
+}
+
+// ChannelAuthCapabilities is how a channel lets sessions log in, as a
+// remote console sees it before it opens one.
+type ChannelAuthCapabilities struct {
+	Channel byte
+	// AuthTypes are the IPMI v1.5 authentication types enabled for the
+	// requested privilege level.
+	AuthTypes AuthTypes
+
+	// IPMIv15 and IPMIv20 are whether the channel takes IPMI v1.5 and
+	// v2.0 (RMCP+) sessions. BMCs without IPMI v2.0 extended data
+	// report only IPMIv15.
+	IPMIv15 bool
+	IPMIv20 bool
+
+	// KGSet is whether the BMC key, K_G, is set rather than all zeros.
+	KGSet bool
+	// PerMessageAuth and UserLevelAuth are whether messages after
+	// activation, and those at User privilege, are authenticated.
+	PerMessageAuth bool
+	UserLevelAuth  bool
+	// NonNullUsers, NullUsers and AnonymousLogin are whether users with
+	// a name, users without one but with a password, and the null user
+	// with a null password can log in.
+	NonNullUsers   bool
+	NullUsers      bool
+	AnonymousLogin bool
+
+	// OEMID and OEMAux are the IANA enterprise number and data of the
+	// OEM authentication type.
+	OEMID  uint32
+	OEMAux byte
+}
+
+// GetChannelAuthCapabilities returns how channel, or the channel the
+// request comes in on if it is CurrentChannel, lets sessions of priv log in.
+func (i *IPMI) GetChannelAuthCapabilities(channel byte, priv Privilege) (*ChannelAuthCapabilities, error) {
+	op := fmt.Sprintf("GetChannelAuthCapabilities(%d, %v)", channel, priv)
+	// Ask for the IPMI v2.0 extended data. IPMI v1.5 BMCs may reject
+	// the bit.
+	recv, err := i.getChannelAuthCapabilities(op, 0x80|channel&0x0F, priv)
+	if isCompletion(err, CompletionInvalidDataField) {
+		recv, err = i.getChannelAuthCapabilities(op, channel&0x0F, priv)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(recv) < 9 {
+		return nil, fmt.Errorf("%s: short response of %d bytes", op, len(recv))
+	}
+	c := &ChannelAuthCapabilities{
+		Channel:        recv[1] & 0x0F,
+		AuthTypes:      AuthTypes(recv[2] & 0x37),
+		IPMIv15:        true,
+		KGSet:          recv[3]&0x20 != 0,
+		PerMessageAuth: recv[3]&0x10 == 0,
+		UserLevelAuth:  recv[3]&0x08 == 0,
+		NonNullUsers:   recv[3]&0x04 != 0,
+		NullUsers:      recv[3]&0x02 != 0,
+		AnonymousLogin: recv[3]&0x01 != 0,
+		OEMID:          uint32(recv[5]) | uint32(recv[6])<<8 | uint32(recv[7])<<16,
+		OEMAux:         recv[8],
+	}
+	// Extended capabilities are only valid with bit 7 of the
+	// authentication types.
+	if recv[2]&0x80 != 0 {
+		c.IPMIv15 = recv[4]&0x01 != 0
+		c.IPMIv20 = recv[4]&0x02 != 0
+	}
+	return c, nil
+}
+
+func (i *IPMI) getChannelAuthCapabilities(op string, channel byte, priv Privilege) ([]byte, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_APP
+	req.msg.cmd = _BMC_GET_CHANNEL_AUTH_CAPABILITIES
+
+	data := [2]byte{channel, byte(priv) & 0x0F}
+	req.msg.data = unsafe.Pointer(&data[0])
+	req.msg.dataLen = 2
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return nil, err
+	}
+	return recv, req.completion(op, recv)
+}
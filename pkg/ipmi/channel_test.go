@@ -0,0 +1,96 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestChannelInfo(t *testing.T) {
+	f := &fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_APP, _BMC_GET_CHANNEL_INFO}: {0, 0x01, 0x04, 0x01, 0x82, 0xF2, 0x1B, 0x00, 0, 0},
+	}}
+	i := &IPMI{Transport: f}
+
+	c, err := i.GetChannelInfo(CurrentChannel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ChannelInfo{Channel: 1, Medium: ChannelMediumLAN, Protocol: ChannelProtocolIPMB, SessionSupport: MultiSession, ActiveSessions: 2, VendorID: 7154}
+	if *c != want {
+		t.Errorf("GetChannelInfo = %+v, want %+v", *c, want)
+	}
+	if reqs := [][]byte{{_IPMI_NETFN_APP, _BMC_GET_CHANNEL_INFO, 0x0E}}; !reflect.DeepEqual(f.requests, reqs) {
+		t.Errorf("requests = %#x, want %#x", f.requests, reqs)
+	}
+
+	for _, tt := range []struct {
+		s    interface{ String() string }
+		want string
+	}{
+		{ChannelMediumSystemIface, "System Interface"},
+		{ChannelMedium(0x61), "OEM (0x61)"},
+		{ChannelMedium(0x20), "Unknown (0x20)"},
+		{ChannelProtocol(0x1D), "OEM 2"},
+		{SessionBased, "session-based"},
+		{AuthTypeMD5 | AuthTypePassword, "MD5 PASSWORD"},
+		{AuthTypes(0), "none enabled"},
+	} {
+		if got := tt.s.String(); got != tt.want {
+			t.Errorf("%#v.String() = %q, want %q", tt.s, got, tt.want)
+		}
+	}
+
+	f.responses[[2]byte{_IPMI_NETFN_APP, _BMC_GET_CHANNEL_INFO}] = []byte{0, 0x01, 0x04}
+	if _, err := i.GetChannelInfo(1); err == nil {
+		t.Error("GetChannelInfo with a short response did not fail")
+	}
+}
+
+func TestChannelAuthCapabilities(t *testing.T) {
+	f := &fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_APP, _BMC_GET_CHANNEL_AUTH_CAPABILITIES}: {0, 0x01, 0x95, 0x2C, 0x02, 0, 0, 0, 0},
+	}}
+	i := &IPMI{Transport: f}
+
+	c, err := i.GetChannelAuthCapabilities(1, PrivilegeAdmin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ChannelAuthCapabilities{Channel: 1, AuthTypes: AuthTypeNone | AuthTypeMD5 | AuthTypePassword, IPMIv20: true, KGSet: true, PerMessageAuth: true, NonNullUsers: true}
+	if *c != want {
+		t.Errorf("GetChannelAuthCapabilities = %+v, want %+v", *c, want)
+	}
+	if reqs := [][]byte{{_IPMI_NETFN_APP, _BMC_GET_CHANNEL_AUTH_CAPABILITIES, 0x81, 0x04}}; !reflect.DeepEqual(f.requests, reqs) {
+		t.Errorf("requests = %#x, want %#x", f.requests, reqs)
+	}
+
+	// An IPMI v1.5 BMC, with anonymous login, that rejects the IPMI v2.0
+	// extended data bit, as some do.
+	v15 := &fakeTransport{}
+	v15.handle(_IPMI_NETFN_APP, _BMC_GET_CHANNEL_AUTH_CAPABILITIES, func(data []byte) []byte {
+		if data[0]&0x80 != 0 {
+			return []byte{byte(CompletionInvalidDataField)}
+		}
+		return []byte{0, 0x01, 0x01, 0x11, 0, 0, 0, 0, 0}
+	})
+	i = &IPMI{Transport: v15}
+	c, err = i.GetChannelAuthCapabilities(CurrentChannel, PrivilegeUser)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = ChannelAuthCapabilities{Channel: 1, AuthTypes: AuthTypeNone, IPMIv15: true, UserLevelAuth: true, AnonymousLogin: true}
+	if *c != want {
+		t.Errorf("GetChannelAuthCapabilities of IPMI v1.5 = %+v, want %+v", *c, want)
+	}
+	reqs := [][]byte{
+		{_IPMI_NETFN_APP, _BMC_GET_CHANNEL_AUTH_CAPABILITIES, 0x8E, 0x02},
+		{_IPMI_NETFN_APP, _BMC_GET_CHANNEL_AUTH_CAPABILITIES, 0x0E, 0x02},
+	}
+	if !reflect.DeepEqual(v15.requests, reqs) {
+		t.Errorf("requests = %#x, want %#x", v15.requests, reqs)
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+// FrontPanelButtons is a set of front panel buttons.
+type FrontPanelButtons byte
+
+// Front panel buttons.
+const (
+	FrontPanelPowerOff      FrontPanelButtons = 1 << 0
+	FrontPanelReset         FrontPanelButtons = 1 << 1
+	FrontPanelDiagInterrupt FrontPanelButtons = 1 << 2
+	FrontPanelStandby       FrontPanelButtons = 1 << 3
+
+	FrontPanelAll = FrontPanelPowerOff | FrontPanelReset | FrontPanelDiagInterrupt | FrontPanelStandby
+)
+
+// ChassisControl is a Chassis Control action.
+type ChassisControl byte
+
+// Chassis Control actions.
+const (
+	ChassisPowerDown     ChassisControl = 0x00
+	ChassisPowerUp       ChassisControl = 0x01
+	ChassisPowerCycle    ChassisControl = 0x02
+	ChassisHardReset     ChassisControl = 0x03
+	ChassisDiagInterrupt ChassisControl = 0x04
+	ChassisSoftOff       ChassisControl = 0x05
+)
+
+var chassisControlNames = map[ChassisControl]string{
+	ChassisPowerDown:     "power down",
+	ChassisPowerUp:       "power up",
+	ChassisPowerCycle:    "power cycle",
+	ChassisHardReset:     "hard reset",
+	ChassisDiagInterrupt: "diagnostic interrupt",
+	ChassisSoftOff:       "soft off",
+}
+
+func (c ChassisControl) String() string {
+	if s, ok := chassisControlNames[c]; ok {
+		return s
+	}
+	return fmt.Sprintf("chassis control %#02x", byte(c))
+}
+
+// ChassisControl asks the BMC to act on the chassis power. Power down and
+// hard reset take effect at once, without the operating system's say, so
+// the caller must have made storage safe first; soft off instead
+// emulates an ACPI power button press and leaves shutdown to the OS. A
+// BMC may complete the command before the action is done.
+func (i *IPMI) ChassisControl(c ChassisControl) error {
+	if c > ChassisSoftOff {
+		return fmt.Errorf("ChassisControl: unknown action %v", c)
+	}
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_CHASSIS
+	req.msg.cmd = _BMC_CHASSIS_CONTROL
+
+	data := byte(c)
+	req.msg.data = unsafe.Pointer(&data)
+	req.msg.dataLen = 1
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return err
+	}
+	if err := req.completion(fmt.Sprintf("ChassisControl(%v)", c), recv); err != nil {
+		return err
+	}
+	return nil
+}
+
+const maxChassisIdentifyPeriod = 255 * time.Second
+
+// ChassisIdentify blinks the chassis identify LED for d, rounded up to the
+// second, or turns it off if d is 0. The BMC allows at most 255 seconds.
+// With force, the LED stays on until it is turned off again and d is
+// ignored. Force on is an IPMI 2.0 addition, so the force byte is only
+// sent when asked for, as IPMI 1.5 BMCs reject the longer request.
+func (i *IPMI) ChassisIdentify(d time.Duration, force bool) error {
+	if d < 0 || d > maxChassisIdentifyPeriod {
+		return fmt.Errorf("ChassisIdentify: interval %v is not within [0, %v]", d, maxChassisIdentifyPeriod)
+	}
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_CHASSIS
+	req.msg.cmd = _BMC_CHASSIS_IDENTIFY
+
+	var data [2]byte
+	data[0] = byte((d + time.Second - 1) / time.Second)
+	req.msg.dataLen = 1
+	if force {
+		data[1] = 0x01
+		req.msg.dataLen = 2
+	}
+	req.msg.data = unsafe.Pointer(&data[0])
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return err
+	}
+	err = req.completion("ChassisIdentify", recv)
+	if force && isCompletion(err, CompletionRequestDataLength, CompletionRequestDataTooLong) {
+		return fmt.Errorf("BMC does not support force on: %w", err)
+	}
+	return err
+}
+
+// SetFrontPanelEnables disables the given front panel buttons and enables
+// all others. Buttons the chassis cannot disable are ignored by the BMC.
+func (i *IPMI) SetFrontPanelEnables(disabled FrontPanelButtons) error {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_CHASSIS
+	req.msg.cmd = _BMC_SET_FRONT_PANEL_ENAB
+
+	data := byte(disabled & FrontPanelAll)
+	req.msg.data = unsafe.Pointer(&data)
+	req.msg.dataLen = 1
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return err
+	}
+	if err := req.completion("SetFrontPanelEnables", recv); err != nil {
+		return err
+	}
+	return nil
+}
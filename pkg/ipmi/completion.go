@@ -0,0 +1,155 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CompletionCode is the status a BMC answers a command with.
+type CompletionCode byte
+
+// Completion codes, IPMI v2.0 table 5-2. Codes from 0x01 to 0x7E are OEM
+// codes, and from 0x80 to 0xBE specific to the command.
+const (
+	CompletionOK                     CompletionCode = 0x00
+	CompletionNodeBusy               CompletionCode = 0xC0
+	CompletionInvalidCommand         CompletionCode = 0xC1
+	CompletionInvalidForLUN          CompletionCode = 0xC2
+	CompletionTimeout                CompletionCode = 0xC3
+	CompletionOutOfSpace             CompletionCode = 0xC4
+	CompletionReservationCanceled    CompletionCode = 0xC5
+	CompletionRequestDataTruncated   CompletionCode = 0xC6
+	CompletionRequestDataLength      CompletionCode = 0xC7
+	CompletionRequestDataTooLong     CompletionCode = 0xC8
+	CompletionParameterOutOfRange    CompletionCode = 0xC9
+	CompletionCannotReturnLength     CompletionCode = 0xCA
+	CompletionNotPresent             CompletionCode = 0xCB
+	CompletionInvalidDataField       CompletionCode = 0xCC
+	CompletionIllegalForSensor       CompletionCode = 0xCD
+	CompletionNoResponse             CompletionCode = 0xCE
+	CompletionDuplicateRequest       CompletionCode = 0xCF
+	CompletionSDRUpdateMode          CompletionCode = 0xD0
+	CompletionFirmwareUpdateMode     CompletionCode = 0xD1
+	CompletionInitializing           CompletionCode = 0xD2
+	CompletionDestinationUnavailable CompletionCode = 0xD3
+	CompletionInsufficientPrivilege  CompletionCode = 0xD4
+	CompletionNotSupportedNow        CompletionCode = 0xD5
+	CompletionSubfunctionDisabled    CompletionCode = 0xD6
+	CompletionUnspecified            CompletionCode = 0xFF
+)
+
+var completionCodes = map[CompletionCode]string{
+	CompletionOK:                     "command completed normally",
+	CompletionNodeBusy:               "node busy",
+	CompletionInvalidCommand:         "invalid command",
+	CompletionInvalidForLUN:          "command invalid for given LUN",
+	CompletionTimeout:                "timeout while processing command",
+	CompletionOutOfSpace:             "out of space",
+	CompletionReservationCanceled:    "reservation canceled or invalid reservation ID",
+	CompletionRequestDataTruncated:   "request data truncated",
+	CompletionRequestDataLength:      "request data length invalid",
+	CompletionRequestDataTooLong:     "request data field length limit exceeded",
+	CompletionParameterOutOfRange:    "parameter out of range",
+	CompletionCannotReturnLength:     "cannot return number of requested data bytes",
+	CompletionNotPresent:             "requested sensor, data, or record not present",
+	CompletionInvalidDataField:       "invalid data field in request",
+	CompletionIllegalForSensor:       "command illegal for specified sensor or record type",
+	CompletionNoResponse:             "command response could not be provided",
+	CompletionDuplicateRequest:       "cannot execute duplicated request",
+	CompletionSDRUpdateMode:          "SDR repository in update mode",
+	CompletionFirmwareUpdateMode:     "device in firmware update mode",
+	CompletionInitializing:           "BMC initialization in progress",
+	CompletionDestinationUnavailable: "destination unavailable",
+	CompletionInsufficientPrivilege:  "insufficient privilege level",
+	CompletionNotSupportedNow:        "command not supported in present state",
+	CompletionSubfunctionDisabled:    "parameter illegal because subfunction is disabled or unavailable",
+	CompletionUnspecified:            "unspecified error",
+}
+
+// String returns the description of c in the spec.
+func (c CompletionCode) String() string {
+	if s, ok := completionCodes[c]; ok {
+		return s
+	}
+	switch {
+	case c >= 0x01 && c <= 0x7E:
+		return "OEM completion code"
+	case c >= 0x80 && c <= 0xBE:
+		return "command-specific completion code"
+	}
+	return "reserved completion code"
+}
+
+// CompletionError is the error of a command a BMC did not complete
+// normally.
+type CompletionError struct {
+	// Op is what failed, such as "GetSDR(0x0001)".
+	Op string
+
+	NetFn byte
+	Cmd   byte
+	Code  CompletionCode
+}
+
+func (e *CompletionError) Error() string {
+	op := e.Op
+	if op == "" {
+		op = fmt.Sprintf("netfn %#02x cmd %#02x", e.NetFn, e.Cmd)
+	}
+	return fmt.Sprintf("%s: completion code %#02x (%v)", op, byte(e.Code), e.Code)
+}
+
+// Completion returns the completion code of a CompletionError in err's
+// chain, as in
+//
+//	if cc, ok := ipmi.Completion(err); ok && cc == ipmi.CompletionInvalidCommand {
+//		// The BMC does not have the command.
+//	}
+func Completion(err error) (CompletionCode, bool) {
+	var e *CompletionError
+	if errors.As(err, &e) {
+		return e.Code, true
+	}
+	return 0, false
+}
+
+// isCompletion returns whether err is a CompletionError with one of codes.
+func isCompletion(err error, codes ...CompletionCode) bool {
+	cc, ok := Completion(err)
+	if !ok {
+		return false
+	}
+	for _, c := range codes {
+		if cc == c {
+			return true
+		}
+	}
+	return false
+}
+
+// tooLarge returns whether err is that of a request for more than the BMC
+// can take or return at once.
+func tooLarge(err error) bool {
+	return isCompletion(err, CompletionRequestDataTooLong, CompletionRequestDataLength, CompletionCannotReturnLength)
+}
+
+// checkCompletion returns nil if resp, the response to netfn and cmd of
+// op, has a completion code of 0, or an error.
+func checkCompletion(op string, netfn, cmd byte, resp []byte) error {
+	if len(resp) == 0 {
+		return fmt.Errorf("%s: empty response", op)
+	}
+	if cc := CompletionCode(resp[0]); cc != CompletionOK {
+		return &CompletionError{Op: op, NetFn: netfn, Cmd: cmd, Code: cc}
+	}
+	return nil
+}
+
+// completion is checkCompletion for the response to r.
+func (r *req) completion(op string, resp []byte) error {
+	return checkCompletion(op, r.msg.netfn, r.msg.cmd, resp)
+}
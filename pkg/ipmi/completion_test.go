@@ -0,0 +1,63 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestCompletionCodeString(t *testing.T) {
+	for _, tt := range []struct {
+		c    CompletionCode
+		want string
+	}{
+		{CompletionInvalidCommand, "invalid command"},
+		{CompletionTimeout, "timeout while processing command"},
+		{0x42, "OEM completion code"},
+		{0x81, "command-specific completion code"},
+		{0xE0, "reserved completion code"},
+	} {
+		if got := tt.c.String(); got != tt.want {
+			t.Errorf("CompletionCode(%#02x).String() = %q, want %q", byte(tt.c), got, tt.want)
+		}
+	}
+}
+
+func TestCompletionError(t *testing.T) {
+	f := &fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_STORAGE, _BMC_GET_SEL_TIME}: {byte(CompletionTimeout)},
+		{_IPMI_NETFN_APP, _BMC_GET_DEVICE_ID}:    {},
+	}}
+	i := &IPMI{Transport: f}
+
+	_, err := i.GetSELTime()
+	var e *CompletionError
+	if !errors.As(err, &e) {
+		t.Fatalf("GetSELTime = %v, want a CompletionError", err)
+	}
+	if e.NetFn != _IPMI_NETFN_STORAGE || e.Cmd != _BMC_GET_SEL_TIME || e.Code != CompletionTimeout {
+		t.Errorf("GetSELTime = %+v, want netfn %#02x, cmd %#02x, code %#02x", e, _IPMI_NETFN_STORAGE, _BMC_GET_SEL_TIME, CompletionTimeout)
+	}
+	if got, want := err.Error(), "GetSELTime: completion code 0xc3 (timeout while processing command)"; got != want {
+		t.Errorf("GetSELTime = %q, want %q", got, want)
+	}
+
+	// Not in the table, so invalid command.
+	err = i.ChassisControl(ChassisPowerCycle)
+	if cc, ok := Completion(fmt.Errorf("power cycle: %w", err)); !ok || cc != CompletionInvalidCommand {
+		t.Errorf("Completion(ChassisControl) = %#02x, %t, want %#02x", byte(cc), ok, CompletionInvalidCommand)
+	}
+
+	// An empty response is not a completion code.
+	_, err = i.GetDeviceID()
+	if err == nil {
+		t.Fatal("GetDeviceID of an empty response did not fail")
+	}
+	if cc, ok := Completion(err); ok {
+		t.Errorf("Completion(GetDeviceID) = %#02x, want none", byte(cc))
+	}
+}
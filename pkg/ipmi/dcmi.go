@@ -0,0 +1,310 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DCMI commands, DCMI v1.5 section 6.
+const (
+	// dcmiID is the group extension that starts the data of DCMI
+	// requests and responses.
+	dcmiID = 0xDC
+
+	_DCMI_GET_CAPABILITIES     = 0x01
+	_DCMI_GET_POWER_READING    = 0x02
+	_DCMI_GET_POWER_LIMIT      = 0x03
+	_DCMI_SET_POWER_LIMIT      = 0x04
+	_DCMI_ACTIVATE_POWER_LIMIT = 0x05
+	_DCMI_GET_ASSET_TAG        = 0x06
+	_DCMI_SET_ASSET_TAG        = 0x08
+
+	// Parameters of Get DCMI Capabilities Info.
+	dcmiCapabilitiesSupported = 1
+	dcmiCapabilitiesMandatory = 2
+
+	dcmiPowerReadingSystem     = 1
+	dcmiPowerMeasurementActive = 0x40
+
+	// Asset tags are up to 64 bytes, read and written 16 at a time.
+	dcmiAssetTagMaxLen  = 64
+	dcmiAssetTagMaxPart = 16
+
+	ccDCMINoPowerLimit          CompletionCode = 0x80
+	ccDCMIPowerLimitOutOfRange  CompletionCode = 0x84
+	ccDCMICorrectionOutOfRange  CompletionCode = 0x85
+	ccDCMISamplingPeriodInvalid CompletionCode = 0x89
+)
+
+// ErrNoPowerLimit is returned by GetPowerLimit if no power limit is set.
+var ErrNoPowerLimit = errors.New("no power limit is set")
+
+// DCMICapabilities are the DCMI capabilities of a BMC.
+type DCMICapabilities struct {
+	// Major and Minor are the DCMI version, e.g. 1 and 5.
+	Major, Minor byte
+
+	// PowerManagement is set if the BMC measures and limits power.
+	PowerManagement bool
+
+	// Channels the BMC can be reached on.
+	InBand       bool // the system interface
+	SerialTMode  bool
+	SecondaryLAN bool
+	PrimaryLAN   bool
+	SOL          bool
+	VLAN         bool
+
+	// SELEntries is the number of SEL entries, and SELOverflowFlush set
+	// if the BMC flushes the SEL when it is full.
+	SELEntries       int
+	SELOverflowFlush bool
+
+	// Identification the BMC supports.
+	AssetTag bool
+	HostName bool // DHCP host name
+	GUID     bool
+
+	// Temperatures the BMC monitors, and how often, 0 if it does not say.
+	BaseboardTemperature bool
+	ProcessorTemperature bool
+	InletTemperature     bool
+	TemperatureSampling  time.Duration
+}
+
+func (i *IPMI) dcmiCmd(op string, cmd byte, data []byte) ([]byte, error) {
+	return i.groupCmd(op, dcmiID, cmd, data)
+}
+
+// getDCMICapabilities returns the data of parameter param of Get DCMI
+// Capabilities Info, after the version and parameter revision.
+func (i *IPMI) getDCMICapabilities(c *DCMICapabilities, param byte) ([]byte, error) {
+	b, err := i.dcmiCmd(fmt.Sprintf("GetDCMICapabilities(%d)", param), _DCMI_GET_CAPABILITIES, []byte{param})
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 3 {
+		return nil, fmt.Errorf("GetDCMICapabilities(%d): short response of %d bytes", param, len(b))
+	}
+	c.Major, c.Minor = b[0], b[1]
+	return b[3:], nil
+}
+
+// GetDCMICapabilities returns the DCMI capabilities of the BMC, an error if
+// it does not implement DCMI.
+func (i *IPMI) GetDCMICapabilities() (*DCMICapabilities, error) {
+	c := &DCMICapabilities{}
+	b, err := i.getDCMICapabilities(c, dcmiCapabilitiesSupported)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 3 {
+		return nil, fmt.Errorf("GetDCMICapabilities: short capabilities of %d bytes", len(b))
+	}
+	c.PowerManagement = b[1]&0x01 != 0
+	c.InBand = b[2]&0x01 != 0
+	c.SerialTMode = b[2]&0x02 != 0
+	c.SecondaryLAN = b[2]&0x04 != 0
+	c.PrimaryLAN = b[2]&0x08 != 0
+	c.SOL = b[2]&0x10 != 0
+	c.VLAN = b[2]&0x20 != 0
+
+	if b, err = i.getDCMICapabilities(c, dcmiCapabilitiesMandatory); err != nil {
+		return nil, err
+	}
+	if len(b) < 5 {
+		return nil, fmt.Errorf("GetDCMICapabilities: short platform attributes of %d bytes", len(b))
+	}
+	sel := binary.LittleEndian.Uint16(b[0:2])
+	c.SELEntries = int(sel & 0x0FFF)
+	c.SELOverflowFlush = sel&0x8000 != 0
+	c.GUID = b[2]&0x04 != 0
+	c.HostName = b[2]&0x02 != 0
+	c.AssetTag = b[2]&0x01 != 0
+	c.BaseboardTemperature = b[3]&0x04 != 0
+	c.ProcessorTemperature = b[3]&0x02 != 0
+	c.InletTemperature = b[3]&0x01 != 0
+	c.TemperatureSampling = time.Duration(b[4]) * time.Second
+	return c, nil
+}
+
+// PowerReading is the power the system draws, in watts, as the BMC
+// measured it over a period.
+type PowerReading struct {
+	Current, Min, Max, Average uint16
+	// Time is when the BMC took the reading, and Period what Min, Max
+	// and Average are over.
+	Time   time.Time
+	Period time.Duration
+	// Active is set if the BMC is measuring power.
+	Active bool
+}
+
+// GetPowerReading returns the power the system draws.
+func (i *IPMI) GetPowerReading() (*PowerReading, error) {
+	b, err := i.dcmiCmd("GetPowerReading", _DCMI_GET_POWER_READING, []byte{dcmiPowerReadingSystem, 0, 0})
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 17 {
+		return nil, fmt.Errorf("GetPowerReading: short response of %d bytes", len(b))
+	}
+	return &PowerReading{
+		Current: binary.LittleEndian.Uint16(b[0:2]),
+		Min:     binary.LittleEndian.Uint16(b[2:4]),
+		Max:     binary.LittleEndian.Uint16(b[4:6]),
+		Average: binary.LittleEndian.Uint16(b[6:8]),
+		Time:    time.Unix(int64(binary.LittleEndian.Uint32(b[8:12])), 0),
+		Period:  time.Duration(binary.LittleEndian.Uint32(b[12:16])) * time.Millisecond,
+		Active:  b[16]&dcmiPowerMeasurementActive != 0,
+	}, nil
+}
+
+// PowerLimitAction is what the BMC does when the power limit cannot be kept
+// to within the correction time.
+type PowerLimitAction byte
+
+// Power limit exception actions.
+const (
+	PowerLimitNoAction PowerLimitAction = 0x00
+	PowerLimitPowerOff PowerLimitAction = 0x01
+	PowerLimitLogSEL   PowerLimitAction = 0x11
+)
+
+func (a PowerLimitAction) String() string {
+	switch a {
+	case PowerLimitNoAction:
+		return "No Action"
+	case PowerLimitPowerOff:
+		return "Hard Power Off & Log Event to SEL"
+	case PowerLimitLogSEL:
+		return "Log Event to SEL"
+	}
+	return fmt.Sprintf("OEM (%#02x)", byte(a))
+}
+
+// PowerLimit is a limit to the power the system draws.
+type PowerLimit struct {
+	// Action is what the BMC does if the system draws more than Limit
+	// watts for longer than Correction.
+	Action     PowerLimitAction
+	Limit      uint16
+	Correction time.Duration
+	// Sampling is how often the BMC measures the power, in seconds.
+	Sampling time.Duration
+}
+
+// GetPowerLimit returns the power limit, or ErrNoPowerLimit if none is set.
+// Whether it is applied is up to ActivatePowerLimit.
+func (i *IPMI) GetPowerLimit() (*PowerLimit, error) {
+	b, err := i.dcmiCmd("GetPowerLimit", _DCMI_GET_POWER_LIMIT, []byte{0, 0})
+	if isCompletion(err, ccDCMINoPowerLimit) {
+		return nil, ErrNoPowerLimit
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 13 {
+		return nil, fmt.Errorf("GetPowerLimit: short response of %d bytes", len(b))
+	}
+	return &PowerLimit{
+		Action:     PowerLimitAction(b[2]),
+		Limit:      binary.LittleEndian.Uint16(b[3:5]),
+		Correction: time.Duration(binary.LittleEndian.Uint32(b[5:9])) * time.Millisecond,
+		Sampling:   time.Duration(binary.LittleEndian.Uint16(b[11:13])) * time.Second,
+	}, nil
+}
+
+// SetPowerLimit sets the power limit to l. It is applied once
+// ActivatePowerLimit activates it.
+func (i *IPMI) SetPowerLimit(l *PowerLimit) error {
+	if l.Correction < 0 || l.Correction/time.Millisecond > 0xFFFFFFFF {
+		return fmt.Errorf("SetPowerLimit: correction time %v is out of range", l.Correction)
+	}
+	if l.Sampling < 0 || l.Sampling/time.Second > 0xFFFF {
+		return fmt.Errorf("SetPowerLimit: sampling period %v is out of range", l.Sampling)
+	}
+	var data [14]byte
+	data[3] = byte(l.Action)
+	binary.LittleEndian.PutUint16(data[4:6], l.Limit)
+	binary.LittleEndian.PutUint32(data[6:10], uint32(l.Correction/time.Millisecond))
+	binary.LittleEndian.PutUint16(data[12:14], uint16(l.Sampling/time.Second))
+	_, err := i.dcmiCmd("SetPowerLimit", _DCMI_SET_POWER_LIMIT, data[:])
+	switch {
+	case isCompletion(err, ccDCMIPowerLimitOutOfRange):
+		return fmt.Errorf("power limit of %dW is out of range: %w", l.Limit, err)
+	case isCompletion(err, ccDCMICorrectionOutOfRange):
+		return fmt.Errorf("correction time %v is out of range: %w", l.Correction, err)
+	case isCompletion(err, ccDCMISamplingPeriodInvalid):
+		return fmt.Errorf("sampling period %v is out of range: %w", l.Sampling, err)
+	}
+	return err
+}
+
+// ActivatePowerLimit applies the power limit, or stops applying it if
+// active is false.
+func (i *IPMI) ActivatePowerLimit(active bool) error {
+	var on byte
+	if active {
+		on = 1
+	}
+	_, err := i.dcmiCmd(fmt.Sprintf("ActivatePowerLimit(%t)", active), _DCMI_ACTIVATE_POWER_LIMIT, []byte{on, 0, 0})
+	return err
+}
+
+// GetAssetTag returns the asset tag of the system.
+func (i *IPMI) GetAssetTag() (string, error) {
+	var tag []byte
+	for total := dcmiAssetTagMaxPart; len(tag) < total; {
+		n := total - len(tag)
+		if n > dcmiAssetTagMaxPart {
+			n = dcmiAssetTagMaxPart
+		}
+		b, err := i.dcmiCmd(fmt.Sprintf("GetAssetTag(%d)", len(tag)), _DCMI_GET_ASSET_TAG, []byte{byte(len(tag)), byte(n)})
+		if err != nil {
+			return "", err
+		}
+		if len(b) < 1 {
+			return "", fmt.Errorf("GetAssetTag: short response")
+		}
+		total = int(b[0])
+		if total > dcmiAssetTagMaxLen {
+			return "", fmt.Errorf("GetAssetTag: asset tag of %d bytes is longer than %d", total, dcmiAssetTagMaxLen)
+		}
+		if len(b) == 1 && len(tag) < total {
+			return "", fmt.Errorf("GetAssetTag: no data at %d of %d bytes", len(tag), total)
+		}
+		tag = append(tag, b[1:]...)
+	}
+	// Tags are UTF-8, some with a byte order mark.
+	return strings.TrimPrefix(string(tag), "\uFEFF"), nil
+}
+
+// SetAssetTag sets the asset tag of the system to tag, of up to 64 bytes.
+func (i *IPMI) SetAssetTag(tag string) error {
+	if len(tag) > dcmiAssetTagMaxLen {
+		return fmt.Errorf("SetAssetTag: %q is longer than %d bytes", tag, dcmiAssetTagMaxLen)
+	}
+	// An empty tag is set by writing nothing at 0.
+	off := 0
+	for {
+		n := len(tag) - off
+		if n > dcmiAssetTagMaxPart {
+			n = dcmiAssetTagMaxPart
+		}
+		data := append([]byte{byte(off), byte(n)}, tag[off:off+n]...)
+		if _, err := i.dcmiCmd(fmt.Sprintf("SetAssetTag(%d)", off), _DCMI_SET_ASSET_TAG, data); err != nil {
+			return err
+		}
+		if off += n; off >= len(tag) {
+			return nil
+		}
+	}
+}
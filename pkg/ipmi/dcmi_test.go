@@ -0,0 +1,170 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// dcmiBMC returns a DCMI 1.5 BMC that keeps an asset tag, starting as tag,
+// and a power limit.
+func dcmiBMC(tag []byte) *fakeTransport {
+	f := &fakeTransport{}
+	dcmi := func(cmd byte, h func(data []byte) []byte) {
+		f.handle(_IPMI_NETFN_GROUP_EXTENSION, cmd, groupExtension(dcmiID, h))
+	}
+	ok := func(b ...byte) []byte {
+		return append([]byte{0, dcmiID}, b...)
+	}
+	var limit []byte
+
+	dcmi(_DCMI_GET_CAPABILITIES, func(data []byte) []byte {
+		switch data[0] {
+		case dcmiCapabilitiesSupported:
+			return ok(1, 5, 2, 0, 0x01, 0x29)
+		case dcmiCapabilitiesMandatory:
+			return ok(1, 5, 2, 0x00, 0x84, 0x01, 0x05, 30)
+		}
+		return []byte{byte(CompletionParameterOutOfRange)}
+	})
+	dcmi(_DCMI_GET_POWER_READING, func([]byte) []byte {
+		return ok(0xC8, 0, 0x64, 0, 0x2C, 0x01, 0x96, 0, 0x00, 0xE1, 0xF5, 0x05, 0xE8, 0x03, 0, 0, 0x40)
+	})
+	dcmi(_DCMI_GET_POWER_LIMIT, func([]byte) []byte {
+		if limit == nil {
+			return []byte{byte(ccDCMINoPowerLimit)}
+		}
+		return ok(limit...)
+	})
+	dcmi(_DCMI_SET_POWER_LIMIT, func(data []byte) []byte {
+		if data[4] == 0 && data[5] == 0 {
+			return []byte{byte(ccDCMIPowerLimitOutOfRange)}
+		}
+		limit = append([]byte{}, data[1:]...)
+		return ok(0)
+	})
+	dcmi(_DCMI_ACTIVATE_POWER_LIMIT, func([]byte) []byte {
+		return ok()
+	})
+	dcmi(_DCMI_GET_ASSET_TAG, func(data []byte) []byte {
+		off, n := int(data[0]), int(data[1])
+		if n > 16 {
+			return []byte{byte(CompletionParameterOutOfRange)}
+		}
+		if off+n > len(tag) {
+			n = len(tag) - off
+		}
+		return append(ok(byte(len(tag))), tag[off:off+n]...)
+	})
+	dcmi(_DCMI_SET_ASSET_TAG, func(data []byte) []byte {
+		off, n := int(data[0]), int(data[1])
+		if n > 16 || len(data) != 2+n || off > len(tag) {
+			return []byte{byte(CompletionParameterOutOfRange)}
+		}
+		tag = append(tag[:off], data[2:]...)
+		return ok(byte(len(tag)))
+	})
+	return f
+}
+
+func TestGetDCMICapabilities(t *testing.T) {
+	i := &IPMI{Transport: dcmiBMC(nil)}
+	c, err := i.GetDCMICapabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &DCMICapabilities{
+		Major:                1,
+		Minor:                5,
+		PowerManagement:      true,
+		InBand:               true,
+		PrimaryLAN:           true,
+		VLAN:                 true,
+		SELEntries:           0x400,
+		SELOverflowFlush:     true,
+		AssetTag:             true,
+		BaseboardTemperature: true,
+		InletTemperature:     true,
+		TemperatureSampling:  30 * time.Second,
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("GetDCMICapabilities = %+v, want %+v", c, want)
+	}
+
+	// Not a DCMI BMC.
+	i = &IPMI{Transport: &fakeTransport{}}
+	if _, err := i.GetDCMICapabilities(); !isCompletion(err, CompletionInvalidCommand) {
+		t.Errorf("GetDCMICapabilities without DCMI = %v, want invalid command", err)
+	}
+}
+
+func TestGetPowerReading(t *testing.T) {
+	i := &IPMI{Transport: dcmiBMC(nil)}
+	r, err := i.GetPowerReading()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &PowerReading{
+		Current: 200,
+		Min:     100,
+		Max:     300,
+		Average: 150,
+		Time:    time.Unix(100000000, 0),
+		Period:  time.Second,
+		Active:  true,
+	}
+	if !reflect.DeepEqual(r, want) {
+		t.Errorf("GetPowerReading = %+v, want %+v", r, want)
+	}
+}
+
+func TestPowerLimit(t *testing.T) {
+	i := &IPMI{Transport: dcmiBMC(nil)}
+	if _, err := i.GetPowerLimit(); err != ErrNoPowerLimit {
+		t.Errorf("GetPowerLimit = %v, want %v", err, ErrNoPowerLimit)
+	}
+	l := &PowerLimit{Action: PowerLimitLogSEL, Limit: 450, Correction: 6 * time.Second, Sampling: time.Minute}
+	if err := i.SetPowerLimit(l); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.ActivatePowerLimit(true); err != nil {
+		t.Fatal(err)
+	}
+	got, err := i.GetPowerLimit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, l) {
+		t.Errorf("GetPowerLimit = %+v, want %+v", got, l)
+	}
+	if err := i.SetPowerLimit(&PowerLimit{}); !isCompletion(err, ccDCMIPowerLimitOutOfRange) || !strings.HasPrefix(err.Error(), "power limit of 0W is out of range") {
+		t.Errorf("SetPowerLimit(0W) = %v", err)
+	}
+	if err := i.SetPowerLimit(&PowerLimit{Limit: 1, Sampling: 20 * time.Hour}); err == nil {
+		t.Error("SetPowerLimit with a sampling period of 20h did not fail")
+	}
+}
+
+func TestAssetTag(t *testing.T) {
+	i := &IPMI{Transport: dcmiBMC([]byte("\xEF\xBB\xBFrack-7"))}
+	if tag, err := i.GetAssetTag(); err != nil || tag != "rack-7" {
+		t.Errorf("GetAssetTag = %q, %v, want rack-7", tag, err)
+	}
+
+	for _, tag := range []string{"a-tag-of-more-than-16-bytes-but-less-than-64", "", "short"} {
+		if err := i.SetAssetTag(tag); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := i.GetAssetTag(); err != nil || got != tag {
+			t.Errorf("GetAssetTag after SetAssetTag(%q) = %q, %v", tag, got, err)
+		}
+	}
+	if err := i.SetAssetTag(strings.Repeat("x", 65)); err == nil {
+		t.Error("SetAssetTag of 65 bytes did not fail")
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"context"
+	"sync"
+)
+
+// demux matches responses to requests by message ID, so that goroutines
+// can have requests outstanding on one device at once. Whichever of them
+// is reading hands each response to the request it answers.
+type demux struct {
+	mu      sync.Mutex
+	next    int64
+	pending map[int64]chan []byte
+
+	// reading is full while a goroutine reads.
+	reading chan struct{}
+}
+
+func newDemux() *demux {
+	return &demux{
+		pending: make(map[int64]chan []byte),
+		reading: make(chan struct{}, 1),
+	}
+}
+
+// register returns the message ID of a new request, whose response
+// await waits for.
+func (m *demux) register() int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.next++
+	m.pending[m.next] = make(chan []byte, 1)
+	return m.next
+}
+
+// forget drops request id, whose response will not be awaited.
+func (m *demux) forget(id int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.pending, id)
+}
+
+// await returns the response to request id, reading responses with read
+// while no other goroutine does, until ctx is done. Responses to requests
+// no longer awaited, as they timed out, are dropped.
+func (m *demux) await(ctx context.Context, id int64, read func(context.Context) (int64, []byte, error)) ([]byte, error) {
+	m.mu.Lock()
+	c := m.pending[id]
+	m.mu.Unlock()
+	defer m.forget(id)
+
+	for {
+		select {
+		case resp := <-c:
+			return resp, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case m.reading <- struct{}{}:
+		}
+
+		// The response may have come in while another goroutine
+		// was reading.
+		select {
+		case resp := <-c:
+			<-m.reading
+			return resp, nil
+		default:
+		}
+		rid, resp, err := read(ctx)
+		<-m.reading
+		if err != nil {
+			return nil, err
+		}
+		m.mu.Lock()
+		if rc, ok := m.pending[rid]; ok {
+			select {
+			case rc <- resp:
+			default:
+				// A duplicate.
+			}
+		}
+		m.mu.Unlock()
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDriver answers requests in the order it is told to, as a BMC may.
+type fakeDriver struct {
+	responses chan int64
+}
+
+func (f *fakeDriver) read(ctx context.Context) (int64, []byte, error) {
+	select {
+	case id := <-f.responses:
+		return id, []byte(fmt.Sprint(id)), nil
+	case <-ctx.Done():
+		return 0, nil, ctx.Err()
+	}
+}
+
+func TestDemux(t *testing.T) {
+	m := newDemux()
+	f := &fakeDriver{responses: make(chan int64, 16)}
+
+	const n = 8
+	ids := make([]int64, n)
+	for i := range ids {
+		ids[i] = m.register()
+	}
+	// A response to a request that timed out, and responses in reverse.
+	stale := m.register()
+	m.forget(stale)
+	f.responses <- stale
+	for i := n - 1; i >= 0; i-- {
+		f.responses <- ids[i]
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for _, id := range ids {
+		wg.Add(1)
+		go func(id int64) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+			resp, err := m.await(ctx, id, f.read)
+			if err == nil && string(resp) != fmt.Sprint(id) {
+				err = fmt.Errorf("request %d got response %s", id, resp)
+			}
+			errs <- err
+		}(id)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if len(m.pending) != 0 {
+		t.Errorf("%d requests still pending", len(m.pending))
+	}
+}
+
+func TestDemuxTimeout(t *testing.T) {
+	m := newDemux()
+	f := &fakeDriver{responses: make(chan int64, 2)}
+	id := m.register()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := m.await(ctx, id, f.read); err != context.DeadlineExceeded {
+		t.Errorf("await = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Its late response does not reach the next request.
+	f.responses <- id
+	next := m.register()
+	f.responses <- next
+	resp, err := m.await(context.Background(), next, f.read)
+	if err != nil || string(resp) != fmt.Sprint(next) {
+		t.Errorf("await = %s, %v, want %d", resp, err, next)
+	}
+
+	broken := errors.New("broken")
+	id = m.register()
+	if _, err := m.await(context.Background(), id, func(context.Context) (int64, []byte, error) {
+		return 0, nil, broken
+	}); err != broken {
+		t.Errorf("await = %v, want %v", err, broken)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"fmt"
+)
+
+// EventReceiver is the controller a controller sends the event messages
+// it generates to, IPMI v2.0 section 29.1. It is usually the BMC, which
+// logs them in the SEL and runs them through PEF.
+type EventReceiver struct {
+	// Target is the slave address of the receiver, or
+	// EventReceiverDisabled.
+	Target byte
+	LUN    byte
+}
+
+// EventReceiverDisabled as the Target of an EventReceiver stops the
+// controller from generating event messages.
+const EventReceiverDisabled = 0xFF
+
+func (r EventReceiver) String() string {
+	if r.Target == EventReceiverDisabled {
+		return "disabled"
+	}
+	return fmt.Sprintf("target %#02x LUN %d", r.Target, r.LUN)
+}
+
+// SetEventReceiver points the event messages of the controller at a to r.
+// Controllers also take the address of the BMC that sets it as theirs at
+// reset, so this is for pointing them elsewhere, e.g. at a shelf manager,
+// or back at a replaced BMC.
+func (i *IPMI) SetEventReceiver(a Addr, r EventReceiver) error {
+	if r.LUN > 3 {
+		return fmt.Errorf("SetEventReceiver: LUN %d is not within [0, 3]", r.LUN)
+	}
+	recv, err := i.RawCmdTo(a, []byte{_IPMI_NETFN_SENSOR_EVENT, _BMC_SET_EVENT_RECEIVER, r.Target, r.LUN})
+	if err != nil {
+		return err
+	}
+	return checkCompletion(fmt.Sprintf("SetEventReceiver(%v)", a), _IPMI_NETFN_SENSOR_EVENT, _BMC_SET_EVENT_RECEIVER, recv)
+}
+
+// GetEventReceiver returns where the controller at a sends its event
+// messages.
+func (i *IPMI) GetEventReceiver(a Addr) (EventReceiver, error) {
+	op := fmt.Sprintf("GetEventReceiver(%v)", a)
+	recv, err := i.RawCmdTo(a, []byte{_IPMI_NETFN_SENSOR_EVENT, _BMC_GET_EVENT_RECEIVER})
+	if err != nil {
+		return EventReceiver{}, err
+	}
+	if err := checkCompletion(op, _IPMI_NETFN_SENSOR_EVENT, _BMC_GET_EVENT_RECEIVER, recv); err != nil {
+		return EventReceiver{}, err
+	}
+	if len(recv) < 3 {
+		return EventReceiver{}, fmt.Errorf("%s: short response of %d bytes", op, len(recv))
+	}
+	return EventReceiver{Target: recv[1], LUN: recv[2] & 0x3}, nil
+}
@@ -0,0 +1,55 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEventReceiver(t *testing.T) {
+	f := &addrTransport{fakeTransport: fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_SENSOR_EVENT, _BMC_SET_EVENT_RECEIVER}: {0},
+		{_IPMI_NETFN_SENSOR_EVENT, _BMC_GET_EVENT_RECEIVER}: {0, 0x20, 0xFE},
+	}}}
+	i := &IPMI{Transport: f}
+	mc := Addr{Channel: 7, Target: 0x72}
+
+	r, err := i.GetEventReceiver(mc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (EventReceiver{Target: BMCAddr, LUN: 2}); r != want {
+		t.Errorf("GetEventReceiver = %v, want %v", r, want)
+	}
+	if err := i.SetEventReceiver(mc, EventReceiver{Target: 0x22}); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.SetEventReceiver(Addr{}, EventReceiver{Target: EventReceiverDisabled}); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]byte{
+		{_IPMI_NETFN_SENSOR_EVENT, _BMC_GET_EVENT_RECEIVER},
+		{_IPMI_NETFN_SENSOR_EVENT, _BMC_SET_EVENT_RECEIVER, 0x22, 0},
+		{_IPMI_NETFN_SENSOR_EVENT, _BMC_SET_EVENT_RECEIVER, 0xFF, 0},
+	}
+	if !reflect.DeepEqual(f.requests, want) {
+		t.Errorf("sent %#x, want %#x", f.requests, want)
+	}
+	if wantAddrs := []Addr{mc, mc, {}}; !reflect.DeepEqual(f.addrs, wantAddrs) {
+		t.Errorf("sent to %v, want %v", f.addrs, wantAddrs)
+	}
+
+	if err := i.SetEventReceiver(mc, EventReceiver{Target: 0x20, LUN: 4}); err == nil {
+		t.Error("SetEventReceiver to LUN 4 did not fail")
+	}
+	f.responses[[2]byte{_IPMI_NETFN_SENSOR_EVENT, _BMC_GET_EVENT_RECEIVER}] = []byte{0, 0x20}
+	if _, err := i.GetEventReceiver(mc); err == nil {
+		t.Error("GetEventReceiver with a short response did not fail")
+	}
+	if s := (EventReceiver{Target: EventReceiverDisabled}).String(); s != "disabled" {
+		t.Errorf("String = %q, want disabled", s)
+	}
+}
@@ -0,0 +1,290 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+const (
+	// Not all interfaces can carry much in one response, so FRU data is
+	// read in pieces of at most this many bytes.
+	fruMaxRead = 16
+
+	fruHeaderSize  = 8
+	fruFormat      = 0x01
+	fruEndOfFields = 0xC1
+)
+
+// fruEpoch is the start of FRU manufacturing dates.
+var fruEpoch = time.Date(1996, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// FRUChassis is the chassis info area of a FRU.
+type FRUChassis struct {
+	// Type is an SMBIOS chassis type.
+	Type         byte
+	PartNumber   string
+	SerialNumber string
+	Custom       []string
+}
+
+// FRUBoard is the board info area of a FRU.
+type FRUBoard struct {
+	// MfgDate is the zero time if unspecified.
+	MfgDate      time.Time
+	Manufacturer string
+	ProductName  string
+	SerialNumber string
+	PartNumber   string
+	FRUFileID    string
+	Custom       []string
+}
+
+// FRUProduct is the product info area of a FRU.
+type FRUProduct struct {
+	Manufacturer string
+	Name         string
+	PartNumber   string
+	Version      string
+	SerialNumber string
+	AssetTag     string
+	FRUFileID    string
+	Custom       []string
+}
+
+// FRU is the decoded inventory of a Field Replaceable Unit, as in the IPMI
+// Platform Management FRU Information Storage Definition v1.0. Areas that
+// are not present are nil.
+type FRU struct {
+	Chassis *FRUChassis
+	Board   *FRUBoard
+	Product *FRUProduct
+}
+
+// GetFRUInventoryAreaInfo returns the size of FRU device dev's inventory
+// in bytes, and whether it is accessed by words rather than bytes.
+func (i *IPMI) GetFRUInventoryAreaInfo(dev byte) (uint16, bool, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_STORAGE
+	req.msg.cmd = _BMC_GET_FRU_INVENTORY_AREA_INFO
+	req.msg.data = unsafe.Pointer(&dev)
+	req.msg.dataLen = 1
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return 0, false, err
+	}
+	if err := req.completion(fmt.Sprintf("GetFRUInventoryAreaInfo(%#02x)", dev), recv); err != nil {
+		return 0, false, err
+	}
+	if len(recv) < 4 {
+		return 0, false, fmt.Errorf("GetFRUInventoryAreaInfo(%#02x): short response of %d bytes", dev, len(recv))
+	}
+	return binary.LittleEndian.Uint16(recv[1:3]), recv[3]&1 != 0, nil
+}
+
+// readFRUData reads count units at off of FRU device dev.
+func (i *IPMI) readFRUData(dev byte, off uint16, count byte) ([]byte, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_STORAGE
+	req.msg.cmd = _BMC_READ_FRU_DATA
+
+	var data [4]byte
+	data[0] = dev
+	binary.LittleEndian.PutUint16(data[1:3], off)
+	data[3] = count
+	req.msg.data = unsafe.Pointer(&data[0])
+	req.msg.dataLen = 4
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.completion(fmt.Sprintf("ReadFRUData(%#02x, %#04x)", dev, off), recv); err != nil {
+		return nil, err
+	}
+	if len(recv) < 2 || len(recv) < 2+int(recv[1]) {
+		return nil, fmt.Errorf("ReadFRUData(%#02x): short response of %d bytes", dev, len(recv))
+	}
+	return recv[2 : 2+int(recv[1])], nil
+}
+
+// ReadFRU reads the whole inventory of FRU device dev; 0 is the BMC's own.
+func (i *IPMI) ReadFRU(dev byte) ([]byte, error) {
+	size, words, err := i.GetFRUInventoryAreaInfo(dev)
+	if err != nil {
+		return nil, err
+	}
+	unit := 1
+	if words {
+		unit = 2
+	}
+	b := make([]byte, 0, size)
+	for chunk := fruMaxRead; len(b) < int(size); {
+		n := int(size) - len(b)
+		if n > chunk {
+			n = chunk
+		}
+		d, err := i.readFRUData(dev, uint16(len(b)/unit), byte((n+unit-1)/unit))
+		if tooLarge(err) && chunk > unit {
+			// Some devices take less than they say; try smaller pieces.
+			chunk /= 2
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(d) == 0 {
+			return nil, fmt.Errorf("ReadFRUData(%#02x, %#04x): no data", dev, len(b))
+		}
+		b = append(b, d...)
+	}
+	return b[:size], nil
+}
+
+// GetFRU reads and decodes the inventory of FRU device dev.
+func (i *IPMI) GetFRU(dev byte) (*FRU, error) {
+	b, err := i.ReadFRU(dev)
+	if err != nil {
+		return nil, err
+	}
+	return ParseFRU(b)
+}
+
+// fruChecksum is whether b sums to zero, as every FRU header and area must.
+func fruChecksum(b []byte) bool {
+	var sum byte
+	for _, c := range b {
+		sum += c
+	}
+	return sum == 0
+}
+
+// fruArea returns the area at header offset off, which is in multiples of 8
+// bytes, checking its version and checksum.
+func fruArea(b []byte, off byte, name string) ([]byte, error) {
+	start := int(off) * 8
+	if start+2 > len(b) {
+		return nil, fmt.Errorf("FRU %s area at %d is beyond the end", name, start)
+	}
+	end := start + int(b[start+1])*8
+	if b[start+1] == 0 || end > len(b) {
+		return nil, fmt.Errorf("FRU %s area at %d has a bad length of %d", name, start, b[start+1])
+	}
+	area := b[start:end]
+	if area[0] != fruFormat {
+		return nil, fmt.Errorf("FRU %s area has unknown format %#02x", name, area[0])
+	}
+	if !fruChecksum(area) {
+		return nil, fmt.Errorf("FRU %s area has a bad checksum", name)
+	}
+	return area, nil
+}
+
+// fruFields decodes the type/length encoded fields in b up to the end
+// marker. n fields are returned; any after that are custom fields.
+func fruFields(b []byte, n int) ([]string, []string, error) {
+	var fields []string
+	for len(b) > 0 && b[0] != fruEndOfFields {
+		l := int(b[0] & 0x3F)
+		if 1+l > len(b) {
+			return nil, nil, fmt.Errorf("FRU field of %d bytes overruns its area", l)
+		}
+		fields = append(fields, decodeField(b[0]>>6, b[1:1+l]))
+		b = b[1+l:]
+	}
+	if len(b) == 0 {
+		return nil, nil, fmt.Errorf("FRU area has no end of fields marker")
+	}
+	if len(fields) < n {
+		return nil, nil, fmt.Errorf("FRU area has %d fields, want at least %d", len(fields), n)
+	}
+	var custom []string
+	if len(fields) > n {
+		custom = fields[n:]
+	}
+	return fields[:n], custom, nil
+}
+
+// ParseFRU decodes the chassis, board and product areas of a FRU inventory.
+func ParseFRU(b []byte) (*FRU, error) {
+	if len(b) < fruHeaderSize {
+		return nil, fmt.Errorf("FRU is %d bytes, want at least %d", len(b), fruHeaderSize)
+	}
+	hdr := b[:fruHeaderSize]
+	if hdr[0]&0x0F != fruFormat {
+		return nil, fmt.Errorf("FRU has unknown format %#02x", hdr[0])
+	}
+	if !fruChecksum(hdr) {
+		return nil, fmt.Errorf("FRU header has a bad checksum")
+	}
+
+	fru := &FRU{}
+	if hdr[2] != 0 {
+		a, err := fruArea(b, hdr[2], "chassis")
+		if err != nil {
+			return nil, err
+		}
+		if len(a) < 3 {
+			return nil, fmt.Errorf("FRU chassis area is too short")
+		}
+		f, custom, err := fruFields(a[3:], 2)
+		if err != nil {
+			return nil, fmt.Errorf("chassis: %v", err)
+		}
+		fru.Chassis = &FRUChassis{Type: a[2], PartNumber: f[0], SerialNumber: f[1], Custom: custom}
+	}
+	if hdr[3] != 0 {
+		a, err := fruArea(b, hdr[3], "board")
+		if err != nil {
+			return nil, err
+		}
+		if len(a) < 6 {
+			return nil, fmt.Errorf("FRU board area is too short")
+		}
+		f, custom, err := fruFields(a[6:], 5)
+		if err != nil {
+			return nil, fmt.Errorf("board: %v", err)
+		}
+		fru.Board = &FRUBoard{
+			Manufacturer: f[0],
+			ProductName:  f[1],
+			SerialNumber: f[2],
+			PartNumber:   f[3],
+			FRUFileID:    f[4],
+			Custom:       custom,
+		}
+		if m := uint32(a[3]) | uint32(a[4])<<8 | uint32(a[5])<<16; m != 0 {
+			fru.Board.MfgDate = fruEpoch.Add(time.Duration(m) * time.Minute)
+		}
+	}
+	if hdr[4] != 0 {
+		a, err := fruArea(b, hdr[4], "product")
+		if err != nil {
+			return nil, err
+		}
+		if len(a) < 3 {
+			return nil, fmt.Errorf("FRU product area is too short")
+		}
+		f, custom, err := fruFields(a[3:], 7)
+		if err != nil {
+			return nil, fmt.Errorf("product: %v", err)
+		}
+		fru.Product = &FRUProduct{
+			Manufacturer: f[0],
+			Name:         f[1],
+			PartNumber:   f[2],
+			Version:      f[3],
+			SerialNumber: f[4],
+			AssetTag:     f[5],
+			FRUFileID:    f[6],
+			Custom:       custom,
+		}
+	}
+	return fru, nil
+}
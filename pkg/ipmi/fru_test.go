@@ -0,0 +1,132 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// fruTestArea builds an area from its fixed bytes and ASCII fields, padded
+// and checksummed.
+func fruTestArea(fixed []byte, fields ...string) []byte {
+	a := append([]byte{fruFormat, 0}, fixed...)
+	for _, f := range fields {
+		a = append(a, 0xC0|byte(len(f)))
+		a = append(a, f...)
+	}
+	a = append(a, fruEndOfFields)
+	for (len(a)+1)%8 != 0 {
+		a = append(a, 0)
+	}
+	a = append(a, 0)
+	a[1] = byte(len(a) / 8)
+	a[len(a)-1] = fruChecksumByte(a)
+	return a
+}
+
+func fruTestImage(chassis, board, product []byte) []byte {
+	hdr := []byte{fruFormat, 0, 0, 0, 0, 0, 0, 0}
+	b := make([]byte, fruHeaderSize)
+	for i, a := range [][]byte{chassis, board, product} {
+		if a != nil {
+			hdr[2+i] = byte(len(b) / 8)
+			b = append(b, a...)
+		}
+	}
+	hdr[7] = fruChecksumByte(hdr[:7])
+	copy(b, hdr)
+	return b
+}
+
+func TestParseFRU(t *testing.T) {
+	// 2020-01-02 03:04 UTC in minutes since 1996.
+	mins := uint32(time.Date(2020, 1, 2, 3, 4, 0, 0, time.UTC).Sub(fruEpoch) / time.Minute)
+	img := fruTestImage(
+		fruTestArea([]byte{0x17}, "CH-PN-1", "CH-SN-1"),
+		fruTestArea([]byte{0x19, byte(mins), byte(mins >> 8), byte(mins >> 16)}, "Acme", "Board X", "BSN123", "BPN456", "", "rev B"),
+		fruTestArea([]byte{0x19}, "Acme", "Server 9", "PPN789", "1.0", "PSN000", "asset-42", ""),
+	)
+	got, err := ParseFRU(img)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &FRU{
+		Chassis: &FRUChassis{Type: 0x17, PartNumber: "CH-PN-1", SerialNumber: "CH-SN-1"},
+		Board: &FRUBoard{
+			MfgDate:      time.Date(2020, 1, 2, 3, 4, 0, 0, time.UTC),
+			Manufacturer: "Acme",
+			ProductName:  "Board X",
+			SerialNumber: "BSN123",
+			PartNumber:   "BPN456",
+			Custom:       []string{"rev B"},
+		},
+		Product: &FRUProduct{
+			Manufacturer: "Acme",
+			Name:         "Server 9",
+			PartNumber:   "PPN789",
+			Version:      "1.0",
+			SerialNumber: "PSN000",
+			AssetTag:     "asset-42",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseFRU = %+v, want %+v", got, want)
+	}
+}
+
+func TestParseFRUBoardOnly(t *testing.T) {
+	// One character ASCII fields cannot be encoded, as C1h ends the fields.
+	got, err := ParseFRU(fruTestImage(nil, fruTestArea([]byte{0, 0, 0, 0}, "Acme", "BX", "SN", "PN", ""), nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Chassis != nil || got.Product != nil || got.Board == nil {
+		t.Fatalf("ParseFRU = %+v, want only a board area", got)
+	}
+	if !got.Board.MfgDate.IsZero() {
+		t.Errorf("MfgDate = %v, want unspecified", got.Board.MfgDate)
+	}
+}
+
+func TestParseFRUErrors(t *testing.T) {
+	good := fruTestImage(fruTestArea([]byte{1}, "PN", "SN"), nil, nil)
+	for _, tt := range []struct {
+		name string
+		mod  func([]byte) []byte
+	}{
+		{"short", func(b []byte) []byte { return b[:4] }},
+		{"header checksum", func(b []byte) []byte { b[7]++; return b }},
+		{"area checksum", func(b []byte) []byte { b[len(b)-1]++; return b }},
+		{"truncated area", func(b []byte) []byte { return b[:len(b)-8] }},
+		{"bad format", func(b []byte) []byte { b[0], b[7] = 2, b[7]-1; return b }},
+		{"missing fields", func(b []byte) []byte {
+			return fruTestImage(fruTestArea([]byte{1}, "PN"), nil, nil)
+		}},
+	} {
+		b := append([]byte(nil), good...)
+		if _, err := ParseFRU(tt.mod(b)); err == nil {
+			t.Errorf("%s: ParseFRU = nil error, want error", tt.name)
+		}
+	}
+}
+
+func TestDecodeField(t *testing.T) {
+	for _, tt := range []struct {
+		typ  byte
+		b    []byte
+		want string
+	}{
+		{0, []byte{0xde, 0xad}, "dead"},
+		{1, []byte{0x12, 0xb3, 0xca}, "12-3."},
+		{2, []byte{0xa1, 0x38, 0x92}, "ABCD"},
+		{3, []byte("Acme\x00\x00"), "Acme"},
+	} {
+		if got := decodeField(tt.typ, tt.b); got != tt.want {
+			t.Errorf("decodeField(%d, %x) = %q, want %q", tt.typ, tt.b, got, tt.want)
+		}
+	}
+}
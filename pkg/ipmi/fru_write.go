@@ -0,0 +1,218 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+	"unsafe"
+)
+
+const (
+	// FRU data is written in pieces of at most this many bytes, less if
+	// the BMC says so.
+	fruMaxWrite = 16
+
+	// Completion code for writes to write protected offsets.
+	ccFRUWriteProtected CompletionCode = 0x80
+)
+
+// writeFRUData writes data at off of FRU device dev. It returns how much was
+// written, in the device's units.
+func (i *IPMI) writeFRUData(dev byte, off uint16, data []byte) (int, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_STORAGE
+	req.msg.cmd = _BMC_WRITE_FRU_DATA
+
+	b := make([]byte, 3+len(data))
+	b[0] = dev
+	binary.LittleEndian.PutUint16(b[1:3], off)
+	copy(b[3:], data)
+	req.msg.data = unsafe.Pointer(&b[0])
+	req.msg.dataLen = uint16(len(b))
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return 0, err
+	}
+	if err := req.completion(fmt.Sprintf("WriteFRUData(%#02x, %#04x)", dev, off), recv); err != nil {
+		return 0, err
+	}
+	if len(recv) < 2 {
+		return 0, fmt.Errorf("WriteFRUData(%#02x): short response of %d bytes", dev, len(recv))
+	}
+	return int(recv[1]), nil
+}
+
+// WriteFRU writes b to the start of FRU device dev's inventory, in as many
+// pieces as the BMC needs.
+func (i *IPMI) WriteFRU(dev byte, b []byte) error {
+	size, words, err := i.GetFRUInventoryAreaInfo(dev)
+	if err != nil {
+		return err
+	}
+	if len(b) > int(size) {
+		return fmt.Errorf("WriteFRU(%#02x): %d bytes do not fit in %d", dev, len(b), size)
+	}
+	unit := 1
+	if words {
+		unit = 2
+		if len(b)%2 != 0 {
+			b = append(b, 0)
+		}
+	}
+	for off, chunk := 0, fruMaxWrite; off < len(b); {
+		n := len(b) - off
+		if n > chunk {
+			n = chunk
+		}
+		// Word devices take whole words.
+		n -= n % unit
+		written, err := i.writeFRUData(dev, uint16(off/unit), b[off:off+n])
+		switch {
+		case err == nil:
+		case tooLarge(err) && chunk > unit:
+			// The BMC takes less than that; try smaller pieces.
+			chunk /= 2
+			continue
+		case isCompletion(err, ccFRUWriteProtected):
+			return fmt.Errorf("write protected: %w", err)
+		default:
+			return err
+		}
+		// Some BMCs write less than they were given.
+		if written <= 0 || written*unit > n {
+			return fmt.Errorf("WriteFRUData(%#02x, %#04x): wrote %d of %d", dev, off, written*unit, n)
+		}
+		off += written * unit
+	}
+	return nil
+}
+
+// encodeFRUField encodes s as an 8-bit ASCII field.
+func encodeFRUField(s string) ([]byte, error) {
+	// C1h, a one byte ASCII field, marks the end of fields. Trailing
+	// spaces are trimmed when decoding, so pad.
+	if len(s) == 1 {
+		s += " "
+	}
+	if len(s) > 0x3F {
+		return nil, fmt.Errorf("FRU field %q is longer than 63 bytes", s)
+	}
+	if strings.IndexFunc(s, func(r rune) bool { return r > 0x7F }) >= 0 {
+		return nil, fmt.Errorf("FRU field %q is not ASCII", s)
+	}
+	return append([]byte{0xC0 | byte(len(s))}, s...), nil
+}
+
+// marshalFRUArea encodes an area from its fixed bytes and fields, padded to
+// a multiple of 8 bytes and checksummed.
+func marshalFRUArea(fixed []byte, fields ...string) ([]byte, error) {
+	a := append([]byte{fruFormat, 0}, fixed...)
+	for _, f := range fields {
+		b, err := encodeFRUField(f)
+		if err != nil {
+			return nil, err
+		}
+		a = append(a, b...)
+	}
+	a = append(a, fruEndOfFields)
+	// Leave room for the checksum.
+	for (len(a)+1)%8 != 0 {
+		a = append(a, 0)
+	}
+	a = append(a, 0)
+	if len(a)/8 > 0xFF {
+		return nil, fmt.Errorf("FRU area of %d bytes is too long", len(a))
+	}
+	a[1] = byte(len(a) / 8)
+	a[len(a)-1] = fruChecksumByte(a[:len(a)-1])
+	return a, nil
+}
+
+// fruChecksumByte returns the byte that makes b sum to zero.
+func fruChecksumByte(b []byte) byte {
+	var sum byte
+	for _, c := range b {
+		sum += c
+	}
+	return -sum
+}
+
+// MarshalFRU encodes f as a FRU inventory, with a common header and the
+// chassis, board and product areas that f has. All fields are encoded as
+// 8-bit ASCII.
+func MarshalFRU(f *FRU) ([]byte, error) {
+	var areas [3][]byte
+	var err error
+	if c := f.Chassis; c != nil {
+		if areas[0], err = marshalFRUArea([]byte{c.Type}, append([]string{c.PartNumber, c.SerialNumber}, c.Custom...)...); err != nil {
+			return nil, fmt.Errorf("chassis: %v", err)
+		}
+	}
+	if b := f.Board; b != nil {
+		var mins uint32
+		if !b.MfgDate.IsZero() {
+			d := b.MfgDate.Sub(fruEpoch)
+			if d < 0 || d/time.Minute > 0xFFFFFF {
+				return nil, fmt.Errorf("board: manufacturing date %v is out of range", b.MfgDate)
+			}
+			mins = uint32(d / time.Minute)
+		}
+		fixed := []byte{0, byte(mins), byte(mins >> 8), byte(mins >> 16)}
+		fields := append([]string{b.Manufacturer, b.ProductName, b.SerialNumber, b.PartNumber, b.FRUFileID}, b.Custom...)
+		if areas[1], err = marshalFRUArea(fixed, fields...); err != nil {
+			return nil, fmt.Errorf("board: %v", err)
+		}
+	}
+	if p := f.Product; p != nil {
+		fields := append([]string{p.Manufacturer, p.Name, p.PartNumber, p.Version, p.SerialNumber, p.AssetTag, p.FRUFileID}, p.Custom...)
+		if areas[2], err = marshalFRUArea([]byte{0}, fields...); err != nil {
+			return nil, fmt.Errorf("product: %v", err)
+		}
+	}
+
+	b := make([]byte, fruHeaderSize)
+	b[0] = fruFormat
+	for i, a := range areas {
+		if a == nil {
+			continue
+		}
+		if len(b)/8 > 0xFF {
+			return nil, fmt.Errorf("FRU of %d bytes is too long", len(b))
+		}
+		b[2+i] = byte(len(b) / 8)
+		b = append(b, a...)
+	}
+	b[7] = fruChecksumByte(b[:7])
+	return b, nil
+}
+
+// FixFRUChecksums recomputes the checksums of the common header and the
+// chassis, board and product areas of b, after its fields were edited in
+// place.
+func FixFRUChecksums(b []byte) error {
+	if len(b) < fruHeaderSize {
+		return fmt.Errorf("FRU is %d bytes, want at least %d", len(b), fruHeaderSize)
+	}
+	b[7] = fruChecksumByte(b[:7])
+	for _, off := range b[2:5] {
+		if off == 0 {
+			continue
+		}
+		start := int(off) * 8
+		if start+2 > len(b) {
+			return fmt.Errorf("FRU area at %d is beyond the end", start)
+		}
+		end := start + int(b[start+1])*8
+		if b[start+1] == 0 || end > len(b) {
+			return fmt.Errorf("FRU area at %d has a bad length of %d", start, b[start+1])
+		}
+		b[end-1] = fruChecksumByte(b[start : end-1])
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMarshalFRU(t *testing.T) {
+	for _, f := range []*FRU{
+		{},
+		{Board: &FRUBoard{Manufacturer: "Acme", ProductName: "Board X", SerialNumber: "S1", PartNumber: "P1"}},
+		{
+			Chassis: &FRUChassis{Type: 0x17, PartNumber: "CPN", SerialNumber: "CSN", Custom: []string{"x", "extra"}},
+			Board: &FRUBoard{
+				MfgDate:      time.Date(2020, 6, 1, 12, 30, 0, 0, time.UTC),
+				Manufacturer: "Acme",
+				ProductName:  "Board X",
+				SerialNumber: "BSN",
+				PartNumber:   "BPN",
+				FRUFileID:    "v1",
+			},
+			Product: &FRUProduct{
+				Manufacturer: "Acme",
+				Name:         "Server",
+				PartNumber:   "PPN",
+				Version:      "2",
+				SerialNumber: "PSN",
+				AssetTag:     "asset",
+			},
+		},
+	} {
+		b, err := MarshalFRU(f)
+		if err != nil {
+			t.Errorf("MarshalFRU(%+v) = %v", f, err)
+			continue
+		}
+		got, err := ParseFRU(b)
+		if err != nil {
+			t.Errorf("ParseFRU(MarshalFRU(%+v)) = %v", f, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, f) {
+			t.Errorf("ParseFRU(MarshalFRU(%+v)) = %+v", f, got)
+		}
+	}
+}
+
+func TestMarshalFRUErrors(t *testing.T) {
+	for _, f := range []*FRU{
+		{Chassis: &FRUChassis{PartNumber: strings.Repeat("x", 64)}},
+		{Product: &FRUProduct{Name: "café"}},
+		{Board: &FRUBoard{MfgDate: time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC)}},
+	} {
+		if _, err := MarshalFRU(f); err == nil {
+			t.Errorf("MarshalFRU(%+v) = nil error, want error", f)
+		}
+	}
+}
+
+func TestFixFRUChecksums(t *testing.T) {
+	b, err := MarshalFRU(&FRU{
+		Chassis: &FRUChassis{PartNumber: "CPN-0001", SerialNumber: "CSN-0001"},
+		Board:   &FRUBoard{Manufacturer: "Acme", ProductName: "Board", SerialNumber: "BSN-0001", PartNumber: "BPN"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Program the serials in place, as bring-up does.
+	for _, s := range []string{"CSN-0001", "BSN-0001"} {
+		i := bytes.Index(b, []byte(s))
+		copy(b[i:], strings.Replace(s, "0001", "4242", 1))
+	}
+	if _, err := ParseFRU(b); err == nil {
+		t.Fatalf("ParseFRU of edited FRU = nil error, want checksum error")
+	}
+	if err := FixFRUChecksums(b); err != nil {
+		t.Fatal(err)
+	}
+	f, err := ParseFRU(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Chassis.SerialNumber != "CSN-4242" || f.Board.SerialNumber != "BSN-4242" {
+		t.Errorf("serials = %q, %q, want CSN-4242, BSN-4242", f.Chassis.SerialNumber, f.Board.SerialNumber)
+	}
+
+	if err := FixFRUChecksums(b[:4]); err == nil {
+		t.Errorf("FixFRUChecksums(short) = nil error, want error")
+	}
+}
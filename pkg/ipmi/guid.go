@@ -0,0 +1,102 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"fmt"
+)
+
+// GUID is a globally unique ID, in the byte order of RFC 4122.
+type GUID [16]byte
+
+func (g GUID) String() string {
+	return fmt.Sprintf("%x-%x-%x-%x-%x", g[0:4], g[4:6], g[6:8], g[8:10], g[10:16])
+}
+
+// GUIDEncoding is the byte order a BMC returns GUIDs in.
+type GUIDEncoding int
+
+// GUID encodings. IPMI v2.0 section 20.8 has GUIDs reversed entirely, but
+// most BMCs return them as SMBIOS has system UUIDs.
+const (
+	// GUIDAuto guesses the encoding from the version and variant the
+	// GUID has in each, SMBIOS first.
+	GUIDAuto GUIDEncoding = iota
+	// GUIDSMBIOS has the first three fields little-endian and the rest
+	// in network order, DSP0134 7.2.1.
+	GUIDSMBIOS
+	// GUIDIPMI has all 16 bytes reversed.
+	GUIDIPMI
+	// GUIDRFC4122 has all fields in network order.
+	GUIDRFC4122
+)
+
+// valid reports whether g has the RFC 4122 variant and a version from 1
+// to 5.
+func (g GUID) valid() bool {
+	v := g[6] >> 4
+	return g[8]&0xC0 == 0x80 && v >= 1 && v <= 5
+}
+
+// DecodeGUID decodes the 16 bytes b of a GUID in encoding enc.
+func DecodeGUID(b []byte, enc GUIDEncoding) (GUID, error) {
+	var g GUID
+	if len(b) < len(g) {
+		return g, fmt.Errorf("GUID of %d bytes is too short", len(b))
+	}
+	switch enc {
+	case GUIDAuto:
+		if g, _ = DecodeGUID(b, GUIDSMBIOS); g.valid() {
+			return g, nil
+		}
+		if g, _ = DecodeGUID(b, GUIDIPMI); g.valid() {
+			return g, nil
+		}
+		return DecodeGUID(b, GUIDSMBIOS)
+	case GUIDSMBIOS:
+		g = GUID{b[3], b[2], b[1], b[0], b[5], b[4], b[7], b[6]}
+		copy(g[8:], b[8:16])
+	case GUIDIPMI:
+		for i := range g {
+			g[i] = b[15-i]
+		}
+	case GUIDRFC4122:
+		copy(g[:], b)
+	default:
+		return g, fmt.Errorf("unknown GUID encoding %d", enc)
+	}
+	return g, nil
+}
+
+func (i *IPMI) getGUID(op string, cmd byte) (GUID, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_APP
+	req.msg.cmd = cmd
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return GUID{}, err
+	}
+	if err := req.completion(op, recv); err != nil {
+		return GUID{}, err
+	}
+	g, err := DecodeGUID(recv[1:], GUIDAuto)
+	if err != nil {
+		return GUID{}, fmt.Errorf("%s: %v", op, err)
+	}
+	return g, nil
+}
+
+// GetDeviceGUID returns the GUID of the BMC. Use GetSystemGUID to tell
+// systems apart; BMCs of the same model may share device GUIDs.
+func (i *IPMI) GetDeviceGUID() (GUID, error) {
+	return i.getGUID("GetDeviceGUID", _BMC_GET_DEVICE_GUID)
+}
+
+// GetSystemGUID returns the GUID of the system the BMC manages, which is
+// usually the UUID of its SMBIOS system information too.
+func (i *IPMI) GetSystemGUID() (GUID, error) {
+	return i.getGUID("GetSystemGUID", _BMC_GET_SYSTEM_GUID)
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"testing"
+)
+
+func TestDecodeGUID(t *testing.T) {
+	const want = "01234567-89ab-4def-8123-456789abcdef"
+	smbios := []byte{0x67, 0x45, 0x23, 0x01, 0xab, 0x89, 0xef, 0x4d, 0x81, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}
+	ipmi := []byte{0xef, 0xcd, 0xab, 0x89, 0x67, 0x45, 0x23, 0x81, 0xef, 0x4d, 0xab, 0x89, 0x67, 0x45, 0x23, 0x01}
+	rfc := []byte{0x01, 0x23, 0x45, 0x67, 0x89, 0xab, 0x4d, 0xef, 0x81, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef}
+	for _, tt := range []struct {
+		b   []byte
+		enc GUIDEncoding
+	}{
+		{smbios, GUIDSMBIOS},
+		{smbios, GUIDAuto},
+		{ipmi, GUIDIPMI},
+		{ipmi, GUIDAuto},
+		{rfc, GUIDRFC4122},
+	} {
+		g, err := DecodeGUID(tt.b, tt.enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if g.String() != want {
+			t.Errorf("DecodeGUID(% x, %d) = %s, want %s", tt.b, tt.enc, g, want)
+		}
+	}
+
+	// Not a valid GUID in any encoding: taken as SMBIOS.
+	g, err := DecodeGUID(make([]byte, 16), GUIDAuto)
+	if err != nil || g != (GUID{}) {
+		t.Errorf("DecodeGUID(zeros) = %s, %v", g, err)
+	}
+	if _, err := DecodeGUID(smbios[:15], GUIDAuto); err == nil {
+		t.Error("DecodeGUID of 15 bytes did not fail")
+	}
+}
+
+func TestGetGUID(t *testing.T) {
+	f := &fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_APP, _BMC_GET_SYSTEM_GUID}: {0, 0x67, 0x45, 0x23, 0x01, 0xab, 0x89, 0xef, 0x4d, 0x81, 0x23, 0x45, 0x67, 0x89, 0xab, 0xcd, 0xef},
+		{_IPMI_NETFN_APP, _BMC_GET_DEVICE_GUID}: {0, 1, 2, 3},
+	}}
+	i := &IPMI{Transport: f}
+	g, err := i.GetSystemGUID()
+	if err != nil || g.String() != "01234567-89ab-4def-8123-456789abcdef" {
+		t.Errorf("GetSystemGUID = %s, %v", g, err)
+	}
+	if _, err := i.GetDeviceGUID(); err == nil {
+		t.Error("GetDeviceGUID with a short response did not fail")
+	}
+	f.responses = nil
+	if _, err := i.GetSystemGUID(); !isCompletion(err, CompletionInvalidCommand) {
+		t.Errorf("GetSystemGUID = %v, want invalid command", err)
+	}
+}
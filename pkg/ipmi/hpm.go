@@ -0,0 +1,376 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// HPM.1 firmware upgrade commands, PICMG HPM.1 rev 1.0 section 3.
+const (
+	// picmgID is the group extension that starts the data of PICMG
+	// requests and responses.
+	picmgID = 0x00
+
+	_HPM_GET_TARGET_UPGRADE_CAPABILITIES = 0x2E
+	_HPM_GET_COMPONENT_PROPERTIES        = 0x2F
+	_HPM_ABORT_FIRMWARE_UPGRADE          = 0x30
+	_HPM_INITIATE_UPGRADE_ACTION         = 0x31
+	_HPM_UPLOAD_FIRMWARE_BLOCK           = 0x32
+	_HPM_FINISH_FIRMWARE_UPLOAD          = 0x33
+	_HPM_GET_UPGRADE_STATUS              = 0x34
+	_HPM_ACTIVATE_FIRMWARE               = 0x35
+	_HPM_QUERY_SELF_TEST_RESULTS         = 0x36
+
+	hpmPropertiesGeneral     = 0
+	hpmPropertiesVersion     = 1
+	hpmPropertiesDescription = 2
+
+	// ccHPMInProgress is the completion code of a long duration command
+	// the IPMC goes on with; Get Upgrade Status says when it is done.
+	ccHPMInProgress CompletionCode = 0x80
+
+	// Firmware is uploaded in blocks of at most this many bytes, less if
+	// the IPMC says so.
+	hpmMaxBlock = 32
+
+	// hpmTimeoutUnit is the unit of the timeouts of Get Target Upgrade
+	// Capabilities, and hpmDefaultTimeout what to wait for an IPMC that
+	// gives none.
+	hpmTimeoutUnit    = 5 * time.Second
+	hpmDefaultTimeout = time.Minute
+)
+
+// hpmPoll is how often long duration HPM.1 commands are asked whether they
+// are done.
+var hpmPoll = time.Second
+
+// HPMCapabilities are what an IPMC says of its firmware upgrades.
+type HPMCapabilities struct {
+	// Version is the HPM.1 version, 0 for rev 1.0.
+	Version byte
+
+	Degraded           bool // the IPMC is degraded during upgrades
+	DeferredActivation bool // the IPMC can activate firmware later
+	ServicesAffected   bool // upgrading affects payload services
+	ManualRollback     bool
+	AutomaticRollback  bool
+	SelfTest           bool // the IPMC tests new firmware
+	Undesirable        bool // upgrading is risky, as the IPMC has no backup
+	RollbackOverridden bool // automatic rollback is overridden
+
+	// Timeouts of upgrade commands, of self-tests and rollbacks after
+	// activation, and of the IPMC being unreachable as it activates.
+	UpgradeTimeout         time.Duration
+	SelfTestTimeout        time.Duration
+	RollbackTimeout        time.Duration
+	InaccessibilityTimeout time.Duration
+
+	// Components has bit n set if there is component n, 0 to 7.
+	Components byte
+}
+
+// Has reports whether the IPMC has component id.
+func (c *HPMCapabilities) Has(id byte) bool {
+	return id < 8 && c.Components&(1<<id) != 0
+}
+
+func hpmTimeout(b byte) time.Duration {
+	if b == 0 {
+		return hpmDefaultTimeout
+	}
+	return time.Duration(b) * hpmTimeoutUnit
+}
+
+// HPMVersion is the version of component firmware.
+type HPMVersion struct {
+	Major byte
+	// Minor is in BCD.
+	Minor byte
+	Aux   [4]byte
+}
+
+func (v HPMVersion) String() string {
+	return fmt.Sprintf("%d.%02x", v.Major, v.Minor)
+}
+
+// HPMRollback is what backup a component has.
+type HPMRollback byte
+
+// Component backups.
+const (
+	HPMRollbackNone      HPMRollback = 0
+	HPMRollbackAutomatic HPMRollback = 1
+	HPMRollbackManual    HPMRollback = 2
+	HPMRollbackBoth      HPMRollback = 3
+)
+
+// HPMComponent describes an upgradeable component of an IPMC.
+type HPMComponent struct {
+	ID          byte
+	Description string
+	// Version is that of the firmware running.
+	Version HPMVersion
+
+	PayloadColdReset   bool // activation needs a payload cold reset
+	DeferredActivation bool
+	Comparison         bool // an image can be compared with the firmware
+	Preparation        bool // the component must be prepared for upgrades
+	Rollback           HPMRollback
+}
+
+// HPMAction is an action Initiate Upgrade Action starts.
+type HPMAction byte
+
+// Upgrade actions.
+const (
+	HPMBackup        HPMAction = 0
+	HPMPrepare       HPMAction = 1
+	HPMUpload        HPMAction = 2
+	HPMUploadCompare HPMAction = 3
+)
+
+// HPMUpgradeStatus is the status of the last long duration HPM.1 command.
+type HPMUpgradeStatus struct {
+	// Command is the command in progress or that was, and Completion its
+	// completion code, ccHPMInProgress while it is going on.
+	Command    byte
+	Completion CompletionCode
+}
+
+// hpmCmd sends PICMG command cmd with data, failing as op, and returns the
+// response data after the PICMG identifier. If the command is one of long
+// duration, it waits up to timeout for it to be done.
+func (i *IPMI) hpmCmd(op string, cmd byte, data []byte, timeout time.Duration) ([]byte, error) {
+	b, err := i.groupCmd(op, picmgID, cmd, data)
+	if isCompletion(err, ccHPMInProgress) && timeout > 0 {
+		return nil, i.waitHPM(op, cmd, timeout)
+	}
+	return b, err
+}
+
+// waitHPM waits up to timeout for long duration command cmd to be done. The
+// IPMC may not answer while it is busy, so errors only count at the end.
+func (i *IPMI) waitHPM(op string, cmd byte, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		time.Sleep(hpmPoll)
+		s, err := i.GetHPMUpgradeStatus()
+		switch {
+		case err != nil:
+		case s.Completion == ccHPMInProgress:
+			err = fmt.Errorf("%s: not done in %v", op, timeout)
+		case s.Completion != CompletionOK:
+			return &CompletionError{Op: op, NetFn: _IPMI_NETFN_GROUP_EXTENSION, Cmd: cmd, Code: s.Completion}
+		default:
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return err
+		}
+	}
+}
+
+// GetHPMCapabilities returns the firmware upgrade capabilities of the IPMC.
+func (i *IPMI) GetHPMCapabilities() (*HPMCapabilities, error) {
+	b, err := i.hpmCmd("GetHPMCapabilities", _HPM_GET_TARGET_UPGRADE_CAPABILITIES, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 7 {
+		return nil, fmt.Errorf("GetHPMCapabilities: short response of %d bytes", len(b))
+	}
+	return &HPMCapabilities{
+		Version:                b[0],
+		Degraded:               b[1]&0x80 != 0,
+		DeferredActivation:     b[1]&0x40 != 0,
+		ServicesAffected:       b[1]&0x20 != 0,
+		ManualRollback:         b[1]&0x10 != 0,
+		AutomaticRollback:      b[1]&0x08 != 0,
+		SelfTest:               b[1]&0x04 != 0,
+		Undesirable:            b[1]&0x02 != 0,
+		RollbackOverridden:     b[1]&0x01 != 0,
+		UpgradeTimeout:         hpmTimeout(b[2]),
+		SelfTestTimeout:        hpmTimeout(b[3]),
+		RollbackTimeout:        hpmTimeout(b[4]),
+		InaccessibilityTimeout: hpmTimeout(b[5]),
+		Components:             b[6],
+	}, nil
+}
+
+func (i *IPMI) getHPMProperties(id, selector byte) ([]byte, error) {
+	return i.hpmCmd(fmt.Sprintf("GetHPMComponent(%d, %d)", id, selector), _HPM_GET_COMPONENT_PROPERTIES, []byte{id, selector}, 0)
+}
+
+// GetHPMComponent returns the properties of component id, 0 to 7.
+func (i *IPMI) GetHPMComponent(id byte) (*HPMComponent, error) {
+	c := &HPMComponent{ID: id}
+	b, err := i.getHPMProperties(id, hpmPropertiesGeneral)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 1 {
+		return nil, fmt.Errorf("GetHPMComponent(%d): short response", id)
+	}
+	c.PayloadColdReset = b[0]&0x20 != 0
+	c.DeferredActivation = b[0]&0x10 != 0
+	c.Comparison = b[0]&0x08 != 0
+	c.Preparation = b[0]&0x04 != 0
+	c.Rollback = HPMRollback(b[0] & 0x03)
+
+	if b, err = i.getHPMProperties(id, hpmPropertiesVersion); err != nil {
+		return nil, err
+	}
+	if len(b) < 6 {
+		return nil, fmt.Errorf("GetHPMComponent(%d): short version of %d bytes", id, len(b))
+	}
+	c.Version = HPMVersion{Major: b[0] & 0x7F, Minor: b[1]}
+	copy(c.Version.Aux[:], b[2:6])
+
+	if b, err = i.getHPMProperties(id, hpmPropertiesDescription); err != nil {
+		return nil, err
+	}
+	if n := strings.IndexByte(string(b), 0); n >= 0 {
+		b = b[:n]
+	}
+	c.Description = string(b)
+	return c, nil
+}
+
+// GetHPMUpgradeStatus returns the status of the last long duration HPM.1
+// command.
+func (i *IPMI) GetHPMUpgradeStatus() (*HPMUpgradeStatus, error) {
+	b, err := i.hpmCmd("GetHPMUpgradeStatus", _HPM_GET_UPGRADE_STATUS, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 2 {
+		return nil, fmt.Errorf("GetHPMUpgradeStatus: short response of %d bytes", len(b))
+	}
+	return &HPMUpgradeStatus{Command: b[0], Completion: CompletionCode(b[1])}, nil
+}
+
+// InitiateHPMUpgrade starts action a on the components with a bit set in
+// components, and waits up to the upgrade timeout of c for it to be done.
+func (i *IPMI) InitiateHPMUpgrade(c *HPMCapabilities, components byte, a HPMAction) error {
+	if components&^c.Components != 0 {
+		return fmt.Errorf("InitiateHPMUpgrade: components %#02x are not all of %#02x", components, c.Components)
+	}
+	_, err := i.hpmCmd(fmt.Sprintf("InitiateHPMUpgrade(%#02x, %d)", components, a), _HPM_INITIATE_UPGRADE_ACTION, []byte{components, byte(a)}, c.UpgradeTimeout)
+	return err
+}
+
+// UploadHPMFirmware uploads image, the firmware of component id, for it to
+// be activated with ActivateHPMFirmware. If the component needs it, it must
+// be prepared with InitiateHPMUpgrade first.
+func (i *IPMI) UploadHPMFirmware(c *HPMCapabilities, id byte, image []byte) error {
+	if !c.Has(id) {
+		return fmt.Errorf("UploadHPMFirmware: there is no component %d", id)
+	}
+	if len(image) == 0 {
+		return fmt.Errorf("UploadHPMFirmware: empty image")
+	}
+	if err := i.InitiateHPMUpgrade(c, 1<<id, HPMUpload); err != nil {
+		return err
+	}
+
+	var block byte
+	for off, size := 0, hpmMaxBlock; off < len(image); {
+		n := len(image) - off
+		if n > size {
+			n = size
+		}
+		op := fmt.Sprintf("UploadHPMFirmware(%d, block %d)", id, block)
+		_, err := i.hpmCmd(op, _HPM_UPLOAD_FIRMWARE_BLOCK, append([]byte{block}, image[off:off+n]...), c.UpgradeTimeout)
+		switch {
+		case err == nil:
+		case tooLarge(err) && size > 1:
+			// The IPMC takes less than that; try smaller blocks.
+			size /= 2
+			continue
+		default:
+			return err
+		}
+		off += n
+		block++
+	}
+
+	var data [5]byte
+	data[0] = id
+	binary.LittleEndian.PutUint32(data[1:], uint32(len(image)))
+	_, err := i.hpmCmd(fmt.Sprintf("FinishHPMUpload(%d)", id), _HPM_FINISH_FIRMWARE_UPLOAD, data[:], c.UpgradeTimeout)
+	return err
+}
+
+// ActivateHPMFirmware activates the firmware uploaded, and waits for the
+// IPMC to be back up with it, which takes up to the inaccessibility timeout
+// of c.
+func (i *IPMI) ActivateHPMFirmware(c *HPMCapabilities) error {
+	_, err := i.hpmCmd("ActivateHPMFirmware", _HPM_ACTIVATE_FIRMWARE, nil, c.InaccessibilityTimeout+c.UpgradeTimeout)
+	return err
+}
+
+// AbortHPMUpgrade abandons the upgrade in progress. Firmware uploaded but
+// not activated is thrown away.
+func (i *IPMI) AbortHPMUpgrade() error {
+	_, err := i.hpmCmd("AbortHPMUpgrade", _HPM_ABORT_FIRMWARE_UPGRADE, nil, 0)
+	return err
+}
+
+// HPMSelfTest is the result of the self-test of activated firmware, as
+// Get Self Test Results has it.
+type HPMSelfTest struct {
+	Result byte
+	Detail byte
+}
+
+// Self-test results.
+const (
+	HPMSelfTestPassed         = 0x55
+	HPMSelfTestNotImplemented = 0x56
+	HPMSelfTestCorrupted      = 0x57
+	HPMSelfTestFatal          = 0x58
+)
+
+// Passed reports whether the firmware passed its self-test, or has none.
+func (s HPMSelfTest) Passed() bool {
+	return s.Result == HPMSelfTestPassed || s.Result == HPMSelfTestNotImplemented
+}
+
+func (s HPMSelfTest) String() string {
+	switch s.Result {
+	case HPMSelfTestPassed:
+		return "passed"
+	case HPMSelfTestNotImplemented:
+		return "not implemented"
+	case HPMSelfTestCorrupted:
+		return fmt.Sprintf("corrupted or inaccessible data or devices (%#02x)", s.Detail)
+	case HPMSelfTestFatal:
+		return fmt.Sprintf("fatal hardware error (%#02x)", s.Detail)
+	}
+	return fmt.Sprintf("device-specific failure %#02x (%#02x)", s.Result, s.Detail)
+}
+
+// QueryHPMSelfTest returns the result of the self-test of firmware
+// activated, waiting up to the self-test timeout of c for it.
+func (i *IPMI) QueryHPMSelfTest(c *HPMCapabilities) (*HPMSelfTest, error) {
+	op := "QueryHPMSelfTest"
+	deadline := time.Now().Add(c.SelfTestTimeout)
+	for {
+		b, err := i.hpmCmd(op, _HPM_QUERY_SELF_TEST_RESULTS, nil, 0)
+		switch {
+		case err == nil && len(b) < 2:
+			return nil, fmt.Errorf("%s: short response of %d bytes", op, len(b))
+		case err == nil:
+			return &HPMSelfTest{Result: b[0], Detail: b[1]}, nil
+		case !isCompletion(err, ccHPMInProgress) || time.Now().After(deadline):
+			return nil, err
+		}
+		time.Sleep(hpmPoll)
+	}
+}
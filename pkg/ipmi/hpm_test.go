@@ -0,0 +1,182 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// hpmIPMC is an IPMC with one component, 1, that takes firmware blocks of
+// up to 16 bytes and finishes uploads and activations in the background.
+type hpmIPMC struct {
+	*fakeTransport
+	image   []byte
+	block   byte
+	busy    int
+	status  []byte
+	version byte
+	aborted bool
+}
+
+func newHPMIPMC(version byte) *hpmIPMC {
+	h := &hpmIPMC{fakeTransport: &fakeTransport{}, version: version}
+	picmg := func(cmd byte, f func(data []byte) []byte) {
+		h.handle(_IPMI_NETFN_GROUP_EXTENSION, cmd, groupExtension(picmgID, f))
+	}
+	ok := func(b ...byte) []byte {
+		return append([]byte{0, picmgID}, b...)
+	}
+	// Background commands are done once asked about twice.
+	background := func(cmd byte) func([]byte) []byte {
+		return func([]byte) []byte {
+			h.busy = 2
+			h.status = ok(cmd, byte(ccHPMInProgress))
+			return []byte{byte(ccHPMInProgress)}
+		}
+	}
+
+	picmg(_HPM_GET_TARGET_UPGRADE_CAPABILITIES, func([]byte) []byte {
+		return ok(0, 0x2C, 0, 2, 0, 12, 0x02)
+	})
+	picmg(_HPM_GET_COMPONENT_PROPERTIES, func(data []byte) []byte {
+		if data[0] != 1 {
+			return []byte{byte(CompletionParameterOutOfRange)}
+		}
+		switch data[1] {
+		case hpmPropertiesGeneral:
+			return ok(0x25)
+		case hpmPropertiesVersion:
+			return ok(0x80|h.version, 0x12, 1, 2, 3, 4)
+		case hpmPropertiesDescription:
+			return ok([]byte("BMC FW\x00\x00\x00\x00\x00\x00")...)
+		}
+		return []byte{byte(CompletionInvalidCommand)}
+	})
+	picmg(_HPM_INITIATE_UPGRADE_ACTION, func([]byte) []byte {
+		h.image, h.block = nil, 0
+		return ok()
+	})
+	picmg(_HPM_UPLOAD_FIRMWARE_BLOCK, func(data []byte) []byte {
+		if len(data) > 17 {
+			return []byte{byte(CompletionRequestDataLength)}
+		}
+		if data[0] != h.block {
+			return []byte{byte(CompletionInvalidDataField)}
+		}
+		h.block++
+		h.image = append(h.image, data[1:]...)
+		return ok()
+	})
+	finish := background(_HPM_FINISH_FIRMWARE_UPLOAD)
+	picmg(_HPM_FINISH_FIRMWARE_UPLOAD, func(data []byte) []byte {
+		if int(data[1])|int(data[2])<<8 != len(h.image) {
+			return []byte{0x81}
+		}
+		return finish(data)
+	})
+	activate := background(_HPM_ACTIVATE_FIRMWARE)
+	picmg(_HPM_ACTIVATE_FIRMWARE, func(data []byte) []byte {
+		h.version++
+		return activate(data)
+	})
+	picmg(_HPM_ABORT_FIRMWARE_UPGRADE, func([]byte) []byte {
+		h.aborted = true
+		return ok()
+	})
+	picmg(_HPM_QUERY_SELF_TEST_RESULTS, func([]byte) []byte {
+		return ok(HPMSelfTestPassed, 0)
+	})
+	picmg(_HPM_GET_UPGRADE_STATUS, func([]byte) []byte {
+		if h.busy--; h.busy == 0 {
+			h.status[3] = 0
+		}
+		return h.status
+	})
+	return h
+}
+
+func TestHPM(t *testing.T) {
+	defer func(d time.Duration) { hpmPoll = d }(hpmPoll)
+	hpmPoll = 0
+
+	h := newHPMIPMC(1)
+	i := &IPMI{Transport: h}
+
+	c, err := i.GetHPMCapabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &HPMCapabilities{
+		ServicesAffected:       true,
+		AutomaticRollback:      true,
+		SelfTest:               true,
+		UpgradeTimeout:         time.Minute,
+		SelfTestTimeout:        10 * time.Second,
+		RollbackTimeout:        time.Minute,
+		InaccessibilityTimeout: time.Minute,
+		Components:             0x02,
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("GetHPMCapabilities = %+v, want %+v", c, want)
+	}
+
+	comp, err := i.GetHPMComponent(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantComp := &HPMComponent{
+		ID:               1,
+		Description:      "BMC FW",
+		Version:          HPMVersion{Major: 1, Minor: 0x12, Aux: [4]byte{1, 2, 3, 4}},
+		PayloadColdReset: true,
+		Preparation:      true,
+		Rollback:         HPMRollbackAutomatic,
+	}
+	if !reflect.DeepEqual(comp, wantComp) {
+		t.Errorf("GetHPMComponent = %+v, want %+v", comp, wantComp)
+	}
+	if s := comp.Version.String(); s != "1.12" {
+		t.Errorf("Version = %s, want 1.12", s)
+	}
+	if _, err := i.GetHPMComponent(0); !isCompletion(err, CompletionParameterOutOfRange) {
+		t.Errorf("GetHPMComponent(0) = %v, want parameter out of range", err)
+	}
+
+	image := bytes.Repeat([]byte("firmware"), 10)
+	if err := i.UploadHPMFirmware(c, 0, image); err == nil {
+		t.Error("UploadHPMFirmware to component 0 did not fail")
+	}
+	if err := i.InitiateHPMUpgrade(c, 0x02, HPMPrepare); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.UploadHPMFirmware(c, 1, image); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(h.image, image) {
+		t.Errorf("IPMC got image %q, want %q", h.image, image)
+	}
+	if h.block != 5 {
+		t.Errorf("IPMC got %d blocks, want 5 of 16 bytes", h.block)
+	}
+	if err := i.ActivateHPMFirmware(c); err != nil {
+		t.Fatal(err)
+	}
+	if comp, err := i.GetHPMComponent(1); err != nil || comp.Version.Major != 2 {
+		t.Errorf("GetHPMComponent after activation = %+v, %v, want version 2", comp, err)
+	}
+
+	// A failed background command fails.
+	h.busy, h.status = 0, []byte{0, picmgID, _HPM_ACTIVATE_FIRMWARE, 0xD5}
+	if err := i.waitHPM("ActivateHPMFirmware", _HPM_ACTIVATE_FIRMWARE, time.Second); !isCompletion(err, CompletionNotSupportedNow) {
+		t.Errorf("waitHPM = %v, want not supported now", err)
+	}
+	h.busy, h.status = 10, []byte{0, picmgID, _HPM_ACTIVATE_FIRMWARE, byte(ccHPMInProgress)}
+	if err := i.waitHPM("ActivateHPMFirmware", _HPM_ACTIVATE_FIRMWARE, 0); err == nil || err.Error() != "ActivateHPMFirmware: not done in 0s" {
+		t.Errorf("waitHPM = %v, want not done", err)
+	}
+}
@@ -0,0 +1,319 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// hpmSignature starts HPM.1 upgrade images, PICMG HPM.1 rev 1.0 section
+// 3.4.
+var hpmSignature = []byte("PICMGFWU")
+
+const (
+	hpmHeaderSize      = 34
+	hpmActionSize      = 3
+	hpmUploadSize      = 31
+	hpmDescriptionSize = 21
+)
+
+// ErrHPMUpToDate is returned by UpgradeHPM if every component of the image
+// already has the firmware version of the image.
+var ErrHPMUpToDate = errors.New("the components already have the firmware of the image")
+
+// HPMImageAction is an action of an upgrade image, with the firmware to
+// upload for HPMUpload.
+type HPMImageAction struct {
+	Action     HPMAction
+	Components byte
+
+	// Version, Description and Firmware are those of the component
+	// HPMUpload uploads to.
+	Version     HPMVersion
+	Description string
+	Firmware    []byte
+}
+
+// Component returns the component an HPMUpload action uploads to.
+func (a *HPMImageAction) Component() (byte, error) {
+	for id := byte(0); id < 8; id++ {
+		if a.Components == 1<<id {
+			return id, nil
+		}
+	}
+	return 0, fmt.Errorf("upload to components %#02x, not to one", a.Components)
+}
+
+// HPMImage is an HPM.1 upgrade image, as vendors ship BMC and CPLD
+// firmware in .hpm files.
+type HPMImage struct {
+	// DeviceID, ManufacturerID and ProductID are those Get Device ID
+	// returns for the IPMC the image is for.
+	DeviceID       byte
+	ManufacturerID uint32
+	ProductID      uint16
+	Time           time.Time
+
+	SelfTest         bool // the firmware tests itself once activated
+	ManualRollback   bool
+	ServicesAffected bool // upgrading affects payload services
+
+	// Components has bit n set if the image has firmware for
+	// component n.
+	Components byte
+
+	SelfTestTimeout        time.Duration
+	RollbackTimeout        time.Duration
+	InaccessibilityTimeout time.Duration
+
+	// EarliestCompatible is the oldest firmware, of Major and Minor, the
+	// image can upgrade.
+	EarliestCompatible HPMVersion
+	Version            HPMVersion
+	OEMData            []byte
+
+	Actions []HPMImageAction
+}
+
+// hpmChecksum returns whether b sums to 0, as the header and action
+// records with their checksums do.
+func hpmChecksum(b []byte) bool {
+	var sum byte
+	for _, c := range b {
+		sum += c
+	}
+	return sum == 0
+}
+
+func hpmImageVersion(b []byte) HPMVersion {
+	v := HPMVersion{Major: b[0] & 0x7F, Minor: b[1]}
+	copy(v.Aux[:], b[2:6])
+	return v
+}
+
+// ParseHPMImage parses and checks an HPM.1 upgrade image.
+func ParseHPMImage(b []byte) (*HPMImage, error) {
+	if len(b) < hpmHeaderSize+1+md5.Size || !bytes.HasPrefix(b, hpmSignature) {
+		return nil, fmt.Errorf("not an HPM.1 upgrade image")
+	}
+	body := b[:len(b)-md5.Size]
+	if sum := md5.Sum(body); !bytes.Equal(sum[:], b[len(body):]) {
+		return nil, fmt.Errorf("HPM.1 image: MD5 checksum mismatch")
+	}
+	if b[8] != 0 {
+		return nil, fmt.Errorf("HPM.1 image: unknown format version %d", b[8])
+	}
+	oemLen := int(binary.LittleEndian.Uint16(b[32:34]))
+	end := hpmHeaderSize + oemLen + 1
+	if end > len(body) {
+		return nil, fmt.Errorf("HPM.1 image: header of %d bytes is longer than the image", end)
+	}
+	if !hpmChecksum(b[:end]) {
+		return nil, fmt.Errorf("HPM.1 image: header checksum mismatch")
+	}
+	img := &HPMImage{
+		DeviceID:               b[9],
+		ManufacturerID:         uint32(b[10]) | uint32(b[11])<<8 | uint32(b[12])<<16,
+		ProductID:              binary.LittleEndian.Uint16(b[13:15]),
+		Time:                   time.Unix(int64(binary.LittleEndian.Uint32(b[15:19])), 0).UTC(),
+		SelfTest:               b[19]&0x01 != 0,
+		ManualRollback:         b[19]&0x02 != 0,
+		ServicesAffected:       b[19]&0x04 != 0,
+		Components:             b[20],
+		SelfTestTimeout:        hpmTimeout(b[21]),
+		RollbackTimeout:        hpmTimeout(b[22]),
+		InaccessibilityTimeout: hpmTimeout(b[23]),
+		EarliestCompatible:     HPMVersion{Major: b[24] & 0x7F, Minor: b[25]},
+		Version:                hpmImageVersion(b[26:32]),
+		OEMData:                b[hpmHeaderSize : hpmHeaderSize+oemLen],
+	}
+
+	for off := end; off < len(body); {
+		if off+hpmActionSize > len(body) {
+			return nil, fmt.Errorf("HPM.1 image: truncated action at %#x", off)
+		}
+		if !hpmChecksum(body[off : off+hpmActionSize]) {
+			return nil, fmt.Errorf("HPM.1 image: checksum mismatch of action at %#x", off)
+		}
+		a := HPMImageAction{Action: HPMAction(body[off]), Components: body[off+1]}
+		if a.Components&^img.Components != 0 {
+			return nil, fmt.Errorf("HPM.1 image: action at %#x is for components %#02x not in the image's %#02x", off, a.Components, img.Components)
+		}
+		off += hpmActionSize
+
+		switch a.Action {
+		case HPMBackup, HPMPrepare:
+		case HPMUpload:
+			if off+hpmUploadSize > len(body) {
+				return nil, fmt.Errorf("HPM.1 image: truncated upload at %#x", off)
+			}
+			if _, err := a.Component(); err != nil {
+				return nil, fmt.Errorf("HPM.1 image: %v", err)
+			}
+			a.Version = hpmImageVersion(body[off : off+6])
+			desc := body[off+6 : off+6+hpmDescriptionSize]
+			if n := bytes.IndexByte(desc, 0); n >= 0 {
+				desc = desc[:n]
+			}
+			a.Description = strings.TrimSpace(string(desc))
+			n := int(binary.LittleEndian.Uint32(body[off+27 : off+31]))
+			off += hpmUploadSize
+			if n > len(body)-off {
+				return nil, fmt.Errorf("HPM.1 image: firmware of %d bytes at %#x is longer than the image", n, off)
+			}
+			a.Firmware = body[off : off+n]
+			off += n
+		default:
+			return nil, fmt.Errorf("HPM.1 image: unknown action %d", a.Action)
+		}
+		img.Actions = append(img.Actions, a)
+	}
+	return img, nil
+}
+
+// HPMUpgradeOptions are options of UpgradeHPM.
+type HPMUpgradeOptions struct {
+	// Force upgrades components that already have the firmware version
+	// of the image, and those whose firmware is older than the image
+	// can upgrade.
+	Force bool
+
+	// Defer leaves the firmware uploaded to be activated later, with
+	// ActivateHPMFirmware, rather than activating it.
+	Defer bool
+
+	// Progress, if not nil, is told of every step of the upgrade.
+	Progress func(format string, v ...interface{})
+}
+
+// hpmOlder reports whether version v is older than major.minor.
+func hpmOlder(v, than HPMVersion) bool {
+	return v.Major < than.Major || (v.Major == than.Major && v.Minor < than.Minor)
+}
+
+// UpgradeHPM flashes the firmware of img to the IPMC, as HPM.1 has it:
+// after checking the image is for this IPMC, it backs up, prepares and
+// uploads to the components that do not have the image's firmware, and
+// then activates the firmware and checks its self-test. An upgrade that
+// fails before activation is aborted.
+func (i *IPMI) UpgradeHPM(img *HPMImage, o *HPMUpgradeOptions) error {
+	if o == nil {
+		o = &HPMUpgradeOptions{}
+	}
+	progress := o.Progress
+	if progress == nil {
+		progress = func(string, ...interface{}) {}
+	}
+
+	id, err := i.GetDeviceID()
+	if err != nil {
+		return err
+	}
+	mfr := uint32(id.ManufacturerID[0]) | uint32(id.ManufacturerID[1])<<8 | uint32(id.ManufacturerID[2]&0x0F)<<16
+	product := binary.LittleEndian.Uint16(id.ProductID[:])
+	if id.DeviceID != img.DeviceID || mfr != img.ManufacturerID || product != img.ProductID {
+		return fmt.Errorf("UpgradeHPM: image is for device %#02x of manufacturer %d, product %#04x, not device %#02x of manufacturer %d, product %#04x",
+			img.DeviceID, img.ManufacturerID, img.ProductID, id.DeviceID, mfr, product)
+	}
+
+	c, err := i.GetHPMCapabilities()
+	if err != nil {
+		return err
+	}
+	if img.Components&^c.Components != 0 {
+		return fmt.Errorf("UpgradeHPM: image has components %#02x, the IPMC only %#02x", img.Components, c.Components)
+	}
+	if o.Defer && !c.DeferredActivation {
+		return fmt.Errorf("UpgradeHPM: the IPMC cannot defer activation")
+	}
+
+	// Leave out the components that have the firmware already.
+	var upgrade byte
+	for _, a := range img.Actions {
+		if a.Action != HPMUpload {
+			continue
+		}
+		n, _ := a.Component()
+		comp, err := i.GetHPMComponent(n)
+		if err != nil {
+			return err
+		}
+		switch {
+		case o.Force:
+		case hpmOlder(comp.Version, img.EarliestCompatible):
+			return fmt.Errorf("UpgradeHPM: component %d (%s) has version %v, older than the %v the image can upgrade", n, comp.Description, comp.Version, img.EarliestCompatible)
+		case comp.Version == a.Version:
+			progress("Component %d (%s) already has version %v", n, comp.Description, comp.Version)
+			continue
+		}
+		progress("Component %d (%s): version %v to %v", n, comp.Description, comp.Version, a.Version)
+		upgrade |= a.Components
+	}
+	if upgrade == 0 {
+		return ErrHPMUpToDate
+	}
+
+	if err := i.runHPMActions(c, img, upgrade, progress); err != nil {
+		if aerr := i.AbortHPMUpgrade(); aerr != nil {
+			progress("Cannot abort the upgrade: %v", aerr)
+		}
+		return err
+	}
+	if o.Defer {
+		progress("Firmware uploaded; it is activated with ActivateHPMFirmware")
+		return nil
+	}
+
+	progress("Activating the firmware")
+	if err := i.ActivateHPMFirmware(c); err != nil {
+		return err
+	}
+	if !c.SelfTest {
+		return nil
+	}
+	progress("Waiting for the self-test")
+	s, err := i.QueryHPMSelfTest(c)
+	if err != nil {
+		return err
+	}
+	if !s.Passed() {
+		return fmt.Errorf("UpgradeHPM: self-test of the new firmware: %v", s)
+	}
+	return nil
+}
+
+func (i *IPMI) runHPMActions(c *HPMCapabilities, img *HPMImage, upgrade byte, progress func(string, ...interface{})) error {
+	for _, a := range img.Actions {
+		components := a.Components & upgrade
+		if components == 0 {
+			continue
+		}
+		switch a.Action {
+		case HPMBackup:
+			progress("Backing up components %#02x", components)
+			if err := i.InitiateHPMUpgrade(c, components, HPMBackup); err != nil {
+				return err
+			}
+		case HPMPrepare:
+			progress("Preparing components %#02x", components)
+			if err := i.InitiateHPMUpgrade(c, components, HPMPrepare); err != nil {
+				return err
+			}
+		case HPMUpload:
+			n, _ := a.Component()
+			progress("Uploading %d bytes of %s to component %d", len(a.Firmware), a.Description, n)
+			if err := i.UploadHPMFirmware(c, n, a.Firmware); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// hpmTestImage returns an image for device 0x20 of manufacturer 0x2A7C,
+// product 0x0B02, that prepares component 1 and uploads firmware to it.
+func hpmTestImage(firmware []byte) []byte {
+	var b bytes.Buffer
+	b.Write(hpmSignature)
+	b.Write([]byte{0, 0x20, 0x7C, 0x2A, 0x00, 0x02, 0x0B})
+	binary.Write(&b, binary.LittleEndian, uint32(1600000000))
+	b.Write([]byte{0x01, 0x02, 2, 0, 0, 1, 0x10, 2, 0x00, 9, 8, 7, 6})
+	binary.Write(&b, binary.LittleEndian, uint16(3))
+	b.WriteString("OEM")
+	b.WriteByte(hpmTestSum(b.Bytes()))
+
+	b.Write([]byte{byte(HPMPrepare), 0x02, hpmTestSum([]byte{byte(HPMPrepare), 0x02})})
+	b.Write([]byte{byte(HPMUpload), 0x02, hpmTestSum([]byte{byte(HPMUpload), 0x02})})
+	b.Write([]byte{2, 0x00, 9, 8, 7, 6})
+	var desc [hpmDescriptionSize]byte
+	copy(desc[:], "BMC FW")
+	b.Write(desc[:])
+	binary.Write(&b, binary.LittleEndian, uint32(len(firmware)))
+	b.Write(firmware)
+
+	sum := md5.Sum(b.Bytes())
+	return append(b.Bytes(), sum[:]...)
+}
+
+func hpmTestSum(b []byte) byte {
+	var sum byte
+	for _, c := range b {
+		sum += c
+	}
+	return -sum
+}
+
+func TestParseHPMImage(t *testing.T) {
+	firmware := bytes.Repeat([]byte("firmware"), 10)
+	b := hpmTestImage(firmware)
+	img, err := ParseHPMImage(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &HPMImage{
+		DeviceID:               0x20,
+		ManufacturerID:         0x2A7C,
+		ProductID:              0x0B02,
+		Time:                   time.Unix(1600000000, 0).UTC(),
+		SelfTest:               true,
+		Components:             0x02,
+		SelfTestTimeout:        10 * time.Second,
+		RollbackTimeout:        time.Minute,
+		InaccessibilityTimeout: time.Minute,
+		EarliestCompatible:     HPMVersion{Major: 1, Minor: 0x10},
+		Version:                HPMVersion{Major: 2, Aux: [4]byte{9, 8, 7, 6}},
+		OEMData:                []byte("OEM"),
+		Actions: []HPMImageAction{
+			{Action: HPMPrepare, Components: 0x02},
+			{
+				Action:      HPMUpload,
+				Components:  0x02,
+				Version:     HPMVersion{Major: 2, Aux: [4]byte{9, 8, 7, 6}},
+				Description: "BMC FW",
+				Firmware:    firmware,
+			},
+		},
+	}
+	if !reflect.DeepEqual(img, want) {
+		t.Errorf("ParseHPMImage = %+v, want %+v", img, want)
+	}
+
+	resum := func(b []byte) []byte {
+		sum := md5.Sum(b[:len(b)-md5.Size])
+		copy(b[len(b)-md5.Size:], sum[:])
+		return b
+	}
+	corrupt := func(off int) []byte {
+		c := append([]byte{}, b...)
+		c[off] ^= 0xFF
+		return resum(c)
+	}
+	for _, tt := range []struct {
+		name string
+		b    []byte
+	}{
+		{"empty", nil},
+		{"signature", corrupt(0)},
+		{"md5", append(append([]byte{}, b[:len(b)-1]...), b[len(b)-1]^1)},
+		{"format version", corrupt(8)},
+		{"header checksum", corrupt(20)},
+		{"action checksum", corrupt(hpmHeaderSize + 4)},
+		{"truncated", resum(append(append([]byte{}, b[:len(b)-md5.Size-8]...), make([]byte, md5.Size)...))},
+	} {
+		if _, err := ParseHPMImage(tt.b); err == nil {
+			t.Errorf("ParseHPMImage with a bad %s did not fail", tt.name)
+		}
+	}
+}
+
+func TestUpgradeHPM(t *testing.T) {
+	defer func(d time.Duration) { hpmPoll = d }(hpmPoll)
+	hpmPoll = 0
+
+	firmware := bytes.Repeat([]byte("firmware"), 10)
+	img, err := ParseHPMImage(hpmTestImage(firmware))
+	if err != nil {
+		t.Fatal(err)
+	}
+	deviceID := []byte{0, 0x20, 1, 1, 0x12, 0x02, 0, 0x7C, 0x2A, 0x00, 0x02, 0x0B, 0, 0, 0, 0}
+	h := newHPMIPMC(1)
+	h.responses = map[[2]byte][]byte{{_IPMI_NETFN_APP, _BMC_GET_DEVICE_ID}: deviceID}
+	i := &IPMI{Transport: h}
+
+	var steps []string
+	o := &HPMUpgradeOptions{Progress: func(format string, v ...interface{}) {
+		steps = append(steps, fmt.Sprintf(format, v...))
+	}}
+	if err := i.UpgradeHPM(img, o); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(h.image, firmware) {
+		t.Errorf("IPMC got image %q, want %q", h.image, firmware)
+	}
+	if h.version != 2 || h.aborted {
+		t.Errorf("IPMC is at version %d, aborted %t, want version 2 activated", h.version, h.aborted)
+	}
+	wantSteps := []string{
+		"Component 1 (BMC FW): version 1.12 to 2.00",
+		"Preparing components 0x02",
+		"Uploading 80 bytes of BMC FW to component 1",
+		"Activating the firmware",
+		"Waiting for the self-test",
+	}
+	if !reflect.DeepEqual(steps, wantSteps) {
+		t.Errorf("UpgradeHPM steps = %q, want %q", steps, wantSteps)
+	}
+
+	// Components with the image's version, aux included, are left alone.
+	img.Actions[1].Version = HPMVersion{Major: 2, Minor: 0x12, Aux: [4]byte{1, 2, 3, 4}}
+	if err := i.UpgradeHPM(img, nil); err != ErrHPMUpToDate {
+		t.Errorf("UpgradeHPM of the firmware the IPMC has = %v, want %v", err, ErrHPMUpToDate)
+	}
+
+	// Firmware older than the image can upgrade is left alone unless
+	// forced.
+	h.version = 1
+	img.EarliestCompatible = HPMVersion{Major: 1, Minor: 0x20}
+	if err := i.UpgradeHPM(img, nil); err == nil {
+		t.Error("UpgradeHPM of firmware that is too old did not fail")
+	}
+	if err := i.UpgradeHPM(img, &HPMUpgradeOptions{Force: true, Defer: true}); err == nil {
+		t.Error("UpgradeHPM deferring activation on an IPMC that cannot did not fail")
+	}
+
+	// A failed upload is aborted.
+	img.Actions[1].Firmware = nil
+	if err := i.UpgradeHPM(img, &HPMUpgradeOptions{Force: true}); err == nil || !h.aborted {
+		t.Errorf("UpgradeHPM of an empty image = %v, aborted %t, want an aborted failure", err, h.aborted)
+	}
+
+	deviceID[1] = 0x21
+	if err := i.UpgradeHPM(img, &HPMUpgradeOptions{Force: true}); err == nil {
+		t.Error("UpgradeHPM of an image for another device did not fail")
+	}
+}
@@ -2,18 +2,20 @@
 // Use of this source code is governed by a BSD-style
 // license that can be found in the LICENSE file.
 
-// Package ipmi implements functions to communicate with the OpenIPMI driver
-// interface.
+// Package ipmi implements functions to communicate with a BMC, the local one
+// through the OpenIPMI driver interface or a remote one over RMCP+.
 package ipmi
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"fmt"
 	"os"
 	"runtime"
 	"syscall"
+	"time"
 	"unsafe"
 
 	"github.com/vtolstov/go-ioctl"
@@ -23,37 +25,94 @@ import (
 const (
 	_IPMI_BMC_CHANNEL                = 0xf
 	_IPMI_BUF_SIZE                   = 1024
+	_IPMI_IPMB_ADDR_TYPE             = 0x01
 	_IPMI_IOC_MAGIC                  = 'i'
 	_IPMI_NETFN_CHASSIS              = 0x0
+	_IPMI_NETFN_SENSOR_EVENT         = 0x4
 	_IPMI_NETFN_APP                  = 0x6
 	_IPMI_NETFN_STORAGE              = 0xA
 	_IPMI_NETFN_TRANSPORT            = 0xC
+	_IPMI_NETFN_GROUP_EXTENSION      = 0x2C
 	_IPMI_OPENIPMI_READ_TIMEOUT      = 15
 	_IPMI_SYSTEM_INTERFACE_ADDR_TYPE = 0x0c
 
 	// IPM Device "Global" Commands
-	_BMC_GET_DEVICE_ID = 0x01
+	_BMC_GET_DEVICE_ID         = 0x01
+	_BMC_COLD_RESET            = 0x02
+	_BMC_WARM_RESET            = 0x03
+	_BMC_GET_SELF_TEST_RESULTS = 0x04
+	_BMC_GET_DEVICE_GUID       = 0x08
 
 	// BMC Device and Messaging Commands
-	_BMC_SET_WATCHDOG_TIMER     = 0x24
-	_BMC_GET_WATCHDOG_TIMER     = 0x25
-	_BMC_SET_GLOBAL_ENABLES     = 0x2E
-	_BMC_GET_GLOBAL_ENABLES     = 0x2F
-	_SET_SYSTEM_INFO_PARAMETERS = 0x58
-	_BMC_ADD_SEL                = 0x44
+	_BMC_RESET_WATCHDOG_TIMER          = 0x22
+	_BMC_SET_WATCHDOG_TIMER            = 0x24
+	_BMC_GET_WATCHDOG_TIMER            = 0x25
+	_BMC_SET_GLOBAL_ENABLES            = 0x2E
+	_BMC_GET_GLOBAL_ENABLES            = 0x2F
+	_BMC_SEND_MESSAGE                  = 0x34
+	_BMC_GET_SYSTEM_GUID               = 0x37
+	_BMC_GET_CHANNEL_AUTH_CAPABILITIES = 0x38
+	_SET_SYSTEM_INFO_PARAMETERS        = 0x58
+	_BMC_ADD_SEL                       = 0x44
+	_BMC_SET_SESSION_PRIVILEGE         = 0x3B
+	_BMC_CLOSE_SESSION                 = 0x3C
+	_BMC_ACTIVATE_PAYLOAD              = 0x48
+	_BMC_DEACTIVATE_PAYLOAD            = 0x49
+	_BMC_GET_CHANNEL_INFO              = 0x42
+	_BMC_SET_USER_ACCESS               = 0x43
+	_BMC_GET_USER_ACCESS               = 0x44
+	_BMC_SET_USER_NAME                 = 0x45
+	_BMC_GET_USER_NAME                 = 0x46
+	_BMC_SET_USER_PASSWORD             = 0x47
 
 	// Chassis Device Commands
-	_BMC_GET_CHASSIS_STATUS = 0x01
+	_BMC_GET_CHASSIS_STATUS      = 0x01
+	_BMC_CHASSIS_CONTROL         = 0x02
+	_BMC_CHASSIS_IDENTIFY        = 0x04
+	_BMC_SET_SYSTEM_BOOT_OPTIONS = 0x08
+	_BMC_GET_SYSTEM_BOOT_OPTIONS = 0x09
+	_BMC_SET_FRONT_PANEL_ENAB    = 0x0A
+
+	// Event Commands
+	_BMC_SET_EVENT_RECEIVER = 0x00
+	_BMC_GET_EVENT_RECEIVER = 0x01
+
+	// Sensor Device Commands
+	_BMC_GET_SENSOR_READING = 0x2D
+
+	// PEF Commands
+	_BMC_GET_PEF_CAPABILITIES = 0x10
+	_BMC_SET_PEF_CONFIG       = 0x12
+	_BMC_GET_PEF_CONFIG       = 0x13
+
+	// FRU Inventory Device Commands
+	_BMC_GET_FRU_INVENTORY_AREA_INFO = 0x10
+	_BMC_READ_FRU_DATA               = 0x11
+	_BMC_WRITE_FRU_DATA              = 0x12
+
+	// SDR Repository Commands
+	_BMC_GET_SDR_REPO_INFO = 0x20
+	_BMC_RESERVE_SDR_REPO  = 0x22
+	_BMC_GET_SDR           = 0x23
 
 	// SEL device Commands
-	_BMC_GET_SEL_INFO = 0x40
+	_BMC_GET_SEL_INFO  = 0x40
+	_BMC_RESERVE_SEL   = 0x42
+	_BMC_GET_SEL_ENTRY = 0x43
+	_BMC_CLEAR_SEL     = 0x47
+	_BMC_GET_SEL_TIME  = 0x48
+	_BMC_SET_SEL_TIME  = 0x49
+
+	_BMC_GET_SEL_TIME_UTC_OFFSET = 0x5C
+	_BMC_SET_SEL_TIME_UTC_OFFSET = 0x5D
 
 	//LAN Device Commands
+	_BMC_SET_LAN_CONFIG = 0x01
 	_BMC_GET_LAN_CONFIG = 0x02
 
-	_IPM_WATCHDOG_NO_ACTION    = 0x00
-	_IPM_WATCHDOG_SMS_OS       = 0x04
-	_IPM_WATCHDOG_CLEAR_SMS_OS = 0x10
+	// SOL Commands
+	_BMC_SET_SOL_CONFIG = 0x21
+	_BMC_GET_SOL_CONFIG = 0x22
 
 	_ADTL_SEL_DEVICE         = 0x04
 	_EN_SYSTEM_EVENT_LOGGING = 0x08
@@ -77,8 +136,118 @@ var (
 	_IPMICTL_SEND_COMMAND = ioctl.IOR(_IPMI_IOC_MAGIC, 13, uintptr(unsafe.Sizeof(req{})))
 )
 
+// Transport carries IPMI requests to a BMC and its responses back: the
+// OpenIPMI driver for the local BMC, an RMCP+ session for a remote one, or
+// a fake one in tests.
+type Transport interface {
+	// SendRecv sends a request of netfn and cmd with data, and returns
+	// the response from the completion code on.
+	SendRecv(netfn, cmd byte, data []byte) ([]byte, error)
+
+	// Close closes the Transport.
+	Close() error
+}
+
+// ContextTransport is a Transport that can give up on a request when a
+// context is done.
+type ContextTransport interface {
+	Transport
+
+	// SendRecvContext is SendRecv, but returns ctx.Err() once ctx is
+	// done.
+	SendRecvContext(ctx context.Context, netfn, cmd byte, data []byte) ([]byte, error)
+}
+
+// IPMI sends IPMI commands over a Transport. All commands work the same
+// over any Transport, and an IPMI is a Transport itself.
 type IPMI struct {
+	Transport
+
+	// ctx and timeout bound each command, as set by WithContext and
+	// WithTimeout.
+	ctx     context.Context
+	timeout time.Duration
+}
+
+var _ ContextTransport = &IPMI{}
+
+// WithContext returns a copy of i whose commands give up once ctx is done,
+// as in
+//
+//	id, err := i.WithContext(ctx).GetDeviceID()
+//
+// It shares i's Transport, which closing either closes.
+func (i *IPMI) WithContext(ctx context.Context) *IPMI {
+	c := *i
+	c.ctx = ctx
+	return &c
+}
+
+// WithTimeout returns a copy of i whose commands each give up after d, or
+// sooner if its context is done. A d of 0 leaves commands to the
+// Transport's own timeout. It shares i's Transport, which closing either
+// closes.
+func (i *IPMI) WithTimeout(d time.Duration) *IPMI {
+	c := *i
+	c.timeout = d
+	return &c
+}
+
+// SendRecv implements Transport.SendRecv, with the context and timeout of
+// WithContext and WithTimeout.
+func (i *IPMI) SendRecv(netfn, cmd byte, data []byte) ([]byte, error) {
+	ctx := i.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return i.SendRecvContext(ctx, netfn, cmd, data)
+}
+
+// SendRecvContext implements ContextTransport.SendRecvContext. A WithTimeout
+// timeout applies on top of ctx.
+//
+// Over a Transport that is not a ContextTransport, the request goes on
+// after SendRecvContext gives up on it.
+func (i *IPMI) SendRecvContext(ctx context.Context, netfn, cmd byte, data []byte) ([]byte, error) {
+	if i.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, i.timeout)
+		defer cancel()
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if t, ok := i.Transport.(ContextTransport); ok {
+		return t.SendRecvContext(ctx, netfn, cmd, data)
+	}
+
+	type result struct {
+		resp []byte
+		err  error
+	}
+	c := make(chan result, 1)
+	data = append([]byte(nil), data...)
+	go func() {
+		resp, err := i.Transport.SendRecv(netfn, cmd, data)
+		c <- result{resp, err}
+	}()
+	select {
+	case r := <-c:
+		return r.resp, r.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// dev is the Transport of the OpenIPMI driver's device. Requests may be
+// sent from several goroutines at once.
+type dev struct {
 	*os.File
+	demux *demux
+}
+
+func newDev(f *os.File) *dev {
+	return &dev{File: f, demux: newDemux()}
 }
 
 type msg struct {
@@ -89,9 +258,9 @@ type msg struct {
 }
 
 type req struct {
-	addr    *systemInterfaceAddr
+	addr    unsafe.Pointer
 	addrLen uint32
-	msgid   int64 //nolint:structcheck
+	msgid   int64
 	msg     msg
 }
 
@@ -117,14 +286,21 @@ type recv struct {
 	recvType int32 //nolint:structcheck
 	addr     *systemInterfaceAddr
 	addrLen  uint32
-	msgid    int64 //nolint:structcheck
+	msgid    int64
 	msg      msg
 }
 
 type systemInterfaceAddr struct {
 	addrType int32
 	channel  int16
-	lun      byte //nolint:unused
+	lun      byte
+}
+
+type ipmbAddr struct {
+	addrType  int32
+	channel   int16
+	slaveAddr byte
+	lun       byte
 }
 
 // StandardEvent is a standard systemevent.
@@ -205,79 +381,161 @@ func fdSet(fd uintptr, p *syscall.FdSet) {
 	p.Bits[fd/64] |= 1 << (uint(fd) % 64)
 }
 
+// pollInterval is how often dev checks whether a context is done while
+// waiting for a response.
+const pollInterval = 100 * time.Millisecond
+
 func (i *IPMI) sendrecv(req *req) ([]byte, error) {
-	addr := systemInterfaceAddr{
-		addrType: _IPMI_SYSTEM_INTERFACE_ADDR_TYPE,
-		channel:  _IPMI_BMC_CHANNEL,
+	var data []byte
+	if req.msg.dataLen > 0 {
+		data = (*[_IPMI_BUF_SIZE]byte)(req.msg.data)[:req.msg.dataLen:req.msg.dataLen]
 	}
+	return i.SendRecv(req.msg.netfn, req.msg.cmd, data)
+}
 
-	req.addr = &addr
-	req.addrLen = uint32(unsafe.Sizeof(addr))
-	if err := ioctlSetReq(i.Fd(), _IPMICTL_SEND_COMMAND, req); err != nil {
-		return nil, err
-	}
+// groupCmd sends command cmd of the group extension group, such as PICMG
+// or DCMI, with data, failing as op. It returns the response data after
+// the group's identifier.
+func (i *IPMI) groupCmd(op string, group, cmd byte, data []byte) ([]byte, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_GROUP_EXTENSION
+	req.msg.cmd = cmd
 
-	set := &syscall.FdSet{}
-	fdSet(i.Fd(), set)
-	time := &syscall.Timeval{
-		Sec:  _IPMI_OPENIPMI_READ_TIMEOUT,
-		Usec: 0,
-	}
-	if _, err := syscall.Select(int(i.Fd()+1), set, nil, nil, time); err != nil {
+	buf := append([]byte{group}, data...)
+	req.msg.data = unsafe.Pointer(&buf[0])
+	req.msg.dataLen = uint16(len(buf))
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
 		return nil, err
 	}
-
-	recv := &recv{}
-	recv.addr = &systemInterfaceAddr{}
-	recv.addrLen = uint32(unsafe.Sizeof(addr))
-	buf := make([]byte, _IPMI_BUF_SIZE)
-	recv.msg.data = unsafe.Pointer(&buf[0])
-	recv.msg.dataLen = _IPMI_BUF_SIZE
-	if err := ioctlGetRecv(i.Fd(), _IPMICTL_RECEIVE_MSG, recv); err != nil {
+	if err := req.completion(op, recv); err != nil {
 		return nil, err
 	}
+	if len(recv) < 2 || recv[1] != group {
+		return nil, fmt.Errorf("%s: response %#x is not of group %#02x", op, recv, group)
+	}
+	return recv[2:], nil
+}
 
-	return buf[:recv.msg.dataLen:recv.msg.dataLen], nil
+// SendRecv implements Transport.SendRecv with the driver's ioctls.
+func (d *dev) SendRecv(netfn, cmd byte, data []byte) ([]byte, error) {
+	return d.SendRecvContext(context.Background(), netfn, cmd, data)
 }
 
-func (i *IPMI) WatchdogRunning() (bool, error) {
-	req := &req{}
-	req.msg.cmd = _BMC_GET_WATCHDOG_TIMER
-	req.msg.netfn = _IPMI_NETFN_APP
+// SendRecvContext implements ContextTransport.SendRecvContext. Without a
+// deadline in ctx, it waits 15 seconds for a response. The driver hands
+// back the message ID of each request with its response, which is how
+// responses get to the right request.
+func (d *dev) SendRecvContext(ctx context.Context, netfn, cmd byte, data []byte) ([]byte, error) {
+	return d.SendRecvTo(ctx, Addr{}, netfn, cmd, data)
+}
 
-	recv, err := i.sendrecv(req)
-	if err != nil {
-		return false, err
+// SendRecvTo implements AddrTransport.SendRecvTo. The driver bridges
+// requests to controllers on the BMC's channels itself. Controllers behind
+// those are sent a Send Message request by way of the transit controller,
+// which embeds the response in its own, as ipmitool has it.
+func (d *dev) SendRecvTo(ctx context.Context, a Addr, netfn, cmd byte, data []byte) ([]byte, error) {
+	if err := a.check(); err != nil {
+		return nil, err
+	}
+	if a.double() {
+		msg := ipmbMessage(a.Target, netfn, a.LUN, BMCAddr, 0, cmd, data)
+		transit := Addr{Channel: a.TransitChannel, Target: a.TransitTarget}
+		resp, err := d.SendRecvTo(ctx, transit, _IPMI_NETFN_APP, _BMC_SEND_MESSAGE, sendMessage(a.Channel, false, msg))
+		if err != nil {
+			return nil, err
+		}
+		return unbridge(a, netfn, cmd, resp)
+	}
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, _IPMI_OPENIPMI_READ_TIMEOUT*time.Second)
+		defer cancel()
 	}
 
-	if len(recv) > 2 && (recv[1]&0x40) != 0 {
-		return true, nil
+	req := &req{}
+	req.msg.netfn = netfn
+	req.msg.cmd = cmd
+	if len(data) > 0 {
+		req.msg.data = unsafe.Pointer(&data[0])
+		req.msg.dataLen = uint16(len(data))
 	}
 
-	return false, nil
+	if a.bmc() {
+		addr := &systemInterfaceAddr{
+			addrType: _IPMI_SYSTEM_INTERFACE_ADDR_TYPE,
+			channel:  _IPMI_BMC_CHANNEL,
+			lun:      a.LUN,
+		}
+		req.addr = unsafe.Pointer(addr)
+		req.addrLen = uint32(unsafe.Sizeof(*addr))
+	} else {
+		addr := &ipmbAddr{
+			addrType:  _IPMI_IPMB_ADDR_TYPE,
+			channel:   int16(a.Channel),
+			slaveAddr: a.Target,
+			lun:       a.LUN,
+		}
+		req.addr = unsafe.Pointer(addr)
+		req.addrLen = uint32(unsafe.Sizeof(*addr))
+	}
+	req.msgid = d.demux.register()
+	if err := ioctlSetReq(d.Fd(), _IPMICTL_SEND_COMMAND, req); err != nil {
+		d.demux.forget(req.msgid)
+		return nil, err
+	}
+	return d.demux.await(ctx, req.msgid, d.receive)
 }
 
-func (i *IPMI) ShutoffWatchdog() error {
-	req := &req{}
-	req.msg.cmd = _BMC_SET_WATCHDOG_TIMER
-	req.msg.netfn = _IPMI_NETFN_APP
+// receive receives the next response, by ctx.
+func (d *dev) receive(ctx context.Context) (int64, []byte, error) {
+	if err := d.wait(ctx); err != nil {
+		return 0, nil, err
+	}
 
-	var data [6]byte
-	data[0] = _IPM_WATCHDOG_SMS_OS
-	data[1] = _IPM_WATCHDOG_NO_ACTION
-	data[2] = 0x00 // pretimeout interval
-	data[3] = _IPM_WATCHDOG_CLEAR_SMS_OS
-	data[4] = 0xb8 // countdown lsb (100 ms/count)
-	data[5] = 0x0b // countdown msb - 5 mins
-	req.msg.data = unsafe.Pointer(&data)
-	req.msg.dataLen = 6
-
-	_, err := i.sendrecv(req)
-	if err != nil {
-		return err
+	recv := &recv{}
+	recv.addr = &systemInterfaceAddr{}
+	recv.addrLen = uint32(unsafe.Sizeof(systemInterfaceAddr{}))
+	buf := make([]byte, _IPMI_BUF_SIZE)
+	recv.msg.data = unsafe.Pointer(&buf[0])
+	recv.msg.dataLen = _IPMI_BUF_SIZE
+	if err := ioctlGetRecv(d.Fd(), _IPMICTL_RECEIVE_MSG, recv); err != nil {
+		return 0, nil, err
 	}
 
-	return nil
+	return recv.msgid, buf[:recv.msg.dataLen:recv.msg.dataLen], nil
+}
+
+// wait waits for a response to be ready to receive, checking ctx every
+// pollInterval.
+func (d *dev) wait(ctx context.Context) error {
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		wait := pollInterval
+		if dl, ok := ctx.Deadline(); ok {
+			if left := time.Until(dl); left <= 0 {
+				return context.DeadlineExceeded
+			} else if left < wait {
+				wait = left
+			}
+		}
+		set := &syscall.FdSet{}
+		fdSet(d.Fd(), set)
+		tv := syscall.NsecToTimeval(wait.Nanoseconds())
+		n, err := syscall.Select(int(d.Fd()+1), set, nil, nil, &tv)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return nil
+		}
+	}
 }
 
 // marshall converts the Event struct to binary data and the content of returned data is based on the record type
@@ -325,9 +583,12 @@ func (i *IPMI) LogSystemEvent(e *Event) error {
 	req.msg.data = unsafe.Pointer(&data[0])
 	req.msg.dataLen = 16
 
-	_, err = i.sendrecv(req)
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return err
+	}
 
-	return err
+	return req.completion("LogSystemEvent", recv)
 }
 
 func (i *IPMI) setsysinfo(data *setSystemInfoReq) error {
@@ -337,11 +598,12 @@ func (i *IPMI) setsysinfo(data *setSystemInfoReq) error {
 	req.msg.dataLen = 18 // size of setSystemInfoReq
 	req.msg.data = unsafe.Pointer(data)
 
-	if _, err := i.sendrecv(req); err != nil {
+	recv, err := i.sendrecv(req)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return req.completion(fmt.Sprintf("SetSystemInfoParameters(%#02x, %d)", data.paramSelector, data.setSelector), recv)
 }
 
 func strcpyPadded(dst []byte, src string) {
@@ -396,6 +658,9 @@ func (i *IPMI) GetDeviceID() (*DevID, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := req.completion("GetDeviceID", data); err != nil {
+		return nil, err
+	}
 
 	buf := bytes.NewReader(data[1:])
 	mcInfo := DevID{}
@@ -414,8 +679,11 @@ func (i *IPMI) setGlobalEnables(enables byte) error {
 	req.msg.data = unsafe.Pointer(&enables)
 	req.msg.dataLen = 1
 
-	_, err := i.sendrecv(req)
-	return err
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return err
+	}
+	return req.completion("SetBMCGlobalEnables", recv)
 }
 
 func (i *IPMI) getGlobalEnables() ([]byte, error) {
@@ -423,7 +691,17 @@ func (i *IPMI) getGlobalEnables() ([]byte, error) {
 	req.msg.netfn = _IPMI_NETFN_APP
 	req.msg.cmd = _BMC_GET_GLOBAL_ENABLES
 
-	return i.sendrecv(req)
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.completion("GetBMCGlobalEnables", recv); err != nil {
+		return nil, err
+	}
+	if len(recv) < 2 {
+		return nil, fmt.Errorf("GetBMCGlobalEnables: short response of %d bytes", len(recv))
+	}
+	return recv, nil
 }
 
 func (i *IPMI) EnableSEL() (bool, error) {
@@ -461,6 +739,9 @@ func (i *IPMI) GetChassisStatus() (*ChassisStatus, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := req.completion("GetChassisStatus", data); err != nil {
+		return nil, err
+	}
 
 	buf := bytes.NewReader(data[1:])
 
@@ -480,6 +761,9 @@ func (i *IPMI) GetSELInfo() (*SELInfo, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err := req.completion("GetSELInfo", data); err != nil {
+		return nil, err
+	}
 
 	buf := bytes.NewReader(data[1:])
 
@@ -490,35 +774,21 @@ func (i *IPMI) GetSELInfo() (*SELInfo, error) {
 	return &info, nil
 }
 
-func (i *IPMI) GetLanConfig(channel byte, param byte) ([]byte, error) {
-	req := &req{}
-	req.msg.netfn = _IPMI_NETFN_TRANSPORT
-	req.msg.cmd = _BMC_GET_LAN_CONFIG
-
-	var data [4]byte
-	data[0] = channel
-	data[1] = param
-	data[2] = 0
-	data[3] = 0
-	req.msg.data = unsafe.Pointer(&data[0])
-	req.msg.dataLen = 4
-
-	return i.sendrecv(req)
+// RawCmd sends the command of netfn param[0] and cmd param[1], with data
+// param[2:], to the BMC and returns the response, completion code first.
+func (i *IPMI) RawCmd(param []byte) ([]byte, error) {
+	return i.RawCmdTo(Addr{}, param)
 }
 
-func (i *IPMI) RawCmd(param []byte) ([]byte, error) {
+// RawCmdTo is RawCmd for the controller at a, like ipmitool's raw with -b,
+// -t and -l.
+func (i *IPMI) RawCmdTo(a Addr, param []byte) ([]byte, error) {
 	if len(param) < 2 {
 		return nil, errors.New("Not enough parameters given")
 	}
-
-	req := &req{}
-	req.msg.netfn = param[0]
-	req.msg.cmd = param[1]
-	if len(param) > 2 {
-		req.msg.data = unsafe.Pointer(&param[2])
+	ctx := i.ctx
+	if ctx == nil {
+		ctx = context.Background()
 	}
-
-	req.msg.dataLen = uint16(len(param) - 2)
-
-	return i.sendrecv(req)
+	return i.SendRecvTo(ctx, a, param[0], param[1], param[2:])
 }
@@ -0,0 +1,196 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeTransport is a BMC answering requests with the handler for their
+// netfn and cmd, if there is one, or from a table, and records what it
+// was sent. It answers one request at a time.
+type fakeTransport struct {
+	responses map[[2]byte][]byte
+	handlers  map[[2]byte]func(data []byte) []byte
+
+	mu       sync.Mutex
+	requests [][]byte
+	closed   bool
+}
+
+// handle has h answer netfn and cmd from the request data.
+func (f *fakeTransport) handle(netfn, cmd byte, h func(data []byte) []byte) {
+	if f.handlers == nil {
+		f.handlers = make(map[[2]byte]func([]byte) []byte)
+	}
+	f.handlers[[2]byte{netfn, cmd}] = h
+}
+
+func (f *fakeTransport) SendRecv(netfn, cmd byte, data []byte) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, append([]byte{netfn, cmd}, data...))
+	if h, ok := f.handlers[[2]byte{netfn, cmd}]; ok {
+		return h(data), nil
+	}
+	resp, ok := f.responses[[2]byte{netfn, cmd}]
+	if !ok {
+		// Invalid command.
+		return []byte{0xC1}, nil
+	}
+	return resp, nil
+}
+
+// addrTransport is a fakeTransport that can be addressed, and records
+// where requests went.
+type addrTransport struct {
+	fakeTransport
+	addrs []Addr
+}
+
+func (f *addrTransport) SendRecvContext(ctx context.Context, netfn, cmd byte, data []byte) ([]byte, error) {
+	return f.SendRecvTo(ctx, Addr{}, netfn, cmd, data)
+}
+
+func (f *addrTransport) SendRecvTo(ctx context.Context, a Addr, netfn, cmd byte, data []byte) ([]byte, error) {
+	f.mu.Lock()
+	f.addrs = append(f.addrs, a)
+	f.mu.Unlock()
+	return f.SendRecv(netfn, cmd, data)
+}
+
+// groupExtension returns a handler for the group extension commands of the
+// group with the defining body id, which h answers without the id.
+func groupExtension(id byte, h func(data []byte) []byte) func([]byte) []byte {
+	return func(data []byte) []byte {
+		if len(data) < 1 || data[0] != id {
+			return []byte{byte(CompletionInvalidDataField)}
+		}
+		return h(data[1:])
+	}
+}
+
+// configParams returns a handler for Get Configuration Parameters commands
+// taking the parameter and set selector at data[at]. It answers with the
+// data of each parameter and set selector in params, and with notSupported
+// for those not listed.
+func configParams(params map[[2]byte][]byte, at int, notSupported CompletionCode) func([]byte) []byte {
+	return func(data []byte) []byte {
+		if len(data) < at+2 {
+			return []byte{byte(CompletionRequestDataLength)}
+		}
+		if b, ok := params[[2]byte{data[at], data[at+1]}]; ok {
+			return append([]byte{0, 0x11}, b...)
+		}
+		return []byte{byte(notSupported)}
+	}
+}
+
+func (f *fakeTransport) Close() error {
+	if f.closed {
+		return errors.New("closed twice")
+	}
+	f.closed = true
+	return nil
+}
+
+func TestTransport(t *testing.T) {
+	f := &fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_APP, _BMC_GET_DEVICE_ID}:      {0, 0x20, 0x81, 0x02, 0x10, 0x02, 0xBF, 0x57, 0x01, 0x00, 0x34, 0x12, 0, 0, 0, 0},
+		{_IPMI_NETFN_APP, _BMC_SET_GLOBAL_ENABLES}: {0},
+		{_IPMI_NETFN_APP, _BMC_GET_GLOBAL_ENABLES}: {0, 0x05},
+	}}
+	// An IPMI is a Transport too.
+	i := &IPMI{Transport: &IPMI{Transport: f}}
+
+	id, err := i.GetDeviceID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.DeviceID != 0x20 || id.IpmiVersion != 0x02 || id.ProductID != [2]byte{0x34, 0x12} {
+		t.Errorf("GetDeviceID = %+v", id)
+	}
+
+	// The SEL is off, so EnableSEL turns it on.
+	if ok, err := i.EnableSEL(); err != nil || !ok {
+		t.Fatalf("EnableSEL = %t, %v", ok, err)
+	}
+	resp, err := i.RawCmd([]byte{_IPMI_NETFN_CHASSIS, _BMC_GET_CHASSIS_STATUS})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(resp, []byte{0xC1}) {
+		t.Errorf("RawCmd = %#x, want invalid command", resp)
+	}
+
+	want := [][]byte{
+		{_IPMI_NETFN_APP, _BMC_GET_DEVICE_ID},
+		{_IPMI_NETFN_APP, _BMC_GET_DEVICE_ID},
+		{_IPMI_NETFN_APP, _BMC_GET_GLOBAL_ENABLES},
+		{_IPMI_NETFN_APP, _BMC_SET_GLOBAL_ENABLES, 0x05 | _EN_SYSTEM_EVENT_LOGGING},
+		{_IPMI_NETFN_CHASSIS, _BMC_GET_CHASSIS_STATUS},
+	}
+	if !reflect.DeepEqual(f.requests, want) {
+		t.Errorf("Transport got %#x, want %#x", f.requests, want)
+	}
+
+	if err := i.Close(); err != nil || !f.closed {
+		t.Errorf("Close = %v, Transport closed %t", err, f.closed)
+	}
+}
+
+// stuckTransport never answers until it is closed.
+type stuckTransport struct {
+	closed chan struct{}
+}
+
+func (s *stuckTransport) SendRecv(netfn, cmd byte, data []byte) ([]byte, error) {
+	<-s.closed
+	return nil, errors.New("closed")
+}
+
+func (s *stuckTransport) Close() error {
+	close(s.closed)
+	return nil
+}
+
+func TestContext(t *testing.T) {
+	s := &stuckTransport{closed: make(chan struct{})}
+	i := &IPMI{Transport: s}
+	defer i.Close()
+
+	if _, err := i.WithTimeout(10 * time.Millisecond).GetDeviceID(); err != context.DeadlineExceeded {
+		t.Errorf("GetDeviceID = %v, want %v", err, context.DeadlineExceeded)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := i.WithContext(ctx).GetDeviceID(); err != context.Canceled {
+		t.Errorf("GetDeviceID = %v, want %v", err, context.Canceled)
+	}
+	// The shorter of the context and the timeout wins.
+	ctx, cancel = context.WithTimeout(context.Background(), time.Hour)
+	defer cancel()
+	if _, err := i.WithContext(ctx).WithTimeout(10*time.Millisecond).SendRecvContext(ctx, _IPMI_NETFN_APP, _BMC_GET_DEVICE_ID, nil); err != context.DeadlineExceeded {
+		t.Errorf("SendRecvContext = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// Contexts reach a ContextTransport wrapped in an IPMI.
+	f := &fakeTransport{responses: map[[2]byte][]byte{{_IPMI_NETFN_APP, _BMC_GET_DEVICE_ID}: {0}}}
+	outer := &IPMI{Transport: &IPMI{Transport: f, timeout: time.Hour}}
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if _, err := outer.WithContext(ctx).SendRecv(_IPMI_NETFN_APP, _BMC_GET_DEVICE_ID, nil); err != context.Canceled {
+		t.Errorf("SendRecv = %v, want %v", err, context.Canceled)
+	}
+	if len(f.requests) != 0 {
+		t.Errorf("request sent with a canceled context")
+	}
+}
@@ -0,0 +1,155 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package ipmitest provides a fake BMC, so code that talks IPMI can be
+// tested without one.
+//
+// A BMC answers commands from a script:
+//
+//	b := ipmitest.New()
+//	b.Respond(0x0A, 0x48, 0x00, 0x5F, 0x5E, 0x00)   // Get SEL Time
+//	b.Fail(0x0A, 0x49, 0xD4)                       // Set SEL Time
+//	_, err := ipmi.SyncSELTime(b.IPMI(), time.Now(), time.Second)
+//
+// and records what it was sent. Commands it has no answer for get the
+// Invalid Command completion code, as a real BMC would give.
+package ipmitest
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/u-root/u-root/pkg/ipmi"
+)
+
+// Completion codes, IPMI v2.0 table 5-2.
+const (
+	CompletionOK             = 0x00
+	CompletionNodeBusy       = 0xC0
+	CompletionInvalidCommand = 0xC1
+	CompletionTimeout        = 0xC3
+	CompletionUnspecified    = 0xFF
+)
+
+// ErrClosed is returned for commands sent after Close.
+var ErrClosed = errors.New("fake BMC is closed")
+
+// Handler answers the request data of a command with a response from the
+// completion code on, or fails as a transport would.
+type Handler func(data []byte) ([]byte, error)
+
+// Request is a request a BMC got.
+type Request struct {
+	NetFn byte
+	Cmd   byte
+	Data  []byte
+}
+
+type command struct {
+	netfn, cmd byte
+}
+
+// BMC is a fake BMC. It is an ipmi.Transport and safe for concurrent use.
+type BMC struct {
+	mu       sync.Mutex
+	handlers map[command]Handler
+	queued   map[command][]Handler
+	requests []Request
+	closed   bool
+}
+
+var _ ipmi.Transport = &BMC{}
+
+// New returns a BMC that answers no commands yet.
+func New() *BMC {
+	return &BMC{
+		handlers: make(map[command]Handler),
+		queued:   make(map[command][]Handler),
+	}
+}
+
+// IPMI returns an IPMI that sends commands to b.
+func (b *BMC) IPMI() *ipmi.IPMI {
+	return &ipmi.IPMI{Transport: b}
+}
+
+// Handle makes b answer netfn and cmd with h from now on.
+func (b *BMC) Handle(netfn, cmd byte, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[command{netfn, cmd}] = h
+}
+
+// Respond makes b answer netfn and cmd with success and data from now on.
+func (b *BMC) Respond(netfn, cmd byte, data ...byte) {
+	resp := append([]byte{CompletionOK}, data...)
+	b.Handle(netfn, cmd, func([]byte) ([]byte, error) {
+		return resp, nil
+	})
+}
+
+// Fail makes b answer netfn and cmd with completion code cc from now on.
+func (b *BMC) Fail(netfn, cmd, cc byte) {
+	b.Handle(netfn, cmd, func([]byte) ([]byte, error) {
+		return []byte{cc}, nil
+	})
+}
+
+// Queue makes b answer the next requests of netfn and cmd with h, once
+// for each h, before it goes back to what Handle, Respond or Fail said.
+// It scripts BMCs that are busy at first, or whose state changes.
+func (b *BMC) Queue(netfn, cmd byte, h ...Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := command{netfn, cmd}
+	b.queued[c] = append(b.queued[c], h...)
+}
+
+// Requests returns the requests b got, oldest first.
+func (b *BMC) Requests() []Request {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Request(nil), b.requests...)
+}
+
+// Closed returns whether b was closed.
+func (b *BMC) Closed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+// SendRecv implements ipmi.Transport.SendRecv.
+func (b *BMC) SendRecv(netfn, cmd byte, data []byte) ([]byte, error) {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil, ErrClosed
+	}
+	b.requests = append(b.requests, Request{NetFn: netfn, Cmd: cmd, Data: append([]byte(nil), data...)})
+	c := command{netfn, cmd}
+	h, ok := b.handlers[c]
+	if q := b.queued[c]; len(q) > 0 {
+		h, ok = q[0], true
+		b.queued[c] = q[1:]
+	}
+	b.mu.Unlock()
+
+	if !ok {
+		return []byte{CompletionInvalidCommand}, nil
+	}
+	// Handlers run unlocked, so they may send commands of their own.
+	return h(data)
+}
+
+// Close implements ipmi.Transport.Close.
+func (b *BMC) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return ErrClosed
+	}
+	b.closed = true
+	return nil
+}
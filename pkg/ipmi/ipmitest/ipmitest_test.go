@@ -0,0 +1,94 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmitest
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/u-root/u-root/pkg/ipmi"
+)
+
+const (
+	netfnChassis = 0x00
+	netfnStorage = 0x0A
+
+	cmdChassisControl = 0x02
+	cmdGetSELTime     = 0x48
+	cmdSetSELTime     = 0x49
+)
+
+func TestSyncSELTime(t *testing.T) {
+	b := New()
+	// An hour behind, then set.
+	now := time.Unix(1600000000, 0)
+	b.Respond(netfnStorage, cmdGetSELTime, 0xF0, 0x01, 0x5E, 0x5F)
+	b.Respond(netfnStorage, cmdSetSELTime)
+	i := b.IPMI()
+
+	delta, err := ipmi.SyncSELTime(i, now, time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delta != -time.Hour {
+		t.Errorf("SyncSELTime = %v, want -1h", delta)
+	}
+	want := []Request{
+		{NetFn: netfnStorage, Cmd: cmdGetSELTime},
+		{NetFn: netfnStorage, Cmd: cmdSetSELTime, Data: []byte{0x00, 0x10, 0x5E, 0x5F}},
+	}
+	if got := b.Requests(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Requests() = %+v, want %+v", got, want)
+	}
+
+	if err := i.Close(); err != nil || !b.Closed() {
+		t.Errorf("Close() = %v, closed %t", err, b.Closed())
+	}
+	if _, err := i.GetSELTime(); err != ErrClosed {
+		t.Errorf("GetSELTime after Close = %v, want %v", err, ErrClosed)
+	}
+}
+
+func TestCompletionCodes(t *testing.T) {
+	b := New()
+	i := b.IPMI()
+
+	// Not scripted at all.
+	if err := i.ChassisControl(ipmi.ChassisPowerUp); err == nil || !strings.Contains(err.Error(), "0xc1") {
+		t.Errorf("ChassisControl = %v, want invalid command", err)
+	}
+
+	// Busy twice, then fine.
+	busy := func([]byte) ([]byte, error) { return []byte{CompletionNodeBusy}, nil }
+	b.Respond(netfnChassis, cmdChassisControl)
+	b.Queue(netfnChassis, cmdChassisControl, busy, busy)
+	for n, want := range []bool{false, false, true} {
+		if err := i.ChassisControl(ipmi.ChassisPowerCycle); (err == nil) != want {
+			t.Errorf("ChassisControl #%d = %v, want ok %t", n, err, want)
+		}
+	}
+
+	b.Fail(netfnChassis, cmdChassisControl, CompletionTimeout)
+	if err := i.ChassisControl(ipmi.ChassisPowerCycle); err == nil || !strings.Contains(err.Error(), "0xc3") {
+		t.Errorf("ChassisControl = %v, want timeout", err)
+	}
+}
+
+func TestHandle(t *testing.T) {
+	b := New()
+	lost := errors.New("lost")
+	b.Handle(netfnStorage, cmdSetSELTime, func(data []byte) ([]byte, error) {
+		if len(data) != 4 {
+			return []byte{CompletionUnspecified}, nil
+		}
+		return nil, lost
+	})
+	if err := b.IPMI().SetSELTime(time.Unix(1, 0)); err != lost {
+		t.Errorf("SetSELTime = %v, want %v", err, lost)
+	}
+}
@@ -0,0 +1,566 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"unsafe"
+)
+
+// LanParam is a LAN configuration parameter, IPMI v2.0 table 23-4.
+type LanParam byte
+
+// LAN configuration parameters.
+const (
+	LanSetInProgress         LanParam = 0
+	LanAuthTypeSupport       LanParam = 1
+	LanAuthTypeEnables       LanParam = 2
+	LanIPAddress             LanParam = 3
+	LanIPAddressSource       LanParam = 4
+	LanMACAddress            LanParam = 5
+	LanSubnetMask            LanParam = 6
+	LanIPv4HeaderParams      LanParam = 7
+	LanARPControl            LanParam = 10
+	LanGratuitousARPInterval LanParam = 11
+	LanDefaultGateway        LanParam = 12
+	LanDefaultGatewayMAC     LanParam = 13
+	LanBackupGateway         LanParam = 14
+	LanBackupGatewayMAC      LanParam = 15
+	LanCommunityString       LanParam = 16
+	LanNumDestinations       LanParam = 17
+	LanDestinationType       LanParam = 18
+	LanDestinationAddress    LanParam = 19
+	LanVLANID                LanParam = 20
+	LanVLANPriority          LanParam = 21
+	LanCipherSuiteSupport    LanParam = 22
+	LanCipherSuites          LanParam = 23
+	LanCipherSuitePrivileges LanParam = 24
+	LanDestinationVLAN       LanParam = 25
+)
+
+// lanParams are the parameters GetLanConfig reads, in order. Destinations
+// are read separately since they take a set selector.
+var lanParams = []LanParam{
+	LanSetInProgress,
+	LanAuthTypeSupport,
+	LanAuthTypeEnables,
+	LanIPAddress,
+	LanIPAddressSource,
+	LanMACAddress,
+	LanSubnetMask,
+	LanIPv4HeaderParams,
+	LanARPControl,
+	LanGratuitousARPInterval,
+	LanDefaultGateway,
+	LanDefaultGatewayMAC,
+	LanBackupGateway,
+	LanBackupGatewayMAC,
+	LanCommunityString,
+	LanNumDestinations,
+	LanVLANID,
+	LanVLANPriority,
+	LanCipherSuiteSupport,
+	LanCipherSuites,
+	LanCipherSuitePrivileges,
+}
+
+// ErrLanParamNotSupported is returned for parameters the BMC does not
+// implement.
+var ErrLanParamNotSupported = errors.New("LAN parameter not supported")
+
+// ErrLanSetInProgress is returned by SetLanConfig if another client is
+// setting parameters.
+var ErrLanSetInProgress = errors.New("LAN parameters are being set by another client")
+
+// Set In Progress states.
+const (
+	lanSetComplete   = 0
+	lanSetInProgress = 1
+	lanCommitWrite   = 2
+)
+
+// Set LAN Configuration Parameters completion codes.
+const (
+	ccLanParamNotSupported CompletionCode = 0x80
+	ccLanSetInProgress     CompletionCode = 0x81
+	ccLanParamReadOnly     CompletionCode = 0x82
+)
+
+// IPAddressSource says where the BMC got its IP address from.
+type IPAddressSource byte
+
+// IP address sources.
+const (
+	IPAddressSourceUnspecified IPAddressSource = 0
+	IPAddressSourceStatic      IPAddressSource = 1
+	IPAddressSourceDHCP        IPAddressSource = 2
+	IPAddressSourceBIOS        IPAddressSource = 3
+	IPAddressSourceOther       IPAddressSource = 4
+)
+
+func (s IPAddressSource) String() string {
+	switch s {
+	case IPAddressSourceUnspecified:
+		return "Unspecified"
+	case IPAddressSourceStatic:
+		return "Static Address"
+	case IPAddressSourceDHCP:
+		return "DHCP Address"
+	case IPAddressSourceBIOS:
+		return "BIOS Assigned Address"
+	case IPAddressSourceOther:
+		return "Other"
+	}
+	return fmt.Sprintf("Unknown (%d)", byte(s))
+}
+
+// Privilege is an IPMI privilege level.
+type Privilege byte
+
+// Privilege levels.
+const (
+	PrivilegeReserved Privilege = 0
+	PrivilegeCallback Privilege = 1
+	PrivilegeUser     Privilege = 2
+	PrivilegeOperator Privilege = 3
+	PrivilegeAdmin    Privilege = 4
+	PrivilegeOEM      Privilege = 5
+	// PrivilegeNoAccess is a user's privilege limit on a channel they
+	// cannot use.
+	PrivilegeNoAccess Privilege = 0x0F
+)
+
+func (p Privilege) String() string {
+	switch p {
+	case PrivilegeReserved:
+		return "Reserved"
+	case PrivilegeCallback:
+		return "Callback"
+	case PrivilegeUser:
+		return "User"
+	case PrivilegeOperator:
+		return "Operator"
+	case PrivilegeAdmin:
+		return "Administrator"
+	case PrivilegeOEM:
+		return "OEM"
+	case PrivilegeNoAccess:
+		return "No Access"
+	}
+	return fmt.Sprintf("Unknown (%d)", byte(p))
+}
+
+// LanDestination is an alert destination.
+type LanDestination struct {
+	Index            byte
+	Type             byte
+	Acknowledge      bool
+	AckTimeout       byte
+	Retries          byte
+	UseBackupGateway bool
+	IPAddress        net.IP
+	MACAddress       net.HardwareAddr
+
+	// VLAN tags of alerts to the destination.
+	VLANEnabled  bool
+	VLANID       uint16
+	VLANPriority byte
+}
+
+// LanConfig is the LAN configuration of a channel. Fields of parameters the
+// BMC does not support are left zero.
+type LanConfig struct {
+	Channel byte
+
+	SetInProgress     byte
+	AuthTypeSupport   byte
+	AuthTypeEnables   [5]byte
+	IPAddress         net.IP
+	IPAddressSource   IPAddressSource
+	MACAddress        net.HardwareAddr
+	SubnetMask        net.IPMask
+	TTL               byte
+	IPFlags           byte
+	TOS               byte
+	ARPControl        byte
+	GratuitousARP     byte // interval in 500ms units
+	DefaultGateway    net.IP
+	DefaultGatewayMAC net.HardwareAddr
+	BackupGateway     net.IP
+	BackupGatewayMAC  net.HardwareAddr
+	CommunityString   string
+	Destinations      []LanDestination
+	VLANEnabled       bool
+	VLANID            uint16
+	VLANPriority      byte
+
+	// CipherSuites are the supported RMCP+ cipher suite IDs, and
+	// CipherSuitePrivileges the highest privilege allowed with each.
+	CipherSuites          []byte
+	CipherSuitePrivileges []Privilege
+
+	// Raw holds the data of every parameter read, without the revision
+	// byte.
+	Raw map[LanParam][]byte
+}
+
+// GetLanConfigParam reads a LAN configuration parameter. It returns the
+// parameter data, without the revision byte.
+func (i *IPMI) GetLanConfigParam(channel byte, param LanParam, set, block byte) ([]byte, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_TRANSPORT
+	req.msg.cmd = _BMC_GET_LAN_CONFIG
+
+	var data [4]byte
+	data[0] = channel
+	data[1] = byte(param)
+	data[2] = set
+	data[3] = block
+	req.msg.data = unsafe.Pointer(&data[0])
+	req.msg.dataLen = 4
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return nil, err
+	}
+	err = req.completion(fmt.Sprintf("GetLanConfig(%d, %d)", channel, param), recv)
+	if isCompletion(err, ccLanParamNotSupported) {
+		return nil, ErrLanParamNotSupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(recv) < 2 {
+		return nil, fmt.Errorf("GetLanConfig(%d, %d): short response of %d bytes", channel, param, len(recv))
+	}
+	return recv[2:], nil
+}
+
+// GetLanConfig reads all LAN configuration parameters of a channel the BMC
+// supports.
+func (i *IPMI) GetLanConfig(channel byte) (*LanConfig, error) {
+	c := &LanConfig{Channel: channel, Raw: make(map[LanParam][]byte)}
+	for _, p := range lanParams {
+		b, err := i.GetLanConfigParam(channel, p, 0, 0)
+		if err == ErrLanParamNotSupported {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := c.set(p, b); err != nil {
+			return nil, err
+		}
+	}
+
+	// Destination 0 is the volatile one used by PET alerts; 1 to
+	// n are configured.
+	if b, ok := c.Raw[LanNumDestinations]; ok {
+		for d := 0; d <= int(b[0]&0xf); d++ {
+			t, err := i.GetLanConfigParam(channel, LanDestinationType, byte(d), 0)
+			if err == ErrLanParamNotSupported {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			a, err := i.GetLanConfigParam(channel, LanDestinationAddress, byte(d), 0)
+			if err != nil {
+				return nil, err
+			}
+			dest, err := parseLanDestination(t, a)
+			if err != nil {
+				return nil, err
+			}
+			v, err := i.GetLanConfigParam(channel, LanDestinationVLAN, byte(d), 0)
+			switch err {
+			case nil:
+				if err := dest.setVLAN(v); err != nil {
+					return nil, err
+				}
+			case ErrLanParamNotSupported:
+			default:
+				return nil, err
+			}
+			c.Destinations = append(c.Destinations, *dest)
+		}
+	}
+	return c, nil
+}
+
+// lanParamSize is the minimum size of each parameter's data.
+var lanParamSize = map[LanParam]int{
+	LanSetInProgress:         1,
+	LanAuthTypeSupport:       1,
+	LanAuthTypeEnables:       5,
+	LanIPAddress:             4,
+	LanIPAddressSource:       1,
+	LanMACAddress:            6,
+	LanSubnetMask:            4,
+	LanIPv4HeaderParams:      3,
+	LanARPControl:            1,
+	LanGratuitousARPInterval: 1,
+	LanDefaultGateway:        4,
+	LanDefaultGatewayMAC:     6,
+	LanBackupGateway:         4,
+	LanBackupGatewayMAC:      6,
+	LanCommunityString:       18,
+	LanNumDestinations:       1,
+	LanVLANID:                2,
+	LanVLANPriority:          1,
+	LanCipherSuiteSupport:    1,
+	LanCipherSuites:          1,
+	LanCipherSuitePrivileges: 9,
+}
+
+// set decodes the data b of parameter p into c.
+func (c *LanConfig) set(p LanParam, b []byte) error {
+	if len(b) < lanParamSize[p] {
+		return fmt.Errorf("LAN parameter %d is %d bytes, want %d", p, len(b), lanParamSize[p])
+	}
+	if c.Raw == nil {
+		c.Raw = make(map[LanParam][]byte)
+	}
+	c.Raw[p] = append([]byte(nil), b...)
+
+	switch p {
+	case LanSetInProgress:
+		c.SetInProgress = b[0] & 0x3
+	case LanAuthTypeSupport:
+		c.AuthTypeSupport = b[0] & 0x3f
+	case LanAuthTypeEnables:
+		copy(c.AuthTypeEnables[:], b)
+	case LanIPAddress:
+		c.IPAddress = net.IPv4(b[0], b[1], b[2], b[3])
+	case LanIPAddressSource:
+		c.IPAddressSource = IPAddressSource(b[0] & 0xf)
+	case LanMACAddress:
+		c.MACAddress = net.HardwareAddr(c.Raw[p][:6])
+	case LanSubnetMask:
+		c.SubnetMask = net.IPv4Mask(b[0], b[1], b[2], b[3])
+	case LanIPv4HeaderParams:
+		c.TTL, c.IPFlags, c.TOS = b[0], b[1]>>5, b[2]
+	case LanARPControl:
+		c.ARPControl = b[0] & 0x3
+	case LanGratuitousARPInterval:
+		c.GratuitousARP = b[0]
+	case LanDefaultGateway:
+		c.DefaultGateway = net.IPv4(b[0], b[1], b[2], b[3])
+	case LanDefaultGatewayMAC:
+		c.DefaultGatewayMAC = net.HardwareAddr(c.Raw[p][:6])
+	case LanBackupGateway:
+		c.BackupGateway = net.IPv4(b[0], b[1], b[2], b[3])
+	case LanBackupGatewayMAC:
+		c.BackupGatewayMAC = net.HardwareAddr(c.Raw[p][:6])
+	case LanCommunityString:
+		c.CommunityString = string(bytes.TrimRight(b[:18], "\x00"))
+	case LanVLANID:
+		id := binary.LittleEndian.Uint16(b)
+		c.VLANEnabled = id&0x8000 != 0
+		c.VLANID = id & 0xfff
+	case LanVLANPriority:
+		c.VLANPriority = b[0] & 0x7
+	case LanCipherSuites:
+		// The first byte is reserved. Trust the count from
+		// LanCipherSuiteSupport over the response length if there
+		// is one.
+		ids := b[1:]
+		if s, ok := c.Raw[LanCipherSuiteSupport]; ok && int(s[0]&0x1f) < len(ids) {
+			ids = ids[:s[0]&0x1f]
+		}
+		c.CipherSuites = append([]byte(nil), ids...)
+	case LanCipherSuitePrivileges:
+		// One nibble per cipher suite entry, low nibble first, after
+		// a reserved byte.
+		n := len(c.CipherSuites)
+		if n == 0 || n > 16 {
+			n = 16
+		}
+		c.CipherSuitePrivileges = make([]Privilege, n)
+		for k := range c.CipherSuitePrivileges {
+			c.CipherSuitePrivileges[k] = Privilege(b[1+k/2] >> (4 * uint(k%2)) & 0xf)
+		}
+	}
+	return nil
+}
+
+// parseLanDestination decodes the destination type and destination address
+// parameters of one destination.
+func parseLanDestination(typ, addr []byte) (*LanDestination, error) {
+	if len(typ) < 4 {
+		return nil, fmt.Errorf("LAN destination type is %d bytes, want 4", len(typ))
+	}
+	if len(addr) < 13 {
+		return nil, fmt.Errorf("LAN destination address is %d bytes, want 13", len(addr))
+	}
+	return &LanDestination{
+		Index:            typ[0] & 0xf,
+		Type:             typ[1] & 0x7,
+		Acknowledge:      typ[1]&0x80 != 0,
+		AckTimeout:       typ[2],
+		Retries:          typ[3] & 0x7,
+		UseBackupGateway: addr[2]&0x1 != 0,
+		IPAddress:        net.IPv4(addr[3], addr[4], addr[5], addr[6]),
+		MACAddress:       append(net.HardwareAddr(nil), addr[7:13]...),
+	}, nil
+}
+
+// setVLAN decodes the destination address VLAN tags parameter of d.
+func (d *LanDestination) setVLAN(b []byte) error {
+	if len(b) < 4 {
+		return fmt.Errorf("LAN destination VLAN is %d bytes, want 4", len(b))
+	}
+	// Address format 1 is an 802.1q tag, the others have none.
+	if b[1]>>4 != 1 {
+		return nil
+	}
+	tag := binary.LittleEndian.Uint16(b[2:])
+	d.VLANEnabled = true
+	d.VLANID = tag & 0xfff
+	d.VLANPriority = byte(tag >> 13)
+	return nil
+}
+
+// SetLanConfigParam writes a LAN configuration parameter, outside of the
+// Set In Progress handshake of SetLanConfig.
+func (i *IPMI) SetLanConfigParam(channel byte, param LanParam, data []byte) error {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_TRANSPORT
+	req.msg.cmd = _BMC_SET_LAN_CONFIG
+
+	b := append([]byte{channel & 0x0F, byte(param)}, data...)
+	req.msg.data = unsafe.Pointer(&b[0])
+	req.msg.dataLen = uint16(len(b))
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return err
+	}
+	err = req.completion(fmt.Sprintf("SetLanConfig(%d, %d)", channel, param), recv)
+	switch {
+	case isCompletion(err, ccLanParamNotSupported):
+		return ErrLanParamNotSupported
+	case isCompletion(err, ccLanSetInProgress):
+		return ErrLanSetInProgress
+	case isCompletion(err, ccLanParamReadOnly):
+		return fmt.Errorf("LAN parameter %d is read-only: %w", param, err)
+	}
+	return err
+}
+
+// LanSetting is a LAN configuration parameter to set, and its data.
+type LanSetting struct {
+	Param LanParam
+	Data  []byte
+}
+
+// SetLanConfig writes settings in order, between claiming Set In Progress
+// and committing them, so other clients do not write at the same time and
+// the BMC applies them together. BMCs without Set In Progress get the
+// settings as they are.
+func (i *IPMI) SetLanConfig(channel byte, settings ...LanSetting) (err error) {
+	lock := true
+	switch err := i.SetLanConfigParam(channel, LanSetInProgress, []byte{lanSetInProgress}); err {
+	case nil:
+	case ErrLanParamNotSupported:
+		lock = false
+	default:
+		return err
+	}
+	if lock {
+		defer func() {
+			// Release Set In Progress even if a setting failed.
+			if rerr := i.SetLanConfigParam(channel, LanSetInProgress, []byte{lanSetComplete}); err == nil {
+				err = rerr
+			}
+		}()
+	}
+	for _, s := range settings {
+		if err := i.SetLanConfigParam(channel, s.Param, s.Data); err != nil {
+			return err
+		}
+	}
+	if lock {
+		// Commit Write is optional, and BMCs without it apply settings
+		// as they are written.
+		err := i.SetLanConfigParam(channel, LanSetInProgress, []byte{lanCommitWrite})
+		if err != nil && err != ErrLanParamNotSupported && !isCompletion(err, CompletionInvalidDataField) {
+			return err
+		}
+	}
+	return nil
+}
+
+func ipv4(name string, ip net.IP) ([]byte, error) {
+	b := ip.To4()
+	if b == nil {
+		return nil, fmt.Errorf("%s %v is not an IPv4 address", name, ip)
+	}
+	return append([]byte(nil), b...), nil
+}
+
+// SetLanIPAddressSource sets where the BMC gets its IP address from,
+// IPAddressSourceStatic or IPAddressSourceDHCP.
+func (i *IPMI) SetLanIPAddressSource(channel byte, src IPAddressSource) error {
+	if src != IPAddressSourceStatic && src != IPAddressSourceDHCP {
+		return fmt.Errorf("cannot set the IP address source to %v", src)
+	}
+	return i.SetLanConfig(channel, LanSetting{LanIPAddressSource, []byte{byte(src)}})
+}
+
+// SetLanStaticIP gives the BMC a static address, subnet mask and, if it is
+// not nil, default gateway.
+func (i *IPMI) SetLanStaticIP(channel byte, ip net.IP, mask net.IPMask, gateway net.IP) error {
+	addr, err := ipv4("IP address", ip)
+	if err != nil {
+		return err
+	}
+	if len(mask) != net.IPv4len {
+		return fmt.Errorf("subnet mask %v is not an IPv4 mask", mask)
+	}
+	settings := []LanSetting{
+		{LanIPAddressSource, []byte{byte(IPAddressSourceStatic)}},
+		{LanIPAddress, addr},
+		{LanSubnetMask, append([]byte(nil), mask...)},
+	}
+	if gateway != nil {
+		gw, err := ipv4("gateway", gateway)
+		if err != nil {
+			return err
+		}
+		settings = append(settings, LanSetting{LanDefaultGateway, gw})
+	}
+	return i.SetLanConfig(channel, settings...)
+}
+
+// SetLanVLAN puts the BMC on VLAN id, 1 to 4094, or takes it off VLANs if
+// id is 0.
+func (i *IPMI) SetLanVLAN(channel byte, id uint16) error {
+	if id > 4094 {
+		return fmt.Errorf("VLAN ID %d is not within [1, 4094]", id)
+	}
+	v := id
+	if id != 0 {
+		v |= 0x8000
+	}
+	var b [2]byte
+	binary.LittleEndian.PutUint16(b[:], v)
+	return i.SetLanConfig(channel, LanSetting{LanVLANID, b[:]})
+}
+
+// SetLanCommunityString sets the SNMP community of PET alerts, of at most
+// 18 bytes.
+func (i *IPMI) SetLanCommunityString(channel byte, community string) error {
+	if len(community) > lanParamSize[LanCommunityString] {
+		return fmt.Errorf("community string %q is longer than %d bytes", community, lanParamSize[LanCommunityString])
+	}
+	b := make([]byte, lanParamSize[LanCommunityString])
+	copy(b, community)
+	return i.SetLanConfig(channel, LanSetting{LanCommunityString, b})
+}
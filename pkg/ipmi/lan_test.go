@@ -0,0 +1,212 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLanConfigSet(t *testing.T) {
+	var c LanConfig
+	for _, p := range []struct {
+		param LanParam
+		data  []byte
+	}{
+		{LanIPAddress, []byte{10, 0, 0, 5}},
+		{LanIPAddressSource, []byte{0x02}},
+		{LanMACAddress, []byte{0x52, 0x54, 0x00, 0x12, 0x34, 0x56}},
+		{LanSubnetMask, []byte{255, 255, 255, 0}},
+		{LanDefaultGateway, []byte{10, 0, 0, 1}},
+		{LanCommunityString, []byte("public\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")},
+		{LanVLANID, []byte{0x2c, 0x81}},
+		{LanVLANPriority, []byte{0x03}},
+		{LanCipherSuiteSupport, []byte{3}},
+		{LanCipherSuites, []byte{0, 3, 17, 1, 0, 0}},
+		{LanCipherSuitePrivileges, []byte{0, 0x44, 0x02, 0, 0, 0, 0, 0, 0}},
+	} {
+		if err := c.set(p.param, p.data); err != nil {
+			t.Fatalf("set(%d, %v) = %v", p.param, p.data, err)
+		}
+	}
+
+	if !c.IPAddress.Equal(net.IPv4(10, 0, 0, 5)) {
+		t.Errorf("IPAddress = %v", c.IPAddress)
+	}
+	if c.IPAddressSource != IPAddressSourceDHCP {
+		t.Errorf("IPAddressSource = %v", c.IPAddressSource)
+	}
+	if c.MACAddress.String() != "52:54:00:12:34:56" {
+		t.Errorf("MACAddress = %v", c.MACAddress)
+	}
+	if c.SubnetMask.String() != "ffffff00" {
+		t.Errorf("SubnetMask = %v", c.SubnetMask)
+	}
+	if !c.DefaultGateway.Equal(net.IPv4(10, 0, 0, 1)) {
+		t.Errorf("DefaultGateway = %v", c.DefaultGateway)
+	}
+	if c.CommunityString != "public" {
+		t.Errorf("CommunityString = %q", c.CommunityString)
+	}
+	if !c.VLANEnabled || c.VLANID != 300 || c.VLANPriority != 3 {
+		t.Errorf("VLAN = %v, %d, %d, want true, 300, 3", c.VLANEnabled, c.VLANID, c.VLANPriority)
+	}
+	if want := []byte{3, 17, 1}; !reflect.DeepEqual(c.CipherSuites, want) {
+		t.Errorf("CipherSuites = %v, want %v", c.CipherSuites, want)
+	}
+	if want := []Privilege{PrivilegeAdmin, PrivilegeAdmin, PrivilegeUser}; !reflect.DeepEqual(c.CipherSuitePrivileges, want) {
+		t.Errorf("CipherSuitePrivileges = %v, want %v", c.CipherSuitePrivileges, want)
+	}
+
+	if err := c.set(LanMACAddress, []byte{1, 2}); err == nil {
+		t.Errorf("set(short MAC) = nil, want error")
+	}
+}
+
+func TestParseLanDestination(t *testing.T) {
+	d, err := parseLanDestination(
+		[]byte{1, 0x80, 3, 2},
+		[]byte{1, 0, 1, 10, 0, 0, 9, 0x52, 0x54, 0, 0xaa, 0xbb, 0xcc},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &LanDestination{
+		Index:            1,
+		Acknowledge:      true,
+		AckTimeout:       3,
+		Retries:          2,
+		UseBackupGateway: true,
+		IPAddress:        net.IPv4(10, 0, 0, 9),
+		MACAddress:       net.HardwareAddr{0x52, 0x54, 0, 0xaa, 0xbb, 0xcc},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("parseLanDestination() = %+v, want %+v", d, want)
+	}
+}
+
+func TestGetLanConfig(t *testing.T) {
+	params := map[[2]byte][]byte{
+		{byte(LanIPAddress), 0}:          {192, 168, 1, 20},
+		{byte(LanMACAddress), 0}:         {0x52, 0x54, 0, 1, 2, 3},
+		{byte(LanVLANID), 0}:             {0x0a, 0x80},
+		{byte(LanNumDestinations), 0}:    {1},
+		{byte(LanDestinationType), 0}:    {0, 0, 0, 0},
+		{byte(LanDestinationAddress), 0}: {0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		{byte(LanDestinationType), 1}:    {1, 0x80, 5, 3},
+		{byte(LanDestinationAddress), 1}: {1, 0, 0, 10, 0, 0, 9, 0x52, 0x54, 0, 0xaa, 0xbb, 0xcc},
+		{byte(LanDestinationVLAN), 1}:    {1, 0x10, 0x2c, 0x61},
+	}
+	f := &fakeTransport{}
+	f.handle(_IPMI_NETFN_TRANSPORT, _BMC_GET_LAN_CONFIG, configParams(params, 1, ccLanParamNotSupported))
+	i := &IPMI{Transport: f}
+
+	c, err := i.GetLanConfig(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.IPAddress.Equal(net.IPv4(192, 168, 1, 20)) || c.MACAddress.String() != "52:54:00:01:02:03" || !c.VLANEnabled || c.VLANID != 10 {
+		t.Errorf("GetLanConfig = IP %v, MAC %v, VLAN %t %d", c.IPAddress, c.MACAddress, c.VLANEnabled, c.VLANID)
+	}
+	if c.SubnetMask != nil || len(c.Raw) != 4 {
+		t.Errorf("GetLanConfig decoded unsupported parameters: %v", c.Raw)
+	}
+	want := []LanDestination{
+		{IPAddress: net.IPv4(0, 0, 0, 0), MACAddress: net.HardwareAddr{0, 0, 0, 0, 0, 0}},
+		{
+			Index:        1,
+			Acknowledge:  true,
+			AckTimeout:   5,
+			Retries:      3,
+			IPAddress:    net.IPv4(10, 0, 0, 9),
+			MACAddress:   net.HardwareAddr{0x52, 0x54, 0, 0xaa, 0xbb, 0xcc},
+			VLANEnabled:  true,
+			VLANID:       300,
+			VLANPriority: 3,
+		},
+	}
+	if !reflect.DeepEqual(c.Destinations, want) {
+		t.Errorf("Destinations = %+v, want %+v", c.Destinations, want)
+	}
+}
+
+func setInProgress(state byte) []byte {
+	return []byte{_IPMI_NETFN_TRANSPORT, _BMC_SET_LAN_CONFIG, 1, byte(LanSetInProgress), state}
+}
+
+func TestSetLanConfig(t *testing.T) {
+	// The BMC answers Set LAN Configuration Parameters with the
+	// completion code of each parameter and data in cc, 0 for those not
+	// listed.
+	var cc map[[2]byte]byte
+	l := &fakeTransport{}
+	l.handle(_IPMI_NETFN_TRANSPORT, _BMC_SET_LAN_CONFIG, func(data []byte) []byte {
+		return []byte{cc[[2]byte{data[1], data[2]}]}
+	})
+	i := &IPMI{Transport: l}
+
+	if err := i.SetLanStaticIP(1, net.IPv4(10, 0, 0, 5), net.CIDRMask(24, 32), net.IPv4(10, 0, 0, 1)); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]byte{
+		setInProgress(lanSetInProgress),
+		{_IPMI_NETFN_TRANSPORT, _BMC_SET_LAN_CONFIG, 1, byte(LanIPAddressSource), 1},
+		{_IPMI_NETFN_TRANSPORT, _BMC_SET_LAN_CONFIG, 1, byte(LanIPAddress), 10, 0, 0, 5},
+		{_IPMI_NETFN_TRANSPORT, _BMC_SET_LAN_CONFIG, 1, byte(LanSubnetMask), 255, 255, 255, 0},
+		{_IPMI_NETFN_TRANSPORT, _BMC_SET_LAN_CONFIG, 1, byte(LanDefaultGateway), 10, 0, 0, 1},
+		setInProgress(lanCommitWrite),
+		setInProgress(lanSetComplete),
+	}
+	if !reflect.DeepEqual(l.requests, want) {
+		t.Errorf("SetLanStaticIP sent %#x, want %#x", l.requests, want)
+	}
+
+	// Commit Write is optional, and so is Set In Progress.
+	l.requests = nil
+	cc = map[[2]byte]byte{{byte(LanSetInProgress), lanCommitWrite}: byte(CompletionInvalidDataField)}
+	if err := i.SetLanVLAN(1, 300); err != nil {
+		t.Fatal(err)
+	}
+	if got := l.requests[1]; !reflect.DeepEqual(got, []byte{_IPMI_NETFN_TRANSPORT, _BMC_SET_LAN_CONFIG, 1, byte(LanVLANID), 0x2c, 0x81}) {
+		t.Errorf("SetLanVLAN sent %#x", got)
+	}
+	l.requests = nil
+	cc = map[[2]byte]byte{{byte(LanSetInProgress), lanSetInProgress}: byte(ccLanParamNotSupported)}
+	if err := i.SetLanIPAddressSource(1, IPAddressSourceDHCP); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.requests) != 2 {
+		t.Errorf("SetLanIPAddressSource without Set In Progress sent %#x", l.requests)
+	}
+
+	// Set In Progress is released after a failure.
+	l.requests = nil
+	cc = map[[2]byte]byte{{byte(LanVLANID), 0}: byte(ccLanParamReadOnly)}
+	if err := i.SetLanVLAN(1, 0); err == nil || !strings.Contains(err.Error(), "read-only") {
+		t.Errorf("SetLanVLAN of a read-only parameter = %v", err)
+	}
+	if got := l.requests[len(l.requests)-1]; !reflect.DeepEqual(got, setInProgress(lanSetComplete)) {
+		t.Errorf("SetLanConfig ended with %#x, want Set Complete", got)
+	}
+
+	cc = map[[2]byte]byte{{byte(LanSetInProgress), lanSetInProgress}: byte(ccLanSetInProgress)}
+	if err := i.SetLanCommunityString(1, "public"); err != ErrLanSetInProgress {
+		t.Errorf("SetLanCommunityString while in progress = %v, want %v", err, ErrLanSetInProgress)
+	}
+
+	for _, err := range []error{
+		i.SetLanStaticIP(1, net.ParseIP("fe80::1"), net.CIDRMask(24, 32), nil),
+		i.SetLanStaticIP(1, net.IPv4(10, 0, 0, 5), net.CIDRMask(64, 128), nil),
+		i.SetLanVLAN(1, 4095),
+		i.SetLanIPAddressSource(1, IPAddressSourceBIOS),
+		i.SetLanCommunityString(1, "a community of 19 b"),
+	} {
+		if err == nil {
+			t.Error("invalid setting did not fail")
+		}
+	}
+}
@@ -0,0 +1,785 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LANConfig is how DialLAN logs in to a BMC.
+type LANConfig struct {
+	// Username and Password are of a BMC user. Passwords are of up to
+	// 20 bytes.
+	Username string
+	Password string
+
+	// Privilege is the privilege level of the session, Administrator
+	// if 0.
+	Privilege Privilege
+
+	// CipherSuite is 3 (SHA-1) or 17 (SHA-256), with AES-128 for both.
+	// 0 tries 17, then 3.
+	CipherSuite int
+
+	// BMCKey is the BMC's key, K_G, if it has one set.
+	BMCKey []byte
+
+	// Timeout is how long to wait for each response, a second if 0.
+	// A request is sent Retries more times before giving up.
+	Timeout time.Duration
+	Retries int
+}
+
+// DialLAN opens an RMCP+ (IPMI v2.0 LAN) session to the BMC at addr, a host
+// with an optional port, 623 by default. The IPMI it returns sends commands
+// to that BMC rather than to the local one; Close closes the session.
+func DialLAN(addr string, c *LANConfig) (*IPMI, error) {
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, strconv.Itoa(rmcpPort))
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newLANSession(conn, c)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("IPMI session to %s: %v", addr, err)
+	}
+	return &IPMI{Transport: s}, nil
+}
+
+// RMCP and RMCP+ packets, IPMI v2.0 section 13.
+const (
+	rmcpPort      = 623
+	rmcpVersion   = 0x06
+	rmcpNoAck     = 0xFF
+	rmcpClassIPMI = 0x07
+
+	// authTypeRMCPPlus is the authentication type of IPMI v2.0
+	// session headers.
+	authTypeRMCPPlus = 0x06
+
+	// RMCP+ headers are the RMCP header, authentication type, payload
+	// type, session ID, session sequence number and payload length.
+	rmcpHeaderLen    = 4
+	sessionHeaderLen = 12
+
+	payloadIPMI            = 0x00
+	payloadSOL             = 0x01
+	payloadOpenSessionReq  = 0x10
+	payloadOpenSessionResp = 0x11
+	payloadRAKP1           = 0x12
+	payloadRAKP2           = 0x13
+	payloadRAKP3           = 0x14
+	payloadRAKP4           = 0x15
+
+	payloadEncrypted     = 0x80
+	payloadAuthenticated = 0x40
+	payloadTypeMask      = 0x3F
+
+	// nextHeader ends the integrity trailer.
+	nextHeader = 0x07
+
+	// rakpNameOnly has the BMC look the user up by name only, not by
+	// name and privilege.
+	rakpNameOnly = 0x10
+
+	// Addresses of IPMI messages over LAN.
+	bmcSlaveAddr      = 0x20
+	remoteConsoleAddr = 0x81
+
+	// kuidLen is the length of user keys: passwords padded with zeros.
+	kuidLen = 20
+)
+
+// A cipherSuite is the algorithms of an RMCP+ cipher suite, IPMI v2.0
+// table 22-20.
+type cipherSuite struct {
+	id byte
+
+	// Algorithm numbers.
+	auth            byte
+	integrity       byte
+	confidentiality byte
+
+	// hash is the HMAC hash of RAKP and integrity.
+	hash func() hash.Hash
+
+	// icvLen is the length of the RAKP 4 integrity check value, and
+	// authCodeLen that of the integrity trailer of packets.
+	icvLen      int
+	authCodeLen int
+}
+
+const confidentialityAESCBC128 = 0x01
+
+var cipherSuites = map[int]*cipherSuite{
+	// RAKP-HMAC-SHA1, HMAC-SHA1-96, AES-CBC-128.
+	3: {id: 3, auth: 0x01, integrity: 0x01, confidentiality: confidentialityAESCBC128, hash: sha1.New, icvLen: 12, authCodeLen: 12},
+	// RAKP-HMAC-SHA256, HMAC-SHA256-128, AES-CBC-128.
+	17: {id: 17, auth: 0x03, integrity: 0x04, confidentiality: confidentialityAESCBC128, hash: sha256.New, icvLen: 16, authCodeLen: 16},
+}
+
+// rmcpStatus are RMCP+ status codes, IPMI v2.0 table 13-15.
+var rmcpStatus = map[byte]string{
+	0x01: "insufficient resources to create a session",
+	0x02: "invalid session ID",
+	0x03: "invalid payload type",
+	0x04: "invalid authentication algorithm",
+	0x05: "invalid integrity algorithm",
+	0x06: "no matching authentication payload",
+	0x07: "no matching integrity payload",
+	0x08: "inactive session ID",
+	0x09: "invalid role",
+	0x0A: "unauthorized role or privilege level requested",
+	0x0B: "insufficient resources to create a session at the requested role",
+	0x0C: "invalid name length",
+	0x0D: "unauthorized name",
+	0x0E: "unauthorized GUID",
+	0x0F: "invalid integrity check value",
+	0x10: "invalid confidentiality algorithm",
+	0x11: "no cipher suite match with proposed security algorithms",
+	0x12: "illegal or unrecognized parameter",
+}
+
+type rmcpStatusError byte
+
+func (e rmcpStatusError) Error() string {
+	if s, ok := rmcpStatus[byte(e)]; ok {
+		return s
+	}
+	return fmt.Sprintf("RMCP+ status %#02x", byte(e))
+}
+
+// unsupportedSuite says whether an open session error means the BMC does
+// not do the cipher suite.
+func unsupportedSuite(err error) bool {
+	e, ok := err.(rmcpStatusError)
+	return ok && (e == 0x04 || e == 0x05 || e == 0x10 || e == 0x11)
+}
+
+// lanSession is an RMCP+ session. The same code makes and checks packets
+// on either end, so localID is the session ID of our end, which packets to
+// us carry, and remoteID that of the other.
+type lanSession struct {
+	conn    net.Conn
+	timeout time.Duration
+	retries int
+	suite   *cipherSuite
+
+	localID  uint32
+	remoteID uint32
+
+	// seq is the session sequence number of the last packet sent, and
+	// rqSeq the sequence number of the last IPMI request.
+	seq   uint32
+	rqSeq byte
+
+	// tag is the message tag of the last session setup message.
+	tag byte
+
+	// k1 and k2 are the integrity and confidentiality keys, set once
+	// the session is up.
+	k1, k2 []byte
+
+	// mu serializes requests, and wmu packets sent, which SOL acks are
+	// too.
+	mu  sync.Mutex
+	wmu sync.Mutex
+
+	// Once SOL is active, a goroutine reads packets: SOL packets go to
+	// sol, which gets nil when the reader stops, and the others to recv.
+	recv  chan lanPacket
+	solMu sync.Mutex
+	sol   func([]byte)
+}
+
+type lanPacket struct {
+	typ     byte
+	payload []byte
+}
+
+var errLANTimeout = errors.New("timeout")
+
+func newLANSession(conn net.Conn, c *LANConfig) (*lanSession, error) {
+	if len(c.Username) > 16 {
+		return nil, fmt.Errorf("user name %q is longer than 16 bytes", c.Username)
+	}
+	if len(c.Password) > kuidLen {
+		return nil, fmt.Errorf("password is longer than %d bytes", kuidLen)
+	}
+	priv := c.Privilege
+	if priv == 0 {
+		priv = PrivilegeAdmin
+	}
+	s := &lanSession{conn: conn, timeout: c.Timeout, retries: c.Retries}
+	if s.timeout == 0 {
+		s.timeout = time.Second
+	}
+
+	suites := []int{17, 3}
+	if c.CipherSuite != 0 {
+		if _, ok := cipherSuites[c.CipherSuite]; !ok {
+			return nil, fmt.Errorf("unsupported cipher suite %d", c.CipherSuite)
+		}
+		suites = []int{c.CipherSuite}
+	}
+	var err error
+	for _, id := range suites {
+		if err = s.open(cipherSuites[id], priv); !unsupportedSuite(err) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.rakp(c, priv); err != nil {
+		return nil, err
+	}
+
+	// Sessions start at user level.
+	if priv > PrivilegeUser {
+		resp, err := s.SendRecv(_IPMI_NETFN_APP, _BMC_SET_SESSION_PRIVILEGE, []byte{byte(priv)})
+		if err == nil {
+			err = checkCompletion(fmt.Sprintf("setting session privilege to %v", priv), _IPMI_NETFN_APP, _BMC_SET_SESSION_PRIVILEGE, resp)
+		}
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// open sends Open Session Request, which proposes a cipher suite and gets
+// the BMC's session ID.
+func (s *lanSession) open(suite *cipherSuite, priv Privilege) error {
+	id, err := randomID()
+	if err != nil {
+		return err
+	}
+	s.suite, s.localID = suite, id
+
+	s.tag++
+	req := make([]byte, 32)
+	req[0] = s.tag
+	req[1] = byte(priv)
+	binary.LittleEndian.PutUint32(req[4:], s.localID)
+	// Authentication, integrity and confidentiality payloads.
+	for i, alg := range []byte{suite.auth, suite.integrity, suite.confidentiality} {
+		p := req[8+8*i:]
+		p[0], p[3], p[4] = byte(i), 8, alg
+	}
+
+	resp, err := s.exchange(context.Background(), payloadOpenSessionReq, req, s.setupReply(payloadOpenSessionResp))
+	if err != nil {
+		return fmt.Errorf("open session: %v", err)
+	}
+	if resp[1] != 0 {
+		return rmcpStatusError(resp[1])
+	}
+	if len(resp) < 12 || binary.LittleEndian.Uint32(resp[4:]) != s.localID {
+		return fmt.Errorf("open session: bad response %#x", resp)
+	}
+	s.remoteID = binary.LittleEndian.Uint32(resp[8:])
+	return nil
+}
+
+// rakp authenticates with RAKP messages 1 to 4 and derives the session
+// keys, IPMI v2.0 section 13.31.
+func (s *lanSession) rakp(c *LANConfig, priv Privilege) error {
+	rm := make([]byte, 16)
+	if _, err := rand.Read(rm); err != nil {
+		return err
+	}
+	user := []byte(c.Username)
+	// The requested role, and the user name with its length.
+	roleUser := append([]byte{byte(priv) | rakpNameOnly, byte(len(user))}, user...)
+
+	s.tag++
+	req := make([]byte, 24, 28+len(user))
+	req[0] = s.tag
+	binary.LittleEndian.PutUint32(req[4:], s.remoteID)
+	copy(req[8:], rm)
+	req = append(req, roleUser[0], 0, 0)
+	req = append(req, roleUser[1:]...)
+
+	resp, err := s.exchange(context.Background(), payloadRAKP1, req, s.setupReply(payloadRAKP2))
+	if err != nil {
+		return fmt.Errorf("RAKP 1: %v", err)
+	}
+	if resp[1] != 0 {
+		return fmt.Errorf("RAKP 2: %v", rmcpStatusError(resp[1]))
+	}
+	size := s.suite.hash().Size()
+	if len(resp) < 40+size {
+		return fmt.Errorf("RAKP 2: short message of %d bytes", len(resp))
+	}
+	rc, guid := resp[8:24], resp[24:40]
+
+	kuid := make([]byte, kuidLen)
+	copy(kuid, c.Password)
+	if !hmac.Equal(resp[40:40+size], s.hmac(kuid, uint32LE(s.localID), uint32LE(s.remoteID), rm, rc, guid, roleUser)) {
+		return errors.New("RAKP 2: bad key exchange auth code, wrong password?")
+	}
+
+	kg := kuid
+	if len(c.BMCKey) > 0 {
+		kg = make([]byte, kuidLen)
+		copy(kg, c.BMCKey)
+	}
+	sik := s.hmac(kg, rm, rc, roleUser)
+
+	s.tag++
+	req = make([]byte, 8, 8+size)
+	req[0] = s.tag
+	binary.LittleEndian.PutUint32(req[4:], s.remoteID)
+	req = append(req, s.hmac(kuid, rc, uint32LE(s.localID), roleUser)...)
+
+	resp, err = s.exchange(context.Background(), payloadRAKP3, req, s.setupReply(payloadRAKP4))
+	if err != nil {
+		return fmt.Errorf("RAKP 3: %v", err)
+	}
+	if resp[1] != 0 {
+		return fmt.Errorf("RAKP 4: %v", rmcpStatusError(resp[1]))
+	}
+	icv := s.hmac(sik, rm, uint32LE(s.remoteID), guid)[:s.suite.icvLen]
+	if len(resp) < 8+len(icv) || !hmac.Equal(resp[8:8+len(icv)], icv) {
+		return errors.New("RAKP 4: bad integrity check value")
+	}
+
+	s.setKeys(sik)
+	return nil
+}
+
+// setKeys derives the integrity and confidentiality keys from the session
+// integrity key, which starts the session.
+func (s *lanSession) setKeys(sik []byte) {
+	const1, const2 := make([]byte, kuidLen), make([]byte, kuidLen)
+	for i := range const1 {
+		const1[i], const2[i] = 0x01, 0x02
+	}
+	s.k1 = s.hmac(sik, const1)
+	s.k2 = s.hmac(sik, const2)
+}
+
+// setupReply accepts a reply of typ to the last session setup message.
+func (s *lanSession) setupReply(typ byte) func(byte, []byte) bool {
+	tag := s.tag
+	return func(t byte, p []byte) bool {
+		return t == typ && len(p) >= 8 && p[0] == tag
+	}
+}
+
+func (s *lanSession) hmac(key []byte, data ...[]byte) []byte {
+	h := hmac.New(s.suite.hash, key)
+	for _, d := range data {
+		h.Write(d)
+	}
+	return h.Sum(nil)
+}
+
+func uint32LE(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+// randomID returns a random non-zero session ID.
+func randomID() (uint32, error) {
+	b := make([]byte, 4)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			return 0, err
+		}
+		if id := binary.LittleEndian.Uint32(b); id != 0 {
+			return id, nil
+		}
+	}
+}
+
+// SendRecv implements Transport.SendRecv, sending the request in the
+// session.
+func (s *lanSession) SendRecv(netfn, cmd byte, data []byte) ([]byte, error) {
+	return s.SendRecvContext(context.Background(), netfn, cmd, data)
+}
+
+// SendRecvContext implements ContextTransport.SendRecvContext. The request
+// is sent again each LANConfig.Timeout until ctx is done or the retries
+// run out.
+func (s *lanSession) SendRecvContext(ctx context.Context, netfn, cmd byte, data []byte) ([]byte, error) {
+	return s.SendRecvTo(ctx, Addr{}, netfn, cmd, data)
+}
+
+// SendRecvTo implements AddrTransport.SendRecvTo. Requests to other
+// controllers than the BMC are wrapped in Send Message requests, once or,
+// through a transit controller, twice, which the BMC tracks. The BMC
+// acknowledges each Send Message request, and then hands back the response
+// on its own or embedded in its Send Message response.
+func (s *lanSession) SendRecvTo(ctx context.Context, a Addr, netfn, cmd byte, data []byte) ([]byte, error) {
+	if err := a.check(); err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rqSeq = (s.rqSeq + 1) & 0x3F
+	rqSeq := s.rqSeq
+	var msg []byte
+	bridging := !a.bmc()
+	if !bridging {
+		msg = ipmbMessage(bmcSlaveAddr, netfn, a.LUN, remoteConsoleAddr, rqSeq, cmd, data)
+	} else {
+		// The BMC is the requester on its channels.
+		msg = ipmbMessage(a.Target, netfn, a.LUN, bmcSlaveAddr, rqSeq, cmd, data)
+		channel := a.Channel
+		if a.double() {
+			msg = ipmbMessage(a.TransitTarget, _IPMI_NETFN_APP, 0, bmcSlaveAddr, rqSeq, _BMC_SEND_MESSAGE, sendMessage(a.Channel, true, msg))
+			channel = a.TransitChannel
+		}
+		msg = ipmbMessage(bmcSlaveAddr, _IPMI_NETFN_APP, 0, remoteConsoleAddr, rqSeq, _BMC_SEND_MESSAGE, sendMessage(channel, true, msg))
+	}
+
+	resp, err := s.exchange(ctx, payloadIPMI, msg, func(t byte, p []byte) bool {
+		if t != payloadIPMI || len(p) < 8 || p[4]>>2 != rqSeq {
+			return false
+		}
+		// Response netfns are odd.
+		if bridging && p[1]>>2 == _IPMI_NETFN_APP|1 && p[5] == _BMC_SEND_MESSAGE {
+			// Failed, or with the response embedded, rather than
+			// just acknowledged.
+			return p[6] != 0 || len(p) > 8
+		}
+		return p[1]>>2 == netfn|1 && p[5] == cmd
+	})
+	if err != nil {
+		return nil, err
+	}
+	if checksum(resp[:3]) != 0 || checksum(resp[3:]) != 0 {
+		return nil, fmt.Errorf("IPMI response with bad checksum: %#x", resp)
+	}
+	if bridging && resp[1]>>2 == _IPMI_NETFN_APP|1 && resp[5] == _BMC_SEND_MESSAGE {
+		return unbridge(a, netfn, cmd, resp[6:len(resp)-1])
+	}
+	return resp[6 : len(resp)-1], nil
+}
+
+// checksum is the two's complement checksum of IPMI messages. Data with
+// its checksum sums to 0.
+func checksum(b []byte) byte {
+	var c byte
+	for _, v := range b {
+		c += v
+	}
+	return -c
+}
+
+// exchange sends a payload and returns the payload of the first reply
+// accept takes, resending it in a new packet each timeout, until ctx is
+// done.
+func (s *lanSession) exchange(ctx context.Context, typ byte, payload []byte, accept func(typ byte, payload []byte) bool) ([]byte, error) {
+	for try := 0; try <= s.retries; try++ {
+		if err := s.send(typ, payload); err != nil {
+			return nil, err
+		}
+		deadline := time.Now().Add(s.timeout)
+		if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+			deadline = d
+		}
+		for {
+			t, p, err := s.receive(ctx, deadline)
+			if err == errLANTimeout {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
+				// The read deadline may pass just before ctx's.
+				if d, ok := ctx.Deadline(); ok && !time.Now().Before(d) {
+					return nil, context.DeadlineExceeded
+				}
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			if accept(t, p) {
+				return p, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("no response from %v", s.conn.RemoteAddr())
+}
+
+// send sends a payload in a packet.
+func (s *lanSession) send(typ byte, payload []byte) error {
+	s.wmu.Lock()
+	defer s.wmu.Unlock()
+	pkt, err := s.packet(typ, payload)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn.Write(pkt)
+	return err
+}
+
+// receive returns the next packet for us by deadline, or errLANTimeout,
+// which it also returns once ctx is done. What is not for us or is stale
+// is dropped.
+func (s *lanSession) receive(ctx context.Context, deadline time.Time) (byte, []byte, error) {
+	if s.recv != nil {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		select {
+		case p, ok := <-s.recv:
+			if !ok {
+				return 0, nil, errors.New("session closed")
+			}
+			return p.typ, p.payload, nil
+		case <-timer.C:
+			return 0, nil, errLANTimeout
+		case <-ctx.Done():
+			return 0, nil, errLANTimeout
+		}
+	}
+
+	if err := s.conn.SetReadDeadline(deadline); err != nil {
+		return 0, nil, err
+	}
+	// Cut the read short once ctx is done, but not a later one.
+	if done := ctx.Done(); done != nil {
+		stop, stopped := make(chan struct{}), make(chan struct{})
+		defer func() {
+			close(stop)
+			<-stopped
+		}()
+		go func() {
+			defer close(stopped)
+			select {
+			case <-done:
+				s.conn.SetReadDeadline(time.Unix(1, 0))
+			case <-stop:
+			}
+		}()
+	}
+	buf := make([]byte, 4096)
+	for {
+		n, err := s.conn.Read(buf)
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			return 0, nil, errLANTimeout
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		if t, p, err := s.parse(buf[:n]); err == nil {
+			return t, p, nil
+		}
+	}
+}
+
+// setSOL has SOL packets handed to sol, starting a goroutine to read
+// packets if there is none. It runs until the connection is closed.
+func (s *lanSession) setSOL(sol func([]byte)) {
+	s.solMu.Lock()
+	s.sol = sol
+	s.solMu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.recv != nil {
+		return
+	}
+	s.recv = make(chan lanPacket, 16)
+	s.conn.SetReadDeadline(time.Time{})
+	go func() {
+		defer close(s.recv)
+		defer s.handleSOL(nil)
+		buf := make([]byte, 4096)
+		for {
+			n, err := s.conn.Read(buf)
+			if err != nil {
+				return
+			}
+			t, p, err := s.parse(buf[:n])
+			if err != nil {
+				continue
+			}
+			p = append([]byte{}, p...)
+			if t == payloadSOL {
+				s.handleSOL(p)
+				continue
+			}
+			select {
+			case s.recv <- lanPacket{t, p}:
+			default:
+			}
+		}
+	}()
+}
+
+func (s *lanSession) handleSOL(p []byte) {
+	s.solMu.Lock()
+	sol := s.sol
+	s.solMu.Unlock()
+	if sol != nil {
+		sol(p)
+	}
+}
+
+// packet makes an RMCP+ packet of a payload. Once the session is up, the
+// payload is encrypted and the packet authenticated.
+func (s *lanSession) packet(typ byte, payload []byte) ([]byte, error) {
+	var id, seq uint32
+	if s.k1 != nil {
+		var err error
+		if payload, err = encryptAES(s.k2, payload); err != nil {
+			return nil, err
+		}
+		typ |= payloadEncrypted | payloadAuthenticated
+		s.seq++
+		id, seq = s.remoteID, s.seq
+	}
+
+	b := make([]byte, rmcpHeaderLen+sessionHeaderLen, rmcpHeaderLen+sessionHeaderLen+len(payload)+8+s.authCodeLen())
+	copy(b, []byte{rmcpVersion, 0, rmcpNoAck, rmcpClassIPMI, authTypeRMCPPlus, typ})
+	binary.LittleEndian.PutUint32(b[6:], id)
+	binary.LittleEndian.PutUint32(b[10:], seq)
+	binary.LittleEndian.PutUint16(b[14:], uint16(len(payload)))
+	b = append(b, payload...)
+
+	if s.k1 != nil {
+		// Pad what the auth code covers to 4 bytes, then the pad
+		// length and next header.
+		pad := (4 - (len(b)-rmcpHeaderLen+2)%4) % 4
+		for i := 0; i < pad; i++ {
+			b = append(b, 0xFF)
+		}
+		b = append(b, byte(pad), nextHeader)
+		b = append(b, s.hmac(s.k1, b[rmcpHeaderLen:])[:s.suite.authCodeLen]...)
+	}
+	return b, nil
+}
+
+func (s *lanSession) authCodeLen() int {
+	if s.suite == nil {
+		return 0
+	}
+	return s.suite.authCodeLen
+}
+
+// parse checks an RMCP+ packet and returns its payload type and payload,
+// decrypted. Once the session is up, only authenticated packets of it are
+// taken.
+func (s *lanSession) parse(b []byte) (byte, []byte, error) {
+	const hl = rmcpHeaderLen + sessionHeaderLen
+	if len(b) < hl || b[0] != rmcpVersion || b[3] != rmcpClassIPMI || b[4] != authTypeRMCPPlus {
+		return 0, nil, errors.New("not an RMCP+ packet")
+	}
+	typ := b[5]
+	id := binary.LittleEndian.Uint32(b[6:])
+	n := int(binary.LittleEndian.Uint16(b[14:]))
+	if hl+n > len(b) {
+		return 0, nil, errors.New("short packet")
+	}
+	payload := b[hl : hl+n]
+
+	if s.k1 == nil {
+		if typ&(payloadEncrypted|payloadAuthenticated) != 0 || id != 0 {
+			return 0, nil, errors.New("packet of a session")
+		}
+		return typ, payload, nil
+	}
+
+	if id != s.localID || typ&payloadAuthenticated == 0 {
+		return 0, nil, errors.New("packet not of the session")
+	}
+	l := len(b) - s.suite.authCodeLen
+	if l < hl+n+2 || !hmac.Equal(b[l:], s.hmac(s.k1, b[rmcpHeaderLen:l])[:s.suite.authCodeLen]) {
+		return 0, nil, errors.New("bad packet auth code")
+	}
+	if typ&payloadEncrypted != 0 {
+		var err error
+		if payload, err = decryptAES(s.k2, payload); err != nil {
+			return 0, nil, err
+		}
+	}
+	return typ & payloadTypeMask, payload, nil
+}
+
+// encryptAES encrypts a payload with AES-CBC-128, IPMI v2.0 section 13.29:
+// a random IV, then the payload padded with 1, 2, 3... and the pad length,
+// to blocks.
+func encryptAES(k2, payload []byte) ([]byte, error) {
+	block, err := aes.NewCipher(k2[:16])
+	if err != nil {
+		return nil, err
+	}
+	pad := (aes.BlockSize - (len(payload)+1)%aes.BlockSize) % aes.BlockSize
+	b := make([]byte, aes.BlockSize+len(payload)+pad+1)
+	iv, p := b[:aes.BlockSize], b[aes.BlockSize:]
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	copy(p, payload)
+	for i := 0; i < pad; i++ {
+		p[len(payload)+i] = byte(i + 1)
+	}
+	p[len(p)-1] = byte(pad)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(p, p)
+	return b, nil
+}
+
+func decryptAES(k2, b []byte) ([]byte, error) {
+	if len(b) < 2*aes.BlockSize || len(b)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted payload of %d bytes", len(b))
+	}
+	block, err := aes.NewCipher(k2[:16])
+	if err != nil {
+		return nil, err
+	}
+	p := make([]byte, len(b)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, b[:aes.BlockSize]).CryptBlocks(p, b[aes.BlockSize:])
+	pad := int(p[len(p)-1])
+	if pad >= len(p) {
+		return nil, errors.New("bad encrypted payload padding")
+	}
+	n := len(p) - 1 - pad
+	for i := 0; i < pad; i++ {
+		if p[n+i] != byte(i+1) {
+			return nil, errors.New("bad encrypted payload padding")
+		}
+	}
+	return p[:n], nil
+}
+
+// Close implements Transport.Close, closing the session and the connection.
+func (s *lanSession) Close() error {
+	var err error
+	if s.k1 != nil {
+		var resp []byte
+		resp, err = s.SendRecv(_IPMI_NETFN_APP, _BMC_CLOSE_SESSION, uint32LE(s.remoteID))
+		if err == nil {
+			err = checkCompletion("close session", _IPMI_NETFN_APP, _BMC_CLOSE_SESSION, resp)
+		}
+	}
+	if cerr := s.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,483 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeBMC is the BMC end of RMCP+ sessions, answering a few commands.
+type fakeBMC struct {
+	conn     net.PacketConn
+	user     string
+	password string
+	suites   []int
+
+	// drop is how many IPMI requests to drop, to test resending.
+	drop int
+
+	// requests are the IPMI requests, netfn, cmd and data, it got.
+	requests [][]byte
+
+	// SOL: how many data packets to drop, the characters and operations
+	// got, and the sequence number of the last packet sent back.
+	solDrop int
+	solData []byte
+	solOps  []byte
+	solSeq  byte
+
+	s                  lanSession
+	rm, rc, guid, role []byte
+
+	// mu is held while a packet is handled; tests hold it to look at
+	// what the BMC got.
+	mu sync.Mutex
+}
+
+func startBMC(t *testing.T, user, password string, suites ...int) *fakeBMC {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &fakeBMC{conn: conn, user: user, password: password, suites: suites}
+	go b.serve()
+	return b
+}
+
+func (b *fakeBMC) addr() string {
+	return b.conn.LocalAddr().String()
+}
+
+func (b *fakeBMC) serve() {
+	buf := make([]byte, 4096)
+	for {
+		n, addr, err := b.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		b.mu.Lock()
+		typ, p, err := b.s.parse(buf[:n])
+		if err != nil {
+			b.mu.Unlock()
+			continue
+		}
+		var reply []byte
+		switch typ {
+		case payloadOpenSessionReq:
+			reply = b.open(p)
+		case payloadRAKP1:
+			reply = b.rakp1(p)
+		case payloadRAKP3:
+			reply = b.rakp3(p)
+		case payloadIPMI:
+			reply = b.ipmi(p)
+		case payloadSOL:
+			b.sol(p, addr)
+		}
+		if reply != nil {
+			b.conn.WriteTo(reply, addr)
+		}
+		b.mu.Unlock()
+	}
+}
+
+func (b *fakeBMC) pkt(typ byte, payload []byte) []byte {
+	pkt, err := b.s.packet(typ, payload)
+	if err != nil {
+		panic(err)
+	}
+	return pkt
+}
+
+func (b *fakeBMC) open(p []byte) []byte {
+	resp := make([]byte, 36)
+	resp[0] = p[0]
+	copy(resp[4:8], p[4:8])
+	b.s = lanSession{localID: 0x11223344, remoteID: binary.LittleEndian.Uint32(p[4:])}
+	resp[1] = 0x11
+	for _, id := range b.suites {
+		if c := cipherSuites[id]; c.auth == p[12] && c.integrity == p[20] && c.confidentiality == p[28] {
+			b.s.suite = c
+			resp[1] = 0
+			binary.LittleEndian.PutUint32(resp[8:], b.s.localID)
+		}
+	}
+	return b.pkt(payloadOpenSessionResp, resp)
+}
+
+func (b *fakeBMC) kuid() []byte {
+	k := make([]byte, kuidLen)
+	copy(k, b.password)
+	return k
+}
+
+func (b *fakeBMC) rakp1(p []byte) []byte {
+	b.rm = append([]byte{}, p[8:24]...)
+	b.role = append([]byte{}, p[24], p[27])
+	b.role = append(b.role, p[28:28+int(p[27])]...)
+	b.rc = bytes.Repeat([]byte{0xC}, 16)
+	b.guid = bytes.Repeat([]byte{0x6}, 16)
+
+	resp := make([]byte, 40)
+	resp[0] = p[0]
+	binary.LittleEndian.PutUint32(resp[4:], b.s.remoteID)
+	if string(p[28:28+int(p[27])]) != b.user {
+		resp[1] = 0x0D
+		return b.pkt(payloadRAKP2, resp)
+	}
+	copy(resp[8:], b.rc)
+	copy(resp[24:], b.guid)
+	resp = append(resp, b.s.hmac(b.kuid(), uint32LE(b.s.remoteID), uint32LE(b.s.localID), b.rm, b.rc, b.guid, b.role)...)
+	return b.pkt(payloadRAKP2, resp)
+}
+
+func (b *fakeBMC) rakp3(p []byte) []byte {
+	resp := make([]byte, 8)
+	resp[0] = p[0]
+	binary.LittleEndian.PutUint32(resp[4:], b.s.remoteID)
+	if !bytes.Equal(p[8:], b.s.hmac(b.kuid(), b.rc, uint32LE(b.s.remoteID), b.role)) {
+		resp[1] = 0x0F
+		return b.pkt(payloadRAKP4, resp)
+	}
+	sik := b.s.hmac(b.kuid(), b.rm, b.rc, b.role)
+	resp = append(resp, b.s.hmac(sik, b.rm, uint32LE(b.s.localID), b.guid)[:b.s.suite.icvLen]...)
+	// RAKP 4 is the last packet out of session.
+	pkt := b.pkt(payloadRAKP4, resp)
+	b.s.setKeys(sik)
+	return pkt
+}
+
+func (b *fakeBMC) ipmi(p []byte) []byte {
+	if b.drop > 0 {
+		b.drop--
+		return nil
+	}
+	netfn, seq, cmd, data := p[1]>>2, p[4], p[5], p[6:len(p)-1]
+	b.requests = append(b.requests, append([]byte{netfn, cmd}, data...))
+
+	resp := []byte{remoteConsoleAddr, (netfn | 1) << 2}
+	resp = append(resp, checksum(resp))
+	resp = append(resp, bmcSlaveAddr, seq, cmd, 0)
+	switch {
+	case netfn == _IPMI_NETFN_APP && cmd == _BMC_GET_DEVICE_ID:
+		resp = append(resp, 0x20, 0x81, 0x02, 0x10, 0x02, 0xBF, 0x57, 0x01, 0x00, 0x34, 0x12, 0, 0, 0, 0)
+	case netfn == _IPMI_NETFN_APP && cmd == _BMC_SET_SESSION_PRIVILEGE:
+		resp = append(resp, data[0])
+	case netfn == _IPMI_NETFN_APP && cmd == _BMC_ACTIVATE_PAYLOAD:
+		// Take 8 characters a packet, on the RMCP port.
+		resp = append(resp, 0, 0, 0, 0, 12, 0, 12, 0, 0x6F, 0x02, 0xFF, 0xFF)
+	case netfn == _IPMI_NETFN_APP && cmd == _BMC_SEND_MESSAGE:
+		resp = append(resp, bridgedResponse(data[1:])...)
+	case netfn == _IPMI_NETFN_APP && (cmd == _BMC_CLOSE_SESSION || cmd == _BMC_DEACTIVATE_PAYLOAD):
+	default:
+		// Invalid command.
+		resp[6] = 0xC1
+	}
+	resp = append(resp, checksum(resp[3:]))
+	return b.pkt(payloadIPMI, resp)
+}
+
+// bridgedResponse returns the response to the bridged request m, with the
+// target's slave address as the data, embedded as a tracking BMC may.
+func bridgedResponse(m []byte) []byte {
+	netfn, cmd := m[1]>>2, m[5]
+	data := []byte{0, m[0]}
+	if netfn == _IPMI_NETFN_APP && cmd == _BMC_SEND_MESSAGE {
+		data = append([]byte{0}, bridgedResponse(m[7:len(m)-1])...)
+	}
+	return ipmbMessage(m[3], netfn|1, m[4]&3, m[0], m[4]>>2, cmd, data)
+}
+
+// sol acks SOL packets, and sends their characters back in upper case.
+func (b *fakeBMC) sol(p []byte, addr net.Addr) {
+	seq, op, data := p[0], p[3], p[4:]
+	if seq == 0 {
+		return
+	}
+	if len(data) > 0 && b.solDrop > 0 {
+		b.solDrop--
+		return
+	}
+	b.solData = append(b.solData, data...)
+	if op != 0 {
+		b.solOps = append(b.solOps, op)
+	}
+	b.conn.WriteTo(b.pkt(payloadSOL, []byte{0, seq, byte(len(data)), 0}), addr)
+	if len(data) > 0 {
+		b.solSeq = b.solSeq%15 + 1
+		b.conn.WriteTo(b.pkt(payloadSOL, append([]byte{b.solSeq, 0, 0, 0}, bytes.ToUpper(data)...)), addr)
+	}
+}
+
+func TestDialLAN(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		suites []int
+		config LANConfig
+	}{
+		{name: "suite 17", suites: []int{3, 17}},
+		{name: "fall back to 3", suites: []int{3}},
+		{name: "suite 3", suites: []int{3, 17}, config: LANConfig{CipherSuite: 3}},
+		{name: "user", suites: []int{17}, config: LANConfig{Privilege: PrivilegeUser}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b := startBMC(t, "admin", "secret", tt.suites...)
+			defer b.conn.Close()
+
+			c := tt.config
+			c.Username, c.Password, c.Timeout = "admin", "secret", 100*time.Millisecond
+			i, err := DialLAN(b.addr(), &c)
+			if err != nil {
+				t.Fatal(err)
+			}
+			id, err := i.GetDeviceID()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := i.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			want := DevID{DeviceID: 0x20, DeviceRevision: 0x81, FwRev1: 0x02, FwRev2: 0x10, IpmiVersion: 0x02, AdtlDeviceSupport: 0xBF, ManufacturerID: [3]byte{0x57, 0x01, 0x00}, ProductID: [2]byte{0x34, 0x12}}
+			if !reflect.DeepEqual(*id, want) {
+				t.Errorf("GetDeviceID = %+v, want %+v", *id, want)
+			}
+			if c.CipherSuite == 3 && b.s.suite.id != 3 {
+				t.Errorf("session has cipher suite %d, want 3", b.s.suite.id)
+			}
+
+			var reqs [][]byte
+			if c.Privilege == 0 {
+				reqs = append(reqs, []byte{_IPMI_NETFN_APP, _BMC_SET_SESSION_PRIVILEGE, byte(PrivilegeAdmin)})
+			}
+			reqs = append(reqs, []byte{_IPMI_NETFN_APP, _BMC_GET_DEVICE_ID}, []byte{_IPMI_NETFN_APP, _BMC_CLOSE_SESSION, 0x44, 0x33, 0x22, 0x11})
+			if !reflect.DeepEqual(b.requests, reqs) {
+				t.Errorf("BMC got requests %#x, want %#x", b.requests, reqs)
+			}
+		})
+	}
+}
+
+func TestLANBridge(t *testing.T) {
+	b := startBMC(t, "admin", "secret", 17)
+	defer b.conn.Close()
+
+	c := &LANConfig{Username: "admin", Password: "secret", Timeout: 100 * time.Millisecond}
+	i, err := DialLAN(b.addr(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Close()
+
+	for _, tt := range []struct {
+		a        Addr
+		channels []byte
+	}{
+		{a: Addr{Channel: 7, Target: 0x72}, channels: []byte{0x47}},
+		{a: Addr{Channel: 7, Target: 0x72, TransitChannel: 6, TransitTarget: 0x82}, channels: []byte{0x46, 0x47}},
+	} {
+		b.mu.Lock()
+		b.requests = nil
+		b.mu.Unlock()
+
+		resp, err := i.RawCmdTo(tt.a, []byte{_IPMI_NETFN_APP, _BMC_GET_DEVICE_ID})
+		if err != nil {
+			t.Fatalf("RawCmdTo(%v) = %v", tt.a, err)
+		}
+		if want := []byte{0, 0x72}; !bytes.Equal(resp, want) {
+			t.Errorf("RawCmdTo(%v) = %#x, want %#x", tt.a, resp, want)
+		}
+
+		b.mu.Lock()
+		if len(b.requests) != 1 || b.requests[0][1] != _BMC_SEND_MESSAGE {
+			t.Fatalf("BMC got requests %#x, want one Send Message", b.requests)
+		}
+		// Each Send Message request's channel, and where it is sent.
+		var channels []byte
+		for m := b.requests[0][2:]; ; m = m[7:] {
+			channels = append(channels, m[0])
+			if m[6] != _BMC_SEND_MESSAGE {
+				if m[1] != 0x72 {
+					t.Errorf("request sent to %#x, want 0x72", m[1])
+				}
+				break
+			}
+		}
+		b.mu.Unlock()
+		if !bytes.Equal(channels, tt.channels) {
+			t.Errorf("Send Message channels %#x, want %#x", channels, tt.channels)
+		}
+	}
+}
+
+func TestDialLANResend(t *testing.T) {
+	b := startBMC(t, "admin", "secret", 17)
+	defer b.conn.Close()
+	b.mu.Lock()
+	b.drop = 2
+	b.mu.Unlock()
+
+	c := &LANConfig{Username: "admin", Password: "secret", Timeout: 50 * time.Millisecond, Retries: 2}
+	i, err := DialLAN(b.addr(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Close()
+	if _, err := i.RawCmd([]byte{_IPMI_NETFN_APP, _BMC_GET_DEVICE_ID}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLANContext(t *testing.T) {
+	b := startBMC(t, "admin", "secret", 17)
+	defer b.conn.Close()
+
+	c := &LANConfig{Username: "admin", Password: "secret", Timeout: time.Minute}
+	i, err := DialLAN(b.addr(), c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Close()
+	b.mu.Lock()
+	b.drop = 2
+	b.mu.Unlock()
+
+	start := time.Now()
+	if _, err := i.WithTimeout(50 * time.Millisecond).GetDeviceID(); err != context.DeadlineExceeded {
+		t.Errorf("GetDeviceID = %v, want %v", err, context.DeadlineExceeded)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	if _, err := i.WithContext(ctx).GetDeviceID(); err != context.Canceled {
+		t.Errorf("GetDeviceID = %v, want %v", err, context.Canceled)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("requests took %v, not bounded by their contexts", d)
+	}
+
+	// The session still works.
+	if _, err := i.WithTimeout(10 * time.Second).GetDeviceID(); err != nil {
+		t.Errorf("GetDeviceID = %v", err)
+	}
+}
+
+func TestDialLANBad(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		suites []int
+		config LANConfig
+		err    string
+	}{
+		{name: "password", suites: []int{17}, config: LANConfig{Username: "admin", Password: "guess"}, err: "wrong password"},
+		{name: "user", suites: []int{17}, config: LANConfig{Username: "root", Password: "secret"}, err: "unauthorized name"},
+		{name: "suite", suites: []int{17}, config: LANConfig{Username: "admin", Password: "secret", CipherSuite: 3}, err: "no cipher suite match"},
+		{name: "long password", suites: []int{17}, config: LANConfig{Username: "admin", Password: strings.Repeat("x", 21)}, err: "longer than 20"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b := startBMC(t, "admin", "secret", tt.suites...)
+			defer b.conn.Close()
+
+			c := tt.config
+			c.Timeout = 100 * time.Millisecond
+			if _, err := DialLAN(b.addr(), &c); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("DialLAN = %v, want error with %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestAESPayload(t *testing.T) {
+	k2 := bytes.Repeat([]byte{0x42}, 20)
+	for n := 0; n < 40; n++ {
+		p := bytes.Repeat([]byte{0xA5}, n)
+		b, err := encryptAES(k2, p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(b)%16 != 0 || len(b) < 16+n+1 {
+			t.Errorf("encryptAES of %d bytes is %d bytes", n, len(b))
+		}
+		got, err := decryptAES(k2, b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, p) {
+			t.Errorf("decryptAES(encryptAES(%#x)) = %#x", p, got)
+		}
+	}
+	if _, err := decryptAES(k2, make([]byte, 32)); err == nil {
+		t.Errorf("decryptAES of bad padding = nil, want error")
+	}
+}
+
+func TestSOL(t *testing.T) {
+	b := startBMC(t, "admin", "secret", 17)
+	defer b.conn.Close()
+	b.mu.Lock()
+	b.solDrop = 1
+	b.mu.Unlock()
+
+	i, err := DialLAN(b.addr(), &LANConfig{Username: "admin", Password: "secret", Timeout: 50 * time.Millisecond, Retries: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer i.Close()
+	sol, err := i.ActivateSOL()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Three packets, the first of them sent twice.
+	msg := "login: root, console"
+	if n, err := sol.Write([]byte(msg)); err != nil || n != len(msg) {
+		t.Fatalf("Write = %d, %v, want %d, nil", n, err, len(msg))
+	}
+	got := make([]byte, len(msg))
+	if _, err := io.ReadFull(sol, got); err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.ToUpper(msg); string(got) != want {
+		t.Errorf("Read %q, want %q", got, want)
+	}
+
+	if err := sol.Break(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sol.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := sol.Deactivate(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sol.Read(got); err != io.EOF {
+		t.Errorf("Read after Deactivate = %v, want EOF", err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if string(b.solData) != msg {
+		t.Errorf("BMC got %q, want %q", b.solData, msg)
+	}
+	if want := []byte{solOpBreak, solOpFlushInbound | solOpFlushOutbound}; !bytes.Equal(b.solOps, want) {
+		t.Errorf("BMC got operations %#x, want %#x", b.solOps, want)
+	}
+}
+
+func TestSOLLocal(t *testing.T) {
+	if _, err := (&IPMI{}).ActivateSOL(); err == nil {
+		t.Errorf("ActivateSOL without a LAN session = nil, want error")
+	}
+}
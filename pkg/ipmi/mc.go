@@ -0,0 +1,175 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// bmcResetPoll is how often WaitBMC asks whether the BMC is back.
+var bmcResetPoll = time.Second
+
+// SelfTestCode is the result of the BMC's self-test, IPMI v2.0 section
+// 20.4. Codes other than those below are device-specific failures.
+type SelfTestCode byte
+
+// Self-test results.
+const (
+	SelfTestPassed         SelfTestCode = 0x55
+	SelfTestNotImplemented SelfTestCode = 0x56
+	SelfTestCorrupted      SelfTestCode = 0x57
+	SelfTestFatal          SelfTestCode = 0x58
+)
+
+func (c SelfTestCode) String() string {
+	switch c {
+	case SelfTestPassed:
+		return "passed"
+	case SelfTestNotImplemented:
+		return "not implemented"
+	case SelfTestCorrupted:
+		return "corrupted or inaccessible data or devices"
+	case SelfTestFatal:
+		return "fatal hardware error"
+	}
+	return fmt.Sprintf("device-specific error %#02x", byte(c))
+}
+
+// Failures of SelfTestCorrupted, in SelfTestResult.Detail.
+const (
+	SelfTestSELInaccessible    = 0x80
+	SelfTestSDRInaccessible    = 0x40
+	SelfTestFRUInaccessible    = 0x20
+	SelfTestIPMBDead           = 0x10
+	SelfTestSDREmpty           = 0x08
+	SelfTestFRUCorrupted       = 0x04
+	SelfTestBootBlockCorrupted = 0x02
+	SelfTestFirmwareCorrupted  = 0x01
+)
+
+var selfTestFailures = []struct {
+	bit  byte
+	name string
+}{
+	{SelfTestSELInaccessible, "SEL device inaccessible"},
+	{SelfTestSDRInaccessible, "SDR repository inaccessible"},
+	{SelfTestFRUInaccessible, "BMC FRU device inaccessible"},
+	{SelfTestIPMBDead, "IPMB signal lines do not respond"},
+	{SelfTestSDREmpty, "SDR repository empty"},
+	{SelfTestFRUCorrupted, "internal use area of BMC FRU corrupted"},
+	{SelfTestBootBlockCorrupted, "boot block firmware corrupted"},
+	{SelfTestFirmwareCorrupted, "operational firmware corrupted"},
+}
+
+// SelfTestResult is what Get Self Test Results returns.
+type SelfTestResult struct {
+	Code SelfTestCode
+	// Detail has the SelfTest bits of what failed for SelfTestCorrupted,
+	// and device-specific data for other failures.
+	Detail byte
+}
+
+// OK reports whether the self-test passed.
+func (r *SelfTestResult) OK() bool {
+	return r.Code == SelfTestPassed
+}
+
+// Failures names what failed, for SelfTestCorrupted.
+func (r *SelfTestResult) Failures() []string {
+	if r.Code != SelfTestCorrupted {
+		return nil
+	}
+	var f []string
+	for _, s := range selfTestFailures {
+		if r.Detail&s.bit != 0 {
+			f = append(f, s.name)
+		}
+	}
+	return f
+}
+
+func (r *SelfTestResult) String() string {
+	switch r.Code {
+	case SelfTestPassed, SelfTestNotImplemented:
+		return r.Code.String()
+	case SelfTestCorrupted:
+		return fmt.Sprintf("%v: %s", r.Code, strings.Join(r.Failures(), ", "))
+	}
+	return fmt.Sprintf("%v, data %#02x", r.Code, r.Detail)
+}
+
+// GetSelfTestResults returns the result of the BMC's self-test.
+func (i *IPMI) GetSelfTestResults() (*SelfTestResult, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_APP
+	req.msg.cmd = _BMC_GET_SELF_TEST_RESULTS
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.completion("GetSelfTestResults", recv); err != nil {
+		return nil, err
+	}
+	if len(recv) < 3 {
+		return nil, fmt.Errorf("GetSelfTestResults: short response of %d bytes", len(recv))
+	}
+	return &SelfTestResult{Code: SelfTestCode(recv[1]), Detail: recv[2]}, nil
+}
+
+// resetBMC sends reset command cmd. The BMC may reset before it answers,
+// so no answer is taken as the reset having started.
+func (i *IPMI) resetBMC(op string, cmd byte) error {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_APP
+	req.msg.cmd = cmd
+
+	recv, err := i.sendrecv(req)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := req.completion(op, recv); !isCompletion(err, CompletionTimeout) {
+		return err
+	}
+	return nil
+}
+
+// ColdReset resets the BMC as if it had been powered up, and its
+// management state with it. Use WaitBMC to wait for it to be back.
+func (i *IPMI) ColdReset() error {
+	return i.resetBMC("ColdReset", _BMC_COLD_RESET)
+}
+
+// WarmReset resets the BMC, but keeps its management state, such as
+// sensor thresholds and event receivers. Not all BMCs have it.
+func (i *IPMI) WarmReset() error {
+	return i.resetBMC("WarmReset", _BMC_WARM_RESET)
+}
+
+// WaitBMC waits up to timeout for the BMC to answer Get Device ID and say it
+// is available, as it does once it is done resetting.
+func (i *IPMI) WaitBMC(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		id, err := i.GetDeviceID()
+		if err == nil {
+			if id.FwRev1&0x80 == 0 {
+				return nil
+			}
+			err = errors.New("device not available")
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("WaitBMC: BMC is not back after %v: %w", timeout, err)
+		}
+		time.Sleep(bmcResetPoll)
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetSelfTestResults(t *testing.T) {
+	for _, tt := range []struct {
+		resp     []byte
+		ok       bool
+		failures []string
+		s        string
+	}{
+		{[]byte{0, 0x55, 0}, true, nil, "passed"},
+		{[]byte{0, 0x56, 0}, false, nil, "not implemented"},
+		{[]byte{0, 0x57, 0x88}, false, []string{"SEL device inaccessible", "SDR repository empty"},
+			"corrupted or inaccessible data or devices: SEL device inaccessible, SDR repository empty"},
+		{[]byte{0, 0x58, 0x01}, false, nil, "fatal hardware error, data 0x01"},
+		{[]byte{0, 0x81, 0x12}, false, nil, "device-specific error 0x81, data 0x12"},
+	} {
+		i := &IPMI{Transport: &fakeTransport{responses: map[[2]byte][]byte{
+			{_IPMI_NETFN_APP, _BMC_GET_SELF_TEST_RESULTS}: tt.resp,
+		}}}
+		r, err := i.GetSelfTestResults()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.OK() != tt.ok || !reflect.DeepEqual(r.Failures(), tt.failures) || r.String() != tt.s {
+			t.Errorf("GetSelfTestResults(% x) = %t, %q, %q, want %t, %q, %q", tt.resp, r.OK(), r.Failures(), r, tt.ok, tt.failures, tt.s)
+		}
+	}
+}
+
+func TestReset(t *testing.T) {
+	f := &fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_APP, _BMC_COLD_RESET}: {0},
+		// The BMC went away before it answered.
+		{_IPMI_NETFN_APP, _BMC_WARM_RESET}: {byte(CompletionTimeout)},
+	}}
+	i := &IPMI{Transport: f}
+	if err := i.ColdReset(); err != nil {
+		t.Errorf("ColdReset = %v", err)
+	}
+	if err := i.WarmReset(); err != nil {
+		t.Errorf("WarmReset without an answer = %v", err)
+	}
+	f.responses[[2]byte{_IPMI_NETFN_APP, _BMC_WARM_RESET}] = []byte{byte(CompletionInvalidCommand)}
+	if err := i.WarmReset(); !isCompletion(err, CompletionInvalidCommand) {
+		t.Errorf("WarmReset = %v, want invalid command", err)
+	}
+}
+
+func TestWaitBMC(t *testing.T) {
+	defer func(d time.Duration) { bmcResetPoll = d }(bmcResetPoll)
+	bmcResetPoll = 0
+
+	// The BMC is back after answering Get Device ID with busy a few
+	// times, then as unavailable once.
+	busy := 3
+	f := &fakeTransport{}
+	f.handle(_IPMI_NETFN_APP, _BMC_GET_DEVICE_ID, func([]byte) []byte {
+		busy--
+		switch {
+		case busy > 0:
+			return []byte{byte(CompletionNodeBusy)}
+		case busy == 0:
+			return []byte{0, 0x20, 0x81, 0x82, 0x10, 0x02, 0xBF, 0x57, 0x01, 0x00, 0x34, 0x12, 0, 0, 0, 0}
+		}
+		return []byte{0, 0x20, 0x81, 0x02, 0x10, 0x02, 0xBF, 0x57, 0x01, 0x00, 0x34, 0x12, 0, 0, 0, 0}
+	})
+	i := &IPMI{Transport: f}
+	if err := i.WaitBMC(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if busy != -1 {
+		t.Errorf("WaitBMC returned after %d Get Device IDs, want 4", 3-busy)
+	}
+
+	busy = 100
+	if err := i.WaitBMC(0); !isCompletion(err, CompletionNodeBusy) {
+		t.Errorf("WaitBMC = %v, want node busy", err)
+	}
+}
@@ -0,0 +1,368 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package nm implements the power policy commands of Intel Node Manager,
+// which the Management Engine of Intel platforms runs. The BMC bridges them
+// to the ME, see the Intel Intelligent Power Node Manager specification.
+//
+//	n := nm.New(i)
+//	err := n.SetPolicy(&nm.Policy{Domain: nm.Platform, ID: 1, Enabled: true, Limit: 450, ...})
+package nm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/u-root/u-root/pkg/ipmi"
+)
+
+// ME is the address of the Management Engine: target 0x2C on the BMC's
+// channel 6, SMLink.
+var ME = ipmi.Addr{Channel: 6, Target: 0x2C}
+
+// Node Manager commands, all of the OEM/Group network function.
+const (
+	netfnNM = 0x2E
+
+	cmdPolicyControl   = 0xC0
+	cmdSetPolicy       = 0xC1
+	cmdGetPolicy       = 0xC2
+	cmdResetStatistics = 0xC7
+	cmdGetStatistics   = 0xC8
+)
+
+// intelID is Intel's IANA enterprise number, 343, that starts the data of
+// requests and responses.
+var intelID = []byte{0x57, 0x01, 0x00}
+
+// Node Manager completion codes.
+const (
+	CompletionInvalidPolicy        ipmi.CompletionCode = 0x80
+	CompletionInvalidDomain        ipmi.CompletionCode = 0x81
+	CompletionInvalidTrigger       ipmi.CompletionCode = 0x82
+	CompletionLimitOutOfRange      ipmi.CompletionCode = 0x84
+	CompletionCorrectionOutOfRange ipmi.CompletionCode = 0x85
+	CompletionTriggerOutOfRange    ipmi.CompletionCode = 0x86
+	CompletionPeriodOutOfRange     ipmi.CompletionCode = 0x89
+)
+
+// ErrNoPolicy is returned for policies there are none of.
+var ErrNoPolicy = errors.New("no such Node Manager policy")
+
+// NM sends Node Manager commands through a BMC.
+type NM struct {
+	IPMI *ipmi.IPMI
+
+	// Addr is where the Node Manager is, ME for most platforms.
+	Addr ipmi.Addr
+}
+
+// New returns an NM for the Node Manager of the ME behind i.
+func New(i *ipmi.IPMI) *NM {
+	return &NM{IPMI: i, Addr: ME}
+}
+
+// cmd sends Node Manager command cmd with data, failing as op, and returns
+// the response data after the manufacturer ID.
+func (n *NM) cmd(op string, cmd byte, data []byte) ([]byte, error) {
+	req := append([]byte{netfnNM, cmd}, intelID...)
+	resp, err := n.IPMI.RawCmdTo(n.Addr, append(req, data...))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(resp) == 0 {
+		return nil, fmt.Errorf("%s: empty response", op)
+	}
+	if cc := ipmi.CompletionCode(resp[0]); cc != ipmi.CompletionOK {
+		return nil, &ipmi.CompletionError{Op: op, NetFn: netfnNM, Cmd: cmd, Code: cc}
+	}
+	if len(resp) < 4 || !bytes.Equal(resp[1:4], intelID) {
+		return nil, fmt.Errorf("%s: response % x is not Intel's", op, resp)
+	}
+	return resp[4:], nil
+}
+
+// Domain is a part of the platform whose power policies apply to.
+type Domain byte
+
+// Domains.
+const (
+	Platform     Domain = 0
+	CPU          Domain = 1
+	Memory       Domain = 2
+	HWProtection Domain = 3
+	HighPowerIO  Domain = 4
+)
+
+func (d Domain) String() string {
+	switch d {
+	case Platform:
+		return "platform"
+	case CPU:
+		return "CPU"
+	case Memory:
+		return "memory"
+	case HWProtection:
+		return "HW protection"
+	case HighPowerIO:
+		return "high power I/O"
+	}
+	return fmt.Sprintf("domain %d", byte(d))
+}
+
+// Trigger is what makes a policy limit power.
+type Trigger byte
+
+// Policy triggers.
+const (
+	// Always limits power from when the policy is enabled.
+	Always Trigger = 0
+	// InletTemperature limits power above TriggerLimit degrees Celsius.
+	InletTemperature Trigger = 1
+	// MissingReadings limits power once there have been no power
+	// readings for TriggerLimit tenths of a second.
+	MissingReadings Trigger = 2
+	// TimeAfterReset limits power from TriggerLimit tenths of a second
+	// after a platform reset.
+	TimeAfterReset Trigger = 3
+	// BootTime limits power while the platform boots.
+	BootTime Trigger = 4
+)
+
+// Policy is a Node Manager power policy.
+type Policy struct {
+	Domain Domain
+	ID     byte
+
+	Enabled bool
+	// DomainEnabled and GlobalEnabled are whether policy control of the
+	// domain and of all domains is enabled, and External whether another
+	// client, such as DCMI, made the policy. They are ignored by
+	// SetPolicy.
+	DomainEnabled bool
+	GlobalEnabled bool
+	External      bool
+
+	Trigger      Trigger
+	TriggerLimit uint16
+
+	// Volatile policies are lost at power-off.
+	Volatile bool
+
+	// Alert and Shutdown are whether the ME sends an alert or shuts the
+	// platform down if Limit cannot be kept for Correction.
+	Alert    bool
+	Shutdown bool
+
+	// Limit is the power limit in watts.
+	Limit      uint16
+	Correction time.Duration
+
+	// Reporting is the period the statistics of the policy average over.
+	Reporting time.Duration
+}
+
+func policyOp(name string, d Domain, id byte) string {
+	return fmt.Sprintf("%s(%v, %d)", name, d, id)
+}
+
+// GetPolicy returns policy id of domain d, or ErrNoPolicy.
+func (n *NM) GetPolicy(d Domain, id byte) (*Policy, error) {
+	op := policyOp("GetPolicy", d, id)
+	b, err := n.cmd(op, cmdGetPolicy, []byte{byte(d), id})
+	if cc, ok := ipmi.Completion(err); ok && cc == CompletionInvalidPolicy {
+		return nil, ErrNoPolicy
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 13 {
+		return nil, fmt.Errorf("%s: short response of %d bytes", op, len(b))
+	}
+	le := binary.LittleEndian
+	return &Policy{
+		Domain:        Domain(b[0] & 0x0F),
+		ID:            id,
+		Enabled:       b[0]&0x10 != 0,
+		DomainEnabled: b[0]&0x20 != 0,
+		GlobalEnabled: b[0]&0x40 != 0,
+		External:      b[0]&0x80 != 0,
+		Trigger:       Trigger(b[1] & 0x0F),
+		Volatile:      b[1]&0x80 != 0,
+		Alert:         b[2]&0x01 != 0,
+		Shutdown:      b[2]&0x02 != 0,
+		Limit:         le.Uint16(b[3:5]),
+		Correction:    time.Duration(le.Uint32(b[5:9])) * time.Millisecond,
+		TriggerLimit:  le.Uint16(b[9:11]),
+		Reporting:     time.Duration(le.Uint16(b[11:13])) * time.Second,
+	}, nil
+}
+
+// SetPolicy adds policy p, or changes it if there is one of its domain and
+// ID.
+func (n *NM) SetPolicy(p *Policy) error {
+	if p.Domain > 0x0F || p.Trigger > 0x0F {
+		return fmt.Errorf("SetPolicy: domain %d or trigger %d is out of range", p.Domain, p.Trigger)
+	}
+	correction := p.Correction / time.Millisecond
+	reporting := p.Reporting / time.Second
+	if correction > 0xFFFFFFFF || reporting > 0xFFFF {
+		return fmt.Errorf("SetPolicy: correction time %v or reporting period %v is too long", p.Correction, p.Reporting)
+	}
+
+	data := make([]byte, 14)
+	data[0] = byte(p.Domain)
+	if p.Enabled {
+		data[0] |= 0x10
+	}
+	data[1] = p.ID
+	// Bit 4 adds the policy, rather than removes it.
+	data[2] = byte(p.Trigger) | 0x10
+	if p.Volatile {
+		data[2] |= 0x80
+	}
+	if p.Alert {
+		data[3] |= 0x01
+	}
+	if p.Shutdown {
+		data[3] |= 0x02
+	}
+	le := binary.LittleEndian
+	le.PutUint16(data[4:6], p.Limit)
+	le.PutUint32(data[6:10], uint32(correction))
+	le.PutUint16(data[10:12], p.TriggerLimit)
+	le.PutUint16(data[12:14], uint16(reporting))
+
+	op := policyOp("SetPolicy", p.Domain, p.ID)
+	_, err := n.cmd(op, cmdSetPolicy, data)
+	switch cc, _ := ipmi.Completion(err); cc {
+	case CompletionLimitOutOfRange:
+		return fmt.Errorf("power limit of %dW is out of range: %w", p.Limit, err)
+	case CompletionCorrectionOutOfRange:
+		return fmt.Errorf("correction time of %v is out of range: %w", p.Correction, err)
+	case CompletionTriggerOutOfRange:
+		return fmt.Errorf("trigger limit of %d is out of range: %w", p.TriggerLimit, err)
+	case CompletionPeriodOutOfRange:
+		return fmt.Errorf("reporting period of %v is out of range: %w", p.Reporting, err)
+	}
+	return err
+}
+
+// RemovePolicy removes policy id of domain d.
+func (n *NM) RemovePolicy(d Domain, id byte) error {
+	data := make([]byte, 14)
+	data[0], data[1] = byte(d), id
+	_, err := n.cmd(policyOp("RemovePolicy", d, id), cmdSetPolicy, data)
+	if cc, ok := ipmi.Completion(err); ok && cc == CompletionInvalidPolicy {
+		return ErrNoPolicy
+	}
+	return err
+}
+
+// policyControl enables or disables policy control: all of it with
+// flags 0, that of domain d with 2, or policy id of d with 4.
+func (n *NM) policyControl(op string, flags byte, enable bool, d Domain, id byte) error {
+	if enable {
+		flags++
+	}
+	_, err := n.cmd(op, cmdPolicyControl, []byte{flags, byte(d), id})
+	return err
+}
+
+// EnableGlobal enables or disables the policies of all domains.
+func (n *NM) EnableGlobal(enable bool) error {
+	return n.policyControl(fmt.Sprintf("EnableGlobal(%t)", enable), 0, enable, 0, 0)
+}
+
+// EnableDomain enables or disables the policies of domain d.
+func (n *NM) EnableDomain(d Domain, enable bool) error {
+	return n.policyControl(fmt.Sprintf("EnableDomain(%v, %t)", d, enable), 2, enable, d, 0)
+}
+
+// EnablePolicy enables or disables policy id of domain d.
+func (n *NM) EnablePolicy(d Domain, id byte, enable bool) error {
+	return n.policyControl(fmt.Sprintf("EnablePolicy(%v, %d, %t)", d, id, enable), 4, enable, d, id)
+}
+
+// StatisticsMode is what statistics GetStatistics returns.
+type StatisticsMode byte
+
+// Statistics modes. Global ones are of a domain, the others of a policy.
+const (
+	GlobalPower      StatisticsMode = 0x01 // watts
+	GlobalInletTemp  StatisticsMode = 0x02 // degrees Celsius
+	GlobalThrottling StatisticsMode = 0x03 // percent
+	GlobalAirflow    StatisticsMode = 0x04 // tenths of a cubic foot per minute
+	PolicyPower      StatisticsMode = 0x11 // watts
+	PolicyTrigger    StatisticsMode = 0x12 // unit of the policy's trigger
+	PolicyThrottling StatisticsMode = 0x13 // percent
+)
+
+// perPolicy is set in the modes of policy statistics.
+const perPolicy StatisticsMode = 0x10
+
+// Statistics are readings of a domain or policy over a period.
+type Statistics struct {
+	Current uint16
+	Min     uint16
+	Max     uint16
+	Average uint16
+
+	// Time is when the statistics were taken, and Period what they are
+	// over.
+	Time   time.Time
+	Period time.Duration
+
+	Domain Domain
+	// Enabled is whether the policy, or global policy control, is
+	// enabled; Operational whether it is monitoring; Measuring whether
+	// readings are being taken; and Limiting whether a policy is
+	// limiting power now.
+	Enabled     bool
+	Operational bool
+	Measuring   bool
+	Limiting    bool
+}
+
+// GetStatistics returns the statistics of mode for domain d, or policy id
+// of d for per-policy modes.
+func (n *NM) GetStatistics(mode StatisticsMode, d Domain, id byte) (*Statistics, error) {
+	op := fmt.Sprintf("GetStatistics(%#02x, %v, %d)", byte(mode), d, id)
+	b, err := n.cmd(op, cmdGetStatistics, []byte{byte(mode), byte(d), id})
+	if err != nil {
+		return nil, err
+	}
+	if len(b) < 17 {
+		return nil, fmt.Errorf("%s: short response of %d bytes", op, len(b))
+	}
+	le := binary.LittleEndian
+	return &Statistics{
+		Current:     le.Uint16(b[0:2]),
+		Min:         le.Uint16(b[2:4]),
+		Max:         le.Uint16(b[4:6]),
+		Average:     le.Uint16(b[6:8]),
+		Time:        time.Unix(int64(le.Uint32(b[8:12])), 0),
+		Period:      time.Duration(le.Uint32(b[12:16])) * time.Second,
+		Domain:      Domain(b[16] & 0x0F),
+		Enabled:     b[16]&0x10 != 0,
+		Operational: b[16]&0x20 != 0,
+		Measuring:   b[16]&0x40 != 0,
+		Limiting:    b[16]&0x80 != 0,
+	}, nil
+}
+
+// ResetStatistics starts the statistics of domain d over, or those of
+// policy id of d for per-policy modes.
+func (n *NM) ResetStatistics(mode StatisticsMode, d Domain, id byte) error {
+	var m byte
+	if mode&perPolicy != 0 {
+		m = 1
+	}
+	op := fmt.Sprintf("ResetStatistics(%#02x, %v, %d)", byte(mode), d, id)
+	_, err := n.cmd(op, cmdResetStatistics, []byte{m, byte(d), id})
+	return err
+}
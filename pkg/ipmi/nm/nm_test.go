@@ -0,0 +1,203 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package nm
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/u-root/u-root/pkg/ipmi"
+	"github.com/u-root/u-root/pkg/ipmi/ipmitest"
+)
+
+// bridge is a fake BMC that bridges requests to any address, and records
+// the addresses.
+type bridge struct {
+	*ipmitest.BMC
+	addrs []ipmi.Addr
+}
+
+func (b *bridge) SendRecvContext(ctx context.Context, netfn, cmd byte, data []byte) ([]byte, error) {
+	return b.SendRecvTo(ctx, ipmi.Addr{}, netfn, cmd, data)
+}
+
+func (b *bridge) SendRecvTo(ctx context.Context, a ipmi.Addr, netfn, cmd byte, data []byte) ([]byte, error) {
+	b.addrs = append(b.addrs, a)
+	return b.SendRecv(netfn, cmd, data)
+}
+
+// newME returns an NM of a fake ME that keeps policies.
+func newME(t *testing.T) (*NM, *bridge) {
+	b := &bridge{BMC: ipmitest.New()}
+	policies := map[[2]byte][]byte{}
+	ok := append([]byte{0}, intelID...)
+	handle := func(cmd byte, h func(data []byte) []byte) {
+		b.Handle(netfnNM, cmd, func(data []byte) ([]byte, error) {
+			if !strings.HasPrefix(string(data), string(intelID)) {
+				t.Errorf("request % x does not start with Intel's ID", data)
+			}
+			return h(data[3:]), nil
+		})
+	}
+	handle(cmdSetPolicy, func(data []byte) []byte {
+		key := [2]byte{data[0] & 0x0F, data[1]}
+		if data[2]&0x10 == 0 {
+			if _, found := policies[key]; !found {
+				return []byte{byte(CompletionInvalidPolicy)}
+			}
+			delete(policies, key)
+			return ok
+		}
+		if data[4] == 0 && data[5] == 0 {
+			return []byte{byte(CompletionLimitOutOfRange)}
+		}
+		// Get Policy has the rest of the request after the policy ID,
+		// and global control enabled.
+		policies[key] = append([]byte{data[0] | 0x40}, data[2:]...)
+		return ok
+	})
+	handle(cmdGetPolicy, func(data []byte) []byte {
+		p, found := policies[[2]byte{data[0], data[1]}]
+		if !found {
+			return []byte{byte(CompletionInvalidPolicy)}
+		}
+		return append(ok, p...)
+	})
+	handle(cmdPolicyControl, func(data []byte) []byte {
+		return ok
+	})
+	handle(cmdGetStatistics, func(data []byte) []byte {
+		if data[0] != byte(GlobalPower) {
+			return []byte{byte(ipmi.CompletionInvalidDataField)}
+		}
+		return append(ok, 0xC8, 0, 0x64, 0, 0x2C, 0x01, 0x96, 0, 0x00, 0xE1, 0xF5, 0x05, 0x3C, 0, 0, 0, 0x70)
+	})
+	handle(cmdResetStatistics, func(data []byte) []byte {
+		return ok
+	})
+	return New(&ipmi.IPMI{Transport: b}), b
+}
+
+func TestPolicy(t *testing.T) {
+	n, b := newME(t)
+	if _, err := n.GetPolicy(Platform, 1); err != ErrNoPolicy {
+		t.Errorf("GetPolicy = %v, want %v", err, ErrNoPolicy)
+	}
+
+	p := &Policy{
+		Domain:        Platform,
+		ID:            1,
+		Enabled:       true,
+		GlobalEnabled: true,
+		Trigger:       InletTemperature,
+		TriggerLimit:  35,
+		Alert:         true,
+		Limit:         450,
+		Correction:    6 * time.Second,
+		Reporting:     time.Minute,
+	}
+	if err := n.SetPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+	got, err := n.GetPolicy(Platform, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, p) {
+		t.Errorf("GetPolicy = %+v, want %+v", got, p)
+	}
+	for _, a := range b.addrs {
+		if a != ME {
+			t.Errorf("request went to %v, want %v", a, ME)
+		}
+	}
+
+	err = n.SetPolicy(&Policy{Domain: CPU, ID: 2})
+	if cc, ok := ipmi.Completion(err); !ok || cc != CompletionLimitOutOfRange || !strings.HasPrefix(err.Error(), "power limit of 0W is out of range") {
+		t.Errorf("SetPolicy(0W) = %v", err)
+	}
+	if err := n.SetPolicy(&Policy{Limit: 1, Reporting: 20 * time.Hour}); err == nil {
+		t.Error("SetPolicy with a reporting period of 20h did not fail")
+	}
+
+	if err := n.RemovePolicy(Platform, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.RemovePolicy(Platform, 1); err != ErrNoPolicy {
+		t.Errorf("RemovePolicy of a removed policy = %v, want %v", err, ErrNoPolicy)
+	}
+}
+
+func TestPolicyControl(t *testing.T) {
+	n, b := newME(t)
+	for _, tt := range []struct {
+		f    func() error
+		want []byte
+	}{
+		{func() error { return n.EnableGlobal(true) }, []byte{1, 0, 0}},
+		{func() error { return n.EnableDomain(Memory, false) }, []byte{2, 2, 0}},
+		{func() error { return n.EnablePolicy(CPU, 7, true) }, []byte{5, 1, 7}},
+	} {
+		if err := tt.f(); err != nil {
+			t.Fatal(err)
+		}
+		reqs := b.Requests()
+		if got := reqs[len(reqs)-1].Data[3:]; !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Enable/Disable Policy Control request = % x, want % x", got, tt.want)
+		}
+	}
+}
+
+func TestStatistics(t *testing.T) {
+	n, b := newME(t)
+	s, err := n.GetStatistics(GlobalPower, Platform, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Statistics{
+		Current:     200,
+		Min:         100,
+		Max:         300,
+		Average:     150,
+		Time:        time.Unix(100000000, 0),
+		Period:      time.Minute,
+		Domain:      Platform,
+		Enabled:     true,
+		Operational: true,
+		Measuring:   true,
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("GetStatistics = %+v, want %+v", s, want)
+	}
+	if _, err := n.GetStatistics(PolicyPower, Platform, 1); err == nil {
+		t.Error("GetStatistics(PolicyPower) did not fail")
+	}
+
+	if err := n.ResetStatistics(PolicyPower, CPU, 3); err != nil {
+		t.Fatal(err)
+	}
+	reqs := b.Requests()
+	if got := reqs[len(reqs)-1].Data[3:]; !reflect.DeepEqual(got, []byte{1, 1, 3}) {
+		t.Errorf("Reset Statistics request = % x, want 01 01 03", got)
+	}
+}
+
+func TestNotIntel(t *testing.T) {
+	b := &bridge{BMC: ipmitest.New()}
+	b.Respond(netfnNM, cmdGetStatistics, 0x57, 0x01)
+	n := New(&ipmi.IPMI{Transport: b})
+	if _, err := n.GetStatistics(GlobalPower, Platform, 0); err == nil {
+		t.Errorf("GetStatistics with a short manufacturer ID = %v, want an error", err)
+	}
+
+	// BMCs that cannot bridge fail.
+	n = New(ipmitest.New().IPMI())
+	if _, err := n.GetPolicy(Platform, 0); err == nil {
+		t.Error("GetPolicy without bridging did not fail")
+	}
+}
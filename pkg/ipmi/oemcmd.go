@@ -0,0 +1,161 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// NetFns of OEM commands.
+const (
+	// NetFnOEMGroup commands start their request and response data,
+	// after the completion code, with the IANA enterprise number of the
+	// manufacturer that defines them.
+	NetFnOEMGroup = 0x2E
+
+	// NetFnOEMFirst to NetFnOEMLast are defined by the BMC's
+	// manufacturer.
+	NetFnOEMFirst = 0x30
+	NetFnOEMLast  = 0x3F
+)
+
+// OEMCommand is an OEM command of a manufacturer: how to ask for it, and
+// what its response means.
+type OEMCommand struct {
+	NetFn byte
+	Cmd   byte
+
+	// Usage lists the arguments of the command, and says what it does.
+	Usage string
+
+	// Encode, if set, returns the request data of args, as typed on a
+	// command line. If not, the command takes no arguments.
+	Encode func(args []string) ([]byte, error)
+
+	// Decode, if set, returns what the response data means, after the
+	// completion code and, for NetFnOEMGroup, the enterprise number. If
+	// not, the data is returned as []byte.
+	Decode func(data []byte) (interface{}, error)
+}
+
+// OEMExtension is the OEM commands of a manufacturer, by name.
+type OEMExtension struct {
+	Name     string
+	Commands map[string]*OEMCommand
+}
+
+var (
+	oemExtensionsMu sync.RWMutex
+	oemExtensions   = make(map[uint32]*OEMExtension)
+)
+
+// RegisterOEMExtension registers e as the OEM commands of the manufacturer
+// with IANA enterprise number id, replacing any others. Extensions are
+// added at build time by calling it from the init function of a vendor
+// package the command imports, as for RegisterOEMEventTable. A nil e
+// removes the extension.
+func RegisterOEMExtension(id uint32, e *OEMExtension) {
+	oemExtensionsMu.Lock()
+	defer oemExtensionsMu.Unlock()
+	if e == nil {
+		delete(oemExtensions, id)
+		return
+	}
+	oemExtensions[id] = e
+}
+
+// OEMExtensionOf returns the OEM commands of manufacturer id, nil if none
+// are registered.
+func OEMExtensionOf(id uint32) *OEMExtension {
+	oemExtensionsMu.RLock()
+	defer oemExtensionsMu.RUnlock()
+	return oemExtensions[id]
+}
+
+// Names returns the names of the commands of e, sorted.
+func (e *OEMExtension) Names() []string {
+	var names []string
+	for n := range e.Commands {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OEMExtension returns the OEM commands of the BMC's manufacturer, as Get
+// Device ID says it is.
+func (i *IPMI) OEMExtension() (*OEMExtension, uint32, error) {
+	id, err := i.GetDeviceID()
+	if err != nil {
+		return nil, 0, err
+	}
+	m := id.Manufacturer()
+	e := OEMExtensionOf(m)
+	if e == nil {
+		return nil, m, fmt.Errorf("no OEM commands of manufacturer %d are registered", m)
+	}
+	return e, m, nil
+}
+
+// RunOEMCommand runs the OEM command name of the BMC's manufacturer with
+// args, and returns its decoded response.
+func (i *IPMI) RunOEMCommand(name string, args ...string) (interface{}, error) {
+	e, m, err := i.OEMExtension()
+	if err != nil {
+		return nil, err
+	}
+	return e.Run(i, m, name, args...)
+}
+
+// Run runs command name of e on the BMC of manufacturer m with args, and
+// returns its decoded response.
+func (e *OEMExtension) Run(i *IPMI, m uint32, name string, args ...string) (interface{}, error) {
+	c, ok := e.Commands[name]
+	if !ok {
+		return nil, fmt.Errorf("%s has no OEM command %q; it has %s", e.Name, name, strings.Join(e.Names(), ", "))
+	}
+	op := fmt.Sprintf("%s %s", e.Name, name)
+
+	var data []byte
+	switch {
+	case c.Encode != nil:
+		var err error
+		if data, err = c.Encode(args); err != nil {
+			return nil, fmt.Errorf("%s: %v; usage: %s", op, err, c.Usage)
+		}
+	case len(args) != 0:
+		return nil, fmt.Errorf("%s takes no arguments", op)
+	}
+	iana := []byte{byte(m), byte(m >> 8), byte(m >> 16)}
+	if c.NetFn == NetFnOEMGroup {
+		data = append(iana, data...)
+	}
+
+	resp, err := i.SendRecv(c.NetFn, c.Cmd, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkCompletion(op, c.NetFn, c.Cmd, resp); err != nil {
+		return nil, err
+	}
+	resp = resp[1:]
+	if c.NetFn == NetFnOEMGroup {
+		if len(resp) < 3 || manufacturer([3]byte{resp[0], resp[1], resp[2]}) != m {
+			return nil, fmt.Errorf("%s: response %#x is not of manufacturer %d", op, resp, m)
+		}
+		resp = resp[3:]
+	}
+	if c.Decode == nil {
+		return resp, nil
+	}
+	v, err := c.Decode(resp)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", op, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,106 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestOEMExtension(t *testing.T) {
+	// Manufacturer 0x012345, a made-up one.
+	const m = 0x012345
+	fanMode := &OEMCommand{
+		NetFn: NetFnOEMFirst,
+		Cmd:   0x45,
+		Usage: "MODE: set the fan mode, 0 to 4",
+		Encode: func(args []string) ([]byte, error) {
+			if len(args) != 1 {
+				return nil, fmt.Errorf("want one mode")
+			}
+			n, err := strconv.ParseUint(args[0], 0, 8)
+			if err != nil || n > 4 {
+				return nil, fmt.Errorf("bad mode %q", args[0])
+			}
+			return []byte{1, byte(n)}, nil
+		},
+	}
+	version := &OEMCommand{
+		NetFn: NetFnOEMGroup,
+		Cmd:   0x01,
+		Usage: "the version of the OEM firmware",
+		Decode: func(b []byte) (interface{}, error) {
+			if len(b) < 2 {
+				return nil, fmt.Errorf("short version")
+			}
+			return fmt.Sprintf("%d.%d", b[0], b[1]), nil
+		},
+	}
+	RegisterOEMExtension(m, &OEMExtension{
+		Name:     "Acme",
+		Commands: map[string]*OEMCommand{"fan-mode": fanMode, "version": version},
+	})
+	defer RegisterOEMExtension(m, nil)
+
+	f := &fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_APP, _BMC_GET_DEVICE_ID}: {0, 0x20, 1, 1, 0x12, 0x02, 0, 0x45, 0x23, 0x01, 0, 0, 0, 0, 0, 0},
+		{NetFnOEMFirst, 0x45}:                 {0},
+		{NetFnOEMGroup, 0x01}:                 {0, 0x45, 0x23, 0x01, 3, 7},
+	}}
+	i := &IPMI{Transport: f}
+
+	e, got, err := i.OEMExtension()
+	if err != nil || got != m || e.Name != "Acme" {
+		t.Fatalf("OEMExtension = %v, %#x, %v, want Acme of %#x", e, got, err, m)
+	}
+	if names := e.Names(); !reflect.DeepEqual(names, []string{"fan-mode", "version"}) {
+		t.Errorf("Names = %q", names)
+	}
+
+	if v, err := i.RunOEMCommand("version"); err != nil || v != "3.7" {
+		t.Errorf("RunOEMCommand(version) = %v, %v, want 3.7", v, err)
+	}
+	if last := f.requests[len(f.requests)-1]; !bytes.Equal(last, []byte{NetFnOEMGroup, 0x01, 0x45, 0x23, 0x01}) {
+		t.Errorf("version request = %#x, want the enterprise number", last)
+	}
+	if v, err := i.RunOEMCommand("fan-mode", "2"); err != nil || len(v.([]byte)) != 0 {
+		t.Errorf("RunOEMCommand(fan-mode 2) = %v, %v", v, err)
+	}
+	if last := f.requests[len(f.requests)-1]; !bytes.Equal(last, []byte{NetFnOEMFirst, 0x45, 1, 2}) {
+		t.Errorf("fan-mode request = %#x", last)
+	}
+
+	for _, tt := range []struct {
+		args []string
+		want string
+	}{
+		{[]string{"fan-mode", "9"}, "usage: MODE"},
+		{[]string{"version", "now"}, "takes no arguments"},
+		{[]string{"reset"}, "has no OEM command"},
+	} {
+		if _, err := i.RunOEMCommand(tt.args[0], tt.args[1:]...); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("RunOEMCommand(%q) = %v, want an error with %q", tt.args, err, tt.want)
+		}
+	}
+
+	// A response of another manufacturer, or a failed command, fails.
+	f.responses[[2]byte{NetFnOEMGroup, 0x01}] = []byte{0, 0x74, 0x02, 0x00, 3, 7}
+	if _, err := i.RunOEMCommand("version"); err == nil {
+		t.Error("RunOEMCommand with a response of another manufacturer did not fail")
+	}
+	f.responses[[2]byte{NetFnOEMFirst, 0x45}] = []byte{byte(CompletionInvalidCommand)}
+	if _, err := i.RunOEMCommand("fan-mode", "1"); !isCompletion(err, CompletionInvalidCommand) {
+		t.Errorf("RunOEMCommand of a command the BMC does not have = %v", err)
+	}
+
+	RegisterOEMExtension(m, nil)
+	if _, err := i.RunOEMCommand("version"); err == nil {
+		t.Error("RunOEMCommand with no extension registered did not fail")
+	}
+}
@@ -0,0 +1,71 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import "fmt"
+
+// OSAction is what the OS is about to do to the machine, logged so the
+// BMC's SEL tells why the machine went down.
+type OSAction byte
+
+// OS actions.
+const (
+	OSPowerOff OSAction = iota
+	OSColdReset
+	OSWarmReset
+	OSSleep
+	OSHibernate
+)
+
+const (
+	// Generator ID of system management software, software ID 20h.
+	genIDSystemSoftware = 0x0041
+
+	sensorTypeSystemBoot = 0x1D
+	sensorTypeOSStop     = 0x20
+	sensorTypeACPIState  = 0x22
+)
+
+var osActionEvents = map[OSAction][2]byte{
+	OSPowerOff:  {sensorTypeOSStop, 0x03},     // OS Graceful Shutdown
+	OSColdReset: {sensorTypeSystemBoot, 0x05}, // OS Initiated Hard Reset
+	OSWarmReset: {sensorTypeSystemBoot, 0x06}, // OS Initiated Warm Reset
+	OSSleep:     {sensorTypeACPIState, 0x03},  // S3: Sleeping, Memory Retained
+	OSHibernate: {sensorTypeACPIState, 0x04},  // S4: Suspend to Disk
+}
+
+// OSActionEvent returns the event of a, ready for LogSystemEvent.
+func OSActionEvent(a OSAction) (*Event, error) {
+	e, ok := osActionEvents[a]
+	if !ok {
+		return nil, fmt.Errorf("unknown OS action %d", a)
+	}
+	return &Event{
+		RecordType: 0x02,
+		StandardEvent: StandardEvent{
+			GenID:        genIDSystemSoftware,
+			EvMRev:       0x04,
+			SensorType:   e[0],
+			EventTypeDir: eventTypeSensorSpecific,
+			// Event data 2 and 3 are unspecified.
+			EventData: [3]uint8{e[1], 0xFF, 0xFF},
+		},
+	}, nil
+}
+
+// LogOSAction opens the first IPMI device and logs a, with commands bounded
+// as ReportMilestone's are.
+func LogOSAction(a OSAction) error {
+	e, err := OSActionEvent(a)
+	if err != nil {
+		return err
+	}
+	i, err := Open(0)
+	if err != nil {
+		return err
+	}
+	defer i.Close()
+	return i.WithTimeout(milestoneTimeout).LogSystemEvent(e)
+}
@@ -0,0 +1,37 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOSActionEvent(t *testing.T) {
+	for _, tt := range []struct {
+		a    OSAction
+		want string
+	}{
+		{OSPowerOff, "OS Critical Stop #0x00 | OS Graceful Shutdown | Asserted"},
+		{OSColdReset, "System Boot Initiated #0x00 | OS Initiated Hard Reset | Asserted"},
+		{OSWarmReset, "System Boot Initiated #0x00 | OS Initiated Warm Reset | Asserted"},
+		{OSSleep, "S3: Sleeping, Memory Retained | Asserted"},
+		{OSHibernate, "S4: Suspend to Disk | Asserted"},
+	} {
+		e, err := OSActionEvent(tt.a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e.GenID != genIDSystemSoftware {
+			t.Errorf("OSActionEvent(%d) generator %#04x, want %#04x", tt.a, e.GenID, genIDSystemSoftware)
+		}
+		if got := e.String(); !strings.HasSuffix(got, tt.want) {
+			t.Errorf("OSActionEvent(%d) = %q, want it to end in %q", tt.a, got, tt.want)
+		}
+	}
+	if _, err := OSActionEvent(OSHibernate + 1); err == nil {
+		t.Error("OSActionEvent of an unknown action did not fail")
+	}
+}
@@ -0,0 +1,622 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unsafe"
+)
+
+// PEFAction is a set of actions Platform Event Filtering can take when an
+// event matches a filter, IPMI v2.0 section 17.
+type PEFAction byte
+
+// PEF actions.
+const (
+	PEFAlert               PEFAction = 0x01
+	PEFPowerOff            PEFAction = 0x02
+	PEFReset               PEFAction = 0x04
+	PEFPowerCycle          PEFAction = 0x08
+	PEFOEM                 PEFAction = 0x10
+	PEFDiagnosticInterrupt PEFAction = 0x20
+	// PEFGroupControl is only valid in event filters.
+	PEFGroupControl PEFAction = 0x40
+)
+
+var pefActionNames = []struct {
+	a    PEFAction
+	name string
+}{
+	{PEFAlert, "alert"},
+	{PEFPowerOff, "power off"},
+	{PEFReset, "reset"},
+	{PEFPowerCycle, "power cycle"},
+	{PEFOEM, "OEM action"},
+	{PEFDiagnosticInterrupt, "diagnostic interrupt"},
+	{PEFGroupControl, "group control"},
+}
+
+func (a PEFAction) String() string {
+	var s []string
+	for _, n := range pefActionNames {
+		if a&n.a != 0 {
+			s = append(s, n.name)
+		}
+	}
+	if len(s) == 0 {
+		return "none"
+	}
+	return strings.Join(s, ", ")
+}
+
+// PEFCapabilities is what Get PEF Capabilities returns.
+type PEFCapabilities struct {
+	// Version is the PEF version, in BCD with the minor version in the
+	// high nibble; 0x51 is 1.5.
+	Version byte
+	// Actions are the actions the BMC supports.
+	Actions PEFAction
+	// OEMFilters says the BMC supports OEM event records in filters.
+	OEMFilters bool
+	// Filters is the number of entries in the event filter table.
+	Filters byte
+}
+
+// GetPEFCapabilities returns what Platform Event Filtering the BMC supports.
+func (i *IPMI) GetPEFCapabilities() (*PEFCapabilities, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_SENSOR_EVENT
+	req.msg.cmd = _BMC_GET_PEF_CAPABILITIES
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.completion("GetPEFCapabilities", recv); err != nil {
+		return nil, err
+	}
+	if len(recv) < 4 {
+		return nil, fmt.Errorf("GetPEFCapabilities: short response of %d bytes", len(recv))
+	}
+	return &PEFCapabilities{
+		Version:    recv[1],
+		Actions:    PEFAction(recv[2]) & pefActionsMask,
+		OEMFilters: recv[2]&0x80 != 0,
+		Filters:    recv[3],
+	}, nil
+}
+
+// PEFParam is a PEF configuration parameter, IPMI v2.0 table 30-6.
+type PEFParam byte
+
+// PEF configuration parameters.
+const (
+	PEFSetInProgress     PEFParam = 0
+	PEFControl           PEFParam = 1
+	PEFActionControl     PEFParam = 2
+	PEFStartupDelay      PEFParam = 3
+	PEFAlertStartupDelay PEFParam = 4
+	PEFNumEventFilters   PEFParam = 5
+	PEFEventFilter       PEFParam = 6
+	PEFEventFilterData1  PEFParam = 7
+	PEFNumAlertPolicies  PEFParam = 8
+	PEFAlertPolicy       PEFParam = 9
+	PEFSystemGUID        PEFParam = 10
+	PEFNumAlertStrings   PEFParam = 11
+	PEFAlertStringKeys   PEFParam = 12
+	PEFAlertStrings      PEFParam = 13
+)
+
+// ErrPEFParamNotSupported is returned for parameters the BMC does not
+// implement.
+var ErrPEFParamNotSupported = errors.New("PEF parameter not supported")
+
+// ErrPEFSetInProgress is returned by SetPEFConfig if another client is
+// setting parameters.
+var ErrPEFSetInProgress = errors.New("PEF parameters are being set by another client")
+
+// Set PEF Configuration Parameters completion codes, and Set In Progress
+// states.
+const (
+	ccPEFParamNotSupported CompletionCode = 0x80
+	ccPEFSetInProgress     CompletionCode = 0x81
+	ccPEFParamReadOnly     CompletionCode = 0x82
+
+	pefSetComplete   = 0
+	pefSetInProgress = 1
+	pefCommitWrite   = 2
+)
+
+// GetPEFConfigParam reads a PEF configuration parameter. It returns the
+// parameter data, without the revision byte.
+func (i *IPMI) GetPEFConfigParam(param PEFParam, set, block byte) ([]byte, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_SENSOR_EVENT
+	req.msg.cmd = _BMC_GET_PEF_CONFIG
+
+	data := [3]byte{byte(param) & 0x7F, set, block}
+	req.msg.data = unsafe.Pointer(&data[0])
+	req.msg.dataLen = 3
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return nil, err
+	}
+	err = req.completion(fmt.Sprintf("GetPEFConfig(%d)", param), recv)
+	if isCompletion(err, ccPEFParamNotSupported) {
+		return nil, ErrPEFParamNotSupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(recv) < 2 {
+		return nil, fmt.Errorf("GetPEFConfig(%d): short response of %d bytes", param, len(recv))
+	}
+	return recv[2:], nil
+}
+
+// SetPEFConfigParam writes a PEF configuration parameter, outside of the
+// Set In Progress handshake of SetPEFConfig.
+func (i *IPMI) SetPEFConfigParam(param PEFParam, data []byte) error {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_SENSOR_EVENT
+	req.msg.cmd = _BMC_SET_PEF_CONFIG
+
+	b := append([]byte{byte(param) & 0x7F}, data...)
+	req.msg.data = unsafe.Pointer(&b[0])
+	req.msg.dataLen = uint16(len(b))
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return err
+	}
+	err = req.completion(fmt.Sprintf("SetPEFConfig(%d)", param), recv)
+	switch {
+	case isCompletion(err, ccPEFParamNotSupported):
+		return ErrPEFParamNotSupported
+	case isCompletion(err, ccPEFSetInProgress):
+		return ErrPEFSetInProgress
+	case isCompletion(err, ccPEFParamReadOnly):
+		return fmt.Errorf("PEF parameter %d is read-only: %w", param, err)
+	}
+	return err
+}
+
+// PEFSetting is a PEF configuration parameter to set, and its data.
+type PEFSetting struct {
+	Param PEFParam
+	Data  []byte
+}
+
+// SetPEFConfig writes settings in order, between claiming Set In Progress
+// and committing them, as SetLanConfig does for LAN parameters.
+func (i *IPMI) SetPEFConfig(settings ...PEFSetting) (err error) {
+	lock := true
+	switch err := i.SetPEFConfigParam(PEFSetInProgress, []byte{pefSetInProgress}); err {
+	case nil:
+	case ErrPEFParamNotSupported:
+		lock = false
+	default:
+		return err
+	}
+	if lock {
+		defer func() {
+			if rerr := i.SetPEFConfigParam(PEFSetInProgress, []byte{pefSetComplete}); err == nil {
+				err = rerr
+			}
+		}()
+	}
+	for _, s := range settings {
+		if err := i.SetPEFConfigParam(s.Param, s.Data); err != nil {
+			return err
+		}
+	}
+	if lock {
+		err := i.SetPEFConfigParam(PEFSetInProgress, []byte{pefCommitWrite})
+		if err != nil && err != ErrPEFParamNotSupported && !isCompletion(err, CompletionInvalidDataField) {
+			return err
+		}
+	}
+	return nil
+}
+
+// EventSeverity is the severity an event filter gives the events it
+// matches, for alerts.
+type EventSeverity byte
+
+// Event severities.
+const (
+	SeverityUnspecified    EventSeverity = 0x00
+	SeverityMonitor        EventSeverity = 0x01
+	SeverityInformation    EventSeverity = 0x02
+	SeverityOK             EventSeverity = 0x04
+	SeverityNonCritical    EventSeverity = 0x08
+	SeverityCritical       EventSeverity = 0x10
+	SeverityNonRecoverable EventSeverity = 0x20
+)
+
+func (s EventSeverity) String() string {
+	switch s {
+	case SeverityUnspecified:
+		return "unspecified"
+	case SeverityMonitor:
+		return "monitor"
+	case SeverityInformation:
+		return "information"
+	case SeverityOK:
+		return "OK"
+	case SeverityNonCritical:
+		return "non-critical"
+	case SeverityCritical:
+		return "critical"
+	case SeverityNonRecoverable:
+		return "non-recoverable"
+	}
+	return fmt.Sprintf("severity %#x", byte(s))
+}
+
+// EventFilterAny matches any generator, sensor type, sensor number or
+// event trigger in an event filter.
+const EventFilterAny = 0xFF
+
+// EventDataMask matches one event data byte: an event matches if the byte
+// ANDed with AND equals Compare1 where Compare2 bits are set, with the bits
+// where they are clear only ANDed, IPMI v2.0 section 17.8.
+type EventDataMask struct {
+	AND      byte
+	Compare1 byte
+	Compare2 byte
+}
+
+// EventFilter is an entry of the event filter table, IPMI v2.0 table 17-2.
+type EventFilter struct {
+	// Number is the entry, from 1.
+	Number  byte
+	Enabled bool
+	// Preconfigured filters were set by the manufacturer; only
+	// Enabled can be changed.
+	Preconfigured bool
+
+	Actions PEFAction
+	// Policy is the alert policy number for PEFAlert, and GroupControl
+	// the group control selector for PEFGroupControl.
+	Policy       byte
+	GroupControl byte
+	Severity     EventSeverity
+
+	// What events the filter matches; EventFilterAny for any.
+	GeneratorID  [2]byte
+	SensorType   byte
+	SensorNumber byte
+	EventTrigger byte
+	// OffsetMask has bit n set to match event offset n.
+	OffsetMask uint16
+	EventData  [3]EventDataMask
+}
+
+const eventFilterLen = 20
+
+func (f *EventFilter) unmarshal(b []byte) error {
+	if len(b) < eventFilterLen {
+		return fmt.Errorf("event filter is %d bytes, want %d", len(b), eventFilterLen)
+	}
+	*f = EventFilter{
+		Enabled:       b[0]&0x80 != 0,
+		Preconfigured: b[0]&0x60 == 0x40,
+		Actions:       PEFAction(b[1] & 0x7F),
+		Policy:        b[2] & 0x0F,
+		GroupControl:  b[2] >> 4 & 0x7,
+		Severity:      EventSeverity(b[3]),
+		GeneratorID:   [2]byte{b[4], b[5]},
+		SensorType:    b[6],
+		SensorNumber:  b[7],
+		EventTrigger:  b[8],
+		OffsetMask:    uint16(b[9]) | uint16(b[10])<<8,
+	}
+	for k := range f.EventData {
+		d := b[11+3*k:]
+		f.EventData[k] = EventDataMask{AND: d[0], Compare1: d[1], Compare2: d[2]}
+	}
+	return nil
+}
+
+func (f *EventFilter) marshal() []byte {
+	b := make([]byte, eventFilterLen)
+	if f.Enabled {
+		b[0] |= 0x80
+	}
+	if f.Preconfigured {
+		b[0] |= 0x40
+	}
+	b[1] = byte(f.Actions & 0x7F)
+	b[2] = f.GroupControl&0x7<<4 | f.Policy&0x0F
+	b[3] = byte(f.Severity)
+	b[4], b[5] = f.GeneratorID[0], f.GeneratorID[1]
+	b[6], b[7], b[8] = f.SensorType, f.SensorNumber, f.EventTrigger
+	b[9], b[10] = byte(f.OffsetMask), byte(f.OffsetMask>>8)
+	for k, d := range f.EventData {
+		copy(b[11+3*k:], []byte{d.AND, d.Compare1, d.Compare2})
+	}
+	return b
+}
+
+// AlertPolicyRule says what to do after an alert policy entry sent its
+// alert, IPMI v2.0 table 30-6, parameter 9.
+type AlertPolicyRule byte
+
+// Alert policy rules.
+const (
+	// AlertAlways goes on to the next entry of the policy whether the
+	// alert was sent or not.
+	AlertAlways AlertPolicyRule = 0
+	// AlertNextOnFailure goes on to the next entry if the alert failed.
+	AlertNextOnFailure AlertPolicyRule = 1
+	// AlertStopOnFailure stops at the first entry whose alert
+	// succeeded, and the first that failed.
+	AlertStopOnFailure AlertPolicyRule = 2
+	// AlertNextChannel and AlertNextMedia go on to the next entry on
+	// another channel, or of another channel medium, if the alert
+	// failed.
+	AlertNextChannel AlertPolicyRule = 3
+	AlertNextMedia   AlertPolicyRule = 4
+)
+
+func (r AlertPolicyRule) String() string {
+	switch r {
+	case AlertAlways:
+		return "always send"
+	case AlertNextOnFailure:
+		return "next entry on failure"
+	case AlertStopOnFailure:
+		return "stop on failure"
+	case AlertNextChannel:
+		return "next channel on failure"
+	case AlertNextMedia:
+		return "next medium on failure"
+	}
+	return fmt.Sprintf("rule %d", byte(r))
+}
+
+// AlertPolicy is an entry of the alert policy table, which says where the
+// alerts of event filters with its policy number go.
+type AlertPolicy struct {
+	// Entry is the entry, from 1.
+	Entry   byte
+	Policy  byte
+	Enabled bool
+	Rule    AlertPolicyRule
+	// Channel and Destination are the LAN or serial channel and
+	// destination selector the alert is sent to.
+	Channel     byte
+	Destination byte
+	// EventSpecific looks the alert string up by event filter and
+	// StringSet; otherwise StringSet is the alert string to send.
+	EventSpecific bool
+	StringSet     byte
+}
+
+const alertPolicyLen = 3
+
+func (p *AlertPolicy) unmarshal(b []byte) error {
+	if len(b) < alertPolicyLen {
+		return fmt.Errorf("alert policy is %d bytes, want %d", len(b), alertPolicyLen)
+	}
+	*p = AlertPolicy{
+		Policy:        b[0] >> 4,
+		Enabled:       b[0]&0x08 != 0,
+		Rule:          AlertPolicyRule(b[0] & 0x07),
+		Channel:       b[1] >> 4,
+		Destination:   b[1] & 0x0F,
+		EventSpecific: b[2]&0x80 != 0,
+		StringSet:     b[2] & 0x7F,
+	}
+	return nil
+}
+
+func (p *AlertPolicy) marshal() []byte {
+	b := []byte{
+		p.Policy<<4 | byte(p.Rule)&0x07,
+		p.Channel<<4 | p.Destination&0x0F,
+		p.StringSet & 0x7F,
+	}
+	if p.Enabled {
+		b[0] |= 0x08
+	}
+	if p.EventSpecific {
+		b[2] |= 0x80
+	}
+	return b
+}
+
+// PEF Control bits.
+const (
+	pefEnable            = 0x01
+	pefEventMessages     = 0x02
+	pefStartupDelay      = 0x04
+	pefAlertStartupDelay = 0x08
+
+	// pefActionsMask has the actions of PEF capabilities and Action
+	// Global Control, which have no group control.
+	pefActionsMask = 0x3F
+	// pefEntryMask masks table sizes and set selectors of event filters
+	// and alert policies.
+	pefEntryMask = 0x7F
+)
+
+// PEFConfig is the PEF configuration. Fields of parameters the BMC does not
+// support are left zero.
+type PEFConfig struct {
+	// Enabled turns PEF on, and EventMessages has the BMC log an event
+	// for each action PEF takes.
+	Enabled       bool
+	EventMessages bool
+	// StartupDelay and AlertStartupDelay hold off PEF actions, and
+	// alerts, for that many seconds after power up and reset, if
+	// enabled.
+	StartupDelayEnabled      bool
+	AlertStartupDelayEnabled bool
+	StartupDelay             byte
+	AlertStartupDelay        byte
+	// Actions are the actions PEF may take at all.
+	Actions PEFAction
+
+	Filters  []EventFilter
+	Policies []AlertPolicy
+}
+
+// control encodes the PEF Control parameter of c.
+func (c *PEFConfig) control() byte {
+	var b byte
+	for _, f := range []struct {
+		on  bool
+		bit byte
+	}{
+		{c.Enabled, pefEnable},
+		{c.EventMessages, pefEventMessages},
+		{c.StartupDelayEnabled, pefStartupDelay},
+		{c.AlertStartupDelayEnabled, pefAlertStartupDelay},
+	} {
+		if f.on {
+			b |= f.bit
+		}
+	}
+	return b
+}
+
+// getPEFByte reads the first byte of a one byte parameter, or returns ok
+// false if the BMC does not support it.
+func (i *IPMI) getPEFByte(param PEFParam) (b byte, ok bool, err error) {
+	d, err := i.GetPEFConfigParam(param, 0, 0)
+	if err == ErrPEFParamNotSupported {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	if len(d) < 1 {
+		return 0, false, fmt.Errorf("PEF parameter %d is empty", param)
+	}
+	return d[0], true, nil
+}
+
+// GetPEFConfig reads the PEF configuration, with every event filter and
+// alert policy entry.
+func (i *IPMI) GetPEFConfig() (*PEFConfig, error) {
+	c := &PEFConfig{}
+	if b, ok, err := i.getPEFByte(PEFControl); err != nil {
+		return nil, err
+	} else if ok {
+		c.Enabled = b&pefEnable != 0
+		c.EventMessages = b&pefEventMessages != 0
+		c.StartupDelayEnabled = b&pefStartupDelay != 0
+		c.AlertStartupDelayEnabled = b&pefAlertStartupDelay != 0
+	}
+	for _, p := range []struct {
+		param PEFParam
+		v     *byte
+	}{
+		{PEFActionControl, (*byte)(&c.Actions)},
+		{PEFStartupDelay, &c.StartupDelay},
+		{PEFAlertStartupDelay, &c.AlertStartupDelay},
+	} {
+		b, _, err := i.getPEFByte(p.param)
+		if err != nil {
+			return nil, err
+		}
+		*p.v = b
+	}
+	c.Actions &= pefActionsMask
+
+	n, _, err := i.getPEFByte(PEFNumEventFilters)
+	if err != nil {
+		return nil, err
+	}
+	for k := byte(1); k <= n&pefEntryMask; k++ {
+		d, err := i.GetPEFConfigParam(PEFEventFilter, k, 0)
+		if err != nil {
+			return nil, err
+		}
+		// The data starts with the set selector.
+		if len(d) < 1 {
+			return nil, fmt.Errorf("event filter %d is empty", k)
+		}
+		var f EventFilter
+		if err := f.unmarshal(d[1:]); err != nil {
+			return nil, fmt.Errorf("event filter %d: %v", k, err)
+		}
+		f.Number = d[0] & pefEntryMask
+		c.Filters = append(c.Filters, f)
+	}
+
+	n, _, err = i.getPEFByte(PEFNumAlertPolicies)
+	if err != nil {
+		return nil, err
+	}
+	for k := byte(1); k <= n&pefEntryMask; k++ {
+		d, err := i.GetPEFConfigParam(PEFAlertPolicy, k, 0)
+		if err != nil {
+			return nil, err
+		}
+		if len(d) < 1 {
+			return nil, fmt.Errorf("alert policy entry %d is empty", k)
+		}
+		var p AlertPolicy
+		if err := p.unmarshal(d[1:]); err != nil {
+			return nil, fmt.Errorf("alert policy entry %d: %v", k, err)
+		}
+		p.Entry = d[0] & pefEntryMask
+		c.Policies = append(c.Policies, p)
+	}
+	return c, nil
+}
+
+// SetPEFControl writes the PEF Control, Action Global Control and startup
+// delay parameters of c. Filters and policies are left alone.
+func (i *IPMI) SetPEFControl(c *PEFConfig) error {
+	return i.SetPEFConfig(
+		PEFSetting{PEFControl, []byte{c.control()}},
+		PEFSetting{PEFActionControl, []byte{byte(c.Actions & pefActionsMask)}},
+		PEFSetting{PEFStartupDelay, []byte{c.StartupDelay}},
+		PEFSetting{PEFAlertStartupDelay, []byte{c.AlertStartupDelay}},
+	)
+}
+
+// SetEventFilter writes event filter table entry f.Number.
+func (i *IPMI) SetEventFilter(f *EventFilter) error {
+	if f.Number == 0 || f.Number > pefEntryMask {
+		return fmt.Errorf("event filter number %d is not within [1, %d]", f.Number, pefEntryMask)
+	}
+	return i.SetPEFConfig(PEFSetting{PEFEventFilter, append([]byte{f.Number}, f.marshal()...)})
+}
+
+// EnableEventFilter enables or disables event filter n, which works for
+// preconfigured filters as well.
+func (i *IPMI) EnableEventFilter(n byte, enable bool) error {
+	d, err := i.GetPEFConfigParam(PEFEventFilterData1, n, 0)
+	if err != nil {
+		return err
+	}
+	if len(d) < 2 {
+		return fmt.Errorf("event filter %d data 1 is %d bytes, want 2", n, len(d))
+	}
+	b := d[1] &^ 0x80
+	if enable {
+		b |= 0x80
+	}
+	return i.SetPEFConfig(PEFSetting{PEFEventFilterData1, []byte{n, b}})
+}
+
+// SetAlertPolicy writes alert policy table entry p.Entry.
+func (i *IPMI) SetAlertPolicy(p *AlertPolicy) error {
+	if p.Entry == 0 || p.Entry > pefEntryMask {
+		return fmt.Errorf("alert policy entry %d is not within [1, %d]", p.Entry, pefEntryMask)
+	}
+	if p.Policy == 0 || p.Policy > 15 {
+		return fmt.Errorf("alert policy number %d is not within [1, 15]", p.Policy)
+	}
+	return i.SetPEFConfig(PEFSetting{PEFAlertPolicy, append([]byte{p.Entry}, p.marshal()...)})
+}
@@ -0,0 +1,168 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGetPEFCapabilities(t *testing.T) {
+	i := &IPMI{Transport: &fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_SENSOR_EVENT, _BMC_GET_PEF_CAPABILITIES}: {0, 0x51, 0xBF, 16},
+	}}}
+	c, err := i.GetPEFCapabilities()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &PEFCapabilities{Version: 0x51, Actions: 0x3F, OEMFilters: true, Filters: 16}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("GetPEFCapabilities = %+v, want %+v", c, want)
+	}
+	if s := c.Actions.String(); s != "alert, power off, reset, power cycle, OEM action, diagnostic interrupt" {
+		t.Errorf("Actions = %q", s)
+	}
+}
+
+// pefBMC returns a BMC answering Get PEF Configuration Parameters from
+// params, and accepting every Set.
+func pefBMC(params map[[2]byte][]byte) *fakeTransport {
+	f := &fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_SENSOR_EVENT, _BMC_SET_PEF_CONFIG}: {0},
+	}}
+	f.handle(_IPMI_NETFN_SENSOR_EVENT, _BMC_GET_PEF_CONFIG, configParams(params, 0, ccPEFParamNotSupported))
+	return f
+}
+
+var (
+	// Power off on a critical temperature, and alert by policy 1.
+	testFilter = EventFilter{
+		Number:       1,
+		Enabled:      true,
+		Actions:      PEFAlert | PEFPowerOff,
+		Policy:       1,
+		Severity:     SeverityCritical,
+		GeneratorID:  [2]byte{EventFilterAny, EventFilterAny},
+		SensorType:   0x01,
+		SensorNumber: EventFilterAny,
+		EventTrigger: 0x01,
+		OffsetMask:   0x0280,
+		EventData:    [3]EventDataMask{{AND: 0xFF}, {}, {}},
+	}
+	testFilterData = []byte{0x80, 0x03, 0x01, 0x10, 0xFF, 0xFF, 0x01, 0xFF, 0x01, 0x80, 0x02, 0xFF, 0, 0, 0, 0, 0, 0, 0, 0}
+
+	testPolicy = AlertPolicy{
+		Entry:       2,
+		Policy:      1,
+		Enabled:     true,
+		Rule:        AlertNextOnFailure,
+		Channel:     1,
+		Destination: 3,
+		StringSet:   5,
+	}
+	testPolicyData = []byte{0x19, 0x13, 0x05}
+)
+
+func TestGetPEFConfig(t *testing.T) {
+	params := map[[2]byte][]byte{
+		{byte(PEFControl), 0}:          {0x03},
+		{byte(PEFActionControl), 0}:    {0x07},
+		{byte(PEFStartupDelay), 0}:     {60},
+		{byte(PEFNumEventFilters), 0}:  {1},
+		{byte(PEFEventFilter), 1}:      append([]byte{1}, testFilterData...),
+		{byte(PEFNumAlertPolicies), 0}: {2},
+		{byte(PEFAlertPolicy), 1}:      {1, 0, 0, 0},
+		{byte(PEFAlertPolicy), 2}:      append([]byte{2}, testPolicyData...),
+	}
+	i := &IPMI{Transport: pefBMC(params)}
+	c, err := i.GetPEFConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &PEFConfig{
+		Enabled:       true,
+		EventMessages: true,
+		StartupDelay:  60,
+		Actions:       PEFAlert | PEFPowerOff | PEFReset,
+		Filters:       []EventFilter{testFilter},
+		Policies:      []AlertPolicy{{Entry: 1}, testPolicy},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("GetPEFConfig = %+v, want %+v", c, want)
+	}
+
+	params[[2]byte{byte(PEFEventFilter), 1}] = []byte{1, 0x80}
+	if _, err := i.GetPEFConfig(); err == nil {
+		t.Error("GetPEFConfig with a short event filter did not fail")
+	}
+}
+
+func pefSet(param PEFParam, data ...byte) []byte {
+	return append([]byte{_IPMI_NETFN_SENSOR_EVENT, _BMC_SET_PEF_CONFIG, byte(param)}, data...)
+}
+
+func TestSetPEFConfig(t *testing.T) {
+	p := pefBMC(map[[2]byte][]byte{
+		{byte(PEFEventFilterData1), 4}: {4, 0x40},
+	})
+	i := &IPMI{Transport: p}
+
+	for _, tt := range []struct {
+		name string
+		set  func() error
+		want []byte
+	}{
+		{"SetEventFilter", func() error { return i.SetEventFilter(&testFilter) }, pefSet(PEFEventFilter, append([]byte{1}, testFilterData...)...)},
+		{"SetAlertPolicy", func() error { return i.SetAlertPolicy(&testPolicy) }, pefSet(PEFAlertPolicy, append([]byte{2}, testPolicyData...)...)},
+		{"EnableEventFilter", func() error { return i.EnableEventFilter(4, true) }, pefSet(PEFEventFilterData1, 4, 0xC0)},
+	} {
+		p.requests = nil
+		if err := tt.set(); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		// The setting is the one between Set In Progress and Commit
+		// Write.
+		n := len(p.requests)
+		got := p.requests[n-3]
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s sent %#x, want %#x", tt.name, got, tt.want)
+		}
+		want := [][]byte{
+			pefSet(PEFSetInProgress, pefSetInProgress),
+			pefSet(PEFSetInProgress, pefCommitWrite),
+			pefSet(PEFSetInProgress, pefSetComplete),
+		}
+		if !reflect.DeepEqual([][]byte{p.requests[n-4], p.requests[n-2], p.requests[n-1]}, want) {
+			t.Errorf("%s handshake = %#x, want %#x", tt.name, p.requests, want)
+		}
+	}
+
+	p.requests = nil
+	if err := i.SetPEFControl(&PEFConfig{Enabled: true, StartupDelayEnabled: true, StartupDelay: 30, Actions: PEFAlert | PEFGroupControl}); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]byte{
+		pefSet(PEFSetInProgress, pefSetInProgress),
+		pefSet(PEFControl, 0x05),
+		pefSet(PEFActionControl, 0x01),
+		pefSet(PEFStartupDelay, 30),
+		pefSet(PEFAlertStartupDelay, 0),
+		pefSet(PEFSetInProgress, pefCommitWrite),
+		pefSet(PEFSetInProgress, pefSetComplete),
+	}
+	if !reflect.DeepEqual(p.requests, want) {
+		t.Errorf("SetPEFControl sent %#x, want %#x", p.requests, want)
+	}
+
+	for _, err := range []error{
+		i.SetEventFilter(&EventFilter{}),
+		i.SetAlertPolicy(&AlertPolicy{Entry: 1}),
+		i.EnableEventFilter(9, false),
+	} {
+		if err == nil {
+			t.Error("invalid PEF setting did not fail")
+		}
+	}
+}
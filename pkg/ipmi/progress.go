@@ -0,0 +1,111 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import "time"
+
+// ProgressCode is a System Firmware Progress code, IPMI v2.0 table 42-3,
+// sensor type 0Fh, offset 02h.
+type ProgressCode byte
+
+// System Firmware Progress codes.
+const (
+	ProgressUnspecified         ProgressCode = 0x00
+	ProgressMemoryInit          ProgressCode = 0x01
+	ProgressHardDiskInit        ProgressCode = 0x02
+	ProgressSecondaryCPUInit    ProgressCode = 0x03
+	ProgressUserAuthentication  ProgressCode = 0x04
+	ProgressSystemSetup         ProgressCode = 0x05
+	ProgressUSBConfig           ProgressCode = 0x06
+	ProgressPCIConfig           ProgressCode = 0x07
+	ProgressOptionROMInit       ProgressCode = 0x08
+	ProgressVideoInit           ProgressCode = 0x09
+	ProgressCacheInit           ProgressCode = 0x0A
+	ProgressSMBusInit           ProgressCode = 0x0B
+	ProgressKeyboardInit        ProgressCode = 0x0C
+	ProgressManagementCtrlInit  ProgressCode = 0x0D
+	ProgressCallingOSWakeVector ProgressCode = 0x12
+	ProgressStartingOSBoot      ProgressCode = 0x13
+	ProgressBaseboardInit       ProgressCode = 0x14
+	ProgressPrimaryCPUInit      ProgressCode = 0x19
+)
+
+// Milestone is a point in a u-root boot that is reported to the BMC as an
+// OEM POST code, so BMC-side tooling can tell where a boot got stuck. The
+// codes are picked from a range firmware does not commonly use.
+type Milestone byte
+
+// u-root boot milestones.
+const (
+	MilestoneInitStart     Milestone = 0xB0
+	MilestoneNetworkUp     Milestone = 0xB1
+	MilestoneImageVerified Milestone = 0xB2
+	MilestoneKexec         Milestone = 0xB3
+)
+
+const (
+	// Generator ID of system firmware, software ID 00h.
+	genIDSystemFirmware = 0x0001
+
+	sensorTypeFirmwareProgress = 0x0F
+	eventTypeSensorSpecific    = 0x6F
+	firmwareProgressOffset     = 0x02
+	// Event data 1 bits [7:6]: what event data 2 holds.
+	evData2OEM            = 0x80
+	evData2SensorSpecific = 0xC0
+)
+
+func firmwareProgressEvent(data1, data2 byte) *Event {
+	return &Event{
+		RecordType: 0x02,
+		StandardEvent: StandardEvent{
+			GenID:        genIDSystemFirmware,
+			EvMRev:       0x04,
+			SensorType:   sensorTypeFirmwareProgress,
+			EventTypeDir: eventTypeSensorSpecific,
+			EventData:    [3]uint8{data1 | firmwareProgressOffset, data2, 0xFF},
+		},
+	}
+}
+
+// FirmwareProgressEvent returns a System Firmware Progress event with a
+// standard progress code, ready for LogSystemEvent.
+func FirmwareProgressEvent(c ProgressCode) *Event {
+	return firmwareProgressEvent(evData2SensorSpecific, byte(c))
+}
+
+// POSTCodeEvent returns a System Firmware Progress event carrying an OEM
+// POST code, ready for LogSystemEvent.
+func POSTCodeEvent(code byte) *Event {
+	return firmwareProgressEvent(evData2OEM, code)
+}
+
+// ReportMilestone logs m as a POST code. MilestoneKexec is also logged as
+// the standard "starting OS boot process" progress code.
+func (i *IPMI) ReportMilestone(m Milestone) error {
+	if err := i.LogSystemEvent(POSTCodeEvent(byte(m))); err != nil {
+		return err
+	}
+	if m == MilestoneKexec {
+		return i.LogSystemEvent(FirmwareProgressEvent(ProgressStartingOSBoot))
+	}
+	return nil
+}
+
+// milestoneTimeout bounds each command of ReportMilestone, so that a BMC
+// that does not answer holds up booting only a little.
+const milestoneTimeout = 2 * time.Second
+
+// ReportMilestone opens the first IPMI device and logs m. It is meant to be
+// called from boot code that should carry on if there is no BMC, or a slow
+// one.
+func ReportMilestone(m Milestone) error {
+	i, err := Open(0)
+	if err != nil {
+		return err
+	}
+	defer i.Close()
+	return i.WithTimeout(milestoneTimeout).ReportMilestone(m)
+}
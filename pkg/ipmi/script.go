@@ -0,0 +1,239 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ScriptStep is a step of a script of raw commands: a command and what its
+// response must be, or a pause.
+type ScriptStep struct {
+	// Line is the line of the script the step is on.
+	Line int
+
+	// Request is the netfn, command and data of the command, as RawCmd
+	// takes them.
+	Request []byte
+	// Completions are the completion codes the command may answer with,
+	// CompletionOK only if there are none.
+	Completions []CompletionCode
+	// Response, if not nil, is what the response data must start with,
+	// compared in the bits Mask has set.
+	Response []byte
+	Mask     []byte
+
+	// Sleep, if not 0, makes the step a pause instead of a command.
+	Sleep time.Duration
+}
+
+// ParseScript parses a script of raw commands, as ipmitool's exec runs
+// them, one a line:
+//
+//	# Comments start with #, also at the end of a line.
+//	raw 0x06 0x01
+//	0x30 0x70 0x0c 0 1	# "raw" is optional.
+//
+// Bytes are in C syntax, 0x0c, 014 or 12. A command must complete normally,
+// unless the lines after it say otherwise:
+//
+//	expect cc 0x00 0xc1	# The completion codes it may answer with.
+//	expect data 0x20 * 0x02	# What its data starts with, * for any byte.
+//
+// And
+//
+//	sleep 5s
+//
+// pauses, e.g. for the BMC to reset.
+func ParseScript(r io.Reader) ([]ScriptStep, error) {
+	var steps []ScriptStep
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := s.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			continue
+		}
+		if err := parseScriptLine(&steps, n, f); err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return steps, nil
+}
+
+func parseScriptLine(steps *[]ScriptStep, n int, f []string) error {
+	switch f[0] {
+	case "sleep":
+		if len(f) != 2 {
+			return fmt.Errorf("sleep takes a duration")
+		}
+		d, err := time.ParseDuration(f[1])
+		if err != nil {
+			return err
+		}
+		if d <= 0 {
+			return fmt.Errorf("sleep duration %v is not positive", d)
+		}
+		*steps = append(*steps, ScriptStep{Line: n, Sleep: d})
+		return nil
+
+	case "expect":
+		var last *ScriptStep
+		if len(*steps) > 0 {
+			last = &(*steps)[len(*steps)-1]
+		}
+		if last == nil || last.Request == nil {
+			return fmt.Errorf("expect does not follow a command")
+		}
+		if len(f) < 3 {
+			return fmt.Errorf("expect takes cc or data and bytes")
+		}
+		switch f[1] {
+		case "cc":
+			b, err := parseScriptBytes(f[2:])
+			if err != nil {
+				return err
+			}
+			for _, c := range b {
+				last.Completions = append(last.Completions, CompletionCode(c))
+			}
+		case "data":
+			if last.Response != nil {
+				return fmt.Errorf("command already has an expect data")
+			}
+			last.Response, last.Mask = []byte{}, []byte{}
+			for _, a := range f[2:] {
+				if a == "*" {
+					last.Response = append(last.Response, 0)
+					last.Mask = append(last.Mask, 0)
+					continue
+				}
+				b, err := parseScriptBytes([]string{a})
+				if err != nil {
+					return err
+				}
+				last.Response = append(last.Response, b[0])
+				last.Mask = append(last.Mask, 0xFF)
+			}
+		default:
+			return fmt.Errorf("expect takes cc or data, not %q", f[1])
+		}
+		return nil
+
+	case "raw":
+		f = f[1:]
+	default:
+		if _, err := strconv.ParseUint(f[0], 0, 8); err != nil {
+			return fmt.Errorf("unsupported command %q, only raw commands run", f[0])
+		}
+	}
+	b, err := parseScriptBytes(f)
+	if err != nil {
+		return err
+	}
+	if len(b) < 2 {
+		return fmt.Errorf("a command needs a netfn and a cmd")
+	}
+	*steps = append(*steps, ScriptStep{Line: n, Request: b})
+	return nil
+}
+
+func parseScriptBytes(f []string) ([]byte, error) {
+	var b []byte
+	for _, a := range f {
+		v, err := strconv.ParseUint(a, 0, 8)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a byte", a)
+		}
+		b = append(b, byte(v))
+	}
+	return b, nil
+}
+
+func (s *ScriptStep) completes(cc CompletionCode) bool {
+	if len(s.Completions) == 0 {
+		return cc == CompletionOK
+	}
+	for _, c := range s.Completions {
+		if c == cc {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *ScriptStep) matches(data []byte) bool {
+	if len(data) < len(s.Response) {
+		return false
+	}
+	for i, b := range s.Response {
+		if (data[i]^b)&s.Mask[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// RunScript sends the commands of steps in turn to the controller at a,
+// writing the data of each response to w as ipmitool's raw prints it. It
+// stops at the first command that fails or answers other than expected.
+func (i *IPMI) RunScript(a Addr, steps []ScriptStep, w io.Writer) error {
+	for _, s := range steps {
+		if s.Sleep > 0 {
+			time.Sleep(s.Sleep)
+			continue
+		}
+		resp, err := i.RawCmdTo(a, s.Request)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", s.Line, err)
+		}
+		if len(resp) == 0 {
+			return fmt.Errorf("line %d: empty response", s.Line)
+		}
+		cc, data := CompletionCode(resp[0]), resp[1:]
+		if !s.completes(cc) {
+			return fmt.Errorf("line %d: %w", s.Line, &CompletionError{
+				Op:    fmt.Sprintf("raw % #x", s.Request),
+				NetFn: s.Request[0],
+				Cmd:   s.Request[1],
+				Code:  cc,
+			})
+		}
+		if _, err := w.Write(formatRaw(data)); err != nil {
+			return err
+		}
+		if s.Response != nil && !s.matches(data) {
+			return fmt.Errorf("line %d: response % #x is not the expected data", s.Line, data)
+		}
+	}
+	return nil
+}
+
+// formatRaw formats data as ipmitool's raw prints it, 16 bytes a line.
+func formatRaw(data []byte) []byte {
+	var b bytes.Buffer
+	for i, x := range data {
+		if i > 0 && i%16 == 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, " %02x", x)
+	}
+	if len(data) > 0 {
+		b.WriteString("\n")
+	}
+	return b.Bytes()
+}
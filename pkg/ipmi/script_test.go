@@ -0,0 +1,100 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseScript(t *testing.T) {
+	script := `# Set up the BMC.
+raw 0x06 0x01
+expect data 0x20 * 0x02   # device 0x20, IPMI 2.0
+
+0x30 0x70 0x0c 0 1
+expect cc 0 0xc1
+sleep 10ms
+raw 0x06 0x02
+`
+	got, err := ParseScript(strings.NewReader(script))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ScriptStep{
+		{Line: 2, Request: []byte{0x06, 0x01}, Response: []byte{0x20, 0, 0x02}, Mask: []byte{0xFF, 0, 0xFF}},
+		{Line: 5, Request: []byte{0x30, 0x70, 0x0c, 0, 1}, Completions: []CompletionCode{CompletionOK, CompletionInvalidCommand}},
+		{Line: 7, Sleep: 10 * time.Millisecond},
+		{Line: 8, Request: []byte{0x06, 0x02}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseScript = %+v, want %+v", got, want)
+	}
+
+	for _, tt := range []struct {
+		script string
+		err    string
+	}{
+		{"raw 0x06", "line 1: a command needs a netfn and a cmd"},
+		{"raw 0x06 0x100", `line 1: "0x100" is not a byte`},
+		{"lan set 1 ipsrc dhcp", `line 1: unsupported command "lan", only raw commands run`},
+		{"expect cc 0", "line 1: expect does not follow a command"},
+		{"sleep 1s\nexpect cc 0", "line 2: expect does not follow a command"},
+		{"raw 6 1\nexpect data 1\nexpect data 2", "line 3: command already has an expect data"},
+		{"raw 6 1\nexpect ok", "line 2: expect takes cc or data and bytes"},
+		{"sleep -1s", "line 1: sleep duration -1s is not positive"},
+	} {
+		if _, err := ParseScript(strings.NewReader(tt.script)); err == nil || err.Error() != tt.err {
+			t.Errorf("ParseScript(%q) = %v, want %s", tt.script, err, tt.err)
+		}
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	f := &fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_APP, _BMC_GET_DEVICE_ID}: {0, 0x20, 0x81, 0x02, 0x10, 0x02, 0xBF, 0x57, 0x01, 0x00, 0x34, 0x12, 0, 0, 0, 0, 0, 0},
+		{0x30, 0x70}:                          {0},
+	}}
+	i := &IPMI{Transport: f}
+
+	for _, tt := range []struct {
+		script string
+		out    string
+		err    string
+	}{
+		{
+			script: "raw 6 1\nexpect data 0x20 * 2\n0x30 0x70 0x0c\nraw 0x30 0x71\nexpect cc 0xc1 0xcc",
+			out:    " 20 81 02 10 02 bf 57 01 00 34 12 00 00 00 00 00\n 00\n",
+		},
+		{
+			script: "raw 0x30 0x71\nraw 6 1",
+			err:    "line 1: raw 0x30 0x71: completion code 0xc1 (invalid command)",
+		},
+		{
+			script: "raw 6 1\nexpect data 0x20 0x80\nraw 6 1",
+			out:    " 20 81 02 10 02 bf 57 01 00 34 12 00 00 00 00 00\n 00\n",
+			err:    "line 1: response 0x20 0x81 0x02 0x10 0x02 0xbf 0x57 0x01 0x00 0x34 0x12 0x00 0x00 0x00 0x00 0x00 0x00 is not the expected data",
+		},
+	} {
+		steps, err := ParseScript(strings.NewReader(tt.script))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out bytes.Buffer
+		err = i.RunScript(Addr{}, steps, &out)
+		if (err == nil && tt.err != "") || (err != nil && err.Error() != tt.err) {
+			t.Errorf("RunScript(%q) = %v, want %q", tt.script, err, tt.err)
+		}
+		if out.String() != tt.out {
+			t.Errorf("RunScript(%q) wrote %q, want %q", tt.script, out.String(), tt.out)
+		}
+	}
+	if cc, ok := Completion(i.RunScript(Addr{}, []ScriptStep{{Request: []byte{0x30, 0x71}}}, &bytes.Buffer{})); !ok || cc != CompletionInvalidCommand {
+		t.Errorf("Completion(RunScript) = %v, %t, want %v", cc, ok, CompletionInvalidCommand)
+	}
+}
@@ -0,0 +1,397 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"sync"
+	"unsafe"
+)
+
+const (
+	// SDRFirstRecord is the record ID that names the first SDR.
+	SDRFirstRecord = 0x0000
+	// SDRLastRecord is returned as the next ID after the last SDR.
+	SDRLastRecord = 0xFFFF
+
+	sdrHeaderSize = 5
+
+	// Not all interfaces can carry a whole record in one response, so
+	// records are read in pieces of at most this many bytes.
+	sdrMaxRead = 16
+)
+
+// SDRType is the type of a Sensor Data Record, IPMI v2.0 section 43.
+type SDRType byte
+
+// SDR record types.
+const (
+	SDRFullSensor          SDRType = 0x01
+	SDRCompactSensor       SDRType = 0x02
+	SDREventOnlySensor     SDRType = 0x03
+	SDREntityAssociation   SDRType = 0x08
+	SDRDeviceRelativeAssoc SDRType = 0x09
+	SDRGenericLocator      SDRType = 0x10
+	SDRFRULocator          SDRType = 0x11
+	SDRMCLocator           SDRType = 0x12
+	SDRMCConfirmation      SDRType = 0x13
+	SDRBMCMessageChannel   SDRType = 0x14
+	SDROEM                 SDRType = 0xC0
+)
+
+// SDRRepoInfo is the response to Get SDR Repository Info.
+type SDRRepoInfo struct {
+	Version     byte
+	Records     uint16
+	FreeSpace   uint16
+	LastAddTime uint32
+	LastDelTime uint32
+	OpSupport   byte
+}
+
+// SDR is a raw Sensor Data Record.
+type SDR struct {
+	RecordID uint16
+	Version  byte
+	Type     SDRType
+	// Body is the record after the 5 byte header.
+	Body []byte
+}
+
+// GetSDRRepoInfo reads the SDR repository's size and modification times.
+func (i *IPMI) GetSDRRepoInfo() (*SDRRepoInfo, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_STORAGE
+	req.msg.cmd = _BMC_GET_SDR_REPO_INFO
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.completion("GetSDRRepoInfo", recv); err != nil {
+		return nil, err
+	}
+
+	var info SDRRepoInfo
+	if err := binary.Read(bytes.NewReader(recv[1:]), binary.LittleEndian, &info); err != nil {
+		return nil, fmt.Errorf("GetSDRRepoInfo: short response of %d bytes", len(recv))
+	}
+	return &info, nil
+}
+
+// ReserveSDRRepo reserves the SDR repository. Partial reads need a
+// reservation, which the BMC cancels when the repository changes.
+func (i *IPMI) ReserveSDRRepo() (uint16, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_STORAGE
+	req.msg.cmd = _BMC_RESERVE_SDR_REPO
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return 0, err
+	}
+	if err := req.completion("ReserveSDRRepo", recv); err != nil {
+		return 0, err
+	}
+	if len(recv) < 3 {
+		return 0, fmt.Errorf("ReserveSDRRepo: short response of %d bytes", len(recv))
+	}
+	return binary.LittleEndian.Uint16(recv[1:3]), nil
+}
+
+// getSDRPart reads n bytes at off of record id.
+func (i *IPMI) getSDRPart(reservation, id uint16, off, n byte) (uint16, []byte, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_STORAGE
+	req.msg.cmd = _BMC_GET_SDR
+
+	var data [6]byte
+	binary.LittleEndian.PutUint16(data[0:2], reservation)
+	binary.LittleEndian.PutUint16(data[2:4], id)
+	data[4] = off
+	data[5] = n
+	req.msg.data = unsafe.Pointer(&data[0])
+	req.msg.dataLen = 6
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := req.completion(fmt.Sprintf("GetSDR(%#04x)", id), recv); err != nil {
+		return 0, nil, err
+	}
+	if len(recv) < 3+int(n) {
+		return 0, nil, fmt.Errorf("GetSDR(%#04x): short response of %d bytes", id, len(recv))
+	}
+	return binary.LittleEndian.Uint16(recv[1:3]), recv[3 : 3+int(n)], nil
+}
+
+// GetSDR reads the whole record with the given ID. It returns the record and
+// the ID of the next one, which is SDRLastRecord after the last record.
+//
+// The record is read in pieces under a reservation, which is renewed if the
+// BMC cancels it.
+func (i *IPMI) GetSDR(id uint16) (*SDR, uint16, error) {
+	for tries := 0; tries < 3; tries++ {
+		sdr, next, err := i.getSDR(id)
+		if isCompletion(err, CompletionReservationCanceled) {
+			continue
+		}
+		return sdr, next, err
+	}
+	return nil, 0, fmt.Errorf("GetSDR(%#04x): reservation keeps being canceled", id)
+}
+
+func (i *IPMI) getSDR(id uint16) (*SDR, uint16, error) {
+	reservation, err := i.ReserveSDRRepo()
+	if err != nil {
+		return nil, 0, err
+	}
+	next, hdr, err := i.getSDRPart(reservation, id, 0, sdrHeaderSize)
+	if err != nil {
+		return nil, 0, err
+	}
+	sdr := &SDR{
+		RecordID: binary.LittleEndian.Uint16(hdr[0:2]),
+		Version:  hdr[2],
+		Type:     SDRType(hdr[3]),
+	}
+	length := int(hdr[4])
+	body := make([]byte, 0, length)
+	for chunk := sdrMaxRead; len(body) < length; {
+		n := length - len(body)
+		if n > chunk {
+			n = chunk
+		}
+		_, b, err := i.getSDRPart(reservation, id, byte(sdrHeaderSize+len(body)), byte(n))
+		// Some BMCs take less than they say; try smaller pieces.
+		if isCompletion(err, CompletionCannotReturnLength) && chunk > 1 {
+			chunk /= 2
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		body = append(body, b...)
+	}
+	sdr.Body = body
+	return sdr, next, nil
+}
+
+// Offsets in the record body, i.e. after the header, IPMI v2.0 section 43.
+const (
+	sdrSensorNumber  = 2
+	sdrFullUnits1    = 15
+	sdrFullLinear    = 18
+	sdrFullM         = 19
+	sdrFullB         = 21
+	sdrFullExponents = 24
+	sdrFullID        = 42
+	sdrCompactID     = 26
+	sdrEventOnlyID   = 11
+	sdrLocatorID     = 10
+)
+
+// SensorNumber returns the sensor number of a sensor record.
+func (s *SDR) SensorNumber() (byte, bool) {
+	switch s.Type {
+	case SDRFullSensor, SDRCompactSensor, SDREventOnlySensor:
+		if len(s.Body) > sdrSensorNumber {
+			return s.Body[sdrSensorNumber], true
+		}
+	}
+	return 0, false
+}
+
+// Name returns the ID string of sensor and device locator records, or "".
+func (s *SDR) Name() string {
+	var off int
+	switch s.Type {
+	case SDRFullSensor:
+		off = sdrFullID
+	case SDRCompactSensor:
+		off = sdrCompactID
+	case SDREventOnlySensor:
+		off = sdrEventOnlyID
+	case SDRFRULocator, SDRMCLocator:
+		off = sdrLocatorID
+	default:
+		return ""
+	}
+	if len(s.Body) <= off {
+		return ""
+	}
+	return decodeIDString(s.Body[off], s.Body[off+1:])
+}
+
+// decodeIDString decodes an ID string from its type/length byte tl.
+func decodeIDString(tl byte, b []byte) string {
+	n := int(tl & 0x1F)
+	if n > len(b) {
+		n = len(b)
+	}
+	return decodeField(tl>>6, b[:n])
+}
+
+// bcdPlus are the characters of BCD plus encoded strings.
+const bcdPlus = "0123456789 -.???"
+
+// decodeField decodes a string of the type in the top two bits of a
+// type/length byte, as used by SDR ID strings and FRU fields.
+func decodeField(typ byte, b []byte) string {
+	switch typ {
+	case 1:
+		s := make([]byte, 0, 2*len(b))
+		for _, c := range b {
+			s = append(s, bcdPlus[c>>4], bcdPlus[c&0xF])
+		}
+		return strings.TrimRight(string(s), " ")
+	case 2:
+		// 6-bit packed ASCII, least significant bits first.
+		var s []byte
+		var acc uint32
+		var bits uint
+		for _, c := range b {
+			acc |= uint32(c) << bits
+			for bits += 8; bits >= 6; bits -= 6 {
+				s = append(s, byte(acc&0x3F)+0x20)
+				acc >>= 6
+			}
+		}
+		return strings.TrimRight(string(s), " ")
+	case 3:
+		return strings.TrimRight(string(b), "\x00 ")
+	}
+	// Binary, and Unicode in SDRs, are shown as hex.
+	return fmt.Sprintf("%x", b)
+}
+
+// signExtend sign extends the low bits bits of v.
+func signExtend(v uint16, bits uint) int16 {
+	shift := 16 - bits
+	return int16(v<<shift) >> shift
+}
+
+// Conversion returns the reading conversion factors of a full sensor record.
+func (s *SDR) Conversion() (SensorConversion, bool) {
+	if s.Type != SDRFullSensor || len(s.Body) <= sdrFullExponents {
+		return SensorConversion{}, false
+	}
+	b := s.Body
+	return SensorConversion{
+		M:             signExtend(uint16(b[sdrFullM])|uint16(b[sdrFullM+1]&0xC0)<<2, 10),
+		B:             signExtend(uint16(b[sdrFullB])|uint16(b[sdrFullB+1]&0xC0)<<2, 10),
+		RExp:          int8(signExtend(uint16(b[sdrFullExponents]>>4), 4)),
+		BExp:          int8(signExtend(uint16(b[sdrFullExponents]&0xF), 4)),
+		Format:        AnalogFormat(b[sdrFullUnits1] >> 6),
+		Linearization: Linearization(b[sdrFullLinear] & 0x7F),
+	}, true
+}
+
+// SDRSource reads SDRs, such as an *IPMI.
+type SDRSource interface {
+	GetSDRRepoInfo() (*SDRRepoInfo, error)
+	GetSDR(id uint16) (*SDR, uint16, error)
+}
+
+// SDRCache keeps the SDR repository in memory, keyed by record ID. It is
+// reread whenever the repository's modification times change.
+type SDRCache struct {
+	src SDRSource
+
+	mu      sync.Mutex
+	info    SDRRepoInfo
+	records []*SDR
+	byID    map[uint16]*SDR
+}
+
+// NewSDRCache returns an empty cache of src's repository.
+func NewSDRCache(src SDRSource) *SDRCache {
+	return &SDRCache{src: src}
+}
+
+// refresh rereads the repository if it has changed. c.mu must be held.
+func (c *SDRCache) refresh() error {
+	info, err := c.src.GetSDRRepoInfo()
+	if err != nil {
+		return err
+	}
+	if c.byID != nil && info.LastAddTime == c.info.LastAddTime && info.LastDelTime == c.info.LastDelTime {
+		return nil
+	}
+
+	var records []*SDR
+	byID := make(map[uint16]*SDR)
+	for id := uint16(SDRFirstRecord); id != SDRLastRecord; {
+		sdr, next, err := c.src.GetSDR(id)
+		if err != nil {
+			return err
+		}
+		// A broken repository must not loop forever.
+		if _, ok := byID[sdr.RecordID]; ok {
+			return fmt.Errorf("SDR %#04x is listed twice", sdr.RecordID)
+		}
+		records = append(records, sdr)
+		byID[sdr.RecordID] = sdr
+		id = next
+	}
+	c.info, c.records, c.byID = *info, records, byID
+	return nil
+}
+
+// Records returns all records in repository order.
+func (c *SDRCache) Records() ([]*SDR, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+	return c.records, nil
+}
+
+// Get returns the record with the given ID.
+func (c *SDRCache) Get(id uint16) (*SDR, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+	sdr, ok := c.byID[id]
+	if !ok {
+		return nil, fmt.Errorf("no SDR %#04x", id)
+	}
+	return sdr, nil
+}
+
+// Sensor returns the record of the sensor with the given number.
+func (c *SDRCache) Sensor(num byte) (*SDR, error) {
+	records, err := c.Records()
+	if err != nil {
+		return nil, err
+	}
+	for _, sdr := range records {
+		if n, ok := sdr.SensorNumber(); ok && n == num {
+			return sdr, nil
+		}
+	}
+	return nil, fmt.Errorf("no SDR for sensor %#02x", num)
+}
+
+// SensorByName returns the record of the sensor with the given ID string.
+func (c *SDRCache) SensorByName(name string) (*SDR, error) {
+	records, err := c.Records()
+	if err != nil {
+		return nil, err
+	}
+	for _, sdr := range records {
+		if _, ok := sdr.SensorNumber(); ok && sdr.Name() == name {
+			return sdr, nil
+		}
+	}
+	return nil, fmt.Errorf("no SDR for sensor %q", name)
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// fullSensor returns a full sensor record body.
+func fullSensor(num byte, name string) []byte {
+	b := make([]byte, sdrFullID+1+len(name))
+	b[sdrSensorNumber] = num
+	b[sdrFullUnits1] = 0x80 // 2's complement
+	b[sdrFullLinear] = byte(LinearLinear)
+	b[sdrFullM], b[sdrFullM+1] = 0xFE, 0xC0 // M = -2
+	b[sdrFullB], b[sdrFullB+1] = 0x05, 0x00 // B = 5
+	b[sdrFullExponents] = 0xF1              // RExp = -1, BExp = 1
+	b[sdrFullID] = 0xC0 | byte(len(name))
+	copy(b[sdrFullID+1:], name)
+	return b
+}
+
+func TestSDRFullSensor(t *testing.T) {
+	s := &SDR{Type: SDRFullSensor, Body: fullSensor(0x30, "CPU Temp")}
+	if n, ok := s.SensorNumber(); n != 0x30 || !ok {
+		t.Errorf("SensorNumber() = %#02x, %t, want 0x30, true", n, ok)
+	}
+	if got := s.Name(); got != "CPU Temp" {
+		t.Errorf("Name() = %q, want %q", got, "CPU Temp")
+	}
+	want := SensorConversion{M: -2, B: 5, RExp: -1, BExp: 1, Format: AnalogTwosComplement}
+	got, ok := s.Conversion()
+	if !ok || got != want {
+		t.Errorf("Conversion() = %+v, %t, want %+v, true", got, ok, want)
+	}
+	// (-2*-10 + 5*10) / 10
+	if v := got.Value(0xF6); v != 7 {
+		t.Errorf("Value(0xf6) = %v, want 7", v)
+	}
+}
+
+func TestSDRName(t *testing.T) {
+	for _, tt := range []struct {
+		sdr  SDR
+		want string
+	}{
+		{SDR{Type: SDRCompactSensor, Body: append(make([]byte, sdrCompactID), 0xC4, 'F', 'A', 'N', '1')}, "FAN1"},
+		{SDR{Type: SDREventOnlySensor, Body: append(make([]byte, sdrEventOnlyID), 0xC5, 'P', 'S', 0, 0, 0)}, "PS"},
+		{SDR{Type: SDRFRULocator, Body: append(make([]byte, sdrLocatorID), 0x83, 0xA1, 0x38, 0x92)}, "ABCD"},
+		{SDR{Type: SDRMCLocator, Body: append(make([]byte, sdrLocatorID), 0xC8, 'B', 'M', 'C')}, "BMC"},
+		{SDR{Type: SDREntityAssociation, Body: make([]byte, 16)}, ""},
+		{SDR{Type: SDRFullSensor, Body: make([]byte, 4)}, ""},
+	} {
+		if got := tt.sdr.Name(); got != tt.want {
+			t.Errorf("SDR type %#02x Name() = %q, want %q", tt.sdr.Type, got, tt.want)
+		}
+	}
+}
+
+type fakeSDRSource struct {
+	info    SDRRepoInfo
+	records map[uint16]*SDR
+	next    map[uint16]uint16
+	reads   int
+}
+
+func (f *fakeSDRSource) GetSDRRepoInfo() (*SDRRepoInfo, error) {
+	info := f.info
+	return &info, nil
+}
+
+func (f *fakeSDRSource) GetSDR(id uint16) (*SDR, uint16, error) {
+	f.reads++
+	sdr, ok := f.records[id]
+	if !ok {
+		return nil, 0, fmt.Errorf("no record %#04x", id)
+	}
+	return sdr, f.next[id], nil
+}
+
+func TestSDRCache(t *testing.T) {
+	cpu := &SDR{RecordID: 0x10, Type: SDRFullSensor, Body: fullSensor(0x30, "CPU Temp")}
+	fan := &SDR{RecordID: 0x20, Type: SDRCompactSensor, Body: append(make([]byte, sdrCompactID), 0xC4, 'F', 'A', 'N', '1')}
+	fru := &SDR{RecordID: 0x30, Type: SDRFRULocator, Body: append(make([]byte, sdrLocatorID), 0xC3, 'F', 'R', 'U')}
+	fan.Body[sdrSensorNumber] = 0x40
+	src := &fakeSDRSource{
+		// Record 0 names the first record, whatever its ID.
+		records: map[uint16]*SDR{0: cpu, 0x20: fan, 0x30: fru},
+		next:    map[uint16]uint16{0: 0x20, 0x20: 0x30, 0x30: SDRLastRecord},
+	}
+	c := NewSDRCache(src)
+
+	records, err := c.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []*SDR{cpu, fan, fru}; !reflect.DeepEqual(records, want) {
+		t.Errorf("Records() = %v, want %v", records, want)
+	}
+	if got, err := c.Get(0x10); err != nil || got != cpu {
+		t.Errorf("Get(0x10) = %v, %v, want %v", got, err, cpu)
+	}
+	if _, err := c.Get(0x11); err == nil {
+		t.Errorf("Get(0x11) = nil error, want error")
+	}
+	if got, err := c.Sensor(0x40); err != nil || got != fan {
+		t.Errorf("Sensor(0x40) = %v, %v, want %v", got, err, fan)
+	}
+	if got, err := c.SensorByName("CPU Temp"); err != nil || got != cpu {
+		t.Errorf("SensorByName(CPU Temp) = %v, %v, want %v", got, err, cpu)
+	}
+	// FRU locators are not sensors.
+	if _, err := c.SensorByName("FRU"); err == nil {
+		t.Errorf("SensorByName(FRU) = nil error, want error")
+	}
+	if src.reads != 3 {
+		t.Errorf("repository read %d records, want 3 from the cache", src.reads)
+	}
+
+	src.info.LastAddTime++
+	if _, err := c.Records(); err != nil {
+		t.Fatal(err)
+	}
+	if src.reads != 6 {
+		t.Errorf("repository read %d records, want 6 after it changed", src.reads)
+	}
+
+	src.info.LastDelTime++
+	src.next[0x30] = 0x20
+	if _, err := c.Records(); err == nil {
+		t.Errorf("Records() of a looping repository = nil error, want error")
+	}
+}
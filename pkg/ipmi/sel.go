@@ -0,0 +1,435 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+	"unsafe"
+)
+
+const (
+	// SELFirstEntry is the record ID that names the first SEL entry.
+	SELFirstEntry = 0x0000
+	// SELLastEntry is the record ID that names the last SEL entry. It is
+	// also returned as the next ID after the last entry.
+	SELLastEntry = 0xFFFF
+
+	// SELPreInitTime is the largest SEL timestamp that counts seconds
+	// since BMC initialization rather than since the epoch.
+	SELPreInitTime = 0x20000000
+
+	selRecordSize = 16
+)
+
+// unmarshalEvent decodes a 16 byte SEL record. The record type decides
+// which of the embedded event structs is filled in.
+func unmarshalEvent(b []byte) (*Event, error) {
+	if len(b) < selRecordSize {
+		return nil, fmt.Errorf("SEL record is %d bytes, want %d", len(b), selRecordSize)
+	}
+	e := &Event{
+		RecordID:   binary.LittleEndian.Uint16(b[0:2]),
+		RecordType: b[2],
+	}
+	r := bytes.NewReader(b[3:selRecordSize])
+	var err error
+	switch {
+	case e.RecordType >= 0xE0:
+		err = binary.Read(r, binary.LittleEndian, &e.OEMNontsEvent)
+	case e.RecordType >= 0xC0:
+		err = binary.Read(r, binary.LittleEndian, &e.OEMTsEvent)
+	default:
+		err = binary.Read(r, binary.LittleEndian, &e.StandardEvent)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// ReserveSEL reserves the SEL. Partial reads need a reservation, which the
+// BMC cancels when the SEL changes.
+func (i *IPMI) ReserveSEL() (uint16, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_STORAGE
+	req.msg.cmd = _BMC_RESERVE_SEL
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return 0, err
+	}
+	if err := req.completion("ReserveSEL", recv); err != nil {
+		return 0, err
+	}
+	if len(recv) < 3 {
+		return 0, fmt.Errorf("ReserveSEL: short response of %d bytes", len(recv))
+	}
+	return binary.LittleEndian.Uint16(recv[1:3]), nil
+}
+
+// getSELPart reads n bytes at off of record id, or the whole record if n is
+// 0xFF.
+func (i *IPMI) getSELPart(reservation, id uint16, off, n byte) (uint16, []byte, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_STORAGE
+	req.msg.cmd = _BMC_GET_SEL_ENTRY
+
+	var data [6]byte
+	binary.LittleEndian.PutUint16(data[0:2], reservation)
+	binary.LittleEndian.PutUint16(data[2:4], id)
+	data[4] = off
+	data[5] = n
+	req.msg.data = unsafe.Pointer(&data[0])
+	req.msg.dataLen = 6
+
+	want := int(n)
+	if n == 0xFF {
+		want = selRecordSize
+	}
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	if err := req.completion(fmt.Sprintf("GetSELEntry(%#04x)", id), recv); err != nil {
+		return 0, nil, err
+	}
+	if len(recv) < 3+want {
+		return 0, nil, fmt.Errorf("GetSELEntry(%#04x): short response of %d bytes", id, len(recv))
+	}
+	return binary.LittleEndian.Uint16(recv[1:3]), recv[3 : 3+want], nil
+}
+
+// GetSELEntry reads the whole SEL record with the given ID. It returns the
+// record and the ID of the next one, which is SELLastEntry after the last
+// record.
+//
+// The record is read in one go if the BMC allows, and otherwise in pieces
+// under a reservation, which is renewed if the BMC cancels it.
+func (i *IPMI) GetSELEntry(id uint16) (*Event, uint16, error) {
+	// A reservation is only needed for partial reads.
+	next, b, err := i.getSELPart(0, id, 0, 0xFF)
+	if tooLarge(err) {
+		next, b, err = i.getSELEntryInParts(id)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	e, err := unmarshalEvent(b)
+	if err != nil {
+		return nil, 0, err
+	}
+	return e, next, nil
+}
+
+func (i *IPMI) getSELEntryInParts(id uint16) (uint16, []byte, error) {
+	for tries := 0; tries < 3; tries++ {
+		next, b, err := i.getSELParts(id)
+		if isCompletion(err, CompletionReservationCanceled) {
+			continue
+		}
+		return next, b, err
+	}
+	return 0, nil, fmt.Errorf("GetSELEntry(%#04x): reservation keeps being canceled", id)
+}
+
+func (i *IPMI) getSELParts(id uint16) (uint16, []byte, error) {
+	reservation, err := i.ReserveSEL()
+	if err != nil {
+		return 0, nil, err
+	}
+	var next uint16
+	b := make([]byte, 0, selRecordSize)
+	for chunk := selRecordSize / 2; len(b) < selRecordSize; {
+		n := selRecordSize - len(b)
+		if n > chunk {
+			n = chunk
+		}
+		nx, part, err := i.getSELPart(reservation, id, byte(len(b)), byte(n))
+		// Some BMCs take less than they say; try smaller pieces.
+		if isCompletion(err, CompletionCannotReturnLength) && chunk > 1 {
+			chunk /= 2
+			continue
+		}
+		if err != nil {
+			return 0, nil, err
+		}
+		next = nx
+		b = append(b, part...)
+	}
+	return next, b, nil
+}
+
+// Clear SEL operations and erasure states, IPMI v2.0 section 31.9.
+const (
+	selClearInitiate  = 0xAA
+	selClearGetStatus = 0x00
+
+	selErasureCompleted = 0x01
+)
+
+// selClearPoll is how often ClearSEL asks whether erasure is done.
+var selClearPoll = 100 * time.Millisecond
+
+// clearSEL sends a Clear SEL request of op under reservation and returns
+// the erasure progress.
+func (i *IPMI) clearSEL(reservation uint16, op byte) (byte, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_STORAGE
+	req.msg.cmd = _BMC_CLEAR_SEL
+
+	var data [6]byte
+	binary.LittleEndian.PutUint16(data[0:2], reservation)
+	copy(data[2:5], "CLR")
+	data[5] = op
+	req.msg.data = unsafe.Pointer(&data[0])
+	req.msg.dataLen = 6
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return 0, err
+	}
+	if err := req.completion("ClearSEL", recv); err != nil {
+		return 0, err
+	}
+	if len(recv) < 2 {
+		return 0, fmt.Errorf("ClearSEL: short response of %d bytes", len(recv))
+	}
+	return recv[1] & 0x0F, nil
+}
+
+// ClearSEL erases all SEL entries and waits up to timeout for the BMC to
+// finish.
+func (i *IPMI) ClearSEL(timeout time.Duration) error {
+	reservation, err := i.ReserveSEL()
+	if err != nil {
+		return err
+	}
+	progress, err := i.clearSEL(reservation, selClearInitiate)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(timeout)
+	for progress != selErasureCompleted {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("ClearSEL: erasure did not complete in %v", timeout)
+		}
+		time.Sleep(selClearPoll)
+		if progress, err = i.clearSEL(reservation, selClearGetStatus); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SELReader reads the SEL, such as an *IPMI.
+type SELReader interface {
+	GetSELInfo() (*SELInfo, error)
+	GetSELEntry(id uint16) (*Event, uint16, error)
+}
+
+// SELIterator walks the SEL from the first entry to the last. It is used
+// like a bufio.Scanner:
+//
+//	it := i.SELEntries()
+//	for it.Next() {
+//		e := it.Event()
+//		...
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type SELIterator struct {
+	r       SELReader
+	started bool
+	next    uint16
+	seen    map[uint16]bool
+	e       *Event
+	err     error
+}
+
+// NewSELIterator returns an iterator over r's SEL.
+func NewSELIterator(r SELReader) *SELIterator {
+	return &SELIterator{r: r, next: SELFirstEntry, seen: make(map[uint16]bool)}
+}
+
+// SELEntries returns an iterator over the SEL.
+func (i *IPMI) SELEntries() *SELIterator {
+	return NewSELIterator(i)
+}
+
+// Next reads the next entry, returning false at the end of the SEL or on
+// an error.
+func (it *SELIterator) Next() bool {
+	it.e = nil
+	if it.err != nil {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		// Asking an empty SEL for its first entry is an error.
+		info, err := it.r.GetSELInfo()
+		if err != nil {
+			it.err = err
+			return false
+		}
+		if info.Entries == 0 {
+			it.next = SELLastEntry
+		}
+	}
+	if it.next == SELLastEntry {
+		return false
+	}
+	e, next, err := it.r.GetSELEntry(it.next)
+	if err != nil {
+		it.err = err
+		return false
+	}
+	// A broken SEL must not loop forever.
+	if it.seen[e.RecordID] {
+		it.err = fmt.Errorf("SEL entry %#04x is listed twice", e.RecordID)
+		return false
+	}
+	it.seen[e.RecordID] = true
+	it.e, it.next = e, next
+	return true
+}
+
+// Event returns the entry read by the last call to Next.
+func (it *SELIterator) Event() *Event {
+	return it.e
+}
+
+// Err returns the error that stopped the iteration, if any.
+func (it *SELIterator) Err() error {
+	return it.err
+}
+
+// GetSELTime reads the SEL clock, which timestamps new SEL entries.
+func (i *IPMI) GetSELTime() (time.Time, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_STORAGE
+	req.msg.cmd = _BMC_GET_SEL_TIME
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := req.completion("GetSELTime", recv); err != nil {
+		return time.Time{}, err
+	}
+	if len(recv) < 5 {
+		return time.Time{}, fmt.Errorf("GetSELTime: short response of %d bytes", len(recv))
+	}
+	return time.Unix(int64(binary.LittleEndian.Uint32(recv[1:5])), 0), nil
+}
+
+// SetSELTime sets the SEL clock to t, truncated to the second.
+func (i *IPMI) SetSELTime(t time.Time) error {
+	if t.Unix() < 0 || t.Unix() > math.MaxUint32 {
+		return fmt.Errorf("SetSELTime: %v is out of range", t)
+	}
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_STORAGE
+	req.msg.cmd = _BMC_SET_SEL_TIME
+
+	var data [4]byte
+	binary.LittleEndian.PutUint32(data[:], uint32(t.Unix()))
+	req.msg.data = unsafe.Pointer(&data[0])
+	req.msg.dataLen = 4
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return err
+	}
+	if err := req.completion("SetSELTime", recv); err != nil {
+		return err
+	}
+	return nil
+}
+
+// selUTCOffsetUnspecified is the UTC offset of a BMC that does not know
+// its time zone.
+const selUTCOffsetUnspecified = 0x07FF
+
+// GetSELTimeUTCOffset returns the offset of the SEL clock from UTC, which
+// tells consumers how to read SEL timestamps. ok is false if the offset
+// is unspecified.
+func (i *IPMI) GetSELTimeUTCOffset() (offset time.Duration, ok bool, err error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_STORAGE
+	req.msg.cmd = _BMC_GET_SEL_TIME_UTC_OFFSET
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return 0, false, err
+	}
+	if err := req.completion("GetSELTimeUTCOffset", recv); err != nil {
+		return 0, false, err
+	}
+	if len(recv) < 3 {
+		return 0, false, fmt.Errorf("GetSELTimeUTCOffset: short response of %d bytes", len(recv))
+	}
+	minutes := int16(binary.LittleEndian.Uint16(recv[1:3]))
+	if minutes == selUTCOffsetUnspecified {
+		return 0, false, nil
+	}
+	return time.Duration(minutes) * time.Minute, true, nil
+}
+
+// SetSELTimeUTCOffset sets the offset of the SEL clock from UTC, in whole
+// minutes of up to 24 hours either way.
+func (i *IPMI) SetSELTimeUTCOffset(offset time.Duration) error {
+	if offset%time.Minute != 0 || offset < -24*time.Hour || offset > 24*time.Hour {
+		return fmt.Errorf("SetSELTimeUTCOffset: %v is not whole minutes within 24h", offset)
+	}
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_STORAGE
+	req.msg.cmd = _BMC_SET_SEL_TIME_UTC_OFFSET
+
+	var data [2]byte
+	binary.LittleEndian.PutUint16(data[:], uint16(int16(offset/time.Minute)))
+	req.msg.data = unsafe.Pointer(&data[0])
+	req.msg.dataLen = 2
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return err
+	}
+	if err := req.completion("SetSELTimeUTCOffset", recv); err != nil {
+		return err
+	}
+	return nil
+}
+
+// SELClock is a clock that can be read and set, such as the SEL clock of
+// an *IPMI.
+type SELClock interface {
+	GetSELTime() (time.Time, error)
+	SetSELTime(t time.Time) error
+}
+
+// SyncSELTime compares c with now and sets c to now if they are more than
+// maxSkew apart. It returns how far c was ahead of now, negative if it was
+// behind.
+//
+// The SEL clock has a resolution of one second, so maxSkew should be at
+// least that. A SEL clock that counts from BMC initialization rather than
+// from the epoch is always set.
+func SyncSELTime(c SELClock, now time.Time, maxSkew time.Duration) (time.Duration, error) {
+	t, err := c.GetSELTime()
+	if err != nil {
+		return 0, err
+	}
+	delta := t.Sub(now.Truncate(time.Second))
+	if t.Unix() > SELPreInitTime && delta <= maxSkew && delta >= -maxSkew {
+		return delta, nil
+	}
+	return delta, c.SetSELTime(now)
+}
@@ -0,0 +1,270 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUnmarshalEvent(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		rec  []byte
+		want Event
+	}{
+		{
+			name: "standard",
+			rec:  []byte{0x34, 0x12, 0x02, 0x78, 0x56, 0x34, 0x12, 0x20, 0x00, 0x04, 0x01, 0x30, 0x01, 0x57, 0xa0, 0xff},
+			want: Event{
+				RecordID:   0x1234,
+				RecordType: 0x02,
+				StandardEvent: StandardEvent{
+					Timestamp:    0x12345678,
+					GenID:        0x0020,
+					EvMRev:       0x04,
+					SensorType:   0x01,
+					SensorNum:    0x30,
+					EventTypeDir: 0x01,
+					EventData:    [3]uint8{0x57, 0xa0, 0xff},
+				},
+			},
+		},
+		{
+			name: "oem timestamped",
+			rec:  []byte{0x01, 0x00, 0xc1, 0x01, 0x00, 0x00, 0x60, 0x0a, 0x40, 0x00, 1, 2, 3, 4, 5, 6},
+			want: Event{
+				RecordID:   1,
+				RecordType: 0xc1,
+				OEMTsEvent: OEMTsEvent{
+					Timestamp:        0x60000001,
+					ManfID:           [3]uint8{0x0a, 0x40, 0x00},
+					OEMTsDefinedData: [6]uint8{1, 2, 3, 4, 5, 6},
+				},
+			},
+		},
+		{
+			name: "oem non-timestamped",
+			rec:  []byte{0x02, 0x00, 0xe0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13},
+			want: Event{
+				RecordID:      2,
+				RecordType:    0xe0,
+				OEMNontsEvent: OEMNontsEvent{[13]uint8{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13}},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unmarshalEvent(tt.rec)
+			if err != nil {
+				t.Fatalf("unmarshalEvent() = %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("unmarshalEvent() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+
+	if _, err := unmarshalEvent(make([]byte, 15)); err == nil {
+		t.Errorf("unmarshalEvent(short) = nil, want error")
+	}
+}
+
+type fakeClock struct {
+	t   time.Time
+	set bool
+}
+
+func (c *fakeClock) GetSELTime() (time.Time, error) { return c.t, nil }
+
+func (c *fakeClock) SetSELTime(t time.Time) error {
+	c.t, c.set = t.Truncate(time.Second), true
+	return nil
+}
+
+func TestSyncSELTime(t *testing.T) {
+	now := time.Unix(1600000000, 500000000)
+	for _, tt := range []struct {
+		name  string
+		sel   time.Time
+		delta time.Duration
+		set   bool
+	}{
+		{name: "in sync", sel: time.Unix(1600000000, 0), delta: 0},
+		{name: "within skew", sel: time.Unix(1600000001, 0), delta: time.Second},
+		{name: "ahead", sel: time.Unix(1600000100, 0), delta: 100 * time.Second, set: true},
+		{name: "behind", sel: time.Unix(1599999000, 0), delta: -1000 * time.Second, set: true},
+		{name: "since BMC init", sel: time.Unix(30, 0), delta: time.Unix(30, 0).Sub(time.Unix(1600000000, 0)), set: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &fakeClock{t: tt.sel}
+			delta, err := SyncSELTime(c, now, 2*time.Second)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if delta != tt.delta {
+				t.Errorf("delta = %v, want %v", delta, tt.delta)
+			}
+			if c.set != tt.set {
+				t.Errorf("SEL time set = %v, want %v", c.set, tt.set)
+			}
+			if c.set && !c.t.Equal(time.Unix(1600000000, 0)) {
+				t.Errorf("SEL time = %v, want %v", c.t, time.Unix(1600000000, 0))
+			}
+		})
+	}
+}
+
+func TestFirmwareProgressEvent(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		e    *Event
+		want []byte
+	}{
+		{
+			name: "standard",
+			e:    FirmwareProgressEvent(ProgressStartingOSBoot),
+			want: []byte{0, 0, 0x02, 0, 0, 0, 0, 0x01, 0x00, 0x04, 0x0F, 0x00, 0x6F, 0xC2, 0x13, 0xFF},
+		},
+		{
+			name: "POST code",
+			e:    POSTCodeEvent(byte(MilestoneNetworkUp)),
+			want: []byte{0, 0, 0x02, 0, 0, 0, 0, 0x01, 0x00, 0x04, 0x0F, 0x00, 0x6F, 0x82, 0xB1, 0xFF},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.e.marshall()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("marshall() = % x, want % x", got, tt.want)
+			}
+		})
+	}
+}
+
+type fakeSELReader struct {
+	entries map[uint16]uint16 // record ID to next ID
+	count   uint16
+}
+
+func (f *fakeSELReader) GetSELInfo() (*SELInfo, error) {
+	return &SELInfo{Entries: f.count}, nil
+}
+
+func (f *fakeSELReader) GetSELEntry(id uint16) (*Event, uint16, error) {
+	if id == SELFirstEntry {
+		id = 1
+	}
+	next, ok := f.entries[id]
+	if !ok {
+		return nil, 0, fmt.Errorf("no SEL entry %#04x", id)
+	}
+	return &Event{RecordID: id}, next, nil
+}
+
+func TestSELIterator(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		r       *fakeSELReader
+		want    []uint16
+		wantErr bool
+	}{
+		{
+			name: "empty",
+			r:    &fakeSELReader{},
+		},
+		{
+			name: "entries",
+			r:    &fakeSELReader{entries: map[uint16]uint16{1: 2, 2: 5, 5: SELLastEntry}, count: 3},
+			want: []uint16{1, 2, 5},
+		},
+		{
+			name:    "loop",
+			r:       &fakeSELReader{entries: map[uint16]uint16{1: 2, 2: 1}, count: 2},
+			want:    []uint16{1, 2},
+			wantErr: true,
+		},
+		{
+			name:    "missing",
+			r:       &fakeSELReader{entries: map[uint16]uint16{1: 3}, count: 2},
+			want:    []uint16{1},
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []uint16
+			it := NewSELIterator(tt.r)
+			for it.Next() {
+				got = append(got, it.Event().RecordID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %v, want %v", got, tt.want)
+			}
+			if (it.Err() != nil) != tt.wantErr {
+				t.Errorf("Err() = %v, want error %v", it.Err(), tt.wantErr)
+			}
+			if it.Next() {
+				t.Errorf("Next() after the end = true")
+			}
+		})
+	}
+}
+
+func TestClearSEL(t *testing.T) {
+	defer func(d time.Duration) { selClearPoll = d }(selClearPoll)
+	selClearPoll = 0
+
+	// The BMC erases the SEL once asked about it pending times.
+	var pending int
+	f := &fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_STORAGE, _BMC_RESERVE_SEL}: {0, 0x34, 0x12},
+	}}
+	f.handle(_IPMI_NETFN_STORAGE, _BMC_CLEAR_SEL, func(data []byte) []byte {
+		if data[5] == selClearGetStatus && pending > 0 {
+			pending--
+		}
+		if pending > 0 {
+			return []byte{0, 0x00}
+		}
+		return []byte{0, selErasureCompleted}
+	})
+	i := &IPMI{Transport: f}
+
+	pending = 2
+	if err := i.ClearSEL(time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	clear := func(op byte) []byte {
+		return []byte{_IPMI_NETFN_STORAGE, _BMC_CLEAR_SEL, 0x34, 0x12, 'C', 'L', 'R', op}
+	}
+	want := [][]byte{
+		{_IPMI_NETFN_STORAGE, _BMC_RESERVE_SEL},
+		clear(selClearInitiate),
+		clear(selClearGetStatus),
+		clear(selClearGetStatus),
+	}
+	if !reflect.DeepEqual(f.requests, want) {
+		t.Errorf("ClearSEL sent %#x, want %#x", f.requests, want)
+	}
+
+	// Erasure that takes too long.
+	pending = 1 << 30
+	if err := i.ClearSEL(0); err == nil || !strings.Contains(err.Error(), "did not complete") {
+		t.Errorf("ClearSEL of a BMC that never finishes = %v, want a timeout", err)
+	}
+
+	// A BMC that refuses, such as for a cancelled reservation.
+	f.handle(_IPMI_NETFN_STORAGE, _BMC_CLEAR_SEL, func([]byte) []byte {
+		return []byte{byte(CompletionReservationCanceled)}
+	})
+	if err := i.ClearSEL(time.Minute); !isCompletion(err, CompletionReservationCanceled) {
+		t.Errorf("ClearSEL = %v, want reservation canceled", err)
+	}
+}
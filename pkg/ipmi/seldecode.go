@@ -0,0 +1,506 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"fmt"
+	"time"
+)
+
+// SensorType is a sensor type code, IPMI v2.0 table 42-3.
+type SensorType byte
+
+// EventReadingType is an event/reading type code, IPMI v2.0 table 42-1.
+// It says how to read the offset in event data 1 of an event.
+type EventReadingType byte
+
+// Event/reading type classes.
+const (
+	EventReadingTypeThreshold      EventReadingType = 0x01
+	EventReadingTypeSensorSpecific EventReadingType = 0x6F
+)
+
+var sensorTypeNames = map[SensorType]string{
+	0x01: "Temperature",
+	0x02: "Voltage",
+	0x03: "Current",
+	0x04: "Fan",
+	0x05: "Physical Security",
+	0x06: "Platform Security",
+	0x07: "Processor",
+	0x08: "Power Supply",
+	0x09: "Power Unit",
+	0x0A: "Cooling Device",
+	0x0B: "Other",
+	0x0C: "Memory",
+	0x0D: "Drive Slot / Bay",
+	0x0E: "POST Memory Resize",
+	0x0F: "System Firmware Progress",
+	0x10: "Event Logging Disabled",
+	0x11: "Watchdog 1",
+	0x12: "System Event",
+	0x13: "Critical Interrupt",
+	0x14: "Button / Switch",
+	0x15: "Module / Board",
+	0x16: "Microcontroller / Coprocessor",
+	0x17: "Add-in Card",
+	0x18: "Chassis",
+	0x19: "Chip Set",
+	0x1A: "Other FRU",
+	0x1B: "Cable / Interconnect",
+	0x1C: "Terminator",
+	0x1D: "System Boot Initiated",
+	0x1E: "Boot Error",
+	0x1F: "OS Boot",
+	0x20: "OS Critical Stop",
+	0x21: "Slot / Connector",
+	0x22: "System ACPI Power State",
+	0x23: "Watchdog 2",
+	0x24: "Platform Alert",
+	0x25: "Entity Presence",
+	0x26: "Monitor ASIC / IC",
+	0x27: "LAN",
+	0x28: "Management Subsystem Health",
+	0x29: "Battery",
+	0x2A: "Session Audit",
+	0x2B: "Version Change",
+	0x2C: "FRU State",
+}
+
+func (t SensorType) String() string {
+	if s, ok := sensorTypeNames[t]; ok {
+		return s
+	}
+	if t >= 0xC0 {
+		return fmt.Sprintf("OEM %#02x", byte(t))
+	}
+	return fmt.Sprintf("Unknown %#02x", byte(t))
+}
+
+func (t EventReadingType) String() string {
+	switch {
+	case t == EventReadingTypeThreshold:
+		return "Threshold"
+	case t >= 0x02 && t <= 0x0C:
+		return "Generic Discrete"
+	case t == EventReadingTypeSensorSpecific:
+		return "Sensor-specific Discrete"
+	case t >= 0x70 && t <= 0x7F:
+		return "OEM Discrete"
+	}
+	return fmt.Sprintf("Unknown %#02x", byte(t))
+}
+
+// genericOffsets are the event offsets of the threshold and generic
+// discrete event/reading types, IPMI v2.0 table 42-2.
+var genericOffsets = map[EventReadingType][]string{
+	0x01: {
+		"Lower Non-critical going low",
+		"Lower Non-critical going high",
+		"Lower Critical going low",
+		"Lower Critical going high",
+		"Lower Non-recoverable going low",
+		"Lower Non-recoverable going high",
+		"Upper Non-critical going low",
+		"Upper Non-critical going high",
+		"Upper Critical going low",
+		"Upper Critical going high",
+		"Upper Non-recoverable going low",
+		"Upper Non-recoverable going high",
+	},
+	0x02: {"Transition to Idle", "Transition to Active", "Transition to Busy"},
+	0x03: {"State Deasserted", "State Asserted"},
+	0x04: {"Predictive Failure deasserted", "Predictive Failure asserted"},
+	0x05: {"Limit Not Exceeded", "Limit Exceeded"},
+	0x06: {"Performance Met", "Performance Lags"},
+	0x07: {
+		"Transition to OK",
+		"Transition to Non-critical from OK",
+		"Transition to Critical from less severe",
+		"Transition to Non-recoverable from less severe",
+		"Transition to Non-critical from more severe",
+		"Transition to Critical from Non-recoverable",
+		"Transition to Non-recoverable",
+		"Monitor",
+		"Informational",
+	},
+	0x08: {"Device Absent", "Device Present"},
+	0x09: {"Device Disabled", "Device Enabled"},
+	0x0A: {
+		"Transition to Running",
+		"Transition to In Test",
+		"Transition to Power Off",
+		"Transition to On Line",
+		"Transition to Off Line",
+		"Transition to Off Duty",
+		"Transition to Degraded",
+		"Transition to Power Save",
+		"Install Error",
+	},
+	0x0B: {
+		"Fully Redundant",
+		"Redundancy Lost",
+		"Redundancy Degraded",
+		"Non-redundant: Sufficient Resources from Redundant",
+		"Non-redundant: Sufficient Resources from Insufficient Resources",
+		"Non-redundant: Insufficient Resources",
+		"Redundancy Degraded from Fully Redundant",
+		"Redundancy Degraded from Non-redundant",
+	},
+	0x0C: {"D0 Power State", "D1 Power State", "D2 Power State", "D3 Power State"},
+}
+
+// sensorSpecificOffsets are the event offsets of sensor-specific events,
+// by sensor type, IPMI v2.0 table 42-3. Reserved offsets are empty.
+var sensorSpecificOffsets = map[SensorType][]string{
+	0x05: {
+		"General Chassis Intrusion",
+		"Drive Bay Intrusion",
+		"I/O Card Area Intrusion",
+		"Processor Area Intrusion",
+		"LAN Leash Lost",
+		"Unauthorized Dock",
+		"Fan Area Intrusion",
+	},
+	0x06: {
+		"Secure Mode Violation Attempt",
+		"Pre-boot Password Violation - user password",
+		"Pre-boot Password Violation - setup password",
+		"Pre-boot Password Violation - network boot password",
+		"Other Pre-boot Password Violation",
+		"Out-of-band Access Password Violation",
+	},
+	0x07: {
+		"IERR",
+		"Thermal Trip",
+		"FRB1/BIST Failure",
+		"FRB2/Hang in POST Failure",
+		"FRB3/Processor Startup/Initialization Failure",
+		"Configuration Error",
+		"SMBIOS Uncorrectable CPU-complex Error",
+		"Presence Detected",
+		"Disabled",
+		"Terminator Presence Detected",
+		"Throttled",
+		"Uncorrectable Machine Check Exception",
+		"Correctable Machine Check Error",
+	},
+	0x08: {
+		"Presence Detected",
+		"Failure Detected",
+		"Predictive Failure",
+		"Power Supply AC Lost",
+		"AC Lost or Out-of-range",
+		"AC Out-of-range, but Present",
+		"Configuration Error",
+		"Power Supply Inactive",
+	},
+	0x09: {
+		"Power Off / Power Down",
+		"Power Cycle",
+		"240VA Power Down",
+		"Interlock Power Down",
+		"AC Lost",
+		"Soft Power Control Failure",
+		"Failure Detected",
+		"Predictive Failure",
+	},
+	0x0C: {
+		"Correctable ECC",
+		"Uncorrectable ECC",
+		"Parity",
+		"Memory Scrub Failed",
+		"Memory Device Disabled",
+		"Correctable ECC Logging Limit Reached",
+		"Presence Detected",
+		"Configuration Error",
+		"Spare",
+		"Throttled",
+		"Critical Overtemperature",
+	},
+	0x0D: {
+		"Drive Present",
+		"Drive Fault",
+		"Predictive Failure",
+		"Hot Spare",
+		"Parity Check In Progress",
+		"In Critical Array",
+		"In Failed Array",
+		"Rebuild In Progress",
+		"Rebuild Aborted",
+	},
+	0x0F: {
+		"System Firmware Error",
+		"System Firmware Hang",
+		"System Firmware Progress",
+	},
+	0x10: {
+		"Correctable Memory Error Logging Disabled",
+		"Event Type Logging Disabled",
+		"Log Area Reset/Cleared",
+		"All Event Logging Disabled",
+		"Log Full",
+		"Log Almost Full",
+		"Correctable Machine Check Error Logging Disabled",
+	},
+	0x11: {
+		"BIOS Reset",
+		"OS Reset",
+		"OS Shut Down",
+		"OS Power Down",
+		"OS Power Cycle",
+		"OS NMI/Diagnostic Interrupt",
+		"OS Expired",
+		"OS Pre-timeout Interrupt",
+	},
+	0x12: {
+		"System Reconfigured",
+		"OEM System Boot Event",
+		"Undetermined System Hardware Failure",
+		"Entry Added to Auxiliary Log",
+		"PEF Action",
+		"Timestamp Clock Sync",
+	},
+	0x13: {
+		"Front Panel NMI/Diagnostic Interrupt",
+		"Bus Timeout",
+		"I/O Channel Check NMI",
+		"Software NMI",
+		"PCI PERR",
+		"PCI SERR",
+		"EISA Failsafe Timeout",
+		"Bus Correctable Error",
+		"Bus Uncorrectable Error",
+		"Fatal NMI",
+		"Bus Fatal Error",
+		"Bus Degraded",
+	},
+	0x14: {
+		"Power Button Pressed",
+		"Sleep Button Pressed",
+		"Reset Button Pressed",
+		"FRU Latch Open",
+		"FRU Service Request Button",
+	},
+	0x19: {"Soft Power Control Failure", "Thermal Trip"},
+	0x1B: {"Connected", "Configuration Error"},
+	0x1D: {
+		"Initiated by Power Up",
+		"Initiated by Hard Reset",
+		"Initiated by Warm Reset",
+		"User Requested PXE Boot",
+		"Automatic Boot to Diagnostic",
+		"OS Initiated Hard Reset",
+		"OS Initiated Warm Reset",
+		"System Restart",
+	},
+	0x1E: {
+		"No Bootable Media",
+		"Non-bootable Diskette Left in Drive",
+		"PXE Server Not Found",
+		"Invalid Boot Sector",
+		"Timeout Waiting for Selection",
+	},
+	0x1F: {
+		"A: Boot Completed",
+		"C: Boot Completed",
+		"PXE Boot Completed",
+		"Diagnostic Boot Completed",
+		"CD-ROM Boot Completed",
+		"ROM Boot Completed",
+		"Boot Completed - Device Not Specified",
+		"Installation Started",
+		"Installation Completed",
+		"Installation Aborted",
+		"Installation Failed",
+	},
+	0x20: {
+		"Critical Stop During OS Load",
+		"Run-time Critical Stop",
+		"OS Graceful Stop",
+		"OS Graceful Shutdown",
+		"PEF Initiated Soft Shutdown",
+		"Agent Not Responding",
+	},
+	0x21: {
+		"Fault Status",
+		"Identify Status",
+		"Device Installed",
+		"Ready for Device Installation",
+		"Ready for Device Removal",
+		"Slot Power is Off",
+		"Device Removal Request",
+		"Interlock",
+		"Slot is Disabled",
+		"Spare Device",
+	},
+	0x22: {
+		"S0/G0: Working",
+		"S1: Sleeping with Context Maintained",
+		"S2: Sleeping, Processor Context Lost",
+		"S3: Sleeping, Memory Retained",
+		"S4: Suspend to Disk",
+		"S5/G2: Soft Off",
+		"S4/S5: Soft Off",
+		"G3: Mechanical Off",
+		"Sleeping in S1/S2/S3",
+		"G1: Sleeping",
+		"S5: Entered by Override",
+		"Legacy ON State",
+		"Legacy OFF State",
+		"",
+		"Unknown",
+	},
+	0x23: {
+		"Timer Expired",
+		"Hard Reset",
+		"Power Down",
+		"Power Cycle",
+		"", "", "", "",
+		"Timer Interrupt",
+	},
+	0x24: {
+		"Platform Generated Page",
+		"Platform Generated LAN Alert",
+		"Platform Event Trap Generated",
+		"Platform Generated SNMP Trap",
+	},
+	0x25: {"Entity Present", "Entity Absent", "Entity Disabled"},
+	0x27: {"Heartbeat Lost", "Heartbeat"},
+	0x28: {
+		"Sensor Access Degraded or Unavailable",
+		"Controller Access Degraded or Unavailable",
+		"Management Controller Off-line",
+		"Management Controller Unavailable",
+		"Sensor Failure",
+		"FRU Failure",
+	},
+	0x29: {"Low", "Failed", "Presence Detected"},
+	0x2A: {
+		"Session Activated",
+		"Session Deactivated",
+		"Invalid Username or Password",
+		"Invalid Password Disable",
+	},
+	0x2B: {
+		"Hardware Change Detected",
+		"Firmware or Software Change Detected",
+		"Hardware Incompatibility Detected",
+		"Firmware or Software Incompatibility Detected",
+		"Invalid or Unsupported Hardware Version",
+		"Invalid or Unsupported Firmware or Software Version",
+		"Hardware Change Successful",
+		"Firmware or Software Change Successful",
+	},
+	0x2C: {
+		"Not Installed",
+		"Inactive",
+		"Activation Requested",
+		"Activation In Progress",
+		"Active",
+		"Deactivation Requested",
+		"Deactivation In Progress",
+		"Communication Lost",
+	},
+}
+
+var progressCodeNames = map[ProgressCode]string{
+	ProgressUnspecified:         "Unspecified",
+	ProgressMemoryInit:          "Memory Initialization",
+	ProgressHardDiskInit:        "Hard-disk Initialization",
+	ProgressSecondaryCPUInit:    "Secondary Processor Initialization",
+	ProgressUserAuthentication:  "User Authentication",
+	ProgressSystemSetup:         "User-initiated System Setup",
+	ProgressUSBConfig:           "USB Resource Configuration",
+	ProgressPCIConfig:           "PCI Resource Configuration",
+	ProgressOptionROMInit:       "Option ROM Initialization",
+	ProgressVideoInit:           "Video Initialization",
+	ProgressCacheInit:           "Cache Initialization",
+	ProgressSMBusInit:           "SMBus Initialization",
+	ProgressKeyboardInit:        "Keyboard Controller Initialization",
+	ProgressManagementCtrlInit:  "Management Controller Initialization",
+	0x0E:                        "Docking Station Attachment",
+	0x0F:                        "Enabling Docking Station",
+	0x10:                        "Docking Station Ejection",
+	0x11:                        "Disabling Docking Station",
+	ProgressCallingOSWakeVector: "Calling Operating System Wake-up Vector",
+	ProgressStartingOSBoot:      "Starting Operating System Boot Process",
+	ProgressBaseboardInit:       "Baseboard or Motherboard Initialization",
+	0x15:                        "Reserved",
+	0x16:                        "Floppy Initialization",
+	0x17:                        "Keyboard Test",
+	0x18:                        "Pointing Device Test",
+	ProgressPrimaryCPUInit:      "Primary Processor Initialization",
+}
+
+func (c ProgressCode) String() string {
+	if s, ok := progressCodeNames[c]; ok {
+		return s
+	}
+	return fmt.Sprintf("Unknown %#02x", byte(c))
+}
+
+// Offset returns the event offset, the low nibble of event data 1.
+func (e *StandardEvent) Offset() byte {
+	return e.EventData[0] & 0x0F
+}
+
+// EventReadingType returns the event/reading type, without the direction.
+func (e *StandardEvent) EventReadingType() EventReadingType {
+	return EventReadingType(e.EventTypeDir & 0x7F)
+}
+
+// Asserted reports whether the event is an assertion rather than a
+// deassertion.
+func (e *StandardEvent) Asserted() bool {
+	return e.EventTypeDir&0x80 == 0
+}
+
+// Description says what the event means, from its sensor type,
+// event/reading type and offset, e.g. "Upper Critical going high".
+func (e *StandardEvent) Description() string {
+	var table []string
+	t := e.EventReadingType()
+	switch {
+	case t == EventReadingTypeSensorSpecific:
+		table = sensorSpecificOffsets[SensorType(e.SensorType)]
+	case t >= 0x70 && t <= 0x7F:
+		return fmt.Sprintf("OEM Event Offset %#02x", e.Offset())
+	default:
+		table = genericOffsets[t]
+	}
+	off := int(e.Offset())
+	if off >= len(table) || table[off] == "" {
+		return fmt.Sprintf("Unknown Event Offset %#02x", off)
+	}
+	desc := table[off]
+
+	// Event data 2 may say more.
+	if e.SensorType == sensorTypeFirmwareProgress && t == EventReadingTypeSensorSpecific &&
+		off == firmwareProgressOffset && e.EventData[0]&0xC0 == evData2SensorSpecific {
+		desc += ": " + ProgressCode(e.EventData[1]).String()
+	}
+	return desc
+}
+
+// selTimeFormat is how ipmitool's sel list shows times.
+const selTimeFormat = "01/02/2006 | 15:04:05"
+
+// selTimestamp formats a SEL timestamp, which counts seconds from BMC
+// initialization rather than the epoch up to SELPreInitTime.
+func selTimestamp(ts uint32) string {
+	if ts <= SELPreInitTime {
+		return fmt.Sprintf("Pre-Init   | %08ds", ts)
+	}
+	return time.Unix(int64(ts), 0).UTC().Format(selTimeFormat)
+}
+
+// String renders the record like a line of ipmitool sel list, without
+// sensor names, which are in the SDRs: sensors are named by type and
+// number. OEM codes are only decoded by a SELDecoder of the BMC's
+// manufacturer.
+func (e *Event) String() string {
+	return SELDecoder{}.String(e)
+}
@@ -0,0 +1,69 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import "testing"
+
+func TestEventString(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		e    Event
+		want string
+	}{
+		{
+			name: "threshold",
+			e: Event{RecordID: 0x12, RecordType: 0x02, StandardEvent: StandardEvent{
+				Timestamp: 1600000000, SensorType: 0x01, SensorNum: 0x30, EventTypeDir: 0x01,
+				EventData: [3]uint8{0x59, 0x5a, 0x55},
+			}},
+			want: "  12 | 09/13/2020 | 12:26:40 | Temperature #0x30 | Upper Critical going high | Asserted",
+		},
+		{
+			name: "sensor specific deasserted",
+			e: Event{RecordID: 0x100, RecordType: 0x02, StandardEvent: StandardEvent{
+				Timestamp: 1600000000, SensorType: 0x08, SensorNum: 0x51, EventTypeDir: 0xEF,
+				EventData: [3]uint8{0x01, 0xff, 0xff},
+			}},
+			want: " 100 | 09/13/2020 | 12:26:40 | Power Supply #0x51 | Failure Detected | Deasserted",
+		},
+		{
+			name: "firmware progress",
+			e:    *FirmwareProgressEvent(ProgressStartingOSBoot),
+			want: "   0 | Pre-Init   | 00000000s | System Firmware Progress #0x00 | System Firmware Progress: Starting Operating System Boot Process | Asserted",
+		},
+		{
+			name: "unknown offset",
+			e: Event{RecordID: 1, RecordType: 0x02, StandardEvent: StandardEvent{
+				Timestamp: 1600000000, SensorType: 0x29, SensorNum: 2, EventTypeDir: 0x6F,
+				EventData: [3]uint8{0x0E, 0xff, 0xff},
+			}},
+			want: "   1 | 09/13/2020 | 12:26:40 | Battery #0x02 | Unknown Event Offset 0x0e | Asserted",
+		},
+		{
+			name: "oem",
+			e:    Event{RecordID: 2, RecordType: 0xE0, OEMNontsEvent: OEMNontsEvent{[13]uint8{1, 2, 3}}},
+			want: "   2 | OEM record e0 | 01 02 03 00 00 00 00 00 00 00 00 00 00",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.e.String(); got != tt.want {
+				t.Errorf("String() =\n%q, want\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSensorTypeString(t *testing.T) {
+	for typ, want := range map[SensorType]string{
+		0x04: "Fan",
+		0x2C: "FRU State",
+		0xC3: "OEM 0xc3",
+		0x80: "Unknown 0x80",
+	} {
+		if got := typ.String(); got != want {
+			t.Errorf("SensorType(%#02x) = %q, want %q", byte(typ), got, want)
+		}
+	}
+}
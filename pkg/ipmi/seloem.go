@@ -0,0 +1,171 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"fmt"
+	"sync"
+)
+
+// IANA enterprise numbers of manufacturers with OEM event tables.
+const (
+	ManufacturerDell       = 674
+	ManufacturerIntel      = 343
+	ManufacturerSupermicro = 10876
+)
+
+// OEMEventTable describes the OEM events of a manufacturer: its OEM sensor
+// types, the offsets of its OEM event/reading types and of its OEM sensor
+// types, and its OEM SEL records.
+type OEMEventTable struct {
+	Name string
+
+	// SensorTypes names OEM sensor types, 0xC0 to 0xFF.
+	SensorTypes map[SensorType]string
+	// SensorSpecificOffsets describe the offsets of sensor-specific
+	// events of OEM sensor types, by sensor type.
+	SensorSpecificOffsets map[SensorType][]string
+	// OEMOffsets describe the offsets of events of OEM event/reading
+	// types, 0x70 to 0x7F, by sensor type and event/reading type.
+	OEMOffsets map[SensorType]map[EventReadingType][]string
+
+	// Event, if set, describes system events the tables cannot, e.g. from
+	// event data 2 and 3. It returns "" for those it does not know.
+	Event func(e *StandardEvent) string
+	// Record, if set, describes OEM SEL records, of types 0xC0 to 0xFF,
+	// from their OEM data. It returns "" for those it does not know.
+	Record func(recordType byte, data []byte) string
+}
+
+var (
+	oemEventTablesMu sync.RWMutex
+	oemEventTables   = make(map[uint32]*OEMEventTable)
+)
+
+// RegisterOEMEventTable registers t as the OEM event table of the
+// manufacturer with IANA enterprise number id, replacing any other. Tables
+// are added at build time by calling it from the init function of a file
+// in the command, or in a package the command imports. A nil t removes the
+// table.
+func RegisterOEMEventTable(id uint32, t *OEMEventTable) {
+	oemEventTablesMu.Lock()
+	defer oemEventTablesMu.Unlock()
+	if t == nil {
+		delete(oemEventTables, id)
+		return
+	}
+	oemEventTables[id] = t
+}
+
+// OEMEventTableOf returns the OEM event table of manufacturer id, nil if
+// there is none.
+func OEMEventTableOf(id uint32) *OEMEventTable {
+	oemEventTablesMu.RLock()
+	defer oemEventTablesMu.RUnlock()
+	return oemEventTables[id]
+}
+
+// Manufacturer returns the IANA enterprise number of the manufacturer.
+func (d *DevID) Manufacturer() uint32 {
+	return manufacturer(d.ManufacturerID)
+}
+
+func manufacturer(id [3]byte) uint32 {
+	return uint32(id[0]) | uint32(id[1])<<8 | uint32(id[2])<<16
+}
+
+// SELDecoder describes the SEL events of a BMC, using the OEM event table of
+// its manufacturer for OEM codes, if one is registered.
+type SELDecoder struct {
+	// Manufacturer is the IANA enterprise number of the BMC's
+	// manufacturer, as Get Device ID returns it.
+	Manufacturer uint32
+}
+
+func (d SELDecoder) table() *OEMEventTable {
+	return OEMEventTableOf(d.Manufacturer)
+}
+
+// SensorTypeName names sensor type t.
+func (d SELDecoder) SensorTypeName(t SensorType) string {
+	if t >= 0xC0 {
+		if tab := d.table(); tab != nil {
+			if s, ok := tab.SensorTypes[t]; ok {
+				return s
+			}
+		}
+	}
+	return t.String()
+}
+
+// Description says what system event e means, like
+// StandardEvent.Description, with OEM codes decoded.
+func (d SELDecoder) Description(e *StandardEvent) string {
+	tab := d.table()
+	if tab == nil {
+		return e.Description()
+	}
+	if tab.Event != nil {
+		if s := tab.Event(e); s != "" {
+			return s
+		}
+	}
+	st, t := SensorType(e.SensorType), e.EventReadingType()
+	var offsets []string
+	switch {
+	case t == EventReadingTypeSensorSpecific && st >= 0xC0:
+		offsets = tab.SensorSpecificOffsets[st]
+	case t >= 0x70 && t <= 0x7F:
+		offsets = tab.OEMOffsets[st][t]
+	}
+	if off := int(e.Offset()); off < len(offsets) && offsets[off] != "" {
+		return offsets[off]
+	}
+	return e.Description()
+}
+
+// RecordDescription describes OEM SEL record e, "" if there is no OEM
+// event table for it. Timestamped OEM records carry the manufacturer, the
+// others are the BMC manufacturer's.
+func (d SELDecoder) RecordDescription(e *Event) string {
+	id, data := d.Manufacturer, e.OEMNontsDefinedData[:]
+	switch {
+	case e.RecordType >= 0xE0:
+	case e.RecordType >= 0xC0:
+		id, data = manufacturer(e.ManfID), e.OEMTsDefinedData[:]
+	default:
+		return ""
+	}
+	tab := OEMEventTableOf(id)
+	if tab == nil || tab.Record == nil {
+		return ""
+	}
+	return tab.Record(e.RecordType, data)
+}
+
+// String renders e like Event.String, with OEM codes decoded.
+func (d SELDecoder) String(e *Event) string {
+	switch {
+	case e.RecordType >= 0xE0:
+		s := fmt.Sprintf("%4x | OEM record %02x | % x", e.RecordID, e.RecordType, e.OEMNontsDefinedData)
+		if desc := d.RecordDescription(e); desc != "" {
+			s += " | " + desc
+		}
+		return s
+	case e.RecordType >= 0xC0:
+		s := fmt.Sprintf("%4x | %s | OEM record %02x | %02x%02x%02x | % x", e.RecordID, selTimestamp(e.OEMTsEvent.Timestamp),
+			e.RecordType, e.ManfID[2], e.ManfID[1], e.ManfID[0], e.OEMTsDefinedData)
+		if desc := d.RecordDescription(e); desc != "" {
+			s += " | " + desc
+		}
+		return s
+	}
+	dir := "Asserted"
+	if !e.Asserted() {
+		dir = "Deasserted"
+	}
+	return fmt.Sprintf("%4x | %s | %s #%#02x | %s | %s", e.RecordID, selTimestamp(e.StandardEvent.Timestamp),
+		d.SensorTypeName(SensorType(e.SensorType)), e.SensorNum, d.Description(&e.StandardEvent), dir)
+}
@@ -0,0 +1,38 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+var dellEvents = &OEMEventTable{
+	Name: "Dell",
+	SensorTypes: map[SensorType]string{
+		0xC0: "Performance Status",
+		0xC1: "Link Tuning",
+		0xC2: "Non-Fatal Error",
+		0xC3: "Fatal I/O Error",
+		0xC4: "Upgrade",
+	},
+	SensorSpecificOffsets: map[SensorType][]string{
+		0xC0: {
+			"Performance Normal",
+			"Performance Degraded, other",
+			"Performance Degraded, thermal protection",
+			"Performance Degraded, cooling capacity change",
+			"Performance Degraded, power capacity change",
+			"Performance Degraded, user defined power capacity",
+			"System Halted, power exceeds capacity",
+			"Performance Degraded, power exceeds capacity",
+		},
+		0xC1: {
+			"Link Tuning Good",
+			"Failed to program virtual MAC address",
+			"Device option ROM failed to support link tuning or flex address",
+			"Failed to get link tuning or flex address data",
+		},
+	},
+}
+
+func init() {
+	RegisterOEMEventTable(ManufacturerDell, dellEvents)
+}
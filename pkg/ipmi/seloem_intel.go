@@ -0,0 +1,90 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Intel's Node Manager and Management Engine report their events with OEM
+// sensor type 0xDC and one OEM event/reading type each, see the Intel
+// Intelligent Power Node Manager specification.
+const (
+	intelSensorTypeNM = 0xDC
+
+	intelNMThreshold    = 0x72
+	intelNMHealth       = 0x73
+	intelNMCapabilities = 0x74
+	intelMEHealth       = 0x75
+)
+
+var intelMEHealthEvents = []string{
+	"Recovery GPIO forced",
+	"Image execution failed",
+	"Flash erase error",
+	"Flash state information",
+	"Internal error",
+	"BMC did not respond to cold reset",
+	"Direct flash update requested by the BIOS",
+	"Manufacturing error",
+	"Persistent storage integrity error",
+	"Firmware exception",
+	"Flash wear-out protection warning",
+}
+
+var intelEvents = &OEMEventTable{
+	Name: "Intel",
+	SensorTypes: map[SensorType]string{
+		intelSensorTypeNM: "Node Manager",
+	},
+	OEMOffsets: map[SensorType]map[EventReadingType][]string{
+		intelSensorTypeNM: {
+			intelNMThreshold: {
+				"Power Threshold 0 Exceeded",
+				"Power Threshold 1 Exceeded",
+				"Power Threshold 2 Exceeded",
+				"", "", "", "", "",
+				"Policy Correction Time Exceeded",
+			},
+			intelNMHealth: {2: "Node Manager Health Event"},
+			intelMEHealth: {"ME Firmware Health Event"},
+		},
+	},
+	Event: intelEvent,
+}
+
+// intelEvent describes the events whose data says more than their offset.
+func intelEvent(e *StandardEvent) string {
+	if e.SensorType != intelSensorTypeNM {
+		return ""
+	}
+	switch e.EventReadingType() {
+	case intelNMCapabilities:
+		var caps []string
+		for bit, c := range []string{"policy interface", "monitoring", "power limiting"} {
+			if e.EventData[0]&(1<<uint(bit)) != 0 {
+				caps = append(caps, c)
+			}
+		}
+		if caps == nil {
+			return "Node Manager Capabilities Change: none available"
+		}
+		return "Node Manager Capabilities Change: " + strings.Join(caps, ", ") + " available"
+	case intelMEHealth:
+		if e.Offset() != 0 {
+			return ""
+		}
+		if c := int(e.EventData[1]); c < len(intelMEHealthEvents) {
+			return "ME Firmware Health Event: " + intelMEHealthEvents[c]
+		}
+		return fmt.Sprintf("ME Firmware Health Event: code %#02x", e.EventData[1])
+	}
+	return ""
+}
+
+func init() {
+	RegisterOEMEventTable(ManufacturerIntel, intelEvents)
+}
@@ -0,0 +1,28 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+// Supermicro BMCs report the CPU temperature as a state, with OEM sensor
+// type 0xC0 and OEM event/reading type 0x70, rather than in degrees.
+const (
+	supermicroSensorTypeCPUTemp = 0xC0
+	supermicroGeneric           = 0x70
+)
+
+var supermicroEvents = &OEMEventTable{
+	Name: "Supermicro",
+	SensorTypes: map[SensorType]string{
+		supermicroSensorTypeCPUTemp: "CPU Temperature",
+	},
+	OEMOffsets: map[SensorType]map[EventReadingType][]string{
+		supermicroSensorTypeCPUTemp: {
+			supermicroGeneric: {"Low", "Medium", "High", "", "Overheat", "", "", "Not Installed"},
+		},
+	},
+}
+
+func init() {
+	RegisterOEMEventTable(ManufacturerSupermicro, supermicroEvents)
+}
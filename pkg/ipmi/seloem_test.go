@@ -0,0 +1,111 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"fmt"
+	"testing"
+)
+
+func oemEvent(sensorType, typeDir byte, data ...byte) *Event {
+	e := &Event{RecordID: 7, RecordType: 0x02, StandardEvent: StandardEvent{
+		Timestamp: 1600000000, SensorType: sensorType, SensorNum: 0x10, EventTypeDir: typeDir,
+	}}
+	copy(e.EventData[:], data)
+	return e
+}
+
+func TestSELDecoder(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		m    uint32
+		e    *Event
+		want string
+	}{
+		{
+			name: "no table",
+			e:    oemEvent(0xDC, 0x75, 0xA0, 0x05),
+			want: "   7 | 09/13/2020 | 12:26:40 | OEM 0xdc #0x10 | OEM Event Offset 0x00 | Asserted",
+		},
+		{
+			name: "intel ME health",
+			m:    ManufacturerIntel,
+			e:    oemEvent(0xDC, 0x75, 0xA0, 0x05),
+			want: "   7 | 09/13/2020 | 12:26:40 | Node Manager #0x10 | ME Firmware Health Event: BMC did not respond to cold reset | Asserted",
+		},
+		{
+			name: "intel NM threshold",
+			m:    ManufacturerIntel,
+			e:    oemEvent(0xDC, 0x72, 0xA1),
+			want: "   7 | 09/13/2020 | 12:26:40 | Node Manager #0x10 | Power Threshold 1 Exceeded | Asserted",
+		},
+		{
+			name: "intel NM capabilities",
+			m:    ManufacturerIntel,
+			e:    oemEvent(0xDC, 0x74, 0x05),
+			want: "   7 | 09/13/2020 | 12:26:40 | Node Manager #0x10 | Node Manager Capabilities Change: policy interface, power limiting available | Asserted",
+		},
+		{
+			name: "supermicro CPU temperature",
+			m:    ManufacturerSupermicro,
+			e:    oemEvent(0xC0, 0xF0, 0x04),
+			want: "   7 | 09/13/2020 | 12:26:40 | CPU Temperature #0x10 | Overheat | Deasserted",
+		},
+		{
+			name: "dell performance",
+			m:    ManufacturerDell,
+			e:    oemEvent(0xC0, 0x6F, 0x02),
+			want: "   7 | 09/13/2020 | 12:26:40 | Performance Status #0x10 | Performance Degraded, thermal protection | Asserted",
+		},
+		{
+			name: "dell unknown offset",
+			m:    ManufacturerDell,
+			e:    oemEvent(0xC2, 0x6F, 0x0E),
+			want: "   7 | 09/13/2020 | 12:26:40 | Non-Fatal Error #0x10 | Unknown Event Offset 0x0e | Asserted",
+		},
+		{
+			name: "standard event",
+			m:    ManufacturerDell,
+			e:    oemEvent(0x04, 0x01, 0x07),
+			want: "   7 | 09/13/2020 | 12:26:40 | Fan #0x10 | Upper Non-critical going high | Asserted",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (SELDecoder{tt.m}).String(tt.e); got != tt.want {
+				t.Errorf("String() =\n%q, want\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterOEMEventTable(t *testing.T) {
+	const id = 0xFFFFF0
+	RegisterOEMEventTable(id, &OEMEventTable{
+		Name:        "Test",
+		SensorTypes: map[SensorType]string{0xD0: "Widget"},
+		Record: func(typ byte, data []byte) string {
+			return fmt.Sprintf("widget %d is %d", data[0], typ)
+		},
+	})
+	defer RegisterOEMEventTable(id, nil)
+
+	d := SELDecoder{id}
+	if got := d.SensorTypeName(0xD0); got != "Widget" {
+		t.Errorf("SensorTypeName(0xD0) = %q, want Widget", got)
+	}
+	e := &Event{RecordID: 3, RecordType: 0xC1, OEMTsEvent: OEMTsEvent{Timestamp: 1600000000, ManfID: [3]uint8{0xF0, 0xFF, 0xFF}, OEMTsDefinedData: [6]uint8{4}}}
+	want := "   3 | 09/13/2020 | 12:26:40 | OEM record c1 | fffff0 | 04 00 00 00 00 00 | widget 4 is 193"
+	// Timestamped records are decoded by their own manufacturer.
+	if got := (SELDecoder{}).String(e); got != want {
+		t.Errorf("String() =\n%q, want\n%q", got, want)
+	}
+	e = &Event{RecordID: 3, RecordType: 0xE0, OEMNontsEvent: OEMNontsEvent{[13]uint8{9}}}
+	if got := d.RecordDescription(e); got != "widget 9 is 224" {
+		t.Errorf("RecordDescription() = %q", got)
+	}
+	if got := (SELDecoder{ManufacturerIntel}).RecordDescription(e); got != "" {
+		t.Errorf("RecordDescription() with the Intel table = %q, want none", got)
+	}
+}
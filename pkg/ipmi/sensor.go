@@ -0,0 +1,212 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unsafe"
+)
+
+// ThresholdStatus says which thresholds a threshold based sensor's reading
+// is at or beyond.
+type ThresholdStatus byte
+
+// Threshold comparison status bits, IPMI v2.0 table 35-15.
+const (
+	BelowLowerNonCritical    ThresholdStatus = 1 << 0
+	BelowLowerCritical       ThresholdStatus = 1 << 1
+	BelowLowerNonRecoverable ThresholdStatus = 1 << 2
+	AboveUpperNonCritical    ThresholdStatus = 1 << 3
+	AboveUpperCritical       ThresholdStatus = 1 << 4
+	AboveUpperNonRecoverable ThresholdStatus = 1 << 5
+)
+
+var thresholdNames = []struct {
+	t    ThresholdStatus
+	name string
+}{
+	{BelowLowerNonRecoverable, "lnr"},
+	{BelowLowerCritical, "lcr"},
+	{BelowLowerNonCritical, "lnc"},
+	{AboveUpperNonCritical, "unc"},
+	{AboveUpperCritical, "ucr"},
+	{AboveUpperNonRecoverable, "unr"},
+}
+
+// String names the crossed thresholds as ipmitool does, or returns "ok".
+func (t ThresholdStatus) String() string {
+	var s []string
+	for _, n := range thresholdNames {
+		if t&n.t != 0 {
+			s = append(s, n.name)
+		}
+	}
+	if len(s) == 0 {
+		return "ok"
+	}
+	return strings.Join(s, ",")
+}
+
+// SensorReading is the response to Get Sensor Reading.
+type SensorReading struct {
+	// Raw is the reading, to be converted with the sensor's SDR.
+	Raw byte
+
+	EventMessagesEnabled bool
+	ScanningEnabled      bool
+	// Unavailable means Raw and the status bits are not valid, e.g. while
+	// the sensor is initializing or its entity is absent.
+	Unavailable bool
+
+	// Thresholds is set for threshold based sensors.
+	Thresholds ThresholdStatus
+	// States are the asserted states 0 to 14 of discrete sensors.
+	States uint16
+}
+
+// GetSensorReading reads sensor sensorNum.
+//
+// Both Thresholds and States are filled in from the same response bytes;
+// which one is meaningful depends on the sensor's event/reading type in its
+// SDR.
+func (i *IPMI) GetSensorReading(sensorNum byte) (*SensorReading, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_SENSOR_EVENT
+	req.msg.cmd = _BMC_GET_SENSOR_READING
+	req.msg.data = unsafe.Pointer(&sensorNum)
+	req.msg.dataLen = 1
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.completion(fmt.Sprintf("GetSensorReading(%#02x)", sensorNum), recv); err != nil {
+		return nil, err
+	}
+	return unmarshalSensorReading(recv[1:])
+}
+
+func unmarshalSensorReading(b []byte) (*SensorReading, error) {
+	// Bytes 3 and 4, the status, are optional.
+	if len(b) < 2 {
+		return nil, fmt.Errorf("GetSensorReading: short response of %d bytes", len(b)+1)
+	}
+	r := &SensorReading{
+		Raw:                  b[0],
+		EventMessagesEnabled: b[1]&0x80 != 0,
+		ScanningEnabled:      b[1]&0x40 != 0,
+		Unavailable:          b[1]&0x20 != 0,
+	}
+	if len(b) > 2 {
+		r.Thresholds = ThresholdStatus(b[2] & 0x3F)
+		r.States = uint16(b[2])
+	}
+	if len(b) > 3 {
+		r.States |= uint16(b[3]&0x7F) << 8
+	}
+	return r, nil
+}
+
+// AnalogFormat is how a sensor's raw readings are encoded, from its SDR.
+type AnalogFormat byte
+
+// Analog data formats.
+const (
+	AnalogUnsigned AnalogFormat = iota
+	AnalogOnesComplement
+	AnalogTwosComplement
+	AnalogNone
+)
+
+// Linearization is the function applied to a converted reading, from the
+// sensor's SDR.
+type Linearization byte
+
+// Linearization functions, IPMI v2.0 table 43-1 byte 24.
+const (
+	LinearLinear Linearization = iota
+	LinearLn
+	LinearLog10
+	LinearLog2
+	LinearE
+	LinearExp10
+	LinearExp2
+	LinearInverse
+	LinearSqr
+	LinearCube
+	LinearSqrt
+	LinearCubeRoot
+)
+
+// SensorConversion holds the factors from a full sensor record that turn a
+// raw reading into a value in the sensor's units:
+//
+//     y = L[(M*x + B*10^BExp) * 10^RExp]
+type SensorConversion struct {
+	M, B          int16
+	BExp, RExp    int8
+	Format        AnalogFormat
+	Linearization Linearization
+}
+
+// Value converts raw. It returns NaN if the sensor has no analog reading or
+// an unknown linearization.
+func (c SensorConversion) Value(raw byte) float64 {
+	var x float64
+	switch c.Format {
+	case AnalogUnsigned:
+		x = float64(raw)
+	case AnalogOnesComplement:
+		if raw&0x80 != 0 {
+			x = -float64(^raw)
+		} else {
+			x = float64(raw)
+		}
+	case AnalogTwosComplement:
+		x = float64(int8(raw))
+	default:
+		return math.NaN()
+	}
+	y := (float64(c.M)*x + float64(c.B)*math.Pow10(int(c.BExp))) * math.Pow10(int(c.RExp))
+
+	switch c.Linearization {
+	case LinearLinear:
+		return y
+	case LinearLn:
+		return math.Log(y)
+	case LinearLog10:
+		return math.Log10(y)
+	case LinearLog2:
+		return math.Log2(y)
+	case LinearE:
+		return math.Exp(y)
+	case LinearExp10:
+		return math.Pow(10, y)
+	case LinearExp2:
+		return math.Exp2(y)
+	case LinearInverse:
+		return 1 / y
+	case LinearSqr:
+		return y * y
+	case LinearCube:
+		return y * y * y
+	case LinearSqrt:
+		return math.Sqrt(y)
+	case LinearCubeRoot:
+		return math.Cbrt(y)
+	}
+	return math.NaN()
+}
+
+// Value converts the reading with c, the factors from the sensor's SDR. It
+// returns NaN if the reading is unavailable.
+func (r *SensorReading) Value(c SensorConversion) float64 {
+	if r.Unavailable {
+		return math.NaN()
+	}
+	return c.Value(r.Raw)
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshalSensorReading(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		b    []byte
+		want *SensorReading
+	}{
+		{
+			name: "threshold",
+			b:    []byte{0x2a, 0xc0, 0x18, 0x80},
+			want: &SensorReading{
+				Raw:                  0x2a,
+				EventMessagesEnabled: true,
+				ScanningEnabled:      true,
+				Thresholds:           AboveUpperNonCritical | AboveUpperCritical,
+				States:               0x18,
+			},
+		},
+		{
+			name: "discrete",
+			b:    []byte{0x00, 0x40, 0x01, 0x42},
+			want: &SensorReading{
+				ScanningEnabled: true,
+				Thresholds:      BelowLowerNonCritical,
+				States:          0x4201,
+			},
+		},
+		{
+			name: "no status",
+			b:    []byte{0x00, 0x20},
+			want: &SensorReading{Unavailable: true},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unmarshalSensorReading(tt.b)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("unmarshalSensorReading() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := unmarshalSensorReading([]byte{0x01}); err == nil {
+		t.Errorf("unmarshalSensorReading(1 byte) = nil, want error")
+	}
+}
+
+func TestThresholdStatusString(t *testing.T) {
+	for ts, want := range map[ThresholdStatus]string{
+		0:                  "ok",
+		AboveUpperCritical: "ucr",
+		BelowLowerNonCritical | BelowLowerCritical:       "lcr,lnc",
+		AboveUpperNonCritical | AboveUpperNonRecoverable: "unc,unr",
+	} {
+		if got := ts.String(); got != want {
+			t.Errorf("ThresholdStatus(%#x) = %q, want %q", byte(ts), got, want)
+		}
+	}
+}
+
+func TestSensorConversion(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		c    SensorConversion
+		raw  byte
+		want float64
+	}{
+		// A fan: 75 RPM per count.
+		{"fan", SensorConversion{M: 75}, 80, 6000},
+		// A voltage: 0.0157 V per count.
+		{"voltage", SensorConversion{M: 157, RExp: -4}, 0xbf, 2.9987},
+		{"offset", SensorConversion{M: 1, B: 5, BExp: 1}, 20, 70},
+		{"twos complement", SensorConversion{M: 1, Format: AnalogTwosComplement}, 0xfe, -2},
+		{"ones complement", SensorConversion{M: 1, Format: AnalogOnesComplement}, 0xfe, -1},
+		{"inverse", SensorConversion{M: 1, Linearization: LinearInverse}, 4, 0.25},
+		{"sqr", SensorConversion{M: 1, Linearization: LinearSqr}, 3, 9},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.c.Value(tt.raw); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Value(%#02x) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+
+	if v := (SensorConversion{Format: AnalogNone}).Value(1); !math.IsNaN(v) {
+		t.Errorf("Value() without analog reading = %v, want NaN", v)
+	}
+	r := &SensorReading{Raw: 1, Unavailable: true}
+	if v := r.Value(SensorConversion{M: 1}); !math.IsNaN(v) {
+		t.Errorf("Value() of unavailable reading = %v, want NaN", v)
+	}
+}
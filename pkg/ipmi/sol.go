@@ -0,0 +1,268 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// SOL packets, IPMI v2.0 section 15.9: sequence number, acked sequence
+// number, accepted character count, operation or status, then characters.
+const (
+	solHeaderLen = 4
+
+	// solSeqMask bounds sequence numbers, which are 1 to 15. 0 is for
+	// packets that only ack.
+	solSeqMask = 0x0F
+
+	// Operations, to the BMC.
+	solOpBreak         = 0x10
+	solOpFlushInbound  = 0x02
+	solOpFlushOutbound = 0x01
+
+	// Status, from the BMC.
+	solStatusNack         = 0x40
+	solStatusUnavailable  = 0x20
+	solStatusDeactivating = 0x10
+
+	// Activate Payload auxiliary data: encrypt and authenticate SOL,
+	// and defer serial alerts while it is active.
+	solActivateAux = 0x80 | 0x40 | 0x04
+
+	solInstance = 1
+
+	// solMaxNacks bounds how often the BMC may say it is not ready.
+	solMaxNacks = 50
+)
+
+// SOL is a Serial over LAN connection to the serial console of a BMC's
+// host. Reads return what the host writes to its serial port, and writes
+// are typed into it.
+type SOL struct {
+	s *lanSession
+
+	// maxData is how many characters the BMC takes in a packet.
+	maxData int
+
+	// wmu serializes writes, and with them the sequence numbers of
+	// packets sent.
+	wmu  sync.Mutex
+	seq  byte
+	acks chan []byte
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	in     []byte
+	inSeq  byte
+	closed bool
+}
+
+// ActivateSOL activates the SOL payload of an IPMI opened with DialLAN,
+// over the same session.
+func (i *IPMI) ActivateSOL() (*SOL, error) {
+	s, ok := i.Transport.(*lanSession)
+	if !ok {
+		return nil, errors.New("SOL needs a LAN session")
+	}
+	resp, err := s.SendRecv(_IPMI_NETFN_APP, _BMC_ACTIVATE_PAYLOAD, []byte{payloadSOL, solInstance, solActivateAux, 0, 0, 0})
+	if err != nil {
+		return nil, err
+	}
+	err = checkCompletion("ActivateSOL", _IPMI_NETFN_APP, _BMC_ACTIVATE_PAYLOAD, resp)
+	switch {
+	case isCompletion(err, 0x80):
+		return nil, fmt.Errorf("SOL is already active: %w", err)
+	case isCompletion(err, 0x81):
+		return nil, fmt.Errorf("SOL is disabled: %w", err)
+	case err != nil:
+		return nil, err
+	case len(resp) < 11:
+		return nil, fmt.Errorf("ActivateSOL: short response %#x", resp)
+	}
+	// Auxiliary data, then inbound and outbound payload sizes, and the
+	// port SOL is on.
+	inSize := int(binary.LittleEndian.Uint16(resp[5:]))
+	if port := binary.LittleEndian.Uint16(resp[9:]); port != rmcpPort {
+		s.deactivateSOL()
+		return nil, fmt.Errorf("ActivateSOL: SOL on port %d is not supported", port)
+	}
+
+	sol := &SOL{s: s, maxData: inSize - solHeaderLen, acks: make(chan []byte, 4)}
+	if sol.maxData <= 0 || sol.maxData > 255 {
+		// The accepted character count is a byte.
+		sol.maxData = 255
+	}
+	sol.cond = sync.NewCond(&sol.mu)
+	s.setSOL(sol.handle)
+	return sol, nil
+}
+
+func (s *lanSession) deactivateSOL() error {
+	resp, err := s.SendRecv(_IPMI_NETFN_APP, _BMC_DEACTIVATE_PAYLOAD, []byte{payloadSOL, solInstance, 0, 0, 0, 0})
+	if err != nil {
+		return err
+	}
+	// 0x80 is for SOL that is already deactivated.
+	if err := checkCompletion("DeactivateSOL", _IPMI_NETFN_APP, _BMC_DEACTIVATE_PAYLOAD, resp); !isCompletion(err, 0x80) {
+		return err
+	}
+	return nil
+}
+
+// handle takes a SOL packet from the BMC, or nil once no more come.
+func (sol *SOL) handle(p []byte) {
+	if p == nil {
+		sol.close()
+		return
+	}
+	if len(p) < solHeaderLen {
+		return
+	}
+	seq, ack, status, data := p[0]&solSeqMask, p[1]&solSeqMask, p[3], p[solHeaderLen:]
+	if ack != 0 {
+		select {
+		case sol.acks <- p[:solHeaderLen]:
+		default:
+		}
+	}
+	if seq != 0 {
+		sol.mu.Lock()
+		// A packet sent again because our ack was lost is acked again,
+		// but its characters were had.
+		if seq != sol.inSeq {
+			sol.inSeq = seq
+			sol.in = append(sol.in, data...)
+			sol.cond.Broadcast()
+		}
+		sol.mu.Unlock()
+		sol.s.send(payloadSOL, []byte{0, seq, byte(len(data)), 0})
+	}
+	if status&solStatusDeactivating != 0 {
+		sol.close()
+	}
+}
+
+func (sol *SOL) close() {
+	sol.mu.Lock()
+	sol.closed = true
+	sol.cond.Broadcast()
+	sol.mu.Unlock()
+}
+
+// Read reads what the host wrote to its serial port. It returns io.EOF once
+// SOL is deactivated.
+func (sol *SOL) Read(b []byte) (int, error) {
+	sol.mu.Lock()
+	defer sol.mu.Unlock()
+	for len(sol.in) == 0 && !sol.closed {
+		sol.cond.Wait()
+	}
+	if len(sol.in) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(b, sol.in)
+	sol.in = sol.in[n:]
+	return n, nil
+}
+
+// Write types b into the host's serial port. It returns once the BMC has
+// taken all of it.
+func (sol *SOL) Write(b []byte) (int, error) {
+	sol.wmu.Lock()
+	defer sol.wmu.Unlock()
+	var n int
+	for n < len(b) {
+		chunk := b[n:]
+		if len(chunk) > sol.maxData {
+			chunk = chunk[:sol.maxData]
+		}
+		accepted, err := sol.send(0, chunk)
+		n += accepted
+		if err != nil {
+			return n, err
+		}
+		if accepted == 0 {
+			return n, errors.New("SOL: BMC accepted no characters")
+		}
+	}
+	return n, nil
+}
+
+// Break sends a serial break to the host.
+func (sol *SOL) Break() error {
+	sol.wmu.Lock()
+	defer sol.wmu.Unlock()
+	_, err := sol.send(solOpBreak, nil)
+	return err
+}
+
+// Flush discards what the BMC holds that the host has yet to read, and what
+// it holds that we have yet to.
+func (sol *SOL) Flush() error {
+	sol.wmu.Lock()
+	defer sol.wmu.Unlock()
+	_, err := sol.send(solOpFlushInbound|solOpFlushOutbound, nil)
+	return err
+}
+
+// send sends characters and operations in a packet until the BMC acks it,
+// and returns how many characters it accepted. A BMC that is not ready
+// for more nacks, and the packet is sent again.
+func (sol *SOL) send(op byte, data []byte) (int, error) {
+	sol.seq = sol.seq%solSeqMask + 1
+	seq := sol.seq
+	p := append([]byte{seq, 0, 0, op}, data...)
+
+	for try, nacks := 0, 0; try <= sol.s.retries && nacks < solMaxNacks; try++ {
+		sol.mu.Lock()
+		closed := sol.closed
+		sol.mu.Unlock()
+		if closed {
+			return 0, errors.New("SOL is deactivated")
+		}
+		if err := sol.s.send(payloadSOL, p); err != nil {
+			return 0, err
+		}
+		timer := time.NewTimer(sol.s.timeout)
+	wait:
+		for {
+			select {
+			case a := <-sol.acks:
+				if a[1]&solSeqMask != seq {
+					continue
+				}
+				timer.Stop()
+				if a[3]&(solStatusNack|solStatusUnavailable) != 0 {
+					// Give the BMC time to make room. This
+					// is not a lost packet.
+					time.Sleep(sol.s.timeout / 4)
+					nacks++
+					try--
+					break wait
+				}
+				accepted := int(a[2])
+				if accepted > len(data) {
+					accepted = len(data)
+				}
+				return accepted, nil
+			case <-timer.C:
+				break wait
+			}
+		}
+	}
+	return 0, fmt.Errorf("SOL packet %d not acked", seq)
+}
+
+// Deactivate deactivates SOL. The session stays open.
+func (sol *SOL) Deactivate() error {
+	sol.close()
+	sol.s.setSOL(nil)
+	return sol.s.deactivateSOL()
+}
@@ -0,0 +1,333 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+// SOLParam is a SOL configuration parameter, IPMI v2.0 table 26-5.
+type SOLParam byte
+
+// SOL configuration parameters.
+const (
+	SOLSetInProgress      SOLParam = 0
+	SOLEnable             SOLParam = 1
+	SOLAuthentication     SOLParam = 2
+	SOLCharAccumulate     SOLParam = 3
+	SOLRetry              SOLParam = 4
+	SOLNonVolatileBitRate SOLParam = 5
+	SOLVolatileBitRate    SOLParam = 6
+	SOLPayloadChannel     SOLParam = 7
+	SOLPayloadPortNumber  SOLParam = 8
+)
+
+// ErrSOLParamNotSupported is returned for parameters the BMC does not
+// support.
+var ErrSOLParamNotSupported = errors.New("SOL parameter not supported")
+
+// ErrSOLSetInProgress is returned by SetSOLConfig if another client is
+// setting SOL parameters.
+var ErrSOLSetInProgress = errors.New("SOL parameters are being set by another client")
+
+// Set SOL Configuration Parameters completion codes, and Set In Progress
+// states.
+const (
+	ccSOLParamNotSupported CompletionCode = 0x80
+	ccSOLSetInProgress     CompletionCode = 0x81
+	ccSOLParamReadOnly     CompletionCode = 0x82
+
+	solSetComplete   = 0
+	solSetInProgress = 1
+	solCommitWrite   = 2
+)
+
+// GetSOLConfigParam reads a SOL configuration parameter of channel. It
+// returns the parameter data, without the revision byte.
+func (i *IPMI) GetSOLConfigParam(channel byte, param SOLParam, set, block byte) ([]byte, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_TRANSPORT
+	req.msg.cmd = _BMC_GET_SOL_CONFIG
+
+	data := [4]byte{channel & 0x0F, byte(param), set, block}
+	req.msg.data = unsafe.Pointer(&data[0])
+	req.msg.dataLen = 4
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return nil, err
+	}
+	err = req.completion(fmt.Sprintf("GetSOLConfig(%d, %d)", channel, param), recv)
+	if isCompletion(err, ccSOLParamNotSupported) {
+		return nil, ErrSOLParamNotSupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(recv) < 2 {
+		return nil, fmt.Errorf("GetSOLConfig(%d, %d): short response of %d bytes", channel, param, len(recv))
+	}
+	return recv[2:], nil
+}
+
+// SetSOLConfigParam writes a SOL configuration parameter of channel,
+// outside of the Set In Progress handshake of SetSOLConfig.
+func (i *IPMI) SetSOLConfigParam(channel byte, param SOLParam, data []byte) error {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_TRANSPORT
+	req.msg.cmd = _BMC_SET_SOL_CONFIG
+
+	b := append([]byte{channel & 0x0F, byte(param)}, data...)
+	req.msg.data = unsafe.Pointer(&b[0])
+	req.msg.dataLen = uint16(len(b))
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return err
+	}
+	err = req.completion(fmt.Sprintf("SetSOLConfig(%d, %d)", channel, param), recv)
+	switch {
+	case isCompletion(err, ccSOLParamNotSupported):
+		return ErrSOLParamNotSupported
+	case isCompletion(err, ccSOLSetInProgress):
+		return ErrSOLSetInProgress
+	case isCompletion(err, ccSOLParamReadOnly):
+		return fmt.Errorf("SOL parameter %d is read-only: %w", param, err)
+	}
+	return err
+}
+
+// SOLSetting is a SOL configuration parameter to set, and its data.
+type SOLSetting struct {
+	Param SOLParam
+	Data  []byte
+}
+
+// SetSOLConfig writes settings of channel in order, between claiming Set
+// In Progress and committing them, as SetLanConfig does for LAN
+// parameters.
+func (i *IPMI) SetSOLConfig(channel byte, settings ...SOLSetting) (err error) {
+	lock := true
+	switch err := i.SetSOLConfigParam(channel, SOLSetInProgress, []byte{solSetInProgress}); err {
+	case nil:
+	case ErrSOLParamNotSupported:
+		lock = false
+	default:
+		return err
+	}
+	if lock {
+		defer func() {
+			if rerr := i.SetSOLConfigParam(channel, SOLSetInProgress, []byte{solSetComplete}); err == nil {
+				err = rerr
+			}
+		}()
+	}
+	for _, s := range settings {
+		if err := i.SetSOLConfigParam(channel, s.Param, s.Data); err != nil {
+			return err
+		}
+	}
+	if lock {
+		err := i.SetSOLConfigParam(channel, SOLSetInProgress, []byte{solCommitWrite})
+		if err != nil && err != ErrSOLParamNotSupported && !isCompletion(err, CompletionInvalidDataField) {
+			return err
+		}
+	}
+	return nil
+}
+
+// SOLBitRate is the bit rate of the serial port SOL is on.
+type SOLBitRate byte
+
+// SOL bit rates. SOLBitRateSerial is the rate of the serial port
+// settings, of the Serial/Modem channel.
+const (
+	SOLBitRateSerial SOLBitRate = 0x0
+	SOLBitRate9600   SOLBitRate = 0x6
+	SOLBitRate19200  SOLBitRate = 0x7
+	SOLBitRate38400  SOLBitRate = 0x8
+	SOLBitRate57600  SOLBitRate = 0x9
+	SOLBitRate115200 SOLBitRate = 0xA
+)
+
+var solBauds = map[SOLBitRate]int{
+	SOLBitRate9600:   9600,
+	SOLBitRate19200:  19200,
+	SOLBitRate38400:  38400,
+	SOLBitRate57600:  57600,
+	SOLBitRate115200: 115200,
+}
+
+// Baud returns the rate in bits per second, or 0 for SOLBitRateSerial and
+// unknown rates.
+func (r SOLBitRate) Baud() int {
+	return solBauds[r]
+}
+
+func (r SOLBitRate) String() string {
+	if r == SOLBitRateSerial {
+		return "serial"
+	}
+	if b, ok := solBauds[r]; ok {
+		return fmt.Sprint(b)
+	}
+	return fmt.Sprintf("SOLBitRate(%#x)", byte(r))
+}
+
+// SOLBitRateOf returns the SOLBitRate of baud bits per second, or
+// SOLBitRateSerial if baud is 0.
+func SOLBitRateOf(baud int) (SOLBitRate, error) {
+	if baud == 0 {
+		return SOLBitRateSerial, nil
+	}
+	for r, b := range solBauds {
+		if b == baud {
+			return r, nil
+		}
+	}
+	return 0, fmt.Errorf("SOL does not run at %d baud", baud)
+}
+
+// SOL parameter units and bounds.
+const (
+	solAccumulateUnit = 5 * time.Millisecond
+	solRetryUnit      = 10 * time.Millisecond
+	solMaxRetries     = 7
+
+	solForceEncryption     = 0x80
+	solForceAuthentication = 0x40
+)
+
+// SOLConfig is the SOL configuration of a channel. Fields of parameters
+// the BMC does not support are left zero.
+type SOLConfig struct {
+	Enabled bool
+	// Privilege is the lowest privilege of the sessions that may
+	// activate SOL, from User to OEM.
+	Privilege Privilege
+	// ForceEncryption and ForceAuthentication have the BMC encrypt and
+	// authenticate SOL whatever the remote console asks for.
+	ForceEncryption     bool
+	ForceAuthentication bool
+
+	// The BMC sends the characters it got once AccumulateInterval has
+	// passed, in steps of 5ms, or once it has SendThreshold of them.
+	AccumulateInterval time.Duration
+	SendThreshold      byte
+	// Retries is how many more times, up to 7, the BMC sends a packet
+	// the remote console does not acknowledge within RetryInterval, in
+	// steps of 10ms.
+	Retries       byte
+	RetryInterval time.Duration
+
+	// BitRate is the rate the BMC sets the port to, and VolatileBitRate
+	// the rate until the next reset.
+	BitRate         SOLBitRate
+	VolatileBitRate SOLBitRate
+
+	// PayloadChannel and PayloadPort are the channel and UDP port SOL
+	// is on; BMCs that do not say use the channel asked about and 623.
+	PayloadChannel byte
+	PayloadPort    uint16
+}
+
+// GetSOLConfig reads the SOL configuration of channel.
+func (i *IPMI) GetSOLConfig(channel byte) (*SOLConfig, error) {
+	c := &SOLConfig{}
+	for _, p := range []struct {
+		param SOLParam
+		size  int
+		set   func(b []byte)
+	}{
+		{SOLEnable, 1, func(b []byte) { c.Enabled = b[0]&0x01 != 0 }},
+		{SOLAuthentication, 1, func(b []byte) {
+			c.ForceEncryption = b[0]&solForceEncryption != 0
+			c.ForceAuthentication = b[0]&solForceAuthentication != 0
+			c.Privilege = Privilege(b[0] & 0x0F)
+		}},
+		{SOLCharAccumulate, 2, func(b []byte) {
+			c.AccumulateInterval = time.Duration(b[0]) * solAccumulateUnit
+			c.SendThreshold = b[1]
+		}},
+		{SOLRetry, 2, func(b []byte) {
+			c.Retries = b[0] & solMaxRetries
+			c.RetryInterval = time.Duration(b[1]) * solRetryUnit
+		}},
+		{SOLNonVolatileBitRate, 1, func(b []byte) { c.BitRate = SOLBitRate(b[0] & 0x0F) }},
+		{SOLVolatileBitRate, 1, func(b []byte) { c.VolatileBitRate = SOLBitRate(b[0] & 0x0F) }},
+		{SOLPayloadChannel, 1, func(b []byte) { c.PayloadChannel = b[0] & 0x0F }},
+		{SOLPayloadPortNumber, 2, func(b []byte) { c.PayloadPort = uint16(b[0]) | uint16(b[1])<<8 }},
+	} {
+		b, err := i.GetSOLConfigParam(channel, p.param, 0, 0)
+		if err == ErrSOLParamNotSupported {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(b) < p.size {
+			return nil, fmt.Errorf("SOL parameter %d of %d bytes, want %d", p.param, len(b), p.size)
+		}
+		p.set(b)
+	}
+	if c.PayloadChannel == 0 {
+		c.PayloadChannel = channel & 0x0F
+	}
+	if c.PayloadPort == 0 {
+		c.PayloadPort = rmcpPort
+	}
+	return c, nil
+}
+
+// SetSOLControl writes the enable, authentication, character accumulate,
+// retry and bit rate parameters of c to channel. The payload channel and
+// port are left alone.
+func (i *IPMI) SetSOLControl(channel byte, c *SOLConfig) error {
+	if c.Privilege < PrivilegeUser || c.Privilege > PrivilegeOEM {
+		return fmt.Errorf("SOL privilege %v is not User, Operator, Administrator or OEM", c.Privilege)
+	}
+	accumulate := c.AccumulateInterval / solAccumulateUnit
+	if accumulate < 1 || accumulate > 0xFF {
+		return fmt.Errorf("SOL character accumulate interval %v is not within [%v, %v]", c.AccumulateInterval, solAccumulateUnit, 0xFF*solAccumulateUnit)
+	}
+	if c.SendThreshold == 0 {
+		return errors.New("SOL character send threshold is 0")
+	}
+	if c.Retries > solMaxRetries {
+		return fmt.Errorf("%d SOL retries is more than %d", c.Retries, solMaxRetries)
+	}
+	retry := c.RetryInterval / solRetryUnit
+	if retry < 0 || retry > 0xFF {
+		return fmt.Errorf("SOL retry interval %v is not within [0, %v]", c.RetryInterval, 0xFF*solRetryUnit)
+	}
+	for _, r := range []SOLBitRate{c.BitRate, c.VolatileBitRate} {
+		if _, ok := solBauds[r]; !ok && r != SOLBitRateSerial {
+			return fmt.Errorf("unknown SOL bit rate %v", r)
+		}
+	}
+
+	var enable, auth byte
+	if c.Enabled {
+		enable = 0x01
+	}
+	if c.ForceEncryption {
+		auth |= solForceEncryption
+	}
+	if c.ForceAuthentication {
+		auth |= solForceAuthentication
+	}
+	auth |= byte(c.Privilege)
+	return i.SetSOLConfig(channel,
+		SOLSetting{SOLEnable, []byte{enable}},
+		SOLSetting{SOLAuthentication, []byte{auth}},
+		SOLSetting{SOLCharAccumulate, []byte{byte(accumulate), c.SendThreshold}},
+		SOLSetting{SOLRetry, []byte{c.Retries, byte(retry)}},
+		SOLSetting{SOLNonVolatileBitRate, []byte{byte(c.BitRate)}},
+		SOLSetting{SOLVolatileBitRate, []byte{byte(c.VolatileBitRate)}},
+	)
+}
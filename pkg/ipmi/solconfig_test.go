@@ -0,0 +1,128 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// solBMC returns a BMC answering Get SOL Configuration Parameters from
+// params, and accepting every Set.
+func solBMC(params map[[2]byte][]byte) *fakeTransport {
+	f := &fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_TRANSPORT, _BMC_SET_SOL_CONFIG}: {0},
+	}}
+	f.handle(_IPMI_NETFN_TRANSPORT, _BMC_GET_SOL_CONFIG, configParams(params, 1, ccSOLParamNotSupported))
+	return f
+}
+
+func TestGetSOLConfig(t *testing.T) {
+	params := map[[2]byte][]byte{
+		{byte(SOLEnable), 0}:             {0x01},
+		{byte(SOLAuthentication), 0}:     {0xC4},
+		{byte(SOLCharAccumulate), 0}:     {12, 96},
+		{byte(SOLRetry), 0}:              {7, 50},
+		{byte(SOLNonVolatileBitRate), 0}: {0x0A},
+		{byte(SOLVolatileBitRate), 0}:    {0x06},
+	}
+	i := &IPMI{Transport: solBMC(params)}
+
+	c, err := i.GetSOLConfig(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := SOLConfig{
+		Enabled:             true,
+		Privilege:           PrivilegeAdmin,
+		ForceEncryption:     true,
+		ForceAuthentication: true,
+		AccumulateInterval:  60 * time.Millisecond,
+		SendThreshold:       96,
+		Retries:             7,
+		RetryInterval:       500 * time.Millisecond,
+		BitRate:             SOLBitRate115200,
+		VolatileBitRate:     SOLBitRate9600,
+		PayloadChannel:      1,
+		PayloadPort:         623,
+	}
+	if *c != want {
+		t.Errorf("GetSOLConfig = %+v, want %+v", *c, want)
+	}
+
+	params[[2]byte{byte(SOLPayloadPortNumber), 0}] = []byte{0x70, 0x02}
+	if c, err := i.GetSOLConfig(1); err != nil || c.PayloadPort != 624 {
+		t.Errorf("GetSOLConfig = %+v, %v, want port 624", c, err)
+	}
+	params[[2]byte{byte(SOLRetry), 0}] = []byte{7}
+	if _, err := i.GetSOLConfig(1); err == nil {
+		t.Error("GetSOLConfig with a short retry parameter did not fail")
+	}
+}
+
+func TestSetSOLControl(t *testing.T) {
+	s := solBMC(nil)
+	i := &IPMI{Transport: s}
+
+	c := &SOLConfig{
+		Enabled:            true,
+		Privilege:          PrivilegeUser,
+		ForceEncryption:    true,
+		AccumulateInterval: 50 * time.Millisecond,
+		SendThreshold:      200,
+		Retries:            3,
+		RetryInterval:      100 * time.Millisecond,
+		BitRate:            SOLBitRate115200,
+		VolatileBitRate:    SOLBitRateSerial,
+	}
+	if err := i.SetSOLControl(1, c); err != nil {
+		t.Fatal(err)
+	}
+	set := func(p SOLParam, d ...byte) []byte {
+		return append([]byte{_IPMI_NETFN_TRANSPORT, _BMC_SET_SOL_CONFIG, 1, byte(p)}, d...)
+	}
+	want := [][]byte{
+		set(SOLSetInProgress, solSetInProgress),
+		set(SOLEnable, 0x01),
+		set(SOLAuthentication, 0x82),
+		set(SOLCharAccumulate, 10, 200),
+		set(SOLRetry, 3, 10),
+		set(SOLNonVolatileBitRate, 0x0A),
+		set(SOLVolatileBitRate, 0x00),
+		set(SOLSetInProgress, solCommitWrite),
+		set(SOLSetInProgress, solSetComplete),
+	}
+	if !reflect.DeepEqual(s.requests, want) {
+		t.Errorf("SetSOLControl sent %#x, want %#x", s.requests, want)
+	}
+
+	for _, bad := range []SOLConfig{
+		{Privilege: PrivilegeCallback, AccumulateInterval: 50 * time.Millisecond, SendThreshold: 1},
+		{Privilege: PrivilegeUser, AccumulateInterval: 2 * time.Second, SendThreshold: 1},
+		{Privilege: PrivilegeUser, AccumulateInterval: 50 * time.Millisecond},
+		{Privilege: PrivilegeUser, AccumulateInterval: 50 * time.Millisecond, SendThreshold: 1, Retries: 8},
+		{Privilege: PrivilegeUser, AccumulateInterval: 50 * time.Millisecond, SendThreshold: 1, BitRate: 3},
+	} {
+		if err := i.SetSOLControl(1, &bad); err == nil {
+			t.Errorf("SetSOLControl(%+v) did not fail", bad)
+		}
+	}
+}
+
+func TestSOLBitRate(t *testing.T) {
+	for _, baud := range []int{0, 9600, 19200, 38400, 57600, 115200} {
+		r, err := SOLBitRateOf(baud)
+		if err != nil || r.Baud() != baud {
+			t.Errorf("SOLBitRateOf(%d) = %v, %v", baud, r, err)
+		}
+	}
+	if _, err := SOLBitRateOf(4800); err == nil {
+		t.Error("SOLBitRateOf(4800) did not fail")
+	}
+	if s := SOLBitRateSerial.String(); s != "serial" {
+		t.Errorf("SOLBitRateSerial = %q, want serial", s)
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package supermicro implements OEM commands of Supermicro BMCs: getting
+// and setting the fan mode, getting the BIOS version and resetting the BMC
+// to its factory defaults.
+//
+//	b := supermicro.New(i)
+//	err := b.SetFanMode(supermicro.FanFull)
+//
+// Importing it also registers the commands as Supermicro's OEM extension,
+// so ipmi.RunOEMCommand runs them on Supermicro BMCs.
+package supermicro
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/ipmi"
+)
+
+// Supermicro OEM commands.
+const (
+	netfnOEM           = 0x30
+	cmdFanMode         = 0x45
+	fanModeGet         = 0x00
+	fanModeSet         = 0x01
+	netfnOEMReset      = 0x3C
+	cmdFactoryDefaults = 0x40
+)
+
+// Get System Info Parameters, IPMI v2.0 section 22.14b, which the BIOS
+// reports its version to the BMC with during POST.
+const (
+	netfnApp                   = 0x06
+	cmdGetSystemInfo           = 0x59
+	paramSystemFirmwareVersion = 0x01
+
+	// blockSize is the size of the string blocks of the parameter; the
+	// first starts with the encoding and the length of the string.
+	blockSize = 16
+)
+
+// FanMode is how a Supermicro BMC drives the fans.
+type FanMode byte
+
+// Fan modes.
+const (
+	// FanStandard balances noise and cooling.
+	FanStandard FanMode = 0
+	// FanFull runs all fans at full speed.
+	FanFull FanMode = 1
+	// FanOptimal runs the fans as slow as the temperatures allow.
+	FanOptimal FanMode = 2
+	// FanPUE optimizes for power usage effectiveness.
+	FanPUE FanMode = 3
+	// FanHeavyIO keeps the fans of the expansion slots faster.
+	FanHeavyIO FanMode = 4
+)
+
+var fanModes = []string{
+	FanStandard: "standard",
+	FanFull:     "full",
+	FanOptimal:  "optimal",
+	FanPUE:      "pue",
+	FanHeavyIO:  "heavy-io",
+}
+
+func (m FanMode) String() string {
+	if int(m) < len(fanModes) {
+		return fanModes[m]
+	}
+	return fmt.Sprintf("fan mode %d", byte(m))
+}
+
+// ParseFanMode parses a fan mode by name, as String returns it, or by
+// number.
+func ParseFanMode(s string) (FanMode, error) {
+	for m, name := range fanModes {
+		if strings.EqualFold(s, name) {
+			return FanMode(m), nil
+		}
+	}
+	if n, err := strconv.ParseUint(s, 0, 8); err == nil && int(n) < len(fanModes) {
+		return FanMode(n), nil
+	}
+	return 0, fmt.Errorf("unknown fan mode %q, want one of %s", s, strings.Join(fanModes, ", "))
+}
+
+// BMC sends Supermicro OEM commands to a BMC.
+type BMC struct {
+	IPMI *ipmi.IPMI
+}
+
+// New returns a BMC for the Supermicro BMC behind i.
+func New(i *ipmi.IPMI) *BMC {
+	return &BMC{IPMI: i}
+}
+
+// cmd sends command cmd of netfn with data, failing as op, and returns the
+// response data after the completion code.
+func (b *BMC) cmd(op string, netfn, cmd byte, data ...byte) ([]byte, error) {
+	resp, err := b.IPMI.RawCmd(append([]byte{netfn, cmd}, data...))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if len(resp) == 0 {
+		return nil, fmt.Errorf("%s: empty response", op)
+	}
+	if cc := ipmi.CompletionCode(resp[0]); cc != ipmi.CompletionOK {
+		return nil, &ipmi.CompletionError{Op: op, NetFn: netfn, Cmd: cmd, Code: cc}
+	}
+	return resp[1:], nil
+}
+
+// FanMode returns the fan mode.
+func (b *BMC) FanMode() (FanMode, error) {
+	data, err := b.cmd("GetFanMode", netfnOEM, cmdFanMode, fanModeGet)
+	if err != nil {
+		return 0, err
+	}
+	return decodeFanMode(data)
+}
+
+func decodeFanMode(data []byte) (FanMode, error) {
+	if len(data) < 1 {
+		return 0, errors.New("GetFanMode: no fan mode in the response")
+	}
+	return FanMode(data[0]), nil
+}
+
+// SetFanMode sets the fan mode to m. The BMC keeps it across restarts.
+func (b *BMC) SetFanMode(m FanMode) error {
+	_, err := b.cmd(fmt.Sprintf("SetFanMode(%v)", m), netfnOEM, cmdFanMode, fanModeSet, byte(m))
+	return err
+}
+
+// ResetToFactoryDefaults resets the configuration of the BMC, including
+// its network settings and users, to its factory defaults. The BMC
+// restarts, and may be unreachable over the network afterwards.
+func (b *BMC) ResetToFactoryDefaults() error {
+	_, err := b.cmd("ResetToFactoryDefaults", netfnOEMReset, cmdFactoryDefaults)
+	return err
+}
+
+// versionBlock returns the characters of block set of the System Firmware
+// Version parameter in a Get System Info Parameters response, and, for
+// the first block, the length of the version.
+func versionBlock(data []byte, set byte) ([]byte, int, error) {
+	// Parameter revision and set selector.
+	if len(data) < 3 {
+		return nil, 0, fmt.Errorf("BIOS version block %d is empty", set)
+	}
+	block := data[2:]
+	if len(block) > blockSize {
+		block = block[:blockSize]
+	}
+	if set != 0 {
+		return block, 0, nil
+	}
+	if len(block) < 2 {
+		return nil, 0, errors.New("BIOS version block 0 has no length")
+	}
+	// ASCII or UTF-8; UTF-16 is never used for versions.
+	if enc := block[0] & 0x0F; enc > 1 {
+		return nil, 0, fmt.Errorf("BIOS version has unsupported encoding %d", enc)
+	}
+	return block[2:], int(block[1]), nil
+}
+
+// BIOSVersion returns the version the BIOS reported to the BMC during the
+// last boot, as the System Firmware Version system info parameter.
+func (b *BMC) BIOSVersion() (string, error) {
+	var v []byte
+	n := -1
+	for set := 0; n < 0 || len(v) < n; set++ {
+		if set > 0xFF {
+			return "", errors.New("BIOS version is longer than its blocks")
+		}
+		op := fmt.Sprintf("GetSystemInfoParameters(%#02x, %d)", paramSystemFirmwareVersion, set)
+		data, err := b.cmd(op, netfnApp, cmdGetSystemInfo, 0, paramSystemFirmwareVersion, byte(set), 0)
+		if err != nil {
+			return "", err
+		}
+		block, length, err := versionBlock(data, byte(set))
+		if err != nil {
+			return "", err
+		}
+		if set == 0 {
+			n = length
+		}
+		v = append(v, block...)
+	}
+	return strings.TrimRight(string(v[:n]), "\x00 "), nil
+}
+
+// Extension is the OEM commands of Supermicro BMCs, as registered with
+// ipmi.RegisterOEMExtension.
+var Extension = &ipmi.OEMExtension{
+	Name: "Supermicro",
+	Commands: map[string]*ipmi.OEMCommand{
+		"fan-mode": {
+			NetFn: netfnOEM,
+			Cmd:   cmdFanMode,
+			Usage: "the fan mode",
+			Encode: func(args []string) ([]byte, error) {
+				if len(args) != 0 {
+					return nil, errors.New("takes no arguments")
+				}
+				return []byte{fanModeGet}, nil
+			},
+			Decode: func(data []byte) (interface{}, error) {
+				return decodeFanMode(data)
+			},
+		},
+		"set-fan-mode": {
+			NetFn: netfnOEM,
+			Cmd:   cmdFanMode,
+			Usage: "MODE: set the fan mode: " + strings.Join(fanModes, ", "),
+			Encode: func(args []string) ([]byte, error) {
+				if len(args) != 1 {
+					return nil, errors.New("want one fan mode")
+				}
+				m, err := ParseFanMode(args[0])
+				if err != nil {
+					return nil, err
+				}
+				return []byte{fanModeSet, byte(m)}, nil
+			},
+		},
+		"bios-version": {
+			NetFn: netfnApp,
+			Cmd:   cmdGetSystemInfo,
+			Usage: "the BIOS version, up to its first 14 characters",
+			Encode: func(args []string) ([]byte, error) {
+				if len(args) != 0 {
+					return nil, errors.New("takes no arguments")
+				}
+				return []byte{0, paramSystemFirmwareVersion, 0, 0}, nil
+			},
+			Decode: func(data []byte) (interface{}, error) {
+				v, n, err := versionBlock(data, 0)
+				if err != nil {
+					return nil, err
+				}
+				if n < len(v) {
+					v = v[:n]
+				}
+				return strings.TrimRight(string(v), "\x00 "), nil
+			},
+		},
+		"factory-reset": {
+			NetFn: netfnOEMReset,
+			Cmd:   cmdFactoryDefaults,
+			Usage: "reset the BMC, including its network settings and users, to its factory defaults",
+		},
+	},
+}
+
+func init() {
+	ipmi.RegisterOEMExtension(ipmi.ManufacturerSupermicro, Extension)
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package supermicro
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/ipmi"
+	"github.com/u-root/u-root/pkg/ipmi/ipmitest"
+)
+
+// newBMC returns a fake Supermicro BMC that keeps a fan mode and reports a
+// BIOS version of two blocks.
+func newBMC() (*ipmitest.BMC, *BMC) {
+	f := ipmitest.New()
+	// Get Device ID of manufacturer 10876.
+	f.Respond(netfnApp, 0x01, 0x20, 1, 1, 0x12, 0x02, 0, 0x7C, 0x2A, 0x00, 0, 0, 0, 0, 0, 0)
+
+	mode := FanOptimal
+	f.Handle(netfnOEM, cmdFanMode, func(data []byte) ([]byte, error) {
+		switch {
+		case len(data) == 1 && data[0] == fanModeGet:
+			return []byte{0, byte(mode)}, nil
+		case len(data) == 2 && data[0] == fanModeSet && data[1] <= byte(FanHeavyIO):
+			mode = FanMode(data[1])
+			return []byte{0}, nil
+		}
+		return []byte{0xCC}, nil
+	})
+
+	version := "BIOS 3.4 (build 20200917)"
+	f.Handle(netfnApp, cmdGetSystemInfo, func(data []byte) ([]byte, error) {
+		if len(data) != 4 || data[1] != paramSystemFirmwareVersion {
+			return []byte{0xCC}, nil
+		}
+		s := append([]byte{0, byte(len(version))}, version...)
+		s = append(s, make([]byte, 2*blockSize-len(s))...)
+		set := int(data[2])
+		if set > 1 {
+			return []byte{0xCC}, nil
+		}
+		return append([]byte{0, 0x11, byte(set)}, s[set*blockSize:(set+1)*blockSize]...), nil
+	})
+	f.Respond(netfnOEMReset, cmdFactoryDefaults)
+	return f, New(f.IPMI())
+}
+
+func isInvalidData(err error) bool {
+	cc, ok := ipmi.Completion(err)
+	return ok && cc == ipmi.CompletionInvalidDataField
+}
+
+func TestFanMode(t *testing.T) {
+	_, b := newBMC()
+	if m, err := b.FanMode(); err != nil || m != FanOptimal {
+		t.Errorf("FanMode = %v, %v, want optimal", m, err)
+	}
+	if err := b.SetFanMode(FanFull); err != nil {
+		t.Fatal(err)
+	}
+	if m, err := b.FanMode(); err != nil || m != FanFull {
+		t.Errorf("FanMode after SetFanMode(full) = %v, %v, want full", m, err)
+	}
+	if err := b.SetFanMode(9); !isInvalidData(err) {
+		t.Errorf("SetFanMode(9) = %v, want Invalid Data Field", err)
+	}
+
+	for _, tt := range []struct {
+		in   string
+		want FanMode
+		ok   bool
+	}{
+		{"standard", FanStandard, true},
+		{"Heavy-IO", FanHeavyIO, true},
+		{"3", FanPUE, true},
+		{"5", 0, false},
+		{"quiet", 0, false},
+	} {
+		if m, err := ParseFanMode(tt.in); m != tt.want || (err == nil) != tt.ok {
+			t.Errorf("ParseFanMode(%q) = %v, %v, want %v", tt.in, m, err, tt.want)
+		}
+	}
+}
+
+func TestBIOSVersion(t *testing.T) {
+	_, b := newBMC()
+	if v, err := b.BIOSVersion(); err != nil || v != "BIOS 3.4 (build 20200917)" {
+		t.Errorf("BIOSVersion = %q, %v", v, err)
+	}
+}
+
+func TestFactoryDefaults(t *testing.T) {
+	f, b := newBMC()
+	if err := b.ResetToFactoryDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	reqs := f.Requests()
+	if got := reqs[len(reqs)-1]; got.NetFn != netfnOEMReset || got.Cmd != cmdFactoryDefaults || len(got.Data) != 0 {
+		t.Errorf("request = %+v, want 3c 40", got)
+	}
+}
+
+func TestExtension(t *testing.T) {
+	_, b := newBMC()
+	for _, tt := range []struct {
+		args []string
+		want interface{}
+	}{
+		{[]string{"set-fan-mode", "heavy-io"}, []byte{}},
+		{[]string{"fan-mode"}, FanHeavyIO},
+		{[]string{"bios-version"}, "BIOS 3.4 (buil"},
+	} {
+		v, err := b.IPMI.RunOEMCommand(tt.args[0], tt.args[1:]...)
+		if err != nil || !reflect.DeepEqual(v, tt.want) {
+			t.Errorf("RunOEMCommand(%q) = %#v, %v, want %#v", tt.args, v, err, tt.want)
+		}
+	}
+	if _, err := b.IPMI.RunOEMCommand("set-fan-mode", "quiet"); err == nil {
+		t.Error("RunOEMCommand(set-fan-mode quiet) did not fail")
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"bytes"
+	"fmt"
+	"unsafe"
+)
+
+// User IDs are 1 to 63. User 1 is the null user, without a name.
+const (
+	maxUserID       = 63
+	userNameLen     = 16
+	userPasswordLen = 16
+	// Passwords of more than 16 bytes are IPMI v2.0 only, and cannot be
+	// used in IPMI v1.5 sessions.
+	userPassword20Len = 20
+)
+
+// Set User Password operations.
+const (
+	userDisable      = 0x00
+	userEnable       = 0x01
+	userSetPassword  = 0x02
+	userTestPassword = 0x03
+
+	userPassword20 = 0x80
+)
+
+// Set User Password completion codes of the test operation.
+const (
+	ccPasswordMismatch CompletionCode = 0x80
+	ccPasswordSize     CompletionCode = 0x81
+)
+
+// UserStatus is whether a user is enabled, as Set User Password left it.
+type UserStatus byte
+
+// User statuses.
+const (
+	UserStatusUnspecified UserStatus = 0
+	UserEnabled           UserStatus = 1
+	UserDisabled          UserStatus = 2
+)
+
+func (s UserStatus) String() string {
+	switch s {
+	case UserStatusUnspecified:
+		return "unspecified"
+	case UserEnabled:
+		return "enabled"
+	case UserDisabled:
+		return "disabled"
+	}
+	return fmt.Sprintf("UserStatus(%d)", byte(s))
+}
+
+// UserAccess is a user's access to a channel.
+type UserAccess struct {
+	// MaxUsers, EnabledUsers and FixedNames count the users of the
+	// channel; SetUserAccess ignores them and Status.
+	MaxUsers     byte
+	EnabledUsers byte
+	FixedNames   byte
+	Status       UserStatus
+
+	// CallbackOnly restricts the user to callback connections.
+	CallbackOnly bool
+	// LinkAuth enables the user for link authentication, e.g. PPP.
+	LinkAuth bool
+	// IPMIMessaging enables the user for IPMI sessions.
+	IPMIMessaging bool
+	// Privilege is the highest privilege the user may have on the
+	// channel, or PrivilegeNoAccess.
+	Privilege Privilege
+}
+
+func checkUserID(op string, user byte) error {
+	if user < 1 || user > maxUserID {
+		return fmt.Errorf("%s: user ID %d is not within [1, %d]", op, user, maxUserID)
+	}
+	return nil
+}
+
+// GetUserAccess returns the access of user to channel.
+func (i *IPMI) GetUserAccess(channel, user byte) (*UserAccess, error) {
+	if err := checkUserID("GetUserAccess", user); err != nil {
+		return nil, err
+	}
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_APP
+	req.msg.cmd = _BMC_GET_USER_ACCESS
+
+	data := [2]byte{channel & 0x0F, user}
+	req.msg.data = unsafe.Pointer(&data[0])
+	req.msg.dataLen = 2
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return nil, err
+	}
+	op := fmt.Sprintf("GetUserAccess(%d, %d)", channel, user)
+	if err := req.completion(op, recv); err != nil {
+		return nil, err
+	}
+	if len(recv) < 5 {
+		return nil, fmt.Errorf("%s: short response of %d bytes", op, len(recv))
+	}
+	return &UserAccess{
+		MaxUsers:      recv[1] & 0x3F,
+		EnabledUsers:  recv[2] & 0x3F,
+		Status:        UserStatus(recv[2] >> 6),
+		FixedNames:    recv[3] & 0x3F,
+		CallbackOnly:  recv[4]&0x40 != 0,
+		LinkAuth:      recv[4]&0x20 != 0,
+		IPMIMessaging: recv[4]&0x10 != 0,
+		Privilege:     Privilege(recv[4] & 0x0F),
+	}, nil
+}
+
+// SetUserAccess sets the access of user to channel.
+func (i *IPMI) SetUserAccess(channel, user byte, a UserAccess) error {
+	if err := checkUserID("SetUserAccess", user); err != nil {
+		return err
+	}
+	if a.Privilege > PrivilegeOEM && a.Privilege != PrivilegeNoAccess {
+		return fmt.Errorf("SetUserAccess: invalid privilege %v", a.Privilege)
+	}
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_APP
+	req.msg.cmd = _BMC_SET_USER_ACCESS
+
+	var data [3]byte
+	// Change the bits below.
+	data[0] = 0x80 | channel&0x0F
+	if a.CallbackOnly {
+		data[0] |= 0x40
+	}
+	if a.LinkAuth {
+		data[0] |= 0x20
+	}
+	if a.IPMIMessaging {
+		data[0] |= 0x10
+	}
+	data[1] = user
+	data[2] = byte(a.Privilege)
+	req.msg.data = unsafe.Pointer(&data[0])
+	req.msg.dataLen = 3
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return err
+	}
+	return req.completion(fmt.Sprintf("SetUserAccess(%d, %d)", channel, user), recv)
+}
+
+// GetUserName returns the name of user, "" if it has none.
+func (i *IPMI) GetUserName(user byte) (string, error) {
+	if err := checkUserID("GetUserName", user); err != nil {
+		return "", err
+	}
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_APP
+	req.msg.cmd = _BMC_GET_USER_NAME
+
+	req.msg.data = unsafe.Pointer(&user)
+	req.msg.dataLen = 1
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return "", err
+	}
+	op := fmt.Sprintf("GetUserName(%d)", user)
+	if err := req.completion(op, recv); err != nil {
+		return "", err
+	}
+	if len(recv) < 1+userNameLen {
+		return "", fmt.Errorf("%s: short response of %d bytes", op, len(recv))
+	}
+	name := recv[1 : 1+userNameLen]
+	if n := bytes.IndexByte(name, 0); n >= 0 {
+		name = name[:n]
+	}
+	return string(name), nil
+}
+
+// SetUserName sets the name of user, of at most 16 bytes. Some users have
+// fixed names, the null user among them.
+func (i *IPMI) SetUserName(user byte, name string) error {
+	if err := checkUserID("SetUserName", user); err != nil {
+		return err
+	}
+	if len(name) > userNameLen {
+		return fmt.Errorf("SetUserName: name %q is longer than %d bytes", name, userNameLen)
+	}
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_APP
+	req.msg.cmd = _BMC_SET_USER_NAME
+
+	var data [1 + userNameLen]byte
+	data[0] = user
+	copy(data[1:], name)
+	req.msg.data = unsafe.Pointer(&data[0])
+	req.msg.dataLen = uint16(len(data))
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return err
+	}
+	return req.completion(fmt.Sprintf("SetUserName(%d)", user), recv)
+}
+
+// setUserPassword sends Set User Password, with password padded to size if
+// it is not "".
+func (i *IPMI) setUserPassword(user, op byte, password string, size int) error {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_APP
+	req.msg.cmd = _BMC_SET_USER_PASSWORD
+
+	data := make([]byte, 2, 2+userPassword20Len)
+	data[0] = user
+	if size == userPassword20Len {
+		data[0] |= userPassword20
+	}
+	data[1] = op
+	if op == userSetPassword || op == userTestPassword {
+		p := make([]byte, size)
+		copy(p, password)
+		data = append(data, p...)
+	}
+	req.msg.data = unsafe.Pointer(&data[0])
+	req.msg.dataLen = uint16(len(data))
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return err
+	}
+	return req.completion(fmt.Sprintf("SetUserPassword(%d)", user), recv)
+}
+
+// passwordSize returns the size password is stored as: 16 bytes if it fits,
+// 20 otherwise.
+func passwordSize(password string) (int, error) {
+	switch {
+	case len(password) <= userPasswordLen:
+		return userPasswordLen, nil
+	case len(password) <= userPassword20Len:
+		return userPassword20Len, nil
+	}
+	return 0, fmt.Errorf("password is longer than %d bytes", userPassword20Len)
+}
+
+// SetUserPassword sets the password of user. Passwords of up to 16 bytes
+// are stored as 16, for IPMI v1.5 sessions too; longer ones, of up to 20,
+// need an IPMI v2.0 BMC.
+func (i *IPMI) SetUserPassword(user byte, password string) error {
+	if err := checkUserID("SetUserPassword", user); err != nil {
+		return err
+	}
+	size, err := passwordSize(password)
+	if err != nil {
+		return fmt.Errorf("SetUserPassword: %v", err)
+	}
+	err = i.setUserPassword(user, userSetPassword, password, size)
+	if size == userPassword20Len && tooLarge(err) {
+		return fmt.Errorf("BMC does not support 20 byte passwords: %w", err)
+	}
+	return err
+}
+
+// TestUserPassword returns whether password is the password of user. It
+// is tested as SetUserPassword stores it and, if the BMC has a 20 byte
+// password for user, as 20 bytes.
+func (i *IPMI) TestUserPassword(user byte, password string) (bool, error) {
+	if err := checkUserID("TestUserPassword", user); err != nil {
+		return false, err
+	}
+	size, err := passwordSize(password)
+	if err != nil {
+		return false, fmt.Errorf("TestUserPassword: %v", err)
+	}
+	err = i.setUserPassword(user, userTestPassword, password, size)
+	if size == userPasswordLen && isCompletion(err, ccPasswordSize) {
+		err = i.setUserPassword(user, userTestPassword, password, userPassword20Len)
+	}
+	switch {
+	case err == nil:
+		return true, nil
+	case isCompletion(err, ccPasswordMismatch, ccPasswordSize):
+		return false, nil
+	}
+	return false, err
+}
+
+// EnableUser enables or disables user.
+func (i *IPMI) EnableUser(user byte, enable bool) error {
+	if err := checkUserID("EnableUser", user); err != nil {
+		return err
+	}
+	op := byte(userDisable)
+	if enable {
+		op = userEnable
+	}
+	return i.setUserPassword(user, op, "", 0)
+}
+
+// SetupUser makes user a user of channel named name, with password and up
+// to priv privilege in IPMI sessions, and enables them: what provisioning
+// a BMC account takes.
+func (i *IPMI) SetupUser(channel, user byte, name, password string, priv Privilege) error {
+	if err := i.SetUserName(user, name); err != nil {
+		return err
+	}
+	if err := i.SetUserPassword(user, password); err != nil {
+		return err
+	}
+	if err := i.SetUserAccess(channel, user, UserAccess{LinkAuth: true, IPMIMessaging: true, Privilege: priv}); err != nil {
+		return err
+	}
+	return i.EnableUser(user, true)
+}
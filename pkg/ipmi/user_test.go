@@ -0,0 +1,154 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUserAccess(t *testing.T) {
+	f := &fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_APP, _BMC_GET_USER_ACCESS}: {0, 0x0A, 0x43, 0x01, 0x34},
+		{_IPMI_NETFN_APP, _BMC_SET_USER_ACCESS}: {0},
+	}}
+	i := &IPMI{Transport: f}
+
+	a, err := i.GetUserAccess(1, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := UserAccess{MaxUsers: 10, EnabledUsers: 3, Status: UserEnabled, FixedNames: 1, LinkAuth: true, IPMIMessaging: true, Privilege: PrivilegeAdmin}
+	if *a != want {
+		t.Errorf("GetUserAccess = %+v, want %+v", *a, want)
+	}
+	if err := i.SetUserAccess(1, 3, UserAccess{CallbackOnly: true, Privilege: PrivilegeNoAccess}); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.SetUserAccess(1, 3, UserAccess{Privilege: 6}); err == nil {
+		t.Error("SetUserAccess of privilege 6 did not fail")
+	}
+	if _, err := i.GetUserAccess(1, 64); err == nil {
+		t.Error("GetUserAccess of user 64 did not fail")
+	}
+	reqs := [][]byte{
+		{_IPMI_NETFN_APP, _BMC_GET_USER_ACCESS, 1, 3},
+		{_IPMI_NETFN_APP, _BMC_SET_USER_ACCESS, 0xC1, 3, 0x0F},
+	}
+	if !reflect.DeepEqual(f.requests, reqs) {
+		t.Errorf("requests = %#x, want %#x", f.requests, reqs)
+	}
+}
+
+func TestUserName(t *testing.T) {
+	f := &fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_APP, _BMC_GET_USER_NAME}: {0, 'a', 'd', 'm', 'i', 'n', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+		{_IPMI_NETFN_APP, _BMC_SET_USER_NAME}: {0},
+	}}
+	i := &IPMI{Transport: f}
+
+	if name, err := i.GetUserName(2); err != nil || name != "admin" {
+		t.Errorf("GetUserName = %q, %v, want admin", name, err)
+	}
+	if err := i.SetUserName(3, "root"); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.SetUserName(3, "a name of 17 byte"); err == nil {
+		t.Error("SetUserName of 17 bytes did not fail")
+	}
+	want := []byte{_IPMI_NETFN_APP, _BMC_SET_USER_NAME, 3, 'r', 'o', 'o', 't', 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	if got := f.requests[1]; !reflect.DeepEqual(got, want) {
+		t.Errorf("SetUserName sent %#x, want %#x", got, want)
+	}
+}
+
+func TestUserPassword(t *testing.T) {
+	// The BMC tests passwords against password, of size, and answers
+	// other Set User Password requests with cc.
+	password, size, cc := "secret", 16, byte(0)
+	f := &fakeTransport{}
+	f.handle(_IPMI_NETFN_APP, _BMC_SET_USER_PASSWORD, func(data []byte) []byte {
+		switch {
+		case data[1] != userTestPassword:
+			return []byte{cc}
+		case len(data)-2 != size:
+			return []byte{byte(ccPasswordSize)}
+		}
+		want := make([]byte, size)
+		copy(want, password)
+		if !reflect.DeepEqual(data[2:], want) {
+			return []byte{byte(ccPasswordMismatch)}
+		}
+		return []byte{0}
+	})
+	i := &IPMI{Transport: f}
+
+	if err := i.SetUserPassword(3, "secret"); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.SetUserPassword(3, "a password of 20 byt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.SetUserPassword(3, "a password of 21 byte"); err == nil {
+		t.Error("SetUserPassword of 21 bytes did not fail")
+	}
+	if got := f.requests[0][2]; got != 3 || len(f.requests[0]) != 4+16 {
+		t.Errorf("16 byte SetUserPassword sent %#x", f.requests[0])
+	}
+	if got := f.requests[1][2]; got != 0x83 || len(f.requests[1]) != 4+20 {
+		t.Errorf("20 byte SetUserPassword sent %#x", f.requests[1])
+	}
+
+	for _, tt := range []struct {
+		password string
+		size     int
+		test     string
+		want     bool
+	}{
+		{"secret", 16, "secret", true},
+		{"secret", 16, "wrong", false},
+		{"secret", 20, "secret", true},
+		{"a password of 20 byt", 20, "a password of 20 byt", true},
+		{"secret", 16, "a password of 20 byt", false},
+	} {
+		password, size = tt.password, tt.size
+		if ok, err := i.TestUserPassword(3, tt.test); err != nil || ok != tt.want {
+			t.Errorf("TestUserPassword(%q) of %d byte %q = %t, %v, want %t", tt.test, tt.size, tt.password, ok, err, tt.want)
+		}
+	}
+
+	// 16 byte only BMCs.
+	cc = byte(CompletionRequestDataLength)
+	if err := i.SetUserPassword(3, "a password of 20 byt"); err == nil || err.Error() != "BMC does not support 20 byte passwords: SetUserPassword(3): completion code 0xc7 (request data length invalid)" {
+		t.Errorf("SetUserPassword of 20 bytes = %v", err)
+	}
+}
+
+func TestSetupUser(t *testing.T) {
+	f := &fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_APP, _BMC_SET_USER_NAME}:     {0},
+		{_IPMI_NETFN_APP, _BMC_SET_USER_PASSWORD}: {0},
+		{_IPMI_NETFN_APP, _BMC_SET_USER_ACCESS}:   {0},
+	}}
+	i := &IPMI{Transport: &IPMI{Transport: f}}
+
+	if err := i.SetupUser(1, 3, "root", "secret", PrivilegeOperator); err != nil {
+		t.Fatal(err)
+	}
+	var cmds []byte
+	for _, r := range f.requests {
+		cmds = append(cmds, r[1])
+	}
+	want := []byte{_BMC_SET_USER_NAME, _BMC_SET_USER_PASSWORD, _BMC_SET_USER_ACCESS, _BMC_SET_USER_PASSWORD}
+	if !reflect.DeepEqual(cmds, want) {
+		t.Errorf("SetupUser sent %#x, want %#x", cmds, want)
+	}
+	if got := f.requests[2]; !reflect.DeepEqual(got, []byte{_IPMI_NETFN_APP, _BMC_SET_USER_ACCESS, 0xB1, 3, 3}) {
+		t.Errorf("SetupUser set access with %#x", got)
+	}
+	if got := f.requests[3]; !reflect.DeepEqual(got, []byte{_IPMI_NETFN_APP, _BMC_SET_USER_PASSWORD, 3, userEnable}) {
+		t.Errorf("SetupUser enabled with %#x", got)
+	}
+}
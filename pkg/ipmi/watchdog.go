@@ -0,0 +1,320 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+// WatchdogTimerUse says who uses the watchdog timer, IPMI v2.0 table 27-6.
+type WatchdogTimerUse byte
+
+// Watchdog timer uses.
+const (
+	WatchdogBIOSFRB2 WatchdogTimerUse = 1
+	WatchdogBIOSPOST WatchdogTimerUse = 2
+	WatchdogOSLoad   WatchdogTimerUse = 3
+	WatchdogSMSOS    WatchdogTimerUse = 4
+	WatchdogOEM      WatchdogTimerUse = 5
+)
+
+func (u WatchdogTimerUse) String() string {
+	switch u {
+	case WatchdogBIOSFRB2:
+		return "BIOS FRB2"
+	case WatchdogBIOSPOST:
+		return "BIOS/POST"
+	case WatchdogOSLoad:
+		return "OS Load"
+	case WatchdogSMSOS:
+		return "SMS/OS"
+	case WatchdogOEM:
+		return "OEM"
+	}
+	return fmt.Sprintf("Reserved (%d)", byte(u))
+}
+
+// WatchdogAction is what the BMC does when the watchdog timer expires.
+type WatchdogAction byte
+
+// Watchdog timeout actions.
+const (
+	WatchdogNoAction   WatchdogAction = 0
+	WatchdogHardReset  WatchdogAction = 1
+	WatchdogPowerDown  WatchdogAction = 2
+	WatchdogPowerCycle WatchdogAction = 3
+)
+
+func (a WatchdogAction) String() string {
+	switch a {
+	case WatchdogNoAction:
+		return "No action"
+	case WatchdogHardReset:
+		return "Hard Reset"
+	case WatchdogPowerDown:
+		return "Power Down"
+	case WatchdogPowerCycle:
+		return "Power Cycle"
+	}
+	return fmt.Sprintf("Reserved (%d)", byte(a))
+}
+
+// WatchdogInterrupt is the interrupt the BMC raises when the pre-timeout
+// interval of the watchdog timer starts.
+type WatchdogInterrupt byte
+
+// Watchdog pre-timeout interrupts.
+const (
+	WatchdogInterruptNone      WatchdogInterrupt = 0
+	WatchdogInterruptSMI       WatchdogInterrupt = 1
+	WatchdogInterruptNMI       WatchdogInterrupt = 2
+	WatchdogInterruptMessaging WatchdogInterrupt = 3
+)
+
+func (i WatchdogInterrupt) String() string {
+	switch i {
+	case WatchdogInterruptNone:
+		return "None"
+	case WatchdogInterruptSMI:
+		return "SMI"
+	case WatchdogInterruptNMI:
+		return "NMI / Diagnostic Interrupt"
+	case WatchdogInterruptMessaging:
+		return "Messaging Interrupt"
+	}
+	return fmt.Sprintf("Reserved (%d)", byte(i))
+}
+
+// The countdown counts in 100ms, the pre-timeout interval in seconds.
+const (
+	watchdogTick        = 100 * time.Millisecond
+	maxWatchdogCount    = 0xFFFF * watchdogTick
+	maxWatchdogPreTime  = 0xFF * time.Second
+	watchdogDontLog     = 0x80
+	watchdogRunning     = 0x40
+	watchdogUseMask     = 0x07
+	watchdogActionMask  = 0x07
+	watchdogInterruptSh = 4
+)
+
+// WatchdogConfig is the configuration and state of the watchdog timer.
+type WatchdogConfig struct {
+	Use WatchdogTimerUse
+	// DontLog keeps the BMC from logging the expiration in the SEL.
+	DontLog bool
+	// Running is set if the timer is counting down. SetWatchdog keeps a
+	// running timer running with the new settings if it is set, and
+	// stops it otherwise.
+	Running bool
+
+	Action           WatchdogAction
+	PreTimeoutAction WatchdogInterrupt
+	// PreTimeout is how long before the timeout the pre-timeout
+	// interrupt is raised, in seconds, up to 255.
+	PreTimeout time.Duration
+
+	// Expired has bit u set for each timer use u the timer expired in
+	// since the bit was cleared. SetWatchdog clears the bits set.
+	Expired byte
+
+	// Countdown is what the timer counts down from, in 100ms, up to
+	// 6553.5s.
+	Countdown time.Duration
+	// Remaining is what is left of the countdown. SetWatchdog ignores it.
+	Remaining time.Duration
+}
+
+// Expiration reports whether the timer expired in use u.
+func (c *WatchdogConfig) Expiration(u WatchdogTimerUse) bool {
+	return c.Expired&(1<<u) != 0
+}
+
+func (c *WatchdogConfig) marshal() ([6]byte, error) {
+	var data [6]byte
+	if c.Use < WatchdogBIOSFRB2 || c.Use > WatchdogOEM {
+		return data, fmt.Errorf("invalid watchdog timer use %v", c.Use)
+	}
+	if c.Action > WatchdogPowerCycle {
+		return data, fmt.Errorf("invalid watchdog action %v", c.Action)
+	}
+	if c.PreTimeoutAction > WatchdogInterruptMessaging {
+		return data, fmt.Errorf("invalid watchdog pre-timeout interrupt %v", c.PreTimeoutAction)
+	}
+	if c.Countdown < 0 || c.Countdown > maxWatchdogCount {
+		return data, fmt.Errorf("watchdog countdown %v is not within [0, %v]", c.Countdown, maxWatchdogCount)
+	}
+	if c.PreTimeout < 0 || c.PreTimeout > maxWatchdogPreTime {
+		return data, fmt.Errorf("watchdog pre-timeout %v is not within [0, %v]", c.PreTimeout, maxWatchdogPreTime)
+	}
+	if c.PreTimeoutAction != WatchdogInterruptNone && c.PreTimeout >= c.Countdown {
+		return data, fmt.Errorf("watchdog pre-timeout %v is not shorter than the countdown %v", c.PreTimeout, c.Countdown)
+	}
+
+	data[0] = byte(c.Use)
+	if c.DontLog {
+		data[0] |= watchdogDontLog
+	}
+	if c.Running {
+		data[0] |= watchdogRunning
+	}
+	data[1] = byte(c.PreTimeoutAction)<<watchdogInterruptSh | byte(c.Action)
+	data[2] = byte(c.PreTimeout / time.Second)
+	// Bits 0, 6 and 7 are reserved.
+	data[3] = c.Expired & 0x3E
+	count := uint16(c.Countdown / watchdogTick)
+	data[4] = byte(count)
+	data[5] = byte(count >> 8)
+	return data, nil
+}
+
+func unmarshalWatchdogConfig(b []byte) *WatchdogConfig {
+	return &WatchdogConfig{
+		Use:              WatchdogTimerUse(b[0] & watchdogUseMask),
+		DontLog:          b[0]&watchdogDontLog != 0,
+		Running:          b[0]&watchdogRunning != 0,
+		Action:           WatchdogAction(b[1] & watchdogActionMask),
+		PreTimeoutAction: WatchdogInterrupt(b[1] >> watchdogInterruptSh & 0x07),
+		PreTimeout:       time.Duration(b[2]) * time.Second,
+		Expired:          b[3] & 0x3E,
+		Countdown:        time.Duration(uint16(b[4])|uint16(b[5])<<8) * watchdogTick,
+		Remaining:        time.Duration(uint16(b[6])|uint16(b[7])<<8) * watchdogTick,
+	}
+}
+
+// GetWatchdog returns the configuration and state of the watchdog timer.
+func (i *IPMI) GetWatchdog() (*WatchdogConfig, error) {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_APP
+	req.msg.cmd = _BMC_GET_WATCHDOG_TIMER
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := req.completion("GetWatchdog", recv); err != nil {
+		return nil, err
+	}
+	if len(recv) < 9 {
+		return nil, fmt.Errorf("GetWatchdog: short response of %d bytes", len(recv))
+	}
+	return unmarshalWatchdogConfig(recv[1:]), nil
+}
+
+// SetWatchdog configures the watchdog timer. It stops the timer unless
+// c.Running is set and the timer is running; Reset Watchdog Timer starts
+// it.
+func (i *IPMI) SetWatchdog(c *WatchdogConfig) error {
+	data, err := c.marshal()
+	if err != nil {
+		return fmt.Errorf("SetWatchdog: %v", err)
+	}
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_APP
+	req.msg.cmd = _BMC_SET_WATCHDOG_TIMER
+	req.msg.data = unsafe.Pointer(&data[0])
+	req.msg.dataLen = uint16(len(data))
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return err
+	}
+	return req.completion("SetWatchdog", recv)
+}
+
+// ccWatchdogUninitialized is Reset Watchdog Timer's completion code for a
+// timer Set Watchdog Timer has not set up.
+const ccWatchdogUninitialized CompletionCode = 0x80
+
+// ResetWatchdog restarts the watchdog timer from its countdown, starting it
+// if it is stopped.
+func (i *IPMI) ResetWatchdog() error {
+	req := &req{}
+	req.msg.netfn = _IPMI_NETFN_APP
+	req.msg.cmd = _BMC_RESET_WATCHDOG_TIMER
+
+	recv, err := i.sendrecv(req)
+	if err != nil {
+		return err
+	}
+	err = req.completion("ResetWatchdog", recv)
+	if isCompletion(err, ccWatchdogUninitialized) {
+		return fmt.Errorf("the watchdog timer is not set up: %w", err)
+	}
+	return err
+}
+
+// StartWatchdogPetter starts the watchdog timer, as SetWatchdog set it up,
+// and resets it every interval until ctx is done, so that the BMC acts if
+// what runs meanwhile hangs, as in
+//
+//	ctx, cancel := context.WithCancel(context.Background())
+//	if _, err := i.StartWatchdogPetter(ctx, 10*time.Second); err != nil {
+//		return err
+//	}
+//	err := flash()
+//	cancel()
+//	i.ShutoffWatchdog()
+//
+// It returns once the timer runs, or an error if interval is not shorter
+// than its countdown. Errors resetting the timer are sent on the returned
+// channel if it has room, and resetting goes on; the channel is closed
+// once it stops. The timer is left running when ctx is done, for the next
+// stage to take over or ShutoffWatchdog to stop.
+func (i *IPMI) StartWatchdogPetter(ctx context.Context, interval time.Duration) (<-chan error, error) {
+	c, err := i.WithContext(ctx).GetWatchdog()
+	if err != nil {
+		return nil, err
+	}
+	if interval <= 0 || interval >= c.Countdown {
+		return nil, fmt.Errorf("watchdog reset interval %v is not within (0, %v)", interval, c.Countdown)
+	}
+	if err := i.WithContext(ctx).ResetWatchdog(); err != nil {
+		return nil, err
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+			}
+			if err := i.WithContext(ctx).ResetWatchdog(); err != nil && ctx.Err() == nil {
+				select {
+				case errs <- err:
+				default:
+				}
+			}
+		}
+	}()
+	return errs, nil
+}
+
+// WatchdogRunning reports whether the watchdog timer is running.
+func (i *IPMI) WatchdogRunning() (bool, error) {
+	c, err := i.GetWatchdog()
+	if err != nil {
+		return false, err
+	}
+	return c.Running, nil
+}
+
+// ShutoffWatchdog stops the watchdog timer, leaving it set up for the OS
+// with no action and the SMS/OS expiration cleared.
+func (i *IPMI) ShutoffWatchdog() error {
+	return i.SetWatchdog(&WatchdogConfig{
+		Use:       WatchdogSMSOS,
+		Action:    WatchdogNoAction,
+		Expired:   1 << WatchdogSMSOS,
+		Countdown: 5 * time.Minute,
+	})
+}
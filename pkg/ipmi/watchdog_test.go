@@ -0,0 +1,138 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package ipmi
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGetWatchdog(t *testing.T) {
+	f := &fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_APP, _BMC_GET_WATCHDOG_TIMER}: {0, 0x44, 0x23, 10, 0x10, 0x58, 0x02, 0x2c, 0x01},
+	}}
+	i := &IPMI{Transport: f}
+
+	c, err := i.GetWatchdog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &WatchdogConfig{
+		Use:              WatchdogSMSOS,
+		Running:          true,
+		Action:           WatchdogPowerCycle,
+		PreTimeoutAction: WatchdogInterruptNMI,
+		PreTimeout:       10 * time.Second,
+		Expired:          0x10,
+		Countdown:        time.Minute,
+		Remaining:        30 * time.Second,
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("GetWatchdog = %+v, want %+v", c, want)
+	}
+	if !c.Expiration(WatchdogSMSOS) || c.Expiration(WatchdogOSLoad) {
+		t.Errorf("Expiration of SMS/OS and OS Load = %t, %t, want true, false", c.Expiration(WatchdogSMSOS), c.Expiration(WatchdogOSLoad))
+	}
+	if ok, err := i.WatchdogRunning(); err != nil || !ok {
+		t.Errorf("WatchdogRunning = %t, %v, want true", ok, err)
+	}
+}
+
+func TestSetWatchdog(t *testing.T) {
+	f := &fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_APP, _BMC_SET_WATCHDOG_TIMER}: {0},
+	}}
+	i := &IPMI{Transport: f}
+
+	if err := i.ShutoffWatchdog(); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.SetWatchdog(&WatchdogConfig{
+		Use:              WatchdogOSLoad,
+		DontLog:          true,
+		Action:           WatchdogHardReset,
+		PreTimeoutAction: WatchdogInterruptSMI,
+		PreTimeout:       5 * time.Second,
+		Expired:          0xFF,
+		Countdown:        6553500 * time.Millisecond,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	reqs := [][]byte{
+		{_IPMI_NETFN_APP, _BMC_SET_WATCHDOG_TIMER, 0x04, 0x00, 0x00, 0x10, 0xb8, 0x0b},
+		{_IPMI_NETFN_APP, _BMC_SET_WATCHDOG_TIMER, 0x83, 0x11, 5, 0x3e, 0xff, 0xff},
+	}
+	if !reflect.DeepEqual(f.requests, reqs) {
+		t.Errorf("requests = %#x, want %#x", f.requests, reqs)
+	}
+
+	for _, c := range []WatchdogConfig{
+		{Countdown: time.Minute},
+		{Use: WatchdogSMSOS, Action: 4, Countdown: time.Minute},
+		{Use: WatchdogSMSOS, PreTimeoutAction: 4, Countdown: time.Minute},
+		{Use: WatchdogSMSOS, Countdown: 2 * time.Hour},
+		{Use: WatchdogSMSOS, PreTimeout: 5 * time.Minute, Countdown: time.Hour},
+		{Use: WatchdogSMSOS, PreTimeoutAction: WatchdogInterruptNMI, PreTimeout: time.Minute, Countdown: time.Minute},
+	} {
+		if err := i.SetWatchdog(&c); err == nil {
+			t.Errorf("SetWatchdog(%+v) did not fail", c)
+		}
+	}
+	if len(f.requests) != 2 {
+		t.Errorf("invalid configurations were sent: %#x", f.requests[2:])
+	}
+}
+
+func TestStartWatchdogPetter(t *testing.T) {
+	f := &fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_APP, _BMC_GET_WATCHDOG_TIMER}: {0, 0x04, 0x01, 0, 0, 0x58, 0x02, 0x58, 0x02},
+	}}
+	// The BMC counts the resets of the watchdog timer, failing those
+	// after the second.
+	resets := make(chan int, 10)
+	var count int
+	f.handle(_IPMI_NETFN_APP, _BMC_RESET_WATCHDOG_TIMER, func([]byte) []byte {
+		count++
+		select {
+		case resets <- count:
+		default:
+		}
+		if count > 2 {
+			return []byte{byte(CompletionNodeBusy)}
+		}
+		return []byte{0}
+	})
+	i := &IPMI{Transport: f}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	if _, err := i.StartWatchdogPetter(ctx, time.Minute); err == nil {
+		t.Error("StartWatchdogPetter with an interval of the countdown did not fail")
+	}
+	errs, err := i.StartWatchdogPetter(ctx, time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// It starts the timer, then resets it, also after it fails to.
+	for n := 0; n < 4; {
+		n = <-resets
+	}
+	if err := <-errs; !isCompletion(err, CompletionNodeBusy) {
+		t.Errorf("reset error = %v, want node busy", err)
+	}
+	cancel()
+	for range errs {
+	}
+
+	i = &IPMI{Transport: &fakeTransport{responses: map[[2]byte][]byte{
+		{_IPMI_NETFN_APP, _BMC_GET_WATCHDOG_TIMER}:   {0, 0x04, 0x01, 0, 0, 0x58, 0x02, 0, 0},
+		{_IPMI_NETFN_APP, _BMC_RESET_WATCHDOG_TIMER}: {byte(ccWatchdogUninitialized)},
+	}}}
+	if _, err := i.StartWatchdogPetter(context.Background(), time.Second); err == nil || err.Error() != "the watchdog timer is not set up: ResetWatchdog: completion code 0x80 (command-specific completion code)" {
+		t.Errorf("StartWatchdogPetter of a timer not set up = %v", err)
+	}
+}
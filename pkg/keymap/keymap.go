@@ -0,0 +1,372 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package keymap loads keyboard layouts into the Linux console, like a
+// small loadkeys.
+//
+// Keymaps are in the loadkeys format, of which it understands
+//
+//	# comments, and ! comments
+//	include "us"
+//	keymaps 0-2,4
+//	keycode 16 = q Q at
+//	altgr keycode 18 = EuroSign
+//
+// with keysyms named as loadkeys names them, U+20AC, or as a character.
+// An include only includes the layouts built in, which Layouts lists.
+// Everything else loadkeys knows, such as strings and compose, is an
+// error.
+package keymap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Table is a keymap table, for a combination of modifiers held down.
+type Table uint8
+
+// Modifiers, which add up to a Table.
+const (
+	Plain   Table = 0
+	Shift   Table = 1
+	AltGr   Table = 2
+	Control Table = 4
+	Alt     Table = 8
+)
+
+// Key is a key, by kernel keycode, in a Table.
+type Key struct {
+	Table Table
+	Code  uint8
+}
+
+// Keymap is what keys do: their kernel keysym values, as in linux/keyboard.h,
+// in each Table. Keys it does not have are left alone by Load.
+type Keymap struct {
+	Keys map[Key]uint16
+}
+
+// Kernel keysym types, linux/keyboard.h.
+const (
+	ktLatin  = 0
+	ktSpec   = 2
+	ktShift  = 7
+	ktLetter = 11
+	ktDead   = 13
+
+	// Keysyms with a type from ktUnicode on are Unicode characters,
+	// xor 0xF000.
+	ktUnicode = 0x10
+)
+
+func keysym(typ, val int) uint16 {
+	return uint16(typ<<8 | val)
+}
+
+// names of keysyms that are not characters.
+var names = map[string]uint16{
+	"VoidSymbol":      keysym(ktSpec, 0),
+	"AltGr":           keysym(ktShift, 1),
+	"Alt":             keysym(ktShift, 3),
+	"dead_grave":      keysym(ktDead, 0),
+	"dead_acute":      keysym(ktDead, 1),
+	"dead_circumflex": keysym(ktDead, 2),
+	"dead_tilde":      keysym(ktDead, 3),
+	"dead_diaeresis":  keysym(ktDead, 4),
+	"dead_cedilla":    keysym(ktDead, 5),
+}
+
+// Names of ASCII from space, and of Latin-1 from no-break space. Letters
+// are named as themselves.
+const (
+	asciiNames = `space exclam quotedbl numbersign dollar percent ampersand
+		apostrophe parenleft parenright asterisk plus comma minus period slash
+		zero one two three four five six seven eight nine colon semicolon less
+		equal greater question at A B C D E F G H I J K L M N O P Q R S T U V W
+		X Y Z bracketleft backslash bracketright asciicircum underscore grave a
+		b c d e f g h i j k l m n o p q r s t u v w x y z braceleft bar
+		braceright asciitilde`
+	latin1Names = `nobreakspace exclamdown cent sterling currency yen brokenbar
+		section diaeresis copyright ordfeminine guillemotleft notsign hyphen
+		registered macron degree plusminus twosuperior threesuperior acute mu
+		paragraph periodcentered cedilla onesuperior masculine guillemotright
+		onequarter onehalf threequarters questiondown Agrave Aacute Acircumflex
+		Atilde Adiaeresis Aring AE Ccedilla Egrave Eacute Ecircumflex Ediaeresis
+		Igrave Iacute Icircumflex Idiaeresis ETH Ntilde Ograve Oacute
+		Ocircumflex Otilde Odiaeresis multiply Ooblique Ugrave Uacute
+		Ucircumflex Udiaeresis Yacute THORN ssharp agrave aacute acircumflex
+		atilde adiaeresis aring ae ccedilla egrave eacute ecircumflex
+		ediaeresis igrave iacute icircumflex idiaeresis eth ntilde ograve
+		oacute ocircumflex otilde odiaeresis division oslash ugrave uacute
+		ucircumflex udiaeresis yacute thorn ydiaeresis`
+)
+
+// runes are the characters keysyms are named after.
+var runes = map[string]rune{
+	"EuroSign": '€',
+}
+
+func init() {
+	for i, n := range strings.Fields(asciiNames) {
+		runes[n] = ' ' + rune(i)
+	}
+	for i, n := range strings.Fields(latin1Names) {
+		runes[n] = 0xA0 + rune(i)
+	}
+	for c := 'a'; c <= 'z'; c++ {
+		names["Control_"+string(c)] = keysym(ktLatin, int(c-'a'+1))
+	}
+}
+
+// runeKeysym is the keysym that types r. Characters beyond Latin-1 are
+// Unicode keysyms, which the kernel only takes in Unicode mode. Those
+// beyond the Basic Multilingual Plane cannot be typed.
+func runeKeysym(r rune) uint16 {
+	switch {
+	case r < 0x100 && unicode.IsLetter(r):
+		return keysym(ktLetter, int(r))
+	case r < 0x100:
+		return keysym(ktLatin, int(r))
+	default:
+		return uint16(r) ^ 0xF000
+	}
+}
+
+// parseKeysym parses a keysym as a name, U+ code point or character.
+func parseKeysym(s string) (uint16, error) {
+	if v, ok := names[s]; ok {
+		return v, nil
+	}
+	if r, ok := runes[strings.TrimPrefix(s, "+")]; ok {
+		return runeKeysym(r), nil
+	}
+	if strings.HasPrefix(s, "U+") {
+		r, err := strconv.ParseUint(s[2:], 16, 16)
+		if err != nil {
+			return 0, fmt.Errorf("bad keysym %q", s)
+		}
+		return runeKeysym(rune(r)), nil
+	}
+	if r, n := utf8.DecodeRuneInString(s); n == len(s) && r != utf8.RuneError && r <= 0xFFFF && unicode.IsPrint(r) {
+		return runeKeysym(r), nil
+	}
+	return 0, fmt.Errorf("unknown keysym %q", s)
+}
+
+// Rune returns the character k types, if it types one.
+func (m *Keymap) Rune(k Key) (rune, bool) {
+	v, ok := m.Keys[k]
+	if !ok {
+		return 0, false
+	}
+	switch t := v >> 8; {
+	case t == ktLatin || t == ktLetter:
+		return rune(v & 0xFF), true
+	case t >= ktUnicode:
+		return rune(v ^ 0xF000), true
+	}
+	return 0, false
+}
+
+// modifierNames are the modifiers before keycode in a line.
+var modifierNames = map[string]Table{
+	"plain":   Plain,
+	"shift":   Shift,
+	"altgr":   AltGr,
+	"control": Control,
+	"alt":     Alt,
+}
+
+// Parse parses a keymap.
+func Parse(r io.Reader) (*Keymap, error) {
+	m := &Keymap{Keys: make(map[Key]uint16)}
+	if err := m.parse(r, 0); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (m *Keymap) parse(r io.Reader, depth int) error {
+	// Columns are for tables 0-3 unless a keymaps line says otherwise.
+	tables := []Table{Plain, Shift, AltGr, Shift | AltGr}
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		f := strings.Fields(s.Text())
+		for i, w := range f {
+			if strings.HasPrefix(w, "#") || strings.HasPrefix(w, "!") {
+				f = f[:i]
+				break
+			}
+		}
+		if len(f) == 0 {
+			continue
+		}
+		var err error
+		switch f[0] {
+		case "include":
+			err = m.include(f[1:], depth)
+		case "keymaps":
+			if len(f) != 2 {
+				err = fmt.Errorf("keymaps takes one list")
+			} else {
+				tables, err = parseTables(f[1])
+			}
+		default:
+			err = m.parseKeycode(f, tables)
+		}
+		if err != nil {
+			return fmt.Errorf("line %d: %v", line, err)
+		}
+	}
+	return s.Err()
+}
+
+func (m *Keymap) include(args []string, depth int) error {
+	if len(args) != 1 {
+		return fmt.Errorf("include takes one layout")
+	}
+	name := strings.Trim(args[0], `"`)
+	l, ok := layouts[name]
+	if !ok {
+		return fmt.Errorf("no built-in layout %q", name)
+	}
+	if depth > 8 {
+		return fmt.Errorf("includes nested too deep at %q", name)
+	}
+	if err := m.parse(strings.NewReader(l), depth+1); err != nil {
+		return fmt.Errorf("%s: %v", name, err)
+	}
+	return nil
+}
+
+// parseTables parses a list of tables such as 0-2,4.
+func parseTables(s string) ([]Table, error) {
+	var tables []Table
+	for _, r := range strings.Split(s, ",") {
+		lo, hi := r, r
+		if i := strings.Index(r, "-"); i >= 0 {
+			lo, hi = r[:i], r[i+1:]
+		}
+		l, err := strconv.ParseUint(lo, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("bad keymaps %q", s)
+		}
+		h, err := strconv.ParseUint(hi, 10, 8)
+		if err != nil || h < l {
+			return nil, fmt.Errorf("bad keymaps %q", s)
+		}
+		for t := l; t <= h; t++ {
+			tables = append(tables, Table(t))
+		}
+	}
+	return tables, nil
+}
+
+// parseKeycode parses [modifiers] keycode N = keysyms.
+func (m *Keymap) parseKeycode(f []string, tables []Table) error {
+	var mods Table
+	var modified bool
+	for len(f) > 0 && f[0] != "keycode" {
+		t, ok := modifierNames[f[0]]
+		if !ok {
+			return fmt.Errorf("unsupported %q", f[0])
+		}
+		mods |= t
+		modified = true
+		f = f[1:]
+	}
+	if len(f) < 4 || f[2] != "=" {
+		return fmt.Errorf("want keycode N = keysyms")
+	}
+	code, err := strconv.ParseUint(f[1], 0, 8)
+	if err != nil {
+		return fmt.Errorf("bad keycode %q", f[1])
+	}
+	syms := f[3:]
+	vals := make([]uint16, len(syms))
+	for i, s := range syms {
+		if vals[i], err = parseKeysym(s); err != nil {
+			return err
+		}
+	}
+	set := func(t Table, v uint16) {
+		m.Keys[Key{Table: t, Code: uint8(code)}] = v
+	}
+
+	if modified {
+		if len(vals) != 1 {
+			return fmt.Errorf("a modified keycode takes one keysym")
+		}
+		set(mods, vals[0])
+		return nil
+	}
+	if len(vals) > len(tables) {
+		return fmt.Errorf("%d keysyms for %d keymaps", len(vals), len(tables))
+	}
+	if len(vals) == 1 {
+		// One keysym is for every table, but a letter is shifted
+		// where it should be.
+		r, isLetter := letter(vals[0])
+		for _, t := range tables {
+			v := vals[0]
+			if isLetter && t&Shift != 0 {
+				v = runeKeysym(unicode.ToUpper(r))
+			}
+			set(t, v)
+		}
+	} else {
+		// Tables without a keysym get none.
+		for i, t := range tables {
+			v := names["VoidSymbol"]
+			if i < len(vals) {
+				v = vals[i]
+			}
+			set(t, v)
+		}
+	}
+	// Control and a letter is that control character, wherever the
+	// letter moved.
+	if r, isLetter := letter(vals[0]); isLetter && r < 0x80 {
+		set(Control, keysym(ktLatin, int(unicode.ToLower(r)-'a'+1)))
+	}
+	return nil
+}
+
+// letter returns the letter v types, if it does.
+func letter(v uint16) (rune, bool) {
+	if v>>8 != ktLetter {
+		return 0, false
+	}
+	return rune(v & 0xFF), true
+}
+
+// Layouts returns the names of the built-in layouts.
+func Layouts() []string {
+	var l []string
+	for n := range layouts {
+		l = append(l, n)
+	}
+	sort.Strings(l)
+	return l
+}
+
+// Layout returns the built-in layout name.
+func Layout(name string) (*Keymap, error) {
+	l, ok := layouts[name]
+	if !ok {
+		return nil, fmt.Errorf("no built-in layout %q; there are %s", name, strings.Join(Layouts(), ", "))
+	}
+	m, err := Parse(strings.NewReader(l))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", name, err)
+	}
+	return m, nil
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package keymap
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLayouts(t *testing.T) {
+	for _, name := range Layouts() {
+		if _, err := Layout(name); err != nil {
+			t.Errorf("Layout(%q) = %v", name, err)
+		}
+	}
+	if _, err := Layout("klingon"); err == nil {
+		t.Errorf("Layout(klingon) succeeded")
+	}
+}
+
+func TestLayoutKeys(t *testing.T) {
+	for _, tt := range []struct {
+		layout string
+		key    Key
+		want   rune
+	}{
+		{"us", Key{Plain, 21}, 'y'},
+		{"us", Key{Shift, 21}, 'Y'},
+		{"us", Key{Control, 21}, 'y' - 'a' + 1},
+		{"us", Key{Shift, 3}, '@'},
+		{"de", Key{Plain, 21}, 'z'},
+		{"de", Key{Shift, 21}, 'Z'},
+		{"de", Key{Control, 21}, 'z' - 'a' + 1},
+		{"de", Key{Plain, 44}, 'y'},
+		{"de", Key{AltGr, 16}, '@'},
+		{"de", Key{AltGr, 18}, '€'},
+		{"de", Key{Shift, 40}, 'Ä'},
+		{"de", Key{Plain, 12}, 'ß'},
+		{"fr", Key{Plain, 16}, 'a'},
+		{"fr", Key{Plain, 3}, 'é'},
+		{"fr", Key{Shift, 3}, '2'},
+		{"uk", Key{Shift, 4}, '£'},
+		{"es", Key{Plain, 39}, 'ñ'},
+		{"dvorak", Key{Plain, 31}, 'o'},
+		{"dvorak", Key{Control, 31}, 'o' - 'a' + 1},
+	} {
+		m, err := Layout(tt.layout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, ok := m.Rune(tt.key); !ok || got != tt.want {
+			t.Errorf("%s: Rune(%v) = %q, %t, want %q", tt.layout, tt.key, got, ok, tt.want)
+		}
+	}
+
+	de, _ := Layout("de")
+	if _, ok := de.Rune(Key{Plain, 13}); ok {
+		t.Errorf("de: dead acute types a character")
+	}
+	if got := de.Keys[Key{AltGr, 21}]; got != names["VoidSymbol"] {
+		t.Errorf("de: AltGr z = %#04x, want VoidSymbol", got)
+	}
+	if got := de.Keys[Key{Shift | AltGr, 100}]; got != names["AltGr"] {
+		t.Errorf("de: keycode 100 = %#04x, want AltGr", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	m, err := Parse(strings.NewReader(`! a comment
+keymaps 0,2-3
+keycode 30 = a   at   U+00E6 # æ
+keycode 0x1f = 1 2
+control alt keycode 32 = VoidSymbol
+altgr keycode 33 = →
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, want := range map[Key]rune{
+		{Plain, 30}:         'a',
+		{AltGr, 30}:         '@',
+		{Shift | AltGr, 30}: 'æ',
+		{Plain, 31}:         '1',
+		{AltGr, 31}:         '2',
+		{AltGr, 33}:         '→',
+	} {
+		if got, ok := m.Rune(k); !ok || got != want {
+			t.Errorf("Rune(%v) = %q, %t, want %q", k, got, ok, want)
+		}
+	}
+	if _, ok := m.Keys[Key{Shift, 30}]; ok {
+		t.Errorf("Shift set without keymap 1")
+	}
+	if v, ok := m.Keys[Key{Control | Alt, 32}]; !ok || v != names["VoidSymbol"] {
+		t.Errorf("control alt keycode 32 = %#04x, %t", v, ok)
+	}
+	// And control a, for the letter.
+	if len(m.Keys) != 9 {
+		t.Errorf("%d keys set, want 9: %v", len(m.Keys), m.Keys)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, s := range []string{
+		"keycode 30 = nosuchsym",
+		"keycode 300 = a",
+		"keycode 30 a",
+		"keycode 30 = a b c d e",
+		"include \"nosuchlayout\"",
+		"string F1 = \"hello\"",
+		"keymaps 3-1",
+		"shift keycode 30 = a b",
+		"keycode 30 = 😀",
+	} {
+		if _, err := Parse(strings.NewReader(s)); err == nil {
+			t.Errorf("Parse(%q) succeeded", s)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package keymap
+
+// layouts are the built-in layouts. They cover the keys that differ
+// between layouts, the typewriter keys, and leave function, editing and
+// keypad keys as the kernel has them.
+var layouts = map[string]string{
+	"us": `# US, which the others start from.
+keycode 2 = one exclam
+keycode 3 = two at
+keycode 4 = three numbersign
+keycode 5 = four dollar
+keycode 6 = five percent
+keycode 7 = six asciicircum
+keycode 8 = seven ampersand
+keycode 9 = eight asterisk
+keycode 10 = nine parenleft
+keycode 11 = zero parenright
+keycode 12 = minus underscore
+keycode 13 = equal plus
+keycode 16 = q
+keycode 17 = w
+keycode 18 = e
+keycode 19 = r
+keycode 20 = t
+keycode 21 = y
+keycode 22 = u
+keycode 23 = i
+keycode 24 = o
+keycode 25 = p
+keycode 26 = bracketleft braceleft
+keycode 27 = bracketright braceright
+keycode 30 = a
+keycode 31 = s
+keycode 32 = d
+keycode 33 = f
+keycode 34 = g
+keycode 35 = h
+keycode 36 = j
+keycode 37 = k
+keycode 38 = l
+keycode 39 = semicolon colon
+keycode 40 = apostrophe quotedbl
+keycode 41 = grave asciitilde
+keycode 43 = backslash bar
+keycode 44 = z
+keycode 45 = x
+keycode 46 = c
+keycode 47 = v
+keycode 48 = b
+keycode 49 = n
+keycode 50 = m
+keycode 51 = comma less
+keycode 52 = period greater
+keycode 53 = slash question
+keycode 57 = space
+keycode 86 = less greater
+keycode 100 = AltGr
+`,
+
+	"uk": `# United Kingdom.
+include "us"
+keycode 3 = two quotedbl
+keycode 4 = three sterling
+keycode 5 = four dollar EuroSign
+keycode 40 = apostrophe at
+keycode 41 = grave notsign bar
+keycode 43 = numbersign asciitilde
+keycode 86 = backslash bar
+`,
+
+	"de": `# German, QWERTZ.
+include "us"
+keycode 2 = one exclam onesuperior
+keycode 3 = two quotedbl twosuperior
+keycode 4 = three section threesuperior
+keycode 5 = four dollar
+keycode 6 = five percent
+keycode 7 = six ampersand
+keycode 8 = seven slash braceleft
+keycode 9 = eight parenleft bracketleft
+keycode 10 = nine parenright bracketright
+keycode 11 = zero equal braceright
+keycode 12 = ssharp question backslash
+keycode 13 = dead_acute dead_grave
+keycode 16 = q Q at
+keycode 18 = e E EuroSign
+keycode 21 = z Z
+keycode 26 = udiaeresis Udiaeresis
+keycode 27 = plus asterisk asciitilde
+keycode 39 = odiaeresis Odiaeresis
+keycode 40 = adiaeresis Adiaeresis
+keycode 41 = dead_circumflex degree
+keycode 43 = numbersign apostrophe
+keycode 44 = y Y
+keycode 50 = m M mu
+keycode 51 = comma semicolon
+keycode 52 = period colon
+keycode 53 = minus underscore
+keycode 86 = less greater bar
+`,
+
+	"fr": `# French, AZERTY.
+include "us"
+keycode 2 = ampersand one
+keycode 3 = eacute two asciitilde
+keycode 4 = quotedbl three numbersign
+keycode 5 = apostrophe four braceleft
+keycode 6 = parenleft five bracketleft
+keycode 7 = minus six bar
+keycode 8 = egrave seven grave
+keycode 9 = underscore eight backslash
+keycode 10 = ccedilla nine asciicircum
+keycode 11 = agrave zero at
+keycode 12 = parenright degree bracketright
+keycode 13 = equal plus braceright
+keycode 16 = a A
+keycode 17 = z Z
+keycode 18 = e E EuroSign
+keycode 26 = dead_circumflex dead_diaeresis
+keycode 27 = dollar sterling currency
+keycode 30 = q Q
+keycode 39 = m M
+keycode 40 = ugrave percent
+keycode 41 = twosuperior
+keycode 43 = asterisk mu
+keycode 44 = w W
+keycode 50 = comma question
+keycode 51 = semicolon period
+keycode 52 = colon slash
+keycode 53 = exclam section
+keycode 86 = less greater
+`,
+
+	"es": `# Spanish.
+include "us"
+keycode 2 = one exclam bar
+keycode 3 = two quotedbl at
+keycode 4 = three periodcentered numbersign
+keycode 5 = four dollar asciitilde
+keycode 7 = six ampersand notsign
+keycode 8 = seven slash
+keycode 9 = eight parenleft
+keycode 10 = nine parenright
+keycode 11 = zero equal
+keycode 12 = apostrophe question
+keycode 13 = exclamdown questiondown
+keycode 18 = e E EuroSign
+keycode 26 = dead_grave dead_circumflex bracketleft
+keycode 27 = plus asterisk bracketright
+keycode 39 = ntilde Ntilde
+keycode 40 = dead_acute dead_diaeresis braceleft
+keycode 41 = masculine ordfeminine backslash
+keycode 43 = ccedilla Ccedilla braceright
+keycode 51 = comma semicolon
+keycode 52 = period colon
+keycode 53 = minus underscore
+keycode 86 = less greater
+`,
+
+	"it": `# Italian.
+include "us"
+keycode 3 = two quotedbl
+keycode 4 = three sterling
+keycode 7 = six ampersand
+keycode 8 = seven slash
+keycode 9 = eight parenleft
+keycode 10 = nine parenright
+keycode 11 = zero equal
+keycode 12 = apostrophe question
+keycode 13 = igrave asciicircum
+keycode 18 = e E EuroSign
+keycode 26 = egrave eacute bracketleft braceleft
+keycode 27 = plus asterisk bracketright braceright
+keycode 39 = ograve ccedilla at
+keycode 40 = agrave degree numbersign
+keycode 41 = backslash bar
+keycode 43 = ugrave section
+keycode 51 = comma semicolon
+keycode 52 = period colon
+keycode 53 = minus underscore
+keycode 86 = less greater
+`,
+
+	"dvorak": `# US Dvorak.
+include "us"
+keycode 12 = bracketleft braceleft
+keycode 13 = bracketright braceright
+keycode 16 = apostrophe quotedbl
+keycode 17 = comma less
+keycode 18 = period greater
+keycode 19 = p
+keycode 20 = y
+keycode 21 = f
+keycode 22 = g
+keycode 23 = c
+keycode 24 = r
+keycode 25 = l
+keycode 26 = slash question
+keycode 27 = equal plus
+keycode 30 = a
+keycode 31 = o
+keycode 32 = e
+keycode 33 = u
+keycode 34 = i
+keycode 35 = d
+keycode 36 = h
+keycode 37 = t
+keycode 38 = n
+keycode 39 = s
+keycode 40 = minus underscore
+keycode 44 = semicolon colon
+keycode 45 = q
+keycode 46 = j
+keycode 47 = k
+keycode 48 = x
+keycode 49 = b
+keycode 50 = m
+keycode 51 = w
+keycode 52 = v
+keycode 53 = z
+`,
+}
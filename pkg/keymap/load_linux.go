@@ -0,0 +1,60 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package keymap
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// KDSKBENT, from linux/kd.h.
+const kdskbent = 0x4B47
+
+// kbentry is struct kbentry.
+type kbentry struct {
+	table uint8
+	index uint8
+	value uint16
+}
+
+// Load sets the keys of m on the console tty is a terminal of, such as
+// /dev/tty0 or /dev/console. The kernel has one keymap for all virtual
+// consoles.
+func (m *Keymap) Load(tty *os.File) error {
+	keys := make([]Key, 0, len(m.Keys))
+	for k := range m.Keys {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Table != keys[j].Table {
+			return keys[i].Table < keys[j].Table
+		}
+		return keys[i].Code < keys[j].Code
+	})
+	for _, k := range keys {
+		e := kbentry{table: uint8(k.Table), index: k.Code, value: m.Keys[k]}
+		if _, _, errno := unix.Syscall(unix.SYS_IOCTL, tty.Fd(), kdskbent, uintptr(unsafe.Pointer(&e))); errno != 0 {
+			return fmt.Errorf("setting keycode %d in keymap %d to %#04x: %v", k.Code, k.Table, e.value, errno)
+		}
+	}
+	return nil
+}
+
+// LoadConsole loads m on the console, through /dev/tty0, or /dev/console
+// if there is no tty0.
+func (m *Keymap) LoadConsole() error {
+	f, err := os.OpenFile("/dev/tty0", os.O_WRONLY, 0)
+	if err != nil {
+		if f, err = os.OpenFile("/dev/console", os.O_WRONLY, 0); err != nil {
+			return err
+		}
+	}
+	defer f.Close()
+	return m.Load(f)
+}
@@ -0,0 +1,28 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package keymap
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLoadNotConsole(t *testing.T) {
+	f, err := ioutil.TempFile("", "keymap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	m, err := Layout("us")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Load(f); err == nil {
+		t.Errorf("Load on a file succeeded")
+	}
+}
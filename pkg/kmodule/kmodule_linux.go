@@ -19,6 +19,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/u-root/u-root/pkg/cmdline"
 	"golang.org/x/sys/unix"
 )
 
@@ -58,6 +59,70 @@ func FileInit(f *os.File, opts string, flags uintptr) error {
 	return err
 }
 
+// FileInitPolicy is FileInit, but first checks the module against p.
+//
+// The module is loaded from the very bytes that were checked.
+func FileInitPolicy(f *os.File, opts string, flags uintptr, p *Policy) error {
+	if p == nil {
+		return FileInit(f, opts, flags)
+	}
+	img, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+	if err := p.Check(img); err != nil {
+		return fmt.Errorf("%s: %v", f.Name(), err)
+	}
+	if flags != 0 {
+		return fmt.Errorf("flags %#x need finit_module, which cannot load a checked image", flags)
+	}
+	return Init(img, opts)
+}
+
+// DefaultKeyring is where DefaultPolicy looks for module signing
+// certificates, in PEM or DER. Build it into the initramfs to use it.
+const DefaultKeyring = "/etc/kmodule/signing_keys.pem"
+
+// DefaultPolicy returns the policy the running system asks for: modules
+// must be signed by a key in DefaultKeyring, if it exists, and unsigned
+// modules are refused if the kernel command line has module.sig_enforce=1.
+// It returns nil if there is nothing to check.
+func DefaultPolicy() (*Policy, error) {
+	p := &Policy{}
+	if v, ok := cmdline.Flag("module.sig_enforce"); ok && v != "0" && v != "n" && v != "N" {
+		p.RequireSigned = true
+	}
+	k, err := LoadKeyring(DefaultKeyring)
+	switch {
+	case err == nil:
+		p.Keyring = k
+	case !os.IsNotExist(err):
+		return nil, err
+	case !p.RequireSigned:
+		return nil, nil
+	}
+	return p, nil
+}
+
+// NewPolicy is DefaultPolicy, but with the certificates in keys, if set,
+// and refusing unsigned modules if requireSigned, as for command flags.
+func NewPolicy(keys string, requireSigned bool) (*Policy, error) {
+	p, err := DefaultPolicy()
+	if err != nil || (keys == "" && !requireSigned) {
+		return p, err
+	}
+	if p == nil {
+		p = &Policy{}
+	}
+	if keys != "" {
+		if p.Keyring, err = LoadKeyring(keys); err != nil {
+			return nil, err
+		}
+	}
+	p.RequireSigned = p.RequireSigned || requireSigned
+	return p, nil
+}
+
 // Delete removes a kernel module.
 func Delete(name string, flags uintptr) error {
 	return unix.DeleteModule(name, int(flags))
@@ -87,6 +152,9 @@ type ProbeOpts struct {
 	RootDir        string
 	KVer           string
 	IgnoreProcMods bool
+
+	// Policy, if set, is checked before loading each module.
+	Policy *Policy
 }
 
 // Probe loads the given kernel module and its dependencies.
@@ -261,7 +329,7 @@ func loadModule(path, modParams string, opts ProbeOpts) error {
 	}
 	defer f.Close()
 
-	if err := FileInit(f, modParams, 0); err != nil && err != unix.EEXIST {
+	if err := FileInitPolicy(f, modParams, 0, opts.Policy); err != nil && err != unix.EEXIST {
 		return err
 	}
 
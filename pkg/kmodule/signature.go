@@ -0,0 +1,316 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kmodule
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+
+	// Register the digests modules are signed with.
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// ErrUnsigned is returned by Keyring.Verify for modules without a signature.
+var ErrUnsigned = errors.New("module is not signed")
+
+// moduleSigMagic ends signed modules, see scripts/sign-file.c.
+const moduleSigMagic = "~Module signature appended~\n"
+
+// moduleSignature is struct module_signature, include/linux/module_signature.h.
+type moduleSignature struct {
+	Algo      uint8
+	Hash      uint8
+	IDType    uint8
+	SignerLen uint8
+	KeyIDLen  uint8
+	_         [3]uint8
+	SigLen    uint32
+}
+
+const (
+	moduleSignatureSize = 12
+	pkeyIDPKCS7         = 2
+)
+
+// splitSignature splits a signed module into what was signed and its
+// PKCS#7 signature.
+func splitSignature(img []byte) ([]byte, []byte, error) {
+	if !bytes.HasSuffix(img, []byte(moduleSigMagic)) {
+		return nil, nil, ErrUnsigned
+	}
+	img = img[:len(img)-len(moduleSigMagic)]
+	if len(img) < moduleSignatureSize {
+		return nil, nil, fmt.Errorf("module signature is truncated")
+	}
+	var ms moduleSignature
+	if err := binary.Read(bytes.NewReader(img[len(img)-moduleSignatureSize:]), binary.BigEndian, &ms); err != nil {
+		return nil, nil, err
+	}
+	img = img[:len(img)-moduleSignatureSize]
+	if ms.IDType != pkeyIDPKCS7 {
+		return nil, nil, fmt.Errorf("module signature has unsupported type %d", ms.IDType)
+	}
+	// Compared as uint64: on 32 bit platforms int(ms.SigLen) can be
+	// negative.
+	if uint64(ms.SigLen) > uint64(len(img)) {
+		return nil, nil, fmt.Errorf("module signature of %d bytes is longer than the module", ms.SigLen)
+	}
+	n := len(img) - int(ms.SigLen)
+	return img[:n], img[n:], nil
+}
+
+// PKCS#7 / CMS structures, RFC 5652, as far as module signatures need them.
+type contentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"explicit,optional,tag:0"`
+}
+
+type signedData struct {
+	Version          int
+	DigestAlgorithms []pkix.AlgorithmIdentifier `asn1:"set"`
+	ContentInfo      contentInfo
+	Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+	CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+	SignerInfos      []signerInfo  `asn1:"set"`
+}
+
+type issuerAndSerial struct {
+	Issuer asn1.RawValue
+	Serial *big.Int
+}
+
+type signerInfo struct {
+	Version            int
+	SID                asn1.RawValue
+	DigestAlgorithm    pkix.AlgorithmIdentifier
+	SignedAttrs        asn1.RawValue `asn1:"optional,tag:0"`
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          []byte
+	UnsignedAttrs      asn1.RawValue `asn1:"optional,tag:1"`
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values asn1.RawValue `asn1:"set"`
+}
+
+var (
+	oidSignedData    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+	oidMessageDigest = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 4}
+
+	digests = []struct {
+		oid  asn1.ObjectIdentifier
+		hash crypto.Hash
+	}{
+		{asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}, crypto.SHA1},
+		{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 4}, crypto.SHA224},
+		{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}, crypto.SHA256},
+		{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2}, crypto.SHA384},
+		{asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3}, crypto.SHA512},
+	}
+)
+
+func digestHash(oid asn1.ObjectIdentifier) (crypto.Hash, error) {
+	for _, d := range digests {
+		if d.oid.Equal(oid) {
+			return d.hash, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported digest algorithm %v", oid)
+}
+
+// Keyring holds the certificates whose keys may sign modules.
+type Keyring struct {
+	certs []*x509.Certificate
+}
+
+// NewKeyring returns a keyring of certs.
+func NewKeyring(certs ...*x509.Certificate) *Keyring {
+	return &Keyring{certs: certs}
+}
+
+// LoadKeyring reads certificates from a file of PEM certificates, or a
+// single DER certificate such as the kernel's signing_key.x509.
+func LoadKeyring(path string) (*Keyring, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	k := &Keyring{}
+	for rest := b; ; {
+		var p *pem.Block
+		if p, rest = pem.Decode(rest); p == nil {
+			break
+		}
+		if p.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(p.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		k.certs = append(k.certs, c)
+	}
+	if len(k.certs) == 0 {
+		c, err := x509.ParseCertificate(b)
+		if err != nil {
+			return nil, fmt.Errorf("%s: no PEM certificates and not DER: %v", path, err)
+		}
+		k.certs = append(k.certs, c)
+	}
+	return k, nil
+}
+
+// signer returns the certificate that sid, an issuer and serial number or
+// a subject key identifier, names.
+func (k *Keyring) signer(sid asn1.RawValue) (*x509.Certificate, error) {
+	if sid.Class == asn1.ClassContextSpecific && sid.Tag == 0 {
+		for _, c := range k.certs {
+			if bytes.Equal(c.SubjectKeyId, sid.Bytes) {
+				return c, nil
+			}
+		}
+		return nil, fmt.Errorf("no key with ID %x", sid.Bytes)
+	}
+	var is issuerAndSerial
+	if _, err := asn1.Unmarshal(sid.FullBytes, &is); err != nil {
+		return nil, fmt.Errorf("bad signer ID: %v", err)
+	}
+	for _, c := range k.certs {
+		if bytes.Equal(c.RawIssuer, is.Issuer.FullBytes) && c.SerialNumber.Cmp(is.Serial) == 0 {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("no key with serial %x", is.Serial)
+}
+
+// Verify checks that the module image img is signed by a key in k. It
+// returns ErrUnsigned if img has no signature at all.
+func (k *Keyring) Verify(img []byte) error {
+	content, sig, err := splitSignature(img)
+	if err != nil {
+		return err
+	}
+	var ci contentInfo
+	if _, err := asn1.Unmarshal(sig, &ci); err != nil {
+		return fmt.Errorf("bad module signature: %v", err)
+	}
+	if !ci.ContentType.Equal(oidSignedData) {
+		return fmt.Errorf("module signature is not PKCS#7 signed data")
+	}
+	var sd signedData
+	if _, err := asn1.Unmarshal(ci.Content.Bytes, &sd); err != nil {
+		return fmt.Errorf("bad module signature: %v", err)
+	}
+	if len(sd.SignerInfos) == 0 {
+		return fmt.Errorf("module signature has no signers")
+	}
+
+	// Any good signature will do.
+	var errs []error
+	for _, si := range sd.SignerInfos {
+		err := k.verifySigner(si, content)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return fmt.Errorf("module signature does not verify: %v", errs)
+}
+
+func (k *Keyring) verifySigner(si signerInfo, content []byte) error {
+	cert, err := k.signer(si.SID)
+	if err != nil {
+		return err
+	}
+	hash, err := digestHash(si.DigestAlgorithm.Algorithm)
+	if err != nil {
+		return err
+	}
+	h := hash.New()
+	h.Write(content)
+	digest := h.Sum(nil)
+
+	// With signed attributes, the signature is over them, and they hold
+	// the content's digest.
+	if len(si.SignedAttrs.Bytes) > 0 {
+		// They are signed as a SET, not with their implicit tag.
+		signed := append([]byte{0x31}, si.SignedAttrs.FullBytes[1:]...)
+		var attrs []attribute
+		if _, err := asn1.UnmarshalWithParams(signed, &attrs, "set"); err != nil {
+			return fmt.Errorf("bad signed attributes: %v", err)
+		}
+		var md []byte
+		for _, a := range attrs {
+			if a.Type.Equal(oidMessageDigest) {
+				if _, err := asn1.Unmarshal(a.Values.Bytes, &md); err != nil {
+					return fmt.Errorf("bad message digest: %v", err)
+				}
+			}
+		}
+		if !bytes.Equal(md, digest) {
+			return fmt.Errorf("module digest does not match its signature")
+		}
+		h = hash.New()
+		h.Write(signed)
+		digest = h.Sum(nil)
+	}
+
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, hash, digest, si.Signature)
+	case *ecdsa.PublicKey:
+		var rs struct{ R, S *big.Int }
+		if _, err := asn1.Unmarshal(si.Signature, &rs); err != nil {
+			return fmt.Errorf("bad ECDSA signature: %v", err)
+		}
+		if !ecdsa.Verify(pub, digest, rs.R, rs.S) {
+			return fmt.Errorf("ECDSA signature does not verify")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported key type %T", cert.PublicKey)
+}
+
+// Policy says which modules may be loaded.
+type Policy struct {
+	// Keyring verifies signed modules. Modules with bad signatures are
+	// always refused.
+	Keyring *Keyring
+
+	// RequireSigned refuses unsigned modules, as module.sig_enforce=1
+	// does in the kernel.
+	RequireSigned bool
+}
+
+// Check returns an error if img may not be loaded. A nil Policy allows
+// everything.
+func (p *Policy) Check(img []byte) error {
+	if p == nil {
+		return nil
+	}
+	k := p.Keyring
+	if k == nil {
+		k = &Keyring{}
+	}
+	err := k.Verify(img)
+	if err == ErrUnsigned && !p.RequireSigned {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,269 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package kmodule
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testCert(t *testing.T, key crypto.Signer, serial int64) *x509.Certificate {
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "Build time autogenerated kernel key"},
+		SubjectKeyId: []byte{byte(serial), 1, 2, 3},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// sign appends a signature to img as scripts/sign-file does, optionally
+// with signed attributes and a subject key identifier.
+func sign(t *testing.T, img []byte, key crypto.Signer, cert *x509.Certificate, withAttrs, bySKID bool) []byte {
+	sha256OID := asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+	digest := sha256.Sum256(img)
+	toSign := digest[:]
+
+	si := signerInfo{
+		Version:            1,
+		DigestAlgorithm:    pkix.AlgorithmIdentifier{Algorithm: sha256OID},
+		SignatureAlgorithm: pkix.AlgorithmIdentifier{Algorithm: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}},
+	}
+	if bySKID {
+		si.SID = asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, Bytes: cert.SubjectKeyId}
+	} else {
+		b, err := asn1.Marshal(issuerAndSerial{Issuer: asn1.RawValue{FullBytes: cert.RawIssuer}, Serial: cert.SerialNumber})
+		if err != nil {
+			t.Fatal(err)
+		}
+		si.SID = asn1.RawValue{FullBytes: b}
+	}
+	if withAttrs {
+		md, _ := asn1.Marshal(digest[:])
+		attrs, err := asn1.MarshalWithParams([]attribute{{
+			Type:   oidMessageDigest,
+			Values: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true, Bytes: md},
+		}}, "set")
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := sha256.Sum256(attrs)
+		toSign = d[:]
+		attrs[0] = 0xA0
+		si.SignedAttrs = asn1.RawValue{FullBytes: attrs}
+	}
+	sig, err := key.Sign(rand.Reader, toSign, crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	si.Signature = sig
+
+	sd, err := asn1.Marshal(signedData{
+		Version:          1,
+		DigestAlgorithms: []pkix.AlgorithmIdentifier{{Algorithm: sha256OID}},
+		ContentInfo:      contentInfo{ContentType: asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}},
+		SignerInfos:      []signerInfo{si},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RawValues with FullBytes are marshaled as is, so tag the content here.
+	content, err := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: sd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p7, err := asn1.Marshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{oidSignedData, asn1.RawValue{FullBytes: content}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ms bytes.Buffer
+	binary.Write(&ms, binary.BigEndian, moduleSignature{IDType: pkeyIDPKCS7, SigLen: uint32(len(p7))})
+	out := append(append([]byte(nil), img...), p7...)
+	out = append(out, ms.Bytes()...)
+	return append(out, moduleSigMagic...)
+}
+
+func TestVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaCert, ecCert, otherCert := testCert(t, rsaKey, 1), testCert(t, ecKey, 2), testCert(t, otherKey, 3)
+	k := NewKeyring(rsaCert, ecCert)
+	img := []byte("\x7fELF pretend this is a module")
+
+	for _, tt := range []struct {
+		name    string
+		img     []byte
+		wantErr bool
+	}{
+		{"rsa", sign(t, img, rsaKey, rsaCert, false, false), false},
+		{"rsa with attributes", sign(t, img, rsaKey, rsaCert, true, false), false},
+		{"ecdsa by key ID", sign(t, img, ecKey, ecCert, false, true), false},
+		{"ecdsa with attributes", sign(t, img, ecKey, ecCert, true, true), false},
+		{"unknown key", sign(t, img, otherKey, otherCert, false, false), true},
+		{"wrong key", sign(t, img, otherKey, ecCert, false, true), true},
+		{"tampered", func() []byte {
+			b := sign(t, img, rsaKey, rsaCert, false, false)
+			b[1] = 'X'
+			return b
+		}(), true},
+		{"tampered with attributes", func() []byte {
+			b := sign(t, img, rsaKey, rsaCert, true, false)
+			b[1] = 'X'
+			return b
+		}(), true},
+		{"truncated", []byte("x" + moduleSigMagic), true},
+		{"signature longer than 2 GiB", func() []byte {
+			b := sign(t, img, rsaKey, rsaCert, false, false)
+			binary.BigEndian.PutUint32(b[len(b)-len(moduleSigMagic)-4:], 1<<32-1)
+			return b
+		}(), true},
+	} {
+		if err := k.Verify(tt.img); (err != nil) != tt.wantErr {
+			t.Errorf("%s: Verify = %v, want error %t", tt.name, err, tt.wantErr)
+		}
+	}
+	if err := k.Verify(img); err != ErrUnsigned {
+		t.Errorf("Verify(unsigned) = %v, want %v", err, ErrUnsigned)
+	}
+}
+
+// testdata/signed.ko is signed as scripts/sign-file signs modules, by
+// OpenSSL: "openssl cms -sign -binary -noattr -nocerts -nosmimecap -md
+// sha256 -outform DER" with the key of testdata/signing_key.x509, followed
+// by struct module_signature and the magic.
+func TestVerifySignFile(t *testing.T) {
+	k, err := LoadKeyring("testdata/signing_key.x509")
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := ioutil.ReadFile("testdata/signed.ko")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Verify(img); err != nil {
+		t.Errorf("Verify(signed.ko) = %v", err)
+	}
+	content, _, err := splitSignature(img)
+	if err != nil || !bytes.HasPrefix(content, []byte("\x7fELF")) || bytes.Contains(content, []byte(moduleSigMagic)) {
+		t.Errorf("splitSignature(signed.ko) = %q, %v, want the module", content, err)
+	}
+	img[1] = 'X'
+	if err := k.Verify(img); err == nil {
+		t.Errorf("Verify(tampered signed.ko) = nil, want error")
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert := testCert(t, key, 1)
+	img := []byte("module")
+	signed := sign(t, img, key, cert, false, false)
+	bad := append([]byte("X"), signed[1:]...)
+
+	for _, tt := range []struct {
+		name string
+		p    *Policy
+		img  []byte
+		ok   bool
+	}{
+		{"nil allows unsigned", nil, img, true},
+		{"nil allows bad", nil, bad, true},
+		{"allows unsigned", &Policy{Keyring: NewKeyring(cert)}, img, true},
+		{"allows signed", &Policy{Keyring: NewKeyring(cert)}, signed, true},
+		{"refuses bad", &Policy{Keyring: NewKeyring(cert)}, bad, false},
+		{"requires signed", &Policy{Keyring: NewKeyring(cert), RequireSigned: true}, img, false},
+		{"requires signed, signed", &Policy{Keyring: NewKeyring(cert), RequireSigned: true}, signed, true},
+		{"no keys", &Policy{RequireSigned: true}, signed, false},
+	} {
+		if err := tt.p.Check(tt.img); (err == nil) != tt.ok {
+			t.Errorf("%s: Check = %v, want ok %t", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1, c2 := testCert(t, key, 1), testCert(t, key, 2)
+
+	dir, err := ioutil.TempDir("", "keyring")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var pemFile []byte
+	for _, c := range []*x509.Certificate{c1, c2} {
+		pemFile = append(pemFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw})...)
+	}
+	for _, tt := range []struct {
+		name    string
+		content []byte
+		want    int
+	}{
+		{"keys.pem", pemFile, 2},
+		{"signing_key.x509", c1.Raw, 1},
+		{"garbage", []byte("not a key"), -1},
+	} {
+		path := filepath.Join(dir, tt.name)
+		if err := ioutil.WriteFile(path, tt.content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		k, err := LoadKeyring(path)
+		if tt.want < 0 {
+			if err == nil {
+				t.Errorf("LoadKeyring(%s) = nil error, want error", tt.name)
+			}
+			continue
+		}
+		if err != nil || len(k.certs) != tt.want {
+			t.Errorf("LoadKeyring(%s) = %v, %v, want %d certificates", tt.name, k, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package l10n translates the messages boot UIs show to users.
+//
+// Messages are looked up by their English text in the catalog of the
+// language, which is that of locale.LANG= or LANG= on the kernel command
+// line, as in LANG=de_DE.UTF-8, or of $LANG. Catalogs are JSON files named
+// after the language in Dir, e.g. /etc/l10n/de.json:
+//
+//	{
+//		"Reboot": "Neu starten",
+//		"Booting %s": "Starte %s"
+//	}
+//
+// which vendors add to the initramfs, or Go maps given to Register. A
+// message not in the catalog of de_DE is looked up in that of de, and
+// failing that is shown in English. Log messages are not translated.
+package l10n
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/u-root/u-root/pkg/cmdline"
+)
+
+// Dir is where catalogs are loaded from when a message is first
+// translated.
+var Dir = "/etc/l10n"
+
+// Catalog maps English messages to their translations. Messages with
+// format verbs must keep them, in order.
+type Catalog map[string]string
+
+var (
+	mu       sync.Mutex
+	once     sync.Once
+	lang     string
+	catalogs = make(map[string]Catalog)
+)
+
+// Register adds the translations of c to the catalog of language l.
+func Register(l string, c Catalog) {
+	mu.Lock()
+	defer mu.Unlock()
+	register(l, c)
+}
+
+func register(l string, c Catalog) {
+	cat, ok := catalogs[l]
+	if !ok {
+		cat = make(Catalog)
+		catalogs[l] = cat
+	}
+	for k, v := range c {
+		cat[k] = v
+	}
+}
+
+// Load registers the catalogs of the JSON files in dir, each named after
+// its language.
+func Load(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		var c Catalog
+		if err := json.Unmarshal(b, &c); err != nil {
+			return fmt.Errorf("%s: %v", f, err)
+		}
+		register(strings.TrimSuffix(filepath.Base(f), ".json"), c)
+	}
+	return nil
+}
+
+// setup picks the language and loads Dir, unless SetLanguage came first.
+func setup() {
+	once.Do(func() {
+		l, ok := cmdline.Flag("locale.LANG")
+		if !ok {
+			l, ok = cmdline.Flag("LANG")
+		}
+		if !ok {
+			l = os.Getenv("LANG")
+		}
+		mu.Lock()
+		lang = Canonical(l)
+		mu.Unlock()
+		// A missing or broken catalog leaves messages in English.
+		_ = Load(Dir)
+	})
+}
+
+// Canonical returns the language of a locale such as de_DE.UTF-8@euro:
+// de_DE. C and POSIX are English, "".
+func Canonical(locale string) string {
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	if locale == "C" || locale == "POSIX" {
+		return ""
+	}
+	return locale
+}
+
+// SetLanguage sets the language messages are translated to, in place of
+// that of the kernel command line. Catalogs are not loaded from Dir.
+func SetLanguage(l string) {
+	once.Do(func() {})
+	mu.Lock()
+	defer mu.Unlock()
+	lang = Canonical(l)
+}
+
+// Language returns the language messages are translated to, "" for
+// English.
+func Language() string {
+	setup()
+	mu.Lock()
+	defer mu.Unlock()
+	return lang
+}
+
+// T returns the translation of msg.
+func T(msg string) string {
+	setup()
+	mu.Lock()
+	defer mu.Unlock()
+	for l := lang; l != ""; {
+		if t, ok := catalogs[l][msg]; ok {
+			return t
+		}
+		i := strings.IndexAny(l, "_-")
+		if i < 0 {
+			break
+		}
+		l = l[:i]
+	}
+	return msg
+}
+
+// Sprintf formats the translation of format.
+func Sprintf(format string, a ...interface{}) string {
+	return fmt.Sprintf(T(format), a...)
+}
+
+// Printf prints the translation of format on stdout.
+func Printf(format string, a ...interface{}) (int, error) {
+	return fmt.Printf(T(format), a...)
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package l10n
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCanonical(t *testing.T) {
+	for in, want := range map[string]string{
+		"de_DE.UTF-8":      "de_DE",
+		"fr_FR.UTF-8@euro": "fr_FR",
+		"pt_BR":            "pt_BR",
+		"C":                "",
+		"POSIX":            "",
+		"":                 "",
+	} {
+		if got := Canonical(in); got != want {
+			t.Errorf("Canonical(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestT(t *testing.T) {
+	dir, err := ioutil.TempDir("", "l10n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "de.json"), []byte(`{"Reboot": "Neu starten", "Booting %s": "Starte %s"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(dir); err != nil {
+		t.Fatal(err)
+	}
+	Register("de_AT", Catalog{"Reboot": "Neu hochfahren"})
+	defer SetLanguage("")
+
+	for _, tt := range []struct {
+		lang, msg, want string
+	}{
+		{"", "Reboot", "Reboot"},
+		{"de", "Reboot", "Neu starten"},
+		{"de_DE.UTF-8", "Reboot", "Neu starten"},
+		{"de_AT", "Reboot", "Neu hochfahren"},
+		{"de_AT", "Booting %s", "Starte %s"},
+		{"de", "Password: ", "Password: "},
+		{"fr", "Reboot", "Reboot"},
+	} {
+		SetLanguage(tt.lang)
+		if got := T(tt.msg); got != tt.want {
+			t.Errorf("%s: T(%q) = %q, want %q", tt.lang, tt.msg, got, tt.want)
+		}
+	}
+
+	SetLanguage("de")
+	if got := Sprintf("Booting %s", "Linux"); got != "Starte Linux" {
+		t.Errorf("Sprintf = %q, want %q", got, "Starte Linux")
+	}
+	if Language() != "de" {
+		t.Errorf("Language() = %q, want de", Language())
+	}
+}
+
+func TestLoadBad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "l10n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "xx.json"), []byte(`["not", "a", "catalog"]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(dir); err == nil {
+		t.Errorf("Load succeeded on a bad catalog")
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package libinit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/boot/kexec"
+	"github.com/u-root/u-root/pkg/cmdline"
+)
+
+var (
+	// procSysKernel is where the kernel's sysctls are.
+	procSysKernel = "/proc/sys/kernel"
+	// kexecCrashSize is how much memory crashkernel= reserved.
+	kexecCrashSize = "/sys/kernel/kexec_crash_size"
+)
+
+// PanicConfig is how the kernel fails: whether oopses and warnings panic,
+// what a panic does, and which SysRq functions are allowed. Its zero value
+// changes nothing.
+type PanicConfig struct {
+	// Sysctls are values to write to files in /proc/sys/kernel, e.g.
+	// "panic_on_oops": "1".
+	Sysctls map[string]string
+
+	// CrashKernel is the kernel to kexec into on a panic, e.g. to dump
+	// the memory of the crashed one, with the initramfs CrashInitrd and
+	// command line CrashCmdline.
+	CrashKernel  string
+	CrashInitrd  string
+	CrashCmdline string
+}
+
+// panicOptions are the kernel command line options of PanicConfig.Sysctls
+// and the sysctl each sets.
+var panicOptions = []struct {
+	flag   string
+	sysctl string
+	parse  func(string) (string, error)
+}{
+	// Oopses and warnings kill the process that hit them, and taint
+	// the kernel, unless they panic.
+	{"uroot.panic_on_oops", "panic_on_oops", parseBool},
+	{"uroot.panic_on_warn", "panic_on_warn", parseBool},
+	// Taint flags that panic once set, Linux 5.8 and later.
+	{"uroot.panic_on_taint", "panic_on_taint", parseUint},
+	// Seconds to wait after a panic before rebooting: 0 waits forever,
+	// and less than 0 reboots at once.
+	{"uroot.panic_timeout", "panic", parseInt},
+	// 0 disables SysRq, 1 enables it all, and more a bitmask of the
+	// functions to enable.
+	{"uroot.sysrq", "sysrq", parseUint},
+}
+
+func parseBool(s string) (string, error) {
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		return "", err
+	}
+	if b {
+		return "1", nil
+	}
+	return "0", nil
+}
+
+func parseInt(s string) (string, error) {
+	i, err := strconv.ParseInt(s, 0, 32)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatInt(i, 10), nil
+}
+
+func parseUint(s string) (string, error) {
+	u, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return "", err
+	}
+	return strconv.FormatUint(u, 10), nil
+}
+
+// crashCmdlineAppend is what kdump adds to the command line of crash
+// kernels, to bring them up on devices the crashed kernel left in any
+// state, in the little memory reserved.
+const crashCmdlineAppend = "irqpoll nr_cpus=1 reset_devices"
+
+// PanicConfigFromCmdline reads a PanicConfig from the kernel command line:
+//
+//     uroot.panic_on_oops=0|1   panic on oopses
+//     uroot.panic_on_warn=0|1   panic on warnings
+//     uroot.panic_on_taint=MASK panic when these taint flags are set
+//     uroot.panic_timeout=SECS  reboot this long after a panic, at once if
+//                               less than 0, never if 0
+//     uroot.reboot_on_panic=0|1 reboot at once on a panic, or never,
+//                               unless uroot.panic_timeout says otherwise
+//     uroot.sysrq=MASK          SysRq functions to enable
+//     uroot.crashkernel=PATH    kernel to kexec into on a panic
+//     uroot.crashinitrd=PATH    initramfs of the crash kernel
+//     uroot.crashcmdline=ARGS   command line of the crash kernel, by
+//                               default this one, without crashkernel=,
+//                               for kdump
+//
+// Invalid options are left out of the config and reported in the error.
+func PanicConfigFromCmdline() (*PanicConfig, error) {
+	return parsePanicConfig(cmdline.Flag, cmdline.FullCmdLine())
+}
+
+func parsePanicConfig(flag func(string) (string, bool), full string) (*PanicConfig, error) {
+	c := &PanicConfig{Sysctls: make(map[string]string)}
+	var errs []string
+	for _, o := range panicOptions {
+		s, ok := flag(o.flag)
+		if !ok {
+			continue
+		}
+		v, err := o.parse(s)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s=%s: %v", o.flag, s, err))
+			continue
+		}
+		c.Sysctls[o.sysctl] = v
+	}
+	if s, ok := flag("uroot.reboot_on_panic"); ok {
+		reboot, err := strconv.ParseBool(s)
+		switch {
+		case err != nil:
+			errs = append(errs, fmt.Sprintf("uroot.reboot_on_panic=%s: %v", s, err))
+		case c.Sysctls["panic"] == "":
+			c.Sysctls["panic"] = "0"
+			if reboot {
+				c.Sysctls["panic"] = "-1"
+			}
+		case (c.Sysctls["panic"] != "0") != reboot:
+			errs = append(errs, fmt.Sprintf("uroot.reboot_on_panic=%s contradicts uroot.panic_timeout=%s", s, c.Sysctls["panic"]))
+		}
+	}
+
+	c.CrashKernel, _ = flag("uroot.crashkernel")
+	c.CrashInitrd, _ = flag("uroot.crashinitrd")
+	if s, ok := flag("uroot.crashcmdline"); ok {
+		c.CrashCmdline = s
+	} else if c.CrashKernel != "" {
+		// The crash kernel must neither reserve memory nor load a
+		// crash kernel itself.
+		c.CrashCmdline = cmdline.NewUpdateFilter(crashCmdlineAppend, []string{"crashkernel", "uroot.crashkernel", "uroot.crashinitrd"}, nil).Update(full)
+	}
+	if c.CrashKernel == "" && c.CrashInitrd != "" {
+		errs = append(errs, "uroot.crashinitrd without uroot.crashkernel")
+	}
+
+	if len(errs) > 0 {
+		return c, fmt.Errorf("invalid panic options: %s", strings.Join(errs, "; "))
+	}
+	return c, nil
+}
+
+// Apply writes the sysctls of c and loads its crash kernel. It applies as
+// much of c as it can, and returns what it could not.
+func (c *PanicConfig) Apply() error {
+	var errs []string
+	var names []string
+	for name := range c.Sysctls {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := ioutil.WriteFile(filepath.Join(procSysKernel, name), []byte(c.Sysctls[name]), 0); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if c.CrashKernel != "" {
+		if err := c.loadCrashKernel(); err != nil {
+			errs = append(errs, fmt.Sprintf("loading crash kernel %s: %v", c.CrashKernel, err))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (c *PanicConfig) loadCrashKernel() error {
+	b, err := ioutil.ReadFile(kexecCrashSize)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(b)) == "0" {
+		return fmt.Errorf("no memory reserved for it, boot with crashkernel=")
+	}
+	kernel, err := os.Open(c.CrashKernel)
+	if err != nil {
+		return err
+	}
+	defer kernel.Close()
+	var initrd *os.File
+	if c.CrashInitrd != "" {
+		if initrd, err = os.Open(c.CrashInitrd); err != nil {
+			return err
+		}
+		defer initrd.Close()
+	}
+	return kexec.FileLoadCrash(kernel, initrd, c.CrashCmdline)
+}
+
+// Taint is the set of reasons the kernel is tainted, as in
+// /proc/sys/kernel/tainted.
+type Taint uint64
+
+// taintFlags are the letters the kernel prints taint flags with, by bit.
+const taintFlags = "PFSRMBUDAWCIOELKXTN"
+
+func (t Taint) String() string {
+	if t == 0 {
+		return "not tainted"
+	}
+	var s []string
+	for bit := uint(0); bit < 64; bit++ {
+		if t&(1<<bit) == 0 {
+			continue
+		}
+		if bit < uint(len(taintFlags)) {
+			s = append(s, taintFlags[bit:bit+1])
+		} else {
+			s = append(s, fmt.Sprintf("bit %d", bit))
+		}
+	}
+	return strings.Join(s, " ")
+}
+
+// KernelTaint returns the reasons the kernel is tainted.
+func KernelTaint() (Taint, error) {
+	b, err := ioutil.ReadFile(filepath.Join(procSysKernel, "tainted"))
+	if err != nil {
+		return 0, err
+	}
+	t, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+	return Taint(t), err
+}
+
+// ConfigurePanic applies the PanicConfig of the kernel command line, so
+// that every machine booted with it fails the same way, and logs whether
+// the kernel is tainted already.
+func ConfigurePanic() {
+	c, err := PanicConfigFromCmdline()
+	if err != nil {
+		log.Print(err)
+	}
+	if err := c.Apply(); err != nil {
+		log.Printf("Panic config: %v", err)
+	}
+	if t, err := KernelTaint(); err == nil && t != 0 {
+		log.Printf("Kernel is tainted: %v", t)
+	}
+}
@@ -0,0 +1,118 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package libinit
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsePanicConfig(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		flags   map[string]string
+		want    PanicConfig
+		wantErr string
+	}{
+		{
+			name: "none",
+			want: PanicConfig{Sysctls: map[string]string{}},
+		},
+		{
+			name:  "panic",
+			flags: map[string]string{"uroot.panic_on_oops": "1", "uroot.panic_on_warn": "false", "uroot.panic_timeout": "30", "uroot.reboot_on_panic": "1", "uroot.sysrq": "0x1b0"},
+			want:  PanicConfig{Sysctls: map[string]string{"panic_on_oops": "1", "panic_on_warn": "0", "panic": "30", "sysrq": "432"}},
+		},
+		{
+			name:  "reboot at once",
+			flags: map[string]string{"uroot.reboot_on_panic": "1"},
+			want:  PanicConfig{Sysctls: map[string]string{"panic": "-1"}},
+		},
+		{
+			name:  "crash kernel",
+			flags: map[string]string{"uroot.crashkernel": "/boot/crash", "uroot.crashinitrd": "/boot/crash.cpio"},
+			want: PanicConfig{
+				Sysctls:      map[string]string{},
+				CrashKernel:  "/boot/crash",
+				CrashInitrd:  "/boot/crash.cpio",
+				CrashCmdline: "console=ttyS0 root=/dev/sda1 " + crashCmdlineAppend,
+			},
+		},
+		{
+			name:  "crash kernel cmdline",
+			flags: map[string]string{"uroot.crashkernel": "/boot/crash", "uroot.crashcmdline": "console=ttyS0"},
+			want:  PanicConfig{Sysctls: map[string]string{}, CrashKernel: "/boot/crash", CrashCmdline: "console=ttyS0"},
+		},
+		{
+			name:    "bad",
+			flags:   map[string]string{"uroot.panic_on_oops": "maybe", "uroot.panic_timeout": "0", "uroot.reboot_on_panic": "1", "uroot.sysrq": "-1", "uroot.panic_on_warn": "1"},
+			want:    PanicConfig{Sysctls: map[string]string{"panic_on_warn": "1", "panic": "0"}},
+			wantErr: "uroot.panic_on_oops=maybe",
+		},
+		{
+			name:    "initrd only",
+			flags:   map[string]string{"uroot.crashinitrd": "/boot/crash.cpio"},
+			want:    PanicConfig{Sysctls: map[string]string{}, CrashInitrd: "/boot/crash.cpio"},
+			wantErr: "without uroot.crashkernel",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			flag := func(f string) (string, bool) {
+				v, ok := tt.flags[f]
+				return v, ok
+			}
+			c, err := parsePanicConfig(flag, "console=ttyS0 crashkernel=256M root=/dev/sda1 uroot.crashkernel=/boot/crash uroot.crashinitrd=/boot/crash.cpio")
+			if tt.wantErr == "" && err != nil || tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("error = %v, want %q", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(*c, tt.want) {
+				t.Errorf("config = %+v, want %+v", *c, tt.want)
+			}
+		})
+	}
+}
+
+func TestPanicConfigApply(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "libinit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	defer func(p, k string) { procSysKernel, kexecCrashSize = p, k }(procSysKernel, kexecCrashSize)
+	procSysKernel = tmp
+	kexecCrashSize = filepath.Join(tmp, "kexec_crash_size")
+	if err := ioutil.WriteFile(kexecCrashSize, []byte("0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := &PanicConfig{Sysctls: map[string]string{"panic_on_oops": "1", "panic": "-1"}, CrashKernel: "/boot/crash"}
+	if err := c.Apply(); err == nil || !strings.Contains(err.Error(), "crashkernel=") {
+		t.Errorf("Apply without crash memory = %v, want an error about crashkernel=", err)
+	}
+	for name, want := range c.Sysctls {
+		if b, err := ioutil.ReadFile(filepath.Join(tmp, name)); err != nil || string(b) != want {
+			t.Errorf("%s = %q, %v, want %q", name, b, err, want)
+		}
+	}
+}
+
+func TestTaint(t *testing.T) {
+	for _, tt := range []struct {
+		t    Taint
+		want string
+	}{
+		{0, "not tainted"},
+		{1<<0 | 1<<12, "P O"},
+		{1<<9 | 1<<40, "W bit 40"},
+	} {
+		if got := tt.t.String(); got != tt.want {
+			t.Errorf("Taint(%#x) = %q, want %q", uint64(tt.t), got, tt.want)
+		}
+	}
+}
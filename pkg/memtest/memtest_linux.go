@@ -0,0 +1,327 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memtest
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+const mpolBind = 2
+
+// DefaultMaxFailures is how many failures Run keeps by default. A bad
+// DIMM can fail in every word; like memtest86, Run only counts failures
+// past the first ones.
+const DefaultMaxFailures = 1000
+
+// Config controls a Run.
+type Config struct {
+	// Fraction of available memory to test, in (0, 1].
+	Fraction float64
+
+	// Workers is the number of goroutines per NUMA node. Zero means one
+	// per CPU.
+	Workers int
+
+	// Loops is how many times to run all patterns.
+	Loops int
+
+	// Patterns to run. Nil means Patterns.
+	Patterns []Pattern
+
+	// NUMA allocates each node's share of memory on that node and tests
+	// it from that node's CPUs.
+	NUMA bool
+
+	// MaxFailures is how many failures Run keeps; the rest are only
+	// counted. Zero means DefaultMaxFailures.
+	MaxFailures int
+
+	// Progress, if set, is called after each pattern completes on a chunk.
+	Progress func(node int, pattern string, loop int)
+}
+
+// Node is a NUMA node.
+type Node struct {
+	ID   int
+	CPUs []int
+	// Free is the free memory on the node in bytes.
+	Free uint64
+}
+
+// Nodes returns the NUMA nodes of the machine. Machines without NUMA
+// information report a single node holding all CPUs and memory.
+func Nodes() ([]Node, error) {
+	dirs, _ := filepath.Glob("/sys/devices/system/node/node[0-9]*")
+	var nodes []Node
+	for _, d := range dirs {
+		id, err := strconv.Atoi(strings.TrimPrefix(filepath.Base(d), "node"))
+		if err != nil {
+			continue
+		}
+		b, err := ioutil.ReadFile(filepath.Join(d, "cpulist"))
+		if err != nil {
+			return nil, err
+		}
+		cpus, err := ParseCPUList(strings.TrimSpace(string(b)))
+		if err != nil {
+			return nil, err
+		}
+		free, err := meminfo(filepath.Join(d, "meminfo"), "MemFree")
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, Node{ID: id, CPUs: cpus, Free: free})
+	}
+	if len(nodes) > 0 {
+		return nodes, nil
+	}
+
+	avail, err := meminfo("/proc/meminfo", "MemAvailable")
+	if err != nil {
+		return nil, err
+	}
+	var cpus []int
+	for i := 0; i < runtime.NumCPU(); i++ {
+		cpus = append(cpus, i)
+	}
+	return []Node{{ID: -1, CPUs: cpus, Free: avail}}, nil
+}
+
+// meminfo returns a field of a /proc/meminfo style file in bytes. Per-node
+// files prefix every line with "Node N".
+func meminfo(path, field string) (uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fs := strings.Fields(s.Text())
+		for i := 0; i+1 < len(fs); i++ {
+			if fs[i] == field+":" {
+				kb, err := strconv.ParseUint(fs[i+1], 10, 64)
+				return kb * 1024, err
+			}
+		}
+	}
+	return 0, fmt.Errorf("%s: no %s", path, field)
+}
+
+// ParseCPUList parses a kernel CPU list such as "0-3,8,10-11".
+func ParseCPUList(s string) ([]int, error) {
+	var cpus []int
+	if s == "" {
+		return nil, nil
+	}
+	for _, r := range strings.Split(s, ",") {
+		b := strings.SplitN(r, "-", 2)
+		lo, err := strconv.Atoi(b[0])
+		if err != nil {
+			return nil, fmt.Errorf("bad CPU list %q: %v", s, err)
+		}
+		hi := lo
+		if len(b) == 2 {
+			if hi, err = strconv.Atoi(b[1]); err != nil {
+				return nil, fmt.Errorf("bad CPU list %q: %v", s, err)
+			}
+		}
+		for c := lo; c <= hi; c++ {
+			cpus = append(cpus, c)
+		}
+	}
+	return cpus, nil
+}
+
+// alloc maps size bytes, optionally bound to a node, and locks them in RAM.
+func alloc(size int, node int) ([]byte, error) {
+	b, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_PRIVATE|unix.MAP_ANONYMOUS)
+	if err != nil {
+		return nil, err
+	}
+	if node >= 0 {
+		var mask [16]uint64
+		mask[node/64] |= 1 << (uint(node) % 64)
+		if _, _, errno := unix.Syscall6(unix.SYS_MBIND, uintptr(unsafe.Pointer(&b[0])), uintptr(len(b)), mpolBind,
+			uintptr(unsafe.Pointer(&mask[0])), uintptr(len(mask)*64), 0); errno != 0 {
+			unix.Munmap(b)
+			return nil, fmt.Errorf("binding memory to node %d: %v", node, errno)
+		}
+	}
+	// Locking faults every page in, so it also commits the memory.
+	if err := unix.Mlock(b); err != nil {
+		unix.Munmap(b)
+		return nil, fmt.Errorf("locking %d bytes: %v", size, err)
+	}
+	return b, nil
+}
+
+// words views b as uint64s.
+func words(b []byte) []uint64 {
+	var w []uint64
+	h := (*reflect.SliceHeader)(unsafe.Pointer(&w))
+	h.Data = uintptr(unsafe.Pointer(&b[0]))
+	h.Len = len(b) / 8
+	h.Cap = len(b) / 8
+	return w
+}
+
+// physAddr translates a virtual address of this process using
+// /proc/self/pagemap. It returns 0 when that is not possible, which is the
+// case without CAP_SYS_ADMIN.
+func physAddr(pagemap *os.File, virt uintptr) uint64 {
+	if pagemap == nil {
+		return 0
+	}
+	psize := uintptr(os.Getpagesize())
+	var b [8]byte
+	if _, err := pagemap.ReadAt(b[:], int64(virt/psize*8)); err != nil {
+		return 0
+	}
+	e := binary.LittleEndian.Uint64(b[:])
+	if e&(1<<63) == 0 {
+		return 0
+	}
+	pfn := e & (1<<55 - 1)
+	if pfn == 0 {
+		return 0
+	}
+	return pfn*uint64(psize) + uint64(virt%psize)
+}
+
+// pin locks the calling goroutine to its thread and the thread to cpus.
+func pin(cpus []int) {
+	runtime.LockOSThread()
+	var set unix.CPUSet
+	for _, c := range cpus {
+		set.Set(c)
+	}
+	unix.SchedSetaffinity(0, &set)
+}
+
+// Run tests a fraction of free memory according to c. It returns the
+// first c.MaxFailures failures found and how many there were in all, and
+// an error if the test could not be set up or ctx ended it early.
+func Run(ctx context.Context, c Config) ([]Failure, int, error) {
+	if c.Fraction <= 0 || c.Fraction > 1 {
+		return nil, 0, fmt.Errorf("fraction %v out of range (0, 1]", c.Fraction)
+	}
+	max := c.MaxFailures
+	if max <= 0 {
+		max = DefaultMaxFailures
+	}
+	patterns := c.Patterns
+	if patterns == nil {
+		patterns = Patterns
+	}
+	loops := c.Loops
+	if loops < 1 {
+		loops = 1
+	}
+
+	nodes, err := Nodes()
+	if err != nil {
+		return nil, 0, err
+	}
+	if !c.NUMA {
+		var all Node
+		all.ID = -1
+		for _, n := range nodes {
+			all.CPUs = append(all.CPUs, n.CPUs...)
+			all.Free += n.Free
+		}
+		nodes = []Node{all}
+	}
+
+	pagemap, err := os.Open("/proc/self/pagemap")
+	if err != nil {
+		pagemap = nil
+	} else {
+		defer pagemap.Close()
+	}
+
+	stop := func() bool { return ctx.Err() != nil }
+	psize := uint64(os.Getpagesize())
+
+	// Allocate everything up front so a failure leaves nothing running.
+	type region struct {
+		node Node
+		buf  []uint64
+	}
+	var regions []region
+	for _, n := range nodes {
+		size := uint64(float64(n.Free)*c.Fraction) / psize * psize
+		if size == 0 {
+			continue
+		}
+		mem, err := alloc(int(size), n.ID)
+		if err != nil {
+			return nil, 0, err
+		}
+		defer unix.Munmap(mem)
+		regions = append(regions, region{node: n, buf: words(mem)})
+	}
+
+	var (
+		mu     sync.Mutex
+		fails  []Failure
+		nfails int
+		wg     sync.WaitGroup
+	)
+	for _, r := range regions {
+		workers := c.Workers
+		if workers < 1 {
+			workers = len(r.node.CPUs)
+		}
+		chunk := (len(r.buf) + workers - 1) / workers
+		for w := 0; w < workers && w*chunk < len(r.buf); w++ {
+			end := (w + 1) * chunk
+			if end > len(r.buf) {
+				end = len(r.buf)
+			}
+			wg.Add(1)
+			go func(n Node, part []uint64) {
+				defer wg.Done()
+				if n.ID >= 0 {
+					pin(n.CPUs)
+				}
+				for loop := 0; loop < loops && !stop(); loop++ {
+					for _, p := range patterns {
+						f, count := p.Test(part, stop, max)
+						for i := range f {
+							f[i].Phys = physAddr(pagemap, f[i].Virt)
+						}
+						mu.Lock()
+						if keep := max - len(fails); len(f) > keep {
+							f = f[:keep]
+						}
+						fails = append(fails, f...)
+						nfails += count
+						mu.Unlock()
+						if c.Progress != nil {
+							c.Progress(n.ID, p.Name, loop)
+						}
+					}
+				}
+			}(r.node, r.buf[w*chunk:end])
+		}
+	}
+	wg.Wait()
+	return fails, nfails, ctx.Err()
+}
@@ -0,0 +1,140 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package memtest implements memtester-style RAM tests.
+//
+// A test fills a buffer with a pattern and reads it back; any word that
+// does not hold what was written is a Failure. Buffers are usually large
+// anonymous mappings carved out of free memory, see Run.
+package memtest
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// Pattern is one test pattern. A pattern makes Passes passes over memory;
+// each pass is written by Fill and read back by Check.
+type Pattern struct {
+	Name   string
+	Passes int
+
+	// Want returns the value word i of buf holds after pass.
+	Want func(buf []uint64, i int, pass int) uint64
+}
+
+// Patterns are the patterns run by default, in order.
+var Patterns = []Pattern{
+	{Name: "walking-ones", Passes: 64, Want: walkingOnes},
+	{Name: "walking-zeros", Passes: 64, Want: walkingZeros},
+	{Name: "random", Passes: 4, Want: random},
+	{Name: "address", Passes: 2, Want: address},
+}
+
+// PatternByName returns the named pattern.
+func PatternByName(name string) (Pattern, error) {
+	for _, p := range Patterns {
+		if p.Name == name {
+			return p, nil
+		}
+	}
+	return Pattern{}, fmt.Errorf("unknown pattern %q", name)
+}
+
+func walkingOnes(buf []uint64, i int, pass int) uint64 {
+	return 1 << (uint(i+pass) % 64)
+}
+
+func walkingZeros(buf []uint64, i int, pass int) uint64 {
+	return ^walkingOnes(buf, i, pass)
+}
+
+// random is a splitmix64 hash of the word index and pass, so the check
+// phase can regenerate any word without storing the sequence.
+func random(buf []uint64, i int, pass int) uint64 {
+	z := uint64(i) + uint64(pass+1)*0x9e3779b97f4a7c15
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// address stores each word's own address, inverted on odd passes, which
+// catches address lines that are shorted or stuck.
+func address(buf []uint64, i int, pass int) uint64 {
+	a := uint64(uintptr(unsafe.Pointer(&buf[i])))
+	if pass%2 == 1 {
+		return ^a
+	}
+	return a
+}
+
+// Failure is a word that read back wrong.
+type Failure struct {
+	Pattern string
+	Pass    int
+
+	// Virt is the virtual address of the word.
+	Virt uintptr
+	// Phys is the physical address of the word, or 0 if it is unknown.
+	Phys uint64
+
+	Got  uint64
+	Want uint64
+}
+
+// String implements fmt.Stringer.
+func (f Failure) String() string {
+	phys := "unknown"
+	if f.Phys != 0 {
+		phys = fmt.Sprintf("%#x", f.Phys)
+	}
+	return fmt.Sprintf("%s pass %d: phys %s (virt %#x): got %#016x, want %#016x, bad bits %#016x",
+		f.Pattern, f.Pass, phys, f.Virt, f.Got, f.Want, f.Got^f.Want)
+}
+
+// Fill writes pass of p to buf.
+func (p Pattern) Fill(buf []uint64, pass int) {
+	for i := range buf {
+		buf[i] = p.Want(buf, i, pass)
+	}
+}
+
+// Check verifies pass of p in buf. It returns the first max words that
+// differ, and how many differ in all.
+func (p Pattern) Check(buf []uint64, pass int, max int) ([]Failure, int) {
+	var fails []Failure
+	n := 0
+	for i := range buf {
+		want := p.Want(buf, i, pass)
+		if got := buf[i]; got != want {
+			n++
+			if len(fails) >= max {
+				continue
+			}
+			fails = append(fails, Failure{
+				Pattern: p.Name,
+				Pass:    pass,
+				Virt:    uintptr(unsafe.Pointer(&buf[i])),
+				Got:     got,
+				Want:    want,
+			})
+		}
+	}
+	return fails, n
+}
+
+// Test runs every pass of p over buf. stop is polled between passes; when
+// it returns true the test ends early. Like Check, it returns the first
+// max failures and how many there were in all.
+func (p Pattern) Test(buf []uint64, stop func() bool, max int) ([]Failure, int) {
+	var fails []Failure
+	n := 0
+	for pass := 0; pass < p.Passes && !stop(); pass++ {
+		p.Fill(buf, pass)
+		f, fn := p.Check(buf, pass, max-len(fails))
+		fails = append(fails, f...)
+		n += fn
+	}
+	return fails, n
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package memtest
+
+import (
+	"testing"
+)
+
+func TestPatternsPass(t *testing.T) {
+	buf := make([]uint64, 4096)
+	for _, p := range Patterns {
+		if f, n := p.Test(buf, func() bool { return false }, 10); len(f) != 0 || n != 0 {
+			t.Errorf("%s: got %d failures %v on good memory", p.Name, n, f)
+		}
+	}
+}
+
+func TestCheckFindsStuckBit(t *testing.T) {
+	buf := make([]uint64, 64)
+	for _, p := range Patterns {
+		p.Fill(buf, 1)
+		buf[17] ^= 1 << 3
+		f, n := p.Check(buf, 1, 10)
+		if len(f) != 1 || n != 1 {
+			t.Fatalf("%s: got %d failures, %d kept, want 1", p.Name, n, len(f))
+		}
+		if f[0].Got^f[0].Want != 1<<3 || f[0].Pattern != p.Name || f[0].Pass != 1 {
+			t.Errorf("%s: got failure %v, want bit 3 of word 17", p.Name, f[0])
+		}
+	}
+}
+
+func TestCheckMax(t *testing.T) {
+	p, err := PatternByName("random")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]uint64, 64)
+	p.Fill(buf, 0)
+	for i := range buf {
+		buf[i] = ^buf[i]
+	}
+	f, n := p.Check(buf, 0, 5)
+	if len(f) != 5 || n != 64 {
+		t.Fatalf("Check of all bad words = %d failures, %d kept, want 64, 5 kept", n, len(f))
+	}
+	if f[4].Virt != f[0].Virt+4*8 {
+		t.Errorf("Check kept %v, want the first 5 words", f)
+	}
+
+	// A word that never reads back what was written fails every pass.
+	var calls uint64
+	flaky := Pattern{Name: "flaky", Passes: 3, Want: func([]uint64, int, int) uint64 {
+		calls++
+		return calls
+	}}
+	f, n = flaky.Test(make([]uint64, 8), func() bool { return false }, 5)
+	if len(f) != 5 || n != 24 {
+		t.Errorf("Test of bad memory = %d failures, %d kept, want 24, 5 kept", n, len(f))
+	}
+}
+
+func TestTestStops(t *testing.T) {
+	p, err := PatternByName("walking-ones")
+	if err != nil {
+		t.Fatal(err)
+	}
+	passes := 0
+	buf := make([]uint64, 8)
+	p.Test(buf, func() bool {
+		passes++
+		return passes > 3
+	}, 10)
+	if passes != 4 {
+		t.Errorf("Test polled stop %d times, want 4", passes)
+	}
+	if _, err := PatternByName("nope"); err == nil {
+		t.Errorf("PatternByName(nope) = nil, want error")
+	}
+}
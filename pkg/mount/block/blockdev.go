@@ -11,9 +11,11 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"unsafe"
 
@@ -98,6 +100,71 @@ func (b *BlockDev) GPTTable() (*gpt.Table, error) {
 	return &table, nil
 }
 
+// PartUUID returns the partition UUID of the partition b, as root=PARTUUID=
+// names it: the unique partition GUID for GPT disks, or the disk signature
+// and partition number for MBR disks.
+func (b *BlockDev) PartUUID() (string, error) {
+	sys, err := filepath.EvalSymlinks(filepath.Join("/sys/class/block", b.Name))
+	if err != nil {
+		return "", err
+	}
+	p, err := ioutil.ReadFile(filepath.Join(sys, "partition"))
+	if err != nil {
+		return "", fmt.Errorf("%s is not a partition: %v", b.Name, err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(p)))
+	if err != nil {
+		return "", err
+	}
+
+	disk := &BlockDev{Name: filepath.Base(filepath.Dir(sys))}
+	f, err := os.Open(disk.DevicePath())
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	blkSize, err := disk.BlockSize()
+	if err != nil {
+		blkSize = 512
+	}
+	return partUUID(f, uint64(blkSize), n)
+}
+
+// MBR fields used for partition UUIDs.
+const (
+	mbrSignatureOff = 440
+	mbrPartTypeOff  = 450
+	mbrPartTypeGPT  = 0xEE
+)
+
+// partUUID returns the partition UUID of partition n of disk.
+func partUUID(disk io.ReadSeeker, blkSize uint64, n int) (string, error) {
+	mbr := make([]byte, 512)
+	if _, err := io.ReadFull(disk, mbr); err != nil {
+		return "", err
+	}
+	if mbr[510] != 0x55 || mbr[511] != 0xAA {
+		return "", errors.New("no partition table")
+	}
+	if mbr[mbrPartTypeOff] != mbrPartTypeGPT {
+		// The kernel numbers logical partitions from 5 on, as
+		// PARTUUID does.
+		return fmt.Sprintf("%08x-%02x", binary.LittleEndian.Uint32(mbr[mbrSignatureOff:]), n), nil
+	}
+
+	if _, err := disk.Seek(int64(blkSize), io.SeekStart); err != nil {
+		return "", err
+	}
+	table, err := gpt.ReadTable(disk, blkSize)
+	if err != nil {
+		return "", err
+	}
+	if n < 1 || n > len(table.Partitions) || table.Partitions[n-1].IsEmpty() {
+		return "", fmt.Errorf("no GPT partition %d", n)
+	}
+	return strings.ToLower(table.Partitions[n-1].Id.String()), nil
+}
+
 // PhysicalBlockSize returns the physical block size.
 func (b *BlockDev) PhysicalBlockSize() (int, error) {
 	f, err := os.Open(b.DevicePath())
@@ -231,7 +298,15 @@ func getFSUUID(devpath string) (string, error) {
 	if err == nil {
 		return fsuuid, nil
 	}
-	return "", fmt.Errorf("unknown UUID (not vfat, ext4, nor xfs)")
+	fsuuid, err = tryEXFAT(file)
+	if err == nil {
+		return fsuuid, nil
+	}
+	fsuuid, err = tryF2FS(file)
+	if err == nil {
+		return fsuuid, nil
+	}
+	return "", fmt.Errorf("unknown UUID (not vfat, ext4, xfs, exfat, nor f2fs)")
 }
 
 // See https://www.nongnu.org/ext2-doc/ext2.html#DISK-ORGANISATION.
@@ -368,6 +443,65 @@ func tryXFS(file io.ReaderAt) (string, error) {
 	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
 }
 
+// See the exFAT specification, section 3.1.
+const (
+	exfatMagic     = "EXFAT   "
+	exfatMagicOff  = 3
+	exfatMagicSize = 8
+
+	// Offset of volume serial number. Treated as short filesystem UUID.
+	exfatIDOff  = 100
+	exfatIDSize = 4
+)
+
+func tryEXFAT(file io.ReaderAt) (string, error) {
+	// Read magic number.
+	b := make([]byte, exfatMagicSize)
+	if _, err := file.ReadAt(b, exfatMagicOff); err != nil {
+		return "", err
+	}
+	magic := string(b)
+	if magic != exfatMagic {
+		return "", fmt.Errorf("exfat magic not found")
+	}
+
+	// Filesystem UUID.
+	b = make([]byte, exfatIDSize)
+	if _, err := file.ReadAt(b, exfatIDOff); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%02x%02x-%02x%02x", b[3], b[2], b[1], b[0]), nil
+}
+
+// See include/linux/f2fs_fs.h.
+const (
+	f2fsSprblkOff = 1024
+	f2fsMagic     = 0xF2F52010
+	f2fsUUIDOff   = 108
+	f2fsUUIDSize  = 16
+)
+
+func tryF2FS(file io.ReaderAt) (string, error) {
+	// Read magic number.
+	b := make([]byte, 4)
+	if _, err := file.ReadAt(b, f2fsSprblkOff); err != nil {
+		return "", err
+	}
+	magic := binary.LittleEndian.Uint32(b)
+	if magic != f2fsMagic {
+		return "", fmt.Errorf("f2fs magic not found")
+	}
+
+	// Filesystem UUID.
+	b = make([]byte, f2fsUUIDSize)
+	if _, err := file.ReadAt(b, f2fsSprblkOff+f2fsUUIDOff); err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
 // BlockDevices is a list of block devices.
 type BlockDevices []*BlockDev
 
@@ -5,8 +5,12 @@
 package block
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
 	"testing"
 
+	"github.com/rekby/gpt"
 	"github.com/stretchr/testify/require"
 )
 
@@ -26,3 +30,50 @@ func TestFindMountPointValid(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, *mountpoint, "/media/usb")
 }
+
+func TestPartUUIDMBR(t *testing.T) {
+	disk := make([]byte, 512)
+	copy(disk[mbrSignatureOff:], []byte{0x78, 0x56, 0x34, 0x12})
+	disk[mbrPartTypeOff] = 0x83
+	disk[510], disk[511] = 0x55, 0xAA
+
+	uuid, err := partUUID(bytes.NewReader(disk), 512, 5)
+	require.NoError(t, err)
+	require.Equal(t, "12345678-05", uuid)
+
+	_, err = partUUID(bytes.NewReader(make([]byte, 512)), 512, 1)
+	require.Error(t, err)
+}
+
+func TestPartUUIDGPT(t *testing.T) {
+	f, err := ioutil.TempFile("", "gpt")
+	require.NoError(t, err)
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	mbr := make([]byte, 512)
+	mbr[mbrPartTypeOff] = mbrPartTypeGPT
+	mbr[510], mbr[511] = 0x55, 0xAA
+	_, err = f.Write(mbr)
+	require.NoError(t, err)
+
+	table := gpt.NewTable(1<<20, nil)
+	id, err := gpt.StringToGuid("0FC63DAF-8483-4772-8E79-3D69D8477DE4")
+	require.NoError(t, err)
+	table.Partitions[1].Type = gpt.PartType(id)
+	table.Partitions[1].Id, err = gpt.StringToGuid("6A5D2C1B-3E4F-4A5B-8C7D-9E0F1A2B3C4D")
+	require.NoError(t, err)
+	table.Partitions[1].FirstLBA, table.Partitions[1].LastLBA = 2048, 2048
+	require.NoError(t, table.Write(f))
+
+	_, err = f.Seek(0, 0)
+	require.NoError(t, err)
+	uuid, err := partUUID(f, 512, 2)
+	require.NoError(t, err)
+	require.Equal(t, "6a5d2c1b-3e4f-4a5b-8c7d-9e0f1a2b3c4d", uuid)
+
+	_, err = f.Seek(0, 0)
+	require.NoError(t, err)
+	_, err = partUUID(f, 512, 1)
+	require.Error(t, err)
+}
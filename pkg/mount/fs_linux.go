@@ -7,6 +7,7 @@ package mount
 import (
 	"fmt"
 	"io/ioutil"
+	"strconv"
 	"strings"
 )
 
@@ -52,3 +53,24 @@ func internalGetFilesystems(file string) (fstypes []string, err error) {
 	}
 	return fstypes, nil
 }
+
+// Unescape undoes the octal escapes the kernel puts in paths in
+// /proc/mounts, /proc/swaps and the like, for spaces, tabs, newlines and
+// backslashes.
+func Unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
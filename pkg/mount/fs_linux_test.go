@@ -59,3 +59,17 @@ nodev   ramfs
 		})
 	}
 }
+
+func TestUnescape(t *testing.T) {
+	for in, want := range map[string]string{
+		`plain`:       "plain",
+		`a\040b`:      "a b",
+		`tab\011`:     "tab\t",
+		`not\escaped`: `not\escaped`,
+		`short\04`:    `short\04`,
+	} {
+		if got := Unescape(in); got != want {
+			t.Errorf("Unescape(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gpt
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// protectiveType is the MBR partition type of a GPT protective partition.
+const protectiveType = 0xee
+
+// Used reports whether the partition entry is in use.
+func (p *Part) Used() bool {
+	return p.PartGUID != GUID{}
+}
+
+// NewGUID returns a random (version 4) GUID.
+func NewGUID() (GUID, error) {
+	var b [16]byte
+	if _, err := io.ReadFull(rand.Reader, b[:]); err != nil {
+		return GUID{}, err
+	}
+	g := GUID{
+		L:  binary.LittleEndian.Uint32(b[0:]),
+		W1: binary.LittleEndian.Uint16(b[4:]),
+		W2: binary.LittleEndian.Uint16(b[6:])&0x0fff | 0x4000,
+	}
+	copy(g.B[:], b[8:])
+	g.B[0] = g.B[0]&0x3f | 0x80
+	return g, nil
+}
+
+// Size returns the size in bytes of r, which is usually a disk device or
+// an image file.
+func Size(r io.Seeker) (int64, error) {
+	cur, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := r.Seek(cur, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// Clone returns a copy of the partition table in p laid out for a disk of
+// size bytes, so that a table dumped from one disk can be written to
+// another of a different size. The backup GPT moves to the end of the new
+// disk, the usable space grows or shrinks with it, and the protective MBR
+// partition is resized to match. It is an error if a partition would not
+// fit on the new disk.
+//
+// If newGUIDs is set, the disk and every partition in use get fresh
+// unique GUIDs, so that the copy can live alongside the original.
+func Clone(p *PartitionTable, size int64, newGUIDs bool) (*PartitionTable, error) {
+	if p.Primary == nil {
+		return nil, fmt.Errorf("no primary GPT to clone")
+	}
+	if p.Primary.PartSize == 0 || int(p.Primary.NPart) > len(p.Primary.Parts) {
+		return nil, fmt.Errorf("primary GPT has %d partition entries of %d bytes and %d partitions", p.Primary.NPart, p.Primary.PartSize, len(p.Primary.Parts))
+	}
+	pg := &GPT{Header: p.Primary.Header, Parts: append([]Part{}, p.Primary.Parts[:p.Primary.NPart]...)}
+
+	// Partition entries take up whole blocks at each end of the disk.
+	partBlocks := (uint64(pg.NPart)*uint64(pg.PartSize) + BlockSize - 1) / BlockSize
+	blocks := uint64(size / BlockSize)
+	if blocks < 2*(partBlocks+1)+1 || pg.FirstLBA < 2+partBlocks {
+		return nil, fmt.Errorf("a disk of %d bytes is too small for a GPT of %d partitions", size, pg.NPart)
+	}
+	last := blocks - 1
+
+	pg.CurrentLBA = 1
+	pg.BackupLBA = last
+	pg.PartStart = 2
+	pg.LastLBA = last - partBlocks - 1
+	if pg.FirstLBA > pg.LastLBA {
+		return nil, fmt.Errorf("a disk of %d bytes has no room for partitions after LBA %#x", size, pg.FirstLBA)
+	}
+	for i, part := range pg.Parts {
+		if !part.Used() {
+			continue
+		}
+		if part.FirstLBA < pg.FirstLBA || part.LastLBA > pg.LastLBA || part.FirstLBA > part.LastLBA {
+			return nil, fmt.Errorf("partition %d (LBA %#x to %#x) does not fit in usable LBAs %#x to %#x", i+1, part.FirstLBA, part.LastLBA, pg.FirstLBA, pg.LastLBA)
+		}
+	}
+
+	if newGUIDs {
+		var err error
+		if pg.DiskGUID, err = NewGUID(); err != nil {
+			return nil, err
+		}
+		for i := range pg.Parts {
+			if !pg.Parts[i].Used() {
+				continue
+			}
+			if pg.Parts[i].UniqueGUID, err = NewGUID(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	bg := &GPT{Header: pg.Header, Parts: append([]Part{}, pg.Parts...)}
+	bg.CurrentLBA = last
+	bg.BackupLBA = 1
+	bg.PartStart = last - partBlocks
+
+	mbr := &MBR{}
+	if p.MasterBootRecord != nil {
+		*mbr = *p.MasterBootRecord
+	}
+	resizeProtective(mbr, blocks)
+
+	return &PartitionTable{MasterBootRecord: mbr, Primary: pg, Backup: bg}, nil
+}
+
+// resizeProtective makes a protective partition in m cover a disk of
+// blocks blocks, or as much of it as an MBR can.
+func resizeProtective(m *MBR, blocks uint64) {
+	for e := 0x1be; e < 0x1fe; e += 16 {
+		if m[e+4] != protectiveType {
+			continue
+		}
+		n := blocks - 1
+		if n > 0xffffffff {
+			n = 0xffffffff
+		}
+		binary.LittleEndian.PutUint32(m[e+12:], uint32(n))
+	}
+}
@@ -221,3 +221,81 @@ func TestWrite(t *testing.T) {
 		t.Fatalf("Reading back new header: new:%s\n%v", n, err)
 	}
 }
+
+func TestClone(t *testing.T) {
+	InstallGPT()
+	p, err := New(bytes.NewReader(disk))
+	if err != nil {
+		t.Fatalf("Reading partitions: got %v, want nil", err)
+	}
+
+	// Grow the disk to all of the test buffer, then check the copy reads
+	// back with the backup at the new end and the same partitions.
+	c, err := Clone(p, int64(len(disk)), false)
+	if err != nil {
+		t.Fatalf("Clone: got %v, want nil", err)
+	}
+	var targ = make(iodisk, len(disk))
+	if err := Write(&targ, c); err != nil {
+		t.Fatalf("Writing: got %v, want nil", err)
+	}
+	n, err := New(bytes.NewReader([]byte(targ)))
+	if err != nil {
+		t.Fatalf("Reading back clone: got %v, want nil", err)
+	}
+	last := uint64(len(disk)/BlockSize - 1)
+	if n.Primary.BackupLBA != last || n.Backup.CurrentLBA != last {
+		t.Errorf("Backup LBA: got %#x and %#x, want %#x", n.Primary.BackupLBA, n.Backup.CurrentLBA, last)
+	}
+	if n.Primary.LastLBA != last-33 {
+		t.Errorf("LastLBA: got %#x, want %#x", n.Primary.LastLBA, last-33)
+	}
+	if err := EqualParts(p.Primary, n.Primary); err != nil {
+		t.Errorf("Partitions differ: %v", err)
+	}
+	if n.Primary.DiskGUID != p.Primary.DiskGUID {
+		t.Errorf("DiskGUID: got %v, want %v", n.Primary.DiskGUID, p.Primary.DiskGUID)
+	}
+
+	if _, err := Clone(p, 1<<20, false); err == nil {
+		t.Errorf("Clone to 1 MiB: got nil, want error")
+	}
+}
+
+func TestCloneNewGUIDs(t *testing.T) {
+	InstallGPT()
+	p, err := New(bytes.NewReader(disk))
+	if err != nil {
+		t.Fatalf("Reading partitions: got %v, want nil", err)
+	}
+	c, err := Clone(p, int64(p.Primary.BackupLBA+1)*BlockSize, true)
+	if err != nil {
+		t.Fatalf("Clone: got %v, want nil", err)
+	}
+	if c.Primary.DiskGUID == p.Primary.DiskGUID {
+		t.Errorf("DiskGUID was not changed")
+	}
+	if c.Primary.DiskGUID.W2>>12 != 4 || c.Primary.DiskGUID.B[0]>>6 != 2 {
+		t.Errorf("DiskGUID %v is not a version 4 GUID", c.Primary.DiskGUID)
+	}
+	seen := map[GUID]bool{c.Primary.DiskGUID: true}
+	for i, part := range c.Primary.Parts {
+		old := p.Primary.Parts[i]
+		if !old.Used() {
+			if part != old {
+				t.Errorf("Unused partition %d changed", i)
+			}
+			continue
+		}
+		if part.UniqueGUID == old.UniqueGUID || seen[part.UniqueGUID] {
+			t.Errorf("Partition %d UniqueGUID %v is not new", i, part.UniqueGUID)
+		}
+		seen[part.UniqueGUID] = true
+		if part.PartGUID != old.PartGUID || part.FirstLBA != old.FirstLBA || part.LastLBA != old.LastLBA {
+			t.Errorf("Partition %d: got %v, want only a new UniqueGUID on %v", i, part, old)
+		}
+		if c.Backup.Parts[i] != part {
+			t.Errorf("Backup partition %d: got %v, want %v", i, c.Backup.Parts[i], part)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package md creates, inspects and manages Linux software RAID (md)
+// arrays.
+//
+// Arrays are created with the kernel's md ioctls and 0.90 metadata, which
+// the kernel writes itself, so no superblock code is needed here. 0.90
+// metadata limits an array to 27 devices of at most 2 TiB each, and is
+// the format the kernel can autodetect at boot. Status and fail and remove
+// go through sysfs and work on arrays of any metadata version.
+package md
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Level is a RAID level.
+type Level int
+
+// Levels Create supports.
+const (
+	RAID0  Level = 0
+	RAID1  Level = 1
+	RAID10 Level = 10
+)
+
+// ParseLevel parses a level such as "1", "raid1" or "mirror".
+func ParseLevel(s string) (Level, error) {
+	switch strings.TrimPrefix(strings.ToLower(s), "raid") {
+	case "0", "stripe":
+		return RAID0, nil
+	case "1", "mirror":
+		return RAID1, nil
+	case "10":
+		return RAID10, nil
+	}
+	return 0, fmt.Errorf("RAID level %q is not one of 0, 1 or 10", s)
+}
+
+func (l Level) String() string {
+	return fmt.Sprintf("raid%d", int(l))
+}
+
+// Member is a device in an array.
+type Member struct {
+	// Name is the kernel name of the device, e.g. sda1.
+	Name string
+
+	// Slot is the device's role in the array, or -1 for a spare or a
+	// failed device.
+	Slot int
+
+	// State is the device's sysfs state flags, e.g. in_sync, faulty or
+	// spare.
+	State []string
+}
+
+// Has reports whether the member has state flag s.
+func (m *Member) Has(s string) bool {
+	for _, f := range m.State {
+		if f == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Array is the status of an array.
+type Array struct {
+	// Name is the kernel name of the array, e.g. md0.
+	Name string
+
+	Level    string
+	Metadata string
+	State    string
+
+	// RaidDisks is how many devices the array should have, and Degraded
+	// how many of those are missing.
+	RaidDisks int
+	Degraded  int
+
+	// ChunkSize is in bytes and Size, that of the whole array, too.
+	ChunkSize int
+	Size      int64
+
+	// SyncAction is what the array is doing, e.g. idle, resync or
+	// recover, and SyncDone of SyncTotal sectors are done.
+	SyncAction string
+	SyncDone   int64
+	SyncTotal  int64
+
+	Members []Member
+}
+
+// Syncing reports whether the array is resyncing, recovering or reshaping.
+func (a *Array) Syncing() bool {
+	return a.SyncAction != "" && a.SyncAction != "idle" && a.SyncAction != "frozen"
+}
+
+func (a *Array) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s %s, %d devices, %d bytes, metadata %s", a.Name, a.State, a.Level, a.RaidDisks, a.Size, a.Metadata)
+	if a.Degraded > 0 {
+		fmt.Fprintf(&b, ", degraded by %d", a.Degraded)
+	}
+	if a.Syncing() {
+		fmt.Fprintf(&b, ", %s", a.SyncAction)
+		if a.SyncTotal > 0 {
+			fmt.Fprintf(&b, " %.1f%%", 100*float64(a.SyncDone)/float64(a.SyncTotal))
+		}
+	}
+	for _, m := range a.Members {
+		slot := "-"
+		if m.Slot >= 0 {
+			slot = fmt.Sprint(m.Slot)
+		}
+		fmt.Fprintf(&b, "\n\t%s\t%s\t%s", slot, m.Name, strings.Join(m.State, ","))
+	}
+	return b.String()
+}
+
+// Events monitoring can report, named as mdadm names them.
+const (
+	EventNewArray          = "NewArray"
+	EventDeviceDisappeared = "DeviceDisappeared"
+	EventDegradedArray     = "DegradedArray"
+	EventFail              = "Fail"
+	EventSpareActive       = "SpareActive"
+	EventRebuildStarted    = "RebuildStarted"
+	EventRebuildFinished   = "RebuildFinished"
+)
+
+// Event is a change in an array.
+type Event struct {
+	Name  string
+	Array string
+
+	// Member is the device the event is about, if any.
+	Member string
+}
+
+func (e Event) String() string {
+	if e.Member != "" {
+		return fmt.Sprintf("%s %s %s", e.Name, e.Array, e.Member)
+	}
+	return fmt.Sprintf("%s %s", e.Name, e.Array)
+}
+
+// Events returns what changed from old to new, two statuses of an array.
+// old is nil for an array that has just appeared and new for one that
+// has gone.
+func Events(old, new *Array) []Event {
+	var ev []Event
+	switch {
+	case old == nil && new == nil:
+		return nil
+	case new == nil:
+		return []Event{{Name: EventDeviceDisappeared, Array: old.Name}}
+	case old == nil:
+		ev = append(ev, Event{Name: EventNewArray, Array: new.Name})
+		if new.Degraded > 0 {
+			ev = append(ev, Event{Name: EventDegradedArray, Array: new.Name})
+		}
+		if new.Syncing() {
+			ev = append(ev, Event{Name: EventRebuildStarted, Array: new.Name})
+		}
+		return ev
+	}
+
+	was := make(map[string]Member, len(old.Members))
+	for _, m := range old.Members {
+		was[m.Name] = m
+	}
+	for _, m := range new.Members {
+		o, ok := was[m.Name]
+		if m.Has("faulty") && (!ok || !o.Has("faulty")) {
+			ev = append(ev, Event{Name: EventFail, Array: new.Name, Member: m.Name})
+		}
+		if ok && m.Has("in_sync") && !o.Has("in_sync") && m.Slot >= 0 {
+			ev = append(ev, Event{Name: EventSpareActive, Array: new.Name, Member: m.Name})
+		}
+	}
+	if new.Degraded > old.Degraded {
+		ev = append(ev, Event{Name: EventDegradedArray, Array: new.Name})
+	}
+	switch {
+	case new.Syncing() && !old.Syncing():
+		ev = append(ev, Event{Name: EventRebuildStarted, Array: new.Name})
+	case !new.Syncing() && old.Syncing():
+		ev = append(ev, Event{Name: EventRebuildFinished, Array: new.Name})
+	}
+	return ev
+}
+
+// maxDevices is MD_SB_DISKS, the most devices 0.90 metadata describes.
+const maxDevices = 27
+
+// reservedSectors is MD_RESERVED_SECTORS, the space 0.90 metadata keeps
+// at the end of each device.
+const reservedSectors = 128
+
+// componentSize returns the size in KiB to use of each of devices of
+// sizes bytes: that of the smallest, less room for the superblock, in
+// whole chunks of chunk bytes.
+func componentSize(sizes []int64, chunk int) (int, error) {
+	var min int64 = -1
+	for _, s := range sizes {
+		if min < 0 || s < min {
+			min = s
+		}
+	}
+	sectors := min/512&^(reservedSectors-1) - reservedSectors
+	if sectors <= 0 {
+		return 0, fmt.Errorf("devices of %d bytes are too small", min)
+	}
+	kib := sectors / 2
+	if chunk > 1024 {
+		kib -= kib % int64(chunk/1024)
+	}
+	if kib > math.MaxInt32 {
+		return 0, fmt.Errorf("devices of %d bytes are too big for 0.90 metadata", min)
+	}
+	return int(kib), nil
+}
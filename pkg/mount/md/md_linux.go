@@ -0,0 +1,364 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package md
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+var (
+	sysBlock = "/sys/block"
+	devDir   = "/dev"
+)
+
+// mdMajor is MD_MAJOR, the block major of mdN devices.
+const mdMajor = 9
+
+// md ioctls, from include/uapi/linux/raid/md_u.h.
+const (
+	_SET_ARRAY_INFO = 0x40480923 // _IOW(MD_MAJOR, 0x23, mdu_array_info_t)
+	_ADD_NEW_DISK   = 0x40140921 // _IOW(MD_MAJOR, 0x21, mdu_disk_info_t)
+	_RUN_ARRAY      = 0x400c0930 // _IOW(MD_MAJOR, 0x30, mdu_param_t)
+	_STOP_ARRAY     = 0x932      // _IO(MD_MAJOR, 0x32)
+	_HOT_ADD_DISK   = 0x928      // _IO(MD_MAJOR, 0x28)
+)
+
+// arrayInfo is mdu_array_info_t.
+type arrayInfo struct {
+	MajorVersion  int32
+	MinorVersion  int32
+	PatchVersion  int32
+	Ctime         uint32
+	Level         int32
+	Size          int32
+	NrDisks       int32
+	RaidDisks     int32
+	MdMinor       int32
+	NotPersistent int32
+	Utime         uint32
+	State         int32
+	ActiveDisks   int32
+	WorkingDisks  int32
+	FailedDisks   int32
+	SpareDisks    int32
+	Layout        int32
+	ChunkSize     int32
+}
+
+// diskInfo is mdu_disk_info_t.
+type diskInfo struct {
+	Number   int32
+	Major    int32
+	Minor    int32
+	RaidDisk int32
+	State    int32
+}
+
+// Disk state bits, MD_DISK_*.
+const (
+	diskActive = 1 << 1
+	diskSync   = 1 << 2
+)
+
+// raid10Near2 is the RAID10 layout with two near copies, mdadm's default.
+const raid10Near2 = 0x102
+
+// DefaultChunk is the chunk size Create uses for striped levels if none
+// is given, as mdadm does.
+const DefaultChunk = 512 << 10
+
+func ioctl(f *os.File, req uintptr, arg uintptr) error {
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), req, arg); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// kernelName returns the kernel name of an array or device given as a name
+// such as md0 or a path such as /dev/md0 or /dev/disk/by-id/....
+func kernelName(s string) string {
+	if !strings.Contains(s, "/") {
+		return s
+	}
+	if p, err := filepath.EvalSymlinks(s); err == nil {
+		s = p
+	}
+	return filepath.Base(s)
+}
+
+// arrayMinor returns N for array mdN.
+func arrayMinor(name string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimPrefix(name, "md"))
+	if err != nil || !strings.HasPrefix(name, "md") || n < 0 {
+		return 0, fmt.Errorf("%q is not an array name of the form mdN", name)
+	}
+	return n, nil
+}
+
+// openArray opens the device node of array mdN, making the node if it is
+// not there yet. Opening the node creates the array in the kernel.
+func openArray(name string) (*os.File, error) {
+	minor, err := arrayMinor(name)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(devDir, name)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		if err := unix.Mknod(path, unix.S_IFBLK|0660, int(unix.Mkdev(mdMajor, uint32(minor)))); err != nil {
+			return nil, fmt.Errorf("making %s: %v", path, err)
+		}
+	}
+	return os.OpenFile(path, os.O_RDWR, 0)
+}
+
+// blockDevice returns the device number and size in bytes of block device
+// path.
+func blockDevice(path string) (uint64, int64, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return 0, 0, fmt.Errorf("%s: %v", path, err)
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFBLK {
+		return 0, 0, fmt.Errorf("%s is not a block device", path)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, 0, fmt.Errorf("%s: %v", path, err)
+	}
+	return uint64(st.Rdev), size, nil
+}
+
+// Create creates and starts array name, e.g. md0, of level from devices,
+// with 0.90 metadata. chunk is the chunk size in bytes for RAID0 and
+// RAID10, or 0 for DefaultChunk. Redundant arrays start with a resync.
+func Create(name string, level Level, chunk int, devices []string) error {
+	name = kernelName(name)
+	minor, err := arrayMinor(name)
+	if err != nil {
+		return err
+	}
+	switch level {
+	case RAID0, RAID10:
+		if chunk == 0 {
+			chunk = DefaultChunk
+		}
+		if chunk < 4096 || chunk&(chunk-1) != 0 {
+			return fmt.Errorf("chunk size %d is not a power of 2 of at least 4096", chunk)
+		}
+	case RAID1:
+		chunk = 0
+	default:
+		return fmt.Errorf("cannot create %v arrays", level)
+	}
+	if len(devices) < 2 || len(devices) > maxDevices {
+		return fmt.Errorf("%v needs 2 to %d devices, not %d", level, maxDevices, len(devices))
+	}
+
+	devs := make([]uint64, len(devices))
+	sizes := make([]int64, len(devices))
+	for i, d := range devices {
+		if devs[i], sizes[i], err = blockDevice(d); err != nil {
+			return err
+		}
+	}
+	size, err := componentSize(sizes, chunk)
+	if err != nil {
+		return err
+	}
+
+	f, err := openArray(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info := arrayInfo{
+		MajorVersion: 0,
+		MinorVersion: 90,
+		Ctime:        uint32(time.Now().Unix()),
+		Level:        int32(level),
+		Size:         int32(size),
+		NrDisks:      int32(len(devices)),
+		RaidDisks:    int32(len(devices)),
+		MdMinor:      int32(minor),
+		ActiveDisks:  int32(len(devices)),
+		WorkingDisks: int32(len(devices)),
+		ChunkSize:    int32(chunk),
+	}
+	if level == RAID10 {
+		info.Layout = raid10Near2
+	}
+	if err := ioctl(f, _SET_ARRAY_INFO, uintptr(unsafe.Pointer(&info))); err != nil {
+		return fmt.Errorf("setting up %s: %v", name, err)
+	}
+	for i, dev := range devs {
+		d := diskInfo{
+			Number:   int32(i),
+			Major:    int32(unix.Major(dev)),
+			Minor:    int32(unix.Minor(dev)),
+			RaidDisk: int32(i),
+			State:    diskActive | diskSync,
+		}
+		if err := ioctl(f, _ADD_NEW_DISK, uintptr(unsafe.Pointer(&d))); err != nil {
+			ioctl(f, _STOP_ARRAY, 0)
+			return fmt.Errorf("adding %s to %s: %v", devices[i], name, err)
+		}
+	}
+	if err := ioctl(f, _RUN_ARRAY, 0); err != nil {
+		ioctl(f, _STOP_ARRAY, 0)
+		return fmt.Errorf("starting %s: %v", name, err)
+	}
+	return nil
+}
+
+// Stop stops array name. Nothing may have it open.
+func Stop(name string) error {
+	name = kernelName(name)
+	f, err := os.OpenFile(filepath.Join(devDir, name), os.O_RDONLY|unix.O_EXCL, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := ioctl(f, _STOP_ARRAY, 0); err != nil {
+		return fmt.Errorf("stopping %s: %v", name, err)
+	}
+	return nil
+}
+
+// Add adds device to a running array as a spare, which the kernel uses
+// to rebuild a degraded array. The kernel can only add devices this way
+// to 0.90 arrays.
+func Add(name, device string) error {
+	name = kernelName(name)
+	if b, err := ioutil.ReadFile(filepath.Join(sysBlock, name, "md/metadata_version")); err == nil {
+		if v := strings.TrimSpace(string(b)); v != "0.90" {
+			return fmt.Errorf("cannot add devices to %s, which has metadata %s rather than 0.90", name, v)
+		}
+	}
+	dev, _, err := blockDevice(device)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(devDir, name), os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := ioctl(f, _HOT_ADD_DISK, uintptr(dev)); err != nil {
+		return fmt.Errorf("adding %s to %s: %v", device, name, err)
+	}
+	return nil
+}
+
+// setMemberState writes state to the sysfs state of device in array name.
+func setMemberState(name, device, state string) error {
+	name, device = kernelName(name), kernelName(device)
+	path := filepath.Join(sysBlock, name, "md", "dev-"+device, "state")
+	if err := ioutil.WriteFile(path, []byte(state), 0); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%s is not in %s", device, name)
+		}
+		return fmt.Errorf("setting %s in %s %s: %v", device, name, state, err)
+	}
+	return nil
+}
+
+// Fail marks device in array name faulty.
+func Fail(name, device string) error {
+	return setMemberState(name, device, "faulty")
+}
+
+// Remove removes device from array name. It must be faulty or a spare.
+func Remove(name, device string) error {
+	return setMemberState(name, device, "remove")
+}
+
+// Arrays returns the names of the md arrays the kernel knows of.
+func Arrays() ([]string, error) {
+	fis, err := ioutil.ReadDir(sysBlock)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, fi := range fis {
+		if _, err := os.Stat(filepath.Join(sysBlock, fi.Name(), "md")); err == nil {
+			names = append(names, fi.Name())
+		}
+	}
+	return names, nil
+}
+
+func readString(dir, file string) string {
+	b, err := ioutil.ReadFile(filepath.Join(dir, file))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(b))
+}
+
+func readInt(dir, file string) int64 {
+	n, _ := strconv.ParseInt(readString(dir, file), 10, 64)
+	return n
+}
+
+// Status returns the status of array name from sysfs.
+func Status(name string) (*Array, error) {
+	name = kernelName(name)
+	dir := filepath.Join(sysBlock, name, "md")
+	if _, err := os.Stat(dir); err != nil {
+		return nil, fmt.Errorf("%s is not an md array: %v", name, err)
+	}
+	a := &Array{
+		Name:       name,
+		Level:      readString(dir, "level"),
+		Metadata:   readString(dir, "metadata_version"),
+		State:      readString(dir, "array_state"),
+		RaidDisks:  int(readInt(dir, "raid_disks")),
+		Degraded:   int(readInt(dir, "degraded")),
+		ChunkSize:  int(readInt(dir, "chunk_size")),
+		Size:       readInt(filepath.Join(sysBlock, name), "size") * 512,
+		SyncAction: readString(dir, "sync_action"),
+	}
+	// sync_completed is "done / total" in sectors, or "none".
+	if f := strings.Fields(readString(dir, "sync_completed")); len(f) == 3 && f[1] == "/" {
+		a.SyncDone, _ = strconv.ParseInt(f[0], 10, 64)
+		a.SyncTotal, _ = strconv.ParseInt(f[2], 10, 64)
+	}
+
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, fi := range fis {
+		if !strings.HasPrefix(fi.Name(), "dev-") {
+			continue
+		}
+		d := filepath.Join(dir, fi.Name())
+		m := Member{Name: strings.TrimPrefix(fi.Name(), "dev-"), Slot: -1}
+		if s, err := strconv.Atoi(readString(d, "slot")); err == nil {
+			m.Slot = s
+		}
+		if s := readString(d, "state"); s != "" {
+			m.State = strings.Split(s, ",")
+		}
+		a.Members = append(a.Members, m)
+	}
+	return a, nil
+}
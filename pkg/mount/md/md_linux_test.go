@@ -0,0 +1,93 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package md
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"unsafe"
+)
+
+func TestIoctlSizes(t *testing.T) {
+	if s := unsafe.Sizeof(arrayInfo{}); s != 72 {
+		t.Errorf("sizeof(mdu_array_info_t) = %d, want 72", s)
+	}
+	if s := unsafe.Sizeof(diskInfo{}); s != 20 {
+		t.Errorf("sizeof(mdu_disk_info_t) = %d, want 20", s)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	dir, err := ioutil.TempDir("", "md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	old := sysBlock
+	sysBlock = dir
+	defer func() { sysBlock = old }()
+
+	for path, s := range map[string]string{
+		"md0/size":                "2097024\n",
+		"md0/md/level":            "raid1\n",
+		"md0/md/metadata_version": "0.90\n",
+		"md0/md/array_state":      "clean\n",
+		"md0/md/raid_disks":       "2\n",
+		"md0/md/degraded":         "1\n",
+		"md0/md/chunk_size":       "0\n",
+		"md0/md/sync_action":      "recover\n",
+		"md0/md/sync_completed":   "1024 / 2097024\n",
+		"md0/md/dev-sda1/slot":    "0\n",
+		"md0/md/dev-sda1/state":   "in_sync\n",
+		"md0/md/dev-sdb1/slot":    "none\n",
+		"md0/md/dev-sdb1/state":   "spare,write_mostly\n",
+		"sda/size":                "1\n",
+		"md1/md/sync_completed":   "none\n",
+	} {
+		p := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	names, err := Arrays()
+	if err != nil || !reflect.DeepEqual(names, []string{"md0", "md1"}) {
+		t.Errorf("Arrays() = %v, %v, want [md0 md1], nil", names, err)
+	}
+
+	got, err := Status("/dev/md0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Array{
+		Name:       "md0",
+		Level:      "raid1",
+		Metadata:   "0.90",
+		State:      "clean",
+		RaidDisks:  2,
+		Degraded:   1,
+		Size:       2097024 * 512,
+		SyncAction: "recover",
+		SyncDone:   1024,
+		SyncTotal:  2097024,
+		Members: []Member{
+			{Name: "sda1", Slot: 0, State: []string{"in_sync"}},
+			{Name: "sdb1", Slot: -1, State: []string{"spare", "write_mostly"}},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Status(md0) = %+v, want %+v", got, want)
+	}
+
+	if _, err := Status("sda"); err == nil {
+		t.Errorf("Status(sda) = nil error, want error")
+	}
+}
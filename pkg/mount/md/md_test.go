@@ -0,0 +1,105 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package md
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want Level
+		err  bool
+	}{
+		{in: "0", want: RAID0},
+		{in: "raid1", want: RAID1},
+		{in: "mirror", want: RAID1},
+		{in: "RAID10", want: RAID10},
+		{in: "5", err: true},
+	} {
+		got, err := ParseLevel(tt.in)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v, error %t", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestComponentSize(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		sizes []int64
+		chunk int
+		want  int
+		err   bool
+	}{
+		// 1 GiB less the 64 KiB superblock area.
+		{name: "mirror", sizes: []int64{1 << 30, 2 << 30}, want: 1<<20 - 64},
+		// The last 64 KiB boundary is 64 KiB below the end, and whole
+		// 512 KiB chunks below that.
+		{name: "odd size", sizes: []int64{1<<30 + 12345}, chunk: 512 << 10, want: 1<<20 - 512},
+		{name: "too small", sizes: []int64{64 << 10}, err: true},
+		{name: "too big", sizes: []int64{4 << 40}, err: true},
+	} {
+		got, err := componentSize(tt.sizes, tt.chunk)
+		if (err != nil) != tt.err || got != tt.want {
+			t.Errorf("%s: componentSize(%v, %d) = %d, %v, want %d, error %t", tt.name, tt.sizes, tt.chunk, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestEvents(t *testing.T) {
+	healthy := &Array{
+		Name:       "md0",
+		SyncAction: "idle",
+		Members: []Member{
+			{Name: "sda1", Slot: 0, State: []string{"in_sync"}},
+			{Name: "sdb1", Slot: 1, State: []string{"in_sync"}},
+		},
+	}
+	failed := &Array{
+		Name:       "md0",
+		Degraded:   1,
+		SyncAction: "idle",
+		Members: []Member{
+			{Name: "sda1", Slot: 0, State: []string{"in_sync"}},
+			{Name: "sdb1", Slot: -1, State: []string{"faulty"}},
+		},
+	}
+	rebuilding := &Array{
+		Name:       "md0",
+		Degraded:   1,
+		SyncAction: "recover",
+		Members: []Member{
+			{Name: "sda1", Slot: 0, State: []string{"in_sync"}},
+			{Name: "sdc1", Slot: 1, State: []string{"spare"}},
+		},
+	}
+	rebuilt := &Array{
+		Name:       "md0",
+		SyncAction: "idle",
+		Members: []Member{
+			{Name: "sda1", Slot: 0, State: []string{"in_sync"}},
+			{Name: "sdc1", Slot: 1, State: []string{"in_sync"}},
+		},
+	}
+	for _, tt := range []struct {
+		name     string
+		old, new *Array
+		want     []Event
+	}{
+		{name: "no change", old: healthy, new: healthy},
+		{name: "new", new: failed, want: []Event{{Name: EventNewArray, Array: "md0"}, {Name: EventDegradedArray, Array: "md0"}}},
+		{name: "gone", old: healthy, want: []Event{{Name: EventDeviceDisappeared, Array: "md0"}}},
+		{name: "fail", old: healthy, new: failed, want: []Event{{Name: EventFail, Array: "md0", Member: "sdb1"}, {Name: EventDegradedArray, Array: "md0"}}},
+		{name: "rebuild", old: failed, new: rebuilding, want: []Event{{Name: EventRebuildStarted, Array: "md0"}}},
+		{name: "rebuilt", old: rebuilding, new: rebuilt, want: []Event{{Name: EventSpareActive, Array: "md0", Member: "sdc1"}, {Name: EventRebuildFinished, Array: "md0"}}},
+	} {
+		if got := Events(tt.old, tt.new); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: Events() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
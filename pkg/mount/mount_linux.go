@@ -24,6 +24,7 @@ const (
 	MS_RELATIME = unix.MS_RELATIME
 	MS_SYNC     = unix.MS_SYNC
 	MS_NOATIME  = unix.MS_NOATIME
+	MS_REMOUNT  = unix.MS_REMOUNT
 
 	ReadOnly = unix.MS_RDONLY | unix.MS_NOATIME
 )
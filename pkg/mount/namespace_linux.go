@@ -0,0 +1,212 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mount
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// Propagation is how mount and unmount events under a mount point are
+// shared with its peers in other mount namespaces; see
+// mount_namespaces(7).
+type Propagation uintptr
+
+// Propagation types.
+const (
+	// Private mounts neither send nor receive events.
+	Private Propagation = unix.MS_PRIVATE
+	// Shared mounts send events to and receive events from their peers.
+	Shared Propagation = unix.MS_SHARED
+	// Slave mounts receive events from their master, but send none.
+	Slave Propagation = unix.MS_SLAVE
+	// Unbindable mounts are private and cannot be bind mounted.
+	Unbindable Propagation = unix.MS_UNBINDABLE
+)
+
+func (p Propagation) String() string {
+	switch p {
+	case Private:
+		return "private"
+	case Shared:
+		return "shared"
+	case Slave:
+		return "slave"
+	case Unbindable:
+		return "unbindable"
+	}
+	return fmt.Sprintf("Propagation(%#x)", uintptr(p))
+}
+
+// SetPropagation sets the propagation of the mount at path to p, and of
+// every mount under it if recursive is true.
+func SetPropagation(path string, p Propagation, recursive bool) error {
+	flags := uintptr(p)
+	if recursive {
+		flags |= unix.MS_REC
+	}
+	if err := unix.Mount("", path, "", flags, ""); err != nil {
+		return &os.PathError{
+			Op:   "mount",
+			Path: path,
+			Err:  fmt.Errorf("making %v: %v", p, err),
+		}
+	}
+	return nil
+}
+
+// Namespace is a mount namespace.
+type Namespace struct {
+	f *os.File
+}
+
+// CurrentNamespace returns the mount namespace of the calling thread.
+//
+// Go schedules goroutines on any thread, so unless the thread is locked,
+// this is only meaningful if all threads share a namespace, as they do
+// unless Namespace.Do is running.
+func CurrentNamespace() (*Namespace, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/mnt", unix.Gettid()))
+	if err != nil {
+		return nil, err
+	}
+	return &Namespace{f: f}, nil
+}
+
+// lockedThread runs f on a thread of its own. The thread is never
+// unlocked, so it exits with f rather than go back to the scheduler with
+// whatever namespace f left it in.
+func lockedThread(f func() error) error {
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		errc <- f()
+	}()
+	return <-errc
+}
+
+// NewNamespace creates a mount namespace that starts with a copy of the
+// mounts of the current one, every one of them set to propagation p.
+//
+// With Private, mounts made in either namespace are not seen by the
+// other. With Slave, mounts made in the current namespace are seen by the
+// new one, but not the other way around, which is what installers
+// want for scratch mounts.
+//
+// Nothing runs in the new namespace; use Do to run code in it. It is gone
+// once it is closed and nothing runs in it.
+func NewNamespace(p Propagation) (*Namespace, error) {
+	var ns *Namespace
+	err := lockedThread(func() error {
+		if err := unix.Unshare(unix.CLONE_NEWNS); err != nil {
+			return fmt.Errorf("unshare mount namespace: %v", err)
+		}
+		if err := SetPropagation("/", p, true); err != nil {
+			return err
+		}
+		var err error
+		ns, err = CurrentNamespace()
+		return err
+	})
+	return ns, err
+}
+
+// Do runs f in ns, on a thread that is discarded after f returns. f must
+// not start goroutines it expects to run in ns.
+func (ns *Namespace) Do(f func() error) error {
+	return lockedThread(func() error {
+		// A thread that shares its root and working directory with
+		// others cannot change mount namespaces.
+		if err := unix.Unshare(unix.CLONE_FS); err != nil {
+			return fmt.Errorf("unshare file system attributes: %v", err)
+		}
+		if err := unix.Setns(int(ns.f.Fd()), unix.CLONE_NEWNS); err != nil {
+			return fmt.Errorf("setns %s: %v", ns.f.Name(), err)
+		}
+		return f()
+	})
+}
+
+// Close releases ns.
+func (ns *Namespace) Close() error {
+	return ns.f.Close()
+}
+
+// Flags of open_tree and move_mount, from linux/mount.h. x/sys/unix does
+// not have them yet.
+const (
+	openTreeClone       = 1
+	atRecursive         = 0x8000
+	moveMountFEmptyPath = 0x4
+)
+
+// openTree returns a detached copy of the mounts at and under path.
+func openTree(path string) (int, error) {
+	p, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return -1, err
+	}
+	cwd := unix.AT_FDCWD
+	fd, _, errno := unix.Syscall(unix.SYS_OPEN_TREE, uintptr(cwd), uintptr(unsafe.Pointer(p)), openTreeClone|unix.O_CLOEXEC|atRecursive)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// moveMountFD attaches the detached mount tree fd at path.
+func moveMountFD(fd int, path string) error {
+	empty, err := unix.BytePtrFromString("")
+	if err != nil {
+		return err
+	}
+	p, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	cwd := unix.AT_FDCWD
+	_, _, errno := unix.Syscall6(unix.SYS_MOVE_MOUNT, uintptr(fd), uintptr(unsafe.Pointer(empty)),
+		uintptr(cwd), uintptr(unsafe.Pointer(p)), moveMountFEmptyPath, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// MoveTo moves the mount at path in ns, and every mount under it, to
+// target in namespace to. Use MoveMount to move mounts within a namespace.
+//
+// It needs Linux 5.2 or later for open_tree and move_mount.
+func (ns *Namespace) MoveTo(path string, to *Namespace, target string) error {
+	var fd int
+	if err := ns.Do(func() error {
+		var err error
+		fd, err = openTree(path)
+		if err != nil {
+			return &os.PathError{Op: "open_tree", Path: path, Err: err}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+
+	if err := to.Do(func() error {
+		if err := moveMountFD(fd, target); err != nil {
+			return &os.PathError{Op: "move_mount", Path: target, Err: err}
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	// The tree is attached in to; what is left at path is a copy.
+	return ns.Do(func() error {
+		return unix.Unmount(path, unix.MNT_DETACH)
+	})
+}
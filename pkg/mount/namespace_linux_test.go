@@ -0,0 +1,87 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mount_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/mount"
+	"github.com/u-root/u-root/pkg/testutil"
+	"golang.org/x/sys/unix"
+)
+
+func TestPropagationString(t *testing.T) {
+	for p, want := range map[mount.Propagation]string{
+		mount.Private:    "private",
+		mount.Shared:     "shared",
+		mount.Slave:      "slave",
+		mount.Unbindable: "unbindable",
+		0x10:             "Propagation(0x10)",
+	} {
+		if got := p.String(); got != want {
+			t.Errorf("Propagation(%#x).String() = %q, want %q", uintptr(p), got, want)
+		}
+	}
+}
+
+func TestNamespace(t *testing.T) {
+	testutil.SkipIfNotRoot(t)
+
+	tmp, err := ioutil.TempDir("", "mountns")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	scratch := filepath.Join(tmp, "scratch")
+	target := filepath.Join(tmp, "target")
+	for _, d := range []string{scratch, target} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cur, err := mount.CurrentNamespace()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cur.Close()
+	ns, err := mount.NewNamespace(mount.Private)
+	if err != nil {
+		t.Skipf("Cannot create mount namespaces: %v", err)
+	}
+	defer ns.Close()
+
+	if err := ns.Do(func() error {
+		if err := unix.Mount("tmpfs", scratch, "tmpfs", 0, ""); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(scratch, "file"), []byte("hello"), 0644)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(scratch, "file")); !os.IsNotExist(err) {
+		t.Errorf("Scratch mount of a private namespace is seen outside it: %v", err)
+	}
+
+	if err := ns.MoveTo(scratch, cur, target); err != nil {
+		if err == unix.ENOSYS || os.IsNotExist(err) {
+			t.Skipf("No open_tree and move_mount: %v", err)
+		}
+		t.Fatal(err)
+	}
+	defer unix.Unmount(target, unix.MNT_DETACH)
+	if b, err := ioutil.ReadFile(filepath.Join(target, "file")); err != nil || string(b) != "hello" {
+		t.Errorf("File of moved mount = %q, %v, want hello", b, err)
+	}
+	if err := ns.Do(func() error {
+		_, err := os.Stat(filepath.Join(scratch, "file"))
+		return err
+	}); !os.IsNotExist(err) {
+		t.Errorf("Moved mount is still at %s: %v", scratch, err)
+	}
+}
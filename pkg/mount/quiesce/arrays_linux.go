@@ -0,0 +1,131 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quiesce
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+var sysBlock = "/sys/block"
+
+// holders returns the devices stacked on top of dev.
+func holders(dev string) []string {
+	fis, _ := ioutil.ReadDir(filepath.Join(sysBlock, dev, "holders"))
+	var h []string
+	for _, fi := range fis {
+		h = append(h, fi.Name())
+	}
+	return h
+}
+
+// stopArrays stops md arrays and removes dm devices, top of the stack
+// first, until no more can be.
+func stopArrays(logf func(string, ...interface{})) []error {
+	failed := make(map[string]error)
+	for progress := true; progress; {
+		progress = false
+		fis, err := ioutil.ReadDir(sysBlock)
+		if err != nil {
+			return []error{err}
+		}
+		for _, fi := range fis {
+			dev := fi.Name()
+			if !strings.HasPrefix(dev, "md") && !strings.HasPrefix(dev, "dm-") {
+				continue
+			}
+			if _, ok := failed[dev]; ok || len(holders(dev)) > 0 {
+				continue
+			}
+			if strings.HasPrefix(dev, "md") {
+				err = stopMD(dev)
+			} else {
+				err = removeDM(dev)
+			}
+			if err != nil {
+				failed[dev] = err
+				continue
+			}
+			logf("quiesce: stopped %s", dev)
+			progress = true
+		}
+	}
+	var errs []error
+	for dev, err := range failed {
+		errs = append(errs, fmt.Errorf("cannot stop %s: %v", dev, err))
+	}
+	return errs
+}
+
+// _STOP_ARRAY is _IO(MD_MAJOR, 0x32), include/uapi/linux/raid/md_u.h.
+const _STOP_ARRAY = 0x932
+
+func stopMD(dev string) error {
+	// An array that is not running has nothing to stop, and its device
+	// node may not take opens.
+	if b, err := ioutil.ReadFile(filepath.Join(sysBlock, dev, "md/array_state")); err == nil {
+		if s := strings.TrimSpace(string(b)); s == "clear" || s == "inactive" {
+			return nil
+		}
+	}
+	f, err := os.OpenFile(filepath.Join("/dev", dev), os.O_RDONLY|unix.O_EXCL, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), _STOP_ARRAY, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// dmIoctl is struct dm_ioctl, include/uapi/linux/dm-ioctl.h.
+type dmIoctl struct {
+	Version     [3]uint32
+	DataSize    uint32
+	DataStart   uint32
+	TargetCount uint32
+	OpenCount   int32
+	Flags       uint32
+	EventNr     uint32
+	_           uint32
+	Dev         uint64
+	Name        [128]byte
+	UUID        [129]byte
+	Data        [7]byte
+}
+
+// _DM_DEV_REMOVE is _IOWR(DM_IOCTL, DM_DEV_REMOVE_CMD, struct dm_ioctl).
+const _DM_DEV_REMOVE = 0xc138fd02
+
+func removeDM(dev string) error {
+	name, err := ioutil.ReadFile(filepath.Join(sysBlock, dev, "dm/name"))
+	if err != nil {
+		return err
+	}
+	ctl, err := os.OpenFile("/dev/mapper/control", os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer ctl.Close()
+
+	d := dmIoctl{
+		// The oldest interface version with DM_DEV_REMOVE as it is.
+		Version:   [3]uint32{4, 0, 0},
+		DataSize:  uint32(unsafe.Sizeof(dmIoctl{})),
+		DataStart: uint32(unsafe.Sizeof(dmIoctl{})),
+	}
+	copy(d.Name[:len(d.Name)-1], strings.TrimSpace(string(name)))
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, ctl.Fd(), _DM_DEV_REMOVE, uintptr(unsafe.Pointer(&d))); errno != 0 {
+		return errno
+	}
+	return nil
+}
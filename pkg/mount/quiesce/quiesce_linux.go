@@ -0,0 +1,162 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package quiesce brings storage to a consistent state before kexec.
+//
+// kexec does not unmount anything. A kernel booted with file systems still
+// mounted read-write finds them dirty, and data still in the page cache is
+// lost. Quiesce syncs, unmounts what it can and remounts the rest
+// read-only, and can stop RAID arrays and spin disks down.
+package quiesce
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/mount"
+	"golang.org/x/sys/unix"
+)
+
+// Options say how far to quiesce.
+type Options struct {
+	// StopArrays stops md arrays and removes device-mapper devices once
+	// nothing is mounted on them.
+	StopArrays bool
+
+	// Standby puts SATA and SCSI disks in standby and NVMe controllers in
+	// their lowest power state.
+	Standby bool
+
+	// Logf, if set, logs each step.
+	Logf func(string, ...interface{})
+}
+
+// Error lists everything that could not be quiesced.
+type Error []error
+
+func (e Error) Error() string {
+	s := make([]string, len(e))
+	for i, err := range e {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "; ")
+}
+
+// These are never unmounted: they have nothing to lose, and later steps
+// need /proc, /sys and /dev.
+var virtualFS = map[string]bool{
+	"autofs":      true,
+	"binfmt_misc": true,
+	"bpf":         true,
+	"cgroup":      true,
+	"cgroup2":     true,
+	"configfs":    true,
+	"debugfs":     true,
+	"devpts":      true,
+	"devtmpfs":    true,
+	"efivarfs":    true,
+	"fusectl":     true,
+	"hugetlbfs":   true,
+	"mqueue":      true,
+	"proc":        true,
+	"pstore":      true,
+	"ramfs":       true,
+	"rootfs":      true,
+	"securityfs":  true,
+	"selinuxfs":   true,
+	"sysfs":       true,
+	"tmpfs":       true,
+	"tracefs":     true,
+}
+
+// mountsFile lists the mounts in the caller's namespace.
+const mountsFile = "/proc/self/mounts"
+
+type mountEntry struct {
+	Source, Path, FSType string
+	ReadOnly             bool
+}
+
+func parseMounts(r io.Reader) ([]mountEntry, error) {
+	var mounts []mountEntry
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		f := strings.Fields(s.Text())
+		if len(f) < 4 {
+			continue
+		}
+		m := mountEntry{Source: mount.Unescape(f[0]), Path: mount.Unescape(f[1]), FSType: f[2]}
+		for _, o := range strings.Split(f[3], ",") {
+			if o == "ro" {
+				m.ReadOnly = true
+			}
+		}
+		mounts = append(mounts, m)
+	}
+	return mounts, s.Err()
+}
+
+func readMounts() ([]mountEntry, error) {
+	f, err := os.Open(mountsFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseMounts(f)
+}
+
+// Quiesce syncs and unmounts all file systems, remounting read-only those
+// that are busy, then stops arrays and spins disks down as o says. It
+// carries on past failures and returns them all as an Error.
+func Quiesce(o Options) error {
+	logf := o.Logf
+	if logf == nil {
+		logf = func(string, ...interface{}) {}
+	}
+	var errs Error
+
+	logf("quiesce: syncing")
+	unix.Sync()
+
+	mounts, err := readMounts()
+	if err != nil {
+		errs = append(errs, err)
+	}
+	// Later mounts may be on top of earlier ones, so go backwards.
+	for i := len(mounts) - 1; i >= 0; i-- {
+		m := mounts[i]
+		if virtualFS[m.FSType] {
+			continue
+		}
+		if m.Path != "/" {
+			if err := unix.Unmount(m.Path, 0); err == nil {
+				logf("quiesce: unmounted %s", m.Path)
+				continue
+			}
+		}
+		if m.ReadOnly {
+			continue
+		}
+		if err := unix.Mount("", m.Path, "", unix.MS_REMOUNT|unix.MS_RDONLY, ""); err != nil {
+			errs = append(errs, fmt.Errorf("cannot unmount or remount %s read-only: %v", m.Path, err))
+			continue
+		}
+		logf("quiesce: remounted %s read-only", m.Path)
+	}
+	unix.Sync()
+
+	if o.StopArrays {
+		errs = append(errs, stopArrays(logf)...)
+	}
+	if o.Standby {
+		errs = append(errs, standby(logf)...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quiesce
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+func TestParseMounts(t *testing.T) {
+	const mounts = `rootfs / rootfs rw 0 0
+proc /proc proc rw,nosuid,nodev,noexec,relatime 0 0
+/dev/sda1 /mnt/my\040disk ext4 rw,relatime 0 0
+/dev/sr0 /media/cd iso9660 ro,relatime 0 0
+/dev/sda2 /mnt/back\134slash vfat rw 0 0
+`
+	got, err := parseMounts(strings.NewReader(mounts))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []mountEntry{
+		{Source: "rootfs", Path: "/", FSType: "rootfs"},
+		{Source: "proc", Path: "/proc", FSType: "proc"},
+		{Source: "/dev/sda1", Path: "/mnt/my disk", FSType: "ext4"},
+		{Source: "/dev/sr0", Path: "/media/cd", FSType: "iso9660", ReadOnly: true},
+		{Source: "/dev/sda2", Path: `/mnt/back\slash`, FSType: "vfat"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseMounts() = %+v, want %+v", got, want)
+	}
+}
+
+func TestLowestPowerState(t *testing.T) {
+	id := make([]byte, identifySize)
+	id[idNPSS] = 4
+	for _, ps := range []int{3, 4} {
+		id[idPowerStates+ps*powerStateSize+psFlagsByteOffset] = psNonOperational
+	}
+	if ps, ok := lowestPowerState(id); !ok || ps != 4 {
+		t.Errorf("lowestPowerState() = %d, %t, want 4, true", ps, ok)
+	}
+
+	id = make([]byte, identifySize)
+	if _, ok := lowestPowerState(id); ok {
+		t.Errorf("lowestPowerState(all operational) = _, true, want false")
+	}
+}
+
+func TestIoctlSizes(t *testing.T) {
+	if s := unsafe.Sizeof(dmIoctl{}); s != 312 {
+		t.Errorf("sizeof(dm_ioctl) = %d, want 312", s)
+	}
+	if s := unsafe.Sizeof(nvmeAdminCmd{}); s != 72 {
+		t.Errorf("sizeof(nvme_admin_cmd) = %d, want 72", s)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quiesce
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"unsafe"
+
+	"github.com/u-root/u-root/pkg/mount/scuzz"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	sdDisk   = regexp.MustCompile(`^sd[a-z]+$`)
+	nvmeDisk = regexp.MustCompile(`^(nvme[0-9]+)n[0-9]+$`)
+)
+
+// standby spins down SCSI and SATA disks and puts NVMe controllers in their
+// lowest power state.
+func standby(logf func(string, ...interface{})) []error {
+	fis, err := ioutil.ReadDir(sysBlock)
+	if err != nil {
+		return []error{err}
+	}
+	var errs []error
+	ctrls := make(map[string]bool)
+	for _, fi := range fis {
+		dev := fi.Name()
+		if sdDisk.MatchString(dev) {
+			if err := standbySD(dev); err != nil {
+				errs = append(errs, fmt.Errorf("cannot put %s in standby: %v", dev, err))
+				continue
+			}
+			logf("quiesce: %s in standby", dev)
+		}
+		// Namespaces share their controller's power state.
+		if m := nvmeDisk.FindStringSubmatch(dev); m != nil && !ctrls[m[1]] {
+			ctrls[m[1]] = true
+			ps, err := standbyNVMe(m[1])
+			if err != nil {
+				errs = append(errs, fmt.Errorf("cannot put %s in standby: %v", m[1], err))
+				continue
+			}
+			logf("quiesce: %s in power state %d", m[1], ps)
+		}
+	}
+	return errs
+}
+
+func standbySD(dev string) error {
+	d, err := scuzz.NewSGDisk(filepath.Join("/dev", dev))
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Standby()
+}
+
+// nvmeAdminCmd is struct nvme_admin_cmd, include/uapi/linux/nvme_ioctl.h.
+type nvmeAdminCmd struct {
+	Opcode      uint8
+	Flags       uint8
+	_           uint16
+	NSID        uint32
+	CDW2        uint32
+	CDW3        uint32
+	Metadata    uint64
+	Addr        uint64
+	MetadataLen uint32
+	DataLen     uint32
+	CDW10       uint32
+	CDW11       uint32
+	CDW12       uint32
+	CDW13       uint32
+	CDW14       uint32
+	CDW15       uint32
+	TimeoutMS   uint32
+	Result      uint32
+}
+
+// _NVME_IOCTL_ADMIN_CMD is _IOWR('N', 0x41, struct nvme_admin_cmd).
+const _NVME_IOCTL_ADMIN_CMD = 0xc0484e41
+
+// NVMe admin commands and their fields, NVM Express 1.4 section 5.
+const (
+	nvmeIdentify      = 0x06
+	nvmeSetFeatures   = 0x09
+	cnsController     = 0x01
+	featurePowerMgmt  = 0x02
+	identifySize      = 4096
+	idNPSS            = 263
+	maxPowerStates    = 32
+	idPowerStates     = 2048
+	powerStateSize    = 32
+	psNonOperational  = 1 << 1
+	psFlagsByteOffset = 3
+)
+
+func nvmeAdmin(f *os.File, c *nvmeAdminCmd) error {
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), _NVME_IOCTL_ADMIN_CMD, uintptr(unsafe.Pointer(c))); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// lowestPowerState returns the lowest power non-operational state described
+// in an Identify Controller data structure. States are numbered from
+// highest to lowest power.
+func lowestPowerState(id []byte) (uint32, bool) {
+	// NPSS is zero based.
+	n := int(id[idNPSS])
+	if n >= maxPowerStates {
+		n = maxPowerStates - 1
+	}
+	for ps := n; ps >= 0; ps-- {
+		if id[idPowerStates+ps*powerStateSize+psFlagsByteOffset]&psNonOperational != 0 {
+			return uint32(ps), true
+		}
+	}
+	return 0, false
+}
+
+func standbyNVMe(ctrl string) (uint32, error) {
+	f, err := os.OpenFile(filepath.Join("/dev", ctrl), os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	id := make([]byte, identifySize)
+	if err := nvmeAdmin(f, &nvmeAdminCmd{
+		Opcode:  nvmeIdentify,
+		Addr:    uint64(uintptr(unsafe.Pointer(&id[0]))),
+		DataLen: identifySize,
+		CDW10:   cnsController,
+	}); err != nil {
+		return 0, fmt.Errorf("identify: %v", err)
+	}
+	ps, ok := lowestPowerState(id)
+	if !ok {
+		return 0, fmt.Errorf("no non-operational power state")
+	}
+	if err := nvmeAdmin(f, &nvmeAdminCmd{
+		Opcode: nvmeSetFeatures,
+		CDW10:  featurePowerMgmt,
+		CDW11:  ps,
+	}); err != nil {
+		return 0, fmt.Errorf("set power state %d: %v", ps, err)
+	}
+	return ps, nil
+}
@@ -0,0 +1,205 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package scratch sets up sized scratch space for downloads and temporary
+// extraction.
+//
+// Left to themselves, downloads and extracted images go to the initramfs,
+// whose tmpfs has no limit but memory: when it fills up, everything else
+// fails in odd ways. A scratch space is a tmpfs of its own with a size
+// limit, so running out of it is an ENOSPC for the one writer. The spaces
+// are torn down before kexec.
+package scratch
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/u-root/u-root/pkg/mount"
+	"github.com/u-root/u-root/pkg/swap"
+	"golang.org/x/sys/unix"
+)
+
+// Options say how to back a scratch space.
+type Options struct {
+	// Zram gives the space a zram swap device of its size, so what it
+	// holds can be compressed in memory rather than take all of it.
+	Zram bool
+
+	// Algorithm is the zram compression algorithm, or the kernel's
+	// default if "".
+	Algorithm string
+}
+
+// Space is a scratch space.
+type Space struct {
+	// Dir is where the space is mounted.
+	Dir string
+
+	// Size is its size in bytes.
+	Size int64
+
+	mp      *mount.MountPoint
+	zram    swapArea
+	madeDir bool
+}
+
+// swapArea is the part of *swap.Zram a Space needs.
+type swapArea interface {
+	Off() error
+}
+
+var (
+	mu     sync.Mutex
+	spaces []*Space
+
+	meminfo = "/proc/meminfo"
+
+	// mountTmpfs mounts a tmpfs of mount options data at dir.
+	mountTmpfs = func(dir, data string) (*mount.MountPoint, error) {
+		return mount.Mount("scratch", dir, "tmpfs", data, mount.MS_NOSUID|unix.MS_NODEV)
+	}
+	unmount = func(mp *mount.MountPoint) error {
+		// Open files must not keep the space from going away.
+		return mp.Unmount(mount.MNT_DETACH)
+	}
+	// zramOn sets up size bytes of zram swap for a tmpfs to spill into.
+	zramOn = func(size int64, algorithm string) (swapArea, error) {
+		return swap.OnZram(size, algorithm, swap.Options{Priority: swap.ZramPriority, Discard: true})
+	}
+)
+
+// New sets up a scratch space of size bytes at dir, which it makes if need
+// be. Without zram, the space must fit in the memory available.
+func New(dir string, size int64, o Options) (*Space, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("scratch space size %d is not positive", size)
+	}
+	if !o.Zram {
+		avail, err := memAvailable()
+		if err != nil {
+			return nil, err
+		}
+		if size > avail {
+			return nil, fmt.Errorf("scratch space of %d bytes is more than the %d bytes of memory available", size, avail)
+		}
+	}
+
+	s := &Space{Dir: dir, Size: size}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		s.madeDir = true
+	}
+	if o.Zram {
+		z, err := zramOn(size, o.Algorithm)
+		if err != nil {
+			return nil, fmt.Errorf("scratch space at %s: %v", dir, err)
+		}
+		s.zram = z
+	}
+	mp, err := mountTmpfs(dir, fmt.Sprintf("size=%d,mode=0755", size))
+	if err != nil {
+		s.release()
+		return nil, err
+	}
+	s.mp = mp
+
+	mu.Lock()
+	spaces = append(spaces, s)
+	mu.Unlock()
+	return s, nil
+}
+
+// TempDir makes a new directory in the space, as ioutil.TempDir does.
+func (s *Space) TempDir(pattern string) (string, error) {
+	return ioutil.TempDir(s.Dir, pattern)
+}
+
+// Avail returns how many bytes are left in the space.
+func (s *Space) Avail() (int64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(s.Dir, &st); err != nil {
+		return 0, &os.PathError{Op: "statfs", Path: s.Dir, Err: err}
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
+
+// Release unmounts the space, which discards what it holds, and frees its
+// zram. Releasing a space twice does nothing.
+func (s *Space) Release() error {
+	mu.Lock()
+	defer mu.Unlock()
+	for i, sp := range spaces {
+		if sp == s {
+			spaces = append(spaces[:i], spaces[i+1:]...)
+			return s.release()
+		}
+	}
+	return nil
+}
+
+func (s *Space) release() error {
+	var err error
+	if s.mp != nil {
+		err = unmount(s.mp)
+		s.mp = nil
+	}
+	if s.madeDir && err == nil {
+		os.Remove(s.Dir)
+	}
+	if s.zram != nil {
+		// The tmpfs is gone, so nothing is swapped out to it.
+		if zerr := s.zram.Off(); err == nil {
+			err = zerr
+		}
+		s.zram = nil
+	}
+	return err
+}
+
+// ReleaseAll releases all spaces, newest first. It is called before kexec.
+func ReleaseAll() error {
+	mu.Lock()
+	defer mu.Unlock()
+	var errs []string
+	for i := len(spaces) - 1; i >= 0; i-- {
+		if err := spaces[i].release(); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", spaces[i].Dir, err))
+		}
+	}
+	spaces = nil
+	if len(errs) > 0 {
+		return fmt.Errorf("releasing scratch spaces: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// memAvailable returns MemAvailable of /proc/meminfo, in bytes.
+func memAvailable() (int64, error) {
+	f, err := os.Open(meminfo)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		// MemAvailable:    1234 kB
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 3 && fields[0] == "MemAvailable:" {
+			n, err := strconv.ParseInt(fields[1], 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("bad %s line %q", meminfo, sc.Text())
+			}
+			return n << 10, nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return 0, err
+	}
+	return 0, fmt.Errorf("no MemAvailable in %s", meminfo)
+}
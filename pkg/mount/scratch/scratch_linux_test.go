@@ -0,0 +1,144 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scratch
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/mount"
+)
+
+type fakeZram struct {
+	log *[]string
+}
+
+func (z fakeZram) Off() error {
+	*z.log = append(*z.log, "zram off")
+	return nil
+}
+
+// fake replaces mounts and zram with fakes that log what they do, and
+// meminfo with one of avail kB. It returns a cleanup func.
+func fake(t *testing.T, avail string) (*[]string, func()) {
+	dir, err := ioutil.TempDir("", "scratch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldMeminfo, oldMount, oldUnmount, oldZram := meminfo, mountTmpfs, unmount, zramOn
+	meminfo = filepath.Join(dir, "meminfo")
+	ioutil.WriteFile(meminfo, []byte("MemTotal:        8000 kB\nMemAvailable:    "+avail+" kB\n"), 0644)
+
+	log := &[]string{}
+	mountTmpfs = func(dir, data string) (*mount.MountPoint, error) {
+		*log = append(*log, "mount "+filepath.Base(dir)+" "+data)
+		return &mount.MountPoint{Path: dir, Data: data}, os.MkdirAll(dir, 0755)
+	}
+	unmount = func(mp *mount.MountPoint) error {
+		*log = append(*log, "unmount "+filepath.Base(mp.Path))
+		return nil
+	}
+	zramOn = func(size int64, algorithm string) (swapArea, error) {
+		*log = append(*log, "zram on "+algorithm)
+		return fakeZram{log}, nil
+	}
+	return log, func() {
+		meminfo, mountTmpfs, unmount, zramOn = oldMeminfo, oldMount, oldUnmount, oldZram
+		spaces = nil
+		os.RemoveAll(dir)
+	}
+}
+
+func TestNew(t *testing.T) {
+	log, cleanup := fake(t, "4096")
+	defer cleanup()
+	dir := filepath.Join(filepath.Dir(meminfo), "dl")
+
+	s, err := New(dir, 1<<20, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := s.TempDir("kernel")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(d) != dir {
+		t.Errorf("TempDir = %s, want a directory in %s", d, dir)
+	}
+	// The fake unmount does not take it away.
+	os.Remove(d)
+
+	// More than the 4 MiB available.
+	if _, err := New(dir+"2", 8<<20, Options{}); err == nil {
+		t.Errorf("New of more than the memory available = nil, want error")
+	}
+
+	if err := s.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Release(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Release left the directory it made: %v", err)
+	}
+	want := []string{"mount dl size=1048576,mode=0755", "unmount dl"}
+	if !reflect.DeepEqual(*log, want) {
+		t.Errorf("New and Release did %q, want %q", *log, want)
+	}
+}
+
+func TestReleaseAll(t *testing.T) {
+	log, cleanup := fake(t, "4096")
+	defer cleanup()
+	tmp := filepath.Dir(meminfo)
+
+	if _, err := New(filepath.Join(tmp, "a"), 1<<20, Options{}); err != nil {
+		t.Fatal(err)
+	}
+	// zram spaces may be bigger than the memory available.
+	if _, err := New(filepath.Join(tmp, "b"), 16<<20, Options{Zram: true, Algorithm: "zstd"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReleaseAll(); err != nil {
+		t.Fatal(err)
+	}
+	if len(spaces) != 0 {
+		t.Errorf("ReleaseAll left %d spaces", len(spaces))
+	}
+	want := []string{
+		"mount a size=1048576,mode=0755",
+		"zram on zstd",
+		"mount b size=16777216,mode=0755",
+		"unmount b",
+		"zram off",
+		"unmount a",
+	}
+	if !reflect.DeepEqual(*log, want) {
+		t.Errorf("New and ReleaseAll did %q, want %q", *log, want)
+	}
+}
+
+func TestNewMountFails(t *testing.T) {
+	log, cleanup := fake(t, "4096")
+	defer cleanup()
+	mountTmpfs = func(dir, data string) (*mount.MountPoint, error) {
+		return nil, errors.New("no tmpfs")
+	}
+
+	if _, err := New(filepath.Join(filepath.Dir(meminfo), "a"), 1<<20, Options{Zram: true}); err == nil {
+		t.Fatalf("New = nil, want error")
+	}
+	if want := []string{"zram on ", "zram off"}; !reflect.DeepEqual(*log, want) {
+		t.Errorf("New did %q, want %q", *log, want)
+	}
+	if len(spaces) != 0 {
+		t.Errorf("New kept a space it could not mount")
+	}
+}
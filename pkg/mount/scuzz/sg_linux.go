@@ -260,6 +260,23 @@ func (s *SGDisk) Identify() (*Info, error) {
 	return unpackIdentify(p.status, p.block, p.word), nil
 }
 
+func (s *SGDisk) standbyPacket() *packet {
+	p := s.newPacket(unix.WIN_STANDBYNOW1, _SG_DXFER_NONE, 0)
+	p.dataLen = 0
+	p.nsect = 0
+	p.genCommandDataBlock()
+	// With CK_COND, success also comes back as sense data, which
+	// operate takes for an error.
+	p.command[2] = 0
+	return p
+}
+
+// Standby spins the disk down immediately. It spins up again on the next
+// access.
+func (s *SGDisk) Standby() error {
+	return s.operate(s.standbyPacket())
+}
+
 // _SG_IO is the ioctl request number for SCSI operations.
 const _SG_IO = 0x2285
 
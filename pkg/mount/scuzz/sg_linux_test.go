@@ -184,3 +184,15 @@ func TestIdentify(t *testing.T) {
 	p := (&SGDisk{dev: 0x40, Timeout: DefaultTimeout}).identifyPacket()
 	check(t, p, want)
 }
+
+func TestStandby(t *testing.T) {
+	d := &SGDisk{dev: 0x40, Timeout: DefaultTimeout}
+	p := d.standbyPacket()
+	if p.direction != _SG_DXFER_NONE || p.dataLen != 0 {
+		t.Errorf("standby direction %d, dataLen %d; want %d, 0", p.direction, p.dataLen, _SG_DXFER_NONE)
+	}
+	want := commandDataBlock{0x85, 0x6, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 00, 0x40, 0xe0, 00}
+	if p.command != want {
+		t.Errorf("standby command %#02x, want %#02x", p.command, want)
+	}
+}
@@ -9,6 +9,8 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"golang.org/x/sys/unix"
 )
@@ -41,13 +43,16 @@ func recursiveDelete(fd int) error {
 		return err
 	}
 
+	// Delete as much as possible: every file left behind keeps using
+	// memory.
+	var firstErr error
 	for _, name := range names {
 		// Loop here, but handle loop in separate function to make defer work as expected.
-		if err := recusiveDeleteInner(fd, parentDev, name); err != nil {
-			return err
+		if err := recusiveDeleteInner(fd, parentDev, name); err != nil && firstErr == nil {
+			firstErr = err
 		}
 	}
-	return nil
+	return firstErr
 }
 
 // recusiveDeleteInner is called from recursiveDelete and either deletes
@@ -96,14 +101,13 @@ func MoveMount(oldPath string, newPath string) error {
 
 // addSpecialMounts moves the 'special' mounts to the given target path
 //
-// 'special' in this context refers to the following non-blockdevice backed
-// mounts that are almost always used: /dev, /proc, /sys, and /run.
+// 'special' in this context refers to non-blockdevice backed mounts that are
+// almost always used, such as /dev, /proc, /sys, and /run. A mount that
+// cannot be moved is detached instead.
 // This function will create the target directories, if necessary.
 // If the target directories already exist, they must be empty.
 // This function skips missing mounts.
-func addSpecialMounts(newRoot string) error {
-	var mounts = []string{"/dev", "/proc", "/sys", "/run"}
-
+func addSpecialMounts(newRoot string, mounts []string) error {
 	for _, mount := range mounts {
 		path := filepath.Join(newRoot, mount)
 		// Skip all mounting if the directory does not exist.
@@ -125,7 +129,12 @@ func addSpecialMounts(newRoot string) error {
 			return err
 		}
 		if err := MoveMount(mount, path); err != nil {
-			return err
+			// Leave nothing behind that would keep the old root
+			// busy.
+			log.Printf("switch_root: Moving %q failed, detaching it: %v", mount, err)
+			if err := unix.Unmount(mount, unix.MNT_DETACH); err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -145,6 +154,31 @@ func SameFilesystem(path1, path2 string) (bool, error) {
 	return stat1.Dev == stat2.Dev, nil
 }
 
+// SwitchRootOptions say how to switch to a new root.
+type SwitchRootOptions struct {
+	// NewRoot is the new root directory. It must be a mount point, e.g.
+	// a tmpfs a downloaded root file system was unpacked into.
+	NewRoot string
+
+	// Init is the path of init in NewRoot, /sbin/init if empty.
+	Init string
+
+	// Args are passed to Init after its name.
+	Args []string
+
+	// Env is Init's environment. If nil, Init gets the environment the
+	// kernel gives init: HOME=/ and TERM=linux.
+	Env []string
+
+	// Mounts are moved into NewRoot. If nil, /dev, /proc, /sys and /run
+	// are moved.
+	Mounts []string
+
+	// KeepFDs are kept open for Init, in addition to stdin, stdout and
+	// stderr. All other file descriptors are closed.
+	KeepFDs []int
+}
+
 // SwitchRoot makes newRootDir the new root directory of the system.
 //
 // To be exact, it makes newRootDir the new root directory of the calling
@@ -154,53 +188,210 @@ func SameFilesystem(path1, path2 string) (bool, error) {
 // does a chroot, moves the root mount to the new directory and finally
 // DELETES EVERYTHING in the old root and execs the given init.
 func SwitchRoot(newRootDir string, init string) error {
-	err := newRoot(newRootDir)
+	return SwitchRootWithOptions(SwitchRootOptions{
+		NewRoot: newRootDir,
+		Init:    init,
+		Env:     []string{},
+	})
+}
+
+// SwitchRootWithOptions is SwitchRoot with more control over what init
+// finds.
+//
+// Everything that can be checked is checked before anything is changed: it
+// fails without harm if NewRoot is not a mount point or has no Init. The
+// old root is only deleted if it is a ramfs or tmpfs, i.e. an initramfs
+// whose files would otherwise keep using memory.
+//
+// Once the root has been switched, failing to delete the old root does not
+// stop Init from being executed. SwitchRootWithOptions only returns if
+// that fails.
+func SwitchRootWithOptions(o SwitchRootOptions) error {
+	if o.Init == "" {
+		o.Init = "/sbin/init"
+	}
+	if o.Env == nil {
+		o.Env = []string{"HOME=/", "TERM=linux"}
+	}
+	if o.Mounts == nil {
+		o.Mounts = []string{"/dev", "/proc", "/sys", "/run"}
+	}
+
+	if same, err := SameFilesystem("/", o.NewRoot); err != nil {
+		return fmt.Errorf("switch_root: %v", err)
+	} else if same {
+		return fmt.Errorf("switch_root: %q is not a mount point", o.NewRoot)
+	}
+	if err := checkInit(o.NewRoot, o.Init); err != nil {
+		return fmt.Errorf("switch_root: %v", err)
+	}
+	var fs unix.Statfs_t
+	if err := unix.Statfs("/", &fs); err != nil {
+		return fmt.Errorf("switch_root: %v", err)
+	}
+	deleteOld := fs.Type == unix.RAMFS_MAGIC || fs.Type == unix.TMPFS_MAGIC
+
+	oldRoot, err := newRoot(o.NewRoot, o.Mounts)
 	if err != nil {
 		return err
 	}
-	return execInit(init)
+	if deleteOld {
+		log.Printf("switch_root: Deleting old /")
+		// recursiveDelete closes the descriptor it is given.
+		if fd, err := unix.Dup(int(oldRoot.Fd())); err != nil {
+			log.Printf("switch_root: Deleting old / failed: %v", err)
+		} else if err := recursiveDelete(fd); err != nil {
+			log.Printf("switch_root: Deleting old / failed: %v", err)
+		}
+	} else {
+		log.Printf("switch_root: Not deleting old /, it is not an initramfs")
+	}
+	oldRoot.Close()
+
+	if err := closeOnExec(o.KeepFDs); err != nil {
+		log.Printf("switch_root: Closing file descriptors failed: %v", err)
+	}
+	return execInit(o.Init, o.Args, o.Env)
 }
 
-// newRoot is the "first half" of SwitchRoot - that is, it creates special mounts
-// in newRoot, chroot's there, and RECURSIVELY DELETES everything in the old root.
-func newRoot(newRootDir string) error {
+// newRoot is the "first half" of SwitchRoot - that is, it moves mounts into
+// newRoot and chroot's there. It returns the old root, open, for deleting.
+func newRoot(newRootDir string, mounts []string) (*os.File, error) {
 	log.Printf("switch_root: moving mounts")
-	if err := addSpecialMounts(newRootDir); err != nil {
-		return fmt.Errorf("switch_root: moving mounts failed %v", err)
+	if err := addSpecialMounts(newRootDir, mounts); err != nil {
+		return nil, fmt.Errorf("switch_root: moving mounts failed %v", err)
 	}
 
 	log.Printf("switch_root: Changing directory")
 	if err := unix.Chdir(newRootDir); err != nil {
-		return fmt.Errorf("switch_root: failed change directory to new_root %v", err)
+		return nil, fmt.Errorf("switch_root: failed change directory to new_root %v", err)
 	}
 
 	// Open "/" now, we need the file descriptor later.
 	oldRoot, err := os.Open("/")
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer oldRoot.Close()
 
 	log.Printf("switch_root: Moving /")
 	if err := MoveMount(newRootDir, "/"); err != nil {
-		return err
+		oldRoot.Close()
+		return nil, err
 	}
 
 	log.Printf("switch_root: Changing root!")
 	if err := unix.Chroot("."); err != nil {
-		return fmt.Errorf("switch_root: fatal chroot error %v", err)
+		oldRoot.Close()
+		return nil, fmt.Errorf("switch_root: fatal chroot error %v", err)
+	}
+	if err := unix.Chdir("/"); err != nil {
+		oldRoot.Close()
+		return nil, fmt.Errorf("switch_root: failed change directory to / %v", err)
+	}
+	return oldRoot, nil
+}
+
+// maxSymlinks is how many symlinks resolveIn follows, as many as Linux.
+const maxSymlinks = 40
+
+// resolveIn resolves path as if root were /, so absolute symlinks such as
+// /sbin/init -> /lib/systemd/systemd stay in root. It returns the resolved
+// path relative to the current root.
+func resolveIn(root, path string) (string, error) {
+	var resolved string
+	todo := strings.Split(filepath.Clean("/"+path), "/")[1:]
+	for links := 0; len(todo) > 0; {
+		c := todo[0]
+		todo = todo[1:]
+		if c == "" || c == "." {
+			continue
+		}
+		if c == ".." {
+			resolved = filepath.Dir(resolved)
+			if resolved == "." || resolved == "/" {
+				resolved = ""
+			}
+			continue
+		}
+		next := resolved + "/" + c
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			// Not a symlink, or an error Stat will report.
+			resolved = next
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return "", fmt.Errorf("%s: too many levels of symbolic links", path)
+		}
+		if filepath.IsAbs(target) {
+			resolved = ""
+		}
+		todo = append(strings.Split(target, "/"), todo...)
+	}
+	return filepath.Join(root, resolved), nil
+}
+
+// checkInit checks that init in newRoot is an executable file.
+func checkInit(newRoot, init string) error {
+	p, err := resolveIn(newRoot, init)
+	if err != nil {
+		return err
 	}
+	fi, err := os.Stat(p)
+	if err != nil {
+		return fmt.Errorf("init %s in %s: %v", init, newRoot, err)
+	}
+	if !fi.Mode().IsRegular() || fi.Mode()&0111 == 0 {
+		return fmt.Errorf("init %s in %s is not an executable file", init, newRoot)
+	}
+	return nil
+}
 
-	log.Printf("switch_root: Deleting old /")
-	return recursiveDelete(int(oldRoot.Fd()))
+// closeOnExec marks all file descriptors but stdin, stdout, stderr and keep
+// close-on-exec, so init starts with only those open. The Go runtime's own
+// descriptors stay usable until then. Go opens everything close-on-exec, so
+// keep are unmarked.
+func closeOnExec(keep []int) error {
+	for _, fd := range keep {
+		if _, err := unix.FcntlInt(uintptr(fd), unix.F_SETFD, 0); err != nil {
+			return fmt.Errorf("keeping fd %d open: %v", fd, err)
+		}
+	}
+	d, err := os.Open("/proc/self/fd")
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	names, err := d.Readdirnames(-1)
+	if err != nil {
+		return err
+	}
+	kept := map[int]bool{0: true, 1: true, 2: true}
+	for _, fd := range keep {
+		kept[fd] = true
+	}
+	for _, n := range names {
+		fd, err := strconv.Atoi(n)
+		if err != nil || kept[fd] {
+			continue
+		}
+		if fd == int(d.Fd()) {
+			continue
+		}
+		// Descriptors that are already closed are fine.
+		if _, err := unix.FcntlInt(uintptr(fd), unix.F_SETFD, unix.FD_CLOEXEC); err != nil && err != unix.EBADF {
+			return err
+		}
+	}
+	return nil
 }
 
 // execInit is generally only useful as part of SwitchRoot or similar.
 // It exec's the given binary in place of the current binary, necessary so that
 // the new binary can be pid 1.
-func execInit(init string) error {
+func execInit(init string, args, env []string) error {
 	log.Printf("switch_root: executing init")
-	if err := unix.Exec(init, []string{init}, []string{}); err != nil {
+	if err := unix.Exec(init, append([]string{init}, args...), env); err != nil {
 		return fmt.Errorf("switch_root: exec failed %v", err)
 	}
 	return nil
@@ -0,0 +1,115 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mount
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestCheckInit(t *testing.T) {
+	root, err := ioutil.TempDir("", "newroot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// A merged-/usr layout with an absolute init symlink, as on Debian.
+	for _, d := range []string{"usr/sbin", "usr/lib/systemd"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, f := range []struct {
+		name string
+		mode os.FileMode
+	}{
+		{"usr/lib/systemd/systemd", 0755},
+		{"usr/sbin/notexec", 0644},
+	} {
+		if err := ioutil.WriteFile(filepath.Join(root, f.name), nil, f.mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, l := range []struct{ target, name string }{
+		{"usr/sbin", "sbin"},
+		{"usr/lib", "lib"},
+		{"/lib/systemd/systemd", "usr/sbin/init"},
+		{"../../etc/passwd", "usr/sbin/escape"},
+		{"loop", "usr/sbin/loop"},
+	} {
+		if err := os.Symlink(l.target, filepath.Join(root, l.name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		init    string
+		wantErr bool
+	}{
+		{"/sbin/init", false},
+		{"/lib/systemd/systemd", false},
+		{"/sbin/notexec", true},
+		{"/sbin/missing", true},
+		{"/sbin", true},
+		// Must not find the host's /etc/passwd.
+		{"/sbin/escape", true},
+		{"/sbin/loop", true},
+	} {
+		if err := checkInit(root, tt.init); (err != nil) != tt.wantErr {
+			t.Errorf("checkInit(%q) = %v, want error %t", tt.init, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSwitchRootNotMountPoint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "newroot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Must fail before touching anything.
+	if err := SwitchRootWithOptions(SwitchRootOptions{NewRoot: dir}); err == nil {
+		t.Errorf("SwitchRootWithOptions(%q) = nil, want error", dir)
+	}
+}
+
+func TestCloseOnExec(t *testing.T) {
+	keep, err := ioutil.TempFile("", "keep")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(keep.Name())
+	defer keep.Close()
+	other, err := os.Open(keep.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	if err := closeOnExec([]int{int(keep.Fd())}); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		f    *os.File
+		want int
+	}{
+		{keep, 0},
+		{other, unix.FD_CLOEXEC},
+	} {
+		flags, err := unix.FcntlInt(tt.f.Fd(), unix.F_GETFD, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := flags & unix.FD_CLOEXEC; got != tt.want {
+			t.Errorf("fd %d of %s: FD_CLOEXEC = %d, want %d", tt.f.Fd(), tt.f.Name(), got, tt.want)
+		}
+	}
+}
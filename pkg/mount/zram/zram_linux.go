@@ -0,0 +1,185 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package zram sets up zram devices: block devices in RAM whose contents
+// are compressed, for swap or scratch space.
+package zram
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/kmodule"
+)
+
+var (
+	sysBlock    = "/sys/block"
+	zramControl = "/sys/class/zram-control"
+	devDir      = "/dev"
+
+	// probe loads the zram module. It is a variable so tests can do
+	// without.
+	probe = func() error { return kmodule.Probe("zram", "") }
+)
+
+// Device is a zram device.
+type Device struct {
+	// Name is the device name, e.g. zram0.
+	Name string
+
+	// added says New added the device, so Free removes it.
+	added bool
+}
+
+// Path is the path of the device node.
+func (d *Device) Path() string {
+	return filepath.Join(devDir, d.Name)
+}
+
+func (d *Device) attr(name string) string {
+	return filepath.Join(sysBlock, d.Name, name)
+}
+
+func (d *Device) write(name, value string) error {
+	if err := ioutil.WriteFile(d.attr(name), []byte(value), 0644); err != nil {
+		return fmt.Errorf("%s: setting %s to %q: %v", d.Name, name, value, err)
+	}
+	return nil
+}
+
+// New sets up a zram device of size bytes that compresses with algorithm,
+// or the kernel's default if it is "". It uses a device with no size set
+// up if there is one, and adds one otherwise, loading the zram module if
+// need be.
+func New(size int64, algorithm string) (*Device, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("zram size %d is not positive", size)
+	}
+	d, err := free()
+	if err != nil {
+		return nil, err
+	}
+	if d == nil {
+		if d, err = add(); err != nil {
+			return nil, err
+		}
+	}
+	// The algorithm can only be set while the device has no size.
+	if algorithm != "" {
+		if err := d.write("comp_algorithm", algorithm); err != nil {
+			d.Free()
+			return nil, err
+		}
+	}
+	if err := d.write("disksize", strconv.FormatInt(size, 10)); err != nil {
+		d.Free()
+		return nil, err
+	}
+	return d, nil
+}
+
+// free returns a zram device with no size set, or nil if there is none.
+func free() (*Device, error) {
+	names, err := filepath.Glob(filepath.Join(sysBlock, "zram*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range names {
+		b, err := ioutil.ReadFile(filepath.Join(n, "disksize"))
+		if err != nil {
+			continue
+		}
+		if strings.TrimSpace(string(b)) == "0" {
+			return &Device{Name: filepath.Base(n)}, nil
+		}
+	}
+	return nil, nil
+}
+
+// add adds a zram device through zram-control, which appears once the
+// module is loaded.
+func add() (*Device, error) {
+	hotAdd := filepath.Join(zramControl, "hot_add")
+	if _, err := os.Stat(hotAdd); os.IsNotExist(err) {
+		if err := probe(); err != nil {
+			return nil, fmt.Errorf("loading zram module: %v", err)
+		}
+		// Loading the module may have made a device, too.
+		if d, err := free(); d != nil || err != nil {
+			return d, err
+		}
+	}
+	// Reading hot_add adds a device and returns its number.
+	b, err := ioutil.ReadFile(hotAdd)
+	if err != nil {
+		return nil, fmt.Errorf("adding zram device: %v", err)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("adding zram device: got %q", b)
+	}
+	return &Device{Name: fmt.Sprintf("zram%d", n), added: true}, nil
+}
+
+// Free resets the device, which discards its contents and frees its
+// memory, and removes it if New added it. The device must not be in use.
+func (d *Device) Free() error {
+	if err := d.write("reset", "1"); err != nil {
+		return err
+	}
+	if !d.added {
+		return nil
+	}
+	id := strings.TrimPrefix(d.Name, "zram")
+	if err := ioutil.WriteFile(filepath.Join(zramControl, "hot_remove"), []byte(id), 0644); err != nil {
+		return fmt.Errorf("removing %s: %v", d.Name, err)
+	}
+	return nil
+}
+
+// Stats is how much memory a zram device holds and uses.
+type Stats struct {
+	// DiskSize is the size of the device.
+	DiskSize int64
+
+	// OrigData is how much data is stored, and ComprData how much it
+	// compressed to.
+	OrigData  int64
+	ComprData int64
+
+	// MemUsed is how much memory the device takes, with overhead.
+	MemUsed int64
+}
+
+// Stats reads the device's memory statistics.
+func (d *Device) Stats() (*Stats, error) {
+	b, err := ioutil.ReadFile(d.attr("disksize"))
+	if err != nil {
+		return nil, err
+	}
+	size, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%s: bad disksize %q", d.Name, b)
+	}
+	// mm_stat: orig_data_size compr_data_size mem_used_total and more.
+	b, err = ioutil.ReadFile(d.attr("mm_stat"))
+	if err != nil {
+		return nil, err
+	}
+	f := strings.Fields(string(b))
+	if len(f) < 3 {
+		return nil, fmt.Errorf("%s: bad mm_stat %q", d.Name, b)
+	}
+	var v [3]int64
+	for i := range v {
+		if v[i], err = strconv.ParseInt(f[i], 10, 64); err != nil {
+			return nil, fmt.Errorf("%s: bad mm_stat %q", d.Name, b)
+		}
+	}
+	return &Stats{DiskSize: size, OrigData: v[0], ComprData: v[1], MemUsed: v[2]}, nil
+}
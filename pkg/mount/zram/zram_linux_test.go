@@ -0,0 +1,123 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package zram
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeSys makes a sysfs with zram devices of the given sizes, and
+// zram-control if hotAdd is not "". It returns a cleanup func.
+func fakeSys(t *testing.T, sizes map[string]string, hotAdd string) (string, func()) {
+	dir, err := ioutil.TempDir("", "zram")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldBlock, oldControl, oldProbe := sysBlock, zramControl, probe
+	sysBlock = filepath.Join(dir, "block")
+	zramControl = filepath.Join(dir, "zram-control")
+	probe = func() error { return os.ErrNotExist }
+	for name, size := range sizes {
+		os.MkdirAll(filepath.Join(sysBlock, name), 0755)
+		ioutil.WriteFile(filepath.Join(sysBlock, name, "disksize"), []byte(size+"\n"), 0644)
+	}
+	if hotAdd != "" {
+		os.MkdirAll(zramControl, 0755)
+		ioutil.WriteFile(filepath.Join(zramControl, "hot_add"), []byte(hotAdd+"\n"), 0644)
+		os.MkdirAll(filepath.Join(sysBlock, "zram"+hotAdd), 0755)
+	}
+	return dir, func() {
+		sysBlock, zramControl, probe = oldBlock, oldControl, oldProbe
+		os.RemoveAll(dir)
+	}
+}
+
+func read(t *testing.T, path string) string {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestNewReuses(t *testing.T) {
+	_, cleanup := fakeSys(t, map[string]string{"zram0": "1048576", "zram1": "0"}, "2")
+	defer cleanup()
+
+	d, err := New(64<<20, "lz4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != "zram1" || d.added {
+		t.Errorf("New = %+v, want existing zram1", d)
+	}
+	if got := read(t, d.attr("comp_algorithm")); got != "lz4" {
+		t.Errorf("comp_algorithm = %q, want lz4", got)
+	}
+	if got := read(t, d.attr("disksize")); got != "67108864" {
+		t.Errorf("disksize = %q, want 67108864", got)
+	}
+
+	if err := d.Free(); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, d.attr("reset")); got != "1" {
+		t.Errorf("reset = %q, want 1", got)
+	}
+	if _, err := os.Stat(filepath.Join(zramControl, "hot_remove")); err == nil {
+		t.Errorf("Free removed a device it did not add")
+	}
+}
+
+func TestNewAdds(t *testing.T) {
+	_, cleanup := fakeSys(t, map[string]string{"zram0": "1048576"}, "1")
+	defer cleanup()
+
+	d, err := New(1<<20, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != "zram1" || !d.added || d.Path() != "/dev/zram1" {
+		t.Errorf("New = %+v, want added zram1", d)
+	}
+	if _, err := os.Stat(d.attr("comp_algorithm")); err == nil {
+		t.Errorf("New set an algorithm when none was asked for")
+	}
+	if err := d.Free(); err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, filepath.Join(zramControl, "hot_remove")); got != "1" {
+		t.Errorf("hot_remove = %q, want 1", got)
+	}
+}
+
+func TestNewNoModule(t *testing.T) {
+	_, cleanup := fakeSys(t, nil, "")
+	defer cleanup()
+
+	if _, err := New(1<<20, ""); err == nil {
+		t.Errorf("New without zram = nil, want error")
+	}
+}
+
+func TestStats(t *testing.T) {
+	_, cleanup := fakeSys(t, map[string]string{"zram0": "4194304"}, "")
+	defer cleanup()
+
+	d := &Device{Name: "zram0"}
+	ioutil.WriteFile(d.attr("mm_stat"), []byte("  1048576   262144   270336        0   270336        3        0        0\n"), 0644)
+	s, err := d.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Stats{DiskSize: 4194304, OrigData: 1048576, ComprData: 262144, MemUsed: 270336}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("Stats = %+v, want %+v", s, want)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/u-root/u-root/pkg/dhclient"
+	"github.com/vishvananda/netlink"
+)
+
+// Apply configures every link that matches an Interface in c: it renames
+// it, sets its MTU and brings it up, adds static addresses and routes, then
+// runs DHCP where asked for. Nameservers and search domains of static
+// configs are written to resolv.conf; DHCP leases write their own.
+//
+// Links that match nothing are left alone. All links are tried; the first
+// error is returned.
+func Apply(ctx context.Context, c *Config, dc dhclient.Config) error {
+	links, err := netlink.LinkList()
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	fail := func(err error) {
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	var dhcp4, dhcp6, dhcpBoth []netlink.Link
+	var ns []net.IP
+	var search []string
+	for _, l := range links {
+		i := c.Lookup(l.Attrs().Name, l.Attrs().HardwareAddr)
+		if i == nil {
+			continue
+		}
+		l, err := i.configure(l)
+		if err != nil {
+			fail(fmt.Errorf("%s (%s): %v", l.Attrs().Name, i.ID, err))
+			continue
+		}
+		switch {
+		case i.DHCP4 && i.DHCP6:
+			dhcpBoth = append(dhcpBoth, l)
+		case i.DHCP4:
+			dhcp4 = append(dhcp4, l)
+		case i.DHCP6:
+			dhcp6 = append(dhcp6, l)
+		}
+		ns = append(ns, i.Nameservers...)
+		search = append(search, i.Search...)
+	}
+
+	if len(ns) > 0 || len(search) > 0 {
+		if err := dhclient.WriteDNSSettings(ns, search, ""); err != nil {
+			fail(err)
+		}
+	}
+
+	for _, g := range []struct {
+		links      []netlink.Link
+		ipv4, ipv6 bool
+	}{
+		{dhcp4, true, false},
+		{dhcp6, false, true},
+		{dhcpBoth, true, true},
+	} {
+		if len(g.links) == 0 {
+			continue
+		}
+		for r := range dhclient.SendRequests(ctx, g.links, g.ipv4, g.ipv6, dc) {
+			if r.Err != nil {
+				fail(fmt.Errorf("%s: %v DHCP: %v", r.Interface.Attrs().Name, r.Protocol, r.Err))
+				continue
+			}
+			if err := r.Lease.Configure(); err != nil {
+				fail(fmt.Errorf("%s: %v", r.Interface.Attrs().Name, err))
+			}
+		}
+	}
+	return firstErr
+}
+
+// configure applies the static part of i to l and returns the link, which
+// may have been renamed.
+func (i *Interface) configure(l netlink.Link) (netlink.Link, error) {
+	if len(i.SetName) > 0 && i.SetName != l.Attrs().Name {
+		// Links can only be renamed while down.
+		if err := netlink.LinkSetDown(l); err != nil {
+			return l, err
+		}
+		if err := netlink.LinkSetName(l, i.SetName); err != nil {
+			return l, fmt.Errorf("rename to %s: %v", i.SetName, err)
+		}
+		var err error
+		if l, err = netlink.LinkByName(i.SetName); err != nil {
+			return l, err
+		}
+	}
+	if i.MTU > 0 {
+		if err := netlink.LinkSetMTU(l, i.MTU); err != nil {
+			return l, fmt.Errorf("set MTU %d: %v", i.MTU, err)
+		}
+	}
+	if err := netlink.LinkSetUp(l); err != nil {
+		return l, err
+	}
+	for _, a := range i.Addresses {
+		if err := netlink.AddrReplace(l, &netlink.Addr{IPNet: a}); err != nil {
+			return l, fmt.Errorf("add address %v: %v", a, err)
+		}
+	}
+	for _, r := range i.Routes {
+		nr := &netlink.Route{
+			LinkIndex: l.Attrs().Index,
+			Dst:       r.To,
+			Gw:        r.Via,
+			Priority:  r.Metric,
+		}
+		if r.Via == nil {
+			nr.Scope = netlink.SCOPE_LINK
+		}
+		if err := netlink.RouteReplace(nr); err != nil {
+			return l, fmt.Errorf("add route %v: %v", nr, err)
+		}
+	}
+	return l, nil
+}
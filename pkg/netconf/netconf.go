@@ -0,0 +1,154 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package netconf configures network interfaces from standard config
+// formats: a practical subset of netplan YAML (as cloud-init's network
+// config version 2 uses) and of systemd-networkd .network files.
+//
+// Both are parsed into a Config, which Apply sets up using netlink and
+// dhclient. Unsupported keys are ignored, so a config written for a full
+// network manager still does what it can.
+package netconf
+
+import (
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+)
+
+// Config is a network configuration.
+type Config struct {
+	// Interfaces are tried in order; a link is configured by the first
+	// one that matches it.
+	Interfaces []*Interface
+}
+
+// Match selects the links an Interface applies to. Empty fields match
+// anything.
+type Match struct {
+	// Names are shell globs, e.g. "eth*".
+	Names []string
+
+	// MACs are hardware addresses.
+	MACs []net.HardwareAddr
+}
+
+// Route is a static route.
+type Route struct {
+	// To is the destination; nil is the default route.
+	To     *net.IPNet
+	Via    net.IP
+	Metric int
+}
+
+// Interface is the configuration of matching links.
+type Interface struct {
+	// ID names the interface's config: a netplan ID or a .network file.
+	ID    string
+	Match Match
+
+	// SetName renames the link.
+	SetName string
+
+	DHCP4 bool
+	DHCP6 bool
+
+	Addresses []*net.IPNet
+	Routes    []Route
+	MTU       int
+
+	Nameservers []net.IP
+	Search      []string
+}
+
+// Matches returns whether i applies to the link called name with hardware
+// address mac.
+func (i *Interface) Matches(name string, mac net.HardwareAddr) bool {
+	if len(i.Match.Names) > 0 {
+		var ok bool
+		for _, g := range i.Match.Names {
+			if m, _ := filepath.Match(g, name); m {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(i.Match.MACs) > 0 {
+		var ok bool
+		for _, m := range i.Match.MACs {
+			if m.String() == mac.String() {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Lookup returns the Interface for the link called name with hardware
+// address mac, or nil.
+func (c *Config) Lookup(name string, mac net.HardwareAddr) *Interface {
+	for _, i := range c.Interfaces {
+		if i.Matches(name, mac) {
+			return i
+		}
+	}
+	return nil
+}
+
+// parseAddress parses an address with prefix length. It returns the host
+// address, not the network.
+func parseAddress(s string) (*net.IPNet, error) {
+	ip, n, err := net.ParseCIDR(strings.TrimSpace(s))
+	if err != nil {
+		return nil, err
+	}
+	n.IP = ip
+	return n, nil
+}
+
+// parseDestination parses a route destination. "default" and empty strings
+// are the default route.
+func parseDestination(s string) (*net.IPNet, error) {
+	switch s = strings.TrimSpace(s); s {
+	case "", "default", "0.0.0.0/0", "::/0":
+		return nil, nil
+	}
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid route destination %q", s)
+		}
+		if ip.To4() != nil {
+			return &net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}, nil
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(128, 128)}, nil
+	}
+	_, n, err := net.ParseCIDR(s)
+	return n, err
+}
+
+func parseIP(s string) (net.IP, error) {
+	ip := net.ParseIP(strings.TrimSpace(s))
+	if ip == nil {
+		return nil, fmt.Errorf("invalid IP address %q", s)
+	}
+	return ip, nil
+}
+
+// gatewayRoute returns the default route via gw.
+func gatewayRoute(s string) (Route, error) {
+	gw, err := parseIP(s)
+	if err != nil {
+		return Route{}, err
+	}
+	return Route{Via: gw}, nil
+}
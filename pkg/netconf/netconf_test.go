@@ -0,0 +1,199 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func mustAddr(s string) *net.IPNet {
+	a, err := parseAddress(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+func mustNet(s string) *net.IPNet {
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func mustMAC(s string) net.HardwareAddr {
+	m, err := net.ParseMAC(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func TestParseNetplan(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		in   string
+		want []*Interface
+	}{
+		{
+			name: "cloud-init network-config",
+			in: `version: 2
+ethernets:
+  eth0:
+    dhcp4: true
+`,
+			want: []*Interface{{ID: "eth0", Match: Match{Names: []string{"eth0"}}, DHCP4: true}},
+		},
+		{
+			name: "etc netplan",
+			in: `network:
+  version: 2
+  ethernets:
+    uplink:
+      match:
+        macaddress: "52:54:00:12:34:56"
+      set-name: wan0
+      mtu: 9000
+      addresses: [192.168.1.10/24, "2001:db8::10/64"]
+      gateway4: 192.168.1.1
+      routes:
+        - to: 10.0.0.0/8
+          via: 192.168.1.254
+          metric: 100
+      nameservers:
+        addresses: [192.168.1.1]
+        search: [example.com]
+    lan:
+      match:
+        name: "en*"
+      dhcp6: true
+`,
+			want: []*Interface{
+				{ID: "lan", Match: Match{Names: []string{"en*"}}, DHCP6: true},
+				{
+					ID:        "uplink",
+					Match:     Match{MACs: []net.HardwareAddr{mustMAC("52:54:00:12:34:56")}},
+					SetName:   "wan0",
+					MTU:       9000,
+					Addresses: []*net.IPNet{mustAddr("192.168.1.10/24"), mustAddr("2001:db8::10/64")},
+					Routes: []Route{
+						{Via: net.ParseIP("192.168.1.1")},
+						{To: mustNet("10.0.0.0/8"), Via: net.ParseIP("192.168.1.254"), Metric: 100},
+					},
+					Nameservers: []net.IP{net.ParseIP("192.168.1.1")},
+					Search:      []string{"example.com"},
+				},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := ParseNetplan([]byte(tt.in))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(c.Interfaces, tt.want) {
+				t.Errorf("ParseNetplan() = %+v, want %+v", c.Interfaces, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseNetplan([]byte("version: 1\nconfig: []\n")); err == nil {
+		t.Errorf("ParseNetplan(version 1) succeeded, want error")
+	}
+}
+
+func TestParseNetworkd(t *testing.T) {
+	const in = `# static uplink
+[Match]
+Name=eth* en*
+MACAddress=52:54:00:12:34:56
+
+[Link]
+MTUBytes=1400
+
+[Network]
+DHCP=ipv6
+Address=10.0.0.2/24
+Gateway=10.0.0.1
+DNS=10.0.0.1 10.0.0.53
+Domains=example.com ~corp
+
+[Address]
+Address=10.0.1.2/24
+
+[Route]
+Destination=172.16.0.0/12
+Gateway=10.0.0.254
+Metric=50
+`
+	got, err := ParseNetworkd("10-uplink.network", strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Interface{
+		ID: "10-uplink.network",
+		Match: Match{
+			Names: []string{"eth*", "en*"},
+			MACs:  []net.HardwareAddr{mustMAC("52:54:00:12:34:56")},
+		},
+		MTU:       1400,
+		DHCP6:     true,
+		Addresses: []*net.IPNet{mustAddr("10.0.0.2/24"), mustAddr("10.0.1.2/24")},
+		Routes: []Route{
+			{Via: net.ParseIP("10.0.0.1")},
+			{To: mustNet("172.16.0.0/12"), Via: net.ParseIP("10.0.0.254"), Metric: 50},
+		},
+		Nameservers: []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.53")},
+		Search:      []string{"example.com"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseNetworkd() = %+v, want %+v", got, want)
+	}
+
+	for _, bad := range []string{"[Network]\nDHCP=maybe\n", "[Network]\nAddress\n", "[Route]\nGateway=nope\n"} {
+		if _, err := ParseNetworkd("bad.network", strings.NewReader(bad)); err == nil {
+			t.Errorf("ParseNetworkd(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netconf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "20-wired.network"), []byte("[Match]\nName=eth*\n[Network]\nDHCP=yes\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "10-mgmt.network"), []byte("[Match]\nMACAddress=52:54:00:00:00:01\n[Network]\nAddress=10.0.0.2/24\n"), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "README"), []byte("not a network file"), 0644)
+
+	c, err := ParseNetworkdDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name, mac string
+		want      string
+	}{
+		{"eth0", "52:54:00:00:00:01", "10-mgmt.network"},
+		{"eth1", "52:54:00:00:00:02", "20-wired.network"},
+		{"wlan0", "52:54:00:00:00:03", ""},
+	} {
+		var got string
+		if i := c.Lookup(tt.name, mustMAC(tt.mac)); i != nil {
+			got = i.ID
+		}
+		if got != tt.want {
+			t.Errorf("Lookup(%s, %s) = %q, want %q", tt.name, tt.mac, got, tt.want)
+		}
+	}
+}
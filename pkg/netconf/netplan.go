@@ -0,0 +1,145 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"fmt"
+	"net"
+	"sort"
+
+	"gopkg.in/yaml.v2"
+)
+
+type netplanRoute struct {
+	To     string `yaml:"to"`
+	Via    string `yaml:"via"`
+	Metric int    `yaml:"metric"`
+}
+
+type netplanEthernet struct {
+	Match struct {
+		Name       string `yaml:"name"`
+		MACAddress string `yaml:"macaddress"`
+	} `yaml:"match"`
+	SetName     string         `yaml:"set-name"`
+	DHCP4       bool           `yaml:"dhcp4"`
+	DHCP6       bool           `yaml:"dhcp6"`
+	Addresses   []string       `yaml:"addresses"`
+	Gateway4    string         `yaml:"gateway4"`
+	Gateway6    string         `yaml:"gateway6"`
+	Routes      []netplanRoute `yaml:"routes"`
+	MTU         int            `yaml:"mtu"`
+	Nameservers struct {
+		Addresses []string `yaml:"addresses"`
+		Search    []string `yaml:"search"`
+	} `yaml:"nameservers"`
+}
+
+type netplanNetwork struct {
+	Version   int                         `yaml:"version"`
+	Ethernets map[string]*netplanEthernet `yaml:"ethernets"`
+}
+
+// ParseNetplan parses netplan YAML. The config may be at the top level, as
+// cloud-init's network-config has it, or under a "network" key, as in
+// /etc/netplan. Only ethernets are supported.
+func ParseNetplan(b []byte) (*Config, error) {
+	var doc struct {
+		netplanNetwork `yaml:",inline"`
+		Network        *netplanNetwork `yaml:"network"`
+	}
+	if err := yaml.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("netplan: %v", err)
+	}
+	n := &doc.netplanNetwork
+	if doc.Network != nil {
+		n = doc.Network
+	}
+	if n.Version != 2 {
+		return nil, fmt.Errorf("netplan: unsupported version %d", n.Version)
+	}
+
+	// netplan has no order of its own; sort by ID so it is stable.
+	var ids []string
+	for id := range n.Ethernets {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	c := &Config{}
+	for _, id := range ids {
+		i, err := n.Ethernets[id].config(id)
+		if err != nil {
+			return nil, fmt.Errorf("netplan: ethernets.%s: %v", id, err)
+		}
+		c.Interfaces = append(c.Interfaces, i)
+	}
+	return c, nil
+}
+
+func (e *netplanEthernet) config(id string) (*Interface, error) {
+	if e == nil {
+		e = &netplanEthernet{}
+	}
+	i := &Interface{
+		ID:      id,
+		SetName: e.SetName,
+		DHCP4:   e.DHCP4,
+		DHCP6:   e.DHCP6,
+		MTU:     e.MTU,
+		Search:  e.Nameservers.Search,
+	}
+	// Without a match, the ID is the interface name.
+	switch {
+	case len(e.Match.Name) > 0:
+		i.Match.Names = []string{e.Match.Name}
+	case len(e.Match.MACAddress) == 0:
+		i.Match.Names = []string{id}
+	}
+	if len(e.Match.MACAddress) > 0 {
+		mac, err := net.ParseMAC(e.Match.MACAddress)
+		if err != nil {
+			return nil, err
+		}
+		i.Match.MACs = []net.HardwareAddr{mac}
+	}
+
+	for _, a := range e.Addresses {
+		addr, err := parseAddress(a)
+		if err != nil {
+			return nil, err
+		}
+		i.Addresses = append(i.Addresses, addr)
+	}
+	for _, gw := range []string{e.Gateway4, e.Gateway6} {
+		if len(gw) == 0 {
+			continue
+		}
+		r, err := gatewayRoute(gw)
+		if err != nil {
+			return nil, err
+		}
+		i.Routes = append(i.Routes, r)
+	}
+	for _, r := range e.Routes {
+		to, err := parseDestination(r.To)
+		if err != nil {
+			return nil, err
+		}
+		via, err := parseIP(r.Via)
+		if err != nil {
+			return nil, err
+		}
+		i.Routes = append(i.Routes, Route{To: to, Via: via, Metric: r.Metric})
+	}
+	for _, ns := range e.Nameservers.Addresses {
+		ip, err := parseIP(ns)
+		if err != nil {
+			return nil, err
+		}
+		i.Nameservers = append(i.Nameservers, ip)
+	}
+	return i, nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconf
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ParseNetworkd parses a systemd-networkd .network file. The supported keys
+// are:
+//
+//     [Match]   Name, MACAddress
+//     [Link]    MTUBytes
+//     [Network] DHCP, Address, Gateway, DNS, Domains
+//     [Address] Address
+//     [Route]   Destination, Gateway, Metric
+func ParseNetworkd(id string, r io.Reader) (*Interface, error) {
+	i := &Interface{ID: id}
+	var section string
+	var route *Route
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if len(line) == 0 || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = line[1 : len(line)-1]
+			if section == "Route" {
+				i.Routes = append(i.Routes, Route{})
+				route = &i.Routes[len(i.Routes)-1]
+			}
+			continue
+		}
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", id, n)
+		}
+		if err := i.setNetworkd(section, strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1]), route); err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", id, n, err)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return i, nil
+}
+
+func (i *Interface) setNetworkd(section, key, value string, route *Route) error {
+	switch section + "." + key {
+	case "Match.Name":
+		i.Match.Names = append(i.Match.Names, strings.Fields(value)...)
+
+	case "Match.MACAddress":
+		for _, m := range strings.Fields(value) {
+			mac, err := net.ParseMAC(m)
+			if err != nil {
+				return err
+			}
+			i.Match.MACs = append(i.Match.MACs, mac)
+		}
+
+	case "Link.MTUBytes":
+		mtu, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		i.MTU = mtu
+
+	case "Network.DHCP":
+		switch value {
+		case "yes", "true", "both":
+			i.DHCP4, i.DHCP6 = true, true
+		case "ipv4":
+			i.DHCP4, i.DHCP6 = true, false
+		case "ipv6":
+			i.DHCP4, i.DHCP6 = false, true
+		case "no", "false", "none":
+			i.DHCP4, i.DHCP6 = false, false
+		default:
+			return fmt.Errorf("invalid DHCP=%s", value)
+		}
+
+	case "Network.Address", "Address.Address":
+		a, err := parseAddress(value)
+		if err != nil {
+			return err
+		}
+		i.Addresses = append(i.Addresses, a)
+
+	case "Network.Gateway":
+		r, err := gatewayRoute(value)
+		if err != nil {
+			return err
+		}
+		i.Routes = append(i.Routes, r)
+
+	case "Network.DNS":
+		for _, d := range strings.Fields(value) {
+			ip, err := parseIP(d)
+			if err != nil {
+				return err
+			}
+			i.Nameservers = append(i.Nameservers, ip)
+		}
+
+	case "Network.Domains":
+		for _, d := range strings.Fields(value) {
+			// "~" marks routing-only domains, which resolv.conf
+			// cannot express.
+			if !strings.HasPrefix(d, "~") {
+				i.Search = append(i.Search, d)
+			}
+		}
+
+	case "Route.Destination":
+		to, err := parseDestination(value)
+		if err != nil {
+			return err
+		}
+		route.To = to
+
+	case "Route.Gateway":
+		gw, err := parseIP(value)
+		if err != nil {
+			return err
+		}
+		route.Via = gw
+
+	case "Route.Metric":
+		m, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		route.Metric = m
+	}
+	return nil
+}
+
+// ParseNetworkdDir parses the .network files in dir in lexical order, as
+// systemd-networkd does.
+func ParseNetworkdDir(dir string) (*Config, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	c := &Config{}
+	for _, fi := range files {
+		if fi.IsDir() || filepath.Ext(fi.Name()) != ".network" {
+			continue
+		}
+		i, err := parseNetworkdFile(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, err
+		}
+		c.Interfaces = append(c.Interfaces, i)
+	}
+	return c, nil
+}
+
+func parseNetworkdFile(path string) (*Interface, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ParseNetworkd(filepath.Base(path), f)
+}
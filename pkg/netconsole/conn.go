@@ -0,0 +1,69 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconsole
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// maxChunk is the most sent in one datagram, as the kernel's
+// MAX_PRINT_CHUNK.
+const maxChunk = 1000
+
+// Conn sends what is written to it to a netconsole receiver, so that
+// userland messages end up next to the kernel's. Whatever the receiver
+// sends back can be read, which makes it a console for console.Mux.
+type Conn struct {
+	c *net.UDPConn
+}
+
+// Dial returns a Conn to remote.
+func Dial(remote *net.UDPAddr) (*Conn, error) {
+	c, err := net.DialUDP("udp", nil, remote)
+	if err != nil {
+		return nil, err
+	}
+	return &Conn{c: c}, nil
+}
+
+// refused is whether err only says nothing was listening when something was
+// last sent, which is no reason to stop sending.
+func refused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED)
+}
+
+// Write sends p in datagrams of at most 1000 bytes. Nobody listening is not
+// an error.
+func (c *Conn) Write(p []byte) (int, error) {
+	for n := 0; n < len(p); {
+		end := n + maxChunk
+		if end > len(p) {
+			end = len(p)
+		}
+		if _, err := c.c.Write(p[n:end]); err != nil && !refused(err) {
+			return n, err
+		}
+		n = end
+	}
+	return len(p), nil
+}
+
+// Read reads a datagram from the receiver.
+func (c *Conn) Read(p []byte) (int, error) {
+	for {
+		n, err := c.c.Read(p)
+		if err != nil && refused(err) {
+			continue
+		}
+		return n, err
+	}
+}
+
+// Close closes the connection.
+func (c *Conn) Close() error {
+	return c.c.Close()
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconsole
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConn(t *testing.T) {
+	l, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("no loopback: %v", err)
+	}
+	defer l.Close()
+	l.SetDeadline(time.Now().Add(5 * time.Second))
+
+	c, err := Dial(l.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	msg := bytes.Repeat([]byte("x"), 2*maxChunk+10)
+	if n, err := c.Write(msg); n != len(msg) || err != nil {
+		t.Fatalf("Write = %d, %v, want %d, nil", n, err, len(msg))
+	}
+	var sizes []int
+	var from *net.UDPAddr
+	buf := make([]byte, 2*maxChunk)
+	for len(sizes) < 3 {
+		n, addr, err := l.ReadFromUDP(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, n)
+		from = addr
+	}
+	if sizes[0] != maxChunk || sizes[1] != maxChunk || sizes[2] != 10 {
+		t.Errorf("datagrams of %v bytes, want %d, %d, 10", sizes, maxChunk, maxChunk)
+	}
+
+	// The receiver can type back.
+	if _, err := l.WriteToUDP([]byte("reboot\n"), from); err != nil {
+		t.Fatal(err)
+	}
+	n, err := c.Read(buf)
+	if err != nil || string(buf[:n]) != "reboot\n" {
+		t.Errorf("Read = %q, %v, want %q", buf[:n], err, "reboot\n")
+	}
+}
+
+func TestConnNobodyListening(t *testing.T) {
+	l, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skipf("no loopback: %v", err)
+	}
+	addr := l.LocalAddr().(*net.UDPAddr)
+	l.Close()
+
+	c, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	// The second write would see the first one's port unreachable.
+	for i := 0; i < 3; i++ {
+		if _, err := c.Write([]byte("hello\n")); err != nil {
+			t.Errorf("Write %d = %v, want nil", i, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
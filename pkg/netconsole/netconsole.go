@@ -0,0 +1,152 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package netconsole sets up the kernel's netconsole and sends u-root's own
+// messages the same way, so machines without a cabled serial port can be
+// debugged over the network.
+//
+// See Documentation/networking/netconsole.rst in the kernel for the receiving
+// side; "nc -u -l 6666" will do.
+package netconsole
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// Default ports, as the kernel's.
+const (
+	DefaultLocalPort  = 6665
+	DefaultRemotePort = 6666
+)
+
+// Target is a netconsole target, as in the kernel's netconsole= parameter:
+//
+//	[+][src-port]@[src-ip]/[<dev>],[tgt-port]@<tgt-ip>/[tgt-macaddr]
+type Target struct {
+	// Extended sends messages in the extended format, with metadata.
+	Extended bool
+
+	LocalPort int
+	LocalIP   net.IP
+	Dev       string
+
+	RemotePort int
+	RemoteIP   net.IP
+	// RemoteMAC is the MAC address of the receiver, or of the router to it.
+	// The kernel does not resolve addresses and broadcasts if it is nil.
+	RemoteMAC net.HardwareAddr
+}
+
+// Remote returns the receiver's address.
+func (t *Target) Remote() *net.UDPAddr {
+	port := t.RemotePort
+	if port == 0 {
+		port = DefaultRemotePort
+	}
+	return &net.UDPAddr{IP: t.RemoteIP, Port: port}
+}
+
+// String formats t as the value of a netconsole= parameter.
+func (t *Target) String() string {
+	var b strings.Builder
+	if t.Extended {
+		b.WriteByte('+')
+	}
+	if t.LocalPort != 0 {
+		b.WriteString(strconv.Itoa(t.LocalPort))
+	}
+	b.WriteByte('@')
+	if t.LocalIP != nil {
+		b.WriteString(t.LocalIP.String())
+	}
+	b.WriteByte('/')
+	b.WriteString(t.Dev)
+	b.WriteByte(',')
+	if t.RemotePort != 0 {
+		b.WriteString(strconv.Itoa(t.RemotePort))
+	}
+	b.WriteByte('@')
+	if t.RemoteIP != nil {
+		b.WriteString(t.RemoteIP.String())
+	}
+	b.WriteByte('/')
+	if t.RemoteMAC != nil {
+		b.WriteString(t.RemoteMAC.String())
+	}
+	return b.String()
+}
+
+// parsePortIP parses "[port]@[ip]".
+func parsePortIP(s string) (int, net.IP, error) {
+	i := strings.IndexByte(s, '@')
+	if i < 0 {
+		return 0, nil, fmt.Errorf("%q: missing @", s)
+	}
+	var port int
+	if i > 0 {
+		p, err := strconv.ParseUint(s[:i], 10, 16)
+		if err != nil {
+			return 0, nil, fmt.Errorf("%q: bad port: %v", s, err)
+		}
+		port = int(p)
+	}
+	var ip net.IP
+	if s[i+1:] != "" {
+		if ip = net.ParseIP(s[i+1:]); ip == nil {
+			return 0, nil, fmt.Errorf("%q: bad IP address", s)
+		}
+	}
+	return port, ip, nil
+}
+
+// Parse parses the value of a netconsole= parameter. The kernel allows
+// several targets separated by semicolons.
+func Parse(s string) ([]*Target, error) {
+	var targets []*Target
+	for _, v := range strings.Split(s, ";") {
+		t := &Target{}
+		if strings.HasPrefix(v, "+") {
+			t.Extended = true
+			v = v[1:]
+		}
+		i := strings.IndexByte(v, ',')
+		if i < 0 {
+			return nil, fmt.Errorf("netconsole %q: missing target", v)
+		}
+		local, remote := v[:i], v[i+1:]
+
+		// IPv6 addresses have no slashes, so the last one ends the address.
+		j := strings.LastIndexByte(local, '/')
+		if j < 0 {
+			return nil, fmt.Errorf("netconsole %q: missing /", v)
+		}
+		var err error
+		if t.LocalPort, t.LocalIP, err = parsePortIP(local[:j]); err != nil {
+			return nil, fmt.Errorf("netconsole source %v", err)
+		}
+		t.Dev = local[j+1:]
+
+		// MAC addresses have no slashes either.
+		var mac string
+		if j := strings.LastIndexByte(remote, '/'); j >= 0 {
+			remote, mac = remote[:j], remote[j+1:]
+		}
+		if t.RemotePort, t.RemoteIP, err = parsePortIP(remote); err != nil {
+			return nil, fmt.Errorf("netconsole target %v", err)
+		}
+		if t.RemoteIP == nil {
+			return nil, fmt.Errorf("netconsole %q: missing target IP", v)
+		}
+		if mac != "" {
+			if t.RemoteMAC, err = net.ParseMAC(mac); err != nil {
+				return nil, fmt.Errorf("netconsole %q: %v", v, err)
+			}
+		}
+		targets = append(targets, t)
+	}
+	return targets, nil
+}
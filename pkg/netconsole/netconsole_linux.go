@@ -0,0 +1,185 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconsole
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+	"github.com/u-root/u-root/pkg/cmdline"
+	"github.com/u-root/u-root/pkg/dhclient"
+	"github.com/u-root/u-root/pkg/kmodule"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	moduleDir   = "/sys/module/netconsole"
+	configfs    = "/sys/kernel/config"
+	configfsDir = filepath.Join(configfs, "netconsole")
+)
+
+// FromCmdline returns the targets of the netconsole= parameter on the kernel
+// command line, if any.
+func FromCmdline() ([]*Target, error) {
+	v, ok := cmdline.Flag("netconsole")
+	if !ok {
+		return nil, nil
+	}
+	return Parse(v)
+}
+
+// Configure starts sending kernel messages to targets. A netconsole module
+// that is not loaded yet is loaded with them as its parameter; otherwise
+// they are added as dynamic targets called name, name1, name2 and so on.
+func Configure(name string, targets ...*Target) error {
+	if _, err := os.Stat(moduleDir); os.IsNotExist(err) {
+		s := make([]string, len(targets))
+		for i, t := range targets {
+			s[i] = t.String()
+		}
+		return kmodule.Probe("netconsole", "netconsole="+strings.Join(s, ";"))
+	}
+	for i, t := range targets {
+		n := name
+		if i > 0 {
+			n += strconv.Itoa(i)
+		}
+		if err := configureDynamic(n, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type attr struct{ name, value string }
+
+// configureDynamic sets t up through configfs, see "Dynamic
+// reconfiguration" in netconsole.rst.
+func configureDynamic(name string, t *Target) error {
+	if _, err := os.Stat(configfsDir); os.IsNotExist(err) {
+		if err := unix.Mount("configfs", configfs, "configfs", 0, ""); err != nil {
+			return fmt.Errorf("netconsole: mount configfs: %v", err)
+		}
+	}
+	dir := filepath.Join(configfsDir, name)
+	if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("netconsole: %v", err)
+	}
+	// Attributes can only be changed while the target is disabled.
+	ioutil.WriteFile(filepath.Join(dir, "enabled"), []byte("0"), 0644)
+
+	attrs := []attr{
+		{"dev_name", t.Dev},
+		{"remote_ip", t.RemoteIP.String()},
+		{"remote_port", strconv.Itoa(t.Remote().Port)},
+	}
+	if t.Extended {
+		attrs = append(attrs, attr{"extended", "1"})
+	}
+	if t.LocalIP != nil {
+		attrs = append(attrs, attr{"local_ip", t.LocalIP.String()})
+	}
+	if t.LocalPort != 0 {
+		attrs = append(attrs, attr{"local_port", strconv.Itoa(t.LocalPort)})
+	}
+	if t.RemoteMAC != nil {
+		attrs = append(attrs, attr{"remote_mac", t.RemoteMAC.String()})
+	}
+	attrs = append(attrs, attr{"enabled", "1"})
+	for _, a := range attrs {
+		if err := ioutil.WriteFile(filepath.Join(dir, a.name), []byte(a.value), 0644); err != nil {
+			return fmt.Errorf("netconsole: %v", err)
+		}
+	}
+	return nil
+}
+
+// target4 returns the target for sending to remote from the address in a
+// DHCPv4 lease, and the next hop to remote.
+func target4(dev string, m *dhcpv4.DHCPv4, remote *net.UDPAddr) (*Target, net.IP, error) {
+	if remote == nil {
+		// The log server option says where to send to.
+		ips := dhcpv4.GetIPs(dhcpv4.OptionLogServer, m.Options)
+		if len(ips) == 0 {
+			return nil, nil, fmt.Errorf("netconsole: no receiver given and no log server in lease")
+		}
+		remote = &net.UDPAddr{IP: ips[0], Port: DefaultRemotePort}
+	}
+	if m.YourIPAddr == nil || m.YourIPAddr.IsUnspecified() {
+		return nil, nil, fmt.Errorf("netconsole: lease has no address")
+	}
+	t := &Target{
+		Dev:        dev,
+		LocalIP:    m.YourIPAddr,
+		RemoteIP:   remote.IP,
+		RemotePort: remote.Port,
+	}
+	hop := remote.IP
+	if mask := m.SubnetMask(); mask != nil {
+		local := net.IPNet{IP: m.YourIPAddr.Mask(mask), Mask: mask}
+		if !local.Contains(remote.IP) {
+			routers := m.Router()
+			if len(routers) == 0 {
+				return nil, nil, fmt.Errorf("netconsole: %v is not on %v and there is no router", remote.IP, &local)
+			}
+			hop = routers[0]
+		}
+	}
+	return t, hop, nil
+}
+
+// FromLease returns a target for sending to remote over the interface of a
+// configured DHCPv4 lease. If remote is nil, the lease's log server is used.
+//
+// The kernel does not resolve addresses, so the MAC address of remote, or
+// of the router to it, is looked up here.
+func FromLease(l dhclient.Lease, remote *net.UDPAddr) (*Target, error) {
+	m, _ := l.Message()
+	if m == nil {
+		return nil, fmt.Errorf("netconsole: only DHCPv4 leases are supported")
+	}
+	link := l.Link()
+	t, hop, err := target4(link.Attrs().Name, m, remote)
+	if err != nil {
+		return nil, err
+	}
+	if t.RemoteMAC, err = resolve(link, hop); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// resolve returns the MAC address of ip on link, sending it a packet to
+// have the kernel ARP for it if need be.
+func resolve(link netlink.Link, ip net.IP) (net.HardwareAddr, error) {
+	for try := 0; try < 10; try++ {
+		neighs, err := netlink.NeighList(link.Attrs().Index, netlink.FAMILY_V4)
+		if err != nil {
+			return nil, err
+		}
+		for _, n := range neighs {
+			if n.IP.Equal(ip) && n.HardwareAddr != nil && n.State&(netlink.NUD_REACHABLE|netlink.NUD_STALE|netlink.NUD_PERMANENT|netlink.NUD_DELAY|netlink.NUD_PROBE) != 0 {
+				return n.HardwareAddr, nil
+			}
+		}
+		if try == 0 {
+			// Anything will do; the discard port is polite.
+			if c, err := net.DialUDP("udp4", nil, &net.UDPAddr{IP: ip, Port: 9}); err == nil {
+				c.Write(nil)
+				c.Close()
+			}
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return nil, fmt.Errorf("netconsole: cannot resolve MAC address of %v on %s", ip, link.Attrs().Name)
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconsole
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/insomniacslk/dhcp/dhcpv4"
+)
+
+func lease(opts ...dhcpv4.Modifier) *dhcpv4.DHCPv4 {
+	m, err := dhcpv4.New(append([]dhcpv4.Modifier{
+		dhcpv4.WithYourIP(net.IPv4(192, 168, 1, 20)),
+		dhcpv4.WithNetmask(net.CIDRMask(24, 32)),
+		dhcpv4.WithRouter(net.IPv4(192, 168, 1, 1)),
+	}, opts...)...)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func TestTarget4(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		m       *dhcpv4.DHCPv4
+		remote  *net.UDPAddr
+		wantIP  net.IP
+		wantHop net.IP
+		wantErr bool
+	}{
+		{
+			name:    "on link",
+			m:       lease(),
+			remote:  &net.UDPAddr{IP: net.IPv4(192, 168, 1, 5), Port: 514},
+			wantIP:  net.IPv4(192, 168, 1, 5),
+			wantHop: net.IPv4(192, 168, 1, 5),
+		},
+		{
+			name:    "routed",
+			m:       lease(),
+			remote:  &net.UDPAddr{IP: net.IPv4(10, 0, 0, 5), Port: 514},
+			wantIP:  net.IPv4(10, 0, 0, 5),
+			wantHop: net.IPv4(192, 168, 1, 1),
+		},
+		{
+			name:    "log server",
+			m:       lease(dhcpv4.WithOption(dhcpv4.OptGeneric(dhcpv4.OptionLogServer, net.IPv4(192, 168, 1, 7).To4()))),
+			wantIP:  net.IPv4(192, 168, 1, 7).To4(),
+			wantHop: net.IPv4(192, 168, 1, 7).To4(),
+		},
+		{
+			name:    "no receiver",
+			m:       lease(),
+			wantErr: true,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			tgt, hop, err := target4("eth0", tt.m, tt.remote)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("target4 = %v, want error %t", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if !tgt.RemoteIP.Equal(tt.wantIP) || !hop.Equal(tt.wantHop) {
+				t.Errorf("target4 = %v via %v, want %v via %v", tgt.RemoteIP, hop, tt.wantIP, tt.wantHop)
+			}
+			if tgt.Dev != "eth0" || !tgt.LocalIP.Equal(net.IPv4(192, 168, 1, 20)) {
+				t.Errorf("target4 = %v, want eth0 and 192.168.1.20", tgt)
+			}
+		})
+	}
+}
+
+func TestConfigureDynamic(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netconsole")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(old string) { configfsDir = old }(configfsDir)
+	configfsDir = dir
+
+	tgt := &Target{
+		Dev:       "eth0",
+		LocalIP:   net.IPv4(192, 168, 1, 20),
+		RemoteIP:  net.IPv4(192, 168, 1, 5),
+		RemoteMAC: mustMAC("12:34:56:78:9a:bc"),
+	}
+	if err := configureDynamic("uroot", tgt); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"dev_name":    "eth0",
+		"local_ip":    "192.168.1.20",
+		"remote_ip":   "192.168.1.5",
+		"remote_port": "6666",
+		"remote_mac":  "12:34:56:78:9a:bc",
+		"enabled":     "1",
+	}
+	got := make(map[string]string)
+	fis, err := ioutil.ReadDir(filepath.Join(dir, "uroot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range fis {
+		b, err := ioutil.ReadFile(filepath.Join(dir, "uroot", fi.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got[fi.Name()] = string(b)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("configfs = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,73 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netconsole
+
+import (
+	"net"
+	"reflect"
+	"testing"
+)
+
+func mustMAC(s string) net.HardwareAddr {
+	m, err := net.ParseMAC(s)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want []*Target
+	}{
+		{
+			in: "4444@10.0.0.1/eth1,9353@10.0.0.2/12:34:56:78:9a:bc",
+			want: []*Target{{
+				LocalPort: 4444, LocalIP: net.ParseIP("10.0.0.1"), Dev: "eth1",
+				RemotePort: 9353, RemoteIP: net.ParseIP("10.0.0.2"), RemoteMAC: mustMAC("12:34:56:78:9a:bc"),
+			}},
+		},
+		{
+			in:   "@/,@10.0.0.2/",
+			want: []*Target{{RemoteIP: net.ParseIP("10.0.0.2")}},
+		},
+		{
+			in: "+@/eth0,@fd00::1/;@/eth1,6000@10.0.0.3/",
+			want: []*Target{
+				{Extended: true, Dev: "eth0", RemoteIP: net.ParseIP("fd00::1")},
+				{Dev: "eth1", RemotePort: 6000, RemoteIP: net.ParseIP("10.0.0.3")},
+			},
+		},
+	} {
+		got, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q) = %v", tt.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Parse(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+		if len(got) == 1 && got[0].String() != tt.in {
+			t.Errorf("Parse(%q).String() = %q", tt.in, got[0].String())
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"@/eth0",
+		"@/eth0,@/",
+		"x@/eth0,@10.0.0.2/",
+		"@/eth0,@10.0.0.256/",
+		"@/eth0,@10.0.0.2/zz",
+		"eth0,@10.0.0.2/",
+	} {
+		if _, err := Parse(in); err == nil {
+			t.Errorf("Parse(%q) = nil error, want error", in)
+		}
+	}
+}
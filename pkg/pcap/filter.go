@@ -0,0 +1,406 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/bpf"
+)
+
+// Compile compiles a filter expression for Ethernet frames to a BPF
+// program that accepts up to snaplen bytes of matching packets.
+//
+// The expression is a subset of tcpdump's:
+//
+//     expr:      expr or expr | expr and expr | not expr | ( expr )
+//     primitive: arp | ip | ip6 | tcp | udp | icmp | icmp6
+//                [src|dst] host ADDR
+//                [src|dst] net CIDR
+//                [tcp|udp] [src|dst] port N
+//
+// "&&", "||" and "!" may be used for and, or and not. Like in tcpdump, and
+// binds tighter than or. IPv6 extension headers are not followed.
+func Compile(expr string, snaplen int) ([]bpf.Instruction, error) {
+	p := &parser{toks: tokenize(expr)}
+	if len(p.toks) == 0 {
+		return []bpf.Instruction{bpf.RetConstant{Val: uint32(snaplen)}}, nil
+	}
+	n, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if len(p.toks) > 0 {
+		return nil, fmt.Errorf("filter: unexpected %q", p.toks[0])
+	}
+
+	var g gen
+	accept, reject := g.label(), g.label()
+	g.node(n, accept, reject)
+	g.place(accept)
+	g.emit(bpf.RetConstant{Val: uint32(snaplen)})
+	g.place(reject)
+	g.emit(bpf.RetConstant{Val: 0})
+	return g.resolve()
+}
+
+func tokenize(s string) []string {
+	for _, op := range []string{"(", ")", "&&", "||"} {
+		s = strings.Replace(s, op, " "+op+" ", -1)
+	}
+	// "!" only stands alone; "!=" is not supported anyway.
+	s = strings.Replace(s, "!", " ! ", -1)
+	return strings.Fields(s)
+}
+
+// node is a boolean expression over packet contents.
+type node interface{}
+
+type andNode struct{ a, b node }
+type orNode struct{ a, b node }
+type notNode struct{ a node }
+
+// test loads a value into A with loads and compares it to val.
+type test struct {
+	loads []bpf.Instruction
+	cond  bpf.JumpTest
+	val   uint32
+}
+
+func and(a node, b ...node) node {
+	for _, n := range b {
+		a = andNode{a, n}
+	}
+	return a
+}
+
+func or(a node, b ...node) node {
+	for _, n := range b {
+		a = orNode{a, n}
+	}
+	return a
+}
+
+func loadEq(off uint32, size int, val uint32) node {
+	return test{[]bpf.Instruction{bpf.LoadAbsolute{Off: off, Size: size}}, bpf.JumpEqual, val}
+}
+
+// Ethernet types and IP protocols.
+const (
+	etherTypeIPv4 = 0x0800
+	etherTypeARP  = 0x0806
+	etherTypeIPv6 = 0x86dd
+
+	protoICMP  = 1
+	protoTCP   = 6
+	protoUDP   = 17
+	protoICMP6 = 58
+)
+
+func etherType(t uint32) node { return loadEq(12, 2, t) }
+
+// ipProto matches IPv4 or IPv6 packets of the given protocol.
+func ipProto(v4, v6 bool, p uint32) node {
+	var n []node
+	if v4 {
+		n = append(n, and(etherType(etherTypeIPv4), loadEq(23, 1, p)))
+	}
+	if v6 {
+		n = append(n, and(etherType(etherTypeIPv6), loadEq(20, 1, p)))
+	}
+	return or(n[0], n[1:]...)
+}
+
+// dirNode matches either the source or destination, or both, as dir says.
+func dirNode(dir string, src, dst node) node {
+	switch dir {
+	case "src":
+		return src
+	case "dst":
+		return dst
+	}
+	return or(src, dst)
+}
+
+func hostNode(dir, addr string) (node, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, fmt.Errorf("filter: invalid host %q", addr)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		v := binary.BigEndian.Uint32(ip4)
+		return and(etherType(etherTypeIPv4), dirNode(dir, loadEq(26, 4, v), loadEq(30, 4, v))), nil
+	}
+	words := func(off uint32) node {
+		var n []node
+		for i := uint32(0); i < 4; i++ {
+			n = append(n, loadEq(off+4*i, 4, binary.BigEndian.Uint32(ip[4*i:])))
+		}
+		return and(n[0], n[1:]...)
+	}
+	return and(etherType(etherTypeIPv6), dirNode(dir, words(22), words(38))), nil
+}
+
+func netNode(dir, cidr string) (node, error) {
+	_, n, err := net.ParseCIDR(cidr)
+	if err != nil || n.IP.To4() == nil {
+		return nil, fmt.Errorf("filter: invalid IPv4 net %q", cidr)
+	}
+	mask := binary.BigEndian.Uint32(n.Mask)
+	v := binary.BigEndian.Uint32(n.IP.To4())
+	masked := func(off uint32) node {
+		return test{[]bpf.Instruction{
+			bpf.LoadAbsolute{Off: off, Size: 4},
+			bpf.ALUOpConstant{Op: bpf.ALUOpAnd, Val: mask},
+		}, bpf.JumpEqual, v}
+	}
+	return and(etherType(etherTypeIPv4), dirNode(dir, masked(26), masked(30))), nil
+}
+
+func portNode(protos []uint32, dir, port string) (node, error) {
+	n, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("filter: invalid port %q", port)
+	}
+	p := uint32(n)
+
+	var in4, in6 []node
+	for _, proto := range protos {
+		in4 = append(in4, loadEq(23, 1, proto))
+		in6 = append(in6, loadEq(20, 1, proto))
+	}
+	// IPv4 ports are after a variable length header, and only in the
+	// first fragment.
+	port4 := func(off uint32) node {
+		return test{[]bpf.Instruction{
+			bpf.LoadMemShift{Off: 14},
+			bpf.LoadIndirect{Off: 14 + off, Size: 2},
+		}, bpf.JumpEqual, p}
+	}
+	notFragment := notNode{test{[]bpf.Instruction{bpf.LoadAbsolute{Off: 20, Size: 2}}, bpf.JumpBitsSet, 0x1fff}}
+	v4 := and(etherType(etherTypeIPv4), or(in4[0], in4[1:]...), notFragment, dirNode(dir, port4(0), port4(2)))
+	v6 := and(etherType(etherTypeIPv6), or(in6[0], in6[1:]...), dirNode(dir, loadEq(54, 2, p), loadEq(56, 2, p)))
+	return or(v4, v6), nil
+}
+
+type parser struct {
+	toks []string
+}
+
+func (p *parser) peek() string {
+	if len(p.toks) == 0 {
+		return ""
+	}
+	return p.toks[0]
+}
+
+func (p *parser) next() string {
+	t := p.peek()
+	if len(p.toks) > 0 {
+		p.toks = p.toks[1:]
+	}
+	return t
+}
+
+func (p *parser) expr() (node, error) {
+	n, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t == "or" || t == "||"; t = p.peek() {
+		p.next()
+		m, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		n = orNode{n, m}
+	}
+	return n, nil
+}
+
+func (p *parser) term() (node, error) {
+	n, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t == "and" || t == "&&"; t = p.peek() {
+		p.next()
+		m, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		n = andNode{n, m}
+	}
+	return n, nil
+}
+
+func (p *parser) factor() (node, error) {
+	switch t := p.next(); t {
+	case "not", "!":
+		n, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+	case "(":
+		n, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("filter: missing )")
+		}
+		return n, nil
+	case "":
+		return nil, fmt.Errorf("filter: unexpected end of expression")
+	default:
+		return p.primitive(t)
+	}
+}
+
+func (p *parser) primitive(t string) (node, error) {
+	protos := []uint32{protoTCP, protoUDP}
+	switch t {
+	case "arp":
+		return etherType(etherTypeARP), nil
+	case "ip":
+		return etherType(etherTypeIPv4), nil
+	case "ip6":
+		return etherType(etherTypeIPv6), nil
+	case "icmp":
+		return ipProto(true, false, protoICMP), nil
+	case "icmp6":
+		return ipProto(false, true, protoICMP6), nil
+	case "tcp", "udp":
+		protos = []uint32{protoTCP}
+		if t == "udp" {
+			protos = []uint32{protoUDP}
+		}
+		switch p.peek() {
+		case "port", "src", "dst":
+			t = p.next()
+		default:
+			return ipProto(true, true, protos[0]), nil
+		}
+	}
+
+	var dir string
+	if t == "src" || t == "dst" {
+		dir, t = t, p.next()
+	}
+	arg := p.next()
+	if len(arg) == 0 {
+		return nil, fmt.Errorf("filter: %s needs an argument", t)
+	}
+	switch t {
+	case "host":
+		return hostNode(dir, arg)
+	case "net":
+		return netNode(dir, arg)
+	case "port":
+		return portNode(protos, dir, arg)
+	}
+	return nil, fmt.Errorf("filter: unknown primitive %q", t)
+}
+
+// gen generates code with symbolic jump targets.
+type gen struct {
+	insns  []insn
+	labels int
+}
+
+type insn struct {
+	bpf.Instruction
+
+	// jump is set for conditional jumps to labels t and f.
+	jump bool
+	cond bpf.JumpTest
+	val  uint32
+	t, f int
+
+	// label is set for label markers, which take no space.
+	label int
+}
+
+func (g *gen) label() int {
+	g.labels++
+	return g.labels
+}
+
+func (g *gen) place(l int) {
+	g.insns = append(g.insns, insn{label: l})
+}
+
+func (g *gen) emit(i bpf.Instruction) {
+	g.insns = append(g.insns, insn{Instruction: i})
+}
+
+// node generates code for n that goes to label t if it is true and to f
+// otherwise.
+func (g *gen) node(n node, t, f int) {
+	switch n := n.(type) {
+	case andNode:
+		mid := g.label()
+		g.node(n.a, mid, f)
+		g.place(mid)
+		g.node(n.b, t, f)
+	case orNode:
+		mid := g.label()
+		g.node(n.a, t, mid)
+		g.place(mid)
+		g.node(n.b, t, f)
+	case notNode:
+		g.node(n.a, f, t)
+	case test:
+		for _, l := range n.loads {
+			g.emit(l)
+		}
+		g.insns = append(g.insns, insn{jump: true, cond: n.cond, val: n.val, t: t, f: f})
+	}
+}
+
+// resolve turns labels into relative jumps.
+func (g *gen) resolve() ([]bpf.Instruction, error) {
+	pos := make(map[int]int)
+	var n int
+	for _, i := range g.insns {
+		if i.label > 0 {
+			pos[i.label] = n
+		} else {
+			n++
+		}
+	}
+
+	var prog []bpf.Instruction
+	for _, i := range g.insns {
+		switch {
+		case i.label > 0:
+		case i.jump:
+			skip := func(l int) (uint8, error) {
+				s := pos[l] - len(prog) - 1
+				if s > 255 {
+					return 0, fmt.Errorf("filter: expression too long")
+				}
+				return uint8(s), nil
+			}
+			st, err := skip(i.t)
+			if err != nil {
+				return nil, err
+			}
+			sf, err := skip(i.f)
+			if err != nil {
+				return nil, err
+			}
+			prog = append(prog, bpf.JumpIf{Cond: i.cond, Val: i.val, SkipTrue: st, SkipFalse: sf})
+		default:
+			prog = append(prog, i.Instruction)
+		}
+	}
+	return prog, nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package pcap writes packet captures in the pcap and pcapng file formats
+// and compiles a subset of tcpdump's filter language to BPF.
+package pcap
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// LinkTypeEthernet is the link type of Ethernet captures.
+const LinkTypeEthernet = 1
+
+// Writer writes packets to a capture file.
+type Writer interface {
+	// WritePacket writes a packet captured at t. length is the packet's
+	// length on the wire, which may be more than len(data).
+	WritePacket(t time.Time, data []byte, length int) error
+}
+
+// pcapWriter writes the classic pcap format.
+type pcapWriter struct {
+	w io.Writer
+}
+
+// NewWriter writes a pcap file header to w and returns a Writer for it.
+// Packets are stored with microsecond timestamps.
+func NewWriter(w io.Writer, snaplen int, linkType uint32) (Writer, error) {
+	hdr := struct {
+		Magic        uint32
+		Major, Minor uint16
+		ThisZone     int32
+		SigFigs      uint32
+		SnapLen      uint32
+		LinkType     uint32
+	}{0xa1b2c3d4, 2, 4, 0, 0, uint32(snaplen), linkType}
+	if err := binary.Write(w, binary.LittleEndian, &hdr); err != nil {
+		return nil, err
+	}
+	return &pcapWriter{w: w}, nil
+}
+
+// WritePacket implements Writer.WritePacket.
+func (p *pcapWriter) WritePacket(t time.Time, data []byte, length int) error {
+	rec := struct {
+		Sec, Usec        uint32
+		InclLen, OrigLen uint32
+	}{uint32(t.Unix()), uint32(t.Nanosecond() / 1000), uint32(len(data)), uint32(length)}
+	if err := binary.Write(p.w, binary.LittleEndian, &rec); err != nil {
+		return err
+	}
+	_, err := p.w.Write(data)
+	return err
+}
+
+// pcapng block types.
+const (
+	blockSectionHeader    = 0x0a0d0d0a
+	blockInterface        = 0x00000001
+	blockEnhancedPacket   = 0x00000006
+	optEndOfOpt           = 0
+	optInterfaceName      = 2
+	byteOrderMagic        = 0x1a2b3c4d
+	defaultTimestampUnits = time.Microsecond
+)
+
+// ngWriter writes pcapng.
+type ngWriter struct {
+	w io.Writer
+}
+
+// NewNGWriter writes a pcapng section header and a description of the
+// interface ifName to w, and returns a Writer for packets captured on it.
+// Timestamps have the format's default resolution of microseconds.
+func NewNGWriter(w io.Writer, ifName string, snaplen int, linkType uint16) (Writer, error) {
+	n := &ngWriter{w: w}
+	// Section header: byte order magic, version 1.0, unknown section
+	// length.
+	shb := make([]byte, 16)
+	binary.LittleEndian.PutUint32(shb[0:], byteOrderMagic)
+	binary.LittleEndian.PutUint16(shb[4:], 1)
+	binary.LittleEndian.PutUint16(shb[6:], 0)
+	binary.LittleEndian.PutUint64(shb[8:], ^uint64(0))
+	if err := n.block(blockSectionHeader, shb); err != nil {
+		return nil, err
+	}
+
+	idb := make([]byte, 8)
+	binary.LittleEndian.PutUint16(idb[0:], linkType)
+	binary.LittleEndian.PutUint32(idb[4:], uint32(snaplen))
+	if len(ifName) > 0 {
+		idb = appendOption(idb, optInterfaceName, []byte(ifName))
+		idb = appendOption(idb, optEndOfOpt, nil)
+	}
+	if err := n.block(blockInterface, idb); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// pad4 pads b to a multiple of 4 bytes.
+func pad4(b []byte) []byte {
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func appendOption(b []byte, code uint16, value []byte) []byte {
+	var h [4]byte
+	binary.LittleEndian.PutUint16(h[0:], code)
+	binary.LittleEndian.PutUint16(h[2:], uint16(len(value)))
+	return pad4(append(append(b, h[:]...), value...))
+}
+
+// block writes a block with the given body, which it pads.
+func (n *ngWriter) block(typ uint32, body []byte) error {
+	body = pad4(body)
+	total := uint32(12 + len(body))
+	b := make([]byte, 0, total)
+	b = append(b, 0, 0, 0, 0, 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(b[0:], typ)
+	binary.LittleEndian.PutUint32(b[4:], total)
+	b = append(b, body...)
+	var trailer [4]byte
+	binary.LittleEndian.PutUint32(trailer[:], total)
+	b = append(b, trailer[:]...)
+	_, err := n.w.Write(b)
+	return err
+}
+
+// WritePacket implements Writer.WritePacket.
+func (n *ngWriter) WritePacket(t time.Time, data []byte, length int) error {
+	ts := uint64(t.UnixNano() / int64(defaultTimestampUnits))
+	epb := make([]byte, 20, 20+len(data)+3)
+	// Interface 0 is the only one.
+	binary.LittleEndian.PutUint32(epb[0:], 0)
+	binary.LittleEndian.PutUint32(epb[4:], uint32(ts>>32))
+	binary.LittleEndian.PutUint32(epb[8:], uint32(ts))
+	binary.LittleEndian.PutUint32(epb[12:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(epb[16:], uint32(length))
+	return n.block(blockEnhancedPacket, append(epb, data...))
+}
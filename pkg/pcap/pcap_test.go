@@ -0,0 +1,150 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/bpf"
+)
+
+// frame builds an Ethernet frame around an IPv4 or IPv6 packet with the
+// given protocol and ports.
+func frame(src, dst string, proto byte, sport, dport uint16) []byte {
+	b := make([]byte, 14)
+	s, d := net.ParseIP(src), net.ParseIP(dst)
+	if s4 := s.To4(); s4 != nil {
+		binary.BigEndian.PutUint16(b[12:], etherTypeIPv4)
+		ip := make([]byte, 24) // IHL 6: one word of options.
+		ip[0] = 0x46
+		ip[9] = proto
+		copy(ip[12:], s4)
+		copy(ip[16:], d.To4())
+		b = append(b, ip...)
+	} else {
+		binary.BigEndian.PutUint16(b[12:], etherTypeIPv6)
+		ip := make([]byte, 40)
+		ip[0] = 0x60
+		ip[6] = proto
+		copy(ip[8:], s)
+		copy(ip[24:], d)
+		b = append(b, ip...)
+	}
+	l4 := make([]byte, 20)
+	binary.BigEndian.PutUint16(l4[0:], sport)
+	binary.BigEndian.PutUint16(l4[2:], dport)
+	return append(b, l4...)
+}
+
+func TestCompile(t *testing.T) {
+	arp := make([]byte, 42)
+	binary.BigEndian.PutUint16(arp[12:], etherTypeARP)
+
+	dhcp := frame("0.0.0.0", "255.255.255.255", protoUDP, 68, 67)
+	http4 := frame("10.0.0.2", "10.0.0.1", protoTCP, 40000, 80)
+	http6 := frame("2001:db8::2", "2001:db8::1", protoTCP, 40000, 80)
+	dns6 := frame("2001:db8::2", "2001:db8::53", protoUDP, 5353, 53)
+	fragment := frame("10.0.0.2", "10.0.0.1", protoTCP, 40000, 80)
+	fragment[14+6] = 0x01 // Fragment offset 256.
+
+	for _, tt := range []struct {
+		filter string
+		pkt    []byte
+		want   bool
+	}{
+		{"", arp, true},
+		{"arp", arp, true},
+		{"arp", dhcp, false},
+		{"udp port 67 or udp port 68", dhcp, true},
+		{"port 67 and not arp", dhcp, true},
+		{"tcp port 67", dhcp, false},
+		{"dst port 80", http4, true},
+		{"src port 80", http4, false},
+		{"tcp and dst port 80", http6, true},
+		{"port 80", fragment, false},
+		{"host 10.0.0.1", http4, true},
+		{"src host 10.0.0.1", http4, false},
+		{"net 10.0.0.0/8 && tcp", http4, true},
+		{"dst net 192.168.0.0/16", http4, false},
+		{"host 2001:db8::53 and udp port 53", dns6, true},
+		{"ip6 and !(tcp || icmp6)", dns6, true},
+		{"ip6 and !(tcp || icmp6)", http6, false},
+		{"ip and (arp or udp)", dhcp, true},
+	} {
+		prog, err := Compile(tt.filter, 65535)
+		if err != nil {
+			t.Errorf("Compile(%q) = %v", tt.filter, err)
+			continue
+		}
+		vm, err := bpf.NewVM(prog)
+		if err != nil {
+			t.Errorf("Compile(%q) = invalid program %v: %v", tt.filter, prog, err)
+			continue
+		}
+		n, err := vm.Run(tt.pkt)
+		if err != nil {
+			t.Errorf("filter %q: %v", tt.filter, err)
+			continue
+		}
+		if got := n > 0; got != tt.want {
+			t.Errorf("filter %q matched = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{"port", "port http", "host nope", "(tcp", "tcp and", "foo", "net 10.0.0.1"} {
+		if _, err := Compile(bad, 65535); err == nil {
+			t.Errorf("Compile(%q) succeeded, want error", bad)
+		}
+	}
+}
+
+func TestWriters(t *testing.T) {
+	ts := time.Unix(1500000000, 123456000)
+	pkt := []byte{1, 2, 3, 4, 5}
+
+	var b bytes.Buffer
+	w, err := NewWriter(&b, 65535, LinkTypeEthernet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WritePacket(ts, pkt, 60); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{
+		0xd4, 0xc3, 0xb2, 0xa1, 2, 0, 4, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0, 0, 1, 0, 0, 0,
+		0x00, 0x2f, 0x68, 0x59, 0x40, 0xe2, 0x01, 0x00, 5, 0, 0, 0, 60, 0, 0, 0,
+		1, 2, 3, 4, 5,
+	}
+	if !bytes.Equal(b.Bytes(), want) {
+		t.Errorf("pcap = % x, want % x", b.Bytes(), want)
+	}
+
+	b.Reset()
+	w, err = NewNGWriter(&b, "eth0", 65535, LinkTypeEthernet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WritePacket(ts, pkt, 60); err != nil {
+		t.Fatal(err)
+	}
+	// Walk the blocks: each has matching leading and trailing lengths.
+	var types []uint32
+	for r := b.Bytes(); len(r) > 0; {
+		typ := binary.LittleEndian.Uint32(r)
+		n := binary.LittleEndian.Uint32(r[4:])
+		if n%4 != 0 || int(n) > len(r) || binary.LittleEndian.Uint32(r[n-4:]) != n {
+			t.Fatalf("bad block of type %#x, length %d", typ, n)
+		}
+		types = append(types, typ)
+		r = r[n:]
+	}
+	if len(types) != 3 || types[0] != blockSectionHeader || types[1] != blockInterface || types[2] != blockEnhancedPacket {
+		t.Errorf("block types = %#x", types)
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pci
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// driversPath is where PCI drivers are, to bind devices to.
+var driversPath = "/sys/bus/pci/drivers"
+
+// driversProbe has the kernel bind a device to the driver it picks.
+func driversProbe() string {
+	return filepath.Join(filepath.Dir(driversPath), "drivers_probe")
+}
+
+// Driver returns the name of the driver p is bound to, or "" if none is.
+func (p *PCI) Driver() (string, error) {
+	dir, err := os.Readlink(filepath.Join(p.FullPath, "driver"))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(dir), nil
+}
+
+// Unbind unbinds p from its driver, if it has one.
+func (p *PCI) Unbind() error {
+	drv, err := p.Driver()
+	if err != nil || drv == "" {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(p.FullPath, "driver", "unbind"), []byte(p.Addr), 0)
+}
+
+// Bind binds p to driver, which must support the device. p must not be
+// bound to a driver yet. Use BindTo for drivers that do not know the
+// device's IDs.
+func (p *PCI) Bind(driver string) error {
+	if err := ioutil.WriteFile(filepath.Join(driversPath, driver, "bind"), []byte(p.Addr), 0); err != nil {
+		return fmt.Errorf("binding %s to %s: %v", p.Addr, driver, err)
+	}
+	return nil
+}
+
+// SetDriverOverride makes driver the only one that binds to p from now on,
+// or lifts the override if driver is "". It does not rebind p.
+func (p *PCI) SetDriverOverride(driver string) error {
+	// An empty write is no write at all; a newline clears it.
+	return ioutil.WriteFile(filepath.Join(p.FullPath, "driver_override"), []byte(driver+"\n"), 0)
+}
+
+// Probe has the kernel bind p to the driver it picks, if it is not bound.
+func (p *PCI) Probe() error {
+	return ioutil.WriteFile(driversProbe(), []byte(p.Addr), 0)
+}
+
+// BindTo rebinds p to driver, even one that does not know the device's IDs
+// such as vfio-pci, by overriding the driver and probing it. The override
+// stays until ResetDriver.
+func (p *PCI) BindTo(driver string) error {
+	if drv, err := p.Driver(); err != nil || drv == driver {
+		return err
+	}
+	if err := p.SetDriverOverride(driver); err != nil {
+		return err
+	}
+	if err := p.Unbind(); err != nil {
+		return err
+	}
+	if err := p.Probe(); err != nil {
+		return err
+	}
+	drv, err := p.Driver()
+	if err != nil {
+		return err
+	}
+	if drv != driver {
+		return fmt.Errorf("%s did not bind to %s; is it loaded?", p.Addr, driver)
+	}
+	return nil
+}
+
+// ResetDriver lifts the driver override of p and rebinds it to the driver
+// the kernel picks.
+func (p *PCI) ResetDriver() error {
+	if err := p.SetDriverOverride(""); err != nil {
+		return err
+	}
+	if err := p.Unbind(); err != nil {
+		return err
+	}
+	return p.Probe()
+}
+
+// dynamicID formats vendor and device IDs, in hex, as new_id and
+// remove_id take them.
+func dynamicID(vendor, device string) ([]byte, error) {
+	for _, id := range []string{vendor, device} {
+		if _, err := strconv.ParseUint(id, 16, 16); err != nil {
+			return nil, fmt.Errorf("PCI ID %q is not a 16-bit hex number", id)
+		}
+	}
+	return []byte(vendor + " " + device), nil
+}
+
+// AddDynamicID makes driver bind to the devices with vendor and device
+// IDs, in hex, as well as those it knows. The kernel binds unbound devices
+// with the IDs at once.
+func AddDynamicID(driver, vendor, device string) error {
+	id, err := dynamicID(vendor, device)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(driversPath, driver, "new_id"), id, 0)
+}
+
+// RemoveDynamicID removes an ID added by AddDynamicID. Devices bound with
+// it stay bound.
+func RemoveDynamicID(driver, vendor, device string) error {
+	id, err := dynamicID(vendor, device)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(driversPath, driver, "remove_id"), id, 0)
+}
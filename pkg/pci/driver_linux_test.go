@@ -0,0 +1,88 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pci
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDriver(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "pci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	fakeSysfs(t, tmp)
+	if err := os.MkdirAll(filepath.Join(tmp, "drivers/vfio-pci"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer func(p string) { driversPath = p }(driversPath)
+	driversPath = filepath.Join(tmp, "drivers")
+
+	read := func(name string) string {
+		b, err := ioutil.ReadFile(filepath.Join(tmp, name))
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	vf0, err := onePCI(filepath.Join(tmp, "devices/0000:01:02.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vf1, err := onePCI(filepath.Join(tmp, "devices/0000:01:02.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Bound already.
+	if err := vf0.BindTo("iavf"); err != nil {
+		t.Fatal(err)
+	}
+	if s := read("devices/0000:01:02.0/driver_override"); s != "" {
+		t.Errorf("BindTo the bound driver wrote override %q", s)
+	}
+
+	// The fake kernel binds nothing, so vfio-pci does not show up.
+	if err := vf0.BindTo("vfio-pci"); err == nil || !strings.Contains(err.Error(), "did not bind to vfio-pci") {
+		t.Errorf("BindTo(vfio-pci) = %v, want did not bind", err)
+	}
+	for file, want := range map[string]string{
+		"devices/0000:01:02.0/driver_override": "vfio-pci\n",
+		"drivers/iavf/unbind":                  "0000:01:02.0",
+		"drivers_probe":                        "0000:01:02.0",
+	} {
+		if got := read(file); got != want {
+			t.Errorf("BindTo(vfio-pci): %s = %q, want %q", file, got, want)
+		}
+	}
+
+	if err := vf1.ResetDriver(); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("devices/0000:01:02.1/driver_override"); got != "\n" {
+		t.Errorf("ResetDriver: driver_override = %q, want a newline", got)
+	}
+	if got := read("drivers_probe"); got != "0000:01:02.1" {
+		t.Errorf("ResetDriver: drivers_probe = %q", got)
+	}
+
+	if err := AddDynamicID("vfio-pci", "8086", "154c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveDynamicID("vfio-pci", "8086", "154c"); err != nil {
+		t.Fatal(err)
+	}
+	if got := read("drivers/vfio-pci/new_id") + "," + read("drivers/vfio-pci/remove_id"); got != "8086 154c,8086 154c" {
+		t.Errorf("new_id, remove_id = %q", got)
+	}
+	if err := AddDynamicID("vfio-pci", "0x8086", "154c"); err == nil {
+		t.Error("AddDynamicID(0x8086) did not fail")
+	}
+}
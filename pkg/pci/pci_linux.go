@@ -38,6 +38,8 @@ func onePCI(dir string) (*PCI, error) {
 		reflect.ValueOf(&pci).Elem().Field(ix).SetString(string(s[2 : len(s)-1]))
 	}
 	pci.VendorName, pci.DeviceName = pci.Vendor, pci.Device
+	pci.Addr = filepath.Base(dir)
+	pci.FullPath = dir
 	return &pci, nil
 }
 
@@ -50,8 +52,6 @@ func (bus *bus) Read() (Devices, error) {
 		if err != nil {
 			return nil, err
 		}
-		p.Addr = filepath.Base(d)
-		p.FullPath = d
 		devices[i] = p
 	}
 	return devices, nil
@@ -0,0 +1,135 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pci
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrNoSRIOV is returned for devices that are not SR-IOV physical
+// functions.
+var ErrNoSRIOV = errors.New("device is not SR-IOV capable")
+
+// SRIOV is the SR-IOV state of a physical function.
+type SRIOV struct {
+	// TotalVFs is how many virtual functions the device supports, and
+	// NumVFs how many are enabled.
+	TotalVFs int
+	NumVFs   int
+	// Offset and Stride place the routing IDs of the VFs relative to
+	// the physical function.
+	Offset int
+	Stride int
+	// VFDevice is the device ID of the VFs.
+	VFDevice string
+	// DriversAutoprobe has drivers bind to VFs as they are enabled.
+	DriversAutoprobe bool
+}
+
+func (s *SRIOV) String() string {
+	return fmt.Sprintf("SR-IOV: %d of %d VFs enabled, VF device %s, offset %d, stride %d", s.NumVFs, s.TotalVFs, s.VFDevice, s.Offset, s.Stride)
+}
+
+func (p *PCI) readAttr(name string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(p.FullPath, name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+func (p *PCI) readInt(name string) (int, error) {
+	s, err := p.readAttr(name)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(s)
+}
+
+// SRIOV returns the SR-IOV state of p, or ErrNoSRIOV if it has none.
+func (p *PCI) SRIOV() (*SRIOV, error) {
+	total, err := p.readInt("sriov_totalvfs")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNoSRIOV
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := &SRIOV{TotalVFs: total}
+	if s.NumVFs, err = p.readInt("sriov_numvfs"); err != nil {
+		return nil, err
+	}
+	// The rest came with Linux 4.x, so they may be missing.
+	s.Offset, _ = p.readInt("sriov_offset")
+	s.Stride, _ = p.readInt("sriov_stride")
+	if d, err := p.readAttr("sriov_vf_device"); err == nil {
+		s.VFDevice = d
+	}
+	if a, err := p.readInt("sriov_drivers_autoprobe"); err == nil {
+		s.DriversAutoprobe = a != 0
+	}
+	return s, nil
+}
+
+// SetNumVFs enables n virtual functions of p, or disables them all if n
+// is 0.
+func (p *PCI) SetNumVFs(n int) error {
+	s, err := p.SRIOV()
+	if err != nil {
+		return err
+	}
+	if n < 0 || n > s.TotalVFs {
+		return fmt.Errorf("%s: %d VFs is not within [0, %d]", p.Addr, n, s.TotalVFs)
+	}
+	if n == s.NumVFs {
+		return nil
+	}
+	name := filepath.Join(p.FullPath, "sriov_numvfs")
+	// Linux only changes the number of VFs from or to 0.
+	if s.NumVFs != 0 && n != 0 {
+		if err := ioutil.WriteFile(name, []byte("0"), 0); err != nil {
+			return err
+		}
+	}
+	return ioutil.WriteFile(name, []byte(strconv.Itoa(n)), 0)
+}
+
+// link reads the device that the symlink name of p points to.
+func (p *PCI) link(name string) (*PCI, error) {
+	dir, err := filepath.EvalSymlinks(filepath.Join(p.FullPath, name))
+	if err != nil {
+		return nil, err
+	}
+	return onePCI(dir)
+}
+
+// VFs returns the enabled virtual functions of p, in order.
+func (p *PCI) VFs() (Devices, error) {
+	s, err := p.SRIOV()
+	if err != nil {
+		return nil, err
+	}
+	var d Devices
+	for k := 0; k < s.NumVFs; k++ {
+		vf, err := p.link(fmt.Sprintf("virtfn%d", k))
+		if err != nil {
+			return nil, err
+		}
+		d = append(d, vf)
+	}
+	return d, nil
+}
+
+// PhysFn returns the physical function of p if p is a virtual function, or
+// an error wrapping os.ErrNotExist if it is not.
+func (p *PCI) PhysFn() (*PCI, error) {
+	return p.link("physfn")
+}
@@ -0,0 +1,125 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package pci
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fakeSysfs builds a PCI devices directory with a physical function that
+// has two of four VFs enabled, the first bound to iavf.
+func fakeSysfs(t *testing.T, tmp string) {
+	files := map[string]string{
+		"devices/0000:01:00.0/vendor":          "0x8086\n",
+		"devices/0000:01:00.0/device":          "0x1572\n",
+		"devices/0000:01:00.0/sriov_totalvfs":  "4\n",
+		"devices/0000:01:00.0/sriov_numvfs":    "2\n",
+		"devices/0000:01:00.0/sriov_offset":    "16\n",
+		"devices/0000:01:00.0/sriov_stride":    "1\n",
+		"devices/0000:01:00.0/sriov_vf_device": "154c\n",
+		"devices/0000:01:02.0/vendor":          "0x8086\n",
+		"devices/0000:01:02.0/device":          "0x154c\n",
+		"devices/0000:01:02.1/vendor":          "0x8086\n",
+		"devices/0000:01:02.1/device":          "0x154c\n",
+		"drivers/iavf/bind":                    "",
+		"drivers/iavf/unbind":                  "",
+	}
+	for name, data := range files {
+		name = filepath.Join(tmp, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"devices/0000:01:00.0/virtfn0": "../0000:01:02.0",
+		"devices/0000:01:00.0/virtfn1": "../0000:01:02.1",
+		"devices/0000:01:02.0/physfn":  "../0000:01:00.0",
+		"devices/0000:01:02.1/physfn":  "../0000:01:00.0",
+		"devices/0000:01:02.0/driver":  "../../drivers/iavf",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(tmp, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSRIOV(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "pci")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	fakeSysfs(t, tmp)
+	defer func(p string) { driversPath = p }(driversPath)
+	driversPath = filepath.Join(tmp, "drivers")
+
+	pf, err := onePCI(filepath.Join(tmp, "devices/0000:01:00.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := pf.SRIOV()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &SRIOV{TotalVFs: 4, NumVFs: 2, Offset: 16, Stride: 1, VFDevice: "154c"}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("SRIOV = %+v, want %+v", s, want)
+	}
+
+	vfs, err := pf.VFs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(vfs) != 2 || vfs[0].Addr != "0000:01:02.0" || vfs[1].Addr != "0000:01:02.1" || vfs[1].Device != "154c" {
+		t.Fatalf("VFs = %v", vfs)
+	}
+	if p, err := vfs[1].PhysFn(); err != nil || p.Addr != pf.Addr {
+		t.Errorf("PhysFn = %v, %v, want %s", p, err, pf.Addr)
+	}
+	if _, err := pf.PhysFn(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("PhysFn of a PF = %v, want not exist", err)
+	}
+	if _, err := vfs[0].SRIOV(); err != ErrNoSRIOV {
+		t.Errorf("SRIOV of a VF = %v, want %v", err, ErrNoSRIOV)
+	}
+
+	if drv, err := vfs[0].Driver(); err != nil || drv != "iavf" {
+		t.Errorf("Driver = %q, %v, want iavf", drv, err)
+	}
+	if drv, err := vfs[1].Driver(); err != nil || drv != "" {
+		t.Errorf("Driver of an unbound VF = %q, %v, want none", drv, err)
+	}
+	for _, tt := range []struct {
+		f    func() error
+		file string
+		want string
+	}{
+		{vfs[0].Unbind, "drivers/iavf/unbind", "0000:01:02.0"},
+		{func() error { return vfs[1].Bind("iavf") }, "drivers/iavf/bind", "0000:01:02.1"},
+		{func() error { return pf.SetNumVFs(3) }, "devices/0000:01:00.0/sriov_numvfs", "3"},
+	} {
+		if err := tt.f(); err != nil {
+			t.Fatal(err)
+		}
+		if b, err := ioutil.ReadFile(filepath.Join(tmp, tt.file)); err != nil || string(b) != tt.want {
+			t.Errorf("%s = %q, %v, want %q", tt.file, b, err, tt.want)
+		}
+	}
+	if err := pf.SetNumVFs(5); err == nil {
+		t.Error("SetNumVFs(5) of 4 VFs did not fail")
+	}
+	if err := vfs[1].Bind("ixgbevf"); err == nil {
+		t.Error("Bind to a missing driver did not fail")
+	}
+}
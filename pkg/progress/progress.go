@@ -0,0 +1,221 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package progress reports how far long operations, such as downloads,
+// image writes and archive extraction, have got.
+//
+// A Meter counts the bytes of one operation and hands a Status to a
+// Reporter now and then. Reporters render it for a terminal, for a serial
+// console or log, or as JSON for a program driving the operation:
+//
+//	m := progress.New("download", size, progress.NewReporter(progress.Auto, os.Stderr))
+//	_, err := io.Copy(w, m.Reader(r))
+//	m.Finish(err)
+package progress
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Status is a snapshot of an operation.
+type Status struct {
+	Name string `json:"name"`
+
+	// Done bytes of Total are done. Total is 0 if unknown.
+	Done  int64 `json:"done"`
+	Total int64 `json:"total,omitempty"`
+
+	// Rate is in bytes per second since the start.
+	Rate    float64       `json:"rate"`
+	Elapsed time.Duration `json:"elapsed"`
+
+	// ETA is how much longer the operation should take, 0 if the total
+	// is unknown.
+	ETA time.Duration `json:"eta,omitempty"`
+
+	// Finished is set in the last status of an operation, and Err if it
+	// failed.
+	Finished bool   `json:"finished,omitempty"`
+	Err      string `json:"error,omitempty"`
+}
+
+// Fraction returns how much of the operation is done, from 0 to 1, or -1 if
+// the total is unknown.
+func (s Status) Fraction() float64 {
+	if s.Total <= 0 {
+		return -1
+	}
+	if s.Done >= s.Total {
+		return 1
+	}
+	return float64(s.Done) / float64(s.Total)
+}
+
+// Reporter is told how an operation is going.
+type Reporter interface {
+	Report(s Status)
+}
+
+// DefaultInterval is how often a Meter reports by default.
+const DefaultInterval = 500 * time.Millisecond
+
+// Meter counts the bytes done of an operation. It is safe for concurrent
+// use, so several workers can share one.
+type Meter struct {
+	// Interval is the least time between reports, other than the last.
+	Interval time.Duration
+
+	name string
+	r    Reporter
+	now  func() time.Time
+
+	mu       sync.Mutex
+	done     int64
+	total    int64
+	start    time.Time
+	last     time.Time
+	finished bool
+}
+
+// New returns a meter for an operation of total bytes, 0 if unknown, that
+// reports to r. A nil r reports nowhere.
+func New(name string, total int64, r Reporter) *Meter {
+	m := &Meter{
+		Interval: DefaultInterval,
+		name:     name,
+		r:        r,
+		now:      time.Now,
+		total:    total,
+	}
+	m.start = m.now()
+	return m
+}
+
+// status returns the meter's status. m.mu must be held.
+func (m *Meter) status() Status {
+	s := Status{
+		Name:     m.name,
+		Done:     m.done,
+		Total:    m.total,
+		Elapsed:  m.now().Sub(m.start),
+		Finished: m.finished,
+	}
+	if secs := s.Elapsed.Seconds(); secs > 0 {
+		s.Rate = float64(s.Done) / secs
+	}
+	if s.Total > s.Done && s.Rate > 0 {
+		s.ETA = time.Duration(float64(s.Total-s.Done) / s.Rate * float64(time.Second))
+	}
+	return s
+}
+
+// Status returns how far the operation has got.
+func (m *Meter) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status()
+}
+
+// report reports the status if the interval has passed. m.mu must be held.
+func (m *Meter) report() {
+	if m.r == nil || m.finished {
+		return
+	}
+	if now := m.now(); now.Sub(m.last) >= m.Interval {
+		m.last = now
+		m.r.Report(m.status())
+	}
+}
+
+// Add adds n bytes done.
+func (m *Meter) Add(n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.done += n
+	m.report()
+}
+
+// Set sets the bytes done to n, for operations that count themselves.
+func (m *Meter) Set(n int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.done = n
+	m.report()
+}
+
+// SetTotal sets the size of the operation once it is known.
+func (m *Meter) SetTotal(total int64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.total = total
+}
+
+// Finish reports the final status, with err if the operation failed. Later
+// calls do nothing.
+func (m *Meter) Finish(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.finished {
+		return
+	}
+	m.finished = true
+	if m.r == nil {
+		return
+	}
+	s := m.status()
+	if err != nil {
+		s.Err = err.Error()
+	}
+	m.r.Report(s)
+}
+
+type reader struct {
+	r io.Reader
+	m *Meter
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.m.Add(int64(n))
+	return n, err
+}
+
+// Reader returns a reader that counts what is read from r.
+func (m *Meter) Reader(r io.Reader) io.Reader {
+	return &reader{r: r, m: m}
+}
+
+type readerAt struct {
+	r io.ReaderAt
+	m *Meter
+}
+
+func (r *readerAt) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.r.ReadAt(p, off)
+	r.m.Add(int64(n))
+	return n, err
+}
+
+// ReaderAt returns a ReaderAt that counts what is read from r.
+func (m *Meter) ReaderAt(r io.ReaderAt) io.ReaderAt {
+	return &readerAt{r: r, m: m}
+}
+
+type writer struct {
+	w io.Writer
+	m *Meter
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.m.Add(int64(n))
+	return n, err
+}
+
+// Writer returns a writer that counts what is written to w.
+func (m *Meter) Writer(w io.Writer) io.Writer {
+	return &writer{w: w, m: m}
+}
@@ -0,0 +1,133 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package progress
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recorder []Status
+
+func (r *recorder) Report(s Status) { *r = append(*r, s) }
+
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestMeter(total int64, r Reporter) (*Meter, *fakeClock) {
+	c := &fakeClock{t: time.Unix(1600000000, 0)}
+	m := New("copy", total, r)
+	m.now = c.now
+	m.start = c.t
+	m.Interval = time.Second
+	return m, c
+}
+
+func TestMeter(t *testing.T) {
+	var r recorder
+	m, c := newTestMeter(1000, &r)
+
+	c.t = c.t.Add(time.Second)
+	m.Add(100)
+	// Within the interval: counted but not reported.
+	c.t = c.t.Add(time.Second / 2)
+	m.Add(100)
+	c.t = c.t.Add(time.Second / 2)
+	m.Add(200)
+	m.Finish(nil)
+	m.Finish(errors.New("ignored"))
+
+	want := []Status{
+		{Name: "copy", Done: 100, Total: 1000, Rate: 100, Elapsed: time.Second, ETA: 9 * time.Second},
+		{Name: "copy", Done: 400, Total: 1000, Rate: 200, Elapsed: 2 * time.Second, ETA: 3 * time.Second},
+		{Name: "copy", Done: 400, Total: 1000, Rate: 200, Elapsed: 2 * time.Second, ETA: 3 * time.Second, Finished: true},
+	}
+	if len(r) != len(want) {
+		t.Fatalf("got %d reports %+v, want %d", len(r), r, len(want))
+	}
+	for i := range want {
+		if r[i] != want[i] {
+			t.Errorf("report %d = %+v, want %+v", i, r[i], want[i])
+		}
+	}
+}
+
+func TestMeterReader(t *testing.T) {
+	var r recorder
+	m, c := newTestMeter(0, &r)
+	c.t = c.t.Add(time.Second)
+	b, err := ioutil.ReadAll(m.Reader(strings.NewReader("hello world")))
+	if err != nil || string(b) != "hello world" {
+		t.Fatalf("ReadAll() = %q, %v", b, err)
+	}
+	m.Finish(errors.New("oops"))
+	s := r[len(r)-1]
+	if s.Done != 11 || s.Err != "oops" || s.ETA != 0 || s.Fraction() != -1 {
+		t.Errorf("last status = %+v", s)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for _, tt := range []struct {
+		n    int64
+		want string
+	}{
+		{0, "0 B"},
+		{1023, "1023 B"},
+		{1536, "1.5 KiB"},
+		{5 << 30, "5.0 GiB"},
+	} {
+		if got := FormatBytes(tt.n); got != tt.want {
+			t.Errorf("FormatBytes(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestReporters(t *testing.T) {
+	running := Status{Name: "write", Done: 512 << 20, Total: 1 << 30, Rate: 64 << 20, Elapsed: 8 * time.Second, ETA: 8 * time.Second}
+	done := Status{Name: "write", Done: 1 << 30, Total: 1 << 30, Rate: 64 << 20, Elapsed: 16 * time.Second, Finished: true}
+
+	var b bytes.Buffer
+	tty := NewTTYReporter(&b)
+	tty.Report(running)
+	tty.Report(done)
+	want := "\r[===============               ] write: 512.0 MiB of 1.0 GiB (50%), 64.0 MiB/s, 8s left" +
+		"\rwrite: 1.0 GiB of 1.0 GiB (100%), 64.0 MiB/s, done in 16s" + strings.Repeat(" ", 30) + "\n"
+	if b.String() != want {
+		t.Errorf("TTY reporter wrote\n%q, want\n%q", b.String(), want)
+	}
+
+	b.Reset()
+	lines := NewLineReporter(&b, 10*time.Second)
+	lines.Report(running)
+	running.Elapsed += time.Second
+	lines.Report(running)
+	lines.Report(done)
+	want = "write: 512.0 MiB of 1.0 GiB (50%), 64.0 MiB/s, 8s left\n" +
+		"write: 1.0 GiB of 1.0 GiB (100%), 64.0 MiB/s, done in 16s\n"
+	if b.String() != want {
+		t.Errorf("line reporter wrote\n%q, want\n%q", b.String(), want)
+	}
+
+	b.Reset()
+	NewJSONReporter(&b).Report(done)
+	var got Status
+	if err := json.Unmarshal(b.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != done {
+		t.Errorf("JSON reporter round trip = %+v, want %+v", got, done)
+	}
+
+	if _, err := NewReporter("fancy", nil); err == nil {
+		t.Errorf("NewReporter(fancy) = nil error, want error")
+	}
+}
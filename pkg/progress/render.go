@@ -0,0 +1,182 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+// Reporter modes for NewReporter.
+const (
+	// Auto is TTY on a terminal and Lines otherwise.
+	Auto  = "auto"
+	TTY   = "tty"
+	Lines = "lines"
+	JSON  = "json"
+	None  = "none"
+)
+
+// NewReporter returns a reporter writing to f in mode, one of the modes
+// above, or nil for None.
+func NewReporter(mode string, f *os.File) (Reporter, error) {
+	switch mode {
+	case Auto:
+		if isatty.IsTerminal(f.Fd()) {
+			return NewTTYReporter(f), nil
+		}
+		return NewLineReporter(f, LineInterval), nil
+	case TTY:
+		return NewTTYReporter(f), nil
+	case Lines:
+		return NewLineReporter(f, LineInterval), nil
+	case JSON:
+		return NewJSONReporter(f), nil
+	case None, "":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("progress mode %q is not one of auto, tty, lines, json or none", mode)
+}
+
+// FormatBytes formats n with binary units, e.g. "1.5 MiB".
+func FormatBytes(n int64) string {
+	const units = "KMGTPE"
+	if n < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	f := float64(n)
+	i := -1
+	for f >= 1024 && i < len(units)-1 {
+		f /= 1024
+		i++
+	}
+	return fmt.Sprintf("%.1f %ciB", f, units[i])
+}
+
+// formatDuration formats d to the second, e.g. "1h02m03s".
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Second)
+	h, m, s := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	switch {
+	case h > 0:
+		return fmt.Sprintf("%dh%02dm%02ds", h, m, s)
+	case m > 0:
+		return fmt.Sprintf("%dm%02ds", m, s)
+	}
+	return fmt.Sprintf("%ds", s)
+}
+
+// summary is the text both text reporters print, without a bar.
+func summary(s Status) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s", s.Name, FormatBytes(s.Done))
+	if f := s.Fraction(); f >= 0 {
+		fmt.Fprintf(&b, " of %s (%.0f%%)", FormatBytes(s.Total), 100*f)
+	}
+	fmt.Fprintf(&b, ", %s/s", FormatBytes(int64(s.Rate)))
+	switch {
+	case s.Err != "":
+		fmt.Fprintf(&b, ", failed after %s: %s", formatDuration(s.Elapsed), s.Err)
+	case s.Finished:
+		fmt.Fprintf(&b, ", done in %s", formatDuration(s.Elapsed))
+	case s.ETA > 0:
+		fmt.Fprintf(&b, ", %s left", formatDuration(s.ETA))
+	}
+	return b.String()
+}
+
+// ttyReporter redraws a single line with a bar.
+type ttyReporter struct {
+	mu    sync.Mutex
+	w     io.Writer
+	width int
+}
+
+// barWidth is the width of the TTY reporter's bar, in characters.
+const barWidth = 30
+
+// NewTTYReporter returns a reporter that redraws one line on w, which
+// should be a terminal.
+func NewTTYReporter(w io.Writer) Reporter {
+	return &ttyReporter{w: w}
+}
+
+func (t *ttyReporter) Report(s Status) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var line string
+	if f := s.Fraction(); f >= 0 && !s.Finished {
+		n := int(f * barWidth)
+		line = fmt.Sprintf("[%s%s] %s", strings.Repeat("=", n), strings.Repeat(" ", barWidth-n), summary(s))
+	} else {
+		line = summary(s)
+	}
+	// Blank out whatever is left of a longer previous line.
+	pad := t.width - len(line)
+	if pad < 0 {
+		pad = 0
+	}
+	t.width = len(line)
+	fmt.Fprintf(t.w, "\r%s%s", line, strings.Repeat(" ", pad))
+	if s.Finished {
+		fmt.Fprintln(t.w)
+		t.width = 0
+	}
+}
+
+// LineInterval is how often the line reporter from NewReporter prints.
+const LineInterval = 10 * time.Second
+
+// lineReporter prints whole lines, for serial consoles and logs, where
+// redrawing a line does not work.
+type lineReporter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	interval time.Duration
+	last     map[string]time.Duration
+}
+
+// NewLineReporter returns a reporter that prints a line to w at most every
+// interval of an operation, and when it finishes.
+func NewLineReporter(w io.Writer, interval time.Duration) Reporter {
+	return &lineReporter{w: w, interval: interval, last: make(map[string]time.Duration)}
+}
+
+func (l *lineReporter) Report(s Status) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	last, ok := l.last[s.Name]
+	if !s.Finished && ok && s.Elapsed-last < l.interval {
+		return
+	}
+	l.last[s.Name] = s.Elapsed
+	fmt.Fprintln(l.w, summary(s))
+}
+
+// jsonReporter prints a JSON object per status.
+type jsonReporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONReporter returns a reporter that writes each status to w as a
+// line of JSON, with durations in nanoseconds.
+func NewJSONReporter(w io.Writer) Reporter {
+	return &jsonReporter{enc: json.NewEncoder(w)}
+}
+
+func (j *jsonReporter) Report(s Status) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.enc.Encode(s)
+}
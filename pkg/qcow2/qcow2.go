@@ -0,0 +1,386 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package qcow2 reads QEMU copy-on-write (qcow2) disk images as the raw
+// images they hold.
+//
+// The image is read front to back only, so it can be converted while it
+// is being downloaded and written to a disk, without qemu-img. Images
+// made by qemu-img convert keep their L2 tables ahead of the clusters
+// they map, which is what streaming needs; clusters that come before
+// their L2 table are held in memory until it is read, up to a limit.
+//
+// Clusters may be compressed with zlib or zstd. Images with a backing
+// file, encryption, an external data file or subclusters are not
+// supported.
+package qcow2
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/u-root/u-root/pkg/qcow2/internal/zstd"
+)
+
+// Magic starts every qcow2 image.
+const Magic = "QFI\xfb"
+
+// Compression types of clusters.
+const (
+	CompressionZlib = 0
+	CompressionZstd = 1
+)
+
+// Incompatible feature bits of version 3 images.
+const (
+	featureDirty           = 1 << 0
+	featureCorrupt         = 1 << 1
+	featureExternalData    = 1 << 2
+	featureCompressionType = 1 << 3
+	featureExtendedL2      = 1 << 4
+)
+
+const (
+	// Offsets of L2 tables and clusters in L1 and L2 entries.
+	offsetMask = 0x00fffffffffffe00
+
+	l2Compressed = 1 << 62
+	l2Zero       = 1 << 0
+)
+
+// ErrNotStreamable is returned when a cluster is needed after it was read
+// past, or when too many clusters had to be held in memory waiting for
+// their L2 table. Such images have to be downloaded first.
+var ErrNotStreamable = errors.New("qcow2 image cannot be read front to back")
+
+// maxBuffered is how many bytes of clusters that come before their L2
+// table are held in memory.
+var maxBuffered int64 = 256 << 20
+
+// Header is the header of a qcow2 image.
+type Header struct {
+	Version     uint32
+	ClusterBits uint32
+
+	// Size is the size of the raw image.
+	Size uint64
+
+	L1Size        uint32
+	L1TableOffset uint64
+
+	// IncompatibleFeatures is 0 for version 2 images.
+	IncompatibleFeatures uint64
+
+	// CompressionType is CompressionZlib or CompressionZstd.
+	CompressionType uint8
+}
+
+// parseHeader parses the header at the start of b, which holds at least
+// 105 bytes.
+func parseHeader(b []byte) (*Header, error) {
+	if !bytes.HasPrefix(b, []byte(Magic)) {
+		return nil, errors.New("not a qcow2 image")
+	}
+	be := binary.BigEndian
+	h := &Header{
+		Version:       be.Uint32(b[4:]),
+		ClusterBits:   be.Uint32(b[20:]),
+		Size:          be.Uint64(b[24:]),
+		L1Size:        be.Uint32(b[36:]),
+		L1TableOffset: be.Uint64(b[40:]),
+	}
+	if h.Version != 2 && h.Version != 3 {
+		return nil, fmt.Errorf("qcow2 version %d is not supported", h.Version)
+	}
+	if h.ClusterBits < 9 || h.ClusterBits > 21 {
+		return nil, fmt.Errorf("qcow2 cluster size 2^%d is invalid", h.ClusterBits)
+	}
+	if be.Uint64(b[8:]) != 0 {
+		return nil, errors.New("qcow2 images with a backing file are not supported")
+	}
+	if be.Uint32(b[32:]) != 0 {
+		return nil, errors.New("encrypted qcow2 images are not supported")
+	}
+	if h.Version == 3 {
+		h.IncompatibleFeatures = be.Uint64(b[72:])
+		if f := h.IncompatibleFeatures &^ (featureDirty | featureCompressionType); f != 0 {
+			switch {
+			case f&featureCorrupt != 0:
+				return nil, errors.New("qcow2 image is marked corrupt")
+			case f&featureExternalData != 0:
+				return nil, errors.New("qcow2 images with an external data file are not supported")
+			case f&featureExtendedL2 != 0:
+				return nil, errors.New("qcow2 images with subclusters are not supported")
+			}
+			return nil, fmt.Errorf("qcow2 incompatible features %#x are not supported", f)
+		}
+		if h.IncompatibleFeatures&featureCompressionType != 0 && be.Uint32(b[100:]) > 104 {
+			h.CompressionType = b[104]
+		}
+		if h.CompressionType != CompressionZlib && h.CompressionType != CompressionZstd {
+			return nil, fmt.Errorf("qcow2 compression type %d is not supported", h.CompressionType)
+		}
+	}
+	cs := uint64(1) << h.ClusterBits
+	if uint64(h.L1Size)*(cs/8)*cs < h.Size {
+		return nil, fmt.Errorf("qcow2 L1 table of %d entries does not cover the image size %d", h.L1Size, h.Size)
+	}
+	return h, nil
+}
+
+// stream reads the clusters of an image in order, holding on to those it
+// has to read past to get to a later one.
+type stream struct {
+	r  io.Reader
+	cs int64
+
+	// next is the index of the next cluster to read from r.
+	next int64
+
+	// passed are the clusters read past, not yet used.
+	passed      map[int64][]byte
+	passedBytes int64
+
+	// last is the cluster used last, which compressed clusters sharing
+	// it need again.
+	last     int64
+	lastData []byte
+}
+
+// cluster returns cluster c, which is short at the end of the image.
+func (s *stream) cluster(c int64) ([]byte, error) {
+	if c == s.last && s.lastData != nil {
+		return s.lastData, nil
+	}
+	if c < s.next {
+		b, ok := s.passed[c]
+		if !ok {
+			return nil, fmt.Errorf("cluster at %#x is needed again: %w", c*s.cs, ErrNotStreamable)
+		}
+		delete(s.passed, c)
+		s.passedBytes -= int64(len(b))
+		s.last, s.lastData = c, b
+		return b, nil
+	}
+	for {
+		b := make([]byte, s.cs)
+		n, err := io.ReadFull(s.r, b)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if n == 0 {
+				return nil, fmt.Errorf("qcow2 image ends at %#x, before the cluster at %#x", s.next*s.cs, c*s.cs)
+			}
+			b = b[:n]
+		} else if err != nil {
+			return nil, err
+		}
+		i := s.next
+		s.next++
+		if i == c {
+			s.last, s.lastData = c, b
+			return b, nil
+		}
+		if s.passedBytes+int64(len(b)) > maxBuffered {
+			return nil, fmt.Errorf("more than %d bytes of clusters come before their L2 table: %w", maxBuffered, ErrNotStreamable)
+		}
+		s.passed[i] = b
+		s.passedBytes += int64(len(b))
+	}
+}
+
+// read returns up to n bytes at off, fewer if the image ends first.
+func (s *stream) read(off, n int64) ([]byte, error) {
+	var b []byte
+	for n > 0 {
+		c, err := s.cluster(off / s.cs)
+		if err != nil {
+			return nil, err
+		}
+		start := off % s.cs
+		if start >= int64(len(c)) {
+			break
+		}
+		c = c[start:]
+		if int64(len(c)) > n {
+			c = c[:n]
+		}
+		b = append(b, c...)
+		off += int64(len(c))
+		n -= int64(len(c))
+		if start+int64(len(c)) < s.cs && n > 0 {
+			// A short cluster is the last one.
+			break
+		}
+	}
+	return b, nil
+}
+
+// Reader reads the raw image held by a qcow2 image.
+type Reader struct {
+	Header
+
+	s  *stream
+	l1 []uint64
+
+	// l2 is the L2 table at l2Index of l1.
+	l2      []uint64
+	l2Index int
+
+	// off is the offset of the next byte of the raw image to be read,
+	// buf the rest of its cluster.
+	off int64
+	buf []byte
+
+	cluster []byte
+	flate   io.ReadCloser
+	zstd    *zstd.Reader
+}
+
+// NewReader reads the header and L1 table of the qcow2 image in r.
+func NewReader(r io.Reader) (*Reader, error) {
+	b := make([]byte, 105)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("reading qcow2 header: %v", err)
+	}
+	h, err := parseHeader(b)
+	if err != nil {
+		return nil, err
+	}
+	cs := int64(1) << h.ClusterBits
+	first := make([]byte, cs)
+	copy(first, b)
+	if _, err := io.ReadFull(r, first[len(b):]); err != nil {
+		return nil, fmt.Errorf("reading qcow2 header: %v", err)
+	}
+
+	qr := &Reader{
+		Header: *h,
+		s: &stream{
+			r:        r,
+			cs:       cs,
+			next:     1,
+			passed:   make(map[int64][]byte),
+			lastData: first,
+		},
+		l2Index: -1,
+		cluster: make([]byte, cs),
+	}
+	l1, err := qr.s.read(int64(h.L1TableOffset), int64(h.L1Size)*8)
+	if err != nil {
+		return nil, fmt.Errorf("reading qcow2 L1 table: %w", err)
+	}
+	if len(l1) < int(h.L1Size)*8 {
+		return nil, errors.New("qcow2 image ends in its L1 table")
+	}
+	for i := 0; i < len(l1); i += 8 {
+		qr.l1 = append(qr.l1, binary.BigEndian.Uint64(l1[i:]))
+	}
+	return qr, nil
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.off >= int64(r.Size) {
+		return 0, io.EOF
+	}
+	if len(r.buf) == 0 {
+		b, err := r.readCluster(r.off >> r.ClusterBits)
+		if err != nil {
+			return 0, err
+		}
+		if rest := int64(r.Size) - r.off; int64(len(b)) > rest {
+			b = b[:rest]
+		}
+		r.buf = b
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	r.off += int64(n)
+	return n, nil
+}
+
+// readCluster returns cluster c of the raw image.
+func (r *Reader) readCluster(c int64) ([]byte, error) {
+	cs := r.s.cs
+	entries := cs / 8
+	i := int(c / entries)
+	if i != r.l2Index {
+		r.l2, r.l2Index = r.l2[:0], i
+		if off := int64(r.l1[i] & offsetMask); off != 0 {
+			b, err := r.s.cluster(off / cs)
+			if err != nil {
+				return nil, fmt.Errorf("reading qcow2 L2 table at %#x: %w", off, err)
+			}
+			if int64(len(b)) < cs {
+				return nil, fmt.Errorf("qcow2 image ends in the L2 table at %#x", off)
+			}
+			for j := 0; j < len(b); j += 8 {
+				r.l2 = append(r.l2, binary.BigEndian.Uint64(b[j:]))
+			}
+		}
+	}
+
+	var e uint64
+	if len(r.l2) > 0 {
+		e = r.l2[c%entries]
+	}
+	switch {
+	case e&l2Compressed != 0:
+		return r.decompress(c, e)
+
+	case e&offsetMask == 0 || r.Version == 3 && e&l2Zero != 0:
+		// Unallocated clusters read as zeroes without a backing file.
+		for j := range r.cluster {
+			r.cluster[j] = 0
+		}
+		return r.cluster, nil
+	}
+	off := int64(e & offsetMask)
+	b, err := r.s.cluster(off / cs)
+	if err != nil {
+		return nil, fmt.Errorf("reading qcow2 cluster at %#x: %w", off, err)
+	}
+	if int64(len(b)) < cs && c<<r.ClusterBits+int64(len(b)) < int64(r.Size) {
+		return nil, fmt.Errorf("qcow2 image ends in the cluster at %#x", off)
+	}
+	return b, nil
+}
+
+// decompress returns compressed cluster c with L2 entry e.
+func (r *Reader) decompress(c int64, e uint64) ([]byte, error) {
+	// The offset takes the low bits, the number of 512 byte sectors
+	// after the first the rest.
+	shift := 62 - (r.ClusterBits - 8)
+	off := int64(e & (1<<shift - 1))
+	sectors := int64(e>>shift&(1<<(r.ClusterBits-8)-1)) + 1
+	b, err := r.s.read(off, sectors*512-off%512)
+	if err != nil {
+		return nil, fmt.Errorf("reading qcow2 compressed cluster at %#x: %w", off, err)
+	}
+
+	var dec io.Reader
+	switch r.CompressionType {
+	case CompressionZlib:
+		if r.flate == nil {
+			r.flate = flate.NewReader(bytes.NewReader(b))
+		} else if err := r.flate.(flate.Resetter).Reset(bytes.NewReader(b), nil); err != nil {
+			return nil, err
+		}
+		dec = r.flate
+	case CompressionZstd:
+		if r.zstd == nil {
+			r.zstd = zstd.NewReader(bytes.NewReader(b))
+		} else {
+			r.zstd.Reset(bytes.NewReader(b))
+		}
+		dec = r.zstd
+	}
+	if _, err := io.ReadFull(dec, r.cluster); err != nil {
+		return nil, fmt.Errorf("decompressing qcow2 cluster %d at %#x: %v", c, off, err)
+	}
+	return r.cluster, nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package qcow2
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+const (
+	testClusterBits = 9
+	testClusterSize = 1 << testClusterBits
+)
+
+// text is the content of the compressed clusters.
+func text() []byte {
+	var b strings.Builder
+	for i := 0; i < 20; i++ {
+		fmt.Fprintf(&b, "line %d of a zstd compressed cluster\n", i)
+	}
+	return []byte(b.String()[:testClusterSize])
+}
+
+// zstdText is text compressed with zstd -19.
+var zstdText = []byte{
+	0x28, 0xb5, 0x2f, 0xfd, 0x64, 0x00, 0x01, 0x7d, 0x02, 0x00, 0x14, 0x03,
+	0x6c, 0x69, 0x6e, 0x65, 0x20, 0x30, 0x20, 0x6f, 0x66, 0x20, 0x61, 0x20,
+	0x7a, 0x73, 0x74, 0x64, 0x20, 0x63, 0x6f, 0x6d, 0x70, 0x72, 0x65, 0x73,
+	0x73, 0x65, 0x64, 0x20, 0x63, 0x6c, 0x75, 0x73, 0x74, 0x65, 0x72, 0x0a,
+	0x31, 0x32, 0x33, 0x34, 0x35, 0x36, 0x37, 0x38, 0x39, 0x31, 0x31, 0x32,
+	0x33, 0x0e, 0xa8, 0x10, 0xf8, 0xfa, 0xff, 0x06, 0xa0, 0x33, 0xae, 0x01,
+	0x10, 0x1a, 0xe1, 0xff, 0x7f, 0x46, 0x1f, 0x11, 0xd1, 0x62, 0x03, 0x46,
+	0x11, 0x08, 0xcf, 0x25, 0x29, 0x6b, 0xf4, 0x14, 0x92,
+}
+
+type testImage struct {
+	version     uint32
+	compression uint8
+
+	// l2Last puts the L2 table after the clusters it maps.
+	l2Last bool
+}
+
+// build returns a qcow2 image and the raw image it holds: 6 clusters of
+// data, unallocated, compressed, zero, compressed and data, the last one
+// partly.
+func (ti testImage) build() ([]byte, []byte) {
+	r := rand.New(rand.NewSource(1))
+	data0, data5 := make([]byte, testClusterSize), make([]byte, testClusterSize)
+	r.Read(data0)
+	r.Read(data5)
+	raw := bytes.Join([][]byte{data0, make([]byte, testClusterSize), text(), make([]byte, testClusterSize), text(), data5}, nil)
+	raw = raw[:len(raw)-100]
+
+	compressed := zstdText
+	if ti.compression == CompressionZlib {
+		var buf bytes.Buffer
+		w, _ := flate.NewWriter(&buf, flate.BestCompression)
+		w.Write(text())
+		w.Close()
+		compressed = buf.Bytes()
+	}
+
+	img := make([]byte, 5*testClusterSize)
+	be := binary.BigEndian
+	copy(img, Magic)
+	be.PutUint32(img[4:], ti.version)
+	be.PutUint32(img[20:], testClusterBits)
+	be.PutUint64(img[24:], uint64(len(raw)))
+	be.PutUint32(img[36:], 1)
+	be.PutUint64(img[40:], testClusterSize)
+	if ti.version == 3 {
+		be.PutUint32(img[100:], 112)
+		if ti.compression != CompressionZlib {
+			be.PutUint64(img[72:], featureCompressionType)
+			img[104] = ti.compression
+		}
+	}
+
+	l2 := make([]byte, testClusterSize)
+	be.PutUint64(l2[0:], 3*testClusterSize)
+	be.PutUint64(l2[40:], 4*testClusterSize)
+	if ti.version == 3 {
+		be.PutUint64(l2[24:], l2Zero)
+	}
+	copy(img[3*testClusterSize:], data0)
+	copy(img[4*testClusterSize:], data5)
+	// Both compressed clusters share the host cluster at 5.
+	for _, i := range []int{2, 4} {
+		off := len(img)
+		img = append(img, compressed...)
+		sectors := (off%512 + len(compressed) + 511) / 512
+		be.PutUint64(l2[8*i:], l2Compressed|uint64(sectors-1)<<61|uint64(off))
+	}
+
+	l2Off := 2 * testClusterSize
+	if ti.l2Last {
+		l2Off = 6 * testClusterSize
+		img = append(img, make([]byte, l2Off-len(img))...)
+		img = append(img, l2...)
+	} else {
+		copy(img[l2Off:], l2)
+	}
+	be.PutUint64(img[testClusterSize:], uint64(l2Off))
+	return img, raw
+}
+
+func TestReader(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		ti   testImage
+	}{
+		{"v2", testImage{version: 2}},
+		{"v3 zlib", testImage{version: 3}},
+		{"v3 zstd", testImage{version: 3, compression: CompressionZstd}},
+		{"L2 table last", testImage{version: 3, compression: CompressionZstd, l2Last: true}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			img, raw := tt.ti.build()
+			r, err := NewReader(iotest.HalfReader(bytes.NewReader(img)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Size != uint64(len(raw)) {
+				t.Errorf("Size = %d, want %d", r.Size, len(raw))
+			}
+			got, err := ioutil.ReadAll(iotest.OneByteReader(r))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, raw) {
+				t.Errorf("read %d bytes that are not the raw image of %d", len(got), len(raw))
+			}
+		})
+	}
+}
+
+func TestNotStreamable(t *testing.T) {
+	defer func(m int64) { maxBuffered = m }(maxBuffered)
+	maxBuffered = 2 * testClusterSize
+
+	img, _ := testImage{version: 3, l2Last: true}.build()
+	r, err := NewReader(bytes.NewReader(img))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(r); !errors.Is(err, ErrNotStreamable) {
+		t.Errorf("reading with too little buffer = %v, want ErrNotStreamable", err)
+	}
+}
+
+func TestHeaderErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		edit func([]byte)
+		want string
+	}{
+		{"magic", func(b []byte) { b[0] = 'X' }, "not a qcow2 image"},
+		{"version", func(b []byte) { b[7] = 4 }, "version 4"},
+		{"backing file", func(b []byte) { b[15] = 0x80 }, "backing file"},
+		{"encrypted", func(b []byte) { b[35] = 2 }, "encrypted"},
+		{"corrupt", func(b []byte) { b[79] |= featureCorrupt }, "corrupt"},
+		{"subclusters", func(b []byte) { b[79] |= featureExtendedL2 }, "subclusters"},
+		{"compression", func(b []byte) { b[104] = 2 }, "compression type 2"},
+		{"small L1", func(b []byte) { b[29] = 1 }, "does not cover"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			img, _ := testImage{version: 3, compression: CompressionZstd}.build()
+			tt.edit(img)
+			if _, err := NewReader(bytes.NewReader(img)); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("NewReader = %v, want an error with %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redfish
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/netconf"
+	"github.com/u-root/u-root/pkg/smbios"
+)
+
+// sysfsNet is where network links are found.
+var sysfsNet = "/sys/class/net"
+
+// HostInterface is a Redfish Host Interface (DMTF DSP0270): a network
+// device, usually USB, the BMC exposes to the host to reach its Redfish
+// service, as SMBIOS describes it.
+type HostInterface struct {
+	Device  *smbios.NetworkHostInterface
+	Service *smbios.RedfishOverIP
+}
+
+// HostInterfaces returns the Redfish Host Interfaces of SMBIOS info.
+func HostInterfaces(info *smbios.Info) ([]*HostInterface, error) {
+	tables, err := info.GetManagementControllerHostInterfaces()
+	if err != nil {
+		return nil, err
+	}
+	return hostInterfaces(tables)
+}
+
+func hostInterfaces(tables []*smbios.ManagementControllerHostInterface) ([]*HostInterface, error) {
+	var his []*HostInterface
+	for _, t := range tables {
+		if t.InterfaceType != smbios.HostInterfaceTypeNetwork {
+			continue
+		}
+		d, err := t.NetworkInterface()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range t.Protocols {
+			if p.Type != smbios.HostInterfaceProtocolRedfishOverIP {
+				continue
+			}
+			s, err := p.RedfishOverIP()
+			if err != nil {
+				return nil, err
+			}
+			his = append(his, &HostInterface{Device: d, Service: s})
+		}
+	}
+	return his, nil
+}
+
+// Endpoint is the endpoint of the Redfish service, for NewClient.
+func (h *HostInterface) Endpoint() string {
+	host := h.Service.ServiceHostname
+	if ip := h.Service.ServiceIP; ip != nil && !ip.IsUnspecified() {
+		host = ip.String()
+	}
+	if h.Service.ServicePort != 0 && h.Service.ServicePort != 443 {
+		return "https://" + net.JoinHostPort(host, strconv.Itoa(int(h.Service.ServicePort)))
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	return "https://" + host
+}
+
+// readHex reads a sysfs attribute that is a hexadecimal number.
+func readHex(path string) (uint64, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(strings.TrimPrefix(string(bytes.TrimSpace(b)), "0x"), 16, 16)
+}
+
+// matches reports whether the network link of sysfs directory dir is the
+// host interface device.
+func (h *HostInterface) matches(dir string) bool {
+	d := h.Device
+	if d.MAC != nil {
+		b, err := ioutil.ReadFile(filepath.Join(dir, "address"))
+		if err != nil {
+			return false
+		}
+		mac, err := net.ParseMAC(string(bytes.TrimSpace(b)))
+		return err == nil && bytes.Equal(mac, d.MAC)
+	}
+
+	dev, err := filepath.EvalSymlinks(filepath.Join(dir, "device"))
+	if err != nil {
+		return false
+	}
+	var ids map[string]uint16
+	switch d.DeviceType {
+	case smbios.HostInterfaceDeviceUSB:
+		// The link is on a USB interface; the IDs are of its device.
+		dev = filepath.Dir(dev)
+		ids = map[string]uint16{"idVendor": d.VendorID, "idProduct": d.ProductID}
+	case smbios.HostInterfaceDevicePCI:
+		ids = map[string]uint16{
+			"vendor":           d.VendorID,
+			"device":           d.ProductID,
+			"subsystem_vendor": d.SubsystemVendorID,
+			"subsystem_device": d.SubsystemID,
+		}
+	default:
+		return false
+	}
+	for attr, want := range ids {
+		if v, err := readHex(filepath.Join(dev, attr)); err != nil || uint16(v) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// Link returns the name of the network link of the host interface.
+func (h *HostInterface) Link() (string, error) {
+	fis, err := ioutil.ReadDir(sysfsNet)
+	if err != nil {
+		return "", err
+	}
+	for _, fi := range fis {
+		if h.matches(filepath.Join(sysfsNet, fi.Name())) {
+			return fi.Name(), nil
+		}
+	}
+	return "", fmt.Errorf("no network link is the %s host interface device %04x:%04x: %w", h.Device.DeviceType, h.Device.VendorID, h.Device.ProductID, os.ErrNotExist)
+}
+
+// Config returns the configuration of link name, the host interface
+// device, to reach the Redfish service.
+func (h *HostInterface) Config(name string) *netconf.Interface {
+	i := &netconf.Interface{
+		ID:    "redfish-host-interface",
+		Match: netconf.Match{Names: []string{name}},
+	}
+	s := h.Service
+	switch s.HostIPAssignment {
+	case smbios.HostIPAssignmentStatic:
+		if s.HostIP != nil {
+			i.Addresses = []*net.IPNet{{IP: s.HostIP, Mask: s.HostMask}}
+		}
+	case smbios.HostIPAssignmentDHCP:
+		if s.HostIP != nil && s.HostIP.To4() == nil {
+			i.DHCP6 = true
+		} else {
+			i.DHCP4 = true
+		}
+	}
+	// Otherwise the link is only brought up, for IPv6 autoconfiguration
+	// or whatever address the host picks.
+	return i
+}
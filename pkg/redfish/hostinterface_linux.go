@@ -0,0 +1,23 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redfish
+
+import (
+	"context"
+
+	"github.com/u-root/u-root/pkg/dhclient"
+	"github.com/u-root/u-root/pkg/netconf"
+)
+
+// Configure brings up the network link of the host interface, with a
+// static address or DHCP with dc as SMBIOS says, and returns its name.
+func (h *HostInterface) Configure(ctx context.Context, dc dhclient.Config) (string, error) {
+	name, err := h.Link()
+	if err != nil {
+		return "", err
+	}
+	c := &netconf.Config{Interfaces: []*netconf.Interface{h.Config(name)}}
+	return name, netconf.Apply(ctx, c, dc)
+}
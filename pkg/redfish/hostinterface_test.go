@@ -0,0 +1,166 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redfish
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/netconf"
+	"github.com/u-root/u-root/pkg/smbios"
+)
+
+// redfishOverIP returns a Redfish over IP protocol record.
+func redfishOverIP(assign byte, hostIP, serviceIP net.IP, port uint16, hostname string) []byte {
+	d := make([]byte, 91, 91+len(hostname))
+	copy(d[0:16], "0123456789abcdef")
+	d[16], d[17] = assign, 1
+	copy(d[18:22], hostIP.To4())
+	copy(d[34:38], net.IPv4Mask(255, 255, 255, 0))
+	d[50], d[51] = 1, 1
+	copy(d[52:56], serviceIP.To4())
+	copy(d[68:72], net.IPv4Mask(255, 255, 255, 0))
+	binary.LittleEndian.PutUint16(d[84:86], port)
+	d[90] = byte(len(hostname))
+	return append(d, hostname...)
+}
+
+// hostInterfaceTable returns a type 42 table of a network host interface
+// with device data dev and a Redfish over IP record rf.
+func hostInterfaceTable(t *testing.T, dev, rf []byte) *smbios.ManagementControllerHostInterface {
+	t.Helper()
+	b := []byte{42, 0, 0x2A, 0x00, 0x40, byte(len(dev))}
+	b = append(b, dev...)
+	b = append(b, 1, 0x04, byte(len(rf)))
+	b = append(b, rf...)
+	b[1] = byte(len(b))
+	b = append(b, 0, 0)
+	tbl, _, err := smbios.ParseTable(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hi, err := smbios.NewManagementControllerHostInterface(tbl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hi
+}
+
+func TestHostInterfaces(t *testing.T) {
+	usb := []byte{0x02, 0x6b, 0x04, 0xb0, 0xff, 8, 0x03, 'A', 0, 'B', 0, 'C', 0}
+	rf := redfishOverIP(1, net.IPv4(169, 254, 0, 2), net.IPv4(169, 254, 0, 1), 443, "bmc")
+	his, err := hostInterfaces([]*smbios.ManagementControllerHostInterface{hostInterfaceTable(t, usb, rf)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(his) != 1 {
+		t.Fatalf("hostInterfaces = %d host interfaces, want 1", len(his))
+	}
+	h := his[0]
+	wantDev := &smbios.NetworkHostInterface{
+		DeviceType:   smbios.HostInterfaceDeviceUSB,
+		VendorID:     0x046b,
+		ProductID:    0xffb0,
+		SerialNumber: "ABC",
+	}
+	if !reflect.DeepEqual(h.Device, wantDev) {
+		t.Errorf("Device = %+v, want %+v", h.Device, wantDev)
+	}
+	if s := h.Service; s.HostIPAssignment != smbios.HostIPAssignmentStatic || !s.HostIP.Equal(net.IPv4(169, 254, 0, 2)) || s.ServiceHostname != "bmc" {
+		t.Errorf("Service = %+v", s)
+	}
+	if e := h.Endpoint(); e != "https://169.254.0.1" {
+		t.Errorf("Endpoint = %q, want https://169.254.0.1", e)
+	}
+
+	want := &netconf.Interface{
+		ID:        "redfish-host-interface",
+		Match:     netconf.Match{Names: []string{"usb0"}},
+		Addresses: []*net.IPNet{{IP: net.IPv4(169, 254, 0, 2), Mask: net.IPv4Mask(255, 255, 255, 0)}},
+	}
+	if c := h.Config("usb0"); !reflect.DeepEqual(c, want) {
+		t.Errorf("Config = %+v, want %+v", c, want)
+	}
+
+	// A service on another port, found by name, with a DHCP host.
+	rf = redfishOverIP(2, nil, nil, 8443, "bmc.local")
+	his, err = hostInterfaces([]*smbios.ManagementControllerHostInterface{hostInterfaceTable(t, usb, rf)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := his[0].Endpoint(); e != "https://bmc.local:8443" {
+		t.Errorf("Endpoint = %q, want https://bmc.local:8443", e)
+	}
+	if c := his[0].Config("usb0"); !c.DHCP4 || c.DHCP6 || c.Addresses != nil {
+		t.Errorf("Config = %+v, want DHCPv4", c)
+	}
+}
+
+func TestHostInterfaceLink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "redfish-sysfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(s string) { sysfsNet = s }(sysfsNet)
+	sysfsNet = filepath.Join(dir, "class/net")
+
+	write := func(path, s string) {
+		path = filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(s), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link := func(name, dev string) {
+		if err := os.MkdirAll(filepath.Join(dir, "class/net", name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Symlink(filepath.Join(dir, dev), filepath.Join(dir, "class/net", name, "device")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("devices/pci0000:00/0000:00:1f.6/vendor", "0x8086\n")
+	write("devices/pci0000:00/0000:00:1f.6/device", "0x15bc\n")
+	write("devices/pci0000:00/0000:00:1f.6/subsystem_vendor", "0x17aa\n")
+	write("devices/pci0000:00/0000:00:1f.6/subsystem_device", "0x2292\n")
+	link("eth0", "devices/pci0000:00/0000:00:1f.6")
+	write("devices/usb1/1-1/idVendor", "046b\n")
+	write("devices/usb1/1-1/idProduct", "ffb0\n")
+	write("devices/usb1/1-1/1-1:1.0/bInterfaceNumber", "00\n")
+	link("usb0", "devices/usb1/1-1/1-1:1.0")
+	write("class/net/usb0/address", "02:00:00:00:00:01\n")
+
+	for _, tt := range []struct {
+		dev  smbios.NetworkHostInterface
+		want string
+	}{
+		{smbios.NetworkHostInterface{DeviceType: smbios.HostInterfaceDeviceUSB, VendorID: 0x046b, ProductID: 0xffb0}, "usb0"},
+		{smbios.NetworkHostInterface{DeviceType: smbios.HostInterfaceDevicePCI, VendorID: 0x8086, ProductID: 0x15bc, SubsystemVendorID: 0x17aa, SubsystemID: 0x2292}, "eth0"},
+		{smbios.NetworkHostInterface{DeviceType: smbios.HostInterfaceDeviceUSBv2, MAC: net.HardwareAddr{2, 0, 0, 0, 0, 1}}, "usb0"},
+		{smbios.NetworkHostInterface{DeviceType: smbios.HostInterfaceDeviceUSB, VendorID: 0x046b, ProductID: 0xffb1}, ""},
+	} {
+		dev := tt.dev
+		h := &HostInterface{Device: &dev}
+		got, err := h.Link()
+		if tt.want == "" {
+			if !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("Link(%+v) = %q, %v, want not found", dev, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("Link(%+v) = %q, %v, want %q", dev, got, err, tt.want)
+		}
+	}
+}
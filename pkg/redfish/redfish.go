@@ -0,0 +1,206 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package redfish implements a small DMTF Redfish client.
+//
+// It covers session authentication and the Systems, Managers and
+// UpdateService resources that provisioning flows need. Anything else can
+// be reached with the generic Get, Patch and Post methods.
+package redfish
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// ServiceRootPath is the well-known Redfish entry point.
+const ServiceRootPath = "/redfish/v1/"
+
+// Client talks to one Redfish service.
+type Client struct {
+	// Endpoint is the scheme and host of the service, e.g. https://bmc.
+	Endpoint string
+
+	// HTTP is the client used for requests.
+	HTTP *http.Client
+
+	user, password string
+	token          string
+	session        string
+}
+
+// NewClient returns a client for endpoint. insecure skips TLS certificate
+// verification, which is what most BMCs with self-signed certificates
+// need.
+func NewClient(endpoint, user, password string, insecure bool) *Client {
+	tr := &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: &tls.Config{InsecureSkipVerify: insecure},
+	}
+	return &Client{
+		Endpoint: strings.TrimSuffix(endpoint, "/"),
+		HTTP:     &http.Client{Transport: tr},
+		user:     user,
+		password: password,
+	}
+}
+
+// Error is a non-2xx response from the service.
+type Error struct {
+	Method string
+	Path   string
+	Status int
+	// Message is the Redfish extended error message, if there was one.
+	Message string
+}
+
+// Error implements error.
+func (e *Error) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("redfish %s %s: %d: %s", e.Method, e.Path, e.Status, e.Message)
+	}
+	return fmt.Sprintf("redfish %s %s: %d %s", e.Method, e.Path, e.Status, http.StatusText(e.Status))
+}
+
+func newError(method, path string, resp *http.Response) error {
+	e := &Error{Method: method, Path: path, Status: resp.StatusCode}
+	var body struct {
+		Error struct {
+			Message  string `json:"message"`
+			Extended []struct {
+				Message string
+			} `json:"@Message.ExtendedInfo"`
+		} `json:"error"`
+	}
+	if json.NewDecoder(resp.Body).Decode(&body) == nil {
+		e.Message = body.Error.Message
+		if len(body.Error.Extended) > 0 {
+			e.Message = body.Error.Extended[0].Message
+		}
+	}
+	return e
+}
+
+// Login opens a session. Without a session every request carries the
+// credentials with HTTP basic auth, which some services do not allow.
+func (c *Client) Login() error {
+	body, err := json.Marshal(map[string]string{"UserName": c.user, "Password": c.password})
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(http.MethodPost, ServiceRootPath+"SessionService/Sessions", nil, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	c.token = resp.Header.Get("X-Auth-Token")
+	if c.token == "" {
+		return fmt.Errorf("redfish: session created without X-Auth-Token")
+	}
+	c.session = resp.Header.Get("Location")
+	return nil
+}
+
+// Logout closes the session opened by Login.
+func (c *Client) Logout() error {
+	if c.session == "" {
+		return nil
+	}
+	path := strings.TrimPrefix(c.session, c.Endpoint)
+	resp, err := c.do(http.MethodDelete, path, nil, nil)
+	c.token, c.session = "", ""
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (c *Client) do(method, path string, header http.Header, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.Endpoint+path, body)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("X-Auth-Token", c.token)
+	} else if c.user != "" {
+		req.SetBasicAuth(c.user, c.password)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		return nil, newError(method, path, resp)
+	}
+	return resp, nil
+}
+
+// Get fetches path and decodes the JSON response into v. It returns the
+// resource's ETag, if any, for use with Patch.
+func (c *Client) Get(path string, v interface{}) (string, error) {
+	resp, err := c.do(http.MethodGet, path, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return "", fmt.Errorf("redfish GET %s: %v", path, err)
+	}
+	return resp.Header.Get("ETag"), nil
+}
+
+// Patch updates path with the JSON encoding of v. A non-empty etag is sent
+// as If-Match so concurrent edits are refused rather than lost.
+func (c *Client) Patch(path, etag string, v interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	h := http.Header{}
+	if etag != "" {
+		h.Set("If-Match", etag)
+	}
+	resp, err := c.do(http.MethodPatch, path, h, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Post sends the JSON encoding of v to path, typically an action target.
+// The response body, if any, is decoded into out unless out is nil.
+func (c *Client) Post(path string, v, out interface{}) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	resp, err := c.do(http.MethodPost, path, nil, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		_, err := io.Copy(ioutil.Discard, resp.Body)
+		return err
+	}
+	// Actions may legitimately answer 204 or 202 with no body.
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil && err != io.EOF {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redfish
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeBMC serves a minimal Redfish tree and records mutating requests.
+type fakeBMC struct {
+	t        *testing.T
+	requests []string
+	bodies   map[string]map[string]interface{}
+}
+
+func (f *fakeBMC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/redfish/v1/SessionService/Sessions" && r.Header.Get("X-Auth-Token") != "tok" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if r.Method != http.MethodGet {
+		f.requests = append(f.requests, r.Method+" "+r.URL.Path)
+		b, _ := ioutil.ReadAll(r.Body)
+		var m map[string]interface{}
+		json.Unmarshal(b, &m)
+		f.bodies[r.Method+" "+r.URL.Path] = m
+	}
+	switch r.Method + " " + r.URL.Path {
+	case "POST /redfish/v1/SessionService/Sessions":
+		w.Header().Set("X-Auth-Token", "tok")
+		w.Header().Set("Location", "/redfish/v1/SessionService/Sessions/1")
+		w.WriteHeader(http.StatusCreated)
+	case "GET /redfish/v1/Systems":
+		w.Write([]byte(`{"Members": [{"@odata.id": "/redfish/v1/Systems/1"}]}`))
+	case "GET /redfish/v1/Systems/1":
+		w.Header().Set("ETag", `"abc"`)
+		w.Write([]byte(`{
+			"@odata.id": "/redfish/v1/Systems/1", "Id": "1", "PowerState": "On",
+			"Boot": {"BootSourceOverrideTarget@Redfish.AllowableValues": ["Pxe", "Hdd"]},
+			"Actions": {"#ComputerSystem.Reset": {
+				"target": "/redfish/v1/Systems/1/Actions/ComputerSystem.Reset",
+				"ResetType@Redfish.AllowableValues": ["On", "ForceRestart"]}}}`))
+	case "PATCH /redfish/v1/Systems/1":
+		if r.Header.Get("If-Match") != `"abc"` {
+			w.WriteHeader(http.StatusPreconditionFailed)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "POST /redfish/v1/Systems/1/Actions/ComputerSystem.Reset":
+		w.WriteHeader(http.StatusNoContent)
+	case "GET /redfish/v1/UpdateService":
+		w.Write([]byte(`{"ServiceEnabled": true}`))
+	case "POST /redfish/v1/UpdateService/Actions/UpdateService.SimpleUpdate":
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(`{"Id": "7", "TaskState": "Running"}`))
+	case "DELETE /redfish/v1/SessionService/Sessions/1":
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"error": {"message": "no such resource"}}`))
+	}
+}
+
+func TestClient(t *testing.T) {
+	f := &fakeBMC{t: t, bodies: make(map[string]map[string]interface{})}
+	srv := httptest.NewServer(f)
+	defer srv.Close()
+
+	c := NewClient(srv.URL, "root", "pw", false)
+	if err := c.Login(); err != nil {
+		t.Fatalf("Login() = %v", err)
+	}
+	if got := f.bodies["POST /redfish/v1/SessionService/Sessions"]["UserName"]; got != "root" {
+		t.Errorf("Login sent UserName %v, want root", got)
+	}
+
+	systems, err := c.Systems()
+	if err != nil {
+		t.Fatalf("Systems() = %v", err)
+	}
+	if len(systems) != 1 || systems[0].PowerState != "On" {
+		t.Fatalf("Systems() = %+v, want one powered on system", systems)
+	}
+	s := systems[0]
+
+	if err := c.Reset(s, "ForceOff"); err == nil {
+		t.Errorf("Reset(ForceOff) = nil, want disallowed type error")
+	}
+	if err := c.Reset(s, "ForceRestart"); err != nil {
+		t.Errorf("Reset(ForceRestart) = %v", err)
+	}
+	if err := c.SetBootOverride(s, "Pxe", "Once"); err != nil {
+		t.Errorf("SetBootOverride() = %v", err)
+	}
+	boot := f.bodies["PATCH /redfish/v1/Systems/1"]["Boot"].(map[string]interface{})
+	if boot["BootSourceOverrideTarget"] != "Pxe" || boot["BootSourceOverrideEnabled"] != "Once" {
+		t.Errorf("SetBootOverride sent %v", boot)
+	}
+
+	task, err := c.SimpleUpdate("http://host/fw.bin", "")
+	if err != nil || task.ID != "7" {
+		t.Errorf("SimpleUpdate() = %+v, %v, want task 7", task, err)
+	}
+
+	if _, err := c.System("2"); err == nil {
+		t.Errorf("System(2) = nil, want error")
+	} else if e, ok := err.(*Error); !ok || e.Status != http.StatusNotFound || e.Message != "no such resource" {
+		t.Errorf("System(2) = %v, want 404 with message", err)
+	}
+
+	if err := c.Logout(); err != nil {
+		t.Errorf("Logout() = %v", err)
+	}
+	if last := f.requests[len(f.requests)-1]; last != "DELETE /redfish/v1/SessionService/Sessions/1" {
+		t.Errorf("last request = %q, want session delete", last)
+	}
+}
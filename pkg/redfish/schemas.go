@@ -0,0 +1,233 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package redfish
+
+import (
+	"fmt"
+)
+
+// Link is a reference to another resource.
+type Link struct {
+	ID string `json:"@odata.id"`
+}
+
+// Collection is a Redfish resource collection.
+type Collection struct {
+	Name    string
+	Members []Link
+}
+
+// Status is the common health status object.
+type Status struct {
+	State  string
+	Health string
+}
+
+// Action is an action a resource supports.
+type Action struct {
+	Target string `json:"target"`
+	// AllowedResetTypes is set on ComputerSystem.Reset actions.
+	AllowedResetTypes []string `json:"ResetType@Redfish.AllowableValues,omitempty"`
+}
+
+// ServiceRoot is the resource at ServiceRootPath.
+type ServiceRoot struct {
+	RedfishVersion string
+	UUID           string
+	Systems        Link
+	Managers       Link
+	UpdateService  Link
+	SessionService Link
+}
+
+// Boot is the boot override part of a ComputerSystem.
+type Boot struct {
+	BootSourceOverrideEnabled string   `json:",omitempty"`
+	BootSourceOverrideTarget  string   `json:",omitempty"`
+	BootSourceOverrideMode    string   `json:",omitempty"`
+	AllowedTargets            []string `json:"BootSourceOverrideTarget@Redfish.AllowableValues,omitempty"`
+}
+
+// ComputerSystem is a host managed by the service.
+type ComputerSystem struct {
+	ODataID      string `json:"@odata.id"`
+	ID           string `json:"Id"`
+	Name         string
+	Manufacturer string
+	Model        string
+	SerialNumber string
+	UUID         string
+	PowerState   string
+	BiosVersion  string
+	Status       Status
+	Boot         Boot
+	Actions      struct {
+		Reset Action `json:"#ComputerSystem.Reset"`
+	}
+}
+
+// Manager is a management controller, usually the BMC itself.
+type Manager struct {
+	ODataID         string `json:"@odata.id"`
+	ID              string `json:"Id"`
+	Name            string
+	ManagerType     string
+	FirmwareVersion string
+	Model           string
+	UUID            string
+	Status          Status
+	Actions         struct {
+		Reset Action `json:"#Manager.Reset"`
+	}
+}
+
+// UpdateService is the firmware update service.
+type UpdateService struct {
+	ServiceEnabled bool
+	HTTPPushURI    string `json:"HttpPushUri"`
+	Actions        struct {
+		SimpleUpdate Action `json:"#UpdateService.SimpleUpdate"`
+	}
+}
+
+// Task is a long running operation started by an action.
+type Task struct {
+	ODataID    string `json:"@odata.id"`
+	ID         string `json:"Id"`
+	TaskState  string
+	TaskStatus string
+	Messages   []struct {
+		Message string
+	}
+}
+
+// ServiceRoot fetches the service root.
+func (c *Client) ServiceRoot() (*ServiceRoot, error) {
+	var r ServiceRoot
+	_, err := c.Get(ServiceRootPath, &r)
+	return &r, err
+}
+
+// collection calls get with the path of every member of the collection at
+// path.
+func (c *Client) collection(path string, get func(string) error) error {
+	var col Collection
+	if _, err := c.Get(path, &col); err != nil {
+		return err
+	}
+	for _, m := range col.Members {
+		if err := get(m.ID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Systems returns all computer systems.
+func (c *Client) Systems() ([]*ComputerSystem, error) {
+	var s []*ComputerSystem
+	err := c.collection(ServiceRootPath+"Systems", func(p string) error {
+		sys, err := c.SystemAt(p)
+		s = append(s, sys)
+		return err
+	})
+	return s, err
+}
+
+// System returns the system with the given Id.
+func (c *Client) System(id string) (*ComputerSystem, error) {
+	return c.SystemAt(ServiceRootPath + "Systems/" + id)
+}
+
+// SystemAt returns the system at path.
+func (c *Client) SystemAt(path string) (*ComputerSystem, error) {
+	var s ComputerSystem
+	_, err := c.Get(path, &s)
+	return &s, err
+}
+
+// Reset performs a ComputerSystem.Reset action such as "On",
+// "ForceOff", "GracefulRestart" or "ForceRestart".
+func (c *Client) Reset(s *ComputerSystem, resetType string) error {
+	if len(s.Actions.Reset.AllowedResetTypes) > 0 && !contains(s.Actions.Reset.AllowedResetTypes, resetType) {
+		return fmt.Errorf("reset type %q not in %v", resetType, s.Actions.Reset.AllowedResetTypes)
+	}
+	target := s.Actions.Reset.Target
+	if target == "" {
+		target = s.ODataID + "/Actions/ComputerSystem.Reset"
+	}
+	return c.Post(target, map[string]string{"ResetType": resetType}, nil)
+}
+
+// SetBootOverride makes s boot from target ("Pxe", "Hdd", "BiosSetup",
+// ...) either "Once" or "Continuous", or turns the override off with
+// "Disabled".
+func (c *Client) SetBootOverride(s *ComputerSystem, target, enabled string) error {
+	if len(s.Boot.AllowedTargets) > 0 && enabled != "Disabled" && !contains(s.Boot.AllowedTargets, target) {
+		return fmt.Errorf("boot target %q not in %v", target, s.Boot.AllowedTargets)
+	}
+	etag, err := c.Get(s.ODataID, &ComputerSystem{})
+	if err != nil {
+		return err
+	}
+	return c.Patch(s.ODataID, etag, map[string]Boot{"Boot": {
+		BootSourceOverrideEnabled: enabled,
+		BootSourceOverrideTarget:  target,
+	}})
+}
+
+// Managers returns all managers.
+func (c *Client) Managers() ([]*Manager, error) {
+	var m []*Manager
+	err := c.collection(ServiceRootPath+"Managers", func(p string) error {
+		var mgr Manager
+		_, err := c.Get(p, &mgr)
+		m = append(m, &mgr)
+		return err
+	})
+	return m, err
+}
+
+// UpdateService returns the update service.
+func (c *Client) UpdateService() (*UpdateService, error) {
+	var u UpdateService
+	_, err := c.Get(ServiceRootPath+"UpdateService", &u)
+	return &u, err
+}
+
+// SimpleUpdate asks the service to fetch and apply the firmware image at
+// imageURI. protocol may be empty when the URI's scheme says it all.
+// The returned task, if the service made one, tracks progress.
+func (c *Client) SimpleUpdate(imageURI, protocol string) (*Task, error) {
+	u, err := c.UpdateService()
+	if err != nil {
+		return nil, err
+	}
+	if !u.ServiceEnabled {
+		return nil, fmt.Errorf("redfish: update service is disabled")
+	}
+	target := u.Actions.SimpleUpdate.Target
+	if target == "" {
+		target = ServiceRootPath + "UpdateService/Actions/UpdateService.SimpleUpdate"
+	}
+	req := map[string]string{"ImageURI": imageURI}
+	if protocol != "" {
+		req["TransferProtocol"] = protocol
+	}
+	var t Task
+	if err := c.Post(target, req, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+func contains(l []string, s string) bool {
+	for _, e := range l {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
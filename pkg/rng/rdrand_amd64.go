@@ -0,0 +1,17 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rng
+
+import "golang.org/x/sys/cpu"
+
+// rdseed and rdrand return the result of one RDSEED or RDRAND, and whether
+// it succeeded.
+func rdseed() (uint64, bool)
+func rdrand() (uint64, bool)
+
+var (
+	hasRDSEED = cpu.X86.HasRDSEED
+	hasRDRAND = cpu.X86.HasRDRAND
+)
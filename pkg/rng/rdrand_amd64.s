@@ -0,0 +1,21 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+#include "textflag.h"
+
+// func rdseed() (uint64, bool)
+TEXT ·rdseed(SB),NOSPLIT,$0-9
+	// RDSEED AX
+	BYTE $0x48; BYTE $0x0f; BYTE $0xc7; BYTE $0xf8
+	SETCS ret1+8(FP)
+	MOVQ AX, ret+0(FP)
+	RET
+
+// func rdrand() (uint64, bool)
+TEXT ·rdrand(SB),NOSPLIT,$0-9
+	// RDRAND AX
+	BYTE $0x48; BYTE $0x0f; BYTE $0xc7; BYTE $0xf0
+	SETCS ret1+8(FP)
+	MOVQ AX, ret+0(FP)
+	RET
@@ -0,0 +1,15 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !amd64
+
+package rng
+
+func rdseed() (uint64, bool) { return 0, false }
+func rdrand() (uint64, bool) { return 0, false }
+
+const (
+	hasRDSEED = false
+	hasRDRAND = false
+)
@@ -0,0 +1,231 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rng
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/u-root/u-root/pkg/tss"
+)
+
+// Seeding
+//
+// UpdateLinuxRandomness feeds the kernel from /dev/hwrng for as long
+// as it runs. Seed is the one-shot version for early boot: it takes a
+// little from every source there is and hands it to the kernel with
+// RNDADDENTROPY, so that the first TLS handshake of a netboot does not
+// wait for the pool to fill on a headless machine.
+
+// SeedSize is the number of bytes Seed takes from each source; twice what
+// the kernel needs to consider its pool initialized.
+var SeedSize = 64
+
+// Source is somewhere to seed the kernel's RNG from.
+type Source struct {
+	// Name says where the bytes came from in logs and errors.
+	Name string
+
+	// Credit says whether the bytes are trusted to be random, in which
+	// case the kernel is credited with 8 bits of entropy for each.
+	// Bytes that are not credited are still mixed into the pool.
+	Credit bool
+
+	// Read fills as much of b as it can. If it returns an error after
+	// reading some bytes, they are mixed in but not credited.
+	Read func(b []byte) (int, error)
+}
+
+// SeedResult is what one source contributed to Seed.
+type SeedResult struct {
+	Name string
+	// Bytes were mixed into the pool, and Bits of entropy credited.
+	Bytes int
+	Bits  int
+	Err   error
+}
+
+// addEntropy hands b to the kernel, crediting it with bits of entropy.
+var addEntropy = addKernelEntropy
+
+// Seed mixes up to SeedSize bytes from each of sources into the kernel's
+// RNG, in order, and reports what each one contributed. A source that
+// fails does not stop the others.
+func Seed(sources []*Source) []SeedResult {
+	var res []SeedResult
+	for _, s := range sources {
+		r := SeedResult{Name: s.Name}
+		b := make([]byte, SeedSize)
+		n, err := s.Read(b)
+		r.Err = err
+		if n > 0 {
+			bits := 0
+			if s.Credit && err == nil {
+				bits = n * 8
+			}
+			if err := addEntropy(b[:n], bits); err != nil {
+				r.Err = err
+			} else {
+				r.Bytes, r.Bits = n, bits
+			}
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// CPUSource returns a source using RDSEED, or RDRAND where RDSEED is not
+// available or keeps failing, and nil if the CPU has neither. The kernel
+// already mixes these in itself, and only credits them with
+// random.trust_cpu=on; credit should follow the same choice.
+func CPUSource(credit bool) *Source {
+	if !hasRDSEED && !hasRDRAND {
+		return nil
+	}
+	return &Source{Name: "cpu", Credit: credit, Read: readCPU}
+}
+
+// cpuRetries is how often RDSEED and RDRAND are tried for each word. Both
+// can fail transiently when the hardware is drained.
+const cpuRetries = 10
+
+func cpuWord() (uint64, bool) {
+	for _, insn := range []struct {
+		ok bool
+		f  func() (uint64, bool)
+	}{
+		{hasRDSEED, rdseed},
+		{hasRDRAND, rdrand},
+	} {
+		if !insn.ok {
+			continue
+		}
+		for i := 0; i < cpuRetries; i++ {
+			if v, ok := insn.f(); ok {
+				return v, true
+			}
+		}
+	}
+	return 0, false
+}
+
+func readCPU(b []byte) (int, error) {
+	var w [8]byte
+	for n := 0; n < len(b); n += len(w) {
+		v, ok := cpuWord()
+		if !ok {
+			return n, fmt.Errorf("RDSEED and RDRAND keep failing")
+		}
+		binary.LittleEndian.PutUint64(w[:], v)
+		copy(b[n:], w[:])
+	}
+	return len(b), nil
+}
+
+// TPMSource returns a source using the TPM's GetRandom command.
+func TPMSource() *Source {
+	return &Source{Name: "tpm", Credit: true, Read: readTPM}
+}
+
+func readTPM(b []byte) (int, error) {
+	t, err := tss.NewTPM()
+	if err != nil {
+		return 0, err
+	}
+	defer t.Close()
+	var n int
+	for n < len(b) {
+		r, err := t.GetRandom(len(b) - n)
+		if err != nil {
+			return n, err
+		}
+		if len(r) == 0 {
+			return n, fmt.Errorf("TPM returned no random bytes")
+		}
+		n += copy(b[n:], r)
+	}
+	return n, nil
+}
+
+// HwRandomSource returns a source reading HwRandomDevice, which is where
+// virtio-rng and other hardware RNG drivers show up.
+func HwRandomSource() *Source {
+	return &Source{Name: "hwrng", Credit: true, Read: readHwRandom}
+}
+
+func readHwRandom(b []byte) (int, error) {
+	f, err := os.Open(HwRandomDevice)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return io.ReadFull(f, b)
+}
+
+// SeedFileSource returns a source reading a seed saved by a previous boot
+// at path. The file is replaced as it is read so the same seed is never
+// used twice; if that fails, the old seed is mixed in but not credited.
+// Only credit seed files that are private to this machine, not ones built
+// into a shared initramfs.
+func SeedFileSource(path string, credit bool) *Source {
+	return &Source{
+		Name:   "seed file " + path,
+		Credit: credit,
+		Read: func(b []byte) (int, error) {
+			return readSeedFile(path, b)
+		},
+	}
+}
+
+func readSeedFile(path string, b []byte) (int, error) {
+	seed, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	n := copy(b, seed)
+	if n == 0 {
+		return 0, fmt.Errorf("%s is empty", path)
+	}
+	// The next seed depends on this one as well as on the kernel's pool,
+	// in case the pool has not got much in it yet.
+	if err := writeSeed(path, seed); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// SaveSeed writes SeedSize bytes from the kernel's RNG to path, for
+// SeedFileSource to use on the next boot.
+func SaveSeed(path string) error {
+	return writeSeed(path, nil)
+}
+
+// writeSeed writes a new seed to path, mixing old into it if not nil.
+func writeSeed(path string, old []byte) error {
+	seed := make([]byte, SeedSize)
+	if _, err := io.ReadFull(rand.Reader, seed); err != nil {
+		return err
+	}
+	if old != nil {
+		sum := sha256.Sum256(append(append([]byte{}, old...), seed...))
+		for i := range seed {
+			seed[i] ^= sum[i%len(sum)]
+		}
+	}
+	tmp := path + ".new"
+	if err := ioutil.WriteFile(tmp, seed, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rng
+
+import (
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// addKernelEntropy passes b to RNDADDENTROPY as a struct rand_pool_info,
+// see include/uapi/linux/random.h. It needs CAP_SYS_ADMIN.
+func addKernelEntropy(b []byte, bits int) error {
+	f, err := os.OpenFile(RandomDevice, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info := make([]byte, 8+len(b))
+	*(*int32)(unsafe.Pointer(&info[0])) = int32(bits)
+	*(*int32)(unsafe.Pointer(&info[4])) = int32(len(b))
+	copy(info[8:], b)
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, f.Fd(), unix.RNDADDENTROPY, uintptr(unsafe.Pointer(&info[0]))); errno != 0 {
+		return os.NewSyscallError("RNDADDENTROPY", errno)
+	}
+	return nil
+}
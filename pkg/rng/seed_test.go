@@ -0,0 +1,135 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package rng
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type added struct {
+	b    []byte
+	bits int
+}
+
+// fakeAddEntropy records what is added, until the returned func is called.
+func fakeAddEntropy() (*[]added, func()) {
+	var got []added
+	old := addEntropy
+	addEntropy = func(b []byte, bits int) error {
+		got = append(got, added{append([]byte{}, b...), bits})
+		return nil
+	}
+	return &got, func() { addEntropy = old }
+}
+
+func fill(c byte, n int, err error) func([]byte) (int, error) {
+	return func(b []byte) (int, error) {
+		for i := 0; i < n && i < len(b); i++ {
+			b[i] = c
+		}
+		return n, err
+	}
+}
+
+func TestSeed(t *testing.T) {
+	got, restore := fakeAddEntropy()
+	defer restore()
+	oldSize := SeedSize
+	SeedSize = 4
+	defer func() { SeedSize = oldSize }()
+
+	errFail := errors.New("fail")
+	res := Seed([]*Source{
+		{Name: "trusted", Credit: true, Read: fill(1, 4, nil)},
+		{Name: "untrusted", Read: fill(2, 4, nil)},
+		{Name: "partial", Credit: true, Read: fill(3, 2, errFail)},
+		{Name: "broken", Credit: true, Read: fill(4, 0, errFail)},
+	})
+
+	wantRes := []SeedResult{
+		{Name: "trusted", Bytes: 4, Bits: 32},
+		{Name: "untrusted", Bytes: 4},
+		{Name: "partial", Bytes: 2, Err: errFail},
+		{Name: "broken", Err: errFail},
+	}
+	if !reflect.DeepEqual(res, wantRes) {
+		t.Errorf("Seed() = %+v, want %+v", res, wantRes)
+	}
+	want := []added{
+		{[]byte{1, 1, 1, 1}, 32},
+		{[]byte{2, 2, 2, 2}, 0},
+		{[]byte{3, 3}, 0},
+	}
+	if !reflect.DeepEqual(*got, want) {
+		t.Errorf("added %v, want %v", *got, want)
+	}
+}
+
+func TestSeedFile(t *testing.T) {
+	got, restore := fakeAddEntropy()
+	defer restore()
+	dir, err := ioutil.TempDir("", "rng")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "seed")
+
+	if err := SaveSeed(path); err != nil {
+		t.Fatal(err)
+	}
+	first, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != SeedSize {
+		t.Fatalf("saved seed is %d bytes, want %d", len(first), SeedSize)
+	}
+
+	res := Seed([]*Source{SeedFileSource(path, true)})
+	if res[0].Err != nil || res[0].Bits != SeedSize*8 {
+		t.Fatalf("Seed() = %+v, want %d bits", res, SeedSize*8)
+	}
+	if !bytes.Equal((*got)[0].b, first) {
+		t.Errorf("seeded with %x, want %x", (*got)[0].b, first)
+	}
+	second, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second) != SeedSize || bytes.Equal(first, second) {
+		t.Errorf("seed file was not replaced: %x", second)
+	}
+}
+
+func TestSeedFileMissing(t *testing.T) {
+	_, restore := fakeAddEntropy()
+	defer restore()
+	res := Seed([]*Source{SeedFileSource("/does/not/exist", true)})
+	if !os.IsNotExist(res[0].Err) || res[0].Bytes != 0 {
+		t.Errorf("Seed() = %+v, want not exist error", res)
+	}
+}
+
+func TestCPUSource(t *testing.T) {
+	s := CPUSource(false)
+	if s == nil {
+		t.Skip("no RDSEED or RDRAND")
+	}
+	b := make([]byte, 20)
+	n, err := s.Read(b)
+	if err != nil || n != len(b) {
+		t.Fatalf("Read() = %d, %v, want %d, nil", n, err, len(b))
+	}
+	if bytes.Equal(b, make([]byte, len(b))) {
+		t.Errorf("Read() returned zeros")
+	}
+}
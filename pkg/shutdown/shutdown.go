@@ -0,0 +1,228 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package shutdown powers off, reboots, suspends and hibernates the
+// machine, in the ways the kernel and firmware offer. What is done is
+// logged in the BMC's SEL first, if there is a BMC.
+package shutdown
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/u-root/u-root/pkg/ipmi"
+	"golang.org/x/sys/unix"
+)
+
+// Mode is how the machine is reset on reboot.
+type Mode string
+
+// Reboot modes.
+const (
+	Cold Mode = "cold"
+	Warm Mode = "warm"
+	Hard Mode = "hard"
+	Soft Mode = "soft"
+	GPIO Mode = "gpio"
+)
+
+// Method is what the kernel resets the machine with, on x86.
+type Method string
+
+// Reboot methods.
+const (
+	ACPI     Method = "acpi"
+	EFI      Method = "efi"
+	BIOS     Method = "bios"
+	Keyboard Method = "kbd"
+	Triple   Method = "triple"
+	PCI      Method = "pci"
+)
+
+var (
+	rebootDir = "/sys/kernel/reboot"
+	powerDir  = "/sys/power"
+	swaps     = "/proc/swaps"
+	meminfo   = "/proc/meminfo"
+	reboot    = unix.Reboot
+
+	// logAction records what is done in the BMC's SEL, if there is one.
+	logAction = ipmi.LogOSAction
+)
+
+// SetRebootMode sets how the machine is reset on the next reboot; a ""
+// method leaves the kernel's choice. It needs Linux 5.11 or later; older
+// kernels take reboot= on the command line.
+func SetRebootMode(m Mode, method Method) error {
+	if _, err := os.Stat(rebootDir); err != nil {
+		return fmt.Errorf("cannot set the reboot mode: %v", err)
+	}
+	if m != "" {
+		if err := ioutil.WriteFile(filepath.Join(rebootDir, "mode"), []byte(m), 0644); err != nil {
+			return fmt.Errorf("reboot mode %s: %v", m, err)
+		}
+	}
+	if method != "" {
+		if err := ioutil.WriteFile(filepath.Join(rebootDir, "type"), []byte(method), 0644); err != nil {
+			return fmt.Errorf("reboot method %s: %v", method, err)
+		}
+	}
+	return nil
+}
+
+// logSEL logs a in the SEL. Most machines have no BMC, so failing to is
+// not an error.
+func logSEL(a ipmi.OSAction) {
+	_ = logAction(a)
+}
+
+// PowerOff powers the machine off.
+func PowerOff() error {
+	logSEL(ipmi.OSPowerOff)
+	unix.Sync()
+	return reboot(unix.LINUX_REBOOT_CMD_POWER_OFF)
+}
+
+// Reboot reboots the machine, in the mode of SetRebootMode.
+func Reboot() error {
+	a := ipmi.OSColdReset
+	if b, err := ioutil.ReadFile(filepath.Join(rebootDir, "mode")); err == nil {
+		if m := Mode(strings.TrimSpace(string(b))); m == Warm || m == Soft {
+			a = ipmi.OSWarmReset
+		}
+	}
+	logSEL(a)
+	unix.Sync()
+	return reboot(unix.LINUX_REBOOT_CMD_RESTART)
+}
+
+// choices returns the words of a sysfs file such as /sys/power/mem_sleep,
+// with the current choice's brackets dropped.
+func choices(file string) ([]string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(powerDir, file))
+	if err != nil {
+		return nil, err
+	}
+	f := strings.Fields(string(b))
+	for i := range f {
+		f[i] = strings.Trim(f[i], "[]")
+	}
+	return f, nil
+}
+
+func has(s []string, w string) bool {
+	for _, v := range s {
+		if v == w {
+			return true
+		}
+	}
+	return false
+}
+
+// Sleep suspends the machine to RAM, ACPI S3, and returns once it is woken
+// up. Machines that only offer suspend to idle are not put to sleep.
+func Sleep() error {
+	s, err := choices("mem_sleep")
+	if err != nil {
+		return fmt.Errorf("suspend to RAM is not supported: %v", err)
+	}
+	if !has(s, "deep") {
+		return fmt.Errorf("suspend to RAM is not supported, only %s", strings.Join(s, ", "))
+	}
+	if err := ioutil.WriteFile(filepath.Join(powerDir, "mem_sleep"), []byte("deep"), 0644); err != nil {
+		return err
+	}
+	logSEL(ipmi.OSSleep)
+	unix.Sync()
+	return ioutil.WriteFile(filepath.Join(powerDir, "state"), []byte("mem"), 0644)
+}
+
+// CheckHibernate returns why the machine cannot be hibernated and resumed:
+// the kernel cannot hibernate, no resume device is set, or there is too
+// little free swap for the memory in use.
+func CheckHibernate() error {
+	s, err := choices("state")
+	if err != nil || !has(s, "disk") {
+		return fmt.Errorf("the kernel cannot hibernate")
+	}
+	b, err := ioutil.ReadFile(filepath.Join(powerDir, "resume"))
+	if err != nil || strings.TrimSpace(string(b)) == "0:0" {
+		return fmt.Errorf("no resume device is set: resume= on the kernel command line")
+	}
+	free, err := freeSwap()
+	if err != nil {
+		return err
+	}
+	// The image holds at least the memory in use by processes.
+	need, err := meminfoKB("Active(anon)")
+	if err != nil {
+		return err
+	}
+	if free < need {
+		return fmt.Errorf("%d kB of free swap is less than the %d kB of memory in use", free, need)
+	}
+	return nil
+}
+
+// freeSwap returns the free swap, in kB.
+func freeSwap() (uint64, error) {
+	f, err := os.Open(swaps)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	// Filename, Type, Size, Used and Priority, under a header.
+	s.Scan()
+	var free uint64
+	for s.Scan() {
+		l := strings.Fields(s.Text())
+		if len(l) < 4 {
+			continue
+		}
+		size, err := strconv.ParseUint(l[2], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", swaps, err)
+		}
+		used, err := strconv.ParseUint(l[3], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %v", swaps, err)
+		}
+		if used < size {
+			free += size - used
+		}
+	}
+	return free, s.Err()
+}
+
+// meminfoKB returns the value of key in /proc/meminfo, in kB.
+func meminfoKB(key string) (uint64, error) {
+	b, err := ioutil.ReadFile(meminfo)
+	if err != nil {
+		return 0, err
+	}
+	for _, l := range strings.Split(string(b), "\n") {
+		f := strings.Fields(l)
+		if len(f) >= 2 && f[0] == key+":" {
+			return strconv.ParseUint(f[1], 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("%s: no %s", meminfo, key)
+}
+
+// Hibernate writes memory to swap and powers off, ACPI S4, after
+// CheckHibernate. It returns once the machine is resumed.
+func Hibernate() error {
+	if err := CheckHibernate(); err != nil {
+		return fmt.Errorf("cannot hibernate: %v", err)
+	}
+	logSEL(ipmi.OSHibernate)
+	unix.Sync()
+	return ioutil.WriteFile(filepath.Join(powerDir, "state"), []byte("disk"), 0644)
+}
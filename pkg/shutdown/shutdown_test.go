@@ -0,0 +1,191 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package shutdown
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/u-root/u-root/pkg/ipmi"
+	"golang.org/x/sys/unix"
+)
+
+// fake points the package at files in a temporary directory, and records
+// reboots and SEL entries instead of doing them.
+type fake struct {
+	dir     string
+	actions []ipmi.OSAction
+	reboots []int
+}
+
+func newFake(t *testing.T, files map[string]string) *fake {
+	d, err := ioutil.TempDir("", "shutdown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, dir := range []string{"reboot", "power"} {
+		if err := os.Mkdir(filepath.Join(d, dir), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(d, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f := &fake{dir: d}
+	rebootDir = filepath.Join(d, "reboot")
+	powerDir = filepath.Join(d, "power")
+	swaps = filepath.Join(d, "swaps")
+	meminfo = filepath.Join(d, "meminfo")
+	logAction = func(a ipmi.OSAction) error {
+		f.actions = append(f.actions, a)
+		return nil
+	}
+	reboot = func(cmd int) error {
+		f.reboots = append(f.reboots, cmd)
+		return nil
+	}
+	return f
+}
+
+func (f *fake) read(t *testing.T, name string) string {
+	b, err := ioutil.ReadFile(filepath.Join(f.dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestReboot(t *testing.T) {
+	f := newFake(t, nil)
+	defer os.RemoveAll(f.dir)
+
+	if err := Reboot(); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetRebootMode(Warm, EFI); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.read(t, "reboot/mode"); got != "warm" {
+		t.Errorf("reboot mode = %q, want warm", got)
+	}
+	if got := f.read(t, "reboot/type"); got != "efi" {
+		t.Errorf("reboot type = %q, want efi", got)
+	}
+	if err := Reboot(); err != nil {
+		t.Fatal(err)
+	}
+	if err := PowerOff(); err != nil {
+		t.Fatal(err)
+	}
+
+	wantActions := []ipmi.OSAction{ipmi.OSColdReset, ipmi.OSWarmReset, ipmi.OSPowerOff}
+	wantReboots := []int{unix.LINUX_REBOOT_CMD_RESTART, unix.LINUX_REBOOT_CMD_RESTART, unix.LINUX_REBOOT_CMD_POWER_OFF}
+	if !reflect.DeepEqual(f.actions, wantActions) {
+		t.Errorf("logged %v, want %v", f.actions, wantActions)
+	}
+	if !reflect.DeepEqual(f.reboots, wantReboots) {
+		t.Errorf("rebooted with %#x, want %#x", f.reboots, wantReboots)
+	}
+
+	rebootDir = filepath.Join(f.dir, "old-kernel")
+	if err := SetRebootMode(Cold, ""); err == nil {
+		t.Error("SetRebootMode without /sys/kernel/reboot did not fail")
+	}
+}
+
+func TestSleep(t *testing.T) {
+	f := newFake(t, map[string]string{"power/mem_sleep": "[s2idle]\n"})
+	defer os.RemoveAll(f.dir)
+
+	if err := Sleep(); err == nil || !strings.Contains(err.Error(), "only s2idle") {
+		t.Errorf("Sleep with s2idle only = %v", err)
+	}
+	if len(f.actions) != 0 {
+		t.Errorf("Sleep that failed logged %v", f.actions)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(f.dir, "power/mem_sleep"), []byte("[s2idle] deep\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Sleep(); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.read(t, "power/mem_sleep"); got != "deep" {
+		t.Errorf("mem_sleep = %q, want deep", got)
+	}
+	if got := f.read(t, "power/state"); got != "mem" {
+		t.Errorf("state = %q, want mem", got)
+	}
+	if len(f.actions) != 1 || f.actions[0] != ipmi.OSSleep {
+		t.Errorf("logged %v, want S3", f.actions)
+	}
+}
+
+func TestHibernate(t *testing.T) {
+	const swapHeader = "Filename\t\t\t\tType\t\tSize\t\tUsed\t\tPriority\n"
+	for _, tt := range []struct {
+		name  string
+		files map[string]string
+		err   string
+	}{
+		{
+			name:  "no disk state",
+			files: map[string]string{"power/state": "freeze mem\n"},
+			err:   "the kernel cannot hibernate",
+		},
+		{
+			name:  "no resume device",
+			files: map[string]string{"power/state": "freeze mem disk\n", "power/resume": "0:0\n"},
+			err:   "no resume device",
+		},
+		{
+			name: "too little swap",
+			files: map[string]string{
+				"power/state":  "freeze mem disk\n",
+				"power/resume": "8:2\n",
+				"swaps":        swapHeader + "/dev/sda2 partition 1000 600 -2\n",
+				"meminfo":      "MemTotal: 8000 kB\nActive(anon): 500 kB\n",
+			},
+			err: "400 kB of free swap is less than the 500 kB",
+		},
+		{
+			name: "ok",
+			files: map[string]string{
+				"power/state":  "freeze mem disk\n",
+				"power/resume": "8:2\n",
+				"swaps":        swapHeader + "/dev/sda2 partition 1000 600 -2\n/swapfile file 1000 0 -3\n",
+				"meminfo":      "MemTotal: 8000 kB\nActive(anon): 500 kB\n",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFake(t, tt.files)
+			defer os.RemoveAll(f.dir)
+
+			err := Hibernate()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Hibernate = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := f.read(t, "power/state"); got != "disk" {
+				t.Errorf("state = %q, want disk", got)
+			}
+			if len(f.actions) != 1 || f.actions[0] != ipmi.OSHibernate {
+				t.Errorf("logged %v, want S4", f.actions)
+			}
+		})
+	}
+}
@@ -182,6 +182,20 @@ func (i *Info) GetIPMIDeviceInfo() ([]*IPMIDeviceInfo, error) {
 	return res, nil
 }
 
+// GetManagementControllerHostInterfaces returns all the Management Controller
+// Host Interface (type 42) tables present.
+func (i *Info) GetManagementControllerHostInterfaces() ([]*ManagementControllerHostInterface, error) {
+	var res []*ManagementControllerHostInterface
+	for _, t := range i.GetTablesByType(TableTypeManagementControllerHostInterface) {
+		d, err := NewManagementControllerHostInterface(t)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, d)
+	}
+	return res, nil
+}
+
 // GetTPMDevices returns all the TPM Device (type 43) tables present.
 func (i *Info) GetTPMDevices() ([]*TPMDevice, error) {
 	var res []*TPMDevice
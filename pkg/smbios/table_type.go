@@ -14,17 +14,18 @@ type TableType uint8
 
 // Supported table types.
 const (
-	TableTypeBIOSInfo       TableType = 0
-	TableTypeSystemInfo     TableType = 1
-	TableTypeBaseboardInfo  TableType = 2
-	TableTypeChassisInfo    TableType = 3
-	TableTypeProcessorInfo  TableType = 4
-	TableTypeCacheInfo      TableType = 7
-	TableTypeMemoryDevice   TableType = 17
-	TableTypeIPMIDeviceInfo TableType = 38
-	TableTypeTPMDevice      TableType = 43
-	TableTypeInactive       TableType = 126
-	TableTypeEndOfTable     TableType = 127
+	TableTypeBIOSInfo                          TableType = 0
+	TableTypeSystemInfo                        TableType = 1
+	TableTypeBaseboardInfo                     TableType = 2
+	TableTypeChassisInfo                       TableType = 3
+	TableTypeProcessorInfo                     TableType = 4
+	TableTypeCacheInfo                         TableType = 7
+	TableTypeMemoryDevice                      TableType = 17
+	TableTypeIPMIDeviceInfo                    TableType = 38
+	TableTypeManagementControllerHostInterface TableType = 42
+	TableTypeTPMDevice                         TableType = 43
+	TableTypeInactive                          TableType = 126
+	TableTypeEndOfTable                        TableType = 127
 )
 
 func (t TableType) String() string {
@@ -45,6 +46,8 @@ func (t TableType) String() string {
 		return "Memory Device"
 	case TableTypeIPMIDeviceInfo:
 		return "IPMI Device Information"
+	case TableTypeManagementControllerHostInterface:
+		return "Management Controller Host Interface"
 	case TableTypeTPMDevice:
 		return "TPM Device"
 	case TableTypeInactive:
@@ -78,6 +81,8 @@ func ParseTypedTable(t *Table) (fmt.Stringer, error) {
 		return NewMemoryDevice(t)
 	case TableTypeIPMIDeviceInfo: // 38
 		return ParseIPMIDeviceInfo(t)
+	case TableTypeManagementControllerHostInterface: // 42
+		return NewManagementControllerHostInterface(t)
 	case TableTypeTPMDevice: // 43
 		return NewTPMDevice(t)
 	case TableTypeInactive: // 126
@@ -0,0 +1,394 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package smbios
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"unicode/utf16"
+)
+
+// ManagementControllerHostInterface is defined in DSP0134 7.43.
+type ManagementControllerHostInterface struct {
+	Table
+	InterfaceType HostInterfaceType // 04h
+	InterfaceData []byte            // 06h
+	Protocols     []HostInterfaceProtocol
+}
+
+// HostInterfaceProtocol is a protocol record of a Management Controller Host
+// Interface, defined in DSP0134 7.43.2.
+type HostInterfaceProtocol struct {
+	Type HostInterfaceProtocolType
+	Data []byte
+}
+
+// NewManagementControllerHostInterface parses a generic Table into
+// ManagementControllerHostInterface.
+func NewManagementControllerHostInterface(t *Table) (*ManagementControllerHostInterface, error) {
+	if t.Type != TableTypeManagementControllerHostInterface {
+		return nil, fmt.Errorf("invalid table type %d", t.Type)
+	}
+	if t.Len() < 0x06 {
+		return nil, errors.New("required fields missing")
+	}
+	hi := &ManagementControllerHostInterface{Table: *t, InterfaceType: HostInterfaceType(t.data[4])}
+	n := int(t.data[5])
+	var err error
+	if hi.InterfaceData, err = t.GetBytesAt(6, n); err != nil {
+		return nil, fmt.Errorf("interface data: %v", err)
+	}
+	// Tables of SMBIOS before 3.2 end here.
+	off := 6 + n
+	if off >= t.Len() {
+		return hi, nil
+	}
+	count := int(t.data[off])
+	off++
+	for i := 0; i < count; i++ {
+		if off+2 > t.Len() {
+			return nil, fmt.Errorf("protocol record %d is missing", i)
+		}
+		p := HostInterfaceProtocol{Type: HostInterfaceProtocolType(t.data[off])}
+		if p.Data, err = t.GetBytesAt(off+2, int(t.data[off+1])); err != nil {
+			return nil, fmt.Errorf("protocol record %d: %v", i, err)
+		}
+		hi.Protocols = append(hi.Protocols, p)
+		off += 2 + len(p.Data)
+	}
+	return hi, nil
+}
+
+func (hi *ManagementControllerHostInterface) String() string {
+	lines := []string{
+		hi.Header.String(),
+		fmt.Sprintf("Host Interface Type: %s", hi.InterfaceType),
+	}
+	if hi.InterfaceType == HostInterfaceTypeNetwork {
+		if ni, err := hi.NetworkInterface(); err != nil {
+			lines = append(lines, fmt.Sprintf("Device Type: %s", outOfSpec))
+		} else {
+			lines = append(lines, ni.String())
+		}
+	} else if len(hi.InterfaceData) > 0 {
+		lines = append(lines, fmt.Sprintf("Interface Data: % x", hi.InterfaceData))
+	}
+	for _, p := range hi.Protocols {
+		lines = append(lines, fmt.Sprintf("\tProtocol ID: %02x (%s)", uint8(p.Type), p.Type))
+		if p.Type != HostInterfaceProtocolRedfishOverIP {
+			continue
+		}
+		if r, err := p.RedfishOverIP(); err != nil {
+			lines = append(lines, "\t\t"+outOfSpec)
+		} else {
+			lines = append(lines, r.String())
+		}
+	}
+	return strings.Join(lines, "\n\t")
+}
+
+// HostInterfaceType is defined in DSP0134 7.43.1 by reference to DSP0239.
+type HostInterfaceType uint8
+
+// HostInterfaceType values are defined in DSP0239 table 1.
+const (
+	HostInterfaceTypeKCS     HostInterfaceType = 0x02 // KCS: Keyboard Controller Style
+	HostInterfaceType8250    HostInterfaceType = 0x03 // 8250 UART Register Compatible
+	HostInterfaceType16450   HostInterfaceType = 0x04 // 16450 UART Register Compatible
+	HostInterfaceType16550   HostInterfaceType = 0x05 // 16550/16550A UART Register Compatible
+	HostInterfaceType16650   HostInterfaceType = 0x06 // 16650/16650A UART Register Compatible
+	HostInterfaceType16750   HostInterfaceType = 0x07 // 16750/16750A UART Register Compatible
+	HostInterfaceType16850   HostInterfaceType = 0x08 // 16850/16850A UART Register Compatible
+	HostInterfaceTypeNetwork HostInterfaceType = 0x40 // Network Host Interface
+	HostInterfaceTypeOEM     HostInterfaceType = 0xF0 // OEM-defined
+)
+
+func (v HostInterfaceType) String() string {
+	names := map[HostInterfaceType]string{
+		HostInterfaceTypeKCS:     "KCS: Keyboard Controller Style",
+		HostInterfaceType8250:    "8250 UART Register Compatible",
+		HostInterfaceType16450:   "16450 UART Register Compatible",
+		HostInterfaceType16550:   "16550/16550A UART Register Compatible",
+		HostInterfaceType16650:   "16650/16650A UART Register Compatible",
+		HostInterfaceType16750:   "16750/16750A UART Register Compatible",
+		HostInterfaceType16850:   "16850/16850A UART Register Compatible",
+		HostInterfaceTypeNetwork: "Network",
+		HostInterfaceTypeOEM:     "OEM",
+	}
+	if name, ok := names[v]; ok {
+		return name
+	}
+	return fmt.Sprintf("%#x", uint8(v))
+}
+
+// HostInterfaceProtocolType is defined in DSP0134 7.43.2.
+type HostInterfaceProtocolType uint8
+
+// HostInterfaceProtocolType values are defined in DSP0134 table 136.
+const (
+	HostInterfaceProtocolIPMI          HostInterfaceProtocolType = 0x02 // IPMI
+	HostInterfaceProtocolMCTP          HostInterfaceProtocolType = 0x03 // MCTP
+	HostInterfaceProtocolRedfishOverIP HostInterfaceProtocolType = 0x04 // Redfish over IP
+	HostInterfaceProtocolOEM           HostInterfaceProtocolType = 0xF0 // OEM-defined
+)
+
+func (v HostInterfaceProtocolType) String() string {
+	names := map[HostInterfaceProtocolType]string{
+		HostInterfaceProtocolIPMI:          "IPMI",
+		HostInterfaceProtocolMCTP:          "MCTP",
+		HostInterfaceProtocolRedfishOverIP: "Redfish over IP",
+		HostInterfaceProtocolOEM:           "OEM",
+	}
+	if name, ok := names[v]; ok {
+		return name
+	}
+	return "Reserved"
+}
+
+// HostInterfaceDeviceType is the device type of a Network Host Interface,
+// defined in DSP0270 8.1.
+type HostInterfaceDeviceType uint8
+
+// HostInterfaceDeviceType values are defined in DSP0270 table 2.
+const (
+	HostInterfaceDeviceUSB   HostInterfaceDeviceType = 0x02 // USB Network Interface
+	HostInterfaceDevicePCI   HostInterfaceDeviceType = 0x03 // PCI/PCIe Network Interface
+	HostInterfaceDeviceUSBv2 HostInterfaceDeviceType = 0x04 // USB Network Interface v2
+	HostInterfaceDevicePCIv2 HostInterfaceDeviceType = 0x05 // PCI/PCIe Network Interface v2
+)
+
+func (v HostInterfaceDeviceType) String() string {
+	switch v {
+	case HostInterfaceDeviceUSB, HostInterfaceDeviceUSBv2:
+		return "USB"
+	case HostInterfaceDevicePCI, HostInterfaceDevicePCIv2:
+		return "PCI/PCIe"
+	}
+	if v >= 0x80 {
+		return "OEM"
+	}
+	return "Unknown"
+}
+
+// NetworkHostInterface is the device a Network Host Interface is on,
+// defined in DSP0270 8.1.
+type NetworkHostInterface struct {
+	DeviceType HostInterfaceDeviceType
+	// VendorID and ProductID are USB or PCI IDs; for PCI, ProductID is
+	// the device ID.
+	VendorID          uint16
+	ProductID         uint16
+	SubsystemVendorID uint16 // PCI
+	SubsystemID       uint16 // PCI
+	SerialNumber      string // USB
+	// MAC is the hardware address of v2 devices.
+	MAC net.HardwareAddr
+}
+
+// NetworkInterface decodes the device of a Network Host Interface.
+func (hi *ManagementControllerHostInterface) NetworkInterface() (*NetworkHostInterface, error) {
+	if hi.InterfaceType != HostInterfaceTypeNetwork {
+		return nil, fmt.Errorf("host interface type is %s, not network", hi.InterfaceType)
+	}
+	d := hi.InterfaceData
+	if len(d) < 1 {
+		return nil, errors.New("no device type")
+	}
+	ni := &NetworkHostInterface{DeviceType: HostInterfaceDeviceType(d[0])}
+	d = d[1:]
+	short := fmt.Errorf("%s device descriptor of %d bytes is too short", ni.DeviceType, len(d))
+	le := binary.LittleEndian
+	switch ni.DeviceType {
+	case HostInterfaceDeviceUSB:
+		if len(d) < 4 {
+			return nil, short
+		}
+		ni.VendorID, ni.ProductID = le.Uint16(d[0:2]), le.Uint16(d[2:4])
+		// The serial number is a USB string descriptor, in UTF-16.
+		if len(d) >= 6 && int(d[4]) >= 2 && len(d) >= 4+int(d[4]) {
+			s := d[6 : 4+int(d[4])]
+			u := make([]uint16, len(s)/2)
+			for i := range u {
+				u[i] = le.Uint16(s[2*i:])
+			}
+			ni.SerialNumber = string(utf16.Decode(u))
+		}
+	case HostInterfaceDevicePCI:
+		if len(d) < 8 {
+			return nil, short
+		}
+		ni.VendorID, ni.ProductID = le.Uint16(d[0:2]), le.Uint16(d[2:4])
+		ni.SubsystemVendorID, ni.SubsystemID = le.Uint16(d[4:6]), le.Uint16(d[6:8])
+	case HostInterfaceDeviceUSBv2:
+		if len(d) < 12 {
+			return nil, short
+		}
+		ni.VendorID, ni.ProductID = le.Uint16(d[1:3]), le.Uint16(d[3:5])
+		// The serial number is an SMBIOS string, at 0Ch of the table.
+		if d[5] != 0 {
+			ni.SerialNumber, _ = hi.GetStringAt(0x0C)
+		}
+		ni.MAC = net.HardwareAddr(append([]byte(nil), d[6:12]...))
+	case HostInterfaceDevicePCIv2:
+		if len(d) < 15 {
+			return nil, short
+		}
+		ni.VendorID, ni.ProductID = le.Uint16(d[1:3]), le.Uint16(d[3:5])
+		ni.SubsystemVendorID, ni.SubsystemID = le.Uint16(d[5:7]), le.Uint16(d[7:9])
+		ni.MAC = net.HardwareAddr(append([]byte(nil), d[9:15]...))
+	}
+	return ni, nil
+}
+
+func (ni *NetworkHostInterface) String() string {
+	lines := []string{fmt.Sprintf("Device Type: %s", ni.DeviceType)}
+	switch ni.DeviceType {
+	case HostInterfaceDeviceUSB, HostInterfaceDeviceUSBv2:
+		lines = append(lines,
+			fmt.Sprintf("\tidVendor: 0x%04x", ni.VendorID),
+			fmt.Sprintf("\tidProduct: 0x%04x", ni.ProductID),
+		)
+		if ni.SerialNumber != "" {
+			lines = append(lines, fmt.Sprintf("\tSerial Number: %s", ni.SerialNumber))
+		}
+	case HostInterfaceDevicePCI, HostInterfaceDevicePCIv2:
+		lines = append(lines,
+			fmt.Sprintf("\tVendorID: 0x%04x", ni.VendorID),
+			fmt.Sprintf("\tDeviceID: 0x%04x", ni.ProductID),
+			fmt.Sprintf("\tSubVendorID: 0x%04x", ni.SubsystemVendorID),
+			fmt.Sprintf("\tSubDeviceID: 0x%04x", ni.SubsystemID),
+		)
+	}
+	if ni.MAC != nil {
+		lines = append(lines, fmt.Sprintf("\tMAC: %s", ni.MAC))
+	}
+	return strings.Join(lines, "\n\t")
+}
+
+// HostIPAssignmentType is how an address of a Redfish over IP record is
+// assigned, defined in DSP0270 table 5.
+type HostIPAssignmentType uint8
+
+// HostIPAssignmentType values are defined in DSP0270 table 5.
+const (
+	HostIPAssignmentUnknown      HostIPAssignmentType = 0x00
+	HostIPAssignmentStatic       HostIPAssignmentType = 0x01
+	HostIPAssignmentDHCP         HostIPAssignmentType = 0x02
+	HostIPAssignmentAutoConfig   HostIPAssignmentType = 0x03
+	HostIPAssignmentHostSelected HostIPAssignmentType = 0x04
+)
+
+func (v HostIPAssignmentType) String() string {
+	names := map[HostIPAssignmentType]string{
+		HostIPAssignmentUnknown:      "Unknown",
+		HostIPAssignmentStatic:       "Static",
+		HostIPAssignmentDHCP:         "DHCP",
+		HostIPAssignmentAutoConfig:   "AutoConf",
+		HostIPAssignmentHostSelected: "Host Selected",
+	}
+	if name, ok := names[v]; ok {
+		return name
+	}
+	return outOfSpec
+}
+
+// RedfishOverIP is the data of a Redfish over IP protocol record, defined
+// in DSP0270 8.2.
+type RedfishOverIP struct {
+	ServiceUUID UUID
+
+	// HostIPAssignment is how the host side of the interface gets its
+	// address, HostIP and HostMask if it is static.
+	HostIPAssignment HostIPAssignmentType
+	HostIP           net.IP
+	HostMask         net.IPMask
+
+	// ServiceIPDiscovery is how the Redfish service gets its address.
+	ServiceIPDiscovery HostIPAssignmentType
+	ServiceIP          net.IP
+	ServiceMask        net.IPMask
+	ServicePort        uint16
+	ServiceVLAN        uint32
+	ServiceHostname    string
+}
+
+// hostInterfaceIP decodes an address of format f, 1 for IPv4 and 2 for
+// IPv6, from b.
+func hostInterfaceIP(f byte, b []byte) net.IP {
+	switch f {
+	case 1:
+		return net.IPv4(b[0], b[1], b[2], b[3])
+	case 2:
+		return net.IP(append([]byte(nil), b[:16]...))
+	}
+	return nil
+}
+
+func hostInterfaceMask(f byte, b []byte) net.IPMask {
+	switch f {
+	case 1:
+		return net.IPv4Mask(b[0], b[1], b[2], b[3])
+	case 2:
+		return net.IPMask(append([]byte(nil), b[:16]...))
+	}
+	return nil
+}
+
+// RedfishOverIP decodes a Redfish over IP protocol record.
+func (p *HostInterfaceProtocol) RedfishOverIP() (*RedfishOverIP, error) {
+	if p.Type != HostInterfaceProtocolRedfishOverIP {
+		return nil, fmt.Errorf("protocol is %s, not Redfish over IP", p.Type)
+	}
+	d := p.Data
+	if len(d) < 91 {
+		return nil, fmt.Errorf("Redfish over IP record of %d bytes is too short", len(d))
+	}
+	r := &RedfishOverIP{
+		HostIPAssignment:   HostIPAssignmentType(d[16]),
+		HostIP:             hostInterfaceIP(d[17], d[18:34]),
+		HostMask:           hostInterfaceMask(d[17], d[34:50]),
+		ServiceIPDiscovery: HostIPAssignmentType(d[50]),
+		ServiceIP:          hostInterfaceIP(d[51], d[52:68]),
+		ServiceMask:        hostInterfaceMask(d[51], d[68:84]),
+		ServicePort:        binary.LittleEndian.Uint16(d[84:86]),
+		ServiceVLAN:        binary.LittleEndian.Uint32(d[86:90]),
+	}
+	copy(r.ServiceUUID[:], d[0:16])
+	n := int(d[90])
+	if len(d) < 91+n {
+		return nil, fmt.Errorf("Redfish service hostname of %d bytes is cut short", n)
+	}
+	r.ServiceHostname = strings.TrimRight(string(d[91:91+n]), "\x00")
+	return r, nil
+}
+
+func (r *RedfishOverIP) String() string {
+	lines := []string{
+		fmt.Sprintf("\tService UUID: %s", r.ServiceUUID),
+		fmt.Sprintf("\tHost IP Assignment Type: %s", r.HostIPAssignment),
+	}
+	if r.HostIP != nil {
+		lines = append(lines,
+			fmt.Sprintf("\tHost IP Address: %s", r.HostIP),
+			fmt.Sprintf("\tHost IP Mask: %s", net.IP(r.HostMask)),
+		)
+	}
+	lines = append(lines, fmt.Sprintf("\tRedfish Service IP Discovery Type: %s", r.ServiceIPDiscovery))
+	if r.ServiceIP != nil {
+		lines = append(lines,
+			fmt.Sprintf("\tRedfish Service IP Address: %s", r.ServiceIP),
+			fmt.Sprintf("\tRedfish Service IP Mask: %s", net.IP(r.ServiceMask)),
+		)
+	}
+	lines = append(lines,
+		fmt.Sprintf("\tRedfish Service Port: %d", r.ServicePort),
+		fmt.Sprintf("\tRedfish Service Vlan: %d", r.ServiceVLAN),
+		fmt.Sprintf("\tRedfish Service Hostname: %s", r.ServiceHostname),
+	)
+	return "\t" + strings.Join(lines, "\n\t\t")
+}
@@ -0,0 +1,96 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package swap makes and enables swap areas, on block devices, files or
+// zram.
+package swap
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"github.com/u-root/u-root/pkg/ubinary"
+)
+
+// The swap header, union swap_header from include/linux/swap.h: a page
+// ending in the magic, with the header proper after 1024 bytes of boot
+// block.
+const (
+	magic       = "SWAPSPACE2"
+	headerOff   = 1024
+	version     = 1
+	uuidOff     = headerOff + 12
+	labelOff    = uuidOff + 16
+	maxLabelLen = 16
+
+	// MinPages is the smallest swap area mkswap makes, in pages.
+	MinPages = 10
+)
+
+// Header is what a swap header says about a swap area.
+type Header struct {
+	// Pages is the size of the area in pages, with the header page.
+	Pages uint32
+
+	UUID  [16]byte
+	Label string
+}
+
+// Format writes a swap header for an area of size bytes, in pages of
+// pageSize, to w. The rest of the area need not be cleared.
+func Format(w io.WriterAt, size int64, pageSize int, h *Header) error {
+	if pageSize < headerOff*2 || pageSize&(pageSize-1) != 0 {
+		return fmt.Errorf("bad page size %d", pageSize)
+	}
+	pages := size / int64(pageSize)
+	if pages < MinPages {
+		return fmt.Errorf("swap area of %d bytes is less than %d pages", size, MinPages)
+	}
+	if pages-1 > 1<<32-1 {
+		return fmt.Errorf("swap area of %d bytes is too big", size)
+	}
+	if len(h.Label) > maxLabelLen {
+		return fmt.Errorf("label %q is longer than %d bytes", h.Label, maxLabelLen)
+	}
+	h.Pages = uint32(pages)
+
+	b := make([]byte, pageSize)
+	ne := ubinary.NativeEndian
+	ne.PutUint32(b[headerOff:], version)
+	ne.PutUint32(b[headerOff+4:], uint32(pages-1))
+	copy(b[uuidOff:], h.UUID[:])
+	copy(b[labelOff:], h.Label)
+	copy(b[pageSize-len(magic):], magic)
+	if _, err := w.WriteAt(b, 0); err != nil {
+		return fmt.Errorf("writing swap header: %v", err)
+	}
+	return nil
+}
+
+// ReadHeader reads the swap header of an area with pages of pageSize.
+func ReadHeader(r io.ReaderAt, pageSize int) (*Header, error) {
+	if pageSize < headerOff*2 {
+		return nil, fmt.Errorf("bad page size %d", pageSize)
+	}
+	b := make([]byte, pageSize)
+	if _, err := r.ReadAt(b, 0); err != nil {
+		return nil, fmt.Errorf("reading swap header: %v", err)
+	}
+	if m := string(b[pageSize-len(magic):]); m != magic {
+		return nil, fmt.Errorf("no swap signature")
+	}
+	ne := ubinary.NativeEndian
+	if v := ne.Uint32(b[headerOff:]); v != version {
+		return nil, fmt.Errorf("unsupported swap header version %d", v)
+	}
+	h := &Header{Pages: ne.Uint32(b[headerOff+4:]) + 1}
+	copy(h.UUID[:], b[uuidOff:])
+	label := b[labelOff : labelOff+maxLabelLen]
+	if i := bytes.IndexByte(label, 0); i >= 0 {
+		label = label[:i]
+	}
+	h.Label = string(label)
+	return h, nil
+}
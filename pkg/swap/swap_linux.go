@@ -0,0 +1,218 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package swap
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"github.com/u-root/u-root/pkg/mount"
+	"github.com/u-root/u-root/pkg/mount/zram"
+	"golang.org/x/sys/unix"
+)
+
+var procSwaps = "/proc/swaps"
+
+// swapon(2) flags, from include/linux/swap.h.
+const (
+	swapFlagPrefer   = 0x8000
+	swapFlagPrioMask = 0x7fff
+	swapFlagDiscard  = 0x10000
+)
+
+// DefaultPriority has the kernel pick a swap area's priority: lower than
+// that of all areas enabled before.
+const DefaultPriority = -1
+
+// Options are how an area is enabled.
+type Options struct {
+	// Priority is from 0 to 32767; areas of higher priority are used
+	// first. DefaultPriority, or any negative value, leaves it to the
+	// kernel.
+	Priority int
+
+	// Discard has the kernel discard freed swap pages, for SSDs and
+	// zram.
+	Discard bool
+}
+
+// MakeFile makes a swap file at path of size bytes, and formats it. Swap
+// files must not have holes, so it is written out in full.
+func MakeFile(path string, size int64, h *Header) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	zero := make([]byte, 1<<20)
+	for n := size; n > 0; n -= int64(len(zero)) {
+		if n < int64(len(zero)) {
+			zero = zero[:n]
+		}
+		if _, err := f.Write(zero); err != nil {
+			f.Close()
+			os.Remove(path)
+			return err
+		}
+	}
+	if err := Format(f, size, os.Getpagesize(), h); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// MakeDevice formats the block device or file at path as swap, all of it.
+// Like mkswap, it opens block devices exclusively, so the kernel refuses
+// those that are mounted, in use as swap or holding partitions.
+func MakeDevice(path string, h *Header) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	flags := os.O_RDWR
+	if fi.Mode()&os.ModeDevice != 0 && fi.Mode()&os.ModeCharDevice == 0 {
+		flags |= os.O_EXCL
+	}
+	f, err := os.OpenFile(path, flags, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	if err := Format(f, size, os.Getpagesize(), h); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return f.Sync()
+}
+
+// On enables the swap area at path, which must have been formatted.
+func On(path string, o Options) error {
+	var flags uintptr
+	if o.Priority >= 0 {
+		if o.Priority > swapFlagPrioMask {
+			return fmt.Errorf("swap priority %d is more than %d", o.Priority, swapFlagPrioMask)
+		}
+		flags |= swapFlagPrefer | uintptr(o.Priority)
+	}
+	if o.Discard {
+		flags |= swapFlagDiscard
+	}
+	p, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_SWAPON, uintptr(unsafe.Pointer(p)), flags, 0); errno != 0 {
+		return &os.PathError{Op: "swapon", Path: path, Err: errno}
+	}
+	return nil
+}
+
+// Off disables the swap area at path. Pages swapped out to it are read
+// back in, which needs as much free memory.
+func Off(path string) error {
+	p, err := unix.BytePtrFromString(path)
+	if err != nil {
+		return err
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_SWAPOFF, uintptr(unsafe.Pointer(p)), 0, 0); errno != 0 {
+		return &os.PathError{Op: "swapoff", Path: path, Err: errno}
+	}
+	return nil
+}
+
+// Area is an enabled swap area, as listed in /proc/swaps.
+type Area struct {
+	// Path is the device or file.
+	Path string
+
+	// Type is "partition" or "file".
+	Type string
+
+	// Size and Used are in bytes.
+	Size int64
+	Used int64
+
+	Priority int
+}
+
+// Areas returns the enabled swap areas.
+func Areas() ([]Area, error) {
+	f, err := os.Open(procSwaps)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseSwaps(f)
+}
+
+func parseSwaps(r io.Reader) ([]Area, error) {
+	var areas []Area
+	s := bufio.NewScanner(r)
+	// Skip the heading.
+	s.Scan()
+	for s.Scan() {
+		f := strings.Fields(s.Text())
+		if len(f) != 5 {
+			return nil, fmt.Errorf("bad %s line %q", procSwaps, s.Text())
+		}
+		var v [3]int64
+		for i := range v {
+			n, err := strconv.ParseInt(f[2+i], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("bad %s line %q", procSwaps, s.Text())
+			}
+			v[i] = n
+		}
+		// Sizes are in KiB.
+		areas = append(areas, Area{Path: mount.Unescape(f[0]), Type: f[1], Size: v[0] << 10, Used: v[1] << 10, Priority: int(v[2])})
+	}
+	return areas, s.Err()
+}
+
+// Zram is swap in a zram device, compressed in memory. It lets a machine
+// hold more than its memory when what it holds compresses well, at the
+// cost of CPU.
+type Zram struct {
+	*zram.Device
+}
+
+// ZramPriority is a priority for zram swap that puts it before swap on
+// disk, which is much slower.
+const ZramPriority = 100
+
+// OnZram sets up a zram device of size bytes, compressed with algorithm or
+// the kernel's default if it is "", and enables it as swap with o.
+func OnZram(size int64, algorithm string, o Options) (*Zram, error) {
+	d, err := zram.New(size, algorithm)
+	if err != nil {
+		return nil, err
+	}
+	if err := MakeDevice(d.Path(), &Header{Label: d.Name}); err != nil {
+		d.Free()
+		return nil, err
+	}
+	if err := On(d.Path(), o); err != nil {
+		d.Free()
+		return nil, err
+	}
+	return &Zram{d}, nil
+}
+
+// Off disables the swap and frees the zram device.
+func (z *Zram) Off() error {
+	if err := Off(z.Path()); err != nil {
+		return err
+	}
+	return z.Free()
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package swap
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseSwaps(t *testing.T) {
+	got, err := parseSwaps(strings.NewReader(`Filename				Type		Size		Used		Priority
+/dev/sda2                               partition	8388604		1024		-2
+/dev/zram0                              partition	2097148		0		100
+/swap\040file                           file		1048572		0		-3
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Area{
+		{Path: "/dev/sda2", Type: "partition", Size: 8388604 << 10, Used: 1 << 20, Priority: -2},
+		{Path: "/dev/zram0", Type: "partition", Size: 2097148 << 10, Priority: 100},
+		{Path: "/swap file", Type: "file", Size: 1048572 << 10, Priority: -3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSwaps = %+v, want %+v", got, want)
+	}
+
+	if _, err := parseSwaps(strings.NewReader("Filename\n/dev/sda2 partition 8 x -2\n")); err == nil {
+		t.Errorf("parseSwaps of bad line = nil, want error")
+	}
+}
+
+func TestMakeFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "swap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "swapfile")
+	size := int64(32 * os.Getpagesize())
+	if err := MakeFile(path, size, &Header{Label: "test"}); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Size() != size || fi.Mode().Perm() != 0600 {
+		t.Errorf("swap file is %d bytes, mode %v; want %d, %v", fi.Size(), fi.Mode().Perm(), size, os.FileMode(0600))
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	h, err := ReadHeader(f, os.Getpagesize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Pages != 32 || h.Label != "test" {
+		t.Errorf("ReadHeader = %+v, want 32 pages labelled test", h)
+	}
+
+	if err := MakeFile(path, size, &Header{}); err == nil {
+		t.Errorf("MakeFile over an existing file = nil, want error")
+	}
+
+	// Files are not opened exclusively, as block devices are.
+	if err := MakeDevice(path, &Header{Label: "again"}); err != nil {
+		t.Fatalf("MakeDevice(%s) = %v, want nil", path, err)
+	}
+	if h, err := ReadHeader(f, os.Getpagesize()); err != nil || h.Label != "again" {
+		t.Errorf("ReadHeader after MakeDevice = %+v, %v; want label again", h, err)
+	}
+}
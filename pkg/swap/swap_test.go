@@ -0,0 +1,71 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package swap
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// buffer is an io.WriterAt and io.ReaderAt over a fixed size area.
+type buffer []byte
+
+func (b buffer) WriteAt(p []byte, off int64) (int, error) {
+	return copy(b[off:], p), nil
+}
+
+func (b buffer) ReadAt(p []byte, off int64) (int, error) {
+	return copy(p, b[off:]), nil
+}
+
+func TestFormat(t *testing.T) {
+	const pageSize = 4096
+	b := make(buffer, 16*pageSize)
+	h := &Header{UUID: [16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}, Label: "scratch"}
+	// A partial page at the end is left out.
+	if err := Format(b, int64(len(b))+100, pageSize, h); err != nil {
+		t.Fatal(err)
+	}
+	if h.Pages != 16 {
+		t.Errorf("Format set Pages to %d, want 16", h.Pages)
+	}
+	if !bytes.Equal(b[pageSize-10:pageSize], []byte("SWAPSPACE2")) {
+		t.Errorf("no swap signature at the end of the first page")
+	}
+	// version 1, last page 15.
+	if want := []byte{1, 0, 0, 0, 15, 0, 0, 0}; !bytes.Equal(b[1024:1032], want) {
+		t.Errorf("header = %v, want %v", b[1024:1032], want)
+	}
+
+	got, err := ReadHeader(b, pageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, h) {
+		t.Errorf("ReadHeader = %+v, want %+v", got, h)
+	}
+	if _, err := ReadHeader(b, 2*pageSize); err == nil {
+		t.Errorf("ReadHeader with the wrong page size = nil, want error")
+	}
+}
+
+func TestFormatBad(t *testing.T) {
+	b := make(buffer, 64<<10)
+	for _, tt := range []struct {
+		name     string
+		size     int64
+		pageSize int
+		label    string
+	}{
+		{"small", 9 * 4096, 4096, ""},
+		{"page size", 64 << 10, 3000, ""},
+		{"label", 64 << 10, 4096, "a label that is far too long"},
+	} {
+		if err := Format(b, tt.size, tt.pageSize, &Header{Label: tt.label}); err == nil {
+			t.Errorf("Format with bad %s = nil, want error", tt.name)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package tss
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/google/go-tpm-tools/tpm2tools"
+	tpm2 "github.com/google/go-tpm/tpm2"
+)
+
+// Quote is a TPM 2.0 quote of PCRs, as the TPM encoded it.
+type Quote struct {
+	// Attest is the TPMS_ATTEST structure the TPM signed.
+	Attest []byte
+	// Signature is the TPMT_SIGNATURE of Attest.
+	Signature []byte
+	// AK is the TPMT_PUBLIC area of the key that signed Attest.
+	AK []byte
+}
+
+// quote20 quotes pcrs of bank alg with an attestation key made from the
+// ECC AIK template under the owner hierarchy. The key is the same for as
+// long as the owner seed is, so a verifier can enroll it once.
+func quote20(rw io.ReadWriter, nonce []byte, alg tpm2.Algorithm, pcrs []int) (*Quote, error) {
+	handle, pub, _, _, _, _, err := tpm2.CreatePrimaryEx(rw, tpm2.HandleOwner, tpm2.PCRSelection{}, "", "", tpm2tools.AIKTemplateECC())
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the attestation key: %v", err)
+	}
+	defer tpm2.FlushContext(rw, handle)
+
+	sel := tpm2.PCRSelection{Hash: alg, PCRs: pcrs}
+	attest, sig, err := tpm2.QuoteRaw(rw, handle, "", "", nonce, sel, tpm2.AlgNull)
+	if err != nil {
+		return nil, fmt.Errorf("failed to quote PCRs %v: %v", pcrs, err)
+	}
+	return &Quote{Attest: attest, Signature: sig, AK: pub}, nil
+}
+
+// Verify checks that q is a quote of pcrs, the digests of a PCR bank,
+// signed by its AK, with nonce. It does not check that the AK is a TPM's:
+// that is up to the verifier.
+func (q *Quote) Verify(nonce []byte, pcrs []PCR) (*tpm2.AttestationData, error) {
+	ak, err := tpm2.DecodePublic(q.AK)
+	if err != nil {
+		return nil, fmt.Errorf("decoding AK: %v", err)
+	}
+	pub, err := ak.Key()
+	if err != nil {
+		return nil, fmt.Errorf("decoding AK: %v", err)
+	}
+	sig, err := tpm2.DecodeSignature(bytes.NewBuffer(q.Signature))
+	if err != nil {
+		return nil, fmt.Errorf("decoding signature: %v", err)
+	}
+
+	switch pub := pub.(type) {
+	case *ecdsa.PublicKey:
+		if sig.ECC == nil || sig.ECC.HashAlg != tpm2.AlgSHA256 {
+			return nil, errors.New("quote is not signed with ECDSA over SHA256")
+		}
+		digest := sha256.Sum256(q.Attest)
+		if !ecdsa.Verify(pub, digest[:], sig.ECC.R, sig.ECC.S) {
+			return nil, errors.New("quote signature does not verify")
+		}
+	case *rsa.PublicKey:
+		if sig.RSA == nil || sig.RSA.HashAlg != tpm2.AlgSHA256 {
+			return nil, errors.New("quote is not signed with RSA over SHA256")
+		}
+		digest := sha256.Sum256(q.Attest)
+		if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig.RSA.Signature); err != nil {
+			return nil, fmt.Errorf("quote signature does not verify: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported AK type %T", pub)
+	}
+
+	ad, err := tpm2.DecodeAttestationData(q.Attest)
+	if err != nil {
+		return nil, fmt.Errorf("decoding quote: %v", err)
+	}
+	if ad.Type != tpm2.TagAttestQuote || ad.AttestedQuoteInfo == nil {
+		return nil, fmt.Errorf("attestation of type %#x is not a quote", ad.Type)
+	}
+	if !bytes.Equal(ad.ExtraData, nonce) {
+		return nil, fmt.Errorf("quote nonce is %x, want %x", []byte(ad.ExtraData), nonce)
+	}
+
+	// The PCR digest is the hash of the quoted PCRs, in order, with the
+	// AK's hash algorithm.
+	quoted := make(map[int]bool)
+	for _, p := range ad.AttestedQuoteInfo.PCRSelection.PCRs {
+		quoted[p] = true
+	}
+	sorted := append([]PCR(nil), pcrs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Index < sorted[j].Index })
+	h := sha256.New()
+	n := 0
+	for _, p := range sorted {
+		if quoted[p.Index] {
+			h.Write(p.Digest)
+			n++
+		}
+	}
+	if n != len(quoted) {
+		return nil, fmt.Errorf("%d of the %d quoted PCRs are missing", len(quoted)-n, len(quoted))
+	}
+	if !bytes.Equal(h.Sum(nil), ad.AttestedQuoteInfo.PCRDigest) {
+		return nil, errors.New("PCRs do not match the quote")
+	}
+	return ad, nil
+}
@@ -10,6 +10,8 @@ import (
 	"errors"
 	"fmt"
 
+	"github.com/google/go-tpm/tpm"
+	"github.com/google/go-tpm/tpm2"
 	tpmutil "github.com/google/go-tpm/tpmutil"
 )
 
@@ -224,3 +226,25 @@ func (t *TPM) NVReadValue(index uint32, ownerPassword string, size, offhandle ui
 	}
 	return nil, fmt.Errorf("unsupported TPM version: %x", t.Version)
 }
+
+// GetRandom returns up to n bytes from the TPM's random number generator.
+// TPMs may return fewer bytes than asked for.
+func (t *TPM) GetRandom(n int) ([]byte, error) {
+	switch t.Version {
+	case TPMVersion12:
+		return tpm.GetRandom(t.RWC, uint32(n))
+	case TPMVersion20:
+		return tpm2.GetRandom(t.RWC, uint16(n))
+	}
+	return nil, fmt.Errorf("unsupported TPM version: %x", t.Version)
+}
+
+// Quote quotes pcrs of bank alg, with nonce as the qualifying data. Only
+// TPM 2.0 is supported.
+func (t *TPM) Quote(nonce []byte, alg HashAlg, pcrs []int) (*Quote, error) {
+	switch t.Version {
+	case TPMVersion20:
+		return quote20(t.RWC, nonce, alg.GoTPMAlg(), pcrs)
+	}
+	return nil, fmt.Errorf("unsupported TPM version: %x", t.Version)
+}
@@ -177,6 +177,10 @@ func (e *TcgPcrEvent) PcrEventData() string {
 	return ""
 }
 
+func (e *TcgPcrEvent) RawEvent() []byte {
+	return e.event
+}
+
 func (e *TcgPcrEvent) Digests() *[]PCRDigestValue {
 	d := make([]PCRDigestValue, 1)
 	d[0].DigestAlg = TPMAlgSha
@@ -270,6 +274,10 @@ func (e *TcgPcrEvent2) PcrEventData() string {
 	return ""
 }
 
+func (e *TcgPcrEvent2) RawEvent() []byte {
+	return e.event
+}
+
 func (e *TcgPcrEvent2) Digests() *[]PCRDigestValue {
 	d := make([]PCRDigestValue, e.digests.count)
 	for i := uint32(0); i < e.digests.count; i++ {
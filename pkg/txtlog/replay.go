@@ -0,0 +1,159 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package txtlog
+
+import (
+	"bytes"
+	"crypto"
+	// Register the hashes logs are replayed with.
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"fmt"
+)
+
+// hashes are the hashes of the algorithms logs can be replayed with.
+var hashes = map[IAlgHash]crypto.Hash{
+	TPMAlgSha:    crypto.SHA1,
+	TPMAlgSha256: crypto.SHA256,
+	TPMAlgSha384: crypto.SHA384,
+	TPMAlgSha512: crypto.SHA512,
+}
+
+// startupLocality is the signature of the EV_NO_ACTION event that gives
+// the locality PCR 0 was reset in, which is its last byte then, see [4].
+const startupLocality = "StartupLocality\x00"
+
+// dataDigestEvents are the types of events whose digest is that of their
+// data, see [4].
+var dataDigestEvents = map[uint32]bool{
+	uint32(EvSeparator):               true,
+	uint32(EvAction):                  true,
+	uint32(EvEFIAction):               true,
+	uint32(EvEFIVariableDriverConfig): true,
+	uint32(EvEFIVariableAuthority):    true,
+}
+
+// Step is an event extended into a PCR in a replay.
+type Step struct {
+	// Event is the index of the event in the log.
+	Event int
+	// Value is the PCR after the event.
+	Value []byte
+	// BadDigest is set if the event's digest is not that of its data,
+	// though it should be.
+	BadDigest bool
+}
+
+// Replay is what a log says the PCRs are.
+type Replay struct {
+	Alg IAlgHash
+	// Initial and PCRs are the PCRs the log extends, before and after.
+	Initial map[int][]byte
+	PCRs    map[int][]byte
+	// Steps are the events extended into each PCR, in order.
+	Steps map[int][]Step
+}
+
+func digestOf(e PCREvent, alg IAlgHash) []byte {
+	for _, d := range *e.Digests() {
+		if d.DigestAlg == alg {
+			return d.Digest
+		}
+	}
+	return nil
+}
+
+// ReplayLog extends the alg digests of the events in l into PCRs reset to
+// zeros, PCR 0 to the startup locality, as the TPM would have.
+func ReplayLog(l *PCRLog, alg IAlgHash) (*Replay, error) {
+	h, ok := hashes[alg]
+	if !ok || !h.Available() {
+		return nil, fmt.Errorf("cannot replay the log with hash algorithm %#x", uint16(alg))
+	}
+	r := &Replay{
+		Alg:     alg,
+		Initial: make(map[int][]byte),
+		PCRs:    make(map[int][]byte),
+		Steps:   make(map[int][]Step),
+	}
+	var locality byte
+	for i, e := range l.PcrList {
+		pcr := e.PcrIndex()
+		data := e.RawEvent()
+		if BIOSLogID(e.PcrEventType()) == EvNoAction {
+			// Not extended.
+			if pcr == 0 && len(data) == len(startupLocality)+1 && string(data[:len(startupLocality)]) == startupLocality {
+				locality = data[len(startupLocality)]
+			}
+			continue
+		}
+		digest := digestOf(e, alg)
+		if len(digest) != h.Size() {
+			return nil, fmt.Errorf("event %d (PCR %d, %s) has no digest of hash algorithm %#x", i, pcr, e.PcrEventName(), uint16(alg))
+		}
+		v, ok := r.PCRs[pcr]
+		if !ok {
+			v = make([]byte, h.Size())
+			if pcr == 0 {
+				v[len(v)-1] = locality
+			}
+			r.Initial[pcr] = v
+		}
+		x := h.New()
+		x.Write(v)
+		x.Write(digest)
+		v = x.Sum(nil)
+		r.PCRs[pcr] = v
+
+		s := Step{Event: i, Value: v}
+		if dataDigestEvents[e.PcrEventType()] {
+			x := h.New()
+			x.Write(data)
+			s.BadDigest = !bytes.Equal(x.Sum(nil), digest)
+		}
+		r.Steps[pcr] = append(r.Steps[pcr], s)
+	}
+	return r, nil
+}
+
+// Divergence is how a PCR compares to what a replay says it is.
+type Divergence struct {
+	PCR int
+	// Match is set if the PCR is what the replay says.
+	Match bool
+	// Matched is the number of the PCR's steps the PCR is the value
+	// after: the events of the steps past them were logged but never
+	// extended. It is -1 if the PCR is none of the values, when an event
+	// was extended with another digest than logged, or not logged.
+	Matched int
+	// BadDigests are the steps of events with a digest that is not of
+	// their data, the likely culprits if nothing matched.
+	BadDigests []Step
+}
+
+// Check compares live, the value of PCR pcr, with the replay. PCRs the
+// log does not extend are expected to be zeros.
+func (r *Replay) Check(pcr int, live []byte) Divergence {
+	d := Divergence{PCR: pcr, Matched: -1}
+	steps := r.Steps[pcr]
+	initial, ok := r.Initial[pcr]
+	if !ok {
+		initial = make([]byte, len(live))
+	}
+	if bytes.Equal(live, initial) {
+		d.Matched = 0
+	}
+	for i, s := range steps {
+		if bytes.Equal(live, s.Value) {
+			d.Matched = i + 1
+		}
+		if s.BadDigest {
+			d.BadDigests = append(d.BadDigests, s)
+		}
+	}
+	d.Match = d.Matched == len(steps)
+	return d
+}
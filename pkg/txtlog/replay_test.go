@@ -0,0 +1,87 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package txtlog
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func event(pcr uint32, typ uint32, digest, data []byte) *TcgPcrEvent2 {
+	return &TcgPcrEvent2{
+		pcrIndex:  pcr,
+		eventType: typ,
+		digests: LDigestValues{
+			count:   1,
+			digests: []THA{{hashAlg: TPMAlgSha256, digest: IHA{hash: digest}}},
+		},
+		eventSize: uint32(len(data)),
+		event:     data,
+	}
+}
+
+func sum(b []byte) []byte {
+	s := sha256.Sum256(b)
+	return s[:]
+}
+
+func extend(pcr, digest []byte) []byte {
+	return sum(append(append([]byte(nil), pcr...), digest...))
+}
+
+func TestReplayLog(t *testing.T) {
+	sep := []byte{0, 0, 0, 0}
+	code := sum([]byte("firmware"))
+	l := &PCRLog{PcrList: []PCREvent{
+		event(0, uint32(EvNoAction), make([]byte, 32), append([]byte(startupLocality), 3)),
+		event(0, uint32(EvSCRTMContents), code, []byte("firmware")),
+		event(7, uint32(EvSeparator), sum(sep), sep),
+		event(0, uint32(EvSeparator), sum([]byte{1}), sep),
+		event(7, uint32(EvEFIAction), sum([]byte("late")), []byte("late")),
+	}}
+	r, err := ReplayLog(l, TPMAlgSha256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pcr0 := make([]byte, 32)
+	pcr0[31] = 3
+	if !bytes.Equal(r.Initial[0], pcr0) {
+		t.Errorf("PCR 0 starts as %x, want locality 3", r.Initial[0])
+	}
+	pcr0 = extend(pcr0, code)
+	afterCode := pcr0
+	pcr0 = extend(pcr0, sum([]byte{1}))
+	pcr7 := extend(make([]byte, 32), sum(sep))
+	afterSep := pcr7
+	pcr7 = extend(pcr7, sum([]byte("late")))
+	if !bytes.Equal(r.PCRs[0], pcr0) || !bytes.Equal(r.PCRs[7], pcr7) {
+		t.Errorf("PCRs 0 and 7 = %x, %x, want %x, %x", r.PCRs[0], r.PCRs[7], pcr0, pcr7)
+	}
+	if len(r.Steps[0]) != 2 || !r.Steps[0][1].BadDigest || r.Steps[0][0].BadDigest || r.Steps[7][0].BadDigest {
+		t.Errorf("PCR 0 steps = %+v, want the separator with a bad digest", r.Steps[0])
+	}
+
+	if d := r.Check(7, pcr7); !d.Match || d.Matched != 2 {
+		t.Errorf("Check(7) of the replayed value = %+v, want a match", d)
+	}
+	if d := r.Check(7, afterSep); d.Match || d.Matched != 1 {
+		t.Errorf("Check(7) without the last event = %+v, want 1 matched", d)
+	}
+	if d := r.Check(0, afterCode); d.Match || d.Matched != 1 || len(d.BadDigests) != 1 || d.BadDigests[0].Event != 3 {
+		t.Errorf("Check(0) without the separator = %+v, want 1 matched and event 3 bad", d)
+	}
+	if d := r.Check(0, sum([]byte("other"))); d.Match || d.Matched != -1 {
+		t.Errorf("Check(0) of another value = %+v, want no match", d)
+	}
+	if d := r.Check(8, make([]byte, 32)); !d.Match {
+		t.Errorf("Check(8) of zeros = %+v, want a match", d)
+	}
+
+	if _, err := ReplayLog(l, TPMAlgSha); err == nil {
+		t.Error("ReplayLog without SHA1 digests did not fail")
+	}
+}
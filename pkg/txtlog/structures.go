@@ -185,6 +185,7 @@ type PCREvent interface {
 	PcrEventType() uint32
 	PcrEventName() string
 	PcrEventData() string
+	RawEvent() []byte
 	Digests() *[]PCRDigestValue
 	String() string
 }
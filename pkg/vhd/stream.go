@@ -0,0 +1,99 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vhd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+)
+
+// maxBuffered is how many bytes of blocks that come before the blocks
+// read ahead of them are held in memory.
+var maxBuffered int64 = 256 << 20
+
+// extent is a range of an image file.
+type extent struct {
+	off, n int64
+}
+
+// stream reads an image file front to back. Extents it is told to expect
+// are held on to when they are read past, until they are asked for.
+type stream struct {
+	r   io.Reader
+	pos int64
+
+	// want are the expected extents not yet read past, by offset.
+	want []extent
+
+	kept      map[int64][]byte
+	keptBytes int64
+}
+
+func newStream(r io.Reader) *stream {
+	return &stream{r: r, kept: make(map[int64][]byte)}
+}
+
+// expect adds extents that will be read, in any order.
+func (s *stream) expect(e ...extent) {
+	s.want = append(s.want, e...)
+	sort.Slice(s.want, func(i, j int) bool { return s.want[i].off < s.want[j].off })
+}
+
+// skip reads past the file up to off.
+func (s *stream) skip(off int64) error {
+	if n, err := io.CopyN(ioutil.Discard, s.r, off-s.pos); err != nil {
+		s.pos += n
+		return fmt.Errorf("image ends at %#x, before %#x", s.pos, off)
+	}
+	s.pos = off
+	return nil
+}
+
+// readFull reads n bytes at the current position.
+func (s *stream) readFull(n int64) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(s.r, b); err != nil {
+		return nil, fmt.Errorf("image ends in the %d bytes at %#x", n, s.pos)
+	}
+	s.pos += n
+	return b, nil
+}
+
+// read returns the n bytes at off.
+func (s *stream) read(off, n int64) ([]byte, error) {
+	if b, ok := s.kept[off]; ok && int64(len(b)) >= n {
+		delete(s.kept, off)
+		s.keptBytes -= int64(len(b))
+		return b[:n], nil
+	}
+	if off < s.pos {
+		return nil, fmt.Errorf("%d bytes at %#x are needed after they were read past: %w", n, off, ErrNotStreamable)
+	}
+	for len(s.want) > 0 && s.want[0].off <= off {
+		w := s.want[0]
+		s.want = s.want[1:]
+		if w.off == off || w.off < s.pos {
+			continue
+		}
+		if s.keptBytes+w.n > maxBuffered {
+			return nil, fmt.Errorf("more than %d bytes come before where they are needed: %w", maxBuffered, ErrNotStreamable)
+		}
+		if err := s.skip(w.off); err != nil {
+			return nil, err
+		}
+		b, err := s.readFull(w.n)
+		if err != nil {
+			return nil, err
+		}
+		s.kept[w.off] = b
+		s.keptBytes += w.n
+	}
+	if err := s.skip(off); err != nil {
+		return nil, err
+	}
+	return s.readFull(n)
+}
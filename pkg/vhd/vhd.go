@@ -0,0 +1,283 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package vhd reads Virtual Hard Disk images, VHD and VHDX, as the raw
+// images they hold.
+//
+// Fixed and dynamic VHDs and VHDXs are supported; differencing ones, which
+// need their parent, are not. Images are read front to back only, so they
+// can be converted while they are being downloaded and written to a disk.
+// Blocks that come before blocks of the raw image ahead of them are held
+// in memory until they are needed, up to a limit.
+package vhd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Signatures at the start of images. Fixed VHDs start with the raw image,
+// and have VHDCookie only in the footer at their end.
+const (
+	VHDCookie     = "conectix"
+	VHDXSignature = "vhdxfile"
+)
+
+// ErrNotStreamable is returned when data is needed after it was read past,
+// or when too much had to be held in memory until it is needed. Such
+// images have to be downloaded first.
+var ErrNotStreamable = errors.New("image cannot be read front to back")
+
+// VHD disk types.
+const (
+	diskFixed        = 2
+	diskDynamic      = 3
+	diskDifferencing = 4
+)
+
+const (
+	footerSize        = 512
+	dynamicHeaderSize = 1024
+	sectorSize        = 512
+	unallocated       = 0xFFFFFFFF
+)
+
+// Reader reads the raw image held by a VHD or VHDX.
+type Reader struct {
+	// Format is "vhd" or "vhdx".
+	Format string
+
+	// Fixed is set for fixed VHDs.
+	Fixed bool
+
+	// Size is the size of the raw image. It is -1 for fixed VHDs until
+	// their footer has been read, at the end.
+	Size int64
+
+	r io.Reader
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+// NewReader reads the headers of the VHD or VHDX in r.
+func NewReader(r io.Reader) (*Reader, error) {
+	sig := make([]byte, 8)
+	n, err := io.ReadFull(r, sig)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("reading VHD: %v", err)
+	}
+	r = io.MultiReader(bytes.NewReader(sig[:n]), r)
+
+	switch string(sig) {
+	case VHDXSignature:
+		return newVHDX(newStream(r))
+	case VHDCookie:
+		return newDynamic(newStream(r))
+	}
+	f := &fixed{r: r, buf: make([]byte, 0, 64<<10)}
+	vr := &Reader{Format: "vhd", Fixed: true, Size: -1, r: f}
+	f.footer = func(b []byte) error {
+		size, err := parseFooter(b, diskFixed)
+		if err != nil {
+			return err
+		}
+		if size != f.n {
+			return fmt.Errorf("VHD footer says the image is %d bytes, not %d", size, f.n)
+		}
+		vr.Size = size
+		return nil
+	}
+	return vr, nil
+}
+
+// parseFooter checks a VHD footer of a disk of type typ, and returns the
+// size of the raw image.
+func parseFooter(b []byte, typ uint32) (int64, error) {
+	if len(b) != footerSize || string(b[:8]) != VHDCookie {
+		return 0, errors.New("not a VHD: no footer")
+	}
+	be := binary.BigEndian
+	if sum := checksum(b, 64); sum != be.Uint32(b[64:]) {
+		return 0, fmt.Errorf("VHD footer checksum is %#x, want %#x", be.Uint32(b[64:]), sum)
+	}
+	switch t := be.Uint32(b[60:]); {
+	case t == diskDifferencing:
+		return 0, errors.New("differencing VHDs are not supported")
+	case t != typ:
+		return 0, fmt.Errorf("VHD of disk type %d is not supported here", t)
+	}
+	return int64(be.Uint64(b[48:])), nil
+}
+
+// checksum returns the one's complement of the sum of the bytes of b,
+// but the 4 byte checksum at off.
+func checksum(b []byte, off int) uint32 {
+	var sum uint32
+	for i, c := range b {
+		if i < off || i >= off+4 {
+			sum += uint32(c)
+		}
+	}
+	return ^sum
+}
+
+// fixed reads the raw image of a fixed VHD, holding back the footer.
+type fixed struct {
+	r   io.Reader
+	buf []byte
+	err error
+
+	// n is how many bytes of the raw image were read.
+	n int64
+
+	// footer checks the footer once it was read.
+	footer func([]byte) error
+}
+
+func (f *fixed) Read(p []byte) (int, error) {
+	for len(f.buf) <= footerSize && f.err == nil {
+		n, err := f.r.Read(f.buf[len(f.buf):cap(f.buf)])
+		f.buf = f.buf[:len(f.buf)+n]
+		f.err = err
+	}
+	if avail := len(f.buf) - footerSize; avail > 0 {
+		n := copy(p, f.buf[:avail])
+		f.buf = f.buf[:copy(f.buf, f.buf[n:])]
+		f.n += int64(n)
+		return n, nil
+	}
+	if f.err != io.EOF {
+		return 0, f.err
+	}
+	if f.footer != nil {
+		if err := f.footer(f.buf); err != nil {
+			f.err = err
+			return 0, err
+		}
+		f.footer = nil
+	}
+	return 0, io.EOF
+}
+
+// blockReader reads a raw image of blocks, of which block returns the data, or
+// nil for blocks of zeroes.
+type blockReader struct {
+	size      int64
+	blockSize int64
+	block     func(i int64) ([]byte, error)
+
+	// off is the offset of the next byte of the raw image to be read,
+	// buf the rest of its block.
+	off   int64
+	buf   []byte
+	zeros []byte
+}
+
+func (b *blockReader) Read(p []byte) (int, error) {
+	if b.off >= b.size {
+		return 0, io.EOF
+	}
+	if len(b.buf) == 0 {
+		d, err := b.block(b.off / b.blockSize)
+		if err != nil {
+			return 0, err
+		}
+		if d == nil {
+			if b.zeros == nil {
+				b.zeros = make([]byte, b.blockSize)
+			}
+			d = b.zeros
+		}
+		if rest := b.size - b.off; int64(len(d)) > rest {
+			d = d[:rest]
+		}
+		b.buf = d
+	}
+	n := copy(p, b.buf)
+	b.buf = b.buf[n:]
+	b.off += int64(n)
+	return n, nil
+}
+
+// newDynamic reads the headers and block allocation table of a dynamic
+// VHD.
+func newDynamic(s *stream) (*Reader, error) {
+	f, err := s.read(0, footerSize)
+	if err != nil {
+		return nil, fmt.Errorf("reading VHD footer: %w", err)
+	}
+	size, err := parseFooter(f, diskDynamic)
+	if err != nil {
+		return nil, err
+	}
+
+	be := binary.BigEndian
+	h, err := s.read(int64(be.Uint64(f[16:])), dynamicHeaderSize)
+	if err != nil {
+		return nil, fmt.Errorf("reading VHD dynamic header: %w", err)
+	}
+	if string(h[:8]) != "cxsparse" {
+		return nil, errors.New("VHD has no dynamic header")
+	}
+	if sum := checksum(h, 36); sum != be.Uint32(h[36:]) {
+		return nil, fmt.Errorf("VHD dynamic header checksum is %#x, want %#x", be.Uint32(h[36:]), sum)
+	}
+	entries := int64(be.Uint32(h[28:]))
+	blockSize := int64(be.Uint32(h[32:]))
+	if blockSize == 0 || blockSize%sectorSize != 0 {
+		return nil, fmt.Errorf("VHD block size %d is invalid", blockSize)
+	}
+	if entries*blockSize < size {
+		return nil, fmt.Errorf("VHD of %d blocks of %d bytes is smaller than its size %d", entries, blockSize, size)
+	}
+	t, err := s.read(int64(be.Uint64(h[16:])), 4*entries)
+	if err != nil {
+		return nil, fmt.Errorf("reading VHD block allocation table: %w", err)
+	}
+
+	// Blocks start with a bitmap of the sectors that hold data, padded to
+	// a sector.
+	bitmap := (blockSize/sectorSize + 7) / 8
+	bitmap = (bitmap + sectorSize - 1) / sectorSize * sectorSize
+	bat := make([]uint32, entries)
+	var allocated []extent
+	for i := range bat {
+		bat[i] = be.Uint32(t[4*i:])
+		if bat[i] != unallocated {
+			allocated = append(allocated, extent{int64(bat[i]) * sectorSize, bitmap + blockSize})
+		}
+	}
+	s.expect(allocated...)
+	b := &blockReader{
+		size:      size,
+		blockSize: blockSize,
+		block: func(i int64) ([]byte, error) {
+			if bat[i] == unallocated {
+				return nil, nil
+			}
+			off := int64(bat[i]) * sectorSize
+			d, err := s.read(off, bitmap+blockSize)
+			if err != nil {
+				return nil, fmt.Errorf("reading VHD block %d at %#x: %w", i, off, err)
+			}
+			bm, d := d[:bitmap], d[bitmap:]
+			for j := int64(0); j < blockSize/sectorSize; j++ {
+				if bm[j/8]&(0x80>>(j%8)) == 0 {
+					sector := d[j*sectorSize : (j+1)*sectorSize]
+					for k := range sector {
+						sector[k] = 0
+					}
+				}
+			}
+			return d, nil
+		},
+	}
+	return &Reader{Format: "vhd", Size: size, r: b}, nil
+}
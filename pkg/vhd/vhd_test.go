@@ -0,0 +1,244 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vhd
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// rawImage returns n bytes of random data around a block of zeroes, and
+// ending in zeroes.
+func rawImage(n, block int) []byte {
+	b := make([]byte, n)
+	r := rand.New(rand.NewSource(1))
+	r.Read(b[:block])
+	r.Read(b[2*block : 3*block])
+	// Sector 1 is zeroes, which dynamicVHD leaves out of its bitmap.
+	for i := range b[sectorSize : 2*sectorSize] {
+		b[sectorSize+i] = 0
+	}
+	return b
+}
+
+func footer(typ uint32, size int64, dataOffset uint64) []byte {
+	f := make([]byte, footerSize)
+	be := binary.BigEndian
+	copy(f, VHDCookie)
+	be.PutUint32(f[8:], 2)
+	be.PutUint32(f[12:], 0x00010000)
+	be.PutUint64(f[16:], dataOffset)
+	be.PutUint64(f[40:], uint64(size))
+	be.PutUint64(f[48:], uint64(size))
+	be.PutUint32(f[60:], typ)
+	be.PutUint32(f[64:], checksum(f, 64))
+	return f
+}
+
+func fixedVHD(raw []byte) []byte {
+	return append(append([]byte{}, raw...), footer(diskFixed, int64(len(raw)), 0xFFFFFFFFFFFFFFFF)...)
+}
+
+// dynamicVHD returns raw as a dynamic VHD of 4096 byte blocks, leaving
+// blocks of zeroes unallocated, and storing blocks in reverse order.
+// Sector 1 of block 0 is left out of its bitmap, with garbage in it.
+func dynamicVHD(raw []byte) []byte {
+	const bs = 4096
+	be := binary.BigEndian
+	entries := (len(raw) + bs - 1) / bs
+	img := footer(diskDynamic, int64(len(raw)), footerSize)
+
+	h := make([]byte, dynamicHeaderSize)
+	copy(h, "cxsparse")
+	be.PutUint64(h[8:], 0xFFFFFFFFFFFFFFFF)
+	be.PutUint64(h[16:], 3*sectorSize)
+	be.PutUint32(h[24:], 0x00010000)
+	be.PutUint32(h[28:], uint32(entries))
+	be.PutUint32(h[32:], bs)
+	be.PutUint32(h[36:], checksum(h, 36))
+	img = append(img, h...)
+
+	bat := make([]byte, (4*entries+sectorSize-1)/sectorSize*sectorSize)
+	img = append(img, bat...)
+	for i := entries - 1; i >= 0; i-- {
+		b := make([]byte, bs)
+		copy(b, raw[i*bs:])
+		if isZero(b) {
+			be.PutUint32(img[3*sectorSize+4*i:], unallocated)
+			continue
+		}
+		be.PutUint32(img[3*sectorSize+4*i:], uint32(len(img)/sectorSize))
+		bitmap := make([]byte, sectorSize)
+		bitmap[0] = 0xFF
+		if i == 0 {
+			bitmap[0] = 0xBF
+			copy(b[sectorSize:2*sectorSize], bytes.Repeat([]byte("garbage!"), sectorSize/8))
+		}
+		img = append(append(img, bitmap...), b...)
+	}
+	return append(img, footer(diskDynamic, int64(len(raw)), footerSize)...)
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// vhdx returns raw as a VHDX of 1 MiB blocks. Blocks of zeroes are
+// marked zero and the others stored in reverse order.
+func vhdx(raw []byte, edit func(header []byte)) []byte {
+	le := binary.LittleEndian
+	crc := func(b []byte) {
+		le.PutUint32(b[4:], crc32.Checksum(b, castagnoli))
+	}
+	img := make([]byte, 3*mib)
+	copy(img, VHDXSignature)
+	for i, off := range vhdxHeaders {
+		h := img[off : off+vhdxHeaderSize]
+		copy(h, "head")
+		le.PutUint64(h[8:], uint64(i))
+		le.PutUint16(h[66:], 1)
+		if edit != nil {
+			edit(h)
+		}
+		crc(h)
+	}
+	for _, off := range vhdxRegionTables {
+		rt := img[off : off+vhdxRegionTableSize]
+		copy(rt, "regi")
+		le.PutUint32(rt[8:], 2)
+		copy(rt[16:], regionBAT[:])
+		le.PutUint64(rt[32:], 2*mib)
+		le.PutUint32(rt[40:], mib)
+		le.PutUint32(rt[44:], 1)
+		copy(rt[48:], regionMetadata[:])
+		le.PutUint64(rt[64:], mib)
+		le.PutUint32(rt[72:], mib)
+		le.PutUint32(rt[76:], 1)
+		crc(rt)
+	}
+
+	m := img[mib:]
+	copy(m, "metadata")
+	le.PutUint16(m[10:], 3)
+	for i, it := range []struct {
+		id    [16]byte
+		value []byte
+	}{
+		{itemFileParameters, []byte{0, 0, 0x10, 0, 0, 0, 0, 0}},
+		{itemVirtualDiskSize, []byte{byte(len(raw)), byte(len(raw) >> 8), byte(len(raw) >> 16), byte(len(raw) >> 24), 0, 0, 0, 0}},
+		{itemLogicalSectorSize, []byte{0, 2, 0, 0}},
+	} {
+		e := m[32+32*i:]
+		copy(e, it.id[:])
+		le.PutUint32(e[16:], uint32(64<<10+8*i))
+		le.PutUint32(e[20:], uint32(len(it.value)))
+		le.PutUint32(e[24:], 4)
+		copy(m[64<<10+8*i:], it.value)
+	}
+
+	bat := make([]byte, mib)
+	blocks := (len(raw) + mib - 1) / mib
+	for i := blocks - 1; i >= 0; i-- {
+		b := make([]byte, mib)
+		copy(b, raw[i*mib:])
+		if isZero(b) {
+			le.PutUint64(bat[8*i:], blockZero)
+			continue
+		}
+		le.PutUint64(bat[8*i:], uint64(len(img))|blockFullyPresent)
+		img = append(img, b...)
+	}
+	copy(img[2*mib:], bat)
+	return img
+}
+
+func TestReader(t *testing.T) {
+	small := rawImage(5*4096+1024, 4096)
+	big := rawImage(3*mib+1000, mib)
+	for _, tt := range []struct {
+		name   string
+		img    []byte
+		raw    []byte
+		format string
+		fixed  bool
+	}{
+		{"fixed VHD", fixedVHD(small), small, "vhd", true},
+		{"dynamic VHD", dynamicVHD(small), small, "vhd", false},
+		{"VHDX", vhdx(big, nil), big, "vhdx", false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReader(iotest.HalfReader(bytes.NewReader(tt.img)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Format != tt.format || r.Fixed != tt.fixed {
+				t.Errorf("format %s, fixed %v, want %s, %v", r.Format, r.Fixed, tt.format, tt.fixed)
+			}
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.raw) {
+				t.Errorf("read %d bytes that are not the raw image of %d", len(got), len(tt.raw))
+			}
+			if r.Size != int64(len(tt.raw)) {
+				t.Errorf("Size = %d, want %d", r.Size, len(tt.raw))
+			}
+		})
+	}
+}
+
+func TestNotStreamable(t *testing.T) {
+	defer func(m int64) { maxBuffered = m }(maxBuffered)
+	maxBuffered = 4096
+
+	r, err := NewReader(bytes.NewReader(dynamicVHD(rawImage(5*4096, 4096))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ioutil.ReadAll(r); !errors.Is(err, ErrNotStreamable) {
+		t.Errorf("reading with too little buffer = %v, want ErrNotStreamable", err)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	raw := rawImage(5*4096, 4096)
+	badFooter := fixedVHD(raw)
+	badFooter[len(badFooter)-1]++
+	for _, tt := range []struct {
+		name string
+		img  []byte
+		want string
+	}{
+		{"fixed VHD without footer", raw, "no footer"},
+		{"fixed VHD with bad checksum", badFooter, "checksum"},
+		{"fixed VHD of another size", append(raw[:4096:4096], footer(diskFixed, 5*4096, 0)...), "image is 20480 bytes, not 4096"},
+		{"differencing VHD", footer(diskDifferencing, 4096, footerSize), "differencing"},
+		{"VHDX with a log", vhdx(raw, func(h []byte) { h[48] = 1 }), "log to replay"},
+		{"VHDX of version 2", vhdx(raw, func(h []byte) { h[66] = 2 }), "version 2"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReader(bytes.NewReader(tt.img))
+			if err == nil {
+				_, err = ioutil.ReadAll(r)
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("reading = %v, want an error with %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,262 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vhd
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strings"
+)
+
+// VHDX structures, see the MS-VHDX specification.
+const (
+	vhdxHeaderSize      = 4 << 10
+	vhdxRegionTableSize = 64 << 10
+	mib                 = 1 << 20
+)
+
+// Offsets of the two copies of the header and the region table.
+var (
+	vhdxHeaders      = []int64{64 << 10, 128 << 10}
+	vhdxRegionTables = []int64{192 << 10, 256 << 10}
+)
+
+// guid returns the on-disk form of GUID s, with its first three fields
+// little endian.
+func guid(s string) [16]byte {
+	b, err := hex.DecodeString(strings.Replace(s, "-", "", -1))
+	if err != nil || len(b) != 16 {
+		panic("bad GUID " + s)
+	}
+	var g [16]byte
+	copy(g[:], b)
+	g[0], g[1], g[2], g[3] = b[3], b[2], b[1], b[0]
+	g[4], g[5] = b[5], b[4]
+	g[6], g[7] = b[7], b[6]
+	return g
+}
+
+// Regions and metadata items.
+var (
+	regionBAT      = guid("2DC27766-F623-4200-9D64-115E9BFD4A08")
+	regionMetadata = guid("8B7CA206-4790-4B9A-B8FE-575F050F886E")
+
+	itemFileParameters    = guid("CAA16737-FA36-4D43-B3B6-33F0AA44E76B")
+	itemVirtualDiskSize   = guid("2FA54224-CD1B-4876-B211-5DBED83BF4B8")
+	itemLogicalSectorSize = guid("8141BF1D-A96F-4709-BA47-F233A8FAAB5F")
+	itemPhysSectorSize    = guid("CDA348C7-445D-4471-9CC9-E9885251C556")
+	itemVirtualDiskID     = guid("BECA12AB-B2E6-4523-93EF-C309E000C746")
+	itemParentLocator     = guid("A8D35F2D-B30B-454D-ABF7-D3D84834AB0C")
+)
+
+// Payload block states in the BAT.
+const (
+	blockNotPresent       = 0
+	blockUndefined        = 1
+	blockZero             = 2
+	blockUnmapped         = 3
+	blockFullyPresent     = 6
+	blockPartiallyPresent = 7
+)
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// validCRC returns whether the CRC-32C of b, with its checksum at 4 taken
+// as 0, is that checksum.
+func validCRC(b []byte) bool {
+	c := make([]byte, len(b))
+	copy(c, b)
+	copy(c[4:8], []byte{0, 0, 0, 0})
+	return crc32.Checksum(c, castagnoli) == binary.LittleEndian.Uint32(b[4:])
+}
+
+// newVHDX reads the headers, metadata and BAT of a VHDX.
+func newVHDX(s *stream) (*Reader, error) {
+	le := binary.LittleEndian
+	if id, err := s.read(0, 8); err != nil || string(id) != VHDXSignature {
+		return nil, errors.New("not a VHDX")
+	}
+
+	// The current header is the valid one with the higher sequence
+	// number.
+	var h []byte
+	for _, off := range vhdxHeaders {
+		b, err := s.read(off, vhdxHeaderSize)
+		if err != nil {
+			return nil, fmt.Errorf("reading VHDX header: %w", err)
+		}
+		if string(b[:4]) != "head" || !validCRC(b) {
+			continue
+		}
+		if h == nil || le.Uint64(b[8:]) > le.Uint64(h[8:]) {
+			h = b
+		}
+	}
+	if h == nil {
+		return nil, errors.New("VHDX has no valid header")
+	}
+	if v := le.Uint16(h[66:]); v != 1 {
+		return nil, fmt.Errorf("VHDX version %d is not supported", v)
+	}
+	var zero [16]byte
+	if string(h[48:64]) != string(zero[:]) {
+		return nil, errors.New("VHDX has a log to replay, which is not supported; open it on Windows first")
+	}
+
+	var rt []byte
+	for _, off := range vhdxRegionTables {
+		b, err := s.read(off, vhdxRegionTableSize)
+		if err != nil {
+			return nil, fmt.Errorf("reading VHDX region table: %w", err)
+		}
+		if rt == nil && string(b[:4]) == "regi" && validCRC(b) {
+			rt = b
+		}
+	}
+	if rt == nil {
+		return nil, errors.New("VHDX has no valid region table")
+	}
+	var bat, meta extent
+	n := int(le.Uint32(rt[8:]))
+	if n > (vhdxRegionTableSize-16)/32 {
+		return nil, fmt.Errorf("VHDX region table has %d entries", n)
+	}
+	for i := 0; i < n; i++ {
+		e := rt[16+32*i:]
+		r := extent{int64(le.Uint64(e[16:])), int64(le.Uint32(e[24:]))}
+		switch string(e[:16]) {
+		case string(regionBAT[:]):
+			bat = r
+		case string(regionMetadata[:]):
+			meta = r
+		default:
+			if le.Uint32(e[28:])&1 != 0 {
+				return nil, fmt.Errorf("VHDX has an unknown required region %x", e[:16])
+			}
+		}
+	}
+	if bat.n == 0 || meta.n == 0 {
+		return nil, errors.New("VHDX has no BAT or metadata region")
+	}
+	s.expect(bat, meta)
+
+	m, err := s.read(meta.off, meta.n)
+	if err != nil {
+		return nil, fmt.Errorf("reading VHDX metadata: %w", err)
+	}
+	blockSize, size, lss, err := parseMetadata(m)
+	if err != nil {
+		return nil, err
+	}
+	t, err := s.read(bat.off, bat.n)
+	if err != nil {
+		return nil, fmt.Errorf("reading VHDX BAT: %w", err)
+	}
+
+	// A sector bitmap entry follows every chunkRatio payload entries.
+	chunkRatio := (1 << 23) * lss / blockSize
+	blocks := (size + blockSize - 1) / blockSize
+	entries := make([]uint64, blocks)
+	var present []extent
+	for i := range entries {
+		j := int64(i) + int64(i)/chunkRatio
+		if 8*(j+1) > int64(len(t)) {
+			return nil, fmt.Errorf("VHDX BAT of %d bytes does not cover %d blocks", len(t), blocks)
+		}
+		entries[i] = le.Uint64(t[8*j:])
+		if entries[i]&7 == blockFullyPresent {
+			present = append(present, extent{int64(entries[i]>>20) * mib, blockSize})
+		}
+	}
+	s.expect(present...)
+
+	r := &Reader{Format: "vhdx", Size: size}
+	r.r = &blockReader{
+		size:      size,
+		blockSize: blockSize,
+		block: func(i int64) ([]byte, error) {
+			e := entries[i]
+			switch e & 7 {
+			case blockNotPresent, blockUndefined, blockZero, blockUnmapped:
+				return nil, nil
+			case blockFullyPresent:
+				off := int64(e>>20) * mib
+				d, err := s.read(off, blockSize)
+				if err != nil {
+					return nil, fmt.Errorf("reading VHDX block %d at %#x: %w", i, off, err)
+				}
+				return d, nil
+			case blockPartiallyPresent:
+				return nil, errors.New("differencing VHDXs are not supported")
+			}
+			return nil, fmt.Errorf("VHDX block %d has invalid state %d", i, e&7)
+		},
+	}
+	return r, nil
+}
+
+// parseMetadata returns the block size, virtual disk size and logical
+// sector size of the VHDX metadata region m.
+func parseMetadata(m []byte) (blockSize, size, lss int64, err error) {
+	le := binary.LittleEndian
+	if len(m) < 32 || string(m[:8]) != "metadata" {
+		return 0, 0, 0, errors.New("VHDX has no metadata table")
+	}
+	n := int(le.Uint16(m[10:]))
+	if 32+32*n > len(m) {
+		return 0, 0, 0, fmt.Errorf("VHDX metadata table has %d entries", n)
+	}
+	item := func(e []byte, size int) ([]byte, error) {
+		off, l := int(le.Uint32(e[16:])), int(le.Uint32(e[20:]))
+		if l < size || off+l > len(m) {
+			return nil, fmt.Errorf("VHDX metadata item %x of %d bytes at %d is invalid", e[:16], l, off)
+		}
+		return m[off : off+size], nil
+	}
+	for i := 0; i < n; i++ {
+		e := m[32+32*i:]
+		switch string(e[:16]) {
+		case string(itemFileParameters[:]):
+			b, err := item(e, 8)
+			if err != nil {
+				return 0, 0, 0, err
+			}
+			if le.Uint32(b[4:])&2 != 0 {
+				return 0, 0, 0, errors.New("differencing VHDXs are not supported")
+			}
+			blockSize = int64(le.Uint32(b))
+		case string(itemVirtualDiskSize[:]):
+			b, err := item(e, 8)
+			if err != nil {
+				return 0, 0, 0, err
+			}
+			size = int64(le.Uint64(b))
+		case string(itemLogicalSectorSize[:]):
+			b, err := item(e, 4)
+			if err != nil {
+				return 0, 0, 0, err
+			}
+			lss = int64(le.Uint32(b))
+		case string(itemPhysSectorSize[:]), string(itemVirtualDiskID[:]), string(itemParentLocator[:]):
+		default:
+			if le.Uint32(e[24:])&4 != 0 {
+				return 0, 0, 0, fmt.Errorf("VHDX has an unknown required metadata item %x", e[:16])
+			}
+		}
+	}
+	if blockSize < mib || blockSize > 256*mib || blockSize&(blockSize-1) != 0 {
+		return 0, 0, 0, fmt.Errorf("VHDX block size %d is invalid", blockSize)
+	}
+	if lss != 512 && lss != 4096 {
+		return 0, 0, 0, fmt.Errorf("VHDX logical sector size %d is invalid", lss)
+	}
+	if size <= 0 {
+		return 0, 0, 0, fmt.Errorf("VHDX virtual disk size %d is invalid", size)
+	}
+	return blockSize, size, lss, nil
+}
@@ -0,0 +1,247 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package vmdk reads streamOptimized VMware disk images, as published for
+// clouds and in OVAs, as the raw images they hold.
+//
+// A streamOptimized VMDK is a sparse extent whose grains are compressed
+// and preceded by markers, in the order of the raw image, so it is read
+// front to back without its grain tables. Other kinds of VMDK, which need
+// random access or more than one file, are not supported.
+package vmdk
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// Magic starts every sparse extent, "KDMV".
+const Magic = "KDMV"
+
+const (
+	sectorSize = 512
+
+	// Header flags of streamOptimized extents.
+	flagCompressed = 1 << 16
+	flagMarkers    = 1 << 17
+
+	compressionDeflate = 1
+)
+
+// Marker types, for markers of metadata.
+const (
+	markerEOS    = 0
+	markerGT     = 1
+	markerGD     = 2
+	markerFooter = 3
+)
+
+// Header is the header of a sparse extent. Sizes and offsets are in
+// sectors.
+type Header struct {
+	Version          uint32
+	Flags            uint32
+	Capacity         uint64
+	GrainSize        uint64
+	DescriptorOffset uint64
+	DescriptorSize   uint64
+	NumGTEsPerGT     uint32
+	RGDOffset        uint64
+	GDOffset         uint64
+	OverHead         uint64
+	UncleanShutdown  uint8
+	EndLineChars     [4]byte
+	Compression      uint16
+}
+
+// Reader reads the raw image held by a streamOptimized VMDK.
+type Reader struct {
+	Header
+
+	// Size is the size of the raw image.
+	Size int64
+
+	r   io.Reader
+	pos int64
+
+	// off is the offset of the next byte of the raw image to be read.
+	off int64
+
+	// grain is the next grain, at grainOff of the raw image; buf is
+	// what is left of it to be read.
+	grain    []byte
+	grainOff int64
+	buf      []byte
+	eos      bool
+
+	zlib  io.ReadCloser
+	zeros []byte
+}
+
+// NewReader reads the header of the streamOptimized VMDK in r, and skips
+// to its first grain.
+func NewReader(r io.Reader) (*Reader, error) {
+	b := make([]byte, sectorSize)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, fmt.Errorf("reading VMDK header: %v", err)
+	}
+	if string(b[:4]) != Magic {
+		return nil, errors.New("not a sparse VMDK extent")
+	}
+	var h Header
+	if err := binary.Read(bytes.NewReader(b[4:]), binary.LittleEndian, &h); err != nil {
+		return nil, err
+	}
+	if h.Flags&(flagCompressed|flagMarkers) != flagCompressed|flagMarkers {
+		return nil, errors.New("VMDK is not streamOptimized; only streamOptimized VMDKs are supported")
+	}
+	if h.Compression != compressionDeflate {
+		return nil, fmt.Errorf("VMDK compression %d is not supported", h.Compression)
+	}
+	if h.GrainSize == 0 || h.GrainSize > 1<<16 {
+		return nil, fmt.Errorf("VMDK grain size of %d sectors is invalid", h.GrainSize)
+	}
+	if h.Capacity > 1<<54 {
+		return nil, fmt.Errorf("VMDK capacity of %d sectors is invalid", h.Capacity)
+	}
+	vr := &Reader{
+		Header: h,
+		Size:   int64(h.Capacity) * sectorSize,
+		r:      r,
+		pos:    sectorSize,
+		grain:  make([]byte, h.GrainSize*sectorSize),
+	}
+	// The descriptor and any grain directory come before the grains.
+	if err := vr.skip(int64(h.OverHead) * sectorSize); err != nil {
+		return nil, err
+	}
+	return vr, nil
+}
+
+// skip reads past the file up to off.
+func (r *Reader) skip(off int64) error {
+	if off < r.pos {
+		return fmt.Errorf("VMDK data at %#x is behind %#x", off, r.pos)
+	}
+	n, err := io.CopyN(ioutil.Discard, r.r, off-r.pos)
+	r.pos += n
+	if err != nil {
+		return fmt.Errorf("VMDK ends at %#x, before %#x", r.pos, off)
+	}
+	return nil
+}
+
+// alignedSkip skips to the next sector.
+func (r *Reader) alignedSkip() error {
+	return r.skip((r.pos + sectorSize - 1) / sectorSize * sectorSize)
+}
+
+// next reads up to the next grain, skipping metadata, and decompresses it,
+// or sets eos at the end of the stream.
+func (r *Reader) next() error {
+	for {
+		var m [12]byte
+		if _, err := io.ReadFull(r.r, m[:]); err != nil {
+			return fmt.Errorf("VMDK ends at %#x without an end-of-stream marker", r.pos)
+		}
+		r.pos += int64(len(m))
+		val, size := binary.LittleEndian.Uint64(m[:]), binary.LittleEndian.Uint32(m[8:])
+
+		if size == 0 {
+			// A metadata marker takes a sector, followed by val
+			// sectors of metadata.
+			var t [4]byte
+			if _, err := io.ReadFull(r.r, t[:]); err != nil {
+				return fmt.Errorf("VMDK ends in the marker at %#x", r.pos-12)
+			}
+			r.pos += 4
+			typ := binary.LittleEndian.Uint32(t[:])
+			if err := r.alignedSkip(); err != nil {
+				return err
+			}
+			switch typ {
+			case markerEOS:
+				r.eos = true
+				return nil
+			case markerGT, markerGD, markerFooter:
+			default:
+				return fmt.Errorf("VMDK marker at %#x has unknown type %d", r.pos-sectorSize, typ)
+			}
+			if err := r.skip(r.pos + int64(val)*sectorSize); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// A grain marker, of the grain at sector val, followed by size
+		// bytes of the compressed grain.
+		off := int64(val) * sectorSize
+		if val%r.GrainSize != 0 || off < r.off {
+			return fmt.Errorf("VMDK grain at sector %d is out of place after %d", val, r.off/sectorSize)
+		}
+		lr := &io.LimitedReader{R: r.r, N: int64(size)}
+		if r.zlib == nil {
+			z, err := zlib.NewReader(lr)
+			if err != nil {
+				return fmt.Errorf("VMDK grain at sector %d: %v", val, err)
+			}
+			r.zlib = z
+		} else if err := r.zlib.(zlib.Resetter).Reset(lr, nil); err != nil {
+			return fmt.Errorf("VMDK grain at sector %d: %v", val, err)
+		}
+		n, err := io.ReadFull(r.zlib, r.grain)
+		// Grains past the capacity may be short.
+		if err != nil && !(err == io.ErrUnexpectedEOF && off+int64(n) >= r.Size) {
+			return fmt.Errorf("VMDK grain at sector %d: %v", val, err)
+		}
+		r.grainOff, r.buf = off, r.grain[:n]
+		r.pos += int64(size) - lr.N
+		if err := r.skip(r.pos + lr.N); err != nil {
+			return err
+		}
+		return r.alignedSkip()
+	}
+}
+
+// Read implements io.Reader.
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.off >= r.Size {
+		return 0, io.EOF
+	}
+	if len(r.buf) == 0 && !r.eos && r.grainOff <= r.off {
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+	if rest := r.Size - r.off; int64(len(p)) > rest {
+		p = p[:rest]
+	}
+
+	// Sectors up to the next grain are zeroes.
+	if r.eos || r.off < r.grainOff {
+		if !r.eos {
+			if gap := r.grainOff - r.off; int64(len(p)) > gap {
+				p = p[:gap]
+			}
+		}
+		if r.zeros == nil {
+			r.zeros = make([]byte, len(r.grain))
+		}
+		if len(p) > len(r.zeros) {
+			p = p[:len(r.zeros)]
+		}
+		n := copy(p, r.zeros)
+		r.off += int64(n)
+		return n, nil
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	r.off += int64(n)
+	return n, nil
+}
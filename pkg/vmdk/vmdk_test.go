@@ -0,0 +1,128 @@
+// Copyright 2020 the u-root Authors. All rights reserved
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package vmdk
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io/ioutil"
+	"math/rand"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+const testGrain = 8 // sectors
+
+type grain struct {
+	lba  uint64
+	data []byte
+}
+
+// streamOptimized returns a streamOptimized VMDK of capacity sectors
+// holding grains, with a grain table and a footer after them.
+func streamOptimized(capacity uint64, flags uint32, grains []grain) []byte {
+	le := binary.LittleEndian
+	pad := func(b []byte) []byte {
+		return append(b, make([]byte, (sectorSize-len(b)%sectorSize)%sectorSize)...)
+	}
+	header := func() []byte {
+		h := make([]byte, sectorSize)
+		copy(h, Magic)
+		le.PutUint32(h[4:], 3)
+		le.PutUint32(h[8:], flags)
+		le.PutUint64(h[12:], capacity)
+		le.PutUint64(h[20:], testGrain)
+		le.PutUint64(h[28:], 1)
+		le.PutUint64(h[36:], 1)
+		le.PutUint32(h[44:], 512)
+		le.PutUint64(h[56:], 0xFFFFFFFFFFFFFFFF)
+		le.PutUint64(h[64:], 2)
+		copy(h[73:], "\n \r\n")
+		le.PutUint16(h[77:], compressionDeflate)
+		return h
+	}
+	marker := func(sectors uint64, typ uint32) []byte {
+		m := make([]byte, sectorSize)
+		le.PutUint64(m, sectors)
+		le.PutUint32(m[12:], typ)
+		return m
+	}
+
+	img := header()
+	img = append(img, pad([]byte("# Disk DescriptorFile\ncreateType=\"streamOptimized\"\n"))...)
+	for _, g := range grains {
+		var z bytes.Buffer
+		w := zlib.NewWriter(&z)
+		w.Write(g.data)
+		w.Close()
+		m := make([]byte, 12)
+		le.PutUint64(m, g.lba)
+		le.PutUint32(m[8:], uint32(z.Len()))
+		img = append(img, pad(append(m, z.Bytes()...))...)
+	}
+	img = append(img, marker(1, markerGT)...)
+	img = append(img, make([]byte, sectorSize)...)
+	img = append(img, marker(1, markerFooter)...)
+	img = append(img, header()...)
+	return append(img, marker(0, markerEOS)...)
+}
+
+func TestReader(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	g0, g2 := make([]byte, testGrain*sectorSize), make([]byte, testGrain*sectorSize)
+	r.Read(g0)
+	r.Read(g2)
+	const capacity = 5*testGrain - 3
+	raw := make([]byte, capacity*sectorSize)
+	copy(raw, g0)
+	copy(raw[2*testGrain*sectorSize:], g2)
+
+	img := streamOptimized(capacity, 1|flagCompressed|flagMarkers, []grain{{0, g0}, {2 * testGrain, g2}})
+	vr, err := NewReader(iotest.HalfReader(bytes.NewReader(img)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vr.Size != int64(len(raw)) || vr.GrainSize != testGrain {
+		t.Errorf("size %d, grain size %d, want %d, %d", vr.Size, vr.GrainSize, len(raw), testGrain)
+	}
+	got, err := ioutil.ReadAll(vr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, raw) {
+		t.Errorf("read %d bytes that are not the raw image of %d", len(got), len(raw))
+	}
+}
+
+func TestErrors(t *testing.T) {
+	g := make([]byte, testGrain*sectorSize)
+	g[0] = 1
+	streamFlags := uint32(flagCompressed | flagMarkers)
+	noEOS := streamOptimized(4*testGrain, streamFlags, []grain{{0, g}})
+	noEOS = noEOS[:len(noEOS)-sectorSize]
+	for _, tt := range []struct {
+		name string
+		img  []byte
+		want string
+	}{
+		{"not a VMDK", make([]byte, sectorSize), "not a sparse VMDK"},
+		{"monolithicSparse", streamOptimized(4*testGrain, 1, nil), "not streamOptimized"},
+		{"grains out of order", streamOptimized(4*testGrain, streamFlags, []grain{{testGrain, g}, {0, g}}), "out of place"},
+		{"misaligned grain", streamOptimized(4*testGrain, streamFlags, []grain{{3, g}}), "out of place"},
+		{"no end of stream", noEOS, "without an end-of-stream marker"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewReader(bytes.NewReader(tt.img))
+			if err == nil {
+				_, err = ioutil.ReadAll(r)
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("reading = %v, want an error with %q", err, tt.want)
+			}
+		})
+	}
+}